@@ -0,0 +1,143 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package accounting keeps per-application, per-client byte and packet
+// counters and exports them as snapshots.
+//
+// Counters are keyed by an application name, which usually comes from an
+// appclass.Engine but can be any protocol detection result, and by the
+// client's IP address.  Traffic is split by direction: sent by the client
+// (out) or received by it (in).
+//
+//	e := appclass.NewEngine(appclass.Conferencing()...)
+//	a := accounting.NewAccountant()
+//	for p := range source.Packets() {
+//	  if f := e.AddFlow(p); f != nil {
+//	    a.AddPacket(f, p)
+//	  }
+//	}
+//	accounting.WriteJSON(os.Stdout, a.Snapshot(true))
+//
+// Snapshots may be written as JSON lines or as IPFIX messages.
+package accounting
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/appclass"
+)
+
+// Unknown is the application name used for flows without a label.
+const Unknown = "unknown"
+
+// Record is the counters for one application and client.
+type Record struct {
+	App        string    `json:"app"`
+	Client     net.IP    `json:"client"`
+	PacketsOut uint64    `json:"packets_out"`
+	BytesOut   uint64    `json:"bytes_out"`
+	PacketsIn  uint64    `json:"packets_in"`
+	BytesIn    uint64    `json:"bytes_in"`
+	First      time.Time `json:"first"`
+	Last       time.Time `json:"last"`
+}
+
+type key struct {
+	app    string
+	client string // net.IP as a string of bytes, so it can be a map key
+}
+
+// Accountant accumulates counters.  It is safe for concurrent use.
+type Accountant struct {
+	mu       sync.Mutex
+	counters map[key]*Record
+}
+
+// NewAccountant creates an empty Accountant.
+func NewAccountant() *Accountant {
+	return &Accountant{counters: map[key]*Record{}}
+}
+
+// Add counts one packet of length bytes for the given application and
+// client.  fromClient is true if the client sent the packet.
+func (a *Accountant) Add(app string, client net.IP, fromClient bool, length int, ts time.Time) {
+	if app == "" {
+		app = Unknown
+	}
+	if ip4 := client.To4(); ip4 != nil {
+		client = ip4
+	}
+	k := key{app, string(client)}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r := a.counters[k]
+	if r == nil {
+		r = &Record{App: app, Client: append(net.IP(nil), client...), First: ts}
+		a.counters[k] = r
+	}
+	if ts.Before(r.First) {
+		r.First = ts
+	}
+	if ts.After(r.Last) {
+		r.Last = ts
+	}
+	if fromClient {
+		r.PacketsOut++
+		r.BytesOut += uint64(length)
+	} else {
+		r.PacketsIn++
+		r.BytesIn += uint64(length)
+	}
+}
+
+// AddPacket counts p against the label of the flow it belongs to.  The
+// packet's original wire length is used if it's known.
+func (a *Accountant) AddPacket(f *appclass.Flow, p gopacket.Packet) {
+	l, _ := f.Label()
+	md := p.Metadata()
+	length := md.Length
+	if length == 0 {
+		length = len(p.Data())
+	}
+	fromClient := true
+	if n := p.NetworkLayer(); n != nil {
+		src, _ := n.NetworkFlow().Endpoints()
+		fromClient = net.IP(src.Raw()).Equal(f.Client)
+	}
+	a.Add(l.App, f.Client, fromClient, length, md.Timestamp)
+}
+
+// Snapshot returns the current counters, ordered by application and then
+// client.  If reset is true the counters are cleared, so the next snapshot
+// holds deltas.
+func (a *Accountant) Snapshot(reset bool) []Record {
+	a.mu.Lock()
+	out := make([]Record, 0, len(a.counters))
+	for _, r := range a.counters {
+		out = append(out, *r)
+	}
+	if reset {
+		a.counters = map[key]*Record{}
+	}
+	a.mu.Unlock()
+	sort.Sort(byAppClient(out))
+	return out
+}
+
+type byAppClient []Record
+
+func (b byAppClient) Len() int      { return len(b) }
+func (b byAppClient) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byAppClient) Less(i, j int) bool {
+	if b[i].App != b[j].App {
+		return b[i].App < b[j].App
+	}
+	return string(b[i].Client) < string(b[j].Client)
+}
@@ -0,0 +1,140 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package accounting
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/appclass"
+	"github.com/mistsys/gopacket/layers"
+)
+
+func udpPacket(t *testing.T, src, dst string, sport, dport uint16, n int, ts time.Time) gopacket.Packet {
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP(src).To4(),
+		DstIP:    net.ParseIP(dst).To4(),
+	}
+	udp := &layers.UDP{SrcPort: layers.UDPPort(sport), DstPort: layers.UDPPort(dport)}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ip, udp, gopacket.Payload(make([]byte, n))); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	p.Metadata().Timestamp = ts
+	return p
+}
+
+func TestAccountantAddPacket(t *testing.T) {
+	e := appclass.NewEngine(appclass.Conferencing()...)
+	a := NewAccountant()
+	start := time.Unix(1000, 0)
+	for i, p := range []gopacket.Packet{
+		udpPacket(t, "10.0.0.2", "170.114.1.1", 50000, 8801, 100, start),
+		udpPacket(t, "170.114.1.1", "10.0.0.2", 8801, 50000, 200, start.Add(time.Second)),
+		udpPacket(t, "10.0.0.2", "203.0.113.1", 50001, 9999, 10, start.Add(2*time.Second)),
+	} {
+		f := e.AddFlow(p)
+		if f == nil {
+			t.Fatalf("packet %d ignored", i)
+		}
+		a.AddPacket(f, p)
+	}
+	got := a.Snapshot(true)
+	if len(got) != 2 {
+		t.Fatalf("got %d records, want 2: %+v", len(got), got)
+	}
+	zoom, unknown := got[0], got[1]
+	if zoom.App != "Zoom" || !zoom.Client.Equal(net.IP{10, 0, 0, 2}) ||
+		zoom.PacketsOut != 1 || zoom.BytesOut != 128 || zoom.PacketsIn != 1 || zoom.BytesIn != 228 ||
+		!zoom.First.Equal(start) || !zoom.Last.Equal(start.Add(time.Second)) {
+		t.Errorf("bad Zoom record %+v", zoom)
+	}
+	if unknown.App != Unknown || unknown.PacketsOut != 1 || unknown.PacketsIn != 0 {
+		t.Errorf("bad unknown record %+v", unknown)
+	}
+	if len(a.Snapshot(false)) != 0 {
+		t.Error("snapshot did not reset counters")
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	a := NewAccountant()
+	a.Add("DNS", net.ParseIP("10.0.0.2"), true, 60, time.Unix(1000, 0))
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, a.Snapshot(false)); err != nil {
+		t.Fatal(err)
+	}
+	var r Record
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.App != "DNS" || r.Client.String() != "10.0.0.2" || r.BytesOut != 60 {
+		t.Errorf("bad JSON round trip %+v from %s", r, buf.Bytes())
+	}
+}
+
+func TestIPFIXExport(t *testing.T) {
+	a := NewAccountant()
+	a.Add("Teams", net.ParseIP("10.0.0.2"), true, 100, time.Unix(1000, 0))
+	a.Add("Teams", net.ParseIP("2001:db8::2"), false, 200, time.Unix(1000, 0))
+	var buf bytes.Buffer
+	x := NewIPFIXExporter(&buf)
+	x.ObservationDomain = 7
+	if err := x.Export(a.Snapshot(false), time.Unix(2000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	msg := buf.Bytes()
+	if v := binary.BigEndian.Uint16(msg[0:2]); v != 10 {
+		t.Fatalf("version %d, want 10", v)
+	}
+	if l := int(binary.BigEndian.Uint16(msg[2:4])); l != len(msg) {
+		t.Fatalf("message length %d, wrote %d", l, len(msg))
+	}
+	if d := binary.BigEndian.Uint32(msg[12:16]); d != 7 {
+		t.Errorf("observation domain %d, want 7", d)
+	}
+	// Walk the sets.
+	var ids []uint16
+	for rest := msg[16:]; len(rest) > 0; {
+		id, l := binary.BigEndian.Uint16(rest[0:2]), int(binary.BigEndian.Uint16(rest[2:4]))
+		if l < 4 || l > len(rest) || l%4 != 0 {
+			t.Fatalf("bad set length %d", l)
+		}
+		ids = append(ids, id)
+		if id == ipfixTemplateIPv4 {
+			// Set header, then applicationId and the client address.
+			if app := binary.BigEndian.Uint32(rest[4:8]); app != ipfixUserDefinedEngine<<24|1 {
+				t.Errorf("applicationId %x", app)
+			}
+			if ip := net.IP(rest[8:12]); !ip.Equal(net.IP{10, 0, 0, 2}) {
+				t.Errorf("client %v", ip)
+			}
+			if n := binary.BigEndian.Uint64(rest[12:20]); n != 100 {
+				t.Errorf("initiatorOctets %d, want 100", n)
+			}
+		}
+		rest = rest[l:]
+	}
+	want := []uint16{ipfixTemplateSetID, ipfixOptionsTemplateSetID, ipfixTemplateAppNames, ipfixTemplateIPv4, ipfixTemplateIPv6}
+	if len(ids) != len(want) {
+		t.Fatalf("sets %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Errorf("sets %v, want %v", ids, want)
+		}
+	}
+}
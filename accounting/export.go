@@ -0,0 +1,233 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package accounting
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// WriteJSON writes each record as a JSON object on its own line.
+func WriteJSON(w io.Writer, recs []Record) error {
+	enc := json.NewEncoder(w)
+	for i := range recs {
+		if err := enc.Encode(&recs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IPFIX information element IDs used by the exporter (RFC 7012, RFC 6759).
+const (
+	ipfixSourceIPv4Address     = 8
+	ipfixSourceIPv6Address     = 27
+	ipfixApplicationID         = 95
+	ipfixApplicationName       = 96
+	ipfixFlowStartMilliseconds = 152
+	ipfixFlowEndMilliseconds   = 153
+	ipfixInitiatorOctets       = 231
+	ipfixResponderOctets       = 232
+	ipfixInitiatorPackets      = 298
+	ipfixResponderPackets      = 299
+)
+
+// Template and set IDs used by the exporter.
+const (
+	ipfixTemplateSetID        = 2
+	ipfixOptionsTemplateSetID = 3
+	ipfixTemplateIPv4         = 256
+	ipfixTemplateIPv6         = 257
+	ipfixTemplateAppNames     = 258
+)
+
+// ipfixUserDefinedEngine is the RFC 6759 classification engine ID for
+// user-defined application IDs.
+const ipfixUserDefinedEngine = 6
+
+type ipfixField struct {
+	id, length uint16
+}
+
+func ipfixCounterTemplate(addr ipfixField) []ipfixField {
+	return []ipfixField{
+		{ipfixApplicationID, 4},
+		addr,
+		{ipfixInitiatorOctets, 8},
+		{ipfixInitiatorPackets, 8},
+		{ipfixResponderOctets, 8},
+		{ipfixResponderPackets, 8},
+		{ipfixFlowStartMilliseconds, 8},
+		{ipfixFlowEndMilliseconds, 8},
+	}
+}
+
+// IPFIXExporter writes snapshots as IPFIX (RFC 7011) messages.
+//
+// Each message starts with the templates it uses: one data template each
+// for IPv4 and IPv6 clients, and an options template (RFC 6759) mapping the
+// exporter's applicationId values back to application names.  Clients are
+// exported as sourceIPv4Address/sourceIPv6Address, traffic they sent as
+// initiatorOctets/initiatorPackets, and traffic they received as
+// responderOctets/responderPackets.
+type IPFIXExporter struct {
+	// ObservationDomain is written into every message header.
+	ObservationDomain uint32
+	w                 io.Writer
+	seq               uint32
+	appIDs            map[string]uint32
+}
+
+// NewIPFIXExporter creates an exporter writing messages to w.
+func NewIPFIXExporter(w io.Writer) *IPFIXExporter {
+	return &IPFIXExporter{w: w, appIDs: map[string]uint32{}}
+}
+
+// appID returns the applicationId for name, assigning a new one if needed.
+func (e *IPFIXExporter) appID(name string) uint32 {
+	id, ok := e.appIDs[name]
+	if !ok {
+		id = ipfixUserDefinedEngine<<24 | uint32(len(e.appIDs)+1)
+		e.appIDs[name] = id
+	}
+	return id
+}
+
+// Export writes recs as a single IPFIX message exported at time now.
+func (e *IPFIXExporter) Export(recs []Record, now time.Time) error {
+	var v4, v6 []Record
+	for _, r := range recs {
+		if r.Client.To4() != nil {
+			v4 = append(v4, r)
+		} else {
+			v6 = append(v6, r)
+		}
+	}
+
+	// Template set: both data templates.
+	tmpl := newIPFIXSet(ipfixTemplateSetID)
+	tmpl.template(ipfixTemplateIPv4, 0, ipfixCounterTemplate(ipfixField{ipfixSourceIPv4Address, 4}))
+	tmpl.template(ipfixTemplateIPv6, 0, ipfixCounterTemplate(ipfixField{ipfixSourceIPv6Address, 16}))
+	// Options template set: applicationId scoped applicationName, with the
+	// name variable length.
+	opts := newIPFIXSet(ipfixOptionsTemplateSetID)
+	opts.template(ipfixTemplateAppNames, 1, []ipfixField{{ipfixApplicationID, 4}, {ipfixApplicationName, 0xffff}})
+
+	sets := []*ipfixSet{tmpl, opts}
+	// Every message carries the names of the applications in it, so that a
+	// collector can make sense of it on its own.
+	names := newIPFIXSet(ipfixTemplateAppNames)
+	seen := map[string]bool{}
+	for _, r := range recs {
+		if seen[r.App] {
+			continue
+		}
+		seen[r.App] = true
+		if len(r.App) >= 255 {
+			return fmt.Errorf("application name too long for IPFIX: %q", r.App)
+		}
+		names.u32(e.appID(r.App))
+		names.b = append(names.b, byte(len(r.App)))
+		names.b = append(names.b, r.App...)
+	}
+	if len(seen) > 0 {
+		sets = append(sets, names)
+	}
+	if len(v4) > 0 {
+		sets = append(sets, e.dataSet(ipfixTemplateIPv4, v4))
+	}
+	if len(v6) > 0 {
+		sets = append(sets, e.dataSet(ipfixTemplateIPv6, v6))
+	}
+
+	msg := make([]byte, 16, 1024)
+	for _, s := range sets {
+		msg = append(msg, s.finish()...)
+	}
+	if len(msg) > 0xffff {
+		return fmt.Errorf("IPFIX message too long: %d bytes", len(msg))
+	}
+	binary.BigEndian.PutUint16(msg[0:2], 10)
+	binary.BigEndian.PutUint16(msg[2:4], uint16(len(msg)))
+	binary.BigEndian.PutUint32(msg[4:8], uint32(now.Unix()))
+	binary.BigEndian.PutUint32(msg[8:12], e.seq)
+	binary.BigEndian.PutUint32(msg[12:16], e.ObservationDomain)
+	if _, err := e.w.Write(msg); err != nil {
+		return err
+	}
+	// The sequence number counts data records, not messages.
+	e.seq += uint32(len(recs) + len(seen))
+	return nil
+}
+
+func (e *IPFIXExporter) dataSet(id uint16, recs []Record) *ipfixSet {
+	s := newIPFIXSet(id)
+	for _, r := range recs {
+		s.u32(e.appID(r.App))
+		if id == ipfixTemplateIPv4 {
+			s.b = append(s.b, r.Client.To4()...)
+		} else {
+			s.b = append(s.b, r.Client.To16()...)
+		}
+		s.u64(r.BytesOut)
+		s.u64(r.PacketsOut)
+		s.u64(r.BytesIn)
+		s.u64(r.PacketsIn)
+		s.u64(uint64(r.First.UnixNano() / int64(time.Millisecond)))
+		s.u64(uint64(r.Last.UnixNano() / int64(time.Millisecond)))
+	}
+	return s
+}
+
+type ipfixSet struct {
+	b []byte
+}
+
+func newIPFIXSet(id uint16) *ipfixSet {
+	s := &ipfixSet{b: make([]byte, 4, 256)}
+	binary.BigEndian.PutUint16(s.b[0:2], id)
+	return s
+}
+
+func (s *ipfixSet) u16(v uint16) {
+	s.b = append(s.b, byte(v>>8), byte(v))
+}
+
+func (s *ipfixSet) u32(v uint32) {
+	s.b = append(s.b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (s *ipfixSet) u64(v uint64) {
+	s.u32(uint32(v >> 32))
+	s.u32(uint32(v))
+}
+
+// template appends a template record.  If scope is non-zero it's written as
+// an options template record with that many scope fields.
+func (s *ipfixSet) template(id uint16, scope uint16, fields []ipfixField) {
+	s.u16(id)
+	s.u16(uint16(len(fields)))
+	if scope > 0 {
+		s.u16(scope)
+	}
+	for _, f := range fields {
+		s.u16(f.id)
+		s.u16(f.length)
+	}
+}
+
+// finish fills in the set length and pads to a 4 byte boundary.
+func (s *ipfixSet) finish() []byte {
+	for len(s.b)%4 != 0 {
+		s.b = append(s.b, 0)
+	}
+	binary.BigEndian.PutUint16(s.b[2:4], uint16(len(s.b)))
+	return s.b
+}
@@ -133,6 +133,9 @@ func (h *TPacket) setRequestedTPacketVersion() error {
 	default:
 		return errors.New("no known tpacket versions work on this machine")
 	}
+	if h.opts.logger != nil {
+		h.opts.logger.Info("afpacket: using tpacket version", "interface", h.opts.iface, "version", h.tpVersion, "requested", h.opts.version)
+	}
 	return nil
 }
 
@@ -227,6 +230,17 @@ func (h *TPacket) releaseCurrentPacket() error {
 	return nil
 }
 
+// packetDirection converts a sockaddr_ll packet type to a direction.
+func packetDirection(pkttype int) gopacket.CaptureDirection {
+	switch pkttype {
+	case C.PACKET_HOST, C.PACKET_BROADCAST, C.PACKET_MULTICAST, C.PACKET_OTHERHOST:
+		return gopacket.DirectionInbound
+	case C.PACKET_OUTGOING:
+		return gopacket.DirectionOutbound
+	}
+	return gopacket.DirectionUnknown
+}
+
 // ZeroCopyReadPacketData reads the next packet off the wire, and returns its data.
 // The slice returned by ZeroCopyReadPacketData points to bytes owned by the
 // TPacket.  Each call to ZeroCopyReadPacketData invalidates any data previously
@@ -255,6 +269,8 @@ func (h *TPacket) ZeroCopyReadPacketData() (data []byte, ci gopacket.CaptureInfo
 	ci.CaptureLength = len(data)
 	ci.Length = h.current.getLength()
 	ci.InterfaceIndex = h.current.getIfaceIndex()
+	ci.Source.InterfaceName = h.opts.iface
+	ci.Direction = packetDirection(h.current.getPacketType())
 	h.stats.Packets++
 	h.mu.Unlock()
 	return
@@ -310,6 +326,7 @@ func (h *TPacket) SocketStats() (SocketStats, SocketStatsV3, error) {
 
 		h.socketStatsV3.tp_packets += ssv3.tp_packets
 		h.socketStatsV3.tp_drops += ssv3.tp_drops
+		h.logDrops(uint(ssv3.tp_drops))
 		h.socketStatsV3.tp_freeze_q_cnt += ssv3.tp_freeze_q_cnt
 		return h.socketStats, h.socketStatsV3, nil
 	} else {
@@ -324,10 +341,19 @@ func (h *TPacket) SocketStats() (SocketStats, SocketStatsV3, error) {
 
 		h.socketStats.tp_packets += ss.tp_packets
 		h.socketStats.tp_drops += ss.tp_drops
+		h.logDrops(uint(ss.tp_drops))
 		return h.socketStats, h.socketStatsV3, nil
 	}
 }
 
+// logDrops logs the packets the kernel dropped since the last call to
+// SocketStats.
+func (h *TPacket) logDrops(drops uint) {
+	if drops > 0 && h.opts.logger != nil {
+		h.opts.logger.Warn("afpacket: kernel dropped packets", "interface", h.opts.iface, "drops", drops)
+	}
+}
+
 // ReadPacketDataTo reads packet data into a user-supplied buffer.
 // This function reads up to the length of the passed-in slice.
 // The number of bytes read into data will be returned in ci.CaptureLength,
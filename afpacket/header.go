@@ -41,6 +41,9 @@ type header interface {
 	// getIfaceIndex returns the index of the network interface
 	// where the packet was seen. The index can later be translated to a name.
 	getIfaceIndex() int
+	// getPacketType returns the PACKET_ type the kernel assigned the packet,
+	// which says whether it was sent or received.
+	getPacketType() int
 	// next moves this header to point to the next packet it contains,
 	// returning true on success (in which case getTime and getData will
 	// return values for the new packet) or false if there are no more
@@ -82,6 +85,10 @@ func (h *v1header) getIfaceIndex() int {
 	ll := (*C.struct_sockaddr_ll)(unsafe.Pointer(uintptr(unsafe.Pointer(h)) + uintptr(tpAlign(int(C.sizeof_struct_tpacket_hdr)))))
 	return int(ll.sll_ifindex)
 }
+func (h *v1header) getPacketType() int {
+	ll := (*C.struct_sockaddr_ll)(unsafe.Pointer(uintptr(unsafe.Pointer(h)) + uintptr(tpAlign(int(C.sizeof_struct_tpacket_hdr)))))
+	return int(ll.sll_pkttype)
+}
 func (h *v1header) next() bool {
 	return false
 }
@@ -105,6 +112,10 @@ func (h *v2header) getIfaceIndex() int {
 	ll := (*C.struct_sockaddr_ll)(unsafe.Pointer(uintptr(unsafe.Pointer(h)) + uintptr(tpAlign(int(C.sizeof_struct_tpacket2_hdr)))))
 	return int(ll.sll_ifindex)
 }
+func (h *v2header) getPacketType() int {
+	ll := (*C.struct_sockaddr_ll)(unsafe.Pointer(uintptr(unsafe.Pointer(h)) + uintptr(tpAlign(int(C.sizeof_struct_tpacket2_hdr)))))
+	return int(ll.sll_pkttype)
+}
 func (h *v2header) next() bool {
 	return false
 }
@@ -141,6 +152,10 @@ func (w *v3wrapper) getIfaceIndex() int {
 	ll := (*C.struct_sockaddr_ll)(unsafe.Pointer(uintptr(unsafe.Pointer(w.packet)) + uintptr(tpAlign(int(C.sizeof_struct_tpacket3_hdr)))))
 	return int(ll.sll_ifindex)
 }
+func (w *v3wrapper) getPacketType() int {
+	ll := (*C.struct_sockaddr_ll)(unsafe.Pointer(uintptr(unsafe.Pointer(w.packet)) + uintptr(tpAlign(int(C.sizeof_struct_tpacket3_hdr)))))
+	return int(ll.sll_pkttype)
+}
 func (w *v3wrapper) next() bool {
 	w.used++
 	if w.used >= w.blockhdr.num_pkts {
@@ -10,6 +10,7 @@ package afpacket
 
 import (
 	"fmt"
+	"log/slog"
 	"time"
 )
 
@@ -86,6 +87,12 @@ type OptNumBlocks int
 // It can be passed into NewTPacket.
 type OptBlockTimeout time.Duration
 
+// OptLogger is a logger for the TPacket, which logs the TPacket version
+// chosen at Info level, and the packets the kernel dropped, as SocketStats
+// finds them, at Warn level.
+// It can be passed into NewTPacket.
+type OptLogger *slog.Logger
+
 const (
 	DefaultFrameSize    = 4096                   // Default value for OptFrameSize.
 	DefaultBlockSize    = DefaultFrameSize * 128 // Default value for OptBlockSize.
@@ -102,6 +109,7 @@ type options struct {
 	version        OptTPacketVersion
 	socktype       OptSocketType
 	iface          string
+	logger         *slog.Logger
 }
 
 var defaultOpts = options{
@@ -131,6 +139,8 @@ func parseOptions(opts ...interface{}) (ret options, err error) {
 			ret.iface = string(v)
 		case OptSocketType:
 			ret.socktype = v
+		case OptLogger:
+			ret.logger = v
 		default:
 			err = fmt.Errorf("unknown type in options")
 			return
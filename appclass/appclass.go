@@ -0,0 +1,281 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package appclass labels UDP and TCP flows with the application that
+// produced them.
+//
+// An Engine keeps a small amount of state for every bidirectional flow it is
+// shown: packet and byte counts, packet size and timing statistics, and any
+// STUN attributes seen on it.  After every packet it runs its Classifiers
+// over the flow until one of them returns a label, after which the flow's
+// label is fixed:
+//
+//	e := appclass.NewEngine(appclass.Conferencing()...)
+//	for p := range source.Packets() {
+//	  if l, ok := e.Add(p); ok {
+//	    fmt.Println(l.App, l.Media)
+//	  }
+//	}
+//
+// Classifiers are plain values, so callers can add their own alongside the
+// built in conferencing ones.
+//
+// Each flow also counts its packets by ECN codepoint, and follows the ECN
+// feedback TCP flows negotiate and send, for checking ECN and L4S
+// deployments: Flow.ECN reports bleached codepoints, CE marks not fed back,
+// and ECE not answered with CWR.
+package appclass
+
+import (
+	"math"
+	"net"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// Label is the result of classifying a flow.
+type Label struct {
+	// App is the application name, such as "Zoom".
+	App string
+	// Media is true if the flow carries real-time audio or video, and so
+	// should be scored for quality of experience.
+	Media bool
+	// Reason briefly describes which signal matched, for debugging.
+	Reason string
+}
+
+// Classifier decides whether a flow belongs to an application.  Classify is
+// called after every packet of a flow until some classifier returns true.
+type Classifier interface {
+	Classify(f *Flow) (Label, bool)
+}
+
+// ClassifierFunc adapts a function to the Classifier interface.
+type ClassifierFunc func(f *Flow) (Label, bool)
+
+// Classify calls c(f).
+func (c ClassifierFunc) Classify(f *Flow) (Label, bool) { return c(f) }
+
+// FlowKey identifies a bidirectional flow.  The endpoints are ordered so
+// that both directions of a flow share a key.
+type FlowKey struct {
+	Network, Transport gopacket.Flow
+	Protocol           layers.IPProtocol
+}
+
+// Flow is the state kept for one flow.  Classifiers should treat it as
+// read-only.
+type Flow struct {
+	Key FlowKey
+	// Client and Server are the endpoints of the first packet seen, which
+	// for UDP media is usually client to server.  If the first packet's
+	// direction is known, as set by the direction package, the local end
+	// is the client instead.
+	Client, Server         net.IP
+	ClientPort, ServerPort uint16
+
+	First, Last time.Time
+	Packets     int
+	Bytes       int
+	// MinSize and MaxSize are the smallest and largest transport payloads.
+	MinSize, MaxSize int
+
+	// STUNSoftware is the last STUN SOFTWARE attribute seen on the flow.
+	STUNSoftware string
+	// STUNAttributes records every STUN attribute type seen on the flow.
+	STUNAttributes map[uint16]bool
+
+	// ECN counts the flow's packets by ECN codepoint, and follows the ECN
+	// feedback of TCP flows.
+	ECN ECN
+
+	// interarrival statistics, in the client to server direction only
+	gaps    int
+	gapSum  time.Duration
+	gapSum2 float64
+	lastFwd time.Time
+
+	label      Label
+	classified bool
+}
+
+// MeanSize returns the mean transport payload size.
+func (f *Flow) MeanSize() int {
+	if f.Packets == 0 {
+		return 0
+	}
+	return f.Bytes / f.Packets
+}
+
+// MeanGap returns the mean gap between packets sent by the client.
+func (f *Flow) MeanGap() time.Duration {
+	if f.gaps == 0 {
+		return 0
+	}
+	return f.gapSum / time.Duration(f.gaps)
+}
+
+// GapStdDev returns the standard deviation of the gap between packets sent
+// by the client, a measure of how regularly they're paced.
+func (f *Flow) GapStdDev() time.Duration {
+	if f.gaps < 2 {
+		return 0
+	}
+	mean := float64(f.gapSum) / float64(f.gaps)
+	v := f.gapSum2/float64(f.gaps) - mean*mean
+	if v <= 0 {
+		return 0
+	}
+	return time.Duration(math.Sqrt(v))
+}
+
+// Label returns the flow's label, and whether it has been classified.
+func (f *Flow) Label() (Label, bool) { return f.label, f.classified }
+
+// Engine tracks flows and classifies them.  It is not safe for concurrent
+// use.
+type Engine struct {
+	Classifiers []Classifier
+	// MaxPackets is the number of packets after which an unclassified flow
+	// is no longer offered to classifiers.  Zero means no limit.
+	MaxPackets int
+	flows      map[FlowKey]*Flow
+}
+
+// NewEngine creates an engine running the given classifiers, in order.
+func NewEngine(c ...Classifier) *Engine {
+	return &Engine{
+		Classifiers: c,
+		MaxPackets:  200,
+		flows:       map[FlowKey]*Flow{},
+	}
+}
+
+// Add updates the state for the flow p belongs to and classifies it if it
+// hasn't been already.  It returns the flow's label, if it has one.
+// Packets without an IP and a TCP or UDP layer are ignored.
+func (e *Engine) Add(p gopacket.Packet) (Label, bool) {
+	f := e.AddFlow(p)
+	if f == nil {
+		return Label{}, false
+	}
+	return f.Label()
+}
+
+// AddFlow is like Add, but returns the flow p belongs to rather than just
+// its label, or nil if p was ignored.
+func (e *Engine) AddFlow(p gopacket.Packet) *Flow {
+	f := e.flow(p)
+	if f == nil || f.classified {
+		return f
+	}
+	if e.MaxPackets > 0 && f.Packets > e.MaxPackets {
+		return f
+	}
+	for _, c := range e.Classifiers {
+		if l, ok := c.Classify(f); ok {
+			f.label, f.classified = l, true
+			break
+		}
+	}
+	return f
+}
+
+// Flow returns the state of the flow with the given key, or nil.
+func (e *Engine) Flow(k FlowKey) *Flow { return e.flows[k] }
+
+// Flows returns every flow the engine is tracking.
+func (e *Engine) Flows() []*Flow {
+	out := make([]*Flow, 0, len(e.flows))
+	for _, f := range e.flows {
+		out = append(out, f)
+	}
+	return out
+}
+
+// Expire forgets every flow whose last packet was before t.
+func (e *Engine) Expire(t time.Time) {
+	for k, f := range e.flows {
+		if f.Last.Before(t) {
+			delete(e.flows, k)
+		}
+	}
+}
+
+func (e *Engine) flow(p gopacket.Packet) *Flow {
+	var src, dst net.IP
+	switch ip := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		src, dst = ip.SrcIP, ip.DstIP
+	case *layers.IPv6:
+		src, dst = ip.SrcIP, ip.DstIP
+	default:
+		return nil
+	}
+	var sport, dport uint16
+	var proto layers.IPProtocol
+	var payload []byte
+	var tcp *layers.TCP
+	switch t := p.TransportLayer().(type) {
+	case *layers.UDP:
+		sport, dport, proto, payload = uint16(t.SrcPort), uint16(t.DstPort), layers.IPProtocolUDP, t.Payload
+	case *layers.TCP:
+		sport, dport, proto, payload = uint16(t.SrcPort), uint16(t.DstPort), layers.IPProtocolTCP, t.Payload
+		tcp = t
+	default:
+		return nil
+	}
+	nf, tf := p.NetworkLayer().NetworkFlow(), p.TransportLayer().TransportFlow()
+	if nf.Dst().LessThan(nf.Src()) || (nf.Dst() == nf.Src() && tf.Dst().LessThan(tf.Src())) {
+		nf, tf = nf.Reverse(), tf.Reverse()
+	}
+	key := FlowKey{Network: nf, Transport: tf, Protocol: proto}
+	ts := p.Metadata().Timestamp
+	f := e.flows[key]
+	if f == nil {
+		client, server, cport, servPort := src, dst, sport, dport
+		if p.Metadata().Direction == gopacket.DirectionInbound {
+			client, server, cport, servPort = dst, src, dport, sport
+		}
+		f = &Flow{
+			Key:            key,
+			Client:         client,
+			Server:         server,
+			ClientPort:     cport,
+			ServerPort:     servPort,
+			First:          ts,
+			MinSize:        len(payload),
+			STUNAttributes: map[uint16]bool{},
+		}
+		e.flows[key] = f
+	}
+	f.Last = ts
+	f.Packets++
+	f.Bytes += len(payload)
+	if len(payload) < f.MinSize {
+		f.MinSize = len(payload)
+	}
+	if len(payload) > f.MaxSize {
+		f.MaxSize = len(payload)
+	}
+	fromClient := sport == f.ClientPort && src.Equal(f.Client)
+	f.addECN(p, fromClient, tcp)
+	if fromClient {
+		if !f.lastFwd.IsZero() {
+			gap := ts.Sub(f.lastFwd)
+			f.gaps++
+			f.gapSum += gap
+			f.gapSum2 += float64(gap) * float64(gap)
+		}
+		f.lastFwd = ts
+	}
+	if proto == layers.IPProtocolUDP {
+		f.addSTUN(payload)
+	}
+	return f
+}
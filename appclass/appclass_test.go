@@ -0,0 +1,222 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package appclass
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/statestore"
+)
+
+func udpPacket(t *testing.T, src, dst string, sport, dport uint16, payload []byte, ts time.Time) gopacket.Packet {
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP(src).To4(),
+		DstIP:    net.ParseIP(dst).To4(),
+	}
+	udp := &layers.UDP{SrcPort: layers.UDPPort(sport), DstPort: layers.UDPPort(dport)}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	p.Metadata().Timestamp = ts
+	return p
+}
+
+func stunBindingRequest(attrs ...uint16) []byte {
+	msg := make([]byte, 20)
+	binary.BigEndian.PutUint16(msg[0:2], 0x0001)
+	binary.BigEndian.PutUint32(msg[4:8], stunMagicCookie)
+	for _, a := range attrs {
+		// 4 byte attribute header plus a 1 byte value padded to 4.
+		msg = append(msg, byte(a>>8), byte(a), 0, 1, 0xff, 0, 0, 0)
+	}
+	binary.BigEndian.PutUint16(msg[2:4], uint16(len(msg)-20))
+	return msg
+}
+
+func TestTeamsSTUN(t *testing.T) {
+	e := NewEngine(Conferencing()...)
+	start := time.Unix(1000, 0)
+	l, ok := e.Add(udpPacket(t, "192.168.1.10", "198.51.100.1", 50000, 3478, stunBindingRequest(0x0006, 0x8055), start))
+	if !ok || l.App != "Teams" || !l.Media || l.Reason != "stun-attribute" {
+		t.Errorf("got %+v %v, want Teams media from STUN", l, ok)
+	}
+	// The reply shares the flow and its label.
+	l, ok = e.Add(udpPacket(t, "198.51.100.1", "192.168.1.10", 3478, 50000, make([]byte, 100), start))
+	if !ok || l.App != "Teams" {
+		t.Errorf("reverse direction got %+v %v", l, ok)
+	}
+	if n := len(e.Flows()); n != 1 {
+		t.Errorf("got %d flows, want 1", n)
+	}
+}
+
+func TestZoomPrefixPort(t *testing.T) {
+	e := NewEngine(Conferencing()...)
+	l, ok := e.Add(udpPacket(t, "10.0.0.2", "170.114.10.20", 61000, 8801, make([]byte, 200), time.Unix(1000, 0)))
+	if !ok || l.App != "Zoom" || !l.Media {
+		t.Errorf("got %+v %v, want Zoom media", l, ok)
+	}
+}
+
+func TestWebExTiming(t *testing.T) {
+	e := NewEngine(Conferencing()...)
+	start := time.Unix(1000, 0)
+	var l Label
+	var ok bool
+	for i := 0; i < 20; i++ {
+		l, ok = e.Add(udpPacket(t, "10.0.0.2", "173.243.1.1", 52000, 33434, make([]byte, 160), start.Add(time.Duration(i)*20*time.Millisecond)))
+		if i < 9 && ok {
+			t.Fatalf("classified after only %d packets: %+v", i+1, l)
+		}
+	}
+	if !ok || l.App != "WebEx" || l.Reason != "prefix-timing" {
+		t.Errorf("got %+v %v, want WebEx from timing", l, ok)
+	}
+}
+
+func TestUnknownFlow(t *testing.T) {
+	e := NewEngine(Conferencing()...)
+	start := time.Unix(1000, 0)
+	for i := 0; i < 20; i++ {
+		if l, ok := e.Add(udpPacket(t, "10.0.0.2", "203.0.113.9", 52000, 8801, make([]byte, 160), start.Add(time.Duration(i)*20*time.Millisecond))); ok {
+			t.Fatalf("unexpected label %+v", l)
+		}
+	}
+	f := e.Flows()[0]
+	if !LooksLikeMedia(f) || f.MeanGap() != 20*time.Millisecond || f.GapStdDev() != 0 {
+		t.Errorf("media stats wrong: gap %v stddev %v", f.MeanGap(), f.GapStdDev())
+	}
+	e.Expire(start.Add(time.Minute))
+	if len(e.Flows()) != 0 {
+		t.Error("flow not expired")
+	}
+}
+
+func TestSaveRestore(t *testing.T) {
+	e := NewEngine(Conferencing()...)
+	start := time.Unix(1000, 0)
+	packet := func(i int) gopacket.Packet {
+		return udpPacket(t, "10.0.0.2", "173.243.1.1", 52000, 33434, make([]byte, 160), start.Add(time.Duration(i)*20*time.Millisecond))
+	}
+	for i := 0; i < 5; i++ {
+		e.Add(packet(i))
+	}
+	s := statestore.NewMemory()
+	if err := e.Save(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// The restored flow carries on from the saved packet timing.
+	restored := NewEngine(Conferencing()...)
+	if err := restored.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	fs := restored.Flows()
+	if len(fs) != 1 || fs[0].Packets != 5 || fs[0].MeanGap() != 20*time.Millisecond || fs[0].Key != e.Flows()[0].Key {
+		t.Fatalf("got flows %+v after restore", fs)
+	}
+	var l Label
+	var ok bool
+	for i := 5; i < 20 && !ok; i++ {
+		l, ok = restored.Add(packet(i))
+	}
+	if !ok || l.App != "WebEx" || l.Reason != "prefix-timing" {
+		t.Errorf("got %+v %v after restore, want WebEx from timing", l, ok)
+	}
+}
+
+func TestInboundFirstPacket(t *testing.T) {
+	e := NewEngine()
+	p := udpPacket(t, "203.0.113.9", "10.0.0.2", 8801, 52000, make([]byte, 160), time.Unix(1000, 0))
+	p.Metadata().Direction = gopacket.DirectionInbound
+	f := e.AddFlow(p)
+	if !f.Client.Equal(net.ParseIP("10.0.0.2")) || f.ClientPort != 52000 || f.ServerPort != 8801 {
+		t.Errorf("got client %v:%d server %v:%d, want the local end as client", f.Client, f.ClientPort, f.Server, f.ServerPort)
+	}
+	// Packets from the server don't count towards the client's pacing.
+	e.AddFlow(udpPacket(t, "203.0.113.9", "10.0.0.2", 8801, 52000, make([]byte, 160), time.Unix(1001, 0)))
+	if f.MeanGap() != 0 {
+		t.Errorf("got client gap %v from server packets", f.MeanGap())
+	}
+}
+
+func tcpPacket(t *testing.T, src, dst string, sport, dport uint16, ecn layers.IPECN, tcp *layers.TCP, ts time.Time) gopacket.Packet {
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		TOS:      uint8(ecn),
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.ParseIP(src).To4(),
+		DstIP:    net.ParseIP(dst).To4(),
+	}
+	tcp.SrcPort, tcp.DstPort, tcp.Window = layers.TCPPort(sport), layers.TCPPort(dport), 1000
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, tcp, gopacket.Payload("data")); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	p.Metadata().Timestamp = ts
+	return p
+}
+
+func TestECN(t *testing.T) {
+	ts := time.Unix(1000, 0)
+	client := func(ecn layers.IPECN, tcp *layers.TCP) gopacket.Packet {
+		return tcpPacket(t, "192.168.1.10", "198.51.100.1", 50000, 443, ecn, tcp, ts)
+	}
+	server := func(ecn layers.IPECN, tcp *layers.TCP) gopacket.Packet {
+		return tcpPacket(t, "198.51.100.1", "192.168.1.10", 443, 50000, ecn, tcp, ts)
+	}
+
+	e := NewEngine()
+	e.AddFlow(client(layers.IPECNNotECT, &layers.TCP{SYN: true, ECE: true, CWR: true}))
+	e.AddFlow(server(layers.IPECNNotECT, &layers.TCP{SYN: true, ACK: true, ECE: true}))
+	e.AddFlow(client(layers.IPECNECT0, &layers.TCP{ACK: true}))
+	e.AddFlow(client(layers.IPECNCE, &layers.TCP{ACK: true}))
+	f := e.AddFlow(server(layers.IPECNECT0, &layers.TCP{ACK: true, ECE: true}))
+	if f.ECN.Requested != ECNModeClassic || f.ECN.Mode != ECNModeClassic || f.ECN.FromClient.ECT0 != 1 || f.ECN.FromClient.CE != 1 || f.ECN.Server.ECE != 1 {
+		t.Errorf("got %+v", f.ECN)
+	}
+	if f.ECN.FeedbackMissing() || !f.ECN.ResponseMissing() || f.ECN.L4S() || f.ECN.Bleached() {
+		t.Errorf("got %+v", f.ECN)
+	}
+	f = e.AddFlow(client(layers.IPECNECT0, &layers.TCP{ACK: true, CWR: true}))
+	if f.ECN.ResponseMissing() {
+		t.Errorf("CWR not counted: %+v", f.ECN)
+	}
+
+	// An L4S client negotiating AccECN, with the SYN-ACK reflecting a
+	// Not-ECT SYN.
+	e = NewEngine()
+	accECN := layers.TCPOption{OptionType: layers.TCPOptionKindAccECN0, OptionLength: 11, OptionData: []byte{0, 0, 0, 0, 0, 1, 0, 0, 9}}
+	e.AddFlow(client(layers.IPECNNotECT, &layers.TCP{SYN: true, NS: true, ECE: true, CWR: true}))
+	e.AddFlow(server(layers.IPECNNotECT, &layers.TCP{SYN: true, ACK: true, CWR: true}))
+	e.AddFlow(client(layers.IPECNECT1, &layers.TCP{ACK: true, NS: true, ECE: true}))
+	e.AddFlow(client(layers.IPECNCE, &layers.TCP{ACK: true, NS: true, ECE: true}))
+	e.AddFlow(server(layers.IPECNECT1, &layers.TCP{ACK: true, NS: true, ECE: true}))
+	f = e.AddFlow(server(layers.IPECNECT1, &layers.TCP{ACK: true, NS: true, CWR: true, Options: []layers.TCPOption{accECN}}))
+	if f.ECN.Mode != ECNModeAccECN || !f.ECN.L4S() || f.ECN.Server.ACEChanges != 1 || f.ECN.Server.AccECNOptions != 1 || f.ECN.Server.LastAccECN.CE != 1 {
+		t.Errorf("got %+v", f.ECN)
+	}
+	if f.ECN.FeedbackMissing() {
+		t.Errorf("feedback missing: %+v", f.ECN)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package appclass
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mistsys/gopacket/layers"
+)
+
+// PortRange is an inclusive range of transport ports.
+type PortRange struct {
+	Low, High uint16
+}
+
+func (r PortRange) contains(p uint16) bool { return p >= r.Low && p <= r.High }
+
+// Provider classifies the flows of a conferencing service.  A flow belongs
+// to the provider if any of these match:
+//
+//   - a STUN SOFTWARE attribute containing one of STUNSoftware
+//   - any of the STUN attribute types in STUNAttributes
+//   - either endpoint in Prefixes
+//
+// Flows matched on their STUN attributes, or on a prefix and one of
+// MediaPorts, are labelled as media immediately.  Other UDP flows to a
+// prefix are labelled as media once their packet sizes and timing look like
+// real-time media (see LooksLikeMedia), and TCP flows to a prefix are
+// labelled as non-media.
+type Provider struct {
+	App            string
+	Prefixes       []*net.IPNet
+	MediaPorts     []PortRange
+	STUNSoftware   []string
+	STUNAttributes []uint16
+	// MinPackets is how many packets a UDP flow to a prefix must have before
+	// its timing is judged.  Defaults to 10.
+	MinPackets int
+}
+
+// Classify implements Classifier.
+func (p *Provider) Classify(f *Flow) (Label, bool) {
+	for _, s := range p.STUNSoftware {
+		if f.STUNSoftware != "" && strings.Contains(f.STUNSoftware, s) {
+			return Label{App: p.App, Media: true, Reason: "stun-software"}, true
+		}
+	}
+	for _, a := range p.STUNAttributes {
+		if f.STUNAttributes[a] {
+			return Label{App: p.App, Media: true, Reason: "stun-attribute"}, true
+		}
+	}
+	if !p.inPrefixes(f.Client) && !p.inPrefixes(f.Server) {
+		return Label{}, false
+	}
+	if f.Key.Protocol == layers.IPProtocolTCP {
+		return Label{App: p.App, Reason: "prefix"}, true
+	}
+	for _, r := range p.MediaPorts {
+		if r.contains(f.ClientPort) || r.contains(f.ServerPort) {
+			return Label{App: p.App, Media: true, Reason: "prefix-port"}, true
+		}
+	}
+	min := p.MinPackets
+	if min == 0 {
+		min = 10
+	}
+	if f.Packets >= min && LooksLikeMedia(f) {
+		return Label{App: p.App, Media: true, Reason: "prefix-timing"}, true
+	}
+	return Label{}, false
+}
+
+func (p *Provider) inPrefixes(ip net.IP) bool {
+	for _, n := range p.Prefixes {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// LooksLikeMedia returns true if a UDP flow's client-side packets are paced
+// and sized like RTP audio or video: a mean gap between 5 and 70ms that
+// varies less than the gap itself, and a mean payload between 40 and 1300
+// bytes.
+func LooksLikeMedia(f *Flow) bool {
+	if f.Key.Protocol != layers.IPProtocolUDP {
+		return false
+	}
+	gap := f.MeanGap()
+	if gap < 5*time.Millisecond || gap > 70*time.Millisecond || f.GapStdDev() >= gap {
+		return false
+	}
+	size := f.MeanSize()
+	return size >= 40 && size <= 1300
+}
+
+func mustCIDRs(cidrs ...string) []*net.IPNet {
+	out := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		out[i] = n
+	}
+	return out
+}
+
+// Zoom, Teams and WebEx are built in providers.  Their prefixes are the
+// main media ranges each provider publishes; the published lists change
+// from time to time, so long running users should refresh Prefixes from
+// them.
+var (
+	Zoom = &Provider{
+		App: "Zoom",
+		Prefixes: mustCIDRs(
+			"3.7.35.0/25", "3.21.137.128/25", "8.5.128.0/23",
+			"64.125.62.0/24", "64.211.144.0/24", "65.39.152.0/24",
+			"69.174.57.0/24", "69.174.108.0/22", "99.79.20.0/25",
+			"101.36.167.0/24", "103.122.166.0/23", "134.224.0.0/16",
+			"144.195.0.0/16", "149.137.0.0/17", "160.1.56.128/25",
+			"162.12.232.0/22", "162.255.36.0/22", "165.254.88.0/23",
+			"170.114.0.0/16", "173.231.80.0/20", "192.204.12.0/22",
+			"198.251.128.0/17", "204.80.104.0/21", "204.141.28.0/22",
+			"206.247.0.0/16", "207.226.132.0/24", "209.9.211.0/24",
+			"209.9.215.0/24", "213.19.144.0/24", "213.19.153.0/24",
+			"213.244.140.0/24", "221.122.88.64/27",
+		),
+		MediaPorts: []PortRange{{8801, 8810}, {3478, 3479}},
+	}
+	Teams = &Provider{
+		App:        "Teams",
+		Prefixes:   mustCIDRs("13.107.64.0/18", "52.112.0.0/14", "52.122.0.0/15", "2603:1063::/38"),
+		MediaPorts: []PortRange{{3478, 3481}},
+		// MS-TURN/MS-ICE2 attributes: MS-VERSION, MS-SEQUENCE-NUMBER,
+		// MS-SERVICE-QUALITY and MS-IMPLEMENTATION-VERSION.
+		STUNAttributes: []uint16{0x8008, 0x8050, 0x8055, 0x8070},
+	}
+	WebEx = &Provider{
+		App: "WebEx",
+		Prefixes: mustCIDRs(
+			"62.109.192.0/18", "64.68.96.0/19", "66.114.160.0/20",
+			"66.163.32.0/19", "69.26.160.0/19", "114.29.192.0/19",
+			"150.253.128.0/17", "170.72.0.0/16", "170.133.128.0/18",
+			"173.39.224.0/19", "173.243.0.0/20", "207.182.160.0/19",
+			"209.197.192.0/19", "210.4.192.0/20", "216.151.128.0/19",
+		),
+		MediaPorts: []PortRange{{9000, 9000}, {5004, 5004}},
+	}
+)
+
+// Conferencing returns the built in conferencing classifiers.  Teams is
+// first, since its STUN attributes are the most specific signal.
+func Conferencing() []Classifier {
+	return []Classifier{Teams, Zoom, WebEx}
+}
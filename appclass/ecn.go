@@ -0,0 +1,211 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package appclass
+
+import (
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// ECNMode is the kind of ECN feedback a TCP connection uses.
+type ECNMode int
+
+const (
+	// ECNModeUnknown means the handshake wasn't seen.
+	ECNModeUnknown ECNMode = iota
+	ECNModeNone
+	// ECNModeClassic is RFC 3168 ECN, which feeds back at most one
+	// congestion signal per round trip with ECE and CWR.
+	ECNModeClassic
+	// ECNModeAccECN is accurate ECN, which feeds back a count of CE marks,
+	// as L4S requires.
+	ECNModeAccECN
+)
+
+func (m ECNMode) String() string {
+	switch m {
+	case ECNModeUnknown:
+		return "Unknown"
+	case ECNModeNone:
+		return "None"
+	case ECNModeClassic:
+		return "Classic"
+	case ECNModeAccECN:
+		return "AccECN"
+	}
+	return fmt.Sprintf("UnknownECNMode(%d)", int(m))
+}
+
+// ECNCounts counts packets by ECN codepoint.
+type ECNCounts struct {
+	NotECT, ECT0, ECT1, CE int
+}
+
+func (c *ECNCounts) add(e layers.IPECN) {
+	switch e {
+	case layers.IPECNNotECT:
+		c.NotECT++
+	case layers.IPECNECT0:
+		c.ECT0++
+	case layers.IPECNECT1:
+		c.ECT1++
+	case layers.IPECNCE:
+		c.CE++
+	}
+}
+
+// ECT returns the number of ECN-capable packets, including those marked CE
+// on the way.
+func (c ECNCounts) ECT() int { return c.ECT0 + c.ECT1 + c.CE }
+
+// ECNSide is the TCP ECN feedback sent by one end of a connection.
+type ECNSide struct {
+	// ECE and CWR count segments with those flags set, other than the
+	// handshake, on connections using classic ECN.
+	ECE, CWR int
+	// ACEChanges counts the changes of the AccECN CE packet counter, and
+	// AccECNOptions the segments carrying an AccECN option, on connections
+	// using AccECN.
+	ACEChanges    int
+	AccECNOptions int
+	// LastAccECN is the last AccECN option's counters.
+	LastAccECN layers.TCPAccECNCounters
+
+	ace    uint8
+	hasACE bool
+}
+
+// ECN is the ECN state of a flow.  Packets are counted by the end that
+// sent them.
+type ECN struct {
+	FromClient, FromServer ECNCounts
+	// Requested is the ECN feedback the SYN asked for, and Mode what the
+	// SYN-ACK agreed to.
+	Requested, Mode ECNMode
+	// Client and Server hold the TCP feedback each end sent.
+	Client, Server ECNSide
+}
+
+// L4S returns true if either end sent ECT(1) packets, as L4S senders do.
+func (e *ECN) L4S() bool { return e.FromClient.ECT1 > 0 || e.FromServer.ECT1 > 0 }
+
+// Bleached returns true if the flow negotiated ECN, but packets sent by one
+// end arrived without any ECN codepoint, as happens when a middlebox
+// clears the bits.  It only makes sense for captures taken near the
+// receiver.
+func (e *ECN) Bleached() bool {
+	if e.Mode != ECNModeClassic && e.Mode != ECNModeAccECN {
+		return false
+	}
+	return (e.FromClient.NotECT > 0 && e.FromClient.ECT() == 0) || (e.FromServer.NotECT > 0 && e.FromServer.ECT() == 0)
+}
+
+// FeedbackMissing returns true if an end received CE-marked packets but
+// never fed them back: no ECE with classic ECN, or an unchanged counter
+// with AccECN.
+func (e *ECN) FeedbackMissing() bool {
+	missing := func(ce int, receiver *ECNSide) bool {
+		switch {
+		case ce == 0:
+			return false
+		case e.Mode == ECNModeClassic:
+			return receiver.ECE == 0
+		case e.Mode == ECNModeAccECN:
+			return receiver.ACEChanges == 0
+		}
+		return false
+	}
+	return missing(e.FromClient.CE, &e.Server) || missing(e.FromServer.CE, &e.Client)
+}
+
+// ResponseMissing returns true if an end using classic ECN received ECE
+// but never answered with CWR to say it reduced its congestion window.
+func (e *ECN) ResponseMissing() bool {
+	if e.Mode != ECNModeClassic {
+		return false
+	}
+	return (e.Server.ECE > 0 && e.Client.CWR == 0) || (e.Client.ECE > 0 && e.Server.CWR == 0)
+}
+
+// synECNMode returns the ECN feedback requested by a SYN with the given AE
+// (NS), CWR and ECE flags.
+func synECNMode(ace uint8) ECNMode {
+	switch ace {
+	case 7:
+		return ECNModeAccECN
+	case 3:
+		return ECNModeClassic
+	}
+	return ECNModeNone
+}
+
+// synAckECNMode returns the ECN feedback agreed by a SYN-ACK with the given
+// AE (NS), CWR and ECE flags.  An AccECN server also reflects the ECN
+// codepoint the SYN arrived with in them.
+func synAckECNMode(ace uint8) ECNMode {
+	switch ace {
+	case 1:
+		return ECNModeClassic
+	case 2, 3, 4, 6:
+		return ECNModeAccECN
+	}
+	return ECNModeNone
+}
+
+// addECN records the ECN codepoint of p, and its ECN feedback if it is a
+// TCP segment.
+func (f *Flow) addECN(p gopacket.Packet, fromClient bool, tcp *layers.TCP) {
+	counts, side := &f.ECN.FromServer, &f.ECN.Server
+	if fromClient {
+		counts, side = &f.ECN.FromClient, &f.ECN.Client
+	}
+	switch ip := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		counts.add(ip.ECN())
+	case *layers.IPv6:
+		counts.add(ip.ECN())
+	}
+	if tcp == nil {
+		return
+	}
+	switch {
+	case tcp.SYN && !tcp.ACK:
+		f.ECN.Requested = synECNMode(tcp.ACE())
+		return
+	case tcp.SYN:
+		f.ECN.Mode = synAckECNMode(tcp.ACE())
+		if f.ECN.Requested == ECNModeUnknown {
+			f.ECN.Requested = f.ECN.Mode
+		}
+		return
+	}
+	switch f.ECN.Mode {
+	case ECNModeClassic:
+		if tcp.ECE {
+			side.ECE++
+		}
+		if tcp.CWR {
+			side.CWR++
+		}
+	case ECNModeAccECN:
+		ace := tcp.ACE()
+		if side.hasACE && ace != side.ace {
+			side.ACEChanges++
+		}
+		side.ace, side.hasACE = ace, true
+		for _, kind := range []layers.TCPOptionKind{layers.TCPOptionKindAccECN0, layers.TCPOptionKindAccECN1} {
+			if o, ok := tcp.Option(kind); ok {
+				if c, ok := o.AccECN(); ok {
+					side.AccECNOptions++
+					side.LastAccECN = c
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package appclass
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/statestore"
+)
+
+// statePrefix prefixes the keys of the flows saved to a store.
+const statePrefix = "appclass/"
+
+// flowState is the saved form of a Flow.  The AccECN counter each end last
+// sent isn't saved, so the first change after a restore isn't counted.
+type flowState struct {
+	Network   statestore.Flow   `json:"network"`
+	Transport statestore.Flow   `json:"transport"`
+	Protocol  layers.IPProtocol `json:"protocol"`
+	Flow
+
+	Gaps       int           `json:"gaps"`
+	GapSum     time.Duration `json:"gap_sum"`
+	GapSum2    float64       `json:"gap_sum2"`
+	LastFwd    time.Time     `json:"last_fwd"`
+	Label      Label         `json:"label"`
+	Classified bool          `json:"classified"`
+}
+
+// Save writes the engine's flows to s, replacing any saved before.
+func (e *Engine) Save(s statestore.Store) error {
+	if err := statestore.Clear(s, statePrefix); err != nil {
+		return err
+	}
+	for k, f := range e.flows {
+		st := flowState{
+			Network:    statestore.NewFlow(k.Network),
+			Transport:  statestore.NewFlow(k.Transport),
+			Protocol:   k.Protocol,
+			Flow:       *f,
+			Gaps:       f.gaps,
+			GapSum:     f.gapSum,
+			GapSum2:    f.gapSum2,
+			LastFwd:    f.lastFwd,
+			Label:      f.label,
+			Classified: f.classified,
+		}
+		key := statePrefix + k.Protocol.String() + " " + k.Network.String() + " " + k.Transport.String()
+		if err := statestore.PutJSON(s, key, st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore adds the flows saved in s to the engine, replacing any with the
+// same key.
+func (e *Engine) Restore(s statestore.Store) error {
+	return s.Scan(statePrefix, func(_ string, v []byte) error {
+		var st flowState
+		if err := json.Unmarshal(v, &st); err != nil {
+			return err
+		}
+		f := st.Flow
+		f.Key = FlowKey{st.Network.Flow(), st.Transport.Flow(), st.Protocol}
+		f.gaps, f.gapSum, f.gapSum2, f.lastFwd = st.Gaps, st.GapSum, st.GapSum2, st.LastFwd
+		f.label, f.classified = st.Label, st.Classified
+		e.flows[f.Key] = &f
+		return nil
+	})
+}
@@ -0,0 +1,50 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package appclass
+
+import (
+	"encoding/binary"
+)
+
+const (
+	stunMagicCookie       = 0x2112A442
+	stunAttributeSoftware = 0x8022
+)
+
+// addSTUN records the attributes of payload if it is a STUN message.  Only
+// the RFC 5389 framing is checked, which is enough to tell STUN apart from
+// RTP on a multiplexed port.
+func (f *Flow) addSTUN(payload []byte) {
+	if len(payload) < 20 || payload[0]&0xc0 != 0 {
+		return
+	}
+	if binary.BigEndian.Uint32(payload[4:8]) != stunMagicCookie {
+		return
+	}
+	length := int(binary.BigEndian.Uint16(payload[2:4]))
+	if length%4 != 0 || 20+length > len(payload) {
+		return
+	}
+	attrs := payload[20 : 20+length]
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:2])
+		alen := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if 4+alen > len(attrs) {
+			return
+		}
+		f.STUNAttributes[typ] = true
+		if typ == stunAttributeSoftware {
+			f.STUNSoftware = string(attrs[4 : 4+alen])
+		}
+		// Attributes are padded to a multiple of 4 bytes.
+		next := 4 + (alen+3)&^3
+		if next > len(attrs) {
+			return
+		}
+		attrs = attrs[next:]
+	}
+}
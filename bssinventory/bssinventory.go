@@ -0,0 +1,200 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package bssinventory builds an inventory of 802.11 BSSes from the
+// beacons and association frames in a capture.
+//
+// Each BSS is classified by layers.ClassifyDot11BSS as open, OWE, either
+// side of an OWE transition mode pair, or otherwise protected, and OWE
+// associations are counted by Diffie-Hellman group.  Check validates OWE
+// transition mode pairs, for checking Enhanced Open rollouts from
+// over-the-air captures:
+//
+//	inv := bssinventory.New()
+//	for p := range source.Packets() {
+//	  inv.Add(p)
+//	}
+//	for _, problem := range inv.Check() {
+//	  log.Println(problem)
+//	}
+package bssinventory
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// BSS is what's known about one BSS.
+type BSS struct {
+	BSSID    net.HardwareAddr
+	SSID     string
+	Security layers.Dot11BSSSecurity
+	// Companion and CompanionSSID are the other BSS of an OWE transition
+	// mode pair, from the BSS's transition mode element.
+	Companion     net.HardwareAddr
+	CompanionSSID string
+	// FirstSeen and LastSeen are the timestamps of the first and last
+	// beacons seen.
+	FirstSeen, LastSeen time.Time
+	Beacons             int
+	// OWEAssociations counts successful association responses carrying an
+	// OWE Diffie-Hellman parameter element, and OWEGroups counts them by
+	// Diffie-Hellman group.
+	OWEAssociations int
+	OWEGroups       map[uint16]int
+}
+
+// Inventory holds the BSSes seen, keyed by BSSID.  It is not safe for
+// concurrent use.
+type Inventory struct {
+	bsses map[string]*BSS
+}
+
+// New creates an empty Inventory.
+func New() *Inventory {
+	return &Inventory{bsses: map[string]*BSS{}}
+}
+
+func (inv *Inventory) bss(bssid net.HardwareAddr) *BSS {
+	b := inv.bsses[string(bssid)]
+	if b == nil {
+		b = &BSS{BSSID: append(net.HardwareAddr(nil), bssid...), OWEGroups: map[uint16]int{}}
+		inv.bsses[string(bssid)] = b
+	}
+	return b
+}
+
+func elements(p gopacket.Packet) []*layers.Dot11InformationElement {
+	var out []*layers.Dot11InformationElement
+	for _, l := range p.Layers() {
+		if e, ok := l.(*layers.Dot11InformationElement); ok {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Add updates the inventory from p, returning the BSS it updated, or nil
+// if p isn't a beacon or an association response.
+func (inv *Inventory) Add(p gopacket.Packet) *BSS {
+	d, ok := p.Layer(layers.LayerTypeDot11).(*layers.Dot11)
+	if !ok {
+		return nil
+	}
+	ts := p.Metadata().Timestamp
+	switch m := p.Layer(d.NextLayerType()).(type) {
+	case *layers.Dot11MgmtBeacon:
+		b := inv.bss(d.Address3)
+		es := elements(p)
+		b.Security = layers.ClassifyDot11BSS(m.Flags, es)
+		b.Companion, b.CompanionSSID = nil, ""
+		for _, e := range es {
+			switch {
+			case e.ID == layers.Dot11InformationElementIDSSID:
+				b.SSID = string(e.Info)
+			case e.IsOWETransitionMode():
+				if t, err := e.OWETransitionMode(); err == nil {
+					b.Companion = append(net.HardwareAddr(nil), t.BSSID...)
+					b.CompanionSSID = string(t.SSID)
+				}
+			}
+		}
+		if b.Beacons == 0 {
+			b.FirstSeen = ts
+		}
+		b.LastSeen = ts
+		b.Beacons++
+		return b
+	case *layers.Dot11MgmtAssociationResp:
+		if m.Status != layers.Dot11StatusSuccess {
+			return nil
+		}
+		b := inv.bss(d.Address3)
+		for _, e := range elements(p) {
+			if dh, err := e.OWEDHParam(); err == nil {
+				b.OWEAssociations++
+				b.OWEGroups[dh.Group]++
+			}
+		}
+		return b
+	}
+	return nil
+}
+
+// Get returns the BSS with the given BSSID, or nil.
+func (inv *Inventory) Get(bssid net.HardwareAddr) *BSS {
+	return inv.bsses[string(bssid)]
+}
+
+// BSSes returns the BSSes seen, ordered by BSSID.
+func (inv *Inventory) BSSes() []*BSS {
+	out := make([]*BSS, 0, len(inv.bsses))
+	for _, b := range inv.bsses {
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool { return bytes.Compare(out[i].BSSID, out[j].BSSID) < 0 })
+	return out
+}
+
+// Counts returns the number of BSSes of each security class.  BSSes seen
+// only in association responses aren't counted.
+func (inv *Inventory) Counts() map[layers.Dot11BSSSecurity]int {
+	out := map[layers.Dot11BSSSecurity]int{}
+	for _, b := range inv.bsses {
+		if b.Beacons > 0 {
+			out[b.Security]++
+		}
+	}
+	return out
+}
+
+// Problem is a misconfigured OWE transition mode BSS found by Check.
+type Problem struct {
+	BSSID  net.HardwareAddr
+	Reason string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%v: %s", p.BSSID, p.Reason)
+}
+
+// Check returns the problems with the OWE transition mode pairs seen: a
+// transition mode BSS whose companion wasn't seen, isn't the other kind
+// of transition mode BSS, doesn't point back, or has another SSID than
+// advertised.  OWE BSSes of a pair are expected to be hidden, so the SSID
+// is only checked against open BSSes.
+func (inv *Inventory) Check() []Problem {
+	var out []Problem
+	for _, b := range inv.BSSes() {
+		var want layers.Dot11BSSSecurity
+		switch b.Security {
+		case layers.Dot11BSSOWETransitionOpen:
+			want = layers.Dot11BSSOWETransitionOWE
+		case layers.Dot11BSSOWETransitionOWE:
+			want = layers.Dot11BSSOWETransitionOpen
+		default:
+			continue
+		}
+		c := inv.Get(b.Companion)
+		switch {
+		case c == nil || c.Beacons == 0:
+			out = append(out, Problem{b.BSSID, fmt.Sprintf("companion %v not seen", b.Companion)})
+		case c.Security != want:
+			out = append(out, Problem{b.BSSID, fmt.Sprintf("companion %v is %v, want %v", c.BSSID, c.Security, want)})
+		case !bytes.Equal(c.Companion, b.BSSID):
+			out = append(out, Problem{b.BSSID, fmt.Sprintf("companion %v points to %v", c.BSSID, c.Companion)})
+		case c.Security == layers.Dot11BSSOWETransitionOpen && c.SSID != b.CompanionSSID:
+			out = append(out, Problem{b.BSSID, fmt.Sprintf("companion %v has SSID %q, advertised %q", c.BSSID, c.SSID, b.CompanionSSID)})
+		}
+	}
+	return out
+}
@@ -0,0 +1,178 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package bssinventory
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/statestore"
+)
+
+var (
+	openBSSID  = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	oweBSSID   = net.HardwareAddr{2, 0, 0, 0, 0, 2}
+	wpa2BSSID  = net.HardwareAddr{2, 0, 0, 0, 0, 3}
+	clientAddr = net.HardwareAddr{2, 0, 0, 0, 0, 9}
+)
+
+// frame returns a management frame of the given frame control type and
+// subtype byte, with the given fixed fields and elements.
+func frame(t *testing.T, fc byte, da, bssid net.HardwareAddr, fixed []byte, es ...*layers.Dot11InformationElement) gopacket.Packet {
+	data := []byte{fc, 0, 0, 0}
+	data = append(data, da...)
+	data = append(data, bssid...)
+	data = append(data, bssid...)
+	data = append(data, 0, 0)
+	data = append(data, fixed...)
+	for _, e := range es {
+		buf := gopacket.NewSerializeBuffer()
+		if err := e.SerializeTo(buf, gopacket.SerializeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, buf.Bytes()...)
+	}
+	data = append(data, 0, 0, 0, 0) // FCS
+	p := gopacket.NewPacket(data, layers.LayerTypeDot11, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	return p
+}
+
+func beacon(t *testing.T, bssid net.HardwareAddr, ssid string, capability uint16, es ...*layers.Dot11InformationElement) gopacket.Packet {
+	fixed := make([]byte, 12)
+	fixed[8], fixed[10], fixed[11] = 100, byte(capability), byte(capability>>8)
+	es = append([]*layers.Dot11InformationElement{{ID: layers.Dot11InformationElementIDSSID, Info: []byte(ssid)}}, es...)
+	p := frame(t, 0x80, layers.EthernetBroadcast, bssid, fixed, es...)
+	p.Metadata().Timestamp = time.Unix(1000, 0)
+	return p
+}
+
+func transition(t *testing.T, bssid net.HardwareAddr, ssid string) *layers.Dot11InformationElement {
+	e, err := (&layers.Dot11OWETransitionMode{BSSID: bssid, SSID: []byte(ssid)}).InformationElement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func rsn(akm byte) *layers.Dot11InformationElement {
+	return &layers.Dot11InformationElement{ID: layers.Dot11InformationElementIDRSNInfo, Info: []byte{
+		1, 0, 0, 0x0f, 0xac, 4, 1, 0, 0, 0x0f, 0xac, 4, 1, 0, 0, 0x0f, 0xac, akm, 0x80, 0,
+	}}
+}
+
+func associationResp(t *testing.T, bssid net.HardwareAddr, status byte, group uint16) gopacket.Packet {
+	dh, err := (&layers.Dot11OWEDHParam{Group: group, PublicKey: make([]byte, 32)}).InformationElement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame(t, 0x10, clientAddr, bssid, []byte{0x11, 0x04, status, 0, 1, 0xc0}, rsn(18), dh)
+}
+
+func TestInventory(t *testing.T) {
+	inv := New()
+	for _, p := range []gopacket.Packet{
+		beacon(t, openBSSID, "guest", 0x0401, transition(t, oweBSSID, "")),
+		beacon(t, oweBSSID, "", 0x0411, rsn(18), transition(t, openBSSID, "guest")),
+		beacon(t, wpa2BSSID, "corp", 0x0411, rsn(2)),
+		beacon(t, wpa2BSSID, "corp", 0x0411, rsn(2)),
+		associationResp(t, oweBSSID, 0, 19),
+		associationResp(t, oweBSSID, 0, 20),
+		associationResp(t, oweBSSID, 1, 19),
+	} {
+		inv.Add(p)
+	}
+	want := map[layers.Dot11BSSSecurity]int{
+		layers.Dot11BSSOWETransitionOpen: 1,
+		layers.Dot11BSSOWETransitionOWE:  1,
+		layers.Dot11BSSProtected:         1,
+	}
+	if got := inv.Counts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got counts %v, want %v", got, want)
+	}
+	owe := inv.Get(oweBSSID)
+	if owe.CompanionSSID != "guest" || owe.Companion.String() != openBSSID.String() {
+		t.Errorf("got companion %v %q", owe.Companion, owe.CompanionSSID)
+	}
+	if owe.OWEAssociations != 2 || owe.OWEGroups[19] != 1 || owe.OWEGroups[20] != 1 {
+		t.Errorf("got %d OWE associations, groups %v", owe.OWEAssociations, owe.OWEGroups)
+	}
+	if b := inv.Get(wpa2BSSID); b.Beacons != 2 || b.SSID != "corp" || !b.FirstSeen.Equal(time.Unix(1000, 0)) {
+		t.Errorf("got %+v", b)
+	}
+	if bs := inv.BSSes(); len(bs) != 3 || bs[0] != inv.Get(openBSSID) {
+		t.Errorf("got BSSes %v", bs)
+	}
+	if problems := inv.Check(); len(problems) != 0 {
+		t.Errorf("got problems %v", problems)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		beacons func() []gopacket.Packet
+		want    string
+	}{
+		{"missing", func() []gopacket.Packet {
+			return []gopacket.Packet{beacon(t, openBSSID, "guest", 0x0401, transition(t, oweBSSID, ""))}
+		}, "not seen"},
+		{"not OWE", func() []gopacket.Packet {
+			return []gopacket.Packet{
+				beacon(t, openBSSID, "guest", 0x0401, transition(t, oweBSSID, "")),
+				beacon(t, oweBSSID, "", 0x0411, rsn(2), transition(t, openBSSID, "guest")),
+			}
+		}, "is Protected, want OWETransitionOWE"},
+		{"one way", func() []gopacket.Packet {
+			return []gopacket.Packet{
+				beacon(t, openBSSID, "guest", 0x0401, transition(t, oweBSSID, "")),
+				beacon(t, oweBSSID, "", 0x0411, rsn(18), transition(t, wpa2BSSID, "guest")),
+			}
+		}, "points to"},
+		{"SSID", func() []gopacket.Packet {
+			return []gopacket.Packet{
+				beacon(t, openBSSID, "guest", 0x0401, transition(t, oweBSSID, "")),
+				beacon(t, oweBSSID, "", 0x0411, rsn(18), transition(t, openBSSID, "visitor")),
+			}
+		}, `has SSID "guest", advertised "visitor"`},
+	} {
+		inv := New()
+		for _, p := range test.beacons() {
+			inv.Add(p)
+		}
+		problems := inv.Check()
+		if len(problems) == 0 || !strings.Contains(problems[0].String(), test.want) {
+			t.Errorf("%s: got %v, want %q", test.name, problems, test.want)
+		}
+	}
+}
+
+func TestSaveRestore(t *testing.T) {
+	inv := New()
+	inv.Add(beacon(t, oweBSSID, "", 0x0411, rsn(18), transition(t, openBSSID, "guest")))
+	inv.Add(associationResp(t, oweBSSID, 0, 19))
+	s := statestore.NewMemory()
+	if err := inv.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	restored := New()
+	if err := restored.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	// The times lose their location, so compare them as strings.
+	if got, want := fmt.Sprintf("%+v", restored.Get(oweBSSID)), fmt.Sprintf("%+v", inv.Get(oweBSSID)); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package bssinventory
+
+import (
+	"encoding/json"
+
+	"github.com/mistsys/gopacket/statestore"
+)
+
+// statePrefix prefixes the keys of the BSSes saved to a store.
+const statePrefix = "bssinventory/"
+
+// Save writes the inventory to s, replacing any inventory saved before.
+func (inv *Inventory) Save(s statestore.Store) error {
+	if err := statestore.Clear(s, statePrefix); err != nil {
+		return err
+	}
+	for _, b := range inv.bsses {
+		if err := statestore.PutJSON(s, statePrefix+b.BSSID.String(), b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore adds the BSSes saved in s to the inventory, replacing any with
+// the same BSSID.
+func (inv *Inventory) Restore(s statestore.Store) error {
+	return s.Scan(statePrefix, func(_ string, v []byte) error {
+		b := &BSS{}
+		if err := json.Unmarshal(v, b); err != nil {
+			return err
+		}
+		if b.OWEGroups == nil {
+			b.OWEGroups = map[uint16]int{}
+		}
+		inv.bsses[string(b.BSSID)] = b
+		return nil
+	})
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package callquality
+
+import (
+	"time"
+)
+
+// Codec describes the E-model equipment impairment parameters for a voice
+// codec, as tabulated in ITU-T G.113 Appendix I.
+type Codec struct {
+	Name string
+	// ClockRate is the RTP timestamp clock rate, used to convert RTP
+	// timestamps and RTCP jitter into wall-clock durations.
+	ClockRate int
+	// Ie is the equipment impairment factor of the codec with no loss.
+	Ie float64
+	// Bpl is the packet-loss robustness factor.
+	Bpl float64
+	// Delay is the algorithmic plus packetization delay the codec adds to
+	// the mouth-to-ear path.
+	Delay time.Duration
+}
+
+// CodecG711 is used for streams whose payload type isn't in Codecs.
+var CodecG711 = Codec{Name: "G.711", ClockRate: 8000, Ie: 0, Bpl: 25.1, Delay: 20 * time.Millisecond}
+
+// Codecs maps static RTP payload types (RFC 3551) to their impairment
+// parameters.  Dynamic payload types should be added by the caller once
+// they're learned from signaling (see layers.SDPRTPMap).
+var Codecs = map[uint8]Codec{
+	0:  CodecG711,
+	8:  {Name: "G.711", ClockRate: 8000, Ie: 0, Bpl: 25.1, Delay: 20 * time.Millisecond},
+	4:  {Name: "G.723.1", ClockRate: 8000, Ie: 15, Bpl: 16.1, Delay: 67500 * time.Microsecond},
+	9:  {Name: "G.722", ClockRate: 8000, Ie: 0, Bpl: 25.1, Delay: 20 * time.Millisecond},
+	18: {Name: "G.729A", ClockRate: 8000, Ie: 11, Bpl: 19, Delay: 35 * time.Millisecond},
+}
+
+// Impairments are the measured inputs to the E-model.
+type Impairments struct {
+	// Delay is the one-way mouth-to-ear delay.
+	Delay time.Duration
+	// LossRate is the packet loss probability, from 0 to 1.
+	LossRate float64
+	// BurstRatio is the G.107 burst ratio.  Values <= 0 are treated as 1
+	// (random loss).
+	BurstRatio float64
+}
+
+// defaultR is the G.107 basic signal-to-noise ratio R0 minus the
+// simultaneous impairment Is, using all default parameter values.
+const defaultR = 93.2
+
+// RFactor computes the ITU-T G.107 transmission rating R for the given
+// codec and impairments, using default values for every parameter that
+// can't be observed from packets.
+func RFactor(c Codec, imp Impairments) float64 {
+	d := float64(imp.Delay) / float64(time.Millisecond)
+	id := 0.024 * d
+	if d > 177.3 {
+		id += 0.11 * (d - 177.3)
+	}
+	burst := imp.BurstRatio
+	if burst <= 0 {
+		burst = 1
+	}
+	ppl := imp.LossRate * 100
+	ieEff := c.Ie
+	if ppl > 0 {
+		ieEff += (95 - c.Ie) * ppl / (ppl/burst + c.Bpl)
+	}
+	return defaultR - id - ieEff
+}
+
+// MOS converts an R factor into an estimated mean opinion score, per G.107
+// Annex B.
+func MOS(r float64) float64 {
+	switch {
+	case r <= 0:
+		return 1
+	case r >= 100:
+		return 4.5
+	}
+	return 1 + 0.035*r + r*(r-60)*(100-r)*7e-6
+}
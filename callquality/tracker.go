@@ -0,0 +1,312 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package callquality estimates voice call quality from RTP and RTCP.
+//
+// A Tracker is fed with the interesting fields of every RTP packet and
+// RTCP report block seen for a call.  It follows each stream's sequence
+// numbers and RFC 3550 interarrival jitter, folds in loss, jitter and
+// round-trip figures reported over RTCP, and at the end of every time
+// window scores the stream with the ITU-T G.107 E-model:
+//
+//	t := callquality.NewTracker(5 * time.Second)
+//	for _, pkt := range packets {
+//	  t.AddRTP(callID, callquality.RTPSample{...})
+//	}
+//	t.Flush()
+//	for _, c := range t.Calls() {
+//	  for _, w := range c.Windows() {
+//	    fmt.Println(w.Start, w.MOS)
+//	  }
+//	}
+//
+// The package works on plain values rather than decoded layers so it can
+// be driven from any RTP source: decoded packets, RTSP interleaved data, or
+// flow exports.
+package callquality
+
+import (
+	"sort"
+	"time"
+)
+
+// RTPSample holds what the tracker needs from a single RTP packet.
+type RTPSample struct {
+	SSRC        uint32
+	PayloadType uint8
+	Sequence    uint16
+	Timestamp   uint32
+	// Arrival is the capture time of the packet.
+	Arrival time.Time
+}
+
+// RTCPReport holds one RTCP report block (from an SR or RR) describing the
+// stream with the given SSRC, as seen by its receiver.
+type RTCPReport struct {
+	SSRC uint32
+	// FractionLost is the fixed point (n/256) loss fraction since the
+	// previous report.
+	FractionLost uint8
+	// Jitter is the interarrival jitter in RTP timestamp units.
+	Jitter uint32
+	// RoundTrip is the round trip time computed from LSR/DLSR, or zero if
+	// it couldn't be computed.
+	RoundTrip time.Duration
+	// Arrival is the capture time of the RTCP packet.
+	Arrival time.Time
+}
+
+// Window is the quality estimate for one stream over one time window.
+type Window struct {
+	Start, End time.Time
+	SSRC       uint32
+	Codec      string
+	// Expected and Received are the RTP packet counts for the window.
+	// They're zero if the window was scored from RTCP reports alone.
+	Expected, Received int
+	LossRate           float64
+	Jitter             time.Duration
+	// Delay is the estimated one-way mouth-to-ear delay used for scoring.
+	Delay   time.Duration
+	RFactor float64
+	MOS     float64
+	// FromRTCP is true if loss and jitter were taken from RTCP reports
+	// because no RTP for the stream was seen in the window.
+	FromRTCP bool
+}
+
+// Tracker accumulates RTP and RTCP observations per call and scores them in
+// fixed time windows.  It is not safe for concurrent use.
+type Tracker struct {
+	// WindowSize is the length of each scoring window.
+	WindowSize time.Duration
+	// JitterBufferFactor is multiplied with the measured jitter to estimate
+	// the delay added by the receiver's jitter buffer.
+	JitterBufferFactor float64
+	calls              map[string]*Call
+}
+
+// NewTracker creates a tracker scoring in windows of the given size.
+func NewTracker(window time.Duration) *Tracker {
+	return &Tracker{
+		WindowSize:         window,
+		JitterBufferFactor: 2,
+		calls:              map[string]*Call{},
+	}
+}
+
+// Call is the set of streams that make up one call.
+type Call struct {
+	ID      string
+	streams map[uint32]*stream
+	windows []Window
+}
+
+// Windows returns every completed window for the call, ordered by start
+// time and then SSRC.
+func (c *Call) Windows() []Window {
+	w := append([]Window(nil), c.windows...)
+	sort.Sort(byStart(w))
+	return w
+}
+
+// Summary scores each window by the worst stream in it, giving the quality
+// of the call as a whole over time.
+func (c *Call) Summary() []Window {
+	var out []Window
+	for _, w := range c.Windows() {
+		if n := len(out); n > 0 && out[n-1].Start.Equal(w.Start) {
+			if w.RFactor < out[n-1].RFactor {
+				out[n-1] = w
+			}
+			continue
+		}
+		out = append(out, w)
+	}
+	return out
+}
+
+type byStart []Window
+
+func (b byStart) Len() int      { return len(b) }
+func (b byStart) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byStart) Less(i, j int) bool {
+	if !b[i].Start.Equal(b[j].Start) {
+		return b[i].Start.Before(b[j].Start)
+	}
+	return b[i].SSRC < b[j].SSRC
+}
+
+type stream struct {
+	ssrc  uint32
+	codec Codec
+	start time.Time // start of the current window
+
+	// sequence tracking, as in RFC 3550 appendix A.1
+	started  bool
+	maxSeq   uint16
+	cycles   uint32
+	winFirst uint32 // extended sequence number expected first in window
+	received int
+
+	// jitter, RFC 3550 appendix A.8, in timestamp units
+	lastArrival   int64
+	lastTimestamp uint32
+	haveTransit   bool
+	jitter        float64
+
+	// latest RTCP figures
+	rtcpLoss   float64
+	rtcpJitter uint32
+	rtcpSeen   bool
+	roundTrip  time.Duration
+}
+
+func (t *Tracker) call(id string) *Call {
+	c := t.calls[id]
+	if c == nil {
+		c = &Call{ID: id, streams: map[uint32]*stream{}}
+		t.calls[id] = c
+	}
+	return c
+}
+
+func (t *Tracker) stream(c *Call, ssrc uint32, ts time.Time) *stream {
+	s := c.streams[ssrc]
+	if s == nil {
+		s = &stream{ssrc: ssrc, codec: CodecG711, start: ts.Truncate(t.WindowSize)}
+		c.streams[ssrc] = s
+	}
+	return s
+}
+
+// advance closes every window of s that ends at or before ts.
+func (t *Tracker) advance(c *Call, s *stream, ts time.Time) {
+	for !ts.Before(s.start.Add(t.WindowSize)) {
+		if s.received == 0 && !s.rtcpSeen {
+			// Nothing left to score; skip straight past any idle windows.
+			s.start = ts.Truncate(t.WindowSize)
+			return
+		}
+		t.close(c, s)
+	}
+}
+
+func (t *Tracker) close(c *Call, s *stream) {
+	w := Window{
+		Start: s.start,
+		End:   s.start.Add(t.WindowSize),
+		SSRC:  s.ssrc,
+		Codec: s.codec.Name,
+	}
+	s.start = w.End
+	var jitterUnits float64
+	if s.received > 0 {
+		ext := s.cycles + uint32(s.maxSeq)
+		w.Expected = int(ext - s.winFirst + 1)
+		w.Received = s.received
+		if lost := w.Expected - w.Received; lost > 0 && w.Expected > 0 {
+			w.LossRate = float64(lost) / float64(w.Expected)
+		}
+		jitterUnits = s.jitter
+		s.winFirst = ext + 1
+		s.received = 0
+	} else if s.rtcpSeen {
+		w.FromRTCP = true
+		w.LossRate = s.rtcpLoss
+		jitterUnits = float64(s.rtcpJitter)
+	} else {
+		// Nothing seen for this stream in the window.
+		return
+	}
+	s.rtcpSeen = false
+	if s.codec.ClockRate > 0 {
+		w.Jitter = time.Duration(jitterUnits * float64(time.Second) / float64(s.codec.ClockRate))
+	}
+	w.Delay = s.roundTrip/2 + s.codec.Delay + time.Duration(float64(w.Jitter)*t.JitterBufferFactor)
+	w.RFactor = RFactor(s.codec, Impairments{Delay: w.Delay, LossRate: w.LossRate})
+	w.MOS = MOS(w.RFactor)
+	c.windows = append(c.windows, w)
+}
+
+// AddRTP records a single RTP packet belonging to the given call.  Packets
+// must be added in capture order.
+func (t *Tracker) AddRTP(callID string, r RTPSample) {
+	c := t.call(callID)
+	s := t.stream(c, r.SSRC, r.Arrival)
+	t.advance(c, s, r.Arrival)
+	if codec, ok := Codecs[r.PayloadType]; ok {
+		s.codec = codec
+	}
+	if !s.started {
+		s.started = true
+		s.maxSeq = r.Sequence
+		s.winFirst = uint32(r.Sequence)
+	} else if delta := r.Sequence - s.maxSeq; delta < 0x8000 {
+		if r.Sequence < s.maxSeq {
+			s.cycles += 1 << 16
+		}
+		s.maxSeq = r.Sequence
+	}
+	s.received++
+
+	if s.codec.ClockRate > 0 {
+		rate := int64(s.codec.ClockRate)
+		arrival := r.Arrival.Unix()*rate + int64(r.Arrival.Nanosecond())*rate/int64(time.Second)
+		if s.haveTransit {
+			// Timestamps wrap, so take their difference modulo 2^32.
+			d := (arrival - s.lastArrival) - int64(int32(r.Timestamp-s.lastTimestamp))
+			if d < 0 {
+				d = -d
+			}
+			s.jitter += (float64(d) - s.jitter) / 16
+		}
+		s.lastArrival, s.lastTimestamp = arrival, r.Timestamp
+		s.haveTransit = true
+	}
+}
+
+// AddRTCP records an RTCP report block about a stream of the given call.
+func (t *Tracker) AddRTCP(callID string, r RTCPReport) {
+	c := t.call(callID)
+	s := t.stream(c, r.SSRC, r.Arrival)
+	t.advance(c, s, r.Arrival)
+	s.rtcpSeen = true
+	s.rtcpLoss = float64(r.FractionLost) / 256
+	s.rtcpJitter = r.Jitter
+	if r.RoundTrip > 0 {
+		// Round trip applies to the whole call, not just this direction.
+		for _, other := range c.streams {
+			other.roundTrip = r.RoundTrip
+		}
+	}
+}
+
+// Flush closes the current window of every stream, whether or not it has
+// ended yet.  It should be called once all packets have been added.
+func (t *Tracker) Flush() {
+	for _, c := range t.calls {
+		for _, s := range c.streams {
+			t.close(c, s)
+		}
+	}
+}
+
+// Calls returns every call seen, ordered by ID.
+func (t *Tracker) Calls() []*Call {
+	out := make([]*Call, 0, len(t.calls))
+	for _, c := range t.calls {
+		out = append(out, c)
+	}
+	sort.Sort(byID(out))
+	return out
+}
+
+type byID []*Call
+
+func (b byID) Len() int           { return len(b) }
+func (b byID) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byID) Less(i, j int) bool { return b[i].ID < b[j].ID }
@@ -0,0 +1,132 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package callquality
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMOS(t *testing.T) {
+	for _, test := range []struct {
+		r, mos float64
+	}{
+		{-5, 1},
+		{0, 1},
+		{50, 2.58},
+		{93.2, 4.41},
+		{120, 4.5},
+	} {
+		if got := MOS(test.r); math.Abs(got-test.mos) > 0.01 {
+			t.Errorf("MOS(%v) = %v, want %v", test.r, got, test.mos)
+		}
+	}
+}
+
+func TestRFactor(t *testing.T) {
+	if got := RFactor(CodecG711, Impairments{}); got != defaultR {
+		t.Errorf("unimpaired G.711 R = %v, want %v", got, defaultR)
+	}
+	// G.113 Appendix I: G.729A with 2% random loss has Ie,eff of about 19.
+	r := RFactor(Codecs[18], Impairments{LossRate: 0.02})
+	if ie := defaultR - r; math.Abs(ie-18.6) > 0.5 {
+		t.Errorf("G.729A at 2%% loss: Ie,eff %v, want ~18.6", ie)
+	}
+	// Delay only starts to hurt a lot past 177.3ms.
+	short := RFactor(CodecG711, Impairments{Delay: 100 * time.Millisecond})
+	long := RFactor(CodecG711, Impairments{Delay: 300 * time.Millisecond})
+	if short < 90 || long > 80 {
+		t.Errorf("delay impairment off: R(100ms)=%v R(300ms)=%v", short, long)
+	}
+}
+
+func TestTrackerLossAndWindows(t *testing.T) {
+	tr := NewTracker(time.Second)
+	start := time.Unix(1000, 0)
+	// Two seconds of 20ms G.711 packets, dropping every tenth packet in the
+	// first second only.  Sequence numbers wrap in the middle.
+	seq := uint16(65500)
+	for i := 0; i < 100; i++ {
+		if i < 50 && i%10 == 4 {
+			seq++
+			continue
+		}
+		tr.AddRTP("call", RTPSample{
+			SSRC:        0x1234,
+			PayloadType: 0,
+			Sequence:    seq,
+			Timestamp:   uint32(i * 160),
+			Arrival:     start.Add(time.Duration(i) * 20 * time.Millisecond),
+		})
+		seq++
+	}
+	tr.Flush()
+	calls := tr.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("got %d calls, want 1", len(calls))
+	}
+	w := calls[0].Windows()
+	if len(w) != 2 {
+		t.Fatalf("got %d windows, want 2: %+v", len(w), w)
+	}
+	if w[0].Expected != 50 || w[0].Received != 45 || math.Abs(w[0].LossRate-0.1) > 1e-9 {
+		t.Errorf("first window loss wrong: %+v", w[0])
+	}
+	if w[1].Expected != 50 || w[1].Received != 50 || w[1].LossRate != 0 {
+		t.Errorf("second window loss wrong: %+v", w[1])
+	}
+	if w[0].Jitter != 0 || w[1].Jitter != 0 {
+		t.Errorf("perfectly paced stream has jitter: %v %v", w[0].Jitter, w[1].Jitter)
+	}
+	if w[0].MOS >= w[1].MOS {
+		t.Errorf("lossy window MOS %v should be below clean window MOS %v", w[0].MOS, w[1].MOS)
+	}
+}
+
+func TestTrackerJitter(t *testing.T) {
+	tr := NewTracker(10 * time.Second)
+	start := time.Unix(1000, 0)
+	for i := 0; i < 200; i++ {
+		// Alternate arrivals on time and 20ms late.
+		var skew time.Duration
+		if i%2 == 1 {
+			skew = 20 * time.Millisecond
+		}
+		tr.AddRTP("call", RTPSample{
+			SSRC:      1,
+			Sequence:  uint16(i),
+			Timestamp: uint32(i * 160),
+			Arrival:   start.Add(time.Duration(i)*20*time.Millisecond + skew),
+		})
+	}
+	tr.Flush()
+	w := tr.Calls()[0].Windows()
+	// |D| is always 20ms, so jitter converges on 20ms.
+	if len(w) != 1 || w[0].Jitter < 19*time.Millisecond || w[0].Jitter > 20*time.Millisecond {
+		t.Errorf("jitter: got %+v, want ~20ms", w)
+	}
+}
+
+func TestTrackerRTCPOnly(t *testing.T) {
+	tr := NewTracker(5 * time.Second)
+	tr.AddRTCP("call", RTCPReport{
+		SSRC:         7,
+		FractionLost: 64, // 25%
+		Jitter:       80, // 10ms at 8kHz
+		RoundTrip:    200 * time.Millisecond,
+		Arrival:      time.Unix(1000, 0),
+	})
+	tr.Flush()
+	w := tr.Calls()[0].Summary()
+	if len(w) != 1 || !w[0].FromRTCP || w[0].LossRate != 0.25 || w[0].Jitter != 10*time.Millisecond {
+		t.Fatalf("RTCP-only window wrong: %+v", w)
+	}
+	if want := 100*time.Millisecond + CodecG711.Delay + 20*time.Millisecond; w[0].Delay != want {
+		t.Errorf("delay: got %v want %v", w[0].Delay, want)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// capi exports gopacket's decoders as a C shared library, so programs in
+// C, C++, or Python through ctypes use the same decoders as Go.  Build it
+// with
+//
+//	go build -buildmode=c-shared -o libgopacket.so ./capi
+//
+// which also writes libgopacket.h, declaring:
+//
+//	char *gopacket_decode(void *data, int len, int linktype);
+//	char *gopacket_decode_capture(void *data, int len);
+//	int gopacket_summarize(void *data, int len, int linktype, gopacket_summary *out);
+//	void gopacket_free(char *s);
+//
+// gopacket_decode decodes one packet starting at the given link type, a
+// LINKTYPE_ value such as 1 for Ethernet, into the JSON encoding of a
+// packetjson.Packet.  gopacket_decode_capture decodes a whole pcap or
+// pcapng file into a packetjson.Capture.  Their results must be released
+// with gopacket_free.  gopacket_summarize fills a flat struct with the
+// addresses, ports and payload location of a packet, for callers that
+// don't want to parse JSON, and returns nonzero if the packet didn't fully
+// decode.  The functions keep no state, and are safe to call from several
+// threads.  From Python:
+//
+//	lib = ctypes.CDLL("./libgopacket.so")
+//	lib.gopacket_decode.restype = ctypes.c_void_p
+//	p = lib.gopacket_decode(frame, len(frame), 1)
+//	packet = json.loads(ctypes.string_at(p))
+//	lib.gopacket_free(ctypes.c_void_p(p))
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+
+typedef struct {
+	int32_t layers;
+	int32_t truncated;
+	// ip_version is 4 or 6, or 0 without an IP layer.  IPv4 addresses
+	// take the first 4 bytes of src_ip and dst_ip.
+	int32_t ip_version;
+	uint8_t src_ip[16];
+	uint8_t dst_ip[16];
+	uint8_t ip_protocol;
+	uint16_t src_port;
+	uint16_t dst_port;
+	int32_t payload_offset;
+	int32_t payload_length;
+} gopacket_summary;
+*/
+import "C"
+
+import (
+	"net"
+	"unsafe"
+
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/packetjson"
+)
+
+//export gopacket_decode
+func gopacket_decode(data unsafe.Pointer, n C.int, linktype C.int) *C.char {
+	return C.CString(string(decodeJSON(C.GoBytes(data, n), layers.LinkType(linktype))))
+}
+
+//export gopacket_decode_capture
+func gopacket_decode_capture(data unsafe.Pointer, n C.int) *C.char {
+	return C.CString(string(packetjson.DecodeCaptureJSON(C.GoBytes(data, n))))
+}
+
+//export gopacket_summarize
+func gopacket_summarize(data unsafe.Pointer, n C.int, linktype C.int, out *C.gopacket_summary) C.int {
+	s, err := summarize(C.GoBytes(data, n), layers.LinkType(linktype))
+	*out = C.gopacket_summary{
+		layers:         C.int32_t(s.Layers),
+		ip_version:     C.int32_t(s.IPVersion),
+		ip_protocol:    C.uint8_t(s.Protocol),
+		src_port:       C.uint16_t(s.SrcPort),
+		dst_port:       C.uint16_t(s.DstPort),
+		payload_offset: C.int32_t(s.PayloadOffset),
+		payload_length: C.int32_t(s.PayloadLength),
+	}
+	if s.Truncated {
+		out.truncated = 1
+	}
+	for i, b := range ipBytes(s.SrcIP, s.IPVersion) {
+		out.src_ip[i] = C.uint8_t(b)
+	}
+	for i, b := range ipBytes(s.DstIP, s.IPVersion) {
+		out.dst_ip[i] = C.uint8_t(b)
+	}
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// ipBytes returns the 4 bytes of an IPv4 address, or the 16 of an IPv6
+// one.
+func ipBytes(ip net.IP, version int) []byte {
+	if version == 4 {
+		return ip.To4()
+	}
+	return ip.To16()
+}
+
+//export gopacket_free
+func gopacket_free(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+func main() {}
@@ -0,0 +1,78 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+//go:build cgo
+// +build cgo
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/packetjson"
+)
+
+// summary is the flat form of a packet, which gopacket_summary mirrors.
+type summary struct {
+	Layers    int
+	Truncated bool
+	// IPVersion is 4 or 6, or 0 if the packet has no IP layer.
+	IPVersion    int
+	SrcIP, DstIP net.IP
+	Protocol     layers.IPProtocol
+	// SrcPort and DstPort are set for TCP, UDP and SCTP.
+	SrcPort, DstPort uint16
+	// PayloadOffset and PayloadLength locate the application layer, if
+	// there is one.
+	PayloadOffset, PayloadLength int
+}
+
+// summarize decodes data, starting with link type lt.  It returns the
+// summary of what decoded along with any decoding error.
+func summarize(data []byte, lt layers.LinkType) (summary, error) {
+	p := gopacket.NewPacket(data, lt, gopacket.NoCopy)
+	s := summary{Layers: len(p.Layers()), Truncated: p.Metadata().Truncated}
+	switch ip := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		s.IPVersion, s.SrcIP, s.DstIP, s.Protocol = 4, ip.SrcIP, ip.DstIP, ip.Protocol
+	case *layers.IPv6:
+		s.IPVersion, s.SrcIP, s.DstIP, s.Protocol = 6, ip.SrcIP, ip.DstIP, ip.NextHeader
+	}
+	if t := p.TransportLayer(); t != nil {
+		src, dst := t.TransportFlow().Endpoints()
+		if a, b := src.Raw(), dst.Raw(); len(a) == 2 && len(b) == 2 {
+			s.SrcPort, s.DstPort = binary.BigEndian.Uint16(a), binary.BigEndian.Uint16(b)
+		}
+	}
+	if app := p.ApplicationLayer(); app != nil {
+		for _, l := range p.Layers() {
+			if l == app {
+				break
+			}
+			s.PayloadOffset += len(l.LayerContents())
+		}
+		s.PayloadLength = len(app.Payload())
+	}
+	if e := p.ErrorLayer(); e != nil {
+		return s, e.Error()
+	}
+	return s, nil
+}
+
+// decodeJSON decodes data, starting with link type lt, into the JSON
+// encoding of a packetjson.Packet.
+func decodeJSON(data []byte, lt layers.LinkType) []byte {
+	p := gopacket.NewPacket(data, lt, gopacket.NoCopy)
+	b, err := json.Marshal(packetjson.FromPacket(p))
+	if err != nil {
+		b, _ = json.Marshal(packetjson.Packet{Layers: []packetjson.Layer{}, Error: err.Error()})
+	}
+	return b
+}
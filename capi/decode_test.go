@@ -0,0 +1,60 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+//go:build cgo
+// +build cgo
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/packetjson"
+)
+
+func udpPacket(t *testing.T) []byte {
+	ip := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: net.ParseIP("2001:db8::1"), DstIP: net.ParseIP("2001:db8::2")}
+	udp := &layers.UDP{SrcPort: 40000, DstPort: 9999}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload("hello")); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSummarize(t *testing.T) {
+	s, err := summarize(udpPacket(t), layers.LinkTypeRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Layers != 3 || s.IPVersion != 6 || !s.SrcIP.Equal(net.ParseIP("2001:db8::1")) || s.Protocol != layers.IPProtocolUDP ||
+		s.SrcPort != 40000 || s.DstPort != 9999 || s.PayloadOffset != 48 || s.PayloadLength != 5 {
+		t.Errorf("got summary %+v", s)
+	}
+	if _, err := summarize([]byte{0x45, 0}, layers.LinkTypeRaw); err == nil {
+		t.Error("truncated packet summarized without error")
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	var p packetjson.Packet
+	if err := json.Unmarshal(decodeJSON(udpPacket(t), layers.LinkTypeRaw), &p); err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, l := range p.Layers {
+		types = append(types, l.Type)
+	}
+	if len(types) != 3 || types[0] != "IPv6" || types[1] != "UDP" || p.Error != "" {
+		t.Errorf("got layers %v, error %q", types, p.Error)
+	}
+}
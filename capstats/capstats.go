@@ -0,0 +1,376 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package capstats summarizes captures in one pass, with capinfos style
+// statistics and breakdowns by layer type, talker and conversation.
+//
+// A Summary has the packet and byte counts, the time span and the rates
+// over it, and a histogram of packet sizes.  Rates are over the span from
+// the earliest to the latest timestamp, so they're correct for captures
+// whose packets are out of order, as merged captures often are.  Sizes
+// and byte counts use the packets' length on the wire, not the captured
+// length.  Talkers and conversations are those of the network layer, the
+// top ones by bytes:
+//
+//	s, err := capstats.SummarizeFile("capture.pcapng", capstats.DefaultConfig())
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	fmt.Printf("%d packets in %v, %.0f bit/s\n", s.Packets, s.Duration, s.BitRate)
+//	for _, c := range s.Conversations {
+//	  fmt.Println(c.AddressA, c.AddressB, c.Bytes)
+//	}
+//
+// A Summarizer builds a Summary from packets from any source.
+package capstats
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/pcapgo"
+)
+
+// Config configures a Summarizer.
+type Config struct {
+	// TopN is the number of talkers and conversations a Summary keeps.
+	TopN int
+	// SizeBounds are the exclusive upper bounds of the size histogram's
+	// buckets, in increasing order.  A last bucket holds the larger
+	// packets.
+	SizeBounds []int
+	// DecodeOptions are used to decode packets read by SummarizeReader and
+	// SummarizeFile.
+	DecodeOptions gopacket.DecodeOptions
+}
+
+// DefaultConfig returns a Config keeping the top 10 talkers and
+// conversations, with the size buckets of Wireshark's packet lengths
+// statistics.
+func DefaultConfig() Config {
+	return Config{
+		TopN:          10,
+		SizeBounds:    []int{20, 40, 80, 160, 320, 640, 1280, 2560, 5120},
+		DecodeOptions: gopacket.DecodeOptions{Lazy: true, NoCopy: true},
+	}
+}
+
+// Counter counts packets and bytes.
+type Counter struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+func (c *Counter) add(length int) {
+	c.Packets++
+	c.Bytes += uint64(length)
+}
+
+// SizeBucket is a bucket of the size histogram, of packets of at least Min
+// bytes and less than Max, or of any size from Min if Max is zero.
+type SizeBucket struct {
+	Min, Max int
+	Counter
+}
+
+// Talker is the traffic of a network address.
+type Talker struct {
+	Address  string
+	Sent     Counter
+	Received Counter
+}
+
+// Conversation is the traffic between two network endpoints, and two
+// transport endpoints if the packets have a transport layer.  A is the
+// endpoint which sent the first packet seen.
+type Conversation struct {
+	Network   gopacket.EndpointType
+	AddressA  string
+	AddressB  string
+	Transport gopacket.EndpointType
+	PortA     string
+	PortB     string
+	AB, BA    Counter
+	// Bytes and Packets are the totals in both directions.
+	Bytes, Packets uint64
+	First, Last    time.Time
+}
+
+// Summary is the statistics of a set of packets.
+type Summary struct {
+	Packets uint64
+	// Bytes is the total length on the wire, and CapturedBytes the total
+	// captured length.
+	Bytes         uint64
+	CapturedBytes uint64
+	// Truncated counts the packets captured shorter than their length.
+	Truncated uint64
+	// DecodeErrors counts the packets which didn't fully decode.
+	DecodeErrors uint64
+	// First and Last are the earliest and the latest timestamps, and
+	// Duration the time between them.
+	First, Last time.Time
+	Duration    time.Duration
+	// ByteRate, BitRate and PacketRate are averages over Duration, and
+	// zero if it is.
+	ByteRate          float64
+	BitRate           float64
+	PacketRate        float64
+	AveragePacketSize float64
+	SizeHistogram     []SizeBucket
+	// Layers counts the packets with each layer type, and their bytes.
+	Layers        map[gopacket.LayerType]Counter
+	Talkers       []Talker
+	Conversations []Conversation
+}
+
+type conversationKey struct {
+	network, transport gopacket.Flow
+}
+
+// Summarizer accumulates the statistics of packets.  It is not safe for
+// concurrent use.
+type Summarizer struct {
+	config        Config
+	summary       Summary
+	histogram     []Counter
+	layers        map[gopacket.LayerType]*Counter
+	talkers       map[gopacket.Endpoint]*Talker
+	conversations map[conversationKey]*Conversation
+	seen          map[gopacket.LayerType]bool
+}
+
+// NewSummarizer returns a Summarizer configured by c.
+func NewSummarizer(c Config) *Summarizer {
+	return &Summarizer{
+		config:        c,
+		histogram:     make([]Counter, len(c.SizeBounds)+1),
+		layers:        map[gopacket.LayerType]*Counter{},
+		talkers:       map[gopacket.Endpoint]*Talker{},
+		conversations: map[conversationKey]*Conversation{},
+		seen:          map[gopacket.LayerType]bool{},
+	}
+}
+
+// Add adds p to the statistics.  Its length and timestamp are taken from
+// its metadata; packets without a length count as their data's length.
+func (s *Summarizer) Add(p gopacket.Packet) {
+	md := p.Metadata()
+	length, captured := md.Length, md.CaptureLength
+	if captured == 0 {
+		captured = len(p.Data())
+	}
+	if length == 0 {
+		length = captured
+	}
+	ts := md.Timestamp
+	sum := &s.summary
+	if sum.Packets == 0 || ts.Before(sum.First) {
+		sum.First = ts
+	}
+	if sum.Packets == 0 || ts.After(sum.Last) {
+		sum.Last = ts
+	}
+	sum.Packets++
+	sum.Bytes += uint64(length)
+	sum.CapturedBytes += uint64(captured)
+	if captured < length {
+		sum.Truncated++
+	}
+	if p.ErrorLayer() != nil {
+		sum.DecodeErrors++
+	}
+	s.histogram[sort.SearchInts(s.config.SizeBounds, length+1)].add(length)
+
+	for t := range s.seen {
+		delete(s.seen, t)
+	}
+	for _, l := range p.Layers() {
+		t := l.LayerType()
+		if s.seen[t] {
+			continue
+		}
+		s.seen[t] = true
+		c := s.layers[t]
+		if c == nil {
+			c = &Counter{}
+			s.layers[t] = c
+		}
+		c.add(length)
+	}
+
+	n := p.NetworkLayer()
+	if n == nil {
+		return
+	}
+	nf := n.NetworkFlow()
+	src, dst := nf.Endpoints()
+	s.talker(src).Sent.add(length)
+	s.talker(dst).Received.add(length)
+
+	k := conversationKey{network: nf}
+	if t := p.TransportLayer(); t != nil {
+		k.transport = t.TransportFlow()
+	}
+	c := s.conversations[k]
+	reverse := false
+	if c == nil {
+		if c = s.conversations[conversationKey{k.network.Reverse(), k.transport.Reverse()}]; c != nil {
+			reverse = true
+		}
+	}
+	if c == nil {
+		c = &Conversation{Network: nf.EndpointType(), AddressA: src.String(), AddressB: dst.String(), First: ts, Last: ts}
+		if k.transport != (gopacket.Flow{}) {
+			a, b := k.transport.Endpoints()
+			c.Transport = k.transport.EndpointType()
+			c.PortA, c.PortB = a.String(), b.String()
+		}
+		s.conversations[k] = c
+	}
+	if ts.Before(c.First) {
+		c.First = ts
+	}
+	if ts.After(c.Last) {
+		c.Last = ts
+	}
+	if reverse {
+		c.BA.add(length)
+	} else {
+		c.AB.add(length)
+	}
+	c.Packets++
+	c.Bytes += uint64(length)
+}
+
+func (s *Summarizer) talker(e gopacket.Endpoint) *Talker {
+	t := s.talkers[e]
+	if t == nil {
+		t = &Talker{Address: e.String()}
+		s.talkers[e] = t
+	}
+	return t
+}
+
+// Summary returns the statistics of the packets added so far.
+func (s *Summarizer) Summary() *Summary {
+	out := s.summary
+	out.Duration = out.Last.Sub(out.First)
+	if secs := out.Duration.Seconds(); secs > 0 {
+		out.ByteRate = float64(out.Bytes) / secs
+		out.BitRate = out.ByteRate * 8
+		out.PacketRate = float64(out.Packets) / secs
+	}
+	if out.Packets > 0 {
+		out.AveragePacketSize = float64(out.Bytes) / float64(out.Packets)
+	}
+	lo := 0
+	for i, c := range s.histogram {
+		b := SizeBucket{Min: lo, Counter: c}
+		if i < len(s.config.SizeBounds) {
+			b.Max = s.config.SizeBounds[i]
+			lo = b.Max
+		}
+		out.SizeHistogram = append(out.SizeHistogram, b)
+	}
+	out.Layers = make(map[gopacket.LayerType]Counter, len(s.layers))
+	for t, c := range s.layers {
+		out.Layers[t] = *c
+	}
+
+	talkers := make([]Talker, 0, len(s.talkers))
+	for _, t := range s.talkers {
+		talkers = append(talkers, *t)
+	}
+	sort.Slice(talkers, func(i, j int) bool {
+		a, b := talkers[i].Sent.Bytes+talkers[i].Received.Bytes, talkers[j].Sent.Bytes+talkers[j].Received.Bytes
+		if a != b {
+			return a > b
+		}
+		return talkers[i].Address < talkers[j].Address
+	})
+	if len(talkers) > s.config.TopN {
+		talkers = talkers[:s.config.TopN]
+	}
+	out.Talkers = talkers
+
+	convs := make([]Conversation, 0, len(s.conversations))
+	for _, c := range s.conversations {
+		convs = append(convs, *c)
+	}
+	sort.Slice(convs, func(i, j int) bool {
+		a, b := convs[i], convs[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		if a.Packets != b.Packets {
+			return a.Packets > b.Packets
+		}
+		if !a.First.Equal(b.First) {
+			return a.First.Before(b.First)
+		}
+		if a.AddressA != b.AddressA {
+			return a.AddressA < b.AddressA
+		}
+		return a.PortA < b.PortA
+	})
+	if len(convs) > s.config.TopN {
+		convs = convs[:s.config.TopN]
+	}
+	out.Conversations = convs
+	return &out
+}
+
+// SummarizeReader summarizes the packets read from r, until io.EOF.  With
+// pcapng, each packet is decoded with the link type of its interface.
+func SummarizeReader(r pcapgo.PacketReader, c Config) (*Summary, error) {
+	s := NewSummarizer(c)
+	ng, _ := r.(*pcapgo.NgReader)
+	for {
+		data, ci, err := r.ReadPacketData()
+		if err == io.EOF {
+			return s.Summary(), nil
+		} else if err != nil {
+			return nil, err
+		}
+		lt := r.LinkType()
+		if ng != nil {
+			if ifs := ng.Interfaces(); ci.InterfaceIndex < len(ifs) {
+				lt = ifs[ci.InterfaceIndex].LinkType
+			}
+		}
+		p := gopacket.NewPacket(data, lt, c.DecodeOptions)
+		p.Metadata().CaptureInfo = ci
+		s.Add(p)
+	}
+}
+
+// SummarizeFile summarizes the pcap or pcapng file at path.
+func SummarizeFile(path string, c Config) (*Summary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := pcapgo.NewAnyReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return SummarizeReader(r, c)
+}
+
+// SummarizeBytes summarizes a pcap or pcapng capture held in data.
+func SummarizeBytes(data []byte, c Config) (*Summary, error) {
+	r, err := pcapgo.NewAnyReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return SummarizeReader(r, c)
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package capstats
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/pcapgo"
+)
+
+type testPacket struct {
+	src, dst         byte
+	srcPort, dstPort layers.UDPPort
+	payload          int
+	at               time.Duration
+}
+
+// capture returns a pcap file of IPv4 UDP packets between 10.0.0.x hosts.
+func capture(t *testing.T, packets []testPacket) []byte {
+	var file bytes.Buffer
+	w := pcapgo.NewWriter(&file)
+	if err := w.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1000, 0)
+	for _, tp := range packets {
+		eth := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 0, 0, 0, 0, tp.src}, DstMAC: net.HardwareAddr{0, 0, 0, 0, 0, tp.dst}, EthernetType: layers.EthernetTypeIPv4}
+		ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{10, 0, 0, tp.src}, DstIP: net.IP{10, 0, 0, tp.dst}}
+		udp := &layers.UDP{SrcPort: tp.srcPort, DstPort: tp.dstPort}
+		buf := gopacket.NewSerializeBuffer()
+		if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, eth, ip, udp, gopacket.Payload(make([]byte, tp.payload))); err != nil {
+			t.Fatal(err)
+		}
+		ci := gopacket.CaptureInfo{Timestamp: start.Add(tp.at), CaptureLength: len(buf.Bytes()), Length: len(buf.Bytes())}
+		if err := w.WritePacket(ci, buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return file.Bytes()
+}
+
+func TestSummarize(t *testing.T) {
+	// Packets are 42 bytes of headers plus the payload.
+	data := capture(t, []testPacket{
+		{1, 2, 5000, 9000, 58, 0},                 // 100 bytes
+		{2, 1, 9000, 5000, 158, time.Second},      // 200 bytes
+		{1, 3, 5001, 9000, 1458, 4 * time.Second}, // 1500 bytes
+		// Out of order, before the first.
+		{3, 1, 9000, 5001, 158, -time.Second}, // 200 bytes
+	})
+	c := DefaultConfig()
+	c.TopN = 1
+	s, err := SummarizeBytes(data, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Packets != 4 || s.Bytes != 2000 || s.CapturedBytes != 2000 || s.Truncated != 0 || s.DecodeErrors != 0 {
+		t.Errorf("got counts %+v", s)
+	}
+	if s.Duration != 5*time.Second || !s.First.Equal(time.Unix(999, 0)) {
+		t.Errorf("got duration %v from %v", s.Duration, s.First)
+	}
+	if s.ByteRate != 400 || s.BitRate != 3200 || s.PacketRate != 0.8 || s.AveragePacketSize != 500 {
+		t.Errorf("got rates %v B/s, %v bit/s, %v packets/s, average size %v", s.ByteRate, s.BitRate, s.PacketRate, s.AveragePacketSize)
+	}
+	for _, b := range s.SizeHistogram {
+		var want uint64
+		switch b.Min {
+		case 80:
+			want = 1
+		case 160:
+			want = 2
+		case 1280:
+			want = 1
+		}
+		if b.Packets != want {
+			t.Errorf("bucket %d-%d has %d packets, want %d", b.Min, b.Max, b.Packets, want)
+		}
+	}
+	if last := s.SizeHistogram[len(s.SizeHistogram)-1]; last.Min != 5120 || last.Max != 0 {
+		t.Errorf("got last bucket %+v", last)
+	}
+	if got := s.Layers[layers.LayerTypeUDP]; got != (Counter{4, 2000}) {
+		t.Errorf("got UDP counter %+v", got)
+	}
+	if len(s.Talkers) != 1 || s.Talkers[0].Address != "10.0.0.1" || s.Talkers[0].Sent != (Counter{2, 1600}) || s.Talkers[0].Received != (Counter{2, 400}) {
+		t.Errorf("got talkers %+v", s.Talkers)
+	}
+	if len(s.Conversations) != 1 {
+		t.Fatalf("got %d conversations, want 1", len(s.Conversations))
+	}
+	conv := s.Conversations[0]
+	if conv.AddressA != "10.0.0.1" || conv.AddressB != "10.0.0.3" || conv.PortA != "5001" || conv.Bytes != 1700 ||
+		conv.AB != (Counter{1, 1500}) || conv.BA != (Counter{1, 200}) || !conv.First.Equal(time.Unix(999, 0)) {
+		t.Errorf("got conversation %+v", conv)
+	}
+}
+
+func TestSummarizeEmpty(t *testing.T) {
+	s, err := SummarizeBytes(capture(t, nil), DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Packets != 0 || s.Duration != 0 || s.ByteRate != 0 || len(s.SizeHistogram) != 10 {
+		t.Errorf("got summary %+v", s)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package conformance checks decoded packets against the constraints of
+// the standards defining their protocols, and reports the violations.
+//
+// Decoders in the layers package are lenient: they accept what they can
+// make sense of, so packets that break protocol rules still decode.  A
+// Validator checks the decoded layers separately, with rules registered
+// per layer type.  NewValidator registers rules for:
+//
+//   - TCP: illegal flag combinations, such as SYN with FIN, and zero ports
+//   - DNS: label and name lengths, and host name syntax of address queries
+//   - DHCPv4: the message type, option lengths and duplicates, and the
+//     message type matching the BOOTP operation
+//   - 802.11: the order and lengths of the information elements of
+//     beacons
+//
+// Usage:
+//
+//	v := conformance.NewValidator()
+//	for p := range source.Packets() {
+//	  for _, viol := range v.Validate(p) {
+//	    log.Println(viol)
+//	  }
+//	}
+package conformance
+
+import (
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// Severity is how serious a Violation is.
+type Severity int
+
+const (
+	// Warning is for rules that are commonly broken in practice, or that
+	// the standard states as recommendations.
+	Warning Severity = iota
+	// Error is for rules whose violation makes the packet invalid.
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "Warning"
+	case Error:
+		return "Error"
+	}
+	return fmt.Sprintf("UnknownSeverity(%d)", int(s))
+}
+
+// Violation is a rule broken by a layer.
+type Violation struct {
+	Layer    gopacket.LayerType
+	Severity Severity
+	// Rule is a short identifier of the rule, stable across releases, such
+	// as "tcp-syn-fin".
+	Rule string
+	// Reference is the standard defining the rule.
+	Reference string
+	Detail    string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%v %v %s: %s (%s)", v.Layer, v.Severity, v.Rule, v.Detail, v.Reference)
+}
+
+// Rule checks a layer of p, and returns the violations found.
+type Rule func(p gopacket.Packet, l gopacket.Layer) []Violation
+
+// Validator runs the rules registered for each layer of the packets it
+// validates.  Registering rules isn't safe for concurrent use, but once
+// they're registered Validate can be called concurrently.
+type Validator struct {
+	rules map[gopacket.LayerType][]Rule
+}
+
+// NewValidator returns a Validator with the rules of this package
+// registered.
+func NewValidator() *Validator {
+	v := NewEmptyValidator()
+	v.Register(tcpRules...)
+	v.Register(dnsRules...)
+	v.Register(dhcpv4Rules...)
+	v.Register(dot11Rules...)
+	return v
+}
+
+// NewEmptyValidator returns a Validator with no rules.
+func NewEmptyValidator() *Validator {
+	return &Validator{rules: map[gopacket.LayerType][]Rule{}}
+}
+
+// LayerRule is a rule and the layer type it applies to.
+type LayerRule struct {
+	LayerType gopacket.LayerType
+	Rule      Rule
+}
+
+// Register adds rules to v.
+func (v *Validator) Register(rules ...LayerRule) {
+	for _, r := range rules {
+		v.rules[r.LayerType] = append(v.rules[r.LayerType], r.Rule)
+	}
+}
+
+// Validate runs the rules for each layer of p, and returns the violations
+// in layer order.
+func (v *Validator) Validate(p gopacket.Packet) []Violation {
+	var out []Violation
+	for _, l := range p.Layers() {
+		for _, r := range v.rules[l.LayerType()] {
+			out = append(out, r(p, l)...)
+		}
+	}
+	return out
+}
@@ -0,0 +1,173 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package conformance
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+func serialize(t *testing.T, first gopacket.Decoder, ls ...gopacket.SerializableLayer) gopacket.Packet {
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ls...); err != nil {
+		t.Fatal(err)
+	}
+	return gopacket.NewPacket(buf.Bytes(), first, gopacket.Default)
+}
+
+// rules returns the sorted rules of vs.
+func rules(vs []Violation) string {
+	var r []string
+	for _, v := range vs {
+		r = append(r, v.Rule)
+	}
+	sort.Strings(r)
+	return strings.Join(r, ",")
+}
+
+func TestTCP(t *testing.T) {
+	v := NewValidator()
+	for _, test := range []struct {
+		tcp  layers.TCP
+		want string
+	}{
+		{layers.TCP{SrcPort: 1, DstPort: 2, SYN: true}, ""},
+		{layers.TCP{SrcPort: 1, DstPort: 2, SYN: true, FIN: true}, "tcp-syn-fin"},
+		{layers.TCP{SrcPort: 1, DstPort: 2, SYN: true, RST: true}, "tcp-syn-rst"},
+		{layers.TCP{SrcPort: 1, DstPort: 2}, "tcp-no-flags"},
+		{layers.TCP{SrcPort: 1, DstPort: 2, FIN: true, PSH: true, URG: true}, "tcp-fin-without-ack"},
+		{layers.TCP{SrcPort: 0, DstPort: 2, ACK: true, Urgent: 5}, "tcp-port-zero,tcp-urgent-without-urg"},
+	} {
+		tcp := test.tcp
+		p := serialize(t, layers.LayerTypeTCP, &tcp)
+		if got := rules(v.Validate(p)); got != test.want {
+			t.Errorf("%+v: got violations %q, want %q", test.tcp, got, test.want)
+		}
+	}
+}
+
+func TestDNS(t *testing.T) {
+	v := NewValidator()
+	dns := &layers.DNS{
+		ID: 1,
+		Questions: []layers.DNSQuestion{
+			{Name: []byte("www.example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN},
+			{Name: []byte("_sip._udp.example.com"), Type: layers.DNSTypeSRV, Class: layers.DNSClassIN},
+			{Name: []byte("bad_host.example.com"), Type: layers.DNSTypeAAAA, Class: layers.DNSClassIN},
+		},
+	}
+	p := serialize(t, layers.LayerTypeDNS, dns)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	if got, want := rules(v.Validate(p)), "dns-host-name"; got != want {
+		t.Errorf("got violations %q, want %q", got, want)
+	}
+
+	// The decoder rejects names that are too long, but rules also apply to
+	// layers built by hand, such as those a fuzzer would serialize.
+	long := strings.Repeat("a", 64)
+	dns = &layers.DNS{
+		QR: true,
+		Answers: []layers.DNSResourceRecord{
+			{Name: []byte(long + ".example.com")},
+			{Name: []byte(strings.Repeat(long[:50]+".", 6))},
+		},
+	}
+	if got, want := rules(checkDNS(nil, dns)), "dns-empty-label,dns-label-length,dns-name-length"; got != want {
+		t.Errorf("got violations %q, want %q", got, want)
+	}
+}
+
+func dhcpPacket(t *testing.T, op layers.DHCPOp, opts ...layers.DHCPOption) gopacket.Packet {
+	d := &layers.DHCPv4{Operation: op, HardwareType: layers.LinkTypeEthernet, HardwareLen: 6,
+		ClientHWAddr: net.HardwareAddr{0, 1, 2, 3, 4, 5}, Options: opts}
+	return serialize(t, layers.LayerTypeDHCPv4, d)
+}
+
+func TestDHCPv4(t *testing.T) {
+	v := NewValidator()
+	msgType := func(m layers.DHCPMsgType) layers.DHCPOption {
+		return layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(m)})
+	}
+	serverID := layers.NewDHCPOption(layers.DHCPOptServerID, []byte{10, 0, 0, 1})
+	for _, test := range []struct {
+		p    gopacket.Packet
+		want string
+	}{
+		{dhcpPacket(t, layers.DHCPOpRequest, msgType(layers.DHCPMsgTypeDiscover)), ""},
+		{dhcpPacket(t, layers.DHCPOpReply, msgType(layers.DHCPMsgTypeAck), serverID), ""},
+		{dhcpPacket(t, layers.DHCPOpRequest), "dhcp-no-message-type"},
+		{dhcpPacket(t, layers.DHCPOpRequest, msgType(layers.DHCPMsgTypeOffer), serverID), "dhcp-op-mismatch"},
+		{dhcpPacket(t, layers.DHCPOpReply, msgType(layers.DHCPMsgTypeOffer)), "dhcp-no-server-id"},
+		{dhcpPacket(t, layers.DHCPOpRequest, msgType(layers.DHCPMsgTypeRequest),
+			layers.NewDHCPOption(layers.DHCPOptRequestIP, []byte{10, 0, 0}),
+			layers.NewDHCPOption(layers.DHCPOptMaxMessageSize, []byte{1, 0}),
+			msgType(layers.DHCPMsgTypeRequest)),
+			"dhcp-duplicate-option,dhcp-max-message-size,dhcp-option-length"},
+	} {
+		if got := rules(v.Validate(test.p)); got != test.want {
+			t.Errorf("%v: got violations %q, want %q", test.p.Layer(layers.LayerTypeDHCPv4), got, test.want)
+		}
+	}
+}
+
+// beacon returns a beacon with the given elements.
+func beacon(ies ...[]byte) gopacket.Packet {
+	b := []byte{0x80, 0, 0, 0}
+	b = append(b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 1, 2, 3, 4, 5, 0, 1, 2, 3, 4, 5, 0, 0)
+	b = append(b, make([]byte, 8)...)
+	b = append(b, 0x64, 0, 0x01, 0x04)
+	for _, ie := range ies {
+		b = append(b, ie...)
+	}
+	// Dot11 treats the last 4 bytes as the FCS.
+	b = append(b, 0, 0, 0, 0)
+	return gopacket.NewPacket(b, layers.LayerTypeDot11, gopacket.Default)
+}
+
+func TestDot11Beacon(t *testing.T) {
+	v := NewValidator()
+	ssid := []byte{0, 4, 't', 'e', 's', 't'}
+	rates := []byte{1, 2, 0x82, 0x84}
+	ds := []byte{3, 1, 6}
+	vendor := []byte{221, 4, 0x00, 0x50, 0xf2, 0x02}
+	ht := append([]byte{45, 26}, make([]byte, 26)...)
+	for _, test := range []struct {
+		p    gopacket.Packet
+		want string
+	}{
+		{beacon(ssid, rates, ds, ht, vendor), ""},
+		{beacon(rates, ssid, ds), "dot11-element-order,dot11-ssid-first"},
+		{beacon(ssid, rates, vendor, ds), "dot11-vendor-not-last"},
+		{beacon(ssid, append([]byte{1, 9}, make([]byte, 9)...)), "dot11-rates-length"},
+	} {
+		if test.p.ErrorLayer() != nil {
+			t.Fatal("Failed to decode packet:", test.p.ErrorLayer().Error())
+		}
+		if got := rules(v.Validate(test.p)); got != test.want {
+			t.Errorf("got violations %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	v := NewEmptyValidator()
+	v.Register(LayerRule{gopacket.LayerTypePayload, func(p gopacket.Packet, l gopacket.Layer) []Violation {
+		return []Violation{{Layer: l.LayerType(), Rule: "payload", Detail: string(l.LayerContents())}}
+	}})
+	p := gopacket.NewPacket([]byte("x"), gopacket.DecodePayload, gopacket.Default)
+	vs := v.Validate(p)
+	if len(vs) != 1 || vs[0].Detail != "x" {
+		t.Errorf("got violations %v", vs)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package conformance
+
+import (
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+var dhcpv4Rules = []LayerRule{{layers.LayerTypeDHCPv4, checkDHCPv4}}
+
+// dhcpOptionLength is the length rule of an option: exactly min bytes if
+// multiple is zero, otherwise at least min bytes in multiples of
+// multiple.
+type dhcpOptionLength struct {
+	min, multiple int
+}
+
+var dhcpOptionLengths = map[layers.DHCPOpt]dhcpOptionLength{
+	layers.DHCPOptSubnetMask:     {4, 0},
+	layers.DHCPOptTimeOffset:     {4, 0},
+	layers.DHCPOptRouter:         {4, 4},
+	layers.DHCPOptTimeServer:     {4, 4},
+	layers.DHCPOptNameServer:     {4, 4},
+	layers.DHCPOptDNS:            {4, 4},
+	layers.DHCPOptLogServer:      {4, 4},
+	layers.DHCPOptHostname:       {1, 1},
+	layers.DHCPOptDomainName:     {1, 1},
+	layers.DHCPOptInterfaceMTU:   {2, 0},
+	layers.DHCPOptBroadcastAddr:  {4, 0},
+	layers.DHCPOptStaticRoute:    {8, 8},
+	layers.DHCPOptNTPServers:     {4, 4},
+	layers.DHCPOptRequestIP:      {4, 0},
+	layers.DHCPOptLeaseTime:      {4, 0},
+	layers.DHCPOptExtOptions:     {1, 0},
+	layers.DHCPOptMessageType:    {1, 0},
+	layers.DHCPOptServerID:       {4, 0},
+	layers.DHCPOptParamsRequest:  {1, 1},
+	layers.DHCPOptMaxMessageSize: {2, 0},
+	layers.DHCPOptT1:             {4, 0},
+	layers.DHCPOptT2:             {4, 0},
+	layers.DHCPOptClassID:        {1, 1},
+	layers.DHCPOptClientID:       {2, 1},
+}
+
+func checkDHCPv4(p gopacket.Packet, l gopacket.Layer) []Violation {
+	d := l.(*layers.DHCPv4)
+	var out []Violation
+	add := func(s Severity, rule, ref, detail string) {
+		out = append(out, Violation{Layer: layers.LayerTypeDHCPv4, Severity: s, Rule: rule, Reference: ref, Detail: detail})
+	}
+	if d.HardwareLen > 16 {
+		add(Error, "dhcp-hlen", "RFC 2131 2", fmt.Sprintf("hardware address length %d over 16", d.HardwareLen))
+	}
+	seen := map[layers.DHCPOpt]bool{}
+	msgType := layers.DHCPMsgTypeUnspecified
+	for _, o := range d.Options {
+		if o.Type == layers.DHCPOptPad {
+			continue
+		}
+		if seen[o.Type] {
+			// RFC 3396 allows splitting long options, but few do.
+			add(Warning, "dhcp-duplicate-option", "RFC 3396", fmt.Sprintf("option %v repeated", o.Type))
+		}
+		seen[o.Type] = true
+		if r, ok := dhcpOptionLengths[o.Type]; ok {
+			n := len(o.Data)
+			if n < r.min || (r.multiple == 0 && n != r.min) || (r.multiple > 0 && n%r.multiple != 0) {
+				add(Error, "dhcp-option-length", "RFC 2132", fmt.Sprintf("option %v has length %d", o.Type, n))
+				continue
+			}
+		}
+		switch o.Type {
+		case layers.DHCPOptMessageType:
+			msgType = layers.DHCPMsgType(o.Data[0])
+		case layers.DHCPOptMaxMessageSize:
+			if n := int(o.Data[0])<<8 | int(o.Data[1]); n < 576 {
+				add(Error, "dhcp-max-message-size", "RFC 2132 9.10", fmt.Sprintf("maximum message size %d under 576", n))
+			}
+		}
+	}
+	if !seen[layers.DHCPOptMessageType] {
+		// Plain BOOTP messages have no message type.
+		add(Warning, "dhcp-no-message-type", "RFC 2131 3", "no DHCP message type option")
+		return out
+	}
+	var op layers.DHCPOp
+	switch msgType {
+	case layers.DHCPMsgTypeDiscover, layers.DHCPMsgTypeRequest, layers.DHCPMsgTypeDecline, layers.DHCPMsgTypeRelease, layers.DHCPMsgTypeInform:
+		op = layers.DHCPOpRequest
+	case layers.DHCPMsgTypeOffer, layers.DHCPMsgTypeAck, layers.DHCPMsgTypeNak:
+		op = layers.DHCPOpReply
+	default:
+		add(Error, "dhcp-message-type", "RFC 2132 9.6", fmt.Sprintf("unknown message type %d", msgType))
+		return out
+	}
+	if d.Operation != op {
+		add(Error, "dhcp-op-mismatch", "RFC 2131 3", fmt.Sprintf("%v sent with op %v", msgType, d.Operation))
+	}
+	if op == layers.DHCPOpReply && !seen[layers.DHCPOptServerID] {
+		add(Error, "dhcp-no-server-id", "RFC 2131 4.3.1", fmt.Sprintf("%v has no server identifier", msgType))
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+var dnsRules = []LayerRule{{layers.LayerTypeDNS, checkDNS}}
+
+func checkDNS(p gopacket.Packet, l gopacket.Layer) []Violation {
+	d := l.(*layers.DNS)
+	var out []Violation
+	add := func(s Severity, rule, ref, detail string) {
+		out = append(out, Violation{Layer: layers.LayerTypeDNS, Severity: s, Rule: rule, Reference: ref, Detail: detail})
+	}
+	checkName := func(name []byte, host bool) {
+		if len(name) > 253 {
+			add(Error, "dns-name-length", "RFC 1035 2.3.4", fmt.Sprintf("name %.20q... is %d characters, over 253", name, len(name)))
+		}
+		if len(name) == 0 {
+			return
+		}
+		for _, label := range bytes.Split(name, []byte{'.'}) {
+			switch {
+			case len(label) == 0:
+				add(Error, "dns-empty-label", "RFC 1035 3.1", fmt.Sprintf("name %q has an empty label", name))
+			case len(label) > 63:
+				add(Error, "dns-label-length", "RFC 1035 2.3.4", fmt.Sprintf("label %.20q... is %d octets, over 63", label, len(label)))
+			case host && !hostLabel(label):
+				add(Warning, "dns-host-name", "RFC 1123 2.1", fmt.Sprintf("name %q isn't a valid host name", name))
+			}
+		}
+	}
+	for _, q := range d.Questions {
+		checkName(q.Name, q.Type == layers.DNSTypeA || q.Type == layers.DNSTypeAAAA)
+	}
+	for _, rrs := range [][]layers.DNSResourceRecord{d.Answers, d.Authorities, d.Additionals} {
+		for _, rr := range rrs {
+			checkName(rr.Name, false)
+		}
+	}
+	if !d.QR && d.OpCode == layers.DNSOpCodeQuery {
+		if len(d.Answers) > 0 {
+			add(Warning, "dns-query-answers", "RFC 1035 4.1.1", "query has answers")
+		}
+		if d.ResponseCode != layers.DNSResponseCodeNoErr {
+			add(Warning, "dns-query-rcode", "RFC 1035 4.1.1", fmt.Sprintf("query has response code %v", d.ResponseCode))
+		}
+	}
+	return out
+}
+
+// hostLabel reports whether label is made of letters, digits and hyphens,
+// and doesn't start or end with a hyphen.
+func hostLabel(label []byte) bool {
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, c := range label {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package conformance
+
+import (
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+const ieee80211Beacon = "IEEE 802.11-2020 9.3.3.2"
+
+var dot11Rules = []LayerRule{{layers.LayerTypeDot11MgmtBeacon, checkDot11Beacon}}
+
+// dot11BeaconOrder is the order of the elements of a beacon, by the Table
+// 9-34 of IEEE 802.11-2020.  Elements not listed aren't checked, except
+// vendor specific ones, which come last.
+var dot11BeaconOrder = map[layers.Dot11InformationElementID]int{}
+
+func init() {
+	for i, id := range []layers.Dot11InformationElementID{
+		0,   // SSID
+		1,   // Supported Rates
+		3,   // DSSS Parameter Set
+		4,   // CF Parameter Set
+		6,   // IBSS Parameter Set
+		5,   // TIM
+		7,   // Country
+		32,  // Power Constraint
+		37,  // Channel Switch Announcement
+		40,  // Quiet
+		41,  // IBSS DFS
+		35,  // TPC Report
+		42,  // ERP
+		50,  // Extended Supported Rates
+		48,  // RSN
+		11,  // BSS Load
+		12,  // EDCA Parameter Set
+		46,  // QoS Capability
+		51,  // AP Channel Report
+		54,  // Mobility Domain
+		60,  // Extended Channel Switch Announcement
+		59,  // Supported Operating Classes
+		45,  // HT Capabilities
+		61,  // HT Operation
+		72,  // 20/40 BSS Coexistence
+		74,  // Overlapping BSS Scan Parameters
+		127, // Extended Capabilities
+		107, // Interworking
+		108, // Advertisement Protocol
+		111, // Roaming Consortium
+		191, // VHT Capabilities
+		192, // VHT Operation
+		255, // Element ID Extension, for HE and later
+	} {
+		dot11BeaconOrder[id] = i
+	}
+}
+
+func checkDot11Beacon(p gopacket.Packet, l gopacket.Layer) []Violation {
+	var out []Violation
+	add := func(s Severity, rule, detail string) {
+		out = append(out, Violation{Layer: layers.LayerTypeDot11MgmtBeacon, Severity: s, Rule: rule, Reference: ieee80211Beacon, Detail: detail})
+	}
+	var ies []*layers.Dot11InformationElement
+	for _, l := range p.Layers() {
+		if ie, ok := l.(*layers.Dot11InformationElement); ok {
+			ies = append(ies, ie)
+		}
+	}
+	if len(ies) == 0 || ies[0].ID != layers.Dot11InformationElementIDSSID {
+		add(Error, "dot11-ssid-first", "beacon doesn't start with an SSID element")
+	}
+	last, lastID, vendor := -1, layers.Dot11InformationElementID(0), false
+	for _, ie := range ies {
+		switch ie.ID {
+		case layers.Dot11InformationElementIDSSID:
+			if len(ie.Info) > 32 {
+				add(Error, "dot11-ssid-length", fmt.Sprintf("SSID length %d over 32", len(ie.Info)))
+			}
+		case layers.Dot11InformationElementIDRates:
+			if len(ie.Info) == 0 || len(ie.Info) > 8 {
+				add(Error, "dot11-rates-length", fmt.Sprintf("supported rates length %d not 1 to 8", len(ie.Info)))
+			}
+		}
+		if ie.ID == layers.Dot11InformationElementIDVendor {
+			vendor = true
+			continue
+		}
+		i, ok := dot11BeaconOrder[ie.ID]
+		if !ok {
+			continue
+		}
+		if vendor {
+			add(Warning, "dot11-vendor-not-last", fmt.Sprintf("%v element after vendor specific elements", ie.ID))
+			vendor = false
+		}
+		if i < last {
+			add(Warning, "dot11-element-order", fmt.Sprintf("%v element after %v element", ie.ID, lastID))
+		}
+		last, lastID = i, ie.ID
+	}
+	return out
+}
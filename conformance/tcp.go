@@ -0,0 +1,46 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package conformance
+
+import (
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+const rfc9293 = "RFC 9293"
+
+var tcpRules = []LayerRule{{layers.LayerTypeTCP, checkTCP}}
+
+func checkTCP(p gopacket.Packet, l gopacket.Layer) []Violation {
+	t := l.(*layers.TCP)
+	var out []Violation
+	add := func(s Severity, rule, detail string) {
+		out = append(out, Violation{Layer: layers.LayerTypeTCP, Severity: s, Rule: rule, Reference: rfc9293, Detail: detail})
+	}
+	switch {
+	case !(t.FIN || t.SYN || t.RST || t.PSH || t.ACK || t.URG || t.ECE || t.CWR || t.NS):
+		add(Error, "tcp-no-flags", "segment has no flags set")
+	case t.SYN && t.FIN:
+		add(Error, "tcp-syn-fin", "SYN and FIN both set")
+	case t.SYN && t.RST:
+		add(Error, "tcp-syn-rst", "SYN and RST both set")
+	case t.FIN && !t.ACK:
+		add(Error, "tcp-fin-without-ack", "FIN set without ACK")
+	case t.PSH && !t.ACK:
+		add(Warning, "tcp-psh-without-ack", "PSH set without ACK")
+	}
+	if t.Urgent != 0 && !t.URG {
+		add(Warning, "tcp-urgent-without-urg", "urgent pointer set without URG")
+	}
+	if t.SrcPort == 0 || t.DstPort == 0 {
+		add(Error, "tcp-port-zero", "source or destination port is zero")
+	}
+	if t.DataOffset < 5 {
+		add(Error, "tcp-data-offset", "data offset less than 5 words")
+	}
+	return out
+}
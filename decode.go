@@ -25,6 +25,22 @@ func (nilDecodeFeedback) SetTruncated() {}
 // NilDecodeFeedback implements DecodeFeedback by doing nothing.
 var NilDecodeFeedback DecodeFeedback = nilDecodeFeedback{}
 
+// WarningFeedback is implemented by DecodeFeedbacks that collect warnings:
+// anomalies that don't stop a packet from being decoded, such as frames
+// shorter or longer than their link layer allows.  Packets and
+// DecodingLayerParsers collect warnings.
+type WarningFeedback interface {
+	// AddWarning records a warning.  It sets packet.Metadata().Warnings.
+	AddWarning(err error)
+}
+
+// AddWarning reports err as a warning to df, if df collects warnings.
+func AddWarning(df DecodeFeedback, err error) {
+	if w, ok := df.(WarningFeedback); ok {
+		w.AddWarning(err)
+	}
+}
+
 // PacketBuilder is used by layer decoders to store the layers they've decoded,
 // and to defer future decoding via NextDecoder.
 // Typically, the pattern for use is:
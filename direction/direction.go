@@ -0,0 +1,262 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package direction decides which way a packet is traveling relative to the
+// local network, and records it in the packet's metadata so that every
+// later module agrees on which side of a flow is local.
+//
+// A Classifier tries these methods in turn, skipping any that aren't
+// configured, until one of them decides:
+//
+//   - Capture: the direction the capture recorded, from Linux SLL headers
+//     or AF_PACKET
+//   - LocalMAC: a source or destination hardware address in LocalMACs
+//   - LocalNet: exactly one of the IP addresses inside LocalNets
+//   - FirstSYN: the sender of the first TCP SYN of a connection is local,
+//     so its packets are outbound and the replies are inbound
+//
+// Usage:
+//
+//	c := direction.NewClassifier(direction.Config{LocalNets: nets, FirstSYN: true})
+//	for p := range source.Packets() {
+//	  c.Annotate(p)
+//	  // p.Metadata().Direction is now set for later modules.
+//	}
+//
+// Modules such as appclass and logexport read p.Metadata().Direction, so
+// packets should be annotated before they're handed on.
+package direction
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// Method is the way a Classifier decided a packet's direction.
+type Method int
+
+const (
+	// None means no method could decide.
+	None Method = iota
+	Capture
+	LocalMAC
+	LocalNet
+	FirstSYN
+)
+
+func (m Method) String() string {
+	switch m {
+	case None:
+		return "None"
+	case Capture:
+		return "Capture"
+	case LocalMAC:
+		return "LocalMAC"
+	case LocalNet:
+		return "LocalNet"
+	case FirstSYN:
+		return "FirstSYN"
+	}
+	return fmt.Sprintf("UnknownMethod(%d)", int(m))
+}
+
+// Config selects the methods a Classifier uses.
+type Config struct {
+	// IgnoreCapture makes the classifier ignore the direction recorded by
+	// the capture, for example when replaying a file whose directions
+	// aren't trusted.
+	IgnoreCapture bool
+	// LocalMACs are the hardware addresses of local interfaces.
+	LocalMACs []net.HardwareAddr
+	// LocalNets are the local address prefixes.
+	LocalNets []*net.IPNet
+	// FirstSYN enables the first SYN heuristic for TCP.
+	FirstSYN bool
+	// MaxConnections bounds the connections remembered for FirstSYN.  When
+	// it's reached new connections aren't remembered until Expire frees
+	// space.  Zero means DefaultMaxConnections.
+	MaxConnections int
+	// Logger, if set, logs SYNs that aren't remembered because
+	// MaxConnections was reached.
+	Logger *slog.Logger
+}
+
+// DefaultMaxConnections is the default for Config.MaxConnections.
+const DefaultMaxConnections = 65536
+
+// connKey is the flows of a TCP connection, ordered so that both directions
+// share a key.
+type connKey struct {
+	network, transport gopacket.Flow
+}
+
+type conn struct {
+	// client is the connection's first SYN sender.
+	client, clientPort gopacket.Endpoint
+	last               time.Time
+}
+
+// Classifier decides the direction of packets.  It is not safe for
+// concurrent use.
+type Classifier struct {
+	cfg   Config
+	conns map[connKey]*conn
+}
+
+// NewClassifier creates a classifier using the methods configured in c.
+func NewClassifier(c Config) *Classifier {
+	if c.MaxConnections == 0 {
+		c.MaxConnections = DefaultMaxConnections
+	}
+	return &Classifier{cfg: c, conns: map[connKey]*conn{}}
+}
+
+// ParseLocalNets parses CIDR prefixes for Config.LocalNets.
+func ParseLocalNets(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, s := range cidrs {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Classify returns the direction of p and the method that decided it.  It
+// doesn't change p, but does update the classifier's FirstSYN state.
+func (c *Classifier) Classify(p gopacket.Packet) (gopacket.CaptureDirection, Method) {
+	// FirstSYN state is updated for every packet, so that connections are
+	// remembered even while an earlier method is deciding.
+	synDir := c.firstSYN(p)
+	if d := p.Metadata().Direction; d != gopacket.DirectionUnknown && !c.cfg.IgnoreCapture {
+		return d, Capture
+	}
+	if d := c.localMAC(p); d != gopacket.DirectionUnknown {
+		return d, LocalMAC
+	}
+	if d := c.localNet(p); d != gopacket.DirectionUnknown {
+		return d, LocalNet
+	}
+	if synDir != gopacket.DirectionUnknown {
+		return synDir, FirstSYN
+	}
+	return gopacket.DirectionUnknown, None
+}
+
+// Annotate classifies p and, if the capture didn't record a direction,
+// records the result in p.Metadata().Direction.  It returns the packet's
+// direction.
+func (c *Classifier) Annotate(p gopacket.Packet) gopacket.CaptureDirection {
+	d, m := c.Classify(p)
+	if m != Capture && m != None {
+		p.Metadata().Direction = d
+	}
+	return d
+}
+
+// Expire forgets FirstSYN connections whose last packet was before t.
+func (c *Classifier) Expire(t time.Time) {
+	for k, cn := range c.conns {
+		if cn.last.Before(t) {
+			delete(c.conns, k)
+		}
+	}
+}
+
+func (c *Classifier) localMAC(p gopacket.Packet) gopacket.CaptureDirection {
+	if len(c.cfg.LocalMACs) == 0 {
+		return gopacket.DirectionUnknown
+	}
+	eth, ok := p.LinkLayer().(*layers.Ethernet)
+	if !ok {
+		return gopacket.DirectionUnknown
+	}
+	src, dst := false, false
+	for _, m := range c.cfg.LocalMACs {
+		src = src || bytes.Equal(eth.SrcMAC, m)
+		dst = dst || bytes.Equal(eth.DstMAC, m)
+	}
+	return decide(src, dst)
+}
+
+func (c *Classifier) localNet(p gopacket.Packet) gopacket.CaptureDirection {
+	if len(c.cfg.LocalNets) == 0 {
+		return gopacket.DirectionUnknown
+	}
+	var srcIP, dstIP net.IP
+	switch ip := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		srcIP, dstIP = ip.SrcIP, ip.DstIP
+	case *layers.IPv6:
+		srcIP, dstIP = ip.SrcIP, ip.DstIP
+	default:
+		return gopacket.DirectionUnknown
+	}
+	src, dst := false, false
+	for _, n := range c.cfg.LocalNets {
+		src = src || n.Contains(srcIP)
+		dst = dst || n.Contains(dstIP)
+	}
+	return decide(src, dst)
+}
+
+// decide returns the direction of a packet between a local and a remote
+// end, or unknown if both or neither end is local.
+func decide(srcLocal, dstLocal bool) gopacket.CaptureDirection {
+	switch {
+	case srcLocal && !dstLocal:
+		return gopacket.DirectionOutbound
+	case dstLocal && !srcLocal:
+		return gopacket.DirectionInbound
+	}
+	return gopacket.DirectionUnknown
+}
+
+func (c *Classifier) firstSYN(p gopacket.Packet) gopacket.CaptureDirection {
+	if !c.cfg.FirstSYN {
+		return gopacket.DirectionUnknown
+	}
+	tcp, ok := p.TransportLayer().(*layers.TCP)
+	if !ok || p.NetworkLayer() == nil {
+		return gopacket.DirectionUnknown
+	}
+	nf, tf := p.NetworkLayer().NetworkFlow(), tcp.TransportFlow()
+	k := connKey{nf, tf}
+	if nf.Dst().LessThan(nf.Src()) || (nf.Dst() == nf.Src() && tf.Dst().LessThan(tf.Src())) {
+		k = connKey{nf.Reverse(), tf.Reverse()}
+	}
+	cn := c.conns[k]
+	if cn == nil {
+		if !tcp.SYN {
+			return gopacket.DirectionUnknown
+		}
+		if len(c.conns) >= c.cfg.MaxConnections {
+			if c.cfg.Logger != nil {
+				c.cfg.Logger.Warn("direction: connection table full", "flow", nf, "max", c.cfg.MaxConnections)
+			}
+			return gopacket.DirectionUnknown
+		}
+		cn = &conn{client: nf.Src(), clientPort: tf.Src()}
+		if tcp.ACK {
+			// The SYN was missed, and this SYN-ACK is from the server.
+			cn.client, cn.clientPort = nf.Dst(), tf.Dst()
+		}
+		c.conns[k] = cn
+	}
+	cn.last = p.Metadata().Timestamp
+	if nf.Src() == cn.client && tf.Src() == cn.clientPort {
+		return gopacket.DirectionOutbound
+	}
+	return gopacket.DirectionInbound
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package direction
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/statestore"
+)
+
+var (
+	macA = net.HardwareAddr{0x02, 0, 0, 0, 0, 0xa}
+	macB = net.HardwareAddr{0x02, 0, 0, 0, 0, 0xb}
+)
+
+func tcpPacket(t *testing.T, srcMAC, dstMAC net.HardwareAddr, src, dst string, sport, dport uint16, tcp layers.TCP) gopacket.Packet {
+	eth := &layers.Ethernet{SrcMAC: srcMAC, DstMAC: dstMAC, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.ParseIP(src).To4(),
+		DstIP:    net.ParseIP(dst).To4(),
+	}
+	tcp.SrcPort, tcp.DstPort = layers.TCPPort(sport), layers.TCPPort(dport)
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, &tcp); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	p.Metadata().Timestamp = time.Unix(1000, 0)
+	return p
+}
+
+func TestMethods(t *testing.T) {
+	nets, err := ParseLocalNets("10.0.0.0/8", "2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	syn := layers.TCP{SYN: true}
+	for _, test := range []struct {
+		name   string
+		cfg    Config
+		p      gopacket.Packet
+		capDir gopacket.CaptureDirection
+		dir    gopacket.CaptureDirection
+		method Method
+	}{
+		{"capture", Config{LocalNets: nets}, tcpPacket(t, macA, macB, "10.0.0.1", "192.0.2.1", 1, 2, syn),
+			gopacket.DirectionInbound, gopacket.DirectionInbound, Capture},
+		{"ignored capture", Config{LocalNets: nets, IgnoreCapture: true}, tcpPacket(t, macA, macB, "10.0.0.1", "192.0.2.1", 1, 2, syn),
+			gopacket.DirectionInbound, gopacket.DirectionOutbound, LocalNet},
+		{"source MAC", Config{LocalMACs: []net.HardwareAddr{macA}}, tcpPacket(t, macA, macB, "192.0.2.2", "192.0.2.1", 1, 2, syn),
+			0, gopacket.DirectionOutbound, LocalMAC},
+		{"destination MAC", Config{LocalMACs: []net.HardwareAddr{macA}}, tcpPacket(t, macB, macA, "192.0.2.2", "192.0.2.1", 1, 2, syn),
+			0, gopacket.DirectionInbound, LocalMAC},
+		{"inbound net", Config{LocalNets: nets}, tcpPacket(t, macA, macB, "192.0.2.1", "10.1.2.3", 1, 2, syn),
+			0, gopacket.DirectionInbound, LocalNet},
+		{"internal", Config{LocalNets: nets}, tcpPacket(t, macA, macB, "10.0.0.1", "10.1.2.3", 1, 2, syn),
+			0, gopacket.DirectionUnknown, None},
+		{"first SYN", Config{LocalNets: nets, FirstSYN: true}, tcpPacket(t, macA, macB, "10.0.0.1", "10.1.2.3", 1, 2, syn),
+			0, gopacket.DirectionOutbound, FirstSYN},
+		{"no SYN", Config{FirstSYN: true}, tcpPacket(t, macA, macB, "10.0.0.1", "10.1.2.3", 1, 2, layers.TCP{ACK: true}),
+			0, gopacket.DirectionUnknown, None},
+	} {
+		test.p.Metadata().Direction = test.capDir
+		dir, m := NewClassifier(test.cfg).Classify(test.p)
+		if dir != test.dir || m != test.method {
+			t.Errorf("%s: got %v by %v, want %v by %v", test.name, dir, m, test.dir, test.method)
+		}
+	}
+}
+
+func TestFirstSYN(t *testing.T) {
+	c := NewClassifier(Config{FirstSYN: true})
+	for i, test := range []struct {
+		fromClient bool
+		tcp        layers.TCP
+		want       gopacket.CaptureDirection
+	}{
+		{false, layers.TCP{SYN: true, ACK: true}, gopacket.DirectionInbound},
+		{true, layers.TCP{ACK: true}, gopacket.DirectionOutbound},
+		{false, layers.TCP{ACK: true, PSH: true}, gopacket.DirectionInbound},
+	} {
+		src, dst, sport, dport := "192.0.2.1", "192.0.2.2", uint16(40000), uint16(443)
+		if !test.fromClient {
+			src, dst, sport, dport = dst, src, dport, sport
+		}
+		p := tcpPacket(t, macA, macB, src, dst, sport, dport, test.tcp)
+		if got := c.Annotate(p); got != test.want || p.Metadata().Direction != test.want {
+			t.Errorf("packet %d: got %v, metadata %v, want %v", i, got, p.Metadata().Direction, test.want)
+		}
+	}
+	c.Expire(time.Unix(1001, 0))
+	p := tcpPacket(t, macA, macB, "192.0.2.1", "192.0.2.2", 40000, 443, layers.TCP{ACK: true})
+	if got := c.Annotate(p); got != gopacket.DirectionUnknown {
+		t.Errorf("got %v after expiry, want unknown", got)
+	}
+}
+
+func TestSaveRestore(t *testing.T) {
+	c := NewClassifier(Config{FirstSYN: true})
+	c.Annotate(tcpPacket(t, macA, macB, "192.0.2.1", "192.0.2.2", 40000, 443, layers.TCP{SYN: true}))
+	s := statestore.NewMemory()
+	if err := c.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewClassifier(Config{FirstSYN: true})
+	if err := restored.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	p := tcpPacket(t, macA, macB, "192.0.2.2", "192.0.2.1", 443, 40000, layers.TCP{ACK: true})
+	if got := restored.Annotate(p); got != gopacket.DirectionInbound {
+		t.Errorf("got %v after restore, want inbound", got)
+	}
+}
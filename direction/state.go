@@ -0,0 +1,68 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package direction
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/statestore"
+)
+
+// statePrefix prefixes the keys of the connections saved to a store.
+const statePrefix = "direction/"
+
+// connState is the saved form of a FirstSYN connection.
+type connState struct {
+	Network    statestore.Flow `json:"network"`
+	Transport  statestore.Flow `json:"transport"`
+	Client     []byte          `json:"client"`
+	ClientPort []byte          `json:"client_port"`
+	Last       time.Time       `json:"last"`
+}
+
+// Save writes the FirstSYN connections to s, replacing any saved before.
+func (c *Classifier) Save(s statestore.Store) error {
+	if err := statestore.Clear(s, statePrefix); err != nil {
+		return err
+	}
+	for k, cn := range c.conns {
+		st := connState{
+			Network:    statestore.NewFlow(k.network),
+			Transport:  statestore.NewFlow(k.transport),
+			Client:     cn.client.Raw(),
+			ClientPort: cn.clientPort.Raw(),
+			Last:       cn.last,
+		}
+		if err := statestore.PutJSON(s, statePrefix+k.network.String()+" "+k.transport.String(), st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore adds the FirstSYN connections saved in s, up to the configured
+// maximum.
+func (c *Classifier) Restore(s statestore.Store) error {
+	return s.Scan(statePrefix, func(_ string, v []byte) error {
+		if len(c.conns) >= c.cfg.MaxConnections {
+			return nil
+		}
+		var st connState
+		if err := json.Unmarshal(v, &st); err != nil {
+			return err
+		}
+		k := connKey{st.Network.Flow(), st.Transport.Flow()}
+		c.conns[k] = &conn{
+			client:     gopacket.NewEndpoint(st.Network.Type, st.Client),
+			clientPort: gopacket.NewEndpoint(st.Transport.Type, st.ClientPort),
+			last:       st.Last,
+		}
+		return nil
+	})
+}
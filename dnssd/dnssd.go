@@ -0,0 +1,322 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package dnssd gathers the services hosts advertise with DNS-based
+// service discovery (RFC 6763) over multicast DNS, as Bonjour devices like
+// printers, phones and media players do.
+//
+// A Collector joins the records of mDNS responses: PTR records name the
+// instances of a service type, SRV records give an instance's host and
+// port, TXT records its attributes, and A and AAAA records the addresses
+// of hosts.  The records of an instance often arrive in several packets,
+// and expire with their TTLs:
+//
+//	c := dnssd.NewCollector()
+//	for p := range source.Packets() {
+//	  c.Add(p)
+//	}
+//	c.Expire(time.Now())
+//	for _, h := range c.Hosts() {
+//	  fmt.Println(h.Name, h.Addrs, h.Model)
+//	  for _, s := range h.Services {
+//	    fmt.Println("  ", s.Service, s.Label, s.Port, s.TXT)
+//	  }
+//	}
+package dnssd
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// deviceInfo is the pseudo service type whose TXT records describe the
+// device of the instances with the same label (RFC 6763 section 6.6).
+const deviceInfo = "_device-info._tcp"
+
+// Instance is an instance of a service.
+type Instance struct {
+	// Name is the instance's full name, like
+	// "Living Room._airplay._tcp.local", made of its Label, Service and
+	// Domain.
+	Name    string
+	Label   string
+	Service string
+	Domain  string
+	// Host and Port are the target of the instance's SRV record, if one
+	// was seen.
+	Host string
+	Port uint16
+	// TXT holds the key/value pairs of the instance's TXT record, with
+	// lowercase keys.  Keys without a value, which are boolean
+	// attributes, map to "".
+	TXT map[string]string
+	// Last is when the instance was last announced, and Expires when its
+	// records do.
+	Last, Expires time.Time
+}
+
+// Host is a host advertising services.
+type Host struct {
+	Name string
+	// Addrs are the addresses of the host's A and AAAA records.
+	Addrs []net.IP
+	// Link is the link layer address of the packets announcing the host's
+	// addresses from one of them, if any.
+	Link gopacket.Endpoint
+	// Model is the model of the host's _device-info._tcp record, like
+	// "MacBookPro18,3".
+	Model    string
+	Services []Instance
+}
+
+// host holds the state of a host name.
+type host struct {
+	name string
+	// addrs maps the addresses of the host, as strings, to when they
+	// expire.
+	addrs map[string]time.Time
+	link  gopacket.Endpoint
+}
+
+// Collector gathers the services advertised in mDNS responses.  It is not
+// safe for concurrent use.
+type Collector struct {
+	// instances and hosts are keyed by lowercase name, since DNS names
+	// compare without case.
+	instances map[string]*Instance
+	hosts     map[string]*host
+}
+
+// NewCollector returns an empty Collector.
+func NewCollector() *Collector {
+	return &Collector{
+		instances: map[string]*Instance{},
+		hosts:     map[string]*host{},
+	}
+}
+
+// Add adds the records of p, if it's an mDNS response.  Queries are
+// ignored, since the records they hold are those of other hosts, known to
+// the querier, or proposed in probes.
+func (c *Collector) Add(p gopacket.Packet) {
+	m, ok := p.Layer(layers.LayerTypeMDNS).(*layers.MDNS)
+	if !ok || !m.QR {
+		return
+	}
+	now := p.Metadata().Timestamp
+	var src net.IP
+	if n := p.NetworkLayer(); n != nil {
+		src = net.IP(n.NetworkFlow().Src().Raw())
+	}
+	var link gopacket.Endpoint
+	if l := p.LinkLayer(); l != nil {
+		link = l.LinkFlow().Src()
+	}
+	for _, rrs := range [][]layers.DNSResourceRecord{m.Answers, m.Additionals} {
+		for i := range rrs {
+			c.addRecord(&rrs[i], now, src, link)
+		}
+	}
+}
+
+func (c *Collector) addRecord(rr *layers.DNSResourceRecord, now time.Time, src net.IP, link gopacket.Endpoint) {
+	expires := now.Add(time.Duration(rr.TTL) * time.Second)
+	// Records with a TTL of 0 are goodbyes, withdrawing earlier ones
+	// (RFC 6762 section 10.1).
+	goodbye := rr.TTL == 0
+	switch rr.Type {
+	case layers.DNSTypePTR:
+		name := string(rr.PTR)
+		if goodbye {
+			delete(c.instances, strings.ToLower(name))
+			return
+		}
+		c.instance(name, now, expires)
+	case layers.DNSTypeSRV:
+		if goodbye {
+			delete(c.instances, strings.ToLower(string(rr.Name)))
+			return
+		}
+		if in := c.instance(string(rr.Name), now, expires); in != nil {
+			in.Host = string(rr.SRV.Name)
+			in.Port = rr.SRV.Port
+		}
+	case layers.DNSTypeTXT:
+		if goodbye {
+			return
+		}
+		if in := c.instance(string(rr.Name), now, expires); in != nil {
+			in.TXT = parseTXT(rr.TXTs)
+		}
+	case layers.DNSTypeA, layers.DNSTypeAAAA:
+		key := strings.ToLower(string(rr.Name))
+		h := c.hosts[key]
+		if h == nil {
+			if goodbye {
+				return
+			}
+			h = &host{name: string(rr.Name), addrs: map[string]time.Time{}}
+			c.hosts[key] = h
+		}
+		if goodbye {
+			delete(h.addrs, rr.IP.String())
+			return
+		}
+		h.addrs[rr.IP.String()] = expires
+		if src != nil && src.Equal(rr.IP) && link != (gopacket.Endpoint{}) {
+			h.link = link
+		}
+	}
+}
+
+// instance returns the instance named name, creating it if needed, and
+// extends its expiry.  It returns nil if name isn't an instance name.
+func (c *Collector) instance(name string, now, expires time.Time) *Instance {
+	key := strings.ToLower(name)
+	in := c.instances[key]
+	if in == nil {
+		label, service, domain, ok := splitInstance(name)
+		if !ok {
+			return nil
+		}
+		in = &Instance{Name: name, Label: label, Service: service, Domain: domain}
+		c.instances[key] = in
+	}
+	in.Last = now
+	if expires.After(in.Expires) {
+		in.Expires = expires
+	}
+	return in
+}
+
+// splitInstance splits an instance name into its label, service type, like
+// "_ipp._tcp", and domain.
+func splitInstance(name string) (label, service, domain string, ok bool) {
+	lower := strings.ToLower(name)
+	for _, proto := range []string{"._tcp.", "._udp."} {
+		i := strings.LastIndex(lower, proto)
+		if i < 0 {
+			continue
+		}
+		j := strings.LastIndex(name[:i], "._")
+		if j <= 0 {
+			return "", "", "", false
+		}
+		return name[:j], name[j+1 : i+len(proto)-1], name[i+len(proto):], true
+	}
+	return "", "", "", false
+}
+
+// parseTXT parses the key/value pairs of a TXT record (RFC 6763 section
+// 6.3).  Only the first of pairs with the same key counts.
+func parseTXT(txts [][]byte) map[string]string {
+	m := map[string]string{}
+	for _, t := range txts {
+		s := string(t)
+		key, value := s, ""
+		if i := strings.IndexByte(s, '='); i >= 0 {
+			key, value = s[:i], s[i+1:]
+		}
+		if key == "" {
+			continue
+		}
+		key = strings.ToLower(key)
+		if _, ok := m[key]; !ok {
+			m[key] = value
+		}
+	}
+	return m
+}
+
+// Expire removes the instances and addresses whose records expired before
+// now, and the hosts left without addresses.
+func (c *Collector) Expire(now time.Time) {
+	for k, in := range c.instances {
+		if in.Expires.Before(now) {
+			delete(c.instances, k)
+		}
+	}
+	for k, h := range c.hosts {
+		for a, t := range h.addrs {
+			if t.Before(now) {
+				delete(h.addrs, a)
+			}
+		}
+		if len(h.addrs) == 0 {
+			delete(c.hosts, k)
+		}
+	}
+}
+
+// Instances returns the instances seen, sorted by name.
+func (c *Collector) Instances() []Instance {
+	out := make([]Instance, 0, len(c.instances))
+	for _, in := range c.instances {
+		out = append(out, *in)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Hosts returns the hosts with addresses or instances, sorted by name,
+// each with its instances.  The model of a host is taken from the
+// _device-info._tcp instance with the same label as one of its instances.
+func (c *Collector) Hosts() []Host {
+	byName := map[string]*Host{}
+	get := func(name string) *Host {
+		key := strings.ToLower(name)
+		h := byName[key]
+		if h == nil {
+			h = &Host{Name: name}
+			if s := c.hosts[key]; s != nil {
+				h.Link = s.link
+				for a := range s.addrs {
+					ip := net.ParseIP(a)
+					if ip4 := ip.To4(); ip4 != nil {
+						ip = ip4
+					}
+					h.Addrs = append(h.Addrs, ip)
+				}
+				sort.Slice(h.Addrs, func(i, j int) bool { return h.Addrs[i].String() < h.Addrs[j].String() })
+			}
+			byName[key] = h
+		}
+		return h
+	}
+	for _, s := range c.hosts {
+		get(s.name)
+	}
+	models := map[string]string{}
+	for _, in := range c.Instances() {
+		if strings.EqualFold(in.Service, deviceInfo) {
+			if model := in.TXT["model"]; model != "" {
+				models[strings.ToLower(in.Label)] = model
+			}
+			continue
+		}
+		if in.Host != "" {
+			h := get(in.Host)
+			h.Services = append(h.Services, in)
+		}
+	}
+	out := make([]Host, 0, len(byName))
+	for _, h := range byName {
+		for _, in := range h.Services {
+			if model, ok := models[strings.ToLower(in.Label)]; ok {
+				h.Model = model
+				break
+			}
+		}
+		out = append(out, *h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
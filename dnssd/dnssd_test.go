@@ -0,0 +1,139 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package dnssd
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+var (
+	start = time.Unix(1000, 0)
+	tvMAC = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x42}
+	tvIP  = net.IP{192, 168, 1, 42}
+)
+
+func response(t *testing.T, ts time.Duration, qr bool, rrs ...layers.DNSResourceRecord) gopacket.Packet {
+	eth := &layers.Ethernet{SrcMAC: tvMAC, DstMAC: net.HardwareAddr{0x01, 0, 0x5e, 0, 0, 0xfb}, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{Version: 4, TTL: 255, Protocol: layers.IPProtocolUDP, SrcIP: tvIP, DstIP: net.IP{224, 0, 0, 251}}
+	udp := &layers.UDP{SrcPort: 5353, DstPort: 5353}
+	udp.SetNetworkLayerForChecksum(ip)
+	m := &layers.MDNS{DNS: layers.DNS{QR: qr, AA: qr, Answers: rrs}}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, eth, ip, udp, m); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+	p.Metadata().Timestamp = start.Add(ts)
+	return p
+}
+
+func ptr(service, instance string, ttl uint32) layers.DNSResourceRecord {
+	return layers.DNSResourceRecord{Name: []byte(service), Type: layers.DNSTypePTR, Class: layers.DNSClassIN, TTL: ttl, PTR: []byte(instance)}
+}
+
+func srv(instance, host string, port uint16, ttl uint32) layers.DNSResourceRecord {
+	return layers.DNSResourceRecord{Name: []byte(instance), Type: layers.DNSTypeSRV, Class: layers.DNSClassIN, TTL: ttl, CacheFlush: true,
+		SRV: layers.DNSSRV{Name: []byte(host), Port: port}}
+}
+
+func txt(instance string, ttl uint32, txts ...string) layers.DNSResourceRecord {
+	rr := layers.DNSResourceRecord{Name: []byte(instance), Type: layers.DNSTypeTXT, Class: layers.DNSClassIN, TTL: ttl, CacheFlush: true}
+	for _, s := range txts {
+		rr.TXTs = append(rr.TXTs, []byte(s))
+	}
+	return rr
+}
+
+func a(host string, ip net.IP, ttl uint32) layers.DNSResourceRecord {
+	return layers.DNSResourceRecord{Name: []byte(host), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: ttl, CacheFlush: true, IP: ip}
+}
+
+func TestCollector(t *testing.T) {
+	c := NewCollector()
+	s := time.Second
+	c.Add(response(t, 0, true,
+		ptr("_airplay._tcp.local", "Living Room._airplay._tcp.local", 4500),
+		srv("Living Room._airplay._tcp.local", "Apple-TV.local", 7000, 120),
+		txt("Living Room._airplay._tcp.local", 4500, "deviceid=02:00:00:00:00:42", "Features=0x5A7FFFF7", "pw"),
+		a("Apple-TV.local", tvIP, 120),
+	))
+	// The rest of the host's records come later.
+	c.Add(response(t, 10*s, true,
+		ptr("_raop._tcp.local", "0200000000420@Living Room._raop._tcp.local", 4500),
+		srv("0200000000420@Living Room._raop._tcp.local", "apple-tv.local", 7000, 120),
+		txt("Living Room._device-info._tcp.local", 4500, "model=AppleTV11,1"),
+	))
+	// Known answers in queries aren't advertisements.
+	c.Add(response(t, 20*s, false,
+		ptr("_ipp._tcp.local", "Office._ipp._tcp.local", 4500),
+		srv("Office._ipp._tcp.local", "printer.local", 631, 120),
+	))
+
+	hosts := c.Hosts()
+	if len(hosts) != 1 {
+		t.Fatalf("got hosts %+v, want 1", hosts)
+	}
+	h := hosts[0]
+	if h.Name != "Apple-TV.local" || h.Model != "AppleTV11,1" || !reflect.DeepEqual(h.Addrs, []net.IP{tvIP}) {
+		t.Errorf("got host %+v", h)
+	}
+	if h.Link != layers.NewMACEndpoint(tvMAC) {
+		t.Errorf("got link address %v, want %v", h.Link, tvMAC)
+	}
+	if len(h.Services) != 2 {
+		t.Fatalf("got services %+v, want 2", h.Services)
+	}
+	in := h.Services[1]
+	if in.Label != "Living Room" || in.Service != "_airplay._tcp" || in.Domain != "local" || in.Port != 7000 {
+		t.Errorf("got instance %+v", in)
+	}
+	if want := map[string]string{"deviceid": "02:00:00:00:00:42", "features": "0x5A7FFFF7", "pw": ""}; !reflect.DeepEqual(in.TXT, want) {
+		t.Errorf("got TXT %v, want %v", in.TXT, want)
+	}
+	if in.Last != start || in.Expires != start.Add(4500*s) {
+		t.Errorf("got last %v and expiry %v", in.Last, in.Expires)
+	}
+
+	// A goodbye withdraws an instance.
+	c.Add(response(t, 30*s, true, ptr("_raop._tcp.local", "0200000000420@Living Room._raop._tcp.local", 0)))
+	if n := len(c.Instances()); n != 2 {
+		t.Errorf("got %d instances after goodbye, want 2", n)
+	}
+	// The address expires before the instances.
+	c.Expire(start.Add(200 * s))
+	hosts = c.Hosts()
+	if len(hosts) != 1 || hosts[0].Addrs != nil || len(hosts[0].Services) != 1 {
+		t.Errorf("got hosts %+v after the address expired", hosts)
+	}
+	c.Expire(start.Add(5000 * s))
+	if n := len(c.Instances()); n != 0 {
+		t.Errorf("got %d instances after expiry, want 0", n)
+	}
+}
+
+func TestSplitInstance(t *testing.T) {
+	for _, test := range []struct {
+		name, label, service, domain string
+		ok                           bool
+	}{
+		{"Office._ipp._tcp.local", "Office", "_ipp._tcp", "local", true},
+		{"My.Dotted.Name._http._TCP.example.com", "My.Dotted.Name", "_http._TCP", "example.com", true},
+		{"_ipp._tcp.local", "", "", "", false},
+		{"host.local", "", "", "", false},
+	} {
+		label, service, domain, ok := splitInstance(test.name)
+		if label != test.label || service != test.service || domain != test.domain || ok != test.ok {
+			t.Errorf("splitInstance(%q) = %q, %q, %q, %v", test.name, label, service, domain, ok)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package dnstrack pairs DNS queries with their responses, as passive DNS
+// monitoring does.
+//
+// A query and a response belong to the same transaction when they share
+// their transaction ID, addresses and ports, reversed, and question.  A
+// Tracker measures the latency of each transaction, and flags queries left
+// unanswered, responses whose question doesn't match the query with their
+// ID, which may be spoofed, and responses to no query seen:
+//
+//	tr := dnstrack.NewTracker(dnstrack.DefaultConfig)
+//	for p := range source.Packets() {
+//	  if t := tr.Add(p); t != nil {
+//	    export(t)
+//	  }
+//	  for _, t := range tr.Expire(p.Metadata().Timestamp) {
+//	    export(&t)
+//	  }
+//	}
+//	for _, t := range tr.Flush() {
+//	  export(&t)
+//	}
+//
+// Transactions have JSON tags, for export.
+package dnstrack
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// Status is the outcome of a transaction.
+type Status int
+
+const (
+	// Answered transactions have a query and its response.
+	Answered Status = iota
+	// Unanswered transactions have a query that got no response within
+	// the timeout.
+	Unanswered
+	// Mismatched transactions have a response whose ID matches a pending
+	// query, but whose question doesn't.
+	Mismatched
+	// Unsolicited transactions have a response to no query seen, as after
+	// a capture starts, or for a response sent twice.
+	Unsolicited
+)
+
+func (s Status) String() string {
+	switch s {
+	case Answered:
+		return "answered"
+	case Unanswered:
+		return "unanswered"
+	case Mismatched:
+		return "mismatched"
+	case Unsolicited:
+		return "unsolicited"
+	default:
+		return fmt.Sprintf("UnknownStatus(%d)", int(s))
+	}
+}
+
+// MarshalText writes s by name.
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Transaction is a DNS transaction.  The question is that of the query,
+// or of the response if no query was seen.
+type Transaction struct {
+	Client     net.IP `json:"client"`
+	ClientPort uint16 `json:"client_port"`
+	Server     net.IP `json:"server"`
+	ServerPort uint16 `json:"server_port"`
+	// Transport is "udp" or "tcp".
+	Transport string          `json:"transport"`
+	ID        uint16          `json:"id"`
+	Name      string          `json:"name"`
+	Type      layers.DNSType  `json:"type"`
+	Class     layers.DNSClass `json:"class"`
+	Status    Status          `json:"status"`
+	// QueryTime is when the query was first sent, and ResponseTime when
+	// the response was seen.  Either is zero if missing.
+	QueryTime    time.Time `json:"query_time"`
+	ResponseTime time.Time `json:"response_time"`
+	// Latency is the time from the first query to the response, for
+	// answered transactions.
+	Latency time.Duration `json:"latency"`
+	// Retransmits counts the copies of the query sent after the first.
+	Retransmits int `json:"retransmits"`
+	// The remaining fields come from the response.
+	RCode     layers.DNSResponseCode `json:"rcode"`
+	Answers   int                    `json:"answers"`
+	Truncated bool                   `json:"truncated"`
+	// ResponseName and ResponseType are the question of the response of a
+	// mismatched transaction.
+	ResponseName string         `json:"response_name,omitempty"`
+	ResponseType layers.DNSType `json:"response_type,omitempty"`
+}
+
+// Config configures a Tracker.
+type Config struct {
+	// Timeout is how long a query waits for its response before it's
+	// unanswered.
+	Timeout time.Duration
+}
+
+// DefaultConfig waits as long for responses as common stub resolvers do.
+var DefaultConfig = Config{Timeout: 5 * time.Second}
+
+// tupleKey identifies the queries with an ID on a flow, from client to
+// server.
+type tupleKey struct {
+	network, transport gopacket.Flow
+	id                 uint16
+}
+
+type question struct {
+	name  string
+	typ   layers.DNSType
+	class layers.DNSClass
+}
+
+// pending is a query waiting for its response.
+type pending struct {
+	q  question
+	tx Transaction
+}
+
+// Tracker pairs DNS queries and responses.  It is not safe for concurrent
+// use.
+type Tracker struct {
+	Config
+	pending map[tupleKey][]*pending
+}
+
+// NewTracker creates a Tracker with the given configuration.
+func NewTracker(c Config) *Tracker {
+	return &Tracker{Config: c, pending: map[tupleKey][]*pending{}}
+}
+
+// Add processes p, if it holds a DNS message.  It returns the transaction
+// a response finishes, and nil for queries and other packets.
+func (tr *Tracker) Add(p gopacket.Packet) *Transaction {
+	dns, ok := p.Layer(layers.LayerTypeDNS).(*layers.DNS)
+	if !ok {
+		return nil
+	}
+	nl, trans := p.NetworkLayer(), p.TransportLayer()
+	if nl == nil || trans == nil {
+		return nil
+	}
+	nf, tf := nl.NetworkFlow(), trans.TransportFlow()
+	ts := p.Metadata().Timestamp
+	var q question
+	if len(dns.Questions) > 0 {
+		dq := &dns.Questions[0]
+		q = question{strings.ToLower(string(dq.Name)), dq.Type, dq.Class}
+	}
+
+	if !dns.QR {
+		k := tupleKey{nf, tf, dns.ID}
+		for _, pq := range tr.pending[k] {
+			if pq.q == q {
+				pq.tx.Retransmits++
+				return nil
+			}
+		}
+		tx := newTransaction(nf, tf, trans.LayerType(), dns)
+		tx.QueryTime = ts
+		tr.pending[k] = append(tr.pending[k], &pending{q: q, tx: tx})
+		return nil
+	}
+
+	k := tupleKey{nf.Reverse(), tf.Reverse(), dns.ID}
+	queries := tr.pending[k]
+	for i, pq := range queries {
+		if pq.q != q {
+			continue
+		}
+		tr.remove(k, i)
+		tx := pq.tx
+		tx.Status = Answered
+		tx.Latency = ts.Sub(tx.QueryTime)
+		tx.setResponse(ts, dns)
+		return &tx
+	}
+	tx := newTransaction(nf.Reverse(), tf.Reverse(), trans.LayerType(), dns)
+	tx.Status = Unsolicited
+	if len(queries) > 0 {
+		// The query stays pending, as its real response may yet come.
+		pq := queries[0]
+		tx.Status = Mismatched
+		tx.QueryTime = pq.tx.QueryTime
+		tx.Retransmits = pq.tx.Retransmits
+		tx.Name, tx.Type, tx.Class = pq.tx.Name, pq.tx.Type, pq.tx.Class
+		if len(dns.Questions) > 0 {
+			tx.ResponseName, tx.ResponseType = string(dns.Questions[0].Name), dns.Questions[0].Type
+		}
+	}
+	tx.setResponse(ts, dns)
+	return &tx
+}
+
+func (tr *Tracker) remove(k tupleKey, i int) {
+	queries := tr.pending[k]
+	if len(queries) == 1 {
+		delete(tr.pending, k)
+		return
+	}
+	tr.pending[k] = append(queries[:i:i], queries[i+1:]...)
+}
+
+// newTransaction starts a transaction on the flow from client to server,
+// with the question of dns.
+func newTransaction(nf, tf gopacket.Flow, transport gopacket.LayerType, dns *layers.DNS) Transaction {
+	tx := Transaction{
+		Client: net.IP(nf.Src().Raw()),
+		Server: net.IP(nf.Dst().Raw()),
+		ID:     dns.ID,
+	}
+	tx.ClientPort, tx.ServerPort = port(tf.Src()), port(tf.Dst())
+	switch transport {
+	case layers.LayerTypeUDP:
+		tx.Transport = "udp"
+	case layers.LayerTypeTCP:
+		tx.Transport = "tcp"
+	}
+	if len(dns.Questions) > 0 {
+		q := &dns.Questions[0]
+		tx.Name, tx.Type, tx.Class = string(q.Name), q.Type, q.Class
+	}
+	return tx
+}
+
+func port(e gopacket.Endpoint) uint16 {
+	if raw := e.Raw(); len(raw) == 2 {
+		return uint16(raw[0])<<8 | uint16(raw[1])
+	}
+	return 0
+}
+
+func (tx *Transaction) setResponse(ts time.Time, dns *layers.DNS) {
+	tx.ResponseTime = ts
+	tx.RCode = dns.ResponseCode
+	tx.Answers = len(dns.Answers)
+	tx.Truncated = dns.TC
+}
+
+// Expire returns the queries sent a timeout or more before now, with no
+// response, as unanswered transactions, sorted by query time.
+func (tr *Tracker) Expire(now time.Time) []Transaction {
+	var out []Transaction
+	for k, queries := range tr.pending {
+		kept := queries[:0]
+		for _, pq := range queries {
+			if now.Sub(pq.tx.QueryTime) >= tr.Timeout {
+				pq.tx.Status = Unanswered
+				out = append(out, pq.tx)
+			} else {
+				kept = append(kept, pq)
+			}
+		}
+		if len(kept) == 0 {
+			delete(tr.pending, k)
+		} else {
+			tr.pending[k] = kept
+		}
+	}
+	sortTransactions(out)
+	return out
+}
+
+// Flush returns every pending query as an unanswered transaction, sorted
+// by query time, as at the end of a capture.
+func (tr *Tracker) Flush() []Transaction {
+	var out []Transaction
+	for _, queries := range tr.pending {
+		for _, pq := range queries {
+			pq.tx.Status = Unanswered
+			out = append(out, pq.tx)
+		}
+	}
+	tr.pending = map[tupleKey][]*pending{}
+	sortTransactions(out)
+	return out
+}
+
+func sortTransactions(txs []Transaction) {
+	sort.Slice(txs, func(i, j int) bool {
+		if !txs[i].QueryTime.Equal(txs[j].QueryTime) {
+			return txs[i].QueryTime.Before(txs[j].QueryTime)
+		}
+		return txs[i].ID < txs[j].ID
+	})
+}
@@ -0,0 +1,121 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package dnstrack
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+var (
+	client   = net.IP{10, 0, 0, 1}
+	resolver = net.IP{10, 0, 0, 53}
+	start    = time.Unix(1000, 0)
+)
+
+func message(t *testing.T, ts time.Duration, port layers.UDPPort, dns *layers.DNS) gopacket.Packet {
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: client, DstIP: resolver}
+	udp := &layers.UDP{SrcPort: port, DstPort: 53}
+	if dns.QR {
+		ip.SrcIP, ip.DstIP = resolver, client
+		udp.SrcPort, udp.DstPort = 53, port
+	}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ip, udp, dns); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	p.Metadata().Timestamp = start.Add(ts)
+	return p
+}
+
+func query(id uint16, name string, typ layers.DNSType) *layers.DNS {
+	return &layers.DNS{ID: id, RD: true, Questions: []layers.DNSQuestion{{Name: []byte(name), Type: typ, Class: layers.DNSClassIN}}}
+}
+
+func response(id uint16, name string, typ layers.DNSType, rcode layers.DNSResponseCode) *layers.DNS {
+	d := query(id, name, typ)
+	d.QR, d.RA, d.ResponseCode = true, true, rcode
+	if rcode == layers.DNSResponseCodeNoErr && typ == layers.DNSTypeA {
+		d.Answers = []layers.DNSResourceRecord{{Name: []byte(name), Type: typ, Class: layers.DNSClassIN, TTL: 60, IP: net.IP{192, 0, 2, 1}}}
+	}
+	return d
+}
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(DefaultConfig)
+	ms := time.Millisecond
+	add := func(ts time.Duration, port layers.UDPPort, dns *layers.DNS) *Transaction {
+		return tr.Add(message(t, ts, port, dns))
+	}
+
+	// A and AAAA queries with the same ID, answered out of order, the A
+	// query after a retransmission.
+	if tx := add(0, 40000, query(1, "example.com", layers.DNSTypeA)); tx != nil {
+		t.Fatalf("query finished transaction %+v", tx)
+	}
+	add(0, 40000, query(1, "example.com", layers.DNSTypeAAAA))
+	add(1000*ms, 40000, query(1, "example.com", layers.DNSTypeA))
+	tx := add(1020*ms, 40000, response(1, "example.com", layers.DNSTypeAAAA, layers.DNSResponseCodeNoErr))
+	if tx == nil || tx.Status != Answered || tx.Type != layers.DNSTypeAAAA || tx.Latency != 1020*ms || tx.Retransmits != 0 {
+		t.Errorf("got AAAA transaction %+v", tx)
+	}
+	// Names compare without case.
+	tx = add(1030*ms, 40000, response(1, "EXAMPLE.com", layers.DNSTypeA, layers.DNSResponseCodeNoErr))
+	if tx == nil || tx.Status != Answered || tx.Latency != 1030*ms || tx.Retransmits != 1 || tx.Answers != 1 {
+		t.Errorf("got A transaction %+v", tx)
+	}
+	if !tx.Client.Equal(client) || tx.ClientPort != 40000 || !tx.Server.Equal(resolver) || tx.ServerPort != 53 || tx.Transport != "udp" {
+		t.Errorf("got endpoints %+v", tx)
+	}
+
+	// A response to another question is mismatched, and the query waits
+	// on.
+	add(2000*ms, 40001, query(2, "bank.example", layers.DNSTypeA))
+	tx = add(2010*ms, 40001, response(2, "evil.example", layers.DNSTypeA, layers.DNSResponseCodeNoErr))
+	if tx == nil || tx.Status != Mismatched || tx.Name != "bank.example" || tx.ResponseName != "evil.example" {
+		t.Errorf("got mismatched transaction %+v", tx)
+	}
+	tx = add(2030*ms, 40001, response(2, "bank.example", layers.DNSTypeA, layers.DNSResponseCodeNXDomain))
+	if tx == nil || tx.Status != Answered || tx.RCode != layers.DNSResponseCodeNXDomain {
+		t.Errorf("got transaction %+v after mismatch", tx)
+	}
+
+	// A second response has no query left.
+	tx = add(2040*ms, 40001, response(2, "bank.example", layers.DNSTypeA, layers.DNSResponseCodeNXDomain))
+	if tx == nil || tx.Status != Unsolicited || !tx.QueryTime.IsZero() || !tx.Client.Equal(client) {
+		t.Errorf("got duplicate response transaction %+v", tx)
+	}
+
+	add(3000*ms, 40002, query(3, "slow.example", layers.DNSTypeA))
+	add(4000*ms, 40003, query(4, "lost.example", layers.DNSTypeA))
+	if txs := tr.Expire(start.Add(7999 * ms)); len(txs) != 0 {
+		t.Errorf("expired %+v too early", txs)
+	}
+	txs := tr.Expire(start.Add(8000 * ms))
+	if len(txs) != 1 || txs[0].Status != Unanswered || txs[0].ID != 3 {
+		t.Errorf("got expired transactions %+v", txs)
+	}
+	txs = tr.Flush()
+	if len(txs) != 1 || txs[0].ID != 4 {
+		t.Errorf("got flushed transactions %+v", txs)
+	}
+	b, err := json.Marshal(txs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"status":"unanswered"`) {
+		t.Errorf("status not exported by name: %s", b)
+	}
+}
@@ -66,7 +66,7 @@ func Run(src gopacket.PacketDataSource) {
 			ip4 := ip4Layer.(*layers.IPv4)
 			l := ip4.Length
 
-			newip4, err := defragger.DefragIPv4(ip4)
+			newip4, err := defragger.DefragIPv4WithTimestamp(ip4, packet.Metadata().Timestamp)
 			if err != nil {
 				log.Fatalln("Error while de-fragmenting", err)
 			} else if newip4 == nil {
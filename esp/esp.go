@@ -0,0 +1,327 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package esp decrypts and verifies IPsec ESP (RFC 4303) packets with
+// security associations registered by the user, and decodes the packets
+// they carry.
+//
+// The supported transforms are AES-CBC (RFC 3602) with HMAC-SHA1-96 or
+// HMAC-SHA2 (RFC 4868) integrity, AES-GCM with a 16 byte ICV (RFC 4106),
+// and NULL encryption (RFC 2410) with HMAC integrity.  Cryptography comes
+// from a packetcrypto.Provider.  Sequence numbers aren't checked for
+// replays, and extended sequence numbers aren't supported.
+//
+// Usage:
+//
+//	d := esp.NewDecrypter()
+//	err := d.AddSA(esp.SA{SPI: 0x1000, Cipher: esp.AESGCM, Key: keyAndSalt})
+//	...
+//	for p := range source.Packets() {
+//	  if inner, err := d.DecryptPacket(p, gopacket.Default); err == nil {
+//	    // inner holds the decrypted IP packet in tunnel mode, or the
+//	    // transport layer in transport mode.
+//	  }
+//	}
+package esp
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/packetcrypto"
+)
+
+// Cipher is an ESP encryption transform.
+type Cipher int
+
+const (
+	// Null is NULL encryption: the payload is sent in the clear.
+	Null Cipher = iota
+	// AESCBC is AES in CBC mode, with a 16, 24 or 32 byte key.
+	AESCBC
+	// AESGCM is AES-GCM with a 16 byte ICV.  Its key is the AES key
+	// followed by the 4 byte salt, as IKE derives it.
+	AESGCM
+)
+
+func (c Cipher) String() string {
+	switch c {
+	case Null:
+		return "NULL"
+	case AESCBC:
+		return "AES-CBC"
+	case AESGCM:
+		return "AES-GCM-16"
+	}
+	return fmt.Sprintf("UnknownCipher(%d)", int(c))
+}
+
+// Auth is an ESP integrity transform.  AES-GCM provides its own, and must
+// be used with NoAuth.
+type Auth int
+
+const (
+	NoAuth Auth = iota
+	HMACSHA1_96
+	HMACSHA256_128
+	HMACSHA384_192
+	HMACSHA512_256
+)
+
+func (a Auth) String() string {
+	switch a {
+	case NoAuth:
+		return "NONE"
+	case HMACSHA1_96:
+		return "HMAC-SHA1-96"
+	case HMACSHA256_128:
+		return "HMAC-SHA256-128"
+	case HMACSHA384_192:
+		return "HMAC-SHA384-192"
+	case HMACSHA512_256:
+		return "HMAC-SHA512-256"
+	}
+	return fmt.Sprintf("UnknownAuth(%d)", int(a))
+}
+
+// hash returns the hash and truncated ICV length of a.
+func (a Auth) hash() (packetcrypto.Hash, int) {
+	switch a {
+	case HMACSHA1_96:
+		return packetcrypto.SHA1, 12
+	case HMACSHA256_128:
+		return packetcrypto.SHA256, 16
+	case HMACSHA384_192:
+		return packetcrypto.SHA384, 24
+	case HMACSHA512_256:
+		return packetcrypto.SHA512, 32
+	}
+	return 0, 0
+}
+
+// SA is a security association: the SPI and transforms of one direction
+// of an IPsec connection, and their keys.
+type SA struct {
+	SPI uint32
+	// Destination, if set, restricts the SA to packets sent to that
+	// address, for captures where peers chose the same SPI.
+	Destination net.IP
+	Cipher      Cipher
+	Key         []byte
+	Auth        Auth
+	AuthKey     []byte
+	// Provider supplies the cryptography; nil means packetcrypto.Default.
+	Provider packetcrypto.Provider
+}
+
+// Errors returned by Decrypt.
+var (
+	ErrUnknownSA = errors.New("esp: no SA for SPI")
+	ErrAuth      = errors.New("esp: integrity check failed")
+)
+
+// sa is an SA with its transforms set up.
+type sa struct {
+	SA
+	block  cipher.Block
+	aead   cipher.AEAD
+	salt   []byte
+	mac    hash.Hash
+	icvLen int
+}
+
+// Decrypter holds SAs and decrypts the ESP packets that use them.  It is
+// not safe for concurrent use.
+type Decrypter struct {
+	sas map[uint32][]*sa
+}
+
+// NewDecrypter creates a Decrypter with no SAs.
+func NewDecrypter() *Decrypter {
+	return &Decrypter{sas: map[uint32][]*sa{}}
+}
+
+// AddSA registers s, replacing any SA with the same SPI and destination.
+// It returns an error if the keys don't suit the transforms, or the
+// provider refuses them.
+func (d *Decrypter) AddSA(s SA) error {
+	p := s.Provider
+	if p == nil {
+		p = packetcrypto.Default
+	}
+	n := &sa{SA: s}
+	var err error
+	switch s.Cipher {
+	case Null:
+	case AESCBC:
+		n.block, err = p.NewAES(s.Key)
+	case AESGCM:
+		if len(s.Key) < 4 {
+			return fmt.Errorf("esp: AES-GCM key length %d too short", len(s.Key))
+		}
+		if s.Auth != NoAuth {
+			return fmt.Errorf("esp: AES-GCM used with %v", s.Auth)
+		}
+		n.salt = s.Key[len(s.Key)-4:]
+		n.aead, err = p.NewAESGCM(s.Key[:len(s.Key)-4])
+	default:
+		return fmt.Errorf("esp: unknown cipher %v", s.Cipher)
+	}
+	if err != nil {
+		return fmt.Errorf("esp: SA %#x: %v", s.SPI, err)
+	}
+	if s.Auth != NoAuth {
+		h, icvLen := s.Auth.hash()
+		if icvLen == 0 {
+			return fmt.Errorf("esp: unknown auth %v", s.Auth)
+		}
+		if n.mac, err = p.NewHMAC(h, s.AuthKey); err != nil {
+			return fmt.Errorf("esp: SA %#x: %v", s.SPI, err)
+		}
+		n.icvLen = icvLen
+	}
+	d.RemoveSA(s.SPI, s.Destination)
+	d.sas[s.SPI] = append(d.sas[s.SPI], n)
+	return nil
+}
+
+// RemoveSA removes the SA with the given SPI and destination.
+func (d *Decrypter) RemoveSA(spi uint32, dst net.IP) {
+	sas := d.sas[spi]
+	for i, s := range sas {
+		if s.Destination.Equal(dst) {
+			sas = append(sas[:i], sas[i+1:]...)
+			break
+		}
+	}
+	if len(sas) == 0 {
+		delete(d.sas, spi)
+	} else {
+		d.sas[spi] = sas
+	}
+}
+
+// lookup returns the SA for spi and dst, preferring one restricted to dst.
+func (d *Decrypter) lookup(spi uint32, dst net.IP) *sa {
+	var fallback *sa
+	for _, s := range d.sas[spi] {
+		if s.Destination == nil {
+			fallback = s
+		} else if s.Destination.Equal(dst) {
+			return s
+		}
+	}
+	return fallback
+}
+
+// Decrypted is the content of an ESP packet.
+type Decrypted struct {
+	SA SA
+	// NextHeader is the protocol of Data: IPv4 or IPv6 in tunnel mode,
+	// the transport protocol in transport mode.
+	NextHeader layers.IPProtocol
+	Data       []byte
+	Padding    []byte
+	// Authenticated is true if the SA has an integrity transform, which
+	// verified the packet.
+	Authenticated bool
+}
+
+// Decrypt decrypts and verifies e, which was sent to dst.  dst may be nil
+// if no SA is restricted to a destination.
+func (d *Decrypter) Decrypt(e *layers.IPSecESP, dst net.IP) (*Decrypted, error) {
+	s := d.lookup(e.SPI, dst)
+	if s == nil {
+		return nil, fmt.Errorf("%w %#x", ErrUnknownSA, e.SPI)
+	}
+	data := e.Contents
+	if len(data) < 8 {
+		return nil, fmt.Errorf("esp: length %d too short", len(data))
+	}
+	var plain []byte
+	switch s.Cipher {
+	case AESGCM:
+		n := s.aead.NonceSize() - len(s.salt)
+		if len(data) < 8+n+s.aead.Overhead() {
+			return nil, fmt.Errorf("esp: length %d too short for %v", len(data), s.Cipher)
+		}
+		nonce := append(append([]byte(nil), s.salt...), data[8:8+n]...)
+		var err error
+		if plain, err = s.aead.Open(nil, nonce, data[8+n:], data[:8]); err != nil {
+			return nil, ErrAuth
+		}
+	default:
+		if len(data) < 8+s.icvLen {
+			return nil, fmt.Errorf("esp: length %d too short for %v", len(data), s.Auth)
+		}
+		body, icv := data[:len(data)-s.icvLen], data[len(data)-s.icvLen:]
+		if s.mac != nil {
+			s.mac.Reset()
+			s.mac.Write(body)
+			if subtle.ConstantTimeCompare(s.mac.Sum(nil)[:s.icvLen], icv) != 1 {
+				return nil, ErrAuth
+			}
+		}
+		plain = body[8:]
+		if s.Cipher == AESCBC {
+			bs := s.block.BlockSize()
+			if len(plain) < 2*bs || len(plain)%bs != 0 {
+				return nil, fmt.Errorf("esp: %v payload length %d invalid", s.Cipher, len(plain))
+			}
+			iv := plain[:bs]
+			out := make([]byte, len(plain)-bs)
+			cipher.NewCBCDecrypter(s.block, iv).CryptBlocks(out, plain[bs:])
+			plain = out
+		}
+	}
+	if len(plain) < 2 {
+		return nil, fmt.Errorf("esp: payload length %d too short", len(plain))
+	}
+	padLen := int(plain[len(plain)-2])
+	if padLen+2 > len(plain) {
+		return nil, fmt.Errorf("esp: pad length %d exceeds payload", padLen)
+	}
+	end := len(plain) - 2 - padLen
+	return &Decrypted{
+		SA:            s.SA,
+		NextHeader:    layers.IPProtocol(plain[len(plain)-1]),
+		Data:          plain[:end],
+		Padding:       plain[end : len(plain)-2],
+		Authenticated: s.mac != nil || s.aead != nil,
+	}, nil
+}
+
+// DecryptPacket decrypts the ESP layer of p and decodes its content as a
+// new packet, starting with the layer given by the ESP next header, with
+// p's capture info.
+func (d *Decrypter) DecryptPacket(p gopacket.Packet, opts gopacket.DecodeOptions) (gopacket.Packet, error) {
+	e, ok := p.Layer(layers.LayerTypeIPSecESP).(*layers.IPSecESP)
+	if !ok {
+		return nil, errors.New("esp: packet has no ESP layer")
+	}
+	var dst net.IP
+	switch ip := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		dst = ip.DstIP
+	case *layers.IPv6:
+		dst = ip.DstIP
+	}
+	dec, err := d.Decrypt(e, dst)
+	if err != nil {
+		return nil, err
+	}
+	inner := gopacket.NewPacket(dec.Data, dec.NextHeader, opts)
+	md := inner.Metadata()
+	md.CaptureInfo = p.Metadata().CaptureInfo
+	md.CaptureLength, md.Length = len(dec.Data), len(dec.Data)
+	return inner, nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package esp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+var (
+	outerSrc = net.IP{192, 0, 2, 1}
+	outerDst = net.IP{192, 0, 2, 2}
+)
+
+// innerPacket returns an IPv4 UDP packet to tunnel.
+func innerPacket(t *testing.T) []byte {
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &layers.UDP{SrcPort: 1000, DstPort: 2000}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ip, udp, gopacket.Payload("secret")); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// espPacket wraps an ESP payload in an outer IPv4 header and decodes it.
+func espPacket(t *testing.T, esp []byte) gopacket.Packet {
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolESP, SrcIP: outerSrc, DstIP: outerDst}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ip, gopacket.Payload(esp)); err != nil {
+		t.Fatal(err)
+	}
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+}
+
+// trailer pads data for blockSize and appends the pad length and next
+// header.
+func trailer(data []byte, blockSize int, next layers.IPProtocol) []byte {
+	out := append([]byte(nil), data...)
+	for i := 1; (len(out)+2)%blockSize != 0; i++ {
+		out = append(out, byte(i))
+	}
+	return append(out, byte(len(out)-len(data)), byte(next))
+}
+
+func header(spi, seq uint32) []byte {
+	var h [8]byte
+	binary.BigEndian.PutUint32(h[:4], spi)
+	binary.BigEndian.PutUint32(h[4:], seq)
+	return h[:]
+}
+
+func checkInner(t *testing.T, inner gopacket.Packet) {
+	if inner.ErrorLayer() != nil {
+		t.Fatal("Failed to decode inner packet:", inner.ErrorLayer().Error())
+	}
+	if app := inner.ApplicationLayer(); app == nil || string(app.Payload()) != "secret" {
+		t.Errorf("got inner packet %v", inner)
+	}
+	if ip, ok := inner.NetworkLayer().(*layers.IPv4); !ok || !ip.DstIP.Equal(net.IP{10, 0, 0, 2}) {
+		t.Errorf("got inner network layer %v", inner.NetworkLayer())
+	}
+}
+
+func TestAESCBCHMAC(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 16)
+	authKey := bytes.Repeat([]byte{2}, 32)
+	iv := bytes.Repeat([]byte{3}, 16)
+	plain := trailer(innerPacket(t), 16, layers.IPProtocolIPv4)
+	block, _ := aes.NewCipher(key)
+	ct := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ct, plain)
+	esp := append(append(header(0x1000, 1), iv...), ct...)
+	mac := hmac.New(sha256.New, authKey)
+	mac.Write(esp)
+	esp = append(esp, mac.Sum(nil)[:16]...)
+
+	d := NewDecrypter()
+	if err := d.AddSA(SA{SPI: 0x1000, Destination: outerDst, Cipher: AESCBC, Key: key, Auth: HMACSHA256_128, AuthKey: authKey}); err != nil {
+		t.Fatal(err)
+	}
+	p := espPacket(t, esp)
+	inner, err := d.DecryptPacket(p, gopacket.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInner(t, inner)
+
+	// A corrupted ICV fails authentication.
+	esp[len(esp)-1] ^= 1
+	if _, err := d.DecryptPacket(espPacket(t, esp), gopacket.Default); err != ErrAuth {
+		t.Errorf("got error %v for corrupted packet, want ErrAuth", err)
+	}
+
+	// The SA doesn't apply to other destinations.
+	e := p.Layer(layers.LayerTypeIPSecESP).(*layers.IPSecESP)
+	if _, err := d.Decrypt(e, net.IP{192, 0, 2, 3}); !errors.Is(err, ErrUnknownSA) {
+		t.Errorf("got error %v for other destination, want ErrUnknownSA", err)
+	}
+	d.RemoveSA(0x1000, outerDst)
+	if _, err := d.Decrypt(e, outerDst); !errors.Is(err, ErrUnknownSA) {
+		t.Errorf("got error %v after RemoveSA, want ErrUnknownSA", err)
+	}
+}
+
+func TestAESGCM(t *testing.T) {
+	key := bytes.Repeat([]byte{4}, 16)
+	salt := []byte{5, 6, 7, 8}
+	iv := []byte{0, 0, 0, 0, 0, 0, 0, 9}
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCM(block)
+	hdr := header(0x2000, 9)
+	sealed := gcm.Seal(nil, append(append([]byte(nil), salt...), iv...), trailer(innerPacket(t), 4, layers.IPProtocolIPv4), hdr)
+	esp := append(append(hdr, iv...), sealed...)
+
+	d := NewDecrypter()
+	if err := d.AddSA(SA{SPI: 0x2000, Cipher: AESGCM, Key: append(key, salt...)}); err != nil {
+		t.Fatal(err)
+	}
+	inner, err := d.DecryptPacket(espPacket(t, esp), gopacket.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInner(t, inner)
+
+	// The header is authenticated.
+	esp[7] ^= 1
+	if _, err := d.DecryptPacket(espPacket(t, esp), gopacket.Default); err != ErrAuth {
+		t.Errorf("got error %v for modified sequence number, want ErrAuth", err)
+	}
+}
+
+func TestNullTransport(t *testing.T) {
+	udp := innerPacket(t)[20:]
+	esp := append(header(0x3000, 1), trailer(udp, 4, layers.IPProtocolUDP)...)
+	d := NewDecrypter()
+	if err := d.AddSA(SA{SPI: 0x3000, Cipher: Null}); err != nil {
+		t.Fatal(err)
+	}
+	dec, err := d.Decrypt(espPacket(t, esp).Layer(layers.LayerTypeIPSecESP).(*layers.IPSecESP), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec.NextHeader != layers.IPProtocolUDP || !bytes.Equal(dec.Data, udp) || dec.Authenticated {
+		t.Errorf("got %+v", dec)
+	}
+}
+
+func TestAddSAErrors(t *testing.T) {
+	d := NewDecrypter()
+	for _, s := range []SA{
+		{Cipher: AESCBC, Key: []byte{1, 2, 3}},
+		{Cipher: AESGCM, Key: make([]byte, 20), Auth: HMACSHA1_96},
+		{Cipher: Null, Auth: Auth(99)},
+	} {
+		if err := d.AddSA(s); err == nil {
+			t.Errorf("AddSA(%+v) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+//go:build js && wasm
+// +build js,wasm
+
+// wasmviewer exposes gopacket's decoders to JavaScript, for capture viewers
+// running in the browser without a backend.  Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o wasmviewer.wasm
+//
+// and load it with the wasm_exec.js shipped with Go.  It defines one
+// function, gopacketDecode, which takes the contents of a pcap or pcapng
+// file as a Uint8Array and returns the JSON encoding of a
+// packetjson.Capture:
+//
+//	const go = new Go();
+//	const wasm = await WebAssembly.instantiateStreaming(fetch("wasmviewer.wasm"), go.importObject);
+//	go.run(wasm.instance);
+//	const bytes = new Uint8Array(await file.arrayBuffer());
+//	const capture = JSON.parse(gopacketDecode(bytes));
+//	for (const p of capture.packets) {
+//	  console.log(p.timestamp, p.layers.map(l => l.type).join("/"));
+//	}
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/mistsys/gopacket/packetjson"
+)
+
+func decode(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 || args[0].Type() != js.TypeObject {
+		return `{"packets":[],"error":"gopacketDecode takes one Uint8Array"}`
+	}
+	data := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(data, args[0])
+	return string(packetjson.DecodeCaptureJSON(data))
+}
+
+func main() {
+	js.Global().Set("gopacketDecode", js.FuncOf(decode))
+	// Keep the functions available to JavaScript.
+	select {}
+}
@@ -0,0 +1,216 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package extcap makes a program a Wireshark extcap, so that Wireshark
+// can show the packets of a gopacket pipeline live, such as frames after
+// decapsulation or decryption.
+//
+// Wireshark runs the programs in its extcap folder (see "About Wireshark",
+// "Folders") to list their interfaces, and runs one again to capture from
+// the interface the user picks, reading pcap from a FIFO it creates.  An
+// Extcap implements that command line protocol for its Interfaces, each of
+// which has a CaptureFunc writing packets until it's stopped:
+//
+//	func main() {
+//	  e := &extcap.Extcap{
+//	    Version: "1.0",
+//	    Interfaces: []extcap.Interface{{
+//	      Value:    "decrypted",
+//	      Display:  "Decrypted WLAN frames",
+//	      LinkType: layers.LinkTypeEthernet,
+//	      Capture: func(ctx context.Context, w extcap.PacketWriter, filter string) error {
+//	        return extcap.Packets(startPipeline(ctx))(ctx, w, filter)
+//	      },
+//	    }},
+//	  }
+//	  e.Main()
+//	}
+//
+// Wireshark stops a capture by closing the FIFO and terminating the
+// program.  Interfaces don't have configuration options, and the control
+// pipes of the extcap protocol aren't used.
+package extcap
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/pcapgo"
+)
+
+// PacketWriter writes captured packets to Wireshark.
+type PacketWriter interface {
+	WritePacket(ci gopacket.CaptureInfo, data []byte) error
+}
+
+// CaptureFunc writes packets to w until ctx is done, or there are no more
+// packets.  filter is the capture filter the user entered, if any.  Errors
+// from w end the capture, and should be returned.
+type CaptureFunc func(ctx context.Context, w PacketWriter, filter string) error
+
+// Interface is an interface Wireshark can capture from.
+type Interface struct {
+	// Value identifies the interface on the command line, and Display is
+	// the name Wireshark shows.
+	Value, Display string
+	// LinkType is the link type of the packets, and Snaplen the maximum
+	// length of their data, 65536 if zero.
+	LinkType layers.LinkType
+	Snaplen  uint32
+	Capture  CaptureFunc
+	// ValidateFilter, if set, checks capture filters as the user types
+	// them.  Without it, all filters are valid.
+	ValidateFilter func(filter string) error
+}
+
+// Extcap is an extcap program.
+type Extcap struct {
+	// Version is the version of the program, and Help a URL to its
+	// documentation, if any.
+	Version, Help string
+	Interfaces    []Interface
+}
+
+// Packets returns a CaptureFunc writing the packets from ch, until ch is
+// closed.  It ignores the filter.
+func Packets(ch <-chan gopacket.Packet) CaptureFunc {
+	return func(ctx context.Context, w PacketWriter, filter string) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case p, ok := <-ch:
+				if !ok {
+					return nil
+				}
+				if err := w.WritePacket(p.Metadata().CaptureInfo, p.Data()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func (e *Extcap) iface(value string) (*Interface, error) {
+	for i := range e.Interfaces {
+		if e.Interfaces[i].Value == value {
+			return &e.Interfaces[i], nil
+		}
+	}
+	return nil, fmt.Errorf("extcap: unknown interface %q", value)
+}
+
+// Run runs the extcap command given by args, the program's arguments,
+// writing its output to stdout.  A capture runs until ctx is done, the
+// interface's CaptureFunc returns, or Wireshark closes the FIFO.
+func (e *Extcap) Run(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("extcap", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	var (
+		interfaces = fs.Bool("extcap-interfaces", false, "list interfaces")
+		dlts       = fs.Bool("extcap-dlts", false, "list link types")
+		config     = fs.Bool("extcap-config", false, "list options")
+		capture    = fs.Bool("capture", false, "capture")
+		iface      = fs.String("extcap-interface", "", "interface")
+		fifo       = fs.String("fifo", "", "FIFO to write pcap to")
+		filter     = fs.String("extcap-capture-filter", "", "capture filter")
+	)
+	// Accepted and ignored.
+	fs.String("extcap-version", "", "Wireshark version")
+	fs.String("extcap-control-in", "", "control pipe")
+	fs.String("extcap-control-out", "", "control pipe")
+	fs.Bool("debug", false, "debug")
+	fs.String("debug-file", "", "debug file")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("extcap: %v", err)
+	}
+
+	if *interfaces {
+		fmt.Fprintf(stdout, "extcap {version=%s}", e.Version)
+		if e.Help != "" {
+			fmt.Fprintf(stdout, "{help=%s}", e.Help)
+		}
+		fmt.Fprintln(stdout)
+		for _, i := range e.Interfaces {
+			fmt.Fprintf(stdout, "interface {value=%s}{display=%s}\n", i.Value, i.Display)
+		}
+		return nil
+	}
+	i, err := e.iface(*iface)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *dlts:
+		fmt.Fprintf(stdout, "dlt {number=%d}{name=%s}{display=%s}\n", uint16(i.LinkType), i.LinkType, i.LinkType)
+		return nil
+	case *config:
+		return nil
+	case *capture:
+		return i.capture(ctx, *fifo, *filter)
+	case *filter != "":
+		if i.ValidateFilter != nil {
+			if err := i.ValidateFilter(*filter); err != nil {
+				fmt.Fprintln(stdout, err)
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.New("extcap: no command")
+}
+
+func (i *Interface) capture(ctx context.Context, fifo, filter string) error {
+	if fifo == "" {
+		return errors.New("extcap: no FIFO to capture to")
+	}
+	f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	snaplen := i.Snaplen
+	if snaplen == 0 {
+		snaplen = 65536
+	}
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(snaplen, i.LinkType); err != nil {
+		return err
+	}
+	err = i.Capture(ctx, w, filter)
+	if errors.Is(err, syscall.EPIPE) {
+		// Wireshark stopped reading.
+		return nil
+	}
+	return err
+}
+
+// Main runs the extcap command given by the program's arguments, stopping
+// captures on SIGINT and SIGTERM, and exits with status 1 if it fails.
+func (e *Extcap) Main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+	err := e.Run(ctx, os.Args[1:], os.Stdout)
+	cancel()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package extcap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/pcapgo"
+)
+
+func testExtcap(ch chan gopacket.Packet) *Extcap {
+	return &Extcap{
+		Version: "1.0",
+		Interfaces: []Interface{{
+			Value:    "decap",
+			Display:  "Decapsulated frames",
+			LinkType: layers.LinkTypeEthernet,
+			Capture:  Packets(ch),
+			ValidateFilter: func(f string) error {
+				if f != "all" {
+					return errors.New("only all is supported")
+				}
+				return nil
+			},
+		}},
+	}
+}
+
+func TestList(t *testing.T) {
+	e := testExtcap(nil)
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--extcap-interfaces", "--extcap-version=4.2"}, "extcap {version=1.0}\ninterface {value=decap}{display=Decapsulated frames}\n"},
+		{[]string{"--extcap-dlts", "--extcap-interface", "decap"}, "dlt {number=1}{name=Ethernet}{display=Ethernet}\n"},
+		{[]string{"--extcap-config", "--extcap-interface", "decap"}, ""},
+		{[]string{"--extcap-interface", "decap", "--extcap-capture-filter", "all"}, ""},
+	} {
+		var out bytes.Buffer
+		if err := e.Run(context.Background(), test.args, &out); err != nil {
+			t.Errorf("%v: %v", test.args, err)
+		} else if out.String() != test.want {
+			t.Errorf("%v: got %q, want %q", test.args, out.String(), test.want)
+		}
+	}
+	var out bytes.Buffer
+	if err := e.Run(context.Background(), []string{"--extcap-interface", "decap", "--extcap-capture-filter", "tcp"}, &out); err == nil || out.Len() == 0 {
+		t.Errorf("invalid filter accepted, output %q", out.String())
+	}
+	if err := e.Run(context.Background(), []string{"--extcap-dlts", "--extcap-interface", "eth0"}, &out); err == nil {
+		t.Error("unknown interface accepted")
+	}
+}
+
+func TestCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// A regular file stands in for Wireshark's FIFO.
+	fifo := filepath.Join(dir, "fifo")
+	if err := ioutil.WriteFile(fifo, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan gopacket.Packet, 2)
+	for _, data := range []string{"first", "second"} {
+		p := gopacket.NewPacket([]byte(data), gopacket.DecodePayload, gopacket.Default)
+		p.Metadata().CaptureInfo = gopacket.CaptureInfo{Timestamp: time.Unix(1, 0), CaptureLength: len(data), Length: len(data)}
+		ch <- p
+	}
+	close(ch)
+	args := []string{"--capture", "--extcap-interface", "decap", "--fifo", fifo}
+	if err := testExtcap(ch).Run(context.Background(), args, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(fifo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.LinkType() != layers.LinkTypeEthernet {
+		t.Errorf("got link type %v", r.LinkType())
+	}
+	var got []string
+	for {
+		data, _, err := r.ReadPacketData()
+		if err != nil {
+			break
+		}
+		got = append(got, string(data))
+	}
+	if strings.Join(got, ",") != "first,second" {
+		t.Errorf("got packets %q", got)
+	}
+}
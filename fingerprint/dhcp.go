@@ -0,0 +1,65 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package fingerprint
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mistsys/gopacket/layers"
+)
+
+// DHCP is what a DHCP client's requests reveal of it.  Which options a
+// client asks for in option 55, and in what order, depends on its
+// operating system and DHCP client rather than on the network, so the
+// list is the signature device classification databases, like
+// Fingerbank, look devices up by.
+type DHCP struct {
+	// ParamsRequest is the option 55 parameter request list, its codes in
+	// decimal separated by commas, like "1,121,3,6,15,119,252".
+	ParamsRequest string
+	// Options is the codes of the options in the message, in order,
+	// separated by commas, which also vary between clients.
+	Options string
+	// ClassID is the vendor class identifier of option 60, like
+	// "MSFT 5.0" or "android-dhcp-13".
+	ClassID  string
+	Hostname string
+}
+
+// FromDHCPv4 returns what d, a DISCOVER, REQUEST or INFORM message, reveals
+// of the client, or nil for other messages.
+func FromDHCPv4(d *layers.DHCPv4) *DHCP {
+	if d.Operation != layers.DHCPOpRequest {
+		return nil
+	}
+	switch d.MessageType() {
+	case layers.DHCPMsgTypeDiscover, layers.DHCPMsgTypeRequest, layers.DHCPMsgTypeInform:
+	default:
+		return nil
+	}
+	codes := make([]string, len(d.Options))
+	for i, o := range d.Options {
+		codes[i] = strconv.Itoa(int(o.Type))
+	}
+	params := d.ParamsRequest()
+	list := make([]string, len(params))
+	for i, p := range params {
+		list[i] = strconv.Itoa(int(p))
+	}
+	return &DHCP{
+		ParamsRequest: strings.Join(list, ","),
+		Options:       strings.Join(codes, ","),
+		ClassID:       d.ClassID(),
+		Hostname:      d.Hostname(),
+	}
+}
+
+// Fingerprint returns the parameter request list and its hash.
+func (f *DHCP) Fingerprint() Fingerprint {
+	return newFingerprint(f.ParamsRequest)
+}
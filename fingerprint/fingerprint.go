@@ -0,0 +1,160 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package fingerprint computes the JA3 and JA3S fingerprints of TLS
+// clients and servers, and the HASSH fingerprints of SSH clients and
+// servers, from the hellos and key exchange messages they send in the
+// clear.
+//
+// The messages are parsed from the start of a TCP payload, which must hold
+// the whole message; TLS and SSH aren't decoded as layers.  DTLS hellos
+// decoded by layers.DTLS are fingerprinted too:
+//
+//	if app := p.ApplicationLayer(); app != nil {
+//	  if h, err := fingerprint.ParseClientHello(app.Payload()); err == nil {
+//	    fmt.Println(h.JA3().MD5)
+//	  }
+//	}
+//
+// The requests of DHCP clients, decoded by layers.DHCPv4, give their
+// option 55 signatures, which classify devices:
+//
+//	if d, ok := p.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4); ok {
+//	  if f := fingerprint.FromDHCPv4(d); f != nil {
+//	    fmt.Println(f.ParamsRequest, f.ClassID)
+//	  }
+//	}
+package fingerprint
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/mistsys/gopacket/layers"
+)
+
+// Fingerprint is a fingerprint string and its MD5 hash, in hex, which is
+// the form the fingerprint is usually shared in.
+type Fingerprint struct {
+	Raw string
+	MD5 string
+}
+
+func newFingerprint(raw string) Fingerprint {
+	sum := md5.Sum([]byte(raw))
+	return Fingerprint{Raw: raw, MD5: hex.EncodeToString(sum[:])}
+}
+
+// Extension is a TLS hello extension.
+type Extension struct {
+	Type uint16
+	Data []byte
+}
+
+// TLS extensions used by JA3.
+const (
+	extensionSupportedGroups = 10
+	extensionPointFormats    = 11
+)
+
+// ClientHello is the part of a TLS or DTLS ClientHello JA3 uses.
+type ClientHello struct {
+	Version      uint16
+	CipherSuites []uint16
+	Extensions   []Extension
+}
+
+// ServerHello is the part of a TLS or DTLS ServerHello JA3S uses.
+type ServerHello struct {
+	Version     uint16
+	CipherSuite uint16
+	Extensions  []Extension
+}
+
+// FromDTLSClientHello returns the ClientHello of a decoded DTLS one.
+func FromDTLSClientHello(h *layers.DTLSClientHello) *ClientHello {
+	c := &ClientHello{Version: uint16(h.Version), CipherSuites: h.CipherSuites}
+	for _, e := range h.Extensions {
+		c.Extensions = append(c.Extensions, Extension{Type: e.Type, Data: e.Data})
+	}
+	return c
+}
+
+// FromDTLSServerHello returns the ServerHello of a decoded DTLS one.
+func FromDTLSServerHello(h *layers.DTLSServerHello) *ServerHello {
+	s := &ServerHello{Version: uint16(h.Version), CipherSuite: h.CipherSuite}
+	for _, e := range h.Extensions {
+		s.Extensions = append(s.Extensions, Extension{Type: e.Type, Data: e.Data})
+	}
+	return s
+}
+
+// isGREASE reports whether v is one of the values of RFC 8701, which
+// clients send at random to keep servers tolerant of unknown values, and
+// which JA3 ignores.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// join returns the decimal values of vs, but GREASE ones, joined by dashes.
+func join(vs []uint16) string {
+	var parts []string
+	for _, v := range vs {
+		if !isGREASE(v) {
+			parts = append(parts, strconv.Itoa(int(v)))
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+func extensionTypes(es []Extension) []uint16 {
+	ts := make([]uint16, len(es))
+	for i, e := range es {
+		ts[i] = e.Type
+	}
+	return ts
+}
+
+// JA3 returns the JA3 fingerprint of h: its version, cipher suites,
+// extensions, supported groups and point formats.
+func (h *ClientHello) JA3() Fingerprint {
+	var groups, formats []uint16
+	for _, e := range h.Extensions {
+		switch e.Type {
+		case extensionSupportedGroups:
+			if b, _, err := vector(e.Data, 2); err == nil {
+				for ; len(b) >= 2; b = b[2:] {
+					groups = append(groups, uint16(b[0])<<8|uint16(b[1]))
+				}
+			}
+		case extensionPointFormats:
+			if b, _, err := vector(e.Data, 1); err == nil {
+				for _, f := range b {
+					formats = append(formats, uint16(f))
+				}
+			}
+		}
+	}
+	return newFingerprint(strings.Join([]string{
+		strconv.Itoa(int(h.Version)),
+		join(h.CipherSuites),
+		join(extensionTypes(h.Extensions)),
+		join(groups),
+		join(formats),
+	}, ","))
+}
+
+// JA3S returns the JA3S fingerprint of h: its version, cipher suite and
+// extensions.
+func (h *ServerHello) JA3S() Fingerprint {
+	return newFingerprint(strings.Join([]string{
+		strconv.Itoa(int(h.Version)),
+		strconv.Itoa(int(h.CipherSuite)),
+		join(extensionTypes(h.Extensions)),
+	}, ","))
+}
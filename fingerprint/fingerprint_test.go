@@ -0,0 +1,170 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package fingerprint
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/mistsys/gopacket/layers"
+)
+
+// prefixed returns b after its length in n bytes.
+func prefixed(n int, b []byte) []byte {
+	l := make([]byte, 4)
+	binary.BigEndian.PutUint32(l, uint32(len(b)))
+	return append(l[4-n:], b...)
+}
+
+func uint16s(vs ...uint16) []byte {
+	var b []byte
+	for _, v := range vs {
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return b
+}
+
+func extensions(es ...Extension) []byte {
+	var b []byte
+	for _, e := range es {
+		b = append(b, uint16s(e.Type)...)
+		b = append(b, prefixed(2, e.Data)...)
+	}
+	return prefixed(2, b)
+}
+
+func record(typ byte, body []byte) []byte {
+	hs := append([]byte{typ}, prefixed(3, body)...)
+	return append([]byte{22, 3, 1}, prefixed(2, hs)...)
+}
+
+func TestJA3(t *testing.T) {
+	body := uint16s(769)
+	body = append(body, make([]byte, 32)...)
+	body = append(body, prefixed(1, []byte{1, 2, 3, 4})...)
+	// 0x0a0a is GREASE.
+	body = append(body, prefixed(2, uint16s(0x0a0a, 47, 53, 5, 10, 49161, 49162, 49171, 49172, 50, 56, 19, 4))...)
+	body = append(body, prefixed(1, []byte{0})...)
+	body = append(body, extensions(
+		Extension{Type: 0, Data: []byte("server name")},
+		Extension{Type: 0x1a1a},
+		Extension{Type: 10, Data: prefixed(2, uint16s(0x2a2a, 23, 24, 25))},
+		Extension{Type: 11, Data: prefixed(1, []byte{0})},
+	)...)
+	h, err := ParseClientHello(record(1, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Fingerprint{
+		Raw: "769,47-53-5-10-49161-49162-49171-49172-50-56-19-4,0-10-11,23-24-25,0",
+		MD5: "ada70206e40642a3e4461f35503241d5",
+	}
+	if got := h.JA3(); got != want {
+		t.Errorf("JA3 = %+v, want %+v", got, want)
+	}
+
+	d := FromDTLSClientHello(&layers.DTLSClientHello{
+		Version:      layers.DTLSVersion12,
+		CipherSuites: []uint16{49195},
+		Extensions:   []layers.DTLSExtension{{Type: 23}},
+	})
+	if got := d.JA3().Raw; got != "65277,49195,23,," {
+		t.Errorf("DTLS JA3 = %q", got)
+	}
+
+	if _, err := ParseClientHello(record(2, body)); err == nil {
+		t.Error("server hello parsed as client hello")
+	}
+	if _, err := ParseClientHello(record(1, body[:40])); err == nil {
+		t.Error("truncated client hello parsed")
+	}
+}
+
+func TestJA3S(t *testing.T) {
+	body := uint16s(771)
+	body = append(body, make([]byte, 32)...)
+	body = append(body, prefixed(1, nil)...)
+	body = append(body, uint16s(49199)...)
+	body = append(body, 0)
+	body = append(body, extensions(Extension{Type: 65281, Data: []byte{0}}, Extension{Type: 11, Data: []byte{1, 0}})...)
+	h, err := ParseServerHello(record(2, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := h.JA3S().Raw, "771,49199,65281-11"; got != want {
+		t.Errorf("JA3S = %q, want %q", got, want)
+	}
+}
+
+func TestHASSH(t *testing.T) {
+	lists := []string{
+		"curve25519-sha256,diffie-hellman-group14-sha256",
+		"ssh-ed25519",
+		"chacha20-poly1305@openssh.com,aes128-ctr",
+		"aes256-ctr",
+		"umac-64-etm@openssh.com",
+		"hmac-sha2-256",
+		"none,zlib@openssh.com",
+		"none",
+		"",
+		"",
+	}
+	payload := append([]byte{sshMsgKEXInit}, make([]byte, 16)...)
+	for _, l := range lists {
+		payload = append(payload, prefixed(4, []byte(l))...)
+	}
+	payload = append(payload, 0, 0, 0, 0, 0)
+	padding := make([]byte, 4)
+	packet := append([]byte{byte(len(padding))}, payload...)
+	packet = append(packet, padding...)
+	data := append([]byte("SSH-2.0-OpenSSH_8.9\r\n"), prefixed(4, packet)...)
+
+	k, err := ParseKEXInit(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := "curve25519-sha256,diffie-hellman-group14-sha256;chacha20-poly1305@openssh.com,aes128-ctr;umac-64-etm@openssh.com;none,zlib@openssh.com"
+	sum := md5.Sum([]byte(raw))
+	if got, want := k.HASSH(), (Fingerprint{Raw: raw, MD5: hex.EncodeToString(sum[:])}); got != want {
+		t.Errorf("HASSH = %+v, want %+v", got, want)
+	}
+	if got, want := k.HASSHServer().Raw, "curve25519-sha256,diffie-hellman-group14-sha256;aes256-ctr;hmac-sha2-256;none"; got != want {
+		t.Errorf("HASSHServer = %q, want %q", got, want)
+	}
+
+	if _, err := ParseKEXInit(data[:len(data)-10]); err == nil {
+		t.Error("truncated KEXINIT parsed")
+	}
+}
+
+func TestDHCP(t *testing.T) {
+	d := &layers.DHCPv4{Operation: layers.DHCPOpRequest, Options: layers.DHCPOptions{
+		layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeDiscover)}),
+		layers.NewDHCPOption(layers.DHCPOptClientID, []byte{1, 2, 0, 0, 0, 0, 1}),
+		layers.NewDHCPOption(layers.DHCPOptMaxMessageSize, []byte{5, 220}),
+		layers.NewDHCPOption(layers.DHCPOptClassID, []byte("android-dhcp-13")),
+		layers.NewDHCPOption(layers.DHCPOptHostname, []byte("Pixel-7")),
+		layers.NewDHCPOption(layers.DHCPOptParamsRequest, []byte{1, 3, 6, 15, 26, 28, 51, 58, 59, 43, 114, 108}),
+	}}
+	f := FromDHCPv4(d)
+	if f == nil {
+		t.Fatal("no fingerprint for DISCOVER")
+	}
+	want := DHCP{ParamsRequest: "1,3,6,15,26,28,51,58,59,43,114,108", Options: "53,61,57,60,12,55", ClassID: "android-dhcp-13", Hostname: "Pixel-7"}
+	if *f != want {
+		t.Errorf("got %+v, want %+v", *f, want)
+	}
+	if got := f.Fingerprint().Raw; got != want.ParamsRequest {
+		t.Errorf("fingerprint = %q, want %q", got, want.ParamsRequest)
+	}
+	d.Options[0].Data[0] = byte(layers.DHCPMsgTypeRelease)
+	if f := FromDHCPv4(d); f != nil {
+		t.Errorf("got fingerprint %+v for RELEASE", f)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package fingerprint
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const sshMsgKEXInit = 20
+
+// KEXInit is an SSH key exchange init message (RFC 4253 section 7.1).  The
+// algorithms are comma separated name lists, in order of preference.
+type KEXInit struct {
+	KEXAlgorithms           string
+	ServerHostKeyAlgorithms string
+	CiphersClientServer     string
+	CiphersServerClient     string
+	MACsClientServer        string
+	MACsServerClient        string
+	CompressionClientServer string
+	CompressionServerClient string
+	LanguagesClientServer   string
+	LanguagesServerClient   string
+	FirstKEXPacketFollows   bool
+}
+
+// ParseKEXInit parses the SSH KEXINIT packet at the start of data, a TCP
+// payload.  The identification string before it, which some
+// implementations send in the same segment, is skipped.
+func ParseKEXInit(data []byte) (*KEXInit, error) {
+	if bytes.HasPrefix(data, []byte("SSH-")) {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return nil, fmt.Errorf("SSH identification string not terminated")
+		}
+		data = data[i+1:]
+	}
+	// The binary packet: its length, the length of the padding after the
+	// payload, and the payload.  There's no MAC before keys are exchanged.
+	packet, _, err := vector(data, 4)
+	if err != nil {
+		return nil, fmt.Errorf("SSH packet: %v", err)
+	}
+	if len(packet) < 1 || int(packet[0])+1 > len(packet) {
+		return nil, fmt.Errorf("SSH packet padding invalid")
+	}
+	b := packet[1 : len(packet)-int(packet[0])]
+	if len(b) < 17 || b[0] != sshMsgKEXInit {
+		return nil, fmt.Errorf("SSH packet not a KEXINIT")
+	}
+	// Skip the cookie.
+	b = b[17:]
+	k := &KEXInit{}
+	for _, f := range []*string{
+		&k.KEXAlgorithms,
+		&k.ServerHostKeyAlgorithms,
+		&k.CiphersClientServer,
+		&k.CiphersServerClient,
+		&k.MACsClientServer,
+		&k.MACsServerClient,
+		&k.CompressionClientServer,
+		&k.CompressionServerClient,
+		&k.LanguagesClientServer,
+		&k.LanguagesServerClient,
+	} {
+		var list []byte
+		if list, b, err = vector(b, 4); err != nil {
+			return nil, fmt.Errorf("SSH KEXINIT name list: %v", err)
+		}
+		*f = string(list)
+	}
+	if len(b) < 5 {
+		return nil, fmt.Errorf("SSH KEXINIT truncated")
+	}
+	k.FirstKEXPacketFollows = b[0] != 0
+	if r := binary.BigEndian.Uint32(b[1:5]); r != 0 {
+		return nil, fmt.Errorf("SSH KEXINIT reserved field %d not zero", r)
+	}
+	return k, nil
+}
+
+// HASSH returns the HASSH fingerprint of k sent by a client: its key
+// exchange algorithms, and its ciphers, MACs and compression algorithms
+// for sending to the server.
+func (k *KEXInit) HASSH() Fingerprint {
+	return newFingerprint(strings.Join([]string{
+		k.KEXAlgorithms,
+		k.CiphersClientServer,
+		k.MACsClientServer,
+		k.CompressionClientServer,
+	}, ";"))
+}
+
+// HASSHServer returns the HASSHServer fingerprint of k sent by a server:
+// its key exchange algorithms, and its ciphers, MACs and compression
+// algorithms for sending to the client.
+func (k *KEXInit) HASSHServer() Fingerprint {
+	return newFingerprint(strings.Join([]string{
+		k.KEXAlgorithms,
+		k.CiphersServerClient,
+		k.MACsServerClient,
+		k.CompressionServerClient,
+	}, ";"))
+}
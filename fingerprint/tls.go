@@ -0,0 +1,148 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package fingerprint
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	tlsRecordHandshake = 22
+
+	tlsHandshakeClientHello = 1
+	tlsHandshakeServerHello = 2
+)
+
+// vector returns the vector with a length prefix of size bytes at the start
+// of b, and what follows it.
+func vector(b []byte, size int) ([]byte, []byte, error) {
+	if len(b) < size {
+		return nil, nil, fmt.Errorf("vector length truncated")
+	}
+	n := 0
+	for _, c := range b[:size] {
+		n = n<<8 | int(c)
+	}
+	if size+n > len(b) {
+		return nil, nil, fmt.Errorf("vector length %d exceeds message", n)
+	}
+	return b[size : size+n], b[size+n:], nil
+}
+
+// handshake returns the body of the handshake message of type typ in the
+// TLS record at the start of data.
+func handshake(data []byte, typ uint8) ([]byte, error) {
+	if len(data) < 5 {
+		return nil, fmt.Errorf("TLS record header length %d too short", len(data))
+	}
+	if data[0] != tlsRecordHandshake {
+		return nil, fmt.Errorf("TLS record type %d not handshake", data[0])
+	}
+	if data[1] != 3 {
+		return nil, fmt.Errorf("TLS record version %#04x invalid", binary.BigEndian.Uint16(data[1:3]))
+	}
+	record, _, err := vector(data[3:], 2)
+	if err != nil {
+		return nil, fmt.Errorf("TLS record: %v", err)
+	}
+	if len(record) < 4 {
+		return nil, fmt.Errorf("TLS handshake header length %d too short", len(record))
+	}
+	if record[0] != typ {
+		return nil, fmt.Errorf("TLS handshake type %d, not %d", record[0], typ)
+	}
+	body, _, err := vector(record[1:], 3)
+	if err != nil {
+		// Messages split across records aren't reassembled.
+		return nil, fmt.Errorf("TLS handshake: %v", err)
+	}
+	return body, nil
+}
+
+func parseExtensions(b []byte) ([]Extension, error) {
+	if len(b) == 0 {
+		// Extensions are optional.
+		return nil, nil
+	}
+	b, _, err := vector(b, 2)
+	if err != nil {
+		return nil, fmt.Errorf("TLS extensions: %v", err)
+	}
+	var out []Extension
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, fmt.Errorf("TLS extension truncated")
+		}
+		e := Extension{Type: binary.BigEndian.Uint16(b[:2])}
+		if e.Data, b, err = vector(b[2:], 2); err != nil {
+			return nil, fmt.Errorf("TLS extension %d: %v", e.Type, err)
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// ParseClientHello parses the TLS ClientHello at the start of data, a TCP
+// payload.  The hello must be in the first record.
+func ParseClientHello(data []byte) (*ClientHello, error) {
+	b, err := handshake(data, tlsHandshakeClientHello)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 34 {
+		return nil, fmt.Errorf("TLS client hello length %d too short", len(b))
+	}
+	h := &ClientHello{Version: binary.BigEndian.Uint16(b[:2])}
+	// Skip the random and session ID.
+	_, rest, err := vector(b[34:], 1)
+	if err != nil {
+		return nil, fmt.Errorf("TLS session ID: %v", err)
+	}
+	suites, rest, err := vector(rest, 2)
+	if err != nil {
+		return nil, fmt.Errorf("TLS cipher suites: %v", err)
+	}
+	if len(suites)%2 != 0 {
+		return nil, fmt.Errorf("TLS cipher suites length %d odd", len(suites))
+	}
+	for i := 0; i < len(suites); i += 2 {
+		h.CipherSuites = append(h.CipherSuites, binary.BigEndian.Uint16(suites[i:i+2]))
+	}
+	if _, rest, err = vector(rest, 1); err != nil {
+		return nil, fmt.Errorf("TLS compression methods: %v", err)
+	}
+	if h.Extensions, err = parseExtensions(rest); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// ParseServerHello parses the TLS ServerHello at the start of data, a TCP
+// payload.
+func ParseServerHello(data []byte) (*ServerHello, error) {
+	b, err := handshake(data, tlsHandshakeServerHello)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 34 {
+		return nil, fmt.Errorf("TLS server hello length %d too short", len(b))
+	}
+	h := &ServerHello{Version: binary.BigEndian.Uint16(b[:2])}
+	_, rest, err := vector(b[34:], 1)
+	if err != nil {
+		return nil, fmt.Errorf("TLS session ID: %v", err)
+	}
+	if len(rest) < 3 {
+		return nil, fmt.Errorf("TLS server hello truncated")
+	}
+	h.CipherSuite = binary.BigEndian.Uint16(rest[:2])
+	if h.Extensions, err = parseExtensions(rest[3:]); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
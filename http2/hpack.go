@@ -0,0 +1,275 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package http2
+
+import (
+	"errors"
+	"fmt"
+)
+
+// HeaderField is a decoded header field.
+type HeaderField struct {
+	Name, Value string
+	// Sensitive is set for fields the sender asked never to be indexed,
+	// like credentials.
+	Sensitive bool
+}
+
+func (f HeaderField) String() string {
+	return f.Name + ": " + f.Value
+}
+
+// size is the size of f in a dynamic table (RFC 7541 section 4.1).
+func (f HeaderField) size() int {
+	return len(f.Name) + len(f.Value) + 32
+}
+
+// staticTable is the HPACK static table (RFC 7541 appendix A), from index
+// 1.
+var staticTable = []HeaderField{
+	{Name: ":authority"},
+	{Name: ":method", Value: "GET"},
+	{Name: ":method", Value: "POST"},
+	{Name: ":path", Value: "/"},
+	{Name: ":path", Value: "/index.html"},
+	{Name: ":scheme", Value: "http"},
+	{Name: ":scheme", Value: "https"},
+	{Name: ":status", Value: "200"},
+	{Name: ":status", Value: "204"},
+	{Name: ":status", Value: "206"},
+	{Name: ":status", Value: "304"},
+	{Name: ":status", Value: "400"},
+	{Name: ":status", Value: "404"},
+	{Name: ":status", Value: "500"},
+	{Name: "accept-charset"},
+	{Name: "accept-encoding", Value: "gzip, deflate"},
+	{Name: "accept-language"},
+	{Name: "accept-ranges"},
+	{Name: "accept"},
+	{Name: "access-control-allow-origin"},
+	{Name: "age"},
+	{Name: "allow"},
+	{Name: "authorization"},
+	{Name: "cache-control"},
+	{Name: "content-disposition"},
+	{Name: "content-encoding"},
+	{Name: "content-language"},
+	{Name: "content-length"},
+	{Name: "content-location"},
+	{Name: "content-range"},
+	{Name: "content-type"},
+	{Name: "cookie"},
+	{Name: "date"},
+	{Name: "etag"},
+	{Name: "expect"},
+	{Name: "expires"},
+	{Name: "from"},
+	{Name: "host"},
+	{Name: "if-match"},
+	{Name: "if-modified-since"},
+	{Name: "if-none-match"},
+	{Name: "if-range"},
+	{Name: "if-unmodified-since"},
+	{Name: "last-modified"},
+	{Name: "link"},
+	{Name: "location"},
+	{Name: "max-forwards"},
+	{Name: "proxy-authenticate"},
+	{Name: "proxy-authorization"},
+	{Name: "range"},
+	{Name: "referer"},
+	{Name: "refresh"},
+	{Name: "retry-after"},
+	{Name: "server"},
+	{Name: "set-cookie"},
+	{Name: "strict-transport-security"},
+	{Name: "transfer-encoding"},
+	{Name: "user-agent"},
+	{Name: "vary"},
+	{Name: "via"},
+	{Name: "www-authenticate"},
+}
+
+// DefaultHeaderTableSize is the initial size of a dynamic table.
+const DefaultHeaderTableSize = 4096
+
+// HPACKDecoder decodes the header blocks sent in one direction of a
+// connection (RFC 7541), which share a dynamic table.  It is not safe for
+// concurrent use.
+type HPACKDecoder struct {
+	// dynamic holds the dynamic table, oldest entry first.
+	dynamic []HeaderField
+	size    int
+	// maxSize is the table's size, which the encoder sets, and limit the
+	// most it may set it to.
+	maxSize, limit int
+}
+
+// NewHPACKDecoder returns a decoder whose dynamic table may grow to limit
+// bytes, the SETTINGS_HEADER_TABLE_SIZE of the decoding side.
+func NewHPACKDecoder(limit int) *HPACKDecoder {
+	return &HPACKDecoder{maxSize: limit, limit: limit}
+}
+
+// SetLimit changes the limit of the dynamic table's size, after the
+// decoding side changes its SETTINGS_HEADER_TABLE_SIZE.
+func (d *HPACKDecoder) SetLimit(limit int) {
+	d.limit = limit
+	if d.maxSize > limit {
+		d.setMaxSize(limit)
+	}
+}
+
+// TableSize returns the size of the dynamic table's entries.
+func (d *HPACKDecoder) TableSize() int { return d.size }
+
+func (d *HPACKDecoder) setMaxSize(n int) {
+	d.maxSize = n
+	d.evict()
+}
+
+func (d *HPACKDecoder) evict() {
+	for d.size > d.maxSize {
+		d.size -= d.dynamic[0].size()
+		d.dynamic = d.dynamic[1:]
+	}
+}
+
+func (d *HPACKDecoder) insert(f HeaderField) {
+	d.dynamic = append(d.dynamic, f)
+	d.size += f.size()
+	d.evict()
+}
+
+// field returns the field at index i of the static and dynamic tables.
+func (d *HPACKDecoder) field(i uint64) (HeaderField, error) {
+	switch {
+	case i == 0:
+	case i <= uint64(len(staticTable)):
+		return staticTable[i-1], nil
+	case i-uint64(len(staticTable)) <= uint64(len(d.dynamic)):
+		return d.dynamic[len(d.dynamic)-int(i-uint64(len(staticTable)))], nil
+	}
+	return HeaderField{}, fmt.Errorf("http2: header table index %d invalid", i)
+}
+
+var errHPACKTruncated = errors.New("http2: header block truncated")
+
+// hpackInt decodes an integer with an n bit prefix (RFC 7541 section
+// 5.1) from the start of b.
+func hpackInt(b []byte, n uint) (uint64, []byte, error) {
+	if len(b) == 0 {
+		return 0, nil, errHPACKTruncated
+	}
+	max := uint64(1)<<n - 1
+	v := uint64(b[0]) & max
+	b = b[1:]
+	if v < max {
+		return v, b, nil
+	}
+	for shift := uint(0); ; shift += 7 {
+		if len(b) == 0 {
+			return 0, nil, errHPACKTruncated
+		}
+		if shift > 56 {
+			return 0, nil, errors.New("http2: header block integer overflows")
+		}
+		c := b[0]
+		b = b[1:]
+		v += uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, b, nil
+		}
+	}
+}
+
+// hpackString decodes a string literal from the start of b.
+func hpackString(b []byte) (string, []byte, error) {
+	if len(b) == 0 {
+		return "", nil, errHPACKTruncated
+	}
+	huffman := b[0]&0x80 != 0
+	n, b, err := hpackInt(b, 7)
+	if err != nil {
+		return "", nil, err
+	}
+	if uint64(len(b)) < n {
+		return "", nil, errHPACKTruncated
+	}
+	s, b := b[:n], b[n:]
+	if !huffman {
+		return string(s), b, nil
+	}
+	str, err := huffmanDecode(s)
+	return str, b, err
+}
+
+// Decode decodes a complete header block, updating the dynamic table.  A
+// block that fails to decode leaves the table in an unknown state, and the
+// rest of the connection can't be decoded.
+func (d *HPACKDecoder) Decode(block []byte) ([]HeaderField, error) {
+	var fields []HeaderField
+	b := block
+	for len(b) > 0 {
+		var err error
+		var i uint64
+		var f HeaderField
+		var index bool
+		switch c := b[0]; {
+		case c&0x80 != 0:
+			// Indexed.
+			if i, b, err = hpackInt(b, 7); err != nil {
+				return fields, err
+			}
+			if f, err = d.field(i); err != nil {
+				return fields, err
+			}
+			fields = append(fields, f)
+			continue
+		case c&0xe0 == 0x20:
+			// Dynamic table size update.
+			if i, b, err = hpackInt(b, 5); err != nil {
+				return fields, err
+			}
+			if i > uint64(d.limit) {
+				return fields, fmt.Errorf("http2: header table size %d exceeds limit %d", i, d.limit)
+			}
+			d.setMaxSize(int(i))
+			continue
+		case c&0xc0 == 0x40:
+			// Literal with incremental indexing.
+			index = true
+			i, b, err = hpackInt(b, 6)
+		default:
+			// Literal without indexing, or never indexed.
+			f.Sensitive = c&0x10 != 0
+			i, b, err = hpackInt(b, 4)
+		}
+		if err != nil {
+			return fields, err
+		}
+		if i == 0 {
+			if f.Name, b, err = hpackString(b); err != nil {
+				return fields, err
+			}
+		} else {
+			name, err := d.field(i)
+			if err != nil {
+				return fields, err
+			}
+			f.Name = name.Name
+		}
+		if f.Value, b, err = hpackString(b); err != nil {
+			return fields, err
+		}
+		if index {
+			d.insert(f)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
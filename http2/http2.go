@@ -0,0 +1,159 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package http2 decodes the frames of HTTP/2 connections, and the header
+// blocks of their HEADERS and PUSH_PROMISE frames.
+//
+// Frames span TCP segments, and header blocks are compressed with HPACK,
+// whose dynamic tables carry state from one block to the next, so a Conn
+// decodes the reassembled bytes of each direction of a cleartext (h2c) or
+// decrypted connection, in order, from its start:
+//
+//	c := http2.NewConn()
+//	frames, err := c.Decode(true, clientBytes)
+//	...
+//	frames, err = c.Decode(false, serverBytes)
+//	for _, f := range frames {
+//	  fmt.Println(f.StreamID, f.Type, f.Headers)
+//	}
+//
+// The layers.HTTP2 layer decodes the frames of a single payload, without
+// their header blocks.
+package http2
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/mistsys/gopacket/layers"
+)
+
+// Frame is a decoded frame.  The frame ending a header block, a HEADERS or
+// PUSH_PROMISE frame with layers.HTTP2FlagEndHeaders or the CONTINUATION
+// frame after them with it, has the block's fields.
+type Frame struct {
+	layers.HTTP2Frame
+	Headers []HeaderField
+}
+
+// direction is one direction of a connection.
+type direction struct {
+	buf     []byte
+	started bool
+	hpack   *HPACKDecoder
+	// block gathers the fragments of a header block until it ends.
+	block   []byte
+	inBlock bool
+	err     error
+}
+
+// Conn decodes both directions of an HTTP/2 connection.  It is not safe
+// for concurrent use.
+type Conn struct {
+	client, server direction
+	// Preface is set once the client's connection preface is seen.
+	Preface bool
+}
+
+// NewConn returns a Conn for a new connection.
+func NewConn() *Conn {
+	return &Conn{
+		client: direction{hpack: NewHPACKDecoder(DefaultHeaderTableSize)},
+		server: direction{hpack: NewHPACKDecoder(DefaultHeaderTableSize)},
+	}
+}
+
+// Decode decodes the frames completed by data, the next bytes sent by the
+// client if fromClient is set, or else by the server.  Once a direction
+// fails to decode, every later call for it returns the same error.
+func (c *Conn) Decode(fromClient bool, data []byte) ([]Frame, error) {
+	d, other := &c.server, &c.client
+	if fromClient {
+		d, other = other, d
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	d.buf = append(d.buf, data...)
+	if !d.started {
+		if fromClient {
+			// The preface may be missing if the capture started late.
+			n := len(d.buf)
+			if n > len(layers.HTTP2Preface) {
+				n = len(layers.HTTP2Preface)
+			}
+			if bytes.Equal(d.buf[:n], []byte(layers.HTTP2Preface[:n])) {
+				if n < len(layers.HTTP2Preface) {
+					return nil, nil
+				}
+				c.Preface = true
+				d.buf = d.buf[n:]
+			}
+		}
+		d.started = true
+	}
+	var frames []Frame
+	for {
+		var f Frame
+		n, err := layers.DecodeHTTP2Frame(&f.HTTP2Frame, d.buf)
+		if err == nil && n == 0 {
+			return frames, nil
+		}
+		d.buf = d.buf[n:]
+		if err == nil {
+			err = d.headers(&f)
+		}
+		if err != nil {
+			d.err = err
+			return frames, err
+		}
+		if f.Type == layers.HTTP2FrameSettings && !f.Flags.Has(layers.HTTP2FlagACK) {
+			// The table size a side sets limits what the other side's
+			// encoder may use.
+			for _, s := range f.Settings {
+				if s.ID == layers.HTTP2SettingHeaderTableSize {
+					other.hpack.SetLimit(int(s.Value))
+				}
+			}
+		}
+		frames = append(frames, f)
+	}
+}
+
+// headers gathers the header block fragment of f, decoding the block if f
+// ends it.
+func (d *direction) headers(f *Frame) error {
+	switch f.Type {
+	case layers.HTTP2FrameHeaders, layers.HTTP2FramePushPromise:
+		if d.inBlock {
+			return errUnendedBlock
+		}
+		d.block = append(d.block[:0], f.HeaderBlock...)
+		d.inBlock = true
+	case layers.HTTP2FrameContinuation:
+		if !d.inBlock {
+			return errUnstartedBlock
+		}
+		d.block = append(d.block, f.HeaderBlock...)
+	default:
+		if d.inBlock {
+			return errUnendedBlock
+		}
+		return nil
+	}
+	if !f.Flags.Has(layers.HTTP2FlagEndHeaders) {
+		return nil
+	}
+	d.inBlock = false
+	var err error
+	f.Headers, err = d.hpack.Decode(d.block)
+	return err
+}
+
+var (
+	errUnendedBlock   = errors.New("http2: frame interrupts a header block")
+	errUnstartedBlock = errors.New("http2: CONTINUATION frame outside a header block")
+)
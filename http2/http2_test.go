@@ -0,0 +1,164 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package http2
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mistsys/gopacket/layers"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestHPACKRequests(t *testing.T) {
+	// RFC 7541 C.4, requests with Huffman coding.
+	d := NewHPACKDecoder(DefaultHeaderTableSize)
+	for _, c := range []struct {
+		block string
+		want  []HeaderField
+		size  int
+	}{
+		{"8286 8441 8cf1 e3c2 e5f2 3a6b a0ab 90f4 ff", []HeaderField{
+			{Name: ":method", Value: "GET"},
+			{Name: ":scheme", Value: "http"},
+			{Name: ":path", Value: "/"},
+			{Name: ":authority", Value: "www.example.com"},
+		}, 57},
+		{"8286 84be 5886 a8eb 1064 9cbf", []HeaderField{
+			{Name: ":method", Value: "GET"},
+			{Name: ":scheme", Value: "http"},
+			{Name: ":path", Value: "/"},
+			{Name: ":authority", Value: "www.example.com"},
+			{Name: "cache-control", Value: "no-cache"},
+		}, 110},
+		{"8287 85bf 4088 25a8 49e9 5ba9 7d7f 8925 a849 e95b b8e8 b4bf", []HeaderField{
+			{Name: ":method", Value: "GET"},
+			{Name: ":scheme", Value: "https"},
+			{Name: ":path", Value: "/index.html"},
+			{Name: ":authority", Value: "www.example.com"},
+			{Name: "custom-key", Value: "custom-value"},
+		}, 164},
+	} {
+		got, err := d.Decode(unhex(t, c.block))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("got %v, want %v", got, c.want)
+		}
+		if d.TableSize() != c.size {
+			t.Errorf("table size %d, want %d", d.TableSize(), c.size)
+		}
+	}
+}
+
+func TestHPACKEviction(t *testing.T) {
+	d := NewHPACKDecoder(DefaultHeaderTableSize)
+	// A table size update to 64, then two literals with indexing; the
+	// second evicts the first.  Then one never indexed.
+	block := []byte{0x3f, 0x21}
+	block = append(block, 0x40, 1, 'a', 3, 'x', 'y', 'z')
+	block = append(block, 0x40, 1, 'b', 1, 'w')
+	block = append(block, 0x10, 1, 'c', 1, 'v')
+	got, err := d.Decode(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HeaderField{{Name: "a", Value: "xyz"}, {Name: "b", Value: "w"}, {Name: "c", Value: "v", Sensitive: true}}
+	if !reflect.DeepEqual(got, want) || d.TableSize() != 34 {
+		t.Errorf("got %v and table size %d", got, d.TableSize())
+	}
+	if _, err := d.Decode([]byte{0xbf}); err == nil {
+		t.Error("evicted entry decoded")
+	}
+	if _, err := d.Decode([]byte{0x3f, 0xe2, 0x1f}); err == nil {
+		t.Error("table size above the limit accepted")
+	}
+}
+
+func TestHuffmanPadding(t *testing.T) {
+	// "a" is 00011, padded with ones.
+	if s, err := huffmanDecode([]byte{0x1f}); err != nil || s != "a" {
+		t.Errorf("got %q, %v", s, err)
+	}
+	for _, b := range [][]byte{{0x18}, {0x1f, 0xff}} {
+		if _, err := huffmanDecode(b); err == nil {
+			t.Errorf("%x decoded", b)
+		}
+	}
+}
+
+func frame(typ layers.HTTP2FrameType, flags layers.HTTP2Flags, stream uint32, payload ...byte) []byte {
+	n := len(payload)
+	b := []byte{byte(n >> 16), byte(n >> 8), byte(n), byte(typ), byte(flags),
+		byte(stream >> 24), byte(stream >> 16), byte(stream >> 8), byte(stream)}
+	return append(b, payload...)
+}
+
+func TestConn(t *testing.T) {
+	c := NewConn()
+	client := []byte(layers.HTTP2Preface)
+	client = append(client, frame(layers.HTTP2FrameSettings, 0, 0)...)
+	// A request whose header block is split across a CONTINUATION.
+	client = append(client, frame(layers.HTTP2FrameHeaders, layers.HTTP2FlagEndStream, 1, 0x82, 0x86)...)
+	client = append(client, frame(layers.HTTP2FrameContinuation, layers.HTTP2FlagEndHeaders, 1, 0x84, 0x41, 3, 'f', 'o', 'o')...)
+
+	// Fed a few bytes at a time.
+	var frames []Frame
+	for i := 0; i < len(client); i += 7 {
+		end := i + 7
+		if end > len(client) {
+			end = len(client)
+		}
+		got, err := c.Decode(true, client[i:end])
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, got...)
+	}
+	if !c.Preface || len(frames) != 3 {
+		t.Fatalf("got preface %v, frames %v", c.Preface, frames)
+	}
+	if frames[1].Headers != nil {
+		t.Errorf("unended block decoded: %v", frames[1].Headers)
+	}
+	want := []HeaderField{{Name: ":method", Value: "GET"}, {Name: ":scheme", Value: "http"}, {Name: ":path", Value: "/"}, {Name: ":authority", Value: "foo"}}
+	if f := frames[2]; f.StreamID != 1 || !reflect.DeepEqual(f.Headers, want) {
+		t.Errorf("got %v", f.Headers)
+	}
+
+	// The server's response, with a header block using its own table.
+	server := frame(layers.HTTP2FrameHeaders, layers.HTTP2FlagEndHeaders, 1, 0x88, 0x40, 1, 'x', 1, 'y', 0xbe)
+	frames, err := c.Decode(false, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []HeaderField{{Name: ":status", Value: "200"}, {Name: "x", Value: "y"}, {Name: "x", Value: "y"}}
+	if len(frames) != 1 || !reflect.DeepEqual(frames[0].Headers, want) {
+		t.Errorf("got %v", frames)
+	}
+
+	// A DATA frame inside a header block breaks the client's side for
+	// good.
+	bad := frame(layers.HTTP2FrameHeaders, 0, 3, 0x82)
+	bad = append(bad, frame(layers.HTTP2FrameData, 0, 3, 1)...)
+	if _, err := c.Decode(true, bad); err == nil {
+		t.Error("interrupted header block decoded")
+	}
+	if _, err := c.Decode(true, frame(layers.HTTP2FramePing, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)); err == nil {
+		t.Error("decoded after an error")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package http2
+
+import "errors"
+
+// huffmanLengths are the lengths of the codes of the HPACK Huffman code
+// (RFC 7541 appendix B), indexed by symbol.  The code is canonical: codes
+// are numbered in order of length, then symbol, so the lengths define it.
+var huffmanLengths = [256]uint8{
+	13, 23, 28, 28, 28, 28, 28, 28, 28, 24, 30, 28, 28, 30, 28, 28,
+	28, 28, 28, 28, 28, 28, 30, 28, 28, 28, 28, 28, 28, 28, 28, 28,
+	6, 10, 10, 12, 13, 6, 8, 11, 10, 10, 8, 11, 8, 6, 6, 6,
+	5, 5, 5, 6, 6, 6, 6, 6, 6, 6, 7, 8, 15, 6, 12, 10,
+	13, 6, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+	7, 7, 7, 7, 7, 7, 7, 7, 8, 7, 8, 13, 19, 13, 14, 6,
+	15, 5, 6, 5, 6, 5, 6, 6, 6, 5, 7, 7, 6, 6, 6, 5,
+	6, 7, 6, 5, 5, 6, 7, 7, 7, 7, 7, 15, 11, 14, 13, 28,
+	20, 22, 20, 20, 22, 22, 22, 23, 22, 23, 23, 23, 23, 23, 24, 23,
+	24, 24, 22, 23, 24, 23, 23, 23, 23, 21, 22, 23, 22, 23, 23, 24,
+	22, 21, 20, 22, 22, 23, 23, 21, 23, 22, 22, 24, 21, 22, 23, 23,
+	21, 21, 22, 21, 23, 22, 23, 23, 20, 22, 22, 22, 23, 22, 22, 23,
+	26, 26, 20, 19, 22, 23, 22, 25, 26, 26, 26, 27, 27, 26, 24, 25,
+	19, 21, 26, 27, 27, 26, 27, 24, 21, 21, 26, 26, 28, 27, 27, 27,
+	20, 24, 20, 21, 22, 21, 21, 23, 22, 22, 25, 25, 24, 24, 26, 23,
+	26, 27, 26, 26, 27, 27, 27, 27, 27, 28, 27, 27, 27, 27, 27, 26,
+}
+
+// huffmanNode is a node of the Huffman decoding tree.  Leaves have no
+// children.
+type huffmanNode struct {
+	children [2]*huffmanNode
+	sym      byte
+}
+
+var huffmanRoot = buildHuffmanTree()
+
+func buildHuffmanTree() *huffmanNode {
+	root := &huffmanNode{}
+	code := uint32(0)
+	for length := uint8(1); length <= 30; length++ {
+		for sym, l := range huffmanLengths {
+			if l != length {
+				continue
+			}
+			n := root
+			for i := int(length) - 1; i >= 0; i-- {
+				bit := code >> uint(i) & 1
+				if n.children[bit] == nil {
+					n.children[bit] = &huffmanNode{}
+				}
+				n = n.children[bit]
+			}
+			n.sym = byte(sym)
+			code++
+		}
+		code <<= 1
+	}
+	return root
+}
+
+var errHuffman = errors.New("http2: invalid Huffman encoded string")
+
+// huffmanDecode decodes the Huffman encoded string b.
+func huffmanDecode(b []byte) (string, error) {
+	var out []byte
+	n := huffmanRoot
+	// depth and ones are the number of bits read since the last symbol,
+	// and whether they were all ones, as padding must be.
+	depth, ones := 0, true
+	for _, c := range b {
+		for i := 7; i >= 0; i-- {
+			bit := c >> uint(i) & 1
+			n = n.children[bit]
+			if n == nil {
+				// Only EOS, which mustn't be sent, has no node.
+				return "", errHuffman
+			}
+			depth++
+			ones = ones && bit == 1
+			if n.children[0] == nil {
+				out = append(out, n.sym)
+				n, depth, ones = huffmanRoot, 0, true
+			}
+		}
+	}
+	if depth > 7 || !ones {
+		return "", errHuffman
+	}
+	return string(out), nil
+}
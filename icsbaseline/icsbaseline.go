@@ -0,0 +1,390 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package icsbaseline learns the normal industrial control traffic between
+// devices and flags deviations from it.
+//
+// A Baseline reads the requests of Modbus/TCP, DNP3 and EtherNet/IP (CIP)
+// sent to their well known ports, and records per device pair the
+// operations seen: function codes, DNP3 objects and CIP classes, and the
+// range of Modbus addresses accessed by each function.  During the
+// learning period everything seen is added to the baseline.  After it,
+// each request that doesn't fit the baseline is reported once as an
+// Anomaly:
+//
+//   - NewDevicePair: a client talking to a server it never did
+//   - NewFunction: a function code, DNP3 object or CIP class not used
+//     between the pair before, such as a write where there were only reads
+//   - AddressOutOfRange: a Modbus access outside the addresses the
+//     function used before
+//
+// Requests are read from the TCP or UDP payload of each packet, assuming
+// it starts with a message as these protocols' senders usually ensure, so
+// no stream reassembly is needed.
+//
+// Usage:
+//
+//	b := icsbaseline.New(icsbaseline.DefaultConfig)
+//	for p := range source.Packets() {
+//	  for _, a := range b.Add(p) {
+//	    log.Println(a)
+//	  }
+//	}
+package icsbaseline
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// Protocol is an industrial protocol a Baseline reads.
+type Protocol int
+
+const (
+	Modbus Protocol = iota
+	DNP3
+	EtherNetIP
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case Modbus:
+		return "Modbus"
+	case DNP3:
+		return "DNP3"
+	case EtherNetIP:
+		return "EtherNet/IP"
+	}
+	return fmt.Sprintf("UnknownProtocol(%d)", int(p))
+}
+
+const (
+	noObject  = -1
+	noAddress = -1
+)
+
+// Operation is what a request asks its server to do.
+type Operation struct {
+	Protocol Protocol
+	// Function is the Modbus function code, the DNP3 application function
+	// code, or for EtherNet/IP the CIP service code if CIP is set and the
+	// encapsulation command otherwise.
+	Function uint16
+	CIP      bool
+	// Object is the DNP3 object group and variation, group in the high
+	// byte, or the CIP class.  It's -1 if there isn't one.
+	Object int
+	// Address and Quantity are the first Modbus address accessed and the
+	// number of coils or registers from it.  Address is -1 if the function
+	// doesn't access any.
+	Address, Quantity int
+}
+
+func (o Operation) String() string {
+	s := fmt.Sprintf("%v function %d", o.Protocol, o.Function)
+	if o.CIP {
+		s = fmt.Sprintf("%v CIP service %#x", o.Protocol, o.Function)
+	}
+	if o.Object != noObject {
+		s += fmt.Sprintf(" object %#x", o.Object)
+	}
+	if o.Address != noAddress {
+		s += fmt.Sprintf(" address %d+%d", o.Address, o.Quantity)
+	}
+	return s
+}
+
+// lastAddress returns the last Modbus address o accesses.
+func (o Operation) lastAddress() int {
+	if o.Quantity == 0 {
+		return o.Address
+	}
+	return o.Address + o.Quantity - 1
+}
+
+// Pair is a client and the server it sends requests to.
+type Pair struct {
+	Client, Server string
+}
+
+func (p Pair) String() string {
+	return p.Client + " -> " + p.Server
+}
+
+// AnomalyType is the kind of deviation an Anomaly reports.
+type AnomalyType int
+
+const (
+	NewDevicePair AnomalyType = iota
+	NewFunction
+	AddressOutOfRange
+)
+
+func (t AnomalyType) String() string {
+	switch t {
+	case NewDevicePair:
+		return "NewDevicePair"
+	case NewFunction:
+		return "NewFunction"
+	case AddressOutOfRange:
+		return "AddressOutOfRange"
+	}
+	return fmt.Sprintf("UnknownAnomalyType(%d)", int(t))
+}
+
+// Anomaly is a request that doesn't fit the baseline.
+type Anomaly struct {
+	Type      AnomalyType
+	Time      time.Time
+	Pair      Pair
+	Operation Operation
+	// Learned is the address range the function used during learning, for
+	// AddressOutOfRange, as the first and last address.
+	Learned [2]int
+}
+
+func (a Anomaly) String() string {
+	switch a.Type {
+	case AddressOutOfRange:
+		return fmt.Sprintf("%v: %v %v outside learned addresses %d-%d", a.Type, a.Pair, a.Operation, a.Learned[0], a.Learned[1])
+	}
+	return fmt.Sprintf("%v: %v %v", a.Type, a.Pair, a.Operation)
+}
+
+// Config configures a Baseline.
+type Config struct {
+	// Learning is how long after the first request the Baseline learns
+	// for.  Zero learns until Freeze is called.
+	Learning time.Duration
+	// MaxPairs bounds the device pairs learned; requests between others are
+	// still reported after learning.  Zero means no limit.
+	MaxPairs int
+}
+
+// DefaultConfig learns for a day, as control loops and polling usually
+// repeat much more often.
+var DefaultConfig = Config{
+	Learning: 24 * time.Hour,
+	MaxPairs: 10000,
+}
+
+// opKey is an operation without its address.
+type opKey struct {
+	protocol Protocol
+	function uint16
+	cip      bool
+	object   int
+}
+
+// addrRange is the addresses an operation accessed, inclusive.
+type addrRange struct {
+	first, last int
+}
+
+type profile struct {
+	ops map[opKey]*addrRange
+}
+
+type anomalyKey struct {
+	typ  AnomalyType
+	pair Pair
+	op   opKey
+}
+
+// Baseline learns and checks the requests between device pairs.  It is not
+// safe for concurrent use.
+type Baseline struct {
+	Config
+	start    time.Time
+	frozen   bool
+	pairs    map[Pair]*profile
+	reported map[anomalyKey]bool
+}
+
+// New creates a Baseline, learning until c.Learning has passed.
+func New(c Config) *Baseline {
+	return &Baseline{
+		Config:   c,
+		pairs:    map[Pair]*profile{},
+		reported: map[anomalyKey]bool{},
+	}
+}
+
+// Freeze ends the learning period.
+func (b *Baseline) Freeze() {
+	b.frozen = true
+}
+
+// learning reports whether requests at ts are learned.
+func (b *Baseline) learning(ts time.Time) bool {
+	if b.frozen {
+		return false
+	}
+	if b.start.IsZero() {
+		b.start = ts
+	}
+	if b.Learning > 0 && ts.Sub(b.start) >= b.Learning {
+		b.frozen = true
+		return false
+	}
+	return true
+}
+
+// Operations parses the industrial requests in p, and returns the pair of
+// devices it's between.
+func Operations(p gopacket.Packet) (Pair, []Operation) {
+	var src, dst net.IP
+	switch ip := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		src, dst = ip.SrcIP, ip.DstIP
+	case *layers.IPv6:
+		src, dst = ip.SrcIP, ip.DstIP
+	default:
+		return Pair{}, nil
+	}
+	var ops []Operation
+	switch t := p.TransportLayer().(type) {
+	case *layers.TCP:
+		switch t.DstPort {
+		case ModbusPort:
+			ops = parseModbus(ops, t.Payload)
+		case DNP3Port:
+			ops = parseDNP3(ops, t.Payload)
+		case EtherNetIPPort:
+			ops = parseEtherNetIP(ops, t.Payload)
+		}
+	case *layers.UDP:
+		switch t.DstPort {
+		case DNP3Port:
+			ops = parseDNP3(ops, t.Payload)
+		case EtherNetIPPort:
+			ops = parseEtherNetIP(ops, t.Payload)
+		}
+	}
+	if len(ops) == 0 {
+		return Pair{}, nil
+	}
+	return Pair{Client: src.String(), Server: dst.String()}, ops
+}
+
+// Add learns or checks the requests in p, and returns any anomalies.
+func (b *Baseline) Add(p gopacket.Packet) []Anomaly {
+	pair, ops := Operations(p)
+	if ops == nil {
+		return nil
+	}
+	ts := p.Metadata().Timestamp
+	if b.learning(ts) {
+		b.learn(pair, ops)
+		return nil
+	}
+	return b.check(nil, pair, ops, ts)
+}
+
+func (b *Baseline) learn(pair Pair, ops []Operation) {
+	pr := b.pairs[pair]
+	if pr == nil {
+		if b.MaxPairs > 0 && len(b.pairs) >= b.MaxPairs {
+			return
+		}
+		pr = &profile{ops: map[opKey]*addrRange{}}
+		b.pairs[pair] = pr
+	}
+	for _, op := range ops {
+		k := opKey{op.Protocol, op.Function, op.CIP, op.Object}
+		r := pr.ops[k]
+		if r == nil {
+			r = &addrRange{noAddress, noAddress}
+			pr.ops[k] = r
+		}
+		if op.Address == noAddress {
+			continue
+		}
+		last := op.lastAddress()
+		if r.first == noAddress || op.Address < r.first {
+			r.first = op.Address
+		}
+		if last > r.last {
+			r.last = last
+		}
+	}
+}
+
+func (b *Baseline) check(as []Anomaly, pair Pair, ops []Operation, ts time.Time) []Anomaly {
+	report := func(t AnomalyType, k opKey, op Operation, learned [2]int) {
+		ak := anomalyKey{t, pair, k}
+		if b.reported[ak] {
+			return
+		}
+		b.reported[ak] = true
+		as = append(as, Anomaly{Type: t, Time: ts, Pair: pair, Operation: op, Learned: learned})
+	}
+	pr := b.pairs[pair]
+	if pr == nil {
+		report(NewDevicePair, opKey{}, ops[0], [2]int{})
+		return as
+	}
+	for _, op := range ops {
+		k := opKey{op.Protocol, op.Function, op.CIP, op.Object}
+		r := pr.ops[k]
+		switch {
+		case r == nil:
+			report(NewFunction, k, op, [2]int{})
+		case op.Address == noAddress:
+		case r.first == noAddress, op.Address < r.first, op.lastAddress() > r.last:
+			report(AddressOutOfRange, k, op, [2]int{r.first, r.last})
+		}
+	}
+	return as
+}
+
+// Pairs returns the device pairs learned, sorted.
+func (b *Baseline) Pairs() []Pair {
+	pairs := make([]Pair, 0, len(b.pairs))
+	for p := range b.pairs {
+		pairs = append(pairs, p)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Client != pairs[j].Client {
+			return pairs[i].Client < pairs[j].Client
+		}
+		return pairs[i].Server < pairs[j].Server
+	})
+	return pairs
+}
+
+// Learned returns the operations learned for pair, one per function and
+// object, with Address and Quantity covering the addresses accessed.
+func (b *Baseline) Learned(pair Pair) []Operation {
+	pr := b.pairs[pair]
+	if pr == nil {
+		return nil
+	}
+	ops := make([]Operation, 0, len(pr.ops))
+	for k, r := range pr.ops {
+		op := Operation{Protocol: k.protocol, Function: k.function, CIP: k.cip, Object: k.object, Address: r.first}
+		if r.first != noAddress {
+			op.Quantity = r.last - r.first + 1
+		}
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		a, b := ops[i], ops[j]
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if a.Function != b.Function {
+			return a.Function < b.Function
+		}
+		return a.Object < b.Object
+	})
+	return ops
+}
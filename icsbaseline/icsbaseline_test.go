@@ -0,0 +1,104 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package icsbaseline
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+var start = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func tcpPacket(t *testing.T, src, dst string, port layers.TCPPort, ts time.Time, payload []byte) gopacket.Packet {
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.ParseIP(src).To4(), DstIP: net.ParseIP(dst).To4()}
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: port, ACK: true, PSH: true, Window: 1000}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ip, tcp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	p.Metadata().Timestamp = ts
+	return p
+}
+
+// modbus returns a Modbus/TCP request for function fc at addr.
+func modbus(fc byte, addr, qty uint16) []byte {
+	return []byte{0, 1, 0, 0, 0, 6, 1, fc, byte(addr >> 8), byte(addr), byte(qty >> 8), byte(qty)}
+}
+
+func TestBaselineModbus(t *testing.T) {
+	b := New(Config{Learning: time.Hour})
+	add := func(src string, ts time.Duration, payload []byte) []Anomaly {
+		return b.Add(tcpPacket(t, src, "10.0.0.100", ModbusPort, start.Add(ts), payload))
+	}
+	// Learn reads of holding registers 100-119, and a write of 110.
+	for i := 0; i < 10; i++ {
+		add("10.0.0.1", time.Duration(i)*time.Minute, modbus(3, 100, 20))
+	}
+	add("10.0.0.1", 20*time.Minute, modbus(6, 110, 0x1234))
+	if got := b.Learned(Pair{"10.0.0.1", "10.0.0.100"}); len(got) != 2 || got[0].Address != 100 || got[0].Quantity != 20 || got[1].Function != 6 {
+		t.Errorf("learned %v", got)
+	}
+
+	if as := add("10.0.0.1", 2*time.Hour, modbus(3, 105, 10)); len(as) != 0 {
+		t.Errorf("got anomalies %v for a learned read", as)
+	}
+	as := add("10.0.0.1", 2*time.Hour, modbus(3, 110, 20))
+	if len(as) != 1 || as[0].Type != AddressOutOfRange || as[0].Learned != [2]int{100, 119} {
+		t.Errorf("got anomalies %v, want AddressOutOfRange", as)
+	}
+	// Reported once only.
+	if as := add("10.0.0.1", 2*time.Hour, modbus(3, 200, 1)); len(as) != 0 {
+		t.Errorf("got anomalies %v reported again", as)
+	}
+	as = add("10.0.0.1", 2*time.Hour, modbus(16, 100, 2))
+	if len(as) != 1 || as[0].Type != NewFunction || as[0].Operation.Function != 16 {
+		t.Errorf("got anomalies %v, want NewFunction", as)
+	}
+	as = add("10.0.0.2", 2*time.Hour, modbus(3, 100, 1))
+	if len(as) != 1 || as[0].Type != NewDevicePair || as[0].Pair.Client != "10.0.0.2" {
+		t.Errorf("got anomalies %v, want NewDevicePair", as)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	// DNP3 read of class 0 data (group 60 variation 1).
+	dnp3 := []byte{0x05, 0x64, 0x0b, 0xc4, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00,
+		0xc0, 0xc0, 0x01, 0x3c, 0x01, 0x06, 0x00, 0x00}
+	_, ops := Operations(tcpPacket(t, "10.0.0.1", "10.0.0.2", DNP3Port, start, dnp3))
+	if len(ops) != 1 || ops[0].Protocol != DNP3 || ops[0].Function != 1 || ops[0].Object != 0x3c01 {
+		t.Errorf("got DNP3 operations %v", ops)
+	}
+
+	// EtherNet/IP SendRRData with an unconnected CIP Get_Attribute_Single
+	// on the identity object (class 1).
+	enip := make([]byte, 24)
+	enip[0] = 0x6f
+	enip = append(enip, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0xb2, 0, 8, 0,
+		0x0e, 0x03, 0x20, 0x01, 0x24, 0x01, 0x30, 0x01)
+	_, ops = Operations(tcpPacket(t, "10.0.0.1", "10.0.0.2", EtherNetIPPort, start, enip))
+	if len(ops) != 1 || !ops[0].CIP || ops[0].Function != 0x0e || ops[0].Object != 1 {
+		t.Errorf("got EtherNet/IP operations %v", ops)
+	}
+
+	// Two Modbus requests in one segment.
+	two := append(modbus(1, 0, 8), modbus(5, 3, 0xff00)...)
+	_, ops = Operations(tcpPacket(t, "10.0.0.1", "10.0.0.2", ModbusPort, start, two))
+	if len(ops) != 2 || ops[1].Function != 5 || ops[1].Address != 3 || ops[1].Quantity != 1 {
+		t.Errorf("got Modbus operations %v", ops)
+	}
+
+	// Responses, and other ports, aren't requests.
+	if _, ops := Operations(tcpPacket(t, "10.0.0.1", "10.0.0.2", 80, start, modbus(3, 0, 1))); ops != nil {
+		t.Errorf("got operations %v from another port", ops)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package icsbaseline
+
+import (
+	"encoding/binary"
+)
+
+// Well known server ports of the protocols.
+const (
+	ModbusPort     = 502
+	DNP3Port       = 20000
+	EtherNetIPPort = 44818
+)
+
+// parseModbus returns the operations of the Modbus/TCP requests in b, which
+// may hold several ADUs.
+func parseModbus(ops []Operation, b []byte) []Operation {
+	for len(b) >= 8 {
+		// MBAP header: transaction, protocol (always 0), length of the unit
+		// identifier and PDU, unit identifier.
+		if binary.BigEndian.Uint16(b[2:4]) != 0 {
+			return ops
+		}
+		n := 6 + int(binary.BigEndian.Uint16(b[4:6]))
+		if n < 8 || n > len(b) {
+			return ops
+		}
+		pdu := b[7:n]
+		op := Operation{Protocol: Modbus, Function: uint16(pdu[0]), Object: noObject, Address: noAddress}
+		switch pdu[0] {
+		case 1, 2, 3, 4, 15, 16:
+			// Reads and multiple writes: address and quantity.
+			if len(pdu) >= 5 {
+				op.Address = int(binary.BigEndian.Uint16(pdu[1:3]))
+				op.Quantity = int(binary.BigEndian.Uint16(pdu[3:5]))
+			}
+		case 5, 6:
+			// Single writes: address and value.
+			if len(pdu) >= 3 {
+				op.Address = int(binary.BigEndian.Uint16(pdu[1:3]))
+				op.Quantity = 1
+			}
+		}
+		ops = append(ops, op)
+		b = b[n:]
+	}
+	return ops
+}
+
+// parseDNP3 returns the operation of a DNP3 request fragment starting in b.
+// Only the first data block is read, which holds the application function
+// code and the first object header.
+func parseDNP3(ops []Operation, b []byte) []Operation {
+	// Link header: start bytes, length, control, destination, source, CRC.
+	if len(b) < 10+3 || b[0] != 0x05 || b[1] != 0x64 {
+		return ops
+	}
+	// Only primary frames from the master carry user data.
+	if b[3]&0xc0 != 0xc0 {
+		return ops
+	}
+	block := b[10:]
+	if len(block) > 16 {
+		block = block[:16]
+	}
+	// Transport header, then the application header: control and function.
+	if block[0]&0x40 == 0 {
+		// Not the first segment of a fragment.
+		return ops
+	}
+	op := Operation{Protocol: DNP3, Function: uint16(block[2]), Object: noObject, Address: noAddress}
+	if len(block) >= 5 {
+		// The first object's group and variation.
+		op.Object = int(block[3])<<8 | int(block[4])
+	}
+	return append(ops, op)
+}
+
+// parseEtherNetIP returns the operation of an EtherNet/IP encapsulation
+// request in b.  For requests carrying CIP, the operation is the CIP
+// service on the addressed class; otherwise it's the encapsulation
+// command.
+func parseEtherNetIP(ops []Operation, b []byte) []Operation {
+	if len(b) < 24 {
+		return ops
+	}
+	cmd := binary.LittleEndian.Uint16(b[0:2])
+	op := Operation{Protocol: EtherNetIP, Function: cmd, Object: noObject, Address: noAddress}
+	if cmd == 0x6f || cmd == 0x70 {
+		// SendRRData or SendUnitData.
+		if service, class, ok := parseCIP(b[24:]); ok {
+			op.CIP = true
+			op.Function = uint16(service)
+			op.Object = class
+		}
+	}
+	return append(ops, op)
+}
+
+// parseCIP finds the CIP request in the common packet format b, and returns
+// its service code and the class its path starts with, if it does.
+func parseCIP(b []byte) (service uint8, class int, ok bool) {
+	// Interface handle, timeout, item count.
+	if len(b) < 8 {
+		return 0, 0, false
+	}
+	count := int(binary.LittleEndian.Uint16(b[6:8]))
+	b = b[8:]
+	for i := 0; i < count && len(b) >= 4; i++ {
+		typ := binary.LittleEndian.Uint16(b[0:2])
+		n := int(binary.LittleEndian.Uint16(b[2:4]))
+		if 4+n > len(b) {
+			return 0, 0, false
+		}
+		data := b[4 : 4+n]
+		b = b[4+n:]
+		switch typ {
+		case 0xb1:
+			// Connected data starts with a sequence count.
+			if len(data) < 2 {
+				return 0, 0, false
+			}
+			data = data[2:]
+		case 0xb2:
+		default:
+			continue
+		}
+		if len(data) < 2 {
+			return 0, 0, false
+		}
+		service = data[0] &^ 0x80
+		path := data[2:]
+		if words := int(data[1]) * 2; words < len(path) {
+			path = path[:words]
+		}
+		// The class is the first segment of the path, 8 or 16 bits wide.
+		class = noObject
+		switch {
+		case len(path) >= 2 && path[0] == 0x20:
+			class = int(path[1])
+		case len(path) >= 4 && path[0] == 0x21:
+			class = int(binary.LittleEndian.Uint16(path[2:4]))
+		}
+		return service, class, true
+	}
+	return 0, 0, false
+}
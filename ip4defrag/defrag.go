@@ -7,6 +7,7 @@ import (
 	"container/list"
 	"fmt"
 	"log"
+	"log/slog"
 	"sync"
 	"time"
 
@@ -67,6 +68,14 @@ const (
 //}
 //
 func (d *IPv4Defragmenter) DefragIPv4(in *layers.IPv4) (*layers.IPv4, error) {
+	return d.DefragIPv4WithTimestamp(in, time.Now())
+}
+
+// DefragIPv4WithTimestamp is DefragIPv4, with t as the time the fragment
+// was captured, usually the packet's Metadata().Timestamp.  Timeouts are
+// measured against these times, so captures read from files expire
+// fragments as they did on the wire.
+func (d *IPv4Defragmenter) DefragIPv4WithTimestamp(in *layers.IPv4, t time.Time) (*layers.IPv4, error) {
 	// check if we need to defrag
 	if st := d.dontDefrag(in); st == true {
 		return in, nil
@@ -81,37 +90,69 @@ func (d *IPv4Defragmenter) DefragIPv4(in *layers.IPv4) (*layers.IPv4, error) {
 	debug.Printf("defrag: got in.Id=%d in.FragOffset=%d in.Flags=%d\n",
 		in.Id, in.FragOffset*8, in.Flags)
 
+	d.Lock()
+	defer d.Unlock()
+	if d.config.Timeout > 0 && t.Sub(d.lastSweep) >= d.config.Timeout {
+		d.discardOlderThan(t.Add(-d.config.Timeout))
+		d.lastSweep = t
+	}
+
 	// do we already has seen a flow between src/dst with that Id
 	ipf := newIPv4(in)
-	var fl *fragmentList
-	var exist bool
-	d.Lock()
-	fl, exist = d.ipFlows[ipf]
+	fl, exist := d.ipFlows[ipf]
+	if exist && d.config.Timeout > 0 && t.Sub(fl.LastSeen) > d.config.Timeout {
+		debug.Printf("defrag: flow timed out\n")
+		if d.config.Logger != nil {
+			d.config.Logger.Debug("defrag: datagram timed out", "flow", ipf.ip4, "id", ipf.id, "fragments", fl.List.Len())
+		}
+		d.remove(ipf)
+		exist = false
+	}
 	if !exist {
 		debug.Printf("defrag: creating a new flow\n")
 		fl = new(fragmentList)
+		fl.elem = d.lru.PushBack(ipf)
 		d.ipFlows[ipf] = fl
+	} else {
+		d.lru.MoveToBack(fl.elem)
 	}
-	d.Unlock()
 	// insert, and if final build it
-	out, err2 := fl.insert(in)
+	before := fl.Bytes
+	out, err2 := fl.insert(in, t)
+	d.bytes += fl.Bytes - before
+
+	// if we got a packet, it's a new one, and he is defragmented
+	if out != nil {
+		d.remove(ipf)
+		return out, nil
+	}
 
 	// at last, if we hit the maximum frag list len
 	// without any defrag success, we just drop everything and
 	// raise an error
-	if out == nil && fl.List.Len()+1 > IPv4MaximumFragmentListLen {
-		d.Lock()
-		fl = new(fragmentList)
-		d.ipFlows[ipf] = fl
-		d.Unlock()
+	if fl.List.Len()+1 > d.config.MaxFragments {
+		if d.config.Logger != nil {
+			d.config.Logger.Warn("defrag: too many fragments, dropping datagram", "flow", ipf.ip4, "id", ipf.id, "max_fragments", d.config.MaxFragments)
+		}
+		d.remove(ipf)
 		return nil, fmt.Errorf("defrag: Fragment List hits its maximum"+
 			"size(%d), without sucess. Flushing the list",
-			IPv4MaximumFragmentListLen)
+			d.config.MaxFragments)
 	}
 
-	// if we got a packet, it's a new one, and he is defragmented
-	if out != nil {
-		return out, nil
+	// drop the least recently seen datagrams until we're back under
+	// the memory bound
+	for d.config.MaxBytes > 0 && d.bytes > d.config.MaxBytes {
+		oldest := d.lru.Front().Value.(ipv4)
+		debug.Printf("defrag: memory bound hit, dropping a flow\n")
+		if d.config.Logger != nil {
+			d.config.Logger.Warn("defrag: memory bound hit, dropping datagram", "flow", oldest.ip4, "id", oldest.id, "bytes", d.ipFlows[oldest].Bytes, "max_bytes", d.config.MaxBytes)
+		}
+		d.remove(oldest)
+		if oldest == ipf {
+			return nil, fmt.Errorf("defrag: fragment of %d bytes exceeds "+
+				"memory bound (%d), dropping it", fl.Bytes, d.config.MaxBytes)
+		}
 	}
 	return nil, err2
 }
@@ -120,18 +161,42 @@ func (d *IPv4Defragmenter) DefragIPv4(in *layers.IPv4) (*layers.IPv4, error) {
 // time t. It returns the number of FragmentList aka number of
 // fragment packets it has discarded.
 func (d *IPv4Defragmenter) DiscardOlderThan(t time.Time) int {
-	var nb int
 	d.Lock()
+	defer d.Unlock()
+	return d.discardOlderThan(t)
+}
+
+func (d *IPv4Defragmenter) discardOlderThan(t time.Time) int {
+	var nb int
 	for k, v := range d.ipFlows {
 		if v.LastSeen.Before(t) {
 			nb = nb + 1
-			delete(d.ipFlows, k)
+			if d.config.Logger != nil {
+				d.config.Logger.Debug("defrag: datagram timed out", "flow", k.ip4, "id", k.id, "fragments", v.List.Len())
+			}
+			d.remove(k)
 		}
 	}
-	d.Unlock()
 	return nb
 }
 
+// remove forgets the fragments of datagram k.
+func (d *IPv4Defragmenter) remove(k ipv4) {
+	if fl, ok := d.ipFlows[k]; ok {
+		d.bytes -= fl.Bytes
+		d.lru.Remove(fl.elem)
+		delete(d.ipFlows, k)
+	}
+}
+
+// Pending returns the number of datagrams waiting for more fragments, and
+// the number of payload bytes their fragments hold.
+func (d *IPv4Defragmenter) Pending() (datagrams, bytes int) {
+	d.RLock()
+	defer d.RUnlock()
+	return len(d.ipFlows), d.bytes
+}
+
 // dontDefrag returns true if the IPv4 packet do not need
 // any defragmentation
 func (d *IPv4Defragmenter) dontDefrag(ip *layers.IPv4) bool {
@@ -174,13 +239,17 @@ type fragmentList struct {
 	Current       uint16
 	FinalReceived bool
 	LastSeen      time.Time
+	// Bytes is the payload held by the fragments in List.
+	Bytes int
+	// elem is the datagram's element in IPv4Defragmenter.lru.
+	elem *list.Element
 }
 
 // insert insert an IPv4 fragment/packet into the Fragment List
 // It use the following strategy : we are inserting fragment based
 // on their offset, latest first. This is sometimes called BSD-Right.
 // See: http://www.sans.org/reading-room/whitepapers/detection/ip-fragment-reassembly-scapy-33969
-func (f *fragmentList) insert(in *layers.IPv4) (*layers.IPv4, error) {
+func (f *fragmentList) insert(in *layers.IPv4, t time.Time) (*layers.IPv4, error) {
 	// TODO: should keep a copy of *in in the list
 	// or not (ie the packet source is reliable) ?
 	fragOffset := in.FragOffset * 8
@@ -197,11 +266,10 @@ func (f *fragmentList) insert(in *layers.IPv4) (*layers.IPv4, error) {
 			}
 		}
 	}
-	// packet.Metadata().Timestamp should have been better, but
-	// we don't have this info there...
-	f.LastSeen = time.Now()
+	f.LastSeen = t
+	f.Bytes += len(in.Payload)
 
-	fragLength := in.Length - 20
+	fragLength := in.Length - uint16(in.IHL)*4
 	// After inserting the Fragment, we update the counters
 	if f.Highest < fragOffset+fragLength {
 		f.Highest = fragOffset + fragLength
@@ -236,17 +304,17 @@ func (f *fragmentList) build(in *layers.IPv4) (*layers.IPv4, error) {
 		if frag.FragOffset*8 == currentOffset {
 			debug.Printf("defrag: building - adding %d\n", frag.FragOffset*8)
 			final = append(final, frag.Payload...)
-			currentOffset = currentOffset + frag.Length - 20
+			currentOffset = currentOffset + frag.Length - uint16(frag.IHL)*4
 		} else if frag.FragOffset*8 < currentOffset {
 			// overlapping fragment - let's take only what we need
 			startAt := currentOffset - frag.FragOffset*8
 			debug.Printf("defrag: building - overlapping, starting at %d\n",
 				startAt)
-			if startAt > frag.Length-20 {
+			if int(startAt) > len(frag.Payload) {
 				return nil, fmt.Errorf("defrag: building - invalid fragment")
 			}
 			final = append(final, frag.Payload[startAt:]...)
-			currentOffset = currentOffset + frag.FragOffset*8
+			currentOffset = frag.FragOffset*8 + uint16(len(frag.Payload))
 		} else {
 			// Houston - we have an hole !
 			debug.Printf("defrag: hole found while building, " +
@@ -261,7 +329,7 @@ func (f *fragmentList) build(in *layers.IPv4) (*layers.IPv4, error) {
 		Version:    in.Version,
 		IHL:        in.IHL,
 		TOS:        in.TOS,
-		Length:     f.Highest,
+		Length:     uint16(in.IHL)*4 + f.Highest,
 		Id:         0,
 		Flags:      0,
 		FragOffset: 0,
@@ -280,15 +348,17 @@ func (f *fragmentList) build(in *layers.IPv4) (*layers.IPv4, error) {
 
 // ipv4 is a struct to be used as a key.
 type ipv4 struct {
-	ip4 gopacket.Flow
-	id  uint16
+	ip4   gopacket.Flow
+	id    uint16
+	proto layers.IPProtocol
 }
 
 // newIPv4 returns a new initialized IPv4 Flow
 func newIPv4(ip *layers.IPv4) ipv4 {
 	return ipv4{
-		ip4: ip.NetworkFlow(),
-		id:  ip.Id,
+		ip4:   ip.NetworkFlow(),
+		id:    ip.Id,
+		proto: ip.Protocol,
 	}
 }
 
@@ -296,13 +366,46 @@ func newIPv4(ip *layers.IPv4) ipv4 {
 // all fragment/packet.
 type IPv4Defragmenter struct {
 	sync.RWMutex
-	ipFlows map[ipv4]*fragmentList
+	ipFlows   map[ipv4]*fragmentList
+	config    Config
+	bytes     int
+	lastSweep time.Time
+	// lru holds the keys of ipFlows, least recently seen first, so the
+	// memory bound drops the oldest datagram without a scan.
+	lru list.List
+}
+
+// Config bounds the state an IPv4Defragmenter keeps.
+type Config struct {
+	// Timeout is how long a datagram waits for its next fragment before
+	// its fragments are dropped.  Zero keeps them until DiscardOlderThan.
+	Timeout time.Duration
+	// MaxFragments is the most fragments kept for one datagram, which
+	// defaults to IPv4MaximumFragmentListLen.
+	MaxFragments int
+	// MaxBytes bounds the payload of the fragments kept for all datagrams.
+	// When it's exceeded, the least recently seen datagrams are dropped.
+	// Zero means no bound.
+	MaxBytes int
+	// Logger, if set, gets a Warn record for each datagram dropped by a
+	// bound, and a Debug record for each one that times out.
+	Logger *slog.Logger
 }
 
 // NewIPv4Defragmenter returns a new IPv4Defragmenter
 // with an initialized map.
 func NewIPv4Defragmenter() *IPv4Defragmenter {
+	return NewIPv4DefragmenterWithConfig(Config{})
+}
+
+// NewIPv4DefragmenterWithConfig returns a new IPv4Defragmenter bounded by
+// c.
+func NewIPv4DefragmenterWithConfig(c Config) *IPv4Defragmenter {
+	if c.MaxFragments <= 0 {
+		c.MaxFragments = IPv4MaximumFragmentListLen
+	}
 	return &IPv4Defragmenter{
 		ipFlows: make(map[ipv4]*fragmentList),
+		config:  c,
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/mistsys/gopacket"
 	"github.com/mistsys/gopacket/bytediff"
@@ -122,6 +123,87 @@ func TestDefragPingTooMuch(t *testing.T) {
 	}
 }
 
+func fragment(t *testing.T, buf []byte) *layers.IPv4 {
+	p := gopacket.NewPacket(buf, layers.LinkTypeEthernet, gopacket.Default)
+	ip, ok := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	if !ok {
+		t.Fatal("no IPv4 layer")
+	}
+	return ip
+}
+
+func TestDefragTimeout(t *testing.T) {
+	defrag := NewIPv4DefragmenterWithConfig(Config{Timeout: 30 * time.Second})
+	start := time.Unix(1000, 0)
+	frags := [][]byte{testPing1Frag1, testPing1Frag2, testPing1Frag3, testPing1Frag4}
+	for i, f := range frags[:3] {
+		if out, err := defrag.DefragIPv4WithTimestamp(fragment(t, f), start.Add(time.Duration(i)*time.Second)); out != nil || err != nil {
+			t.Fatalf("fragment %d: got %v, %v", i, out, err)
+		}
+	}
+	// The last fragment arrives too late, and starts a new datagram.
+	out, err := defrag.DefragIPv4WithTimestamp(fragment(t, frags[3]), start.Add(time.Minute))
+	if out != nil || err != nil {
+		t.Fatalf("late fragment: got %v, %v", out, err)
+	}
+	if n, _ := defrag.Pending(); n != 1 {
+		t.Errorf("got %d pending datagrams, want 1", n)
+	}
+	for i, f := range frags[:3] {
+		out, err = defrag.DefragIPv4WithTimestamp(fragment(t, f), start.Add(time.Minute+time.Duration(i)*time.Second))
+	}
+	if out == nil || err != nil {
+		t.Fatalf("got %v, %v, want reassembled datagram", out, err)
+	}
+	if out.Length != 20+4508 || out.NextLayerType() != layers.LayerTypeICMPv4 {
+		t.Errorf("got length %d next layer %v", out.Length, out.NextLayerType())
+	}
+	if n, b := defrag.Pending(); n != 0 || b != 0 {
+		t.Errorf("got %d pending datagrams of %d bytes after reassembly", n, b)
+	}
+}
+
+func TestDefragMaxBytes(t *testing.T) {
+	defrag := NewIPv4DefragmenterWithConfig(Config{MaxBytes: 3000})
+	now := time.Unix(1000, 0)
+	gentest := func(buf []byte) error {
+		now = now.Add(time.Second)
+		_, err := defrag.DefragIPv4WithTimestamp(fragment(t, buf), now)
+		return err
+	}
+	for _, f := range [][]byte{testPing1Frag1, testPing1Frag2, testPing2Frag1, testPing2Frag2} {
+		if err := gentest(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Ping1 is dropped to make room for Ping2.
+	if n, b := defrag.Pending(); n != 1 || b != 2960 {
+		t.Errorf("got %d pending datagrams of %d bytes, want 1 of 2960", n, b)
+	}
+	// Ping2 alone doesn't fit.
+	if err := gentest(testPing2Frag3); err == nil {
+		t.Error("no error exceeding memory bound")
+	}
+	if n, b := defrag.Pending(); n != 0 || b != 0 {
+		t.Errorf("got %d pending datagrams of %d bytes, want none", n, b)
+	}
+}
+
+func TestDefragProtocol(t *testing.T) {
+	defrag := NewIPv4Defragmenter()
+	gentestDefrag(t, defrag, testPing1Frag1, false, "Ping1Frag1")
+	// A fragment with the same addresses and ID but another protocol
+	// belongs to another datagram.
+	other := fragment(t, testPing1Frag2)
+	other.Protocol = layers.IPProtocolUDP
+	if out, err := defrag.DefragIPv4(other); out != nil || err != nil {
+		t.Fatalf("got %v, %v", out, err)
+	}
+	if n, _ := defrag.Pending(); n != 2 {
+		t.Errorf("got %d pending datagrams, want 2", n)
+	}
+}
+
 func gentestDefrag(t *testing.T, defrag *IPv4Defragmenter, buf []byte, expect bool, label string) *layers.IPv4 {
 	p := gopacket.NewPacket(buf, layers.LinkTypeEthernet, gopacket.Default)
 	if p.ErrorLayer() != nil {
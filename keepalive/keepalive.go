@@ -0,0 +1,559 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package keepalive identifies the keepalives sent on each flow, and
+// estimates the idle timeouts of NATs and firewalls from flows that fail
+// after a silence.
+//
+// An Analyzer follows TCP and UDP flows.  A TCP segment of at most one
+// byte, sent one byte before the next sequence number, is a TCP keepalive,
+// and Detectors recognize the keepalives of protocols above, like TLS
+// heartbeats or HTTP/2 PINGs.  When a flow has been silent for at least
+// MinIdle, what follows the packet ending the silence tells whether the
+// flow survived it: an answer means it did, and a reset, or a TCP segment
+// retransmitted with no answer within ResponseWindow, means it didn't.
+// The silences of every flow bound the idle timeout:
+//
+//	a := keepalive.NewAnalyzer(keepalive.DefaultConfig)
+//	for p := range source.Packets() {
+//	  a.Add(p)
+//	}
+//	a.Flush(time.Now())
+//	e := a.Estimate()
+//	fmt.Printf("idle timeout between %v and %v\n", e.Lower, e.Upper)
+package keepalive
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// Kind is a kind of keepalive.
+type Kind string
+
+const (
+	TCPKeepalive       Kind = "tcp-keepalive"
+	TLSHeartbeat       Kind = "tls-heartbeat"
+	HTTP2Ping          Kind = "http2-ping"
+	WebSocketPing      Kind = "websocket-ping"
+	MQTTPing           Kind = "mqtt-ping"
+	WireGuardKeepalive Kind = "wireguard-keepalive"
+	NATTKeepalive      Kind = "nat-t-keepalive"
+)
+
+// A Detector returns the Kind of keepalive p is, given its TCP or UDP
+// payload, or "" if it isn't one.
+type Detector func(p gopacket.Packet, payload []byte) Kind
+
+// DetectTLSHeartbeat detects TLS and DTLS heartbeat records (RFC 6520).
+func DetectTLSHeartbeat(p gopacket.Packet, payload []byte) Kind {
+	// Content type 24, and a TLS 3.x or DTLS 254.x version.
+	if len(payload) >= 5 && payload[0] == 24 && (payload[1] == 3 || payload[1] == 254) {
+		return TLSHeartbeat
+	}
+	return ""
+}
+
+// DetectHTTP2Ping detects segments holding just an HTTP/2 PING frame.
+func DetectHTTP2Ping(p gopacket.Packet, payload []byte) Kind {
+	// A 9 byte frame header, with length 8 and type 6, on stream 0.
+	if len(payload) == 17 && payload[0] == 0 && payload[1] == 0 && payload[2] == 8 && payload[3] == 6 &&
+		payload[5]|payload[6]|payload[7]|payload[8] == 0 {
+		return HTTP2Ping
+	}
+	return ""
+}
+
+// DetectWebSocketPing detects segments holding just a WebSocket ping or
+// pong frame.
+func DetectWebSocketPing(p gopacket.Packet, payload []byte) Kind {
+	if len(payload) < 2 || (payload[0] != 0x89 && payload[0] != 0x8a) {
+		return ""
+	}
+	n := 2 + int(payload[1]&0x7f)
+	if payload[1]&0x80 != 0 {
+		n += 4
+	}
+	if payload[1]&0x7f <= 125 && len(payload) == n {
+		return WebSocketPing
+	}
+	return ""
+}
+
+// DetectMQTTPing detects MQTT PINGREQ and PINGRESP packets.
+func DetectMQTTPing(p gopacket.Packet, payload []byte) Kind {
+	if len(payload) == 2 && (payload[0] == 0xc0 || payload[0] == 0xd0) && payload[1] == 0 {
+		return MQTTPing
+	}
+	return ""
+}
+
+// DetectWireGuard detects WireGuard keepalives.
+func DetectWireGuard(p gopacket.Packet, payload []byte) Kind {
+	if w, ok := p.Layer(layers.LayerTypeWireGuard).(*layers.WireGuard); ok && w.IsKeepalive() {
+		return WireGuardKeepalive
+	}
+	return ""
+}
+
+// DetectNATT detects the NAT keepalives of UDP encapsulated IPsec.
+func DetectNATT(p gopacket.Packet, payload []byte) Kind {
+	if e, ok := p.Layer(layers.LayerTypeIPSecUDPEncap).(*layers.IPSecUDPEncap); ok && e.Type == layers.IPSecUDPEncapKeepalive {
+		return NATTKeepalive
+	}
+	return ""
+}
+
+// Result is what followed a silence.
+type Result uint8
+
+const (
+	// Answered is a silence followed by an answer from the other side.
+	Answered Result = iota
+	// Reset is a silence followed by a TCP reset.
+	Reset
+	// Retransmitted is a silence followed by a TCP segment that was
+	// retransmitted, and not answered within ResponseWindow.
+	Retransmitted
+)
+
+func (r Result) String() string {
+	switch r {
+	case Answered:
+		return "Answered"
+	case Reset:
+		return "Reset"
+	case Retransmitted:
+		return "Retransmitted"
+	default:
+		return fmt.Sprintf("UnknownResult(%d)", uint8(r))
+	}
+}
+
+// Failed reports whether r means the flow didn't survive the silence.
+func (r Result) Failed() bool { return r != Answered }
+
+// Silence is a period of at least MinIdle in which a flow sent nothing,
+// and what followed it.
+type Silence struct {
+	// Time is when the packet ending the silence was seen.
+	Time       time.Time
+	Idle       time.Duration
+	FromClient bool
+	Result     Result
+}
+
+// Pattern summarizes the keepalives of one kind on a flow.
+type Pattern struct {
+	Kind                   Kind
+	Count                  int
+	FromClient, FromServer int
+	First, Last            time.Time
+	// Interval is the median time between consecutive keepalives, or zero
+	// if there was only one.
+	Interval time.Duration
+}
+
+// Flow is a flow's keepalives and silences.  Its client is the sender of
+// the TCP SYN, if one is seen, and otherwise the sender of the first
+// packet seen, unless the capture direction says it was inbound.
+type Flow struct {
+	Protocol               layers.IPProtocol
+	Client, Server         net.IP
+	ClientPort, ServerPort uint16
+	First, Last            time.Time
+	// Keepalives are sorted by Kind.
+	Keepalives []Pattern
+	Silences   []Silence
+}
+
+// Config configures an Analyzer.
+type Config struct {
+	// MinIdle is the shortest silence whose outcome is recorded.
+	MinIdle time.Duration
+	// ResponseWindow is how long after a silence a retransmitted segment
+	// may still be answered.
+	ResponseWindow time.Duration
+	// Detectors detect keepalives above TCP and UDP.
+	Detectors []Detector
+}
+
+// DefaultConfig records silences of at least 30 seconds, waits 10 seconds
+// for answers, and detects TLS heartbeats, HTTP/2 PINGs, WebSocket pings,
+// MQTT pings, and WireGuard and IPsec NAT-T keepalives.
+var DefaultConfig = Config{
+	MinIdle:        30 * time.Second,
+	ResponseWindow: 10 * time.Second,
+	Detectors: []Detector{
+		DetectTLSHeartbeat,
+		DetectHTTP2Ping,
+		DetectWebSocketPing,
+		DetectMQTTPing,
+		DetectWireGuard,
+		DetectNATT,
+	},
+}
+
+// half is one direction of a TCP flow.
+type half struct {
+	seen bool
+	next uint32
+}
+
+// pending is a silence whose outcome isn't known yet.
+type pending struct {
+	Silence
+	tcp           bool
+	seq, end      uint32
+	retransmitted bool
+}
+
+type flowKey struct {
+	network, transport gopacket.Flow
+}
+
+type flow struct {
+	Flow
+	fromClient, fromServer half
+	keepalives             map[Kind]*keepalives
+	pending                *pending
+	// failed is set after a failed silence, until the other side answers,
+	// so the retries of a dead flow aren't taken as more silences.
+	failed, failedFromClient bool
+}
+
+type keepalives struct {
+	Pattern
+	times []time.Time
+}
+
+// Analyzer follows TCP and UDP flows, recording their keepalives and
+// silences.  It is not safe for concurrent use.
+type Analyzer struct {
+	Config
+	flows map[flowKey]*flow
+}
+
+// NewAnalyzer creates an Analyzer with the given configuration.
+func NewAnalyzer(c Config) *Analyzer {
+	return &Analyzer{Config: c, flows: map[flowKey]*flow{}}
+}
+
+// Add records p, if it is a TCP segment or UDP datagram.
+func (a *Analyzer) Add(p gopacket.Packet) {
+	var src net.IP
+	switch ip := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		src = ip.SrcIP
+	case *layers.IPv6:
+		src = ip.SrcIP
+	default:
+		return
+	}
+	var tcp *layers.TCP
+	var sport uint16
+	var payload []byte
+	switch t := p.TransportLayer().(type) {
+	case *layers.TCP:
+		tcp, sport, payload = t, uint16(t.SrcPort), t.Payload
+	case *layers.UDP:
+		sport, payload = uint16(t.SrcPort), t.Payload
+	default:
+		return
+	}
+	ts := p.Metadata().Timestamp
+	f := a.flow(p, tcp)
+	fromClient := sport == f.ClientPort && src.Equal(f.Client)
+	h := &f.fromServer
+	if fromClient {
+		h = &f.fromClient
+	}
+
+	if f.pending != nil {
+		a.resolve(f, tcp, fromClient, ts)
+	}
+	if f.failed && fromClient != f.failedFromClient {
+		f.failed = false
+	}
+	idle := ts.Sub(f.Last)
+	if !f.First.IsZero() && idle >= a.MinIdle && f.pending == nil && !f.failed {
+		a.silence(f, tcp, fromClient, ts, idle)
+	}
+	if f.First.IsZero() {
+		f.First = ts
+	}
+	f.Last = ts
+
+	var kind Kind
+	if tcp != nil {
+		if h.seen && tcp.ACK && !tcp.SYN && !tcp.FIN && !tcp.RST && len(payload) <= 1 && tcp.Seq == h.next-1 {
+			kind = TCPKeepalive
+		}
+		length := uint32(len(payload))
+		if tcp.SYN || tcp.FIN {
+			length++
+		}
+		if end := tcp.Seq + length; !h.seen || tcp.SYN || int32(end-h.next) > 0 {
+			h.seen, h.next = true, end
+		}
+	}
+	for _, d := range a.Detectors {
+		if kind != "" || len(payload) == 0 {
+			break
+		}
+		kind = d(p, payload)
+	}
+	if kind != "" {
+		f.keepalive(kind, fromClient, ts)
+	}
+}
+
+// flow returns the flow of p, whose TCP layer is tcp, or nil for UDP.
+func (a *Analyzer) flow(p gopacket.Packet, tcp *layers.TCP) *flow {
+	nf, tf := p.NetworkLayer().NetworkFlow(), p.TransportLayer().TransportFlow()
+	k := flowKey{nf, tf}
+	if nf.Dst().LessThan(nf.Src()) || (nf.Dst() == nf.Src() && tf.Dst().LessThan(tf.Src())) {
+		k = flowKey{nf.Reverse(), tf.Reverse()}
+	}
+	syn := tcp != nil && tcp.SYN && !tcp.ACK
+	f := a.flows[k]
+	if f != nil && !syn {
+		return f
+	}
+	src, dst := net.IP(nf.Src().Raw()), net.IP(nf.Dst().Raw())
+	sport, dport := binaryPort(tf.Src()), binaryPort(tf.Dst())
+	if tcp != nil && tcp.SYN && tcp.ACK || (!syn && p.Metadata().Direction == gopacket.DirectionInbound) {
+		src, dst, sport, dport = dst, src, dport, sport
+	}
+	if f == nil {
+		f = &flow{keepalives: map[Kind]*keepalives{}}
+		f.Protocol = layers.IPProtocolUDP
+		if tcp != nil {
+			f.Protocol = layers.IPProtocolTCP
+		}
+		a.flows[k] = f
+	}
+	f.Client, f.Server = append(net.IP(nil), src...), append(net.IP(nil), dst...)
+	f.ClientPort, f.ServerPort = sport, dport
+	return f
+}
+
+func binaryPort(e gopacket.Endpoint) uint16 {
+	b := e.Raw()
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+// silence records the silence of idle that the packet sent at ts ends.
+// Only packets that should be answered start one, unless they reset the
+// flow.
+func (a *Analyzer) silence(f *flow, tcp *layers.TCP, fromClient bool, ts time.Time, idle time.Duration) {
+	s := Silence{Time: ts, Idle: idle, FromClient: fromClient}
+	if tcp == nil {
+		f.pending = &pending{Silence: s}
+		return
+	}
+	if tcp.RST {
+		s.Result = Reset
+		f.Silences = append(f.Silences, s)
+		f.failed, f.failedFromClient = true, fromClient
+		return
+	}
+	h := &f.fromServer
+	if fromClient {
+		h = &f.fromClient
+	}
+	length := uint32(len(tcp.Payload))
+	if tcp.SYN || tcp.FIN {
+		length++
+	}
+	if length == 0 && !(h.seen && tcp.Seq == h.next-1) {
+		// A pure ACK isn't answered.
+		return
+	}
+	end := tcp.Seq + length
+	if h.seen && tcp.Seq == h.next-1 && len(tcp.Payload) <= 1 {
+		// A keepalive is answered with an ACK of the next sequence number.
+		end = h.next
+	}
+	f.pending = &pending{Silence: s, tcp: true, seq: tcp.Seq, end: end}
+}
+
+// resolve looks for the outcome of f's pending silence in a packet sent at
+// ts.
+func (a *Analyzer) resolve(f *flow, tcp *layers.TCP, fromClient bool, ts time.Time) {
+	pd := f.pending
+	switch {
+	case tcp != nil && tcp.RST:
+		a.done(f, Reset)
+		return
+	case fromClient != pd.FromClient:
+		if !pd.tcp || tcp.ACK && int32(tcp.Ack-pd.end) >= 0 {
+			a.done(f, Answered)
+			return
+		}
+	case pd.tcp && tcp.Seq == pd.seq:
+		pd.retransmitted = true
+	}
+	a.expire(f, ts)
+}
+
+// expire ends f's pending silence if its response window has passed by
+// now.
+func (a *Analyzer) expire(f *flow, now time.Time) {
+	if now.Sub(f.pending.Time) <= a.ResponseWindow {
+		return
+	}
+	if f.pending.retransmitted {
+		a.done(f, Retransmitted)
+		return
+	}
+	// Nothing says what happened: the packet may not need an answer, or
+	// the answer and retransmissions weren't captured.
+	f.pending = nil
+}
+
+func (a *Analyzer) done(f *flow, r Result) {
+	s := f.pending.Silence
+	s.Result = r
+	f.Silences = append(f.Silences, s)
+	f.pending = nil
+	if r.Failed() {
+		f.failed, f.failedFromClient = true, s.FromClient
+	}
+}
+
+func (f *flow) keepalive(kind Kind, fromClient bool, ts time.Time) {
+	k := f.keepalives[kind]
+	if k == nil {
+		k = &keepalives{Pattern: Pattern{Kind: kind, First: ts}}
+		f.keepalives[kind] = k
+	}
+	k.Count++
+	if fromClient {
+		k.FromClient++
+	} else {
+		k.FromServer++
+	}
+	k.Last = ts
+	k.times = append(k.times, ts)
+}
+
+// Flush ends the silences whose response window has passed by now.
+func (a *Analyzer) Flush(now time.Time) {
+	for _, f := range a.flows {
+		if f.pending != nil {
+			a.expire(f, now)
+		}
+	}
+}
+
+// Expire forgets every flow whose last packet was before t.
+func (a *Analyzer) Expire(t time.Time) {
+	for k, f := range a.flows {
+		if f.Last.Before(t) {
+			delete(a.flows, k)
+		}
+	}
+}
+
+// Flows returns every flow, sorted by first packet then client and server.
+func (a *Analyzer) Flows() []Flow {
+	flows := make([]Flow, 0, len(a.flows))
+	for _, f := range a.flows {
+		out := f.Flow
+		out.Silences = append([]Silence(nil), f.Silences...)
+		out.Keepalives = nil
+		for _, k := range f.keepalives {
+			out.Keepalives = append(out.Keepalives, k.pattern())
+		}
+		sort.Slice(out.Keepalives, func(i, j int) bool { return out.Keepalives[i].Kind < out.Keepalives[j].Kind })
+		flows = append(flows, out)
+	}
+	sort.Slice(flows, func(i, j int) bool {
+		a, b := &flows[i], &flows[j]
+		if !a.First.Equal(b.First) {
+			return a.First.Before(b.First)
+		}
+		if c := bytes.Compare(a.Client, b.Client); c != 0 {
+			return c < 0
+		}
+		if a.ClientPort != b.ClientPort {
+			return a.ClientPort < b.ClientPort
+		}
+		if c := bytes.Compare(a.Server, b.Server); c != 0 {
+			return c < 0
+		}
+		return a.ServerPort < b.ServerPort
+	})
+	return flows
+}
+
+func (k *keepalives) pattern() Pattern {
+	p := k.Pattern
+	if len(k.times) < 2 {
+		return p
+	}
+	gaps := make([]time.Duration, len(k.times)-1)
+	for i := range gaps {
+		gaps[i] = k.times[i+1].Sub(k.times[i])
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	p.Interval = gaps[len(gaps)/2]
+	return p
+}
+
+// Estimate bounds an idle timeout from the silences flows survived and
+// failed after.
+type Estimate struct {
+	// Upper is the shortest silence a flow failed after, or zero if none
+	// did, and Lower the longest shorter one a flow survived.
+	Lower, Upper     time.Duration
+	Survived, Failed int
+	// Conflicts counts the silences survived that were at least as long as
+	// Upper.  They mean some failures weren't idle timeouts, or that the
+	// flows crossed middleboxes with different timeouts.
+	Conflicts int
+}
+
+// EstimateTimeout returns the Estimate of silences.
+func EstimateTimeout(silences []Silence) Estimate {
+	var e Estimate
+	for _, s := range silences {
+		if s.Result.Failed() {
+			e.Failed++
+			if e.Upper == 0 || s.Idle < e.Upper {
+				e.Upper = s.Idle
+			}
+		} else {
+			e.Survived++
+		}
+	}
+	for _, s := range silences {
+		switch {
+		case s.Result.Failed():
+		case e.Upper != 0 && s.Idle >= e.Upper:
+			e.Conflicts++
+		case s.Idle > e.Lower:
+			e.Lower = s.Idle
+		}
+	}
+	return e
+}
+
+// Estimate returns the Estimate of the silences of every flow.
+func (a *Analyzer) Estimate() Estimate {
+	var silences []Silence
+	for _, f := range a.flows {
+		silences = append(silences, f.Silences...)
+	}
+	return EstimateTimeout(silences)
+}
@@ -0,0 +1,173 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package keepalive
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+var (
+	client = net.IP{10, 0, 0, 1}
+	server = net.IP{192, 0, 2, 1}
+	start  = time.Unix(1000, 0)
+)
+
+func segment(t *testing.T, ts time.Duration, port layers.TCPPort, fromClient bool, tcp *layers.TCP, payload []byte) gopacket.Packet {
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: server, DstIP: client}
+	tcp.SrcPort, tcp.DstPort = 443, port
+	if fromClient {
+		ip.SrcIP, ip.DstIP = client, server
+		tcp.SrcPort, tcp.DstPort = port, 443
+	}
+	tcp.Window = 1000
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ip, tcp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	p.Metadata().Timestamp = start.Add(ts)
+	return p
+}
+
+func TestAnalyzer(t *testing.T) {
+	a := NewAnalyzer(DefaultConfig)
+	s := time.Second
+	data := make([]byte, 10)
+	add := func(ts time.Duration, fromClient bool, tcp *layers.TCP, payload []byte) {
+		a.Add(segment(t, ts, 40000, fromClient, tcp, payload))
+	}
+	add(0, true, &layers.TCP{SYN: true, Seq: 99}, nil)
+	add(0, false, &layers.TCP{SYN: true, ACK: true, Seq: 999, Ack: 100}, nil)
+	add(0, true, &layers.TCP{ACK: true, Seq: 100, Ack: 1000}, data)
+	add(0, false, &layers.TCP{ACK: true, Seq: 1000, Ack: 110}, nil)
+	// A minute's silence, survived.
+	add(60*s, true, &layers.TCP{ACK: true, Seq: 110, Ack: 1000}, data)
+	add(60*s, false, &layers.TCP{ACK: true, Seq: 1000, Ack: 120}, nil)
+	// Two TCP keepalives, 45 seconds apart, and answered.
+	add(100*s, true, &layers.TCP{ACK: true, Seq: 119, Ack: 1000}, nil)
+	add(100*s, false, &layers.TCP{ACK: true, Seq: 1000, Ack: 120}, nil)
+	add(145*s, true, &layers.TCP{ACK: true, Seq: 119, Ack: 1000}, []byte{0})
+	add(145*s, false, &layers.TCP{ACK: true, Seq: 1000, Ack: 120}, nil)
+	// And an HTTP/2 PING from the server, too soon to be a silence.
+	ping := []byte{0, 0, 8, 6, 0, 0, 0, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8}
+	add(150*s, false, &layers.TCP{ACK: true, Seq: 1000, Ack: 120}, ping)
+	add(150*s, true, &layers.TCP{ACK: true, Seq: 120, Ack: 1017}, nil)
+	// Then 400 seconds, after which the client's data is retransmitted and
+	// never answered.  The retransmissions aren't silences of their own.
+	add(550*s, true, &layers.TCP{ACK: true, Seq: 120, Ack: 1017}, data)
+	add(551*s, true, &layers.TCP{ACK: true, Seq: 120, Ack: 1017}, data)
+	add(553*s, true, &layers.TCP{ACK: true, Seq: 120, Ack: 1017}, data)
+	add(600*s, true, &layers.TCP{ACK: true, Seq: 120, Ack: 1017}, data)
+
+	// A second connection, reset 300 seconds into a silence.
+	b := func(ts time.Duration, fromClient bool, tcp *layers.TCP, payload []byte) {
+		a.Add(segment(t, ts, 40001, fromClient, tcp, payload))
+	}
+	b(10*s, true, &layers.TCP{SYN: true, Seq: 0}, nil)
+	b(10*s, false, &layers.TCP{SYN: true, ACK: true, Seq: 0, Ack: 1}, nil)
+	b(310*s, true, &layers.TCP{ACK: true, Seq: 1, Ack: 1}, data)
+	b(310*s, false, &layers.TCP{RST: true, Seq: 1}, nil)
+	a.Flush(start.Add(700 * s))
+
+	flows := a.Flows()
+	if len(flows) != 2 {
+		t.Fatalf("got %d flows, want 2", len(flows))
+	}
+	f := flows[0]
+	if !f.Client.Equal(client) || f.ClientPort != 40000 || !f.Server.Equal(server) || f.ServerPort != 443 || f.Protocol != layers.IPProtocolTCP {
+		t.Errorf("got flow %+v", f)
+	}
+	wantKeepalives := []Pattern{
+		{Kind: HTTP2Ping, Count: 1, FromServer: 1, First: start.Add(150 * s), Last: start.Add(150 * s)},
+		{Kind: TCPKeepalive, Count: 2, FromClient: 2, First: start.Add(100 * s), Last: start.Add(145 * s), Interval: 45 * s},
+	}
+	if !reflect.DeepEqual(f.Keepalives, wantKeepalives) {
+		t.Errorf("got keepalives %+v, want %+v", f.Keepalives, wantKeepalives)
+	}
+	wantSilences := []Silence{
+		{Time: start.Add(60 * s), Idle: 60 * s, FromClient: true, Result: Answered},
+		{Time: start.Add(100 * s), Idle: 40 * s, FromClient: true, Result: Answered},
+		{Time: start.Add(145 * s), Idle: 45 * s, FromClient: true, Result: Answered},
+		{Time: start.Add(550 * s), Idle: 400 * s, FromClient: true, Result: Retransmitted},
+	}
+	if !reflect.DeepEqual(f.Silences, wantSilences) {
+		t.Errorf("got silences %+v, want %+v", f.Silences, wantSilences)
+	}
+	if s := flows[1].Silences; len(s) != 1 || s[0].Result != Reset || s[0].Idle != 300*time.Second {
+		t.Errorf("got silences %+v", s)
+	}
+
+	want := Estimate{Lower: 60 * s, Upper: 300 * s, Survived: 3, Failed: 2}
+	if got := a.Estimate(); got != want {
+		t.Errorf("got estimate %+v, want %+v", got, want)
+	}
+}
+
+func TestEstimateConflicts(t *testing.T) {
+	m := time.Minute
+	e := EstimateTimeout([]Silence{
+		{Idle: 5 * m, Result: Answered},
+		{Idle: 20 * m, Result: Answered},
+		{Idle: 10 * m, Result: Reset},
+		{Idle: 30 * m, Result: Retransmitted},
+	})
+	want := Estimate{Lower: 5 * m, Upper: 10 * m, Survived: 2, Failed: 2, Conflicts: 1}
+	if e != want {
+		t.Errorf("got %+v, want %+v", e, want)
+	}
+}
+
+func TestDetectors(t *testing.T) {
+	for _, c := range []struct {
+		d       Detector
+		payload []byte
+		want    Kind
+	}{
+		{DetectTLSHeartbeat, []byte{24, 3, 3, 0, 3, 1, 0, 0}, TLSHeartbeat},
+		{DetectTLSHeartbeat, []byte{23, 3, 3, 0, 3, 1, 0, 0}, ""},
+		{DetectWebSocketPing, []byte{0x89, 0x82, 1, 2, 3, 4, 5, 6}, WebSocketPing},
+		{DetectWebSocketPing, []byte{0x8a, 0}, WebSocketPing},
+		{DetectWebSocketPing, []byte{0x81, 0}, ""},
+		{DetectMQTTPing, []byte{0xc0, 0}, MQTTPing},
+		{DetectMQTTPing, []byte{0x30, 0}, ""},
+		{DetectHTTP2Ping, []byte{0, 0, 8, 6, 0, 0, 0, 0, 1, 1, 2, 3, 4, 5, 6, 7, 8}, ""},
+	} {
+		if got := c.d(nil, c.payload); got != c.want {
+			t.Errorf("detector on %x got %q, want %q", c.payload, got, c.want)
+		}
+	}
+}
+
+func TestUDPKeepalives(t *testing.T) {
+	a := NewAnalyzer(DefaultConfig)
+	for _, ts := range []time.Duration{0, 20 * time.Second, 40 * time.Second} {
+		ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: client, DstIP: server}
+		udp := &layers.UDP{SrcPort: 4500, DstPort: 4500}
+		udp.SetNetworkLayerForChecksum(ip)
+		buf := gopacket.NewSerializeBuffer()
+		if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ip, udp, gopacket.Payload{0xff}); err != nil {
+			t.Fatal(err)
+		}
+		p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+		p.Metadata().Timestamp = start.Add(ts)
+		a.Add(p)
+	}
+	flows := a.Flows()
+	if len(flows) != 1 || len(flows[0].Keepalives) != 1 {
+		t.Fatalf("got flows %+v", flows)
+	}
+	if k := flows[0].Keepalives[0]; k.Kind != NATTKeepalive || k.Count != 3 || k.Interval != 20*time.Second || k.FromClient != 3 {
+		t.Errorf("got keepalives %+v", k)
+	}
+}
@@ -0,0 +1,470 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// AMQP091FrameType is the type of an AMQP 0-9-1 frame.
+type AMQP091FrameType uint8
+
+// AMQP 0-9-1 frame types.
+const (
+	AMQP091FrameMethod    AMQP091FrameType = 1
+	AMQP091FrameHeader    AMQP091FrameType = 2
+	AMQP091FrameBody      AMQP091FrameType = 3
+	AMQP091FrameHeartbeat AMQP091FrameType = 8
+)
+
+func (t AMQP091FrameType) String() string {
+	switch t {
+	case AMQP091FrameMethod:
+		return "Method"
+	case AMQP091FrameHeader:
+		return "Header"
+	case AMQP091FrameBody:
+		return "Body"
+	case AMQP091FrameHeartbeat:
+		return "Heartbeat"
+	default:
+		return fmt.Sprintf("UnknownAMQP091FrameType(%d)", t)
+	}
+}
+
+// AMQP091Method is the class ID and method ID of an AMQP 0-9-1 method, in
+// the top and bottom 16 bits.
+type AMQP091Method uint32
+
+// Class returns the class ID of the method.
+func (m AMQP091Method) Class() uint16 { return uint16(m >> 16) }
+
+// ID returns the method ID within the class.
+func (m AMQP091Method) ID() uint16 { return uint16(m) }
+
+// AMQP 0-9-1 methods.
+const (
+	AMQP091ConnectionStart   AMQP091Method = 10<<16 | 10
+	AMQP091ConnectionStartOk AMQP091Method = 10<<16 | 11
+	AMQP091ConnectionTune    AMQP091Method = 10<<16 | 30
+	AMQP091ConnectionTuneOk  AMQP091Method = 10<<16 | 31
+	AMQP091ConnectionOpen    AMQP091Method = 10<<16 | 40
+	AMQP091ConnectionOpenOk  AMQP091Method = 10<<16 | 41
+	AMQP091ConnectionClose   AMQP091Method = 10<<16 | 50
+	AMQP091ConnectionCloseOk AMQP091Method = 10<<16 | 51
+	AMQP091ChannelOpen       AMQP091Method = 20<<16 | 10
+	AMQP091ChannelOpenOk     AMQP091Method = 20<<16 | 11
+	AMQP091ChannelClose      AMQP091Method = 20<<16 | 40
+	AMQP091ChannelCloseOk    AMQP091Method = 20<<16 | 41
+	AMQP091ExchangeDeclare   AMQP091Method = 40<<16 | 10
+	AMQP091ExchangeDeclareOk AMQP091Method = 40<<16 | 11
+	AMQP091QueueDeclare      AMQP091Method = 50<<16 | 10
+	AMQP091QueueDeclareOk    AMQP091Method = 50<<16 | 11
+	AMQP091QueueBind         AMQP091Method = 50<<16 | 20
+	AMQP091QueueBindOk       AMQP091Method = 50<<16 | 21
+	AMQP091BasicQos          AMQP091Method = 60<<16 | 10
+	AMQP091BasicQosOk        AMQP091Method = 60<<16 | 11
+	AMQP091BasicConsume      AMQP091Method = 60<<16 | 20
+	AMQP091BasicConsumeOk    AMQP091Method = 60<<16 | 21
+	AMQP091BasicCancel       AMQP091Method = 60<<16 | 30
+	AMQP091BasicCancelOk     AMQP091Method = 60<<16 | 31
+	AMQP091BasicPublish      AMQP091Method = 60<<16 | 40
+	AMQP091BasicReturn       AMQP091Method = 60<<16 | 50
+	AMQP091BasicDeliver      AMQP091Method = 60<<16 | 60
+	AMQP091BasicGet          AMQP091Method = 60<<16 | 70
+	AMQP091BasicGetOk        AMQP091Method = 60<<16 | 71
+	AMQP091BasicGetEmpty     AMQP091Method = 60<<16 | 72
+	AMQP091BasicAck          AMQP091Method = 60<<16 | 80
+	AMQP091BasicReject       AMQP091Method = 60<<16 | 90
+	AMQP091BasicNack         AMQP091Method = 60<<16 | 120
+	AMQP091ConfirmSelect     AMQP091Method = 85<<16 | 10
+	AMQP091ConfirmSelectOk   AMQP091Method = 85<<16 | 11
+	AMQP091TxSelect          AMQP091Method = 90<<16 | 10
+	AMQP091TxCommit          AMQP091Method = 90<<16 | 20
+	AMQP091TxRollback        AMQP091Method = 90<<16 | 30
+)
+
+var amqp091MethodNames = map[AMQP091Method]string{
+	AMQP091ConnectionStart:   "connection.start",
+	AMQP091ConnectionStartOk: "connection.start-ok",
+	AMQP091ConnectionTune:    "connection.tune",
+	AMQP091ConnectionTuneOk:  "connection.tune-ok",
+	AMQP091ConnectionOpen:    "connection.open",
+	AMQP091ConnectionOpenOk:  "connection.open-ok",
+	AMQP091ConnectionClose:   "connection.close",
+	AMQP091ConnectionCloseOk: "connection.close-ok",
+	AMQP091ChannelOpen:       "channel.open",
+	AMQP091ChannelOpenOk:     "channel.open-ok",
+	AMQP091ChannelClose:      "channel.close",
+	AMQP091ChannelCloseOk:    "channel.close-ok",
+	AMQP091ExchangeDeclare:   "exchange.declare",
+	AMQP091ExchangeDeclareOk: "exchange.declare-ok",
+	AMQP091QueueDeclare:      "queue.declare",
+	AMQP091QueueDeclareOk:    "queue.declare-ok",
+	AMQP091QueueBind:         "queue.bind",
+	AMQP091QueueBindOk:       "queue.bind-ok",
+	AMQP091BasicQos:          "basic.qos",
+	AMQP091BasicQosOk:        "basic.qos-ok",
+	AMQP091BasicConsume:      "basic.consume",
+	AMQP091BasicConsumeOk:    "basic.consume-ok",
+	AMQP091BasicCancel:       "basic.cancel",
+	AMQP091BasicCancelOk:     "basic.cancel-ok",
+	AMQP091BasicPublish:      "basic.publish",
+	AMQP091BasicReturn:       "basic.return",
+	AMQP091BasicDeliver:      "basic.deliver",
+	AMQP091BasicGet:          "basic.get",
+	AMQP091BasicGetOk:        "basic.get-ok",
+	AMQP091BasicGetEmpty:     "basic.get-empty",
+	AMQP091BasicAck:          "basic.ack",
+	AMQP091BasicReject:       "basic.reject",
+	AMQP091BasicNack:         "basic.nack",
+	AMQP091ConfirmSelect:     "confirm.select",
+	AMQP091ConfirmSelectOk:   "confirm.select-ok",
+	AMQP091TxSelect:          "tx.select",
+	AMQP091TxCommit:          "tx.commit",
+	AMQP091TxRollback:        "tx.rollback",
+}
+
+func (m AMQP091Method) String() string {
+	if name, ok := amqp091MethodNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("UnknownAMQP091Method(%d.%d)", m.Class(), m.ID())
+}
+
+// amqp091ProtocolHeader starts an AMQP 0-9-1 connection.
+var amqp091ProtocolHeader = []byte("AMQP\x00\x00\x09\x01")
+
+// AMQP091 is an AMQP 0-9-1 frame, the protocol of RabbitMQ and other
+// message brokers, or the protocol header that starts a connection.
+//
+// The arguments of the methods that open connections and channels, declare
+// and bind queues, and publish, deliver and acknowledge messages are
+// decoded into the fields named after them; those of other methods are
+// left in Arguments.  Content header frames give the size of the message
+// body, which follows in body frames.
+//
+// A TCP segment may hold several frames, each decoded as a layer; use
+// AMQPStream for frames split across segments.
+type AMQP091 struct {
+	BaseLayer
+	// ProtocolHeader is set if this is the protocol header rather than a
+	// frame.
+	ProtocolHeader bool
+	Type           AMQP091FrameType
+	Channel        uint16
+	Size           uint32
+
+	// Method and Arguments are set for method frames.
+	Method    AMQP091Method
+	Arguments []byte
+
+	VirtualHost  string
+	Exchange     string
+	ExchangeType string
+	Queue        string
+	RoutingKey   string
+	ConsumerTag  string
+	DeliveryTag  uint64
+	// Redelivered is set for basic.deliver and basic.get-ok, and Multiple
+	// for basic.ack and basic.nack.
+	Redelivered bool
+	Multiple    bool
+	// ReplyCode and ReplyText are the reason for connection.close,
+	// channel.close and basic.return.
+	ReplyCode uint16
+	ReplyText string
+
+	// ContentClass and BodySize are set for content header frames.
+	ContentClass uint16
+	BodySize     uint64
+	// Body is the content of body frames.
+	Body []byte
+}
+
+// LayerType returns LayerTypeAMQP091.
+func (a *AMQP091) LayerType() gopacket.LayerType { return LayerTypeAMQP091 }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (a *AMQP091) CanDecode() gopacket.LayerClass { return LayerTypeAMQP091 }
+
+// NextLayerType returns the layer type of the frame following this one,
+// if it's complete, and otherwise LayerTypePayload.
+func (a *AMQP091) NextLayerType() gopacket.LayerType {
+	return amqpNextLayerType(a.BaseLayer.Payload)
+}
+
+// Payload returns nil, since the frame's body is part of the layer.
+func (a *AMQP091) Payload() []byte { return nil }
+
+func decodeAMQP(data []byte, p gopacket.PacketBuilder) error {
+	var l interface {
+		gopacket.DecodingLayer
+		gopacket.ApplicationLayer
+	}
+	switch {
+	case isAMQP091(data):
+		l = &AMQP091{}
+	case isAMQP10(data):
+		l = &AMQP10{}
+	default:
+		// A segment that doesn't start with a complete frame is left as
+		// payload; reassemble the stream and use AMQPStream to decode
+		// it.
+		return gopacket.DecodePayload.Decode(data, p)
+	}
+	if err := l.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(l)
+	p.SetApplicationLayer(l)
+	if len(l.LayerPayload()) == 0 {
+		return nil
+	}
+	return p.NextDecoder(gopacket.DecodeFunc(decodeAMQP))
+}
+
+// amqpNextLayerType returns the layer type of the protocol header or
+// complete frame at the start of data, or LayerTypeZero if data is empty,
+// and otherwise LayerTypePayload.
+func amqpNextLayerType(data []byte) gopacket.LayerType {
+	switch {
+	case len(data) == 0:
+		return gopacket.LayerTypeZero
+	case isAMQP091(data):
+		return LayerTypeAMQP091
+	case isAMQP10(data):
+		return LayerTypeAMQP10
+	}
+	return gopacket.LayerTypePayload
+}
+
+// isAMQP091 returns true if data starts with the AMQP 0-9-1 protocol
+// header or a complete frame.
+func isAMQP091(data []byte) bool {
+	return bytes.HasPrefix(data, amqp091ProtocolHeader) || isAMQP091Frame(data)
+}
+
+// isAMQP091Frame returns true if data starts with a complete AMQP 0-9-1
+// frame, which is told apart by its type and the end octet after the
+// payload.
+func isAMQP091Frame(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	switch AMQP091FrameType(data[0]) {
+	case AMQP091FrameMethod, AMQP091FrameHeader, AMQP091FrameBody, AMQP091FrameHeartbeat:
+	default:
+		return false
+	}
+	n := 7 + uint64(binary.BigEndian.Uint32(data[3:7]))
+	return n < uint64(len(data)) && data[n] == 0xce
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (a *AMQP091) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	*a = AMQP091{}
+	if bytes.HasPrefix(data, amqp091ProtocolHeader) {
+		a.ProtocolHeader = true
+		a.BaseLayer = BaseLayer{Contents: data[:8], Payload: data[8:]}
+		return nil
+	}
+	if len(data) < 8 {
+		df.SetTruncated()
+		return errors.New("AMQP 0-9-1 frame header truncated")
+	}
+	a.Type = AMQP091FrameType(data[0])
+	a.Channel = binary.BigEndian.Uint16(data[1:3])
+	a.Size = binary.BigEndian.Uint32(data[3:7])
+	if uint64(len(data)) < 8+uint64(a.Size) {
+		df.SetTruncated()
+		return fmt.Errorf("AMQP 0-9-1 frame size %d exceeds %d bytes", a.Size, len(data)-8)
+	}
+	n := 7 + int(a.Size)
+	if data[n] != 0xce {
+		return fmt.Errorf("AMQP 0-9-1 frame end %#x invalid", data[n])
+	}
+	a.BaseLayer = BaseLayer{Contents: data[:n+1], Payload: data[n+1:]}
+	body := data[7:n]
+	switch a.Type {
+	case AMQP091FrameMethod:
+		if len(body) < 4 {
+			return errors.New("AMQP 0-9-1 method frame truncated")
+		}
+		a.Method = AMQP091Method(binary.BigEndian.Uint32(body[:4]))
+		a.Arguments = body[4:]
+		if err := a.decodeArguments(); err != nil {
+			return fmt.Errorf("AMQP 0-9-1 %v arguments invalid: %v", a.Method, err)
+		}
+	case AMQP091FrameHeader:
+		if len(body) < 14 {
+			return errors.New("AMQP 0-9-1 content header truncated")
+		}
+		a.ContentClass = binary.BigEndian.Uint16(body[:2])
+		a.BodySize = binary.BigEndian.Uint64(body[4:12])
+	case AMQP091FrameBody:
+		a.Body = body
+	case AMQP091FrameHeartbeat:
+	default:
+		return fmt.Errorf("AMQP 0-9-1 frame type %d unknown", a.Type)
+	}
+	return nil
+}
+
+// amqp091Reader reads the arguments of a method.
+type amqp091Reader struct {
+	data []byte
+	err  error
+}
+
+func (r *amqp091Reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = errors.New("truncated")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *amqp091Reader) octet() uint8 {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *amqp091Reader) short() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *amqp091Reader) longlong() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *amqp091Reader) shortstr() string {
+	return string(r.next(int(r.octet())))
+}
+
+func (a *AMQP091) decodeArguments() error {
+	r := &amqp091Reader{data: a.Arguments}
+	switch a.Method {
+	case AMQP091ConnectionOpen:
+		a.VirtualHost = r.shortstr()
+	case AMQP091ConnectionClose, AMQP091ChannelClose:
+		a.ReplyCode = r.short()
+		a.ReplyText = r.shortstr()
+	case AMQP091ExchangeDeclare:
+		r.short()
+		a.Exchange = r.shortstr()
+		a.ExchangeType = r.shortstr()
+	case AMQP091QueueDeclare:
+		r.short()
+		a.Queue = r.shortstr()
+	case AMQP091QueueDeclareOk:
+		a.Queue = r.shortstr()
+	case AMQP091QueueBind:
+		r.short()
+		a.Queue = r.shortstr()
+		a.Exchange = r.shortstr()
+		a.RoutingKey = r.shortstr()
+	case AMQP091BasicConsume:
+		r.short()
+		a.Queue = r.shortstr()
+		a.ConsumerTag = r.shortstr()
+	case AMQP091BasicConsumeOk, AMQP091BasicCancel, AMQP091BasicCancelOk:
+		a.ConsumerTag = r.shortstr()
+	case AMQP091BasicPublish:
+		r.short()
+		a.Exchange = r.shortstr()
+		a.RoutingKey = r.shortstr()
+	case AMQP091BasicReturn:
+		a.ReplyCode = r.short()
+		a.ReplyText = r.shortstr()
+		a.Exchange = r.shortstr()
+		a.RoutingKey = r.shortstr()
+	case AMQP091BasicDeliver:
+		a.ConsumerTag = r.shortstr()
+		a.DeliveryTag = r.longlong()
+		a.Redelivered = r.octet()&1 != 0
+		a.Exchange = r.shortstr()
+		a.RoutingKey = r.shortstr()
+	case AMQP091BasicGet:
+		r.short()
+		a.Queue = r.shortstr()
+	case AMQP091BasicGetOk:
+		a.DeliveryTag = r.longlong()
+		a.Redelivered = r.octet()&1 != 0
+		a.Exchange = r.shortstr()
+		a.RoutingKey = r.shortstr()
+	case AMQP091BasicAck, AMQP091BasicNack:
+		a.DeliveryTag = r.longlong()
+		a.Multiple = r.octet()&1 != 0
+	case AMQP091BasicReject:
+		a.DeliveryTag = r.longlong()
+	}
+	return r.err
+}
+
+// maxAMQPFrame is the largest frame AMQPStream accepts.  Peers negotiate
+// their largest frame, which brokers such as RabbitMQ default to 128KB.
+const maxAMQPFrame = 1 << 20
+
+// AMQPStream splits one direction of a reassembled AMQP connection, of
+// either version, into its protocol header and frames, including those
+// split across TCP segments.
+type AMQPStream struct {
+	buf streamBuffer
+}
+
+// Decode appends data from the stream and returns the protocol header and
+// frames (*AMQP091 or *AMQP10) completed by it, in order.  After an error,
+// or a gap in the stream, call Reset before decoding more data.
+func (s *AMQPStream) Decode(data []byte) ([]gopacket.Layer, error) {
+	return s.buf.decode(data, "AMQP", maxAMQPFrame, amqpFrame)
+}
+
+// amqpFrame is the streamFramer of AMQPStream.
+func amqpFrame(data []byte) (int64, layerDecodingLayer, error) {
+	if len(data) < 8 {
+		return 0, nil, nil
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte("AMQP")):
+		if bytes.Equal(data[:8], amqp091ProtocolHeader) {
+			return 8, &AMQP091{}, nil
+		}
+		return 8, &AMQP10{}, nil
+	case data[0] >= byte(AMQP091FrameMethod) && data[0] <= byte(AMQP091FrameHeartbeat):
+		// AMQP 1.0 frame sizes start with zero, unless 16MB or more.
+		return 8 + int64(binary.BigEndian.Uint32(data[3:7])), &AMQP091{}, nil
+	}
+	n := int64(binary.BigEndian.Uint32(data[:4]))
+	if n < 8 {
+		return 0, nil, fmt.Errorf("AMQP frame size %d invalid", n)
+	}
+	return n, &AMQP10{}, nil
+}
+
+// Reset discards any partial frame.
+func (s *AMQPStream) Reset() {
+	s.buf.reset()
+}
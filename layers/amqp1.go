@@ -0,0 +1,503 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// AMQP10FrameType is the type of an AMQP 1.0 frame.
+type AMQP10FrameType uint8
+
+// AMQP 1.0 frame types.
+const (
+	AMQP10FrameAMQP AMQP10FrameType = 0
+	AMQP10FrameSASL AMQP10FrameType = 1
+)
+
+func (t AMQP10FrameType) String() string {
+	switch t {
+	case AMQP10FrameAMQP:
+		return "AMQP"
+	case AMQP10FrameSASL:
+		return "SASL"
+	default:
+		return fmt.Sprintf("UnknownAMQP10FrameType(%d)", t)
+	}
+}
+
+// AMQP10Performative is the descriptor code of the performative, or SASL
+// frame body, that an AMQP 1.0 frame carries.
+type AMQP10Performative uint64
+
+// AMQP 1.0 performatives and SASL frame bodies.
+const (
+	AMQP10Open           AMQP10Performative = 0x10
+	AMQP10Begin          AMQP10Performative = 0x11
+	AMQP10Attach         AMQP10Performative = 0x12
+	AMQP10Flow           AMQP10Performative = 0x13
+	AMQP10Transfer       AMQP10Performative = 0x14
+	AMQP10Disposition    AMQP10Performative = 0x15
+	AMQP10Detach         AMQP10Performative = 0x16
+	AMQP10End            AMQP10Performative = 0x17
+	AMQP10Close          AMQP10Performative = 0x18
+	AMQP10SASLMechanisms AMQP10Performative = 0x40
+	AMQP10SASLInit       AMQP10Performative = 0x41
+	AMQP10SASLChallenge  AMQP10Performative = 0x42
+	AMQP10SASLResponse   AMQP10Performative = 0x43
+	AMQP10SASLOutcome    AMQP10Performative = 0x44
+)
+
+func (p AMQP10Performative) String() string {
+	switch p {
+	case AMQP10Open:
+		return "open"
+	case AMQP10Begin:
+		return "begin"
+	case AMQP10Attach:
+		return "attach"
+	case AMQP10Flow:
+		return "flow"
+	case AMQP10Transfer:
+		return "transfer"
+	case AMQP10Disposition:
+		return "disposition"
+	case AMQP10Detach:
+		return "detach"
+	case AMQP10End:
+		return "end"
+	case AMQP10Close:
+		return "close"
+	case AMQP10SASLMechanisms:
+		return "sasl-mechanisms"
+	case AMQP10SASLInit:
+		return "sasl-init"
+	case AMQP10SASLChallenge:
+		return "sasl-challenge"
+	case AMQP10SASLResponse:
+		return "sasl-response"
+	case AMQP10SASLOutcome:
+		return "sasl-outcome"
+	default:
+		return fmt.Sprintf("UnknownAMQP10Performative(%#x)", uint64(p))
+	}
+}
+
+// AMQP10 is an AMQP 1.0 frame (OASIS AMQP 1.0 part 2), used by Azure
+// Service Bus, ActiveMQ and Qpid, or a protocol header, which starts the
+// connection and its SASL and TLS layers.
+//
+// The fields identifying the connection, its links and their transfers are
+// decoded from the performatives; frames with no body are heartbeats.  The
+// payload of transfers is the encoded message, which may continue over
+// several transfers.
+//
+// A TCP segment may hold several frames, each decoded as a layer; use
+// AMQPStream for frames split across segments.
+type AMQP10 struct {
+	BaseLayer
+	// ProtocolHeader is set if this is a protocol header rather than a
+	// frame, and ProtocolID is the protocol it starts: 0 for AMQP, 2 for
+	// TLS and 3 for SASL.
+	ProtocolHeader bool
+	ProtocolID     uint8
+	Size           uint32
+	DataOffset     uint8
+	Type           AMQP10FrameType
+	Channel        uint16
+	Performative   AMQP10Performative
+
+	// ContainerID and Hostname are set for open, and RemoteChannel for
+	// begin, if set by the sender.
+	ContainerID   string
+	Hostname      string
+	RemoteChannel uint16
+	// LinkName, Receiver, Source and Target are set for attach.  Source
+	// and Target are the node addresses of the terminus.
+	LinkName string
+	Receiver bool
+	Source   string
+	Target   string
+	// Handle is the link of attach, flow, transfer and detach.
+	Handle uint32
+	// DeliveryID and DeliveryTag are set for the first transfer of a
+	// delivery, and More if further transfers continue the message.
+	DeliveryID  uint32
+	DeliveryTag []byte
+	More        bool
+	// ErrorCondition and ErrorDescription are the error of detach, end and
+	// close, if any.
+	ErrorCondition   string
+	ErrorDescription string
+	// Mechanisms are offered by sasl-mechanisms; Mechanism is chosen by
+	// sasl-init, whose Hostname is also set.  SASLCode is the outcome of
+	// sasl-outcome: 0 for success.
+	Mechanisms []string
+	Mechanism  string
+	SASLCode   uint8
+
+	// Body is the encoded performative, with its fields.
+	Body []byte
+	// Message is the payload of a transfer.
+	Message []byte
+}
+
+// LayerType returns LayerTypeAMQP10.
+func (a *AMQP10) LayerType() gopacket.LayerType { return LayerTypeAMQP10 }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (a *AMQP10) CanDecode() gopacket.LayerClass { return LayerTypeAMQP10 }
+
+// NextLayerType returns the layer type of the frame following this one,
+// if it's complete, and otherwise LayerTypePayload.
+func (a *AMQP10) NextLayerType() gopacket.LayerType {
+	return amqpNextLayerType(a.BaseLayer.Payload)
+}
+
+// Payload returns nil, since the frame's body is part of the layer.
+func (a *AMQP10) Payload() []byte { return nil }
+
+// isAMQP10 returns true if data starts with an AMQP 1.0 protocol header or
+// a complete frame.
+func isAMQP10(data []byte) bool {
+	return isAMQP10ProtocolHeader(data) || isAMQP10Frame(data)
+}
+
+// isAMQP10ProtocolHeader returns true if data starts with an AMQP 1.0
+// protocol header, for AMQP, TLS or SASL.
+func isAMQP10ProtocolHeader(data []byte) bool {
+	return len(data) >= 8 && bytes.HasPrefix(data, []byte("AMQP")) &&
+		(data[4] == 0 || data[4] == 2 || data[4] == 3) && bytes.Equal(data[5:8], []byte{1, 0, 0})
+}
+
+// isAMQP10Frame returns true if data starts with a complete AMQP 1.0
+// frame.
+func isAMQP10Frame(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	size := binary.BigEndian.Uint32(data[:4])
+	return size >= 8 && uint64(size) <= uint64(len(data)) && data[4] >= 2 &&
+		uint32(data[4])*4 <= size && data[5] <= byte(AMQP10FrameSASL)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (a *AMQP10) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	*a = AMQP10{}
+	if isAMQP10ProtocolHeader(data) {
+		a.ProtocolHeader, a.ProtocolID = true, data[4]
+		a.BaseLayer = BaseLayer{Contents: data[:8], Payload: data[8:]}
+		return nil
+	}
+	if len(data) < 8 {
+		df.SetTruncated()
+		return errors.New("AMQP 1.0 frame header truncated")
+	}
+	a.Size = binary.BigEndian.Uint32(data[:4])
+	a.DataOffset = data[4]
+	a.Type = AMQP10FrameType(data[5])
+	a.Channel = binary.BigEndian.Uint16(data[6:8])
+	if a.Size < 8 || a.DataOffset < 2 || uint32(a.DataOffset)*4 > a.Size {
+		return fmt.Errorf("AMQP 1.0 frame size %d or data offset %d invalid", a.Size, a.DataOffset)
+	}
+	if uint64(a.Size) > uint64(len(data)) {
+		df.SetTruncated()
+		return fmt.Errorf("AMQP 1.0 frame size %d exceeds %d bytes", a.Size, len(data))
+	}
+	if a.Type > AMQP10FrameSASL {
+		return fmt.Errorf("AMQP 1.0 frame type %d unknown", a.Type)
+	}
+	a.BaseLayer = BaseLayer{Contents: data[:a.Size], Payload: data[a.Size:]}
+	body := data[4*int(a.DataOffset) : a.Size]
+	if len(body) == 0 {
+		// An empty frame keeps the connection alive.
+		return nil
+	}
+	v, rest, err := readAMQPValue(body)
+	if err != nil {
+		return fmt.Errorf("AMQP 1.0 frame body invalid: %v", err)
+	}
+	a.Body = body[:len(body)-len(rest)]
+	code, ok := v.descriptorCode()
+	if !ok {
+		return errors.New("AMQP 1.0 frame body isn't a described performative")
+	}
+	a.Performative = AMQP10Performative(code)
+	if a.Performative == AMQP10Transfer {
+		a.Message = rest
+	}
+	fields, err := v.list()
+	if err != nil {
+		return fmt.Errorf("AMQP 1.0 %v fields invalid: %v", a.Performative, err)
+	}
+	a.decodeFields(fields)
+	return nil
+}
+
+// decodeFields sets the fields of a from the performative's.  Fields that
+// are absent, null or of the wrong type are left unset.
+func (a *AMQP10) decodeFields(f amqpFields) {
+	switch a.Performative {
+	case AMQP10Open:
+		a.ContainerID = f.str(0)
+		a.Hostname = f.str(1)
+	case AMQP10Begin:
+		a.RemoteChannel = uint16(f.uint(0))
+	case AMQP10Attach:
+		a.LinkName = f.str(0)
+		a.Handle = uint32(f.uint(1))
+		a.Receiver = f.bool(2)
+		a.Source = f.terminusAddress(5)
+		a.Target = f.terminusAddress(6)
+	case AMQP10Flow:
+		a.Handle = uint32(f.uint(4))
+	case AMQP10Transfer:
+		a.Handle = uint32(f.uint(0))
+		a.DeliveryID = uint32(f.uint(1))
+		a.DeliveryTag = f.bytes(2)
+		a.More = f.bool(5)
+	case AMQP10Detach:
+		a.Handle = uint32(f.uint(0))
+		a.decodeError(f.field(2))
+	case AMQP10End, AMQP10Close:
+		a.decodeError(f.field(0))
+	case AMQP10SASLMechanisms:
+		a.Mechanisms = f.field(0).symbols()
+	case AMQP10SASLInit:
+		a.Mechanism = f.str(0)
+		a.Hostname = f.str(2)
+	case AMQP10SASLOutcome:
+		a.SASLCode = uint8(f.uint(0))
+	}
+}
+
+// decodeError sets the error condition and description from an error
+// field.
+func (a *AMQP10) decodeError(v amqpValue) {
+	if fields, err := v.list(); err == nil {
+		a.ErrorCondition = fields.str(0)
+		a.ErrorDescription = fields.str(1)
+	}
+}
+
+// amqpValue is a value in the AMQP 1.0 type system (OASIS AMQP 1.0 part
+// 1).  data is the encoded value after the constructor, and for compound
+// types and arrays includes the element count.
+type amqpValue struct {
+	descriptor *amqpValue
+	code       byte
+	data       []byte
+}
+
+// readAMQPValue reads the value at the start of data, and returns it and
+// the rest of data.
+func readAMQPValue(data []byte) (amqpValue, []byte, error) {
+	var v amqpValue
+	if len(data) == 0 {
+		return v, nil, errors.New("value truncated")
+	}
+	if data[0] == 0x00 {
+		// A described type: the descriptor, then the value.
+		d, rest, err := readAMQPValue(data[1:])
+		if err != nil {
+			return v, nil, err
+		}
+		if d.descriptor != nil {
+			return v, nil, errors.New("descriptor is itself described")
+		}
+		if v, rest, err = readAMQPValue(rest); err != nil {
+			return v, nil, err
+		}
+		v.descriptor = &d
+		return v, rest, nil
+	}
+	v.code, data = data[0], data[1:]
+	var n int
+	switch v.code >> 4 {
+	case 0x4:
+		n = 0
+	case 0x5:
+		n = 1
+	case 0x6:
+		n = 2
+	case 0x7:
+		n = 4
+	case 0x8:
+		n = 8
+	case 0x9:
+		n = 16
+	case 0xa, 0xc, 0xe:
+		if len(data) < 1 {
+			return v, nil, errors.New("value size truncated")
+		}
+		n, data = int(data[0]), data[1:]
+	case 0xb, 0xd, 0xf:
+		if len(data) < 4 {
+			return v, nil, errors.New("value size truncated")
+		}
+		size := binary.BigEndian.Uint32(data[:4])
+		if uint64(size) > uint64(len(data)-4) {
+			return v, nil, fmt.Errorf("value size %d exceeds %d bytes", size, len(data)-4)
+		}
+		n, data = int(size), data[4:]
+	default:
+		return v, nil, fmt.Errorf("constructor %#x unknown", v.code)
+	}
+	if len(data) < n {
+		return v, nil, fmt.Errorf("value of %d bytes truncated", n)
+	}
+	v.data = data[:n]
+	return v, data[n:], nil
+}
+
+// descriptorCode returns the numeric descriptor of a described value.
+func (v amqpValue) descriptorCode() (uint64, bool) {
+	if v.descriptor == nil {
+		return 0, false
+	}
+	return v.descriptor.uint()
+}
+
+func (v amqpValue) uint() (uint64, bool) {
+	switch v.code {
+	case 0x43, 0x44:
+		return 0, true
+	case 0x50, 0x52, 0x53, 0x60, 0x70, 0x80:
+		var n uint64
+		for _, b := range v.data {
+			n = n<<8 | uint64(b)
+		}
+		return n, true
+	}
+	return 0, false
+}
+
+func (v amqpValue) bytes() ([]byte, bool) {
+	switch v.code {
+	case 0xa0, 0xa1, 0xa3, 0xb0, 0xb1, 0xb3:
+		return v.data, true
+	}
+	return nil, false
+}
+
+// symbols returns the symbols of a symbol or an array of symbols.
+func (v amqpValue) symbols() []string {
+	switch v.code {
+	case 0xa3, 0xb3:
+		return []string{string(v.data)}
+	case 0xe0, 0xf0:
+	default:
+		return nil
+	}
+	var count int
+	d := v.data
+	if v.code == 0xe0 && len(d) >= 2 {
+		count, d = int(d[0]), d[1:]
+	} else if v.code == 0xf0 && len(d) >= 5 {
+		count, d = int(binary.BigEndian.Uint32(d[:4])), d[4:]
+	} else {
+		return nil
+	}
+	// Elements share the constructor that follows the count.
+	elem, d := d[0], d[1:]
+	var out []string
+	for i := 0; i < count; i++ {
+		var n int
+		switch {
+		case elem == 0xa3 && len(d) >= 1:
+			n, d = int(d[0]), d[1:]
+		case elem == 0xb3 && len(d) >= 4:
+			n, d = int(binary.BigEndian.Uint32(d[:4])), d[4:]
+		default:
+			return out
+		}
+		if n > len(d) {
+			return out
+		}
+		out = append(out, string(d[:n]))
+		d = d[n:]
+	}
+	return out
+}
+
+// amqpFields are the elements of a list, such as a performative's fields.
+type amqpFields []amqpValue
+
+// list returns the elements of a list.
+func (v amqpValue) list() (amqpFields, error) {
+	var count int
+	d := v.data
+	switch v.code {
+	case 0x45:
+		return nil, nil
+	case 0xc0:
+		if len(d) < 1 {
+			return nil, errors.New("list count truncated")
+		}
+		count, d = int(d[0]), d[1:]
+	case 0xd0:
+		if len(d) < 4 {
+			return nil, errors.New("list count truncated")
+		}
+		count, d = int(binary.BigEndian.Uint32(d[:4])), d[4:]
+	default:
+		return nil, fmt.Errorf("constructor %#x isn't a list", v.code)
+	}
+	var out amqpFields
+	for i := 0; i < count; i++ {
+		e, rest, err := readAMQPValue(d)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+		d = rest
+	}
+	return out, nil
+}
+
+// field returns the i'th field, or a null value if there are fewer.
+func (f amqpFields) field(i int) amqpValue {
+	if i < len(f) {
+		return f[i]
+	}
+	return amqpValue{code: 0x40}
+}
+
+func (f amqpFields) uint(i int) uint64 {
+	n, _ := f.field(i).uint()
+	return n
+}
+
+func (f amqpFields) str(i int) string {
+	b, _ := f.field(i).bytes()
+	return string(b)
+}
+
+func (f amqpFields) bytes(i int) []byte {
+	b, _ := f.field(i).bytes()
+	return b
+}
+
+func (f amqpFields) bool(i int) bool {
+	v := f.field(i)
+	return v.code == 0x41 || v.code == 0x56 && len(v.data) == 1 && v.data[0] != 0
+}
+
+// terminusAddress returns the address of the source or target in the i'th
+// field.
+func (f amqpFields) terminusAddress(i int) string {
+	t, err := f.field(i).list()
+	if err != nil {
+		return ""
+	}
+	return t.str(0)
+}
@@ -0,0 +1,293 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func testAMQP091Frame(typ AMQP091FrameType, channel uint16, payload ...byte) []byte {
+	b := []byte{byte(typ), byte(channel >> 8), byte(channel), 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[3:], uint32(len(payload)))
+	return append(append(b, payload...), 0xce)
+}
+
+func testAMQP10Frame(typ AMQP10FrameType, channel uint16, body ...byte) []byte {
+	b := []byte{0, 0, 0, 0, 2, byte(typ), byte(channel >> 8), byte(channel)}
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	return append(b, body...)
+}
+
+// testAMQP10Described encodes a value described by a small ulong code.
+func testAMQP10Described(code byte, v []byte) []byte {
+	return append([]byte{0x00, 0x53, code}, v...)
+}
+
+func testAMQP10List(elems ...[]byte) []byte {
+	b := []byte{0xc0, 0, byte(len(elems))}
+	for _, e := range elems {
+		b = append(b, e...)
+	}
+	b[1] = byte(len(b) - 2)
+	return b
+}
+
+func testAMQP10String(code byte, s string) []byte {
+	return append([]byte{code, byte(len(s))}, s...)
+}
+
+func testAMQPPacket(t *testing.T, srcPort, dstPort TCPPort, payload []byte) gopacket.Packet {
+	setTCPPortLayerType(t, 5672, LayerTypeAMQP091)
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolTCP, SrcIP: net.IP{10, 0, 0, 2}, DstIP: net.IP{10, 0, 0, 9}}
+	tcp := &TCP{SrcPort: srcPort, DstPort: dstPort, PSH: true, ACK: true, Window: 1024}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, tcp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	return p
+}
+
+// testAMQP091Publish is a client opening a connection to the "/" virtual
+// host, and publishing "hello" to the logs exchange.
+var testAMQP091Publish = bytes.Join([][]byte{
+	[]byte("AMQP\x00\x00\x09\x01"),
+	testAMQP091Frame(AMQP091FrameMethod, 0, 0x00, 0x0a, 0x00, 0x28, 1, '/', 0, 0),
+	testAMQP091Frame(AMQP091FrameMethod, 1, 0x00, 0x3c, 0x00, 0x28, 0, 0,
+		4, 'l', 'o', 'g', 's', 8, 'a', 'p', 'p', '.', 'i', 'n', 'f', 'o', 0),
+	testAMQP091Frame(AMQP091FrameHeader, 1, 0x00, 0x3c, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5, 0, 0),
+	testAMQP091Frame(AMQP091FrameBody, 1, 'h', 'e', 'l', 'l', 'o'),
+}, nil)
+
+// testAMQP091Deliver is the broker delivering the message to a consumer,
+// then a heartbeat, and the consumer's acknowledgement.
+var testAMQP091Deliver = bytes.Join([][]byte{
+	testAMQP091Frame(AMQP091FrameMethod, 1, 0x00, 0x3c, 0x00, 0x3c,
+		6, 'c', 't', 'a', 'g', '-', '1', 0, 0, 0, 0, 0, 0, 0, 7, 1,
+		4, 'l', 'o', 'g', 's', 8, 'a', 'p', 'p', '.', 'i', 'n', 'f', 'o'),
+	testAMQP091Frame(AMQP091FrameHeartbeat, 0),
+	testAMQP091Frame(AMQP091FrameMethod, 1, 0x00, 0x3c, 0x00, 0x50, 0, 0, 0, 0, 0, 0, 0, 7, 0),
+}, nil)
+
+func TestAMQP091Publish(t *testing.T) {
+	p := testAMQPPacket(t, 40000, 5672, testAMQP091Publish)
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeTCP,
+		LayerTypeAMQP091, LayerTypeAMQP091, LayerTypeAMQP091, LayerTypeAMQP091, LayerTypeAMQP091}, t)
+	var frames []*AMQP091
+	for _, l := range p.Layers() {
+		if a, ok := l.(*AMQP091); ok {
+			frames = append(frames, a)
+		}
+	}
+	if !frames[0].ProtocolHeader {
+		t.Errorf("got first frame %+v, want protocol header", frames[0])
+	}
+	if f := frames[1]; f.Type != AMQP091FrameMethod || f.Method != AMQP091ConnectionOpen || f.Channel != 0 || f.VirtualHost != "/" {
+		t.Errorf("got connection.open %+v", f)
+	}
+	if f := frames[2]; f.Method != AMQP091BasicPublish || f.Channel != 1 || f.Exchange != "logs" || f.RoutingKey != "app.info" {
+		t.Errorf("got basic.publish %+v", f)
+	}
+	if got := frames[2].Method.String(); got != "basic.publish" {
+		t.Errorf("got method %q", got)
+	}
+	if f := frames[3]; f.Type != AMQP091FrameHeader || f.ContentClass != 60 || f.BodySize != 5 {
+		t.Errorf("got content header %+v", f)
+	}
+	if f := frames[4]; f.Type != AMQP091FrameBody || string(f.Body) != "hello" {
+		t.Errorf("got body %+v", f)
+	}
+	if app := p.ApplicationLayer(); app == nil || app.LayerType() != LayerTypeAMQP091 {
+		t.Errorf("got application layer %v", app)
+	}
+}
+
+func TestAMQP091Stream(t *testing.T) {
+	var s AMQPStream
+	var frames []gopacket.Layer
+	// Split inside the frame header, then inside the delivery tag.
+	for _, seg := range [][]byte{testAMQP091Deliver[:3], testAMQP091Deliver[3:20], testAMQP091Deliver[20:]} {
+		out, err := s.Decode(seg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, out...)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 3", len(frames))
+	}
+	d := frames[0].(*AMQP091)
+	want := &AMQP091{Type: AMQP091FrameMethod, Channel: 1, Size: 34, Method: AMQP091BasicDeliver,
+		ConsumerTag: "ctag-1", DeliveryTag: 7, Redelivered: true, Exchange: "logs", RoutingKey: "app.info"}
+	want.BaseLayer, want.Arguments = d.BaseLayer, d.Arguments
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("got basic.deliver\n%+v\nwant\n%+v", d, want)
+	}
+	if h := frames[1].(*AMQP091); h.Type != AMQP091FrameHeartbeat || h.Size != 0 {
+		t.Errorf("got heartbeat %+v", h)
+	}
+	if a := frames[2].(*AMQP091); a.Method != AMQP091BasicAck || a.DeliveryTag != 7 || a.Multiple {
+		t.Errorf("got basic.ack %+v", a)
+	}
+}
+
+// testAMQP10Client is a client negotiating SASL ANONYMOUS, opening a
+// connection and session, attaching a sending link to the orders queue
+// and transferring a message on it.
+var testAMQP10Client = bytes.Join([][]byte{
+	[]byte("AMQP\x03\x01\x00\x00"),
+	testAMQP10Frame(AMQP10FrameSASL, 0, testAMQP10Described(0x41, testAMQP10List(
+		testAMQP10String(0xa3, "ANONYMOUS"), []byte{0x40}, testAMQP10String(0xa1, "example.com")))...),
+	[]byte("AMQP\x00\x01\x00\x00"),
+	testAMQP10Frame(AMQP10FrameAMQP, 0, testAMQP10Described(0x10, testAMQP10List(
+		testAMQP10String(0xa1, "client-1"), testAMQP10String(0xa1, "example.com")))...),
+	testAMQP10Frame(AMQP10FrameAMQP, 0, testAMQP10Described(0x11, testAMQP10List(
+		[]byte{0x40}, []byte{0x52, 0x01}, []byte{0x70, 0, 0, 8, 0}, []byte{0x70, 0, 0, 8, 0}))...),
+	testAMQP10Frame(AMQP10FrameAMQP, 0, testAMQP10Described(0x12, testAMQP10List(
+		testAMQP10String(0xa1, "sender-1"), []byte{0x52, 0x03}, []byte{0x42}, []byte{0x40}, []byte{0x40},
+		testAMQP10Described(0x28, testAMQP10List(testAMQP10String(0xa1, "client-1"))),
+		testAMQP10Described(0x29, testAMQP10List(testAMQP10String(0xa1, "orders")))))...),
+	testAMQP10Frame(AMQP10FrameAMQP, 0, append(testAMQP10Described(0x14, testAMQP10List(
+		[]byte{0x52, 0x03}, []byte{0x43}, []byte{0xa0, 0x01, 0x2a}, []byte{0x43}, []byte{0x41})),
+		testAMQP10Described(0x77, testAMQP10String(0xa1, "hello"))...)...),
+	{0, 0, 0, 8, 2, 0, 0, 0},
+}, nil)
+
+// testAMQP10Server is the broker offering SASL mechanisms, accepting, and
+// closing the connection with an error.
+var testAMQP10Server = bytes.Join([][]byte{
+	[]byte("AMQP\x03\x01\x00\x00"),
+	testAMQP10Frame(AMQP10FrameSASL, 0, testAMQP10Described(0x40, testAMQP10List(
+		[]byte{0xe0, 0x12, 0x02, 0xa3, 5, 'P', 'L', 'A', 'I', 'N', 9, 'A', 'N', 'O', 'N', 'Y', 'M', 'O', 'U', 'S'}))...),
+	testAMQP10Frame(AMQP10FrameSASL, 0, testAMQP10Described(0x44, testAMQP10List([]byte{0x50, 0x00}))...),
+	[]byte("AMQP\x00\x01\x00\x00"),
+	testAMQP10Frame(AMQP10FrameAMQP, 0, testAMQP10Described(0x18, testAMQP10List(
+		testAMQP10Described(0x1d, testAMQP10List(
+			testAMQP10String(0xa3, "amqp:internal-error"), testAMQP10String(0xa1, "boom")))))...),
+}, nil)
+
+func TestAMQP10Client(t *testing.T) {
+	p := testAMQPPacket(t, 40000, 5672, testAMQP10Client)
+	var frames []*AMQP10
+	for _, l := range p.Layers() {
+		if a, ok := l.(*AMQP10); ok {
+			frames = append(frames, a)
+		}
+	}
+	if len(frames) != 8 {
+		t.Fatalf("got %d AMQP 1.0 layers, want 8: %v", len(frames), p)
+	}
+	if f := frames[0]; !f.ProtocolHeader || f.ProtocolID != 3 {
+		t.Errorf("got SASL header %+v", f)
+	}
+	if f := frames[1]; f.Type != AMQP10FrameSASL || f.Performative != AMQP10SASLInit || f.Mechanism != "ANONYMOUS" || f.Hostname != "example.com" {
+		t.Errorf("got sasl-init %+v", f)
+	}
+	if f := frames[2]; !f.ProtocolHeader || f.ProtocolID != 0 {
+		t.Errorf("got AMQP header %+v", f)
+	}
+	if f := frames[3]; f.Performative != AMQP10Open || f.ContainerID != "client-1" || f.Hostname != "example.com" {
+		t.Errorf("got open %+v", f)
+	}
+	if f := frames[4]; f.Performative != AMQP10Begin || f.RemoteChannel != 0 {
+		t.Errorf("got begin %+v", f)
+	}
+	if f := frames[5]; f.Performative != AMQP10Attach || f.LinkName != "sender-1" || f.Handle != 3 || f.Receiver || f.Source != "client-1" || f.Target != "orders" {
+		t.Errorf("got attach %+v", f)
+	}
+	if f := frames[6]; f.Performative != AMQP10Transfer || f.Handle != 3 || f.DeliveryID != 0 || !bytes.Equal(f.DeliveryTag, []byte{0x2a}) || f.More {
+		t.Errorf("got transfer %+v", f)
+	}
+	if want := testAMQP10Described(0x77, testAMQP10String(0xa1, "hello")); !bytes.Equal(frames[6].Message, want) {
+		t.Errorf("got message %x, want %x", frames[6].Message, want)
+	}
+	if f := frames[7]; f.Size != 8 || f.Body != nil || f.Performative != 0 {
+		t.Errorf("got heartbeat %+v", f)
+	}
+	if got := frames[5].Performative.String(); got != "attach" {
+		t.Errorf("got performative %q", got)
+	}
+}
+
+func TestAMQP10Stream(t *testing.T) {
+	var s AMQPStream
+	var frames []gopacket.Layer
+	for i := 0; i < len(testAMQP10Server); i += 7 {
+		end := i + 7
+		if end > len(testAMQP10Server) {
+			end = len(testAMQP10Server)
+		}
+		out, err := s.Decode(testAMQP10Server[i:end])
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, out...)
+	}
+	if len(frames) != 5 {
+		t.Fatalf("got %d frames, want 5", len(frames))
+	}
+	if f := frames[1].(*AMQP10); f.Performative != AMQP10SASLMechanisms || !reflect.DeepEqual(f.Mechanisms, []string{"PLAIN", "ANONYMOUS"}) {
+		t.Errorf("got sasl-mechanisms %+v", f)
+	}
+	if f := frames[2].(*AMQP10); f.Performative != AMQP10SASLOutcome || f.SASLCode != 0 {
+		t.Errorf("got sasl-outcome %+v", f)
+	}
+	if f := frames[4].(*AMQP10); f.Performative != AMQP10Close || f.ErrorCondition != "amqp:internal-error" || f.ErrorDescription != "boom" {
+		t.Errorf("got close %+v", f)
+	}
+}
+
+func TestAMQPMalformed(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"091 frame end", append(testAMQP091Frame(AMQP091FrameBody, 1, 'x')[:8], 0x00)},
+		{"091 truncated arguments", testAMQP091Frame(AMQP091FrameMethod, 1, 0x00, 0x3c, 0x00, 0x28, 0, 0, 9, 'l')},
+		{"091 truncated header", testAMQP091Frame(AMQP091FrameHeader, 1, 0x00, 0x3c, 0, 0)},
+		{"10 data offset", []byte{0, 0, 0, 8, 3, 0, 0, 0}},
+		{"10 undescribed body", testAMQP10Frame(AMQP10FrameAMQP, 0, testAMQP10List()...)},
+		{"10 truncated list", testAMQP10Frame(AMQP10FrameAMQP, 0, 0x00, 0x53, 0x10, 0xc0, 0x05, 0x02, 0xa1, 0x09, 'x')},
+		{"10 unknown constructor", testAMQP10Frame(AMQP10FrameAMQP, 0, 0x00, 0x53, 0x10, 0x3f)},
+	} {
+		var l gopacket.DecodingLayer = &AMQP091{}
+		if c.name[:2] == "10" {
+			l = &AMQP10{}
+		}
+		if err := l.DecodeFromBytes(c.data, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("%s: decoded %x without error", c.name, c.data)
+		}
+	}
+
+	// A segment starting inside a frame is left as payload.
+	p := testAMQPPacket(t, 5672, 40000, testAMQP091Deliver[5:])
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeTCP, gopacket.LayerTypePayload}, t)
+
+	// A partial frame after a complete one is left as payload too.
+	p = testAMQPPacket(t, 5672, 40000, testAMQP091Deliver[:45])
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeTCP, LayerTypeAMQP091, gopacket.LayerTypePayload}, t)
+
+	var s AMQPStream
+	if _, err := s.Decode([]byte{0, 0, 0, 4, 2, 0, 0, 0}); err == nil {
+		t.Error("stream decoded a frame size of 4 without error")
+	}
+	s.Reset()
+	if _, err := s.Decode([]byte{1, 0, 1, 0xff, 0xff, 0xff, 0xff, 0}); err == nil {
+		t.Error("stream buffered a 4GB frame without error")
+	}
+}
@@ -0,0 +1,815 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/mistsys/gopacket"
+)
+
+// bgpHeaderLength is the length of the marker, length and type fields that
+// start every BGP message.
+const bgpHeaderLength = 19
+
+var bgpMarker = bytes.Repeat([]byte{0xff}, 16)
+
+// BGPType is the type of a BGP message.
+type BGPType uint8
+
+const (
+	BGPTypeOpen         BGPType = 1
+	BGPTypeUpdate       BGPType = 2
+	BGPTypeNotification BGPType = 3
+	BGPTypeKeepalive    BGPType = 4
+	BGPTypeRouteRefresh BGPType = 5
+)
+
+func (t BGPType) String() string {
+	switch t {
+	case BGPTypeOpen:
+		return "Open"
+	case BGPTypeUpdate:
+		return "Update"
+	case BGPTypeNotification:
+		return "Notification"
+	case BGPTypeKeepalive:
+		return "Keepalive"
+	case BGPTypeRouteRefresh:
+		return "RouteRefresh"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(t))
+}
+
+// BGPAFI is a BGP address family identifier.
+type BGPAFI uint16
+
+const (
+	BGPAFIIPv4  BGPAFI = 1
+	BGPAFIIPv6  BGPAFI = 2
+	BGPAFIL2VPN BGPAFI = 25
+)
+
+func (a BGPAFI) String() string {
+	switch a {
+	case BGPAFIIPv4:
+		return "IPv4"
+	case BGPAFIIPv6:
+		return "IPv6"
+	case BGPAFIL2VPN:
+		return "L2VPN"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint16(a))
+}
+
+// BGPSAFI is a BGP subsequent address family identifier.
+type BGPSAFI uint8
+
+const (
+	BGPSAFIUnicast   BGPSAFI = 1
+	BGPSAFIMulticast BGPSAFI = 2
+	BGPSAFILabeled   BGPSAFI = 4
+	BGPSAFIEVPN      BGPSAFI = 70
+	BGPSAFIVPN       BGPSAFI = 128
+	BGPSAFIFlowSpec  BGPSAFI = 133
+)
+
+func (s BGPSAFI) String() string {
+	switch s {
+	case BGPSAFIUnicast:
+		return "Unicast"
+	case BGPSAFIMulticast:
+		return "Multicast"
+	case BGPSAFILabeled:
+		return "Labeled"
+	case BGPSAFIEVPN:
+		return "EVPN"
+	case BGPSAFIVPN:
+		return "VPN"
+	case BGPSAFIFlowSpec:
+		return "FlowSpec"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(s))
+}
+
+// BGP is a single BGP message.  Exactly one of Open, Update, Notification
+// and RouteRefresh is set, according to Type; keepalives have no body.
+// Messages following this one in the same TCP segment are decoded as
+// further BGP layers.
+type BGP struct {
+	BaseLayer
+	Length       uint16
+	Type         BGPType
+	Open         *BGPOpen
+	Update       *BGPUpdate
+	Notification *BGPNotification
+	RouteRefresh *BGPRouteRefresh
+}
+
+// BGPCapabilityCode is the code of a capability advertised in an OPEN
+// message.
+type BGPCapabilityCode uint8
+
+const (
+	BGPCapabilityMultiprotocol        BGPCapabilityCode = 1
+	BGPCapabilityRouteRefresh         BGPCapabilityCode = 2
+	BGPCapabilityExtendedNextHop      BGPCapabilityCode = 5
+	BGPCapabilityExtendedMessage      BGPCapabilityCode = 6
+	BGPCapabilityGracefulRestart      BGPCapabilityCode = 64
+	BGPCapabilityFourOctetAS          BGPCapabilityCode = 65
+	BGPCapabilityAddPath              BGPCapabilityCode = 69
+	BGPCapabilityEnhancedRouteRefresh BGPCapabilityCode = 70
+)
+
+func (c BGPCapabilityCode) String() string {
+	switch c {
+	case BGPCapabilityMultiprotocol:
+		return "Multiprotocol"
+	case BGPCapabilityRouteRefresh:
+		return "RouteRefresh"
+	case BGPCapabilityExtendedNextHop:
+		return "ExtendedNextHop"
+	case BGPCapabilityExtendedMessage:
+		return "ExtendedMessage"
+	case BGPCapabilityGracefulRestart:
+		return "GracefulRestart"
+	case BGPCapabilityFourOctetAS:
+		return "FourOctetAS"
+	case BGPCapabilityAddPath:
+		return "AddPath"
+	case BGPCapabilityEnhancedRouteRefresh:
+		return "EnhancedRouteRefresh"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(c))
+}
+
+// BGPCapability is a capability advertised in an OPEN message.
+type BGPCapability struct {
+	Code BGPCapabilityCode
+	Data []byte
+}
+
+// BGPOptionalParameter is an optional parameter of an OPEN message other
+// than capabilities, which are decoded into BGPOpen.Capabilities.
+type BGPOptionalParameter struct {
+	Type uint8
+	Data []byte
+}
+
+// BGPOpen is the body of an OPEN message.
+type BGPOpen struct {
+	Version    uint8
+	MyAS       uint16
+	HoldTime   uint16
+	Identifier net.IP
+	// Capabilities are gathered from all capabilities optional parameters.
+	Capabilities []BGPCapability
+	Parameters   []BGPOptionalParameter
+}
+
+// BGPPathAttributeType is the type code of a path attribute.
+type BGPPathAttributeType uint8
+
+const (
+	BGPAttrOrigin              BGPPathAttributeType = 1
+	BGPAttrASPath              BGPPathAttributeType = 2
+	BGPAttrNextHop             BGPPathAttributeType = 3
+	BGPAttrMultiExitDisc       BGPPathAttributeType = 4
+	BGPAttrLocalPref           BGPPathAttributeType = 5
+	BGPAttrAtomicAggregate     BGPPathAttributeType = 6
+	BGPAttrAggregator          BGPPathAttributeType = 7
+	BGPAttrCommunities         BGPPathAttributeType = 8
+	BGPAttrOriginatorID        BGPPathAttributeType = 9
+	BGPAttrClusterList         BGPPathAttributeType = 10
+	BGPAttrMPReachNLRI         BGPPathAttributeType = 14
+	BGPAttrMPUnreachNLRI       BGPPathAttributeType = 15
+	BGPAttrExtendedCommunities BGPPathAttributeType = 16
+	BGPAttrAS4Path             BGPPathAttributeType = 17
+	BGPAttrAS4Aggregator       BGPPathAttributeType = 18
+	BGPAttrLargeCommunities    BGPPathAttributeType = 32
+)
+
+func (t BGPPathAttributeType) String() string {
+	switch t {
+	case BGPAttrOrigin:
+		return "Origin"
+	case BGPAttrASPath:
+		return "ASPath"
+	case BGPAttrNextHop:
+		return "NextHop"
+	case BGPAttrMultiExitDisc:
+		return "MultiExitDisc"
+	case BGPAttrLocalPref:
+		return "LocalPref"
+	case BGPAttrAtomicAggregate:
+		return "AtomicAggregate"
+	case BGPAttrAggregator:
+		return "Aggregator"
+	case BGPAttrCommunities:
+		return "Communities"
+	case BGPAttrOriginatorID:
+		return "OriginatorID"
+	case BGPAttrClusterList:
+		return "ClusterList"
+	case BGPAttrMPReachNLRI:
+		return "MPReachNLRI"
+	case BGPAttrMPUnreachNLRI:
+		return "MPUnreachNLRI"
+	case BGPAttrExtendedCommunities:
+		return "ExtendedCommunities"
+	case BGPAttrAS4Path:
+		return "AS4Path"
+	case BGPAttrAS4Aggregator:
+		return "AS4Aggregator"
+	case BGPAttrLargeCommunities:
+		return "LargeCommunities"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(t))
+}
+
+// Path attribute flags.
+const (
+	BGPAttrFlagOptional       = 0x80
+	BGPAttrFlagTransitive     = 0x40
+	BGPAttrFlagPartial        = 0x20
+	BGPAttrFlagExtendedLength = 0x10
+)
+
+// BGPPathAttribute is a path attribute of an UPDATE message.  Decode its
+// value with the method for its type.
+type BGPPathAttribute struct {
+	Flags uint8
+	Type  BGPPathAttributeType
+	Data  []byte
+}
+
+// BGPUpdate is the body of an UPDATE message.  WithdrawnRoutes and NLRI are
+// the IPv4 unicast routes withdrawn and advertised; routes of other
+// families are carried in the MP_REACH_NLRI and MP_UNREACH_NLRI
+// attributes.
+type BGPUpdate struct {
+	WithdrawnRoutes []net.IPNet
+	PathAttributes  []BGPPathAttribute
+	NLRI            []net.IPNet
+}
+
+// BGPErrorCode is the error code of a NOTIFICATION message.
+type BGPErrorCode uint8
+
+const (
+	BGPErrorMessageHeader      BGPErrorCode = 1
+	BGPErrorOpenMessage        BGPErrorCode = 2
+	BGPErrorUpdateMessage      BGPErrorCode = 3
+	BGPErrorHoldTimeExpired    BGPErrorCode = 4
+	BGPErrorFiniteStateMachine BGPErrorCode = 5
+	BGPErrorCease              BGPErrorCode = 6
+	BGPErrorRouteRefresh       BGPErrorCode = 7
+)
+
+func (c BGPErrorCode) String() string {
+	switch c {
+	case BGPErrorMessageHeader:
+		return "MessageHeader"
+	case BGPErrorOpenMessage:
+		return "OpenMessage"
+	case BGPErrorUpdateMessage:
+		return "UpdateMessage"
+	case BGPErrorHoldTimeExpired:
+		return "HoldTimeExpired"
+	case BGPErrorFiniteStateMachine:
+		return "FiniteStateMachine"
+	case BGPErrorCease:
+		return "Cease"
+	case BGPErrorRouteRefresh:
+		return "RouteRefresh"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(c))
+}
+
+// BGPNotification is the body of a NOTIFICATION message.
+type BGPNotification struct {
+	Code    BGPErrorCode
+	Subcode uint8
+	Data    []byte
+}
+
+// BGPRouteRefresh is the body of a ROUTE-REFRESH message.  Subtype is 0 for
+// a plain refresh request, and marks the beginning or end of an enhanced
+// route refresh otherwise.
+type BGPRouteRefresh struct {
+	AFI     BGPAFI
+	Subtype uint8
+	SAFI    BGPSAFI
+}
+
+// LayerType returns LayerTypeBGP.
+func (b *BGP) LayerType() gopacket.LayerType { return LayerTypeBGP }
+
+func (b *BGP) CanDecode() gopacket.LayerClass { return LayerTypeBGP }
+
+// NextLayerType returns LayerTypeBGP if another complete BGP message
+// follows this one, and gopacket.LayerTypePayload for anything else.
+func (b *BGP) NextLayerType() gopacket.LayerType {
+	if isBGPMessage(b.Payload) {
+		return LayerTypeBGP
+	}
+	return gopacket.LayerTypePayload
+}
+
+// isBGPMessage returns true if data starts with a complete BGP message.
+func isBGPMessage(data []byte) bool {
+	if len(data) < bgpHeaderLength || !bytes.Equal(data[:16], bgpMarker) {
+		return false
+	}
+	l := int(binary.BigEndian.Uint16(data[16:18]))
+	return l >= bgpHeaderLength && l <= len(data)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (b *BGP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < bgpHeaderLength {
+		df.SetTruncated()
+		return fmt.Errorf("BGP length %d too short", len(data))
+	}
+	if !bytes.Equal(data[:16], bgpMarker) {
+		return errors.New("BGP marker invalid")
+	}
+	*b = BGP{Length: binary.BigEndian.Uint16(data[16:18]), Type: BGPType(data[18])}
+	switch {
+	case b.Length < bgpHeaderLength:
+		return fmt.Errorf("BGP message length %d too short", b.Length)
+	case int(b.Length) > len(data):
+		df.SetTruncated()
+		return fmt.Errorf("BGP message length %d exceeds %d bytes available", b.Length, len(data))
+	}
+	b.BaseLayer = BaseLayer{Contents: data[:b.Length], Payload: data[b.Length:]}
+	body := data[bgpHeaderLength:b.Length]
+	var err error
+	switch b.Type {
+	case BGPTypeOpen:
+		b.Open, err = decodeBGPOpen(body)
+	case BGPTypeUpdate:
+		b.Update, err = decodeBGPUpdate(body)
+	case BGPTypeNotification:
+		if len(body) < 2 {
+			return fmt.Errorf("BGP notification length %d too short", len(body))
+		}
+		b.Notification = &BGPNotification{Code: BGPErrorCode(body[0]), Subcode: body[1], Data: body[2:]}
+	case BGPTypeKeepalive:
+		if len(body) != 0 {
+			return fmt.Errorf("BGP keepalive has %d byte body", len(body))
+		}
+	case BGPTypeRouteRefresh:
+		if len(body) < 4 {
+			return fmt.Errorf("BGP route refresh length %d too short", len(body))
+		}
+		b.RouteRefresh = &BGPRouteRefresh{AFI: BGPAFI(binary.BigEndian.Uint16(body[0:2])), Subtype: body[2], SAFI: BGPSAFI(body[3])}
+	default:
+		return fmt.Errorf("unknown BGP message type %v", b.Type)
+	}
+	return err
+}
+
+func decodeBGPOpen(b []byte) (*BGPOpen, error) {
+	if len(b) < 10 {
+		return nil, fmt.Errorf("BGP open length %d too short", len(b))
+	}
+	o := &BGPOpen{
+		Version:    b[0],
+		MyAS:       binary.BigEndian.Uint16(b[1:3]),
+		HoldTime:   binary.BigEndian.Uint16(b[3:5]),
+		Identifier: net.IP(b[5:9]),
+	}
+	n, b := int(b[9]), b[10:]
+	// Extended optional parameters (RFC 9072) have two byte lengths.
+	extended := n == 255 && len(b) >= 3 && b[0] == 255
+	if extended {
+		n, b = int(binary.BigEndian.Uint16(b[1:3])), b[3:]
+	}
+	if n != len(b) {
+		return nil, fmt.Errorf("BGP open optional parameters length %d, have %d bytes", n, len(b))
+	}
+	for len(b) > 0 {
+		var t uint8
+		var v []byte
+		if extended {
+			if len(b) < 3 || len(b) < 3+int(binary.BigEndian.Uint16(b[1:3])) {
+				return nil, errors.New("BGP open optional parameter truncated")
+			}
+			t, v, b = b[0], b[3:3+binary.BigEndian.Uint16(b[1:3])], b[3+binary.BigEndian.Uint16(b[1:3]):]
+		} else {
+			if len(b) < 2 || len(b) < 2+int(b[1]) {
+				return nil, errors.New("BGP open optional parameter truncated")
+			}
+			t, v, b = b[0], b[2:2+int(b[1])], b[2+int(b[1]):]
+		}
+		if t != 2 {
+			o.Parameters = append(o.Parameters, BGPOptionalParameter{Type: t, Data: v})
+			continue
+		}
+		for len(v) > 0 {
+			if len(v) < 2 || len(v) < 2+int(v[1]) {
+				return nil, errors.New("BGP capability truncated")
+			}
+			o.Capabilities = append(o.Capabilities, BGPCapability{Code: BGPCapabilityCode(v[0]), Data: v[2 : 2+int(v[1])]})
+			v = v[2+int(v[1]):]
+		}
+	}
+	return o, nil
+}
+
+// Capability returns the first capability with the given code.
+func (o *BGPOpen) Capability(code BGPCapabilityCode) (BGPCapability, bool) {
+	for _, c := range o.Capabilities {
+		if c.Code == code {
+			return c, true
+		}
+	}
+	return BGPCapability{}, false
+}
+
+// AS returns the speaker's AS number: the one in its four-octet AS
+// capability if it has one, or MyAS.
+func (o *BGPOpen) AS() uint32 {
+	if c, ok := o.Capability(BGPCapabilityFourOctetAS); ok {
+		if as, err := c.FourOctetAS(); err == nil {
+			return as
+		}
+	}
+	return uint32(o.MyAS)
+}
+
+// Multiprotocol decodes a multiprotocol extensions capability.
+func (c BGPCapability) Multiprotocol() (BGPAFI, BGPSAFI, error) {
+	if c.Code != BGPCapabilityMultiprotocol || len(c.Data) != 4 {
+		return 0, 0, fmt.Errorf("BGP capability %v length %d is not multiprotocol", c.Code, len(c.Data))
+	}
+	return BGPAFI(binary.BigEndian.Uint16(c.Data[0:2])), BGPSAFI(c.Data[3]), nil
+}
+
+// FourOctetAS decodes a four-octet AS number capability.
+func (c BGPCapability) FourOctetAS() (uint32, error) {
+	if c.Code != BGPCapabilityFourOctetAS || len(c.Data) != 4 {
+		return 0, fmt.Errorf("BGP capability %v length %d is not four-octet AS", c.Code, len(c.Data))
+	}
+	return binary.BigEndian.Uint32(c.Data), nil
+}
+
+func decodeBGPUpdate(b []byte) (*BGPUpdate, error) {
+	if len(b) < 2 || len(b) < 4+int(binary.BigEndian.Uint16(b[0:2])) {
+		return nil, fmt.Errorf("BGP update length %d too short", len(b))
+	}
+	u := &BGPUpdate{}
+	var err error
+	wl := int(binary.BigEndian.Uint16(b[0:2]))
+	if u.WithdrawnRoutes, err = decodeBGPIPv4Prefixes(b[2 : 2+wl]); err != nil {
+		return nil, err
+	}
+	b = b[2+wl:]
+	al := int(binary.BigEndian.Uint16(b[0:2]))
+	if len(b) < 2+al {
+		return nil, fmt.Errorf("BGP update path attributes length %d exceeds %d bytes available", al, len(b)-2)
+	}
+	for a := b[2 : 2+al]; len(a) > 0; {
+		if len(a) < 3 {
+			return nil, errors.New("BGP path attribute truncated")
+		}
+		attr := BGPPathAttribute{Flags: a[0], Type: BGPPathAttributeType(a[1])}
+		var l, h int
+		if attr.Flags&BGPAttrFlagExtendedLength != 0 {
+			if len(a) < 4 {
+				return nil, errors.New("BGP path attribute truncated")
+			}
+			l, h = int(binary.BigEndian.Uint16(a[2:4])), 4
+		} else {
+			l, h = int(a[2]), 3
+		}
+		if len(a) < h+l {
+			return nil, fmt.Errorf("BGP %v attribute truncated", attr.Type)
+		}
+		attr.Data = a[h : h+l]
+		u.PathAttributes = append(u.PathAttributes, attr)
+		a = a[h+l:]
+	}
+	if u.NLRI, err = decodeBGPIPv4Prefixes(b[2+al:]); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// decodeBGPIPv4Prefixes decodes the IPv4 unicast prefixes of an UPDATE's
+// withdrawn routes or NLRI.
+func decodeBGPIPv4Prefixes(b []byte) ([]net.IPNet, error) {
+	var out []net.IPNet
+	for len(b) > 0 {
+		p, n, err := decodeBGPAddressPrefix(b[1:], int(b[0]), net.IPv4len)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+		b = b[1+n:]
+	}
+	return out, nil
+}
+
+// decodeBGPAddressPrefix decodes a prefix of the given number of bits,
+// and returns it and the number of bytes it took.
+func decodeBGPAddressPrefix(b []byte, bits, addrLen int) (net.IPNet, int, error) {
+	if bits > addrLen*8 {
+		return net.IPNet{}, 0, fmt.Errorf("BGP prefix length %d too long", bits)
+	}
+	n := (bits + 7) / 8
+	if len(b) < n {
+		return net.IPNet{}, 0, fmt.Errorf("BGP /%d prefix truncated", bits)
+	}
+	ip := make(net.IP, addrLen)
+	copy(ip, b[:n])
+	return net.IPNet{IP: ip, Mask: net.CIDRMask(bits, addrLen*8)}, n, nil
+}
+
+// Attribute returns the first path attribute of the given type.
+func (u *BGPUpdate) Attribute(t BGPPathAttributeType) (BGPPathAttribute, bool) {
+	for _, a := range u.PathAttributes {
+		if a.Type == t {
+			return a, true
+		}
+	}
+	return BGPPathAttribute{}, false
+}
+
+func (a BGPPathAttribute) check(t BGPPathAttributeType, length int) error {
+	if a.Type != t {
+		return fmt.Errorf("BGP attribute %v is not %v", a.Type, t)
+	}
+	if len(a.Data) != length {
+		return fmt.Errorf("BGP %v attribute length %d, want %d", a.Type, len(a.Data), length)
+	}
+	return nil
+}
+
+// Origin decodes an ORIGIN attribute: 0 for IGP, 1 for EGP and 2 for
+// incomplete.
+func (a BGPPathAttribute) Origin() (uint8, error) {
+	if err := a.check(BGPAttrOrigin, 1); err != nil {
+		return 0, err
+	}
+	return a.Data[0], nil
+}
+
+// BGP AS path segment types.
+const (
+	BGPASSet            = 1
+	BGPASSequence       = 2
+	BGPASConfedSequence = 3
+	BGPASConfedSet      = 4
+)
+
+// BGPASPathSegment is a segment of an AS path.
+type BGPASPathSegment struct {
+	Type uint8
+	ASNs []uint32
+}
+
+// ASPath decodes an AS_PATH or AS4_PATH attribute.  Whether an AS_PATH
+// carries four-octet AS numbers depends on the capabilities both speakers
+// advertised in their OPEN messages, so the caller passes as4; AS4_PATH
+// always does.
+func (a BGPPathAttribute) ASPath(as4 bool) ([]BGPASPathSegment, error) {
+	switch a.Type {
+	case BGPAttrAS4Path:
+		as4 = true
+	case BGPAttrASPath:
+	default:
+		return nil, fmt.Errorf("BGP attribute %v is not an AS path", a.Type)
+	}
+	size := 2
+	if as4 {
+		size = 4
+	}
+	var out []BGPASPathSegment
+	for b := a.Data; len(b) > 0; {
+		if len(b) < 2 || len(b) < 2+size*int(b[1]) {
+			return nil, errors.New("BGP AS path segment truncated")
+		}
+		s := BGPASPathSegment{Type: b[0]}
+		for i := 0; i < int(b[1]); i++ {
+			if as4 {
+				s.ASNs = append(s.ASNs, binary.BigEndian.Uint32(b[2+4*i:]))
+			} else {
+				s.ASNs = append(s.ASNs, uint32(binary.BigEndian.Uint16(b[2+2*i:])))
+			}
+		}
+		out = append(out, s)
+		b = b[2+size*int(b[1]):]
+	}
+	return out, nil
+}
+
+// NextHop decodes a NEXT_HOP attribute.
+func (a BGPPathAttribute) NextHop() (net.IP, error) {
+	if err := a.check(BGPAttrNextHop, 4); err != nil {
+		return nil, err
+	}
+	return net.IP(a.Data), nil
+}
+
+// MultiExitDisc decodes a MULTI_EXIT_DISC attribute.
+func (a BGPPathAttribute) MultiExitDisc() (uint32, error) {
+	if err := a.check(BGPAttrMultiExitDisc, 4); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(a.Data), nil
+}
+
+// LocalPref decodes a LOCAL_PREF attribute.
+func (a BGPPathAttribute) LocalPref() (uint32, error) {
+	if err := a.check(BGPAttrLocalPref, 4); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(a.Data), nil
+}
+
+// Communities decodes a COMMUNITIES attribute.
+func (a BGPPathAttribute) Communities() ([]uint32, error) {
+	if a.Type != BGPAttrCommunities || len(a.Data)%4 != 0 {
+		return nil, fmt.Errorf("BGP attribute %v length %d is not communities", a.Type, len(a.Data))
+	}
+	var out []uint32
+	for b := a.Data; len(b) > 0; b = b[4:] {
+		out = append(out, binary.BigEndian.Uint32(b))
+	}
+	return out, nil
+}
+
+// BGPPrefix is a route of a multiprotocol family.  Labels are the MPLS
+// labels of labeled unicast and VPN routes, and RouteDistinguisher is set
+// for VPN routes.
+type BGPPrefix struct {
+	Labels             []uint32
+	RouteDistinguisher []byte
+	Prefix             net.IPNet
+}
+
+// BGPMPReachNLRI is the value of an MP_REACH_NLRI or MP_UNREACH_NLRI
+// attribute; the latter has no next hops.  NLRI are decoded for the
+// unicast, multicast, labeled and VPN families of IPv4 and IPv6, and left
+// in RawNLRI for others.
+type BGPMPReachNLRI struct {
+	AFI      BGPAFI
+	SAFI     BGPSAFI
+	NextHops []net.IP
+	NLRI     []BGPPrefix
+	RawNLRI  []byte
+}
+
+// MPReachNLRI decodes an MP_REACH_NLRI attribute.
+func (a BGPPathAttribute) MPReachNLRI() (*BGPMPReachNLRI, error) {
+	if a.Type != BGPAttrMPReachNLRI || len(a.Data) < 5 || len(a.Data) < 5+int(a.Data[3]) {
+		return nil, fmt.Errorf("BGP attribute %v length %d is not MP_REACH_NLRI", a.Type, len(a.Data))
+	}
+	r := &BGPMPReachNLRI{AFI: BGPAFI(binary.BigEndian.Uint16(a.Data[0:2])), SAFI: BGPSAFI(a.Data[2])}
+	nh := a.Data[4 : 4+int(a.Data[3])]
+	// VPN next hops are preceded by a zero route distinguisher.
+	rd := 0
+	if r.SAFI == BGPSAFIVPN {
+		rd = 8
+	}
+	var size int
+	switch {
+	case len(nh) > 0 && len(nh)%(rd+net.IPv6len) == 0:
+		size = rd + net.IPv6len
+	case len(nh) > 0 && len(nh)%(rd+net.IPv4len) == 0:
+		size = rd + net.IPv4len
+	default:
+		return nil, fmt.Errorf("BGP MP_REACH_NLRI next hop length %d invalid", len(nh))
+	}
+	for ; len(nh) > 0; nh = nh[size:] {
+		r.NextHops = append(r.NextHops, net.IP(nh[rd:size]))
+	}
+	return r, r.decodeNLRI(a.Data[5+int(a.Data[3]):])
+}
+
+// MPUnreachNLRI decodes an MP_UNREACH_NLRI attribute.
+func (a BGPPathAttribute) MPUnreachNLRI() (*BGPMPReachNLRI, error) {
+	if a.Type != BGPAttrMPUnreachNLRI || len(a.Data) < 3 {
+		return nil, fmt.Errorf("BGP attribute %v length %d is not MP_UNREACH_NLRI", a.Type, len(a.Data))
+	}
+	r := &BGPMPReachNLRI{AFI: BGPAFI(binary.BigEndian.Uint16(a.Data[0:2])), SAFI: BGPSAFI(a.Data[2])}
+	return r, r.decodeNLRI(a.Data[3:])
+}
+
+func (r *BGPMPReachNLRI) decodeNLRI(b []byte) error {
+	var addrLen int
+	switch r.AFI {
+	case BGPAFIIPv4:
+		addrLen = net.IPv4len
+	case BGPAFIIPv6:
+		addrLen = net.IPv6len
+	}
+	switch r.SAFI {
+	case BGPSAFIUnicast, BGPSAFIMulticast, BGPSAFILabeled, BGPSAFIVPN:
+	default:
+		addrLen = 0
+	}
+	if addrLen == 0 {
+		r.RawNLRI = b
+		return nil
+	}
+	for len(b) > 0 {
+		var p BGPPrefix
+		bits := int(b[0])
+		b = b[1:]
+		n := 0
+		if r.SAFI == BGPSAFILabeled || r.SAFI == BGPSAFIVPN {
+			for {
+				if len(b) < n+3 || bits < 24 {
+					return errors.New("BGP labeled prefix truncated")
+				}
+				label := uint32(b[n])<<16 | uint32(b[n+1])<<8 | uint32(b[n+2])
+				n, bits = n+3, bits-24
+				p.Labels = append(p.Labels, label>>4)
+				// Withdrawals may carry 0x800000 or 0 in place of a label
+				// stack.
+				if label&1 != 0 || label == 0x800000 || label == 0 {
+					break
+				}
+			}
+		}
+		if r.SAFI == BGPSAFIVPN {
+			if len(b) < n+8 || bits < 64 {
+				return errors.New("BGP VPN prefix truncated")
+			}
+			p.RouteDistinguisher = b[n : n+8]
+			n, bits = n+8, bits-64
+		}
+		prefix, l, err := decodeBGPAddressPrefix(b[n:], bits, addrLen)
+		if err != nil {
+			return err
+		}
+		p.Prefix = prefix
+		r.NLRI = append(r.NLRI, p)
+		b = b[n+l:]
+	}
+	return nil
+}
+
+func decodeBGP(data []byte, p gopacket.PacketBuilder) error {
+	// A segment that doesn't start with a complete message is part of a
+	// message split across segments; reassemble the stream and use
+	// BGPStream to decode it.
+	if !isBGPMessage(data) {
+		return gopacket.DecodePayload.Decode(data, p)
+	}
+	b := &BGP{}
+	return decodingLayerDecoder(b, data, p)
+}
+
+// maxBGPMessage is the largest BGP message, an extended message (RFC
+// 8654).
+const maxBGPMessage = 0xffff
+
+// BGPStream splits one direction of a reassembled BGP session into
+// messages, including those split across TCP segments.
+type BGPStream struct {
+	buf streamBuffer
+}
+
+// Decode appends data from the stream and returns the messages completed
+// by it.  After an error, or a gap in the stream, call Reset before
+// decoding more data.
+func (s *BGPStream) Decode(data []byte) ([]*BGP, error) {
+	ls, err := s.buf.decode(data, "BGP", maxBGPMessage, bgpFrame)
+	var out []*BGP
+	for _, l := range ls {
+		out = append(out, l.(*BGP))
+	}
+	return out, err
+}
+
+// bgpFrame is the streamFramer of BGPStream.
+func bgpFrame(data []byte) (int64, layerDecodingLayer, error) {
+	if len(data) < bgpHeaderLength {
+		return 0, nil, nil
+	}
+	if !bytes.Equal(data[:16], bgpMarker) {
+		return 0, nil, errors.New("BGP marker invalid")
+	}
+	n := int64(binary.BigEndian.Uint16(data[16:18]))
+	if n < bgpHeaderLength {
+		return 0, nil, fmt.Errorf("BGP message length %d too short", n)
+	}
+	return n, &BGP{}, nil
+}
+
+// Reset discards any partial message.
+func (s *BGPStream) Reset() {
+	s.buf.reset()
+}
@@ -0,0 +1,245 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// bgpMessage returns a BGP message with the given type and body.
+func bgpMessage(t BGPType, body ...byte) []byte {
+	l := bgpHeaderLength + len(body)
+	m := append(append([]byte{}, bgpMarker...), byte(l>>8), byte(l), byte(t))
+	return append(m, body...)
+}
+
+// testBGPOpen is an OPEN from AS 65536, advertising IPv4 unicast, route
+// refresh and four-octet AS numbers.
+var testBGPOpen = bgpMessage(BGPTypeOpen,
+	0x04, 0x5b, 0xa0, 0x00, 0xb4, 0x0a, 0x00, 0x00, 0x01, 0x14,
+	0x02, 0x06, 0x01, 0x04, 0x00, 0x01, 0x00, 0x01,
+	0x02, 0x06, 0x41, 0x04, 0x00, 0x01, 0x00, 0x00,
+	0x02, 0x02, 0x02, 0x00,
+)
+
+// testBGPUpdate withdraws 192.168.1.0/24 and advertises 10.1.0.0/16 and
+// 203.0.113.5/32.
+var testBGPUpdate = bgpMessage(BGPTypeUpdate,
+	0x00, 0x04, 0x18, 0xc0, 0xa8, 0x01,
+	0x00, 0x26,
+	0x40, 0x01, 0x01, 0x00,
+	0x40, 0x02, 0x0a, 0x02, 0x02, 0x00, 0x00, 0xfd, 0xe8, 0x00, 0x01, 0x00, 0x00,
+	0x40, 0x03, 0x04, 0x0a, 0x00, 0x00, 0x01,
+	0x80, 0x04, 0x04, 0x00, 0x00, 0x00, 0x64,
+	0xc0, 0x08, 0x04, 0xfd, 0xe8, 0x00, 0x64,
+	0x10, 0x0a, 0x01, 0x20, 0xcb, 0x00, 0x71, 0x05,
+)
+
+func TestPacketBGP(t *testing.T) {
+	setTCPPortLayerType(t, 179, LayerTypeBGP)
+	buf := gopacket.NewSerializeBuffer()
+	ip := &IPv4{Version: 4, TTL: 1, Protocol: IPProtocolTCP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	tcp := &TCP{SrcPort: 50000, DstPort: 179, ACK: true, PSH: true, Window: 1024}
+	tcp.SetNetworkLayerForChecksum(ip)
+	payload := append(append(append([]byte{}, testBGPOpen...), bgpMessage(BGPTypeKeepalive)...), testBGPUpdate...)
+	err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		&Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{0, 1, 2, 3, 4, 6}, EthernetType: EthernetTypeIPv4},
+		ip, tcp, gopacket.Payload(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeIPv4, LayerTypeTCP, LayerTypeBGP, LayerTypeBGP, LayerTypeBGP}, t)
+	var msgs []*BGP
+	for _, l := range p.Layers() {
+		if b, ok := l.(*BGP); ok {
+			msgs = append(msgs, b)
+		}
+	}
+
+	open := msgs[0].Open
+	if msgs[0].Type != BGPTypeOpen || open == nil {
+		t.Fatalf("got %+v", msgs[0])
+	}
+	if open.Version != 4 || open.HoldTime != 180 || !open.Identifier.Equal(net.IP{10, 0, 0, 1}) || open.AS() != 65536 {
+		t.Errorf("got open %+v", open)
+	}
+	if len(open.Capabilities) != 3 {
+		t.Fatalf("got capabilities %+v", open.Capabilities)
+	}
+	if afi, safi, err := open.Capabilities[0].Multiprotocol(); err != nil || afi != BGPAFIIPv4 || safi != BGPSAFIUnicast {
+		t.Errorf("got multiprotocol %v/%v, %v", afi, safi, err)
+	}
+	if _, ok := open.Capability(BGPCapabilityRouteRefresh); !ok {
+		t.Error("no route refresh capability")
+	}
+	if msgs[1].Type != BGPTypeKeepalive || msgs[1].Length != bgpHeaderLength {
+		t.Errorf("got %+v", msgs[1])
+	}
+
+	u := msgs[2].Update
+	if u == nil {
+		t.Fatalf("got %+v", msgs[2])
+	}
+	wantWithdrawn := []net.IPNet{{IP: net.IP{192, 168, 1, 0}, Mask: net.CIDRMask(24, 32)}}
+	if !reflect.DeepEqual(u.WithdrawnRoutes, wantWithdrawn) {
+		t.Errorf("got withdrawn %v", u.WithdrawnRoutes)
+	}
+	wantNLRI := []net.IPNet{
+		{IP: net.IP{10, 1, 0, 0}, Mask: net.CIDRMask(16, 32)},
+		{IP: net.IP{203, 0, 113, 5}, Mask: net.CIDRMask(32, 32)},
+	}
+	if !reflect.DeepEqual(u.NLRI, wantNLRI) {
+		t.Errorf("got NLRI %v", u.NLRI)
+	}
+	if len(u.PathAttributes) != 5 {
+		t.Fatalf("got attributes %+v", u.PathAttributes)
+	}
+	if o, err := u.PathAttributes[0].Origin(); err != nil || o != 0 {
+		t.Errorf("got origin %d, %v", o, err)
+	}
+	path, err := u.PathAttributes[1].ASPath(true)
+	if err != nil || !reflect.DeepEqual(path, []BGPASPathSegment{{Type: BGPASSequence, ASNs: []uint32{65000, 65536}}}) {
+		t.Errorf("got AS path %+v, %v", path, err)
+	}
+	if nh, err := u.PathAttributes[2].NextHop(); err != nil || !nh.Equal(net.IP{10, 0, 0, 1}) {
+		t.Errorf("got next hop %v, %v", nh, err)
+	}
+	med, _ := u.Attribute(BGPAttrMultiExitDisc)
+	if m, err := med.MultiExitDisc(); err != nil || m != 100 {
+		t.Errorf("got MED %d, %v", m, err)
+	}
+	if c, err := u.PathAttributes[4].Communities(); err != nil || !reflect.DeepEqual(c, []uint32{0xfde80064}) {
+		t.Errorf("got communities %x, %v", c, err)
+	}
+	if _, err := u.PathAttributes[4].LocalPref(); err == nil {
+		t.Error("decoded communities as local preference")
+	}
+}
+
+func TestBGPMultiprotocol(t *testing.T) {
+	data := bgpMessage(BGPTypeUpdate,
+		0x00, 0x00, 0x00, 0x4e,
+		0x40, 0x01, 0x01, 0x00,
+		0x40, 0x02, 0x00,
+		// MP_REACH_NLRI: IPv6 unicast 2001:db8:1::/64 via 2001:db8::1 and
+		// fe80::1.
+		0x90, 0x0e, 0x00, 0x2e, 0x00, 0x02, 0x01, 0x20,
+		0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x40, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x01, 0x00, 0x00,
+		// MP_UNREACH_NLRI: VPNv4 10.2.0.0/24 with RD 65000:1.
+		0x80, 0x0f, 0x12, 0x00, 0x01, 0x80,
+		0x70, 0x80, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0xfd, 0xe8, 0x00, 0x01, 0x0a, 0x02, 0x00,
+	)
+	p := gopacket.NewPacket(data, LayerTypeBGP, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	u := p.Layer(LayerTypeBGP).(*BGP).Update
+	if len(u.PathAttributes) != 4 || len(u.NLRI) != 0 {
+		t.Fatalf("got %+v", u)
+	}
+	if path, err := u.PathAttributes[1].ASPath(false); err != nil || len(path) != 0 {
+		t.Errorf("got AS path %+v, %v", path, err)
+	}
+
+	reach, err := u.PathAttributes[2].MPReachNLRI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantReach := &BGPMPReachNLRI{
+		AFI:      BGPAFIIPv6,
+		SAFI:     BGPSAFIUnicast,
+		NextHops: []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("fe80::1")},
+		NLRI:     []BGPPrefix{{Prefix: net.IPNet{IP: net.ParseIP("2001:db8:1::"), Mask: net.CIDRMask(64, 128)}}},
+	}
+	if !reflect.DeepEqual(reach, wantReach) {
+		t.Errorf("got %+v, want %+v", reach, wantReach)
+	}
+
+	unreach, err := u.PathAttributes[3].MPUnreachNLRI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUnreach := &BGPMPReachNLRI{
+		AFI:  BGPAFIIPv4,
+		SAFI: BGPSAFIVPN,
+		NLRI: []BGPPrefix{{
+			Labels:             []uint32{0x80000},
+			RouteDistinguisher: []byte{0x00, 0x01, 0x00, 0x00, 0xfd, 0xe8, 0x00, 0x01},
+			Prefix:             net.IPNet{IP: net.IP{10, 2, 0, 0}, Mask: net.CIDRMask(24, 32)},
+		}},
+	}
+	if !reflect.DeepEqual(unreach, wantUnreach) {
+		t.Errorf("got %+v, want %+v", unreach, wantUnreach)
+	}
+
+	vpn := BGPPathAttribute{Type: BGPAttrMPReachNLRI, Data: []byte{
+		0x00, 0x01, 0x80, 0x0c, 0, 0, 0, 0, 0, 0, 0, 0, 0x0a, 0x00, 0x00, 0x02, 0x00,
+		0x70, 0x00, 0x01, 0x01, 0x00, 0x01, 0x00, 0x00, 0xfd, 0xe8, 0x00, 0x01, 0x0a, 0x03, 0x00,
+	}}
+	r, err := vpn.MPReachNLRI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.NextHops) != 1 || !r.NextHops[0].Equal(net.IP{10, 0, 0, 2}) || len(r.NLRI) != 1 || !reflect.DeepEqual(r.NLRI[0].Labels, []uint32{16}) {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestBGPStream(t *testing.T) {
+	notification := bgpMessage(BGPTypeNotification, 0x06, 0x02)
+	stream := append(append(append([]byte{}, testBGPOpen...), testBGPUpdate...), notification...)
+	var s BGPStream
+	var got []*BGP
+	for i := 0; i < len(stream); i += 7 {
+		end := i + 7
+		if end > len(stream) {
+			end = len(stream)
+		}
+		msgs, err := s.Decode(stream[i:end])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, msgs...)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d messages", len(got))
+	}
+	if !bytes.Equal(got[1].Contents, testBGPUpdate) || len(got[1].Update.NLRI) != 2 {
+		t.Errorf("got update %+v", got[1])
+	}
+	if n := got[2].Notification; n == nil || n.Code != BGPErrorCease || n.Subcode != 2 {
+		t.Errorf("got notification %+v", got[2])
+	}
+
+	// The start of a message split across segments is left as payload.
+	p := gopacket.NewPacket(testBGPUpdate[:30], LayerTypeBGP, gopacket.Default)
+	if p.ErrorLayer() != nil || p.Layer(LayerTypeBGP) != nil || p.ApplicationLayer() == nil {
+		t.Errorf("decoded partial message as %v", p)
+	}
+
+	if _, err := s.Decode([]byte{0x00, 0x13, 0x04}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Decode(bytes.Repeat([]byte{0x00}, 16)); err == nil {
+		t.Error("decoded message without marker")
+	}
+	s.Reset()
+	if msgs, err := s.Decode(bgpMessage(BGPTypeKeepalive)); err != nil || len(msgs) != 1 {
+		t.Errorf("got %v, %v after reset", msgs, err)
+	}
+}
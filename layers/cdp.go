@@ -172,7 +172,9 @@ type CDPEnergyWise struct {
 	ReplyUnknown3  []byte
 }
 
-// CiscoDiscoveryInfo represents the decoded details for a set of CiscoDiscoveryValues
+// CiscoDiscoveryInfo represents the decoded details for a set of CiscoDiscoveryValues.
+// It can be serialized after a CiscoDiscovery layer with no Values, to build
+// a CDP frame from its fields.
 type CiscoDiscoveryInfo struct {
 	BaseLayer
 	CDPHello
@@ -209,6 +211,10 @@ func (c *CiscoDiscovery) LayerType() gopacket.LayerType {
 }
 
 func decodeCiscoDiscovery(data []byte, p gopacket.PacketBuilder) error {
+	if len(data) < 4 {
+		p.SetTruncated()
+		return fmt.Errorf("CiscoDiscovery length %d too short", len(data))
+	}
 	c := &CiscoDiscovery{
 		Version:  data[0],
 		TTL:      data[1],
@@ -235,11 +241,15 @@ func (c *CiscoDiscoveryInfo) LayerType() gopacket.LayerType {
 
 func decodeCiscoDiscoveryTLVs(data []byte) (values []CiscoDiscoveryValue, err error) {
 	for len(data) > 0 {
+		if len(data) < 4 {
+			err = fmt.Errorf("CiscoDiscovery value truncated, %d bytes left", len(data))
+			break
+		}
 		val := CiscoDiscoveryValue{
 			Type:   CDPTLVType(binary.BigEndian.Uint16(data[:2])),
 			Length: binary.BigEndian.Uint16(data[2:4]),
 		}
-		if val.Length < 4 {
+		if val.Length < 4 || int(val.Length) > len(data) {
 			err = fmt.Errorf("Invalid CiscoDiscovery value length %d", val.Length)
 			break
 		}
@@ -390,7 +400,7 @@ func decodeCiscoDiscoveryInfo(data []byte, p gopacket.PacketBuilder) error {
 			}
 			info.PowerRequest.ID = binary.BigEndian.Uint16(val.Value[0:2])
 			info.PowerRequest.MgmtID = binary.BigEndian.Uint16(val.Value[2:4])
-			for n := 4; n < len(val.Value); n += 4 {
+			for n := 4; n+4 <= len(val.Value); n += 4 {
 				info.PowerRequest.Values = append(info.PowerRequest.Values, binary.BigEndian.Uint32(val.Value[n:n+4]))
 			}
 		case CDPTLVPowerAvailable:
@@ -399,7 +409,7 @@ func decodeCiscoDiscoveryInfo(data []byte, p gopacket.PacketBuilder) error {
 			}
 			info.PowerAvailable.ID = binary.BigEndian.Uint16(val.Value[0:2])
 			info.PowerAvailable.MgmtID = binary.BigEndian.Uint16(val.Value[2:4])
-			for n := 4; n < len(val.Value); n += 4 {
+			for n := 4; n+4 <= len(val.Value); n += 4 {
 				info.PowerAvailable.Values = append(info.PowerAvailable.Values, binary.BigEndian.Uint32(val.Value[n:n+4]))
 			}
 			//		case CDPTLVPortUnidirectional
@@ -436,11 +446,11 @@ func decodeCiscoDiscoveryInfo(data []byte, p gopacket.PacketBuilder) error {
 				data = data[8:]
 				switch tType {
 				case CDPEnergyWiseRole:
-					info.EnergyWise.Role = string(data[:])
+					info.EnergyWise.Role = string(data[:tLen])
 				case CDPEnergyWiseDomain:
-					info.EnergyWise.Domain = string(data[:])
+					info.EnergyWise.Domain = string(data[:tLen])
 				case CDPEnergyWiseName:
-					info.EnergyWise.Name = string(data[:])
+					info.EnergyWise.Name = string(data[:tLen])
 				case CDPEnergyWiseReplyTo:
 					if len(data) >= 18 {
 						info.EnergyWise.ReplyUnknown1 = data[0:2]
@@ -499,6 +509,9 @@ func decodeAddresses(v []byte) (addresses []net.IP, err error) {
 		return nil, fmt.Errorf("Invalid Address TLV length %d", len(v))
 	}
 	for i := 0; i < numaddr; i++ {
+		if len(v) < 2 {
+			return nil, fmt.Errorf("Invalid Address TLV length %d", len(v))
+		}
 		prottype := v[0]
 		if prottype != CDPProtocolTypeNLPID && prottype != CDPProtocolType802_2 { // invalid protocol type
 			return nil, fmt.Errorf("Invalid Address Protocol %d", prottype)
@@ -508,11 +521,17 @@ func decodeAddresses(v []byte) (addresses []net.IP, err error) {
 			(prottype == CDPProtocolType802_2 && protlen != 3 && protlen != 8) { // invalid length
 			return nil, fmt.Errorf("Invalid Address Protocol length %d", protlen)
 		}
+		if len(v) < 4+protlen {
+			return nil, fmt.Errorf("Invalid Address TLV length %d", len(v))
+		}
 		plen := make([]byte, 8)
 		copy(plen[8-protlen:], v[2:2+protlen])
 		protocol := CDPAddressType(binary.BigEndian.Uint64(plen))
 		v = v[2+protlen:]
 		addrlen := binary.BigEndian.Uint16(v[0:2])
+		if len(v) < 2+int(addrlen) {
+			return nil, fmt.Errorf("Invalid Address length %d", addrlen)
+		}
 		ab := v[2 : 2+addrlen]
 		if protocol == CDPAddressTypeIPV4 && addrlen == 4 {
 			addresses = append(addresses, net.IPv4(ab[0], ab[1], ab[2], ab[3]))
@@ -639,3 +658,251 @@ func checkCDPTLVLen(v CiscoDiscoveryValue, l int) (err error) {
 	}
 	return
 }
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+// See the docs for gopacket.SerializableLayer for more info.  Values are
+// written after the header; if there are none, the TLVs are expected to be
+// the payload, usually a CiscoDiscoveryInfo layer.
+func (c *CiscoDiscovery) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	if len(c.Values) > 0 {
+		var tlvs []byte
+		for _, v := range c.Values {
+			tlvs = appendCDPTLV(tlvs, v.Type, v.Value)
+		}
+		bytes, err := b.PrependBytes(len(tlvs))
+		if err != nil {
+			return err
+		}
+		copy(bytes, tlvs)
+	}
+	bytes, err := b.PrependBytes(4)
+	if err != nil {
+		return err
+	}
+	bytes[0] = c.Version
+	bytes[1] = c.TTL
+	if opts.ComputeChecksums {
+		bytes[2], bytes[3] = 0, 0
+		c.Checksum = cdpChecksum(b.Bytes())
+	}
+	binary.BigEndian.PutUint16(bytes[2:4], c.Checksum)
+	return nil
+}
+
+// cdpChecksum computes the checksum of a CDP packet.  It is the IP
+// checksum, except that Cisco devices add the last byte of an odd length
+// packet as a signed value, so a negative one is subtracted from the sum.
+func cdpChecksum(data []byte) uint16 {
+	if len(data)%2 == 0 {
+		return tcpipChecksum(data, 0)
+	}
+	last := uint32(data[len(data)-1])
+	if last&0x80 != 0 {
+		// -(0x100-last), as a ones' complement 16 bit word.
+		last += 0xff00 - 1
+	}
+	return tcpipChecksum(data[:len(data)-1], last)
+}
+
+func appendCDPTLV(b []byte, t CDPTLVType, v []byte) []byte {
+	var h [4]byte
+	binary.BigEndian.PutUint16(h[0:2], uint16(t))
+	binary.BigEndian.PutUint16(h[2:4], uint16(4+len(v)))
+	return append(append(b, h[:]...), v...)
+}
+
+func appendCDPUint(b []byte, t CDPTLVType, v uint32, size int) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return appendCDPTLV(b, t, buf[4-size:])
+}
+
+func encodeCDPAddresses(addresses []net.IP) ([]byte, error) {
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint32(v, uint32(len(addresses)))
+	for _, a := range addresses {
+		if a4 := a.To4(); a4 != nil {
+			v = append(v, CDPProtocolTypeNLPID, 1, byte(CDPAddressTypeIPV4), 0, 4)
+			v = append(v, a4...)
+		} else if len(a) == net.IPv6len {
+			v = append(v, CDPProtocolType802_2, 8)
+			v = append(v, 0, 0, 0, 0, 0, 0, 0, 0)
+			binary.BigEndian.PutUint64(v[len(v)-8:], uint64(CDPAddressTypeIPV6))
+			v = append(v, 0, 16)
+			v = append(v, a...)
+		} else {
+			return nil, fmt.Errorf("invalid CDP address %v", a)
+		}
+	}
+	return v, nil
+}
+
+func (c CDPCapabilities) mask() (m CDPCapability) {
+	for _, f := range []struct {
+		set  bool
+		mask CDPCapability
+	}{
+		{c.L3Router, CDPCapMaskRouter},
+		{c.TBBridge, CDPCapMaskTBBridge},
+		{c.SPBridge, CDPCapMaskSPBridge},
+		{c.L2Switch, CDPCapMaskSwitch},
+		{c.IsHost, CDPCapMaskHost},
+		{c.IGMPFilter, CDPCapMaskIGMPFilter},
+		{c.L1Repeater, CDPCapMaskRepeater},
+		{c.IsPhone, CDPCapMaskPhone},
+		{c.RemotelyManaged, CDPCapMaskRemote},
+	} {
+		if f.set {
+			m |= f.mask
+		}
+	}
+	return
+}
+
+func (h *CDPHello) encode() []byte {
+	v := make([]byte, 32)
+	copy(v[0:3], h.OUI)
+	binary.BigEndian.PutUint16(v[3:5], h.ProtocolID)
+	copy(v[5:9], h.ClusterMaster.To4())
+	copy(v[9:13], h.Unknown1.To4())
+	v[13], v[14], v[15], v[16] = h.Version, h.SubVersion, h.Status, h.Unknown2
+	copy(v[17:23], h.ClusterCommander)
+	copy(v[23:29], h.SwitchMAC)
+	v[29] = h.Unknown3
+	binary.BigEndian.PutUint16(v[30:32], h.ManagementVLAN)
+	return v
+}
+
+func (d *CDPPowerDialogue) encode() []byte {
+	v := make([]byte, 4+4*len(d.Values))
+	binary.BigEndian.PutUint16(v[0:2], d.ID)
+	binary.BigEndian.PutUint16(v[2:4], d.MgmtID)
+	for i, p := range d.Values {
+		binary.BigEndian.PutUint32(v[4+4*i:], p)
+	}
+	return v
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+// See the docs for gopacket.SerializableLayer for more info.
+//
+// Fields are written as TLVs, in type order, and zero fields are left out,
+// except that ports always report their duplex and trust settings, so
+// FullDuplex, ExtendedTrust and UntrustedCOS are written whenever PortID is
+// set.  EnergyWise isn't written.  Unknown values are written last, as
+// they are.
+func (c *CiscoDiscoveryInfo) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	var v []byte
+	str := func(t CDPTLVType, s string) {
+		if s != "" {
+			v = appendCDPTLV(v, t, []byte(s))
+		}
+	}
+	addrs := func(t CDPTLVType, a []net.IP) error {
+		if len(a) == 0 {
+			return nil
+		}
+		enc, err := encodeCDPAddresses(a)
+		if err != nil {
+			return err
+		}
+		v = appendCDPTLV(v, t, enc)
+		return nil
+	}
+	str(CDPTLVDevID, c.DeviceID)
+	if err := addrs(CDPTLVAddress, c.Addresses); err != nil {
+		return err
+	}
+	str(CDPTLVPortID, c.PortID)
+	if m := c.Capabilities.mask(); m != 0 {
+		v = appendCDPUint(v, CDPTLVCapabilities, uint32(m), 4)
+	}
+	str(CDPTLVVersion, c.Version)
+	str(CDPTLVPlatform, c.Platform)
+	if len(c.IPPrefixes) > 0 {
+		var p []byte
+		for _, n := range c.IPPrefixes {
+			ip := n.IP.To4()
+			if ip == nil {
+				return fmt.Errorf("invalid CDP IP prefix %v", n)
+			}
+			ones, _ := n.Mask.Size()
+			p = append(append(p, ip...), byte(ones))
+		}
+		v = appendCDPTLV(v, CDPTLVIPPrefix, p)
+	}
+	if c.CDPHello.OUI != nil {
+		v = appendCDPTLV(v, CDPTLVHello, c.CDPHello.encode())
+	}
+	str(CDPTLVVTPDomain, c.VTPDomain)
+	if c.NativeVLAN != 0 {
+		v = appendCDPUint(v, CDPTLVNativeVLAN, uint32(c.NativeVLAN), 2)
+	}
+	if c.FullDuplex || c.PortID != "" {
+		duplex := uint32(0)
+		if c.FullDuplex {
+			duplex = 1
+		}
+		v = appendCDPUint(v, CDPTLVFullDuplex, duplex, 1)
+	}
+	if c.VLANReply != (CDPVLANDialogue{}) {
+		v = appendCDPUint(v, CDPTLVVLANReply, uint32(c.VLANReply.ID)<<16|uint32(c.VLANReply.VLAN), 3)
+	}
+	if c.VLANQuery != (CDPVLANDialogue{}) {
+		v = appendCDPUint(v, CDPTLVVLANQuery, uint32(c.VLANQuery.ID)<<16|uint32(c.VLANQuery.VLAN), 3)
+	}
+	if c.PowerConsumption != 0 {
+		v = appendCDPUint(v, CDPTLVPower, uint32(c.PowerConsumption), 2)
+	}
+	if c.MTU != 0 {
+		v = appendCDPUint(v, CDPTLVMTU, c.MTU, 4)
+	}
+	if c.ExtendedTrust != 0 || c.PortID != "" {
+		v = appendCDPUint(v, CDPTLVExtendedTrust, uint32(c.ExtendedTrust), 1)
+	}
+	if c.UntrustedCOS != 0 || c.PortID != "" {
+		v = appendCDPUint(v, CDPTLVUntrustedCOS, uint32(c.UntrustedCOS), 1)
+	}
+	str(CDPTLVSysName, c.SysName)
+	str(CDPTLVSysOID, c.SysOID)
+	if err := addrs(CDPTLVMgmtAddresses, c.MgmtAddresses); err != nil {
+		return err
+	}
+	if c.Location.Location != "" {
+		v = appendCDPTLV(v, CDPTLVLocation, append([]byte{c.Location.Type}, c.Location.Location...))
+	}
+	if c.PowerRequest.ID != 0 || len(c.PowerRequest.Values) > 0 {
+		v = appendCDPTLV(v, CDPTLVPowerRequested, c.PowerRequest.encode())
+	}
+	if c.PowerAvailable.ID != 0 || len(c.PowerAvailable.Values) > 0 {
+		v = appendCDPTLV(v, CDPTLVPowerAvailable, c.PowerAvailable.encode())
+	}
+	if c.SparePairPoe != (CDPSparePairPoE{}) {
+		var poe byte
+		for _, f := range []struct {
+			set  bool
+			mask byte
+		}{
+			{c.SparePairPoe.PSEFourWire, CDPPoEFourWire},
+			{c.SparePairPoe.PDArchShared, CDPPoEPDArch},
+			{c.SparePairPoe.PDRequestOn, CDPPoEPDRequest},
+			{c.SparePairPoe.PSEOn, CDPPoEPSE},
+		} {
+			if f.set {
+				poe |= f.mask
+			}
+		}
+		v = appendCDPTLV(v, CDPTLVSparePairPOE, []byte{poe})
+	}
+	for _, u := range c.Unknown {
+		v = appendCDPTLV(v, u.Type, u.Value)
+	}
+	bytes, err := b.PrependBytes(len(v))
+	if err != nil {
+		return err
+	}
+	copy(bytes, v)
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func TestCiscoDiscoverySerializeRoundTrip(t *testing.T) {
+	_, prefix, _ := net.ParseCIDR("10.1.0.0/16")
+	info := &CiscoDiscoveryInfo{
+		DeviceID:         "phone1",
+		Addresses:        []net.IP{net.IPv4(10, 1, 2, 3), net.ParseIP("2001:db8::1")},
+		PortID:           "Port 1",
+		Capabilities:     CDPCapabilities{IsHost: true, IsPhone: true},
+		Version:          "1.0",
+		Platform:         "Cisco IP Phone",
+		IPPrefixes:       []net.IPNet{*prefix},
+		VTPDomain:        "VTP",
+		NativeVLAN:       10,
+		FullDuplex:       true,
+		VLANReply:        CDPVLANDialogue{ID: 1, VLAN: 20},
+		VLANQuery:        CDPVLANDialogue{ID: 0x20, VLAN: 0},
+		PowerConsumption: 6300,
+		MTU:              1500,
+		ExtendedTrust:    1,
+		UntrustedCOS:     5,
+		SysName:          "phone1.example.com",
+		SysOID:           "1.3.6.1.4.1.9",
+		MgmtAddresses:    []net.IP{net.IPv4(10, 1, 2, 3)},
+		Location:         CDPLocation{Type: 1, Location: "Building 1"},
+		PowerRequest:     CDPPowerDialogue{ID: 1, MgmtID: 2, Values: []uint32{6300, 12000}},
+		PowerAvailable:   CDPPowerDialogue{ID: 1, MgmtID: 3, Values: []uint32{12000}},
+		SparePairPoe:     CDPSparePairPoE{PSEFourWire: true, PDRequestOn: true},
+		Unknown:          []CiscoDiscoveryValue{{Type: 0x7fff, Length: 6, Value: []byte{1, 2}}},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	err := gopacket.SerializeLayers(buf, opts,
+		&Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+			DstMAC:       net.HardwareAddr{1, 0, 0x0c, 0xcc, 0xcc, 0xcc},
+			EthernetType: EthernetTypeLLC,
+		},
+		&LLC{DSAP: 0xaa, SSAP: 0xaa, Control: 3},
+		&SNAP{OrganizationalCode: []byte{0, 0, 0x0c}, Type: EthernetTypeCiscoDiscovery},
+		&CiscoDiscovery{Version: 2, TTL: 180},
+		info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeLLC, LayerTypeSNAP, LayerTypeCiscoDiscovery, LayerTypeCiscoDiscoveryInfo}, t)
+
+	cdp := p.Layer(LayerTypeCiscoDiscovery).(*CiscoDiscovery)
+	if cdp.Version != 2 || cdp.TTL != 180 {
+		t.Errorf("header mismatch: %+v", cdp)
+	}
+	if (len(cdp.Contents)+len(cdp.Payload))%2 != 1 {
+		t.Errorf("want odd length packet, to check the checksum padding")
+	}
+	if got := cdpChecksum(append(cdp.Contents, cdp.Payload...)); got != 0 {
+		t.Errorf("checksum %#x doesn't verify", cdp.Checksum)
+	}
+
+	got := p.Layer(LayerTypeCiscoDiscoveryInfo).(*CiscoDiscoveryInfo)
+	info.Addresses[0] = info.Addresses[0].To16()
+	info.Contents = got.Contents
+	if !reflect.DeepEqual(got, info) {
+		t.Errorf("CiscoDiscoveryInfo mismatch:\ngot  %#v\nwant %#v", got, info)
+	}
+}
+
+func TestCiscoDiscoverySerializeValues(t *testing.T) {
+	c := &CiscoDiscovery{
+		Version:  2,
+		TTL:      120,
+		Checksum: 0x1234,
+		Values: []CiscoDiscoveryValue{
+			{Type: CDPTLVDevID, Value: []byte("sw")},
+			{Type: CDPTLVNativeVLAN, Value: []byte{0, 1}},
+		},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := c.SerializeTo(buf, gopacket.SerializeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x02, 0x78, 0x12, 0x34,
+		0x00, 0x01, 0x00, 0x06, 's', 'w',
+		0x00, 0x0a, 0x00, 0x06, 0x00, 0x01,
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got %x, want %x", buf.Bytes(), want)
+	}
+}
+
+func TestCiscoDiscoveryTruncated(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x02, 0xb4},
+		{0x02, 0xb4, 0x00, 0x00, 0x00, 0x01, 0x00, 0x20, 's', 'w'},
+		{0x02, 0xb4, 0x00, 0x00, 0x00, 0x02, 0x00, 0x0c, 0x00, 0x00, 0x00, 0x01},
+	} {
+		p := gopacket.NewPacket(data, LayerTypeCiscoDiscovery, gopacket.Default)
+		if p.ErrorLayer() == nil {
+			t.Errorf("%x: want decode error", data)
+		}
+	}
+}
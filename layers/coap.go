@@ -0,0 +1,542 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mistsys/gopacket"
+)
+
+// CoAPType is the type of a CoAP message.
+type CoAPType uint8
+
+// CoAP message types.
+const (
+	CoAPTypeConfirmable     CoAPType = 0
+	CoAPTypeNonConfirmable  CoAPType = 1
+	CoAPTypeAcknowledgement CoAPType = 2
+	CoAPTypeReset           CoAPType = 3
+)
+
+func (t CoAPType) String() string {
+	switch t {
+	case CoAPTypeConfirmable:
+		return "CON"
+	case CoAPTypeNonConfirmable:
+		return "NON"
+	case CoAPTypeAcknowledgement:
+		return "ACK"
+	case CoAPTypeReset:
+		return "RST"
+	default:
+		return fmt.Sprintf("UnknownCoAPType(%d)", t)
+	}
+}
+
+// CoAPCode is the code of a CoAP message: a request method, or a response
+// code written as class.detail, like 2.05.
+type CoAPCode uint8
+
+// CoAP codes (RFC 7252, RFC 7959 and RFC 8132).
+const (
+	CoAPCodeEmpty                    CoAPCode = 0x00
+	CoAPCodeGET                      CoAPCode = 0x01
+	CoAPCodePOST                     CoAPCode = 0x02
+	CoAPCodePUT                      CoAPCode = 0x03
+	CoAPCodeDELETE                   CoAPCode = 0x04
+	CoAPCodeFETCH                    CoAPCode = 0x05
+	CoAPCodePATCH                    CoAPCode = 0x06
+	CoAPCodeIPATCH                   CoAPCode = 0x07
+	CoAPCodeCreated                  CoAPCode = 0x41
+	CoAPCodeDeleted                  CoAPCode = 0x42
+	CoAPCodeValid                    CoAPCode = 0x43
+	CoAPCodeChanged                  CoAPCode = 0x44
+	CoAPCodeContent                  CoAPCode = 0x45
+	CoAPCodeContinue                 CoAPCode = 0x5f
+	CoAPCodeBadRequest               CoAPCode = 0x80
+	CoAPCodeUnauthorized             CoAPCode = 0x81
+	CoAPCodeBadOption                CoAPCode = 0x82
+	CoAPCodeForbidden                CoAPCode = 0x83
+	CoAPCodeNotFound                 CoAPCode = 0x84
+	CoAPCodeMethodNotAllowed         CoAPCode = 0x85
+	CoAPCodeNotAcceptable            CoAPCode = 0x86
+	CoAPCodeRequestEntityIncomplete  CoAPCode = 0x88
+	CoAPCodePreconditionFailed       CoAPCode = 0x8c
+	CoAPCodeRequestEntityTooLarge    CoAPCode = 0x8d
+	CoAPCodeUnsupportedContentFormat CoAPCode = 0x8f
+	CoAPCodeInternalServerError      CoAPCode = 0xa0
+	CoAPCodeNotImplemented           CoAPCode = 0xa1
+	CoAPCodeBadGateway               CoAPCode = 0xa2
+	CoAPCodeServiceUnavailable       CoAPCode = 0xa3
+	CoAPCodeGatewayTimeout           CoAPCode = 0xa4
+	CoAPCodeProxyingNotSupported     CoAPCode = 0xa5
+)
+
+// Class returns the class of the code: 0 for requests, 2 for success, 4
+// for client errors and 5 for server errors.
+func (c CoAPCode) Class() uint8 { return uint8(c) >> 5 }
+
+// Detail returns the detail of the code.
+func (c CoAPCode) Detail() uint8 { return uint8(c) & 0x1f }
+
+// IsRequest returns true if the code is a request method.
+func (c CoAPCode) IsRequest() bool { return c.Class() == 0 && c != CoAPCodeEmpty }
+
+func (c CoAPCode) String() string {
+	switch c {
+	case CoAPCodeEmpty:
+		return "Empty"
+	case CoAPCodeGET:
+		return "GET"
+	case CoAPCodePOST:
+		return "POST"
+	case CoAPCodePUT:
+		return "PUT"
+	case CoAPCodeDELETE:
+		return "DELETE"
+	case CoAPCodeFETCH:
+		return "FETCH"
+	case CoAPCodePATCH:
+		return "PATCH"
+	case CoAPCodeIPATCH:
+		return "iPATCH"
+	case CoAPCodeCreated:
+		return "2.01 Created"
+	case CoAPCodeDeleted:
+		return "2.02 Deleted"
+	case CoAPCodeValid:
+		return "2.03 Valid"
+	case CoAPCodeChanged:
+		return "2.04 Changed"
+	case CoAPCodeContent:
+		return "2.05 Content"
+	case CoAPCodeContinue:
+		return "2.31 Continue"
+	case CoAPCodeBadRequest:
+		return "4.00 Bad Request"
+	case CoAPCodeUnauthorized:
+		return "4.01 Unauthorized"
+	case CoAPCodeBadOption:
+		return "4.02 Bad Option"
+	case CoAPCodeForbidden:
+		return "4.03 Forbidden"
+	case CoAPCodeNotFound:
+		return "4.04 Not Found"
+	case CoAPCodeMethodNotAllowed:
+		return "4.05 Method Not Allowed"
+	case CoAPCodeNotAcceptable:
+		return "4.06 Not Acceptable"
+	case CoAPCodeRequestEntityIncomplete:
+		return "4.08 Request Entity Incomplete"
+	case CoAPCodePreconditionFailed:
+		return "4.12 Precondition Failed"
+	case CoAPCodeRequestEntityTooLarge:
+		return "4.13 Request Entity Too Large"
+	case CoAPCodeUnsupportedContentFormat:
+		return "4.15 Unsupported Content-Format"
+	case CoAPCodeInternalServerError:
+		return "5.00 Internal Server Error"
+	case CoAPCodeNotImplemented:
+		return "5.01 Not Implemented"
+	case CoAPCodeBadGateway:
+		return "5.02 Bad Gateway"
+	case CoAPCodeServiceUnavailable:
+		return "5.03 Service Unavailable"
+	case CoAPCodeGatewayTimeout:
+		return "5.04 Gateway Timeout"
+	case CoAPCodeProxyingNotSupported:
+		return "5.05 Proxying Not Supported"
+	default:
+		return fmt.Sprintf("%d.%02d", c.Class(), c.Detail())
+	}
+}
+
+// CoAPOptionNumber is the number of a CoAP option.
+type CoAPOptionNumber uint16
+
+// CoAP option numbers (RFC 7252, RFC 7641, RFC 7959, RFC 8613 and RFC
+// 9177).
+const (
+	CoAPOptionIfMatch       CoAPOptionNumber = 1
+	CoAPOptionURIHost       CoAPOptionNumber = 3
+	CoAPOptionETag          CoAPOptionNumber = 4
+	CoAPOptionIfNoneMatch   CoAPOptionNumber = 5
+	CoAPOptionObserve       CoAPOptionNumber = 6
+	CoAPOptionURIPort       CoAPOptionNumber = 7
+	CoAPOptionLocationPath  CoAPOptionNumber = 8
+	CoAPOptionOSCORE        CoAPOptionNumber = 9
+	CoAPOptionURIPath       CoAPOptionNumber = 11
+	CoAPOptionContentFormat CoAPOptionNumber = 12
+	CoAPOptionMaxAge        CoAPOptionNumber = 14
+	CoAPOptionURIQuery      CoAPOptionNumber = 15
+	CoAPOptionHopLimit      CoAPOptionNumber = 16
+	CoAPOptionAccept        CoAPOptionNumber = 17
+	CoAPOptionQBlock1       CoAPOptionNumber = 19
+	CoAPOptionLocationQuery CoAPOptionNumber = 20
+	CoAPOptionBlock2        CoAPOptionNumber = 23
+	CoAPOptionBlock1        CoAPOptionNumber = 27
+	CoAPOptionSize2         CoAPOptionNumber = 28
+	CoAPOptionQBlock2       CoAPOptionNumber = 31
+	CoAPOptionProxyURI      CoAPOptionNumber = 35
+	CoAPOptionProxyScheme   CoAPOptionNumber = 39
+	CoAPOptionSize1         CoAPOptionNumber = 60
+	CoAPOptionNoResponse    CoAPOptionNumber = 258
+)
+
+func (n CoAPOptionNumber) String() string {
+	switch n {
+	case CoAPOptionIfMatch:
+		return "If-Match"
+	case CoAPOptionURIHost:
+		return "Uri-Host"
+	case CoAPOptionETag:
+		return "ETag"
+	case CoAPOptionIfNoneMatch:
+		return "If-None-Match"
+	case CoAPOptionObserve:
+		return "Observe"
+	case CoAPOptionURIPort:
+		return "Uri-Port"
+	case CoAPOptionLocationPath:
+		return "Location-Path"
+	case CoAPOptionOSCORE:
+		return "OSCORE"
+	case CoAPOptionURIPath:
+		return "Uri-Path"
+	case CoAPOptionContentFormat:
+		return "Content-Format"
+	case CoAPOptionMaxAge:
+		return "Max-Age"
+	case CoAPOptionURIQuery:
+		return "Uri-Query"
+	case CoAPOptionHopLimit:
+		return "Hop-Limit"
+	case CoAPOptionAccept:
+		return "Accept"
+	case CoAPOptionQBlock1:
+		return "Q-Block1"
+	case CoAPOptionLocationQuery:
+		return "Location-Query"
+	case CoAPOptionBlock2:
+		return "Block2"
+	case CoAPOptionBlock1:
+		return "Block1"
+	case CoAPOptionSize2:
+		return "Size2"
+	case CoAPOptionQBlock2:
+		return "Q-Block2"
+	case CoAPOptionProxyURI:
+		return "Proxy-Uri"
+	case CoAPOptionProxyScheme:
+		return "Proxy-Scheme"
+	case CoAPOptionSize1:
+		return "Size1"
+	case CoAPOptionNoResponse:
+		return "No-Response"
+	default:
+		return fmt.Sprintf("UnknownCoAPOption(%d)", n)
+	}
+}
+
+// Critical returns true if an endpoint that doesn't understand the option
+// must reject the message.
+func (n CoAPOptionNumber) Critical() bool { return n&1 != 0 }
+
+// CoAPContentFormat is the media type and encoding of a CoAP payload, as
+// given by the Content-Format and Accept options.
+type CoAPContentFormat uint16
+
+// Common CoAP content formats.
+const (
+	CoAPContentFormatTextPlain   CoAPContentFormat = 0
+	CoAPContentFormatLinkFormat  CoAPContentFormat = 40
+	CoAPContentFormatXML         CoAPContentFormat = 41
+	CoAPContentFormatOctetStream CoAPContentFormat = 42
+	CoAPContentFormatEXI         CoAPContentFormat = 47
+	CoAPContentFormatJSON        CoAPContentFormat = 50
+	CoAPContentFormatCBOR        CoAPContentFormat = 60
+	CoAPContentFormatSenMLJSON   CoAPContentFormat = 110
+	CoAPContentFormatSenMLCBOR   CoAPContentFormat = 112
+	CoAPContentFormatLwM2MTLV    CoAPContentFormat = 11542
+	CoAPContentFormatLwM2MJSON   CoAPContentFormat = 11543
+)
+
+func (f CoAPContentFormat) String() string {
+	switch f {
+	case CoAPContentFormatTextPlain:
+		return "text/plain;charset=utf-8"
+	case CoAPContentFormatLinkFormat:
+		return "application/link-format"
+	case CoAPContentFormatXML:
+		return "application/xml"
+	case CoAPContentFormatOctetStream:
+		return "application/octet-stream"
+	case CoAPContentFormatEXI:
+		return "application/exi"
+	case CoAPContentFormatJSON:
+		return "application/json"
+	case CoAPContentFormatCBOR:
+		return "application/cbor"
+	case CoAPContentFormatSenMLJSON:
+		return "application/senml+json"
+	case CoAPContentFormatSenMLCBOR:
+		return "application/senml+cbor"
+	case CoAPContentFormatLwM2MTLV:
+		return "application/vnd.oma.lwm2m+tlv"
+	case CoAPContentFormatLwM2MJSON:
+		return "application/vnd.oma.lwm2m+json"
+	default:
+		return fmt.Sprintf("UnknownCoAPContentFormat(%d)", f)
+	}
+}
+
+// CoAPOption is an option of a CoAP message.
+type CoAPOption struct {
+	Number CoAPOptionNumber
+	Value  []byte
+}
+
+// Uint returns the value of an option holding an unsigned integer, like
+// Content-Format or Observe, which is sent in as few bytes as needed.
+func (o CoAPOption) Uint() (uint32, error) {
+	if len(o.Value) > 4 {
+		return 0, fmt.Errorf("CoAP %v option of %d bytes isn't an integer", o.Number, len(o.Value))
+	}
+	var v uint32
+	for _, b := range o.Value {
+		v = v<<8 | uint32(b)
+	}
+	return v, nil
+}
+
+// CoAPBlock is the value of a Block1 or Block2 option (RFC 7959), which
+// describes one block of a body sent in several messages.
+type CoAPBlock struct {
+	// Num is the number of the block, counting from zero.
+	Num uint32
+	// More is set if further blocks follow.
+	More bool
+	// Size is the block size in bytes, a power of two from 16 to 1024, or
+	// 1024 for the BERT blocks of CoAP over TCP.
+	Size int
+}
+
+// Offset returns the offset in the body of the block.
+func (b CoAPBlock) Offset() int { return int(b.Num) * b.Size }
+
+// CoAP is a CoAP message over UDP (RFC 7252), the REST protocol of
+// constrained devices.  The payload is the message body, whose format is
+// given by the Content-Format option.
+type CoAP struct {
+	BaseLayer
+	Version     uint8
+	Type        CoAPType
+	TokenLength uint8
+	Code        CoAPCode
+	MessageID   uint16
+	Token       []byte
+	// Options are in the order of the message, which is by number.
+	Options []CoAPOption
+}
+
+// LayerType returns LayerTypeCoAP.
+func (c *CoAP) LayerType() gopacket.LayerType { return LayerTypeCoAP }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (c *CoAP) CanDecode() gopacket.LayerClass { return LayerTypeCoAP }
+
+// NextLayerType returns LayerTypePayload if there is a payload.
+func (c *CoAP) NextLayerType() gopacket.LayerType {
+	if len(c.BaseLayer.Payload) == 0 {
+		return gopacket.LayerTypeZero
+	}
+	return gopacket.LayerTypePayload
+}
+
+// Payload returns the message body.
+func (c *CoAP) Payload() []byte { return c.BaseLayer.Payload }
+
+// Option returns the first option with the given number.
+func (c *CoAP) Option(n CoAPOptionNumber) (CoAPOption, bool) {
+	for _, o := range c.Options {
+		if o.Number == n {
+			return o, true
+		}
+	}
+	return CoAPOption{}, false
+}
+
+// OptionValues returns the values of every option with the given number,
+// which may repeat, like Uri-Path.
+func (c *CoAP) OptionValues(n CoAPOptionNumber) [][]byte {
+	var out [][]byte
+	for _, o := range c.Options {
+		if o.Number == n {
+			out = append(out, o.Value)
+		}
+	}
+	return out
+}
+
+// URIPath returns the path of a request's resource, from its Uri-Path
+// options.  It's "/" if there are none.
+func (c *CoAP) URIPath() string {
+	var segs []string
+	for _, v := range c.OptionValues(CoAPOptionURIPath) {
+		segs = append(segs, string(v))
+	}
+	return "/" + strings.Join(segs, "/")
+}
+
+// URIQuery returns the arguments of a request's Uri-Query options.
+func (c *CoAP) URIQuery() []string {
+	var out []string
+	for _, v := range c.OptionValues(CoAPOptionURIQuery) {
+		out = append(out, string(v))
+	}
+	return out
+}
+
+// ContentFormat returns the format of the payload.
+func (c *CoAP) ContentFormat() (CoAPContentFormat, bool) {
+	o, ok := c.Option(CoAPOptionContentFormat)
+	if !ok {
+		return 0, false
+	}
+	v, err := o.Uint()
+	return CoAPContentFormat(v), err == nil
+}
+
+// Observe returns the value of the Observe option (RFC 7641): 0 to
+// register and 1 to deregister in requests, and a sequence number in
+// notifications.
+func (c *CoAP) Observe() (uint32, bool) {
+	o, ok := c.Option(CoAPOptionObserve)
+	if !ok {
+		return 0, false
+	}
+	v, err := o.Uint()
+	return v, err == nil
+}
+
+// Block returns the value of the Block1 or Block2 option.
+func (c *CoAP) Block(n CoAPOptionNumber) (CoAPBlock, error) {
+	o, ok := c.Option(n)
+	if !ok {
+		return CoAPBlock{}, fmt.Errorf("CoAP message has no %v option", n)
+	}
+	v, err := o.Uint()
+	if err != nil || len(o.Value) > 3 {
+		return CoAPBlock{}, fmt.Errorf("CoAP %v option of %d bytes invalid", n, len(o.Value))
+	}
+	szx := v & 7
+	if szx == 7 {
+		// BERT, only over TCP.
+		szx = 6
+	}
+	return CoAPBlock{Num: v >> 4, More: v&8 != 0, Size: 16 << szx}, nil
+}
+
+func decodeCoAP(data []byte, p gopacket.PacketBuilder) error {
+	c := &CoAP{}
+	if err := c.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(c)
+	p.SetApplicationLayer(c)
+	next := c.NextLayerType()
+	if next == gopacket.LayerTypeZero {
+		return nil
+	}
+	return p.NextDecoder(next)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (c *CoAP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return fmt.Errorf("CoAP message of %d bytes too short", len(data))
+	}
+	c.Version = data[0] >> 6
+	if c.Version != 1 {
+		return fmt.Errorf("CoAP version %d unsupported", c.Version)
+	}
+	c.Type = CoAPType(data[0] >> 4 & 3)
+	c.TokenLength = data[0] & 0x0f
+	c.Code = CoAPCode(data[1])
+	c.MessageID = uint16(data[2])<<8 | uint16(data[3])
+	if c.TokenLength > 8 {
+		return fmt.Errorf("CoAP token length %d invalid", c.TokenLength)
+	}
+	n := 4 + int(c.TokenLength)
+	if len(data) < n {
+		df.SetTruncated()
+		return errors.New("CoAP token truncated")
+	}
+	c.Token = data[4:n]
+	if c.Code == CoAPCodeEmpty && len(data) > 4 {
+		return errors.New("CoAP empty message has a token, options or payload")
+	}
+
+	c.Options = c.Options[:0]
+	var num int
+	rest := data[n:]
+	for len(rest) > 0 && rest[0] != 0xff {
+		delta, l := int(rest[0]>>4), int(rest[0]&0x0f)
+		rest = rest[1:]
+		var err error
+		if delta, rest, err = decodeCoAPOptionExt(delta, rest); err != nil {
+			return fmt.Errorf("CoAP option delta invalid: %v", err)
+		}
+		if l, rest, err = decodeCoAPOptionExt(l, rest); err != nil {
+			return fmt.Errorf("CoAP option length invalid: %v", err)
+		}
+		num += delta
+		if num > 0xffff {
+			return fmt.Errorf("CoAP option number %d invalid", num)
+		}
+		if len(rest) < l {
+			return fmt.Errorf("CoAP %v option length %d exceeds %d bytes", CoAPOptionNumber(num), l, len(rest))
+		}
+		c.Options = append(c.Options, CoAPOption{Number: CoAPOptionNumber(num), Value: rest[:l]})
+		rest = rest[l:]
+	}
+	var payload []byte
+	if len(rest) > 0 {
+		// The payload marker must be followed by a payload.
+		if len(rest) == 1 {
+			return errors.New("CoAP payload marker without payload")
+		}
+		payload = rest[1:]
+	}
+	c.BaseLayer = BaseLayer{Contents: data[:len(data)-len(payload)], Payload: payload}
+	return nil
+}
+
+// decodeCoAPOptionExt decodes the extended option delta or length that
+// follows the option header for the 4 bit values 13 and 14.  15 is
+// reserved for the payload marker.
+func decodeCoAPOptionExt(v int, data []byte) (int, []byte, error) {
+	switch v {
+	case 13:
+		if len(data) < 1 {
+			return 0, nil, errors.New("truncated")
+		}
+		return int(data[0]) + 13, data[1:], nil
+	case 14:
+		if len(data) < 2 {
+			return 0, nil, errors.New("truncated")
+		}
+		return (int(data[0])<<8 | int(data[1])) + 269, data[2:], nil
+	case 15:
+		return 0, nil, errors.New("reserved value 15")
+	}
+	return v, data, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testCoAPObserve is a confirmable GET of /sensors/temp?u=c registering
+// for notifications, asking for 64 byte blocks of a JSON response.
+var testCoAPObserve = []byte{
+	0x42, 0x01, 0x12, 0x34, 0xab, 0xcd,
+	0x60,                                    // Observe, empty value (0)
+	0x57, 's', 'e', 'n', 's', 'o', 'r', 's', // Uri-Path
+	0x04, 't', 'e', 'm', 'p', // Uri-Path
+	0x43, 'u', '=', 'c', // Uri-Query
+	0x21, 0x32, // Accept: application/json
+	0x61, 0x02, // Block2: 0/0/64
+	0xd1, 0xde, 0x1a, // No-Response (258): 26
+}
+
+// testCoAPContent is the piggybacked response: a notification with block 1
+// of the body, more to follow.
+var testCoAPContent = []byte{
+	0x62, 0x45, 0x12, 0x34, 0xab, 0xcd,
+	0x61, 0x05, // Observe: 5
+	0x61, 0x32, // Content-Format: application/json
+	0xb1, 0x1a, // Block2: 1/1/64
+	0x51, 0x04, // Size2 (28): 4
+	0xff, '{', '}', ' ', ' ',
+}
+
+func TestCoAPObserve(t *testing.T) {
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 2}, DstIP: net.IP{10, 0, 0, 9}}
+	udp := &UDP{SrcPort: 40000, DstPort: 5683}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload(testCoAPObserve)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeCoAP}, t)
+	c := p.Layer(LayerTypeCoAP).(*CoAP)
+	if c.Type != CoAPTypeConfirmable || c.Code != CoAPCodeGET || !c.Code.IsRequest() || c.MessageID != 0x1234 || !bytes.Equal(c.Token, []byte{0xab, 0xcd}) {
+		t.Errorf("got header %+v", c)
+	}
+	if got := c.URIPath(); got != "/sensors/temp" {
+		t.Errorf("got path %q", got)
+	}
+	if got := c.URIQuery(); !reflect.DeepEqual(got, []string{"u=c"}) {
+		t.Errorf("got query %q", got)
+	}
+	if obs, ok := c.Observe(); !ok || obs != 0 {
+		t.Errorf("got Observe %d, %v", obs, ok)
+	}
+	if o, _ := c.Option(CoAPOptionAccept); o.Number != CoAPOptionAccept || len(o.Value) != 1 || CoAPContentFormat(o.Value[0]) != CoAPContentFormatJSON {
+		t.Errorf("got Accept %+v", o)
+	}
+	if b, err := c.Block(CoAPOptionBlock2); err != nil || b != (CoAPBlock{Num: 0, More: false, Size: 64}) {
+		t.Errorf("got Block2 %+v, %v", b, err)
+	}
+	if o, ok := c.Option(CoAPOptionNoResponse); !ok || !bytes.Equal(o.Value, []byte{26}) {
+		t.Errorf("got No-Response %+v", o)
+	}
+	if _, err := c.Block(CoAPOptionBlock1); err == nil {
+		t.Error("got Block1 from request without one")
+	}
+
+	var r CoAP
+	if err := r.DecodeFromBytes(testCoAPContent, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if r.Type != CoAPTypeAcknowledgement || r.Code != CoAPCodeContent || r.Code.String() != "2.05 Content" || r.Code.IsRequest() {
+		t.Errorf("got %v %v", r.Type, r.Code)
+	}
+	if f, ok := r.ContentFormat(); !ok || f != CoAPContentFormatJSON {
+		t.Errorf("got Content-Format %v", f)
+	}
+	if b, err := r.Block(CoAPOptionBlock2); err != nil || b != (CoAPBlock{Num: 1, More: true, Size: 64}) || b.Offset() != 64 {
+		t.Errorf("got Block2 %+v, %v", b, err)
+	}
+	if o, ok := r.Option(CoAPOptionSize2); !ok || !bytes.Equal(o.Value, []byte{4}) {
+		t.Errorf("got Size2 %+v", o)
+	}
+	if !bytes.Equal(r.Payload(), []byte("{}  ")) || r.NextLayerType() != gopacket.LayerTypePayload {
+		t.Errorf("got payload %q", r.Payload())
+	}
+}
+
+func TestCoAPMalformed(t *testing.T) {
+	for _, b := range [][]byte{
+		{0x40, 0x01, 0x00},
+		{0x80, 0x01, 0x00, 0x01},
+		{0x49, 0x01, 0x00, 0x01, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{0x42, 0x01, 0x00, 0x01, 0xab},
+		{0x41, 0x00, 0x00, 0x01, 0xab},
+		{0x40, 0x01, 0x00, 0x01, 0xb3, 'a'},
+		{0x40, 0x01, 0x00, 0x01, 0xd1},
+		{0x40, 0x01, 0x00, 0x01, 0xf0},
+		{0x40, 0x01, 0x00, 0x01, 0xff},
+	} {
+		if err := (&CoAP{}).DecodeFromBytes(b, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("decoded %x without error", b)
+		}
+	}
+	var c CoAP
+	if err := c.DecodeFromBytes([]byte{0x70, 0x00, 0x00, 0x07}, gopacket.NilDecodeFeedback); err != nil || c.Type != CoAPTypeReset {
+		t.Errorf("reset message: %v, %+v", err, c)
+	}
+}
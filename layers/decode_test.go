@@ -690,6 +690,17 @@ func TestDecodeCiscoDiscovery(t *testing.T) {
 	if !reflect.DeepEqual(info, want) {
 		t.Errorf("Values mismatch, \ngot  %#v\nwant %#v\n", info, want)
 	}
+
+	// The sample's TLVs are in type order, so serializing the decoded
+	// fields reproduces it, including its odd length checksum.
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, &CiscoDiscovery{Version: 2, TTL: 180}, info); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.Bytes(); !bytes.Equal(got, data[22:]) {
+		t.Errorf("serialization mismatch:\ngot  %x\nwant %x", got, data[22:])
+	}
 }
 
 func TestDecodeLinkLayerDiscovery(t *testing.T) {
@@ -1030,7 +1041,7 @@ func TestICMP6(t *testing.T) {
 	if p.ErrorLayer() != nil {
 		t.Error("Failed to decode packet:", p.ErrorLayer().Error())
 	}
-	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeIPv6, LayerTypeICMPv6, gopacket.LayerTypePayload}, t)
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeIPv6, LayerTypeICMPv6, LayerTypeICMPv6NeighborSolicitation}, t)
 	testSerialization(t, p, testICMP6)
 }
 func BenchmarkDecodeICMP6(b *testing.B) {
@@ -1102,7 +1113,7 @@ func TestPPPoE_ICMPv6(t *testing.T) {
 		LayerTypePPP,
 		LayerTypeIPv6,
 		LayerTypeICMPv6,
-		gopacket.LayerTypePayload,
+		LayerTypeICMPv6NeighborAdvertisement,
 	}, t)
 	testSerialization(t, p, testPPPoE_ICMPv6)
 }
@@ -1179,10 +1190,15 @@ func TestPacketMPLSInMPLS(t *testing.T) {
 	checkLayers(p, []gopacket.LayerType{
 		LayerTypeEthernet,
 		LayerTypeMPLS,
-		LayerTypeMPLS,
 		LayerTypeIPv4,
 		LayerTypeICMPv4,
 		gopacket.LayerTypePayload}, t)
+	mpls := p.Layer(LayerTypeMPLS).(*MPLS)
+	want := []MPLSLabel{{Label: 18, TTL: 255}, {Label: 16, StackBottom: true, TTL: 255}}
+	if !reflect.DeepEqual(mpls.Stack, want) || mpls.Label != 18 {
+		t.Errorf("got label stack %+v, want %+v", mpls.Stack, want)
+	}
+	testSerialization(t, p, testPacketMPLSInMPLS)
 }
 
 // testPacketIPv4Fragmented is the packet:
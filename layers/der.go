@@ -0,0 +1,213 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ASN.1 tag classes.
+const (
+	derClassUniversal   = 0
+	derClassApplication = 1
+	derClassContext     = 2
+)
+
+// ASN.1 universal tags.
+const (
+	derTagInteger         = 2
+	derTagBitString       = 3
+	derTagOctetString     = 4
+	derTagSequence        = 16
+	derTagGeneralizedTime = 24
+)
+
+// derValue is an ASN.1 value in DER: its tag, and the bytes of its
+// contents.
+type derValue struct {
+	class       int
+	constructed bool
+	tag         int
+	bytes       []byte
+}
+
+// readDER reads the value at the start of b, and returns it and the bytes
+// following it.  DER forbids indefinite lengths, so they aren't supported.
+func readDER(b []byte) (v derValue, rest []byte, err error) {
+	if len(b) < 2 {
+		return v, nil, errors.New("ASN.1 value truncated")
+	}
+	v.class = int(b[0] >> 6)
+	v.constructed = b[0]&0x20 != 0
+	v.tag = int(b[0] & 0x1f)
+	i := 1
+	if v.tag == 0x1f {
+		// High tag number form.
+		v.tag = 0
+		for {
+			if i == len(b) || i > 4 {
+				return v, nil, errors.New("ASN.1 tag invalid")
+			}
+			v.tag = v.tag<<7 | int(b[i]&0x7f)
+			i++
+			if b[i-1]&0x80 == 0 {
+				break
+			}
+		}
+	}
+	if i == len(b) {
+		return v, nil, errors.New("ASN.1 value truncated")
+	}
+	n := int(b[i])
+	i++
+	if n&0x80 != 0 {
+		k := n & 0x7f
+		if k == 0 {
+			return v, nil, errors.New("ASN.1 indefinite length not allowed in DER")
+		}
+		if k > 4 || len(b) < i+k {
+			return v, nil, errors.New("ASN.1 length invalid")
+		}
+		n = 0
+		for _, c := range b[i : i+k] {
+			n = n<<8 | int(c)
+		}
+		i += k
+	}
+	if n < 0 || len(b)-i < n {
+		return v, nil, fmt.Errorf("ASN.1 length %d exceeds %d bytes available", n, len(b)-i)
+	}
+	v.bytes = b[i : i+n]
+	return v, b[i+n:], nil
+}
+
+// readDERExpect reads the value at the start of b, which must have the
+// given class and tag, and fails if other bytes follow it.
+func readDERExpect(b []byte, class, tag int) (derValue, error) {
+	v, rest, err := readDER(b)
+	if err != nil {
+		return v, err
+	}
+	if v.class != class || v.tag != tag {
+		return v, fmt.Errorf("ASN.1 tag %d of class %d, want %d of class %d", v.tag, v.class, tag, class)
+	}
+	if len(rest) > 0 {
+		return v, fmt.Errorf("ASN.1 value followed by %d bytes", len(rest))
+	}
+	return v, nil
+}
+
+// children returns the values making up the contents of a constructed
+// value, like the elements of a SEQUENCE.
+func (v derValue) children() ([]derValue, error) {
+	var out []derValue
+	for b := v.bytes; len(b) > 0; {
+		c, rest, err := readDER(b)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+		b = rest
+	}
+	return out, nil
+}
+
+// fields returns the fields of a SEQUENCE whose elements are explicitly
+// tagged, as most protocols defined in ASN.1 use, by tag number.  Each
+// field is the value inside its tag.
+func (v derValue) fields() (map[int]derValue, error) {
+	if v.class != derClassUniversal || v.tag != derTagSequence {
+		return nil, fmt.Errorf("ASN.1 tag %d of class %d isn't a SEQUENCE", v.tag, v.class)
+	}
+	cs, err := v.children()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[int]derValue, len(cs))
+	for _, c := range cs {
+		if c.class != derClassContext {
+			return nil, fmt.Errorf("ASN.1 SEQUENCE element of class %d isn't tagged", c.class)
+		}
+		inner, rest, err := readDER(c.bytes)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) > 0 {
+			return nil, fmt.Errorf("ASN.1 field [%d] followed by %d bytes", c.tag, len(rest))
+		}
+		out[c.tag] = inner
+	}
+	return out, nil
+}
+
+func (v derValue) check(tag int) error {
+	if v.class != derClassUniversal || v.tag != tag {
+		return fmt.Errorf("ASN.1 tag %d of class %d, want universal tag %d", v.tag, v.class, tag)
+	}
+	return nil
+}
+
+// int returns the value of an INTEGER.
+func (v derValue) int() (int64, error) {
+	if err := v.check(derTagInteger); err != nil {
+		return 0, err
+	}
+	if len(v.bytes) == 0 || len(v.bytes) > 8 {
+		return 0, fmt.Errorf("ASN.1 INTEGER of %d bytes", len(v.bytes))
+	}
+	n := int64(int8(v.bytes[0]))
+	for _, c := range v.bytes[1:] {
+		n = n<<8 | int64(c)
+	}
+	return n, nil
+}
+
+// string returns the value of a character string of any of the types
+// ASN.1 defines.
+func (v derValue) string() (string, error) {
+	if v.class != derClassUniversal || v.constructed {
+		return "", fmt.Errorf("ASN.1 tag %d of class %d isn't a string", v.tag, v.class)
+	}
+	return string(v.bytes), nil
+}
+
+// octets returns the value of an OCTET STRING.
+func (v derValue) octets() ([]byte, error) {
+	if err := v.check(derTagOctetString); err != nil {
+		return nil, err
+	}
+	return v.bytes, nil
+}
+
+// bitString returns the bits of a BIT STRING, without the count of unused
+// bits.
+func (v derValue) bitString() ([]byte, error) {
+	if err := v.check(derTagBitString); err != nil {
+		return nil, err
+	}
+	if len(v.bytes) == 0 || v.bytes[0] > 7 {
+		return nil, errors.New("ASN.1 BIT STRING invalid")
+	}
+	return v.bytes[1:], nil
+}
+
+// time returns the value of a GeneralizedTime, which DER requires be in
+// UTC.
+func (v derValue) time() (time.Time, error) {
+	if err := v.check(derTagGeneralizedTime); err != nil {
+		return time.Time{}, err
+	}
+	s := string(v.bytes)
+	for _, layout := range []string{"20060102150405Z", "20060102150405.999999999Z"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("ASN.1 GeneralizedTime %q invalid", s)
+}
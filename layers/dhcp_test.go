@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"reflect"
 	"testing"
 
 	"github.com/mistsys/gopacket"
@@ -67,6 +68,29 @@ func TestDHCPv4EncodeResponse(t *testing.T) {
 	fmt.Print(p2)
 }
 
+func TestDHCPv4EncodeDeterministic(t *testing.T) {
+	// ServerName, File and the padding after the options are left unset.
+	dhcp := &DHCPv4{Operation: DHCPOpRequest, HardwareType: LinkTypeEthernet, Xid: 0x12345678,
+		ClientHWAddr: net.HardwareAddr{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc}}
+	dhcp.Options = append(dhcp.Options, NewDHCPOption(DHCPOptMessageType, []byte{byte(DHCPMsgTypeDiscover)}))
+
+	opts := gopacket.SerializeOptions{FixLengths: true, Deterministic: true}
+	fresh := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(fresh, opts, dhcp); err != nil {
+		t.Fatal(err)
+	}
+	reused := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(reused, opts, gopacket.Payload(bytes.Repeat([]byte{0xff}, 400))); err != nil {
+		t.Fatal(err)
+	}
+	if err := gopacket.SerializeLayers(reused, opts, dhcp); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fresh.Bytes(), reused.Bytes()) {
+		t.Errorf("serialization depends on the buffer:\n%x\n%x", fresh.Bytes(), reused.Bytes())
+	}
+}
+
 func testDHCPEqual(t *testing.T, d1, d2 *DHCPv4) {
 	if d1.Operation != d2.Operation {
 		t.Errorf("expected Operation=%s, got %s", d1.Operation, d2.Operation)
@@ -127,3 +151,135 @@ func testDHCPOptionEqual(t *testing.T, idx int, d1, d2 DHCPOption) {
 		t.Errorf("expection Options[%d].Data to be = %v, got %v", idx, d1.Data, d2.Data)
 	}
 }
+
+func TestDHCPv4Options(t *testing.T) {
+	dhcp := &DHCPv4{Operation: DHCPOpRequest, HardwareType: LinkTypeEthernet, Xid: 1,
+		ClientHWAddr: net.HardwareAddr{0x02, 0, 0, 0, 0, 1}}
+	dhcp.Options = append(dhcp.Options, NewDHCPOption(DHCPOptMessageType, []byte{byte(DHCPMsgTypeRequest)}))
+	dhcp.Options = append(dhcp.Options, NewDHCPOption(DHCPOptClassID, []byte("MSFT 5.0")))
+	dhcp.Options = append(dhcp.Options, NewDHCPOption(DHCPOptHostname, []byte("desktop-1")))
+	dhcp.Options = append(dhcp.Options, NewDHCPOption(DHCPOptParamsRequest, []byte{1, 3, 6, 15, 31, 33, 43, 44, 46, 47, 119, 121, 249, 252}))
+	dhcp.Options = append(dhcp.Options, NewDHCPOption(DHCPOptRelayAgentInfo, []byte{1, 3, 'g', 'e', '1', 2, 2, 0xab, 0xcd}))
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, dhcp); err != nil {
+		t.Fatal(err)
+	}
+	// Pad options between others are skipped.
+	data := buf.Bytes()
+	data = append(data[:243:243], append([]byte{0, 0}, data[243:]...)...)
+	p := gopacket.NewPacket(data, LayerTypeDHCPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	d := p.Layer(LayerTypeDHCPv4).(*DHCPv4)
+	if len(d.Options) != len(dhcp.Options) {
+		t.Fatalf("got options %v, want %v", d.Options, dhcp.Options)
+	}
+	for i, o := range dhcp.Options {
+		testDHCPOptionEqual(t, i, o, d.Options[i])
+	}
+	if mt := d.MessageType(); mt != DHCPMsgTypeRequest {
+		t.Errorf("got message type %v, want Request", mt)
+	}
+	if d.ClassID() != "MSFT 5.0" || d.Hostname() != "desktop-1" {
+		t.Errorf("got class ID %q and hostname %q", d.ClassID(), d.Hostname())
+	}
+	params := d.ParamsRequest()
+	if len(params) != 14 || params[0] != DHCPOptSubnetMask || params[13] != 252 {
+		t.Errorf("got parameter request list %v", params)
+	}
+	r := d.RelayAgentInfo
+	if r == nil || string(r.CircuitID) != "ge1" || !bytes.Equal(r.RemoteID, []byte{0xab, 0xcd}) {
+		t.Errorf("got relay agent information %+v", r)
+	}
+}
+
+func TestDHCPv4RelayAgentInfo(t *testing.T) {
+	info := &DHCPRelayAgentInfo{
+		CircuitID:     []byte("vlan10:ge-0/0/1"),
+		RemoteID:      []byte{0x02, 0, 0, 0, 0, 9},
+		LinkSelection: net.IP{10, 1, 2, 0},
+		SubscriberID:  []byte("sub-1234"),
+		VendorSpecific: []DHCPVendorInfo{
+			{EnterpriseNumber: 3561, Data: []byte{1, 2, 'a', 'b'}},
+			{EnterpriseNumber: 9, Data: []byte{}},
+		},
+		Other: []DHCPSubOption{{Code: 151, Data: []byte{0, 'v', 'r', 'f'}}},
+	}
+	dhcp := &DHCPv4{Operation: DHCPOpRequest, HardwareType: LinkTypeEthernet, Xid: 2,
+		ClientHWAddr: net.HardwareAddr{0x02, 0, 0, 0, 0, 1}, RelayAgentIP: net.IP{10, 1, 2, 1},
+		RelayAgentInfo: info}
+	// RelayAgentInfo replaces option 82 in Options, in its place.
+	dhcp.Options = append(dhcp.Options, NewDHCPOption(DHCPOptRelayAgentInfo, []byte{1, 1, 'x'}))
+	dhcp.Options = append(dhcp.Options, NewDHCPOption(DHCPOptMessageType, []byte{byte(DHCPMsgTypeDiscover)}))
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, dhcp); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeDHCPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	d := p.Layer(LayerTypeDHCPv4).(*DHCPv4)
+	if len(d.Options) != 2 || d.Options[0].Type != DHCPOptRelayAgentInfo || d.Options[1].Type != DHCPOptMessageType {
+		t.Fatalf("got options %v", d.Options)
+	}
+	if !reflect.DeepEqual(d.RelayAgentInfo, info) {
+		t.Errorf("got relay agent information %+v, want %+v", d.RelayAgentInfo, info)
+	}
+
+	// A decoded option 82 is written back as it was, sub-options in their
+	// order, unless RelayAgentInfo changes, and then in the same place.
+	dhcp = &DHCPv4{Operation: DHCPOpRequest, HardwareType: LinkTypeEthernet, Xid: 3,
+		ClientHWAddr: net.HardwareAddr{0x02, 0, 0, 0, 0, 1}}
+	dhcp.Options = append(dhcp.Options, NewDHCPOption(DHCPOptRelayAgentInfo, []byte{2, 1, 'r', 1, 1, 'c'}))
+	dhcp.Options = append(dhcp.Options, NewDHCPOption(DHCPOptMessageType, []byte{byte(DHCPMsgTypeDiscover)}))
+	buf = gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, dhcp); err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte{}, buf.Bytes()...)
+	d = gopacket.NewPacket(want, LayerTypeDHCPv4, testDecodeOptions).Layer(LayerTypeDHCPv4).(*DHCPv4)
+	buf = gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, d); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got %x, want %x", buf.Bytes(), want)
+	}
+	d.RelayAgentInfo.CircuitID = []byte("ge2")
+	buf = gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, d); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.Bytes()[240:253]; !bytes.Equal(got, []byte{82, 8, 1, 3, 'g', 'e', '2', 2, 1, 'r', 53, 1, 1}) {
+		t.Errorf("got options %x", got)
+	}
+
+	for _, data := range [][]byte{
+		{1, 5, 'a'},
+		{5, 2, 10, 1},
+		{9, 6, 0, 0, 0, 9, 3, 1},
+	} {
+		if err := (&DHCPRelayAgentInfo{}).decode(data); err == nil {
+			t.Errorf("decoded %x without error", data)
+		}
+	}
+
+	// A malformed option 82 is only a warning.
+	dhcp = &DHCPv4{Operation: DHCPOpRequest, HardwareType: LinkTypeEthernet, Xid: 4,
+		ClientHWAddr: net.HardwareAddr{0x02, 0, 0, 0, 0, 1}}
+	dhcp.Options = append(dhcp.Options, NewDHCPOption(DHCPOptRelayAgentInfo, []byte{1, 5, 'a'}))
+	buf = gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, dhcp); err != nil {
+		t.Fatal(err)
+	}
+	p = gopacket.NewPacket(buf.Bytes(), LayerTypeDHCPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	d = p.Layer(LayerTypeDHCPv4).(*DHCPv4)
+	if d.RelayAgentInfo != nil || len(d.Options) != 1 || len(p.Metadata().Warnings) != 1 {
+		t.Errorf("got relay agent information %+v, options %v, warnings %v", d.RelayAgentInfo, d.Options, p.Metadata().Warnings)
+	}
+}
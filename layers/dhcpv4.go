@@ -100,6 +100,16 @@ type DHCPv4 struct {
 	ServerName   []byte
 	File         []byte
 	Options      DHCPOptions
+	// RelayAgentInfo holds the sub-options of the relay agent information
+	// option, 82, or is nil if there is none or it's malformed; the option
+	// itself stays in Options.  If it's set or changed, SerializeTo encodes
+	// it in place of option 82 in Options, or as the last option, as relay
+	// agents add it, if there is none.
+	RelayAgentInfo *DHCPRelayAgentInfo
+
+	// relayAgentInfo is the encoding of RelayAgentInfo as decoded, to tell
+	// whether it has changed since.
+	relayAgentInfo []byte
 }
 
 // DHCPOptions is used to get nicely printed option lists which would normally
@@ -143,6 +153,8 @@ func (d *DHCPv4) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error
 		return errors.New("Bad DHCP header")
 	}
 
+	d.Options = d.Options[:0]
+	d.RelayAgentInfo, d.relayAgentInfo = nil, nil
 	if len(data) <= 240 {
 		// DHCP Packet could have no option (??)
 		return nil
@@ -160,26 +172,77 @@ func (d *DHCPv4) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error
 		if o.Type == DHCPOptEnd {
 			break
 		}
+		if o.Type == DHCPOptPad {
+			start++
+			continue
+		}
 		d.Options = append(d.Options, o)
 		start += int(o.Length) + 2
 	}
+	if o, ok := d.Option(DHCPOptRelayAgentInfo); ok {
+		info := &DHCPRelayAgentInfo{}
+		if err := info.decode(o.Data); err != nil {
+			gopacket.AddWarning(df, fmt.Errorf("DHCP relay agent information invalid: %v", err))
+		} else {
+			d.RelayAgentInfo = info
+			d.relayAgentInfo, _ = info.encode()
+		}
+	}
 	return nil
 }
 
 // Len returns the length of a DHCPv4 packet.
 func (d *DHCPv4) Len() uint16 {
 	n := uint16(240)
-	for _, o := range d.Options {
+	options, _ := d.serializedOptions()
+	for _, o := range options {
 		n += uint16(o.Length) + 2
 	}
 	n++ // for opt end
 	return n
 }
 
+// serializedOptions returns the options SerializeTo writes: Options, in
+// order, with option 82 encoded from RelayAgentInfo if that was set or
+// changed since decoding.
+func (d *DHCPv4) serializedOptions() ([]DHCPOption, error) {
+	if d.RelayAgentInfo == nil {
+		return d.Options, nil
+	}
+	data, err := d.RelayAgentInfo.encode()
+	if err != nil {
+		return nil, err
+	}
+	if d.relayAgentInfo != nil && bytes.Equal(data, d.relayAgentInfo) {
+		if _, ok := d.Option(DHCPOptRelayAgentInfo); ok {
+			return d.Options, nil
+		}
+	}
+	opt := NewDHCPOption(DHCPOptRelayAgentInfo, data)
+	options := make([]DHCPOption, 0, len(d.Options)+1)
+	found := false
+	for _, o := range d.Options {
+		if o.Type != DHCPOptRelayAgentInfo {
+			options = append(options, o)
+		} else if !found {
+			options = append(options, opt)
+			found = true
+		}
+	}
+	if !found {
+		options = append(options, opt)
+	}
+	return options, nil
+}
+
 // SerializeTo writes the serialized form of this layer into the
 // SerializationBuffer, implementing gopacket.SerializableLayer.
 // See the docs for gopacket.SerializableLayer for more info.
 func (d *DHCPv4) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	options, err := d.serializedOptions()
+	if err != nil {
+		return err
+	}
 	plen := int(d.Len())
 	if plen < 300 {
 		plen = 300
@@ -209,9 +272,9 @@ func (d *DHCPv4) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.Serialize
 	copy(data[108:236], d.File)
 	binary.BigEndian.PutUint32(data[236:240], DHCPMagic)
 
-	if len(d.Options) > 0 {
+	if len(options) > 0 {
 		offset := 240
-		for _, o := range d.Options {
+		for _, o := range options {
 			if err := o.encode(data[offset:]); err != nil {
 				return err
 			}
@@ -225,6 +288,187 @@ func (d *DHCPv4) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.Serialize
 	return nil
 }
 
+// Option returns the first option of type t.
+func (d *DHCPv4) Option(t DHCPOpt) (DHCPOption, bool) {
+	for _, o := range d.Options {
+		if o.Type == t {
+			return o, true
+		}
+	}
+	return DHCPOption{}, false
+}
+
+// MessageType returns the message type of option 53, or
+// DHCPMsgTypeUnspecified for BOOTP messages, which have none.
+func (d *DHCPv4) MessageType() DHCPMsgType {
+	if o, ok := d.Option(DHCPOptMessageType); ok && len(o.Data) == 1 {
+		return DHCPMsgType(o.Data[0])
+	}
+	return DHCPMsgTypeUnspecified
+}
+
+// ParamsRequest returns the options the client asks for in option 55, in
+// the order it asks for them.
+func (d *DHCPv4) ParamsRequest() []DHCPOpt {
+	o, ok := d.Option(DHCPOptParamsRequest)
+	if !ok {
+		return nil
+	}
+	params := make([]DHCPOpt, len(o.Data))
+	for i, b := range o.Data {
+		params[i] = DHCPOpt(b)
+	}
+	return params
+}
+
+// ClassID returns the vendor class identifier of option 60, like
+// "MSFT 5.0", or "" if there is none.
+func (d *DHCPv4) ClassID() string {
+	o, _ := d.Option(DHCPOptClassID)
+	return string(o.Data)
+}
+
+// Hostname returns the host name of option 12, or "" if there is none.
+func (d *DHCPv4) Hostname() string {
+	o, _ := d.Option(DHCPOptHostname)
+	return string(o.Data)
+}
+
+// DHCPSubOption is a sub-option of an option that encapsulates others,
+// like the relay agent information option.
+type DHCPSubOption struct {
+	Code uint8
+	Data []byte
+}
+
+// DecodeDHCPSubOptions decodes the code, length and data of each
+// sub-option in data.
+func DecodeDHCPSubOptions(data []byte) ([]DHCPSubOption, error) {
+	var subs []DHCPSubOption
+	for len(data) > 0 {
+		if len(data) < 2 || len(data) < 2+int(data[1]) {
+			return subs, errors.New("DHCP sub-option truncated")
+		}
+		subs = append(subs, DHCPSubOption{Code: data[0], Data: data[2 : 2+int(data[1])]})
+		data = data[2+int(data[1]):]
+	}
+	return subs, nil
+}
+
+// DHCP relay agent information sub-option codes.
+const (
+	DHCPRelaySubOptCircuitID      uint8 = 1 // RFC 3046
+	DHCPRelaySubOptRemoteID       uint8 = 2 // RFC 3046
+	DHCPRelaySubOptLinkSelection  uint8 = 5 // RFC 3527
+	DHCPRelaySubOptSubscriberID   uint8 = 6 // RFC 3993
+	DHCPRelaySubOptVendorSpecific uint8 = 9 // RFC 4243
+)
+
+// DHCPRelayAgentInfo is the relay agent information option (RFC 3046),
+// with which relay agents tell servers where a client is: which port of
+// which switch or access concentrator, or which subscriber.  Sub-options
+// that are absent are nil.
+type DHCPRelayAgentInfo struct {
+	// CircuitID identifies the circuit the request came in on, like a
+	// switch port or VLAN, and RemoteID the remote end of it, like a modem
+	// or the relay itself.  Their formats are up to the relay agent.
+	CircuitID []byte
+	RemoteID  []byte
+	// LinkSelection is the subnet the client is on, when it isn't that of
+	// RelayAgentIP.
+	LinkSelection net.IP
+	// SubscriberID identifies the subscriber, as provisioned.
+	SubscriberID   []byte
+	VendorSpecific []DHCPVendorInfo
+	// Other holds the other sub-options, in order.
+	Other []DHCPSubOption
+}
+
+// DHCPVendorInfo is the information of one vendor in the vendor-specific
+// sub-option, identified by its IANA enterprise number.
+type DHCPVendorInfo struct {
+	EnterpriseNumber uint32
+	Data             []byte
+}
+
+func (r *DHCPRelayAgentInfo) decode(data []byte) error {
+	subs, err := DecodeDHCPSubOptions(data)
+	if err != nil {
+		return err
+	}
+	for _, s := range subs {
+		switch s.Code {
+		case DHCPRelaySubOptCircuitID:
+			r.CircuitID = s.Data
+		case DHCPRelaySubOptRemoteID:
+			r.RemoteID = s.Data
+		case DHCPRelaySubOptLinkSelection:
+			if len(s.Data) != 4 {
+				return errors.New("DHCP link selection sub-option isn't 4 bytes")
+			}
+			r.LinkSelection = net.IP(s.Data)
+		case DHCPRelaySubOptSubscriberID:
+			r.SubscriberID = s.Data
+		case DHCPRelaySubOptVendorSpecific:
+			for b := s.Data; len(b) > 0; {
+				if len(b) < 5 || len(b) < 5+int(b[4]) {
+					return errors.New("DHCP vendor-specific sub-option truncated")
+				}
+				r.VendorSpecific = append(r.VendorSpecific, DHCPVendorInfo{
+					EnterpriseNumber: binary.BigEndian.Uint32(b),
+					Data:             b[5 : 5+int(b[4])],
+				})
+				b = b[5+int(b[4]):]
+			}
+		default:
+			r.Other = append(r.Other, s)
+		}
+	}
+	return nil
+}
+
+func (r *DHCPRelayAgentInfo) encode() ([]byte, error) {
+	subs := []DHCPSubOption{
+		{DHCPRelaySubOptCircuitID, r.CircuitID},
+		{DHCPRelaySubOptRemoteID, r.RemoteID},
+	}
+	if r.LinkSelection != nil {
+		ip := r.LinkSelection.To4()
+		if ip == nil {
+			return nil, errors.New("DHCP link selection isn't an IPv4 address")
+		}
+		subs = append(subs, DHCPSubOption{DHCPRelaySubOptLinkSelection, ip})
+	}
+	subs = append(subs, DHCPSubOption{DHCPRelaySubOptSubscriberID, r.SubscriberID})
+	if r.VendorSpecific != nil {
+		var v []byte
+		for _, vi := range r.VendorSpecific {
+			if len(vi.Data) > 255 {
+				return nil, errors.New("DHCP vendor-specific data too long to encode")
+			}
+			v = append(v, byte(vi.EnterpriseNumber>>24), byte(vi.EnterpriseNumber>>16),
+				byte(vi.EnterpriseNumber>>8), byte(vi.EnterpriseNumber), byte(len(vi.Data)))
+			v = append(v, vi.Data...)
+		}
+		subs = append(subs, DHCPSubOption{DHCPRelaySubOptVendorSpecific, v})
+	}
+	var b []byte
+	for _, s := range append(subs, r.Other...) {
+		if s.Data == nil {
+			continue
+		}
+		if len(s.Data) > 255 {
+			return nil, fmt.Errorf("DHCP relay agent sub-option %d too long to encode", s.Code)
+		}
+		b = append(b, s.Code, byte(len(s.Data)))
+		b = append(b, s.Data...)
+	}
+	if len(b) > 253 {
+		return nil, errors.New("DHCP relay agent information too long to encode")
+	}
+	return b, nil
+}
+
 // CanDecode returns the set of layer types that this DecodingLayer can decode.
 func (d *DHCPv4) CanDecode() gopacket.LayerClass {
 	return LayerTypeDHCPv4
@@ -312,6 +556,7 @@ const (
 	DHCPOptT2                    DHCPOpt = 59  // 4, uint32
 	DHCPOptClassID               DHCPOpt = 60  // n, []byte
 	DHCPOptClientID              DHCPOpt = 61  // n >=  2, []byte
+	DHCPOptRelayAgentInfo        DHCPOpt = 82  // n, sub-options (RFC 3046)
 	DHCPOptDomainSearch          DHCPOpt = 119 // n, string
 	DHCPOptSIPServers            DHCPOpt = 120 // n, url
 	DHCPOptClasslessStaticRoute  DHCPOpt = 121 //
@@ -449,6 +694,8 @@ func (o DHCPOpt) String() string {
 		return "ClassID"
 	case DHCPOptClientID:
 		return "ClientID"
+	case DHCPOptRelayAgentInfo:
+		return "RelayAgentInfo"
 	case DHCPOptDomainSearch:
 		return "DomainSearch"
 	case DHCPOptClasslessStaticRoute:
@@ -554,6 +801,9 @@ func (o *DHCPOption) decode(data []byte) error {
 		if o.Length > 253 {
 			return errors.New("data too long to decode")
 		}
+		if len(data) < 2+int(o.Length) {
+			return errors.New("Not enough data to decode")
+		}
 		o.Data = data[2 : 2+o.Length]
 	}
 	return nil
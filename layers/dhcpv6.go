@@ -0,0 +1,640 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/mistsys/gopacket"
+)
+
+// DHCPv6MsgType is the type of a DHCPv6 message.
+type DHCPv6MsgType uint8
+
+// DHCPv6 message types (RFC 8415 section 7.3).
+const (
+	DHCPv6MsgTypeSolicit            DHCPv6MsgType = 1
+	DHCPv6MsgTypeAdvertise          DHCPv6MsgType = 2
+	DHCPv6MsgTypeRequest            DHCPv6MsgType = 3
+	DHCPv6MsgTypeConfirm            DHCPv6MsgType = 4
+	DHCPv6MsgTypeRenew              DHCPv6MsgType = 5
+	DHCPv6MsgTypeRebind             DHCPv6MsgType = 6
+	DHCPv6MsgTypeReply              DHCPv6MsgType = 7
+	DHCPv6MsgTypeRelease            DHCPv6MsgType = 8
+	DHCPv6MsgTypeDecline            DHCPv6MsgType = 9
+	DHCPv6MsgTypeReconfigure        DHCPv6MsgType = 10
+	DHCPv6MsgTypeInformationRequest DHCPv6MsgType = 11
+	DHCPv6MsgTypeRelayForward       DHCPv6MsgType = 12
+	DHCPv6MsgTypeRelayReply         DHCPv6MsgType = 13
+)
+
+func (t DHCPv6MsgType) String() string {
+	switch t {
+	case DHCPv6MsgTypeSolicit:
+		return "Solicit"
+	case DHCPv6MsgTypeAdvertise:
+		return "Advertise"
+	case DHCPv6MsgTypeRequest:
+		return "Request"
+	case DHCPv6MsgTypeConfirm:
+		return "Confirm"
+	case DHCPv6MsgTypeRenew:
+		return "Renew"
+	case DHCPv6MsgTypeRebind:
+		return "Rebind"
+	case DHCPv6MsgTypeReply:
+		return "Reply"
+	case DHCPv6MsgTypeRelease:
+		return "Release"
+	case DHCPv6MsgTypeDecline:
+		return "Decline"
+	case DHCPv6MsgTypeReconfigure:
+		return "Reconfigure"
+	case DHCPv6MsgTypeInformationRequest:
+		return "InformationRequest"
+	case DHCPv6MsgTypeRelayForward:
+		return "RelayForward"
+	case DHCPv6MsgTypeRelayReply:
+		return "RelayReply"
+	default:
+		return fmt.Sprintf("UnknownDHCPv6MsgType(%d)", uint8(t))
+	}
+}
+
+// Relay reports whether t is the type of a message between relay agents
+// and servers, which carries another message.
+func (t DHCPv6MsgType) Relay() bool {
+	return t == DHCPv6MsgTypeRelayForward || t == DHCPv6MsgTypeRelayReply
+}
+
+// DHCPv6Opt is the code of a DHCPv6 option.
+type DHCPv6Opt uint16
+
+// DHCPv6 option codes (RFC 8415 section 21, and others).
+const (
+	DHCPv6OptClientID            DHCPv6Opt = 1
+	DHCPv6OptServerID            DHCPv6Opt = 2
+	DHCPv6OptIANA                DHCPv6Opt = 3
+	DHCPv6OptIATA                DHCPv6Opt = 4
+	DHCPv6OptIAAddr              DHCPv6Opt = 5
+	DHCPv6OptORO                 DHCPv6Opt = 6
+	DHCPv6OptPreference          DHCPv6Opt = 7
+	DHCPv6OptElapsedTime         DHCPv6Opt = 8
+	DHCPv6OptRelayMessage        DHCPv6Opt = 9
+	DHCPv6OptAuth                DHCPv6Opt = 11
+	DHCPv6OptUnicast             DHCPv6Opt = 12
+	DHCPv6OptStatusCode          DHCPv6Opt = 13
+	DHCPv6OptRapidCommit         DHCPv6Opt = 14
+	DHCPv6OptUserClass           DHCPv6Opt = 15
+	DHCPv6OptVendorClass         DHCPv6Opt = 16
+	DHCPv6OptVendorOpts          DHCPv6Opt = 17
+	DHCPv6OptInterfaceID         DHCPv6Opt = 18
+	DHCPv6OptReconfigureMessage  DHCPv6Opt = 19
+	DHCPv6OptReconfigureAccept   DHCPv6Opt = 20
+	DHCPv6OptDNSServers          DHCPv6Opt = 23 // [RFC3646]
+	DHCPv6OptDomainList          DHCPv6Opt = 24 // [RFC3646]
+	DHCPv6OptIAPD                DHCPv6Opt = 25
+	DHCPv6OptIAPrefix            DHCPv6Opt = 26
+	DHCPv6OptRemoteID            DHCPv6Opt = 37 // [RFC4649]
+	DHCPv6OptSubscriberID        DHCPv6Opt = 38 // [RFC4580]
+	DHCPv6OptClientFQDN          DHCPv6Opt = 39 // [RFC4704]
+	DHCPv6OptClientLinkLayerAddr DHCPv6Opt = 79 // [RFC6939]
+)
+
+func (o DHCPv6Opt) String() string {
+	switch o {
+	case DHCPv6OptClientID:
+		return "ClientID"
+	case DHCPv6OptServerID:
+		return "ServerID"
+	case DHCPv6OptIANA:
+		return "IA_NA"
+	case DHCPv6OptIATA:
+		return "IA_TA"
+	case DHCPv6OptIAAddr:
+		return "IAAddr"
+	case DHCPv6OptORO:
+		return "ORO"
+	case DHCPv6OptPreference:
+		return "Preference"
+	case DHCPv6OptElapsedTime:
+		return "ElapsedTime"
+	case DHCPv6OptRelayMessage:
+		return "RelayMessage"
+	case DHCPv6OptAuth:
+		return "Auth"
+	case DHCPv6OptUnicast:
+		return "Unicast"
+	case DHCPv6OptStatusCode:
+		return "StatusCode"
+	case DHCPv6OptRapidCommit:
+		return "RapidCommit"
+	case DHCPv6OptUserClass:
+		return "UserClass"
+	case DHCPv6OptVendorClass:
+		return "VendorClass"
+	case DHCPv6OptVendorOpts:
+		return "VendorOpts"
+	case DHCPv6OptInterfaceID:
+		return "InterfaceID"
+	case DHCPv6OptReconfigureMessage:
+		return "ReconfigureMessage"
+	case DHCPv6OptReconfigureAccept:
+		return "ReconfigureAccept"
+	case DHCPv6OptDNSServers:
+		return "DNSServers"
+	case DHCPv6OptDomainList:
+		return "DomainList"
+	case DHCPv6OptIAPD:
+		return "IA_PD"
+	case DHCPv6OptIAPrefix:
+		return "IAPrefix"
+	case DHCPv6OptRemoteID:
+		return "RemoteID"
+	case DHCPv6OptSubscriberID:
+		return "SubscriberID"
+	case DHCPv6OptClientFQDN:
+		return "ClientFQDN"
+	case DHCPv6OptClientLinkLayerAddr:
+		return "ClientLinkLayerAddr"
+	default:
+		return fmt.Sprintf("UnknownDHCPv6Opt(%d)", uint16(o))
+	}
+}
+
+// DHCPv6StatusCode is the code of a status code option.
+type DHCPv6StatusCode uint16
+
+// DHCPv6 status codes (RFC 8415 section 21.13).
+const (
+	DHCPv6StatusSuccess       DHCPv6StatusCode = 0
+	DHCPv6StatusUnspecFail    DHCPv6StatusCode = 1
+	DHCPv6StatusNoAddrsAvail  DHCPv6StatusCode = 2
+	DHCPv6StatusNoBinding     DHCPv6StatusCode = 3
+	DHCPv6StatusNotOnLink     DHCPv6StatusCode = 4
+	DHCPv6StatusUseMulticast  DHCPv6StatusCode = 5
+	DHCPv6StatusNoPrefixAvail DHCPv6StatusCode = 6
+)
+
+func (c DHCPv6StatusCode) String() string {
+	switch c {
+	case DHCPv6StatusSuccess:
+		return "Success"
+	case DHCPv6StatusUnspecFail:
+		return "UnspecFail"
+	case DHCPv6StatusNoAddrsAvail:
+		return "NoAddrsAvail"
+	case DHCPv6StatusNoBinding:
+		return "NoBinding"
+	case DHCPv6StatusNotOnLink:
+		return "NotOnLink"
+	case DHCPv6StatusUseMulticast:
+		return "UseMulticast"
+	case DHCPv6StatusNoPrefixAvail:
+		return "NoPrefixAvail"
+	default:
+		return fmt.Sprintf("UnknownDHCPv6StatusCode(%d)", uint16(c))
+	}
+}
+
+// DHCPv6 is a DHCPv6 message (RFC 8415).  Client and server messages have
+// a transaction ID.  Relay messages, between relay agents and servers,
+// have a hop count and the addresses of the link and the peer instead,
+// and carry the message they relay in a RelayMessage option.
+type DHCPv6 struct {
+	BaseLayer
+	MsgType DHCPv6MsgType
+	// TransactionID is 24 bits.
+	TransactionID uint32
+	HopCount      uint8
+	LinkAddr      net.IP
+	PeerAddr      net.IP
+	Options       []DHCPv6Option
+}
+
+// DHCPv6Option is a DHCPv6 option.  The methods named after options
+// decode the options of those types.
+type DHCPv6Option struct {
+	Code   DHCPv6Opt
+	Length uint16
+	Data   []byte
+}
+
+// NewDHCPv6Option constructs a new DHCPv6Option with a given code and
+// data.
+func NewDHCPv6Option(code DHCPv6Opt, data []byte) DHCPv6Option {
+	return DHCPv6Option{Code: code, Length: uint16(len(data)), Data: data}
+}
+
+func (o DHCPv6Option) String() string {
+	return fmt.Sprintf("Option(%s:%x)", o.Code, o.Data)
+}
+
+// LayerType returns LayerTypeDHCPv6.
+func (d *DHCPv6) LayerType() gopacket.LayerType { return LayerTypeDHCPv6 }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (d *DHCPv6) CanDecode() gopacket.LayerClass { return LayerTypeDHCPv6 }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (d *DHCPv6) NextLayerType() gopacket.LayerType { return gopacket.LayerTypePayload }
+
+// Payload returns nil, since DHCPv6 messages carry no payload.
+func (d *DHCPv6) Payload() []byte { return nil }
+
+func decodeDHCPv6(data []byte, p gopacket.PacketBuilder) error {
+	d := &DHCPv6{}
+	if err := d.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(d)
+	p.SetApplicationLayer(d)
+	return nil
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (d *DHCPv6) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return errors.New("DHCPv6 message too short")
+	}
+	d.MsgType = DHCPv6MsgType(data[0])
+	d.TransactionID, d.HopCount, d.LinkAddr, d.PeerAddr = 0, 0, nil, nil
+	n := 4
+	if d.MsgType.Relay() {
+		n = 34
+		if len(data) < n {
+			df.SetTruncated()
+			return errors.New("DHCPv6 relay message too short")
+		}
+		d.HopCount = data[1]
+		d.LinkAddr = net.IP(data[2:18])
+		d.PeerAddr = net.IP(data[18:34])
+	} else {
+		d.TransactionID = uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])
+	}
+	var err error
+	if d.Options, err = decodeDHCPv6Options(data[n:], d.Options[:0]); err != nil {
+		df.SetTruncated()
+		return err
+	}
+	d.BaseLayer = BaseLayer{Contents: data}
+	return nil
+}
+
+func decodeDHCPv6Options(data []byte, opts []DHCPv6Option) ([]DHCPv6Option, error) {
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return opts, errors.New("DHCPv6 option truncated")
+		}
+		n := binary.BigEndian.Uint16(data[2:])
+		if len(data) < 4+int(n) {
+			return opts, errors.New("DHCPv6 option truncated")
+		}
+		opts = append(opts, DHCPv6Option{
+			Code:   DHCPv6Opt(binary.BigEndian.Uint16(data)),
+			Length: n,
+			Data:   data[4 : 4+n],
+		})
+		data = data[4+n:]
+	}
+	return opts, nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+func (d *DHCPv6) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	n := 4
+	if d.MsgType.Relay() {
+		n = 34
+	}
+	for _, o := range d.Options {
+		n += 4 + len(o.Data)
+	}
+	data, err := b.PrependBytes(n)
+	if err != nil {
+		return err
+	}
+	data[0] = byte(d.MsgType)
+	if d.MsgType.Relay() {
+		data[1] = d.HopCount
+		copy(data[2:18], d.LinkAddr.To16())
+		copy(data[18:34], d.PeerAddr.To16())
+		data = data[34:]
+	} else {
+		data[1], data[2], data[3] = byte(d.TransactionID>>16), byte(d.TransactionID>>8), byte(d.TransactionID)
+		data = data[4:]
+	}
+	for i := range d.Options {
+		o := &d.Options[i]
+		if len(o.Data) > 0xffff {
+			return fmt.Errorf("DHCPv6 option %v is %d bytes, over 65535", o.Code, len(o.Data))
+		}
+		if opts.FixLengths {
+			o.Length = uint16(len(o.Data))
+		}
+		binary.BigEndian.PutUint16(data, uint16(o.Code))
+		binary.BigEndian.PutUint16(data[2:], o.Length)
+		copy(data[4:], o.Data)
+		data = data[4+len(o.Data):]
+	}
+	return nil
+}
+
+func appendDHCPv6Options(b []byte, opts []DHCPv6Option) []byte {
+	for _, o := range opts {
+		b = append(b, byte(o.Code>>8), byte(o.Code), byte(len(o.Data)>>8), byte(len(o.Data)))
+		b = append(b, o.Data...)
+	}
+	return b
+}
+
+// Option returns the first option with code c.
+func (d *DHCPv6) Option(c DHCPv6Opt) (DHCPv6Option, bool) {
+	for _, o := range d.Options {
+		if o.Code == c {
+			return o, true
+		}
+	}
+	return DHCPv6Option{}, false
+}
+
+// RelayedMessage decodes the message a relay message carries in its
+// RelayMessage option, which may itself be a relay message, when relay
+// agents are chained.  It returns nil for other messages.
+func (d *DHCPv6) RelayedMessage() (*DHCPv6, error) {
+	if !d.MsgType.Relay() {
+		return nil, nil
+	}
+	o, ok := d.Option(DHCPv6OptRelayMessage)
+	if !ok {
+		return nil, errors.New("DHCPv6 relay message without RelayMessage option")
+	}
+	inner := &DHCPv6{}
+	if err := inner.DecodeFromBytes(o.Data, gopacket.NilDecodeFeedback); err != nil {
+		return nil, err
+	}
+	return inner, nil
+}
+
+// DHCPv6DUIDType is the type of a DUID.
+type DHCPv6DUIDType uint16
+
+// DUID types (RFC 8415 section 11).
+const (
+	DHCPv6DUIDTypeLLT  DHCPv6DUIDType = 1 // link-layer address plus time
+	DHCPv6DUIDTypeEN   DHCPv6DUIDType = 2 // enterprise number
+	DHCPv6DUIDTypeLL   DHCPv6DUIDType = 3 // link-layer address
+	DHCPv6DUIDTypeUUID DHCPv6DUIDType = 4 // UUID [RFC6355]
+)
+
+func (t DHCPv6DUIDType) String() string {
+	switch t {
+	case DHCPv6DUIDTypeLLT:
+		return "LLT"
+	case DHCPv6DUIDTypeEN:
+		return "EN"
+	case DHCPv6DUIDTypeLL:
+		return "LL"
+	case DHCPv6DUIDTypeUUID:
+		return "UUID"
+	default:
+		return fmt.Sprintf("UnknownDHCPv6DUIDType(%d)", uint16(t))
+	}
+}
+
+// DHCPv6DUID is a DHCP unique identifier, which identifies a client or
+// server in its ClientID or ServerID option.
+type DHCPv6DUID struct {
+	Type DHCPv6DUIDType
+	// HardwareType and LinkLayerAddr are set for LLT and LL DUIDs, and
+	// Time, seconds since 2000 modulo 2^32, for LLT DUIDs.
+	HardwareType  uint16
+	Time          uint32
+	LinkLayerAddr net.HardwareAddr
+	// EnterpriseNumber is set for EN DUIDs.
+	EnterpriseNumber uint32
+	// Identifier is the identifier of EN DUIDs, the UUID of UUID DUIDs, and
+	// what follows the type in DUIDs of other types.
+	Identifier []byte
+}
+
+// DUID decodes the DUID of a ClientID or ServerID option.
+func (o DHCPv6Option) DUID() (DHCPv6DUID, error) {
+	b := o.Data
+	if len(b) < 2 {
+		return DHCPv6DUID{}, errors.New("DHCPv6 DUID truncated")
+	}
+	d := DHCPv6DUID{Type: DHCPv6DUIDType(binary.BigEndian.Uint16(b))}
+	b = b[2:]
+	switch d.Type {
+	case DHCPv6DUIDTypeLLT:
+		if len(b) < 6 {
+			return d, errors.New("DHCPv6 DUID-LLT truncated")
+		}
+		d.HardwareType = binary.BigEndian.Uint16(b)
+		d.Time = binary.BigEndian.Uint32(b[2:])
+		d.LinkLayerAddr = net.HardwareAddr(b[6:])
+	case DHCPv6DUIDTypeEN:
+		if len(b) < 4 {
+			return d, errors.New("DHCPv6 DUID-EN truncated")
+		}
+		d.EnterpriseNumber = binary.BigEndian.Uint32(b)
+		d.Identifier = b[4:]
+	case DHCPv6DUIDTypeLL:
+		if len(b) < 2 {
+			return d, errors.New("DHCPv6 DUID-LL truncated")
+		}
+		d.HardwareType = binary.BigEndian.Uint16(b)
+		d.LinkLayerAddr = net.HardwareAddr(b[2:])
+	case DHCPv6DUIDTypeUUID:
+		if len(b) != 16 {
+			return d, errors.New("DHCPv6 DUID-UUID isn't 16 bytes")
+		}
+		d.Identifier = b
+	default:
+		d.Identifier = b
+	}
+	return d, nil
+}
+
+// Encode returns the bytes of d.
+func (d DHCPv6DUID) Encode() []byte {
+	b := []byte{byte(d.Type >> 8), byte(d.Type)}
+	switch d.Type {
+	case DHCPv6DUIDTypeLLT:
+		b = append(b, byte(d.HardwareType>>8), byte(d.HardwareType),
+			byte(d.Time>>24), byte(d.Time>>16), byte(d.Time>>8), byte(d.Time))
+		b = append(b, d.LinkLayerAddr...)
+	case DHCPv6DUIDTypeEN:
+		b = append(b, byte(d.EnterpriseNumber>>24), byte(d.EnterpriseNumber>>16), byte(d.EnterpriseNumber>>8), byte(d.EnterpriseNumber))
+		b = append(b, d.Identifier...)
+	case DHCPv6DUIDTypeLL:
+		b = append(b, byte(d.HardwareType>>8), byte(d.HardwareType))
+		b = append(b, d.LinkLayerAddr...)
+	default:
+		b = append(b, d.Identifier...)
+	}
+	return b
+}
+
+// DHCPv6IA is an identity association: an IA_NA, IA_TA or IA_PD option,
+// whose options hold its addresses or prefixes.
+type DHCPv6IA struct {
+	IAID uint32
+	// T1 and T2 are the renewal and rebinding times, in seconds, of IA_NA
+	// and IA_PD options.
+	T1, T2  uint32
+	Options []DHCPv6Option
+}
+
+// IA decodes an IA_NA, IA_TA or IA_PD option.
+func (o DHCPv6Option) IA() (DHCPv6IA, error) {
+	var ia DHCPv6IA
+	n := 12
+	switch o.Code {
+	case DHCPv6OptIANA, DHCPv6OptIAPD:
+	case DHCPv6OptIATA:
+		n = 4
+	default:
+		return ia, fmt.Errorf("DHCPv6 option %v isn't an IA", o.Code)
+	}
+	if len(o.Data) < n {
+		return ia, fmt.Errorf("DHCPv6 %v option truncated", o.Code)
+	}
+	ia.IAID = binary.BigEndian.Uint32(o.Data)
+	if n == 12 {
+		ia.T1 = binary.BigEndian.Uint32(o.Data[4:])
+		ia.T2 = binary.BigEndian.Uint32(o.Data[8:])
+	}
+	var err error
+	ia.Options, err = decodeDHCPv6Options(o.Data[n:], nil)
+	return ia, err
+}
+
+// Option returns the option of type code, which must be DHCPv6OptIANA,
+// DHCPv6OptIATA or DHCPv6OptIAPD, holding ia.
+func (ia DHCPv6IA) Option(code DHCPv6Opt) DHCPv6Option {
+	b := []byte{byte(ia.IAID >> 24), byte(ia.IAID >> 16), byte(ia.IAID >> 8), byte(ia.IAID)}
+	if code != DHCPv6OptIATA {
+		b = append(b, byte(ia.T1>>24), byte(ia.T1>>16), byte(ia.T1>>8), byte(ia.T1),
+			byte(ia.T2>>24), byte(ia.T2>>16), byte(ia.T2>>8), byte(ia.T2))
+	}
+	return NewDHCPv6Option(code, appendDHCPv6Options(b, ia.Options))
+}
+
+// DHCPv6IAAddr is an address of an IA_NA or IA_TA option.
+type DHCPv6IAAddr struct {
+	Addr net.IP
+	// PreferredLifetime and ValidLifetime are in seconds.
+	PreferredLifetime, ValidLifetime uint32
+	Options                          []DHCPv6Option
+}
+
+// IAAddr decodes an IAAddr option.
+func (o DHCPv6Option) IAAddr() (DHCPv6IAAddr, error) {
+	var a DHCPv6IAAddr
+	if o.Code != DHCPv6OptIAAddr {
+		return a, fmt.Errorf("DHCPv6 option %v isn't IAAddr", o.Code)
+	}
+	if len(o.Data) < 24 {
+		return a, errors.New("DHCPv6 IAAddr option truncated")
+	}
+	a.Addr = net.IP(o.Data[:16])
+	a.PreferredLifetime = binary.BigEndian.Uint32(o.Data[16:])
+	a.ValidLifetime = binary.BigEndian.Uint32(o.Data[20:])
+	var err error
+	a.Options, err = decodeDHCPv6Options(o.Data[24:], nil)
+	return a, err
+}
+
+// Option returns the IAAddr option holding a.
+func (a DHCPv6IAAddr) Option() DHCPv6Option {
+	b := make([]byte, 24)
+	copy(b, a.Addr.To16())
+	binary.BigEndian.PutUint32(b[16:], a.PreferredLifetime)
+	binary.BigEndian.PutUint32(b[20:], a.ValidLifetime)
+	return NewDHCPv6Option(DHCPv6OptIAAddr, appendDHCPv6Options(b, a.Options))
+}
+
+// DHCPv6IAPrefix is a prefix of an IA_PD option (RFC 8415 section 21.22).
+type DHCPv6IAPrefix struct {
+	// PreferredLifetime and ValidLifetime are in seconds.
+	PreferredLifetime, ValidLifetime uint32
+	PrefixLength                     uint8
+	Prefix                           net.IP
+	Options                          []DHCPv6Option
+}
+
+// IAPrefix decodes an IAPrefix option.
+func (o DHCPv6Option) IAPrefix() (DHCPv6IAPrefix, error) {
+	var p DHCPv6IAPrefix
+	if o.Code != DHCPv6OptIAPrefix {
+		return p, fmt.Errorf("DHCPv6 option %v isn't IAPrefix", o.Code)
+	}
+	if len(o.Data) < 25 {
+		return p, errors.New("DHCPv6 IAPrefix option truncated")
+	}
+	p.PreferredLifetime = binary.BigEndian.Uint32(o.Data)
+	p.ValidLifetime = binary.BigEndian.Uint32(o.Data[4:])
+	p.PrefixLength = o.Data[8]
+	p.Prefix = net.IP(o.Data[9:25])
+	var err error
+	p.Options, err = decodeDHCPv6Options(o.Data[25:], nil)
+	return p, err
+}
+
+// Option returns the IAPrefix option holding p.
+func (p DHCPv6IAPrefix) Option() DHCPv6Option {
+	b := make([]byte, 25)
+	binary.BigEndian.PutUint32(b, p.PreferredLifetime)
+	binary.BigEndian.PutUint32(b[4:], p.ValidLifetime)
+	b[8] = p.PrefixLength
+	copy(b[9:], p.Prefix.To16())
+	return NewDHCPv6Option(DHCPv6OptIAPrefix, appendDHCPv6Options(b, p.Options))
+}
+
+// DHCPv6Status is the status of a message or identity association.
+type DHCPv6Status struct {
+	Code    DHCPv6StatusCode
+	Message string
+}
+
+// Status decodes a StatusCode option.
+func (o DHCPv6Option) Status() (DHCPv6Status, error) {
+	if o.Code != DHCPv6OptStatusCode {
+		return DHCPv6Status{}, fmt.Errorf("DHCPv6 option %v isn't StatusCode", o.Code)
+	}
+	if len(o.Data) < 2 {
+		return DHCPv6Status{}, errors.New("DHCPv6 StatusCode option truncated")
+	}
+	return DHCPv6Status{Code: DHCPv6StatusCode(binary.BigEndian.Uint16(o.Data)), Message: string(o.Data[2:])}, nil
+}
+
+// Option returns the StatusCode option holding s.
+func (s DHCPv6Status) Option() DHCPv6Option {
+	b := append([]byte{byte(s.Code >> 8), byte(s.Code)}, s.Message...)
+	return NewDHCPv6Option(DHCPv6OptStatusCode, b)
+}
+
+// ORO decodes the option codes an ORO option requests.
+func (o DHCPv6Option) ORO() ([]DHCPv6Opt, error) {
+	if o.Code != DHCPv6OptORO {
+		return nil, fmt.Errorf("DHCPv6 option %v isn't ORO", o.Code)
+	}
+	if len(o.Data)%2 != 0 {
+		return nil, errors.New("DHCPv6 ORO option has odd length")
+	}
+	codes := make([]DHCPv6Opt, len(o.Data)/2)
+	for i := range codes {
+		codes[i] = DHCPv6Opt(binary.BigEndian.Uint16(o.Data[2*i:]))
+	}
+	return codes, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func testDHCPv6Packet(t *testing.T, src, dst UDPPort, d *DHCPv6) gopacket.Packet {
+	ip := &IPv6{
+		Version:    6,
+		HopLimit:   1,
+		NextHeader: IPProtocolUDP,
+		SrcIP:      net.ParseIP("fe80::1"),
+		DstIP:      net.ParseIP("ff02::1:2"),
+	}
+	udp := &UDP{SrcPort: src, DstPort: dst}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, d); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv6, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv6, LayerTypeUDP, LayerTypeDHCPv6}, t)
+	return p
+}
+
+func TestDHCPv6Solicit(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	duid := DHCPv6DUID{Type: DHCPv6DUIDTypeLLT, HardwareType: 1, Time: 0x2a000000, LinkLayerAddr: mac}
+	addr := DHCPv6IAAddr{Addr: net.ParseIP("2001:db8::10"), PreferredLifetime: 3600, ValidLifetime: 7200}
+	ia := DHCPv6IA{IAID: 7, T1: 1800, T2: 2880, Options: []DHCPv6Option{addr.Option()}}
+	d := &DHCPv6{
+		MsgType:       DHCPv6MsgTypeSolicit,
+		TransactionID: 0xabcdef,
+		Options: []DHCPv6Option{
+			NewDHCPv6Option(DHCPv6OptClientID, duid.Encode()),
+			NewDHCPv6Option(DHCPv6OptORO, []byte{0, 23, 0, 24}),
+			ia.Option(DHCPv6OptIANA),
+		},
+	}
+	p := testDHCPv6Packet(t, 546, 547, d)
+	got := p.Layer(LayerTypeDHCPv6).(*DHCPv6)
+	if got.MsgType != DHCPv6MsgTypeSolicit || got.TransactionID != 0xabcdef {
+		t.Errorf("got %v transaction %x, want Solicit transaction abcdef", got.MsgType, got.TransactionID)
+	}
+	o, ok := got.Option(DHCPv6OptClientID)
+	if !ok {
+		t.Fatal("no ClientID")
+	}
+	gotDUID, err := o.DUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotDUID, duid) {
+		t.Errorf("got DUID %+v, want %+v", gotDUID, duid)
+	}
+	o, _ = got.Option(DHCPv6OptORO)
+	if codes, err := o.ORO(); err != nil || !reflect.DeepEqual(codes, []DHCPv6Opt{DHCPv6OptDNSServers, DHCPv6OptDomainList}) {
+		t.Errorf("got ORO %v, %v", codes, err)
+	}
+	o, _ = got.Option(DHCPv6OptIANA)
+	gotIA, err := o.IA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotIA.IAID != 7 || gotIA.T1 != 1800 || gotIA.T2 != 2880 || len(gotIA.Options) != 1 {
+		t.Fatalf("got IA_NA %+v", gotIA)
+	}
+	gotAddr, err := gotIA.Options[0].IAAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotAddr.Addr.Equal(addr.Addr) || gotAddr.PreferredLifetime != 3600 || gotAddr.ValidLifetime != 7200 {
+		t.Errorf("got IAAddr %+v, want %+v", gotAddr, addr)
+	}
+}
+
+func TestDHCPv6Relay(t *testing.T) {
+	status := DHCPv6Status{Code: DHCPv6StatusNoAddrsAvail, Message: "pool exhausted"}
+	ia := DHCPv6IA{IAID: 1, Options: []DHCPv6Option{status.Option()}}
+	reply := &DHCPv6{
+		MsgType:       DHCPv6MsgTypeReply,
+		TransactionID: 0x123456,
+		Options:       []DHCPv6Option{ia.Option(DHCPv6OptIATA)},
+	}
+	inner := gopacket.NewSerializeBuffer()
+	if err := reply.SerializeTo(inner, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		t.Fatal(err)
+	}
+	relay := &DHCPv6{
+		MsgType:  DHCPv6MsgTypeRelayReply,
+		HopCount: 1,
+		LinkAddr: net.ParseIP("2001:db8:1::1"),
+		PeerAddr: net.ParseIP("fe80::2"),
+		Options: []DHCPv6Option{
+			NewDHCPv6Option(DHCPv6OptInterfaceID, []byte("eth1")),
+			NewDHCPv6Option(DHCPv6OptRelayMessage, inner.Bytes()),
+		},
+	}
+	p := testDHCPv6Packet(t, 547, 547, relay)
+	got := p.Layer(LayerTypeDHCPv6).(*DHCPv6)
+	if got.MsgType != DHCPv6MsgTypeRelayReply || got.HopCount != 1 ||
+		!got.LinkAddr.Equal(relay.LinkAddr) || !got.PeerAddr.Equal(relay.PeerAddr) {
+		t.Errorf("got relay message %+v", got)
+	}
+	in, err := got.RelayedMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.MsgType != DHCPv6MsgTypeReply || in.TransactionID != 0x123456 {
+		t.Fatalf("got relayed %v transaction %x", in.MsgType, in.TransactionID)
+	}
+	if m, err := in.RelayedMessage(); m != nil || err != nil {
+		t.Errorf("got relayed message %v, %v of a reply", m, err)
+	}
+	o, _ := in.Option(DHCPv6OptIATA)
+	gotIA, err := o.IA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotIA.IAID != 1 || len(gotIA.Options) != 1 {
+		t.Fatalf("got IA_TA %+v", gotIA)
+	}
+	if s, err := gotIA.Options[0].Status(); err != nil || s != status {
+		t.Errorf("got status %+v, %v, want %+v", s, err, status)
+	}
+	if !bytes.Equal(got.Options[0].Data, []byte("eth1")) {
+		t.Errorf("got interface ID %q", got.Options[0].Data)
+	}
+}
+
+func TestDHCPv6Truncated(t *testing.T) {
+	for _, data := range [][]byte{
+		{1, 0, 0},
+		{12, 0, 0, 0},
+		{1, 0, 0, 1, 0, 1, 0, 10, 0, 1},
+	} {
+		d := &DHCPv6{}
+		if err := d.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("decoded %x without error", data)
+		}
+	}
+	if _, err := (DHCPv6Option{Code: DHCPv6OptClientID, Data: []byte{0, 1, 0}}).DUID(); err == nil {
+		t.Error("decoded truncated DUID-LLT without error")
+	}
+}
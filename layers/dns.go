@@ -7,10 +7,12 @@
 package layers
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 
 	"github.com/mistsys/gopacket"
 )
@@ -25,6 +27,23 @@ const (
 	DNSClassAny DNSClass = 255 // AnyClass
 )
 
+func (dc DNSClass) String() string {
+	switch dc {
+	default:
+		return fmt.Sprintf("UnknownDNSClass(%d)", uint16(dc))
+	case DNSClassIN:
+		return "IN"
+	case DNSClassCS:
+		return "CS"
+	case DNSClassCH:
+		return "CH"
+	case DNSClassHS:
+		return "HS"
+	case DNSClassAny:
+		return "Any"
+	}
+}
+
 type DNSType uint16
 
 const (
@@ -46,8 +65,73 @@ const (
 	DNSTypeTXT   DNSType = 16 // text strings
 	DNSTypeAAAA  DNSType = 28 // a IPv6 host address [RFC3596]
 	DNSTypeSRV   DNSType = 33 // server discovery [RFC2782] [RFC6195]
+
+	DNSTypeOPT        DNSType = 41 // EDNS0 pseudo-record [RFC6891]
+	DNSTypeDS         DNSType = 43 // delegation signer [RFC4034]
+	DNSTypeRRSIG      DNSType = 46 // RRset signature [RFC4034]
+	DNSTypeNSEC       DNSType = 47 // next secure [RFC4034]
+	DNSTypeDNSKEY     DNSType = 48 // DNS public key [RFC4034]
+	DNSTypeNSEC3      DNSType = 50 // hashed next secure [RFC5155]
+	DNSTypeNSEC3PARAM DNSType = 51 // NSEC3 parameters [RFC5155]
 )
 
+func (dt DNSType) String() string {
+	switch dt {
+	default:
+		return fmt.Sprintf("UnknownDNSType(%d)", uint16(dt))
+	case DNSTypeA:
+		return "A"
+	case DNSTypeNS:
+		return "NS"
+	case DNSTypeMD:
+		return "MD"
+	case DNSTypeMF:
+		return "MF"
+	case DNSTypeCNAME:
+		return "CNAME"
+	case DNSTypeSOA:
+		return "SOA"
+	case DNSTypeMB:
+		return "MB"
+	case DNSTypeMG:
+		return "MG"
+	case DNSTypeMR:
+		return "MR"
+	case DNSTypeNULL:
+		return "NULL"
+	case DNSTypeWKS:
+		return "WKS"
+	case DNSTypePTR:
+		return "PTR"
+	case DNSTypeHINFO:
+		return "HINFO"
+	case DNSTypeMINFO:
+		return "MINFO"
+	case DNSTypeMX:
+		return "MX"
+	case DNSTypeTXT:
+		return "TXT"
+	case DNSTypeAAAA:
+		return "AAAA"
+	case DNSTypeSRV:
+		return "SRV"
+	case DNSTypeOPT:
+		return "OPT"
+	case DNSTypeDS:
+		return "DS"
+	case DNSTypeRRSIG:
+		return "RRSIG"
+	case DNSTypeNSEC:
+		return "NSEC"
+	case DNSTypeDNSKEY:
+		return "DNSKEY"
+	case DNSTypeNSEC3:
+		return "NSEC3"
+	case DNSTypeNSEC3PARAM:
+		return "NSEC3PARAM"
+	}
+}
+
 type DNSResponseCode uint8
 
 const (
@@ -309,41 +393,17 @@ func b2i(b bool) int {
 	return 0
 }
 
-func computeSize(recs []DNSResourceRecord) int {
-	sz := 0
-	for _, rr := range recs {
-		sz += len(rr.Name) + 14
-		switch rr.Type {
-		case DNSTypeA:
-			sz += 4
-		case DNSTypeAAAA:
-			sz += 16
-		case DNSTypeCNAME:
-			sz += len(rr.CNAME) + 1
-		}
-	}
-	return sz
-}
-
 // SerializeTo writes the serialized form of this layer into the
-// SerializationBuffer, implementing gopacket.SerializableLayer.
+// SerializationBuffer, implementing gopacket.SerializableLayer.  Names are
+// compressed where RFC 1035 allows it: owner names, and names in the RDATA
+// of the types it defines.  Names in the RDATA of later types, like SRV
+// targets and RRSIG signer names, are written in full, as RFC 3597
+// requires.
 func (d *DNS) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
-	dsz := 0
-	for _, q := range d.Questions {
-		dsz += len(q.Name) + 6
-	}
-	dsz += computeSize(d.Answers)
-	dsz += computeSize(d.Authorities)
-	dsz += computeSize(d.Additionals)
-	dsz += computeSize(d.Additionals)
-
-	bytes, err := b.PrependBytes(12 + dsz)
-	if err != nil {
-		return err
-	}
-	binary.BigEndian.PutUint16(bytes, d.ID)
-	bytes[2] = byte((b2i(d.QR) << 7) | (int(d.OpCode) << 3) | (b2i(d.AA) << 2) | (b2i(d.TC) << 1) | b2i(d.RD))
-	bytes[3] = byte((b2i(d.RA) << 7) | (int(d.Z) << 4) | int(d.ResponseCode))
+	e := dnsEncoder{buf: make([]byte, 12, 512), names: map[string]int{}}
+	binary.BigEndian.PutUint16(e.buf, d.ID)
+	e.buf[2] = byte((b2i(d.QR) << 7) | (int(d.OpCode) << 3) | (b2i(d.AA) << 2) | (b2i(d.TC) << 1) | b2i(d.RD))
+	e.buf[3] = byte((b2i(d.RA) << 7) | (int(d.Z) << 4) | int(d.ResponseCode))
 
 	if opts.FixLengths {
 		d.QDCount = uint16(len(d.Questions))
@@ -351,50 +411,91 @@ func (d *DNS) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOpt
 		d.NSCount = uint16(len(d.Authorities))
 		d.ARCount = uint16(len(d.Additionals))
 	}
-	binary.BigEndian.PutUint16(bytes[4:], d.QDCount)
-	binary.BigEndian.PutUint16(bytes[6:], d.ANCount)
-	binary.BigEndian.PutUint16(bytes[8:], d.NSCount)
-	binary.BigEndian.PutUint16(bytes[10:], d.ARCount)
+	binary.BigEndian.PutUint16(e.buf[4:], d.QDCount)
+	binary.BigEndian.PutUint16(e.buf[6:], d.ANCount)
+	binary.BigEndian.PutUint16(e.buf[8:], d.NSCount)
+	binary.BigEndian.PutUint16(e.buf[10:], d.ARCount)
 
-	off := 12
-	for _, qd := range d.Questions {
-		n := qd.encode(bytes, off)
-		off += n
-	}
-
-	for i := range d.Answers {
-		// done this way so we can modify DNSResourceRecord to fix
-		// lengths if requested
-		qa := &d.Answers[i]
-		n, err := qa.encode(bytes, off, opts)
-		if err != nil {
+	for i := range d.Questions {
+		if err := d.Questions[i].encode(&e); err != nil {
 			return err
 		}
-		off += n
 	}
-
-	for i := range d.Authorities {
-		qa := &d.Answers[i]
-		n, err := qa.encode(bytes, off, opts)
-		if err != nil {
-			return err
+	for _, rrs := range [][]DNSResourceRecord{d.Answers, d.Authorities, d.Additionals} {
+		for i := range rrs {
+			// done this way so we can modify DNSResourceRecord to fix
+			// lengths if requested
+			if err := rrs[i].encode(&e, opts); err != nil {
+				return err
+			}
 		}
-		off += n
 	}
-	for i := range d.Additionals {
-		qa := &d.Answers[i]
-		n, err := qa.encode(bytes, off, opts)
-		if err != nil {
-			return err
-		}
-		off += n
+
+	data, err := b.PrependBytes(len(e.buf))
+	if err != nil {
+		return err
 	}
+	copy(data, e.buf)
+	return nil
+}
+
+// dnsEncoder builds a message, compressing names against those written
+// before them.
+type dnsEncoder struct {
+	buf []byte
+	// names maps the names written where compression is allowed, and
+	// their suffixes, to their offsets in the message.
+	names map[string]int
+}
 
+func (e *dnsEncoder) uint16(v uint16) {
+	e.buf = append(e.buf, byte(v>>8), byte(v))
+}
+
+func (e *dnsEncoder) uint32(v uint32) {
+	e.buf = append(e.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// name appends name, replacing its longest suffix written before with a
+// pointer if compress is set.  Names are compared exactly, so compression
+// never changes the case of a name.
+func (e *dnsEncoder) name(name []byte, compress bool) error {
+	if len(name) > 0 && name[len(name)-1] == '.' {
+		name = name[:len(name)-1]
+	}
+	if len(name) > 253 {
+		return fmt.Errorf("dns name %.20q... is too long", name)
+	}
+	for len(name) > 0 {
+		if compress {
+			if off, ok := e.names[string(name)]; ok {
+				e.uint16(0xc000 | uint16(off))
+				return nil
+			}
+			// Pointers only hold 14 bit offsets.
+			if len(e.buf) < 0x4000 {
+				e.names[string(name)] = len(e.buf)
+			}
+		}
+		label := name
+		name = nil
+		if i := bytes.IndexByte(label, '.'); i >= 0 {
+			label, name = label[:i], label[i+1:]
+		}
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("dns label %q has invalid length %d", label, len(label))
+		}
+		e.buf = append(e.buf, byte(len(label)))
+		e.buf = append(e.buf, label...)
+	}
+	e.buf = append(e.buf, 0)
 	return nil
 }
 
 var maxRecursion = errors.New("max DNS recursion level hit")
 
+var errDNSNameTruncated = errors.New("dns name runs past the end of the message")
+
 const maxRecursionLevel = 255
 
 func decodeName(data []byte, offset int, buffer *[]byte, level int) ([]byte, int, error) {
@@ -403,11 +504,14 @@ func decodeName(data []byte, offset int, buffer *[]byte, level int) ([]byte, int
 	}
 	start := len(*buffer)
 	index := offset
+	if index >= len(data) {
+		return nil, 0, errDNSNameTruncated
+	}
 	if data[index] == 0x00 {
 		return nil, index + 1, nil
 	}
 loop:
-	for data[index] != 0x00 {
+	for index < len(data) && data[index] != 0x00 {
 		switch data[index] & 0xc0 {
 		default:
 			/* RFC 1035
@@ -423,6 +527,9 @@ loop:
 				return nil, 0,
 					fmt.Errorf("dns name is too long")
 			}
+			if index2 > len(data) {
+				return nil, 0, errDNSNameTruncated
+			}
 			*buffer = append(*buffer, '.')
 			*buffer = append(*buffer, data[index+1:index2]...)
 			index = index2
@@ -448,6 +555,9 @@ loop:
 			      - a sequence of labels ending with a pointer
 			*/
 
+			if index+2 > len(data) {
+				return nil, 0, errDNSNameTruncated
+			}
 			offsetp := int(binary.BigEndian.Uint16(data[index:index+2]) & 0x3fff)
 			// This looks a little tricky, but actually isn't.  Because of how
 			// decodeName is written, calling it appends the decoded name to the
@@ -469,6 +579,9 @@ loop:
 				data[index], index)
 		}
 	}
+	if index >= len(data) {
+		return nil, 0, errDNSNameTruncated
+	}
 	return (*buffer)[start+1:], index + 1, nil
 }
 
@@ -476,6 +589,9 @@ type DNSQuestion struct {
 	Name  []byte
 	Type  DNSType
 	Class DNSClass
+	// UnicastResponse is the QU bit of mDNS questions (RFC 6762 section
+	// 5.4), which MDNS decodes from the top bit of the class.
+	UnicastResponse bool
 }
 
 func (q *DNSQuestion) decode(data []byte, offset int, df gopacket.DecodeFeedback, buffer *[]byte) (int, error) {
@@ -484,6 +600,10 @@ func (q *DNSQuestion) decode(data []byte, offset int, df gopacket.DecodeFeedback
 		return 0, err
 	}
 
+	if len(data) < endq+4 {
+		df.SetTruncated()
+		return 0, errors.New("DNS question truncated")
+	}
 	q.Name = name
 	q.Type = DNSType(binary.BigEndian.Uint16(data[endq : endq+2]))
 	q.Class = DNSClass(binary.BigEndian.Uint16(data[endq+2 : endq+4]))
@@ -491,11 +611,17 @@ func (q *DNSQuestion) decode(data []byte, offset int, df gopacket.DecodeFeedback
 	return endq + 4, nil
 }
 
-func (q *DNSQuestion) encode(data []byte, offset int) int {
-	noff := encodeName(q.Name, data, offset)
-	binary.BigEndian.PutUint16(data[noff:], uint16(q.Type))
-	binary.BigEndian.PutUint16(data[noff+2:], uint16(q.Class))
-	return len(q.Name) + 6
+func (q *DNSQuestion) encode(e *dnsEncoder) error {
+	if err := e.name(q.Name, true); err != nil {
+		return err
+	}
+	class := uint16(q.Class)
+	if q.UnicastResponse {
+		class |= 0x8000
+	}
+	e.uint16(uint16(q.Type))
+	e.uint16(class)
+	return nil
 }
 
 //  DNSResourceRecord
@@ -525,6 +651,9 @@ type DNSResourceRecord struct {
 	Type  DNSType
 	Class DNSClass
 	TTL   uint32
+	// CacheFlush is the cache-flush bit of mDNS records (RFC 6762 section
+	// 10.2), which MDNS decodes from the top bit of the class.
+	CacheFlush bool
 
 	// RDATA Raw Values
 	DataLength uint16
@@ -537,6 +666,12 @@ type DNSResourceRecord struct {
 	SOA            DNSSOA
 	SRV            DNSSRV
 	MX             DNSMX
+	OPT            []DNSOPT
+	DS             DNSDS
+	DNSKEY         DNSKEY
+	RRSIG          DNSRRSIG
+	NSEC           DNSNSEC
+	NSEC3          DNSNSEC3
 
 	// Undecoded TXT for backward compatibility
 	TXT []byte
@@ -549,11 +684,19 @@ func (rr *DNSResourceRecord) decode(data []byte, offset int, df gopacket.DecodeF
 		return 0, err
 	}
 
+	if len(data) < endq+10 {
+		df.SetTruncated()
+		return 0, errors.New("DNS resource record truncated")
+	}
 	rr.Name = name
 	rr.Type = DNSType(binary.BigEndian.Uint16(data[endq : endq+2]))
 	rr.Class = DNSClass(binary.BigEndian.Uint16(data[endq+2 : endq+4]))
 	rr.TTL = binary.BigEndian.Uint32(data[endq+4 : endq+8])
 	rr.DataLength = binary.BigEndian.Uint16(data[endq+8 : endq+10])
+	if len(data) < endq+10+int(rr.DataLength) {
+		df.SetTruncated()
+		return 0, errors.New("DNS resource record data truncated")
+	}
 	rr.Data = data[endq+10 : endq+10+int(rr.DataLength)]
 
 	if err = rr.decodeRData(data, endq+10, buffer); err != nil {
@@ -563,54 +706,141 @@ func (rr *DNSResourceRecord) decode(data []byte, offset int, df gopacket.DecodeF
 	return endq + 10 + int(rr.DataLength), nil
 }
 
-func encodeName(name []byte, data []byte, offset int) int {
-	l := 0
-	for i := range name {
-		if name[i] == '.' {
-			data[offset+i-l] = byte(l)
-			l = 0
-		} else {
-			// skip one to write the length
-			data[offset+i+1] = name[i]
-			l++
-		}
+func (rr *DNSResourceRecord) encode(e *dnsEncoder, opts gopacket.SerializeOptions) error {
+	if err := e.name(rr.Name, true); err != nil {
+		return err
 	}
-	// length for final portion
-	data[offset+len(name)-l] = byte(l)
-	data[offset+len(name)+1] = 0x00 // terminal
-	return offset + len(name) + 2
-}
-
-func (rr *DNSResourceRecord) encode(data []byte, offset int, opts gopacket.SerializeOptions) (int, error) {
-
-	noff := encodeName(rr.Name, data, offset)
+	class := uint16(rr.Class)
+	if rr.CacheFlush {
+		class |= 0x8000
+	}
+	e.uint16(uint16(rr.Type))
+	e.uint16(class)
+	e.uint32(rr.TTL)
+
+	// DataLength is filled in once the RDATA is written.
+	off := len(e.buf)
+	e.uint16(0)
+	if err := rr.encodeRData(e); err != nil {
+		return err
+	}
+	dSz := len(e.buf) - off - 2
+	if dSz > 0xffff {
+		return fmt.Errorf("%v resource record data is %d bytes, over 65535", rr.Type, dSz)
+	}
+	binary.BigEndian.PutUint16(e.buf[off:], uint16(dSz))
 
-	binary.BigEndian.PutUint16(data[noff:], uint16(rr.Type))
-	binary.BigEndian.PutUint16(data[noff+2:], uint16(rr.Class))
-	binary.BigEndian.PutUint32(data[noff+4:], uint32(rr.TTL))
+	if opts.FixLengths {
+		rr.DataLength = uint16(dSz)
+	}
+	return nil
+}
 
-	var dSz int
+func (rr *DNSResourceRecord) encodeRData(e *dnsEncoder) error {
 	switch rr.Type {
 	case DNSTypeA:
-		dSz = 4
-		copy(data[noff+10:], rr.IP)
+		ip := rr.IP.To4()
+		if ip == nil {
+			return fmt.Errorf("A resource record has invalid IPv4 address %v", rr.IP)
+		}
+		e.buf = append(e.buf, ip...)
 	case DNSTypeAAAA:
-		dSz = 16
-		copy(data[noff+10:], rr.IP)
+		ip := rr.IP.To16()
+		if ip == nil {
+			return fmt.Errorf("AAAA resource record has invalid IPv6 address %v", rr.IP)
+		}
+		e.buf = append(e.buf, ip...)
+	case DNSTypeNS:
+		return e.name(rr.NS, true)
 	case DNSTypeCNAME:
-		dSz = len(rr.CNAME) + 1
-		encodeName(rr.CNAME, data, noff+10)
+		return e.name(rr.CNAME, true)
+	case DNSTypePTR:
+		return e.name(rr.PTR, true)
+	case DNSTypeSOA:
+		if err := e.name(rr.SOA.MName, true); err != nil {
+			return err
+		}
+		if err := e.name(rr.SOA.RName, true); err != nil {
+			return err
+		}
+		e.uint32(rr.SOA.Serial)
+		e.uint32(rr.SOA.Refresh)
+		e.uint32(rr.SOA.Retry)
+		e.uint32(rr.SOA.Expire)
+		e.uint32(rr.SOA.Minimum)
+	case DNSTypeMX:
+		e.uint16(rr.MX.Preference)
+		return e.name(rr.MX.Name, true)
+	case DNSTypeSRV:
+		e.uint16(rr.SRV.Priority)
+		e.uint16(rr.SRV.Weight)
+		e.uint16(rr.SRV.Port)
+		return e.name(rr.SRV.Name, false)
+	case DNSTypeTXT, DNSTypeHINFO:
+		if rr.TXTs == nil {
+			e.buf = append(e.buf, rr.TXT...)
+			break
+		}
+		for _, txt := range rr.TXTs {
+			if len(txt) > 255 {
+				return fmt.Errorf("%v <character-string> is %d bytes, over 255", rr.Type, len(txt))
+			}
+			e.buf = append(e.buf, byte(len(txt)))
+			e.buf = append(e.buf, txt...)
+		}
+	case DNSTypeOPT:
+		for _, o := range rr.OPT {
+			if len(o.Data) > 0xffff {
+				return fmt.Errorf("EDNS0 option %v is %d bytes, over 65535", o.Code, len(o.Data))
+			}
+			e.uint16(uint16(o.Code))
+			e.uint16(uint16(len(o.Data)))
+			e.buf = append(e.buf, o.Data...)
+		}
+	case DNSTypeDS:
+		e.uint16(rr.DS.KeyTag)
+		e.buf = append(e.buf, byte(rr.DS.Algorithm), byte(rr.DS.DigestType))
+		e.buf = append(e.buf, rr.DS.Digest...)
+	case DNSTypeDNSKEY:
+		e.uint16(rr.DNSKEY.Flags)
+		e.buf = append(e.buf, rr.DNSKEY.Protocol, byte(rr.DNSKEY.Algorithm))
+		e.buf = append(e.buf, rr.DNSKEY.PublicKey...)
+	case DNSTypeRRSIG:
+		e.uint16(uint16(rr.RRSIG.TypeCovered))
+		e.buf = append(e.buf, byte(rr.RRSIG.Algorithm), rr.RRSIG.Labels)
+		e.uint32(rr.RRSIG.OriginalTTL)
+		e.uint32(rr.RRSIG.Expiration)
+		e.uint32(rr.RRSIG.Inception)
+		e.uint16(rr.RRSIG.KeyTag)
+		if err := e.name(rr.RRSIG.SignerName, false); err != nil {
+			return err
+		}
+		e.buf = append(e.buf, rr.RRSIG.Signature...)
+	case DNSTypeNSEC:
+		if err := e.name(rr.NSEC.NextDomain, false); err != nil {
+			return err
+		}
+		e.buf = appendDNSTypeBitmap(e.buf, rr.NSEC.Types)
+	case DNSTypeNSEC3:
+		if len(rr.NSEC3.Salt) > 255 || len(rr.NSEC3.NextHashedOwner) > 255 {
+			return errors.New("NSEC3 salt or hash longer than 255 bytes")
+		}
+		e.buf = append(e.buf, rr.NSEC3.HashAlgorithm, rr.NSEC3.Flags)
+		e.uint16(rr.NSEC3.Iterations)
+		e.buf = append(e.buf, byte(len(rr.NSEC3.Salt)))
+		e.buf = append(e.buf, rr.NSEC3.Salt...)
+		e.buf = append(e.buf, byte(len(rr.NSEC3.NextHashedOwner)))
+		e.buf = append(e.buf, rr.NSEC3.NextHashedOwner...)
+		e.buf = appendDNSTypeBitmap(e.buf, rr.NSEC3.Types)
 	default:
-		return 0, fmt.Errorf("serializing resource record of type %v not supported", rr.Type)
-	}
-	// DataLength
-	binary.BigEndian.PutUint16(data[noff+8:], uint16(dSz))
-
-	if opts.FixLengths {
-		rr.DataLength = uint16(dSz)
+		// The RDATA of other types holds no compressed names (RFC 3597
+		// section 4), so it's written as it was decoded.
+		if rr.Data == nil {
+			return fmt.Errorf("serializing resource record of type %v not supported", rr.Type)
+		}
+		e.buf = append(e.buf, rr.Data...)
 	}
-
-	return len(rr.Name) + 1 + 11 + dSz, nil
+	return nil
 }
 
 func (rr *DNSResourceRecord) String() string {
@@ -688,12 +918,18 @@ func (rr *DNSResourceRecord) decodeRData(data []byte, offset int, buffer *[]byte
 			return err
 		}
 		rr.SOA.RName = name
+		if len(data) < endq+20 {
+			return errDNSRDataTruncated
+		}
 		rr.SOA.Serial = binary.BigEndian.Uint32(data[endq : endq+4])
 		rr.SOA.Refresh = binary.BigEndian.Uint32(data[endq+4 : endq+8])
 		rr.SOA.Retry = binary.BigEndian.Uint32(data[endq+8 : endq+12])
 		rr.SOA.Expire = binary.BigEndian.Uint32(data[endq+12 : endq+16])
 		rr.SOA.Minimum = binary.BigEndian.Uint32(data[endq+16 : endq+20])
 	case DNSTypeMX:
+		if len(rr.Data) < 2 {
+			return errDNSRDataTruncated
+		}
 		rr.MX.Preference = binary.BigEndian.Uint16(data[offset : offset+2])
 		name, _, err := decodeName(data, offset+2, buffer, 1)
 		if err != nil {
@@ -701,6 +937,9 @@ func (rr *DNSResourceRecord) decodeRData(data []byte, offset int, buffer *[]byte
 		}
 		rr.MX.Name = name
 	case DNSTypeSRV:
+		if len(rr.Data) < 6 {
+			return errDNSRDataTruncated
+		}
 		rr.SRV.Priority = binary.BigEndian.Uint16(data[offset : offset+2])
 		rr.SRV.Weight = binary.BigEndian.Uint16(data[offset+2 : offset+4])
 		rr.SRV.Port = binary.BigEndian.Uint16(data[offset+4 : offset+6])
@@ -709,10 +948,90 @@ func (rr *DNSResourceRecord) decodeRData(data []byte, offset int, buffer *[]byte
 			return err
 		}
 		rr.SRV.Name = name
+	case DNSTypeOPT:
+		opts, err := decodeDNSOPTs(rr.Data)
+		if err != nil {
+			return err
+		}
+		rr.OPT = opts
+	case DNSTypeDS:
+		if len(rr.Data) < 4 {
+			return errDNSRDataTruncated
+		}
+		rr.DS = DNSDS{
+			KeyTag:     binary.BigEndian.Uint16(rr.Data),
+			Algorithm:  DNSSECAlgorithm(rr.Data[2]),
+			DigestType: DNSSECDigestType(rr.Data[3]),
+			Digest:     rr.Data[4:],
+		}
+	case DNSTypeDNSKEY:
+		if len(rr.Data) < 4 {
+			return errDNSRDataTruncated
+		}
+		rr.DNSKEY = DNSKEY{
+			Flags:     binary.BigEndian.Uint16(rr.Data),
+			Protocol:  rr.Data[2],
+			Algorithm: DNSSECAlgorithm(rr.Data[3]),
+			PublicKey: rr.Data[4:],
+		}
+	case DNSTypeRRSIG:
+		// The signer name is never compressed (RFC 4034 section 3.1.7),
+		// so it's decoded from the RDATA alone.
+		if len(rr.Data) < 18 {
+			return errDNSRDataTruncated
+		}
+		name, end, err := decodeName(rr.Data, 18, buffer, 1)
+		if err != nil {
+			return err
+		}
+		rr.RRSIG = DNSRRSIG{
+			TypeCovered: DNSType(binary.BigEndian.Uint16(rr.Data)),
+			Algorithm:   DNSSECAlgorithm(rr.Data[2]),
+			Labels:      rr.Data[3],
+			OriginalTTL: binary.BigEndian.Uint32(rr.Data[4:]),
+			Expiration:  binary.BigEndian.Uint32(rr.Data[8:]),
+			Inception:   binary.BigEndian.Uint32(rr.Data[12:]),
+			KeyTag:      binary.BigEndian.Uint16(rr.Data[16:]),
+			SignerName:  name,
+			Signature:   rr.Data[end:],
+		}
+	case DNSTypeNSEC:
+		name, end, err := decodeName(rr.Data, 0, buffer, 1)
+		if err != nil {
+			return err
+		}
+		types, err := decodeDNSTypeBitmap(rr.Data[end:])
+		if err != nil {
+			return err
+		}
+		rr.NSEC = DNSNSEC{NextDomain: name, Types: types}
+	case DNSTypeNSEC3:
+		b := rr.Data
+		if len(b) < 5 || len(b) < 5+int(b[4]) {
+			return errDNSRDataTruncated
+		}
+		rr.NSEC3 = DNSNSEC3{
+			HashAlgorithm: b[0],
+			Flags:         b[1],
+			Iterations:    binary.BigEndian.Uint16(b[2:]),
+			Salt:          b[5 : 5+int(b[4])],
+		}
+		b = b[5+int(b[4]):]
+		if len(b) < 1 || len(b) < 1+int(b[0]) {
+			return errDNSRDataTruncated
+		}
+		rr.NSEC3.NextHashedOwner = b[1 : 1+int(b[0])]
+		types, err := decodeDNSTypeBitmap(b[1+int(b[0]):])
+		if err != nil {
+			return err
+		}
+		rr.NSEC3.Types = types
 	}
 	return nil
 }
 
+var errDNSRDataTruncated = errors.New("DNS resource record data truncated")
+
 type DNSSOA struct {
 	MName, RName                            []byte
 	Serial, Refresh, Retry, Expire, Minimum uint32
@@ -727,3 +1046,395 @@ type DNSMX struct {
 	Preference uint16
 	Name       []byte
 }
+
+// DNSOptionCode is the code of an EDNS0 option.
+type DNSOptionCode uint16
+
+const (
+	DNSOptionCodeNSID          DNSOptionCode = 3  // Name server identifier [RFC5001]
+	DNSOptionCodeClientSubnet  DNSOptionCode = 8  // Client subnet          [RFC7871]
+	DNSOptionCodeExpire        DNSOptionCode = 9  // Zone expiry            [RFC7314]
+	DNSOptionCodeCookie        DNSOptionCode = 10 // Cookie                 [RFC7873]
+	DNSOptionCodeTCPKeepalive  DNSOptionCode = 11 // TCP keepalive          [RFC7828]
+	DNSOptionCodePadding       DNSOptionCode = 12 // Padding                [RFC7830]
+	DNSOptionCodeExtendedError DNSOptionCode = 15 // Extended DNS error     [RFC8914]
+)
+
+func (c DNSOptionCode) String() string {
+	switch c {
+	default:
+		return fmt.Sprintf("UnknownDNSOptionCode(%d)", uint16(c))
+	case DNSOptionCodeNSID:
+		return "NSID"
+	case DNSOptionCodeClientSubnet:
+		return "ClientSubnet"
+	case DNSOptionCodeExpire:
+		return "Expire"
+	case DNSOptionCodeCookie:
+		return "Cookie"
+	case DNSOptionCodeTCPKeepalive:
+		return "TCPKeepalive"
+	case DNSOptionCodePadding:
+		return "Padding"
+	case DNSOptionCodeExtendedError:
+		return "ExtendedError"
+	}
+}
+
+// DNSOPT is an option of an OPT pseudo-record (RFC 6891 section 6.1.2).
+type DNSOPT struct {
+	Code DNSOptionCode
+	Data []byte
+}
+
+func decodeDNSOPTs(data []byte) ([]DNSOPT, error) {
+	var opts []DNSOPT
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errDNSRDataTruncated
+		}
+		n := int(binary.BigEndian.Uint16(data[2:]))
+		if len(data) < 4+n {
+			return nil, errDNSRDataTruncated
+		}
+		opts = append(opts, DNSOPT{Code: DNSOptionCode(binary.BigEndian.Uint16(data)), Data: data[4 : 4+n]})
+		data = data[4+n:]
+	}
+	return opts, nil
+}
+
+// DNSClientSubnet is the data of a client subnet option (RFC 7871).
+type DNSClientSubnet struct {
+	// Family is the address family: 1 for IPv4, 2 for IPv6.
+	Family       uint16
+	SourcePrefix uint8
+	ScopePrefix  uint8
+	// Address is the subnet's address, whose bits past SourcePrefix are
+	// zero.
+	Address net.IP
+}
+
+// ClientSubnet decodes the data of a client subnet option.
+func (o DNSOPT) ClientSubnet() (DNSClientSubnet, error) {
+	if o.Code != DNSOptionCodeClientSubnet {
+		return DNSClientSubnet{}, fmt.Errorf("EDNS0 option %v isn't ClientSubnet", o.Code)
+	}
+	if len(o.Data) < 4 {
+		return DNSClientSubnet{}, errors.New("EDNS0 client subnet option truncated")
+	}
+	s := DNSClientSubnet{
+		Family:       binary.BigEndian.Uint16(o.Data),
+		SourcePrefix: o.Data[2],
+		ScopePrefix:  o.Data[3],
+	}
+	size := 0
+	switch s.Family {
+	case 1:
+		size = net.IPv4len
+	case 2:
+		size = net.IPv6len
+	default:
+		return s, fmt.Errorf("EDNS0 client subnet has unknown family %d", s.Family)
+	}
+	addr := o.Data[4:]
+	if len(addr) > size || int(s.SourcePrefix) > size*8 || len(addr) != (int(s.SourcePrefix)+7)/8 {
+		return s, fmt.Errorf("EDNS0 client subnet address is %d bytes for a /%d prefix", len(addr), s.SourcePrefix)
+	}
+	s.Address = make(net.IP, size)
+	copy(s.Address, addr)
+	return s, nil
+}
+
+// Option returns the client subnet option holding s, whose address is
+// truncated to its source prefix.
+func (s DNSClientSubnet) Option() DNSOPT {
+	n := (int(s.SourcePrefix) + 7) / 8
+	addr := s.Address
+	if s.Family == 1 {
+		addr = addr.To4()
+	}
+	data := make([]byte, 4+n)
+	binary.BigEndian.PutUint16(data, s.Family)
+	data[2] = s.SourcePrefix
+	data[3] = s.ScopePrefix
+	copy(data[4:], addr)
+	if bits := s.SourcePrefix % 8; bits != 0 {
+		data[len(data)-1] &= 0xff << (8 - bits)
+	}
+	return DNSOPT{Code: DNSOptionCodeClientSubnet, Data: data}
+}
+
+// DNSCookie is the data of a cookie option (RFC 7873 section 4).
+type DNSCookie struct {
+	// Client is the 8 byte client cookie, and Server the 8 to 32 byte
+	// server cookie, or nil in queries to servers not yet known.
+	Client, Server []byte
+}
+
+// Cookie decodes the data of a cookie option.
+func (o DNSOPT) Cookie() (DNSCookie, error) {
+	if o.Code != DNSOptionCodeCookie {
+		return DNSCookie{}, fmt.Errorf("EDNS0 option %v isn't Cookie", o.Code)
+	}
+	if n := len(o.Data); n != 8 && (n < 16 || n > 40) {
+		return DNSCookie{}, fmt.Errorf("EDNS0 cookie option has invalid length %d", n)
+	}
+	c := DNSCookie{Client: o.Data[:8]}
+	if len(o.Data) > 8 {
+		c.Server = o.Data[8:]
+	}
+	return c, nil
+}
+
+// Option returns the cookie option holding c.
+func (c DNSCookie) Option() DNSOPT {
+	data := make([]byte, 0, len(c.Client)+len(c.Server))
+	data = append(data, c.Client...)
+	data = append(data, c.Server...)
+	return DNSOPT{Code: DNSOptionCodeCookie, Data: data}
+}
+
+// DNSEDNS holds the EDNS0 fields of a message (RFC 6891 section 6.1.3),
+// which its OPT pseudo-record carries in its class and TTL.
+type DNSEDNS struct {
+	// UDPSize is the largest UDP payload the sender can reassemble.
+	UDPSize uint16
+	// ExtendedRCode holds the upper 8 bits of the message's 12 bit
+	// response code.
+	ExtendedRCode uint8
+	Version       uint8
+	// DO is set if the sender accepts DNSSEC records.
+	DO bool
+	// Z holds the other 15 flag bits, which are reserved.
+	Z       uint16
+	Options []DNSOPT
+}
+
+// EDNS returns the EDNS0 fields of d, and whether it has an OPT
+// pseudo-record.
+func (d *DNS) EDNS() (DNSEDNS, bool) {
+	for i := range d.Additionals {
+		if rr := &d.Additionals[i]; rr.Type == DNSTypeOPT {
+			return DNSEDNS{
+				UDPSize:       uint16(rr.Class),
+				ExtendedRCode: uint8(rr.TTL >> 24),
+				Version:       uint8(rr.TTL >> 16),
+				DO:            rr.TTL&0x8000 != 0,
+				Z:             uint16(rr.TTL & 0x7fff),
+				Options:       rr.OPT,
+			}, true
+		}
+	}
+	return DNSEDNS{}, false
+}
+
+// Record returns the OPT pseudo-record carrying e, to be added to the
+// additional records of a message.
+func (e DNSEDNS) Record() DNSResourceRecord {
+	ttl := uint32(e.ExtendedRCode)<<24 | uint32(e.Version)<<16 | uint32(e.Z&0x7fff)
+	if e.DO {
+		ttl |= 0x8000
+	}
+	return DNSResourceRecord{
+		Type:  DNSTypeOPT,
+		Class: DNSClass(e.UDPSize),
+		TTL:   ttl,
+		OPT:   e.Options,
+	}
+}
+
+// DNSSECAlgorithm is a DNSSEC signing algorithm.
+type DNSSECAlgorithm uint8
+
+const (
+	DNSSECAlgorithmRSAMD5           DNSSECAlgorithm = 1  // [RFC3110]
+	DNSSECAlgorithmDSA              DNSSECAlgorithm = 3  // [RFC2536]
+	DNSSECAlgorithmRSASHA1          DNSSECAlgorithm = 5  // [RFC3110]
+	DNSSECAlgorithmDSANSEC3SHA1     DNSSECAlgorithm = 6  // [RFC5155]
+	DNSSECAlgorithmRSASHA1NSEC3SHA1 DNSSECAlgorithm = 7  // [RFC5155]
+	DNSSECAlgorithmRSASHA256        DNSSECAlgorithm = 8  // [RFC5702]
+	DNSSECAlgorithmRSASHA512        DNSSECAlgorithm = 10 // [RFC5702]
+	DNSSECAlgorithmECCGOST          DNSSECAlgorithm = 12 // [RFC5933]
+	DNSSECAlgorithmECDSAP256SHA256  DNSSECAlgorithm = 13 // [RFC6605]
+	DNSSECAlgorithmECDSAP384SHA384  DNSSECAlgorithm = 14 // [RFC6605]
+	DNSSECAlgorithmED25519          DNSSECAlgorithm = 15 // [RFC8080]
+	DNSSECAlgorithmED448            DNSSECAlgorithm = 16 // [RFC8080]
+)
+
+func (a DNSSECAlgorithm) String() string {
+	switch a {
+	default:
+		return fmt.Sprintf("UnknownDNSSECAlgorithm(%d)", uint8(a))
+	case DNSSECAlgorithmRSAMD5:
+		return "RSAMD5"
+	case DNSSECAlgorithmDSA:
+		return "DSA"
+	case DNSSECAlgorithmRSASHA1:
+		return "RSASHA1"
+	case DNSSECAlgorithmDSANSEC3SHA1:
+		return "DSA-NSEC3-SHA1"
+	case DNSSECAlgorithmRSASHA1NSEC3SHA1:
+		return "RSASHA1-NSEC3-SHA1"
+	case DNSSECAlgorithmRSASHA256:
+		return "RSASHA256"
+	case DNSSECAlgorithmRSASHA512:
+		return "RSASHA512"
+	case DNSSECAlgorithmECCGOST:
+		return "ECC-GOST"
+	case DNSSECAlgorithmECDSAP256SHA256:
+		return "ECDSAP256SHA256"
+	case DNSSECAlgorithmECDSAP384SHA384:
+		return "ECDSAP384SHA384"
+	case DNSSECAlgorithmED25519:
+		return "ED25519"
+	case DNSSECAlgorithmED448:
+		return "ED448"
+	}
+}
+
+// DNSSECDigestType is the digest algorithm of a DS record.
+type DNSSECDigestType uint8
+
+const (
+	DNSSECDigestTypeSHA1   DNSSECDigestType = 1 // [RFC3658]
+	DNSSECDigestTypeSHA256 DNSSECDigestType = 2 // [RFC4509]
+	DNSSECDigestTypeGOST   DNSSECDigestType = 3 // [RFC5933]
+	DNSSECDigestTypeSHA384 DNSSECDigestType = 4 // [RFC6605]
+)
+
+func (t DNSSECDigestType) String() string {
+	switch t {
+	default:
+		return fmt.Sprintf("UnknownDNSSECDigestType(%d)", uint8(t))
+	case DNSSECDigestTypeSHA1:
+		return "SHA1"
+	case DNSSECDigestTypeSHA256:
+		return "SHA256"
+	case DNSSECDigestTypeGOST:
+		return "GOST"
+	case DNSSECDigestTypeSHA384:
+		return "SHA384"
+	}
+}
+
+// DNSDS is the RDATA of a DS record (RFC 4034 section 5).
+type DNSDS struct {
+	KeyTag     uint16
+	Algorithm  DNSSECAlgorithm
+	DigestType DNSSECDigestType
+	Digest     []byte
+}
+
+// DNSKEY flags (RFC 4034 section 2.1.1, RFC 5011 section 7).
+const (
+	DNSKEYFlagZone   uint16 = 0x0100
+	DNSKEYFlagRevoke uint16 = 0x0080
+	DNSKEYFlagSEP    uint16 = 0x0001
+)
+
+// DNSKEY is the RDATA of a DNSKEY record (RFC 4034 section 2).
+type DNSKEY struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm DNSSECAlgorithm
+	PublicKey []byte
+}
+
+// KeyTag returns the key tag of k, which RRSIG and DS records use to
+// refer to it (RFC 4034 appendix B).
+func (k DNSKEY) KeyTag() uint16 {
+	if k.Algorithm == DNSSECAlgorithmRSAMD5 {
+		// The tag is the third to last and second to last bytes of the
+		// modulus.
+		if len(k.PublicKey) < 3 {
+			return 0
+		}
+		return binary.BigEndian.Uint16(k.PublicKey[len(k.PublicKey)-3:])
+	}
+	sum := uint32(k.Flags) + uint32(k.Protocol)<<8 + uint32(k.Algorithm)
+	for i, b := range k.PublicKey {
+		if i%2 == 0 {
+			sum += uint32(b) << 8
+		} else {
+			sum += uint32(b)
+		}
+	}
+	sum += sum >> 16
+	return uint16(sum)
+}
+
+// DNSRRSIG is the RDATA of an RRSIG record (RFC 4034 section 3).
+type DNSRRSIG struct {
+	TypeCovered DNSType
+	Algorithm   DNSSECAlgorithm
+	Labels      uint8
+	OriginalTTL uint32
+	// Expiration and Inception are seconds since the epoch, modulo 2^32.
+	Expiration, Inception uint32
+	KeyTag                uint16
+	SignerName            []byte
+	Signature             []byte
+}
+
+// DNSNSEC is the RDATA of an NSEC record (RFC 4034 section 4).
+type DNSNSEC struct {
+	NextDomain []byte
+	// Types are the types of the records of the owner name, in order.
+	Types []DNSType
+}
+
+// DNSNSEC3 is the RDATA of an NSEC3 record (RFC 5155 section 3).
+type DNSNSEC3 struct {
+	HashAlgorithm uint8
+	// Flags holds the opt-out flag, 0x01.
+	Flags           uint8
+	Iterations      uint16
+	Salt            []byte
+	NextHashedOwner []byte
+	Types           []DNSType
+}
+
+// decodeDNSTypeBitmap decodes the type bitmaps of NSEC and NSEC3 records
+// (RFC 4034 section 4.1.2).
+func decodeDNSTypeBitmap(data []byte) ([]DNSType, error) {
+	var types []DNSType
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errDNSRDataTruncated
+		}
+		window, n := uint16(data[0])<<8, int(data[1])
+		if n == 0 || n > 32 {
+			return nil, fmt.Errorf("DNS type bitmap has invalid length %d", n)
+		}
+		if len(data) < 2+n {
+			return nil, errDNSRDataTruncated
+		}
+		for i, b := range data[2 : 2+n] {
+			for bit := uint(0); bit < 8; bit++ {
+				if b&(0x80>>bit) != 0 {
+					types = append(types, DNSType(window|uint16(i*8)|uint16(bit)))
+				}
+			}
+		}
+		data = data[2+n:]
+	}
+	return types, nil
+}
+
+func appendDNSTypeBitmap(data []byte, types []DNSType) []byte {
+	sorted := append([]DNSType(nil), types...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for i := 0; i < len(sorted); {
+		window := sorted[i] >> 8
+		var bits [32]byte
+		n := 0
+		for ; i < len(sorted) && sorted[i]>>8 == window; i++ {
+			lo := int(sorted[i] & 0xff)
+			bits[lo/8] |= 0x80 >> uint(lo%8)
+			n = lo/8 + 1
+		}
+		data = append(data, byte(window), byte(n))
+		data = append(data, bits[:n]...)
+	}
+	return data
+}
@@ -8,7 +8,9 @@ package layers
 
 import (
 	"bytes"
+	"encoding/base64"
 	"net"
+	"reflect"
 	"testing"
 
 	"github.com/mistsys/gopacket"
@@ -340,3 +342,146 @@ func TestDNSEncodeResponse(t *testing.T) {
 	dns2 := p2.Layer(LayerTypeDNS).(*DNS)
 	testDNSEqual(t, dns, dns2)
 }
+
+func TestDNSEDNS(t *testing.T) {
+	p := gopacket.NewPacket(testPacketDNSRegression, LinkTypeEthernet, testDecodeOptions)
+	dns := p.Layer(LayerTypeDNS).(*DNS)
+	e, ok := dns.EDNS()
+	if !ok {
+		t.Fatal("no EDNS0 record")
+	}
+	if want := (DNSEDNS{UDPSize: 4096, DO: true}); !reflect.DeepEqual(e, want) {
+		t.Errorf("got EDNS0 %+v, want %+v", e, want)
+	}
+}
+
+func TestDNSEncodeEDNSOptions(t *testing.T) {
+	subnet := DNSClientSubnet{Family: 1, SourcePrefix: 20, Address: net.IP{192, 0, 2, 255}}
+	cookie := DNSCookie{Client: []byte("12345678"), Server: []byte("abcdefghijklmnop")}
+	edns := DNSEDNS{UDPSize: 1232, Version: 0, DO: true, Options: []DNSOPT{subnet.Option(), cookie.Option()}}
+	dns := &DNS{ID: 1, RD: true,
+		Questions:   []DNSQuestion{{Name: []byte("example.com"), Type: DNSTypeA, Class: DNSClassIN}},
+		Additionals: []DNSResourceRecord{edns.Record()},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, dns); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeDNS, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	got, ok := p.Layer(LayerTypeDNS).(*DNS).EDNS()
+	if !ok {
+		t.Fatal("no EDNS0 record")
+	}
+	if got.UDPSize != 1232 || !got.DO || len(got.Options) != 2 {
+		t.Fatalf("got EDNS0 %+v", got)
+	}
+	s, err := got.Options[0].ClientSubnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (DNSClientSubnet{Family: 1, SourcePrefix: 20, Address: net.IP{192, 0, 0, 0}}); !reflect.DeepEqual(s, want) {
+		t.Errorf("got client subnet %+v, want %+v", s, want)
+	}
+	c, err := got.Options[1].Cookie()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, cookie) {
+		t.Errorf("got cookie %+v, want %+v", c, cookie)
+	}
+	if _, err := got.Options[1].ClientSubnet(); err == nil {
+		t.Error("cookie decoded as a client subnet")
+	}
+}
+
+// testDNSKEY is dskey.example.com's key from RFC 4034 section 5.4, whose
+// key tag is 60485.
+var testDNSKEY = "AQOeiiR0GOMYkDshWoSKz9XzfwJr1AYtsmx3TGkJaNXVbfi/2pHm822aJ5iI9BMzNXxeYCmZDRD99WYwYqUSdjMmmAphXdvxegXd/M5+X7OrzKBaMbCVdFLUUh6DhweJBjEVv5f2wwjM9XzcnOf+EPbtG9DMBmADjFDc2w/rljwvFw=="
+
+func TestDNSKEYKeyTag(t *testing.T) {
+	key, err := base64.StdEncoding.DecodeString(testDNSKEY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := DNSKEY{Flags: DNSKEYFlagZone, Protocol: 3, Algorithm: DNSSECAlgorithmRSASHA1, PublicKey: key}
+	if tag := k.KeyTag(); tag != 60485 {
+		t.Errorf("got key tag %d, want 60485", tag)
+	}
+}
+
+func TestDNSEncodeDNSSEC(t *testing.T) {
+	key, _ := base64.StdEncoding.DecodeString(testDNSKEY)
+	dns := &DNS{ID: 2, QR: true, AA: true,
+		Questions: []DNSQuestion{{Name: []byte("www.example.com"), Type: DNSTypeA, Class: DNSClassIN}},
+		Answers: []DNSResourceRecord{
+			{Name: []byte("www.example.com"), Type: DNSTypeA, Class: DNSClassIN, TTL: 300, IP: net.IP{192, 0, 2, 1}},
+			{Name: []byte("www.example.com"), Type: DNSTypeRRSIG, Class: DNSClassIN, TTL: 300, RRSIG: DNSRRSIG{
+				TypeCovered: DNSTypeA, Algorithm: DNSSECAlgorithmRSASHA1, Labels: 3, OriginalTTL: 300,
+				Expiration: 1700000000, Inception: 1690000000, KeyTag: 60485,
+				SignerName: []byte("example.com"), Signature: []byte{1, 2, 3, 4},
+			}},
+		},
+		Authorities: []DNSResourceRecord{
+			{Name: []byte("example.com"), Type: DNSTypeNSEC, Class: DNSClassIN, TTL: 300, NSEC: DNSNSEC{
+				NextDomain: []byte("www.example.com"),
+				Types:      []DNSType{DNSTypeA, DNSTypeNS, DNSTypeSOA, DNSTypeRRSIG, DNSTypeNSEC, DNSTypeDNSKEY, 1234},
+			}},
+			{Name: []byte("2vptu5timamqttgl4luu9kg21e0aor3s.example.com"), Type: DNSTypeNSEC3, Class: DNSClassIN, TTL: 300, NSEC3: DNSNSEC3{
+				HashAlgorithm: 1, Flags: 1, Iterations: 12, Salt: []byte{0xaa, 0xbb, 0xcc, 0xdd},
+				NextHashedOwner: []byte{0x01, 0x02, 0x03}, Types: []DNSType{DNSTypeMX, DNSTypeRRSIG},
+			}},
+			{Name: []byte("sub.example.com"), Type: DNSTypeDS, Class: DNSClassIN, TTL: 300, DS: DNSDS{
+				KeyTag: 60485, Algorithm: DNSSECAlgorithmRSASHA1, DigestType: DNSSECDigestTypeSHA1, Digest: []byte{9, 8, 7},
+			}},
+		},
+		Additionals: []DNSResourceRecord{
+			{Name: []byte("example.com"), Type: DNSTypeDNSKEY, Class: DNSClassIN, TTL: 300, DNSKEY: DNSKEY{
+				Flags: DNSKEYFlagZone, Protocol: 3, Algorithm: DNSSECAlgorithmRSASHA1, PublicKey: key,
+			}},
+		},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, dns); err != nil {
+		t.Fatal(err)
+	}
+	// The signer and next domain names must be written in full, though
+	// they could point at earlier names.
+	if n := bytes.Count(buf.Bytes(), []byte("\x07example\x03com\x00")); n != 3 {
+		t.Errorf("example.com written in full %d times, want 3", n)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeDNS, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	got := p.Layer(LayerTypeDNS).(*DNS)
+	testDNSEqual(t, dns, got)
+	if !reflect.DeepEqual(got.Answers[1].RRSIG, dns.Answers[1].RRSIG) {
+		t.Errorf("got RRSIG %+v, want %+v", got.Answers[1].RRSIG, dns.Answers[1].RRSIG)
+	}
+	if !reflect.DeepEqual(got.Authorities[0].NSEC, dns.Authorities[0].NSEC) {
+		t.Errorf("got NSEC %+v, want %+v", got.Authorities[0].NSEC, dns.Authorities[0].NSEC)
+	}
+	if !reflect.DeepEqual(got.Authorities[1].NSEC3, dns.Authorities[1].NSEC3) {
+		t.Errorf("got NSEC3 %+v, want %+v", got.Authorities[1].NSEC3, dns.Authorities[1].NSEC3)
+	}
+	if !reflect.DeepEqual(got.Authorities[2].DS, dns.Authorities[2].DS) {
+		t.Errorf("got DS %+v, want %+v", got.Authorities[2].DS, dns.Authorities[2].DS)
+	}
+	if !reflect.DeepEqual(got.Additionals[0].DNSKEY, dns.Additionals[0].DNSKEY) {
+		t.Errorf("got DNSKEY %+v, want %+v", got.Additionals[0].DNSKEY, dns.Additionals[0].DNSKEY)
+	}
+}
+
+func TestDNSTruncated(t *testing.T) {
+	p := gopacket.NewPacket(testPacketDNSRegression, LinkTypeEthernet, testDecodeOptions)
+	data := p.Layer(LayerTypeDNS).LayerContents()
+	for n := 12; n < len(data); n++ {
+		var dns DNS
+		if err := dns.DecodeFromBytes(data[:n], gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("%d of %d bytes decoded without error", n, len(data))
+		}
+	}
+}
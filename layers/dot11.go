@@ -257,14 +257,20 @@ const (
 	Dot11InformationElementIDERPInfo2           Dot11InformationElementID = 47
 	Dot11InformationElementIDRSNInfo            Dot11InformationElementID = 48
 	Dot11InformationElementIDESRates            Dot11InformationElementID = 50
+	Dot11InformationElementIDNeighborReport     Dot11InformationElementID = 52
 	Dot11InformationElementHTOperation          Dot11InformationElementID = 61
 	Dot11InformationElementIDReserved           Dot11InformationElementID = 68
+	Dot11InformationElementIDInterworking       Dot11InformationElementID = 107
+	Dot11InformationElementIDAdvertisementProto Dot11InformationElementID = 108
+	Dot11InformationElementIDRoamingConsortium  Dot11InformationElementID = 111
+	Dot11InformationElementIDEmergencyAlertID   Dot11InformationElementID = 112
 	Dot11InformationElementExtendedCapabilities Dot11InformationElementID = 127
 	Dot11InformationElementCiscoCCX1CKIP        Dot11InformationElementID = 133
 	Dot11InformationElementCiscoCCX3            Dot11InformationElementID = 149
 	Dot11InformationElementVHTCapabilities      Dot11InformationElementID = 191
 	Dot11InformationElementVHTOperation         Dot11InformationElementID = 192
 	Dot11InformationElementIDVendor             Dot11InformationElementID = 221
+	Dot11InformationElementIDExtension          Dot11InformationElementID = 255
 )
 
 // String provides a human readable string for Dot11InformationElementID.
@@ -301,12 +307,24 @@ func (a Dot11InformationElementID) String() string {
 		return "RSNinfo"
 	case Dot11InformationElementIDESRates:
 		return "ESrates"
+	case Dot11InformationElementIDNeighborReport:
+		return "Neighbor report"
 	case Dot11InformationElementHTOperation:
 		return "HT operation"
 	case Dot11InformationElementIDVendor:
 		return "Vendor"
+	case Dot11InformationElementIDExtension:
+		return "Extension"
 	case Dot11InformationElementIDReserved:
 		return "Reserved"
+	case Dot11InformationElementIDInterworking:
+		return "Interworking"
+	case Dot11InformationElementIDAdvertisementProto:
+		return "Advertisement protocol"
+	case Dot11InformationElementIDRoamingConsortium:
+		return "Roaming consortium"
+	case Dot11InformationElementIDEmergencyAlertID:
+		return "Emergency alert identifier"
 	case Dot11InformationElementExtendedCapabilities:
 		return "Extended capabilities"
 	case Dot11InformationElementVHTCapabilities:
@@ -1060,6 +1078,9 @@ func (m *Dot11MgmtReassociationReq) DecodeFromBytes(data []byte, df gopacket.Dec
 
 type Dot11MgmtReassociationResp struct {
 	Dot11Mgmt
+	CapabilityInfo uint16
+	Status         Dot11Status
+	AID            uint16
 }
 
 func decodeDot11MgmtReassociationResp(data []byte, p gopacket.PacketBuilder) error {
@@ -1076,6 +1097,17 @@ func (m *Dot11MgmtReassociationResp) CanDecode() gopacket.LayerClass {
 func (m *Dot11MgmtReassociationResp) NextLayerType() gopacket.LayerType {
 	return LayerTypeDot11InformationElement
 }
+func (m *Dot11MgmtReassociationResp) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 6 {
+		df.SetTruncated()
+		return fmt.Errorf("Dot11MgmtReassociationResp length %v too short, %v required", len(data), 6)
+	}
+	m.CapabilityInfo = binary.LittleEndian.Uint16(data[0:2])
+	m.Status = Dot11Status(binary.LittleEndian.Uint16(data[2:4]))
+	m.AID = binary.LittleEndian.Uint16(data[4:6])
+	m.Payload = data[6:]
+	return m.Dot11Mgmt.DecodeFromBytes(data, df)
+}
 
 type Dot11MgmtProbeReq struct {
 	Dot11Mgmt
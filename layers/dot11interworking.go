@@ -0,0 +1,374 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// The elements here describe interworking with external networks (IEEE
+// 802.11u), which Hotspot 2.0 (Passpoint) builds on: what kind of network
+// a BSS is, where it is, which roaming consortiums it serves, how to query
+// it with ANQP, and which emergency alerts it holds.
+
+// Dot11AccessNetworkType is the access network type of an Interworking
+// element.
+type Dot11AccessNetworkType uint8
+
+const (
+	Dot11AccessNetworkPrivate            Dot11AccessNetworkType = 0
+	Dot11AccessNetworkPrivateGuest       Dot11AccessNetworkType = 1
+	Dot11AccessNetworkChargeablePublic   Dot11AccessNetworkType = 2
+	Dot11AccessNetworkFreePublic         Dot11AccessNetworkType = 3
+	Dot11AccessNetworkPersonalDevice     Dot11AccessNetworkType = 4
+	Dot11AccessNetworkEmergencyServices  Dot11AccessNetworkType = 5
+	Dot11AccessNetworkTestOrExperimental Dot11AccessNetworkType = 14
+	Dot11AccessNetworkWildcard           Dot11AccessNetworkType = 15
+)
+
+func (t Dot11AccessNetworkType) String() string {
+	switch t {
+	case Dot11AccessNetworkPrivate:
+		return "Private"
+	case Dot11AccessNetworkPrivateGuest:
+		return "PrivateWithGuestAccess"
+	case Dot11AccessNetworkChargeablePublic:
+		return "ChargeablePublic"
+	case Dot11AccessNetworkFreePublic:
+		return "FreePublic"
+	case Dot11AccessNetworkPersonalDevice:
+		return "PersonalDevice"
+	case Dot11AccessNetworkEmergencyServices:
+		return "EmergencyServicesOnly"
+	case Dot11AccessNetworkTestOrExperimental:
+		return "TestOrExperimental"
+	case Dot11AccessNetworkWildcard:
+		return "Wildcard"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(t))
+}
+
+// Dot11VenueGroup is the venue group of an Interworking element.  The
+// meaning of the venue type depends on the group.
+type Dot11VenueGroup uint8
+
+const (
+	Dot11VenueUnspecified   Dot11VenueGroup = 0
+	Dot11VenueAssembly      Dot11VenueGroup = 1
+	Dot11VenueBusiness      Dot11VenueGroup = 2
+	Dot11VenueEducational   Dot11VenueGroup = 3
+	Dot11VenueIndustrial    Dot11VenueGroup = 4
+	Dot11VenueInstitutional Dot11VenueGroup = 5
+	Dot11VenueMercantile    Dot11VenueGroup = 6
+	Dot11VenueResidential   Dot11VenueGroup = 7
+	Dot11VenueStorage       Dot11VenueGroup = 8
+	Dot11VenueUtility       Dot11VenueGroup = 9
+	Dot11VenueVehicular     Dot11VenueGroup = 10
+	Dot11VenueOutdoor       Dot11VenueGroup = 11
+)
+
+func (g Dot11VenueGroup) String() string {
+	switch g {
+	case Dot11VenueUnspecified:
+		return "Unspecified"
+	case Dot11VenueAssembly:
+		return "Assembly"
+	case Dot11VenueBusiness:
+		return "Business"
+	case Dot11VenueEducational:
+		return "Educational"
+	case Dot11VenueIndustrial:
+		return "FactoryAndIndustrial"
+	case Dot11VenueInstitutional:
+		return "Institutional"
+	case Dot11VenueMercantile:
+		return "Mercantile"
+	case Dot11VenueResidential:
+		return "Residential"
+	case Dot11VenueStorage:
+		return "Storage"
+	case Dot11VenueUtility:
+		return "UtilityAndMiscellaneous"
+	case Dot11VenueVehicular:
+		return "Vehicular"
+	case Dot11VenueOutdoor:
+		return "Outdoor"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(g))
+}
+
+// Dot11Interworking is the body of an Interworking element.
+type Dot11Interworking struct {
+	AccessNetworkType Dot11AccessNetworkType
+	// Internet is true if the network provides internet access.
+	Internet bool
+	// ASRA (additional step required for access) is true if clients must
+	// do more than associate, such as accept terms on a captive portal.
+	ASRA bool
+	// ESR (emergency services reachable) is true if emergency services can
+	// be reached through the network.
+	ESR bool
+	// UESA (unauthenticated emergency service accessible) is true if
+	// clients can reach emergency services without authenticating.
+	UESA bool
+	// HasVenue is true if VenueGroup and VenueType are present.
+	HasVenue   bool
+	VenueGroup Dot11VenueGroup
+	VenueType  uint8
+	// HESSID identifies the homogeneous ESS the BSS is part of, or is nil.
+	HESSID net.HardwareAddr
+}
+
+// Interworking decodes d as an Interworking element.
+func (d *Dot11InformationElement) Interworking() (*Dot11Interworking, error) {
+	if d.ID != Dot11InformationElementIDInterworking {
+		return nil, errors.New("not an Interworking element")
+	}
+	b := d.Info
+	i := &Dot11Interworking{}
+	switch len(b) {
+	case 1, 7:
+	case 3, 9:
+		i.HasVenue = true
+		i.VenueGroup, i.VenueType = Dot11VenueGroup(b[1]), b[2]
+	default:
+		return nil, fmt.Errorf("invalid Interworking element length %d", len(b))
+	}
+	i.AccessNetworkType = Dot11AccessNetworkType(b[0] & 0xf)
+	i.Internet = b[0]&0x10 != 0
+	i.ASRA = b[0]&0x20 != 0
+	i.ESR = b[0]&0x40 != 0
+	i.UESA = b[0]&0x80 != 0
+	if len(b) >= 7 {
+		i.HESSID = net.HardwareAddr(b[len(b)-6:])
+	}
+	return i, nil
+}
+
+// InformationElement returns i as an element, for serialization.
+func (i *Dot11Interworking) InformationElement() (*Dot11InformationElement, error) {
+	if i.AccessNetworkType > 0xf {
+		return nil, fmt.Errorf("invalid access network type %d", i.AccessNetworkType)
+	}
+	options := uint8(i.AccessNetworkType)
+	for bit, set := range []bool{i.Internet, i.ASRA, i.ESR, i.UESA} {
+		if set {
+			options |= 0x10 << uint(bit)
+		}
+	}
+	info := []byte{options}
+	if i.HasVenue {
+		info = append(info, uint8(i.VenueGroup), i.VenueType)
+	}
+	if i.HESSID != nil {
+		if len(i.HESSID) != 6 {
+			return nil, fmt.Errorf("invalid HESSID %v", i.HESSID)
+		}
+		info = append(info, i.HESSID...)
+	}
+	return &Dot11InformationElement{
+		ID:     Dot11InformationElementIDInterworking,
+		Length: uint8(len(info)),
+		Info:   info,
+	}, nil
+}
+
+// Dot11AdvertisementProtocolID identifies a protocol listed in an
+// Advertisement Protocol element.
+type Dot11AdvertisementProtocolID uint8
+
+const (
+	Dot11AdvertisementProtocolANQP            Dot11AdvertisementProtocolID = 0
+	Dot11AdvertisementProtocolMIHInfo         Dot11AdvertisementProtocolID = 1
+	Dot11AdvertisementProtocolMIHCommandEvent Dot11AdvertisementProtocolID = 2
+	Dot11AdvertisementProtocolEAS             Dot11AdvertisementProtocolID = 3
+	Dot11AdvertisementProtocolVendor          Dot11AdvertisementProtocolID = 221
+)
+
+func (p Dot11AdvertisementProtocolID) String() string {
+	switch p {
+	case Dot11AdvertisementProtocolANQP:
+		return "ANQP"
+	case Dot11AdvertisementProtocolMIHInfo:
+		return "MIHInformationService"
+	case Dot11AdvertisementProtocolMIHCommandEvent:
+		return "MIHCommandAndEventServicesDiscovery"
+	case Dot11AdvertisementProtocolEAS:
+		return "EmergencyAlertSystem"
+	case Dot11AdvertisementProtocolVendor:
+		return "VendorSpecific"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(p))
+}
+
+// Dot11AdvertisementProtocol is a protocol listed in an Advertisement
+// Protocol element.
+type Dot11AdvertisementProtocol struct {
+	ID Dot11AdvertisementProtocolID
+	// QueryResponseLengthLimit is the largest query response the AP sends
+	// in GAS frames, in 256 byte units; 0x7f means no limit.
+	QueryResponseLengthLimit uint8
+	// PAMEBI is the pre-association message exchange BSSID independent
+	// bit.
+	PAMEBI bool
+	// Vendor is the body of the vendor specific element identifying a
+	// Dot11AdvertisementProtocolVendor protocol, starting with its OUI.
+	Vendor []byte
+}
+
+// Dot11AdvertisementProtocols is the body of an Advertisement Protocol
+// element.
+type Dot11AdvertisementProtocols []Dot11AdvertisementProtocol
+
+// AdvertisementProtocols decodes d as an Advertisement Protocol element.
+func (d *Dot11InformationElement) AdvertisementProtocols() (Dot11AdvertisementProtocols, error) {
+	if d.ID != Dot11InformationElementIDAdvertisementProto {
+		return nil, errors.New("not an Advertisement Protocol element")
+	}
+	var out Dot11AdvertisementProtocols
+	for b := d.Info; len(b) > 0; {
+		if len(b) < 2 {
+			return nil, fmt.Errorf("Advertisement Protocol tuple length %d too short, 2 required", len(b))
+		}
+		p := Dot11AdvertisementProtocol{
+			ID:                       Dot11AdvertisementProtocolID(b[1]),
+			QueryResponseLengthLimit: b[0] & 0x7f,
+			PAMEBI:                   b[0]&0x80 != 0,
+		}
+		b = b[2:]
+		if p.ID == Dot11AdvertisementProtocolVendor {
+			if len(b) < 1 || len(b) < 1+int(b[0]) {
+				return nil, fmt.Errorf("Advertisement Protocol vendor specific protocol truncated")
+			}
+			p.Vendor = b[1 : 1+int(b[0])]
+			b = b[1+int(b[0]):]
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// InformationElement returns ps as an element, for serialization.
+func (ps Dot11AdvertisementProtocols) InformationElement() (*Dot11InformationElement, error) {
+	var info []byte
+	for _, p := range ps {
+		if p.QueryResponseLengthLimit > 0x7f {
+			return nil, fmt.Errorf("query response length limit %d too large", p.QueryResponseLengthLimit)
+		}
+		b := p.QueryResponseLengthLimit
+		if p.PAMEBI {
+			b |= 0x80
+		}
+		info = append(info, b, uint8(p.ID))
+		if p.ID == Dot11AdvertisementProtocolVendor {
+			if len(p.Vendor) > 0xff {
+				return nil, fmt.Errorf("vendor specific protocol length %d too long", len(p.Vendor))
+			}
+			info = append(info, uint8(len(p.Vendor)))
+			info = append(info, p.Vendor...)
+		}
+	}
+	if len(info) > 0xff {
+		return nil, fmt.Errorf("Advertisement Protocol element length %d too long", len(info))
+	}
+	return &Dot11InformationElement{
+		ID:     Dot11InformationElementIDAdvertisementProto,
+		Length: uint8(len(info)),
+		Info:   info,
+	}, nil
+}
+
+// Dot11RoamingConsortium is the body of a Roaming Consortium element,
+// listing the organization identifiers (OIs) of the roaming consortiums
+// and service providers whose credentials the network accepts.
+type Dot11RoamingConsortium struct {
+	// ANQPOIs is the number of further OIs returned by an ANQP query.
+	ANQPOIs uint8
+	// OIs holds up to three OIs, each of 3 to 15 bytes.
+	OIs [][]byte
+}
+
+// RoamingConsortium decodes d as a Roaming Consortium element.
+func (d *Dot11InformationElement) RoamingConsortium() (*Dot11RoamingConsortium, error) {
+	if d.ID != Dot11InformationElementIDRoamingConsortium {
+		return nil, errors.New("not a Roaming Consortium element")
+	}
+	b := d.Info
+	if len(b) < 2 {
+		return nil, fmt.Errorf("Roaming Consortium element length %d too short, 2 required", len(b))
+	}
+	r := &Dot11RoamingConsortium{ANQPOIs: b[0]}
+	len1, len2 := int(b[1]&0xf), int(b[1]>>4)
+	b = b[2:]
+	if len(b) < len1+len2 {
+		return nil, fmt.Errorf("Roaming Consortium element length %d too short for OIs of %d and %d bytes", len(d.Info), len1, len2)
+	}
+	if len1 > 0 {
+		r.OIs = append(r.OIs, b[:len1])
+	}
+	if len2 > 0 {
+		r.OIs = append(r.OIs, b[len1:len1+len2])
+	}
+	if rest := b[len1+len2:]; len(rest) > 0 {
+		r.OIs = append(r.OIs, rest)
+	}
+	return r, nil
+}
+
+// InformationElement returns r as an element, for serialization.
+func (r *Dot11RoamingConsortium) InformationElement() (*Dot11InformationElement, error) {
+	if len(r.OIs) > 3 {
+		return nil, fmt.Errorf("%d OIs, at most 3 allowed", len(r.OIs))
+	}
+	info := []byte{r.ANQPOIs, 0}
+	for i, oi := range r.OIs {
+		if len(oi) < 3 || len(oi) > 15 {
+			return nil, fmt.Errorf("invalid OI length %d", len(oi))
+		}
+		if i < 2 {
+			info[1] |= uint8(len(oi)) << (4 * uint(i))
+		}
+		info = append(info, oi...)
+	}
+	return &Dot11InformationElement{
+		ID:     Dot11InformationElementIDRoamingConsortium,
+		Length: uint8(len(info)),
+		Info:   info,
+	}, nil
+}
+
+// Dot11EmergencyAlertID is the body of an Emergency Alert Identifier
+// element, advertising an emergency alert that clients fetch with the
+// emergency alert system advertisement protocol.
+type Dot11EmergencyAlertID struct {
+	// Hash identifies the alert, and changes when it does.
+	Hash [8]byte
+}
+
+// EmergencyAlertID decodes d as an Emergency Alert Identifier element.
+func (d *Dot11InformationElement) EmergencyAlertID() (*Dot11EmergencyAlertID, error) {
+	if d.ID != Dot11InformationElementIDEmergencyAlertID {
+		return nil, errors.New("not an Emergency Alert Identifier element")
+	}
+	if len(d.Info) != 8 {
+		return nil, fmt.Errorf("invalid Emergency Alert Identifier element length %d", len(d.Info))
+	}
+	e := &Dot11EmergencyAlertID{}
+	copy(e.Hash[:], d.Info)
+	return e, nil
+}
+
+// InformationElement returns e as an element, for serialization.
+func (e *Dot11EmergencyAlertID) InformationElement() (*Dot11InformationElement, error) {
+	return &Dot11InformationElement{
+		ID:     Dot11InformationElementIDEmergencyAlertID,
+		Length: 8,
+		Info:   append([]byte{}, e.Hash[:]...),
+	}, nil
+}
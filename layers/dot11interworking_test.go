@@ -0,0 +1,142 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testDot11HotspotElements are the interworking elements of a Passpoint
+// AP's beacon.
+var testDot11HotspotElements = []byte{
+	// Interworking: free public, internet, ESR, venue business/doctor's
+	// office, HESSID.
+	0x6b, 0x09, 0x53, 0x02, 0x02, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01,
+	// Advertisement protocol: ANQP, no limit, then a vendor protocol.
+	0x6c, 0x09, 0x7f, 0x00, 0x14, 0xdd, 0x04, 0x50, 0x6f, 0x9a, 0x11,
+	// Roaming consortium: 1 more by ANQP, OIs 50-6f-9a, 00-1b-c5-04-bd and
+	// 11-22-33.
+	0x6f, 0x0d, 0x01, 0x53, 0x50, 0x6f, 0x9a, 0x00, 0x1b, 0xc5, 0x04, 0xbd, 0x11, 0x22, 0x33,
+	// Emergency alert identifier.
+	0x70, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+}
+
+func TestDot11HotspotElements(t *testing.T) {
+	p := gopacket.NewPacket(testDot11HotspotElements, LayerTypeDot11InformationElement, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	es := dot11Elements(p)
+	if len(es) != 4 {
+		t.Fatalf("got %d elements", len(es))
+	}
+
+	iw, err := es[0].Interworking()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantIW := &Dot11Interworking{
+		AccessNetworkType: Dot11AccessNetworkFreePublic,
+		Internet:          true,
+		ESR:               true,
+		HasVenue:          true,
+		VenueGroup:        Dot11VenueBusiness,
+		VenueType:         2,
+		HESSID:            net.HardwareAddr{2, 0, 0, 0, 0, 1},
+	}
+	if !reflect.DeepEqual(iw, wantIW) {
+		t.Errorf("got %+v, want %+v", iw, wantIW)
+	}
+
+	aps, err := es[1].AdvertisementProtocols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantAPs := Dot11AdvertisementProtocols{
+		{ID: Dot11AdvertisementProtocolANQP, QueryResponseLengthLimit: 0x7f},
+		{ID: Dot11AdvertisementProtocolVendor, QueryResponseLengthLimit: 0x14, Vendor: []byte{0x50, 0x6f, 0x9a, 0x11}},
+	}
+	if !reflect.DeepEqual(aps, wantAPs) {
+		t.Errorf("got %+v, want %+v", aps, wantAPs)
+	}
+
+	rc, err := es[2].RoamingConsortium()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRC := &Dot11RoamingConsortium{ANQPOIs: 1, OIs: [][]byte{
+		{0x50, 0x6f, 0x9a}, {0x00, 0x1b, 0xc5, 0x04, 0xbd}, {0x11, 0x22, 0x33},
+	}}
+	if !reflect.DeepEqual(rc, wantRC) {
+		t.Errorf("got %+v, want %+v", rc, wantRC)
+	}
+
+	ea, err := es[3].EmergencyAlertID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ea.Hash != [8]byte{1, 2, 3, 4, 5, 6, 7, 8} {
+		t.Errorf("got hash %x", ea.Hash)
+	}
+
+	type elementer interface {
+		InformationElement() (*Dot11InformationElement, error)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	for i, e := range []elementer{ea, rc, aps, iw} {
+		ie, err := e.InformationElement()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(ie.Length) != len(ie.Info) {
+			t.Errorf("element %d length %d, want %d", i, ie.Length, len(ie.Info))
+		}
+		if err := ie.SerializeTo(buf, gopacket.SerializeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(buf.Bytes(), testDot11HotspotElements) {
+		t.Errorf("serialized\n%x, want\n%x", buf.Bytes(), testDot11HotspotElements)
+	}
+
+	if _, err := es[0].RoamingConsortium(); err == nil {
+		t.Error("decoded Interworking element as Roaming Consortium")
+	}
+}
+
+func TestDot11HotspotElementsInvalid(t *testing.T) {
+	for _, e := range []*Dot11InformationElement{
+		{ID: Dot11InformationElementIDInterworking, Info: []byte{0x03, 0x02}},
+		{ID: Dot11InformationElementIDAdvertisementProto, Info: []byte{0x7f}},
+		{ID: Dot11InformationElementIDAdvertisementProto, Info: []byte{0x7f, 0xdd, 0x04, 0x50}},
+		{ID: Dot11InformationElementIDRoamingConsortium, Info: []byte{0x00, 0x33, 0x50, 0x6f, 0x9a}},
+		{ID: Dot11InformationElementIDEmergencyAlertID, Info: []byte{1, 2, 3}},
+	} {
+		var err error
+		switch e.ID {
+		case Dot11InformationElementIDInterworking:
+			_, err = e.Interworking()
+		case Dot11InformationElementIDAdvertisementProto:
+			_, err = e.AdvertisementProtocols()
+		case Dot11InformationElementIDRoamingConsortium:
+			_, err = e.RoamingConsortium()
+		case Dot11InformationElementIDEmergencyAlertID:
+			_, err = e.EmergencyAlertID()
+		}
+		if err == nil {
+			t.Errorf("decoded invalid %v element %x", e.ID, e.Info)
+		}
+	}
+	if _, err := (&Dot11RoamingConsortium{OIs: [][]byte{{1, 2}}}).InformationElement(); err == nil {
+		t.Error("serialized 2 byte OI")
+	}
+}
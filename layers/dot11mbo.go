@@ -0,0 +1,239 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Multiband operation (MBO, or Wi-Fi Agile Multiband) and optimized
+// connectivity experience (OCE) are Wi-Fi Alliance programs for steering
+// clients between bands and APs.  APs and clients exchange MBO-OCE
+// attributes in a vendor specific element, and clients also report them
+// in WNM notification requests.
+
+// dot11OUITypeMBO is the Wi-Fi Alliance OUI and vendor specific type of the
+// MBO-OCE element, as decoded into Dot11InformationElement.OUI.
+var dot11OUITypeMBO = []byte{0x50, 0x6f, 0x9a, 0x16}
+
+// Dot11MBOAttributeID is the type of an MBO-OCE attribute.
+type Dot11MBOAttributeID uint8
+
+const (
+	Dot11MBOAttrAPCapability                     Dot11MBOAttributeID = 1
+	Dot11MBOAttrNonPreferredChannelReport        Dot11MBOAttributeID = 2
+	Dot11MBOAttrCellularDataCapabilities         Dot11MBOAttributeID = 3
+	Dot11MBOAttrAssociationDisallowed            Dot11MBOAttributeID = 4
+	Dot11MBOAttrCellularDataConnectionPreference Dot11MBOAttributeID = 5
+	Dot11MBOAttrTransitionReason                 Dot11MBOAttributeID = 6
+	Dot11MBOAttrTransitionRejectionReason        Dot11MBOAttributeID = 7
+	Dot11MBOAttrAssociationRetryDelay            Dot11MBOAttributeID = 8
+	Dot11OCEAttrCapability                       Dot11MBOAttributeID = 101
+	Dot11OCEAttrRSSIAssociationRejection         Dot11MBOAttributeID = 102
+	Dot11OCEAttrReducedWANMetrics                Dot11MBOAttributeID = 103
+	Dot11OCEAttrRNRCompleteness                  Dot11MBOAttributeID = 104
+)
+
+func (id Dot11MBOAttributeID) String() string {
+	switch id {
+	case Dot11MBOAttrAPCapability:
+		return "APCapability"
+	case Dot11MBOAttrNonPreferredChannelReport:
+		return "NonPreferredChannelReport"
+	case Dot11MBOAttrCellularDataCapabilities:
+		return "CellularDataCapabilities"
+	case Dot11MBOAttrAssociationDisallowed:
+		return "AssociationDisallowed"
+	case Dot11MBOAttrCellularDataConnectionPreference:
+		return "CellularDataConnectionPreference"
+	case Dot11MBOAttrTransitionReason:
+		return "TransitionReason"
+	case Dot11MBOAttrTransitionRejectionReason:
+		return "TransitionRejectionReason"
+	case Dot11MBOAttrAssociationRetryDelay:
+		return "AssociationRetryDelay"
+	case Dot11OCEAttrCapability:
+		return "OCECapability"
+	case Dot11OCEAttrRSSIAssociationRejection:
+		return "RSSIAssociationRejection"
+	case Dot11OCEAttrReducedWANMetrics:
+		return "ReducedWANMetrics"
+	case Dot11OCEAttrRNRCompleteness:
+		return "RNRCompleteness"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(id))
+}
+
+// Dot11MBOAPCapabilityCellularAware is the bit of an AP capability
+// attribute set by APs that take clients' cellular data capabilities into
+// account.
+const Dot11MBOAPCapabilityCellularAware = 0x40
+
+// Dot11MBOCellularDataCapability is the body of a cellular data
+// capabilities attribute.
+type Dot11MBOCellularDataCapability uint8
+
+const (
+	Dot11MBOCellularDataAvailable    Dot11MBOCellularDataCapability = 1
+	Dot11MBOCellularDataNotAvailable Dot11MBOCellularDataCapability = 2
+	Dot11MBONotCellularDataCapable   Dot11MBOCellularDataCapability = 3
+)
+
+func (c Dot11MBOCellularDataCapability) String() string {
+	switch c {
+	case Dot11MBOCellularDataAvailable:
+		return "Available"
+	case Dot11MBOCellularDataNotAvailable:
+		return "NotAvailable"
+	case Dot11MBONotCellularDataCapable:
+		return "NotCapable"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(c))
+}
+
+// Dot11MBONonPreferredChannelReport is the body of a non-preferred channel
+// report attribute, in which a client lists channels it would rather not
+// be steered to.  An empty report says all channels are acceptable.
+type Dot11MBONonPreferredChannelReport struct {
+	OperatingClass uint8
+	Channels       []uint8
+	// Preference is 0 for channels the client won't use, 1 for channels it
+	// prefers not to use, and 255 is reserved.
+	Preference uint8
+	// Reason is 0 if unspecified, 1 for interference seen by the client, 2
+	// for interference with cellular, and 3 for interference with another
+	// radio of the client.
+	Reason uint8
+	// Empty is true for an empty report.
+	Empty bool
+}
+
+// Dot11MBOAttribute is an MBO-OCE attribute.  Decode its body with the
+// method for its ID; attributes with a one byte body, such as transition
+// reasons, are read from Data.
+type Dot11MBOAttribute struct {
+	ID   Dot11MBOAttributeID
+	Data []byte
+}
+
+// Dot11MBOAttributes is the body of an MBO-OCE element.
+type Dot11MBOAttributes []Dot11MBOAttribute
+
+// IsMBO returns true if d is an MBO-OCE element.
+func (d *Dot11InformationElement) IsMBO() bool {
+	return d.ID == Dot11InformationElementIDVendor && bytes.Equal(d.OUI, dot11OUITypeMBO)
+}
+
+// MBOAttributes decodes d as an MBO-OCE element.
+func (d *Dot11InformationElement) MBOAttributes() (Dot11MBOAttributes, error) {
+	if !d.IsMBO() {
+		return nil, errors.New("not an MBO-OCE element")
+	}
+	var out Dot11MBOAttributes
+	for b := d.Info; len(b) > 0; {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, fmt.Errorf("MBO-OCE attribute truncated")
+		}
+		out = append(out, Dot11MBOAttribute{ID: Dot11MBOAttributeID(b[0]), Data: b[2 : 2+int(b[1])]})
+		b = b[2+int(b[1]):]
+	}
+	return out, nil
+}
+
+// Attribute returns the first attribute with the given ID.
+func (as Dot11MBOAttributes) Attribute(id Dot11MBOAttributeID) (Dot11MBOAttribute, bool) {
+	for _, a := range as {
+		if a.ID == id {
+			return a, true
+		}
+	}
+	return Dot11MBOAttribute{}, false
+}
+
+// InformationElement returns as as an MBO-OCE element, for serialization.
+func (as Dot11MBOAttributes) InformationElement() (*Dot11InformationElement, error) {
+	var info []byte
+	for _, a := range as {
+		if len(a.Data) > 0xff {
+			return nil, fmt.Errorf("MBO-OCE attribute %v length %d too long", a.ID, len(a.Data))
+		}
+		info = append(info, uint8(a.ID), uint8(len(a.Data)))
+		info = append(info, a.Data...)
+	}
+	if len(info) > 0xff-4 {
+		return nil, fmt.Errorf("MBO-OCE element length %d too long", len(info))
+	}
+	return &Dot11InformationElement{
+		ID:     Dot11InformationElementIDVendor,
+		Length: uint8(4 + len(info)),
+		OUI:    append([]byte{}, dot11OUITypeMBO...),
+		Info:   info,
+	}, nil
+}
+
+func (a Dot11MBOAttribute) check(id Dot11MBOAttributeID, length int) error {
+	if a.ID != id {
+		return fmt.Errorf("MBO-OCE attribute %v is not %v", a.ID, id)
+	}
+	if len(a.Data) < length {
+		return fmt.Errorf("MBO-OCE %v attribute length %d too short, %d required", a.ID, len(a.Data), length)
+	}
+	return nil
+}
+
+// CellularDataCapability decodes a cellular data capabilities attribute.
+func (a Dot11MBOAttribute) CellularDataCapability() (Dot11MBOCellularDataCapability, error) {
+	if err := a.check(Dot11MBOAttrCellularDataCapabilities, 1); err != nil {
+		return 0, err
+	}
+	return Dot11MBOCellularDataCapability(a.Data[0]), nil
+}
+
+// NonPreferredChannelReport decodes a non-preferred channel report
+// attribute.
+func (a Dot11MBOAttribute) NonPreferredChannelReport() (*Dot11MBONonPreferredChannelReport, error) {
+	if err := a.check(Dot11MBOAttrNonPreferredChannelReport, 0); err != nil {
+		return nil, err
+	}
+	return decodeDot11MBONonPreferredChannelReport(a.Data)
+}
+
+func decodeDot11MBONonPreferredChannelReport(b []byte) (*Dot11MBONonPreferredChannelReport, error) {
+	if len(b) == 0 {
+		return &Dot11MBONonPreferredChannelReport{Empty: true}, nil
+	}
+	if len(b) < 3 {
+		return nil, fmt.Errorf("non-preferred channel report length %d too short, 3 required", len(b))
+	}
+	return &Dot11MBONonPreferredChannelReport{
+		OperatingClass: b[0],
+		Channels:       b[1 : len(b)-2],
+		Preference:     b[len(b)-2],
+		Reason:         b[len(b)-1],
+	}, nil
+}
+
+// AssociationRetryDelay decodes an association retry delay attribute.
+func (a Dot11MBOAttribute) AssociationRetryDelay() (time.Duration, error) {
+	if err := a.check(Dot11MBOAttrAssociationRetryDelay, 2); err != nil {
+		return 0, err
+	}
+	return time.Duration(binary.LittleEndian.Uint16(a.Data)) * time.Second, nil
+}
+
+// Attribute returns r as a non-preferred channel report attribute.
+func (r *Dot11MBONonPreferredChannelReport) Attribute() Dot11MBOAttribute {
+	a := Dot11MBOAttribute{ID: Dot11MBOAttrNonPreferredChannelReport}
+	if !r.Empty {
+		a.Data = append(append([]byte{r.OperatingClass}, r.Channels...), r.Preference, r.Reason)
+	}
+	return a
+}
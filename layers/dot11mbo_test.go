@@ -0,0 +1,131 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testPacketDot11WNMNotificationRequest is a WNM notification request from
+// an MBO client, reporting channels 36 and 40 as non-preferred and no
+// cellular data capability.
+var testPacketDot11WNMNotificationRequest = []byte{
+	0xd0, 0x00, 0x3a, 0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x02, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01,
+	0x02, 0x00, 0x00, 0x00, 0x00, 0x02, 0x20, 0x00,
+	0x0a, 0x1a, 0x05, 0xdd,
+	0xdd, 0x09, 0x50, 0x6f, 0x9a, 0x02, 0x73, 0x24, 0x28, 0x00, 0x01,
+	0xdd, 0x05, 0x50, 0x6f, 0x9a, 0x03, 0x03,
+	0x01, 0x02, 0x03, 0x04, // FCS
+}
+
+func TestPacketDot11WNMNotificationRequest(t *testing.T) {
+	p := gopacket.NewPacket(testPacketDot11WNMNotificationRequest, LayerTypeDot11, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	action, ok := p.Layer(LayerTypeDot11MgmtAction).(*Dot11MgmtAction)
+	if !ok {
+		t.Fatal("no action frame")
+	}
+	if action.Category() != Dot11ActionWNM || Dot11WNMAction(action.Action()) != Dot11WNMNotificationRequestAction {
+		t.Errorf("got action %v/%d", action.Category(), action.Action())
+	}
+	if _, err := action.WNMNotificationResponse(); err == nil {
+		t.Error("decoded request as response")
+	}
+	req, err := action.WNMNotificationRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.DialogToken != 5 || req.Type != Dot11WNMNotificationVendor || len(req.Subelements) != 2 {
+		t.Errorf("got %+v", req)
+	}
+
+	attrs := req.MBOAttributes()
+	if len(attrs) != 2 {
+		t.Fatalf("got attributes %v", attrs)
+	}
+	npc, err := attrs[0].NonPreferredChannelReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Dot11MBONonPreferredChannelReport{OperatingClass: 115, Channels: []uint8{36, 40}, Reason: 1}
+	if !reflect.DeepEqual(npc, want) {
+		t.Errorf("got %+v, want %+v", npc, want)
+	}
+	if a := npc.Attribute(); !bytes.Equal(a.Data, attrs[0].Data) {
+		t.Errorf("encoded report %x, want %x", a.Data, attrs[0].Data)
+	}
+	cell, ok := attrs.Attribute(Dot11MBOAttrCellularDataCapabilities)
+	if !ok {
+		t.Fatal("no cellular data capabilities")
+	}
+	if c, err := cell.CellularDataCapability(); err != nil || c != Dot11MBONotCellularDataCapable {
+		t.Errorf("got %v, %v", c, err)
+	}
+	if _, err := cell.NonPreferredChannelReport(); err == nil {
+		t.Error("decoded cellular data capabilities as non-preferred channel report")
+	}
+
+	resp := &Dot11MgmtAction{}
+	resp.Contents = []byte{0x0a, 0x1b, 0x05, 0x00}
+	if r, err := resp.WNMNotificationResponse(); err != nil || r.DialogToken != 5 || r.Status != 0 {
+		t.Errorf("got %+v, %v", r, err)
+	}
+}
+
+func TestDot11MBOElement(t *testing.T) {
+	attrs := Dot11MBOAttributes{
+		{ID: Dot11MBOAttrAPCapability, Data: []byte{Dot11MBOAPCapabilityCellularAware}},
+		{ID: Dot11MBOAttrAssociationRetryDelay, Data: []byte{0x2c, 0x01}},
+		(&Dot11MBONonPreferredChannelReport{Empty: true}).Attribute(),
+		{ID: Dot11OCEAttrCapability, Data: []byte{0x01}},
+	}
+	ie, err := attrs.InformationElement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := ie.SerializeTo(buf, gopacket.SerializeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0xdd, 0x10, 0x50, 0x6f, 0x9a, 0x16, 0x01, 0x01, 0x40, 0x08, 0x02, 0x2c, 0x01, 0x02, 0x00, 0x65, 0x01, 0x01}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("serialized %x, want %x", buf.Bytes(), want)
+	}
+
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeDot11InformationElement, gopacket.Default)
+	e := p.Layer(LayerTypeDot11InformationElement).(*Dot11InformationElement)
+	if !e.IsMBO() || e.IsOWETransitionMode() {
+		t.Fatalf("element %v not recognized", e)
+	}
+	got, err := e.MBOAttributes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs[2].Data = []byte{}
+	if !reflect.DeepEqual(got, attrs) {
+		t.Errorf("got %v, want %v", got, attrs)
+	}
+	delay, _ := got.Attribute(Dot11MBOAttrAssociationRetryDelay)
+	if d, err := delay.AssociationRetryDelay(); err != nil || d != 300*time.Second {
+		t.Errorf("got delay %v, %v", d, err)
+	}
+	if r, err := got[2].NonPreferredChannelReport(); err != nil || !r.Empty {
+		t.Errorf("got report %+v, %v", r, err)
+	}
+
+	e.Info = e.Info[:len(e.Info)-1]
+	if _, err := e.MBOAttributes(); err == nil {
+		t.Error("decoded truncated attribute")
+	}
+}
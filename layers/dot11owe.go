@@ -0,0 +1,230 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Opportunistic wireless encryption (OWE, or Wi-Fi Enhanced Open), from RFC
+// 8110 and the Wi-Fi Alliance OWE specification, encrypts open networks
+// with an unauthenticated Diffie-Hellman exchange carried in association
+// frames.  In transition mode, an open BSS and a hidden OWE BSS advertise
+// each other with the OWE transition mode element, so legacy clients join
+// the open BSS and OWE-capable clients the OWE one.
+
+// Dot11ExtElementIDOWEDHParam is the element ID extension of the OWE
+// Diffie-Hellman parameter element, carried in an element with ID
+// Dot11InformationElementIDExtension.
+const Dot11ExtElementIDOWEDHParam = 32
+
+// dot11OUITypeOWETransition is the Wi-Fi Alliance OUI and vendor specific
+// type of the OWE transition mode element, as decoded into
+// Dot11InformationElement.OUI.
+var dot11OUITypeOWETransition = []byte{0x50, 0x6f, 0x9a, 0x1c}
+
+// dot11AKMOWE is the RSN AKM suite selector for OWE, 00-0F-AC:18.
+var dot11AKMOWE = []byte{0x00, 0x0f, 0xac, 18}
+
+// Dot11OWETransitionMode is the body of an OWE transition mode element,
+// which points an open BSS at its OWE companion, and back.
+type Dot11OWETransitionMode struct {
+	// BSSID and SSID are the other BSS's.
+	BSSID net.HardwareAddr
+	SSID  []byte
+	// HasChannel is true if the other BSS is on another channel, given by
+	// OperatingClass (the element's band info) and Channel.
+	HasChannel     bool
+	OperatingClass uint8
+	Channel        uint8
+}
+
+// IsOWETransitionMode returns true if d is an OWE transition mode element.
+func (d *Dot11InformationElement) IsOWETransitionMode() bool {
+	return d.ID == Dot11InformationElementIDVendor && bytes.Equal(d.OUI, dot11OUITypeOWETransition)
+}
+
+// OWETransitionMode decodes d as an OWE transition mode element.
+func (d *Dot11InformationElement) OWETransitionMode() (*Dot11OWETransitionMode, error) {
+	if !d.IsOWETransitionMode() {
+		return nil, errors.New("not an OWE transition mode element")
+	}
+	if len(d.Info) < 7 {
+		return nil, fmt.Errorf("OWE transition mode element length %d too short, 7 required", len(d.Info))
+	}
+	o := &Dot11OWETransitionMode{BSSID: net.HardwareAddr(d.Info[0:6])}
+	end := 7 + int(d.Info[6])
+	if len(d.Info) < end {
+		return nil, fmt.Errorf("OWE transition mode element length %d too short for %d byte SSID", len(d.Info), d.Info[6])
+	}
+	o.SSID = d.Info[7:end]
+	if len(d.Info) >= end+2 {
+		o.HasChannel = true
+		o.OperatingClass, o.Channel = d.Info[end], d.Info[end+1]
+	}
+	return o, nil
+}
+
+// InformationElement returns o as an element, for serialization.
+func (o *Dot11OWETransitionMode) InformationElement() (*Dot11InformationElement, error) {
+	if len(o.BSSID) != 6 {
+		return nil, fmt.Errorf("invalid OWE transition mode BSSID %v", o.BSSID)
+	}
+	if len(o.SSID) > 32 {
+		return nil, fmt.Errorf("OWE transition mode SSID length %d too long", len(o.SSID))
+	}
+	info := append(append([]byte{}, o.BSSID...), byte(len(o.SSID)))
+	info = append(info, o.SSID...)
+	if o.HasChannel {
+		info = append(info, o.OperatingClass, o.Channel)
+	}
+	return &Dot11InformationElement{
+		ID:     Dot11InformationElementIDVendor,
+		Length: uint8(4 + len(info)),
+		OUI:    append([]byte{}, dot11OUITypeOWETransition...),
+		Info:   info,
+	}, nil
+}
+
+// Dot11OWEDHParam is the body of an OWE Diffie-Hellman parameter element,
+// which carries a client's public key in its association request and the
+// AP's in its association response.
+type Dot11OWEDHParam struct {
+	// Group is the IANA Diffie-Hellman group; 19 is NIST P-256.
+	Group     uint16
+	PublicKey []byte
+}
+
+// IsOWEDHParam returns true if d is an OWE Diffie-Hellman parameter
+// element.
+func (d *Dot11InformationElement) IsOWEDHParam() bool {
+	return d.ID == Dot11InformationElementIDExtension && len(d.Info) > 0 && d.Info[0] == Dot11ExtElementIDOWEDHParam
+}
+
+// OWEDHParam decodes d as an OWE Diffie-Hellman parameter element.
+func (d *Dot11InformationElement) OWEDHParam() (*Dot11OWEDHParam, error) {
+	if !d.IsOWEDHParam() {
+		return nil, errors.New("not an OWE Diffie-Hellman parameter element")
+	}
+	if len(d.Info) < 3 {
+		return nil, fmt.Errorf("OWE Diffie-Hellman parameter element length %d too short, 3 required", len(d.Info))
+	}
+	return &Dot11OWEDHParam{
+		Group:     binary.LittleEndian.Uint16(d.Info[1:3]),
+		PublicKey: d.Info[3:],
+	}, nil
+}
+
+// InformationElement returns o as an element, for serialization.
+func (o *Dot11OWEDHParam) InformationElement() (*Dot11InformationElement, error) {
+	if len(o.PublicKey) > 252 {
+		return nil, fmt.Errorf("OWE public key length %d too long", len(o.PublicKey))
+	}
+	info := make([]byte, 3+len(o.PublicKey))
+	info[0] = Dot11ExtElementIDOWEDHParam
+	binary.LittleEndian.PutUint16(info[1:3], o.Group)
+	copy(info[3:], o.PublicKey)
+	return &Dot11InformationElement{
+		ID:     Dot11InformationElementIDExtension,
+		Length: uint8(len(info)),
+		Info:   info,
+	}, nil
+}
+
+// Dot11BSSSecurity classifies a BSS by how it protects its clients, telling
+// open, OWE and OWE transition mode BSSes apart.
+type Dot11BSSSecurity uint8
+
+const (
+	// Dot11BSSOpen is an open BSS with no OWE companion.
+	Dot11BSSOpen Dot11BSSSecurity = iota
+	// Dot11BSSOWE is an OWE BSS with no open companion.
+	Dot11BSSOWE
+	// Dot11BSSOWETransitionOpen is the open BSS of a transition mode pair.
+	Dot11BSSOWETransitionOpen
+	// Dot11BSSOWETransitionOWE is the OWE BSS of a transition mode pair,
+	// which is normally hidden.
+	Dot11BSSOWETransitionOWE
+	// Dot11BSSProtected is a BSS using WEP, or RSN without OWE, such as
+	// WPA2 or WPA3 personal or enterprise.
+	Dot11BSSProtected
+)
+
+func (s Dot11BSSSecurity) String() string {
+	switch s {
+	case Dot11BSSOpen:
+		return "Open"
+	case Dot11BSSOWE:
+		return "OWE"
+	case Dot11BSSOWETransitionOpen:
+		return "OWETransitionOpen"
+	case Dot11BSSOWETransitionOWE:
+		return "OWETransitionOWE"
+	case Dot11BSSProtected:
+		return "Protected"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(s))
+}
+
+// Dot11CapabilityPrivacy is the privacy bit of the capability information
+// field of beacons, probe responses and association frames.
+const Dot11CapabilityPrivacy = 0x0010
+
+// ClassifyDot11BSS classifies a BSS from the capability information and
+// elements of its beacon or probe response.
+func ClassifyDot11BSS(capability uint16, elements []*Dot11InformationElement) Dot11BSSSecurity {
+	var rsn, owe, transition bool
+	for _, e := range elements {
+		switch {
+		case e.ID == Dot11InformationElementIDRSNInfo:
+			rsn = true
+			owe = dot11RSNHasAKM(e.Info, dot11AKMOWE)
+		case e.IsOWETransitionMode():
+			transition = true
+		}
+	}
+	switch {
+	case owe && transition:
+		return Dot11BSSOWETransitionOWE
+	case owe:
+		return Dot11BSSOWE
+	case rsn || capability&Dot11CapabilityPrivacy != 0:
+		return Dot11BSSProtected
+	case transition:
+		return Dot11BSSOWETransitionOpen
+	}
+	return Dot11BSSOpen
+}
+
+// dot11RSNHasAKM returns true if the body of an RSN element lists akm
+// among its AKM suites.
+func dot11RSNHasAKM(rsn []byte, akm []byte) bool {
+	// Version and group data cipher suite.
+	if len(rsn) < 8 {
+		return false
+	}
+	rsn = rsn[6:]
+	n := int(binary.LittleEndian.Uint16(rsn))
+	rsn = rsn[2:]
+	if len(rsn) < 4*n+2 {
+		return false
+	}
+	rsn = rsn[4*n:]
+	n = int(binary.LittleEndian.Uint16(rsn))
+	rsn = rsn[2:]
+	for i := 0; i < n && len(rsn) >= 4; i++ {
+		if bytes.Equal(rsn[:4], akm) {
+			return true
+		}
+		rsn = rsn[4:]
+	}
+	return false
+}
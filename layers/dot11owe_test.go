@@ -0,0 +1,144 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testPacketDot11OWEAssociationReq is an association request to an OWE
+// BSS, with an RSN element listing the OWE AKM and a Diffie-Hellman
+// parameter element for group 19.
+var testPacketDot11OWEAssociationReq = []byte{
+	0x00, 0x00, 0x3a, 0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x02, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01,
+	0x02, 0x00, 0x00, 0x00, 0x00, 0x02, 0x10, 0x00, 0x31, 0x04, 0x0a, 0x00,
+	0x00, 0x04, 0x6f, 0x77, 0x65, 0x21, // SSID "owe!"
+	0x30, 0x14, 0x01, 0x00, 0x00, 0x0f, 0xac, 0x04, 0x01, 0x00, 0x00, 0x0f, 0xac, 0x04, 0x01, 0x00,
+	0x00, 0x0f, 0xac, 0x12, 0x80, 0x00, // RSN, OWE AKM
+	0xff, 0x23, 0x20, 0x13, 0x00, // OWE DH parameter, group 19
+	0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10,
+	0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f, 0x20,
+	0xde, 0xad, 0xbe, 0xef, // FCS
+}
+
+func dot11Elements(p gopacket.Packet) []*Dot11InformationElement {
+	var out []*Dot11InformationElement
+	for _, l := range p.Layers() {
+		if e, ok := l.(*Dot11InformationElement); ok {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func TestPacketDot11OWEAssociationReq(t *testing.T) {
+	p := gopacket.NewPacket(testPacketDot11OWEAssociationReq, LayerTypeDot11, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{
+		LayerTypeDot11, LayerTypeDot11MgmtAssociationReq,
+		LayerTypeDot11InformationElement, LayerTypeDot11InformationElement, LayerTypeDot11InformationElement,
+	}, t)
+	elements := dot11Elements(p)
+	dh := elements[2]
+	if dh.IsOWETransitionMode() || !dh.IsOWEDHParam() {
+		t.Fatalf("element %v not recognized", dh)
+	}
+	got, err := dh.OWEDHParam()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Group != 19 || len(got.PublicKey) != 32 || got.PublicKey[31] != 0x20 {
+		t.Errorf("got %+v", got)
+	}
+	ie, err := got.InformationElement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := ie.SerializeTo(buf, gopacket.SerializeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), dh.Contents) {
+		t.Errorf("serialized\n%x, want\n%x", buf.Bytes(), dh.Contents)
+	}
+	if _, err := elements[0].OWEDHParam(); err == nil {
+		t.Error("decoded SSID as OWE DH parameter")
+	}
+	if s := ClassifyDot11BSS(0x0431, elements); s != Dot11BSSOWE {
+		t.Errorf("classified as %v", s)
+	}
+}
+
+func TestDot11OWETransitionMode(t *testing.T) {
+	for _, want := range []Dot11OWETransitionMode{
+		{BSSID: net.HardwareAddr{2, 0, 0, 0, 0, 3}, SSID: []byte("hidden-owe")},
+		{BSSID: net.HardwareAddr{2, 0, 0, 0, 0, 3}, SSID: []byte{}, HasChannel: true, OperatingClass: 115, Channel: 36},
+	} {
+		ie, err := want.InformationElement()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := gopacket.NewSerializeBuffer()
+		if err := ie.SerializeTo(buf, gopacket.SerializeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if b := buf.Bytes(); b[0] != 221 || int(b[1]) != len(b)-2 || !bytes.Equal(b[2:6], []byte{0x50, 0x6f, 0x9a, 0x1c}) {
+			t.Errorf("serialized %x", b)
+		}
+		p := gopacket.NewPacket(buf.Bytes(), LayerTypeDot11InformationElement, gopacket.Default)
+		e, ok := p.Layer(LayerTypeDot11InformationElement).(*Dot11InformationElement)
+		if !ok {
+			t.Fatal("no element decoded")
+		}
+		got, err := e.OWETransitionMode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*got, want) {
+			t.Errorf("got %+v, want %+v", *got, want)
+		}
+	}
+
+	short := &Dot11InformationElement{ID: 221, OUI: []byte{0x50, 0x6f, 0x9a, 0x1c}, Info: []byte{2, 0, 0, 0, 0, 3, 4, 'a'}}
+	if _, err := short.OWETransitionMode(); err == nil {
+		t.Error("decoded truncated SSID")
+	}
+}
+
+func TestClassifyDot11BSS(t *testing.T) {
+	transition := &Dot11InformationElement{ID: 221, OUI: []byte{0x50, 0x6f, 0x9a, 0x1c}, Info: []byte{2, 0, 0, 0, 0, 3, 0}}
+	rsn := func(akm byte) *Dot11InformationElement {
+		return &Dot11InformationElement{ID: 48, Info: []byte{
+			1, 0, 0, 0x0f, 0xac, 4, 1, 0, 0, 0x0f, 0xac, 4, 1, 0, 0, 0x0f, 0xac, akm, 0, 0,
+		}}
+	}
+	ssid := &Dot11InformationElement{ID: 0, Info: []byte("net")}
+	for _, test := range []struct {
+		capability uint16
+		elements   []*Dot11InformationElement
+		want       Dot11BSSSecurity
+	}{
+		{0x0401, []*Dot11InformationElement{ssid}, Dot11BSSOpen},
+		{0x0401, []*Dot11InformationElement{ssid, transition}, Dot11BSSOWETransitionOpen},
+		{0x0411, []*Dot11InformationElement{ssid, rsn(18)}, Dot11BSSOWE},
+		{0x0411, []*Dot11InformationElement{ssid, rsn(18), transition}, Dot11BSSOWETransitionOWE},
+		{0x0411, []*Dot11InformationElement{ssid, rsn(2)}, Dot11BSSProtected},
+		{0x0411, []*Dot11InformationElement{ssid}, Dot11BSSProtected},
+		{0x0411, []*Dot11InformationElement{ssid, {ID: 48, Info: []byte{1, 0}}}, Dot11BSSProtected},
+	} {
+		if got := ClassifyDot11BSS(test.capability, test.elements); got != test.want {
+			t.Errorf("%#04x %v: got %v, want %v", test.capability, test.elements, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Dot11ActionCategory is the category of an action frame, its first byte.
+type Dot11ActionCategory uint8
+
+const (
+	Dot11ActionSpectrumManagement Dot11ActionCategory = 0
+	Dot11ActionQoS                Dot11ActionCategory = 1
+	Dot11ActionBlockAck           Dot11ActionCategory = 3
+	Dot11ActionPublic             Dot11ActionCategory = 4
+	Dot11ActionRadioMeasurement   Dot11ActionCategory = 5
+	Dot11ActionFastBSSTransition  Dot11ActionCategory = 6
+	Dot11ActionHT                 Dot11ActionCategory = 7
+	Dot11ActionSAQuery            Dot11ActionCategory = 8
+	Dot11ActionProtectedPublic    Dot11ActionCategory = 9
+	Dot11ActionWNM                Dot11ActionCategory = 10
+	Dot11ActionUnprotectedWNM     Dot11ActionCategory = 11
+	Dot11ActionTDLS               Dot11ActionCategory = 12
+	Dot11ActionSelfProtected      Dot11ActionCategory = 15
+	Dot11ActionVHT                Dot11ActionCategory = 21
+	Dot11ActionVendorProtected    Dot11ActionCategory = 126
+	Dot11ActionVendor             Dot11ActionCategory = 127
+)
+
+func (c Dot11ActionCategory) String() string {
+	switch c {
+	case Dot11ActionSpectrumManagement:
+		return "SpectrumManagement"
+	case Dot11ActionQoS:
+		return "QoS"
+	case Dot11ActionBlockAck:
+		return "BlockAck"
+	case Dot11ActionPublic:
+		return "Public"
+	case Dot11ActionRadioMeasurement:
+		return "RadioMeasurement"
+	case Dot11ActionFastBSSTransition:
+		return "FastBSSTransition"
+	case Dot11ActionHT:
+		return "HT"
+	case Dot11ActionSAQuery:
+		return "SAQuery"
+	case Dot11ActionProtectedPublic:
+		return "ProtectedDualOfPublic"
+	case Dot11ActionWNM:
+		return "WNM"
+	case Dot11ActionUnprotectedWNM:
+		return "UnprotectedWNM"
+	case Dot11ActionTDLS:
+		return "TDLS"
+	case Dot11ActionSelfProtected:
+		return "SelfProtected"
+	case Dot11ActionVHT:
+		return "VHT"
+	case Dot11ActionVendorProtected:
+		return "VendorSpecificProtected"
+	case Dot11ActionVendor:
+		return "VendorSpecific"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(c))
+}
+
+// Dot11WNMAction is the action of a WNM action frame.
+type Dot11WNMAction uint8
+
+const (
+	Dot11WNMBSSTransitionQueryAction    Dot11WNMAction = 6
+	Dot11WNMBSSTransitionRequestAction  Dot11WNMAction = 7
+	Dot11WNMBSSTransitionResponseAction Dot11WNMAction = 8
+	Dot11WNMNotificationRequestAction   Dot11WNMAction = 26
+	Dot11WNMNotificationResponseAction  Dot11WNMAction = 27
+)
+
+// Category returns the category of the action frame.
+func (m *Dot11MgmtAction) Category() Dot11ActionCategory {
+	if len(m.Contents) < 1 {
+		return 0
+	}
+	return Dot11ActionCategory(m.Contents[0])
+}
+
+// Action returns the action field of the action frame, whose meaning
+// depends on its category.
+func (m *Dot11MgmtAction) Action() uint8 {
+	if len(m.Contents) < 2 {
+		return 0
+	}
+	return m.Contents[1]
+}
+
+// wnmBody returns the body of a WNM action frame with the given action,
+// following the category and action fields.
+func (m *Dot11MgmtAction) wnmBody(action Dot11WNMAction, min int) ([]byte, error) {
+	if m.Category() != Dot11ActionWNM || Dot11WNMAction(m.Action()) != action {
+		return nil, fmt.Errorf("action frame %v/%d is not WNM/%d", m.Category(), m.Action(), action)
+	}
+	if len(m.Contents) < 2+min {
+		return nil, fmt.Errorf("WNM action %d length %d too short, %d required", action, len(m.Contents), 2+min)
+	}
+	return m.Contents[2:], nil
+}
+
+// Dot11WNMNotificationType is the type of a WNM notification request.
+type Dot11WNMNotificationType uint8
+
+const (
+	Dot11WNMNotificationFirmwareUpdate Dot11WNMNotificationType = 0
+	Dot11WNMNotificationVendor         Dot11WNMNotificationType = 221
+)
+
+// Dot11WNMSubelement is a subelement of a WNM notification request.  The
+// Data of vendor specific subelements, with ID 221, starts with the
+// vendor's OUI.
+type Dot11WNMSubelement struct {
+	ID   uint8
+	Data []byte
+}
+
+// Dot11WNMNotificationRequest is a WNM notification request, which MBO
+// clients send to report their non-preferred channels and cellular data
+// capability.
+type Dot11WNMNotificationRequest struct {
+	DialogToken uint8
+	Type        Dot11WNMNotificationType
+	Subelements []Dot11WNMSubelement
+}
+
+// Dot11WNMNotificationResponse is the response to a WNM notification
+// request.
+type Dot11WNMNotificationResponse struct {
+	DialogToken uint8
+	// Status is 0 on success.
+	Status uint8
+}
+
+// WNMNotificationRequest decodes m as a WNM notification request.
+func (m *Dot11MgmtAction) WNMNotificationRequest() (*Dot11WNMNotificationRequest, error) {
+	b, err := m.wnmBody(Dot11WNMNotificationRequestAction, 2)
+	if err != nil {
+		return nil, err
+	}
+	r := &Dot11WNMNotificationRequest{DialogToken: b[0], Type: Dot11WNMNotificationType(b[1])}
+	for b = b[2:]; len(b) > 0; {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, errors.New("WNM notification request subelement truncated")
+		}
+		r.Subelements = append(r.Subelements, Dot11WNMSubelement{ID: b[0], Data: b[2 : 2+int(b[1])]})
+		b = b[2+int(b[1]):]
+	}
+	return r, nil
+}
+
+// WNMNotificationResponse decodes m as a WNM notification response.
+func (m *Dot11MgmtAction) WNMNotificationResponse() (*Dot11WNMNotificationResponse, error) {
+	b, err := m.wnmBody(Dot11WNMNotificationResponseAction, 2)
+	if err != nil {
+		return nil, err
+	}
+	return &Dot11WNMNotificationResponse{DialogToken: b[0], Status: b[1]}, nil
+}
+
+// dot11OUIWFA is the Wi-Fi Alliance OUI, which starts the MBO subelements
+// of WNM notification requests.
+var dot11OUIWFA = []byte{0x50, 0x6f, 0x9a}
+
+// MBOAttributes returns the MBO subelements of r as attributes: a vendor
+// specific subelement with the Wi-Fi Alliance OUI and OUI type 2 or 3
+// carries the body of a non-preferred channel report or a cellular data
+// capabilities attribute.
+func (r *Dot11WNMNotificationRequest) MBOAttributes() Dot11MBOAttributes {
+	var out Dot11MBOAttributes
+	for _, s := range r.Subelements {
+		if s.ID != uint8(Dot11WNMNotificationVendor) || len(s.Data) < 4 || !bytes.Equal(s.Data[:3], dot11OUIWFA) {
+			continue
+		}
+		switch id := Dot11MBOAttributeID(s.Data[3]); id {
+		case Dot11MBOAttrNonPreferredChannelReport, Dot11MBOAttrCellularDataCapabilities:
+			out = append(out, Dot11MBOAttribute{ID: id, Data: s.Data[4:]})
+		}
+	}
+	return out
+}
+
+// Dot11NeighborReport is a neighbor report element, describing a BSS a
+// client may transition to.
+type Dot11NeighborReport struct {
+	BSSID          net.HardwareAddr
+	BSSIDInfo      uint32
+	OperatingClass uint8
+	Channel        uint8
+	PHYType        uint8
+	Subelements    []Dot11WNMSubelement
+}
+
+// dot11NeighborReportPreference is the ID of the BSS transition candidate
+// preference subelement.
+const dot11NeighborReportPreference = 3
+
+// Preference returns the candidate preference of r, from 1 to 255 with
+// higher preferred, if it has one.
+func (r *Dot11NeighborReport) Preference() (uint8, bool) {
+	for _, s := range r.Subelements {
+		if s.ID == dot11NeighborReportPreference && len(s.Data) == 1 {
+			return s.Data[0], true
+		}
+	}
+	return 0, false
+}
+
+// NeighborReport decodes d as a neighbor report element.
+func (d *Dot11InformationElement) NeighborReport() (*Dot11NeighborReport, error) {
+	if d.ID != Dot11InformationElementIDNeighborReport {
+		return nil, fmt.Errorf("element %v is not a neighbor report", d.ID)
+	}
+	return decodeDot11NeighborReport(d.Info)
+}
+
+func decodeDot11NeighborReport(b []byte) (*Dot11NeighborReport, error) {
+	if len(b) < 13 {
+		return nil, fmt.Errorf("neighbor report length %d too short, 13 required", len(b))
+	}
+	r := &Dot11NeighborReport{
+		BSSID:          net.HardwareAddr(b[0:6]),
+		BSSIDInfo:      binary.LittleEndian.Uint32(b[6:10]),
+		OperatingClass: b[10],
+		Channel:        b[11],
+		PHYType:        b[12],
+	}
+	for b = b[13:]; len(b) > 0; {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, errors.New("neighbor report subelement truncated")
+		}
+		r.Subelements = append(r.Subelements, Dot11WNMSubelement{ID: b[0], Data: b[2 : 2+int(b[1])]})
+		b = b[2+int(b[1]):]
+	}
+	return r, nil
+}
+
+// decodeDot11BSSTransitionCandidates decodes the neighbor reports of a BSS
+// transition candidate list, skipping any other elements.
+func decodeDot11BSSTransitionCandidates(b []byte) ([]Dot11NeighborReport, error) {
+	var out []Dot11NeighborReport
+	for len(b) > 0 {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, errors.New("BSS transition candidate list element truncated")
+		}
+		if Dot11InformationElementID(b[0]) == Dot11InformationElementIDNeighborReport {
+			r, err := decodeDot11NeighborReport(b[2 : 2+int(b[1])])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, *r)
+		}
+		b = b[2+int(b[1]):]
+	}
+	return out, nil
+}
+
+// BSS transition management request modes.
+const (
+	Dot11BTMPreferredCandidateList    = 0x01
+	Dot11BTMAbridged                  = 0x02
+	Dot11BTMDisassociationImminent    = 0x04
+	Dot11BTMBSSTerminationIncluded    = 0x08
+	Dot11BTMESSDisassociationImminent = 0x10
+)
+
+// Dot11BTMStatus is the status of a BSS transition management response.
+type Dot11BTMStatus uint8
+
+const (
+	Dot11BTMAccept                     Dot11BTMStatus = 0
+	Dot11BTMRejectUnspecified          Dot11BTMStatus = 1
+	Dot11BTMRejectInsufficientBeacon   Dot11BTMStatus = 2
+	Dot11BTMRejectInsufficientCapacity Dot11BTMStatus = 3
+	Dot11BTMRejectUndesired            Dot11BTMStatus = 4
+	Dot11BTMRejectDelayRequest         Dot11BTMStatus = 5
+	Dot11BTMRejectCandidateListGiven   Dot11BTMStatus = 6
+	Dot11BTMRejectNoSuitableCandidates Dot11BTMStatus = 7
+	Dot11BTMRejectLeavingESS           Dot11BTMStatus = 8
+)
+
+func (s Dot11BTMStatus) String() string {
+	switch s {
+	case Dot11BTMAccept:
+		return "Accept"
+	case Dot11BTMRejectUnspecified:
+		return "RejectUnspecified"
+	case Dot11BTMRejectInsufficientBeacon:
+		return "RejectInsufficientBeacon"
+	case Dot11BTMRejectInsufficientCapacity:
+		return "RejectInsufficientCapacity"
+	case Dot11BTMRejectUndesired:
+		return "RejectUndesired"
+	case Dot11BTMRejectDelayRequest:
+		return "RejectDelayRequest"
+	case Dot11BTMRejectCandidateListGiven:
+		return "RejectCandidateListGiven"
+	case Dot11BTMRejectNoSuitableCandidates:
+		return "RejectNoSuitableCandidates"
+	case Dot11BTMRejectLeavingESS:
+		return "RejectLeavingESS"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(s))
+}
+
+// Dot11BSSTransitionQuery is a BSS transition management query, sent by a
+// client asking its AP for transition candidates.
+type Dot11BSSTransitionQuery struct {
+	DialogToken uint8
+	Reason      uint8
+	Candidates  []Dot11NeighborReport
+}
+
+// Dot11BSSTransitionRequest is a BSS transition management request, sent by
+// an AP to steer a client to another BSS.
+type Dot11BSSTransitionRequest struct {
+	DialogToken uint8
+	// Mode is a combination of the Dot11BTM request mode bits.
+	Mode uint8
+	// DisassociationTimer is the number of beacon intervals before the AP
+	// disassociates the client.
+	DisassociationTimer uint16
+	// ValidityInterval is the number of beacon intervals the candidate list
+	// is valid for.
+	ValidityInterval uint8
+	// BSSTerminationDuration is the raw subelement present when Mode has
+	// Dot11BTMBSSTerminationIncluded.
+	BSSTerminationDuration []byte
+	SessionInformationURL  string
+	Candidates             []Dot11NeighborReport
+}
+
+// Dot11BSSTransitionResponse is a client's response to a BSS transition
+// management request.  TargetBSSID is only present when the client accepts.
+type Dot11BSSTransitionResponse struct {
+	DialogToken      uint8
+	Status           Dot11BTMStatus
+	TerminationDelay uint8
+	TargetBSSID      net.HardwareAddr
+	Candidates       []Dot11NeighborReport
+}
+
+// BSSTransitionQuery decodes m as a BSS transition management query.
+func (m *Dot11MgmtAction) BSSTransitionQuery() (*Dot11BSSTransitionQuery, error) {
+	b, err := m.wnmBody(Dot11WNMBSSTransitionQueryAction, 2)
+	if err != nil {
+		return nil, err
+	}
+	q := &Dot11BSSTransitionQuery{DialogToken: b[0], Reason: b[1]}
+	if q.Candidates, err = decodeDot11BSSTransitionCandidates(b[2:]); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// BSSTransitionRequest decodes m as a BSS transition management request.
+func (m *Dot11MgmtAction) BSSTransitionRequest() (*Dot11BSSTransitionRequest, error) {
+	b, err := m.wnmBody(Dot11WNMBSSTransitionRequestAction, 5)
+	if err != nil {
+		return nil, err
+	}
+	r := &Dot11BSSTransitionRequest{
+		DialogToken:         b[0],
+		Mode:                b[1],
+		DisassociationTimer: binary.LittleEndian.Uint16(b[2:4]),
+		ValidityInterval:    b[4],
+	}
+	b = b[5:]
+	if r.Mode&Dot11BTMBSSTerminationIncluded != 0 {
+		if len(b) < 12 {
+			return nil, errors.New("BSS transition request termination duration truncated")
+		}
+		r.BSSTerminationDuration, b = b[:12], b[12:]
+	}
+	if r.Mode&Dot11BTMESSDisassociationImminent != 0 {
+		if len(b) < 1 || len(b) < 1+int(b[0]) {
+			return nil, errors.New("BSS transition request session information URL truncated")
+		}
+		r.SessionInformationURL, b = string(b[1:1+int(b[0])]), b[1+int(b[0]):]
+	}
+	if r.Candidates, err = decodeDot11BSSTransitionCandidates(b); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// BSSTransitionResponse decodes m as a BSS transition management response.
+func (m *Dot11MgmtAction) BSSTransitionResponse() (*Dot11BSSTransitionResponse, error) {
+	b, err := m.wnmBody(Dot11WNMBSSTransitionResponseAction, 3)
+	if err != nil {
+		return nil, err
+	}
+	r := &Dot11BSSTransitionResponse{DialogToken: b[0], Status: Dot11BTMStatus(b[1]), TerminationDelay: b[2]}
+	b = b[3:]
+	if r.Status == Dot11BTMAccept {
+		if len(b) < 6 {
+			return nil, errors.New("BSS transition response target BSSID truncated")
+		}
+		r.TargetBSSID, b = net.HardwareAddr(b[:6]), b[6:]
+	}
+	if r.Candidates, err = decodeDot11BSSTransitionCandidates(b); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testPacketDot11BTMRequest is a BSS transition management request with
+// disassociation imminent, listing 02:00:00:00:00:03 on channel 149 as
+// the preferred candidate.
+var testPacketDot11BTMRequest = []byte{
+	0xd0, 0x00, 0x3a, 0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x09, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01,
+	0x02, 0x00, 0x00, 0x00, 0x00, 0x01, 0x30, 0x00,
+	0x0a, 0x07, 0x03, 0x05, 0x0a, 0x00, 0xff,
+	0x34, 0x10, 0x02, 0x00, 0x00, 0x00, 0x00, 0x03, 0x8f, 0x00, 0x00, 0x00, 0x7c, 0x95, 0x09,
+	0x03, 0x01, 0xff,
+	0x01, 0x02, 0x03, 0x04, // FCS
+}
+
+func TestPacketDot11BTMRequest(t *testing.T) {
+	p := gopacket.NewPacket(testPacketDot11BTMRequest, LayerTypeDot11, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	action := p.Layer(LayerTypeDot11MgmtAction).(*Dot11MgmtAction)
+	req, err := action.BSSTransitionRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Dot11BSSTransitionRequest{
+		DialogToken:         3,
+		Mode:                Dot11BTMPreferredCandidateList | Dot11BTMDisassociationImminent,
+		DisassociationTimer: 10,
+		ValidityInterval:    255,
+		Candidates: []Dot11NeighborReport{{
+			BSSID:          net.HardwareAddr{2, 0, 0, 0, 0, 3},
+			BSSIDInfo:      0x8f,
+			OperatingClass: 124,
+			Channel:        149,
+			PHYType:        9,
+			Subelements:    []Dot11WNMSubelement{{ID: 3, Data: []byte{0xff}}},
+		}},
+	}
+	if !reflect.DeepEqual(req, want) {
+		t.Errorf("got %+v, want %+v", req, want)
+	}
+	if pref, ok := req.Candidates[0].Preference(); !ok || pref != 255 {
+		t.Errorf("got preference %d, %v", pref, ok)
+	}
+	if _, err := action.BSSTransitionResponse(); err == nil {
+		t.Error("decoded request as response")
+	}
+
+	resp := &Dot11MgmtAction{}
+	resp.Contents = []byte{0x0a, 0x08, 0x03, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x03}
+	r, err := resp.BSSTransitionResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.DialogToken != 3 || r.Status != Dot11BTMAccept || r.TargetBSSID.String() != "02:00:00:00:00:03" {
+		t.Errorf("got %+v", r)
+	}
+	resp.Contents = []byte{0x0a, 0x08, 0x03, 0x07, 0x00}
+	if r, err := resp.BSSTransitionResponse(); err != nil || r.Status != Dot11BTMRejectNoSuitableCandidates || r.TargetBSSID != nil {
+		t.Errorf("got %+v, %v", r, err)
+	}
+	resp.Contents = []byte{0x0a, 0x08, 0x03, 0x00, 0x00, 0x02}
+	if _, err := resp.BSSTransitionResponse(); err == nil {
+		t.Error("decoded accept without target BSSID")
+	}
+
+	query := &Dot11MgmtAction{}
+	query.Contents = []byte{0x0a, 0x06, 0x01, 0x10}
+	if q, err := query.BSSTransitionQuery(); err != nil || q.DialogToken != 1 || q.Reason != 16 || len(q.Candidates) != 0 {
+		t.Errorf("got %+v, %v", q, err)
+	}
+}
@@ -14,7 +14,8 @@ import (
 	"github.com/mistsys/gopacket"
 )
 
-// Dot1Q is the packet layer for 802.1Q VLAN headers.
+// Dot1Q is the packet layer for 802.1Q VLAN headers.  It also decodes
+// 802.1ad service tags; see VLANStack for the tags of QinQ frames.
 type Dot1Q struct {
 	BaseLayer
 	Priority       uint8
@@ -28,6 +29,10 @@ func (d *Dot1Q) LayerType() gopacket.LayerType { return LayerTypeDot1Q }
 
 // DecodeFromBytes decodes the given bytes into this layer.
 func (d *Dot1Q) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return fmt.Errorf("Dot1Q length %d too short", len(data))
+	}
 	d.Priority = (data[0] & 0xE0) >> 5
 	d.DropEligible = data[0]&0x10 != 0
 	d.VLANIdentifier = binary.BigEndian.Uint16(data[:2]) & 0x0FFF
@@ -64,7 +69,7 @@ func (d *Dot1Q) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeO
 	}
 	firstBytes := uint16(d.Priority)<<13 | d.VLANIdentifier
 	if d.DropEligible {
-		firstBytes |= 0x10
+		firstBytes |= 0x1000
 	}
 	binary.BigEndian.PutUint16(bytes, firstBytes)
 	binary.BigEndian.PutUint16(bytes[2:], uint16(d.Type))
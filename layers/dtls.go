@@ -0,0 +1,507 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// DTLSVersion is a DTLS protocol version, as found in records and hellos.
+type DTLSVersion uint16
+
+const (
+	DTLSVersion10 DTLSVersion = 0xfeff
+	DTLSVersion12 DTLSVersion = 0xfefd
+	DTLSVersion13 DTLSVersion = 0xfefc
+)
+
+func (v DTLSVersion) String() string {
+	switch v {
+	case DTLSVersion10:
+		return "DTLS 1.0"
+	case DTLSVersion12:
+		return "DTLS 1.2"
+	case DTLSVersion13:
+		return "DTLS 1.3"
+	default:
+		return fmt.Sprintf("UnknownDTLSVersion(%#04x)", uint16(v))
+	}
+}
+
+// DTLSContentType is the type of a DTLS record.
+type DTLSContentType uint8
+
+const (
+	DTLSContentTypeChangeCipherSpec DTLSContentType = 20
+	DTLSContentTypeAlert            DTLSContentType = 21
+	DTLSContentTypeHandshake        DTLSContentType = 22
+	DTLSContentTypeApplicationData  DTLSContentType = 23
+	DTLSContentTypeHeartbeat        DTLSContentType = 24
+	DTLSContentTypeACK              DTLSContentType = 26
+)
+
+func (t DTLSContentType) String() string {
+	switch t {
+	case DTLSContentTypeChangeCipherSpec:
+		return "Change Cipher Spec"
+	case DTLSContentTypeAlert:
+		return "Alert"
+	case DTLSContentTypeHandshake:
+		return "Handshake"
+	case DTLSContentTypeApplicationData:
+		return "Application Data"
+	case DTLSContentTypeHeartbeat:
+		return "Heartbeat"
+	case DTLSContentTypeACK:
+		return "ACK"
+	default:
+		return fmt.Sprintf("UnknownDTLSContentType(%d)", uint8(t))
+	}
+}
+
+// DTLSHandshakeType is the type of a DTLS handshake message.
+type DTLSHandshakeType uint8
+
+const (
+	DTLSHandshakeHelloRequest       DTLSHandshakeType = 0
+	DTLSHandshakeClientHello        DTLSHandshakeType = 1
+	DTLSHandshakeServerHello        DTLSHandshakeType = 2
+	DTLSHandshakeHelloVerifyRequest DTLSHandshakeType = 3
+	DTLSHandshakeNewSessionTicket   DTLSHandshakeType = 4
+	DTLSHandshakeCertificate        DTLSHandshakeType = 11
+	DTLSHandshakeServerKeyExchange  DTLSHandshakeType = 12
+	DTLSHandshakeCertificateRequest DTLSHandshakeType = 13
+	DTLSHandshakeServerHelloDone    DTLSHandshakeType = 14
+	DTLSHandshakeCertificateVerify  DTLSHandshakeType = 15
+	DTLSHandshakeClientKeyExchange  DTLSHandshakeType = 16
+	DTLSHandshakeFinished           DTLSHandshakeType = 20
+)
+
+func (t DTLSHandshakeType) String() string {
+	switch t {
+	case DTLSHandshakeHelloRequest:
+		return "Hello Request"
+	case DTLSHandshakeClientHello:
+		return "Client Hello"
+	case DTLSHandshakeServerHello:
+		return "Server Hello"
+	case DTLSHandshakeHelloVerifyRequest:
+		return "Hello Verify Request"
+	case DTLSHandshakeNewSessionTicket:
+		return "New Session Ticket"
+	case DTLSHandshakeCertificate:
+		return "Certificate"
+	case DTLSHandshakeServerKeyExchange:
+		return "Server Key Exchange"
+	case DTLSHandshakeCertificateRequest:
+		return "Certificate Request"
+	case DTLSHandshakeServerHelloDone:
+		return "Server Hello Done"
+	case DTLSHandshakeCertificateVerify:
+		return "Certificate Verify"
+	case DTLSHandshakeClientKeyExchange:
+		return "Client Key Exchange"
+	case DTLSHandshakeFinished:
+		return "Finished"
+	default:
+		return fmt.Sprintf("UnknownDTLSHandshakeType(%d)", uint8(t))
+	}
+}
+
+// DTLSExtension is a hello extension.
+type DTLSExtension struct {
+	Type uint16
+	Data []byte
+}
+
+// DTLSExtensionServerName is the server name indication extension.
+const DTLSExtensionServerName = 0
+
+// DTLSClientHello is the body of a ClientHello.  Cookie is empty in the
+// first ClientHello, and echoes the HelloVerifyRequest in the second.
+type DTLSClientHello struct {
+	Version            DTLSVersion
+	Random             []byte
+	SessionID          []byte
+	Cookie             []byte
+	CipherSuites       []uint16
+	CompressionMethods []uint8
+	Extensions         []DTLSExtension
+}
+
+// ServerName returns the host name of the server name indication
+// extension, or "" if there is none.
+func (h *DTLSClientHello) ServerName() string {
+	for _, e := range h.Extensions {
+		if e.Type != DTLSExtensionServerName {
+			continue
+		}
+		// A list of (type, length, name), of which only type 0, host
+		// names, is defined.
+		b := e.Data
+		if len(b) < 2 {
+			return ""
+		}
+		for b = b[2:]; len(b) >= 3; {
+			n := int(binary.BigEndian.Uint16(b[1:3]))
+			if 3+n > len(b) {
+				return ""
+			}
+			if b[0] == 0 {
+				return string(b[3 : 3+n])
+			}
+			b = b[3+n:]
+		}
+	}
+	return ""
+}
+
+// DTLSServerHello is the body of a ServerHello.
+type DTLSServerHello struct {
+	Version           DTLSVersion
+	Random            []byte
+	SessionID         []byte
+	CipherSuite       uint16
+	CompressionMethod uint8
+	Extensions        []DTLSExtension
+}
+
+// DTLSHelloVerifyRequest is the body of a HelloVerifyRequest, by which a
+// server has the client prove its address with a cookie.
+type DTLSHelloVerifyRequest struct {
+	Version DTLSVersion
+	Cookie  []byte
+}
+
+// DTLSHandshake is a handshake message, or a fragment of one.  A message
+// is sent in fragments when it doesn't fit in a datagram; the hello
+// fields are only decoded from complete messages.
+type DTLSHandshake struct {
+	Type DTLSHandshakeType
+	// Length is the length of the whole message, and FragmentOffset and
+	// FragmentLength locate this fragment of it, which is Body.
+	Length         uint32
+	MessageSeq     uint16
+	FragmentOffset uint32
+	FragmentLength uint32
+	Body           []byte
+
+	ClientHello        *DTLSClientHello
+	ServerHello        *DTLSServerHello
+	HelloVerifyRequest *DTLSHelloVerifyRequest
+}
+
+// IsFragment reports whether h is only part of a handshake message.
+func (h *DTLSHandshake) IsFragment() bool {
+	return h.FragmentOffset != 0 || h.FragmentLength != h.Length
+}
+
+// DTLSAlert is an unencrypted alert.
+type DTLSAlert struct {
+	Level       uint8
+	Description uint8
+}
+
+// DTLSRecord is a DTLS record.  Records with an epoch of zero aren't
+// encrypted, and their handshake messages and alerts are decoded.
+type DTLSRecord struct {
+	ContentType DTLSContentType
+	Version     DTLSVersion
+	Epoch       uint16
+	// SequenceNumber is 48 bits.
+	SequenceNumber uint64
+	Length         uint16
+	Fragment       []byte
+	// Unified is set for DTLS 1.3 ciphertext records, whose unified header
+	// has only the low bits of the epoch and sequence number, the latter
+	// encrypted, and neither ContentType nor Version.  Their
+	// connection ID, if any, is at the start of Fragment.
+	Unified bool
+
+	Handshakes []DTLSHandshake
+	Alert      *DTLSAlert
+}
+
+// DTLS is a UDP datagram of DTLS (RFC 6347, RFC 9147) records.  DTLS has
+// no well-known port except for some of the protocols using it, such as
+// RADIUS (2083) and CoAP (5684); on other ports, such as those of WebRTC,
+// decode the UDP payload with LayerTypeDTLS.
+type DTLS struct {
+	BaseLayer
+	Records []DTLSRecord
+}
+
+// LayerType returns LayerTypeDTLS.
+func (d *DTLS) LayerType() gopacket.LayerType { return LayerTypeDTLS }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (d *DTLS) CanDecode() gopacket.LayerClass { return LayerTypeDTLS }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (d *DTLS) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+func decodeDTLS(data []byte, p gopacket.PacketBuilder) error {
+	return decodingLayerDecoder(&DTLS{}, data, p)
+}
+
+const dtlsRecordHeaderLength = 13
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (d *DTLS) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) == 0 {
+		df.SetTruncated()
+		return fmt.Errorf("DTLS datagram empty")
+	}
+	d.Records = d.Records[:0]
+	for rest := data; len(rest) > 0; {
+		var r DTLSRecord
+		var n int
+		var err error
+		if rest[0]&0xe0 == 0x20 {
+			r, n, err = decodeDTLSUnifiedRecord(rest, df)
+		} else {
+			r, n, err = decodeDTLSRecord(rest, df)
+		}
+		if err != nil {
+			return err
+		}
+		d.Records = append(d.Records, r)
+		rest = rest[n:]
+	}
+	d.BaseLayer = BaseLayer{Contents: data}
+	return nil
+}
+
+// decodeDTLSRecord decodes the record at the start of b, and returns its
+// length.
+func decodeDTLSRecord(b []byte, df gopacket.DecodeFeedback) (DTLSRecord, int, error) {
+	var r DTLSRecord
+	if len(b) < dtlsRecordHeaderLength {
+		df.SetTruncated()
+		return r, 0, fmt.Errorf("DTLS record header length %d too short", len(b))
+	}
+	r.ContentType = DTLSContentType(b[0])
+	r.Version = DTLSVersion(binary.BigEndian.Uint16(b[1:3]))
+	if r.Version>>8 != 0xfe {
+		return r, 0, fmt.Errorf("DTLS record version %v invalid", r.Version)
+	}
+	r.Epoch = binary.BigEndian.Uint16(b[3:5])
+	r.SequenceNumber = uint64(binary.BigEndian.Uint16(b[5:7]))<<32 | uint64(binary.BigEndian.Uint32(b[7:11]))
+	r.Length = binary.BigEndian.Uint16(b[11:13])
+	n := dtlsRecordHeaderLength + int(r.Length)
+	if n > len(b) {
+		df.SetTruncated()
+		return r, 0, fmt.Errorf("DTLS record length %d exceeds datagram", r.Length)
+	}
+	r.Fragment = b[dtlsRecordHeaderLength:n]
+	if r.Epoch != 0 {
+		return r, n, nil
+	}
+	switch r.ContentType {
+	case DTLSContentTypeHandshake:
+		for f := r.Fragment; len(f) > 0; {
+			h, m, err := decodeDTLSHandshake(f)
+			if err != nil {
+				return r, 0, err
+			}
+			r.Handshakes = append(r.Handshakes, h)
+			f = f[m:]
+		}
+	case DTLSContentTypeAlert:
+		if len(r.Fragment) != 2 {
+			return r, 0, fmt.Errorf("DTLS alert length %d invalid", len(r.Fragment))
+		}
+		r.Alert = &DTLSAlert{Level: r.Fragment[0], Description: r.Fragment[1]}
+	}
+	return r, n, nil
+}
+
+// decodeDTLSUnifiedRecord decodes the DTLS 1.3 ciphertext record at the
+// start of b, and returns its length.
+func decodeDTLSUnifiedRecord(b []byte, df gopacket.DecodeFeedback) (DTLSRecord, int, error) {
+	r := DTLSRecord{Unified: true, Epoch: uint16(b[0] & 3)}
+	flags := b[0]
+	if flags&0x10 != 0 {
+		// The length of the connection ID was negotiated, so the rest of
+		// the datagram is taken as one record.
+		r.Fragment = b[1:]
+		r.Length = uint16(len(r.Fragment))
+		return r, len(b), nil
+	}
+	off := 2
+	if flags&0x08 != 0 {
+		off = 3
+	}
+	if flags&0x04 != 0 {
+		off += 2
+	}
+	if len(b) < off {
+		df.SetTruncated()
+		return r, 0, fmt.Errorf("DTLS unified header length %d too short", len(b))
+	}
+	if flags&0x08 != 0 {
+		r.SequenceNumber = uint64(binary.BigEndian.Uint16(b[1:3]))
+	} else {
+		r.SequenceNumber = uint64(b[1])
+	}
+	if flags&0x04 == 0 {
+		r.Fragment = b[off:]
+		r.Length = uint16(len(r.Fragment))
+		return r, len(b), nil
+	}
+	r.Length = binary.BigEndian.Uint16(b[off-2 : off])
+	n := off + int(r.Length)
+	if n > len(b) {
+		df.SetTruncated()
+		return r, 0, fmt.Errorf("DTLS record length %d exceeds datagram", r.Length)
+	}
+	r.Fragment = b[off:n]
+	return r, n, nil
+}
+
+func dtlsUint24(b []byte) uint32 {
+	return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+}
+
+// decodeDTLSHandshake decodes the handshake message at the start of b,
+// and returns its length.
+func decodeDTLSHandshake(b []byte) (DTLSHandshake, int, error) {
+	var h DTLSHandshake
+	if len(b) < 12 {
+		return h, 0, fmt.Errorf("DTLS handshake header length %d too short", len(b))
+	}
+	h.Type = DTLSHandshakeType(b[0])
+	h.Length = dtlsUint24(b[1:4])
+	h.MessageSeq = binary.BigEndian.Uint16(b[4:6])
+	h.FragmentOffset = dtlsUint24(b[6:9])
+	h.FragmentLength = dtlsUint24(b[9:12])
+	n := 12 + int(h.FragmentLength)
+	if n > len(b) {
+		return h, 0, fmt.Errorf("DTLS handshake fragment length %d exceeds record", h.FragmentLength)
+	}
+	if h.FragmentOffset+h.FragmentLength > h.Length {
+		return h, 0, fmt.Errorf("DTLS handshake fragment %d+%d exceeds message length %d", h.FragmentOffset, h.FragmentLength, h.Length)
+	}
+	h.Body = b[12:n]
+	if h.IsFragment() {
+		return h, n, nil
+	}
+	var err error
+	switch h.Type {
+	case DTLSHandshakeClientHello:
+		h.ClientHello, err = decodeDTLSClientHello(h.Body)
+	case DTLSHandshakeServerHello:
+		h.ServerHello, err = decodeDTLSServerHello(h.Body)
+	case DTLSHandshakeHelloVerifyRequest:
+		if len(h.Body) < 3 || len(h.Body) < 3+int(h.Body[2]) {
+			return h, 0, fmt.Errorf("DTLS hello verify request length %d too short", len(h.Body))
+		}
+		h.HelloVerifyRequest = &DTLSHelloVerifyRequest{
+			Version: DTLSVersion(binary.BigEndian.Uint16(h.Body[:2])),
+			Cookie:  h.Body[3 : 3+int(h.Body[2])],
+		}
+	}
+	return h, n, err
+}
+
+// dtlsVector returns the vector with a length prefix of size bytes at the
+// start of b, and what follows it.
+func dtlsVector(b []byte, size int, what string) ([]byte, []byte, error) {
+	if len(b) < size {
+		return nil, nil, fmt.Errorf("DTLS %s length truncated", what)
+	}
+	n := 0
+	for _, c := range b[:size] {
+		n = n<<8 | int(c)
+	}
+	if size+n > len(b) {
+		return nil, nil, fmt.Errorf("DTLS %s length %d exceeds message", what, n)
+	}
+	return b[size : size+n], b[size+n:], nil
+}
+
+func decodeDTLSExtensions(b []byte) ([]DTLSExtension, error) {
+	if len(b) == 0 {
+		// Extensions are optional.
+		return nil, nil
+	}
+	b, rest, err := dtlsVector(b, 2, "extensions")
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("DTLS hello has %d bytes after extensions", len(rest))
+	}
+	var out []DTLSExtension
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, fmt.Errorf("DTLS extension truncated")
+		}
+		e := DTLSExtension{Type: binary.BigEndian.Uint16(b[:2])}
+		if e.Data, b, err = dtlsVector(b[2:], 2, "extension"); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func decodeDTLSClientHello(b []byte) (*DTLSClientHello, error) {
+	if len(b) < 34 {
+		return nil, fmt.Errorf("DTLS client hello length %d too short", len(b))
+	}
+	h := &DTLSClientHello{Version: DTLSVersion(binary.BigEndian.Uint16(b[:2])), Random: b[2:34]}
+	var err error
+	rest := b[34:]
+	if h.SessionID, rest, err = dtlsVector(rest, 1, "session ID"); err != nil {
+		return nil, err
+	}
+	if h.Cookie, rest, err = dtlsVector(rest, 1, "cookie"); err != nil {
+		return nil, err
+	}
+	var suites []byte
+	if suites, rest, err = dtlsVector(rest, 2, "cipher suites"); err != nil {
+		return nil, err
+	}
+	if len(suites)%2 != 0 {
+		return nil, fmt.Errorf("DTLS cipher suites length %d odd", len(suites))
+	}
+	for i := 0; i < len(suites); i += 2 {
+		h.CipherSuites = append(h.CipherSuites, binary.BigEndian.Uint16(suites[i:i+2]))
+	}
+	if h.CompressionMethods, rest, err = dtlsVector(rest, 1, "compression methods"); err != nil {
+		return nil, err
+	}
+	if h.Extensions, err = decodeDTLSExtensions(rest); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func decodeDTLSServerHello(b []byte) (*DTLSServerHello, error) {
+	if len(b) < 34 {
+		return nil, fmt.Errorf("DTLS server hello length %d too short", len(b))
+	}
+	h := &DTLSServerHello{Version: DTLSVersion(binary.BigEndian.Uint16(b[:2])), Random: b[2:34]}
+	var err error
+	rest := b[34:]
+	if h.SessionID, rest, err = dtlsVector(rest, 1, "session ID"); err != nil {
+		return nil, err
+	}
+	if len(rest) < 3 {
+		return nil, fmt.Errorf("DTLS server hello truncated")
+	}
+	h.CipherSuite = binary.BigEndian.Uint16(rest[:2])
+	h.CompressionMethod = rest[2]
+	if h.Extensions, err = decodeDTLSExtensions(rest[3:]); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
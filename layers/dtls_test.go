@@ -0,0 +1,144 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// dtlsRecord returns a record of content type t in epoch, holding body.
+func dtlsRecord(t DTLSContentType, epoch uint16, seq uint64, body []byte) []byte {
+	b := []byte{byte(t), 0xfe, 0xfd, byte(epoch >> 8), byte(epoch), byte(seq >> 40), byte(seq >> 32), 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[7:11], uint32(seq))
+	binary.BigEndian.PutUint16(b[11:13], uint16(len(body)))
+	return append(b, body...)
+}
+
+// dtlsHandshake returns a handshake fragment of a message of the given
+// length, at offset.
+func dtlsHandshake(t DTLSHandshakeType, seq uint16, length, offset int, body []byte) []byte {
+	b := []byte{byte(t), byte(length >> 16), byte(length >> 8), byte(length), byte(seq >> 8), byte(seq),
+		byte(offset >> 16), byte(offset >> 8), byte(offset), byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	return append(b, body...)
+}
+
+func testDTLSClientHello() []byte {
+	b := []byte{0xfe, 0xfd}
+	b = append(b, repeatByte(0x11, 32)...)
+	b = append(b, 0)             // session ID
+	b = append(b, 4, 1, 2, 3, 4) // cookie
+	b = append(b, 0, 4, 0xc0, 0x2b, 0xc0, 0x2f)
+	b = append(b, 1, 0)
+	sni := []byte{0, 0, 0, 16, 0, 14, 0, 0, 11}
+	sni = append(sni, "example.com"...)
+	b = append(b, 0, byte(len(sni)+4), 0, 0x17, 0, 0)
+	return append(b, sni...)
+}
+
+func TestDTLSClientHello(t *testing.T) {
+	hello := testDTLSClientHello()
+	data := dtlsRecord(DTLSContentTypeHandshake, 0, 1, dtlsHandshake(DTLSHandshakeClientHello, 1, len(hello), 0, hello))
+	p := gopacket.NewPacket(data, LayerTypeDTLS, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	d := p.Layer(LayerTypeDTLS).(*DTLS)
+	if len(d.Records) != 1 || len(d.Records[0].Handshakes) != 1 {
+		t.Fatalf("got records %+v", d.Records)
+	}
+	r := d.Records[0]
+	if r.ContentType != DTLSContentTypeHandshake || r.Version != DTLSVersion12 || r.SequenceNumber != 1 || int(r.Length) != len(data)-13 {
+		t.Errorf("got record %+v", r)
+	}
+	h := r.Handshakes[0].ClientHello
+	if h == nil {
+		t.Fatal("client hello not decoded")
+	}
+	want := &DTLSClientHello{
+		Version:            DTLSVersion12,
+		Random:             repeatByte(0x11, 32),
+		SessionID:          []byte{},
+		Cookie:             []byte{1, 2, 3, 4},
+		CipherSuites:       []uint16{0xc02b, 0xc02f},
+		CompressionMethods: []uint8{0},
+		Extensions:         h.Extensions,
+	}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("got %+v, want %+v", h, want)
+	}
+	if len(h.Extensions) != 2 || h.Extensions[0].Type != 0x17 {
+		t.Errorf("got extensions %+v", h.Extensions)
+	}
+	if got := h.ServerName(); got != "example.com" {
+		t.Errorf("got server name %q", got)
+	}
+}
+
+func TestDTLSServerFlight(t *testing.T) {
+	sh := []byte{0xfe, 0xfd}
+	sh = append(sh, repeatByte(0x22, 32)...)
+	sh = append(sh, 2, 0xaa, 0xbb, 0xc0, 0x2b, 0)
+	hvr := []byte{0xfe, 0xff, 3, 7, 8, 9}
+	var data []byte
+	data = append(data, dtlsRecord(DTLSContentTypeHandshake, 0, 0, dtlsHandshake(DTLSHandshakeHelloVerifyRequest, 0, len(hvr), 0, hvr))...)
+	flight := dtlsHandshake(DTLSHandshakeServerHello, 1, len(sh), 0, sh)
+	flight = append(flight, dtlsHandshake(DTLSHandshakeCertificate, 2, 1000, 0, repeatByte(0x30, 100))...)
+	data = append(data, dtlsRecord(DTLSContentTypeHandshake, 0, 1, flight)...)
+	data = append(data, dtlsRecord(DTLSContentTypeApplicationData, 1, 5, repeatByte(0xee, 40))...)
+
+	p := gopacket.NewPacket(data, LayerTypeDTLS, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	d := p.Layer(LayerTypeDTLS).(*DTLS)
+	if len(d.Records) != 3 {
+		t.Fatalf("got %d records, want 3", len(d.Records))
+	}
+	if v := d.Records[0].Handshakes[0].HelloVerifyRequest; v == nil || v.Version != DTLSVersion10 || !bytes.Equal(v.Cookie, []byte{7, 8, 9}) {
+		t.Errorf("got hello verify request %+v", v)
+	}
+	hs := d.Records[1].Handshakes
+	if len(hs) != 2 {
+		t.Fatalf("got %d handshakes, want 2", len(hs))
+	}
+	if s := hs[0].ServerHello; s == nil || s.CipherSuite != 0xc02b || !bytes.Equal(s.SessionID, []byte{0xaa, 0xbb}) || s.Extensions != nil {
+		t.Errorf("got server hello %+v", s)
+	}
+	if c := hs[1]; !c.IsFragment() || c.Length != 1000 || c.FragmentLength != 100 || c.MessageSeq != 2 {
+		t.Errorf("got certificate fragment %+v", c)
+	}
+	if r := d.Records[2]; r.Epoch != 1 || r.SequenceNumber != 5 || len(r.Fragment) != 40 || r.Handshakes != nil {
+		t.Errorf("got application data %+v", r)
+	}
+}
+
+func TestDTLSUnified(t *testing.T) {
+	// Unified header with a 16 bit sequence number and a length, epoch 3.
+	data := []byte{0x2f, 0x12, 0x34, 0, 4, 1, 2, 3, 4}
+	p := gopacket.NewPacket(data, LayerTypeDTLS, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	r := p.Layer(LayerTypeDTLS).(*DTLS).Records[0]
+	if !r.Unified || r.Epoch != 3 || r.SequenceNumber != 0x1234 || !bytes.Equal(r.Fragment, []byte{1, 2, 3, 4}) {
+		t.Errorf("got record %+v", r)
+	}
+}
+
+func TestDTLSTruncated(t *testing.T) {
+	hello := testDTLSClientHello()
+	data := dtlsRecord(DTLSContentTypeHandshake, 0, 1, dtlsHandshake(DTLSHandshakeClientHello, 1, len(hello), 0, hello))
+	p := gopacket.NewPacket(data[:len(data)-5], LayerTypeDTLS, gopacket.Default)
+	if p.ErrorLayer() == nil || !p.Metadata().Truncated {
+		t.Error("truncated record decoded without error")
+	}
+}
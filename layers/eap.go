@@ -48,13 +48,21 @@ func (e *EAP) LayerType() gopacket.LayerType { return LayerTypeEAP }
 
 // DecodeFromBytes decodes the given bytes into this layer.
 func (e *EAP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return fmt.Errorf("EAP length %d too short", len(data))
+	}
 	e.Code = EAPCode(data[0])
 	e.Id = data[1]
 	e.Length = binary.BigEndian.Uint16(data[2:4])
+	if int(e.Length) > len(data) {
+		df.SetTruncated()
+		return fmt.Errorf("EAP length %d exceeds %d bytes available", e.Length, len(data))
+	}
 	switch {
 	case e.Length > 4:
 		e.Type = EAPType(data[4])
-		e.TypeData = data[5:]
+		e.TypeData = data[5:e.Length]
 	case e.Length == 4:
 		e.Type = 0
 		e.TypeData = nil
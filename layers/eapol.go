@@ -8,6 +8,7 @@ package layers
 
 import (
 	"encoding/binary"
+	"fmt"
 
 	"github.com/mistsys/gopacket"
 )
@@ -25,10 +26,18 @@ func (e *EAPOL) LayerType() gopacket.LayerType { return LayerTypeEAPOL }
 
 // DecodeFromBytes decodes the given bytes into this layer.
 func (e *EAPOL) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return fmt.Errorf("EAPOL length %d too short", len(data))
+	}
 	e.Version = data[0]
 	e.Type = EAPOLType(data[1])
 	e.Length = binary.BigEndian.Uint16(data[2:4])
 	e.BaseLayer = BaseLayer{data[:4], data[4:]}
+	if int(e.Length) < len(e.Payload) {
+		// Strip the padding of short Ethernet frames.
+		e.Payload = e.Payload[:e.Length]
+	}
 	return nil
 }
 
@@ -0,0 +1,354 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/mistsys/gopacket"
+)
+
+const eigrpHeaderLength = 20
+
+// EIGRPOpcode is the type of an EIGRP packet.
+type EIGRPOpcode uint8
+
+const (
+	EIGRPOpcodeUpdate   EIGRPOpcode = 1
+	EIGRPOpcodeQuery    EIGRPOpcode = 3
+	EIGRPOpcodeReply    EIGRPOpcode = 4
+	EIGRPOpcodeHello    EIGRPOpcode = 5
+	EIGRPOpcodeSIAQuery EIGRPOpcode = 10
+	EIGRPOpcodeSIAReply EIGRPOpcode = 11
+)
+
+func (o EIGRPOpcode) String() string {
+	switch o {
+	case EIGRPOpcodeUpdate:
+		return "Update"
+	case EIGRPOpcodeQuery:
+		return "Query"
+	case EIGRPOpcodeReply:
+		return "Reply"
+	case EIGRPOpcodeHello:
+		return "Hello"
+	case EIGRPOpcodeSIAQuery:
+		return "SIAQuery"
+	case EIGRPOpcodeSIAReply:
+		return "SIAReply"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(o))
+}
+
+// EIGRP header flags.
+const (
+	EIGRPFlagInit            = 0x01
+	EIGRPFlagConditionalRecv = 0x02
+	EIGRPFlagRestart         = 0x04
+	EIGRPFlagEndOfTable      = 0x08
+)
+
+// EIGRPTLVType is the type of an EIGRP TLV.
+type EIGRPTLVType uint16
+
+const (
+	EIGRPTLVParameters            EIGRPTLVType = 0x0001
+	EIGRPTLVAuthentication        EIGRPTLVType = 0x0002
+	EIGRPTLVSequence              EIGRPTLVType = 0x0003
+	EIGRPTLVSoftwareVersion       EIGRPTLVType = 0x0004
+	EIGRPTLVNextMulticastSequence EIGRPTLVType = 0x0005
+	EIGRPTLVIPv4Internal          EIGRPTLVType = 0x0102
+	EIGRPTLVIPv4External          EIGRPTLVType = 0x0103
+	EIGRPTLVIPv6Internal          EIGRPTLVType = 0x0402
+	EIGRPTLVIPv6External          EIGRPTLVType = 0x0403
+)
+
+func (t EIGRPTLVType) String() string {
+	switch t {
+	case EIGRPTLVParameters:
+		return "Parameters"
+	case EIGRPTLVAuthentication:
+		return "Authentication"
+	case EIGRPTLVSequence:
+		return "Sequence"
+	case EIGRPTLVSoftwareVersion:
+		return "SoftwareVersion"
+	case EIGRPTLVNextMulticastSequence:
+		return "NextMulticastSequence"
+	case EIGRPTLVIPv4Internal:
+		return "IPv4Internal"
+	case EIGRPTLVIPv4External:
+		return "IPv4External"
+	case EIGRPTLVIPv6Internal:
+		return "IPv6Internal"
+	case EIGRPTLVIPv6External:
+		return "IPv6External"
+	}
+	return fmt.Sprintf("Unknown(%#04x)", uint16(t))
+}
+
+// EIGRP is an EIGRP packet.
+type EIGRP struct {
+	BaseLayer
+	Version         uint8
+	Opcode          EIGRPOpcode
+	Checksum        uint16
+	Flags           uint32
+	Sequence        uint32
+	Ack             uint32
+	VirtualRouterID uint16
+	AS              uint16
+	TLVs            []EIGRPTLV
+}
+
+// EIGRPTLV is a TLV of an EIGRP packet.  Decode its value with the method
+// for its type.
+type EIGRPTLV struct {
+	Type  EIGRPTLVType
+	Value []byte
+}
+
+// LayerType returns LayerTypeEIGRP.
+func (e *EIGRP) LayerType() gopacket.LayerType { return LayerTypeEIGRP }
+
+func (e *EIGRP) CanDecode() gopacket.LayerClass { return LayerTypeEIGRP }
+
+func (e *EIGRP) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (e *EIGRP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < eigrpHeaderLength {
+		df.SetTruncated()
+		return fmt.Errorf("EIGRP length %d too short", len(data))
+	}
+	*e = EIGRP{
+		BaseLayer:       BaseLayer{Contents: data},
+		Version:         data[0],
+		Opcode:          EIGRPOpcode(data[1]),
+		Checksum:        binary.BigEndian.Uint16(data[2:4]),
+		Flags:           binary.BigEndian.Uint32(data[4:8]),
+		Sequence:        binary.BigEndian.Uint32(data[8:12]),
+		Ack:             binary.BigEndian.Uint32(data[12:16]),
+		VirtualRouterID: binary.BigEndian.Uint16(data[16:18]),
+		AS:              binary.BigEndian.Uint16(data[18:20]),
+	}
+	for b := data[eigrpHeaderLength:]; len(b) > 0; {
+		if len(b) < 4 {
+			return errors.New("EIGRP TLV truncated")
+		}
+		l := int(binary.BigEndian.Uint16(b[2:4]))
+		if l < 4 || l > len(b) {
+			return fmt.Errorf("EIGRP TLV length %d invalid", l)
+		}
+		e.TLVs = append(e.TLVs, EIGRPTLV{Type: EIGRPTLVType(binary.BigEndian.Uint16(b[0:2])), Value: b[4:l]})
+		b = b[l:]
+	}
+	return nil
+}
+
+// TLV returns the first TLV of the given type.
+func (e *EIGRP) TLV(t EIGRPTLVType) (EIGRPTLV, bool) {
+	for _, tlv := range e.TLVs {
+		if tlv.Type == t {
+			return tlv, true
+		}
+	}
+	return EIGRPTLV{}, false
+}
+
+// Hello returns true if e is a hello, and false if it is an ack: an empty
+// hello acknowledging a sequence number.
+func (e *EIGRP) Hello() bool {
+	return e.Opcode == EIGRPOpcodeHello && e.Ack == 0
+}
+
+func decodeEIGRP(data []byte, p gopacket.PacketBuilder) error {
+	e := &EIGRP{}
+	return decodingLayerDecoder(e, data, p)
+}
+
+func (t EIGRPTLV) check(typ EIGRPTLVType, min int) error {
+	if t.Type != typ {
+		return fmt.Errorf("EIGRP TLV %v is not %v", t.Type, typ)
+	}
+	if len(t.Value) < min {
+		return fmt.Errorf("EIGRP %v length %d too short", typ, len(t.Value))
+	}
+	return nil
+}
+
+// EIGRPParameters are the metric weights and hold time a router sends in
+// its hellos.  Neighbors only form adjacencies if their K values match.
+type EIGRPParameters struct {
+	K1, K2, K3, K4, K5, K6 uint8
+	HoldTime               uint16
+}
+
+// Parameters decodes a parameters TLV.
+func (t EIGRPTLV) Parameters() (EIGRPParameters, error) {
+	if err := t.check(EIGRPTLVParameters, 8); err != nil {
+		return EIGRPParameters{}, err
+	}
+	b := t.Value
+	return EIGRPParameters{
+		K1: b[0], K2: b[1], K3: b[2], K4: b[3], K5: b[4], K6: b[5],
+		HoldTime: binary.BigEndian.Uint16(b[6:8]),
+	}, nil
+}
+
+// EIGRPSoftwareVersion is the release of the sending router's operating
+// system and of its EIGRP implementation, each as major and minor versions.
+type EIGRPSoftwareVersion struct {
+	OS, EIGRP [2]uint8
+}
+
+// SoftwareVersion decodes a software version TLV.
+func (t EIGRPTLV) SoftwareVersion() (EIGRPSoftwareVersion, error) {
+	if err := t.check(EIGRPTLVSoftwareVersion, 4); err != nil {
+		return EIGRPSoftwareVersion{}, err
+	}
+	return EIGRPSoftwareVersion{
+		OS:    [2]uint8{t.Value[0], t.Value[1]},
+		EIGRP: [2]uint8{t.Value[2], t.Value[3]},
+	}, nil
+}
+
+// SequenceAddresses decodes a sequence TLV, which lists the neighbors that
+// should not accept the multicast packet that follows the hello.
+func (t EIGRPTLV) SequenceAddresses() ([]net.IP, error) {
+	if err := t.check(EIGRPTLVSequence, 0); err != nil {
+		return nil, err
+	}
+	var out []net.IP
+	for b := t.Value; len(b) > 0; {
+		n := int(b[0])
+		if len(b) < 1+n {
+			return nil, errors.New("EIGRP sequence address truncated")
+		}
+		out = append(out, net.IP(b[1:1+n]))
+		b = b[1+n:]
+	}
+	return out, nil
+}
+
+// NextMulticastSequence decodes a next multicast sequence TLV.
+func (t EIGRPTLV) NextMulticastSequence() (uint32, error) {
+	if err := t.check(EIGRPTLVNextMulticastSequence, 4); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(t.Value), nil
+}
+
+// EIGRPMetric is the composite metric of a route.  Delay is in tens of
+// microseconds, and Bandwidth the inverse of the minimum bandwidth,
+// 10^7/kbps.  An infinite delay makes the route unreachable.
+type EIGRPMetric struct {
+	Delay       uint32
+	Bandwidth   uint32
+	MTU         uint32
+	HopCount    uint8
+	Reliability uint8
+	Load        uint8
+	Tag         uint8
+	Flags       uint8
+}
+
+// EIGRPDelayInfinity is the delay of unreachable routes.
+const EIGRPDelayInfinity = 0xffffffff
+
+// EIGRPExternal describes where an external route was redistributed from.
+type EIGRPExternal struct {
+	OriginatingRouter net.IP
+	OriginatingAS     uint32
+	Tag               uint32
+	Metric            uint32
+	// Protocol is the routing protocol the route came from, such as 3 for
+	// static routes or 7 for OSPF.
+	Protocol uint8
+	Flags    uint8
+}
+
+// EIGRPRoute is a route of an update, query or reply.  External is only
+// set for external routes.
+type EIGRPRoute struct {
+	NextHop      net.IP
+	External     *EIGRPExternal
+	Metric       EIGRPMetric
+	Destinations []net.IPNet
+}
+
+// Unreachable returns true if r withdraws its destinations.
+func (r *EIGRPRoute) Unreachable() bool {
+	return r.Metric.Delay == EIGRPDelayInfinity
+}
+
+// Route decodes an IPv4 or IPv6 internal or external route TLV.
+func (t EIGRPTLV) Route() (*EIGRPRoute, error) {
+	var addrLen int
+	var external bool
+	switch t.Type {
+	case EIGRPTLVIPv4Internal:
+		addrLen = net.IPv4len
+	case EIGRPTLVIPv4External:
+		addrLen, external = net.IPv4len, true
+	case EIGRPTLVIPv6Internal:
+		addrLen = net.IPv6len
+	case EIGRPTLVIPv6External:
+		addrLen, external = net.IPv6len, true
+	default:
+		return nil, fmt.Errorf("EIGRP TLV %v is not a route", t.Type)
+	}
+	min := addrLen + 16
+	if external {
+		min += 20
+	}
+	if len(t.Value) < min {
+		return nil, fmt.Errorf("EIGRP %v length %d too short", t.Type, len(t.Value))
+	}
+	b := t.Value
+	r := &EIGRPRoute{NextHop: net.IP(b[:addrLen])}
+	b = b[addrLen:]
+	if external {
+		r.External = &EIGRPExternal{
+			OriginatingRouter: net.IP(b[0:4]),
+			OriginatingAS:     binary.BigEndian.Uint32(b[4:8]),
+			Tag:               binary.BigEndian.Uint32(b[8:12]),
+			Metric:            binary.BigEndian.Uint32(b[12:16]),
+			Protocol:          b[18],
+			Flags:             b[19],
+		}
+		b = b[20:]
+	}
+	r.Metric = EIGRPMetric{
+		Delay:       binary.BigEndian.Uint32(b[0:4]),
+		Bandwidth:   binary.BigEndian.Uint32(b[4:8]),
+		MTU:         uint32(b[8])<<16 | uint32(b[9])<<8 | uint32(b[10]),
+		HopCount:    b[11],
+		Reliability: b[12],
+		Load:        b[13],
+		Tag:         b[14],
+		Flags:       b[15],
+	}
+	for b = b[16:]; len(b) > 0; {
+		bits := int(b[0])
+		if bits > addrLen*8 {
+			return nil, fmt.Errorf("EIGRP prefix length %d too long", bits)
+		}
+		n := (bits + 7) / 8
+		if len(b) < 1+n {
+			return nil, fmt.Errorf("EIGRP /%d destination truncated", bits)
+		}
+		ip := make(net.IP, addrLen)
+		copy(ip, b[1:1+n])
+		r.Destinations = append(r.Destinations, net.IPNet{IP: ip, Mask: net.CIDRMask(bits, addrLen*8)})
+		b = b[1+n:]
+	}
+	return r, nil
+}
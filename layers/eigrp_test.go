@@ -0,0 +1,95 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// eigrpPacket returns an EIGRP packet for AS 100 in an IPv4 packet.
+func eigrpPacket(t *testing.T, opcode EIGRPOpcode, flags, seq byte, tlvs ...byte) *EIGRP {
+	eigrp := []byte{2, byte(opcode), 0, 0, 0, 0, 0, flags, 0, 0, 0, seq, 0, 0, 0, 0, 0, 0, 0, 100}
+	buf := gopacket.NewSerializeBuffer()
+	ip := &IPv4{Version: 4, TTL: 2, Protocol: IPProtocolEIGRP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{224, 0, 0, 10}}
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		ip, gopacket.Payload(append(eigrp, tlvs...))); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeEIGRP}, t)
+	return p.Layer(LayerTypeEIGRP).(*EIGRP)
+}
+
+func TestPacketEIGRPHello(t *testing.T) {
+	e := eigrpPacket(t, EIGRPOpcodeHello, 0, 0,
+		0x00, 0x01, 0x00, 0x0c, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x0f,
+		0x00, 0x04, 0x00, 0x08, 0x0f, 0x00, 0x02, 0x00,
+	)
+	if e.Version != 2 || e.AS != 100 || !e.Hello() || len(e.TLVs) != 2 {
+		t.Fatalf("got %+v", e)
+	}
+	tlv, _ := e.TLV(EIGRPTLVParameters)
+	want := EIGRPParameters{K1: 1, K3: 1, HoldTime: 15}
+	if params, err := tlv.Parameters(); err != nil || params != want {
+		t.Errorf("got parameters %+v, %v", params, err)
+	}
+	tlv, _ = e.TLV(EIGRPTLVSoftwareVersion)
+	if v, err := tlv.SoftwareVersion(); err != nil || v.OS != [2]uint8{15, 0} || v.EIGRP != [2]uint8{2, 0} {
+		t.Errorf("got version %+v, %v", v, err)
+	}
+	if _, err := tlv.Parameters(); err == nil {
+		t.Error("decoded software version as parameters")
+	}
+}
+
+func TestPacketEIGRPUpdate(t *testing.T) {
+	e := eigrpPacket(t, EIGRPOpcodeUpdate, EIGRPFlagInit, 7,
+		// Internal route to 192.168.10.0/24 via the sender.
+		0x01, 0x02, 0x00, 0x1c,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x0a, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x05, 0xdc, 0x01, 0xff, 0x01, 0x00, 0x00,
+		0x18, 0xc0, 0xa8, 0x0a,
+		// External static route to 172.16.0.0/12.
+		0x01, 0x03, 0x00, 0x2f,
+		0x0a, 0x00, 0x00, 0x02,
+		0x0a, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x2a, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0x00,
+		0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x01, 0x00, 0x00, 0x05, 0xdc, 0x01, 0xff, 0x01, 0x00, 0x00,
+		0x0c, 0xac, 0x10,
+	)
+	if e.Opcode != EIGRPOpcodeUpdate || e.Flags != EIGRPFlagInit || e.Sequence != 7 || len(e.TLVs) != 2 {
+		t.Fatalf("got %+v", e)
+	}
+	r, err := e.TLVs[0].Route()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &EIGRPRoute{
+		NextHop:      net.IP{0, 0, 0, 0},
+		Metric:       EIGRPMetric{Delay: 2560, Bandwidth: 256, MTU: 1500, HopCount: 1, Reliability: 255, Load: 1},
+		Destinations: []net.IPNet{{IP: net.IP{192, 168, 10, 0}, Mask: net.CIDRMask(24, 32)}},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("got route %+v, want %+v", r, want)
+	}
+	r, err = e.TLVs[1].Route()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x := r.External; x == nil || !x.OriginatingRouter.Equal(net.IP{10, 0, 0, 9}) || x.Tag != 42 || x.Protocol != 3 {
+		t.Errorf("got external %+v", r.External)
+	}
+	if !r.Unreachable() || r.Destinations[0].String() != "172.16.0.0/12" {
+		t.Errorf("got route %+v", r)
+	}
+}
@@ -56,9 +56,16 @@ const (
 	EthernetTypeMPLSUnicast                 EthernetType = 0x8847
 	EthernetTypeMPLSMulticast               EthernetType = 0x8848
 	EthernetTypeEAPOL                       EthernetType = 0x888e
+	EthernetTypeRSNPreAuth                  EthernetType = 0x88c7
+	EthernetTypeSlowProtocols               EthernetType = 0x8809
 	EthernetTypeQinQ                        EthernetType = 0x88a8
 	EthernetTypeLinkLayerDiscovery          EthernetType = 0x88cc
+	EthernetTypeMACsec                      EthernetType = 0x88e5
+	EthernetTypeERSPAN                      EthernetType = 0x88be
+	EthernetTypeERSPANTypeIII               EthernetType = 0x22eb
+	EthernetTypePTP                         EthernetType = 0x88f7
 	EthernetTypeEthernetCTP                 EthernetType = 0x9000
+	EthernetTypeRTag                        EthernetType = 0xf1c1
 )
 
 // IPProtocol is an enumeration of IP protocol values, and acts as a decoder
@@ -82,9 +89,12 @@ const (
 	IPProtocolICMPv6          IPProtocol = 58
 	IPProtocolNoNextHeader    IPProtocol = 59
 	IPProtocolIPv6Destination IPProtocol = 60
+	IPProtocolEIGRP           IPProtocol = 88
+	IPProtocolOSPF            IPProtocol = 89
 	IPProtocolIPIP            IPProtocol = 94
 	IPProtocolEtherIP         IPProtocol = 97
 	IPProtocolVRRP            IPProtocol = 112
+	IPProtocolL2TP            IPProtocol = 115
 	IPProtocolSCTP            IPProtocol = 132
 	IPProtocolUDPLite         IPProtocol = 136
 	IPProtocolMPLSInIP        IPProtocol = 137
@@ -92,7 +102,7 @@ const (
 
 // LinkType is an enumeration of link types, and acts as a decoder for any
 // link type it supports.
-type LinkType uint8
+type LinkType uint16
 
 const (
 	// According to pcap-linktype(7) and http://www.tcpdump.org/linktypes.html
@@ -124,6 +134,7 @@ const (
 	LinkTypeLinuxUSB       LinkType = 220
 	LinkTypeIPv4           LinkType = 228
 	LinkTypeIPv6           LinkType = 229
+	LinkTypeLinuxSLL2      LinkType = 276
 )
 
 // PPPoECode is the PPPoE code enum, taken from http://tools.ietf.org/html/rfc2516
@@ -184,6 +195,7 @@ const (
 	EAPOLTypeLogOff   EAPOLType = 2
 	EAPOLTypeKey      EAPOLType = 3
 	EAPOLTypeASFAlert EAPOLType = 4
+	EAPOLTypeMKA      EAPOLType = 5
 )
 
 // ProtocolFamily is the set of values defined as PF_* in sys/socket.h
@@ -283,7 +295,7 @@ var (
 	SCTPChunkTypeMetadata    [265]EnumMetadata
 	PPPTypeMetadata          [65536]EnumMetadata
 	PPPoECodeMetadata        [256]EnumMetadata
-	LinkTypeMetadata         [256]EnumMetadata
+	LinkTypeMetadata         [65536]EnumMetadata
 	FDDIFrameControlMetadata [256]EnumMetadata
 	EAPOLTypeMetadata        [256]EnumMetadata
 	ProtocolFamilyMetadata   [256]EnumMetadata
@@ -454,20 +466,30 @@ func init() {
 	EthernetTypeMetadata[EthernetTypeCiscoDiscovery] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeCiscoDiscovery), Name: "CiscoDiscovery", LayerType: LayerTypeCiscoDiscovery}
 	EthernetTypeMetadata[EthernetTypeNortelDiscovery] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeNortelDiscovery), Name: "NortelDiscovery", LayerType: LayerTypeNortelDiscovery}
 	EthernetTypeMetadata[EthernetTypeLinkLayerDiscovery] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeLinkLayerDiscovery), Name: "LinkLayerDiscovery", LayerType: LayerTypeLinkLayerDiscovery}
+	EthernetTypeMetadata[EthernetTypeMACsec] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeMACsec), Name: "MACsec", LayerType: LayerTypeMACsec}
+	EthernetTypeMetadata[EthernetTypeRTag] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeRTag), Name: "RTag", LayerType: LayerTypeRTag}
+	EthernetTypeMetadata[EthernetTypePTP] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodePTP), Name: "PTP", LayerType: LayerTypePTP}
 	EthernetTypeMetadata[EthernetTypeMPLSUnicast] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeMPLS), Name: "MPLSUnicast", LayerType: LayerTypeMPLS}
 	EthernetTypeMetadata[EthernetTypeMPLSMulticast] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeMPLS), Name: "MPLSMulticast", LayerType: LayerTypeMPLS}
 	EthernetTypeMetadata[EthernetTypeEAPOL] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeEAPOL), Name: "EAPOL", LayerType: LayerTypeEAPOL}
+	// RSN pre-authentication frames are EAPOL frames sent through the
+	// distribution system to an AP the station may roam to.
+	EthernetTypeMetadata[EthernetTypeRSNPreAuth] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeEAPOL), Name: "RSNPreAuth", LayerType: LayerTypeEAPOL}
+	EthernetTypeMetadata[EthernetTypeSlowProtocols] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeSlowProtocol), Name: "SlowProtocols", LayerType: LayerTypeLACP}
 	EthernetTypeMetadata[EthernetTypeQinQ] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeDot1Q), Name: "Dot1Q", LayerType: LayerTypeDot1Q}
 	EthernetTypeMetadata[EthernetTypeTransparentEthernetBridging] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeEthernet), Name: "TransparentEthernetBridging", LayerType: LayerTypeEthernet}
 
 	EthernetTypeMetadata[EthernetType802dot3] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeEthernet), Name: "802dot3", LayerType: LayerTypeEthernet}
 	EthernetTypeMetadata[EthernetTypeCiscoAP] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeCiscoAP), Name: "CiscoAP", LayerType: LayerTypeCiscoAP}
+	EthernetTypeMetadata[EthernetTypeERSPAN] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeERSPAN), Name: "ERSPAN", LayerType: LayerTypeERSPAN}
+	EthernetTypeMetadata[EthernetTypeERSPANTypeIII] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeERSPAN), Name: "ERSPANTypeIII", LayerType: LayerTypeERSPAN}
 
 	IPProtocolMetadata[IPProtocolIPv4] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeIPv4), Name: "IPv4", LayerType: LayerTypeIPv4}
 	IPProtocolMetadata[IPProtocolTCP] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeTCP), Name: "TCP", LayerType: LayerTypeTCP}
 	IPProtocolMetadata[IPProtocolUDP] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeUDP), Name: "UDP", LayerType: LayerTypeUDP}
 	IPProtocolMetadata[IPProtocolICMPv4] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeICMPv4), Name: "ICMPv4", LayerType: LayerTypeICMPv4}
 	IPProtocolMetadata[IPProtocolICMPv6] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeICMPv6), Name: "ICMPv6", LayerType: LayerTypeICMPv6}
+	IPProtocolMetadata[IPProtocolL2TP] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeL2TPv3IP), Name: "L2TP", LayerType: LayerTypeL2TPv3IP}
 	IPProtocolMetadata[IPProtocolSCTP] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeSCTP), Name: "SCTP", LayerType: LayerTypeSCTP}
 	IPProtocolMetadata[IPProtocolIPv6] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeIPv6), Name: "IPv6", LayerType: LayerTypeIPv6}
 	IPProtocolMetadata[IPProtocolIPIP] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeIPv4), Name: "IPv4", LayerType: LayerTypeIPv4}
@@ -485,6 +507,8 @@ func init() {
 	IPProtocolMetadata[IPProtocolNoNextHeader] = EnumMetadata{DecodeWith: gopacket.DecodePayload, Name: "NoNextHeader", LayerType: gopacket.LayerTypePayload}
 	IPProtocolMetadata[IPProtocolIGMP] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeIGMP), Name: "IGMP", LayerType: LayerTypeIGMP}
 	IPProtocolMetadata[IPProtocolVRRP] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeVRRP), Name: "VRRP", LayerType: LayerTypeVRRP}
+	IPProtocolMetadata[IPProtocolEIGRP] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeEIGRP), Name: "EIGRP", LayerType: LayerTypeEIGRP}
+	IPProtocolMetadata[IPProtocolOSPF] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeOSPF), Name: "OSPF", LayerType: LayerTypeOSPF}
 
 	SCTPChunkTypeMetadata[SCTPChunkTypeData] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeSCTPData), Name: "Data"}
 	SCTPChunkTypeMetadata[SCTPChunkTypeInit] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeSCTPInit), Name: "Init"}
@@ -517,12 +541,14 @@ func init() {
 	LinkTypeMetadata[LinkTypeIEEE80211Radio] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeRadioTap), Name: "RadioTap"}
 	LinkTypeMetadata[LinkTypeLinuxUSB] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeUSB), Name: "USB"}
 	LinkTypeMetadata[LinkTypeLinuxSLL] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeLinuxSLL), Name: "Linux SLL"}
+	LinkTypeMetadata[LinkTypeLinuxSLL2] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeLinuxSLL2), Name: "Linux SLL2"}
 	LinkTypeMetadata[LinkTypePrismHeader] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodePrismHeader), Name: "Prism"}
 
 	FDDIFrameControlMetadata[FDDIFrameControlLLC] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeLLC), Name: "LLC"}
 
 	EAPOLTypeMetadata[EAPOLTypeEAP] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeEAP), Name: "EAP", LayerType: LayerTypeEAP}
 	EAPOLTypeMetadata[EAPOLTypeKey] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeEAPOLKey), Name: "EAPOLKey", LayerType: LayerTypeEAPOLKey}
+	EAPOLTypeMetadata[EAPOLTypeMKA] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeMKA), Name: "MKA", LayerType: LayerTypeMKA}
 
 	ProtocolFamilyMetadata[ProtocolFamilyIPv4] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeIPv4), Name: "IPv4", LayerType: LayerTypeIPv4}
 	ProtocolFamilyMetadata[ProtocolFamilyIPv6BSD] = EnumMetadata{DecodeWith: gopacket.DecodeFunc(decodeIPv6), Name: "IPv6", LayerType: LayerTypeIPv6}
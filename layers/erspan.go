@@ -0,0 +1,264 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// ERSPAN is the Encapsulated Remote SPAN header used by Cisco, Arista and
+// others to mirror traffic over GRE, as described in
+// draft-foschiano-erspan-03.
+//
+// Type I sessions carry the mirrored frame directly after a GRE header with
+// no sequence number and have no ERSPAN header at all; GRE decodes those
+// straight into Ethernet.  Type II (version 1) uses GRE protocol 0x88BE and
+// Type III (version 2) uses 0x22EB.
+//
+// Type II header:
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|  Ver  |          VLAN         | COS | En|T|    Session ID     |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|      Reserved         |                  Index                |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//
+// Type III header:
+//
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|  Ver  |          VLAN         | COS |BSO|T|     Session ID    |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                          Timestamp                            |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|             SGT               |P|    FT   |   Hw ID   |D|Gra|O|
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|          Platform Specific Info (optional, if O is set)       |
+//	+                                                               +
+//	|                                                               |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type ERSPAN struct {
+	BaseLayer
+	Version ERSPANVersion
+	VLAN    uint16
+	COS     uint8
+	// Encapsulation is the En field in type II, describing the original
+	// frame's VLAN tagging.  In type III the same bits are the BSO (bad/short
+	// oversized) field.
+	Encapsulation uint8
+	// Truncated is set when the mirrored frame was truncated to fit the
+	// session's MTU.
+	Truncated bool
+	SessionID uint16
+	// Index is the type II port index/direction field.
+	Index uint32
+
+	// The following fields are only present in type III headers.
+	Timestamp   uint32
+	SGT         uint16
+	PDUFrame    bool
+	FrameType   ERSPANFrameType
+	HardwareID  uint8
+	Egress      bool
+	Granularity ERSPANGranularity
+	// PlatformSpecific holds the 8-byte platform specific subheader if the O
+	// flag was set.
+	PlatformSpecific []byte
+}
+
+// ERSPANVersion is the version field of an ERSPAN header.
+type ERSPANVersion uint8
+
+const (
+	ERSPANVersionTypeII  ERSPANVersion = 1
+	ERSPANVersionTypeIII ERSPANVersion = 2
+)
+
+func (v ERSPANVersion) String() string {
+	switch v {
+	case ERSPANVersionTypeII:
+		return "TypeII"
+	case ERSPANVersionTypeIII:
+		return "TypeIII"
+	}
+	return fmt.Sprintf("UnknownERSPANVersion(%d)", uint8(v))
+}
+
+// ERSPANFrameType is the FT field of a type III header, giving the type of
+// the mirrored frame.
+type ERSPANFrameType uint8
+
+const (
+	ERSPANFrameTypeEthernet ERSPANFrameType = 0
+	ERSPANFrameTypeIP       ERSPANFrameType = 2
+)
+
+func (t ERSPANFrameType) String() string {
+	switch t {
+	case ERSPANFrameTypeEthernet:
+		return "Ethernet"
+	case ERSPANFrameTypeIP:
+		return "IP"
+	}
+	return fmt.Sprintf("UnknownERSPANFrameType(%d)", uint8(t))
+}
+
+// ERSPANGranularity is the Gra field of a type III header, giving the unit
+// of Timestamp.
+type ERSPANGranularity uint8
+
+const (
+	ERSPANGranularity100Microseconds ERSPANGranularity = 0
+	ERSPANGranularity100Nanoseconds  ERSPANGranularity = 1
+	ERSPANGranularityIEEE1588        ERSPANGranularity = 2
+	ERSPANGranularityUserDefined     ERSPANGranularity = 3
+)
+
+func (g ERSPANGranularity) String() string {
+	switch g {
+	case ERSPANGranularity100Microseconds:
+		return "100us"
+	case ERSPANGranularity100Nanoseconds:
+		return "100ns"
+	case ERSPANGranularityIEEE1588:
+		return "IEEE1588"
+	case ERSPANGranularityUserDefined:
+		return "UserDefined"
+	}
+	return fmt.Sprintf("UnknownERSPANGranularity(%d)", uint8(g))
+}
+
+// LayerType returns LayerTypeERSPAN.
+func (e *ERSPAN) LayerType() gopacket.LayerType { return LayerTypeERSPAN }
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (e *ERSPAN) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 8 {
+		df.SetTruncated()
+		return fmt.Errorf("ERSPAN header too short: %d bytes", len(data))
+	}
+	e.Version = ERSPANVersion(data[0] >> 4)
+	e.VLAN = binary.BigEndian.Uint16(data[0:2]) & 0x0fff
+	e.COS = data[2] >> 5
+	e.Encapsulation = (data[2] >> 3) & 0x3
+	e.Truncated = data[2]&0x04 != 0
+	e.SessionID = binary.BigEndian.Uint16(data[2:4]) & 0x03ff
+	e.Index, e.Timestamp, e.SGT = 0, 0, 0
+	e.PDUFrame, e.FrameType, e.HardwareID, e.Egress, e.Granularity = false, 0, 0, false, 0
+	e.PlatformSpecific = nil
+	switch e.Version {
+	case ERSPANVersionTypeII:
+		e.Index = binary.BigEndian.Uint32(data[4:8]) & 0x000fffff
+		e.BaseLayer = BaseLayer{Contents: data[:8], Payload: data[8:]}
+	case ERSPANVersionTypeIII:
+		if len(data) < 12 {
+			df.SetTruncated()
+			return fmt.Errorf("ERSPAN type III header too short: %d bytes", len(data))
+		}
+		e.Timestamp = binary.BigEndian.Uint32(data[4:8])
+		e.SGT = binary.BigEndian.Uint16(data[8:10])
+		e.PDUFrame = data[10]&0x80 != 0
+		e.FrameType = ERSPANFrameType((data[10] >> 2) & 0x1f)
+		e.HardwareID = uint8(binary.BigEndian.Uint16(data[10:12])>>4) & 0x3f
+		e.Egress = data[11]&0x08 != 0
+		e.Granularity = ERSPANGranularity((data[11] >> 1) & 0x3)
+		length := 12
+		if data[11]&0x01 != 0 {
+			if len(data) < 20 {
+				df.SetTruncated()
+				return fmt.Errorf("ERSPAN type III platform subheader too short: %d bytes", len(data))
+			}
+			e.PlatformSpecific = data[12:20]
+			length = 20
+		}
+		e.BaseLayer = BaseLayer{Contents: data[:length], Payload: data[length:]}
+	default:
+		return fmt.Errorf("unsupported ERSPAN version %d", e.Version)
+	}
+	return nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+// See the docs for gopacket.SerializableLayer for more info.
+func (e *ERSPAN) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	if e.VLAN > 0xfff {
+		return fmt.Errorf("ERSPAN VLAN %d too large", e.VLAN)
+	}
+	if e.SessionID > 0x3ff {
+		return fmt.Errorf("ERSPAN session ID %d too large", e.SessionID)
+	}
+	var size int
+	switch e.Version {
+	case ERSPANVersionTypeII:
+		size = 8
+	case ERSPANVersionTypeIII:
+		size = 12
+		if e.PlatformSpecific != nil {
+			if len(e.PlatformSpecific) != 8 {
+				return fmt.Errorf("ERSPAN platform specific subheader must be 8 bytes, got %d", len(e.PlatformSpecific))
+			}
+			size = 20
+		}
+	default:
+		return fmt.Errorf("unsupported ERSPAN version %d", e.Version)
+	}
+	bytes, err := b.PrependBytes(size)
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint16(bytes[0:2], uint16(e.Version)<<12|e.VLAN)
+	word := uint16(e.COS&0x7)<<13 | uint16(e.Encapsulation&0x3)<<11 | e.SessionID
+	if e.Truncated {
+		word |= 0x0400
+	}
+	binary.BigEndian.PutUint16(bytes[2:4], word)
+	if e.Version == ERSPANVersionTypeII {
+		binary.BigEndian.PutUint32(bytes[4:8], e.Index&0x000fffff)
+		return nil
+	}
+	binary.BigEndian.PutUint32(bytes[4:8], e.Timestamp)
+	binary.BigEndian.PutUint16(bytes[8:10], e.SGT)
+	word = uint16(e.FrameType&0x1f)<<10 | uint16(e.HardwareID&0x3f)<<4 | uint16(e.Granularity&0x3)<<1
+	if e.PDUFrame {
+		word |= 0x8000
+	}
+	if e.Egress {
+		word |= 0x0008
+	}
+	if e.PlatformSpecific != nil {
+		word |= 0x0001
+		copy(bytes[12:20], e.PlatformSpecific)
+	}
+	binary.BigEndian.PutUint16(bytes[10:12], word)
+	return nil
+}
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (e *ERSPAN) CanDecode() gopacket.LayerClass {
+	return LayerTypeERSPAN
+}
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (e *ERSPAN) NextLayerType() gopacket.LayerType {
+	if e.Version == ERSPANVersionTypeIII && e.FrameType == ERSPANFrameTypeIP {
+		if len(e.Payload) > 0 && e.Payload[0]>>4 == 6 {
+			return LayerTypeIPv6
+		}
+		return LayerTypeIPv4
+	}
+	return LayerTypeEthernet
+}
+
+func decodeERSPAN(data []byte, p gopacket.PacketBuilder) error {
+	e := &ERSPAN{}
+	return decodingLayerDecoder(e, data, p)
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func serializeERSPANTest(t *testing.T, e *ERSPAN, seq bool) []byte {
+	inner := &Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		DstMAC:       net.HardwareAddr{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb},
+		EthernetType: EthernetTypeIPv4,
+	}
+	ip := &IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: IPProtocolICMPv4,
+		SrcIP:    net.IP{10, 0, 0, 1},
+		DstIP:    net.IP{10, 0, 0, 2},
+	}
+	icmp := &ICMPv4{TypeCode: ICMPv4TypeEchoRequest << 8}
+	proto := EthernetTypeERSPAN
+	if e != nil && e.Version == ERSPANVersionTypeIII {
+		proto = EthernetTypeERSPANTypeIII
+	}
+	ls := []gopacket.SerializableLayer{&GRE{SeqPresent: seq, Seq: 7, Protocol: proto}}
+	if e != nil {
+		ls = append(ls, e)
+	}
+	ls = append(ls, inner, ip, icmp)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ls...); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestERSPANTypeII(t *testing.T) {
+	e := &ERSPAN{
+		Version:       ERSPANVersionTypeII,
+		VLAN:          100,
+		COS:           5,
+		Encapsulation: 3,
+		Truncated:     true,
+		SessionID:     0x2aa,
+		Index:         0xabcde,
+	}
+	data := serializeERSPANTest(t, e, true)
+	p := gopacket.NewPacket(data, LayerTypeGRE, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeGRE, LayerTypeERSPAN, LayerTypeEthernet, LayerTypeIPv4, LayerTypeICMPv4}, t)
+	got := p.Layer(LayerTypeERSPAN).(*ERSPAN)
+	want := *e
+	want.BaseLayer = BaseLayer{Contents: data[8:16], Payload: data[16:]}
+	if !reflect.DeepEqual(&want, got) {
+		t.Errorf("ERSPAN mismatch:\nwant %#v\ngot  %#v", &want, got)
+	}
+}
+
+func TestERSPANTypeIII(t *testing.T) {
+	e := &ERSPAN{
+		Version:          ERSPANVersionTypeIII,
+		VLAN:             4094,
+		COS:              1,
+		SessionID:        3,
+		Timestamp:        0xdeadbeef,
+		SGT:              0x1234,
+		PDUFrame:         true,
+		FrameType:        ERSPANFrameTypeEthernet,
+		HardwareID:       0x2d,
+		Egress:           true,
+		Granularity:      ERSPANGranularity100Nanoseconds,
+		PlatformSpecific: []byte{0x0c, 0, 0, 0, 0x01, 0x02, 0x03, 0x04},
+	}
+	data := serializeERSPANTest(t, e, true)
+	p := gopacket.NewPacket(data, LayerTypeGRE, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeGRE, LayerTypeERSPAN, LayerTypeEthernet, LayerTypeIPv4, LayerTypeICMPv4}, t)
+	got := p.Layer(LayerTypeERSPAN).(*ERSPAN)
+	want := *e
+	want.BaseLayer = BaseLayer{Contents: data[8:28], Payload: data[28:]}
+	if !reflect.DeepEqual(&want, got) {
+		t.Errorf("ERSPAN mismatch:\nwant %#v\ngot  %#v", &want, got)
+	}
+}
+
+func TestERSPANTypeI(t *testing.T) {
+	data := serializeERSPANTest(t, nil, false)
+	p := gopacket.NewPacket(data, LayerTypeGRE, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeGRE, LayerTypeEthernet, LayerTypeIPv4, LayerTypeICMPv4}, t)
+}
+
+func TestERSPANTruncated(t *testing.T) {
+	p := gopacket.NewPacket([]byte{0x20, 0x01, 0x00, 0x01, 0, 0, 0, 0, 0, 0}, LayerTypeERSPAN, gopacket.Default)
+	if p.ErrorLayer() == nil {
+		t.Error("expected error decoding short type III header")
+	}
+}
@@ -30,6 +30,66 @@ type Ethernet struct {
 	// former is the case, we set EthernetType and Length stays 0.  In the latter
 	// case, we set Length and EthernetType = EthernetTypeLLC.
 	Length uint16
+	// Padding holds the bytes after the network layer packet, which pad
+	// short frames to the minimum length or are trailers added by some
+	// devices.  They are left out of Payload so upper layers don't mistake
+	// them for data.  Padding is only found for 802.3 frames and for
+	// EtherTypes whose headers give their length, such as IPv4, IPv6 and
+	// ARP.
+	Padding []byte
+}
+
+// Ethernet frame size limits, not counting the FCS.
+const (
+	EthernetMinLength = 60
+	// EthernetMaxLength is the maximum length of an untagged frame.  Each
+	// VLAN tag adds 4 bytes.
+	EthernetMaxLength = 1514
+	// EthernetBabyGiantLength is the maximum length of a baby giant: a frame
+	// a little over the maximum, such as one carrying MPLS labels, that
+	// most switches forward.
+	EthernetBabyGiantLength = 1600
+	// EthernetJumboMaxLength is the maximum length of an untagged jumbo
+	// frame, for a 9000 byte MTU.
+	EthernetJumboMaxLength = 9014
+)
+
+// EthernetGiantLength is the length of the longest untagged frame that
+// decoding doesn't report as a giant.  Set it to EthernetJumboMaxLength when
+// decoding captures from links with jumbo frames.
+var EthernetGiantLength = EthernetMaxLength
+
+// EthernetSizeWarnings says whether decoding reports an EthernetSizeWarning
+// for runt and giant frames.  It is off by default, because the check costs
+// time on every frame and captures are full of runts sent by the capturing
+// host.
+var EthernetSizeWarnings = false
+
+// EthernetSizeWarning is the warning reported when EthernetSizeWarnings is
+// set and a frame is a runt, shorter than EthernetMinLength, or a giant,
+// longer than Max.  Frames captured on the host sending them are often
+// runts, because the NIC pads them later.
+type EthernetSizeWarning struct {
+	Length, Max int
+}
+
+// Runt returns true if the frame was too short, and false if it was too
+// long.
+func (w *EthernetSizeWarning) Runt() bool { return w.Length < EthernetMinLength }
+
+// BabyGiant returns true if the frame was too long, but only by the few
+// bytes that EthernetBabyGiantLength allows for.
+func (w *EthernetSizeWarning) BabyGiant() bool {
+	return w.Length > w.Max && w.Length <= w.Max-EthernetMaxLength+EthernetBabyGiantLength
+}
+
+func (w *EthernetSizeWarning) Error() string {
+	if w.Runt() {
+		return fmt.Sprintf("Ethernet runt frame of %d bytes, minimum %d", w.Length, EthernetMinLength)
+	} else if w.BabyGiant() {
+		return fmt.Sprintf("Ethernet baby giant frame of %d bytes, maximum %d", w.Length, w.Max)
+	}
+	return fmt.Sprintf("Ethernet giant frame of %d bytes, maximum %d", w.Length, w.Max)
 }
 
 // LayerType returns LayerTypeEthernet
@@ -47,6 +107,10 @@ func (eth *Ethernet) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) er
 	eth.SrcMAC = net.HardwareAddr(data[6:12])
 	eth.EthernetType = EthernetType(binary.BigEndian.Uint16(data[12:14]))
 	eth.BaseLayer = BaseLayer{data[:14], data[14:]}
+	eth.Length, eth.Padding = 0, nil
+	if EthernetSizeWarnings {
+		eth.checkSize(data, df)
+	}
 	if eth.EthernetType < 0x0600 {
 		eth.Length = uint16(eth.EthernetType)
 		eth.EthernetType = EthernetTypeLLC
@@ -54,13 +118,73 @@ func (eth *Ethernet) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) er
 			df.SetTruncated()
 		} else if cmp > 0 {
 			// Strip off bytes at the end, since we have too many bytes
-			eth.Payload = eth.Payload[:len(eth.Payload)-cmp]
+			eth.Padding = eth.Payload[eth.Length:]
+			eth.Payload = eth.Payload[:eth.Length]
 		}
-		//	fmt.Println(eth)
+	} else if n, ok := ethernetPayloadLength(eth.EthernetType, eth.Payload); ok && n < len(eth.Payload) {
+		eth.Padding = eth.Payload[n:]
+		eth.Payload = eth.Payload[:n]
 	}
 	return nil
 }
 
+// checkSize reports an EthernetSizeWarning if the frame in data is a runt
+// or a giant, and df collects warnings.
+func (eth *Ethernet) checkSize(data []byte, df gopacket.DecodeFeedback) {
+	if _, ok := df.(gopacket.WarningFeedback); !ok {
+		return
+	}
+	max := EthernetGiantLength
+	for t, b := eth.EthernetType, eth.Payload; (t == EthernetTypeDot1Q || t == EthernetTypeQinQ) && len(b) >= 4; b = b[4:] {
+		max += 4
+		t = EthernetType(binary.BigEndian.Uint16(b[2:4]))
+	}
+	if len(data) < EthernetMinLength || len(data) > max {
+		gopacket.AddWarning(df, &EthernetSizeWarning{Length: len(data), Max: max})
+	}
+}
+
+// ethernetPayloadLength returns the length of the packet of type t at the
+// start of b, if its header gives it.
+func ethernetPayloadLength(t EthernetType, b []byte) (int, bool) {
+	switch t {
+	case EthernetTypeDot1Q, EthernetTypeQinQ:
+		if len(b) < 4 {
+			return 0, false
+		}
+		inner := EthernetType(binary.BigEndian.Uint16(b[2:4]))
+		if inner < 0x0600 {
+			return 4 + int(inner), true
+		}
+		n, ok := ethernetPayloadLength(inner, b[4:])
+		return 4 + n, ok
+	case EthernetTypeIPv4:
+		if len(b) < 4 || b[0]>>4 != 4 {
+			return 0, false
+		}
+		n := int(binary.BigEndian.Uint16(b[2:4]))
+		return n, n >= 20
+	case EthernetTypeIPv6:
+		// A zero payload length is a jumbogram, whose length is in a
+		// hop-by-hop option.
+		if len(b) < 6 || b[0]>>4 != 6 || binary.BigEndian.Uint16(b[4:6]) == 0 {
+			return 0, false
+		}
+		return 40 + int(binary.BigEndian.Uint16(b[4:6])), true
+	case EthernetTypeARP:
+		if len(b) < 6 {
+			return 0, false
+		}
+		return 8 + 2*int(b[4]) + 2*int(b[5]), true
+	case EthernetTypeEAPOL, EthernetTypeRSNPreAuth:
+		if len(b) < 4 {
+			return 0, false
+		}
+		return 4 + int(binary.BigEndian.Uint16(b[2:4])), true
+	}
+	return 0, false
+}
+
 // SerializeTo writes the serialized form of this layer into the
 // SerializationBuffer, implementing gopacket.SerializableLayer.
 // See the docs for gopacket.SerializableLayer for more info.
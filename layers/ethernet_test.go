@@ -0,0 +1,139 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// ethernetFrame serializes the given layers behind an Ethernet header,
+// which pads the frame to the minimum length.
+func ethernetFrame(t *testing.T, typ EthernetType, ls ...gopacket.SerializableLayer) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	eth := &Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{0, 1, 2, 3, 4, 6}, EthernetType: typ}
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, append([]gopacket.SerializableLayer{eth}, ls...)...); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEthernetPadding(t *testing.T) {
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &UDP{SrcPort: 1000, DstPort: 2000}
+	udp.SetNetworkLayerForChecksum(ip)
+	data := ethernetFrame(t, EthernetTypeIPv4, ip, udp, gopacket.Payload("hi"))
+	// Pad with non-zero bytes, as some devices do.
+	for i := 14 + 20 + 8 + 2; i < len(data); i++ {
+		data[i] = 0xee
+	}
+	p := gopacket.NewPacket(data, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	eth := p.Layer(LayerTypeEthernet).(*Ethernet)
+	if len(eth.Padding) != 16 || eth.Padding[0] != 0xee {
+		t.Errorf("got padding %x", eth.Padding)
+	}
+	if got := p.ApplicationLayer().Payload(); !bytes.Equal(got, []byte("hi")) {
+		t.Errorf("got payload %q", got)
+	}
+	if len(p.Metadata().Warnings) != 0 {
+		t.Errorf("got warnings %v", p.Metadata().Warnings)
+	}
+
+	data = ethernetFrame(t, EthernetTypeDot1Q, &Dot1Q{VLANIdentifier: 10, Type: EthernetTypeARP}, &ARP{
+		AddrType:          LinkTypeEthernet,
+		Protocol:          EthernetTypeIPv4,
+		Operation:         1,
+		SourceHwAddress:   []byte{0, 1, 2, 3, 4, 5},
+		SourceProtAddress: []byte{10, 0, 0, 1},
+		DstHwAddress:      []byte{0, 0, 0, 0, 0, 0},
+		DstProtAddress:    []byte{10, 0, 0, 2},
+	})
+	p = gopacket.NewPacket(data, LinkTypeEthernet, gopacket.Default)
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeDot1Q, LayerTypeARP}, t)
+	if eth := p.Layer(LayerTypeEthernet).(*Ethernet); len(eth.Padding) != 14 {
+		t.Errorf("got padding %x", eth.Padding)
+	}
+}
+
+func TestEthernetSizeWarnings(t *testing.T) {
+	runt := ethernetFrame(t, EthernetTypeARP)[:42]
+	giant := ethernetFrame(t, EthernetTypeIPv4, gopacket.Payload(make([]byte, 1504)))
+	tagged := ethernetFrame(t, EthernetTypeDot1Q, &Dot1Q{Type: EthernetTypeIPv4}, gopacket.Payload(make([]byte, 1500)))
+
+	// Size warnings are off by default.
+	if ws := gopacket.NewPacket(runt, LinkTypeEthernet, gopacket.Default).Metadata().Warnings; len(ws) != 0 {
+		t.Errorf("got warnings %v with size warnings off", ws)
+	}
+	defer func(on bool) { EthernetSizeWarnings = on }(EthernetSizeWarnings)
+	EthernetSizeWarnings = true
+	for _, test := range []struct {
+		name string
+		data []byte
+		runt bool
+		ok   bool
+	}{
+		{"runt", runt, true, false},
+		{"giant", giant, false, false},
+		{"tagged", tagged, false, true},
+	} {
+		p := gopacket.NewPacket(test.data, LinkTypeEthernet, gopacket.Lazy)
+		p.Layer(LayerTypeEthernet)
+		ws := p.Metadata().Warnings
+		if test.ok {
+			if len(ws) != 0 {
+				t.Errorf("%s: got warnings %v", test.name, ws)
+			}
+			continue
+		}
+		if len(ws) != 1 {
+			t.Fatalf("%s: got warnings %v", test.name, ws)
+		}
+		if w, ok := ws[0].(*EthernetSizeWarning); !ok || w.Runt() != test.runt || w.Length != len(test.data) {
+			t.Errorf("%s: got warning %v", test.name, ws[0])
+		}
+	}
+
+	var eth Ethernet
+	parser := gopacket.NewDecodingLayerParser(LayerTypeEthernet, &eth)
+	var decoded []gopacket.LayerType
+	parser.DecodeLayers(giant, &decoded)
+	if len(parser.Warnings) != 1 {
+		t.Errorf("got parser warnings %v", parser.Warnings)
+	}
+	parser.DecodeLayers(tagged, &decoded)
+	if len(parser.Warnings) != 0 {
+		t.Errorf("warnings not reset: %v", parser.Warnings)
+	}
+}
+
+func TestEthernetJumbo(t *testing.T) {
+	defer func(on bool) { EthernetSizeWarnings = on }(EthernetSizeWarnings)
+	EthernetSizeWarnings = true
+	babyGiant := ethernetFrame(t, EthernetTypeIPv4, gopacket.Payload(make([]byte, 1530)))
+	jumbo := ethernetFrame(t, EthernetTypeIPv4, gopacket.Payload(make([]byte, 9000)))
+	p := gopacket.NewPacket(babyGiant, LinkTypeEthernet, gopacket.Default)
+	if ws := p.Metadata().Warnings; len(ws) != 1 || !ws[0].(*EthernetSizeWarning).BabyGiant() {
+		t.Errorf("got warnings %v", ws)
+	}
+	p = gopacket.NewPacket(jumbo, LinkTypeEthernet, gopacket.Default)
+	if ws := p.Metadata().Warnings; len(ws) != 1 || ws[0].(*EthernetSizeWarning).BabyGiant() {
+		t.Errorf("got warnings %v", ws)
+	}
+
+	defer func(l int) { EthernetGiantLength = l }(EthernetGiantLength)
+	EthernetGiantLength = EthernetJumboMaxLength
+	p = gopacket.NewPacket(jumbo, LinkTypeEthernet, gopacket.Default)
+	if ws := p.Metadata().Warnings; len(ws) != 0 {
+		t.Errorf("got warnings %v", ws)
+	}
+}
@@ -8,21 +8,60 @@ package layers
 
 import (
 	"encoding/binary"
+	"fmt"
 
 	"github.com/mistsys/gopacket"
 )
 
-// GRE is a Generic Routing Encapsulation header.
+// GRE is a Generic Routing Encapsulation header, as described in RFC 1701,
+// RFC 2784 and RFC 2890.  Version 1 headers (the enhanced GRE used by PPTP,
+// RFC 2637) may also carry an acknowledgment number.
+//
+// Checksum, Offset, Key, Seq and Ack are only meaningful if the matching
+// Present flag is set; they're zeroed on decode otherwise.
 type GRE struct {
 	BaseLayer
 	ChecksumPresent, RoutingPresent, KeyPresent, SeqPresent, StrictSourceRoute bool
-	RecursionControl, Flags, Version                                           uint8
-	Protocol                                                                   EthernetType
-	Checksum, Offset                                                           uint16
-	Key, Seq                                                                   uint32
+	// AckPresent is only valid for version 1 headers.  It is decoded from,
+	// and serialized into, the high bit of Flags.
+	AckPresent                       bool
+	RecursionControl, Flags, Version uint8
+	Protocol                         EthernetType
+	Checksum, Offset                 uint16
+	Key, Seq, Ack                    uint32
 	*GRERouting
 }
 
+// greAckFlag is the version 1 acknowledgment present bit within GRE.Flags.
+const greAckFlag = 0x10
+
+// VSID returns the 24-bit virtual subnet ID of an NVGRE (RFC 7637) header,
+// which is carried in the top bits of the key field.
+func (g *GRE) VSID() uint32 {
+	return g.Key >> 8
+}
+
+// FlowID returns the 8-bit flow ID of an NVGRE (RFC 7637) header, which is
+// carried in the low bits of the key field.
+func (g *GRE) FlowID() uint8 {
+	return uint8(g.Key)
+}
+
+// IsNVGRE returns true if the header looks like NVGRE: a version 0 header
+// with a key, carrying transparent Ethernet bridging.
+func (g *GRE) IsNVGRE() bool {
+	return g.Version == 0 && g.KeyPresent && !g.ChecksumPresent && !g.RoutingPresent &&
+		g.Protocol == EthernetTypeTransparentEthernetBridging
+}
+
+// SetNVGRE sets the key field to carry the given NVGRE virtual subnet and
+// flow IDs, and sets the flags and protocol NVGRE requires.
+func (g *GRE) SetNVGRE(vsid uint32, flowID uint8) {
+	g.KeyPresent = true
+	g.Key = vsid<<8 | uint32(flowID)
+	g.Protocol = EthernetTypeTransparentEthernetBridging
+}
+
 // GRERouting is GRE routing information, present if the RoutingPresent flag is
 // set.
 type GRERouting struct {
@@ -37,6 +76,10 @@ func (g *GRE) LayerType() gopacket.LayerType { return LayerTypeGRE }
 
 // DecodeFromBytes decodes the given bytes into this layer.
 func (g *GRE) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return fmt.Errorf("GRE header too short: %d bytes", len(data))
+	}
 	g.ChecksumPresent = data[0]&0x80 != 0
 	g.RoutingPresent = data[0]&0x40 != 0
 	g.KeyPresent = data[0]&0x20 != 0
@@ -45,7 +88,27 @@ func (g *GRE) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
 	g.RecursionControl = data[0] & 0x7
 	g.Flags = data[1] >> 3
 	g.Version = data[1] & 0x7
+	g.AckPresent = g.Version == 1 && g.Flags&greAckFlag != 0
 	g.Protocol = EthernetType(binary.BigEndian.Uint16(data[2:4]))
+	g.Checksum, g.Offset, g.Key, g.Seq, g.Ack = 0, 0, 0, 0, 0
+	g.GRERouting = nil
+	size := 4
+	if g.ChecksumPresent || g.RoutingPresent {
+		size += 4
+	}
+	if g.KeyPresent {
+		size += 4
+	}
+	if g.SeqPresent {
+		size += 4
+	}
+	if g.AckPresent {
+		size += 4
+	}
+	if len(data) < size {
+		df.SetTruncated()
+		return fmt.Errorf("GRE header too short for its flags: %d bytes, want %d", len(data), size)
+	}
 	offset := 4
 	if g.ChecksumPresent || g.RoutingPresent {
 		g.Checksum = binary.BigEndian.Uint16(data[offset : offset+2])
@@ -60,14 +123,26 @@ func (g *GRE) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
 		g.Seq = binary.BigEndian.Uint32(data[offset : offset+4])
 		offset += 4
 	}
+	if g.AckPresent {
+		g.Ack = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
 	if g.RoutingPresent {
 		tail := &g.GRERouting
 		for {
+			if len(data) < offset+4 {
+				df.SetTruncated()
+				return fmt.Errorf("GRE routing entry truncated")
+			}
 			sre := &GRERouting{
 				AddressFamily: binary.BigEndian.Uint16(data[offset : offset+2]),
 				SREOffset:     data[offset+2],
 				SRELength:     data[offset+3],
 			}
+			if len(data) < offset+4+int(sre.SRELength) {
+				df.SetTruncated()
+				return fmt.Errorf("GRE routing information truncated")
+			}
 			sre.RoutingInformation = data[offset+4 : offset+4+int(sre.SRELength)]
 			offset += 4 + int(sre.SRELength)
 			if sre.AddressFamily == 0 && sre.SRELength == 0 {
@@ -81,6 +156,18 @@ func (g *GRE) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
 	return nil
 }
 
+// VerifyChecksum checks the GRE checksum, which covers the GRE header and
+// its payload.  It returns true if no checksum is present.
+func (g *GRE) VerifyChecksum() bool {
+	if !g.ChecksumPresent {
+		return true
+	}
+	data := make([]byte, 0, len(g.Contents)+len(g.Payload))
+	data = append(data, g.Contents...)
+	data = append(data, g.Payload...)
+	return tcpipChecksum(data, 0) == 0
+}
+
 // SerializeTo writes the serialized form of this layer into the SerializationBuffer,
 // implementing gopacket.SerializableLayer. See the docs for gopacket.SerializableLayer for more info.
 func (g *GRE) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
@@ -94,6 +181,12 @@ func (g *GRE) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOpt
 	if g.SeqPresent {
 		size += 4
 	}
+	if g.AckPresent {
+		if g.Version != 1 {
+			return fmt.Errorf("GRE acknowledgment number requires version 1, got %d", g.Version)
+		}
+		size += 4
+	}
 	if g.RoutingPresent {
 		r := g.GRERouting
 		for r != nil {
@@ -124,9 +217,16 @@ func (g *GRE) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOpt
 	if g.StrictSourceRoute {
 		buf[0] |= 0x08
 	}
-	buf[0] |= g.RecursionControl
-	buf[1] |= g.Flags << 3
-	buf[1] |= g.Version
+	buf[0] |= g.RecursionControl & 0x7
+	flags := g.Flags
+	if g.Version == 1 {
+		flags &^= greAckFlag
+		if g.AckPresent {
+			flags |= greAckFlag
+		}
+	}
+	buf[1] |= flags << 3
+	buf[1] |= g.Version & 0x7
 	binary.BigEndian.PutUint16(buf[2:4], uint16(g.Protocol))
 	offset := 4
 	if g.ChecksumPresent || g.RoutingPresent {
@@ -146,6 +246,10 @@ func (g *GRE) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOpt
 		binary.BigEndian.PutUint32(buf[offset:offset+4], g.Seq)
 		offset += 4
 	}
+	if g.AckPresent {
+		binary.BigEndian.PutUint32(buf[offset:offset+4], g.Ack)
+		offset += 4
+	}
 	if g.RoutingPresent {
 		sre := g.GRERouting
 		for sre != nil {
@@ -176,6 +280,11 @@ func (g *GRE) CanDecode() gopacket.LayerClass {
 
 // NextLayerType returns the layer type contained by this DecodingLayer.
 func (g *GRE) NextLayerType() gopacket.LayerType {
+	if g.Protocol == EthernetTypeERSPAN && !g.SeqPresent {
+		// ERSPAN type I has no ERSPAN header and is told apart from type II
+		// only by the absence of a sequence number.
+		return LayerTypeEthernet
+	}
 	return g.Protocol.LayerType()
 }
 
@@ -6,6 +6,7 @@
 package layers
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"reflect"
@@ -387,3 +388,74 @@ func setNetworkLayer(layers []gopacket.SerializableLayer) error {
 	}
 	return nil
 }
+
+func TestGREOptionalFieldsRoundTrip(t *testing.T) {
+	for _, g := range []*GRE{
+		{ChecksumPresent: true, KeyPresent: true, SeqPresent: true, Protocol: EthernetTypeIPv4, Key: 0xdeadbeef, Seq: 42},
+		{KeyPresent: true, SeqPresent: true, AckPresent: true, Version: 1, Protocol: 0x880b, Key: 0x00100007, Seq: 1, Ack: 9},
+		{SeqPresent: true, Protocol: EthernetTypeIPv6, Seq: 0xffffffff},
+	} {
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{ComputeChecksums: true}
+		if err := gopacket.SerializeLayers(buf, opts, g, gopacket.Payload{1, 2, 3, 4, 5}); err != nil {
+			t.Fatal(err)
+		}
+		var got GRE
+		if err := got.DecodeFromBytes(buf.Bytes(), gopacket.NilDecodeFeedback); err != nil {
+			t.Fatal(err)
+		}
+		if !got.VerifyChecksum() {
+			t.Errorf("checksum of %+v does not verify", got)
+		}
+		want := *g
+		want.Checksum = got.Checksum
+		want.BaseLayer = got.BaseLayer
+		if want.AckPresent {
+			want.Flags = greAckFlag
+		}
+		if !reflect.DeepEqual(&want, &got) {
+			t.Errorf("round trip mismatch:\nwant %#v\ngot  %#v", &want, &got)
+		}
+		if !bytes.Equal(got.Payload, []byte{1, 2, 3, 4, 5}) {
+			t.Errorf("payload mismatch: %v", got.Payload)
+		}
+	}
+}
+
+func TestGRENVGRE(t *testing.T) {
+	g := &GRE{}
+	g.SetNVGRE(0xabcdef, 0x12)
+	buf := gopacket.NewSerializeBuffer()
+	inner := &Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{6, 7, 8, 9, 10, 11},
+		EthernetType: EthernetTypeIPv4,
+	}
+	ip := &IPv4{Version: 4, TTL: 64, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}, Protocol: IPProtocolUDP}
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	if err := gopacket.SerializeLayers(buf, opts, g, inner, ip); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x20, 0x00, 0x65, 0x58, 0xab, 0xcd, 0xef, 0x12}; !bytes.Equal(buf.Bytes()[:8], want) {
+		t.Errorf("NVGRE header: got %x want %x", buf.Bytes()[:8], want)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeGRE, gopacket.Default)
+	checkLayers(p, []gopacket.LayerType{LayerTypeGRE, LayerTypeEthernet, LayerTypeIPv4}, t)
+	got := p.Layer(LayerTypeGRE).(*GRE)
+	if !got.IsNVGRE() || got.VSID() != 0xabcdef || got.FlowID() != 0x12 {
+		t.Errorf("NVGRE fields wrong: %+v", got)
+	}
+}
+
+func TestGRETruncated(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x00, 0x00},
+		{0xb0, 0x00, 0x08, 0x00, 0, 0, 0, 0, 0, 0, 0, 0},
+		{0x40, 0x00, 0x08, 0x00, 0, 0, 0, 0, 0, 0x01, 0, 8, 1, 2},
+	} {
+		var g GRE
+		if err := g.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("expected error decoding %x", data)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+const gtpMinimumSizeInBytes int = 8
+
+// GTPMessageTypeGPDU is the GTPv1-U message type for user data (a G-PDU),
+// whose payload is the subscriber's IP packet.
+const GTPMessageTypeGPDU uint8 = 255
+
+// GTPExtensionHeader is a GTPv1 extension header.  Content excludes the
+// length and next extension header type octets.
+type GTPExtensionHeader struct {
+	Type    uint8
+	Content []byte
+}
+
+// GTPv1U is the GTP-U header of 3GPP TS 29.281, carrying user plane
+// traffic between mobile core nodes over UDP port 2152.
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|Ver  |P|R|E|S|N| Message Type  |            Length             |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                 Tunnel Endpoint Identifier                    |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|        Sequence Number        |    N-PDU      |  Next Ext Hdr |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//
+// The last word is only present if any of E, S or N is set.
+type GTPv1U struct {
+	BaseLayer
+	Version             uint8
+	ProtocolType        uint8
+	Reserved            uint8
+	ExtensionHeaderFlag bool
+	SequenceNumberFlag  bool
+	NPDUFlag            bool
+	MessageType         uint8
+	// MessageLength is the length of everything after the first 8 bytes,
+	// including any optional fields and extension headers.
+	MessageLength    uint16
+	TEID             uint32
+	SequenceNumber   uint16
+	NPDU             uint8
+	ExtensionHeaders []GTPExtensionHeader
+}
+
+// LayerType returns LayerTypeGTPv1U.
+func (g *GTPv1U) LayerType() gopacket.LayerType { return LayerTypeGTPv1U }
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (g *GTPv1U) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < gtpMinimumSizeInBytes {
+		df.SetTruncated()
+		return fmt.Errorf("GTP packet too small: %d bytes", len(data))
+	}
+	g.Version = data[0] >> 5
+	if g.Version != 1 {
+		return fmt.Errorf("GTP version %d is not GTPv1", g.Version)
+	}
+	g.ProtocolType = (data[0] >> 4) & 1
+	g.Reserved = (data[0] >> 3) & 1
+	g.ExtensionHeaderFlag = data[0]&0x04 != 0
+	g.SequenceNumberFlag = data[0]&0x02 != 0
+	g.NPDUFlag = data[0]&0x01 != 0
+	g.MessageType = data[1]
+	g.MessageLength = binary.BigEndian.Uint16(data[2:4])
+	g.TEID = binary.BigEndian.Uint32(data[4:8])
+	g.SequenceNumber, g.NPDU = 0, 0
+	g.ExtensionHeaders = g.ExtensionHeaders[:0]
+	if len(data) < gtpMinimumSizeInBytes+int(g.MessageLength) {
+		df.SetTruncated()
+		return fmt.Errorf("GTP packet too small: %d bytes, header claims %d", len(data), gtpMinimumSizeInBytes+int(g.MessageLength))
+	}
+	length := gtpMinimumSizeInBytes
+	if g.ExtensionHeaderFlag || g.SequenceNumberFlag || g.NPDUFlag {
+		if g.MessageLength < 4 {
+			return fmt.Errorf("GTP message length %d too short for optional fields", g.MessageLength)
+		}
+		g.SequenceNumber = binary.BigEndian.Uint16(data[8:10])
+		g.NPDU = data[10]
+		next := data[11]
+		length += 4
+		if g.ExtensionHeaderFlag {
+			// Each extension header's length is in units of 4 bytes and
+			// includes the length and next type octets.
+			for next != 0 {
+				if len(data) < length+1 {
+					df.SetTruncated()
+					return fmt.Errorf("GTP extension header truncated")
+				}
+				extLen := int(data[length]) * 4
+				if extLen == 0 {
+					return fmt.Errorf("GTP extension header with zero length")
+				}
+				if len(data) < length+extLen {
+					df.SetTruncated()
+					return fmt.Errorf("GTP extension header truncated")
+				}
+				g.ExtensionHeaders = append(g.ExtensionHeaders, GTPExtensionHeader{
+					Type:    next,
+					Content: data[length+1 : length+extLen-1],
+				})
+				next = data[length+extLen-1]
+				length += extLen
+			}
+		}
+	}
+	if length > gtpMinimumSizeInBytes+int(g.MessageLength) {
+		return fmt.Errorf("GTP extension headers overrun message length %d", g.MessageLength)
+	}
+	g.BaseLayer = BaseLayer{Contents: data[:length], Payload: data[length : gtpMinimumSizeInBytes+int(g.MessageLength)]}
+	return nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+// See the docs for gopacket.SerializableLayer for more info.
+func (g *GTPv1U) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	size := gtpMinimumSizeInBytes
+	optional := g.ExtensionHeaderFlag || g.SequenceNumberFlag || g.NPDUFlag || len(g.ExtensionHeaders) > 0
+	if optional {
+		size += 4
+	}
+	for _, eh := range g.ExtensionHeaders {
+		if (len(eh.Content)+2)%4 != 0 {
+			return fmt.Errorf("GTP extension header content length %d must be 2 less than a multiple of 4", len(eh.Content))
+		}
+		size += len(eh.Content) + 2
+	}
+	payloadLen := len(b.Bytes())
+	data, err := b.PrependBytes(size)
+	if err != nil {
+		return err
+	}
+	data[0] = 1<<5 | (g.ProtocolType&1)<<4 | (g.Reserved&1)<<3
+	if g.ExtensionHeaderFlag || len(g.ExtensionHeaders) > 0 {
+		data[0] |= 0x04
+	}
+	if g.SequenceNumberFlag {
+		data[0] |= 0x02
+	}
+	if g.NPDUFlag {
+		data[0] |= 0x01
+	}
+	data[1] = g.MessageType
+	if opts.FixLengths {
+		g.MessageLength = uint16(size - gtpMinimumSizeInBytes + payloadLen)
+	}
+	binary.BigEndian.PutUint16(data[2:4], g.MessageLength)
+	binary.BigEndian.PutUint32(data[4:8], g.TEID)
+	if optional {
+		binary.BigEndian.PutUint16(data[8:10], g.SequenceNumber)
+		data[10] = g.NPDU
+		data[11] = 0
+		offset := 12
+		for i, eh := range g.ExtensionHeaders {
+			data[offset-1] = eh.Type
+			data[offset] = uint8((len(eh.Content) + 2) / 4)
+			copy(data[offset+1:], eh.Content)
+			offset += len(eh.Content) + 2
+			if i == len(g.ExtensionHeaders)-1 {
+				data[offset-1] = 0
+			}
+		}
+	}
+	return nil
+}
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (g *GTPv1U) CanDecode() gopacket.LayerClass {
+	return LayerTypeGTPv1U
+}
+
+// NextLayerType returns the layer type contained by this DecodingLayer.  The
+// payload of a G-PDU is an IPv4 or IPv6 packet; other message types carry
+// signalling that isn't decoded further.
+func (g *GTPv1U) NextLayerType() gopacket.LayerType {
+	if g.MessageType != GTPMessageTypeGPDU || len(g.Payload) == 0 {
+		return gopacket.LayerTypePayload
+	}
+	switch g.Payload[0] >> 4 {
+	case 4:
+		return LayerTypeIPv4
+	case 6:
+		return LayerTypeIPv6
+	}
+	return gopacket.LayerTypePayload
+}
+
+func decodeGTPv1u(data []byte, p gopacket.PacketBuilder) error {
+	g := &GTPv1U{}
+	return decodingLayerDecoder(g, data, p)
+}
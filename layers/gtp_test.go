@@ -0,0 +1,123 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testGTPv1UHeader is a G-PDU header with a sequence number and a PDU
+// session container extension header (QFI 9), as sent on the 5G N3
+// interface.
+var testGTPv1UHeader = []byte{
+	0x36, 0xff, 0x00, 0x00, // flags E+S, G-PDU, length filled in by test
+	0x00, 0x00, 0x00, 0x2a, // TEID 42
+	0x12, 0x34, 0x00, 0x85, // sequence, N-PDU, next: PDU session container
+	0x01, 0x10, 0x09, 0x00, // length 1, PDU type UL, QFI 9, no more headers
+}
+
+func testGTPInnerIPv4(t *testing.T) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	ip := &IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: IPProtocolICMPv4,
+		SrcIP:    net.IP{10, 45, 0, 2},
+		DstIP:    net.IP{8, 8, 8, 8},
+	}
+	if err := gopacket.SerializeLayers(buf, opts, ip, &ICMPv4{TypeCode: CreateICMPv4TypeCode(ICMPv4TypeEchoRequest, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGTPv1UDecode(t *testing.T) {
+	inner := testGTPInnerIPv4(t)
+	data := append(append([]byte(nil), testGTPv1UHeader...), inner...)
+	data[3] = byte(len(data) - 8)
+	p := gopacket.NewPacket(data, LayerTypeGTPv1U, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeGTPv1U, LayerTypeIPv4, LayerTypeICMPv4}, t)
+	got := p.Layer(LayerTypeGTPv1U).(*GTPv1U)
+	want := &GTPv1U{
+		BaseLayer:           BaseLayer{Contents: data[:16], Payload: data[16:]},
+		Version:             1,
+		ProtocolType:        1,
+		ExtensionHeaderFlag: true,
+		SequenceNumberFlag:  true,
+		MessageType:         GTPMessageTypeGPDU,
+		MessageLength:       uint16(len(data) - 8),
+		TEID:                42,
+		SequenceNumber:      0x1234,
+		ExtensionHeaders:    []GTPExtensionHeader{{Type: 0x85, Content: []byte{0x10, 0x09}}},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("GTP mismatch:\nwant %#v\ngot  %#v", want, got)
+	}
+}
+
+func TestGTPv1UOverUDP(t *testing.T) {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	udp := &UDP{SrcPort: 2152, DstPort: 2152}
+	gtp := &GTPv1U{ProtocolType: 1, MessageType: GTPMessageTypeGPDU, TEID: 0x1000}
+	if err := gopacket.SerializeLayers(buf, opts, udp, gtp, gopacket.Payload(testGTPInnerIPv4(t))); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeUDP, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeUDP, LayerTypeGTPv1U, LayerTypeIPv4, LayerTypeICMPv4}, t)
+	if got := p.Layer(LayerTypeGTPv1U).(*GTPv1U); got.TEID != 0x1000 || got.MessageLength != 28 {
+		t.Errorf("bad GTP header %+v", got)
+	}
+}
+
+func TestGTPv1USerializeExtensionHeaders(t *testing.T) {
+	inner := testGTPInnerIPv4(t)
+	buf := gopacket.NewSerializeBuffer()
+	gtp := &GTPv1U{
+		ProtocolType:       1,
+		SequenceNumberFlag: true,
+		MessageType:        GTPMessageTypeGPDU,
+		TEID:               42,
+		SequenceNumber:     0x1234,
+		ExtensionHeaders:   []GTPExtensionHeader{{Type: 0x85, Content: []byte{0x10, 0x09}}},
+	}
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, gtp, gopacket.Payload(inner)); err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]byte(nil), testGTPv1UHeader...), inner...)
+	want[3] = byte(len(want) - 8)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("serialization mismatch:\nwant %x\ngot  %x", want, buf.Bytes())
+	}
+}
+
+func TestGTPv1UMalformed(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x30, 0xff, 0x00},
+		{0x50, 0xff, 0x00, 0x00, 0, 0, 0, 1},                            // version 2
+		{0x30, 0xff, 0x00, 0x10, 0, 0, 0, 1},                            // length overruns
+		{0x34, 0xff, 0x00, 0x04, 0, 0, 0, 1, 0, 0, 0, 0x85},             // extension missing
+		{0x34, 0xff, 0x00, 0x08, 0, 0, 0, 1, 0, 0, 0, 0x85, 0, 0, 0, 0}, // zero length extension
+	} {
+		var g GTPv1U
+		if err := g.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("expected error decoding %x", data)
+		}
+	}
+}
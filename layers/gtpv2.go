@@ -0,0 +1,433 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mistsys/gopacket"
+)
+
+// GTPv2MessageType is the message type of a GTPv2-C header.
+type GTPv2MessageType uint8
+
+const (
+	GTPv2MessageTypeEchoRequest                  GTPv2MessageType = 1
+	GTPv2MessageTypeEchoResponse                 GTPv2MessageType = 2
+	GTPv2MessageTypeVersionNotSupported          GTPv2MessageType = 3
+	GTPv2MessageTypeCreateSessionRequest         GTPv2MessageType = 32
+	GTPv2MessageTypeCreateSessionResponse        GTPv2MessageType = 33
+	GTPv2MessageTypeModifyBearerRequest          GTPv2MessageType = 34
+	GTPv2MessageTypeModifyBearerResponse         GTPv2MessageType = 35
+	GTPv2MessageTypeDeleteSessionRequest         GTPv2MessageType = 36
+	GTPv2MessageTypeDeleteSessionResponse        GTPv2MessageType = 37
+	GTPv2MessageTypeCreateBearerRequest          GTPv2MessageType = 95
+	GTPv2MessageTypeCreateBearerResponse         GTPv2MessageType = 96
+	GTPv2MessageTypeUpdateBearerRequest          GTPv2MessageType = 97
+	GTPv2MessageTypeUpdateBearerResponse         GTPv2MessageType = 98
+	GTPv2MessageTypeDeleteBearerRequest          GTPv2MessageType = 99
+	GTPv2MessageTypeDeleteBearerResponse         GTPv2MessageType = 100
+	GTPv2MessageTypeReleaseAccessBearersRequest  GTPv2MessageType = 170
+	GTPv2MessageTypeReleaseAccessBearersResponse GTPv2MessageType = 171
+	GTPv2MessageTypeDownlinkDataNotification     GTPv2MessageType = 176
+	GTPv2MessageTypeDownlinkDataNotificationAck  GTPv2MessageType = 177
+	GTPv2MessageTypeModifyAccessBearersRequest   GTPv2MessageType = 211
+	GTPv2MessageTypeModifyAccessBearersResponse  GTPv2MessageType = 212
+)
+
+func (t GTPv2MessageType) String() string {
+	switch t {
+	case GTPv2MessageTypeEchoRequest:
+		return "EchoRequest"
+	case GTPv2MessageTypeEchoResponse:
+		return "EchoResponse"
+	case GTPv2MessageTypeVersionNotSupported:
+		return "VersionNotSupported"
+	case GTPv2MessageTypeCreateSessionRequest:
+		return "CreateSessionRequest"
+	case GTPv2MessageTypeCreateSessionResponse:
+		return "CreateSessionResponse"
+	case GTPv2MessageTypeModifyBearerRequest:
+		return "ModifyBearerRequest"
+	case GTPv2MessageTypeModifyBearerResponse:
+		return "ModifyBearerResponse"
+	case GTPv2MessageTypeDeleteSessionRequest:
+		return "DeleteSessionRequest"
+	case GTPv2MessageTypeDeleteSessionResponse:
+		return "DeleteSessionResponse"
+	case GTPv2MessageTypeCreateBearerRequest:
+		return "CreateBearerRequest"
+	case GTPv2MessageTypeCreateBearerResponse:
+		return "CreateBearerResponse"
+	case GTPv2MessageTypeUpdateBearerRequest:
+		return "UpdateBearerRequest"
+	case GTPv2MessageTypeUpdateBearerResponse:
+		return "UpdateBearerResponse"
+	case GTPv2MessageTypeDeleteBearerRequest:
+		return "DeleteBearerRequest"
+	case GTPv2MessageTypeDeleteBearerResponse:
+		return "DeleteBearerResponse"
+	case GTPv2MessageTypeReleaseAccessBearersRequest:
+		return "ReleaseAccessBearersRequest"
+	case GTPv2MessageTypeReleaseAccessBearersResponse:
+		return "ReleaseAccessBearersResponse"
+	case GTPv2MessageTypeDownlinkDataNotification:
+		return "DownlinkDataNotification"
+	case GTPv2MessageTypeDownlinkDataNotificationAck:
+		return "DownlinkDataNotificationAck"
+	case GTPv2MessageTypeModifyAccessBearersRequest:
+		return "ModifyAccessBearersRequest"
+	case GTPv2MessageTypeModifyAccessBearersResponse:
+		return "ModifyAccessBearersResponse"
+	}
+	return fmt.Sprintf("UnknownGTPv2MessageType(%d)", uint8(t))
+}
+
+// GTPv2IEType is the type of a GTPv2-C information element.
+type GTPv2IEType uint8
+
+const (
+	GTPv2IETypeIMSI             GTPv2IEType = 1
+	GTPv2IETypeCause            GTPv2IEType = 2
+	GTPv2IETypeRecovery         GTPv2IEType = 3
+	GTPv2IETypeAPN              GTPv2IEType = 71
+	GTPv2IETypeAMBR             GTPv2IEType = 72
+	GTPv2IETypeEBI              GTPv2IEType = 73
+	GTPv2IETypeMEI              GTPv2IEType = 75
+	GTPv2IETypeMSISDN           GTPv2IEType = 76
+	GTPv2IETypeIndication       GTPv2IEType = 77
+	GTPv2IETypePAA              GTPv2IEType = 79
+	GTPv2IETypeBearerQoS        GTPv2IEType = 80
+	GTPv2IETypeRATType          GTPv2IEType = 82
+	GTPv2IETypeServingNetwork   GTPv2IEType = 83
+	GTPv2IETypeULI              GTPv2IEType = 86
+	GTPv2IETypeFTEID            GTPv2IEType = 87
+	GTPv2IETypeBearerContext    GTPv2IEType = 93
+	GTPv2IETypeChargingID       GTPv2IEType = 94
+	GTPv2IETypePDNType          GTPv2IEType = 99
+	GTPv2IETypeAPNRestriction   GTPv2IEType = 127
+	GTPv2IETypeSelectionMode    GTPv2IEType = 128
+	GTPv2IETypePrivateExtension GTPv2IEType = 255
+)
+
+func (t GTPv2IEType) String() string {
+	switch t {
+	case GTPv2IETypeIMSI:
+		return "IMSI"
+	case GTPv2IETypeCause:
+		return "Cause"
+	case GTPv2IETypeRecovery:
+		return "Recovery"
+	case GTPv2IETypeAPN:
+		return "APN"
+	case GTPv2IETypeAMBR:
+		return "AMBR"
+	case GTPv2IETypeEBI:
+		return "EBI"
+	case GTPv2IETypeMEI:
+		return "MEI"
+	case GTPv2IETypeMSISDN:
+		return "MSISDN"
+	case GTPv2IETypeIndication:
+		return "Indication"
+	case GTPv2IETypePAA:
+		return "PAA"
+	case GTPv2IETypeBearerQoS:
+		return "BearerQoS"
+	case GTPv2IETypeRATType:
+		return "RATType"
+	case GTPv2IETypeServingNetwork:
+		return "ServingNetwork"
+	case GTPv2IETypeULI:
+		return "ULI"
+	case GTPv2IETypeFTEID:
+		return "F-TEID"
+	case GTPv2IETypeBearerContext:
+		return "BearerContext"
+	case GTPv2IETypeChargingID:
+		return "ChargingID"
+	case GTPv2IETypePDNType:
+		return "PDNType"
+	case GTPv2IETypeAPNRestriction:
+		return "APNRestriction"
+	case GTPv2IETypeSelectionMode:
+		return "SelectionMode"
+	case GTPv2IETypePrivateExtension:
+		return "PrivateExtension"
+	}
+	return fmt.Sprintf("UnknownGTPv2IEType(%d)", uint8(t))
+}
+
+// grouped returns true if IEs of this type contain other IEs.
+func (t GTPv2IEType) grouped() bool {
+	return t == GTPv2IETypeBearerContext
+}
+
+// GTPv2IE is a GTPv2-C information element.  Grouped IEs, such as bearer
+// contexts, have their contents decoded into IEs as well.
+type GTPv2IE struct {
+	Type     GTPv2IEType
+	Instance uint8
+	Content  []byte
+	IEs      []GTPv2IE
+}
+
+// GTPv2FTEID is a fully qualified tunnel endpoint identifier.
+type GTPv2FTEID struct {
+	// InterfaceType identifies the interface the TEID is for, such as 0 for
+	// S1-U eNodeB GTP-U or 11 for S11 MME GTP-C.
+	InterfaceType uint8
+	TEID          uint32
+	IPv4, IPv6    net.IP
+}
+
+// gtpv2FindIE returns the first IE in ies with the given type and instance,
+// or nil.
+func gtpv2FindIE(ies []GTPv2IE, t GTPv2IEType, instance uint8) *GTPv2IE {
+	for i := range ies {
+		if ies[i].Type == t && ies[i].Instance == instance {
+			return &ies[i]
+		}
+	}
+	return nil
+}
+
+// IE returns the first nested IE with the given type and instance, or nil.
+func (ie *GTPv2IE) IE(t GTPv2IEType, instance uint8) *GTPv2IE {
+	return gtpv2FindIE(ie.IEs, t, instance)
+}
+
+// gtpv2TBCD decodes telephony binary coded decimal digits, as used by
+// IMSI, MSISDN and MEI.
+func gtpv2TBCD(b []byte) string {
+	var s []byte
+	for _, c := range b {
+		for _, d := range []byte{c & 0xf, c >> 4} {
+			if d == 0xf {
+				return string(s)
+			}
+			s = append(s, '0'+d)
+		}
+	}
+	return string(s)
+}
+
+// Digits decodes an IMSI, MSISDN or MEI IE.
+func (ie *GTPv2IE) Digits() (string, error) {
+	switch ie.Type {
+	case GTPv2IETypeIMSI, GTPv2IETypeMSISDN, GTPv2IETypeMEI:
+		return gtpv2TBCD(ie.Content), nil
+	}
+	return "", fmt.Errorf("GTPv2 IE %v does not hold digits", ie.Type)
+}
+
+// Cause decodes the cause value of a Cause IE.
+func (ie *GTPv2IE) Cause() (uint8, error) {
+	if ie.Type != GTPv2IETypeCause || len(ie.Content) < 2 {
+		return 0, fmt.Errorf("GTPv2 IE %v is not a valid cause", ie.Type)
+	}
+	return ie.Content[0], nil
+}
+
+// EBI decodes the EPS bearer ID of an EBI IE.
+func (ie *GTPv2IE) EBI() (uint8, error) {
+	if ie.Type != GTPv2IETypeEBI || len(ie.Content) < 1 {
+		return 0, fmt.Errorf("GTPv2 IE %v is not a valid EBI", ie.Type)
+	}
+	return ie.Content[0] & 0xf, nil
+}
+
+// APN decodes an APN IE, which is encoded as DNS style labels, into dotted
+// form.
+func (ie *GTPv2IE) APN() (string, error) {
+	if ie.Type != GTPv2IETypeAPN {
+		return "", fmt.Errorf("GTPv2 IE %v is not an APN", ie.Type)
+	}
+	var labels []string
+	for b := ie.Content; len(b) > 0; {
+		l := int(b[0])
+		if 1+l > len(b) {
+			return "", fmt.Errorf("GTPv2 APN label overruns IE")
+		}
+		labels = append(labels, string(b[1:1+l]))
+		b = b[1+l:]
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// FTEID decodes an F-TEID IE.
+func (ie *GTPv2IE) FTEID() (GTPv2FTEID, error) {
+	var f GTPv2FTEID
+	if ie.Type != GTPv2IETypeFTEID || len(ie.Content) < 5 {
+		return f, fmt.Errorf("GTPv2 IE %v is not a valid F-TEID", ie.Type)
+	}
+	flags := ie.Content[0]
+	f.InterfaceType = flags & 0x3f
+	f.TEID = binary.BigEndian.Uint32(ie.Content[1:5])
+	b := ie.Content[5:]
+	if flags&0x80 != 0 {
+		if len(b) < 4 {
+			return f, fmt.Errorf("GTPv2 F-TEID IPv4 address truncated")
+		}
+		f.IPv4 = net.IP(b[:4])
+		b = b[4:]
+	}
+	if flags&0x40 != 0 {
+		if len(b) < 16 {
+			return f, fmt.Errorf("GTPv2 F-TEID IPv6 address truncated")
+		}
+		f.IPv6 = net.IP(b[:16])
+	}
+	return f, nil
+}
+
+func decodeGTPv2IEs(data []byte) ([]GTPv2IE, error) {
+	var ies []GTPv2IE
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return ies, fmt.Errorf("GTPv2 IE header truncated")
+		}
+		ie := GTPv2IE{
+			Type:     GTPv2IEType(data[0]),
+			Instance: data[3] & 0xf,
+		}
+		length := int(binary.BigEndian.Uint16(data[1:3]))
+		if len(data) < 4+length {
+			return ies, fmt.Errorf("GTPv2 IE %v length %d overruns message", ie.Type, length)
+		}
+		ie.Content = data[4 : 4+length]
+		if ie.Type.grouped() {
+			var err error
+			if ie.IEs, err = decodeGTPv2IEs(ie.Content); err != nil {
+				return ies, err
+			}
+		}
+		ies = append(ies, ie)
+		data = data[4+length:]
+	}
+	return ies, nil
+}
+
+// GTPv2C is a GTPv2-C control plane message, as described in 3GPP TS
+// 29.274, carried over UDP port 2123.
+type GTPv2C struct {
+	BaseLayer
+	Version uint8
+	// Piggybacked is set if another GTPv2-C message follows this one in the
+	// same datagram; it is decoded as the next layer.
+	Piggybacked bool
+	TEIDPresent bool
+	// MessagePriorityPresent and MessagePriority are only used when
+	// TEIDPresent is set.
+	MessagePriorityPresent bool
+	MessageType            GTPv2MessageType
+	// MessageLength is the length of the message after the first 4 bytes.
+	MessageLength   uint16
+	TEID            uint32
+	SequenceNumber  uint32
+	MessagePriority uint8
+	IEs             []GTPv2IE
+}
+
+// LayerType returns LayerTypeGTPv2C.
+func (g *GTPv2C) LayerType() gopacket.LayerType { return LayerTypeGTPv2C }
+
+// IE returns the first top level IE with the given type and instance, or
+// nil.
+func (g *GTPv2C) IE(t GTPv2IEType, instance uint8) *GTPv2IE {
+	return gtpv2FindIE(g.IEs, t, instance)
+}
+
+// IMSI returns the subscriber's IMSI, or "" if the message has none.
+func (g *GTPv2C) IMSI() string {
+	if ie := g.IE(GTPv2IETypeIMSI, 0); ie != nil {
+		s, _ := ie.Digits()
+		return s
+	}
+	return ""
+}
+
+// BearerContexts returns every top level bearer context IE.
+func (g *GTPv2C) BearerContexts() []*GTPv2IE {
+	var out []*GTPv2IE
+	for i := range g.IEs {
+		if g.IEs[i].Type == GTPv2IETypeBearerContext {
+			out = append(out, &g.IEs[i])
+		}
+	}
+	return out
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (g *GTPv2C) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 8 {
+		df.SetTruncated()
+		return fmt.Errorf("GTPv2-C message too short: %d bytes", len(data))
+	}
+	g.Version = data[0] >> 5
+	if g.Version != 2 {
+		return fmt.Errorf("GTP version %d is not GTPv2", g.Version)
+	}
+	g.Piggybacked = data[0]&0x10 != 0
+	g.TEIDPresent = data[0]&0x08 != 0
+	g.MessagePriorityPresent = data[0]&0x04 != 0
+	g.MessageType = GTPv2MessageType(data[1])
+	g.MessageLength = binary.BigEndian.Uint16(data[2:4])
+	end := 4 + int(g.MessageLength)
+	if len(data) < end {
+		df.SetTruncated()
+		return fmt.Errorf("GTPv2-C message too short: %d bytes, header claims %d", len(data), end)
+	}
+	header := 8
+	g.TEID, g.MessagePriority = 0, 0
+	if g.TEIDPresent {
+		header = 12
+		if end < header {
+			return fmt.Errorf("GTPv2-C message length %d too short for TEID", g.MessageLength)
+		}
+		g.TEID = binary.BigEndian.Uint32(data[4:8])
+	} else if end < header {
+		return fmt.Errorf("GTPv2-C message length %d too short", g.MessageLength)
+	}
+	g.SequenceNumber = uint32(data[header-4])<<16 | uint32(data[header-3])<<8 | uint32(data[header-2])
+	if g.TEIDPresent && g.MessagePriorityPresent {
+		g.MessagePriority = data[header-1] >> 4
+	}
+	var err error
+	if g.IEs, err = decodeGTPv2IEs(data[header:end]); err != nil {
+		return err
+	}
+	g.BaseLayer = BaseLayer{Contents: data[:end], Payload: data[end:]}
+	return nil
+}
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (g *GTPv2C) CanDecode() gopacket.LayerClass {
+	return LayerTypeGTPv2C
+}
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (g *GTPv2C) NextLayerType() gopacket.LayerType {
+	if g.Piggybacked && len(g.Payload) > 0 {
+		return LayerTypeGTPv2C
+	}
+	return gopacket.LayerTypePayload
+}
+
+// decodeGTPv2c decodes GTP-C traffic.  GTPv1-C shares port 2123 with
+// GTPv2-C and uses the same header as GTPv1-U, so version 1 messages are
+// handed to the GTPv1U decoder.
+func decodeGTPv2c(data []byte, p gopacket.PacketBuilder) error {
+	if len(data) > 0 && data[0]>>5 == 1 {
+		return decodeGTPv1u(data, p)
+	}
+	g := &GTPv2C{}
+	return decodingLayerDecoder(g, data, p)
+}
@@ -0,0 +1,121 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testGTPv2CreateSession is a trimmed S11 Create Session Request with an
+// IMSI, APN, sender F-TEID and one bearer context holding an EBI and an
+// S1-U F-TEID.
+var testGTPv2CreateSession = []byte{
+	0x48, 0x20, 0x00, 0x57, // v2, T, Create Session Request, length 87
+	0x00, 0x00, 0x00, 0x00, // TEID 0
+	0x00, 0x01, 0x02, 0x00, // sequence 0x102
+	// IMSI 001010123456789
+	0x01, 0x00, 0x08, 0x00, 0x00, 0x01, 0x01, 0x21, 0x43, 0x65, 0x87, 0xf9,
+	// APN internet.mnc001.mcc001.gprs
+	0x47, 0x00, 0x1c, 0x00,
+	0x08, 'i', 'n', 't', 'e', 'r', 'n', 'e', 't',
+	0x06, 'm', 'n', 'c', '0', '0', '1',
+	0x06, 'm', 'c', 'c', '0', '0', '1',
+	0x04, 'g', 'p', 'r', 's',
+	// Sender F-TEID: S11 MME, TEID 0x11223344, 192.0.2.1
+	0x57, 0x00, 0x09, 0x00, 0x8a, 0x11, 0x22, 0x33, 0x44, 192, 0, 2, 1,
+	// Bearer context: EBI 5, S1-U eNodeB F-TEID instance 1
+	0x5d, 0x00, 0x12, 0x00,
+	0x49, 0x00, 0x01, 0x00, 0x05,
+	0x57, 0x00, 0x09, 0x01, 0x80, 0xaa, 0xbb, 0xcc, 0xdd, 192, 0, 2, 2,
+}
+
+func TestGTPv2CreateSessionRequest(t *testing.T) {
+	p := gopacket.NewPacket(testGTPv2CreateSession, LayerTypeGTPv2C, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeGTPv2C}, t)
+	g := p.Layer(LayerTypeGTPv2C).(*GTPv2C)
+	if g.MessageType != GTPv2MessageTypeCreateSessionRequest || !g.TEIDPresent || g.SequenceNumber != 0x102 {
+		t.Errorf("bad header %+v", g)
+	}
+	if len(g.IEs) != 4 {
+		t.Fatalf("got %d IEs, want 4", len(g.IEs))
+	}
+	if imsi := g.IMSI(); imsi != "001010123456789" {
+		t.Errorf("IMSI %q", imsi)
+	}
+	if apn, err := g.IE(GTPv2IETypeAPN, 0).APN(); err != nil || apn != "internet.mnc001.mcc001.gprs" {
+		t.Errorf("APN %q %v", apn, err)
+	}
+	f, err := g.IE(GTPv2IETypeFTEID, 0).FTEID()
+	if err != nil || f.InterfaceType != 10 || f.TEID != 0x11223344 || !f.IPv4.Equal(net.IP{192, 0, 2, 1}) || f.IPv6 != nil {
+		t.Errorf("sender F-TEID %+v %v", f, err)
+	}
+	bcs := g.BearerContexts()
+	if len(bcs) != 1 {
+		t.Fatalf("got %d bearer contexts, want 1", len(bcs))
+	}
+	if ebi, err := bcs[0].IE(GTPv2IETypeEBI, 0).EBI(); err != nil || ebi != 5 {
+		t.Errorf("EBI %d %v", ebi, err)
+	}
+	if f, err := bcs[0].IE(GTPv2IETypeFTEID, 1).FTEID(); err != nil || f.TEID != 0xaabbccdd || !f.IPv4.Equal(net.IP{192, 0, 2, 2}) {
+		t.Errorf("S1-U F-TEID %+v %v", f, err)
+	}
+}
+
+func TestGTPv2OverUDP(t *testing.T) {
+	// Echo request without a TEID, then a GTPv1-C echo request on the same
+	// port.
+	for _, test := range []struct {
+		data []byte
+		want gopacket.LayerType
+	}{
+		{[]byte{0x40, 0x01, 0x00, 0x09, 0x00, 0x00, 0x07, 0x00, 0x03, 0x00, 0x01, 0x00, 0x04}, LayerTypeGTPv2C},
+		{[]byte{0x32, 0x01, 0x00, 0x04, 0, 0, 0, 0, 0x00, 0x07, 0x00, 0x00}, LayerTypeGTPv1U},
+	} {
+		buf := gopacket.NewSerializeBuffer()
+		udp := &UDP{SrcPort: 2123, DstPort: 2123}
+		if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, udp, gopacket.Payload(test.data)); err != nil {
+			t.Fatal(err)
+		}
+		p := gopacket.NewPacket(buf.Bytes(), LayerTypeUDP, gopacket.Default)
+		if p.ErrorLayer() != nil {
+			t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+		}
+		checkLayers(p, []gopacket.LayerType{LayerTypeUDP, test.want}, t)
+	}
+}
+
+func TestGTPv2Piggybacked(t *testing.T) {
+	data := []byte{
+		0x58, 0x21, 0x00, 0x08, 0, 0, 0, 1, 0, 0, 1, 0, // response, piggybacked
+		0x48, 0x5f, 0x00, 0x08, 0, 0, 0, 1, 0, 0, 2, 0, // create bearer request
+	}
+	p := gopacket.NewPacket(data, LayerTypeGTPv2C, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeGTPv2C, LayerTypeGTPv2C}, t)
+}
+
+func TestGTPv2Malformed(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x48, 0x20, 0x00},
+		{0x48, 0x20, 0x00, 0x20, 0, 0, 0, 0, 0, 0, 0, 0},                      // length overruns
+		{0x48, 0x20, 0x00, 0x0c, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0x00, 0x08, 0}, // IE overruns
+		{0x40, 0x01, 0x00, 0x02, 0, 0, 0, 0},                                  // too short without TEID
+	} {
+		var g GTPv2C
+		if err := g.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("expected error decoding %x", data)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// HSRP is sent on UDP port 1985 to 224.0.0.2 (version 1) or 224.0.0.102
+// (version 2), and on port 2029 to ff02::66 for IPv6, which always uses
+// version 2.  Version 1 messages have a fixed 20 byte format, optionally
+// followed by an MD5 authentication TLV; version 2 messages are made of
+// TLVs only, the first holding the group state.
+const (
+	hsrpV1Length         = 20
+	hsrpGroupStateLength = 40
+	hsrpMD5AuthLength    = 28
+)
+
+// HSRPOpCode is the type of an HSRP message.
+type HSRPOpCode uint8
+
+const (
+	HSRPOpCodeHello     HSRPOpCode = 0
+	HSRPOpCodeCoup      HSRPOpCode = 1
+	HSRPOpCodeResign    HSRPOpCode = 2
+	HSRPOpCodeAdvertise HSRPOpCode = 3
+)
+
+func (o HSRPOpCode) String() string {
+	switch o {
+	case HSRPOpCodeHello:
+		return "Hello"
+	case HSRPOpCodeCoup:
+		return "Coup"
+	case HSRPOpCodeResign:
+		return "Resign"
+	case HSRPOpCodeAdvertise:
+		return "Advertise"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(o))
+}
+
+// HSRPState is the state of an HSRP router in a group.  The constants have
+// the values version 1 sends; version 2 numbers states differently, and its
+// states are converted to these, including HSRPStateDisabled, which version
+// 1 doesn't have.
+type HSRPState uint8
+
+const (
+	HSRPStateInitial  HSRPState = 0
+	HSRPStateLearn    HSRPState = 1
+	HSRPStateListen   HSRPState = 2
+	HSRPStateSpeak    HSRPState = 4
+	HSRPStateStandby  HSRPState = 8
+	HSRPStateActive   HSRPState = 16
+	HSRPStateDisabled HSRPState = 0x80
+)
+
+// hsrpV2States maps version 2 states to HSRPStates.
+var hsrpV2States = [...]HSRPState{
+	HSRPStateDisabled, HSRPStateInitial, HSRPStateLearn, HSRPStateListen,
+	HSRPStateSpeak, HSRPStateStandby, HSRPStateActive,
+}
+
+func (s HSRPState) String() string {
+	switch s {
+	case HSRPStateInitial:
+		return "Initial"
+	case HSRPStateLearn:
+		return "Learn"
+	case HSRPStateListen:
+		return "Listen"
+	case HSRPStateSpeak:
+		return "Speak"
+	case HSRPStateStandby:
+		return "Standby"
+	case HSRPStateActive:
+		return "Active"
+	case HSRPStateDisabled:
+		return "Disabled"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(s))
+}
+
+// HSRPTLVType is the type of an HSRP TLV.
+type HSRPTLVType uint8
+
+const (
+	HSRPTLVGroupState     HSRPTLVType = 1
+	HSRPTLVInterfaceState HSRPTLVType = 2
+	HSRPTLVTextAuth       HSRPTLVType = 3
+	HSRPTLVMD5Auth        HSRPTLVType = 4
+)
+
+func (t HSRPTLVType) String() string {
+	switch t {
+	case HSRPTLVGroupState:
+		return "GroupState"
+	case HSRPTLVInterfaceState:
+		return "InterfaceState"
+	case HSRPTLVTextAuth:
+		return "TextAuth"
+	case HSRPTLVMD5Auth:
+		return "MD5Auth"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(t))
+}
+
+// HSRPTLV is a TLV of an HSRP message.
+type HSRPTLV struct {
+	Type  HSRPTLVType
+	Value []byte
+}
+
+// HSRPMD5Auth is the MD5 authentication of an HSRP message.
+type HSRPMD5Auth struct {
+	Algorithm uint8
+	Flags     uint16
+	IP        net.IP
+	KeyID     uint32
+	Digest    []byte
+}
+
+// HSRPInterfaceState is the number of groups on the sender's interface
+// that are active or standby (Active), and in other states (Passive).  It
+// is sent in advertise messages.
+type HSRPInterfaceState struct {
+	Active, Passive uint16
+}
+
+// HSRP is a Hot Standby Router Protocol message, version 1 or 2.
+type HSRP struct {
+	BaseLayer
+	// Version is 0 for version 1 messages, as sent, and 2 for version 2.
+	Version  uint8
+	OpCode   HSRPOpCode
+	State    HSRPState
+	Group    uint16
+	Priority uint32
+	// HelloTime and HoldTime are sent in seconds by version 1, and in
+	// milliseconds by version 2.
+	HelloTime, HoldTime time.Duration
+	// Identifier is the sender's MAC address, sent by version 2 only.
+	Identifier net.HardwareAddr
+	VirtualIP  net.IP
+	// Authentication is the plain text authentication data, "cisco" with
+	// trailing zeros by default.
+	Authentication []byte
+	MD5            *HSRPMD5Auth
+	// Interface is set for advertise messages.
+	Interface *HSRPInterfaceState
+	// TLVs holds the version 2 TLVs, and any that follow a version 1
+	// message.
+	TLVs []HSRPTLV
+}
+
+// LayerType returns LayerTypeHSRP.
+func (h *HSRP) LayerType() gopacket.LayerType { return LayerTypeHSRP }
+
+func (h *HSRP) CanDecode() gopacket.LayerClass { return LayerTypeHSRP }
+
+func (h *HSRP) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// Payload returns nil; HSRP messages carry no payload.
+func (h *HSRP) Payload() []byte { return nil }
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (h *HSRP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return fmt.Errorf("HSRP length %d too short", len(data))
+	}
+	*h = HSRP{BaseLayer: BaseLayer{Contents: data}}
+	b := data
+	if data[0] == 0 {
+		// Version 1.
+		h.OpCode = HSRPOpCode(data[1])
+		if h.OpCode == HSRPOpCodeAdvertise {
+			// Advertisements hold an interface state, after a type and
+			// length.
+			if len(data) < 12 {
+				df.SetTruncated()
+				return fmt.Errorf("HSRPv1 advertisement length %d too short", len(data))
+			}
+			h.State = HSRPState(data[6])
+			h.Interface = &HSRPInterfaceState{
+				Active:  binary.BigEndian.Uint16(data[8:10]),
+				Passive: binary.BigEndian.Uint16(data[10:12]),
+			}
+			return nil
+		}
+		if len(data) < hsrpV1Length {
+			df.SetTruncated()
+			return fmt.Errorf("HSRPv1 length %d too short", len(data))
+		}
+		h.State = HSRPState(data[2])
+		h.HelloTime = time.Duration(data[3]) * time.Second
+		h.HoldTime = time.Duration(data[4]) * time.Second
+		h.Priority = uint32(data[5])
+		h.Group = uint16(data[6])
+		h.Authentication = data[8:16]
+		h.VirtualIP = net.IP(data[16:20])
+		b = data[hsrpV1Length:]
+	} else {
+		h.Version = 2
+	}
+	for len(b) > 0 {
+		if len(b) < 2 || 2+int(b[1]) > len(b) {
+			df.SetTruncated()
+			return fmt.Errorf("HSRP TLV truncated, %d bytes left", len(b))
+		}
+		tlv := HSRPTLV{Type: HSRPTLVType(b[0]), Value: b[2 : 2+int(b[1])]}
+		h.TLVs = append(h.TLVs, tlv)
+		b = b[2+len(tlv.Value):]
+		if err := h.decodeTLV(tlv); err != nil {
+			return err
+		}
+	}
+	if h.Version == 2 && len(h.TLVs) > 0 && h.TLVs[0].Type != HSRPTLVGroupState && h.TLVs[0].Type != HSRPTLVInterfaceState {
+		return fmt.Errorf("HSRPv2 message starts with %v TLV", h.TLVs[0].Type)
+	}
+	return nil
+}
+
+func (h *HSRP) decodeTLV(tlv HSRPTLV) error {
+	v := tlv.Value
+	switch tlv.Type {
+	case HSRPTLVGroupState:
+		if len(v) < hsrpGroupStateLength {
+			return fmt.Errorf("HSRP group state TLV length %d too short", len(v))
+		}
+		h.Version = v[0]
+		h.OpCode = HSRPOpCode(v[1])
+		if int(v[2]) < len(hsrpV2States) {
+			h.State = hsrpV2States[v[2]]
+		} else {
+			h.State = HSRPState(v[2])
+		}
+		h.Group = binary.BigEndian.Uint16(v[4:6])
+		h.Identifier = net.HardwareAddr(v[6:12])
+		h.Priority = binary.BigEndian.Uint32(v[12:16])
+		h.HelloTime = time.Duration(binary.BigEndian.Uint32(v[16:20])) * time.Millisecond
+		h.HoldTime = time.Duration(binary.BigEndian.Uint32(v[20:24])) * time.Millisecond
+		switch v[3] {
+		case 4:
+			h.VirtualIP = net.IP(v[24:28])
+		case 6:
+			h.VirtualIP = net.IP(v[24:40])
+		default:
+			return fmt.Errorf("HSRP group state IP version %d unknown", v[3])
+		}
+	case HSRPTLVInterfaceState:
+		if len(v) < 4 {
+			return fmt.Errorf("HSRP interface state TLV length %d too short", len(v))
+		}
+		h.OpCode = HSRPOpCodeAdvertise
+		h.Interface = &HSRPInterfaceState{
+			Active:  binary.BigEndian.Uint16(v[0:2]),
+			Passive: binary.BigEndian.Uint16(v[2:4]),
+		}
+	case HSRPTLVTextAuth:
+		h.Authentication = v
+	case HSRPTLVMD5Auth:
+		if len(v) < hsrpMD5AuthLength {
+			return fmt.Errorf("HSRP MD5 authentication TLV length %d too short", len(v))
+		}
+		h.MD5 = &HSRPMD5Auth{
+			Algorithm: v[0],
+			Flags:     binary.BigEndian.Uint16(v[2:4]),
+			IP:        net.IP(v[4:8]),
+			KeyID:     binary.BigEndian.Uint32(v[8:12]),
+			Digest:    v[12:28],
+		}
+	}
+	return nil
+}
+
+func decodeHSRP(data []byte, p gopacket.PacketBuilder) error {
+	h := &HSRP{}
+	if err := h.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(h)
+	p.SetApplicationLayer(h)
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// hsrpPacket returns an HSRP message sent over UDP on the given port.
+func hsrpPacket(t *testing.T, port UDPPort, hsrp []byte) *HSRP {
+	buf := gopacket.NewSerializeBuffer()
+	ip := &IPv4{Version: 4, TTL: 1, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 2}, DstIP: net.IP{224, 0, 0, 102}}
+	udp := &UDP{SrcPort: port, DstPort: port}
+	udp.SetNetworkLayerForChecksum(ip)
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		ip, udp, gopacket.Payload(hsrp)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeHSRP}, t)
+	return p.ApplicationLayer().(*HSRP)
+}
+
+func TestPacketHSRPv1(t *testing.T) {
+	h := hsrpPacket(t, 1985, []byte{
+		0x00, 0x00, 0x10, 0x03, 0x0a, 0x78, 0x01, 0x00,
+		'c', 'i', 's', 'c', 'o', 0x00, 0x00, 0x00,
+		0x0a, 0x00, 0x00, 0x01,
+	})
+	if h.Version != 0 || h.OpCode != HSRPOpCodeHello || h.State != HSRPStateActive || h.Priority != 120 || h.Group != 1 {
+		t.Errorf("got %+v", h)
+	}
+	if h.HelloTime != 3*time.Second || h.HoldTime != 10*time.Second || !h.VirtualIP.Equal(net.IP{10, 0, 0, 1}) {
+		t.Errorf("got %+v", h)
+	}
+	if !bytes.Equal(h.Authentication, []byte("cisco\x00\x00\x00")) || h.MD5 != nil || len(h.TLVs) != 0 {
+		t.Errorf("got %+v", h)
+	}
+}
+
+func TestPacketHSRPv2(t *testing.T) {
+	msg := []byte{
+		// Group state: version 2, hello, standby, IPv4, group 10.
+		0x01, 0x28, 0x02, 0x00, 0x05, 0x04, 0x00, 0x0a,
+		0x00, 0x00, 0x0c, 0x9f, 0xf0, 0x0a,
+		0x00, 0x00, 0x00, 0x64,
+		0x00, 0x00, 0x0b, 0xb8,
+		0x00, 0x00, 0x27, 0x10,
+		0x0a, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		// MD5 authentication.
+		0x04, 0x1c, 0x01, 0x00, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x07,
+	}
+	msg = append(msg, bytes.Repeat([]byte{0xaa}, 16)...)
+	h := hsrpPacket(t, 1985, msg)
+	if h.Version != 2 || h.OpCode != HSRPOpCodeHello || h.State != HSRPStateStandby || h.Group != 10 || h.Priority != 100 {
+		t.Errorf("got %+v", h)
+	}
+	if h.HelloTime != 3*time.Second || h.HoldTime != 10*time.Second || !h.VirtualIP.Equal(net.IP{10, 0, 0, 1}) || h.Identifier.String() != "00:00:0c:9f:f0:0a" {
+		t.Errorf("got %+v", h)
+	}
+	if len(h.TLVs) != 2 || h.MD5 == nil || h.MD5.KeyID != 7 || !h.MD5.IP.Equal(net.IP{10, 0, 0, 2}) || len(h.MD5.Digest) != 16 {
+		t.Errorf("got %+v, MD5 %+v", h, h.MD5)
+	}
+
+	// An IPv6 group in the active state.
+	msg = []byte{
+		0x01, 0x28, 0x02, 0x00, 0x06, 0x06, 0x00, 0x01,
+		0x00, 0x05, 0x73, 0xa0, 0x0f, 0xff,
+		0x00, 0x00, 0x00, 0x64,
+		0x00, 0x00, 0x0b, 0xb8,
+		0x00, 0x00, 0x27, 0x10,
+		0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0x02, 0x05, 0x73, 0xff, 0xfe, 0xa0, 0x0f, 0xff,
+	}
+	h = hsrpPacket(t, 2029, msg)
+	if h.State != HSRPStateActive || h.VirtualIP.String() != "fe80::205:73ff:fea0:fff" {
+		t.Errorf("got %+v", h)
+	}
+}
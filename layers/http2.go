@@ -0,0 +1,368 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// HTTP2Preface starts the client's side of every HTTP/2 connection.
+const HTTP2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// HTTP2FrameType is the type of an HTTP/2 frame.
+type HTTP2FrameType uint8
+
+const (
+	HTTP2FrameData         HTTP2FrameType = 0x0
+	HTTP2FrameHeaders      HTTP2FrameType = 0x1
+	HTTP2FramePriority     HTTP2FrameType = 0x2
+	HTTP2FrameRSTStream    HTTP2FrameType = 0x3
+	HTTP2FrameSettings     HTTP2FrameType = 0x4
+	HTTP2FramePushPromise  HTTP2FrameType = 0x5
+	HTTP2FramePing         HTTP2FrameType = 0x6
+	HTTP2FrameGoAway       HTTP2FrameType = 0x7
+	HTTP2FrameWindowUpdate HTTP2FrameType = 0x8
+	HTTP2FrameContinuation HTTP2FrameType = 0x9
+)
+
+func (t HTTP2FrameType) String() string {
+	switch t {
+	case HTTP2FrameData:
+		return "DATA"
+	case HTTP2FrameHeaders:
+		return "HEADERS"
+	case HTTP2FramePriority:
+		return "PRIORITY"
+	case HTTP2FrameRSTStream:
+		return "RST_STREAM"
+	case HTTP2FrameSettings:
+		return "SETTINGS"
+	case HTTP2FramePushPromise:
+		return "PUSH_PROMISE"
+	case HTTP2FramePing:
+		return "PING"
+	case HTTP2FrameGoAway:
+		return "GOAWAY"
+	case HTTP2FrameWindowUpdate:
+		return "WINDOW_UPDATE"
+	case HTTP2FrameContinuation:
+		return "CONTINUATION"
+	default:
+		return fmt.Sprintf("UnknownHTTP2FrameType(%d)", uint8(t))
+	}
+}
+
+// HTTP2Flags are the flags of an HTTP/2 frame.  Their meaning depends on
+// the frame type.
+type HTTP2Flags uint8
+
+const (
+	// HTTP2FlagEndStream is set on DATA and HEADERS frames.
+	HTTP2FlagEndStream HTTP2Flags = 0x1
+	// HTTP2FlagACK is set on SETTINGS and PING frames.
+	HTTP2FlagACK HTTP2Flags = 0x1
+	// HTTP2FlagEndHeaders is set on HEADERS, PUSH_PROMISE and
+	// CONTINUATION frames.
+	HTTP2FlagEndHeaders HTTP2Flags = 0x4
+	// HTTP2FlagPadded is set on DATA, HEADERS and PUSH_PROMISE frames.
+	HTTP2FlagPadded HTTP2Flags = 0x8
+	// HTTP2FlagPriority is set on HEADERS frames.
+	HTTP2FlagPriority HTTP2Flags = 0x20
+)
+
+// Has reports whether f has every flag of o.
+func (f HTTP2Flags) Has(o HTTP2Flags) bool { return f&o == o }
+
+// HTTP2ErrorCode is the error code of a RST_STREAM or GOAWAY frame.
+type HTTP2ErrorCode uint32
+
+const (
+	HTTP2NoError            HTTP2ErrorCode = 0x0
+	HTTP2ProtocolError      HTTP2ErrorCode = 0x1
+	HTTP2InternalError      HTTP2ErrorCode = 0x2
+	HTTP2FlowControlError   HTTP2ErrorCode = 0x3
+	HTTP2SettingsTimeout    HTTP2ErrorCode = 0x4
+	HTTP2StreamClosed       HTTP2ErrorCode = 0x5
+	HTTP2FrameSizeError     HTTP2ErrorCode = 0x6
+	HTTP2RefusedStream      HTTP2ErrorCode = 0x7
+	HTTP2Cancel             HTTP2ErrorCode = 0x8
+	HTTP2CompressionError   HTTP2ErrorCode = 0x9
+	HTTP2ConnectError       HTTP2ErrorCode = 0xa
+	HTTP2EnhanceYourCalm    HTTP2ErrorCode = 0xb
+	HTTP2InadequateSecurity HTTP2ErrorCode = 0xc
+	HTTP2HTTP11Required     HTTP2ErrorCode = 0xd
+)
+
+var http2ErrorCodeNames = []string{
+	"NO_ERROR", "PROTOCOL_ERROR", "INTERNAL_ERROR", "FLOW_CONTROL_ERROR",
+	"SETTINGS_TIMEOUT", "STREAM_CLOSED", "FRAME_SIZE_ERROR", "REFUSED_STREAM",
+	"CANCEL", "COMPRESSION_ERROR", "CONNECT_ERROR", "ENHANCE_YOUR_CALM",
+	"INADEQUATE_SECURITY", "HTTP_1_1_REQUIRED",
+}
+
+func (c HTTP2ErrorCode) String() string {
+	if int(c) < len(http2ErrorCodeNames) {
+		return http2ErrorCodeNames[c]
+	}
+	return fmt.Sprintf("UnknownHTTP2ErrorCode(%#x)", uint32(c))
+}
+
+// HTTP2SettingID identifies an HTTP/2 setting.
+type HTTP2SettingID uint16
+
+const (
+	HTTP2SettingHeaderTableSize      HTTP2SettingID = 0x1
+	HTTP2SettingEnablePush           HTTP2SettingID = 0x2
+	HTTP2SettingMaxConcurrentStreams HTTP2SettingID = 0x3
+	HTTP2SettingInitialWindowSize    HTTP2SettingID = 0x4
+	HTTP2SettingMaxFrameSize         HTTP2SettingID = 0x5
+	HTTP2SettingMaxHeaderListSize    HTTP2SettingID = 0x6
+)
+
+func (s HTTP2SettingID) String() string {
+	switch s {
+	case HTTP2SettingHeaderTableSize:
+		return "HEADER_TABLE_SIZE"
+	case HTTP2SettingEnablePush:
+		return "ENABLE_PUSH"
+	case HTTP2SettingMaxConcurrentStreams:
+		return "MAX_CONCURRENT_STREAMS"
+	case HTTP2SettingInitialWindowSize:
+		return "INITIAL_WINDOW_SIZE"
+	case HTTP2SettingMaxFrameSize:
+		return "MAX_FRAME_SIZE"
+	case HTTP2SettingMaxHeaderListSize:
+		return "MAX_HEADER_LIST_SIZE"
+	default:
+		return fmt.Sprintf("UnknownHTTP2SettingID(%d)", uint16(s))
+	}
+}
+
+// HTTP2Setting is a setting of a SETTINGS frame.
+type HTTP2Setting struct {
+	ID    HTTP2SettingID
+	Value uint32
+}
+
+// HTTP2Frame is an HTTP/2 frame.  Payload holds the frame's payload, and
+// the fields of its type are decoded from it; the others are left zero.
+type HTTP2Frame struct {
+	Length   uint32
+	Type     HTTP2FrameType
+	Flags    HTTP2Flags
+	StreamID uint32
+	Payload  []byte
+
+	// PadLength is the length of the padding of a padded DATA, HEADERS or
+	// PUSH_PROMISE frame.
+	PadLength uint8
+	// Data is the data of a DATA frame, without padding.
+	Data []byte
+	// HeaderBlock is the HPACK encoded header block fragment of a HEADERS,
+	// PUSH_PROMISE or CONTINUATION frame, without padding.
+	HeaderBlock []byte
+	// Exclusive, StreamDependency and Weight are the priority of a
+	// PRIORITY frame, or a HEADERS frame with HTTP2FlagPriority.
+	Exclusive        bool
+	StreamDependency uint32
+	Weight           uint8
+	// PromisedStreamID is the stream a PUSH_PROMISE frame reserves.
+	PromisedStreamID uint32
+	// ErrorCode is set for RST_STREAM and GOAWAY frames.
+	ErrorCode HTTP2ErrorCode
+	Settings  []HTTP2Setting
+	// OpaqueData is the data of a PING frame.
+	OpaqueData []byte
+	// LastStreamID and DebugData are set for GOAWAY frames.
+	LastStreamID uint32
+	DebugData    []byte
+	// WindowSizeIncrement is set for WINDOW_UPDATE frames.
+	WindowSizeIncrement uint32
+}
+
+func (f *HTTP2Frame) String() string {
+	var s bytes.Buffer
+	fmt.Fprintf(&s, "%v stream=%d flags=%#x", f.Type, f.StreamID, uint8(f.Flags))
+	switch f.Type {
+	case HTTP2FrameData:
+		fmt.Fprintf(&s, " len=%d", len(f.Data))
+	case HTTP2FrameRSTStream:
+		fmt.Fprintf(&s, " error=%v", f.ErrorCode)
+	case HTTP2FrameSettings:
+		for _, st := range f.Settings {
+			fmt.Fprintf(&s, " %v=%d", st.ID, st.Value)
+		}
+	case HTTP2FrameGoAway:
+		fmt.Fprintf(&s, " last=%d error=%v", f.LastStreamID, f.ErrorCode)
+	case HTTP2FrameWindowUpdate:
+		fmt.Fprintf(&s, " increment=%d", f.WindowSizeIncrement)
+	}
+	return s.String()
+}
+
+// HTTP2 is a run of HTTP/2 frames (RFC 9113), optionally preceded by the
+// client's connection preface.  HTTP/2 has no port of its own, so TCP
+// payloads aren't decoded as HTTP2 unless asked to; frames also span
+// segments, and the http2 package decodes the reassembled stream of a
+// connection, including its header blocks.
+type HTTP2 struct {
+	BaseLayer
+	// Preface is set if the frames follow the client connection preface.
+	Preface bool
+	Frames  []HTTP2Frame
+}
+
+// LayerType returns LayerTypeHTTP2.
+func (h *HTTP2) LayerType() gopacket.LayerType { return LayerTypeHTTP2 }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (h *HTTP2) CanDecode() gopacket.LayerClass { return LayerTypeHTTP2 }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (h *HTTP2) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+func decodeHTTP2(data []byte, p gopacket.PacketBuilder) error {
+	return decodingLayerDecoder(&HTTP2{}, data, p)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (h *HTTP2) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	rest := data
+	h.Preface = bytes.HasPrefix(rest, []byte(HTTP2Preface))
+	if h.Preface {
+		rest = rest[len(HTTP2Preface):]
+	}
+	h.Frames = h.Frames[:0]
+	for len(rest) > 0 {
+		var f HTTP2Frame
+		n, err := DecodeHTTP2Frame(&f, rest)
+		if n == 0 && err == nil {
+			df.SetTruncated()
+			return fmt.Errorf("HTTP/2 frame truncated")
+		}
+		if err != nil {
+			return err
+		}
+		h.Frames = append(h.Frames, f)
+		rest = rest[n:]
+	}
+	h.BaseLayer = BaseLayer{Contents: data}
+	return nil
+}
+
+// DecodeHTTP2Frame decodes the frame at the start of data into f,
+// returning its length, which is 0 with no error if data doesn't hold all
+// of it yet.
+func DecodeHTTP2Frame(f *HTTP2Frame, data []byte) (int, error) {
+	if len(data) < 9 {
+		return 0, nil
+	}
+	*f = HTTP2Frame{
+		Length:   uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2]),
+		Type:     HTTP2FrameType(data[3]),
+		Flags:    HTTP2Flags(data[4]),
+		StreamID: binary.BigEndian.Uint32(data[5:9]) & 0x7fffffff,
+	}
+	n := 9 + int(f.Length)
+	if len(data) < n {
+		return 0, nil
+	}
+	f.Payload = data[9:n]
+	return n, f.decodePayload()
+}
+
+// unpad removes the padding of a padded frame's payload.
+func (f *HTTP2Frame) unpad() ([]byte, error) {
+	b := f.Payload
+	if !f.Flags.Has(HTTP2FlagPadded) {
+		return b, nil
+	}
+	if len(b) < 1 || int(b[0]) > len(b)-1 {
+		return nil, fmt.Errorf("HTTP/2 %v frame padding exceeds payload", f.Type)
+	}
+	f.PadLength = b[0]
+	return b[1 : len(b)-int(b[0])], nil
+}
+
+func (f *HTTP2Frame) priority(b []byte) []byte {
+	d := binary.BigEndian.Uint32(b)
+	f.Exclusive, f.StreamDependency, f.Weight = d&0x80000000 != 0, d&0x7fffffff, b[4]
+	return b[5:]
+}
+
+// http2FixedLengths are the payload lengths of the frames whose length is
+// fixed.
+var http2FixedLengths = map[HTTP2FrameType]int{
+	HTTP2FramePriority:     5,
+	HTTP2FrameRSTStream:    4,
+	HTTP2FramePing:         8,
+	HTTP2FrameWindowUpdate: 4,
+}
+
+func (f *HTTP2Frame) decodePayload() error {
+	if n, ok := http2FixedLengths[f.Type]; ok && len(f.Payload) != n {
+		return fmt.Errorf("HTTP/2 %v frame length %d, want %d", f.Type, len(f.Payload), n)
+	}
+	b := f.Payload
+	var err error
+	switch f.Type {
+	case HTTP2FrameData:
+		f.Data, err = f.unpad()
+	case HTTP2FrameHeaders:
+		if b, err = f.unpad(); err != nil {
+			return err
+		}
+		if f.Flags.Has(HTTP2FlagPriority) {
+			if len(b) < 5 {
+				return fmt.Errorf("HTTP/2 HEADERS frame priority truncated")
+			}
+			b = f.priority(b)
+		}
+		f.HeaderBlock = b
+	case HTTP2FramePriority:
+		f.priority(b)
+	case HTTP2FrameRSTStream:
+		f.ErrorCode = HTTP2ErrorCode(binary.BigEndian.Uint32(b))
+	case HTTP2FrameSettings:
+		if len(b)%6 != 0 {
+			return fmt.Errorf("HTTP/2 SETTINGS frame length %d not a multiple of 6", len(b))
+		}
+		for ; len(b) > 0; b = b[6:] {
+			f.Settings = append(f.Settings, HTTP2Setting{
+				ID:    HTTP2SettingID(binary.BigEndian.Uint16(b)),
+				Value: binary.BigEndian.Uint32(b[2:]),
+			})
+		}
+	case HTTP2FramePushPromise:
+		if b, err = f.unpad(); err != nil {
+			return err
+		}
+		if len(b) < 4 {
+			return fmt.Errorf("HTTP/2 PUSH_PROMISE frame truncated")
+		}
+		f.PromisedStreamID = binary.BigEndian.Uint32(b) & 0x7fffffff
+		f.HeaderBlock = b[4:]
+	case HTTP2FramePing:
+		f.OpaqueData = b
+	case HTTP2FrameGoAway:
+		if len(b) < 8 {
+			return fmt.Errorf("HTTP/2 GOAWAY frame length %d too short", len(b))
+		}
+		f.LastStreamID = binary.BigEndian.Uint32(b) & 0x7fffffff
+		f.ErrorCode = HTTP2ErrorCode(binary.BigEndian.Uint32(b[4:]))
+		f.DebugData = b[8:]
+	case HTTP2FrameWindowUpdate:
+		f.WindowSizeIncrement = binary.BigEndian.Uint32(b) & 0x7fffffff
+	case HTTP2FrameContinuation:
+		f.HeaderBlock = b
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// http2Frame returns a frame with the given header fields and payload.
+func http2Frame(typ HTTP2FrameType, flags HTTP2Flags, stream uint32, payload ...byte) []byte {
+	n := len(payload)
+	b := []byte{byte(n >> 16), byte(n >> 8), byte(n), byte(typ), byte(flags),
+		byte(stream >> 24), byte(stream >> 16), byte(stream >> 8), byte(stream)}
+	return append(b, payload...)
+}
+
+func TestHTTP2Frames(t *testing.T) {
+	data := []byte(HTTP2Preface)
+	data = append(data, http2Frame(HTTP2FrameSettings, 0, 0, 0, 3, 0, 0, 0, 100, 0, 4, 0, 1, 0, 0)...)
+	data = append(data, http2Frame(HTTP2FrameWindowUpdate, 0, 0, 0, 0xf, 0, 1)...)
+	// Padded, with a priority: 2 bytes of padding, exclusive on stream 1
+	// with weight 15, and a 2 byte block fragment.
+	data = append(data, http2Frame(HTTP2FrameHeaders, HTTP2FlagPadded|HTTP2FlagPriority|HTTP2FlagEndHeaders, 3,
+		2, 0x80, 0, 0, 1, 15, 0x82, 0x84, 0, 0)...)
+	data = append(data, http2Frame(HTTP2FrameData, HTTP2FlagEndStream, 3, 'h', 'i')...)
+	data = append(data, http2Frame(HTTP2FrameRSTStream, 0, 3, 0, 0, 0, 8)...)
+	data = append(data, http2Frame(HTTP2FrameGoAway, 0, 0, 0, 0, 0, 3, 0, 0, 0, 0xb, 'b', 'y', 'e')...)
+	p := gopacket.NewPacket(data, LayerTypeHTTP2, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	h := p.Layer(LayerTypeHTTP2).(*HTTP2)
+	if !h.Preface || len(h.Frames) != 6 {
+		t.Fatalf("got preface %v and %d frames", h.Preface, len(h.Frames))
+	}
+	want := []HTTP2Setting{{HTTP2SettingMaxConcurrentStreams, 100}, {HTTP2SettingInitialWindowSize, 65536}}
+	if f := h.Frames[0]; f.Type != HTTP2FrameSettings || !reflect.DeepEqual(f.Settings, want) {
+		t.Errorf("got %v", &f)
+	}
+	if f := h.Frames[1]; f.WindowSizeIncrement != 0xf0001 {
+		t.Errorf("got %v", &f)
+	}
+	f := h.Frames[2]
+	if f.StreamID != 3 || f.PadLength != 2 || !f.Exclusive || f.StreamDependency != 1 || f.Weight != 15 ||
+		!bytes.Equal(f.HeaderBlock, []byte{0x82, 0x84}) || !f.Flags.Has(HTTP2FlagEndHeaders) {
+		t.Errorf("got %+v", f)
+	}
+	if f := h.Frames[3]; string(f.Data) != "hi" || !f.Flags.Has(HTTP2FlagEndStream) {
+		t.Errorf("got %v", &f)
+	}
+	if f := h.Frames[4]; f.ErrorCode != HTTP2Cancel {
+		t.Errorf("got %v", &f)
+	}
+	if f := h.Frames[5]; f.LastStreamID != 3 || f.ErrorCode != HTTP2EnhanceYourCalm || string(f.DebugData) != "bye" {
+		t.Errorf("got %v", &f)
+	}
+	if got := h.Frames[5].String(); got != "GOAWAY stream=0 flags=0x0 last=3 error=ENHANCE_YOUR_CALM" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestHTTP2Invalid(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", http2Frame(HTTP2FrameData, 0, 1, 1, 2, 3)[:10]},
+		{"padding", http2Frame(HTTP2FrameData, HTTP2FlagPadded, 1, 5, 1, 2)},
+		{"settings", http2Frame(HTTP2FrameSettings, 0, 0, 0, 1, 0)},
+		{"ping", http2Frame(HTTP2FramePing, 0, 0, 1, 2, 3)},
+	} {
+		p := gopacket.NewPacket(c.data, LayerTypeHTTP2, gopacket.Default)
+		if p.ErrorLayer() == nil {
+			t.Errorf("%s: decoded", c.name)
+		}
+	}
+}
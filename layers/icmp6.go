@@ -23,6 +23,11 @@ const (
 	ICMPv6TypeParameterProblem       = 4
 	ICMPv6TypeEchoRequest            = 128
 	ICMPv6TypeEchoReply              = 129
+	// The following are from RFC 2710 and RFC 3810
+	ICMPv6TypeMulticastListenerQuery    = 130
+	ICMPv6TypeMulticastListenerReport   = 131
+	ICMPv6TypeMulticastListenerDone     = 132
+	ICMPv6TypeMulticastListenerReportV2 = 143
 	// The following are from RFC 4861
 	ICMPv6TypeRouterSolicitation    = 133
 	ICMPv6TypeRouterAdvertisement   = 134
@@ -91,6 +96,18 @@ var (
 		ICMPv6TypeEchoReply: icmpv6TypeCodeInfoStruct{
 			"EchoReply", nil,
 		},
+		ICMPv6TypeMulticastListenerQuery: icmpv6TypeCodeInfoStruct{
+			"MulticastListenerQuery", nil,
+		},
+		ICMPv6TypeMulticastListenerReport: icmpv6TypeCodeInfoStruct{
+			"MulticastListenerReport", nil,
+		},
+		ICMPv6TypeMulticastListenerDone: icmpv6TypeCodeInfoStruct{
+			"MulticastListenerDone", nil,
+		},
+		ICMPv6TypeMulticastListenerReportV2: icmpv6TypeCodeInfoStruct{
+			"MulticastListenerReportV2", nil,
+		},
 		ICMPv6TypeRouterSolicitation: icmpv6TypeCodeInfoStruct{
 			"RouterSolicitation", nil,
 		},
@@ -164,12 +181,30 @@ func CreateICMPv6TypeCode(typ uint8, code uint8) ICMPv6TypeCode {
 // ICMPv6 is the layer for IPv6 ICMP packet data
 type ICMPv6 struct {
 	BaseLayer
-	TypeCode  ICMPv6TypeCode
-	Checksum  uint16
+	TypeCode ICMPv6TypeCode
+	Checksum uint16
+	// TypeBytes holds the 4 bytes following the checksum, except for echo,
+	// multicast listener discovery and neighbor discovery messages, which
+	// are decoded by their own layers following this one and leave it nil.
+	// When serializing those messages, TypeBytes is written if it's set,
+	// and must then be left nil in the layer of the message.
 	TypeBytes []byte
 	tcpipchecksum
 }
 
+// hasMessageLayer returns true if messages of type t are decoded by a
+// layer following ICMPv6: echo messages, and the multicast listener
+// discovery and neighbor discovery messages.
+func hasMessageLayer(t uint8) bool {
+	switch {
+	case t >= ICMPv6TypeEchoRequest && t <= ICMPv6TypeRedirect:
+		return true
+	case t == ICMPv6TypeMulticastListenerReportV2:
+		return true
+	}
+	return false
+}
+
 // LayerType returns LayerTypeICMPv6.
 func (i *ICMPv6) LayerType() gopacket.LayerType { return LayerTypeICMPv6 }
 
@@ -181,6 +216,11 @@ func (i *ICMPv6) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error
 	}
 	i.TypeCode = CreateICMPv6TypeCode(data[0], data[1])
 	i.Checksum = binary.BigEndian.Uint16(data[2:4])
+	if hasMessageLayer(i.TypeCode.Type()) {
+		i.TypeBytes = nil
+		i.BaseLayer = BaseLayer{data[:4], data[4:]}
+		return nil
+	}
 	i.TypeBytes = data[4:8]
 	i.BaseLayer = BaseLayer{data[:8], data[8:]}
 	return nil
@@ -190,17 +230,27 @@ func (i *ICMPv6) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error
 // SerializationBuffer, implementing gopacket.SerializableLayer.
 // See the docs for gopacket.SerializableLayer for more info.
 func (i *ICMPv6) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
-	if i.TypeBytes == nil {
-		i.TypeBytes = lotsOfZeros[:4]
-	} else if len(i.TypeBytes) != 4 {
-		return fmt.Errorf("invalid type bytes for ICMPv6 packet: %v", i.TypeBytes)
+	// Messages with their own layers are serialized by them, leaving only
+	// the type, code and checksum here, unless TypeBytes is set, as by
+	// callers serializing the message's first 4 bytes with this layer and
+	// the rest as payload.
+	length := 4
+	if i.TypeBytes != nil || !hasMessageLayer(i.TypeCode.Type()) {
+		length = 8
+		if i.TypeBytes == nil {
+			i.TypeBytes = lotsOfZeros[:4]
+		} else if len(i.TypeBytes) != 4 {
+			return fmt.Errorf("invalid type bytes for ICMPv6 packet: %v", i.TypeBytes)
+		}
 	}
-	bytes, err := b.PrependBytes(8)
+	bytes, err := b.PrependBytes(length)
 	if err != nil {
 		return err
 	}
 	i.TypeCode.SerializeTo(bytes)
-	copy(bytes[4:8], i.TypeBytes)
+	if length == 8 {
+		copy(bytes[4:8], i.TypeBytes)
+	}
 	if opts.ComputeChecksums {
 		bytes[2] = 0
 		bytes[3] = 0
@@ -221,9 +271,61 @@ func (i *ICMPv6) CanDecode() gopacket.LayerClass {
 
 // NextLayerType returns the layer type contained by this DecodingLayer.
 func (i *ICMPv6) NextLayerType() gopacket.LayerType {
+	switch i.TypeCode.Type() {
+	case ICMPv6TypeEchoRequest, ICMPv6TypeEchoReply:
+		return LayerTypeICMPv6Echo
+	case ICMPv6TypeMulticastListenerQuery:
+		// MLDv1 queries are 24 bytes long, and MLDv2 queries at least 28.
+		if len(i.Payload) >= 24 {
+			return LayerTypeMLDv2Query
+		}
+		return LayerTypeMLDv1
+	case ICMPv6TypeMulticastListenerReport, ICMPv6TypeMulticastListenerDone:
+		return LayerTypeMLDv1
+	case ICMPv6TypeMulticastListenerReportV2:
+		return LayerTypeMLDv2Report
+	case ICMPv6TypeRouterSolicitation:
+		return LayerTypeICMPv6RouterSolicitation
+	case ICMPv6TypeRouterAdvertisement:
+		return LayerTypeICMPv6RouterAdvertisement
+	case ICMPv6TypeNeighborSolicitation:
+		return LayerTypeICMPv6NeighborSolicitation
+	case ICMPv6TypeNeighborAdvertisement:
+		return LayerTypeICMPv6NeighborAdvertisement
+	case ICMPv6TypeRedirect:
+		return LayerTypeICMPv6Redirect
+	}
 	return gopacket.LayerTypePayload
 }
 
+// SetNetworkLayerForChecksum tells this layer which network layer is
+// wrapping it, for computing its checksum over the IPv6 pseudo-header.  The
+// passed in layer must be an *IPv6.
+func (i *ICMPv6) SetNetworkLayerForChecksum(l gopacket.NetworkLayer) error {
+	if _, ok := l.(*IPv6); !ok {
+		return fmt.Errorf("cannot use layer type %v for ICMPv6 checksum network layer", l.LayerType())
+	}
+	return i.tcpipchecksum.SetNetworkLayerForChecksum(l)
+}
+
+// VerifyChecksum returns true if the checksum of a decoded message is
+// correct.  The network layer must have been set with
+// SetNetworkLayerForChecksum.
+func (i *ICMPv6) VerifyChecksum() (bool, error) {
+	if len(i.Contents) < 4 {
+		return false, fmt.Errorf("ICMPv6 layer has not been decoded")
+	}
+	data := make([]byte, 0, len(i.Contents)+len(i.Payload))
+	data = append(data, i.Contents...)
+	data = append(data, i.Payload...)
+	data[2], data[3] = 0, 0
+	csum, err := i.computeChecksum(data, IPProtocolICMPv6)
+	if err != nil {
+		return false, err
+	}
+	return csum == i.Checksum, nil
+}
+
 func decodeICMPv6(data []byte, p gopacket.PacketBuilder) error {
 	i := &ICMPv6{}
 	return decodingLayerDecoder(i, data, p)
@@ -35,7 +35,7 @@ func TestPacketICMPv6(t *testing.T) {
 	if p.ErrorLayer() != nil {
 		t.Error("Failed to decode packet:", p.ErrorLayer().Error())
 	}
-	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeIPv6, LayerTypeICMPv6, gopacket.LayerTypePayload}, t)
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeIPv6, LayerTypeICMPv6, LayerTypeICMPv6NeighborAdvertisement}, t)
 	if got, ok := p.Layer(LayerTypeIPv6).(*IPv6); ok {
 		want := &IPv6{
 			BaseLayer: BaseLayer{
@@ -65,13 +65,12 @@ func TestPacketICMPv6(t *testing.T) {
 	if got, ok := p.Layer(LayerTypeICMPv6).(*ICMPv6); ok {
 		want := &ICMPv6{
 			BaseLayer: BaseLayer{
-				Contents: []byte{0x88, 0x0, 0x1e, 0xd6, 0x40, 0x0, 0x0, 0x0},
-				Payload: []byte{0x26, 0x20, 0x0, 0x0, 0x10,
+				Contents: []byte{0x88, 0x0, 0x1e, 0xd6},
+				Payload: []byte{0x40, 0x0, 0x0, 0x0, 0x26, 0x20, 0x0, 0x0, 0x10,
 					0x5, 0x0, 0x0, 0x26, 0xbe, 0x5, 0xff, 0xfe, 0x27, 0xb, 0x17},
 			},
-			TypeCode:  0x8800,
-			Checksum:  0x1ed6,
-			TypeBytes: []byte{0x40, 0x0, 0x0, 0x0},
+			TypeCode: 0x8800,
+			Checksum: 0x1ed6,
 		}
 		if !reflect.DeepEqual(got, want) {
 			t.Errorf("ICMPv6 packet processing failed:\ngot  :\n%#v\n\nwant :\n%#v\n\n", got, want)
@@ -82,4 +81,191 @@ func TestPacketICMPv6(t *testing.T) {
 	} else {
 		t.Error("No ICMPv6 layer type found in packet")
 	}
+	if got, ok := p.Layer(LayerTypeICMPv6NeighborAdvertisement).(*ICMPv6NeighborAdvertisement); ok {
+		if !got.Solicited() || got.Router() || got.Override() || !got.TargetAddress.Equal(net.ParseIP("2620:0:1005:0:26be:5ff:fe27:b17")) || len(got.Options) != 0 {
+			t.Errorf("got neighbor advertisement %+v", got)
+		}
+	} else {
+		t.Error("No ICMPv6NeighborAdvertisement layer type found in packet")
+	}
+}
+
+// testPacketICMPv6RouterAdvertisement is a router advertisement from
+// fe80::1 with a source link layer address, MTU, prefix information, route
+// information, RDNSS and DNSSL options.
+var testPacketICMPv6RouterAdvertisement = []byte{
+	0x33, 0x33, 0x00, 0x00, 0x00, 0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01, 0x86, 0xdd, 0x60, 0x00,
+	0x00, 0x00, 0x00, 0x90, 0x3a, 0xff, 0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+	// ICMPv6 router advertisement, M and O set with high preference.
+	0x86, 0x00, 0xdf, 0x2c, 0x40, 0xc8, 0x07, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	// Source link layer address.
+	0x01, 0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01,
+	// MTU 1480.
+	0x05, 0x01, 0x00, 0x00, 0x00, 0x00, 0x05, 0xc8,
+	// Prefix 2001:db8:1::/64, on link and autonomous.
+	0x03, 0x04, 0x40, 0xc0, 0x00, 0x27, 0x8d, 0x00, 0x00, 0x09, 0x3a, 0x80, 0x00, 0x00, 0x00, 0x00,
+	0x20, 0x01, 0x0d, 0xb8, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	// Route 2001:db8:2::/48, low preference.
+	0x18, 0x02, 0x30, 0x18, 0x00, 0x00, 0x0e, 0x10, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x02, 0x00, 0x00,
+	// RDNSS 2001:db8::53.
+	0x19, 0x03, 0x00, 0x00, 0x00, 0x00, 0x0e, 0x10, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x53,
+	// DNSSL example.com, lab.example.com.
+	0x1f, 0x05, 0x00, 0x00, 0x00, 0x00, 0x0e, 0x10, 0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e',
+	0x03, 'c', 'o', 'm', 0x00, 0x03, 'l', 'a', 'b', 0x07, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x03,
+	'c', 'o', 'm', 0x00, 0x00, 0x00,
+}
+
+func TestPacketICMPv6RouterAdvertisement(t *testing.T) {
+	p := gopacket.NewPacket(testPacketICMPv6RouterAdvertisement, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeIPv6, LayerTypeICMPv6, LayerTypeICMPv6RouterAdvertisement}, t)
+	ra := p.Layer(LayerTypeICMPv6RouterAdvertisement).(*ICMPv6RouterAdvertisement)
+	if ra.HopLimit != 64 || !ra.ManagedAddressConfig() || !ra.OtherConfig() || ra.Preference() != ICMPv6RouterPreferenceHigh || ra.RouterLifetime != 1800 {
+		t.Errorf("got router advertisement %+v", ra)
+	}
+	want := ICMPv6Options{
+		{Type: ICMPv6OptSourceAddress, LinkLayerAddress: net.HardwareAddr{2, 0, 0, 0, 0, 1}},
+		{Type: ICMPv6OptMTU, MTU: 1480},
+		{Type: ICMPv6OptPrefixInfo, PrefixInfo: &ICMPv6PrefixInfo{
+			PrefixLength:      64,
+			OnLink:            true,
+			Autonomous:        true,
+			ValidLifetime:     2592000,
+			PreferredLifetime: 604800,
+			Prefix:            net.ParseIP("2001:db8:1::"),
+		}},
+		{Type: ICMPv6OptRouteInfo, RouteInfo: &ICMPv6RouteInfo{
+			PrefixLength: 48,
+			Preference:   ICMPv6RouterPreferenceLow,
+			Lifetime:     3600,
+			Prefix:       net.ParseIP("2001:db8:2::"),
+		}},
+		{Type: ICMPv6OptRDNSS, RDNSS: &ICMPv6RDNSS{Lifetime: 3600, Servers: []net.IP{net.ParseIP("2001:db8::53")}}},
+		{Type: ICMPv6OptDNSSL, DNSSL: &ICMPv6DNSSL{Lifetime: 3600, Domains: []string{"example.com", "lab.example.com"}}},
+	}
+	if len(ra.Options) != len(want) {
+		t.Fatalf("got %d options, want %d: %v", len(ra.Options), len(want), ra.Options)
+	}
+	for i, got := range ra.Options {
+		got.Data = nil
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("option %d: got %+v, want %+v", i, got, want[i])
+		}
+	}
+	if o := ra.Options.Option(ICMPv6OptMTU); o == nil || o.MTU != 1480 {
+		t.Errorf("got MTU option %v", o)
+	}
+	testSerialization(t, p, testPacketICMPv6RouterAdvertisement)
+
+	// Options built from their typed bodies alone serialize the same way.
+	ip6 := p.Layer(LayerTypeIPv6).(*IPv6)
+	icmp := &ICMPv6{TypeCode: CreateICMPv6TypeCode(ICMPv6TypeRouterAdvertisement, 0)}
+	icmp.SetNetworkLayerForChecksum(ip6)
+	ra = &ICMPv6RouterAdvertisement{HopLimit: 64, Flags: 0xc8, RouterLifetime: 1800, Options: want}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, icmp, ra); err != nil {
+		t.Fatal(err)
+	}
+	p2 := gopacket.NewPacket(buf.Bytes(), LayerTypeICMPv6, gopacket.Default)
+	ra2, ok := p2.Layer(LayerTypeICMPv6RouterAdvertisement).(*ICMPv6RouterAdvertisement)
+	if !ok || !reflect.DeepEqual(ra2.Contents, testPacketICMPv6RouterAdvertisement[58:]) {
+		t.Errorf("serialized %x, want %x", buf.Bytes()[4:], testPacketICMPv6RouterAdvertisement[58:])
+	}
+}
+
+func TestICMPv6BadOptions(t *testing.T) {
+	for _, data := range [][]byte{
+		// Zero length option.
+		{0x01, 0x00, 0, 0, 0, 0, 0, 0},
+		// Option longer than the message.
+		{0x01, 0x02, 0, 0, 0, 0, 0, 0},
+		// Trailing byte.
+		{0x01, 0x01, 0, 0, 0, 0, 0, 0, 0x01},
+	} {
+		var o ICMPv6Options
+		if err := o.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("decoded %x as %v", data, o)
+		}
+	}
+	// A malformed body is left untyped.
+	var o ICMPv6Options
+	if err := o.DecodeFromBytes([]byte{0x05, 0x01, 0, 0, 0, 0, 0, 0, 0x03, 0x01, 0, 0, 0, 0, 0, 0}, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if len(o) != 2 || o[0].MTU != 0 || o[1].PrefixInfo != nil {
+		t.Errorf("got %v", o)
+	}
+}
+
+// testPacketICMPv6Echo is an echo request from fe80::1 to fe80::2, with
+// identifier 0x1234, sequence number 1 and data "abcd".
+var testPacketICMPv6Echo = []byte{
+	0x60, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x3a, 0x40, 0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x80, 0x00, 0xab, 0xb8, 0x12, 0x34, 0x00, 0x01,
+	'a', 'b', 'c', 'd',
+}
+
+func TestPacketICMPv6Echo(t *testing.T) {
+	p := gopacket.NewPacket(testPacketICMPv6Echo, LayerTypeIPv6, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv6, LayerTypeICMPv6, LayerTypeICMPv6Echo, gopacket.LayerTypePayload}, t)
+	echo := p.Layer(LayerTypeICMPv6Echo).(*ICMPv6Echo)
+	if echo.Identifier != 0x1234 || echo.SeqNumber != 1 || string(echo.Payload) != "abcd" {
+		t.Errorf("got echo %+v", echo)
+	}
+	icmp := p.Layer(LayerTypeICMPv6).(*ICMPv6)
+	if ok, err := icmp.VerifyChecksum(); err == nil {
+		t.Errorf("verified checksum without a network layer: %v", ok)
+	}
+	if err := icmp.SetNetworkLayerForChecksum(&IPv4{}); err == nil {
+		t.Error("used IPv4 for the ICMPv6 checksum")
+	}
+	icmp.SetNetworkLayerForChecksum(p.NetworkLayer())
+	if ok, err := icmp.VerifyChecksum(); !ok || err != nil {
+		t.Errorf("checksum not verified: %v", err)
+	}
+	testSerialization(t, p, testPacketICMPv6Echo)
+
+	// Craft the same packet from scratch.
+	ip6 := &IPv6{
+		Version:    6,
+		NextHeader: IPProtocolICMPv6,
+		HopLimit:   64,
+		SrcIP:      net.ParseIP("fe80::1"),
+		DstIP:      net.ParseIP("fe80::2"),
+	}
+	icmp = &ICMPv6{TypeCode: CreateICMPv6TypeCode(ICMPv6TypeEchoRequest, 0)}
+	icmp.SetNetworkLayerForChecksum(ip6)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip6, icmp, &ICMPv6Echo{Identifier: 0x1234, SeqNumber: 1}, gopacket.Payload("abcd")); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(buf.Bytes(), testPacketICMPv6Echo) {
+		t.Errorf("serialized %x, want %x", buf.Bytes(), testPacketICMPv6Echo)
+	}
+
+	// Callers from before ICMPv6Echo give the identifier and sequence
+	// number in TypeBytes.
+	icmp = &ICMPv6{TypeCode: CreateICMPv6TypeCode(ICMPv6TypeEchoRequest, 0), TypeBytes: []byte{0x12, 0x34, 0, 1}}
+	icmp.SetNetworkLayerForChecksum(ip6)
+	if err := gopacket.SerializeLayers(buf, opts, ip6, icmp, gopacket.Payload("abcd")); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(buf.Bytes(), testPacketICMPv6Echo) {
+		t.Errorf("serialized with TypeBytes %x, want %x", buf.Bytes(), testPacketICMPv6Echo)
+	}
+	icmp.TypeBytes = []byte{0x12, 0x34}
+	if err := gopacket.SerializeLayers(buf, opts, ip6, icmp, gopacket.Payload("abcd")); err == nil {
+		t.Error("serialized 2 type bytes without error")
+	}
 }
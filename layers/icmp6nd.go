@@ -0,0 +1,684 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mistsys/gopacket"
+)
+
+// ICMPv6Opt is the type of a neighbor discovery option.
+type ICMPv6Opt uint8
+
+const (
+	// The following are from RFC 4861
+	ICMPv6OptSourceAddress    ICMPv6Opt = 1
+	ICMPv6OptTargetAddress    ICMPv6Opt = 2
+	ICMPv6OptPrefixInfo       ICMPv6Opt = 3
+	ICMPv6OptRedirectedHeader ICMPv6Opt = 4
+	ICMPv6OptMTU              ICMPv6Opt = 5
+	// RFC 4191
+	ICMPv6OptRouteInfo ICMPv6Opt = 24
+	// RFC 8106
+	ICMPv6OptRDNSS ICMPv6Opt = 25
+	ICMPv6OptDNSSL ICMPv6Opt = 31
+)
+
+func (i ICMPv6Opt) String() string {
+	switch i {
+	case ICMPv6OptSourceAddress:
+		return "SourceAddress"
+	case ICMPv6OptTargetAddress:
+		return "TargetAddress"
+	case ICMPv6OptPrefixInfo:
+		return "PrefixInfo"
+	case ICMPv6OptRedirectedHeader:
+		return "RedirectedHeader"
+	case ICMPv6OptMTU:
+		return "MTU"
+	case ICMPv6OptRouteInfo:
+		return "RouteInfo"
+	case ICMPv6OptRDNSS:
+		return "RDNSS"
+	case ICMPv6OptDNSSL:
+		return "DNSSL"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(i))
+}
+
+// ICMPv6RouterPreference is the preference of a default router or route,
+// from RFC 4191.
+type ICMPv6RouterPreference uint8
+
+const (
+	ICMPv6RouterPreferenceMedium   ICMPv6RouterPreference = 0
+	ICMPv6RouterPreferenceHigh     ICMPv6RouterPreference = 1
+	ICMPv6RouterPreferenceReserved ICMPv6RouterPreference = 2
+	ICMPv6RouterPreferenceLow      ICMPv6RouterPreference = 3
+)
+
+func (p ICMPv6RouterPreference) String() string {
+	switch p {
+	case ICMPv6RouterPreferenceMedium:
+		return "Medium"
+	case ICMPv6RouterPreferenceHigh:
+		return "High"
+	case ICMPv6RouterPreferenceLow:
+		return "Low"
+	}
+	return "Reserved"
+}
+
+// ICMPv6PrefixInfo is the body of a prefix information option.
+type ICMPv6PrefixInfo struct {
+	PrefixLength uint8
+	// OnLink and Autonomous are the L and A flags.
+	OnLink, Autonomous bool
+	// ValidLifetime and PreferredLifetime are in seconds, with 0xffffffff
+	// meaning forever.
+	ValidLifetime, PreferredLifetime uint32
+	Prefix                           net.IP
+}
+
+// ICMPv6RouteInfo is the body of a route information option.
+type ICMPv6RouteInfo struct {
+	PrefixLength uint8
+	Preference   ICMPv6RouterPreference
+	// Lifetime is in seconds, with 0xffffffff meaning forever.
+	Lifetime uint32
+	// Prefix is padded with zeros to 16 bytes.
+	Prefix net.IP
+}
+
+// ICMPv6RDNSS is the body of a recursive DNS server option.
+type ICMPv6RDNSS struct {
+	// Lifetime is in seconds, with 0xffffffff meaning forever.
+	Lifetime uint32
+	Servers  []net.IP
+}
+
+// ICMPv6DNSSL is the body of a DNS search list option.
+type ICMPv6DNSSL struct {
+	// Lifetime is in seconds, with 0xffffffff meaning forever.
+	Lifetime uint32
+	Domains  []string
+}
+
+// ICMPv6Option is a neighbor discovery option.
+type ICMPv6Option struct {
+	Type ICMPv6Opt
+	// Data is the body of the option, following its type and length.
+	Data []byte
+	// LinkLayerAddress, PrefixInfo, MTU, RouteInfo, RDNSS and DNSSL are the
+	// decoded body of options of those types, set when the option is well
+	// formed.  When serializing, an option with its typed body set is
+	// encoded from it, and Data is ignored.
+	LinkLayerAddress net.HardwareAddr
+	PrefixInfo       *ICMPv6PrefixInfo
+	MTU              uint32
+	RouteInfo        *ICMPv6RouteInfo
+	RDNSS            *ICMPv6RDNSS
+	DNSSL            *ICMPv6DNSSL
+}
+
+func (i ICMPv6Option) String() string {
+	switch {
+	case i.LinkLayerAddress != nil:
+		return fmt.Sprintf("ICMPv6Option(%s:%s)", i.Type, i.LinkLayerAddress)
+	case i.PrefixInfo != nil:
+		return fmt.Sprintf("ICMPv6Option(%s:%s/%d)", i.Type, i.PrefixInfo.Prefix, i.PrefixInfo.PrefixLength)
+	case i.Type == ICMPv6OptMTU && i.MTU != 0:
+		return fmt.Sprintf("ICMPv6Option(%s:%d)", i.Type, i.MTU)
+	case i.RouteInfo != nil:
+		return fmt.Sprintf("ICMPv6Option(%s:%s/%d)", i.Type, i.RouteInfo.Prefix, i.RouteInfo.PrefixLength)
+	case i.RDNSS != nil:
+		return fmt.Sprintf("ICMPv6Option(%s:%v)", i.Type, i.RDNSS.Servers)
+	case i.DNSSL != nil:
+		return fmt.Sprintf("ICMPv6Option(%s:%s)", i.Type, strings.Join(i.DNSSL.Domains, ","))
+	}
+	return fmt.Sprintf("ICMPv6Option(%s:%v)", i.Type, i.Data)
+}
+
+// ICMPv6Options is a list of neighbor discovery options.
+type ICMPv6Options []ICMPv6Option
+
+// Option returns the first option of type t, or nil if there's none.
+func (o ICMPv6Options) Option(t ICMPv6Opt) *ICMPv6Option {
+	for i := range o {
+		if o[i].Type == t {
+			return &o[i]
+		}
+	}
+	return nil
+}
+
+// DecodeFromBytes decodes the options in data.
+func (o *ICMPv6Options) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	*o = (*o)[:0]
+	for len(data) > 0 {
+		if len(data) < 2 {
+			df.SetTruncated()
+			return fmt.Errorf("ICMPv6 option truncated, %d bytes left", len(data))
+		}
+		length := int(data[1]) * 8
+		if length == 0 {
+			return fmt.Errorf("ICMPv6 %v option has zero length", ICMPv6Opt(data[0]))
+		}
+		if length > len(data) {
+			df.SetTruncated()
+			return fmt.Errorf("ICMPv6 %v option length %d exceeds %d remaining bytes", ICMPv6Opt(data[0]), length, len(data))
+		}
+		opt := ICMPv6Option{Type: ICMPv6Opt(data[0]), Data: data[2:length]}
+		opt.decodeTyped()
+		*o = append(*o, opt)
+		data = data[length:]
+	}
+	return nil
+}
+
+// decodeTyped sets the typed body of o from its Data, leaving it unset if
+// the option is malformed.
+func (o *ICMPv6Option) decodeTyped() {
+	data := o.Data
+	switch o.Type {
+	case ICMPv6OptSourceAddress, ICMPv6OptTargetAddress:
+		// The address fills the option, which for Ethernet is exactly 8
+		// bytes.  Other link layers may leave padding at the end.
+		if len(data) > 0 {
+			o.LinkLayerAddress = net.HardwareAddr(data)
+		}
+	case ICMPv6OptPrefixInfo:
+		if len(data) != 30 {
+			return
+		}
+		o.PrefixInfo = &ICMPv6PrefixInfo{
+			PrefixLength:      data[0],
+			OnLink:            data[1]&0x80 != 0,
+			Autonomous:        data[1]&0x40 != 0,
+			ValidLifetime:     binary.BigEndian.Uint32(data[2:6]),
+			PreferredLifetime: binary.BigEndian.Uint32(data[6:10]),
+			Prefix:            net.IP(data[14:30]),
+		}
+	case ICMPv6OptMTU:
+		if len(data) != 6 {
+			return
+		}
+		o.MTU = binary.BigEndian.Uint32(data[2:6])
+	case ICMPv6OptRouteInfo:
+		// The prefix is 0, 8 or 16 bytes long.
+		if len(data) != 6 && len(data) != 14 && len(data) != 22 {
+			return
+		}
+		r := &ICMPv6RouteInfo{
+			PrefixLength: data[0],
+			Preference:   ICMPv6RouterPreference(data[1]>>3) & 0x3,
+			Lifetime:     binary.BigEndian.Uint32(data[2:6]),
+			Prefix:       make(net.IP, net.IPv6len),
+		}
+		if int(r.PrefixLength) > 8*(len(data)-6) {
+			return
+		}
+		copy(r.Prefix, data[6:])
+		o.RouteInfo = r
+	case ICMPv6OptRDNSS:
+		if len(data) < 6 || (len(data)-6)%16 != 0 {
+			return
+		}
+		r := &ICMPv6RDNSS{Lifetime: binary.BigEndian.Uint32(data[2:6])}
+		for i := 6; i < len(data); i += 16 {
+			r.Servers = append(r.Servers, net.IP(data[i:i+16]))
+		}
+		o.RDNSS = r
+	case ICMPv6OptDNSSL:
+		if len(data) < 6 {
+			return
+		}
+		d := &ICMPv6DNSSL{Lifetime: binary.BigEndian.Uint32(data[2:6])}
+		names := data[6:]
+		for len(names) > 0 && names[0] != 0 {
+			var labels []string
+			for {
+				if len(names) == 0 {
+					return
+				}
+				n := int(names[0])
+				if n == 0 {
+					names = names[1:]
+					break
+				}
+				if n > 63 || 1+n > len(names) {
+					return
+				}
+				labels = append(labels, string(names[1:1+n]))
+				names = names[1+n:]
+			}
+			d.Domains = append(d.Domains, strings.Join(labels, "."))
+		}
+		o.DNSSL = d
+	}
+}
+
+// encodeTyped returns the body of o encoded from its typed body, or Data if
+// it has none.
+func (o *ICMPv6Option) encodeTyped() []byte {
+	switch o.Type {
+	case ICMPv6OptSourceAddress, ICMPv6OptTargetAddress:
+		if o.LinkLayerAddress != nil {
+			return o.LinkLayerAddress
+		}
+	case ICMPv6OptPrefixInfo:
+		if p := o.PrefixInfo; p != nil {
+			data := make([]byte, 30)
+			data[0] = p.PrefixLength
+			if p.OnLink {
+				data[1] |= 0x80
+			}
+			if p.Autonomous {
+				data[1] |= 0x40
+			}
+			binary.BigEndian.PutUint32(data[2:6], p.ValidLifetime)
+			binary.BigEndian.PutUint32(data[6:10], p.PreferredLifetime)
+			copy(data[14:30], p.Prefix.To16())
+			return data
+		}
+	case ICMPv6OptMTU:
+		if o.MTU != 0 {
+			data := make([]byte, 6)
+			binary.BigEndian.PutUint32(data[2:6], o.MTU)
+			return data
+		}
+	case ICMPv6OptRouteInfo:
+		if r := o.RouteInfo; r != nil {
+			n := (int(r.PrefixLength) + 63) / 64 * 8
+			if n > 16 {
+				n = 16
+			}
+			data := make([]byte, 6+n)
+			data[0] = r.PrefixLength
+			data[1] = uint8(r.Preference&0x3) << 3
+			binary.BigEndian.PutUint32(data[2:6], r.Lifetime)
+			copy(data[6:], r.Prefix.To16())
+			return data
+		}
+	case ICMPv6OptRDNSS:
+		if r := o.RDNSS; r != nil {
+			data := make([]byte, 6+16*len(r.Servers))
+			binary.BigEndian.PutUint32(data[2:6], r.Lifetime)
+			for i, s := range r.Servers {
+				copy(data[6+16*i:], s.To16())
+			}
+			return data
+		}
+	case ICMPv6OptDNSSL:
+		if d := o.DNSSL; d != nil {
+			data := make([]byte, 6)
+			binary.BigEndian.PutUint32(data[2:6], d.Lifetime)
+			for _, name := range d.Domains {
+				for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+					data = append(data, uint8(len(label)))
+					data = append(data, label...)
+				}
+				data = append(data, 0)
+			}
+			return data
+		}
+	}
+	return o.Data
+}
+
+// SerializeTo writes the options to b, padding each to a multiple of 8
+// bytes.
+func (o ICMPv6Options) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	for i := len(o) - 1; i >= 0; i-- {
+		data := o[i].encodeTyped()
+		length := (2 + len(data) + 7) / 8 * 8
+		if length > 255*8 {
+			return fmt.Errorf("ICMPv6 %v option too long: %d bytes", o[i].Type, length)
+		}
+		bytes, err := b.PrependBytes(length)
+		if err != nil {
+			return err
+		}
+		bytes[0] = uint8(o[i].Type)
+		bytes[1] = uint8(length / 8)
+		copy(bytes[2:], data)
+		for j := 2 + len(data); j < length; j++ {
+			bytes[j] = 0
+		}
+	}
+	return nil
+}
+
+// ICMPv6RouterSolicitation is a router solicitation message, following
+// its ICMPv6 header.
+type ICMPv6RouterSolicitation struct {
+	BaseLayer
+	Options ICMPv6Options
+}
+
+// ICMPv6RouterAdvertisement is a router advertisement message, following
+// its ICMPv6 header.
+type ICMPv6RouterAdvertisement struct {
+	BaseLayer
+	HopLimit       uint8
+	Flags          uint8
+	RouterLifetime uint16
+	ReachableTime  uint32
+	RetransTimer   uint32
+	Options        ICMPv6Options
+}
+
+// ICMPv6NeighborSolicitation is a neighbor solicitation message,
+// following its ICMPv6 header.
+type ICMPv6NeighborSolicitation struct {
+	BaseLayer
+	TargetAddress net.IP
+	Options       ICMPv6Options
+}
+
+// ICMPv6NeighborAdvertisement is a neighbor advertisement message,
+// following its ICMPv6 header.
+type ICMPv6NeighborAdvertisement struct {
+	BaseLayer
+	Flags         uint8
+	TargetAddress net.IP
+	Options       ICMPv6Options
+}
+
+// ICMPv6Redirect is a redirect message, following its ICMPv6 header.
+type ICMPv6Redirect struct {
+	BaseLayer
+	TargetAddress      net.IP
+	DestinationAddress net.IP
+	Options            ICMPv6Options
+}
+
+// LayerType returns LayerTypeICMPv6RouterSolicitation.
+func (i *ICMPv6RouterSolicitation) LayerType() gopacket.LayerType {
+	return LayerTypeICMPv6RouterSolicitation
+}
+
+// LayerType returns LayerTypeICMPv6RouterAdvertisement.
+func (i *ICMPv6RouterAdvertisement) LayerType() gopacket.LayerType {
+	return LayerTypeICMPv6RouterAdvertisement
+}
+
+// LayerType returns LayerTypeICMPv6NeighborSolicitation.
+func (i *ICMPv6NeighborSolicitation) LayerType() gopacket.LayerType {
+	return LayerTypeICMPv6NeighborSolicitation
+}
+
+// LayerType returns LayerTypeICMPv6NeighborAdvertisement.
+func (i *ICMPv6NeighborAdvertisement) LayerType() gopacket.LayerType {
+	return LayerTypeICMPv6NeighborAdvertisement
+}
+
+// LayerType returns LayerTypeICMPv6Redirect.
+func (i *ICMPv6Redirect) LayerType() gopacket.LayerType {
+	return LayerTypeICMPv6Redirect
+}
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (i *ICMPv6RouterSolicitation) CanDecode() gopacket.LayerClass {
+	return LayerTypeICMPv6RouterSolicitation
+}
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (i *ICMPv6RouterAdvertisement) CanDecode() gopacket.LayerClass {
+	return LayerTypeICMPv6RouterAdvertisement
+}
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (i *ICMPv6NeighborSolicitation) CanDecode() gopacket.LayerClass {
+	return LayerTypeICMPv6NeighborSolicitation
+}
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (i *ICMPv6NeighborAdvertisement) CanDecode() gopacket.LayerClass {
+	return LayerTypeICMPv6NeighborAdvertisement
+}
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (i *ICMPv6Redirect) CanDecode() gopacket.LayerClass {
+	return LayerTypeICMPv6Redirect
+}
+
+// NextLayerType returns the layer type contained by this DecodingLayer,
+// which is none, since options run to the end of the message.
+func (i *ICMPv6RouterSolicitation) NextLayerType() gopacket.LayerType {
+	return gopacket.LayerTypeZero
+}
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (i *ICMPv6RouterAdvertisement) NextLayerType() gopacket.LayerType {
+	return gopacket.LayerTypeZero
+}
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (i *ICMPv6NeighborSolicitation) NextLayerType() gopacket.LayerType {
+	return gopacket.LayerTypeZero
+}
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (i *ICMPv6NeighborAdvertisement) NextLayerType() gopacket.LayerType {
+	return gopacket.LayerTypeZero
+}
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (i *ICMPv6Redirect) NextLayerType() gopacket.LayerType {
+	return gopacket.LayerTypeZero
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (i *ICMPv6RouterSolicitation) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return fmt.Errorf("ICMPv6 router solicitation %d bytes, need 4", len(data))
+	}
+	i.BaseLayer = BaseLayer{Contents: data}
+	return i.Options.DecodeFromBytes(data[4:], df)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (i *ICMPv6RouterAdvertisement) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 12 {
+		df.SetTruncated()
+		return fmt.Errorf("ICMPv6 router advertisement %d bytes, need 12", len(data))
+	}
+	i.HopLimit = data[0]
+	i.Flags = data[1]
+	i.RouterLifetime = binary.BigEndian.Uint16(data[2:4])
+	i.ReachableTime = binary.BigEndian.Uint32(data[4:8])
+	i.RetransTimer = binary.BigEndian.Uint32(data[8:12])
+	i.BaseLayer = BaseLayer{Contents: data}
+	return i.Options.DecodeFromBytes(data[12:], df)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (i *ICMPv6NeighborSolicitation) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 20 {
+		df.SetTruncated()
+		return fmt.Errorf("ICMPv6 neighbor solicitation %d bytes, need 20", len(data))
+	}
+	i.TargetAddress = net.IP(data[4:20])
+	i.BaseLayer = BaseLayer{Contents: data}
+	return i.Options.DecodeFromBytes(data[20:], df)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (i *ICMPv6NeighborAdvertisement) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 20 {
+		df.SetTruncated()
+		return fmt.Errorf("ICMPv6 neighbor advertisement %d bytes, need 20", len(data))
+	}
+	i.Flags = data[0]
+	i.TargetAddress = net.IP(data[4:20])
+	i.BaseLayer = BaseLayer{Contents: data}
+	return i.Options.DecodeFromBytes(data[20:], df)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (i *ICMPv6Redirect) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 36 {
+		df.SetTruncated()
+		return fmt.Errorf("ICMPv6 redirect %d bytes, need 36", len(data))
+	}
+	i.TargetAddress = net.IP(data[4:20])
+	i.DestinationAddress = net.IP(data[20:36])
+	i.BaseLayer = BaseLayer{Contents: data}
+	return i.Options.DecodeFromBytes(data[36:], df)
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+func (i *ICMPv6RouterSolicitation) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	if err := i.Options.SerializeTo(b, opts); err != nil {
+		return err
+	}
+	bytes, err := b.PrependBytes(4)
+	if err != nil {
+		return err
+	}
+	copy(bytes, lotsOfZeros[:4])
+	return nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+func (i *ICMPv6RouterAdvertisement) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	if err := i.Options.SerializeTo(b, opts); err != nil {
+		return err
+	}
+	bytes, err := b.PrependBytes(12)
+	if err != nil {
+		return err
+	}
+	bytes[0] = i.HopLimit
+	bytes[1] = i.Flags
+	binary.BigEndian.PutUint16(bytes[2:], i.RouterLifetime)
+	binary.BigEndian.PutUint32(bytes[4:], i.ReachableTime)
+	binary.BigEndian.PutUint32(bytes[8:], i.RetransTimer)
+	return nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+func (i *ICMPv6NeighborSolicitation) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	if err := i.Options.SerializeTo(b, opts); err != nil {
+		return err
+	}
+	bytes, err := b.PrependBytes(20)
+	if err != nil {
+		return err
+	}
+	copy(bytes, lotsOfZeros[:4])
+	return putIPv6Address(bytes[4:20], i.TargetAddress)
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+func (i *ICMPv6NeighborAdvertisement) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	if err := i.Options.SerializeTo(b, opts); err != nil {
+		return err
+	}
+	bytes, err := b.PrependBytes(20)
+	if err != nil {
+		return err
+	}
+	bytes[0] = i.Flags
+	copy(bytes[1:4], lotsOfZeros[:3])
+	return putIPv6Address(bytes[4:20], i.TargetAddress)
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+func (i *ICMPv6Redirect) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	if err := i.Options.SerializeTo(b, opts); err != nil {
+		return err
+	}
+	bytes, err := b.PrependBytes(36)
+	if err != nil {
+		return err
+	}
+	copy(bytes, lotsOfZeros[:4])
+	if err := putIPv6Address(bytes[4:20], i.TargetAddress); err != nil {
+		return err
+	}
+	return putIPv6Address(bytes[20:36], i.DestinationAddress)
+}
+
+func putIPv6Address(b []byte, ip net.IP) error {
+	ip16 := ip.To16()
+	if ip16 == nil || ip.To4() != nil {
+		return fmt.Errorf("invalid IPv6 address %v", ip)
+	}
+	copy(b, ip16)
+	return nil
+}
+
+// ManagedAddressConfig returns the M flag, saying addresses are available
+// from DHCPv6.
+func (i *ICMPv6RouterAdvertisement) ManagedAddressConfig() bool {
+	return i.Flags&0x80 != 0
+}
+
+// OtherConfig returns the O flag, saying other configuration is available
+// from DHCPv6.
+func (i *ICMPv6RouterAdvertisement) OtherConfig() bool {
+	return i.Flags&0x40 != 0
+}
+
+// Preference returns the router's default router preference.
+func (i *ICMPv6RouterAdvertisement) Preference() ICMPv6RouterPreference {
+	return ICMPv6RouterPreference(i.Flags>>3) & 0x3
+}
+
+// Router returns the R flag, saying the sender is a router.
+func (i *ICMPv6NeighborAdvertisement) Router() bool {
+	return i.Flags&0x80 != 0
+}
+
+// Solicited returns the S flag, saying the advertisement answers a
+// solicitation.
+func (i *ICMPv6NeighborAdvertisement) Solicited() bool {
+	return i.Flags&0x40 != 0
+}
+
+// Override returns the O flag, saying the advertisement should override
+// cached link layer addresses.
+func (i *ICMPv6NeighborAdvertisement) Override() bool {
+	return i.Flags&0x20 != 0
+}
+
+func decodeICMPv6RouterSolicitation(data []byte, p gopacket.PacketBuilder) error {
+	i := &ICMPv6RouterSolicitation{}
+	return decodingLayerDecoder(i, data, p)
+}
+
+func decodeICMPv6RouterAdvertisement(data []byte, p gopacket.PacketBuilder) error {
+	i := &ICMPv6RouterAdvertisement{}
+	return decodingLayerDecoder(i, data, p)
+}
+
+func decodeICMPv6NeighborSolicitation(data []byte, p gopacket.PacketBuilder) error {
+	i := &ICMPv6NeighborSolicitation{}
+	return decodingLayerDecoder(i, data, p)
+}
+
+func decodeICMPv6NeighborAdvertisement(data []byte, p gopacket.PacketBuilder) error {
+	i := &ICMPv6NeighborAdvertisement{}
+	return decodingLayerDecoder(i, data, p)
+}
+
+func decodeICMPv6Redirect(data []byte, p gopacket.PacketBuilder) error {
+	i := &ICMPv6Redirect{}
+	return decodingLayerDecoder(i, data, p)
+}
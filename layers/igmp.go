@@ -109,19 +109,6 @@ type IGMPv1or2 struct {
 	Version         uint8
 }
 
-// decodeResponse dissects IGMPv1 or IGMPv2 packet.
-func (i *IGMPv1or2) decodeResponse(data []byte) error {
-	if len(data) < 8 {
-		return fmt.Errorf("IGMP packet too small")
-	}
-
-	i.MaxResponseTime = igmpTimeDecode(data[1])
-	i.Checksum = binary.BigEndian.Uint16(data[2:4])
-	i.GroupAddress = net.IP(data[4:8])
-
-	return nil
-}
-
 //  0                   1                   2                   3
 //  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
 // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
@@ -165,20 +152,25 @@ type IGMPv3GroupRecord struct {
 	NumberOfSources  uint16
 	MulticastAddress net.IP
 	SourceAddresses  []net.IP
-	AuxData          uint32 // NOT USED
+	// AuxData is AuxDataLen 32 bit words of auxiliary data, which no
+	// record types define yet.
+	AuxData []byte
 }
 
-func (i *IGMP) decodeIGMPv3MembershipReport(data []byte) error {
+func (i *IGMP) decodeIGMPv3MembershipReport(data []byte, df gopacket.DecodeFeedback) error {
 	if len(data) < 8 {
+		df.SetTruncated()
 		return fmt.Errorf("IGMPv3 Membership Report too small #1")
 	}
 
 	i.Checksum = binary.BigEndian.Uint16(data[2:4])
 	i.NumberOfGroupRecords = binary.BigEndian.Uint16(data[6:8])
+	i.GroupRecords = i.GroupRecords[:0]
 
 	recordOffset := 8
 	for j := 0; j < int(i.NumberOfGroupRecords); j++ {
 		if len(data) < recordOffset+8 {
+			df.SetTruncated()
 			return fmt.Errorf("IGMPv3 Membership Report too small #2")
 		}
 
@@ -188,7 +180,10 @@ func (i *IGMP) decodeIGMPv3MembershipReport(data []byte) error {
 		gr.NumberOfSources = binary.BigEndian.Uint16(data[recordOffset+2 : recordOffset+4])
 		gr.MulticastAddress = net.IP(data[recordOffset+4 : recordOffset+8])
 
-		if len(data) < recordOffset+8+int(gr.NumberOfSources)*4 {
+		sourcesEnd := recordOffset + 8 + int(gr.NumberOfSources)*4
+		recordEnd := sourcesEnd + int(gr.AuxDataLen)*4
+		if len(data) < recordEnd {
+			df.SetTruncated()
 			return fmt.Errorf("IGMPv3 Membership Report too small #3")
 		}
 
@@ -197,10 +192,14 @@ func (i *IGMP) decodeIGMPv3MembershipReport(data []byte) error {
 			sourceAddr := net.IP(data[recordOffset+8+i*4 : recordOffset+12+i*4])
 			gr.SourceAddresses = append(gr.SourceAddresses, sourceAddr)
 		}
+		if gr.AuxDataLen > 0 {
+			gr.AuxData = data[sourcesEnd:recordEnd]
+		}
 
 		i.GroupRecords = append(i.GroupRecords, gr)
-		recordOffset += 8 + 4*int(gr.NumberOfSources)
+		recordOffset = recordEnd
 	}
+	i.BaseLayer = BaseLayer{Contents: data[:recordOffset], Payload: data[recordOffset:]}
 	return nil
 }
 
@@ -221,8 +220,9 @@ func (i *IGMP) decodeIGMPv3MembershipReport(data []byte) error {
 // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 //
 // decodeIGMPv3MembershipQuery parses the IGMPv3 message of type 0x11
-func (i *IGMP) decodeIGMPv3MembershipQuery(data []byte) error {
+func (i *IGMP) decodeIGMPv3MembershipQuery(data []byte, df gopacket.DecodeFeedback) error {
 	if len(data) < 12 {
+		df.SetTruncated()
 		return fmt.Errorf("IGMPv3 Membership Query too small #1")
 	}
 
@@ -231,17 +231,21 @@ func (i *IGMP) decodeIGMPv3MembershipQuery(data []byte) error {
 	i.SupressRouterProcessing = data[8]&0x8 != 0
 	i.GroupAddress = net.IP(data[4:8])
 	i.RobustnessValue = data[8] & 0x7
-	i.IntervalTime = igmpTimeDecode(data[9])
+	// The QQIC has the same format as MLDv2's, in seconds.
+	i.IntervalTime = mldv2IntervalDecode(data[9])
 	i.NumberOfSources = binary.BigEndian.Uint16(data[10:12])
 
-	if len(data) < 12+int(i.NumberOfSources)*4 {
+	end := 12 + int(i.NumberOfSources)*4
+	if len(data) < end {
+		df.SetTruncated()
 		return fmt.Errorf("IGMPv3 Membership Query too small #2")
 	}
 
+	i.SourceAddresses = i.SourceAddresses[:0]
 	for j := 0; j < int(i.NumberOfSources); j++ {
 		i.SourceAddresses = append(i.SourceAddresses, net.IP(data[12+j*4:16+j*4]))
 	}
-
+	i.BaseLayer = BaseLayer{Contents: data[:end], Payload: data[end:]}
 	return nil
 }
 
@@ -251,28 +255,87 @@ func igmpTimeDecode(t uint8) time.Duration {
 	if t&0x80 == 0 {
 		return time.Millisecond * 100 * time.Duration(t)
 	}
-	mant := (t & 0x70) >> 4
-	exp := t & 0x0F
-	return time.Millisecond * 100 * time.Duration((mant|0x10)<<(exp+3))
+	exp := (t & 0x70) >> 4
+	mant := t & 0x0F
+	return time.Millisecond * 100 * time.Duration(uint32(mant|0x10)<<(exp+3))
+}
+
+// igmpTimeEncode encodes d as a maximum response code, rounding down; the
+// reverse of igmpTimeDecode.
+func igmpTimeEncode(d time.Duration) uint8 {
+	t := uint64(d / (100 * time.Millisecond))
+	if t < 0x80 {
+		return uint8(t)
+	}
+	for exp := uint(0); exp < 8; exp++ {
+		if v := t >> (exp + 3); v <= 0x1f {
+			return 0x80 | uint8(exp)<<4 | uint8(v&0xf)
+		}
+	}
+	return 0xff
 }
 
 // LayerType returns LayerTypeIGMP for the V1,2,3 message protocol formats.
 func (i *IGMP) LayerType() gopacket.LayerType      { return LayerTypeIGMP }
 func (i *IGMPv1or2) LayerType() gopacket.LayerType { return LayerTypeIGMP }
 
+// DecodeFromBytes decodes the given bytes into this layer.
 func (i *IGMPv1or2) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
 	if len(data) < 8 {
-		fmt.Errorf("IGMP Packet too small")
+		df.SetTruncated()
+		return fmt.Errorf("IGMP Packet too small")
 	}
 
 	i.Type = IGMPType(data[0])
-	i.MaxResponseTime = igmpTimeDecode(data[1])
+	// IGMPv2 maximum response times are plain tenths of seconds, unlike
+	// IGMPv3 maximum response codes.
+	i.MaxResponseTime = time.Duration(data[1]) * 100 * time.Millisecond
 	i.Checksum = binary.BigEndian.Uint16(data[2:4])
 	i.GroupAddress = net.IP(data[4:8])
+	i.BaseLayer = BaseLayer{Contents: data[:8], Payload: data[8:]}
 
 	return nil
 }
 
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+func (i *IGMPv1or2) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	bytes, err := b.PrependBytes(8)
+	if err != nil {
+		return err
+	}
+	bytes[0] = uint8(i.Type)
+	t := i.MaxResponseTime / (100 * time.Millisecond)
+	if t > 0xff {
+		return fmt.Errorf("IGMPv2 maximum response time %v too long", i.MaxResponseTime)
+	}
+	bytes[1] = uint8(t)
+	if err := putIGMPAddress(bytes[4:8], i.GroupAddress); err != nil {
+		return err
+	}
+	if opts.ComputeChecksums {
+		bytes[2], bytes[3] = 0, 0
+		i.Checksum = tcpipChecksum(bytes, 0)
+	}
+	binary.BigEndian.PutUint16(bytes[2:4], i.Checksum)
+	return nil
+}
+
+// putIGMPAddress writes ip to b, writing zeros for a nil ip, as in general
+// queries.
+func putIGMPAddress(b []byte, ip net.IP) error {
+	if ip == nil {
+		copy(b, net.IPv4zero.To4())
+		return nil
+	}
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return fmt.Errorf("invalid IGMP address %v", ip)
+	}
+	copy(b, ip4)
+	return nil
+}
+
 func (i *IGMPv1or2) NextLayerType() gopacket.LayerType {
 	return gopacket.LayerTypeZero
 }
@@ -292,16 +355,111 @@ func (i *IGMP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
 
 	switch i.Type {
 	case IGMPMembershipQuery:
-		i.decodeIGMPv3MembershipQuery(data)
+		return i.decodeIGMPv3MembershipQuery(data, df)
 	case IGMPMembershipReportV3:
-		i.decodeIGMPv3MembershipReport(data)
-	default:
-		return fmt.Errorf("unsupported IGMP type")
+		return i.decodeIGMPv3MembershipReport(data, df)
 	}
+	return fmt.Errorf("unsupported IGMP type")
+}
 
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.  Only
+// IGMPv3 membership queries and reports are supported; IGMPv1or2
+// serializes the other messages.
+func (i *IGMP) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	var bytes []byte
+	var err error
+	switch i.Type {
+	case IGMPMembershipQuery:
+		bytes, err = i.serializeIGMPv3MembershipQuery(b, opts)
+	case IGMPMembershipReportV3:
+		bytes, err = i.serializeIGMPv3MembershipReport(b, opts)
+	default:
+		return fmt.Errorf("unsupported IGMPv3 type %v", i.Type)
+	}
+	if err != nil {
+		return err
+	}
+	bytes[0] = uint8(i.Type)
+	if opts.ComputeChecksums {
+		bytes[2], bytes[3] = 0, 0
+		i.Checksum = tcpipChecksum(bytes, 0)
+	}
+	binary.BigEndian.PutUint16(bytes[2:4], i.Checksum)
 	return nil
 }
 
+func (i *IGMP) serializeIGMPv3MembershipQuery(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) ([]byte, error) {
+	if opts.FixLengths {
+		i.NumberOfSources = uint16(len(i.SourceAddresses))
+	}
+	bytes, err := b.PrependBytes(12 + 4*len(i.SourceAddresses))
+	if err != nil {
+		return nil, err
+	}
+	bytes[1] = igmpTimeEncode(i.MaxResponseTime)
+	if err := putIGMPAddress(bytes[4:8], i.GroupAddress); err != nil {
+		return nil, err
+	}
+	bytes[8] = i.RobustnessValue & 0x7
+	if i.SupressRouterProcessing {
+		bytes[8] |= 0x8
+	}
+	bytes[9] = mldv2IntervalEncode(i.IntervalTime)
+	binary.BigEndian.PutUint16(bytes[10:12], i.NumberOfSources)
+	for j, s := range i.SourceAddresses {
+		if err := putIGMPAddress(bytes[12+4*j:16+4*j], s); err != nil {
+			return nil, err
+		}
+	}
+	return bytes, nil
+}
+
+func (i *IGMP) serializeIGMPv3MembershipReport(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) ([]byte, error) {
+	length := 8
+	for j := range i.GroupRecords {
+		gr := &i.GroupRecords[j]
+		if opts.FixLengths {
+			gr.NumberOfSources = uint16(len(gr.SourceAddresses))
+			gr.AuxDataLen = uint8((len(gr.AuxData) + 3) / 4)
+		}
+		length += 8 + 4*len(gr.SourceAddresses) + 4*int(gr.AuxDataLen)
+	}
+	if opts.FixLengths {
+		i.NumberOfGroupRecords = uint16(len(i.GroupRecords))
+	}
+	bytes, err := b.PrependBytes(length)
+	if err != nil {
+		return nil, err
+	}
+	bytes[1] = 0
+	bytes[4], bytes[5] = 0, 0
+	binary.BigEndian.PutUint16(bytes[6:8], i.NumberOfGroupRecords)
+	offset := 8
+	for _, gr := range i.GroupRecords {
+		bytes[offset] = uint8(gr.Type)
+		bytes[offset+1] = gr.AuxDataLen
+		binary.BigEndian.PutUint16(bytes[offset+2:offset+4], gr.NumberOfSources)
+		if err := putIGMPAddress(bytes[offset+4:offset+8], gr.MulticastAddress); err != nil {
+			return nil, err
+		}
+		offset += 8
+		for _, s := range gr.SourceAddresses {
+			if err := putIGMPAddress(bytes[offset:offset+4], s); err != nil {
+				return nil, err
+			}
+			offset += 4
+		}
+		aux := bytes[offset : offset+4*int(gr.AuxDataLen)]
+		copy(aux, gr.AuxData)
+		for k := len(gr.AuxData); k < len(aux); k++ {
+			aux[k] = 0
+		}
+		offset += len(aux)
+	}
+	return bytes, nil
+}
+
 // CanDecode returns the set of layer types that this DecodingLayer can decode.
 func (i *IGMP) CanDecode() gopacket.LayerClass {
 	return LayerTypeIGMP
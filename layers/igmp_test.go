@@ -7,7 +7,11 @@
 package layers
 
 import (
+	"bytes"
+	"net"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/mistsys/gopacket"
 )
@@ -68,6 +72,16 @@ func TestIGMPv2MembershipQuery(t *testing.T) {
 	if igmp.Type != IGMPMembershipQuery {
 		t.Fatal("Invalid IGMP type")
 	}
+	if igmp.MaxResponseTime != 10*time.Second {
+		t.Errorf("got max response time %v", igmp.MaxResponseTime)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := igmp.SerializeTo(buf, gopacket.SerializeOptions{ComputeChecksums: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), igmp.Contents) {
+		t.Errorf("serialized %x, want %x", buf.Bytes(), igmp.Contents)
+	}
 }
 func BenchmarkDecodeigmpv2MembershipQueryPacket(b *testing.B) {
 	for i := 0; i < b.N; i++ {
@@ -130,6 +144,10 @@ func TestIGMPv3MembershipQuery(t *testing.T) {
 	if igmp.Type != IGMPMembershipQuery {
 		t.Fatal("Invalid IGMP type")
 	}
+	if igmp.MaxResponseTime != 2400*time.Millisecond || igmp.IntervalTime != 20*time.Second || igmp.RobustnessValue != 2 {
+		t.Errorf("got %+v", igmp)
+	}
+	testSerialization(t, p, igmp3v3MembershipQueryPacket)
 }
 
 func BenchmarkDecodeigmp3v3MembershipQueryPacket(b *testing.B) {
@@ -162,6 +180,14 @@ func TestIGMPv3MembershipReport2Records(t *testing.T) {
 	if igmp.Type != IGMPMembershipReportV3 {
 		t.Fatal("Invalid IGMP type")
 	}
+	want := []IGMPv3GroupRecord{
+		{Type: IGMPIsEx, MulticastAddress: net.IP{239, 195, 7, 2}},
+		{Type: IGMPIsEx, MulticastAddress: net.IP{239, 255, 255, 250}},
+	}
+	if !reflect.DeepEqual(igmp.GroupRecords, want) {
+		t.Errorf("got records %+v, want %+v", igmp.GroupRecords, want)
+	}
+	testSerialization(t, p, igmpv3MembershipReport2Records)
 }
 
 func BenchmarkDecodeigmpv3MembershipReport2Records(b *testing.B) {
@@ -169,3 +195,77 @@ func BenchmarkDecodeigmpv3MembershipReport2Records(b *testing.B) {
 		gopacket.NewPacket(igmpv3MembershipReport2Records, LinkTypeEthernet, gopacket.NoCopy)
 	}
 }
+
+func TestIGMPv3MembershipReportSerialize(t *testing.T) {
+	report := &IGMP{
+		Type: IGMPMembershipReportV3,
+		GroupRecords: []IGMPv3GroupRecord{
+			{
+				Type:             IGMPToIn,
+				MulticastAddress: net.IP{232, 1, 1, 1},
+				SourceAddresses:  []net.IP{{192, 0, 2, 1}, {192, 0, 2, 2}},
+				AuxData:          []byte{1, 2, 3, 4, 5},
+			},
+			{Type: IGMPBlock, MulticastAddress: net.IP{232, 1, 1, 2}, SourceAddresses: []net.IP{{192, 0, 2, 3}}},
+		},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := report.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if len(data) != 8+8+8+8+8+4 {
+		t.Fatalf("serialized %d bytes: %x", len(data), data)
+	}
+	if tcpipChecksum(data, 0) != 0 {
+		t.Errorf("bad checksum %#04x", report.Checksum)
+	}
+	p := gopacket.NewPacket(data, LayerTypeIGMP, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	got := p.Layer(LayerTypeIGMP).(*IGMP)
+	report.GroupRecords[0].AuxData = append(report.GroupRecords[0].AuxData, 0, 0, 0)
+	if got.NumberOfGroupRecords != 2 || !reflect.DeepEqual(got.GroupRecords, report.GroupRecords) {
+		t.Errorf("got %+v, want %+v", got.GroupRecords, report.GroupRecords)
+	}
+
+	report.GroupRecords[1].SourceAddresses = []net.IP{net.ParseIP("2001:db8::1")}
+	if err := report.SerializeTo(gopacket.NewSerializeBuffer(), gopacket.SerializeOptions{}); err == nil {
+		t.Error("serialized IPv6 source address")
+	}
+	v2 := &IGMPv1or2{Type: IGMPMembershipQuery, MaxResponseTime: time.Minute}
+	if err := v2.SerializeTo(gopacket.NewSerializeBuffer(), gopacket.SerializeOptions{}); err == nil {
+		t.Error("serialized IGMPv2 maximum response time of a minute")
+	}
+}
+
+func TestIGMPv3MembershipReportTruncated(t *testing.T) {
+	// One record with one source and one word of aux data, missing the aux
+	// data.
+	data := []byte{0x22, 0, 0, 0, 0, 0, 0, 1, 1, 1, 0, 1, 232, 1, 1, 1, 192, 0, 2, 1}
+	p := gopacket.NewPacket(data, LayerTypeIGMP, gopacket.Default)
+	if p.ErrorLayer() == nil {
+		t.Error("decoded truncated report")
+	}
+}
+
+func TestIGMPTimeCode(t *testing.T) {
+	for _, test := range []struct {
+		code uint8
+		d    time.Duration
+	}{
+		{0x00, 0},
+		{0x7f, 12700 * time.Millisecond},
+		{0x80, 12800 * time.Millisecond},
+		{0x8f, 24800 * time.Millisecond},
+		{0xff, 31744 * 100 * time.Millisecond},
+	} {
+		if got := igmpTimeDecode(test.code); got != test.d {
+			t.Errorf("decode %#02x: got %v, want %v", test.code, got, test.d)
+		}
+		if got := igmpTimeEncode(test.d); got != test.code {
+			t.Errorf("encode %v: got %#02x, want %#02x", test.d, got, test.code)
+		}
+	}
+}
@@ -0,0 +1,736 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// IKEExchangeType is the exchange an IKE message belongs to.
+type IKEExchangeType uint8
+
+const (
+	// IKEv1 exchanges (RFC 2408, RFC 2409).
+	IKEExchangeIdentityProtection IKEExchangeType = 2 // main mode
+	IKEExchangeAggressive         IKEExchangeType = 4
+	IKEExchangeInformationalV1    IKEExchangeType = 5
+	IKEExchangeQuickMode          IKEExchangeType = 32
+	// IKEv2 exchanges (RFC 7296).
+	IKEExchangeSAInit        IKEExchangeType = 34
+	IKEExchangeAuth          IKEExchangeType = 35
+	IKEExchangeCreateChildSA IKEExchangeType = 36
+	IKEExchangeInformational IKEExchangeType = 37
+)
+
+func (t IKEExchangeType) String() string {
+	switch t {
+	case IKEExchangeIdentityProtection:
+		return "Identity Protection"
+	case IKEExchangeAggressive:
+		return "Aggressive"
+	case IKEExchangeInformationalV1:
+		return "Informational (IKEv1)"
+	case IKEExchangeQuickMode:
+		return "Quick Mode"
+	case IKEExchangeSAInit:
+		return "IKE_SA_INIT"
+	case IKEExchangeAuth:
+		return "IKE_AUTH"
+	case IKEExchangeCreateChildSA:
+		return "CREATE_CHILD_SA"
+	case IKEExchangeInformational:
+		return "INFORMATIONAL"
+	default:
+		return fmt.Sprintf("UnknownIKEExchangeType(%d)", uint8(t))
+	}
+}
+
+// IKEPayloadType is the type of an IKE payload.  IKEv1 and IKEv2 use
+// distinct ranges.
+type IKEPayloadType uint8
+
+const (
+	IKEPayloadNone IKEPayloadType = 0
+	// IKEv1 payloads.
+	IKEPayloadSAV1             IKEPayloadType = 1
+	IKEPayloadProposalV1       IKEPayloadType = 2
+	IKEPayloadTransformV1      IKEPayloadType = 3
+	IKEPayloadKeyExchangeV1    IKEPayloadType = 4
+	IKEPayloadIdentificationV1 IKEPayloadType = 5
+	IKEPayloadCertificateV1    IKEPayloadType = 6
+	IKEPayloadCertRequestV1    IKEPayloadType = 7
+	IKEPayloadHashV1           IKEPayloadType = 8
+	IKEPayloadSignatureV1      IKEPayloadType = 9
+	IKEPayloadNonceV1          IKEPayloadType = 10
+	IKEPayloadNotificationV1   IKEPayloadType = 11
+	IKEPayloadDeleteV1         IKEPayloadType = 12
+	IKEPayloadVendorIDV1       IKEPayloadType = 13
+	IKEPayloadNATDV1           IKEPayloadType = 20
+	IKEPayloadNATOAV1          IKEPayloadType = 21
+	// IKEv2 payloads.
+	IKEPayloadSA                IKEPayloadType = 33
+	IKEPayloadKeyExchange       IKEPayloadType = 34
+	IKEPayloadIDInitiator       IKEPayloadType = 35
+	IKEPayloadIDResponder       IKEPayloadType = 36
+	IKEPayloadCertificate       IKEPayloadType = 37
+	IKEPayloadCertRequest       IKEPayloadType = 38
+	IKEPayloadAuthentication    IKEPayloadType = 39
+	IKEPayloadNonce             IKEPayloadType = 40
+	IKEPayloadNotify            IKEPayloadType = 41
+	IKEPayloadDelete            IKEPayloadType = 42
+	IKEPayloadVendorID          IKEPayloadType = 43
+	IKEPayloadTSInitiator       IKEPayloadType = 44
+	IKEPayloadTSResponder       IKEPayloadType = 45
+	IKEPayloadEncrypted         IKEPayloadType = 46
+	IKEPayloadConfiguration     IKEPayloadType = 47
+	IKEPayloadEAP               IKEPayloadType = 48
+	IKEPayloadEncryptedFragment IKEPayloadType = 53
+)
+
+var ikePayloadTypeNames = map[IKEPayloadType]string{
+	IKEPayloadNone:              "None",
+	IKEPayloadSAV1:              "SA (IKEv1)",
+	IKEPayloadProposalV1:        "Proposal (IKEv1)",
+	IKEPayloadTransformV1:       "Transform (IKEv1)",
+	IKEPayloadKeyExchangeV1:     "Key Exchange (IKEv1)",
+	IKEPayloadIdentificationV1:  "Identification (IKEv1)",
+	IKEPayloadCertificateV1:     "Certificate (IKEv1)",
+	IKEPayloadCertRequestV1:     "Certificate Request (IKEv1)",
+	IKEPayloadHashV1:            "Hash (IKEv1)",
+	IKEPayloadSignatureV1:       "Signature (IKEv1)",
+	IKEPayloadNonceV1:           "Nonce (IKEv1)",
+	IKEPayloadNotificationV1:    "Notification (IKEv1)",
+	IKEPayloadDeleteV1:          "Delete (IKEv1)",
+	IKEPayloadVendorIDV1:        "Vendor ID (IKEv1)",
+	IKEPayloadNATDV1:            "NAT Discovery (IKEv1)",
+	IKEPayloadNATOAV1:           "NAT Original Address (IKEv1)",
+	IKEPayloadSA:                "Security Association",
+	IKEPayloadKeyExchange:       "Key Exchange",
+	IKEPayloadIDInitiator:       "Identification - Initiator",
+	IKEPayloadIDResponder:       "Identification - Responder",
+	IKEPayloadCertificate:       "Certificate",
+	IKEPayloadCertRequest:       "Certificate Request",
+	IKEPayloadAuthentication:    "Authentication",
+	IKEPayloadNonce:             "Nonce",
+	IKEPayloadNotify:            "Notify",
+	IKEPayloadDelete:            "Delete",
+	IKEPayloadVendorID:          "Vendor ID",
+	IKEPayloadTSInitiator:       "Traffic Selector - Initiator",
+	IKEPayloadTSResponder:       "Traffic Selector - Responder",
+	IKEPayloadEncrypted:         "Encrypted and Authenticated",
+	IKEPayloadConfiguration:     "Configuration",
+	IKEPayloadEAP:               "EAP",
+	IKEPayloadEncryptedFragment: "Encrypted and Authenticated Fragment",
+}
+
+func (t IKEPayloadType) String() string {
+	if name, ok := ikePayloadTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("UnknownIKEPayloadType(%d)", uint8(t))
+}
+
+// IKEFlags are the flags of the IKE header.
+type IKEFlags uint8
+
+const (
+	// IKEv1 flags.
+	IKEFlagEncryption IKEFlags = 0x01
+	IKEFlagCommit     IKEFlags = 0x02
+	IKEFlagAuthOnly   IKEFlags = 0x04
+	// IKEv2 flags.
+	IKEFlagInitiator IKEFlags = 0x08
+	IKEFlagVersion   IKEFlags = 0x10
+	IKEFlagResponse  IKEFlags = 0x20
+)
+
+// IKEProtocolID is the protocol a proposal or notification is about.
+type IKEProtocolID uint8
+
+const (
+	IKEProtocolIKE IKEProtocolID = 1
+	IKEProtocolAH  IKEProtocolID = 2
+	IKEProtocolESP IKEProtocolID = 3
+)
+
+func (p IKEProtocolID) String() string {
+	switch p {
+	case IKEProtocolIKE:
+		return "IKE"
+	case IKEProtocolAH:
+		return "AH"
+	case IKEProtocolESP:
+		return "ESP"
+	default:
+		return fmt.Sprintf("UnknownIKEProtocolID(%d)", uint8(p))
+	}
+}
+
+// IKETransformType is the type of an IKEv2 transform.  The meaning of a
+// transform ID depends on it.
+type IKETransformType uint8
+
+const (
+	IKETransformEncryption IKETransformType = 1
+	IKETransformPRF        IKETransformType = 2
+	IKETransformIntegrity  IKETransformType = 3
+	IKETransformDHGroup    IKETransformType = 4
+	IKETransformESN        IKETransformType = 5
+)
+
+func (t IKETransformType) String() string {
+	switch t {
+	case IKETransformEncryption:
+		return "Encryption Algorithm"
+	case IKETransformPRF:
+		return "Pseudorandom Function"
+	case IKETransformIntegrity:
+		return "Integrity Algorithm"
+	case IKETransformDHGroup:
+		return "Diffie-Hellman Group"
+	case IKETransformESN:
+		return "Extended Sequence Numbers"
+	default:
+		return fmt.Sprintf("UnknownIKETransformType(%d)", uint8(t))
+	}
+}
+
+// IKEAttributeKeyLength is the transform attribute giving the key length
+// in bits of variable length ciphers.
+const IKEAttributeKeyLength = 14
+
+// IKETransformAttribute is an attribute of a transform.  Short attributes
+// have a two byte Value.
+type IKETransformAttribute struct {
+	Type  uint16
+	Value []byte
+}
+
+// IKETransform is a transform of an IKEv2 proposal.
+type IKETransform struct {
+	Type IKETransformType
+	ID   uint16
+	// KeyLength is the value of the key length attribute, or zero if the
+	// transform has none.
+	KeyLength  uint16
+	Attributes []IKETransformAttribute
+}
+
+// IKEProposal is a proposal of an IKEv2 SA payload.
+type IKEProposal struct {
+	Number     uint8
+	Protocol   IKEProtocolID
+	SPI        []byte
+	Transforms []IKETransform
+}
+
+// IKEKeyExchange is an IKEv2 key exchange payload.
+type IKEKeyExchange struct {
+	DHGroup uint16
+	Data    []byte
+}
+
+// IKEIDType is the type of an identification payload.
+type IKEIDType uint8
+
+const (
+	IKEIDIPv4Address IKEIDType = 1
+	IKEIDFQDN        IKEIDType = 2
+	IKEIDRFC822      IKEIDType = 3
+	IKEIDIPv6Address IKEIDType = 5
+	IKEIDDERASN1DN   IKEIDType = 9
+	IKEIDDERASN1GN   IKEIDType = 10
+	IKEIDKeyID       IKEIDType = 11
+)
+
+func (t IKEIDType) String() string {
+	switch t {
+	case IKEIDIPv4Address:
+		return "IPv4 Address"
+	case IKEIDFQDN:
+		return "FQDN"
+	case IKEIDRFC822:
+		return "RFC 822 Address"
+	case IKEIDIPv6Address:
+		return "IPv6 Address"
+	case IKEIDDERASN1DN:
+		return "DER ASN.1 DN"
+	case IKEIDDERASN1GN:
+		return "DER ASN.1 GN"
+	case IKEIDKeyID:
+		return "Key ID"
+	default:
+		return fmt.Sprintf("UnknownIKEIDType(%d)", uint8(t))
+	}
+}
+
+// IKEIdentification is an IKEv2 identification payload.
+type IKEIdentification struct {
+	Type IKEIDType
+	Data []byte
+}
+
+// IKENotifyType is the type of an IKEv2 notification.  Types below 16384
+// report errors, the others status.
+type IKENotifyType uint16
+
+const (
+	IKENotifyUnsupportedCriticalPayload IKENotifyType = 1
+	IKENotifyInvalidIKESPI              IKENotifyType = 4
+	IKENotifyInvalidMajorVersion        IKENotifyType = 5
+	IKENotifyInvalidSyntax              IKENotifyType = 7
+	IKENotifyInvalidMessageID           IKENotifyType = 9
+	IKENotifyInvalidSPI                 IKENotifyType = 11
+	IKENotifyNoProposalChosen           IKENotifyType = 14
+	IKENotifyInvalidKEPayload           IKENotifyType = 17
+	IKENotifyAuthenticationFailed       IKENotifyType = 24
+	IKENotifySinglePairRequired         IKENotifyType = 34
+	IKENotifyNoAdditionalSAs            IKENotifyType = 35
+	IKENotifyInternalAddressFailure     IKENotifyType = 36
+	IKENotifyFailedCPRequired           IKENotifyType = 37
+	IKENotifyTSUnacceptable             IKENotifyType = 38
+	IKENotifyInvalidSelectors           IKENotifyType = 39
+	IKENotifyTemporaryFailure           IKENotifyType = 43
+	IKENotifyChildSANotFound            IKENotifyType = 44
+	IKENotifyInitialContact             IKENotifyType = 16384
+	IKENotifySetWindowSize              IKENotifyType = 16385
+	IKENotifyAdditionalTSPossible       IKENotifyType = 16386
+	IKENotifyIPCompSupported            IKENotifyType = 16387
+	IKENotifyNATDetectionSourceIP       IKENotifyType = 16388
+	IKENotifyNATDetectionDestinationIP  IKENotifyType = 16389
+	IKENotifyCookie                     IKENotifyType = 16390
+	IKENotifyUseTransportMode           IKENotifyType = 16391
+	IKENotifyRekeySA                    IKENotifyType = 16393
+	IKENotifyMOBIKESupported            IKENotifyType = 16396
+	IKENotifyFragmentationSupported     IKENotifyType = 16430
+	IKENotifySignatureHashAlgorithms    IKENotifyType = 16431
+)
+
+var ikeNotifyTypeNames = map[IKENotifyType]string{
+	IKENotifyUnsupportedCriticalPayload: "UNSUPPORTED_CRITICAL_PAYLOAD",
+	IKENotifyInvalidIKESPI:              "INVALID_IKE_SPI",
+	IKENotifyInvalidMajorVersion:        "INVALID_MAJOR_VERSION",
+	IKENotifyInvalidSyntax:              "INVALID_SYNTAX",
+	IKENotifyInvalidMessageID:           "INVALID_MESSAGE_ID",
+	IKENotifyInvalidSPI:                 "INVALID_SPI",
+	IKENotifyNoProposalChosen:           "NO_PROPOSAL_CHOSEN",
+	IKENotifyInvalidKEPayload:           "INVALID_KE_PAYLOAD",
+	IKENotifyAuthenticationFailed:       "AUTHENTICATION_FAILED",
+	IKENotifySinglePairRequired:         "SINGLE_PAIR_REQUIRED",
+	IKENotifyNoAdditionalSAs:            "NO_ADDITIONAL_SAS",
+	IKENotifyInternalAddressFailure:     "INTERNAL_ADDRESS_FAILURE",
+	IKENotifyFailedCPRequired:           "FAILED_CP_REQUIRED",
+	IKENotifyTSUnacceptable:             "TS_UNACCEPTABLE",
+	IKENotifyInvalidSelectors:           "INVALID_SELECTORS",
+	IKENotifyTemporaryFailure:           "TEMPORARY_FAILURE",
+	IKENotifyChildSANotFound:            "CHILD_SA_NOT_FOUND",
+	IKENotifyInitialContact:             "INITIAL_CONTACT",
+	IKENotifySetWindowSize:              "SET_WINDOW_SIZE",
+	IKENotifyAdditionalTSPossible:       "ADDITIONAL_TS_POSSIBLE",
+	IKENotifyIPCompSupported:            "IPCOMP_SUPPORTED",
+	IKENotifyNATDetectionSourceIP:       "NAT_DETECTION_SOURCE_IP",
+	IKENotifyNATDetectionDestinationIP:  "NAT_DETECTION_DESTINATION_IP",
+	IKENotifyCookie:                     "COOKIE",
+	IKENotifyUseTransportMode:           "USE_TRANSPORT_MODE",
+	IKENotifyRekeySA:                    "REKEY_SA",
+	IKENotifyMOBIKESupported:            "MOBIKE_SUPPORTED",
+	IKENotifyFragmentationSupported:     "IKEV2_FRAGMENTATION_SUPPORTED",
+	IKENotifySignatureHashAlgorithms:    "SIGNATURE_HASH_ALGORITHMS",
+}
+
+func (t IKENotifyType) String() string {
+	if name, ok := ikeNotifyTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("UnknownIKENotifyType(%d)", uint16(t))
+}
+
+// IsError reports whether the notification reports an error.
+func (t IKENotifyType) IsError() bool { return t < 16384 }
+
+// IKENotify is an IKEv2 notify payload.
+type IKENotify struct {
+	Protocol IKEProtocolID
+	SPI      []byte
+	Type     IKENotifyType
+	Data     []byte
+}
+
+// IKEPayload is a raw IKE payload.  NextPayload is the type of the
+// payload following it, which for the last payload is normally
+// IKEPayloadNone, except for an Encrypted payload, where it's the type of
+// the first payload it encrypts.
+type IKEPayload struct {
+	Type        IKEPayloadType
+	NextPayload IKEPayloadType
+	// Critical is the IKEv2 critical bit, telling the receiver to reject
+	// the message if it doesn't know the payload type.
+	Critical bool
+	Body     []byte
+}
+
+// IKE is an ISAKMP message, of IKEv1 (RFC 2409) or IKEv2 (RFC 7296), on
+// UDP port 500, or after the non-ESP marker on port 4500.
+//
+// The header is decoded into the fields up to Length, and the payload
+// chain into Payloads.  For IKEv2 the SA, key exchange, identification,
+// nonce and notify payloads are decoded into their own fields.  Payloads
+// after an Encrypted payload are encrypted, and so are all payloads of
+// IKEv1 messages with IKEFlagEncryption set, which are left in Encrypted.
+type IKE struct {
+	BaseLayer
+	InitiatorSPI uint64
+	ResponderSPI uint64
+	NextPayload  IKEPayloadType
+	MajorVersion uint8
+	MinorVersion uint8
+	ExchangeType IKEExchangeType
+	Flags        IKEFlags
+	MessageID    uint32
+	Length       uint32
+	Payloads     []IKEPayload
+
+	Proposals     []IKEProposal
+	KeyExchange   *IKEKeyExchange
+	InitiatorID   *IKEIdentification
+	ResponderID   *IKEIdentification
+	Nonce         []byte
+	Notifications []IKENotify
+	// Encrypted holds the payloads of an encrypted IKEv1 message.
+	Encrypted []byte
+}
+
+// LayerType returns LayerTypeIKE.
+func (i *IKE) LayerType() gopacket.LayerType { return LayerTypeIKE }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (i *IKE) CanDecode() gopacket.LayerClass { return LayerTypeIKE }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (i *IKE) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+func decodeIKE(data []byte, p gopacket.PacketBuilder) error {
+	return decodingLayerDecoder(&IKE{}, data, p)
+}
+
+const ikeHeaderLength = 28
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (i *IKE) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < ikeHeaderLength {
+		df.SetTruncated()
+		return fmt.Errorf("IKE length %d too short", len(data))
+	}
+	i.InitiatorSPI = binary.BigEndian.Uint64(data[0:8])
+	i.ResponderSPI = binary.BigEndian.Uint64(data[8:16])
+	i.NextPayload = IKEPayloadType(data[16])
+	i.MajorVersion = data[17] >> 4
+	i.MinorVersion = data[17] & 0xf
+	i.ExchangeType = IKEExchangeType(data[18])
+	i.Flags = IKEFlags(data[19])
+	i.MessageID = binary.BigEndian.Uint32(data[20:24])
+	i.Length = binary.BigEndian.Uint32(data[24:28])
+	if i.Length < ikeHeaderLength {
+		return fmt.Errorf("IKE header length %d too short", i.Length)
+	}
+	if int64(i.Length) > int64(len(data)) {
+		df.SetTruncated()
+		return fmt.Errorf("IKE header length %d exceeds message length %d", i.Length, len(data))
+	}
+	data = data[:i.Length]
+
+	i.Payloads = i.Payloads[:0]
+	i.Proposals, i.Notifications = i.Proposals[:0], i.Notifications[:0]
+	i.KeyExchange, i.InitiatorID, i.ResponderID = nil, nil, nil
+	i.Nonce, i.Encrypted = nil, nil
+	i.BaseLayer = BaseLayer{Contents: data}
+	if i.MajorVersion == 1 && i.Flags&IKEFlagEncryption != 0 {
+		i.Encrypted = data[ikeHeaderLength:]
+		return nil
+	}
+	next, rest := i.NextPayload, data[ikeHeaderLength:]
+	for next != IKEPayloadNone {
+		if len(rest) < 4 {
+			df.SetTruncated()
+			return fmt.Errorf("IKE %v payload header truncated", next)
+		}
+		n := int(binary.BigEndian.Uint16(rest[2:4]))
+		if n < 4 || n > len(rest) {
+			return fmt.Errorf("IKE %v payload length %d invalid", next, n)
+		}
+		pl := IKEPayload{Type: next, NextPayload: IKEPayloadType(rest[0]), Body: rest[4:n]}
+		if i.MajorVersion == 2 {
+			pl.Critical = rest[1]&0x80 != 0
+			if err := i.decodePayload(pl); err != nil {
+				return err
+			}
+		}
+		i.Payloads = append(i.Payloads, pl)
+		if pl.Type == IKEPayloadEncrypted || pl.Type == IKEPayloadEncryptedFragment {
+			break
+		}
+		next, rest = pl.NextPayload, rest[n:]
+	}
+	return nil
+}
+
+func (i *IKE) decodePayload(pl IKEPayload) error {
+	b := pl.Body
+	switch pl.Type {
+	case IKEPayloadSA:
+		return i.decodeProposals(b)
+	case IKEPayloadKeyExchange:
+		if len(b) < 4 {
+			return fmt.Errorf("IKE key exchange payload length %d too short", len(b))
+		}
+		i.KeyExchange = &IKEKeyExchange{DHGroup: binary.BigEndian.Uint16(b[0:2]), Data: b[4:]}
+	case IKEPayloadIDInitiator, IKEPayloadIDResponder:
+		if len(b) < 4 {
+			return fmt.Errorf("IKE identification payload length %d too short", len(b))
+		}
+		id := &IKEIdentification{Type: IKEIDType(b[0]), Data: b[4:]}
+		if pl.Type == IKEPayloadIDInitiator {
+			i.InitiatorID = id
+		} else {
+			i.ResponderID = id
+		}
+	case IKEPayloadNonce:
+		i.Nonce = b
+	case IKEPayloadNotify:
+		if len(b) < 4 || len(b) < 4+int(b[1]) {
+			return fmt.Errorf("IKE notify payload length %d too short", len(b))
+		}
+		spi := 4 + int(b[1])
+		i.Notifications = append(i.Notifications, IKENotify{
+			Protocol: IKEProtocolID(b[0]),
+			SPI:      b[4:spi],
+			Type:     IKENotifyType(binary.BigEndian.Uint16(b[2:4])),
+			Data:     b[spi:],
+		})
+	}
+	return nil
+}
+
+func (i *IKE) decodeProposals(b []byte) error {
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return fmt.Errorf("IKE proposal length %d too short", len(b))
+		}
+		last := b[0] == 0
+		n := int(binary.BigEndian.Uint16(b[2:4]))
+		if n < 8 || n > len(b) {
+			return fmt.Errorf("IKE proposal length %d invalid", n)
+		}
+		spi := 8 + int(b[6])
+		if spi > n {
+			return fmt.Errorf("IKE proposal SPI size %d exceeds proposal", b[6])
+		}
+		p := IKEProposal{Number: b[4], Protocol: IKEProtocolID(b[5]), SPI: b[8:spi]}
+		t := b[spi:n]
+		for j := 0; j < int(b[7]); j++ {
+			tr, m, err := decodeIKETransform(t)
+			if err != nil {
+				return err
+			}
+			p.Transforms = append(p.Transforms, tr)
+			t = t[m:]
+		}
+		i.Proposals = append(i.Proposals, p)
+		if last {
+			break
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// decodeIKETransform decodes the transform at the start of b, and returns
+// its length.
+func decodeIKETransform(b []byte) (IKETransform, int, error) {
+	var t IKETransform
+	if len(b) < 8 {
+		return t, 0, fmt.Errorf("IKE transform length %d too short", len(b))
+	}
+	n := int(binary.BigEndian.Uint16(b[2:4]))
+	if n < 8 || n > len(b) {
+		return t, 0, fmt.Errorf("IKE transform length %d invalid", n)
+	}
+	t.Type = IKETransformType(b[4])
+	t.ID = binary.BigEndian.Uint16(b[6:8])
+	for a := b[8:n]; len(a) > 0; {
+		if len(a) < 4 {
+			return t, 0, fmt.Errorf("IKE transform attribute length %d too short", len(a))
+		}
+		typ := binary.BigEndian.Uint16(a[0:2])
+		attr := IKETransformAttribute{Type: typ & 0x7fff}
+		if typ&0x8000 != 0 {
+			attr.Value, a = a[2:4], a[4:]
+			if attr.Type == IKEAttributeKeyLength {
+				t.KeyLength = binary.BigEndian.Uint16(attr.Value)
+			}
+		} else {
+			m := 4 + int(binary.BigEndian.Uint16(a[2:4]))
+			if m > len(a) {
+				return t, 0, fmt.Errorf("IKE transform attribute length %d exceeds transform", m-4)
+			}
+			attr.Value, a = a[4:m], a[m:]
+		}
+		t.Attributes = append(t.Attributes, attr)
+	}
+	return t, n, nil
+}
+
+// SerializeTo writes the header and Payloads into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.  The
+// header's NextPayload and the NextPayload of each payload but the last
+// are set from the types of the payloads.  The typed fields aren't
+// serialized, nor Encrypted.
+// See the docs for gopacket.SerializableLayer for more info.
+func (i *IKE) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	n := ikeHeaderLength
+	for _, pl := range i.Payloads {
+		if len(pl.Body) > 0xffff-4 {
+			return fmt.Errorf("IKE %v payload length %d too long", pl.Type, len(pl.Body))
+		}
+		n += 4 + len(pl.Body)
+	}
+	bytes, err := b.PrependBytes(n)
+	if err != nil {
+		return err
+	}
+	next := i.NextPayload
+	if len(i.Payloads) > 0 {
+		next = i.Payloads[0].Type
+	}
+	if opts.FixLengths {
+		i.Length = uint32(len(b.Bytes()))
+	}
+	binary.BigEndian.PutUint64(bytes[0:8], i.InitiatorSPI)
+	binary.BigEndian.PutUint64(bytes[8:16], i.ResponderSPI)
+	bytes[16] = uint8(next)
+	bytes[17] = i.MajorVersion<<4 | i.MinorVersion&0xf
+	bytes[18] = uint8(i.ExchangeType)
+	bytes[19] = uint8(i.Flags)
+	binary.BigEndian.PutUint32(bytes[20:24], i.MessageID)
+	binary.BigEndian.PutUint32(bytes[24:28], i.Length)
+	off := ikeHeaderLength
+	for j, pl := range i.Payloads {
+		next = pl.NextPayload
+		if j+1 < len(i.Payloads) {
+			next = i.Payloads[j+1].Type
+		}
+		bytes[off] = uint8(next)
+		bytes[off+1] = 0
+		if pl.Critical {
+			bytes[off+1] = 0x80
+		}
+		binary.BigEndian.PutUint16(bytes[off+2:off+4], uint16(4+len(pl.Body)))
+		copy(bytes[off+4:], pl.Body)
+		off += 4 + len(pl.Body)
+	}
+	return nil
+}
+
+// IPSecUDPEncapType is the kind of packet carried by UDP encapsulated
+// IPsec.
+type IPSecUDPEncapType uint8
+
+const (
+	// IPSecUDPEncapESP is an ESP packet.
+	IPSecUDPEncapESP IPSecUDPEncapType = iota
+	// IPSecUDPEncapIKE is an IKE message, after the non-ESP marker.
+	IPSecUDPEncapIKE
+	// IPSecUDPEncapKeepalive is a NAT keepalive, a single 0xff byte.
+	IPSecUDPEncapKeepalive
+)
+
+func (t IPSecUDPEncapType) String() string {
+	switch t {
+	case IPSecUDPEncapESP:
+		return "ESP"
+	case IPSecUDPEncapIKE:
+		return "IKE"
+	case IPSecUDPEncapKeepalive:
+		return "Keepalive"
+	}
+	return fmt.Sprintf("UnknownIPSecUDPEncapType(%d)", uint8(t))
+}
+
+// IPSecUDPEncap marks a packet on UDP port 4500, which NAT traversal
+// (RFC 3948) uses for both ESP and IKE.  IKE messages are preceded by a
+// non-ESP marker of four zero bytes where ESP has its SPI, which are the
+// layer's contents.  The contents of a keepalive are its single byte.
+type IPSecUDPEncap struct {
+	BaseLayer
+	Type IPSecUDPEncapType
+}
+
+// LayerType returns LayerTypeIPSecUDPEncap.
+func (e *IPSecUDPEncap) LayerType() gopacket.LayerType { return LayerTypeIPSecUDPEncap }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (e *IPSecUDPEncap) CanDecode() gopacket.LayerClass { return LayerTypeIPSecUDPEncap }
+
+// NextLayerType returns LayerTypeIKE or LayerTypeIPSecESP, depending on
+// Type.
+func (e *IPSecUDPEncap) NextLayerType() gopacket.LayerType {
+	switch e.Type {
+	case IPSecUDPEncapESP:
+		return LayerTypeIPSecESP
+	case IPSecUDPEncapIKE:
+		return LayerTypeIKE
+	}
+	return gopacket.LayerTypeZero
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (e *IPSecUDPEncap) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	switch {
+	case len(data) == 1 && data[0] == 0xff:
+		e.Type = IPSecUDPEncapKeepalive
+		e.BaseLayer = BaseLayer{Contents: data}
+	case len(data) < 8:
+		df.SetTruncated()
+		return fmt.Errorf("UDP encapsulated IPsec length %d too short", len(data))
+	case binary.BigEndian.Uint32(data[:4]) == 0:
+		e.Type = IPSecUDPEncapIKE
+		e.BaseLayer = BaseLayer{Contents: data[:4], Payload: data[4:]}
+	default:
+		e.Type = IPSecUDPEncapESP
+		e.BaseLayer = BaseLayer{Payload: data}
+	}
+	return nil
+}
+
+// SerializeTo writes the non-ESP marker or keepalive byte, if Type needs
+// one, into the SerializationBuffer, implementing
+// gopacket.SerializableLayer.
+// See the docs for gopacket.SerializableLayer for more info.
+func (e *IPSecUDPEncap) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	switch e.Type {
+	case IPSecUDPEncapIKE:
+		bytes, err := b.PrependBytes(4)
+		if err != nil {
+			return err
+		}
+		copy(bytes, []byte{0, 0, 0, 0})
+	case IPSecUDPEncapKeepalive:
+		bytes, err := b.PrependBytes(1)
+		if err != nil {
+			return err
+		}
+		bytes[0] = 0xff
+	}
+	return nil
+}
+
+func decodeIPSecUDPEncap(data []byte, p gopacket.PacketBuilder) error {
+	return decodingLayerDecoder(&IPSecUDPEncap{}, data, p)
+}
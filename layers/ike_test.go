@@ -0,0 +1,140 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testIKESAInit returns an IKE_SA_INIT request with one proposal of
+// AES-CBC-128, HMAC-SHA2-256 PRF and DH group 14, a key exchange, a nonce
+// and a NAT detection notification.
+func testIKESAInit() *IKE {
+	sa := []byte{0, 0, 0, 36, 1, 1, 0, 3}
+	sa = append(sa, 3, 0, 0, 12, 1, 0, 0, 12, 0x80, 0x0e, 0x00, 0x80)
+	sa = append(sa, 3, 0, 0, 8, 2, 0, 0, 5)
+	sa = append(sa, 0, 0, 0, 8, 4, 0, 0, 14)
+	return &IKE{
+		InitiatorSPI: 0x0102030405060708,
+		MajorVersion: 2,
+		ExchangeType: IKEExchangeSAInit,
+		Flags:        IKEFlagInitiator,
+		Payloads: []IKEPayload{
+			{Type: IKEPayloadSA, Body: sa},
+			{Type: IKEPayloadKeyExchange, Body: []byte{0, 14, 0, 0, 0xde, 0xad, 0xbe, 0xef}},
+			{Type: IKEPayloadNonce, Body: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+			{Type: IKEPayloadNotify, Body: []byte{0, 0, 0x40, 0x04, 9, 9, 9, 9}},
+		},
+	}
+}
+
+func serializeIKE(t *testing.T, port UDPPort, ls ...gopacket.SerializableLayer) gopacket.Packet {
+	eth := &Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{6, 7, 8, 9, 10, 11}, EthernetType: EthernetTypeIPv4}
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &UDP{SrcPort: port, DstPort: port}
+	buf := gopacket.NewSerializeBuffer()
+	ls = append([]gopacket.SerializableLayer{eth, ip, udp}, ls...)
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ls...); err != nil {
+		t.Fatal(err)
+	}
+	return gopacket.NewPacket(buf.Bytes(), LinkTypeEthernet, gopacket.Default)
+}
+
+func TestIKESAInit(t *testing.T) {
+	p := serializeIKE(t, 500, testIKESAInit())
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeIPv4, LayerTypeUDP, LayerTypeIKE}, t)
+	ike := p.Layer(LayerTypeIKE).(*IKE)
+	if ike.InitiatorSPI != 0x0102030405060708 || ike.MajorVersion != 2 || ike.ExchangeType != IKEExchangeSAInit ||
+		ike.Flags != IKEFlagInitiator || ike.NextPayload != IKEPayloadSA || ike.Length != uint32(len(ike.Contents)) {
+		t.Errorf("got header %+v", ike)
+	}
+	if len(ike.Payloads) != 4 || ike.Payloads[3].NextPayload != IKEPayloadNone {
+		t.Fatalf("got payloads %+v", ike.Payloads)
+	}
+	want := []IKEProposal{{
+		Number:   1,
+		Protocol: IKEProtocolIKE,
+		SPI:      []byte{},
+		Transforms: []IKETransform{
+			{Type: IKETransformEncryption, ID: 12, KeyLength: 128, Attributes: []IKETransformAttribute{{IKEAttributeKeyLength, []byte{0, 0x80}}}},
+			{Type: IKETransformPRF, ID: 5},
+			{Type: IKETransformDHGroup, ID: 14},
+		},
+	}}
+	if !reflect.DeepEqual(ike.Proposals, want) {
+		t.Errorf("got proposals %+v, want %+v", ike.Proposals, want)
+	}
+	if ke := ike.KeyExchange; ke == nil || ke.DHGroup != 14 || !bytes.Equal(ke.Data, []byte{0xde, 0xad, 0xbe, 0xef}) {
+		t.Errorf("got key exchange %+v", ke)
+	}
+	if !bytes.Equal(ike.Nonce, []byte{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("got nonce %x", ike.Nonce)
+	}
+	if len(ike.Notifications) != 1 || ike.Notifications[0].Type != IKENotifyNATDetectionSourceIP || len(ike.Notifications[0].Data) != 4 {
+		t.Errorf("got notifications %+v", ike.Notifications)
+	}
+}
+
+func TestIKEEncrypted(t *testing.T) {
+	ike := &IKE{
+		MajorVersion: 2,
+		ExchangeType: IKEExchangeAuth,
+		Payloads:     []IKEPayload{{Type: IKEPayloadEncrypted, NextPayload: IKEPayloadIDInitiator, Body: repeatByte(0x55, 32)}},
+	}
+	p := serializeIKE(t, 500, ike)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	got := p.Layer(LayerTypeIKE).(*IKE)
+	if len(got.Payloads) != 1 || got.Payloads[0].NextPayload != IKEPayloadIDInitiator || got.InitiatorID != nil {
+		t.Errorf("got payloads %+v, identification %+v", got.Payloads, got.InitiatorID)
+	}
+}
+
+func TestIPSecUDPEncap(t *testing.T) {
+	p := serializeIKE(t, 4500, &IPSecUDPEncap{Type: IPSecUDPEncapIKE}, testIKESAInit())
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeIPv4, LayerTypeUDP, LayerTypeIPSecUDPEncap, LayerTypeIKE}, t)
+	if ike := p.Layer(LayerTypeIKE).(*IKE); ike.InitiatorSPI != 0x0102030405060708 || len(ike.Proposals) != 1 {
+		t.Errorf("got IKE %+v", ike)
+	}
+
+	esp := gopacket.Payload{0, 0, 0x12, 0x34, 0, 0, 0, 1, 0xaa, 0xbb}
+	p = serializeIKE(t, 4500, esp)
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeIPv4, LayerTypeUDP, LayerTypeIPSecUDPEncap, LayerTypeIPSecESP}, t)
+	if e := p.Layer(LayerTypeIPSecESP).(*IPSecESP); e.SPI != 0x1234 || e.Seq != 1 {
+		t.Errorf("got ESP %+v", e)
+	}
+
+	p = serializeIKE(t, 4500, &IPSecUDPEncap{Type: IPSecUDPEncapKeepalive})
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeIPv4, LayerTypeUDP, LayerTypeIPSecUDPEncap}, t)
+	if e := p.Layer(LayerTypeIPSecUDPEncap).(*IPSecUDPEncap); e.Type != IPSecUDPEncapKeepalive {
+		t.Errorf("got type %v, want keepalive", e.Type)
+	}
+}
+
+func TestIKETruncated(t *testing.T) {
+	buf := gopacket.NewSerializeBuffer()
+	if err := testIKESAInit().SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	p := gopacket.NewPacket(b[:len(b)-4], LayerTypeIKE, gopacket.Default)
+	if p.ErrorLayer() == nil || !p.Metadata().Truncated {
+		t.Error("truncated message decoded without error")
+	}
+}
@@ -38,6 +38,32 @@ func (f IPv4Flag) String() string {
 	return strings.Join(s, "|")
 }
 
+// IPECN is the explicit congestion notification codepoint of an IPv4 or
+// IPv6 packet, the low two bits of its TOS or traffic class.  L4S traffic
+// is sent as ECT(1).
+type IPECN uint8
+
+const (
+	IPECNNotECT IPECN = 0
+	IPECNECT1   IPECN = 1
+	IPECNECT0   IPECN = 2
+	IPECNCE     IPECN = 3
+)
+
+func (e IPECN) String() string {
+	switch e {
+	case IPECNNotECT:
+		return "Not-ECT"
+	case IPECNECT1:
+		return "ECT(1)"
+	case IPECNECT0:
+		return "ECT(0)"
+	case IPECNCE:
+		return "CE"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(e))
+}
+
 // IPv4 is the header of an IP packet.
 type IPv4 struct {
 	BaseLayer
@@ -57,6 +83,9 @@ type IPv4 struct {
 	Padding    []byte
 }
 
+// ECN returns the packet's ECN codepoint.
+func (ip *IPv4) ECN() IPECN { return IPECN(ip.TOS & 3) }
+
 // LayerType returns LayerTypeIPv4
 func (i *IPv4) LayerType() gopacket.LayerType { return LayerTypeIPv4 }
 func (i *IPv4) NetworkFlow() gopacket.Flow {
@@ -67,6 +96,13 @@ type IPv4Option struct {
 	OptionType   uint8
 	OptionLength uint8
 	OptionData   []byte
+	// Route, Timestamp and RouterAlert are the decoded body of options of
+	// those types, set when the option is well formed.  When serializing,
+	// an option with its typed body set is encoded from it, and
+	// OptionData and OptionLength are ignored.
+	Route       *IPv4RouteOption
+	Timestamp   *IPv4TimestampOption
+	RouterAlert *IPv4RouterAlertOption
 }
 
 func (i IPv4Option) String() string {
@@ -100,6 +136,9 @@ func (ip *IPv4) getIPv4OptionSize() uint8 {
 // SerializeTo writes the serialized form of this layer into the
 // SerializationBuffer, implementing gopacket.SerializableLayer.
 func (ip *IPv4) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	for i := range ip.Options {
+		ip.Options[i].encodeTyped()
+	}
 	optionLength := ip.getIPv4OptionSize()
 	bytes, err := b.PrependBytes(20 + int(optionLength))
 	if err != nil {
@@ -107,6 +146,9 @@ func (ip *IPv4) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeO
 	}
 	if opts.FixLengths {
 		ip.IHL = 5 + (optionLength / 4)
+		if len(b.Bytes()) > 65535 {
+			return fmt.Errorf("IPv4 length %d exceeds 65535", len(b.Bytes()))
+		}
 		ip.Length = uint16(len(b.Bytes()))
 	}
 	bytes[0] = (ip.Version << 4) | ip.IHL
@@ -139,13 +181,17 @@ func (ip *IPv4) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeO
 			bytes[curLocation+1] = opt.OptionLength
 
 			// sanity checking to protect us from buffer overrun
-			if len(opt.OptionData) > int(opt.OptionLength-2) {
+			if opt.OptionLength < 2 || len(opt.OptionData) > int(opt.OptionLength-2) {
 				return fmt.Errorf("option length is smaller than length of option data")
 			}
 			copy(bytes[curLocation+2:curLocation+int(opt.OptionLength)], opt.OptionData)
 			curLocation += int(opt.OptionLength)
 		}
 	}
+	// Pad with end of option list bytes.
+	for ; curLocation < len(bytes); curLocation++ {
+		bytes[curLocation] = 0
+	}
 
 	if opts.ComputeChecksums {
 		// Clear checksum bytes
@@ -208,6 +254,8 @@ func (ip *IPv4) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
 	// From here on, data contains the header options.
 	data = data[20 : ip.IHL*4]
 	// Pull out IP options
+	ip.Options = ip.Options[:0]
+	ip.Padding = nil
 	for len(data) > 0 {
 		if ip.Options == nil {
 			// Pre-allocate to avoid growing the slice too much.
@@ -215,22 +263,28 @@ func (ip *IPv4) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
 		}
 		opt := IPv4Option{OptionType: data[0]}
 		switch opt.OptionType {
-		case 0: // End of options
+		case IPv4OptionEndOfList:
 			opt.OptionLength = 1
 			ip.Options = append(ip.Options, opt)
 			ip.Padding = data[1:]
-			break
-		case 1: // 1 byte padding
+			return nil
+		case IPv4OptionNoOperation:
 			opt.OptionLength = 1
 		default:
+			if len(data) < 2 {
+				return fmt.Errorf("IP option type %v truncated", opt.OptionType)
+			}
 			opt.OptionLength = data[1]
+			if opt.OptionLength < 2 {
+				return fmt.Errorf("Invalid IP option type %v length %v", opt.OptionType, opt.OptionLength)
+			}
+			if len(data) < int(opt.OptionLength) {
+				return fmt.Errorf("IP option length exceeds remaining IP header size, option type %v length %v", opt.OptionType, opt.OptionLength)
+			}
 			opt.OptionData = data[2:opt.OptionLength]
+			opt.decodeTyped()
 		}
-		if len(data) >= int(opt.OptionLength) {
-			data = data[opt.OptionLength:]
-		} else {
-			return fmt.Errorf("IP option length exceeds remaining IP header size, option type %v length %v", opt.OptionType, opt.OptionLength)
-		}
+		data = data[opt.OptionLength:]
 		ip.Options = append(ip.Options, opt)
 	}
 	return nil
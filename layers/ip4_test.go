@@ -9,7 +9,12 @@
 package layers
 
 import (
+	"bytes"
+	"net"
+	"reflect"
 	"testing"
+
+	"github.com/mistsys/gopacket"
 )
 
 // Test the function getIPv4OptionSize when the ipv4 has no options
@@ -53,3 +58,79 @@ func TestGetIPOptLengthOptionEndOfList(t *testing.T) {
 		t.Fatalf("The list should have 12 length.  Actual %d", length)
 	}
 }
+
+func TestIPv4TypedOptions(t *testing.T) {
+	a, b := net.IP{192, 0, 2, 1}, net.IP{192, 0, 2, 2}
+	ip := &IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: IPProtocolNoNextHeader,
+		SrcIP:    net.IP{10, 0, 0, 1},
+		DstIP:    net.IP{10, 0, 0, 2},
+		Options: []IPv4Option{
+			{OptionType: IPv4OptionLooseSourceRoute, Route: &IPv4RouteOption{Pointer: 8, Addresses: []net.IP{a, b}}},
+			{OptionType: IPv4OptionTimestamp, Timestamp: &IPv4TimestampOption{Pointer: 13, Flag: IPv4TimestampWithAddress,
+				Entries: []IPv4TimestampEntry{{Address: a, Timestamp: 1000}, {Address: net.IPv4zero.To4()}}}},
+			{OptionType: IPv4OptionRouterAlert, RouterAlert: &IPv4RouterAlertOption{}},
+		},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	// Dirty the buffer, so padding that isn't written shows up.
+	buf.PrependBytes(64)
+	buf.Clear()
+	if err := ip.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x4e, 0x00, 0x00, 0x38, 0x00, 0x00, 0x00, 0x00, 0x40, 0x3b, 0x00, 0x00,
+		0x0a, 0x00, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x02,
+		// Loose source route.
+		0x83, 0x0b, 0x08, 0xc0, 0x00, 0x02, 0x01, 0xc0, 0x00, 0x02, 0x02,
+		// Timestamp.
+		0x44, 0x14, 0x0d, 0x01, 0xc0, 0x00, 0x02, 0x01, 0x00, 0x00, 0x03, 0xe8,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// Router alert, and padding.
+		0x94, 0x04, 0x00, 0x00, 0x00,
+	}
+	got := buf.Bytes()
+	got[10], got[11] = 0, 0
+	if !bytes.Equal(got, want) {
+		t.Fatalf("serialized\n%x\nwant\n%x", got, want)
+	}
+
+	var dec IPv4
+	if err := dec.DecodeFromBytes(got, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if len(dec.Options) != 4 || dec.Options[3].OptionType != IPv4OptionEndOfList {
+		t.Fatalf("decoded options %v", dec.Options)
+	}
+	for i, opt := range ip.Options {
+		d := dec.Options[i]
+		if !reflect.DeepEqual(d.Route, opt.Route) || !reflect.DeepEqual(d.Timestamp, opt.Timestamp) || !reflect.DeepEqual(d.RouterAlert, opt.RouterAlert) {
+			t.Errorf("option %d: decoded %+v, want %+v", i, d, opt)
+		}
+	}
+	sr := dec.SourceRoute()
+	if sr == nil || sr.Route.Next() != 1 || !sr.Route.Addresses[sr.Route.Next()].Equal(b) {
+		t.Errorf("source route %+v, want next hop %v", sr, b)
+	}
+	if dec.Option(IPv4OptionRecordRoute) != nil {
+		t.Error("found record route option")
+	}
+}
+
+func TestIPv4BadOptions(t *testing.T) {
+	hdr := []byte{0x46, 0x00, 0x00, 0x18, 0x00, 0x00, 0x00, 0x00, 0x40, 0x3b, 0x00, 0x00,
+		0x0a, 0x00, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x02}
+	for _, opts := range [][]byte{
+		{0x01, 0x01, 0x01, 0x07},
+		{0x07, 0x01, 0x00, 0x00},
+		{0x07, 0x08, 0x04, 0x00},
+	} {
+		var ip IPv4
+		if err := ip.DecodeFromBytes(append(append([]byte(nil), hdr...), opts...), gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("options %x decoded without error: %v", opts, ip.Options)
+		}
+	}
+}
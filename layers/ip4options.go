@@ -0,0 +1,204 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// IPv4 option types, including the copied flag and class bits, as found in
+// IPv4Option.OptionType.
+const (
+	IPv4OptionEndOfList         uint8 = 0
+	IPv4OptionNoOperation       uint8 = 1
+	IPv4OptionRecordRoute       uint8 = 7
+	IPv4OptionTimestamp         uint8 = 68
+	IPv4OptionLooseSourceRoute  uint8 = 131
+	IPv4OptionStrictSourceRoute uint8 = 137
+	IPv4OptionRouterAlert       uint8 = 148
+)
+
+// IPv4RouteOption is the body of a record route, loose source route or
+// strict source route option, as defined in RFC 791.
+type IPv4RouteOption struct {
+	// Pointer is the offset within the option, counting from 1, of the
+	// next address to record or route through.  It's 4 in a fresh option.
+	Pointer uint8
+	// Addresses holds every slot of the option, including the ones the
+	// pointer hasn't reached yet.
+	Addresses []net.IP
+}
+
+// Next returns the index in Addresses of the slot Pointer refers to, which
+// is len(Addresses) once the route is exhausted or the option is full.
+func (r *IPv4RouteOption) Next() int {
+	if r.Pointer < 4 {
+		return 0
+	}
+	n := int(r.Pointer-4) / 4
+	if n > len(r.Addresses) {
+		return len(r.Addresses)
+	}
+	return n
+}
+
+// IPv4TimestampFlag says what an IPv4 timestamp option records.
+type IPv4TimestampFlag uint8
+
+const (
+	// IPv4TimestampOnly options record timestamps alone.
+	IPv4TimestampOnly IPv4TimestampFlag = 0
+	// IPv4TimestampWithAddress options record each router's address with
+	// its timestamp.
+	IPv4TimestampWithAddress IPv4TimestampFlag = 1
+	// IPv4TimestampPrespecified options list the addresses of the routers
+	// that should record a timestamp.
+	IPv4TimestampPrespecified IPv4TimestampFlag = 3
+)
+
+// IPv4TimestampEntry is one slot of an IPv4 timestamp option.
+type IPv4TimestampEntry struct {
+	// Address is nil in IPv4TimestampOnly options.
+	Address net.IP
+	// Timestamp is in milliseconds since midnight UT, unless its high bit
+	// is set to mark a non-standard time.
+	Timestamp uint32
+}
+
+// IPv4TimestampOption is the body of an IPv4 timestamp option, as defined
+// in RFC 791.
+type IPv4TimestampOption struct {
+	// Pointer is the offset within the option, counting from 1, of the
+	// next free slot.  It's 5 in a fresh option.
+	Pointer uint8
+	// Overflow is the number of routers that couldn't record a timestamp
+	// because the option was full.
+	Overflow uint8
+	Flag     IPv4TimestampFlag
+	// Entries holds every slot of the option, including unused ones.
+	Entries []IPv4TimestampEntry
+}
+
+func (t *IPv4TimestampOption) entrySize() int {
+	if t.Flag == IPv4TimestampOnly {
+		return 4
+	}
+	return 8
+}
+
+// IPv4RouterAlertOption is the body of an IPv4 router alert option, as
+// defined in RFC 2113.
+type IPv4RouterAlertOption struct {
+	// Value is 0 when routers should examine the packet.
+	Value uint16
+}
+
+// decodeTyped sets the typed body of o from its OptionData, leaving it nil
+// if the option is malformed.
+func (o *IPv4Option) decodeTyped() {
+	data := o.OptionData
+	switch o.OptionType {
+	case IPv4OptionRecordRoute, IPv4OptionLooseSourceRoute, IPv4OptionStrictSourceRoute:
+		if len(data) < 1 || (len(data)-1)%4 != 0 {
+			return
+		}
+		r := &IPv4RouteOption{Pointer: data[0]}
+		for i := 1; i < len(data); i += 4 {
+			r.Addresses = append(r.Addresses, net.IP(data[i:i+4]))
+		}
+		o.Route = r
+	case IPv4OptionTimestamp:
+		if len(data) < 2 {
+			return
+		}
+		t := &IPv4TimestampOption{Pointer: data[0], Overflow: data[1] >> 4, Flag: IPv4TimestampFlag(data[1] & 0xf)}
+		size := t.entrySize()
+		if (len(data)-2)%size != 0 {
+			return
+		}
+		for i := 2; i < len(data); i += size {
+			var e IPv4TimestampEntry
+			if size == 8 {
+				e.Address = net.IP(data[i : i+4])
+			}
+			e.Timestamp = binary.BigEndian.Uint32(data[i+size-4 : i+size])
+			t.Entries = append(t.Entries, e)
+		}
+		o.Timestamp = t
+	case IPv4OptionRouterAlert:
+		if len(data) != 2 {
+			return
+		}
+		o.RouterAlert = &IPv4RouterAlertOption{Value: binary.BigEndian.Uint16(data)}
+	}
+}
+
+// encodeTyped sets OptionData and OptionLength of o from its typed body, if
+// it has one.
+func (o *IPv4Option) encodeTyped() {
+	var data []byte
+	switch o.OptionType {
+	case IPv4OptionRecordRoute, IPv4OptionLooseSourceRoute, IPv4OptionStrictSourceRoute:
+		if o.Route == nil {
+			return
+		}
+		data = make([]byte, 1+4*len(o.Route.Addresses))
+		data[0] = o.Route.Pointer
+		for i, a := range o.Route.Addresses {
+			copy(data[1+4*i:], a.To4())
+		}
+	case IPv4OptionTimestamp:
+		if o.Timestamp == nil {
+			return
+		}
+		t := o.Timestamp
+		size := t.entrySize()
+		data = make([]byte, 2+size*len(t.Entries))
+		data[0] = t.Pointer
+		data[1] = t.Overflow<<4 | uint8(t.Flag)&0xf
+		for i, e := range t.Entries {
+			off := 2 + size*i
+			if size == 8 {
+				copy(data[off:], e.Address.To4())
+			}
+			binary.BigEndian.PutUint32(data[off+size-4:], e.Timestamp)
+		}
+	case IPv4OptionRouterAlert:
+		if o.RouterAlert == nil {
+			return
+		}
+		data = make([]byte, 2)
+		binary.BigEndian.PutUint16(data, o.RouterAlert.Value)
+	default:
+		return
+	}
+	o.OptionData = data
+	o.OptionLength = uint8(2 + len(data))
+}
+
+// Option returns the first option of type t, or nil if ip has none.
+func (ip *IPv4) Option(t uint8) *IPv4Option {
+	for i := range ip.Options {
+		if ip.Options[i].OptionType == t {
+			return &ip.Options[i]
+		}
+	}
+	return nil
+}
+
+// SourceRoute returns the first loose or strict source route option, or
+// nil if ip isn't source routed.
+func (ip *IPv4) SourceRoute() *IPv4Option {
+	for i := range ip.Options {
+		switch ip.Options[i].OptionType {
+		case IPv4OptionLooseSourceRoute, IPv4OptionStrictSourceRoute:
+			return &ip.Options[i]
+		}
+	}
+	return nil
+}
@@ -43,6 +43,9 @@ type IPv6 struct {
 // LayerType returns LayerTypeIPv6
 func (i *IPv6) LayerType() gopacket.LayerType { return LayerTypeIPv6 }
 
+// ECN returns the packet's ECN codepoint.
+func (i *IPv6) ECN() IPECN { return IPECN(i.TrafficClass & 3) }
+
 func (i *IPv6) NetworkFlow() gopacket.Flow {
 	return gopacket.NewFlow(EndpointIPv6, i.SrcIP, i.DstIP)
 }
@@ -505,6 +508,35 @@ type IPv6Routing struct {
 	// SourceRoutingIPs is the set of IPv6 addresses requested for source routing,
 	// set only if RoutingType == 0.
 	SourceRoutingIPs []net.IP
+	// LastEntry, Flags, Tag, Segments and SegmentTLVs are set only if
+	// RoutingType == 4, the segment routing header of RFC 8754, in which
+	// case Reserved holds the same fields unparsed.  Segments is in header
+	// order, so the first segment of the path is Segments[LastEntry] and
+	// the final destination is Segments[0].
+	LastEntry   uint8
+	Flags       uint8
+	Tag         uint16
+	Segments    []net.IP
+	SegmentTLVs []IPv6SegmentRoutingTLV
+}
+
+// IPv6SegmentRoutingTLV is a TLV following the segment list of a segment
+// routing header, such as padding (types 0 and 4) or an HMAC (type 5).  A
+// Pad1 TLV is a single byte, with no length or value.
+type IPv6SegmentRoutingTLV struct {
+	Type   uint8
+	Length uint8
+	Value  []byte
+}
+
+// ActiveSegment returns the segment a segment routing header is currently
+// directing the packet to, which should be its destination address, or nil
+// if there is none.
+func (i *IPv6Routing) ActiveSegment() net.IP {
+	if i.RoutingType != 4 || int(i.SegmentsLeft) >= len(i.Segments) {
+		return nil
+	}
+	return i.Segments[i.SegmentsLeft]
 }
 
 // LayerType returns LayerTypeIPv6Routing.
@@ -525,6 +557,29 @@ func decodeIPv6Routing(data []byte, p gopacket.PacketBuilder) error {
 		for d := i.Contents[8:]; len(d) >= 16; d = d[16:] {
 			i.SourceRoutingIPs = append(i.SourceRoutingIPs, net.IP(d[:16]))
 		}
+	case 4: // Segment routing
+		i.LastEntry = data[4]
+		i.Flags = data[5]
+		i.Tag = binary.BigEndian.Uint16(data[6:8])
+		end := 8 + 16*(int(i.LastEntry)+1)
+		if end > i.ActualLength {
+			return fmt.Errorf("Invalid IPv6 segment routing header, %d segments don't fit in %d bytes", int(i.LastEntry)+1, i.ActualLength)
+		}
+		for d := i.Contents[8:end]; len(d) > 0; d = d[16:] {
+			i.Segments = append(i.Segments, net.IP(d[:16]))
+		}
+		for d := i.Contents[end:]; len(d) > 0; {
+			if d[0] == 0 { // Pad1
+				i.SegmentTLVs = append(i.SegmentTLVs, IPv6SegmentRoutingTLV{})
+				d = d[1:]
+				continue
+			}
+			if len(d) < 2 || len(d) < 2+int(d[1]) {
+				return fmt.Errorf("Invalid IPv6 segment routing header, truncated TLV of type %d", d[0])
+			}
+			i.SegmentTLVs = append(i.SegmentTLVs, IPv6SegmentRoutingTLV{Type: d[0], Length: d[1], Value: d[2 : 2+int(d[1])]})
+			d = d[2+int(d[1]):]
+		}
 	default:
 		return fmt.Errorf("Unknown IPv6 routing header type %d", i.RoutingType)
 	}
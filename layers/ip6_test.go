@@ -429,3 +429,48 @@ func TestIPv6JumbogramDecode(t *testing.T) {
 		t.Error("No Payload layer type found in packet")
 	}
 }
+
+func TestIPv6SegmentRoutingDecode(t *testing.T) {
+	ip6 := &IPv6{
+		Version:    6,
+		NextHeader: IPProtocolIPv6Routing,
+		HopLimit:   64,
+		SrcIP:      net.ParseIP("2001:db8::1"),
+		DstIP:      net.ParseIP("fc00:2::1"),
+	}
+	srh := []byte{
+		byte(IPProtocolNoNextHeader), 5, 4, 1, // next header, length, type 4, segments left 1
+		1, 0, 0x12, 0x34, // last entry, flags, tag
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, // 2001:db8::2
+		0xfc, 0x00, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, // fc00:2::1
+		0x00,                   // Pad1
+		0x04, 0x02, 0x00, 0x00, // PadN
+		0x06, 0x01, 0xaa, // an unknown TLV
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ip6, gopacket.Payload(srh)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv6, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv6, LayerTypeIPv6Routing}, t)
+	r := p.Layer(LayerTypeIPv6Routing).(*IPv6Routing)
+	if r.SegmentsLeft != 1 || r.LastEntry != 1 || r.Flags != 0 || r.Tag != 0x1234 {
+		t.Errorf("bad segment routing header %+v", r)
+	}
+	if len(r.Segments) != 2 || !r.Segments[0].Equal(net.ParseIP("2001:db8::2")) || !r.ActiveSegment().Equal(ip6.DstIP) {
+		t.Errorf("got segments %v, active %v", r.Segments, r.ActiveSegment())
+	}
+	want := []IPv6SegmentRoutingTLV{{}, {Type: 4, Length: 2, Value: []byte{0, 0}}, {Type: 6, Length: 1, Value: []byte{0xaa}}}
+	if !reflect.DeepEqual(r.SegmentTLVs, want) {
+		t.Errorf("got TLVs %+v, want %+v", r.SegmentTLVs, want)
+	}
+
+	srh[4] = 3 // more segments than fit
+	p = gopacket.NewPacket(append(buf.Bytes()[:40], srh...), LayerTypeIPv6, gopacket.Default)
+	if p.ErrorLayer() == nil {
+		t.Error("expected error decoding segment list longer than the header")
+	}
+}
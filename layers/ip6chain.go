@@ -0,0 +1,145 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// IPv6MaxExtensionHeaders is the most extension headers ExtensionChain will
+// walk before giving up on a packet.  RFC 8200 allows each header once,
+// except destination options which may appear twice, so real packets have
+// far fewer.
+const IPv6MaxExtensionHeaders = 16
+
+// IPv6Extension describes one extension header in an IPv6ExtensionChain.
+type IPv6Extension struct {
+	// Type is the header's own protocol number, such as
+	// IPProtocolIPv6Routing.
+	Type IPProtocol
+	// Offset is the header's position in the IPv6 payload, and Length its
+	// length in bytes.
+	Offset, Length int
+	// NextHeader is the type of the header that follows it.
+	NextHeader IPProtocol
+}
+
+// IPv6ExtensionChain summarizes the extension headers of an IPv6 packet.
+type IPv6ExtensionChain struct {
+	// Extensions are the extension headers, in order.
+	Extensions []IPv6Extension
+	// HeaderLength is the total length of the extension headers.
+	HeaderLength int
+	// NextHeader is the type of the upper layer header following the
+	// chain, such as IPProtocolTCP.  It's IPProtocolESP for encrypted
+	// packets, IPProtocolNoNextHeader if there's no upper layer, and the
+	// fragment header's next header for non-first fragments.
+	NextHeader IPProtocol
+	// Payload is the data following the chain.
+	Payload []byte
+	// Fragmented is true if the chain has a fragment header, in which case
+	// FragmentOffset, MoreFragments and Identification are taken from it.
+	// Headers after the fragment header of a non-first fragment are part
+	// of the fragment data, and aren't walked.
+	Fragmented     bool
+	FragmentOffset uint16
+	MoreFragments  bool
+	Identification uint32
+}
+
+// Has returns true if the chain contains an extension header of type t.
+func (c *IPv6ExtensionChain) Has(t IPProtocol) bool {
+	for _, e := range c.Extensions {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+func isIPv6Extension(t IPProtocol) bool {
+	switch t {
+	case IPProtocolIPv6HopByHop, IPProtocolIPv6Routing, IPProtocolIPv6Fragment, IPProtocolIPv6Destination,
+		IPProtocolAH, ipv6ProtocolMobility, ipv6ProtocolHIP, ipv6ProtocolShim6:
+		return true
+	}
+	return false
+}
+
+// ipv6ExtensionLength returns the length of the extension header of type t
+// at the start of data, which must be at least 2 bytes.
+func ipv6ExtensionLength(t IPProtocol, data []byte) int {
+	switch t {
+	case IPProtocolIPv6Fragment:
+		return 8
+	case IPProtocolAH:
+		return (int(data[1]) + 2) * 4
+	}
+	return (int(data[1]) + 1) * 8
+}
+
+// Extension header protocol numbers that have no layer of their own.
+const (
+	ipv6ProtocolMobility IPProtocol = 135
+	ipv6ProtocolHIP      IPProtocol = 139
+	ipv6ProtocolShim6    IPProtocol = 140
+)
+
+// ExtensionChain walks the extension headers of ip6 in order, from its
+// payload rather than from decoded layers, so it works the same after
+// NewPacket or a DecodingLayerParser.  It returns an error for truncated
+// headers, a hop-by-hop header anywhere but first, a header repeated more
+// than RFC 8200 allows, or more than IPv6MaxExtensionHeaders headers,
+// along with the part of the chain it could walk.
+func (ip6 *IPv6) ExtensionChain() (IPv6ExtensionChain, error) {
+	c := IPv6ExtensionChain{NextHeader: ip6.NextHeader, Payload: ip6.Payload}
+	seen := map[IPProtocol]int{}
+	for {
+		data := ip6.Payload[c.HeaderLength:]
+		c.Payload = data
+		if !isIPv6Extension(c.NextHeader) {
+			return c, nil
+		}
+		if len(c.Extensions) == IPv6MaxExtensionHeaders {
+			return c, fmt.Errorf("IPv6 extension chain longer than %d headers", IPv6MaxExtensionHeaders)
+		}
+		if len(data) < 2 {
+			return c, fmt.Errorf("IPv6 %v header truncated", c.NextHeader)
+		}
+		length := ipv6ExtensionLength(c.NextHeader, data)
+		if length > len(data) {
+			return c, fmt.Errorf("IPv6 %v header truncated, length %d with %d bytes left", c.NextHeader, length, len(data))
+		}
+		t := c.NextHeader
+		if t == IPProtocolIPv6HopByHop && len(c.Extensions) > 0 {
+			return c, fmt.Errorf("IPv6 hop-by-hop header at position %d, must be first", len(c.Extensions))
+		}
+		seen[t]++
+		limit := 1
+		if t == IPProtocolIPv6Destination {
+			limit = 2
+		}
+		if seen[t] > limit {
+			return c, fmt.Errorf("IPv6 %v header repeated", t)
+		}
+		e := IPv6Extension{Type: t, Offset: c.HeaderLength, Length: length, NextHeader: IPProtocol(data[0])}
+		c.Extensions = append(c.Extensions, e)
+		c.HeaderLength += length
+		c.NextHeader = e.NextHeader
+		if t == IPProtocolIPv6Fragment {
+			c.Fragmented = true
+			c.FragmentOffset = binary.BigEndian.Uint16(data[2:4]) >> 3
+			c.MoreFragments = data[3]&0x1 != 0
+			c.Identification = binary.BigEndian.Uint32(data[4:8])
+			if c.FragmentOffset != 0 {
+				c.Payload = ip6.Payload[c.HeaderLength:]
+				return c, nil
+			}
+		}
+	}
+}
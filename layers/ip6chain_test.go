@@ -0,0 +1,114 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testIPv6Chain returns an IPv6 header with the given next header, followed
+// by payload.
+func testIPv6Chain(next IPProtocol, payload ...byte) []byte {
+	data := make([]byte, 40, 40+len(payload))
+	data[0] = 0x60
+	data[4], data[5] = byte(len(payload)>>8), byte(len(payload))
+	data[6], data[7] = byte(next), 64
+	return append(data, payload...)
+}
+
+func TestIPv6ExtensionChain(t *testing.T) {
+	data := testIPv6Chain(IPProtocolIPv6HopByHop,
+		// Hop-by-hop, router alert
+		byte(IPProtocolIPv6Destination), 0, 5, 2, 0, 0, 1, 0,
+		// Destination options, PadN
+		byte(IPProtocolIPv6Routing), 0, 1, 4, 0, 0, 0, 0,
+		// Routing type 0 with no addresses
+		byte(IPProtocolIPv6Fragment), 0, 0, 0, 0, 0, 0, 0,
+		// First fragment, more to come
+		byte(IPProtocolAH), 0, 0, 1, 0, 0, 0, 42,
+		// Authentication header with no ICV
+		byte(IPProtocolTCP), 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1,
+		// TCP data
+		0xaa, 0xbb,
+	)
+	var ip6 IPv6
+	if err := ip6.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ip6.ExtensionChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := IPv6ExtensionChain{
+		Extensions: []IPv6Extension{
+			{IPProtocolIPv6HopByHop, 0, 8, IPProtocolIPv6Destination},
+			{IPProtocolIPv6Destination, 8, 8, IPProtocolIPv6Routing},
+			{IPProtocolIPv6Routing, 16, 8, IPProtocolIPv6Fragment},
+			{IPProtocolIPv6Fragment, 24, 8, IPProtocolAH},
+			{IPProtocolAH, 32, 12, IPProtocolTCP},
+		},
+		HeaderLength:   44,
+		NextHeader:     IPProtocolTCP,
+		Payload:        []byte{0xaa, 0xbb},
+		Fragmented:     true,
+		MoreFragments:  true,
+		Identification: 42,
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got  %+v\nwant %+v", c, want)
+	}
+	if !c.Has(IPProtocolIPv6Routing) || c.Has(IPProtocolESP) {
+		t.Error("Has reports the wrong headers")
+	}
+}
+
+func TestIPv6ExtensionChainNonFirstFragment(t *testing.T) {
+	data := testIPv6Chain(IPProtocolIPv6Fragment,
+		byte(IPProtocolIPv6Destination), 0, 0, 0x10, 0, 0, 0, 7,
+		// Fragment data that happens to look like a header.
+		byte(IPProtocolUDP), 9, 1, 2, 3, 4,
+	)
+	var ip6 IPv6
+	if err := ip6.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ip6.ExtensionChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Extensions) != 1 || c.FragmentOffset != 2 || c.NextHeader != IPProtocolIPv6Destination || len(c.Payload) != 6 {
+		t.Errorf("bad chain %+v", c)
+	}
+}
+
+func TestIPv6ExtensionChainMalformed(t *testing.T) {
+	dest := func(next IPProtocol) []byte { return []byte{byte(next), 0, 1, 4, 0, 0, 0, 0} }
+	var threeDest []byte
+	for i := 0; i < 3; i++ {
+		threeDest = append(threeDest, dest(IPProtocolIPv6Destination)...)
+	}
+	for _, test := range []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", testIPv6Chain(IPProtocolIPv6Destination, byte(IPProtocolTCP), 1, 0, 0)},
+		{"no length", testIPv6Chain(IPProtocolIPv6Routing, byte(IPProtocolTCP))},
+		{"late hop-by-hop", testIPv6Chain(IPProtocolIPv6Destination, append(dest(IPProtocolIPv6HopByHop), dest(IPProtocolTCP)...)...)},
+		{"repeated", testIPv6Chain(IPProtocolIPv6Destination, threeDest...)},
+	} {
+		var ip6 IPv6
+		if err := ip6.DecodeFromBytes(test.data, gopacket.NilDecodeFeedback); err != nil {
+			t.Fatal(err)
+		}
+		if c, err := ip6.ExtensionChain(); err == nil {
+			t.Errorf("%s: expected error, got %+v", test.name, c)
+		}
+	}
+}
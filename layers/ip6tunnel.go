@@ -0,0 +1,257 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/mistsys/gopacket"
+)
+
+// IPv6TunnelType is the kind of IPv6 transition mechanism carrying an
+// IPv6 packet.
+type IPv6TunnelType uint8
+
+const (
+	// IPv6TunnelType6in4 is a configured IPv6 in IPv4 tunnel (RFC 4213).
+	IPv6TunnelType6in4 IPv6TunnelType = iota
+	// IPv6TunnelType6to4 is 6to4 (RFC 3056), with an address in 2002::/16.
+	IPv6TunnelType6to4
+	// IPv6TunnelTypeISATAP is ISATAP (RFC 5214), with an interface ID of
+	// 0000:5efe or 0200:5efe followed by an IPv4 address.
+	IPv6TunnelTypeISATAP
+	// IPv6TunnelTypeTeredo is Teredo (RFC 4380), IPv6 over UDP.
+	IPv6TunnelTypeTeredo
+)
+
+func (t IPv6TunnelType) String() string {
+	switch t {
+	case IPv6TunnelType6in4:
+		return "6in4"
+	case IPv6TunnelType6to4:
+		return "6to4"
+	case IPv6TunnelTypeISATAP:
+		return "ISATAP"
+	case IPv6TunnelTypeTeredo:
+		return "Teredo"
+	}
+	return fmt.Sprintf("UnknownIPv6TunnelType(%d)", uint8(t))
+}
+
+// TeredoAuthentication is the authentication indicator that can precede a
+// Teredo packet.
+type TeredoAuthentication struct {
+	ClientID      []byte
+	Authenticator []byte
+	Nonce         [8]byte
+	Confirmation  uint8
+}
+
+// TeredoOrigin is the origin indication that can precede a Teredo packet,
+// with the obfuscation removed.
+type TeredoOrigin struct {
+	Port uint16
+	IP   net.IP
+}
+
+// IPv6Tunnel holds the Teredo indicators that can precede an IPv6 packet
+// on UDP port 3544, which is the layer's payload.  It is only decoded for
+// packets carrying indicators; IPv4 protocol 41, and Teredo packets
+// without indicators, go straight to IPv6, whose transition mechanism
+// IPv6TunnelTypeOf finds.
+type IPv6Tunnel struct {
+	BaseLayer
+	Type IPv6TunnelType
+	// Authentication and Origin are set if present in a Teredo packet.
+	Authentication *TeredoAuthentication
+	Origin         *TeredoOrigin
+}
+
+// LayerType returns LayerTypeIPv6Tunnel.
+func (t *IPv6Tunnel) LayerType() gopacket.LayerType { return LayerTypeIPv6Tunnel }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (t *IPv6Tunnel) CanDecode() gopacket.LayerClass { return LayerTypeIPv6Tunnel }
+
+// NextLayerType returns LayerTypeIPv6.
+func (t *IPv6Tunnel) NextLayerType() gopacket.LayerType { return LayerTypeIPv6 }
+
+var (
+	teredoPrefix = []byte{0x20, 0x01, 0x00, 0x00}
+	isatapID     = []byte{0x00, 0x00, 0x5e, 0xfe}
+	isatapIDG    = []byte{0x02, 0x00, 0x5e, 0xfe}
+)
+
+func isISATAP(ip []byte) bool {
+	id := ip[8:12]
+	return string(id) == string(isatapID) || string(id) == string(isatapIDG)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (t *IPv6Tunnel) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	t.Type, t.Authentication, t.Origin = IPv6TunnelType6in4, nil, nil
+	offset := 0
+	// Teredo indicators start with a zero byte, where IPv6 has its version.
+	if len(data) >= 2 && data[0] == 0 && data[1] == 1 {
+		if len(data) < 4 {
+			df.SetTruncated()
+			return fmt.Errorf("Teredo authentication indicator too short: %d bytes", len(data))
+		}
+		idLen, auLen := int(data[2]), int(data[3])
+		end := 4 + idLen + auLen + 9
+		if len(data) < end {
+			df.SetTruncated()
+			return fmt.Errorf("Teredo authentication indicator too short: %d bytes, want %d", len(data), end)
+		}
+		a := &TeredoAuthentication{
+			ClientID:      data[4 : 4+idLen],
+			Authenticator: data[4+idLen : 4+idLen+auLen],
+			Confirmation:  data[end-1],
+		}
+		copy(a.Nonce[:], data[end-9:end-1])
+		t.Authentication = a
+		t.Type = IPv6TunnelTypeTeredo
+		offset = end
+	}
+	if len(data) >= offset+2 && data[offset] == 0 && data[offset+1] == 0 {
+		if len(data) < offset+8 {
+			df.SetTruncated()
+			return fmt.Errorf("Teredo origin indicator too short: %d bytes", len(data)-offset)
+		}
+		ip := make(net.IP, 4)
+		for i := range ip {
+			ip[i] = ^data[offset+4+i]
+		}
+		t.Origin = &TeredoOrigin{Port: ^binary.BigEndian.Uint16(data[offset+2 : offset+4]), IP: ip}
+		t.Type = IPv6TunnelTypeTeredo
+		offset += 8
+	}
+	inner := data[offset:]
+	if len(inner) < 40 {
+		df.SetTruncated()
+		return fmt.Errorf("IPv6 tunnel payload too short: %d bytes", len(inner))
+	}
+	if inner[0]>>4 != 6 {
+		return fmt.Errorf("IPv6 tunnel payload has IP version %d", inner[0]>>4)
+	}
+	if t.Type != IPv6TunnelTypeTeredo {
+		t.Type = ipv6TunnelType(inner[8:24], inner[24:40])
+	}
+	t.BaseLayer = BaseLayer{Contents: data[:offset], Payload: inner}
+	return nil
+}
+
+// SerializeTo writes the Teredo indicators, if any, into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+// See the docs for gopacket.SerializableLayer for more info.
+func (t *IPv6Tunnel) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	if o := t.Origin; o != nil {
+		ip := o.IP.To4()
+		if ip == nil {
+			return fmt.Errorf("invalid Teredo origin address %v", o.IP)
+		}
+		bytes, err := b.PrependBytes(8)
+		if err != nil {
+			return err
+		}
+		bytes[0], bytes[1] = 0, 0
+		binary.BigEndian.PutUint16(bytes[2:4], ^o.Port)
+		for i := range ip {
+			bytes[4+i] = ^ip[i]
+		}
+	}
+	if a := t.Authentication; a != nil {
+		if len(a.ClientID) > 255 || len(a.Authenticator) > 255 {
+			return fmt.Errorf("Teredo client ID or authenticator too long")
+		}
+		n := 4 + len(a.ClientID) + len(a.Authenticator) + 9
+		bytes, err := b.PrependBytes(n)
+		if err != nil {
+			return err
+		}
+		bytes[0], bytes[1] = 0, 1
+		bytes[2], bytes[3] = uint8(len(a.ClientID)), uint8(len(a.Authenticator))
+		copy(bytes[4:], a.ClientID)
+		copy(bytes[4+len(a.ClientID):], a.Authenticator)
+		copy(bytes[n-9:n-1], a.Nonce[:])
+		bytes[n-1] = a.Confirmation
+	}
+	return nil
+}
+
+// ipv6TunnelType returns the transition mechanism used by IPv6 packets
+// with the given source and destination addresses.
+func ipv6TunnelType(src, dst []byte) IPv6TunnelType {
+	switch {
+	case string(src[:4]) == string(teredoPrefix) || string(dst[:4]) == string(teredoPrefix):
+		return IPv6TunnelTypeTeredo
+	case src[0] == 0x20 && src[1] == 0x02, dst[0] == 0x20 && dst[1] == 0x02:
+		return IPv6TunnelType6to4
+	case isISATAP(src) || isISATAP(dst):
+		return IPv6TunnelTypeISATAP
+	}
+	return IPv6TunnelType6in4
+}
+
+// IPv6TunnelTypeOf returns the transition mechanism of ip, an IPv6 packet
+// carried by IPv4 protocol 41 or UDP port 3544, from its addresses.
+func IPv6TunnelTypeOf(ip *IPv6) IPv6TunnelType {
+	src, dst := ip.SrcIP.To16(), ip.DstIP.To16()
+	if src == nil || dst == nil {
+		return IPv6TunnelType6in4
+	}
+	return ipv6TunnelType(src, dst)
+}
+
+// teredoNextLayerType returns the layer type of a UDP port 3544 payload:
+// IPv6Tunnel if it starts with Teredo indicators, which start with a zero
+// byte where IPv6 has its version, or else IPv6.
+func teredoNextLayerType(data []byte) gopacket.LayerType {
+	switch {
+	case len(data) > 0 && data[0] == 0:
+		return LayerTypeIPv6Tunnel
+	case len(data) > 0 && data[0]>>4 == 6:
+		return LayerTypeIPv6
+	}
+	return gopacket.LayerTypePayload
+}
+
+func decodeIPv6Tunnel(data []byte, p gopacket.PacketBuilder) error {
+	t := &IPv6Tunnel{}
+	return decodingLayerDecoder(t, data, p)
+}
+
+// TeredoAddress is the information encoded in a Teredo IPv6 address.
+type TeredoAddress struct {
+	Server net.IP
+	Flags  uint16
+	// ClientPort and ClientIP are the client's external address, with the
+	// obfuscation removed.
+	ClientPort uint16
+	ClientIP   net.IP
+}
+
+// ParseTeredoAddress extracts the server and client addresses from a
+// Teredo IPv6 address in 2001::/32, returning false for other addresses.
+func ParseTeredoAddress(ip net.IP) (TeredoAddress, bool) {
+	ip = ip.To16()
+	if ip == nil || ip.To4() != nil || string(ip[:4]) != string(teredoPrefix) {
+		return TeredoAddress{}, false
+	}
+	client := make(net.IP, 4)
+	for i := range client {
+		client[i] = ^ip[12+i]
+	}
+	return TeredoAddress{
+		Server:     net.IP(append([]byte(nil), ip[4:8]...)),
+		Flags:      binary.BigEndian.Uint16(ip[8:10]),
+		ClientPort: ^binary.BigEndian.Uint16(ip[10:12]),
+		ClientIP:   client,
+	}, true
+}
@@ -0,0 +1,138 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func testIPv6TunnelInner(src, dst string) []gopacket.SerializableLayer {
+	ip6 := &IPv6{Version: 6, HopLimit: 64, NextHeader: IPProtocolUDP, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)}
+	udp := &UDP{SrcPort: 1000, DstPort: 2000}
+	udp.SetNetworkLayerForChecksum(ip6)
+	return []gopacket.SerializableLayer{ip6, udp, gopacket.Payload("tunneled")}
+}
+
+func TestIPv6TunnelProtocol41(t *testing.T) {
+	for _, test := range []struct {
+		src, dst string
+		want     IPv6TunnelType
+	}{
+		{"2002:c000:201::1", "2001:db8::1", IPv6TunnelType6to4},
+		{"fe80::5efe:c000:201", "fe80::200:5efe:c000:202", IPv6TunnelTypeISATAP},
+		{"2001:db8::1", "2001:db8::2", IPv6TunnelType6in4},
+	} {
+		ip4 := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolIPv6, SrcIP: net.IP{192, 0, 2, 1}, DstIP: net.IP{192, 0, 2, 2}}
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+		if err := gopacket.SerializeLayers(buf, opts, append([]gopacket.SerializableLayer{ip4}, testIPv6TunnelInner(test.src, test.dst)...)...); err != nil {
+			t.Fatal(err)
+		}
+		p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, gopacket.Default)
+		if p.ErrorLayer() != nil {
+			t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+		}
+		checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeIPv6, LayerTypeUDP, gopacket.LayerTypePayload}, t)
+		if got := IPv6TunnelTypeOf(p.Layer(LayerTypeIPv6).(*IPv6)); got != test.want {
+			t.Errorf("%s -> %s: got tunnel type %v, want %v", test.src, test.dst, got, test.want)
+		}
+
+		// Parsers without IPv6Tunnel still decode IPv6 over IPv4.
+		var (
+			dip4    IPv4
+			dip6    IPv6
+			dudp    UDP
+			payload gopacket.Payload
+		)
+		parser := gopacket.NewDecodingLayerParser(LayerTypeIPv4, &dip4, &dip6, &dudp, &payload)
+		var decoded []gopacket.LayerType
+		if err := parser.DecodeLayers(buf.Bytes(), &decoded); err != nil {
+			t.Errorf("%s -> %s: parser error: %v", test.src, test.dst, err)
+		}
+		want := []gopacket.LayerType{LayerTypeIPv4, LayerTypeIPv6, LayerTypeUDP, gopacket.LayerTypePayload}
+		if !reflect.DeepEqual(decoded, want) {
+			t.Errorf("%s -> %s: parser decoded %v, want %v", test.src, test.dst, decoded, want)
+		}
+	}
+}
+
+func TestIPv6TunnelTeredo(t *testing.T) {
+	// Server 65.54.227.120, client 192.0.2.45:40000.
+	teredoAddr := "2001:0:4136:e378:8000:63bf:3fff:fdd2"
+	want := &IPv6Tunnel{
+		Authentication: &TeredoAuthentication{
+			ClientID:      []byte{},
+			Authenticator: []byte{},
+			Nonce:         [8]byte{1, 2, 3, 4, 5, 6, 7, 8},
+		},
+		Origin: &TeredoOrigin{Port: 40000, IP: net.IP{192, 0, 2, 45}},
+	}
+	ip4 := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{65, 54, 227, 120}, DstIP: net.IP{192, 0, 2, 45}}
+	udp := &UDP{SrcPort: 3544, DstPort: 40000}
+	udp.SetNetworkLayerForChecksum(ip4)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	ls := append([]gopacket.SerializableLayer{ip4, udp, want}, testIPv6TunnelInner("2001:db8::1", teredoAddr)...)
+	if err := gopacket.SerializeLayers(buf, opts, ls...); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeIPv6Tunnel, LayerTypeIPv6, LayerTypeUDP, gopacket.LayerTypePayload}, t)
+	got := p.Layer(LayerTypeIPv6Tunnel).(*IPv6Tunnel)
+	if len(got.Contents) != 13+8 {
+		t.Errorf("got %d bytes of indicators, want 21", len(got.Contents))
+	}
+	want.Type = IPv6TunnelTypeTeredo
+	want.BaseLayer = got.BaseLayer
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v\nwant %#v", got, want)
+	}
+
+	a, ok := ParseTeredoAddress(net.ParseIP(teredoAddr))
+	if !ok || !a.Server.Equal(net.IP{65, 54, 227, 120}) || a.Flags != 0x8000 || a.ClientPort != 40000 || !a.ClientIP.Equal(net.IP{192, 0, 2, 45}) {
+		t.Errorf("bad Teredo address %+v", a)
+	}
+
+	// Without indicators, Teredo packets have no IPv6Tunnel layer.
+	buf = gopacket.NewSerializeBuffer()
+	ls = append([]gopacket.SerializableLayer{ip4, udp}, testIPv6TunnelInner("2001:db8::1", teredoAddr)...)
+	if err := gopacket.SerializeLayers(buf, opts, ls...); err != nil {
+		t.Fatal(err)
+	}
+	p = gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, gopacket.Default)
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeIPv6, LayerTypeUDP, gopacket.LayerTypePayload}, t)
+	if got := IPv6TunnelTypeOf(p.Layer(LayerTypeIPv6).(*IPv6)); got != IPv6TunnelTypeTeredo {
+		t.Errorf("got tunnel type %v, want Teredo", got)
+	}
+
+	if _, ok := ParseTeredoAddress(net.ParseIP("2001:db8::1")); ok {
+		t.Error("2001:db8::1 parsed as a Teredo address")
+	}
+}
+
+func TestIPv6TunnelMalformed(t *testing.T) {
+	ip6 := bytes.Repeat([]byte{0x60}, 40)
+	for _, data := range [][]byte{
+		ip6[:39],
+		append([]byte{0, 1, 4, 0}, ip6...)[:10], // truncated authentication
+		append([]byte{0, 0, 0, 0}, ip6...)[:6],  // truncated origin
+		bytes.Repeat([]byte{0x45}, 40),          // IPv4
+	} {
+		var tun IPv6Tunnel
+		if err := tun.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("expected error decoding %x", data)
+		}
+	}
+}
@@ -0,0 +1,545 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/mistsys/gopacket"
+)
+
+// isisIRPD is the intradomain routeing protocol discriminator that starts
+// every IS-IS PDU.
+const isisIRPD = 0x83
+
+// isisCommonHeaderLength is the length of the header fields shared by all
+// PDU types.
+const isisCommonHeaderLength = 8
+
+// ISISPDUType is the type of an IS-IS PDU.
+type ISISPDUType uint8
+
+const (
+	ISISL1LANHello ISISPDUType = 15
+	ISISL2LANHello ISISPDUType = 16
+	ISISP2PHello   ISISPDUType = 17
+	ISISL1LSP      ISISPDUType = 18
+	ISISL2LSP      ISISPDUType = 20
+	ISISL1CSNP     ISISPDUType = 24
+	ISISL2CSNP     ISISPDUType = 25
+	ISISL1PSNP     ISISPDUType = 26
+	ISISL2PSNP     ISISPDUType = 27
+)
+
+func (t ISISPDUType) String() string {
+	switch t {
+	case ISISL1LANHello:
+		return "L1LANHello"
+	case ISISL2LANHello:
+		return "L2LANHello"
+	case ISISP2PHello:
+		return "P2PHello"
+	case ISISL1LSP:
+		return "L1LSP"
+	case ISISL2LSP:
+		return "L2LSP"
+	case ISISL1CSNP:
+		return "L1CSNP"
+	case ISISL2CSNP:
+		return "L2CSNP"
+	case ISISL1PSNP:
+		return "L1PSNP"
+	case ISISL2PSNP:
+		return "L2PSNP"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(t))
+}
+
+// ISISTLVType is the type code of an IS-IS TLV.
+type ISISTLVType uint8
+
+const (
+	ISISTLVAreaAddresses          ISISTLVType = 1
+	ISISTLVISReachability         ISISTLVType = 2
+	ISISTLVISNeighbors            ISISTLVType = 6
+	ISISTLVPadding                ISISTLVType = 8
+	ISISTLVLSPEntries             ISISTLVType = 9
+	ISISTLVAuthentication         ISISTLVType = 10
+	ISISTLVExtendedISReachability ISISTLVType = 22
+	ISISTLVIPInternalReachability ISISTLVType = 128
+	ISISTLVProtocolsSupported     ISISTLVType = 129
+	ISISTLVIPExternalReachability ISISTLVType = 130
+	ISISTLVIPInterfaceAddress     ISISTLVType = 132
+	ISISTLVExtendedIPReachability ISISTLVType = 135
+	ISISTLVHostname               ISISTLVType = 137
+	ISISTLVIPv6InterfaceAddress   ISISTLVType = 232
+	ISISTLVIPv6Reachability       ISISTLVType = 236
+)
+
+func (t ISISTLVType) String() string {
+	switch t {
+	case ISISTLVAreaAddresses:
+		return "AreaAddresses"
+	case ISISTLVISReachability:
+		return "ISReachability"
+	case ISISTLVISNeighbors:
+		return "ISNeighbors"
+	case ISISTLVPadding:
+		return "Padding"
+	case ISISTLVLSPEntries:
+		return "LSPEntries"
+	case ISISTLVAuthentication:
+		return "Authentication"
+	case ISISTLVExtendedISReachability:
+		return "ExtendedISReachability"
+	case ISISTLVIPInternalReachability:
+		return "IPInternalReachability"
+	case ISISTLVProtocolsSupported:
+		return "ProtocolsSupported"
+	case ISISTLVIPExternalReachability:
+		return "IPExternalReachability"
+	case ISISTLVIPInterfaceAddress:
+		return "IPInterfaceAddress"
+	case ISISTLVExtendedIPReachability:
+		return "ExtendedIPReachability"
+	case ISISTLVHostname:
+		return "Hostname"
+	case ISISTLVIPv6InterfaceAddress:
+		return "IPv6InterfaceAddress"
+	case ISISTLVIPv6Reachability:
+		return "IPv6Reachability"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(t))
+}
+
+// ISIS is an IS-IS PDU, carried over LLC with the OSI SAP.  Exactly one of
+// Hello, LSP and SNP is set, according to PDUType.  System IDs are 6
+// bytes; LAN and node IDs add a pseudonode byte, and LSP IDs a fragment
+// byte after that.
+type ISIS struct {
+	BaseLayer
+	HeaderLength     uint8
+	IDLength         uint8
+	PDUType          ISISPDUType
+	Version          uint8
+	MaxAreaAddresses uint8
+	Hello            *ISISHello
+	LSP              *ISISLSP
+	SNP              *ISISSNP
+	TLVs             []ISISTLV
+}
+
+// ISISHello holds the fixed fields of a LAN or point-to-point hello.
+// Priority and LANID are only set for LAN hellos, and LocalCircuitID for
+// point-to-point hellos.
+type ISISHello struct {
+	// CircuitType is 1 for level 1, 2 for level 2, and 3 for both.
+	CircuitType    uint8
+	SourceID       []byte
+	HoldingTime    uint16
+	PDULength      uint16
+	Priority       uint8
+	LANID          []byte
+	LocalCircuitID uint8
+}
+
+// ISIS LSP flags.
+const (
+	ISISLSPFlagPartition = 0x80
+	ISISLSPFlagAttached  = 0x08 // default metric
+	ISISLSPFlagOverload  = 0x04
+)
+
+// ISISLSP holds the fixed fields of a link state PDU.
+type ISISLSP struct {
+	PDULength         uint16
+	RemainingLifetime uint16
+	LSPID             []byte
+	SequenceNumber    uint32
+	Checksum          uint16
+	// Flags holds the partition repair, attached and overload bits, and
+	// the IS type in its low two bits.
+	Flags uint8
+}
+
+// ISISSNP holds the fixed fields of a complete or partial sequence numbers
+// PDU.  StartLSPID and EndLSPID are only set for CSNPs.
+type ISISSNP struct {
+	PDULength  uint16
+	SourceID   []byte
+	StartLSPID []byte
+	EndLSPID   []byte
+}
+
+// ISISTLV is a TLV of an IS-IS PDU.  Decode its value with the method for
+// its type.
+type ISISTLV struct {
+	Type  ISISTLVType
+	Value []byte
+}
+
+// LayerType returns LayerTypeISIS.
+func (i *ISIS) LayerType() gopacket.LayerType { return LayerTypeISIS }
+
+func (i *ISIS) CanDecode() gopacket.LayerClass { return LayerTypeISIS }
+
+func (i *ISIS) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (i *ISIS) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < isisCommonHeaderLength {
+		df.SetTruncated()
+		return fmt.Errorf("IS-IS length %d too short", len(data))
+	}
+	if data[0] != isisIRPD {
+		return fmt.Errorf("IS-IS discriminator %#x invalid", data[0])
+	}
+	*i = ISIS{
+		HeaderLength:     data[1],
+		IDLength:         data[3],
+		PDUType:          ISISPDUType(data[4] & 0x1f),
+		Version:          data[5],
+		MaxAreaAddresses: data[7],
+	}
+	if i.IDLength != 0 && i.IDLength != 6 {
+		return fmt.Errorf("IS-IS ID length %d unsupported", i.IDLength)
+	}
+	if len(data) < int(i.HeaderLength) {
+		df.SetTruncated()
+		return fmt.Errorf("IS-IS header length %d exceeds %d bytes available", i.HeaderLength, len(data))
+	}
+	var fixed int
+	switch i.PDUType {
+	case ISISL1LANHello, ISISL2LANHello, ISISP2PHello:
+		fixed = 12
+		if i.PDUType != ISISP2PHello {
+			fixed = 19
+		}
+	case ISISL1LSP, ISISL2LSP:
+		fixed = 19
+	case ISISL1CSNP, ISISL2CSNP:
+		fixed = 25
+	case ISISL1PSNP, ISISL2PSNP:
+		fixed = 9
+	default:
+		return fmt.Errorf("unknown IS-IS PDU type %v", i.PDUType)
+	}
+	if int(i.HeaderLength) != isisCommonHeaderLength+fixed {
+		return fmt.Errorf("IS-IS %v header length %d, want %d", i.PDUType, i.HeaderLength, isisCommonHeaderLength+fixed)
+	}
+	b := data[isisCommonHeaderLength:i.HeaderLength]
+	var pduLength uint16
+	switch i.PDUType {
+	case ISISL1LANHello, ISISL2LANHello, ISISP2PHello:
+		i.Hello = &ISISHello{
+			CircuitType: b[0] & 0x03,
+			SourceID:    b[1:7],
+			HoldingTime: binary.BigEndian.Uint16(b[7:9]),
+			PDULength:   binary.BigEndian.Uint16(b[9:11]),
+		}
+		if i.PDUType == ISISP2PHello {
+			i.Hello.LocalCircuitID = b[11]
+		} else {
+			i.Hello.Priority = b[11] & 0x7f
+			i.Hello.LANID = b[12:19]
+		}
+		pduLength = i.Hello.PDULength
+	case ISISL1LSP, ISISL2LSP:
+		i.LSP = &ISISLSP{
+			PDULength:         binary.BigEndian.Uint16(b[0:2]),
+			RemainingLifetime: binary.BigEndian.Uint16(b[2:4]),
+			LSPID:             b[4:12],
+			SequenceNumber:    binary.BigEndian.Uint32(b[12:16]),
+			Checksum:          binary.BigEndian.Uint16(b[16:18]),
+			Flags:             b[18],
+		}
+		pduLength = i.LSP.PDULength
+	default:
+		i.SNP = &ISISSNP{PDULength: binary.BigEndian.Uint16(b[0:2]), SourceID: b[2:9]}
+		if fixed == 25 {
+			i.SNP.StartLSPID, i.SNP.EndLSPID = b[9:17], b[17:25]
+		}
+		pduLength = i.SNP.PDULength
+	}
+	switch {
+	case int(pduLength) > len(data):
+		df.SetTruncated()
+		return fmt.Errorf("IS-IS PDU length %d exceeds %d bytes available", pduLength, len(data))
+	case pduLength < uint16(i.HeaderLength):
+		return fmt.Errorf("IS-IS PDU length %d shorter than header", pduLength)
+	}
+	// Anything past the PDU length is link layer padding.
+	i.BaseLayer = BaseLayer{Contents: data[:pduLength]}
+	for t := data[i.HeaderLength:pduLength]; len(t) > 0; {
+		if len(t) < 2 || len(t) < 2+int(t[1]) {
+			return fmt.Errorf("IS-IS TLV truncated")
+		}
+		i.TLVs = append(i.TLVs, ISISTLV{Type: ISISTLVType(t[0]), Value: t[2 : 2+int(t[1])]})
+		t = t[2+int(t[1]):]
+	}
+	return nil
+}
+
+// TLV returns the first TLV of the given type.
+func (i *ISIS) TLV(t ISISTLVType) (ISISTLV, bool) {
+	for _, tlv := range i.TLVs {
+		if tlv.Type == t {
+			return tlv, true
+		}
+	}
+	return ISISTLV{}, false
+}
+
+func decodeISIS(data []byte, p gopacket.PacketBuilder) error {
+	i := &ISIS{}
+	return decodingLayerDecoder(i, data, p)
+}
+
+func (t ISISTLV) check(types ...ISISTLVType) error {
+	for _, typ := range types {
+		if t.Type == typ {
+			return nil
+		}
+	}
+	return fmt.Errorf("IS-IS TLV %v is not %v", t.Type, types[0])
+}
+
+// AreaAddresses decodes an area addresses TLV.
+func (t ISISTLV) AreaAddresses() ([][]byte, error) {
+	if err := t.check(ISISTLVAreaAddresses); err != nil {
+		return nil, err
+	}
+	var out [][]byte
+	for b := t.Value; len(b) > 0; {
+		if len(b) < 1+int(b[0]) {
+			return nil, errors.New("IS-IS area address truncated")
+		}
+		out = append(out, b[1:1+int(b[0])])
+		b = b[1+int(b[0]):]
+	}
+	return out, nil
+}
+
+// ISNeighbors decodes the neighbor MAC addresses of a LAN hello's IS
+// neighbors TLV.
+func (t ISISTLV) ISNeighbors() ([]net.HardwareAddr, error) {
+	if err := t.check(ISISTLVISNeighbors); err != nil {
+		return nil, err
+	}
+	if len(t.Value)%6 != 0 {
+		return nil, fmt.Errorf("IS-IS IS neighbors length %d is not a multiple of 6", len(t.Value))
+	}
+	var out []net.HardwareAddr
+	for b := t.Value; len(b) > 0; b = b[6:] {
+		out = append(out, net.HardwareAddr(b[:6]))
+	}
+	return out, nil
+}
+
+// ISISLSPEntry summarizes an LSP in a sequence numbers PDU.
+type ISISLSPEntry struct {
+	RemainingLifetime uint16
+	LSPID             []byte
+	SequenceNumber    uint32
+	Checksum          uint16
+}
+
+// LSPEntries decodes an LSP entries TLV.
+func (t ISISTLV) LSPEntries() ([]ISISLSPEntry, error) {
+	if err := t.check(ISISTLVLSPEntries); err != nil {
+		return nil, err
+	}
+	if len(t.Value)%16 != 0 {
+		return nil, fmt.Errorf("IS-IS LSP entries length %d is not a multiple of 16", len(t.Value))
+	}
+	var out []ISISLSPEntry
+	for b := t.Value; len(b) > 0; b = b[16:] {
+		out = append(out, ISISLSPEntry{
+			RemainingLifetime: binary.BigEndian.Uint16(b[0:2]),
+			LSPID:             b[2:10],
+			SequenceNumber:    binary.BigEndian.Uint32(b[10:14]),
+			Checksum:          binary.BigEndian.Uint16(b[14:16]),
+		})
+	}
+	return out, nil
+}
+
+// ISISNeighbor is a neighbor advertised in an IS reachability TLV.  ID is a
+// node ID: the neighbor's system ID and a pseudonode byte.
+type ISISNeighbor struct {
+	ID      []byte
+	Metric  uint32
+	SubTLVs []byte
+}
+
+// ISReachability decodes an IS reachability or extended IS reachability
+// TLV.  Only the default metric of the former is kept.
+func (t ISISTLV) ISReachability() ([]ISISNeighbor, error) {
+	if err := t.check(ISISTLVISReachability, ISISTLVExtendedISReachability); err != nil {
+		return nil, err
+	}
+	var out []ISISNeighbor
+	if t.Type == ISISTLVISReachability {
+		// A virtual flag byte, then 4 metrics and a node ID per neighbor.
+		if len(t.Value) < 1 || (len(t.Value)-1)%11 != 0 {
+			return nil, fmt.Errorf("IS-IS IS reachability length %d invalid", len(t.Value))
+		}
+		for b := t.Value[1:]; len(b) > 0; b = b[11:] {
+			out = append(out, ISISNeighbor{ID: b[4:11], Metric: uint32(b[0] & 0x3f)})
+		}
+		return out, nil
+	}
+	for b := t.Value; len(b) > 0; {
+		if len(b) < 11 || len(b) < 11+int(b[10]) {
+			return nil, errors.New("IS-IS extended IS reachability truncated")
+		}
+		out = append(out, ISISNeighbor{
+			ID:      b[0:7],
+			Metric:  uint32(b[7])<<16 | uint32(b[8])<<8 | uint32(b[9]),
+			SubTLVs: b[11 : 11+int(b[10])],
+		})
+		b = b[11+int(b[10]):]
+	}
+	return out, nil
+}
+
+// ISISPrefix is an IP prefix advertised in a reachability TLV.  Down is the
+// up/down bit set on prefixes leaked from level 2 into level 1, and External
+// marks prefixes redistributed from other protocols, where the TLV carries
+// that.
+type ISISPrefix struct {
+	Prefix   net.IPNet
+	Metric   uint32
+	Down     bool
+	External bool
+	SubTLVs  []byte
+}
+
+// IPReachability decodes an IP internal or external reachability TLV, or
+// an extended IP reachability TLV.  Only the default metric of the former
+// is kept.
+func (t ISISTLV) IPReachability() ([]ISISPrefix, error) {
+	if err := t.check(ISISTLVIPInternalReachability, ISISTLVIPExternalReachability, ISISTLVExtendedIPReachability); err != nil {
+		return nil, err
+	}
+	var out []ISISPrefix
+	if t.Type != ISISTLVExtendedIPReachability {
+		if len(t.Value)%12 != 0 {
+			return nil, fmt.Errorf("IS-IS IP reachability length %d is not a multiple of 12", len(t.Value))
+		}
+		for b := t.Value; len(b) > 0; b = b[12:] {
+			out = append(out, ISISPrefix{
+				Prefix:   net.IPNet{IP: net.IP(b[4:8]), Mask: net.IPMask(b[8:12])},
+				Metric:   uint32(b[0] & 0x3f),
+				Down:     b[0]&0x80 != 0,
+				External: t.Type == ISISTLVIPExternalReachability || b[0]&0x40 != 0,
+			})
+		}
+		return out, nil
+	}
+	for b := t.Value; len(b) > 0; {
+		if len(b) < 5 {
+			return nil, errors.New("IS-IS extended IP reachability truncated")
+		}
+		p := ISISPrefix{Metric: binary.BigEndian.Uint32(b[0:4]), Down: b[4]&0x80 != 0}
+		n, err := p.decodePrefix(b[5:], int(b[4]&0x3f), net.IPv4len, b[4]&0x40 != 0)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+		b = b[5+n:]
+	}
+	return out, nil
+}
+
+// IPv6Reachability decodes an IPv6 reachability TLV.
+func (t ISISTLV) IPv6Reachability() ([]ISISPrefix, error) {
+	if err := t.check(ISISTLVIPv6Reachability); err != nil {
+		return nil, err
+	}
+	var out []ISISPrefix
+	for b := t.Value; len(b) > 0; {
+		if len(b) < 6 {
+			return nil, errors.New("IS-IS IPv6 reachability truncated")
+		}
+		p := ISISPrefix{
+			Metric:   binary.BigEndian.Uint32(b[0:4]),
+			Down:     b[4]&0x80 != 0,
+			External: b[4]&0x40 != 0,
+		}
+		n, err := p.decodePrefix(b[6:], int(b[5]), net.IPv6len, b[4]&0x20 != 0)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+		b = b[6+n:]
+	}
+	return out, nil
+}
+
+// decodePrefix decodes a prefix of the given length from the start of b,
+// followed by sub-TLVs if subTLVs is set, and returns the number of bytes
+// they took.
+func (p *ISISPrefix) decodePrefix(b []byte, bits, addrLen int, subTLVs bool) (int, error) {
+	if bits > addrLen*8 {
+		return 0, fmt.Errorf("IS-IS prefix length %d too long", bits)
+	}
+	n := (bits + 7) / 8
+	if len(b) < n {
+		return 0, fmt.Errorf("IS-IS /%d prefix truncated", bits)
+	}
+	ip := make(net.IP, addrLen)
+	copy(ip, b[:n])
+	p.Prefix = net.IPNet{IP: ip, Mask: net.CIDRMask(bits, addrLen*8)}
+	if !subTLVs {
+		return n, nil
+	}
+	if len(b) < n+1 || len(b) < n+1+int(b[n]) {
+		return 0, errors.New("IS-IS prefix sub-TLVs truncated")
+	}
+	p.SubTLVs = b[n+1 : n+1+int(b[n])]
+	return n + 1 + int(b[n]), nil
+}
+
+// ProtocolsSupported decodes the network layer protocol IDs of a protocols
+// supported TLV: 0xcc for IPv4 and 0x8e for IPv6.
+func (t ISISTLV) ProtocolsSupported() ([]uint8, error) {
+	if err := t.check(ISISTLVProtocolsSupported); err != nil {
+		return nil, err
+	}
+	return t.Value, nil
+}
+
+// InterfaceAddresses decodes an IP or IPv6 interface address TLV.
+func (t ISISTLV) InterfaceAddresses() ([]net.IP, error) {
+	if err := t.check(ISISTLVIPInterfaceAddress, ISISTLVIPv6InterfaceAddress); err != nil {
+		return nil, err
+	}
+	size := net.IPv4len
+	if t.Type == ISISTLVIPv6InterfaceAddress {
+		size = net.IPv6len
+	}
+	if len(t.Value)%size != 0 {
+		return nil, fmt.Errorf("IS-IS %v length %d is not a multiple of %d", t.Type, len(t.Value), size)
+	}
+	var out []net.IP
+	for b := t.Value; len(b) > 0; b = b[size:] {
+		out = append(out, net.IP(b[:size]))
+	}
+	return out, nil
+}
+
+// Hostname decodes a dynamic hostname TLV.
+func (t ISISTLV) Hostname() (string, error) {
+	if err := t.check(ISISTLVHostname); err != nil {
+		return "", err
+	}
+	return string(t.Value), nil
+}
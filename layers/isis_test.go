@@ -0,0 +1,162 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// isisFrame returns an 802.3 frame carrying an IS-IS PDU with the given
+// type, fixed header and TLVs, with its lengths filled in.
+func isisFrame(typ ISISPDUType, fixed []byte, tlvs ...byte) []byte {
+	pdu := append([]byte{0x83, byte(8 + len(fixed)), 1, 0, byte(typ), 1, 0, 0}, fixed...)
+	pdu = append(pdu, tlvs...)
+	off := 8
+	if typ == ISISL1LANHello || typ == ISISL2LANHello || typ == ISISP2PHello {
+		off = 8 + 9
+	}
+	pdu[off], pdu[off+1] = byte(len(pdu)>>8), byte(len(pdu))
+	frame := []byte{0x01, 0x80, 0xc2, 0x00, 0x00, 0x14, 0x00, 0x00, 0x5e, 0x00, 0x01, 0x01}
+	frame = append(frame, byte((len(pdu)+3)>>8), byte(len(pdu)+3), 0xfe, 0xfe, 0x03)
+	frame = append(frame, pdu...)
+	for len(frame) < 60 {
+		frame = append(frame, 0)
+	}
+	return frame
+}
+
+func decodeISISFrame(t *testing.T, data []byte) *ISIS {
+	p := gopacket.NewPacket(data, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeLLC, LayerTypeISIS}, t)
+	return p.Layer(LayerTypeISIS).(*ISIS)
+}
+
+var isisSystemID = []byte{0x19, 0x21, 0x68, 0x00, 0x10, 0x01}
+
+func TestPacketISISHello(t *testing.T) {
+	fixed := append([]byte{0x01}, isisSystemID...)
+	fixed = append(fixed, 0x00, 0x1e, 0, 0, 0x40)
+	fixed = append(fixed, isisSystemID...)
+	fixed = append(fixed, 0x02)
+	isis := decodeISISFrame(t, isisFrame(ISISL1LANHello, fixed,
+		0x01, 0x04, 0x03, 0x49, 0x00, 0x01,
+		0x81, 0x01, 0xcc,
+		0x06, 0x06, 0x00, 0x00, 0x5e, 0x00, 0x01, 0x02,
+		0x84, 0x04, 0x0a, 0x00, 0x00, 0x01,
+	))
+	h := isis.Hello
+	if isis.PDUType != ISISL1LANHello || h == nil || h.CircuitType != 1 || h.HoldingTime != 30 || h.Priority != 64 {
+		t.Fatalf("got %+v, hello %+v", isis, h)
+	}
+	if !reflect.DeepEqual(h.SourceID, isisSystemID) || h.LANID[6] != 2 || len(isis.TLVs) != 4 {
+		t.Errorf("got hello %+v, TLVs %v", h, isis.TLVs)
+	}
+	area, _ := isis.TLV(ISISTLVAreaAddresses)
+	if areas, err := area.AreaAddresses(); err != nil || !reflect.DeepEqual(areas, [][]byte{{0x49, 0x00, 0x01}}) {
+		t.Errorf("got areas %x, %v", areas, err)
+	}
+	nbrs, _ := isis.TLV(ISISTLVISNeighbors)
+	if macs, err := nbrs.ISNeighbors(); err != nil || len(macs) != 1 || macs[0].String() != "00:00:5e:00:01:02" {
+		t.Errorf("got neighbors %v, %v", macs, err)
+	}
+	if _, err := area.ISNeighbors(); err == nil {
+		t.Error("decoded area addresses as neighbors")
+	}
+}
+
+func TestPacketISISLSP(t *testing.T) {
+	fixed := []byte{0, 0, 0x04, 0xaf}
+	fixed = append(fixed, isisSystemID...)
+	fixed = append(fixed, 0, 0, 0, 0, 0, 0x2a, 0x12, 0x34, 0x0b)
+	tlvs := []byte{
+		0x01, 0x04, 0x03, 0x49, 0x00, 0x01,
+		0x81, 0x02, 0xcc, 0x8e,
+		0x84, 0x04, 0x0a, 0x00, 0x00, 0x01,
+		0x89, 0x03, 'r', 't', '1',
+		// Extended IS reachability: pseudonode 2, metric 10.
+		0x16, 0x0b, 0x19, 0x21, 0x68, 0x00, 0x10, 0x02, 0x02, 0x00, 0x00, 0x0a, 0x00,
+		// Extended IP reachability: 10.1.0.0/16 metric 20, and
+		// 192.0.2.1/32 metric 0 with a sub-TLV.
+		0x87, 0x14,
+		0x00, 0x00, 0x00, 0x14, 0x10, 0x0a, 0x01,
+		0x00, 0x00, 0x00, 0x00, 0x60, 0xc0, 0x00, 0x02, 0x01, 0x03, 0x04, 0x01, 0x80,
+		// IPv6 reachability: 2001:db8::/32 metric 10, external and down.
+		0xec, 0x0a, 0x00, 0x00, 0x00, 0x0a, 0xc0, 0x20, 0x20, 0x01, 0x0d, 0xb8,
+	}
+	isis := decodeISISFrame(t, isisFrame(ISISL2LSP, fixed, tlvs...))
+	lsp := isis.LSP
+	if lsp == nil || lsp.RemainingLifetime != 1199 || lsp.SequenceNumber != 42 || lsp.Checksum != 0x1234 ||
+		lsp.Flags&ISISLSPFlagAttached == 0 || lsp.Flags&0x03 != 3 || lsp.LSPID[5] != 0x01 {
+		t.Fatalf("got LSP %+v", lsp)
+	}
+
+	tlv, _ := isis.TLV(ISISTLVProtocolsSupported)
+	if nlpids, err := tlv.ProtocolsSupported(); err != nil || !reflect.DeepEqual(nlpids, []uint8{0xcc, 0x8e}) {
+		t.Errorf("got protocols %x, %v", nlpids, err)
+	}
+	tlv, _ = isis.TLV(ISISTLVIPInterfaceAddress)
+	if addrs, err := tlv.InterfaceAddresses(); err != nil || len(addrs) != 1 || !addrs[0].Equal(net.IP{10, 0, 0, 1}) {
+		t.Errorf("got interface addresses %v, %v", addrs, err)
+	}
+	tlv, _ = isis.TLV(ISISTLVHostname)
+	if name, err := tlv.Hostname(); err != nil || name != "rt1" {
+		t.Errorf("got hostname %q, %v", name, err)
+	}
+
+	tlv, _ = isis.TLV(ISISTLVExtendedISReachability)
+	nbrs, err := tlv.ISReachability()
+	if err != nil || len(nbrs) != 1 || nbrs[0].Metric != 10 || nbrs[0].ID[6] != 2 {
+		t.Errorf("got neighbors %+v, %v", nbrs, err)
+	}
+
+	tlv, _ = isis.TLV(ISISTLVExtendedIPReachability)
+	pfxs, err := tlv.IPReachability()
+	if err != nil || len(pfxs) != 2 {
+		t.Fatalf("got prefixes %+v, %v", pfxs, err)
+	}
+	if pfxs[0].Prefix.String() != "10.1.0.0/16" || pfxs[0].Metric != 20 || pfxs[0].SubTLVs != nil {
+		t.Errorf("got prefix %+v", pfxs[0])
+	}
+	if pfxs[1].Prefix.String() != "192.0.2.1/32" || !reflect.DeepEqual(pfxs[1].SubTLVs, []byte{0x04, 0x01, 0x80}) {
+		t.Errorf("got prefix %+v", pfxs[1])
+	}
+
+	tlv, _ = isis.TLV(ISISTLVIPv6Reachability)
+	pfxs, err = tlv.IPv6Reachability()
+	if err != nil || len(pfxs) != 1 || pfxs[0].Prefix.String() != "2001:db8::/32" || !pfxs[0].Down || !pfxs[0].External {
+		t.Errorf("got IPv6 prefixes %+v, %v", pfxs, err)
+	}
+}
+
+func TestPacketISISCSNP(t *testing.T) {
+	fixed := []byte{0, 0}
+	fixed = append(fixed, isisSystemID...)
+	fixed = append(fixed, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	isis := decodeISISFrame(t, isisFrame(ISISL2CSNP, fixed,
+		0x09, 0x10, 0x04, 0xaf, 0x19, 0x21, 0x68, 0x00, 0x10, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x2a, 0x12, 0x34,
+	))
+	if isis.SNP == nil || isis.SNP.EndLSPID[7] != 0xff || isis.SNP.SourceID[6] != 0 {
+		t.Fatalf("got SNP %+v", isis.SNP)
+	}
+	tlv, _ := isis.TLV(ISISTLVLSPEntries)
+	want := []ISISLSPEntry{{
+		RemainingLifetime: 1199,
+		LSPID:             []byte{0x19, 0x21, 0x68, 0x00, 0x10, 0x01, 0x00, 0x00},
+		SequenceNumber:    42,
+		Checksum:          0x1234,
+	}}
+	if entries, err := tlv.LSPEntries(); err != nil || !reflect.DeepEqual(entries, want) {
+		t.Errorf("got entries %+v, %v", entries, err)
+	}
+}
@@ -0,0 +1,878 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// KerberosMessageType is the type of a Kerberos message, which is also
+// the ASN.1 application tag of the message.
+type KerberosMessageType uint8
+
+// Kerberos message types (RFC 4120 section 5.10).
+const (
+	KerberosMessageTypeASReq  KerberosMessageType = 10
+	KerberosMessageTypeASRep  KerberosMessageType = 11
+	KerberosMessageTypeTGSReq KerberosMessageType = 12
+	KerberosMessageTypeTGSRep KerberosMessageType = 13
+	KerberosMessageTypeAPReq  KerberosMessageType = 14
+	KerberosMessageTypeAPRep  KerberosMessageType = 15
+	KerberosMessageTypeSafe   KerberosMessageType = 20
+	KerberosMessageTypePriv   KerberosMessageType = 21
+	KerberosMessageTypeCred   KerberosMessageType = 22
+	KerberosMessageTypeError  KerberosMessageType = 30
+)
+
+func (t KerberosMessageType) String() string {
+	switch t {
+	case KerberosMessageTypeASReq:
+		return "AS-REQ"
+	case KerberosMessageTypeASRep:
+		return "AS-REP"
+	case KerberosMessageTypeTGSReq:
+		return "TGS-REQ"
+	case KerberosMessageTypeTGSRep:
+		return "TGS-REP"
+	case KerberosMessageTypeAPReq:
+		return "AP-REQ"
+	case KerberosMessageTypeAPRep:
+		return "AP-REP"
+	case KerberosMessageTypeSafe:
+		return "KRB-SAFE"
+	case KerberosMessageTypePriv:
+		return "KRB-PRIV"
+	case KerberosMessageTypeCred:
+		return "KRB-CRED"
+	case KerberosMessageTypeError:
+		return "KRB-ERROR"
+	default:
+		return fmt.Sprintf("UnknownKerberosMessageType(%d)", uint8(t))
+	}
+}
+
+// KerberosEncryptionType is an encryption type, used for tickets, session
+// keys and pre-authentication.
+type KerberosEncryptionType int32
+
+// Kerberos encryption types (RFC 3961, RFC 3962, RFC 4757 and RFC 8009).
+const (
+	KerberosEncryptionTypeDESCBCCRC           KerberosEncryptionType = 1
+	KerberosEncryptionTypeDESCBCMD5           KerberosEncryptionType = 3
+	KerberosEncryptionTypeDES3CBCSHA1         KerberosEncryptionType = 16
+	KerberosEncryptionTypeAES128CTSHMACSHA196 KerberosEncryptionType = 17
+	KerberosEncryptionTypeAES256CTSHMACSHA196 KerberosEncryptionType = 18
+	KerberosEncryptionTypeAES128CTSHMACSHA256 KerberosEncryptionType = 19
+	KerberosEncryptionTypeAES256CTSHMACSHA384 KerberosEncryptionType = 20
+	KerberosEncryptionTypeRC4HMAC             KerberosEncryptionType = 23
+	KerberosEncryptionTypeRC4HMACExp          KerberosEncryptionType = 24
+	KerberosEncryptionTypeCamellia128CTSCMAC  KerberosEncryptionType = 25
+	KerberosEncryptionTypeCamellia256CTSCMAC  KerberosEncryptionType = 26
+	KerberosEncryptionTypeRC4HMACOldExp       KerberosEncryptionType = -135
+)
+
+// String returns the name RFC 3961 and its successors give t, like
+// "aes256-cts-hmac-sha1-96".
+func (t KerberosEncryptionType) String() string {
+	switch t {
+	case KerberosEncryptionTypeDESCBCCRC:
+		return "des-cbc-crc"
+	case KerberosEncryptionTypeDESCBCMD5:
+		return "des-cbc-md5"
+	case KerberosEncryptionTypeDES3CBCSHA1:
+		return "des3-cbc-sha1-kd"
+	case KerberosEncryptionTypeAES128CTSHMACSHA196:
+		return "aes128-cts-hmac-sha1-96"
+	case KerberosEncryptionTypeAES256CTSHMACSHA196:
+		return "aes256-cts-hmac-sha1-96"
+	case KerberosEncryptionTypeAES128CTSHMACSHA256:
+		return "aes128-cts-hmac-sha256-128"
+	case KerberosEncryptionTypeAES256CTSHMACSHA384:
+		return "aes256-cts-hmac-sha384-192"
+	case KerberosEncryptionTypeRC4HMAC:
+		return "rc4-hmac"
+	case KerberosEncryptionTypeRC4HMACExp:
+		return "rc4-hmac-exp"
+	case KerberosEncryptionTypeCamellia128CTSCMAC:
+		return "camellia128-cts-cmac"
+	case KerberosEncryptionTypeCamellia256CTSCMAC:
+		return "camellia256-cts-cmac"
+	case KerberosEncryptionTypeRC4HMACOldExp:
+		return "rc4-hmac-old-exp"
+	default:
+		return fmt.Sprintf("UnknownKerberosEncryptionType(%d)", int32(t))
+	}
+}
+
+// KerberosErrorCode is the error code of a KRB-ERROR message.
+type KerberosErrorCode int32
+
+// Common Kerberos error codes (RFC 4120 section 7.5.9).
+const (
+	KerberosErrorNone                   KerberosErrorCode = 0
+	KerberosErrorClientPrincipalUnknown KerberosErrorCode = 6
+	KerberosErrorServerPrincipalUnknown KerberosErrorCode = 7
+	KerberosErrorPolicy                 KerberosErrorCode = 12
+	KerberosErrorBadOption              KerberosErrorCode = 13
+	KerberosErrorETypeNotSupported      KerberosErrorCode = 14
+	KerberosErrorClientRevoked          KerberosErrorCode = 18
+	KerberosErrorKeyExpired             KerberosErrorCode = 23
+	KerberosErrorPreauthFailed          KerberosErrorCode = 24
+	KerberosErrorPreauthRequired        KerberosErrorCode = 25
+	KerberosErrorBadIntegrity           KerberosErrorCode = 31
+	KerberosErrorTicketExpired          KerberosErrorCode = 32
+	KerberosErrorSkew                   KerberosErrorCode = 37
+	KerberosErrorModified               KerberosErrorCode = 41
+	KerberosErrorResponseTooBig         KerberosErrorCode = 52
+	KerberosErrorGeneric                KerberosErrorCode = 60
+	KerberosErrorWrongRealm             KerberosErrorCode = 68
+)
+
+// String returns the name RFC 4120 gives c, like "KDC_ERR_PREAUTH_REQUIRED".
+func (c KerberosErrorCode) String() string {
+	switch c {
+	case KerberosErrorNone:
+		return "KDC_ERR_NONE"
+	case KerberosErrorClientPrincipalUnknown:
+		return "KDC_ERR_C_PRINCIPAL_UNKNOWN"
+	case KerberosErrorServerPrincipalUnknown:
+		return "KDC_ERR_S_PRINCIPAL_UNKNOWN"
+	case KerberosErrorPolicy:
+		return "KDC_ERR_POLICY"
+	case KerberosErrorBadOption:
+		return "KDC_ERR_BADOPTION"
+	case KerberosErrorETypeNotSupported:
+		return "KDC_ERR_ETYPE_NOSUPP"
+	case KerberosErrorClientRevoked:
+		return "KDC_ERR_CLIENT_REVOKED"
+	case KerberosErrorKeyExpired:
+		return "KDC_ERR_KEY_EXPIRED"
+	case KerberosErrorPreauthFailed:
+		return "KDC_ERR_PREAUTH_FAILED"
+	case KerberosErrorPreauthRequired:
+		return "KDC_ERR_PREAUTH_REQUIRED"
+	case KerberosErrorBadIntegrity:
+		return "KRB_AP_ERR_BAD_INTEGRITY"
+	case KerberosErrorTicketExpired:
+		return "KRB_AP_ERR_TKT_EXPIRED"
+	case KerberosErrorSkew:
+		return "KRB_AP_ERR_SKEW"
+	case KerberosErrorModified:
+		return "KRB_AP_ERR_MODIFIED"
+	case KerberosErrorResponseTooBig:
+		return "KRB_ERR_RESPONSE_TOO_BIG"
+	case KerberosErrorGeneric:
+		return "KRB_ERR_GENERIC"
+	case KerberosErrorWrongRealm:
+		return "KDC_ERR_WRONG_REALM"
+	default:
+		return fmt.Sprintf("UnknownKerberosErrorCode(%d)", int32(c))
+	}
+}
+
+// KerberosPADataType is the type of pre-authentication data.
+type KerberosPADataType int32
+
+// Common Kerberos pre-authentication data types (RFC 4120 section 7.5.2,
+// RFC 4556 and MS-KILE).
+const (
+	KerberosPADataTypeTGSReq       KerberosPADataType = 1
+	KerberosPADataTypeEncTimestamp KerberosPADataType = 2
+	KerberosPADataTypePWSalt       KerberosPADataType = 3
+	KerberosPADataTypeETypeInfo    KerberosPADataType = 11
+	KerberosPADataTypePKASReq      KerberosPADataType = 16
+	KerberosPADataTypePKASRep      KerberosPADataType = 17
+	KerberosPADataTypeETypeInfo2   KerberosPADataType = 19
+	KerberosPADataTypePACRequest   KerberosPADataType = 128
+	KerberosPADataTypeFXFast       KerberosPADataType = 136
+)
+
+func (t KerberosPADataType) String() string {
+	switch t {
+	case KerberosPADataTypeTGSReq:
+		return "PA-TGS-REQ"
+	case KerberosPADataTypeEncTimestamp:
+		return "PA-ENC-TIMESTAMP"
+	case KerberosPADataTypePWSalt:
+		return "PA-PW-SALT"
+	case KerberosPADataTypeETypeInfo:
+		return "PA-ETYPE-INFO"
+	case KerberosPADataTypePKASReq:
+		return "PA-PK-AS-REQ"
+	case KerberosPADataTypePKASRep:
+		return "PA-PK-AS-REP"
+	case KerberosPADataTypeETypeInfo2:
+		return "PA-ETYPE-INFO2"
+	case KerberosPADataTypePACRequest:
+		return "PA-PAC-REQUEST"
+	case KerberosPADataTypeFXFast:
+		return "PA-FX-FAST"
+	default:
+		return fmt.Sprintf("UnknownKerberosPADataType(%d)", int32(t))
+	}
+}
+
+// Kerberos KDC options, in the KDCOptions field of requests.  RFC 4120
+// numbers the bits from the most significant.
+const (
+	KerberosKDCOptionForwardable           uint32 = 1 << (31 - 1)
+	KerberosKDCOptionForwarded             uint32 = 1 << (31 - 2)
+	KerberosKDCOptionProxiable             uint32 = 1 << (31 - 3)
+	KerberosKDCOptionProxy                 uint32 = 1 << (31 - 4)
+	KerberosKDCOptionAllowPostdate         uint32 = 1 << (31 - 5)
+	KerberosKDCOptionPostdated             uint32 = 1 << (31 - 6)
+	KerberosKDCOptionRenewable             uint32 = 1 << (31 - 8)
+	KerberosKDCOptionCanonicalize          uint32 = 1 << (31 - 15)
+	KerberosKDCOptionDisableTransitedCheck uint32 = 1 << (31 - 26)
+	KerberosKDCOptionRenewableOK           uint32 = 1 << (31 - 27)
+	KerberosKDCOptionEncTktInSkey          uint32 = 1 << (31 - 28)
+	KerberosKDCOptionRenew                 uint32 = 1 << (31 - 30)
+	KerberosKDCOptionValidate              uint32 = 1 << (31 - 31)
+)
+
+// KerberosPrincipalName is the name of a client or service, without its
+// realm.
+type KerberosPrincipalName struct {
+	// Type is the name type, like 1 for a user or 2 for a service.
+	Type       int32
+	Components []string
+}
+
+// String returns n in the usual form, like "krbtgt/EXAMPLE.COM".
+func (n KerberosPrincipalName) String() string {
+	return strings.Join(n.Components, "/")
+}
+
+// KerberosEncryptedData is encrypted data, like the encrypted part of a
+// ticket.
+type KerberosEncryptedData struct {
+	EType KerberosEncryptionType
+	// KVNO is the version of the key the data is encrypted with, or zero
+	// if it's not given.
+	KVNO   uint32
+	Cipher []byte
+}
+
+// KerberosTicket is a ticket, with which a client authenticates to a
+// service.  Only the realm and name of the service are in the clear.
+type KerberosTicket struct {
+	Version int
+	Realm   string
+	SName   KerberosPrincipalName
+	EncPart KerberosEncryptedData
+}
+
+// KerberosPAData is pre-authentication data.
+type KerberosPAData struct {
+	Type  KerberosPADataType
+	Value []byte
+}
+
+// KerberosHostAddress is an address of a client.
+type KerberosHostAddress struct {
+	// Type is the address type, like 2 for IPv4, 24 for IPv6 or 20 for a
+	// NetBIOS name.
+	Type    int32
+	Address []byte
+}
+
+// Kerberos is a Kerberos 5 message (RFC 4120).  Only the parts in the
+// clear are decoded; the rest, like the encrypted part of a ticket, needs
+// keys.
+//
+// Which fields are set depends on the message type.  Requests (AS-REQ and
+// TGS-REQ) set the request fields, and a TGS-REQ also sets Ticket to the
+// ticket it presents.  Replies (AS-REP and TGS-REP) set CRealm, CName,
+// Ticket and EncPart.  Errors set the error fields, CRealm and CName if
+// the client is known, and Realm and SName.  An AP-REQ sets Ticket, and
+// EncPart to its authenticator.  Other messages set only the header.
+type Kerberos struct {
+	BaseLayer
+	// RecordLength is the length in the record marker before the message
+	// over TCP, or zero over UDP (RFC 4120 section 7.2.2).
+	RecordLength uint32
+	Version      int
+	MsgType      KerberosMessageType
+	PAData       []KerberosPAData
+
+	// Request fields.  Realm and SName are also set in errors.
+	KDCOptions      uint32
+	CName           KerberosPrincipalName
+	Realm           string
+	SName           KerberosPrincipalName
+	From, Till      time.Time
+	RTime           time.Time
+	Nonce           uint32
+	EncryptionTypes []KerberosEncryptionType
+	Addresses       []KerberosHostAddress
+
+	// Reply fields.  CRealm is also set in errors.
+	CRealm  string
+	Ticket  *KerberosTicket
+	EncPart KerberosEncryptedData
+
+	// Error fields.
+	CTime, STime time.Time
+	CUsec, SUsec int
+	ErrorCode    KerberosErrorCode
+	EText        string
+	EData        []byte
+}
+
+// LayerType returns LayerTypeKerberos.
+func (k *Kerberos) LayerType() gopacket.LayerType { return LayerTypeKerberos }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (k *Kerberos) CanDecode() gopacket.LayerClass { return LayerTypeKerberos }
+
+// NextLayerType returns gopacket.LayerTypeZero.
+func (k *Kerberos) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// Payload returns nil.
+func (k *Kerberos) Payload() []byte { return nil }
+
+func decodeKerberos(data []byte, p gopacket.PacketBuilder) error {
+	// A TCP segment that doesn't start with a message, like one continuing
+	// a ticket split across segments, is left as payload; reassemble the
+	// stream and use KerberosStream to decode it.
+	if !isKerberosMessage(data) {
+		return gopacket.DecodePayload.Decode(data, p)
+	}
+	k := &Kerberos{}
+	if err := k.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(k)
+	p.SetApplicationLayer(k)
+	return nil
+}
+
+// isKerberosApplicationTag returns whether c is the first byte of a
+// message: a constructed application tag.
+func isKerberosApplicationTag(c byte) bool {
+	return c&0xe0 == 0x60 && c&0x1f != 0x1f
+}
+
+// isKerberosMessage returns whether data holds a whole message, with or
+// without a record marker.
+func isKerberosMessage(data []byte) bool {
+	if len(data) >= 5 && !isKerberosApplicationTag(data[0]) {
+		n := binary.BigEndian.Uint32(data[:4])
+		data = data[4:]
+		if uint64(n) > uint64(len(data)) {
+			return false
+		}
+		data = data[:n]
+	}
+	if len(data) == 0 || !isKerberosApplicationTag(data[0]) {
+		return false
+	}
+	_, _, err := readDER(data)
+	return err == nil
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (k *Kerberos) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	*k = Kerberos{}
+	msg := data
+	if len(data) > 0 && !isKerberosApplicationTag(data[0]) {
+		if len(data) < 4 {
+			df.SetTruncated()
+			return fmt.Errorf("Kerberos length %d too short", len(data))
+		}
+		k.RecordLength = binary.BigEndian.Uint32(data[:4])
+		if k.RecordLength&0x80000000 != 0 {
+			return errors.New("Kerberos record marker reserved bit set")
+		}
+		if uint64(k.RecordLength) > uint64(len(data)-4) {
+			df.SetTruncated()
+			return fmt.Errorf("Kerberos record length %d exceeds %d bytes available", k.RecordLength, len(data)-4)
+		}
+		data = data[:4+k.RecordLength]
+		msg = data[4:]
+	}
+	app, rest, err := readDER(msg)
+	if err != nil {
+		if len(msg) > 0 {
+			df.SetTruncated()
+		}
+		return fmt.Errorf("Kerberos message invalid: %v", err)
+	}
+	if app.class != derClassApplication {
+		return fmt.Errorf("Kerberos message tag of class %d isn't an application tag", app.class)
+	}
+	k.MsgType = KerberosMessageType(app.tag)
+	k.BaseLayer = BaseLayer{Contents: data[:len(data)-len(rest)]}
+	seq, err := readDERExpect(app.bytes, derClassUniversal, derTagSequence)
+	if err != nil {
+		return fmt.Errorf("Kerberos %v invalid: %v", k.MsgType, err)
+	}
+	f, err := seq.fields()
+	if err != nil {
+		return fmt.Errorf("Kerberos %v invalid: %v", k.MsgType, err)
+	}
+	switch k.MsgType {
+	case KerberosMessageTypeASReq, KerberosMessageTypeTGSReq:
+		err = k.decodeRequest(f)
+	case KerberosMessageTypeASRep, KerberosMessageTypeTGSRep:
+		err = k.decodeReply(f)
+	case KerberosMessageTypeError:
+		err = k.decodeError(f)
+	case KerberosMessageTypeAPReq:
+		err = k.decodeAPReq(f)
+	default:
+		err = k.decodeHeader(f, 0)
+	}
+	if err != nil {
+		return fmt.Errorf("Kerberos %v invalid: %v", k.MsgType, err)
+	}
+	return nil
+}
+
+// decodeHeader decodes the protocol version and message type, which are
+// the fields numbered from first, and checks the message type matches the
+// application tag.
+func (k *Kerberos) decodeHeader(f map[int]derValue, first int) error {
+	pvno, err := derInt(f, first)
+	if err != nil {
+		return err
+	}
+	if pvno != 5 {
+		return fmt.Errorf("version %d not supported", pvno)
+	}
+	k.Version = int(pvno)
+	t, err := derInt(f, first+1)
+	if err != nil {
+		return err
+	}
+	if t != int64(k.MsgType) {
+		return fmt.Errorf("message type %d in application tag %d", t, k.MsgType)
+	}
+	return nil
+}
+
+func (k *Kerberos) decodeRequest(f map[int]derValue) error {
+	if err := k.decodeHeader(f, 1); err != nil {
+		return err
+	}
+	var err error
+	if v, ok := f[3]; ok {
+		if k.PAData, err = decodeKerberosPAData(v); err != nil {
+			return err
+		}
+	}
+	body, ok := f[4]
+	if !ok {
+		return errors.New("request body missing")
+	}
+	b, err := body.fields()
+	if err != nil {
+		return err
+	}
+	if v, ok := b[0]; ok {
+		opts, err := v.bitString()
+		if err != nil {
+			return err
+		}
+		var o [4]byte
+		copy(o[:], opts)
+		k.KDCOptions = binary.BigEndian.Uint32(o[:])
+	}
+	if v, ok := b[1]; ok {
+		if k.CName, err = decodeKerberosPrincipalName(v); err != nil {
+			return err
+		}
+	}
+	if k.Realm, err = derString(b, 2); err != nil {
+		return err
+	}
+	if v, ok := b[3]; ok {
+		if k.SName, err = decodeKerberosPrincipalName(v); err != nil {
+			return err
+		}
+	}
+	if v, ok := b[4]; ok {
+		if k.From, err = v.time(); err != nil {
+			return err
+		}
+	}
+	v, ok := b[5]
+	if !ok {
+		return errors.New("till time missing")
+	}
+	if k.Till, err = v.time(); err != nil {
+		return err
+	}
+	if v, ok := b[6]; ok {
+		if k.RTime, err = v.time(); err != nil {
+			return err
+		}
+	}
+	nonce, err := derInt(b, 7)
+	if err != nil {
+		return err
+	}
+	k.Nonce = uint32(nonce)
+	etypes, ok := b[8]
+	if !ok {
+		return errors.New("encryption types missing")
+	}
+	es, err := etypes.children()
+	if err != nil {
+		return err
+	}
+	for _, e := range es {
+		n, err := e.int()
+		if err != nil {
+			return err
+		}
+		k.EncryptionTypes = append(k.EncryptionTypes, KerberosEncryptionType(n))
+	}
+	if v, ok := b[9]; ok {
+		if k.Addresses, err = decodeKerberosHostAddresses(v); err != nil {
+			return err
+		}
+	}
+	// A TGS-REQ presents a ticket in an AP-REQ in its PA-TGS-REQ.
+	for _, pa := range k.PAData {
+		if pa.Type != KerberosPADataTypeTGSReq {
+			continue
+		}
+		ap := &Kerberos{}
+		if err := ap.DecodeFromBytes(pa.Value, gopacket.NilDecodeFeedback); err != nil {
+			return err
+		}
+		if ap.MsgType != KerberosMessageTypeAPReq {
+			return fmt.Errorf("PA-TGS-REQ holds %v", ap.MsgType)
+		}
+		k.Ticket = ap.Ticket
+	}
+	return nil
+}
+
+func (k *Kerberos) decodeReply(f map[int]derValue) error {
+	if err := k.decodeHeader(f, 0); err != nil {
+		return err
+	}
+	var err error
+	if v, ok := f[2]; ok {
+		if k.PAData, err = decodeKerberosPAData(v); err != nil {
+			return err
+		}
+	}
+	if k.CRealm, err = derString(f, 3); err != nil {
+		return err
+	}
+	v, ok := f[4]
+	if !ok {
+		return errors.New("client name missing")
+	}
+	if k.CName, err = decodeKerberosPrincipalName(v); err != nil {
+		return err
+	}
+	if k.Ticket, err = derTicket(f, 5); err != nil {
+		return err
+	}
+	if k.EncPart, err = derEncryptedData(f, 6); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (k *Kerberos) decodeAPReq(f map[int]derValue) error {
+	if err := k.decodeHeader(f, 0); err != nil {
+		return err
+	}
+	var err error
+	if k.Ticket, err = derTicket(f, 3); err != nil {
+		return err
+	}
+	if k.EncPart, err = derEncryptedData(f, 4); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (k *Kerberos) decodeError(f map[int]derValue) error {
+	if err := k.decodeHeader(f, 0); err != nil {
+		return err
+	}
+	var err error
+	if v, ok := f[2]; ok {
+		if k.CTime, err = v.time(); err != nil {
+			return err
+		}
+	}
+	if _, ok := f[3]; ok {
+		n, err := derInt(f, 3)
+		if err != nil {
+			return err
+		}
+		k.CUsec = int(n)
+	}
+	v, ok := f[4]
+	if !ok {
+		return errors.New("server time missing")
+	}
+	if k.STime, err = v.time(); err != nil {
+		return err
+	}
+	n, err := derInt(f, 5)
+	if err != nil {
+		return err
+	}
+	k.SUsec = int(n)
+	if n, err = derInt(f, 6); err != nil {
+		return err
+	}
+	k.ErrorCode = KerberosErrorCode(n)
+	if _, ok := f[7]; ok {
+		if k.CRealm, err = derString(f, 7); err != nil {
+			return err
+		}
+	}
+	if v, ok := f[8]; ok {
+		if k.CName, err = decodeKerberosPrincipalName(v); err != nil {
+			return err
+		}
+	}
+	if k.Realm, err = derString(f, 9); err != nil {
+		return err
+	}
+	if v, ok = f[10]; !ok {
+		return errors.New("server name missing")
+	}
+	if k.SName, err = decodeKerberosPrincipalName(v); err != nil {
+		return err
+	}
+	if _, ok := f[11]; ok {
+		if k.EText, err = derString(f, 11); err != nil {
+			return err
+		}
+	}
+	if v, ok := f[12]; ok {
+		if k.EData, err = v.octets(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// derInt returns the INTEGER field numbered i.
+func derInt(f map[int]derValue, i int) (int64, error) {
+	v, ok := f[i]
+	if !ok {
+		return 0, fmt.Errorf("field [%d] missing", i)
+	}
+	return v.int()
+}
+
+// derString returns the string field numbered i.
+func derString(f map[int]derValue, i int) (string, error) {
+	v, ok := f[i]
+	if !ok {
+		return "", fmt.Errorf("field [%d] missing", i)
+	}
+	return v.string()
+}
+
+func derTicket(f map[int]derValue, i int) (*KerberosTicket, error) {
+	v, ok := f[i]
+	if !ok {
+		return nil, errors.New("ticket missing")
+	}
+	if v.class != derClassApplication || v.tag != 1 {
+		return nil, fmt.Errorf("ticket tag %d of class %d invalid", v.tag, v.class)
+	}
+	seq, err := readDERExpect(v.bytes, derClassUniversal, derTagSequence)
+	if err != nil {
+		return nil, err
+	}
+	tf, err := seq.fields()
+	if err != nil {
+		return nil, err
+	}
+	t := &KerberosTicket{}
+	n, err := derInt(tf, 0)
+	if err != nil {
+		return nil, err
+	}
+	t.Version = int(n)
+	if t.Realm, err = derString(tf, 1); err != nil {
+		return nil, err
+	}
+	sname, ok := tf[2]
+	if !ok {
+		return nil, errors.New("ticket service name missing")
+	}
+	if t.SName, err = decodeKerberosPrincipalName(sname); err != nil {
+		return nil, err
+	}
+	if t.EncPart, err = derEncryptedData(tf, 3); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func derEncryptedData(f map[int]derValue, i int) (KerberosEncryptedData, error) {
+	var e KerberosEncryptedData
+	v, ok := f[i]
+	if !ok {
+		return e, fmt.Errorf("encrypted data [%d] missing", i)
+	}
+	ef, err := v.fields()
+	if err != nil {
+		return e, err
+	}
+	n, err := derInt(ef, 0)
+	if err != nil {
+		return e, err
+	}
+	e.EType = KerberosEncryptionType(n)
+	if _, ok := ef[1]; ok {
+		if n, err = derInt(ef, 1); err != nil {
+			return e, err
+		}
+		e.KVNO = uint32(n)
+	}
+	c, ok := ef[2]
+	if !ok {
+		return e, errors.New("cipher text missing")
+	}
+	if e.Cipher, err = c.octets(); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+func decodeKerberosPrincipalName(v derValue) (KerberosPrincipalName, error) {
+	var n KerberosPrincipalName
+	f, err := v.fields()
+	if err != nil {
+		return n, err
+	}
+	t, err := derInt(f, 0)
+	if err != nil {
+		return n, err
+	}
+	n.Type = int32(t)
+	names, ok := f[1]
+	if !ok {
+		return n, errors.New("name string missing")
+	}
+	cs, err := names.children()
+	if err != nil {
+		return n, err
+	}
+	for _, c := range cs {
+		s, err := c.string()
+		if err != nil {
+			return n, err
+		}
+		n.Components = append(n.Components, s)
+	}
+	return n, nil
+}
+
+func decodeKerberosPAData(v derValue) ([]KerberosPAData, error) {
+	cs, err := v.children()
+	if err != nil {
+		return nil, err
+	}
+	var out []KerberosPAData
+	for _, c := range cs {
+		f, err := c.fields()
+		if err != nil {
+			return nil, err
+		}
+		t, err := derInt(f, 1)
+		if err != nil {
+			return nil, err
+		}
+		pa := KerberosPAData{Type: KerberosPADataType(t)}
+		if v, ok := f[2]; ok {
+			if pa.Value, err = v.octets(); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, pa)
+	}
+	return out, nil
+}
+
+func decodeKerberosHostAddresses(v derValue) ([]KerberosHostAddress, error) {
+	cs, err := v.children()
+	if err != nil {
+		return nil, err
+	}
+	var out []KerberosHostAddress
+	for _, c := range cs {
+		f, err := c.fields()
+		if err != nil {
+			return nil, err
+		}
+		t, err := derInt(f, 0)
+		if err != nil {
+			return nil, err
+		}
+		a := KerberosHostAddress{Type: int32(t)}
+		if v, ok := f[1]; ok {
+			if a.Address, err = v.octets(); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// maxKerberosRecord is the largest Kerberos TCP record KerberosStream
+// accepts.  It matches the default request limit of Heimdal's KDC and
+// Windows' largest MaxTokenSize, so even tickets carrying large PACs fit.
+const maxKerberosRecord = 1 << 16
+
+// KerberosStream splits one direction of a reassembled Kerberos TCP
+// connection into messages, including those split across TCP segments,
+// as tickets carrying authorization data often are.
+type KerberosStream struct {
+	buf streamBuffer
+}
+
+// Decode appends data from the stream and returns the messages completed
+// by it.  After an error, or a gap in the stream, call Reset before
+// decoding more data.
+func (s *KerberosStream) Decode(data []byte) ([]*Kerberos, error) {
+	ls, err := s.buf.decode(data, "Kerberos", 4+maxKerberosRecord, kerberosFrame)
+	var out []*Kerberos
+	for _, l := range ls {
+		out = append(out, l.(*Kerberos))
+	}
+	return out, err
+}
+
+// kerberosFrame is the streamFramer of KerberosStream.
+func kerberosFrame(data []byte) (int64, layerDecodingLayer, error) {
+	if len(data) < 4 {
+		return 0, nil, nil
+	}
+	n := binary.BigEndian.Uint32(data[:4])
+	if n&0x80000000 != 0 {
+		return 0, nil, errors.New("Kerberos record marker reserved bit set")
+	}
+	return 4 + int64(n), &Kerberos{}, nil
+}
+
+// Reset discards any partial message.
+func (s *KerberosStream) Reset() {
+	s.buf.reset()
+}
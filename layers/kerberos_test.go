@@ -0,0 +1,264 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testDER encodes a DER value with the given tag byte and contents.
+func testDER(tag byte, parts ...[]byte) []byte {
+	c := bytes.Join(parts, nil)
+	out := []byte{tag}
+	switch {
+	case len(c) < 0x80:
+		out = append(out, byte(len(c)))
+	case len(c) < 0x100:
+		out = append(out, 0x81, byte(len(c)))
+	default:
+		out = append(out, 0x82, byte(len(c)>>8), byte(len(c)))
+	}
+	return append(out, c...)
+}
+
+func testDERField(n int, v []byte) []byte { return testDER(0xa0|byte(n), v) }
+func testDERSeq(parts ...[]byte) []byte   { return testDER(0x30, parts...) }
+func testDERString(s string) []byte       { return testDER(0x1b, []byte(s)) }
+func testDERTime(s string) []byte         { return testDER(0x18, []byte(s)) }
+
+func testDERInt(n int64) []byte {
+	b := []byte{byte(n)}
+	// Add bytes until the rest is just the sign extension of the first.
+	for m := n >> 8; !(m == 0 && b[0] < 0x80) && !(m == -1 && b[0] >= 0x80); m >>= 8 {
+		b = append([]byte{byte(m)}, b...)
+	}
+	return testDER(0x02, b)
+}
+
+func testKerberosPrincipal(t int64, names ...string) []byte {
+	var ns [][]byte
+	for _, n := range names {
+		ns = append(ns, testDERString(n))
+	}
+	return testDERSeq(testDERField(0, testDERInt(t)), testDERField(1, testDERSeq(ns...)))
+}
+
+func testKerberosEncData(etype, kvno int64, cipher []byte) []byte {
+	return testDERSeq(testDERField(0, testDERInt(etype)), testDERField(1, testDERInt(kvno)), testDERField(2, testDER(0x04, cipher)))
+}
+
+func testKerberosTicket() []byte {
+	return testDER(0x61, testDERSeq(
+		testDERField(0, testDERInt(5)),
+		testDERField(1, testDERString("EXAMPLE.COM")),
+		testDERField(2, testKerberosPrincipal(2, "krbtgt", "EXAMPLE.COM")),
+		testDERField(3, testKerberosEncData(18, 2, bytes.Repeat([]byte{0xee}, 300))),
+	))
+}
+
+func TestKerberosASReq(t *testing.T) {
+	req := testDER(0x6a, testDERSeq(
+		testDERField(1, testDERInt(5)),
+		testDERField(2, testDERInt(10)),
+		testDERField(3, testDERSeq(testDERSeq(
+			testDERField(1, testDERInt(128)),
+			testDERField(2, testDER(0x04, testDERSeq(testDERField(0, []byte{0x01, 0x01, 0xff})))),
+		))),
+		testDERField(4, testDERSeq(
+			testDERField(0, testDER(0x03, []byte{0, 0x40, 0x81, 0x00, 0x10})),
+			testDERField(1, testKerberosPrincipal(1, "alice")),
+			testDERField(2, testDERString("EXAMPLE.COM")),
+			testDERField(3, testKerberosPrincipal(2, "krbtgt", "EXAMPLE.COM")),
+			testDERField(5, testDERTime("20370913024805Z")),
+			testDERField(7, testDERInt(0x7abcdef0)),
+			testDERField(8, testDERSeq(testDERInt(18), testDERInt(17), testDERInt(23), testDERInt(-135))),
+			testDERField(9, testDERSeq(testDERSeq(testDERField(0, testDERInt(20)), testDERField(1, testDER(0x04, []byte("WS01            ")))))),
+		)),
+	))
+	ip := &IPv4{Version: 4, TTL: 128, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 50}, DstIP: net.IP{10, 0, 0, 1}}
+	udp := &UDP{SrcPort: 51000, DstPort: 88}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload(req)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeKerberos}, t)
+	got := p.Layer(LayerTypeKerberos).(*Kerberos)
+	if got.MsgType != KerberosMessageTypeASReq || got.Version != 5 || got.RecordLength != 0 {
+		t.Errorf("got header %v version %d", got.MsgType, got.Version)
+	}
+	want := KerberosKDCOptionForwardable | KerberosKDCOptionRenewable | KerberosKDCOptionCanonicalize | KerberosKDCOptionRenewableOK
+	if got.KDCOptions != want {
+		t.Errorf("got KDC options %#x, want %#x", got.KDCOptions, want)
+	}
+	if got.CName.String() != "alice" || got.CName.Type != 1 || got.Realm != "EXAMPLE.COM" || got.SName.String() != "krbtgt/EXAMPLE.COM" {
+		t.Errorf("got %v@%s for %v", got.CName, got.Realm, got.SName)
+	}
+	if !got.Till.Equal(time.Date(2037, 9, 13, 2, 48, 5, 0, time.UTC)) || !got.From.IsZero() || got.Nonce != 0x7abcdef0 {
+		t.Errorf("got till %v, from %v, nonce %#x", got.Till, got.From, got.Nonce)
+	}
+	etypes := []KerberosEncryptionType{
+		KerberosEncryptionTypeAES256CTSHMACSHA196, KerberosEncryptionTypeAES128CTSHMACSHA196,
+		KerberosEncryptionTypeRC4HMAC, KerberosEncryptionTypeRC4HMACOldExp,
+	}
+	if !reflect.DeepEqual(got.EncryptionTypes, etypes) {
+		t.Errorf("got encryption types %v, want %v", got.EncryptionTypes, etypes)
+	}
+	if len(got.PAData) != 1 || got.PAData[0].Type != KerberosPADataTypePACRequest {
+		t.Errorf("got pre-authentication data %v", got.PAData)
+	}
+	if len(got.Addresses) != 1 || got.Addresses[0].Type != 20 || string(got.Addresses[0].Address) != "WS01            " {
+		t.Errorf("got addresses %v", got.Addresses)
+	}
+	if got.Ticket != nil {
+		t.Errorf("got ticket %+v in AS-REQ", got.Ticket)
+	}
+}
+
+func TestKerberosTCP(t *testing.T) {
+	setTCPPortLayerType(t, 88, LayerTypeKerberos)
+	// A KRB-ERROR asking for pre-authentication, in one segment.
+	krbErr := testDER(0x7e, testDERSeq(
+		testDERField(0, testDERInt(5)),
+		testDERField(1, testDERInt(30)),
+		testDERField(4, testDERTime("20240301100000Z")),
+		testDERField(5, testDERInt(123456)),
+		testDERField(6, testDERInt(25)),
+		testDERField(9, testDERString("EXAMPLE.COM")),
+		testDERField(10, testKerberosPrincipal(2, "krbtgt", "EXAMPLE.COM")),
+		testDERField(12, testDER(0x04, []byte{0x30, 0x00})),
+	))
+	record := make([]byte, 4, 4+len(krbErr))
+	binary.BigEndian.PutUint32(record, uint32(len(krbErr)))
+	record = append(record, krbErr...)
+
+	ip := &IPv4{Version: 4, TTL: 128, Protocol: IPProtocolTCP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 50}}
+	tcp := &TCP{SrcPort: 88, DstPort: 51000, PSH: true, ACK: true, Window: 1024}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, tcp, gopacket.Payload(record)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeTCP, LayerTypeKerberos}, t)
+	got := p.Layer(LayerTypeKerberos).(*Kerberos)
+	if got.MsgType != KerberosMessageTypeError || got.ErrorCode != KerberosErrorPreauthRequired || got.RecordLength != uint32(len(krbErr)) {
+		t.Errorf("got %v %v in record of %d bytes", got.MsgType, got.ErrorCode, got.RecordLength)
+	}
+	if got.ErrorCode.String() != "KDC_ERR_PREAUTH_REQUIRED" || got.SUsec != 123456 || !got.STime.Equal(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("got error %v at %v +%dµs", got.ErrorCode, got.STime, got.SUsec)
+	}
+	if got.Realm != "EXAMPLE.COM" || got.SName.String() != "krbtgt/EXAMPLE.COM" || got.CRealm != "" || len(got.EData) != 2 {
+		t.Errorf("got error for %v@%s, client realm %q, data %x", got.SName, got.Realm, got.CRealm, got.EData)
+	}
+
+	// An AS-REP too large for one segment.  The segment continuing it is
+	// left as payload, and a stream reassembles it.
+	rep := testDER(0x6b, testDERSeq(
+		testDERField(0, testDERInt(5)),
+		testDERField(1, testDERInt(11)),
+		testDERField(3, testDERString("EXAMPLE.COM")),
+		testDERField(4, testKerberosPrincipal(1, "alice")),
+		testDERField(5, testKerberosTicket()),
+		testDERField(6, testKerberosEncData(18, 3, bytes.Repeat([]byte{0xdd}, 200))),
+	))
+	record = make([]byte, 4, 4+len(rep))
+	binary.BigEndian.PutUint32(record, uint32(len(rep)))
+	record = append(record, rep...)
+	if p := gopacket.NewPacket(record[:300], LayerTypeKerberos, testDecodeOptions); p.Layer(LayerTypeKerberos) != nil {
+		t.Error("decoded partial message")
+	}
+	var s KerberosStream
+	msgs, err := s.Decode(record[:300])
+	if err != nil || len(msgs) != 0 {
+		t.Fatalf("got %d messages from partial record, %v", len(msgs), err)
+	}
+	if msgs, err = s.Decode(record[300:]); err != nil || len(msgs) != 1 {
+		t.Fatalf("got %d messages, %v", len(msgs), err)
+	}
+	got = msgs[0]
+	if got.MsgType != KerberosMessageTypeASRep || got.CName.String() != "alice" || got.CRealm != "EXAMPLE.COM" {
+		t.Errorf("got %v for %v@%s", got.MsgType, got.CName, got.CRealm)
+	}
+	if got.Ticket == nil || got.Ticket.SName.String() != "krbtgt/EXAMPLE.COM" || got.Ticket.EncPart.EType != KerberosEncryptionTypeAES256CTSHMACSHA196 || got.Ticket.EncPart.KVNO != 2 || len(got.Ticket.EncPart.Cipher) != 300 {
+		t.Errorf("got ticket %+v", got.Ticket)
+	}
+	if got.EncPart.KVNO != 3 || len(got.EncPart.Cipher) != 200 {
+		t.Errorf("got encrypted part %v kvno %d", got.EncPart.EType, got.EncPart.KVNO)
+	}
+
+	// A record marker claiming more than the largest record is refused
+	// rather than buffered.
+	s.Reset()
+	if _, err := s.Decode([]byte{0x7f, 0xff, 0xff, 0xff, 0x6a}); err == nil {
+		t.Error("no error for oversized record")
+	}
+}
+
+func TestKerberosTGSReq(t *testing.T) {
+	apReq := testDER(0x6e, testDERSeq(
+		testDERField(0, testDERInt(5)),
+		testDERField(1, testDERInt(14)),
+		testDERField(2, testDER(0x03, []byte{0, 0, 0, 0, 0})),
+		testDERField(3, testKerberosTicket()),
+		testDERField(4, testKerberosEncData(18, 0, []byte{1, 2, 3})),
+	))
+	req := testDER(0x6c, testDERSeq(
+		testDERField(1, testDERInt(5)),
+		testDERField(2, testDERInt(12)),
+		testDERField(3, testDERSeq(testDERSeq(testDERField(1, testDERInt(1)), testDERField(2, testDER(0x04, apReq))))),
+		testDERField(4, testDERSeq(
+			testDERField(0, testDER(0x03, []byte{0, 0x40, 0x81, 0, 0})),
+			testDERField(2, testDERString("EXAMPLE.COM")),
+			testDERField(3, testKerberosPrincipal(2, "cifs", "fs01.example.com")),
+			testDERField(5, testDERTime("20240301200000Z")),
+			testDERField(7, testDERInt(1)),
+			testDERField(8, testDERSeq(testDERInt(23))),
+		)),
+	))
+	got := &Kerberos{}
+	if err := got.DecodeFromBytes(req, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if got.MsgType != KerberosMessageTypeTGSReq || got.SName.String() != "cifs/fs01.example.com" || got.CName.Components != nil {
+		t.Errorf("got %v for %v", got.MsgType, got.SName)
+	}
+	if got.Ticket == nil || got.Ticket.Realm != "EXAMPLE.COM" || got.Ticket.SName.String() != "krbtgt/EXAMPLE.COM" {
+		t.Errorf("got ticket %+v", got.Ticket)
+	}
+
+	for _, test := range []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", req[:len(req)-1]},
+		{"mismatched type", bytes.Replace(req, testDERField(2, testDERInt(12)), testDERField(2, testDERInt(10)), 1)},
+		{"version 4", bytes.Replace(req, testDERField(1, testDERInt(5)), testDERField(1, testDERInt(4)), 1)},
+		{"bad ticket", bytes.Replace(req, []byte{0x61, 0x82}, []byte{0x62, 0x82}, 1)},
+		{"not DER", []byte{0x6a, 0x80, 0x00, 0x00}},
+	} {
+		if err := (&Kerberos{}).DecodeFromBytes(test.data, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("%s: decoded without error", test.name)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// L2TPAVPType is the attribute type of an L2TP attribute value pair.  The
+// values here are for IETF AVPs (vendor ID 0).
+type L2TPAVPType uint16
+
+const (
+	L2TPAVPTypeMessageType                 L2TPAVPType = 0
+	L2TPAVPTypeResultCode                  L2TPAVPType = 1
+	L2TPAVPTypeProtocolVersion             L2TPAVPType = 2
+	L2TPAVPTypeFramingCapabilities         L2TPAVPType = 3
+	L2TPAVPTypeBearerCapabilities          L2TPAVPType = 4
+	L2TPAVPTypeTieBreaker                  L2TPAVPType = 5
+	L2TPAVPTypeFirmwareRevision            L2TPAVPType = 6
+	L2TPAVPTypeHostName                    L2TPAVPType = 7
+	L2TPAVPTypeVendorName                  L2TPAVPType = 8
+	L2TPAVPTypeAssignedTunnelID            L2TPAVPType = 9
+	L2TPAVPTypeReceiveWindowSize           L2TPAVPType = 10
+	L2TPAVPTypeChallenge                   L2TPAVPType = 11
+	L2TPAVPTypeChallengeResponse           L2TPAVPType = 13
+	L2TPAVPTypeAssignedSessionID           L2TPAVPType = 14
+	L2TPAVPTypeCallSerialNumber            L2TPAVPType = 15
+	L2TPAVPTypeFramingType                 L2TPAVPType = 19
+	L2TPAVPTypeCalledNumber                L2TPAVPType = 21
+	L2TPAVPTypeCallingNumber               L2TPAVPType = 22
+	L2TPAVPTypeTxConnectSpeed              L2TPAVPType = 24
+	L2TPAVPTypeRandomVector                L2TPAVPType = 36
+	L2TPAVPTypeAssignedControlConnectionID L2TPAVPType = 61
+	L2TPAVPTypePseudowireCapabilities      L2TPAVPType = 62
+	L2TPAVPTypeLocalSessionID              L2TPAVPType = 63
+	L2TPAVPTypeRemoteSessionID             L2TPAVPType = 64
+	L2TPAVPTypeAssignedCookie              L2TPAVPType = 65
+	L2TPAVPTypeRemoteEndID                 L2TPAVPType = 66
+	L2TPAVPTypePseudowireType              L2TPAVPType = 68
+	L2TPAVPTypeL2SpecificSublayer          L2TPAVPType = 69
+)
+
+// L2TPMessageType is the value of a Message Type AVP, which is the first AVP
+// of every control message.
+type L2TPMessageType uint16
+
+const (
+	L2TPMessageTypeSCCRQ   L2TPMessageType = 1
+	L2TPMessageTypeSCCRP   L2TPMessageType = 2
+	L2TPMessageTypeSCCCN   L2TPMessageType = 3
+	L2TPMessageTypeStopCCN L2TPMessageType = 4
+	L2TPMessageTypeHello   L2TPMessageType = 6
+	L2TPMessageTypeOCRQ    L2TPMessageType = 7
+	L2TPMessageTypeOCRP    L2TPMessageType = 8
+	L2TPMessageTypeOCCN    L2TPMessageType = 9
+	L2TPMessageTypeICRQ    L2TPMessageType = 10
+	L2TPMessageTypeICRP    L2TPMessageType = 11
+	L2TPMessageTypeICCN    L2TPMessageType = 12
+	L2TPMessageTypeCDN     L2TPMessageType = 14
+	L2TPMessageTypeWEN     L2TPMessageType = 15
+	L2TPMessageTypeSLI     L2TPMessageType = 16
+)
+
+func (t L2TPMessageType) String() string {
+	switch t {
+	case L2TPMessageTypeSCCRQ:
+		return "SCCRQ"
+	case L2TPMessageTypeSCCRP:
+		return "SCCRP"
+	case L2TPMessageTypeSCCCN:
+		return "SCCCN"
+	case L2TPMessageTypeStopCCN:
+		return "StopCCN"
+	case L2TPMessageTypeHello:
+		return "Hello"
+	case L2TPMessageTypeOCRQ:
+		return "OCRQ"
+	case L2TPMessageTypeOCRP:
+		return "OCRP"
+	case L2TPMessageTypeOCCN:
+		return "OCCN"
+	case L2TPMessageTypeICRQ:
+		return "ICRQ"
+	case L2TPMessageTypeICRP:
+		return "ICRP"
+	case L2TPMessageTypeICCN:
+		return "ICCN"
+	case L2TPMessageTypeCDN:
+		return "CDN"
+	case L2TPMessageTypeWEN:
+		return "WEN"
+	case L2TPMessageTypeSLI:
+		return "SLI"
+	}
+	return fmt.Sprintf("UnknownL2TPMessageType(%d)", uint16(t))
+}
+
+// L2TPAVP is an attribute value pair from an L2TP control message.  Hidden
+// AVPs are left encrypted.
+type L2TPAVP struct {
+	Mandatory, Hidden bool
+	VendorID          uint16
+	Type              L2TPAVPType
+	Value             []byte
+}
+
+// L2TPv3DataConfig says how to decode L2TPv3 data messages.  The cookie
+// length, whether the default L2-specific sublayer is used and what the
+// session carries are all negotiated in the control channel, so they can't
+// be determined from the data packets themselves.
+type L2TPv3DataConfig struct {
+	// CookieLength is 0, 4 or 8.
+	CookieLength int
+	// L2SpecificSublayer is true if data messages carry the 4 byte default
+	// L2-specific sublayer.
+	L2SpecificSublayer bool
+	// Payload is the layer type carried by the session.
+	Payload gopacket.LayerType
+}
+
+// L2TPv3Data is used when decoding every L2TPv3 data message.  The default
+// matches Linux's Ethernet pseudowires: no cookie and no sublayer.
+var L2TPv3Data = L2TPv3DataConfig{Payload: LayerTypeEthernet}
+
+// L2TP is an L2TP header carried over UDP (normally port 1701), as
+// described in RFC 2661 for version 2 and RFC 3931 for version 3.
+//
+// For version 2, TunnelID and SessionID are the 16 bit tunnel and session
+// IDs and data messages carry PPP.  For version 3 over UDP, TunnelID is the
+// control connection ID of control messages, SessionID the 32 bit session
+// ID of data messages, and data messages are decoded as described by
+// L2TPv3Data.
+type L2TP struct {
+	BaseLayer
+	Version uint8
+	// Control is the T bit: set for control messages, clear for data.
+	Control         bool
+	LengthPresent   bool
+	SequencePresent bool
+	OffsetPresent   bool
+	Priority        bool
+	Length          uint16
+	TunnelID        uint32
+	SessionID       uint32
+	Ns, Nr          uint16
+	OffsetSize      uint16
+	// Cookie and L2SpecificSublayer are only set for L2TPv3 data messages.
+	Cookie             []byte
+	L2SpecificSublayer []byte
+	AVPs               []L2TPAVP
+}
+
+// LayerType returns LayerTypeL2TP.
+func (l *L2TP) LayerType() gopacket.LayerType { return LayerTypeL2TP }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (l *L2TP) CanDecode() gopacket.LayerClass { return LayerTypeL2TP }
+
+// MessageType returns the message type of a control message, or false if it
+// is a data message or a zero-length acknowledgment.
+func (l *L2TP) MessageType() (L2TPMessageType, bool) {
+	if !l.Control || len(l.AVPs) == 0 {
+		return 0, false
+	}
+	a := l.AVPs[0]
+	if a.VendorID != 0 || a.Type != L2TPAVPTypeMessageType || a.Hidden || len(a.Value) != 2 {
+		return 0, false
+	}
+	return L2TPMessageType(binary.BigEndian.Uint16(a.Value)), true
+}
+
+// AVP returns the first IETF AVP of the given type, or nil.
+func (l *L2TP) AVP(t L2TPAVPType) *L2TPAVP {
+	for i := range l.AVPs {
+		if l.AVPs[i].VendorID == 0 && l.AVPs[i].Type == t {
+			return &l.AVPs[i]
+		}
+	}
+	return nil
+}
+
+func (l *L2TP) reset() {
+	l.Version, l.Control, l.LengthPresent, l.SequencePresent, l.OffsetPresent, l.Priority = 0, false, false, false, false, false
+	l.Length, l.TunnelID, l.SessionID, l.Ns, l.Nr, l.OffsetSize = 0, 0, 0, 0, 0, 0
+	l.Cookie, l.L2SpecificSublayer, l.AVPs = nil, nil, nil
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (l *L2TP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	l.reset()
+	if len(data) < 2 {
+		df.SetTruncated()
+		return fmt.Errorf("L2TP header too short: %d bytes", len(data))
+	}
+	l.Control = data[0]&0x80 != 0
+	l.LengthPresent = data[0]&0x40 != 0
+	l.SequencePresent = data[0]&0x08 != 0
+	l.OffsetPresent = data[0]&0x02 != 0
+	l.Priority = data[0]&0x01 != 0
+	l.Version = data[1] & 0x0f
+	switch l.Version {
+	case 2:
+		return l.decodeV2(data, df)
+	case 3:
+		if l.Control {
+			return l.decodeV3Control(data, df)
+		}
+		// Data messages over UDP have a 4 byte header with only the T bit
+		// and version, followed by the session header.
+		if len(data) < 4 {
+			df.SetTruncated()
+			return fmt.Errorf("L2TPv3 header too short: %d bytes", len(data))
+		}
+		return l.decodeV3Session(data, 4, df)
+	}
+	return fmt.Errorf("unsupported L2TP version %d", l.Version)
+}
+
+func (l *L2TP) decodeV2(data []byte, df gopacket.DecodeFeedback) error {
+	size := 6
+	if l.LengthPresent {
+		size += 2
+	}
+	if l.SequencePresent {
+		size += 4
+	}
+	if l.OffsetPresent {
+		size += 2
+	}
+	if len(data) < size {
+		df.SetTruncated()
+		return fmt.Errorf("L2TP header too short: %d bytes, want %d", len(data), size)
+	}
+	offset := 2
+	end := len(data)
+	if l.LengthPresent {
+		l.Length = binary.BigEndian.Uint16(data[2:4])
+		if int(l.Length) < size || int(l.Length) > len(data) {
+			df.SetTruncated()
+			return fmt.Errorf("L2TP length %d invalid for %d bytes", l.Length, len(data))
+		}
+		end = int(l.Length)
+		offset += 2
+	}
+	l.TunnelID = uint32(binary.BigEndian.Uint16(data[offset : offset+2]))
+	l.SessionID = uint32(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
+	offset += 4
+	if l.SequencePresent {
+		l.Ns = binary.BigEndian.Uint16(data[offset : offset+2])
+		l.Nr = binary.BigEndian.Uint16(data[offset+2 : offset+4])
+		offset += 4
+	}
+	if l.OffsetPresent {
+		l.OffsetSize = binary.BigEndian.Uint16(data[offset : offset+2])
+		offset += 2 + int(l.OffsetSize)
+		if offset > end {
+			df.SetTruncated()
+			return fmt.Errorf("L2TP offset size %d overruns packet", l.OffsetSize)
+		}
+	}
+	if l.Control {
+		if !l.LengthPresent || !l.SequencePresent {
+			return fmt.Errorf("L2TP control message without length and sequence fields")
+		}
+		return l.decodeAVPs(data[:end], offset)
+	}
+	l.BaseLayer = BaseLayer{Contents: data[:offset], Payload: data[offset:end]}
+	return nil
+}
+
+func (l *L2TP) decodeV3Control(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 12 {
+		df.SetTruncated()
+		return fmt.Errorf("L2TPv3 control header too short: %d bytes", len(data))
+	}
+	l.Length = binary.BigEndian.Uint16(data[2:4])
+	if l.Length < 12 || int(l.Length) > len(data) {
+		df.SetTruncated()
+		return fmt.Errorf("L2TPv3 length %d invalid for %d bytes", l.Length, len(data))
+	}
+	l.TunnelID = binary.BigEndian.Uint32(data[4:8])
+	l.Ns = binary.BigEndian.Uint16(data[8:10])
+	l.Nr = binary.BigEndian.Uint16(data[10:12])
+	return l.decodeAVPs(data[:l.Length], 12)
+}
+
+// decodeV3Session decodes the session header of an L2TPv3 data message that
+// starts at offset.
+func (l *L2TP) decodeV3Session(data []byte, offset int, df gopacket.DecodeFeedback) error {
+	c := L2TPv3Data
+	size := offset + 4 + c.CookieLength
+	if c.L2SpecificSublayer {
+		size += 4
+	}
+	if len(data) < size {
+		df.SetTruncated()
+		return fmt.Errorf("L2TPv3 session header too short: %d bytes, want %d", len(data), size)
+	}
+	l.SessionID = binary.BigEndian.Uint32(data[offset : offset+4])
+	offset += 4
+	if c.CookieLength > 0 {
+		l.Cookie = data[offset : offset+c.CookieLength]
+		offset += c.CookieLength
+	}
+	if c.L2SpecificSublayer {
+		l.L2SpecificSublayer = data[offset : offset+4]
+		offset += 4
+	}
+	l.BaseLayer = BaseLayer{Contents: data[:offset], Payload: data[offset:]}
+	return nil
+}
+
+func (l *L2TP) decodeAVPs(data []byte, offset int) error {
+	for rest := data[offset:]; len(rest) > 0; {
+		if len(rest) < 6 {
+			return fmt.Errorf("L2TP AVP header truncated")
+		}
+		length := int(binary.BigEndian.Uint16(rest[0:2]) & 0x3ff)
+		if length < 6 || length > len(rest) {
+			return fmt.Errorf("L2TP AVP length %d invalid", length)
+		}
+		l.AVPs = append(l.AVPs, L2TPAVP{
+			Mandatory: rest[0]&0x80 != 0,
+			Hidden:    rest[0]&0x40 != 0,
+			VendorID:  binary.BigEndian.Uint16(rest[2:4]),
+			Type:      L2TPAVPType(binary.BigEndian.Uint16(rest[4:6])),
+			Value:     rest[6:length],
+		})
+		rest = rest[length:]
+	}
+	l.BaseLayer = BaseLayer{Contents: data, Payload: nil}
+	return nil
+}
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (l *L2TP) NextLayerType() gopacket.LayerType {
+	if l.Control {
+		return gopacket.LayerTypeZero
+	}
+	if l.Version == 2 {
+		return LayerTypePPP
+	}
+	return L2TPv3Data.Payload
+}
+
+func decodeL2TP(data []byte, p gopacket.PacketBuilder) error {
+	l := &L2TP{}
+	return decodingLayerDecoder(l, data, p)
+}
+
+// L2TPv3IP is an L2TPv3 header carried directly over IP, protocol 115.
+// Control messages are marked by a zero session ID in place of the UDP
+// header's flags.
+type L2TPv3IP struct {
+	L2TP
+}
+
+// LayerType returns LayerTypeL2TPv3IP.
+func (l *L2TPv3IP) LayerType() gopacket.LayerType { return LayerTypeL2TPv3IP }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (l *L2TPv3IP) CanDecode() gopacket.LayerClass { return LayerTypeL2TPv3IP }
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (l *L2TPv3IP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	l.reset()
+	l.Version = 3
+	if len(data) < 4 {
+		df.SetTruncated()
+		return fmt.Errorf("L2TPv3 header too short: %d bytes", len(data))
+	}
+	if binary.BigEndian.Uint32(data[0:4]) != 0 {
+		return l.decodeV3Session(data, 0, df)
+	}
+	if len(data) < 6 {
+		df.SetTruncated()
+		return fmt.Errorf("L2TPv3 control header too short: %d bytes", len(data))
+	}
+	l.Control = data[4]&0x80 != 0
+	l.LengthPresent = data[4]&0x40 != 0
+	l.SequencePresent = data[4]&0x08 != 0
+	if v := data[5] & 0x0f; !l.Control || v != 3 {
+		return fmt.Errorf("invalid L2TPv3 control header, version %d", v)
+	}
+	if err := l.decodeV3Control(data[4:], df); err != nil {
+		return err
+	}
+	// Include the zero session ID in the contents.
+	l.Contents = data[:4+len(l.Contents)]
+	return nil
+}
+
+func decodeL2TPv3IP(data []byte, p gopacket.PacketBuilder) error {
+	l := &L2TPv3IP{}
+	return decodingLayerDecoder(l, data, p)
+}
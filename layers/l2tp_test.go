@@ -0,0 +1,162 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func testL2TPInnerIPv4(t *testing.T) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &UDP{SrcPort: 1000, DstPort: 2000}
+	udp.SetNetworkLayerForChecksum(ip)
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ip, udp, gopacket.Payload("hi")); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testL2TPOverUDP(t *testing.T, l2tp []byte) gopacket.Packet {
+	buf := gopacket.NewSerializeBuffer()
+	udp := &UDP{SrcPort: 1701, DstPort: 1701}
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, udp, gopacket.Payload(l2tp)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeUDP, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	return p
+}
+
+func TestL2TPv2Data(t *testing.T) {
+	inner := testL2TPInnerIPv4(t)
+	data := []byte{
+		0x48, 0x02, 0x00, 0x00, // L, S, v2, length filled in below
+		0x00, 0x01, 0x00, 0x02, // tunnel 1, session 2
+		0x00, 0x03, 0x00, 0x04, // Ns 3, Nr 4
+		0xff, 0x03, 0x00, 0x21, // PPP address, control, IPv4
+	}
+	data = append(data, inner...)
+	data[3] = byte(len(data))
+	p := testL2TPOverUDP(t, data)
+	checkLayers(p, []gopacket.LayerType{LayerTypeUDP, LayerTypeL2TP, LayerTypePPP, LayerTypeIPv4, LayerTypeUDP, gopacket.LayerTypePayload}, t)
+	l := p.Layer(LayerTypeL2TP).(*L2TP)
+	if l.Version != 2 || l.Control || l.TunnelID != 1 || l.SessionID != 2 || l.Ns != 3 || l.Nr != 4 || int(l.Length) != len(data) {
+		t.Errorf("bad L2TP header %+v", l)
+	}
+	if ppp := p.Layer(LayerTypePPP).(*PPP); ppp.PPPType != PPPTypeIPv4 || len(ppp.Contents) != 4 {
+		t.Errorf("bad PPP header %+v", ppp)
+	}
+}
+
+func TestL2TPv2Control(t *testing.T) {
+	data := []byte{
+		0xc8, 0x02, 0x00, 0x1e, // T, L, S, v2, length 30
+		0x00, 0x00, 0x00, 0x00, // tunnel 0, session 0
+		0x00, 0x00, 0x00, 0x00, // Ns 0, Nr 0
+		0x80, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, // message type SCCRQ
+		0x80, 0x0a, 0x00, 0x00, 0x00, 0x07, 'l', 'a', 'c', '1', // host name
+	}
+	p := testL2TPOverUDP(t, data)
+	checkLayers(p, []gopacket.LayerType{LayerTypeUDP, LayerTypeL2TP}, t)
+	l := p.Layer(LayerTypeL2TP).(*L2TP)
+	if mt, ok := l.MessageType(); !ok || mt != L2TPMessageTypeSCCRQ {
+		t.Errorf("message type %v %v", mt, ok)
+	}
+	if len(l.AVPs) != 2 {
+		t.Fatalf("got %d AVPs, want 2", len(l.AVPs))
+	}
+	if a := l.AVP(L2TPAVPTypeHostName); a == nil || !a.Mandatory || string(a.Value) != "lac1" {
+		t.Errorf("host name AVP %+v", a)
+	}
+}
+
+func TestL2TPv3OverIP(t *testing.T) {
+	eth := &Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 6},
+		EthernetType: EthernetTypeIPv4,
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{}, eth, gopacket.Payload(testL2TPInnerIPv4(t))); err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte{0x00, 0x00, 0x12, 0x34}, buf.Bytes()...)
+	p := gopacket.NewPacket(data, LayerTypeL2TPv3IP, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeL2TPv3IP, LayerTypeEthernet, LayerTypeIPv4, LayerTypeUDP, gopacket.LayerTypePayload}, t)
+	if l := p.Layer(LayerTypeL2TPv3IP).(*L2TPv3IP); l.SessionID != 0x1234 || l.Control {
+		t.Errorf("bad L2TPv3 header %+v", l)
+	}
+
+	// With a cookie, sessions carrying PPP.
+	defer func(c L2TPv3DataConfig) { L2TPv3Data = c }(L2TPv3Data)
+	L2TPv3Data = L2TPv3DataConfig{CookieLength: 4, Payload: LayerTypePPP}
+	data = append([]byte{0x00, 0x00, 0x12, 0x34, 0xde, 0xad, 0xbe, 0xef, 0xff, 0x03, 0x00, 0x21}, testL2TPInnerIPv4(t)...)
+	p = gopacket.NewPacket(data, LayerTypeL2TPv3IP, gopacket.Default)
+	checkLayers(p, []gopacket.LayerType{LayerTypeL2TPv3IP, LayerTypePPP, LayerTypeIPv4, LayerTypeUDP, gopacket.LayerTypePayload}, t)
+	if l := p.Layer(LayerTypeL2TPv3IP).(*L2TPv3IP); !bytes.Equal(l.Cookie, []byte{0xde, 0xad, 0xbe, 0xef}) {
+		t.Errorf("bad cookie %x", l.Cookie)
+	}
+}
+
+func TestL2TPv3Control(t *testing.T) {
+	ctrl := []byte{
+		0xc8, 0x03, 0x00, 0x14, // T, L, S, v3, length 20
+		0x00, 0x00, 0x00, 0x07, // control connection 7
+		0x00, 0x01, 0x00, 0x02, // Ns 1, Nr 2
+		0x80, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x06, // message type Hello
+	}
+	for _, test := range []struct {
+		name string
+		p    gopacket.Packet
+		typ  gopacket.LayerType
+	}{
+		{"IP", gopacket.NewPacket(append([]byte{0, 0, 0, 0}, ctrl...), LayerTypeL2TPv3IP, gopacket.Default), LayerTypeL2TPv3IP},
+		{"UDP", testL2TPOverUDP(t, ctrl), LayerTypeL2TP},
+	} {
+		if test.p.ErrorLayer() != nil {
+			t.Fatalf("%s: failed to decode packet: %v", test.name, test.p.ErrorLayer().Error())
+		}
+		var l *L2TP
+		switch v := test.p.Layer(test.typ).(type) {
+		case *L2TP:
+			l = v
+		case *L2TPv3IP:
+			l = &v.L2TP
+		default:
+			t.Fatalf("%s: no L2TP layer", test.name)
+		}
+		if mt, ok := l.MessageType(); !ok || mt != L2TPMessageTypeHello || l.TunnelID != 7 || l.Ns != 1 || l.Nr != 2 {
+			t.Errorf("%s: bad control message %+v", test.name, l)
+		}
+	}
+}
+
+func TestL2TPMalformed(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x02},
+		{0x48, 0x02, 0x00, 0x40, 0, 1, 0, 2, 0, 0, 0, 0},                   // length overruns
+		{0xc8, 0x02, 0x00, 0x10, 0, 0, 0, 0, 0, 0, 0, 0, 0x80, 0x08, 0, 0}, // AVP overruns
+		{0x80, 0x02, 0, 0, 0, 0},                                           // control without length
+		{0x02, 0x04, 0, 0, 0, 0},                                           // version 4
+		{0x02, 0x02, 0, 1, 0, 2, 0x00, 0x10, 0x00},                         // offset overruns
+	} {
+		var l L2TP
+		if err := l.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("expected error decoding %x", data)
+		}
+	}
+}
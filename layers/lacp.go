@@ -0,0 +1,217 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mistsys/gopacket"
+)
+
+// SlowProtocolSubtype is the first byte of an IEEE 802.3 slow protocol
+// frame, which says which protocol it carries.
+type SlowProtocolSubtype uint8
+
+const (
+	SlowProtocolSubtypeLACP   SlowProtocolSubtype = 1
+	SlowProtocolSubtypeMarker SlowProtocolSubtype = 2
+	SlowProtocolSubtypeOAM    SlowProtocolSubtype = 3
+)
+
+// LACPDUs are a fixed 110 bytes long, after the Ethernet header.
+const (
+	lacpLength          = 110
+	lacpPortInfoLength  = 20
+	lacpCollectorLength = 16
+)
+
+const (
+	lacpTLVTerminator = 0
+	lacpTLVActor      = 1
+	lacpTLVPartner    = 2
+	lacpTLVCollector  = 3
+)
+
+// LACPState is the state of an aggregation port, as the actor or partner
+// of an LACPDU sees it.
+type LACPState uint8
+
+const (
+	// LACPStateActivity is set for active LACP, and clear for passive.
+	LACPStateActivity LACPState = 1 << iota
+	// LACPStateTimeout is set for the short timeout, of 3 seconds, and
+	// clear for the long one, of 90 seconds.
+	LACPStateTimeout
+	LACPStateAggregation
+	LACPStateSynchronization
+	LACPStateCollecting
+	LACPStateDistributing
+	LACPStateDefaulted
+	LACPStateExpired
+)
+
+var lacpStateNames = [...]string{
+	"Activity", "Timeout", "Aggregation", "Synchronization",
+	"Collecting", "Distributing", "Defaulted", "Expired",
+}
+
+func (s LACPState) String() string {
+	var names []string
+	for i, name := range lacpStateNames {
+		if s&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// LACPPortInfo is the actor or partner information of an LACPDU.  System
+// and Key identify the aggregation the port belongs to; both ends of a
+// working link agree on them.
+type LACPPortInfo struct {
+	SystemPriority uint16
+	System         net.HardwareAddr
+	Key            uint16
+	PortPriority   uint16
+	Port           uint16
+	State          LACPState
+}
+
+func (i *LACPPortInfo) decode(b []byte) {
+	i.SystemPriority = binary.BigEndian.Uint16(b[0:2])
+	i.System = net.HardwareAddr(b[2:8])
+	i.Key = binary.BigEndian.Uint16(b[8:10])
+	i.PortPriority = binary.BigEndian.Uint16(b[10:12])
+	i.Port = binary.BigEndian.Uint16(b[12:14])
+	i.State = LACPState(b[14])
+}
+
+func (i *LACPPortInfo) encode(b []byte) error {
+	if i.System != nil && len(i.System) != 6 {
+		return fmt.Errorf("invalid LACP system %v", i.System)
+	}
+	binary.BigEndian.PutUint16(b[0:2], i.SystemPriority)
+	copy(b[2:8], i.System)
+	binary.BigEndian.PutUint16(b[8:10], i.Key)
+	binary.BigEndian.PutUint16(b[10:12], i.PortPriority)
+	binary.BigEndian.PutUint16(b[12:14], i.Port)
+	b[14] = uint8(i.State)
+	return nil
+}
+
+// LACP is an IEEE 802.3ad (802.1AX) Link Aggregation Control Protocol
+// data unit, sent as a slow protocol with EtherType 0x8809.
+type LACP struct {
+	BaseLayer
+	Version        uint8
+	Actor, Partner LACPPortInfo
+	// CollectorMaxDelay is the longest the actor's collector may delay
+	// frames, in tens of microseconds.
+	CollectorMaxDelay uint16
+}
+
+// LayerType returns LayerTypeLACP.
+func (l *LACP) LayerType() gopacket.LayerType { return LayerTypeLACP }
+
+func (l *LACP) CanDecode() gopacket.LayerClass { return LayerTypeLACP }
+
+func (l *LACP) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// DecodeFromBytes decodes the given bytes into this layer.  The TLVs are
+// found by type, so version 2 LACPDUs, which may carry more of them, are
+// decoded too.
+func (l *LACP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 2 {
+		df.SetTruncated()
+		return fmt.Errorf("LACP length %d too short", len(data))
+	}
+	if SlowProtocolSubtype(data[0]) != SlowProtocolSubtypeLACP {
+		return fmt.Errorf("slow protocol subtype %d is not LACP", data[0])
+	}
+	*l = LACP{BaseLayer: BaseLayer{Contents: data}, Version: data[1]}
+	var actor, partner bool
+	for b := data[2:]; ; {
+		if len(b) < 2 {
+			df.SetTruncated()
+			return fmt.Errorf("LACP TLVs truncated, %d bytes left", len(b))
+		}
+		typ, length := b[0], int(b[1])
+		if typ == lacpTLVTerminator {
+			break
+		}
+		// Lengths count the type and length bytes.
+		if length < 2 || length > len(b) {
+			df.SetTruncated()
+			return fmt.Errorf("LACP TLV %d length %d invalid, %d bytes left", typ, length, len(b))
+		}
+		switch typ {
+		case lacpTLVActor, lacpTLVPartner:
+			if length != lacpPortInfoLength {
+				return fmt.Errorf("LACP TLV %d length %d invalid", typ, length)
+			}
+			if typ == lacpTLVActor {
+				l.Actor.decode(b[2:])
+				actor = true
+			} else {
+				l.Partner.decode(b[2:])
+				partner = true
+			}
+		case lacpTLVCollector:
+			if length != lacpCollectorLength {
+				return fmt.Errorf("LACP collector TLV length %d invalid", length)
+			}
+			l.CollectorMaxDelay = binary.BigEndian.Uint16(b[2:4])
+		}
+		b = b[length:]
+	}
+	if !actor || !partner {
+		return fmt.Errorf("LACPDU missing actor or partner information")
+	}
+	return nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+// See the docs for gopacket.SerializableLayer for more info.
+func (l *LACP) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	bytes, err := b.PrependBytes(lacpLength)
+	if err != nil {
+		return err
+	}
+	for i := range bytes {
+		bytes[i] = 0
+	}
+	bytes[0] = uint8(SlowProtocolSubtypeLACP)
+	bytes[1] = l.Version
+	t := bytes[2:]
+	t[0], t[1] = lacpTLVActor, lacpPortInfoLength
+	if err := l.Actor.encode(t[2:]); err != nil {
+		return err
+	}
+	t = t[lacpPortInfoLength:]
+	t[0], t[1] = lacpTLVPartner, lacpPortInfoLength
+	if err := l.Partner.encode(t[2:]); err != nil {
+		return err
+	}
+	t = t[lacpPortInfoLength:]
+	t[0], t[1] = lacpTLVCollector, lacpCollectorLength
+	binary.BigEndian.PutUint16(t[2:4], l.CollectorMaxDelay)
+	// The terminator and reserved bytes are left zero.
+	return nil
+}
+
+// decodeSlowProtocol decodes LACPDUs, and leaves the other slow protocols
+// as payload.
+func decodeSlowProtocol(data []byte, p gopacket.PacketBuilder) error {
+	if len(data) > 0 && SlowProtocolSubtype(data[0]) == SlowProtocolSubtypeLACP {
+		return decodingLayerDecoder(&LACP{}, data, p)
+	}
+	return p.NextDecoder(gopacket.LayerTypePayload)
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testPacketLACP is an LACPDU from an active actor with a short timeout,
+// collecting and distributing on a link with its partner.
+var testPacketLACP = []byte{
+	0x01, 0x80, 0xc2, 0x00, 0x00, 0x02, 0x00, 0x1b, 0x54, 0x00, 0x00, 0x05, 0x88, 0x09,
+	0x01, 0x01,
+	0x01, 0x14, 0x80, 0x00, 0x00, 0x1b, 0x54, 0x00, 0x00, 0x01, 0x00, 0x0a, 0x80, 0x00, 0x00, 0x05, 0x3f, 0x00, 0x00, 0x00,
+	0x02, 0x14, 0x80, 0x00, 0x00, 0x1c, 0x73, 0x00, 0x00, 0x02, 0x00, 0x14, 0x80, 0x00, 0x00, 0x07, 0x3d, 0x00, 0x00, 0x00,
+	0x03, 0x10, 0x00, 0x32, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0x00, 0x00,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+}
+
+func TestPacketLACP(t *testing.T) {
+	p := gopacket.NewPacket(testPacketLACP, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeLACP}, t)
+	lacp := p.Layer(LayerTypeLACP).(*LACP)
+	want := LACPPortInfo{
+		SystemPriority: 0x8000,
+		System:         net.HardwareAddr{0x00, 0x1b, 0x54, 0x00, 0x00, 0x01},
+		Key:            10,
+		PortPriority:   0x8000,
+		Port:           5,
+		State:          LACPStateActivity | LACPStateTimeout | LACPStateAggregation | LACPStateSynchronization | LACPStateCollecting | LACPStateDistributing,
+	}
+	if lacp.Version != 1 || !reflect.DeepEqual(lacp.Actor, want) || lacp.CollectorMaxDelay != 50 {
+		t.Errorf("got %+v", lacp)
+	}
+	if lacp.Partner.Key != 20 || lacp.Partner.Port != 7 || lacp.Partner.State&LACPStateTimeout != 0 {
+		t.Errorf("got partner %+v", lacp.Partner)
+	}
+	if s := lacp.Partner.State.String(); s != "Activity|Aggregation|Synchronization|Collecting|Distributing" {
+		t.Errorf("got partner state %s", s)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	if err := lacp.SerializeTo(buf, gopacket.SerializeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), testPacketLACP[14:]) {
+		t.Errorf("serialized\n%x\nwant\n%x", buf.Bytes(), testPacketLACP[14:])
+	}
+}
+
+func TestPacketSlowProtocolMarker(t *testing.T) {
+	data := append(append([]byte{}, testPacketLACP[:14]...), 0x02, 0x01, 0x01, 0x10)
+	data = append(data, make([]byte, 106)...)
+	p := gopacket.NewPacket(data, LinkTypeEthernet, gopacket.Default)
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, gopacket.LayerTypePayload}, t)
+}
@@ -124,6 +124,64 @@ var (
 	LayerTypeEAPOLKey                    = gopacket.RegisterLayerType(120, gopacket.LayerTypeMetadata{"EAPOLKey", gopacket.DecodeFunc(decodeEAPOLKey)})
 	LayerTypeOmniPeek                    = gopacket.RegisterLayerType(121, gopacket.LayerTypeMetadata{"OmniPeek", gopacket.DecodeFunc(decodeOmniPeek)})
 	LayerTypeCiscoAP                     = gopacket.RegisterLayerType(122, gopacket.LayerTypeMetadata{"CiscoAP", gopacket.DecodeFunc(decodeCiscoAP)})
+	LayerTypeSDP                         = gopacket.RegisterLayerType(123, gopacket.LayerTypeMetadata{"SDP", gopacket.DecodeFunc(decodeSDP)})
+	LayerTypeERSPAN                      = gopacket.RegisterLayerType(124, gopacket.LayerTypeMetadata{"ERSPAN", gopacket.DecodeFunc(decodeERSPAN)})
+	LayerTypeGTPv1U                      = gopacket.RegisterLayerType(125, gopacket.LayerTypeMetadata{"GTPv1U", gopacket.DecodeFunc(decodeGTPv1u)})
+	LayerTypeGTPv2C                      = gopacket.RegisterLayerType(126, gopacket.LayerTypeMetadata{"GTPv2C", gopacket.DecodeFunc(decodeGTPv2c)})
+	LayerTypeL2TP                        = gopacket.RegisterLayerType(127, gopacket.LayerTypeMetadata{"L2TP", gopacket.DecodeFunc(decodeL2TP)})
+	LayerTypeL2TPv3IP                    = gopacket.RegisterLayerType(128, gopacket.LayerTypeMetadata{"L2TPv3IP", gopacket.DecodeFunc(decodeL2TPv3IP)})
+	LayerTypeIPv6Tunnel                  = gopacket.RegisterLayerType(129, gopacket.LayerTypeMetadata{"IPv6Tunnel", gopacket.DecodeFunc(decodeIPv6Tunnel)})
+	LayerTypeLinuxSLL2                   = gopacket.RegisterLayerType(130, gopacket.LayerTypeMetadata{"Linux SLL2", gopacket.DecodeFunc(decodeLinuxSLL2)})
+	LayerTypePWControlWord               = gopacket.RegisterLayerType(131, gopacket.LayerTypeMetadata{"PWControlWord", gopacket.DecodeFunc(decodePWControlWord)})
+	LayerTypeICMPv6RouterSolicitation    = gopacket.RegisterLayerType(132, gopacket.LayerTypeMetadata{"ICMPv6RouterSolicitation", gopacket.DecodeFunc(decodeICMPv6RouterSolicitation)})
+	LayerTypeICMPv6RouterAdvertisement   = gopacket.RegisterLayerType(133, gopacket.LayerTypeMetadata{"ICMPv6RouterAdvertisement", gopacket.DecodeFunc(decodeICMPv6RouterAdvertisement)})
+	LayerTypeICMPv6NeighborSolicitation  = gopacket.RegisterLayerType(134, gopacket.LayerTypeMetadata{"ICMPv6NeighborSolicitation", gopacket.DecodeFunc(decodeICMPv6NeighborSolicitation)})
+	LayerTypeICMPv6NeighborAdvertisement = gopacket.RegisterLayerType(135, gopacket.LayerTypeMetadata{"ICMPv6NeighborAdvertisement", gopacket.DecodeFunc(decodeICMPv6NeighborAdvertisement)})
+	LayerTypeICMPv6Redirect              = gopacket.RegisterLayerType(136, gopacket.LayerTypeMetadata{"ICMPv6Redirect", gopacket.DecodeFunc(decodeICMPv6Redirect)})
+	LayerTypeICMPv6Echo                  = gopacket.RegisterLayerType(137, gopacket.LayerTypeMetadata{"ICMPv6Echo", gopacket.DecodeFunc(decodeICMPv6Echo)})
+	LayerTypeMLDv1                       = gopacket.RegisterLayerType(138, gopacket.LayerTypeMetadata{"MLDv1", gopacket.DecodeFunc(decodeMLDv1)})
+	LayerTypeMLDv2Query                  = gopacket.RegisterLayerType(139, gopacket.LayerTypeMetadata{"MLDv2Query", gopacket.DecodeFunc(decodeMLDv2Query)})
+	LayerTypeMLDv2Report                 = gopacket.RegisterLayerType(140, gopacket.LayerTypeMetadata{"MLDv2Report", gopacket.DecodeFunc(decodeMLDv2Report)})
+	LayerTypeOSPF                        = gopacket.RegisterLayerType(141, gopacket.LayerTypeMetadata{"OSPF", gopacket.DecodeFunc(decodeOSPF)})
+	LayerTypeBGP                         = gopacket.RegisterLayerType(142, gopacket.LayerTypeMetadata{"BGP", gopacket.DecodeFunc(decodeBGP)})
+	LayerTypeISIS                        = gopacket.RegisterLayerType(143, gopacket.LayerTypeMetadata{"ISIS", gopacket.DecodeFunc(decodeISIS)})
+	LayerTypeLLCXID                      = gopacket.RegisterLayerType(144, gopacket.LayerTypeMetadata{"LLCXID", gopacket.DecodeFunc(decodeLLCXID)})
+	LayerTypeRIP                         = gopacket.RegisterLayerType(145, gopacket.LayerTypeMetadata{"RIP", gopacket.DecodeFunc(decodeRIP)})
+	LayerTypeEIGRP                       = gopacket.RegisterLayerType(146, gopacket.LayerTypeMetadata{"EIGRP", gopacket.DecodeFunc(decodeEIGRP)})
+	LayerTypeHSRP                        = gopacket.RegisterLayerType(147, gopacket.LayerTypeMetadata{"HSRP", gopacket.DecodeFunc(decodeHSRP)})
+	LayerTypeLACP                        = gopacket.RegisterLayerType(148, gopacket.LayerTypeMetadata{"LACP", gopacket.DecodeFunc(decodeSlowProtocol)})
+	LayerTypeSTP                         = gopacket.RegisterLayerType(149, gopacket.LayerTypeMetadata{"STP", gopacket.DecodeFunc(decodeSTP)})
+	LayerTypeMACsec                      = gopacket.RegisterLayerType(150, gopacket.LayerTypeMetadata{"MACsec", gopacket.DecodeFunc(decodeMACsec)})
+	LayerTypeRTag                        = gopacket.RegisterLayerType(151, gopacket.LayerTypeMetadata{"RTag", gopacket.DecodeFunc(decodeRTag)})
+	LayerTypeMKA                         = gopacket.RegisterLayerType(152, gopacket.LayerTypeMetadata{"MKA", gopacket.DecodeFunc(decodeMKA)})
+	LayerTypeIKE                         = gopacket.RegisterLayerType(153, gopacket.LayerTypeMetadata{"IKE", gopacket.DecodeFunc(decodeIKE)})
+	LayerTypeIPSecUDPEncap               = gopacket.RegisterLayerType(154, gopacket.LayerTypeMetadata{"IPSecUDPEncap", gopacket.DecodeFunc(decodeIPSecUDPEncap)})
+	LayerTypeWireGuard                   = gopacket.RegisterLayerType(155, gopacket.LayerTypeMetadata{"WireGuard", gopacket.DecodeFunc(decodeWireGuard)})
+	LayerTypeDTLS                        = gopacket.RegisterLayerType(156, gopacket.LayerTypeMetadata{"DTLS", gopacket.DecodeFunc(decodeDTLS)})
+	LayerTypeQUIC                        = gopacket.RegisterLayerType(157, gopacket.LayerTypeMetadata{"QUIC", gopacket.DecodeFunc(decodeQUIC)})
+	LayerTypeHTTP2                       = gopacket.RegisterLayerType(158, gopacket.LayerTypeMetadata{"HTTP2", gopacket.DecodeFunc(decodeHTTP2)})
+	LayerTypeWebSocket                   = gopacket.RegisterLayerType(159, gopacket.LayerTypeMetadata{"WebSocket", gopacket.DecodeFunc(decodeWebSocket)})
+	LayerTypeMDNS                        = gopacket.RegisterLayerType(160, gopacket.LayerTypeMetadata{"MDNS", gopacket.DecodeFunc(decodeMDNS)})
+	LayerTypeLLMNR                       = gopacket.RegisterLayerType(161, gopacket.LayerTypeMetadata{"LLMNR", gopacket.DecodeFunc(decodeLLMNR)})
+	LayerTypeDHCPv6                      = gopacket.RegisterLayerType(162, gopacket.LayerTypeMetadata{"DHCPv6", gopacket.DecodeFunc(decodeDHCPv6)})
+	LayerTypeNTPControl                  = gopacket.RegisterLayerType(163, gopacket.LayerTypeMetadata{"NTPControl", gopacket.DecodeFunc(decodeNTPControl)})
+	LayerTypeNTPPrivate                  = gopacket.RegisterLayerType(164, gopacket.LayerTypeMetadata{"NTPPrivate", gopacket.DecodeFunc(decodeNTPPrivate)})
+	LayerTypePTP                         = gopacket.RegisterLayerType(165, gopacket.LayerTypeMetadata{"PTP", gopacket.DecodeFunc(decodePTP)})
+	LayerTypeSyslog                      = gopacket.RegisterLayerType(166, gopacket.LayerTypeMetadata{"Syslog", gopacket.DecodeFunc(decodeSyslog)})
+	LayerTypeRADIUS                      = gopacket.RegisterLayerType(167, gopacket.LayerTypeMetadata{"RADIUS", gopacket.DecodeFunc(decodeRADIUS)})
+	LayerTypeKerberos                    = gopacket.RegisterLayerType(168, gopacket.LayerTypeMetadata{"Kerberos", gopacket.DecodeFunc(decodeKerberos)})
+	LayerTypeTACACSPlus                  = gopacket.RegisterLayerType(169, gopacket.LayerTypeMetadata{"TACACSPlus", gopacket.DecodeFunc(decodeTACACSPlus)})
+	LayerTypeSIP                         = gopacket.RegisterLayerType(170, gopacket.LayerTypeMetadata{"SIP", gopacket.DecodeFunc(decodeSIP)})
+	LayerTypeRTP                         = gopacket.RegisterLayerType(171, gopacket.LayerTypeMetadata{"RTP", gopacket.DecodeFunc(decodeRTP)})
+	LayerTypeRTCP                        = gopacket.RegisterLayerType(172, gopacket.LayerTypeMetadata{"RTCP", gopacket.DecodeFunc(decodeRTCP)})
+	LayerTypeRTSP                        = gopacket.RegisterLayerType(173, gopacket.LayerTypeMetadata{"RTSP", gopacket.DecodeFunc(decodeRTSP)})
+	LayerTypeRTSPInterleaved             = gopacket.RegisterLayerType(174, gopacket.LayerTypeMetadata{"RTSPInterleaved", gopacket.DecodeFunc(decodeRTSP)})
+	LayerTypeSTUN                        = gopacket.RegisterLayerType(175, gopacket.LayerTypeMetadata{"STUN", gopacket.DecodeFunc(decodeSTUN)})
+	LayerTypeTURNChannelData             = gopacket.RegisterLayerType(176, gopacket.LayerTypeMetadata{"TURNChannelData", gopacket.DecodeFunc(decodeSTUN)})
+	LayerTypeCoAP                        = gopacket.RegisterLayerType(177, gopacket.LayerTypeMetadata{"CoAP", gopacket.DecodeFunc(decodeCoAP)})
+	LayerTypeAMQP091                     = gopacket.RegisterLayerType(178, gopacket.LayerTypeMetadata{"AMQP091", gopacket.DecodeFunc(decodeAMQP)})
+	LayerTypeAMQP10                      = gopacket.RegisterLayerType(179, gopacket.LayerTypeMetadata{"AMQP10", gopacket.DecodeFunc(decodeAMQP)})
+	LayerTypeSSDP                        = gopacket.RegisterLayerType(180, gopacket.LayerTypeMetadata{"SSDP", gopacket.DecodeFunc(decodeSSDP)})
 )
 
 var (
@@ -48,6 +48,40 @@ func (l LinuxSLLPacketType) String() string {
 	return fmt.Sprintf("Unknown(%d)", int(l))
 }
 
+// Direction returns whether packets of this type were sent or received by
+// the capturing host.
+func (l LinuxSLLPacketType) Direction() gopacket.CaptureDirection {
+	switch l {
+	case LinuxSLLPacketTypeHost, LinuxSLLPacketTypeBroadcast, LinuxSLLPacketTypeMulticast, LinuxSLLPacketTypeOtherhost:
+		return gopacket.DirectionInbound
+	case LinuxSLLPacketTypeOutgoing:
+		return gopacket.DirectionOutbound
+	}
+	return gopacket.DirectionUnknown
+}
+
+// metadataBuilder is implemented by PacketBuilders that give decoders access
+// to the packet's metadata, as gopacket's packets do.
+type metadataBuilder interface {
+	Metadata() *gopacket.PacketMetadata
+}
+
+// setCaptureInfo records the direction and interface index found in a link
+// layer header in the packet's metadata, unless they're already set.
+func setCaptureInfo(p gopacket.PacketBuilder, dir gopacket.CaptureDirection, ifindex int) {
+	mb, ok := p.(metadataBuilder)
+	if !ok {
+		return
+	}
+	m := mb.Metadata()
+	if m.Direction == gopacket.DirectionUnknown {
+		m.Direction = dir
+	}
+	if m.InterfaceIndex == 0 {
+		m.InterfaceIndex = ifindex
+	}
+}
+
 type LinuxSLL struct {
 	BaseLayer
 	PacketType   LinuxSLLPacketType
@@ -92,5 +126,64 @@ func decodeLinuxSLL(data []byte, p gopacket.PacketBuilder) error {
 	}
 	p.AddLayer(sll)
 	p.SetLinkLayer(sll)
+	setCaptureInfo(p, sll.PacketType.Direction(), 0)
+	return p.NextDecoder(sll.EthernetType)
+}
+
+// LinuxSLL2 is the second version of the Linux cooked capture header, which
+// adds the interface index.
+type LinuxSLL2 struct {
+	BaseLayer
+	EthernetType   EthernetType
+	InterfaceIndex uint32
+	// ARPHRDType is the ARPHRD_ type of the interface, such as 1 for
+	// Ethernet.
+	ARPHRDType uint16
+	PacketType LinuxSLLPacketType
+	AddrLen    uint8
+	Addr       net.HardwareAddr
+}
+
+// LayerType returns LayerTypeLinuxSLL2.
+func (sll *LinuxSLL2) LayerType() gopacket.LayerType { return LayerTypeLinuxSLL2 }
+
+func (sll *LinuxSLL2) CanDecode() gopacket.LayerClass {
+	return LayerTypeLinuxSLL2
+}
+
+func (sll *LinuxSLL2) LinkFlow() gopacket.Flow {
+	return gopacket.NewFlow(EndpointMAC, sll.Addr, nil)
+}
+
+func (sll *LinuxSLL2) NextLayerType() gopacket.LayerType {
+	return sll.EthernetType.LayerType()
+}
+
+func (sll *LinuxSLL2) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 20 {
+		return errors.New("Linux SLL2 packet too small")
+	}
+	sll.EthernetType = EthernetType(binary.BigEndian.Uint16(data[0:2]))
+	sll.InterfaceIndex = binary.BigEndian.Uint32(data[4:8])
+	sll.ARPHRDType = binary.BigEndian.Uint16(data[8:10])
+	sll.PacketType = LinuxSLLPacketType(data[10])
+	sll.AddrLen = data[11]
+	addrLen := int(sll.AddrLen)
+	if addrLen > 8 {
+		addrLen = 8
+	}
+	sll.Addr = net.HardwareAddr(data[12 : 12+addrLen])
+	sll.BaseLayer = BaseLayer{data[:20], data[20:]}
+	return nil
+}
+
+func decodeLinuxSLL2(data []byte, p gopacket.PacketBuilder) error {
+	sll := &LinuxSLL2{}
+	if err := sll.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(sll)
+	p.SetLinkLayer(sll)
+	setCaptureInfo(p, sll.PacketType.Direction(), int(sll.InterfaceIndex))
 	return p.NextDecoder(sll.EthernetType)
 }
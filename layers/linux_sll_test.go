@@ -0,0 +1,79 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func testSLLIPv4(t *testing.T) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &UDP{SrcPort: 1000, DstPort: 2000}
+	udp.SetNetworkLayerForChecksum(ip)
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ip, udp); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLinuxSLLDirection(t *testing.T) {
+	for _, test := range []struct {
+		pktType LinuxSLLPacketType
+		want    gopacket.CaptureDirection
+	}{
+		{LinuxSLLPacketTypeHost, gopacket.DirectionInbound},
+		{LinuxSLLPacketTypeOtherhost, gopacket.DirectionInbound},
+		{LinuxSLLPacketTypeOutgoing, gopacket.DirectionOutbound},
+		{LinuxSLLPacketTypeLoopback, gopacket.DirectionUnknown},
+	} {
+		data := append([]byte{
+			0, byte(test.pktType), 0x00, 0x01, 0x00, 0x06,
+			0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x00, 0x00,
+			0x08, 0x00,
+		}, testSLLIPv4(t)...)
+		p := gopacket.NewPacket(data, LinkTypeLinuxSLL, gopacket.Default)
+		if p.ErrorLayer() != nil {
+			t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+		}
+		checkLayers(p, []gopacket.LayerType{LayerTypeLinuxSLL, LayerTypeIPv4, LayerTypeUDP}, t)
+		if got := p.Metadata().Direction; got != test.want {
+			t.Errorf("packet type %v: got direction %v, want %v", test.pktType, got, test.want)
+		}
+	}
+}
+
+func TestLinuxSLL2(t *testing.T) {
+	data := append([]byte{
+		0x08, 0x00, 0x00, 0x00, // IPv4, reserved
+		0x00, 0x00, 0x00, 0x07, // interface 7
+		0x00, 0x01, 0x04, 0x06, // ARPHRD_ETHER, outgoing, address length 6
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x00, 0x00,
+	}, testSLLIPv4(t)...)
+	p := gopacket.NewPacket(data, LinkTypeLinuxSLL2, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeLinuxSLL2, LayerTypeIPv4, LayerTypeUDP}, t)
+	sll := p.Layer(LayerTypeLinuxSLL2).(*LinuxSLL2)
+	if sll.InterfaceIndex != 7 || sll.ARPHRDType != 1 || sll.PacketType != LinuxSLLPacketTypeOutgoing ||
+		!bytes.Equal(sll.Addr, []byte{0, 1, 2, 3, 4, 5}) || sll.EthernetType != EthernetTypeIPv4 {
+		t.Errorf("bad SLL2 header %+v", sll)
+	}
+	if m := p.Metadata(); m.Direction != gopacket.DirectionOutbound || m.InterfaceIndex != 7 {
+		t.Errorf("got direction %v interface %d, want outbound on 7", m.Direction, m.InterfaceIndex)
+	}
+
+	var s LinuxSLL2
+	if err := s.DecodeFromBytes(data[:19], gopacket.NilDecodeFeedback); err == nil {
+		t.Error("expected error decoding truncated SLL2 header")
+	}
+}
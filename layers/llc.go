@@ -27,6 +27,64 @@ type LLC struct {
 // LayerType returns gopacket.LayerTypeLLC.
 func (l *LLC) LayerType() gopacket.LayerType { return LayerTypeLLC }
 
+// LLC unnumbered frame control values, without the poll/final bit.
+const (
+	LLCControlUI   = 0x03
+	LLCControlXID  = 0xAF
+	LLCControlTEST = 0xE3
+	// LLCControlPF is the poll/final bit of unnumbered frames.
+	LLCControlPF = 0x10
+)
+
+// XID returns true if l is an exchange identification frame.
+func (l *LLC) XID() bool { return l.Control&^LLCControlPF == LLCControlXID }
+
+// TEST returns true if l is a TEST frame, whose payload the responder
+// echoes back.
+func (l *LLC) TEST() bool { return l.Control&^LLCControlPF == LLCControlTEST }
+
+// LLCXID is the information field of an LLC XID frame in the basic format.
+// APs send an XID response from a station's address, with a null DSAP, when
+// the station associates, so that switches learn where it now is.
+type LLCXID struct {
+	BaseLayer
+	FormatID uint8
+	// Types holds the LLC types supported, 1 for type 1 only.
+	Types         uint8
+	ReceiveWindow uint8
+}
+
+// LLCXIDFormatBasic is the format identifier of basic XID information.
+const LLCXIDFormatBasic = 0x81
+
+// LayerType returns LayerTypeLLCXID.
+func (x *LLCXID) LayerType() gopacket.LayerType { return LayerTypeLLCXID }
+
+func (x *LLCXID) CanDecode() gopacket.LayerClass { return LayerTypeLLCXID }
+
+func (x *LLCXID) NextLayerType() gopacket.LayerType { return gopacket.LayerTypePayload }
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (x *LLCXID) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 3 {
+		df.SetTruncated()
+		return fmt.Errorf("LLC XID length %d too short", len(data))
+	}
+	if data[0] != LLCXIDFormatBasic {
+		return fmt.Errorf("LLC XID format %#x unsupported", data[0])
+	}
+	x.FormatID = data[0]
+	x.Types = data[1] & 0x1f
+	x.ReceiveWindow = data[2] >> 1
+	x.BaseLayer = BaseLayer{Contents: data[:3], Payload: data[3:]}
+	return nil
+}
+
+func decodeLLCXID(data []byte, p gopacket.PacketBuilder) error {
+	x := &LLCXID{}
+	return decodingLayerDecoder(x, data, p)
+}
+
 // SNAP is used inside LLC.  See
 // http://standards.ieee.org/getieee802/download/802-2001.pdf.
 // From http://en.wikipedia.org/wiki/Subnetwork_Access_Protocol:
@@ -59,9 +117,24 @@ func decodeLLC(data []byte, p gopacket.PacketBuilder) error {
 		l.Payload = data[3:]
 	}
 	p.AddLayer(l)
+	if l.XID() || l.TEST() {
+		if len(l.Payload) == 0 {
+			return nil
+		} else if l.XID() {
+			return p.NextDecoder(LayerTypeLLCXID)
+		}
+		return p.NextDecoder(gopacket.LayerTypePayload)
+	}
 	if l.DSAP == 0xAA && l.SSAP == 0xAA {
 		return p.NextDecoder(LayerTypeSNAP)
 	}
+	if l.DSAP == stpLLCSAP && l.SSAP == stpLLCSAP {
+		return p.NextDecoder(LayerTypeSTP)
+	}
+	if l.DSAP == 0xFE && l.SSAP == 0xFE {
+		// OSI network layer, which on LANs is only used by IS-IS.
+		return p.NextDecoder(LayerTypeISIS)
+	}
 	return p.NextDecoder(gopacket.DecodeUnknown)
 }
 
@@ -0,0 +1,69 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testPacketLLCXIDUpdate is the layer 2 update frame an AP sends for
+// 00:03:93:00:00:01 when it associates.
+var testPacketLLCXIDUpdate = []byte{
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00, 0x03, 0x93, 0x00, 0x00, 0x01, 0x00, 0x06,
+	0x00, 0x01, 0xaf, 0x81, 0x01, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+func TestPacketLLCXID(t *testing.T) {
+	p := gopacket.NewPacket(testPacketLLCXIDUpdate, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeLLC, LayerTypeLLCXID}, t)
+	llc := p.Layer(LayerTypeLLC).(*LLC)
+	if !llc.XID() || llc.TEST() || !llc.CR || llc.DSAP != 0 {
+		t.Errorf("got LLC %+v", llc)
+	}
+	xid := p.Layer(LayerTypeLLCXID).(*LLCXID)
+	if xid.FormatID != LLCXIDFormatBasic || xid.Types != 1 || xid.ReceiveWindow != 0 {
+		t.Errorf("got XID %+v", xid)
+	}
+}
+
+func TestPacketLLCTEST(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x00, 0x03, 0x93, 0x00, 0x00, 0x01, 0x00, 0x07,
+		0x04, 0x04, 0xf3, 'p', 'i', 'n', 'g'}
+	p := gopacket.NewPacket(data, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeLLC, gopacket.LayerTypePayload}, t)
+	if llc := p.Layer(LayerTypeLLC).(*LLC); !llc.TEST() || llc.Control&LLCControlPF == 0 {
+		t.Errorf("got LLC %+v", llc)
+	}
+	if !bytes.Equal(p.ApplicationLayer().Payload(), []byte("ping")) {
+		t.Errorf("got payload %q", p.ApplicationLayer().Payload())
+	}
+}
+
+func TestPacketRSNPreAuth(t *testing.T) {
+	data := []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x03, 0x93, 0x00, 0x00, 0x01, 0x88, 0xc7,
+		0x02, 0x00, 0x00, 0x06, 0x02, 0x01, 0x00, 0x06, 0x01, 'a'}
+	p := gopacket.NewPacket(data, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeEAPOL, LayerTypeEAP}, t)
+	if eap := p.Layer(LayerTypeEAP).(*EAP); eap.Code != EAPCodeResponse || eap.Type != EAPTypeIdentity {
+		t.Errorf("got EAP %+v", eap)
+	}
+}
@@ -267,6 +267,10 @@ const (
 	LLDP8023SubtypeMDIPower        uint8 = 2
 	LLDP8023SubtypeLinkAggregation uint8 = 3
 	LLDP8023SubtypeMTU             uint8 = 4
+	LLDP8023SubtypeEEE             uint8 = 5
+	LLDP8023SubtypeEEEFastWake     uint8 = 6
+	LLDP8023SubtypeAdditionalCaps  uint8 = 7
+	LLDP8023SubtypePowerMeasure    uint8 = 8
 )
 
 // MACPHY options
@@ -429,8 +433,55 @@ type LLDPPowerViaMDI8023 struct {
 	Type            LLDPPowerType
 	Source          LLDPPowerSource
 	Priority        LLDPPowerPriority
-	Requested       uint16 // 1-510 Watts
-	Allocated       uint16 // 1-510 Watts
+	Requested       uint16 // 0.1 Watts
+	Allocated       uint16 // 0.1 Watts
+}
+
+// LLDPPowerViaMDI8023bt holds the fields 802.3bt adds to the power via MDI
+// TLV, for type 3 and 4 devices.
+type LLDPPowerViaMDI8023bt struct {
+	// RequestedA and RequestedB are the power the PD requests on each
+	// pairset, and AllocatedA and AllocatedB what the PSE allocates, in
+	// 0.1 Watts.
+	RequestedA, RequestedB uint16
+	AllocatedA, AllocatedB uint16
+	// The power status fields.
+	PSEPoweringStatus uint8
+	PDPoweredStatus   uint8
+	PSEPowerPairs     uint8
+	ClassA, ClassB    uint8
+	Class             uint8
+	// The system setup fields.
+	PowerTypeExt uint8
+	PDLoad       bool
+	// PSEMaxAvailable is the most power the PSE can grant, in 0.1 Watts.
+	PSEMaxAvailable uint16
+	// The autoclass fields.
+	PSEAutoclassSupport bool
+	AutoclassCompleted  bool
+	AutoclassRequest    bool
+	// PowerDownRequest is 0x1d when the PD asks to be powered down for
+	// PowerDownTime seconds.
+	PowerDownRequest uint8
+	PowerDownTime    uint32
+}
+
+// LLDPEEE holds the Energy Efficient Ethernet wake times of a port, in
+// microseconds.
+type LLDPEEE struct {
+	TransmitTw, ReceiveTw         uint16
+	FallbackReceiveTw             uint16
+	EchoTransmitTw, EchoReceiveTw uint16
+}
+
+// LLDPAdditionalCaps holds the frame preemption capabilities of a port.
+type LLDPAdditionalCaps struct {
+	PreemptionSupported bool
+	PreemptionEnabled   bool
+	PreemptionActive    bool
+	// AdditionalFragmentSize is the minimum fragment size, in units of 64
+	// bytes beyond the first 64.
+	AdditionalFragmentSize uint8
 }
 
 // LLDPInfo8023 represents the information carried in 802.3 Org-specific TLVs
@@ -439,6 +490,11 @@ type LLDPInfo8023 struct {
 	PowerViaMDI        LLDPPowerViaMDI8023
 	LinkAggregation    LLDPLinkAggregation
 	MTU                uint16
+	// PowerViaMDI8023bt is set if the power via MDI TLV carries the 802.3bt
+	// fields.
+	PowerViaMDI8023bt *LLDPPowerViaMDI8023bt
+	EEE               *LLDPEEE
+	AdditionalCaps    *LLDPAdditionalCaps
 }
 
 // IEEE 802.1Qbg TLV Subtypes
@@ -850,16 +906,22 @@ func (l *LinkLayerDiscoveryInfo) Decode8021() (info LLDPInfo8021, err error) {
 			id := binary.BigEndian.Uint16(o.Info[1:3])
 			info.PPVIDs = append(info.PPVIDs, PortProtocolVLANID{sup, en, id})
 		case LLDP8021SubtypeVLANName:
-			if err = checkLLDPOrgSpecificLen(o, 2); err != nil {
+			if err = checkLLDPOrgSpecificLen(o, 3); err != nil {
 				return
 			}
 			id := binary.BigEndian.Uint16(o.Info[0:2])
-			info.VLANNames = append(info.VLANNames, VLANName{id, string(o.Info[3:])})
+			if err = checkLLDPOrgSpecificLen(o, 3+int(o.Info[2])); err != nil {
+				return
+			}
+			info.VLANNames = append(info.VLANNames, VLANName{id, string(o.Info[3 : 3+int(o.Info[2])])})
 		case LLDP8021SubtypeProtocolIdentity:
 			if err = checkLLDPOrgSpecificLen(o, 1); err != nil {
 				return
 			}
 			l := int(o.Info[0])
+			if err = checkLLDPOrgSpecificLen(o, 1+l); err != nil {
+				return
+			}
 			if l > 0 {
 				info.ProtocolIdentities = append(info.ProtocolIdentities, o.Info[1:1+l])
 			}
@@ -910,7 +972,7 @@ func (l *LinkLayerDiscoveryInfo) Decode8023() (info LLDPInfo8023, err error) {
 			info.PowerViaMDI.PSEPairsAbility = (o.Info[0]&LLDPMDIPowerPairsAbility > 0)
 			info.PowerViaMDI.PSEPowerPair = uint8(o.Info[1])
 			info.PowerViaMDI.PSEClass = uint8(o.Info[2])
-			if len(o.Info) >= 7 {
+			if len(o.Info) >= 8 {
 				info.PowerViaMDI.Type = LLDPPowerType((o.Info[3] & 0xc0) >> 6)
 				info.PowerViaMDI.Source = LLDPPowerSource((o.Info[3] & 0x30) >> 4)
 				if info.PowerViaMDI.Type == 1 || info.PowerViaMDI.Type == 3 {
@@ -920,6 +982,9 @@ func (l *LinkLayerDiscoveryInfo) Decode8023() (info LLDPInfo8023, err error) {
 				info.PowerViaMDI.Requested = binary.BigEndian.Uint16(o.Info[4:6])
 				info.PowerViaMDI.Allocated = binary.BigEndian.Uint16(o.Info[6:8])
 			}
+			if len(o.Info) >= 25 {
+				info.PowerViaMDI8023bt = decodeLLDPPowerViaMDI8023bt(o.Info[8:25])
+			}
 		case LLDP8023SubtypeLinkAggregation:
 			if err = checkLLDPOrgSpecificLen(o, 5); err != nil {
 				return
@@ -932,11 +997,60 @@ func (l *LinkLayerDiscoveryInfo) Decode8023() (info LLDPInfo8023, err error) {
 				return
 			}
 			info.MTU = binary.BigEndian.Uint16(o.Info[0:2])
+		case LLDP8023SubtypeEEE:
+			if err = checkLLDPOrgSpecificLen(o, 10); err != nil {
+				return
+			}
+			info.EEE = &LLDPEEE{
+				TransmitTw:        binary.BigEndian.Uint16(o.Info[0:2]),
+				ReceiveTw:         binary.BigEndian.Uint16(o.Info[2:4]),
+				FallbackReceiveTw: binary.BigEndian.Uint16(o.Info[4:6]),
+				EchoTransmitTw:    binary.BigEndian.Uint16(o.Info[6:8]),
+				EchoReceiveTw:     binary.BigEndian.Uint16(o.Info[8:10]),
+			}
+		case LLDP8023SubtypeAdditionalCaps:
+			if err = checkLLDPOrgSpecificLen(o, 2); err != nil {
+				return
+			}
+			b := binary.BigEndian.Uint16(o.Info[0:2])
+			info.AdditionalCaps = &LLDPAdditionalCaps{
+				PreemptionSupported:    b&0x1 != 0,
+				PreemptionEnabled:      b&0x2 != 0,
+				PreemptionActive:       b&0x4 != 0,
+				AdditionalFragmentSize: uint8(b>>3) & 0x3,
+			}
 		}
 	}
 	return
 }
 
+// decodeLLDPPowerViaMDI8023bt decodes the 17 bytes 802.3bt adds to the
+// power via MDI TLV.
+func decodeLLDPPowerViaMDI8023bt(b []byte) *LLDPPowerViaMDI8023bt {
+	status := binary.BigEndian.Uint16(b[8:10])
+	down := uint32(b[14])<<16 | uint32(b[15])<<8 | uint32(b[16])
+	return &LLDPPowerViaMDI8023bt{
+		RequestedA:          binary.BigEndian.Uint16(b[0:2]),
+		RequestedB:          binary.BigEndian.Uint16(b[2:4]),
+		AllocatedA:          binary.BigEndian.Uint16(b[4:6]),
+		AllocatedB:          binary.BigEndian.Uint16(b[6:8]),
+		PSEPoweringStatus:   uint8(status >> 14),
+		PDPoweredStatus:     uint8(status>>12) & 0x3,
+		PSEPowerPairs:       uint8(status>>10) & 0x3,
+		ClassA:              uint8(status>>7) & 0x7,
+		ClassB:              uint8(status>>4) & 0x7,
+		Class:               uint8(status) & 0xf,
+		PowerTypeExt:        (b[10] >> 1) & 0x7,
+		PDLoad:              b[10]&0x1 != 0,
+		PSEMaxAvailable:     binary.BigEndian.Uint16(b[11:13]),
+		PSEAutoclassSupport: b[13]&0x4 != 0,
+		AutoclassCompleted:  b[13]&0x2 != 0,
+		AutoclassRequest:    b[13]&0x1 != 0,
+		PowerDownRequest:    uint8(down >> 18),
+		PowerDownTime:       down & 0x3ffff,
+	}
+}
+
 func (l *LinkLayerDiscoveryInfo) Decode8021Qbg() (info LLDPInfo8021Qbg, err error) {
 	for _, o := range l.OrgTLVs {
 		if o.OUI != IEEEOUI8021Qbg {
@@ -1011,7 +1125,7 @@ func (l *LinkLayerDiscoveryInfo) DecodeMedia() (info LLDPInfoMedia, err error) {
 				info.Location.Coordinate.Altitude = b2 & 0x3fffffff
 				info.Location.Coordinate.Datum = uint8(o.Info[15])
 			case LLDPLocationFormatAddress:
-				if err = checkLLDPOrgSpecificLen(o, 3); err != nil {
+				if err = checkLLDPOrgSpecificLen(o, 4); err != nil {
 					return
 				}
 				//ll := uint8(o.Info[0])
@@ -0,0 +1,88 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testPacketLLDP8023bt is an LLDPDU from a type 3 PSE, with the 802.3bt
+// power via MDI fields, EEE and preemption capabilities, and a VLAN name.
+var testPacketLLDP8023bt = []byte{
+	0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x88, 0xcc,
+	0x02, 0x07, 0x04, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55,
+	0x04, 0x04, 0x07, '1', '/', '1',
+	0x06, 0x02, 0x00, 0x78,
+	0xfe, 0x1d, 0x00, 0x12, 0x0f, 0x02,
+	0x0f, 0x01, 0x05, 0x51, 0x00, 0xff, 0x00, 0xff,
+	0x01, 0x2c, 0x01, 0x2c, 0x01, 0x2c, 0x01, 0x2c,
+	0x8e, 0xd7, 0x02, 0x02, 0x58, 0x04, 0x00, 0x00, 0x00,
+	0xfe, 0x0e, 0x00, 0x12, 0x0f, 0x05, 0x00, 0x11, 0x00, 0x11, 0x00, 0x11, 0x00, 0x0b, 0x00, 0x0b,
+	0xfe, 0x06, 0x00, 0x12, 0x0f, 0x07, 0x00, 0x0b,
+	0xfe, 0x0c, 0x00, 0x80, 0xc2, 0x03, 0x00, 0x0a, 0x05, 'v', 'l', 'a', 'n', 'a',
+	0x00, 0x00,
+}
+
+func TestLLDP8023bt(t *testing.T) {
+	p := gopacket.NewPacket(testPacketLLDP8023bt, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeLinkLayerDiscovery, LayerTypeLinkLayerDiscoveryInfo}, t)
+	info := p.Layer(LayerTypeLinkLayerDiscoveryInfo).(*LinkLayerDiscoveryInfo)
+	i8023, err := info.Decode8023()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i8023.PowerViaMDI.Requested != 255 || i8023.PowerViaMDI.PSEClass != 5 {
+		t.Errorf("got power via MDI %+v", i8023.PowerViaMDI)
+	}
+	wantbt := &LLDPPowerViaMDI8023bt{
+		RequestedA: 300, RequestedB: 300, AllocatedA: 300, AllocatedB: 300,
+		PSEPoweringStatus: 2, PSEPowerPairs: 3, ClassA: 5, ClassB: 5, Class: 7,
+		PowerTypeExt:        1,
+		PSEMaxAvailable:     600,
+		PSEAutoclassSupport: true,
+	}
+	if !reflect.DeepEqual(i8023.PowerViaMDI8023bt, wantbt) {
+		t.Errorf("got 802.3bt fields %+v, want %+v", i8023.PowerViaMDI8023bt, wantbt)
+	}
+	if want := (&LLDPEEE{17, 17, 17, 11, 11}); !reflect.DeepEqual(i8023.EEE, want) {
+		t.Errorf("got EEE %+v, want %+v", i8023.EEE, want)
+	}
+	if want := (&LLDPAdditionalCaps{true, true, false, 1}); !reflect.DeepEqual(i8023.AdditionalCaps, want) {
+		t.Errorf("got additional capabilities %+v, want %+v", i8023.AdditionalCaps, want)
+	}
+	i8021, err := info.Decode8021()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []VLANName{{10, "vlana"}}; !reflect.DeepEqual(i8021.VLANNames, want) {
+		t.Errorf("got VLAN names %v, want %v", i8021.VLANNames, want)
+	}
+}
+
+func TestLLDPOrgSpecificTruncated(t *testing.T) {
+	for _, o := range []LLDPOrgSpecificTLV{
+		{OUI: IEEEOUI8021, SubType: LLDP8021SubtypeVLANName, Info: []byte{0x00, 0x0a, 0x09, 'v'}},
+		{OUI: IEEEOUI8021, SubType: LLDP8021SubtypeProtocolIdentity, Info: []byte{0x04, 0x88}},
+	} {
+		info := &LinkLayerDiscoveryInfo{OrgTLVs: []LLDPOrgSpecificTLV{o}}
+		if _, err := info.Decode8021(); err == nil {
+			t.Errorf("subtype %d: no error for truncated TLV", o.SubType)
+		}
+	}
+	info := &LinkLayerDiscoveryInfo{OrgTLVs: []LLDPOrgSpecificTLV{
+		{OUI: IEEEOUI8023, SubType: LLDP8023SubtypeMDIPower, Info: []byte{0x0f, 0x01, 0x05, 0x51, 0x00, 0xff, 0x00}},
+	}}
+	if _, err := info.Decode8023(); err != nil {
+		t.Errorf("got error %v for power via MDI without 802.3at fields", err)
+	}
+}
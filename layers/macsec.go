@@ -0,0 +1,222 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/mistsys/gopacket"
+)
+
+// MACsecICVLength is the length of the integrity check value that ends
+// a MACsec frame, the same for all the standard GCM-AES cipher suites.
+const MACsecICVLength = 16
+
+// MACsecSCI is a secure channel identifier: the system's MAC address and
+// a port number.
+type MACsecSCI struct {
+	System net.HardwareAddr
+	Port   uint16
+}
+
+// MACsec is the 802.1AE security tag, the secure data it protects, and its
+// integrity check value.
+//
+// If the frame is integrity protected but not encrypted, the secure data is
+// cleartext, starting with the EtherType of the protected frame, and
+// decoding carries on with it.  Otherwise the secure data is left
+// undecoded, as the payload.
+type MACsec struct {
+	BaseLayer
+	// TCI flags.  Encrypted and Changed are both set for confidentiality,
+	// and both clear for integrity only.
+	EndStation          bool
+	SCPresent           bool
+	SingleCopyBroadcast bool
+	Encrypted           bool
+	Changed             bool
+	AssociationNumber   uint8
+	// ShortLength is the length of the secure data if it's shorter than
+	// 48 bytes, and 0 otherwise.
+	ShortLength  uint8
+	PacketNumber uint32
+	// SCI is only set if SCPresent is.  Otherwise it's implied: the source
+	// MAC address and port 1 if EndStation is set, or a default the peers
+	// agreed on.
+	SCI MACsecSCI
+	// Type is the EtherType of a frame sent in cleartext.
+	Type EthernetType
+	// SecureData is the protected data, including the EtherType of a
+	// cleartext frame.
+	SecureData []byte
+	// ICV is the integrity check value, and ICVOffset its offset from the
+	// start of the layer, for verification by code that holds the keys.
+	// It covers the Ethernet addresses, the security tag and SecureData.
+	ICV       []byte
+	ICVOffset int
+}
+
+// LayerType returns LayerTypeMACsec.
+func (m *MACsec) LayerType() gopacket.LayerType { return LayerTypeMACsec }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (m *MACsec) CanDecode() gopacket.LayerClass { return LayerTypeMACsec }
+
+// NextLayerType returns the layer type contained by this DecodingLayer: the
+// protected frame's EtherType if it's cleartext, and nothing otherwise.
+func (m *MACsec) NextLayerType() gopacket.LayerType {
+	if m.cleartext() {
+		return m.Type.LayerType()
+	}
+	return gopacket.LayerTypeZero
+}
+
+func (m *MACsec) cleartext() bool {
+	return !m.Encrypted && !m.Changed
+}
+
+func (m *MACsec) headerLength() int {
+	if m.SCPresent {
+		return 14
+	}
+	return 6
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (m *MACsec) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 6 {
+		df.SetTruncated()
+		return fmt.Errorf("MACsec length %d too short", len(data))
+	}
+	tci := data[0]
+	if tci&0x80 != 0 {
+		return errors.New("MACsec version 1 not supported")
+	}
+	m.EndStation = tci&0x40 != 0
+	m.SCPresent = tci&0x20 != 0
+	m.SingleCopyBroadcast = tci&0x10 != 0
+	m.Encrypted = tci&0x08 != 0
+	m.Changed = tci&0x04 != 0
+	m.AssociationNumber = tci & 0x03
+	m.ShortLength = data[1] & 0x3f
+	m.PacketNumber = binary.BigEndian.Uint32(data[2:6])
+	hdr := m.headerLength()
+	if len(data) < hdr {
+		df.SetTruncated()
+		return fmt.Errorf("MACsec length %d too short for SCI", len(data))
+	}
+	m.SCI = MACsecSCI{}
+	if m.SCPresent {
+		m.SCI = MACsecSCI{System: net.HardwareAddr(data[6:12]), Port: binary.BigEndian.Uint16(data[12:14])}
+	}
+	end := len(data) - MACsecICVLength
+	if m.ShortLength != 0 {
+		// Anything after the ICV is Ethernet padding.
+		end = hdr + int(m.ShortLength)
+	}
+	if end < hdr || end+MACsecICVLength > len(data) {
+		df.SetTruncated()
+		return fmt.Errorf("MACsec length %d too short for ICV", len(data))
+	}
+	m.SecureData = data[hdr:end]
+	m.ICV = data[end : end+MACsecICVLength]
+	m.ICVOffset = end
+	m.Type = 0
+	if !m.cleartext() {
+		m.BaseLayer = BaseLayer{Contents: data[:hdr], Payload: m.SecureData}
+		return nil
+	}
+	if len(m.SecureData) < 2 {
+		return fmt.Errorf("MACsec secure data length %d too short for EtherType", len(m.SecureData))
+	}
+	m.Type = EthernetType(binary.BigEndian.Uint16(m.SecureData))
+	m.BaseLayer = BaseLayer{Contents: data[:hdr+2], Payload: data[hdr+2 : end]}
+	return nil
+}
+
+func decodeMACsec(data []byte, p gopacket.PacketBuilder) error {
+	return decodingLayerDecoder(&MACsec{}, data, p)
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+// See the docs for gopacket.SerializableLayer for more info.
+//
+// A cleartext frame's payload is the serialized layers that follow, after
+// Type.  Otherwise SecureData is written, and nothing should follow.  ICV
+// is written as it is, or as zeros if it's nil, for the caller to fill in.
+func (m *MACsec) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	if m.cleartext() {
+		bytes, err := b.PrependBytes(2)
+		if err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint16(bytes, uint16(m.Type))
+	} else {
+		bytes, err := b.PrependBytes(len(m.SecureData))
+		if err != nil {
+			return err
+		}
+		copy(bytes, m.SecureData)
+	}
+	if m.ICV != nil && len(m.ICV) != MACsecICVLength {
+		return fmt.Errorf("MACsec ICV length %d, want %d", len(m.ICV), MACsecICVLength)
+	}
+	if opts.FixLengths {
+		m.ShortLength = 0
+		if n := len(b.Bytes()); n < 48 {
+			m.ShortLength = uint8(n)
+		}
+	}
+	icv, err := b.AppendBytes(MACsecICVLength)
+	if err != nil {
+		return err
+	}
+	copy(icv, m.ICV)
+	if m.ICV == nil {
+		for i := range icv {
+			icv[i] = 0
+		}
+	}
+	hdr := m.headerLength()
+	bytes, err := b.PrependBytes(hdr)
+	if err != nil {
+		return err
+	}
+	if m.AssociationNumber > 3 {
+		return fmt.Errorf("MACsec association number %d too high", m.AssociationNumber)
+	}
+	tci := m.AssociationNumber
+	for _, f := range []struct {
+		set  bool
+		mask uint8
+	}{
+		{m.EndStation, 0x40},
+		{m.SCPresent, 0x20},
+		{m.SingleCopyBroadcast, 0x10},
+		{m.Encrypted, 0x08},
+		{m.Changed, 0x04},
+	} {
+		if f.set {
+			tci |= f.mask
+		}
+	}
+	bytes[0] = tci
+	bytes[1] = m.ShortLength & 0x3f
+	binary.BigEndian.PutUint32(bytes[2:6], m.PacketNumber)
+	if m.SCPresent {
+		if len(m.SCI.System) != 6 {
+			return fmt.Errorf("MACsec SCI system address %v invalid", m.SCI.System)
+		}
+		copy(bytes[6:12], m.SCI.System)
+		binary.BigEndian.PutUint16(bytes[12:14], m.SCI.Port)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testPacketMACsecIntegrity is an integrity-only MACsec frame with an
+// explicit SCI, protecting an ARP request.  The short length is set, and
+// the frame is padded after the ICV.
+var testPacketMACsecIntegrity = []byte{
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x88, 0xe5,
+	0x21, 0x1e, 0x00, 0x00, 0x00, 0x07,
+	0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x00, 0x01,
+	0x08, 0x06,
+	0x00, 0x01, 0x08, 0x00, 0x06, 0x04, 0x00, 0x01,
+	0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x0a, 0x00, 0x00, 0x01,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x02,
+	0xa0, 0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xab, 0xac, 0xad, 0xae, 0xaf,
+	0x00, 0x00,
+}
+
+func TestMACsecIntegrity(t *testing.T) {
+	p := gopacket.NewPacket(testPacketMACsecIntegrity, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeMACsec, LayerTypeARP}, t)
+
+	m := p.Layer(LayerTypeMACsec).(*MACsec)
+	data := testPacketMACsecIntegrity[14:]
+	want := &MACsec{
+		BaseLayer:         BaseLayer{Contents: data[:16], Payload: data[16:44]},
+		SCPresent:         true,
+		AssociationNumber: 1,
+		ShortLength:       30,
+		PacketNumber:      7,
+		SCI:               MACsecSCI{System: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}, Port: 1},
+		Type:              EthernetTypeARP,
+		SecureData:        data[14:44],
+		ICV:               data[44:60],
+		ICVOffset:         44,
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("MACsec mismatch:\ngot  %#v\nwant %#v", m, want)
+	}
+	if arp := p.Layer(LayerTypeARP).(*ARP); !bytes.Equal(arp.DstProtAddress, []byte{10, 0, 0, 2}) {
+		t.Errorf("got ARP %+v", arp)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	m.ShortLength = 0
+	eth := p.Layer(LayerTypeEthernet).(*Ethernet)
+	if err := gopacket.SerializeLayers(buf, opts, eth, m, gopacket.Payload(m.Payload)); err != nil {
+		t.Fatal(err)
+	}
+	if want := testPacketMACsecIntegrity[:len(testPacketMACsecIntegrity)-2]; !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("serialization mismatch:\ngot  %x\nwant %x", buf.Bytes(), want)
+	}
+}
+
+func TestMACsecEncrypted(t *testing.T) {
+	m := &MACsec{
+		EndStation:   true,
+		Encrypted:    true,
+		Changed:      true,
+		PacketNumber: 0x01020304,
+		SecureData:   bytes.Repeat([]byte{0x5a}, 64),
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	err := gopacket.SerializeLayers(buf, opts,
+		&Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+			DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 6},
+			EthernetType: EthernetTypeMACsec,
+		}, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeMACsec}, t)
+	got := p.Layer(LayerTypeMACsec).(*MACsec)
+	if !got.EndStation || !got.Encrypted || !got.Changed || got.SCPresent || got.ShortLength != 0 || got.PacketNumber != 0x01020304 {
+		t.Errorf("got flags %+v", got)
+	}
+	if !bytes.Equal(got.SecureData, m.SecureData) || !bytes.Equal(got.Payload, m.SecureData) {
+		t.Errorf("got secure data %x", got.SecureData)
+	}
+	if got.ICVOffset != 6+64 || !bytes.Equal(got.ICV, make([]byte, MACsecICVLength)) {
+		t.Errorf("got ICV %x at %d", got.ICV, got.ICVOffset)
+	}
+}
+
+func TestMACsecTruncated(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x20, 0x00, 0x00, 0x00},
+		{0x20, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x11},
+		{0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x08, 0x00, 0x45},
+		{0x00, 0x20, 0x00, 0x00, 0x00, 0x01, 0x08, 0x00, 0x45, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+	} {
+		p := gopacket.NewPacket(data, LayerTypeMACsec, gopacket.Default)
+		if p.ErrorLayer() == nil {
+			t.Errorf("%x: want decode error", data)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"github.com/mistsys/gopacket"
+)
+
+// MDNS is a multicast DNS message (RFC 6762), sent to UDP port 5353.  Its
+// format is that of DNS, except that the top bit of the class of a
+// question asks for a unicast response, and that of a record tells caches
+// to flush the other records of its name and type.  DecodeFromBytes moves
+// those bits to the UnicastResponse and CacheFlush fields, leaving the
+// classes without them, and SerializeTo puts them back.
+type MDNS struct {
+	DNS
+}
+
+// LayerType returns LayerTypeMDNS.
+func (m *MDNS) LayerType() gopacket.LayerType { return LayerTypeMDNS }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (m *MDNS) CanDecode() gopacket.LayerClass { return LayerTypeMDNS }
+
+func decodeMDNS(data []byte, p gopacket.PacketBuilder) error {
+	m := &MDNS{}
+	if err := m.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(m)
+	p.SetApplicationLayer(m)
+	return nil
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (m *MDNS) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if err := m.DNS.DecodeFromBytes(data, df); err != nil {
+		return err
+	}
+	for i := range m.Questions {
+		q := &m.Questions[i]
+		q.UnicastResponse = q.Class&0x8000 != 0
+		q.Class &^= 0x8000
+	}
+	for _, rrs := range [][]DNSResourceRecord{m.Answers, m.Authorities, m.Additionals} {
+		for i := range rrs {
+			// The class of an OPT record is a payload size.
+			if rr := &rrs[i]; rr.Type != DNSTypeOPT {
+				rr.CacheFlush = rr.Class&0x8000 != 0
+				rr.Class &^= 0x8000
+			}
+		}
+	}
+	return nil
+}
+
+// LLMNR is a Link-Local Multicast Name Resolution message (RFC 4795), sent
+// to UDP port 5355.  Its format is that of DNS, except for the flags: the
+// bits DNS uses for AA and RD are LLMNR's C (conflict) and T (tentative)
+// bits, which Conflict and Tentative report.
+type LLMNR struct {
+	DNS
+}
+
+// LayerType returns LayerTypeLLMNR.
+func (l *LLMNR) LayerType() gopacket.LayerType { return LayerTypeLLMNR }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (l *LLMNR) CanDecode() gopacket.LayerClass { return LayerTypeLLMNR }
+
+// Conflict reports whether the C bit, held in AA, is set: in a query, the
+// sender saw conflicting responses for the name, and in a response, the
+// name isn't considered unique.
+func (l *LLMNR) Conflict() bool { return l.AA }
+
+// Tentative reports whether the T bit, held in RD, is set: the responder
+// hasn't yet verified that the name is unique.
+func (l *LLMNR) Tentative() bool { return l.RD }
+
+func decodeLLMNR(data []byte, p gopacket.PacketBuilder) error {
+	l := &LLMNR{}
+	if err := l.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(l)
+	p.SetApplicationLayer(l)
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func testMDNSPacket(t *testing.T, port UDPPort, dns gopacket.SerializableLayer) gopacket.Packet {
+	eth := &Ethernet{
+		SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0x01, 0, 0x5e, 0, 0, 0xfb},
+		EthernetType: EthernetTypeIPv4,
+	}
+	ip := &IPv4{Version: 4, TTL: 255, Protocol: IPProtocolUDP, SrcIP: net.IP{192, 168, 1, 20}, DstIP: net.IP{224, 0, 0, 251}}
+	udp := &UDP{SrcPort: port, DstPort: port}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, dns); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LinkTypeEthernet, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	return p
+}
+
+func TestMDNS(t *testing.T) {
+	m := &MDNS{DNS{
+		Questions: []DNSQuestion{{Name: []byte("_ipp._tcp.local"), Type: DNSTypePTR, Class: DNSClassIN, UnicastResponse: true}},
+		Additionals: []DNSResourceRecord{
+			{Name: []byte("printer.local"), Type: DNSTypeA, Class: DNSClassIN, TTL: 120, CacheFlush: true, IP: net.IP{192, 168, 1, 20}},
+			DNSEDNS{UDPSize: 0x8000 | 1440}.Record(),
+		},
+	}}
+	p := testMDNSPacket(t, 5353, m)
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeIPv4, LayerTypeUDP, LayerTypeMDNS}, t)
+	got := p.Layer(LayerTypeMDNS).(*MDNS)
+	if q := got.Questions[0]; !q.UnicastResponse || q.Class != DNSClassIN {
+		t.Errorf("got question %+v, want unicast response and class IN", q)
+	}
+	if rr := got.Additionals[0]; !rr.CacheFlush || rr.Class != DNSClassIN {
+		t.Errorf("got record %+v, want cache flush and class IN", rr)
+	}
+	// The class of an OPT record is a payload size, whose top bit is its
+	// own.
+	if e, ok := got.EDNS(); !ok || e.UDPSize != 0x8000|1440 {
+		t.Errorf("got EDNS0 %+v, want payload size %d", e, 0x8000|1440)
+	}
+	if p.Layer(LayerTypeDNS) != nil {
+		t.Error("mDNS decoded as DNS")
+	}
+}
+
+func TestLLMNR(t *testing.T) {
+	l := &LLMNR{DNS{ID: 7, QR: true, AA: true,
+		Questions: []DNSQuestion{{Name: []byte("fileserver"), Type: DNSTypeA, Class: DNSClassIN}},
+		Answers:   []DNSResourceRecord{{Name: []byte("fileserver"), Type: DNSTypeA, Class: DNSClassIN, TTL: 30, IP: net.IP{192, 168, 1, 20}}},
+	}}
+	p := testMDNSPacket(t, 5355, l)
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeIPv4, LayerTypeUDP, LayerTypeLLMNR}, t)
+	got := p.Layer(LayerTypeLLMNR).(*LLMNR)
+	if !got.Conflict() || got.Tentative() {
+		t.Errorf("got conflict %v and tentative %v, want true and false", got.Conflict(), got.Tentative())
+	}
+	if len(got.Answers) != 1 || !got.Answers[0].IP.Equal(net.IP{192, 168, 1, 20}) {
+		t.Errorf("got answers %v", got.Answers)
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/mistsys/gopacket"
+)
+
+// MKAParameterSetType is the type of an MKA parameter set.
+type MKAParameterSetType uint8
+
+const (
+	MKAParameterSetLivePeerList      MKAParameterSetType = 1
+	MKAParameterSetPotentialPeerList MKAParameterSetType = 2
+	MKAParameterSetSAKUse            MKAParameterSetType = 3
+	MKAParameterSetDistributedSAK    MKAParameterSetType = 4
+	MKAParameterSetDistributedCAK    MKAParameterSetType = 5
+	MKAParameterSetKMD               MKAParameterSetType = 6
+	MKAParameterSetAnnouncement      MKAParameterSetType = 7
+	MKAParameterSetXPN               MKAParameterSetType = 8
+	MKAParameterSetICVIndicator      MKAParameterSetType = 255
+)
+
+func (t MKAParameterSetType) String() string {
+	switch t {
+	case MKAParameterSetLivePeerList:
+		return "Live Peer List"
+	case MKAParameterSetPotentialPeerList:
+		return "Potential Peer List"
+	case MKAParameterSetSAKUse:
+		return "MACsec SAK Use"
+	case MKAParameterSetDistributedSAK:
+		return "Distributed SAK"
+	case MKAParameterSetDistributedCAK:
+		return "Distributed CAK"
+	case MKAParameterSetKMD:
+		return "KMD"
+	case MKAParameterSetAnnouncement:
+		return "Announcement"
+	case MKAParameterSetXPN:
+		return "XPN"
+	case MKAParameterSetICVIndicator:
+		return "ICV Indicator"
+	default:
+		return fmt.Sprintf("Unknown(%d)", uint8(t))
+	}
+}
+
+// MKAMACsecCapability is the MACsec capability a participant announces.
+type MKAMACsecCapability uint8
+
+const (
+	MKAMACsecNotImplemented           MKAMACsecCapability = 0
+	MKAMACsecIntegrity                MKAMACsecCapability = 1
+	MKAMACsecIntegrityConfidentiality MKAMACsecCapability = 2
+	// MKAMACsecConfidentialityOffset adds support for confidentiality
+	// offsets of 0, 30 and 50 bytes.
+	MKAMACsecConfidentialityOffset MKAMACsecCapability = 3
+)
+
+// MKAMemberID is the random member identifier of an MKA participant.
+type MKAMemberID [12]byte
+
+func (id MKAMemberID) String() string {
+	return fmt.Sprintf("%x", id[:])
+}
+
+// MKAPeer is an entry of a live or potential peer list.
+type MKAPeer struct {
+	MemberID      MKAMemberID
+	MessageNumber uint32
+}
+
+// MKAKeyUse describes the use of one of the keys in a SAK use parameter
+// set.
+type MKAKeyUse struct {
+	// KeyServerMemberID and KeyNumber identify the key.
+	KeyServerMemberID MKAMemberID
+	KeyNumber         uint32
+	// LowestAcceptablePN is the lowest packet number receivers accept.
+	LowestAcceptablePN uint32
+}
+
+// MKASAKUse is the MACsec SAK use parameter set, which says which SAKs a
+// participant transmits and receives with.
+type MKASAKUse struct {
+	LatestKeyAN  uint8
+	LatestKeyTx  bool
+	LatestKeyRx  bool
+	OldKeyAN     uint8
+	OldKeyTx     bool
+	OldKeyRx     bool
+	PlainTx      bool
+	PlainRx      bool
+	DelayProtect bool
+	// LatestKey and OldKey are only set if HasKeys is; a participant that
+	// doesn't use MACsec sends the set without them.
+	HasKeys   bool
+	LatestKey MKAKeyUse
+	OldKey    MKAKeyUse
+}
+
+// MKADistributedSAK is the distributed SAK parameter set, by which the key
+// server hands out a new SAK, wrapped with the key encrypting key.
+type MKADistributedSAK struct {
+	AssociationNumber     uint8
+	ConfidentialityOffset uint8
+	// KeyNumber and WrappedKey are zero if the key server distributes no
+	// SAK because MACsec isn't used.
+	KeyNumber uint32
+	// CipherSuite is the cipher suite reference number, or zero for the
+	// default GCM-AES-128 when the set doesn't carry one.
+	CipherSuite uint64
+	WrappedKey  []byte
+}
+
+// MKAParameterSet is a raw MKA parameter set.  Header holds its four
+// header bytes, whose type specific bits the typed fields of MKA decode,
+// and Body the bytes its length covers, excluding padding.
+type MKAParameterSet struct {
+	Type   MKAParameterSetType
+	Header []byte
+	Body   []byte
+}
+
+// MKA is an 802.1X MACsec Key Agreement PDU, carried by EAPOL packets of
+// type EAPOLTypeMKA.
+//
+// The basic parameter set, which every MKPDU starts with, is decoded into
+// the fields up to CAKName.  The peer list, SAK use and distributed SAK
+// sets are decoded into their own fields, and ParameterSets holds all the
+// sets after the basic one, in order, whether their types are known or
+// not.
+type MKA struct {
+	BaseLayer
+	Version           uint8
+	KeyServerPriority uint8
+	KeyServer         bool
+	MACsecDesired     bool
+	MACsecCapability  MKAMACsecCapability
+	SCI               MACsecSCI
+	// MemberID and MessageNumber identify the participant sending the
+	// MKPDU and the MKPDU.
+	MemberID         MKAMemberID
+	MessageNumber    uint32
+	AlgorithmAgility uint32
+	CAKName          []byte
+
+	LivePeers      []MKAPeer
+	PotentialPeers []MKAPeer
+	SAKUse         *MKASAKUse
+	DistributedSAK *MKADistributedSAK
+	ParameterSets  []MKAParameterSet
+
+	// ICV is the integrity check value ending the MKPDU.
+	ICV []byte
+}
+
+// LayerType returns LayerTypeMKA.
+func (m *MKA) LayerType() gopacket.LayerType { return LayerTypeMKA }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (m *MKA) CanDecode() gopacket.LayerClass { return LayerTypeMKA }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (m *MKA) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+func decodeMKA(data []byte, p gopacket.PacketBuilder) error {
+	return decodingLayerDecoder(&MKA{}, data, p)
+}
+
+// mkaParameterSetLength returns the body length in the header of a
+// parameter set.
+func mkaParameterSetLength(h []byte) int {
+	return int(binary.BigEndian.Uint16(h[2:4]) & 0xfff)
+}
+
+// mkaNext returns what follows the parameter set with a body of length n
+// at the start of b, which is padded to a multiple of 4 bytes.
+func mkaNext(b []byte, n int) []byte {
+	if n = (4 + n + 3) &^ 3; n < len(b) {
+		return b[n:]
+	}
+	return nil
+}
+
+func decodeMKAPeers(b []byte) ([]MKAPeer, error) {
+	if len(b)%16 != 0 {
+		return nil, fmt.Errorf("MKA peer list length %d not a multiple of 16", len(b))
+	}
+	peers := make([]MKAPeer, 0, len(b)/16)
+	for ; len(b) > 0; b = b[16:] {
+		var p MKAPeer
+		copy(p.MemberID[:], b[:12])
+		p.MessageNumber = binary.BigEndian.Uint32(b[12:16])
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+func decodeMKAKeyUse(b []byte) MKAKeyUse {
+	var k MKAKeyUse
+	copy(k.KeyServerMemberID[:], b[:12])
+	k.KeyNumber = binary.BigEndian.Uint32(b[12:16])
+	k.LowestAcceptablePN = binary.BigEndian.Uint32(b[16:20])
+	return k
+}
+
+func decodeMKASAKUse(h, b []byte) (*MKASAKUse, error) {
+	u := &MKASAKUse{
+		LatestKeyAN:  h[1] >> 6,
+		LatestKeyTx:  h[1]&0x20 != 0,
+		LatestKeyRx:  h[1]&0x10 != 0,
+		OldKeyAN:     h[1] >> 2 & 3,
+		OldKeyTx:     h[1]&0x02 != 0,
+		OldKeyRx:     h[1]&0x01 != 0,
+		PlainTx:      h[2]&0x80 != 0,
+		PlainRx:      h[2]&0x40 != 0,
+		DelayProtect: h[2]&0x10 != 0,
+	}
+	switch {
+	case len(b) == 0:
+	case len(b) >= 40:
+		u.HasKeys = true
+		u.LatestKey = decodeMKAKeyUse(b[:20])
+		u.OldKey = decodeMKAKeyUse(b[20:40])
+	default:
+		return nil, fmt.Errorf("MKA SAK use length %d too short", len(b))
+	}
+	return u, nil
+}
+
+func decodeMKADistributedSAK(h, b []byte) (*MKADistributedSAK, error) {
+	d := &MKADistributedSAK{
+		AssociationNumber:     h[1] >> 6,
+		ConfidentialityOffset: h[1] >> 4 & 3,
+	}
+	switch {
+	case len(b) == 0:
+	case len(b) == 28:
+		// The default cipher suite, with a 128 bit key wrapped in 24 bytes.
+		d.KeyNumber = binary.BigEndian.Uint32(b[:4])
+		d.WrappedKey = b[4:]
+	case len(b) > 12:
+		d.KeyNumber = binary.BigEndian.Uint32(b[:4])
+		d.CipherSuite = binary.BigEndian.Uint64(b[4:12])
+		d.WrappedKey = b[12:]
+	default:
+		return nil, fmt.Errorf("MKA distributed SAK length %d invalid", len(b))
+	}
+	return d, nil
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (m *MKA) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 32+MACsecICVLength {
+		df.SetTruncated()
+		return fmt.Errorf("MKA length %d too short", len(data))
+	}
+	body := data[:len(data)-MACsecICVLength]
+	m.ICV = data[len(data)-MACsecICVLength:]
+
+	n := mkaParameterSetLength(body)
+	if n < 28 {
+		return fmt.Errorf("MKA basic parameter set length %d too short", n)
+	}
+	if 4+n > len(body) {
+		df.SetTruncated()
+		return fmt.Errorf("MKA basic parameter set length %d exceeds MKPDU", n)
+	}
+	m.Version = body[0]
+	m.KeyServerPriority = body[1]
+	m.KeyServer = body[2]&0x80 != 0
+	m.MACsecDesired = body[2]&0x40 != 0
+	m.MACsecCapability = MKAMACsecCapability(body[2] >> 4 & 3)
+	m.SCI = MACsecSCI{System: net.HardwareAddr(body[4:10]), Port: binary.BigEndian.Uint16(body[10:12])}
+	copy(m.MemberID[:], body[12:24])
+	m.MessageNumber = binary.BigEndian.Uint32(body[24:28])
+	m.AlgorithmAgility = binary.BigEndian.Uint32(body[28:32])
+	m.CAKName = body[32 : 4+n]
+
+	m.LivePeers, m.PotentialPeers = nil, nil
+	m.SAKUse, m.DistributedSAK = nil, nil
+	m.ParameterSets = m.ParameterSets[:0]
+	for rest := mkaNext(body, n); len(rest) > 0; rest = mkaNext(rest, n) {
+		if len(rest) < 4 {
+			df.SetTruncated()
+			return fmt.Errorf("MKA parameter set length %d too short", len(rest))
+		}
+		ps := MKAParameterSet{Type: MKAParameterSetType(rest[0]), Header: rest[:4]}
+		if ps.Type == MKAParameterSetICVIndicator {
+			// Only the ICV follows.
+			m.ParameterSets = append(m.ParameterSets, ps)
+			break
+		}
+		n = mkaParameterSetLength(rest)
+		if 4+n > len(rest) {
+			df.SetTruncated()
+			return fmt.Errorf("MKA %v parameter set length %d exceeds MKPDU", ps.Type, n)
+		}
+		ps.Body = rest[4 : 4+n]
+		var err error
+		switch ps.Type {
+		case MKAParameterSetLivePeerList:
+			m.LivePeers, err = decodeMKAPeers(ps.Body)
+		case MKAParameterSetPotentialPeerList:
+			m.PotentialPeers, err = decodeMKAPeers(ps.Body)
+		case MKAParameterSetSAKUse:
+			m.SAKUse, err = decodeMKASAKUse(ps.Header, ps.Body)
+		case MKAParameterSetDistributedSAK:
+			m.DistributedSAK, err = decodeMKADistributedSAK(ps.Header, ps.Body)
+		}
+		if err != nil {
+			return err
+		}
+		m.ParameterSets = append(m.ParameterSets, ps)
+	}
+	m.BaseLayer = BaseLayer{Contents: data}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func repeatByte(b byte, n int) []byte {
+	return bytes.Repeat([]byte{b}, n)
+}
+
+// testMKPDU returns an MKPDU from a key server, with a live peer list, SAK
+// use, distributed SAK, an unknown parameter set needing padding, and an
+// ICV indicator.
+func testMKPDU() []byte {
+	var b []byte
+	// Basic parameter set, with a 4 byte CAK name.
+	b = append(b, 1, 0x10, 0xe0, 32)
+	b = append(b, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x00, 0x01)
+	b = append(b, repeatByte(0xaa, 12)...)
+	b = append(b, 0, 0, 0, 7, 0x00, 0x80, 0xc2, 0x01, 1, 2, 3, 4)
+	// Live peer list.
+	b = append(b, 1, 0, 0, 16)
+	b = append(b, repeatByte(0xbb, 12)...)
+	b = append(b, 0, 0, 0, 5)
+	// SAK use: latest key AN 1, transmitting and receiving, delay protect.
+	b = append(b, 3, 0x70, 0x10, 40)
+	b = append(b, repeatByte(0xaa, 12)...)
+	b = append(b, 0, 0, 0, 1, 0, 0, 0, 2)
+	b = append(b, make([]byte, 20)...)
+	// Distributed SAK with the default cipher suite, AN 1.
+	b = append(b, 4, 0x40, 0, 28, 0, 0, 0, 1)
+	b = append(b, repeatByte(0xcc, 24)...)
+	// An unknown set with a 1 byte body, padded to 4 bytes.
+	b = append(b, 0x7f, 0, 0, 1, 0x99, 0, 0, 0)
+	// ICV indicator and ICV.
+	b = append(b, 0xff, 0, 0, 16)
+	b = append(b, repeatByte(0xdd, 16)...)
+	return b
+}
+
+func TestMKA(t *testing.T) {
+	mkpdu := testMKPDU()
+	eapol := []byte{3, 5, 0, 0}
+	binary.BigEndian.PutUint16(eapol[2:], uint16(len(mkpdu)))
+	data := append([]byte{0x01, 0x80, 0xc2, 0x00, 0x00, 0x03, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x88, 0x8e}, eapol...)
+	data = append(data, mkpdu...)
+	p := gopacket.NewPacket(data, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeEAPOL, LayerTypeMKA}, t)
+	m := p.Layer(LayerTypeMKA).(*MKA)
+
+	if m.Version != 1 || m.KeyServerPriority != 0x10 || !m.KeyServer || !m.MACsecDesired || m.MACsecCapability != MKAMACsecIntegrityConfidentiality {
+		t.Errorf("got basic parameters %+v", m)
+	}
+	if !bytes.Equal(m.SCI.System, net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}) || m.SCI.Port != 1 {
+		t.Errorf("got SCI %v", m.SCI)
+	}
+	if m.MemberID != (MKAMemberID{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa}) || m.MessageNumber != 7 || m.AlgorithmAgility != 0x0080c201 {
+		t.Errorf("got member %v, message number %d, agility %x", m.MemberID, m.MessageNumber, m.AlgorithmAgility)
+	}
+	if !bytes.Equal(m.CAKName, []byte{1, 2, 3, 4}) {
+		t.Errorf("got CAK name %x", m.CAKName)
+	}
+	if len(m.LivePeers) != 1 || m.LivePeers[0].MemberID[0] != 0xbb || m.LivePeers[0].MessageNumber != 5 || m.PotentialPeers != nil {
+		t.Errorf("got live peers %v, potential peers %v", m.LivePeers, m.PotentialPeers)
+	}
+	if u := m.SAKUse; u == nil {
+		t.Error("no SAK use")
+	} else if u.LatestKeyAN != 1 || !u.LatestKeyTx || !u.LatestKeyRx || u.OldKeyTx || !u.DelayProtect || !u.HasKeys ||
+		u.LatestKey.KeyServerMemberID != m.MemberID || u.LatestKey.KeyNumber != 1 || u.LatestKey.LowestAcceptablePN != 2 {
+		t.Errorf("got SAK use %+v", u)
+	}
+	if d := m.DistributedSAK; d == nil {
+		t.Error("no distributed SAK")
+	} else if d.AssociationNumber != 1 || d.KeyNumber != 1 || d.CipherSuite != 0 || !bytes.Equal(d.WrappedKey, repeatByte(0xcc, 24)) {
+		t.Errorf("got distributed SAK %+v", d)
+	}
+	wantSets := []MKAParameterSetType{MKAParameterSetLivePeerList, MKAParameterSetSAKUse, MKAParameterSetDistributedSAK, 0x7f, MKAParameterSetICVIndicator}
+	if len(m.ParameterSets) != len(wantSets) {
+		t.Fatalf("got %d parameter sets, want %d", len(m.ParameterSets), len(wantSets))
+	}
+	for i, ps := range m.ParameterSets {
+		if ps.Type != wantSets[i] {
+			t.Errorf("parameter set %d is %v, want %v", i, ps.Type, wantSets[i])
+		}
+	}
+	if unknown := m.ParameterSets[3]; !bytes.Equal(unknown.Body, []byte{0x99}) {
+		t.Errorf("got unknown set body %x", unknown.Body)
+	}
+	if !bytes.Equal(m.ICV, repeatByte(0xdd, 16)) {
+		t.Errorf("got ICV %x", m.ICV)
+	}
+}
+
+func TestMKAPadded(t *testing.T) {
+	// A minimal MKPDU in a padded Ethernet frame, without an ICV indicator.
+	mkpdu := append([]byte{1, 0, 0x00, 28}, make([]byte, 28)...)
+	mkpdu = append(mkpdu, repeatByte(0xdd, 16)...)
+	data := append([]byte{3, 5, 0, byte(len(mkpdu))}, mkpdu...)
+	data = append(data, make([]byte, 10)...)
+	p := gopacket.NewPacket(data, LayerTypeEAPOL, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	m := p.Layer(LayerTypeMKA).(*MKA)
+	if len(m.CAKName) != 0 || len(m.ParameterSets) != 0 || !bytes.Equal(m.ICV, repeatByte(0xdd, 16)) {
+		t.Errorf("got %+v", m)
+	}
+}
+
+func TestMKATruncated(t *testing.T) {
+	mkpdu := testMKPDU()
+	// Cut into the distributed SAK.
+	mkpdu = append(mkpdu[:36+20+44+10], repeatByte(0xdd, 16)...)
+	p := gopacket.NewPacket(mkpdu, LayerTypeMKA, gopacket.Default)
+	if p.ErrorLayer() == nil || !p.Metadata().Truncated {
+		t.Error("want truncated decode error")
+	}
+	p = gopacket.NewPacket(mkpdu[:40], LayerTypeMKA, gopacket.Default)
+	if p.ErrorLayer() == nil || !p.Metadata().Truncated {
+		t.Error("want truncated decode error")
+	}
+}
@@ -0,0 +1,401 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// MLDv1 is a multicast listener discovery version 1 message, from RFC 2710,
+// following its ICMPv6 header: a query, a report or a done message.  The
+// ICMPv6 type says which.
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|     Maximum Response Delay    |          Reserved             |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                                                               |
+//	+                                                               +
+//	|                       Multicast Address                       |
+//	+                                                               +
+//	|                                                               |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type MLDv1 struct {
+	BaseLayer
+	// MaximumResponseDelay is meaningful only in queries.
+	MaximumResponseDelay time.Duration
+	// MulticastAddress is unspecified in general queries.
+	MulticastAddress net.IP
+}
+
+// MLDv2RecordType is the type of an MLDv2 multicast address record.
+type MLDv2RecordType uint8
+
+const (
+	MLDv2ModeIsInclude   MLDv2RecordType = 1
+	MLDv2ModeIsExclude   MLDv2RecordType = 2
+	MLDv2ChangeToInclude MLDv2RecordType = 3
+	MLDv2ChangeToExclude MLDv2RecordType = 4
+	MLDv2AllowNewSources MLDv2RecordType = 5
+	MLDv2BlockOldSources MLDv2RecordType = 6
+)
+
+func (t MLDv2RecordType) String() string {
+	switch t {
+	case MLDv2ModeIsInclude:
+		return "MODE_IS_INCLUDE"
+	case MLDv2ModeIsExclude:
+		return "MODE_IS_EXCLUDE"
+	case MLDv2ChangeToInclude:
+		return "CHANGE_TO_INCLUDE_MODE"
+	case MLDv2ChangeToExclude:
+		return "CHANGE_TO_EXCLUDE_MODE"
+	case MLDv2AllowNewSources:
+		return "ALLOW_NEW_SOURCES"
+	case MLDv2BlockOldSources:
+		return "BLOCK_OLD_SOURCES"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(t))
+}
+
+// MLDv2Query is a multicast listener query, version 2, from RFC 3810,
+// following its ICMPv6 header.
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|    Maximum Response Code      |           Reserved            |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                                                               |
+//	*                       Multicast Address                       *
+//	|                                                               |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	| Resv  |S| QRV |     QQIC      |     Number of Sources (N)     |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                                                               |
+//	*                       Source Addresses                        *
+//	|                                                               |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type MLDv2Query struct {
+	BaseLayer
+	// MaximumResponseDelay is decoded from the maximum response code,
+	// which encodes delays of 32768ms or more with a 12 bit mantissa, so
+	// longer delays are rounded down when serialized.
+	MaximumResponseDelay time.Duration
+	// MulticastAddress is unspecified in general queries.
+	MulticastAddress         net.IP
+	SuppressRouterProcessing bool
+	RobustnessValue          uint8
+	// QueryInterval is decoded from the querier's query interval code,
+	// which encodes intervals of 128s or more with a 4 bit mantissa, so
+	// longer intervals are rounded down when serialized.
+	QueryInterval   time.Duration
+	NumberOfSources uint16
+	SourceAddresses []net.IP
+}
+
+// MLDv2MulticastAddressRecord is a record of an MLDv2Report.
+type MLDv2MulticastAddressRecord struct {
+	Type MLDv2RecordType
+	// AuxDataLen is the length of AuxData in 32 bit words.
+	AuxDataLen       uint8
+	NumberOfSources  uint16
+	MulticastAddress net.IP
+	SourceAddresses  []net.IP
+	AuxData          []byte
+}
+
+// MLDv2Report is a multicast listener report, version 2, from RFC 3810,
+// following its ICMPv6 header.
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|           Reserved            |Nr of Mcast Address Records (M)|
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                                                               |
+//	.                  Multicast Address Records                    .
+//	|                                                               |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+type MLDv2Report struct {
+	BaseLayer
+	NumberOfRecords uint16
+	Records         []MLDv2MulticastAddressRecord
+}
+
+// mldv2DelayDecode decodes a maximum response code, from RFC 3810 section
+// 5.1.3.
+func mldv2DelayDecode(code uint16) time.Duration {
+	if code < 0x8000 {
+		return time.Duration(code) * time.Millisecond
+	}
+	mant := uint64(code & 0xfff)
+	exp := uint(code>>12) & 0x7
+	return time.Duration((mant|0x1000)<<(exp+3)) * time.Millisecond
+}
+
+// mldv2DelayEncode encodes d as a maximum response code, rounding down.
+func mldv2DelayEncode(d time.Duration) uint16 {
+	ms := uint64(d / time.Millisecond)
+	if ms < 0x8000 {
+		return uint16(ms)
+	}
+	for exp := uint(0); exp < 8; exp++ {
+		if v := ms >> (exp + 3); v <= 0x1fff {
+			return 0x8000 | uint16(exp)<<12 | uint16(v&0xfff)
+		}
+	}
+	return 0xffff
+}
+
+// mldv2IntervalDecode decodes a querier's query interval code, from RFC
+// 3810 section 5.1.9.
+func mldv2IntervalDecode(code uint8) time.Duration {
+	if code < 0x80 {
+		return time.Duration(code) * time.Second
+	}
+	mant := uint64(code & 0xf)
+	exp := uint(code>>4) & 0x7
+	return time.Duration((mant|0x10)<<(exp+3)) * time.Second
+}
+
+// mldv2IntervalEncode encodes d as a querier's query interval code,
+// rounding down.
+func mldv2IntervalEncode(d time.Duration) uint8 {
+	s := uint64(d / time.Second)
+	if s < 0x80 {
+		return uint8(s)
+	}
+	for exp := uint(0); exp < 8; exp++ {
+		if v := s >> (exp + 3); v <= 0x1f {
+			return 0x80 | uint8(exp)<<4 | uint8(v&0xf)
+		}
+	}
+	return 0xff
+}
+
+// LayerType returns LayerTypeMLDv1.
+func (m *MLDv1) LayerType() gopacket.LayerType { return LayerTypeMLDv1 }
+
+// LayerType returns LayerTypeMLDv2Query.
+func (m *MLDv2Query) LayerType() gopacket.LayerType { return LayerTypeMLDv2Query }
+
+// LayerType returns LayerTypeMLDv2Report.
+func (m *MLDv2Report) LayerType() gopacket.LayerType { return LayerTypeMLDv2Report }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (m *MLDv1) CanDecode() gopacket.LayerClass { return LayerTypeMLDv1 }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (m *MLDv2Query) CanDecode() gopacket.LayerClass { return LayerTypeMLDv2Query }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (m *MLDv2Report) CanDecode() gopacket.LayerClass { return LayerTypeMLDv2Report }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (m *MLDv1) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (m *MLDv2Query) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (m *MLDv2Report) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (m *MLDv1) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 20 {
+		df.SetTruncated()
+		return fmt.Errorf("MLDv1 message %d bytes, need 20", len(data))
+	}
+	m.MaximumResponseDelay = time.Duration(binary.BigEndian.Uint16(data[0:2])) * time.Millisecond
+	m.MulticastAddress = net.IP(data[4:20])
+	m.BaseLayer = BaseLayer{Contents: data[:20], Payload: data[20:]}
+	return nil
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (m *MLDv2Query) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 24 {
+		df.SetTruncated()
+		return fmt.Errorf("MLDv2 query %d bytes, need 24", len(data))
+	}
+	m.MaximumResponseDelay = mldv2DelayDecode(binary.BigEndian.Uint16(data[0:2]))
+	m.MulticastAddress = net.IP(data[4:20])
+	m.SuppressRouterProcessing = data[20]&0x8 != 0
+	m.RobustnessValue = data[20] & 0x7
+	m.QueryInterval = mldv2IntervalDecode(data[21])
+	m.NumberOfSources = binary.BigEndian.Uint16(data[22:24])
+	end := 24 + 16*int(m.NumberOfSources)
+	if len(data) < end {
+		df.SetTruncated()
+		return fmt.Errorf("MLDv2 query with %d sources %d bytes, need %d", m.NumberOfSources, len(data), end)
+	}
+	m.SourceAddresses = m.SourceAddresses[:0]
+	for i := 24; i < end; i += 16 {
+		m.SourceAddresses = append(m.SourceAddresses, net.IP(data[i:i+16]))
+	}
+	m.BaseLayer = BaseLayer{Contents: data[:end], Payload: data[end:]}
+	return nil
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (m *MLDv2Report) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return fmt.Errorf("MLDv2 report %d bytes, need 4", len(data))
+	}
+	m.NumberOfRecords = binary.BigEndian.Uint16(data[2:4])
+	m.Records = m.Records[:0]
+	offset := 4
+	for i := 0; i < int(m.NumberOfRecords); i++ {
+		if len(data) < offset+20 {
+			df.SetTruncated()
+			return fmt.Errorf("MLDv2 report record %d truncated", i)
+		}
+		r := MLDv2MulticastAddressRecord{
+			Type:             MLDv2RecordType(data[offset]),
+			AuxDataLen:       data[offset+1],
+			NumberOfSources:  binary.BigEndian.Uint16(data[offset+2 : offset+4]),
+			MulticastAddress: net.IP(data[offset+4 : offset+20]),
+		}
+		offset += 20
+		end := offset + 16*int(r.NumberOfSources) + 4*int(r.AuxDataLen)
+		if len(data) < end {
+			df.SetTruncated()
+			return fmt.Errorf("MLDv2 report record %d with %d sources truncated", i, r.NumberOfSources)
+		}
+		for j := 0; j < int(r.NumberOfSources); j++ {
+			r.SourceAddresses = append(r.SourceAddresses, net.IP(data[offset:offset+16]))
+			offset += 16
+		}
+		if r.AuxDataLen > 0 {
+			r.AuxData = data[offset:end]
+		}
+		offset = end
+		m.Records = append(m.Records, r)
+	}
+	m.BaseLayer = BaseLayer{Contents: data[:offset], Payload: data[offset:]}
+	return nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+func (m *MLDv1) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	bytes, err := b.PrependBytes(20)
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint16(bytes[0:2], uint16(m.MaximumResponseDelay/time.Millisecond))
+	bytes[2], bytes[3] = 0, 0
+	return putMLDAddress(bytes[4:20], m.MulticastAddress)
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+func (m *MLDv2Query) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	if opts.FixLengths {
+		m.NumberOfSources = uint16(len(m.SourceAddresses))
+	}
+	bytes, err := b.PrependBytes(24 + 16*len(m.SourceAddresses))
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint16(bytes[0:2], mldv2DelayEncode(m.MaximumResponseDelay))
+	bytes[2], bytes[3] = 0, 0
+	if err := putMLDAddress(bytes[4:20], m.MulticastAddress); err != nil {
+		return err
+	}
+	bytes[20] = m.RobustnessValue & 0x7
+	if m.SuppressRouterProcessing {
+		bytes[20] |= 0x8
+	}
+	bytes[21] = mldv2IntervalEncode(m.QueryInterval)
+	binary.BigEndian.PutUint16(bytes[22:24], m.NumberOfSources)
+	for i, s := range m.SourceAddresses {
+		if err := putMLDAddress(bytes[24+16*i:40+16*i], s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+func (m *MLDv2Report) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	length := 4
+	for i := range m.Records {
+		r := &m.Records[i]
+		if opts.FixLengths {
+			r.NumberOfSources = uint16(len(r.SourceAddresses))
+			r.AuxDataLen = uint8((len(r.AuxData) + 3) / 4)
+		}
+		length += 20 + 16*len(r.SourceAddresses) + 4*int(r.AuxDataLen)
+	}
+	if opts.FixLengths {
+		m.NumberOfRecords = uint16(len(m.Records))
+	}
+	bytes, err := b.PrependBytes(length)
+	if err != nil {
+		return err
+	}
+	bytes[0], bytes[1] = 0, 0
+	binary.BigEndian.PutUint16(bytes[2:4], m.NumberOfRecords)
+	offset := 4
+	for _, r := range m.Records {
+		bytes[offset] = uint8(r.Type)
+		bytes[offset+1] = r.AuxDataLen
+		binary.BigEndian.PutUint16(bytes[offset+2:offset+4], r.NumberOfSources)
+		if err := putMLDAddress(bytes[offset+4:offset+20], r.MulticastAddress); err != nil {
+			return err
+		}
+		offset += 20
+		for _, s := range r.SourceAddresses {
+			if err := putMLDAddress(bytes[offset:offset+16], s); err != nil {
+				return err
+			}
+			offset += 16
+		}
+		aux := bytes[offset : offset+4*int(r.AuxDataLen)]
+		copy(aux, r.AuxData)
+		for i := len(r.AuxData); i < len(aux); i++ {
+			aux[i] = 0
+		}
+		offset += len(aux)
+	}
+	return nil
+}
+
+// putMLDAddress writes ip to b, writing zeros for a nil ip, which is the
+// unspecified address of general queries.
+func putMLDAddress(b []byte, ip net.IP) error {
+	if ip == nil {
+		copy(b, net.IPv6unspecified)
+		return nil
+	}
+	return putIPv6Address(b, ip)
+}
+
+func decodeMLDv1(data []byte, p gopacket.PacketBuilder) error {
+	m := &MLDv1{}
+	return decodingLayerDecoder(m, data, p)
+}
+
+func decodeMLDv2Query(data []byte, p gopacket.PacketBuilder) error {
+	m := &MLDv2Query{}
+	return decodingLayerDecoder(m, data, p)
+}
+
+func decodeMLDv2Report(data []byte, p gopacket.PacketBuilder) error {
+	m := &MLDv2Report{}
+	return decodingLayerDecoder(m, data, p)
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testMLDv2Report is the ICMPv6 part of an MLDv2 report changing to
+// exclude mode for ff02::fb, and including source 2001:db8::1 for
+// ff05::1:3.
+var testMLDv2Report = []byte{
+	0x8f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+	0x04, 0x00, 0x00, 0x00, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xfb,
+	0x01, 0x00, 0x00, 0x01, 0xff, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x03,
+	0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+}
+
+// testMLDv2Query is the ICMPv6 part of a general MLDv2 query, with a
+// maximum response delay of 10s, robustness 2 and query interval 125s.
+var testMLDv2Query = []byte{
+	0x82, 0x00, 0x00, 0x00, 0x27, 0x10, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x02, 0x7d, 0x00, 0x00,
+}
+
+// testMLDv1Report is the ICMPv6 part of an MLDv1 report for
+// ff02::1:ff00:1.
+var testMLDv1Report = []byte{
+	0x83, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0xff, 0x00, 0x00, 0x01,
+}
+
+// testMLDSerialization checks that p's layers serialize back to data.
+// Checksums aren't computed, since there's no network layer.
+func testMLDSerialization(t *testing.T, p gopacket.Packet, data []byte) {
+	var slayers []gopacket.SerializableLayer
+	for _, l := range p.Layers() {
+		slayers = append(slayers, l.(gopacket.SerializableLayer))
+	}
+	for _, opts := range []gopacket.SerializeOptions{{}, {FixLengths: true}} {
+		buf := gopacket.NewSerializeBuffer()
+		if err := gopacket.SerializeLayers(buf, opts, slayers...); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("serialized %x, want %x", buf.Bytes(), data)
+		}
+	}
+}
+
+func TestMLDv2Report(t *testing.T) {
+	p := gopacket.NewPacket(testMLDv2Report, LayerTypeICMPv6, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeICMPv6, LayerTypeMLDv2Report}, t)
+	got := p.Layer(LayerTypeMLDv2Report).(*MLDv2Report)
+	want := []MLDv2MulticastAddressRecord{
+		{Type: MLDv2ChangeToExclude, MulticastAddress: net.ParseIP("ff02::fb")},
+		{
+			Type:             MLDv2ModeIsInclude,
+			NumberOfSources:  1,
+			MulticastAddress: net.ParseIP("ff05::1:3"),
+			SourceAddresses:  []net.IP{net.ParseIP("2001:db8::1")},
+		},
+	}
+	if got.NumberOfRecords != 2 || !reflect.DeepEqual(got.Records, want) {
+		t.Errorf("got records %+v, want %+v", got.Records, want)
+	}
+	testMLDSerialization(t, p, testMLDv2Report)
+}
+
+func TestMLDv2Query(t *testing.T) {
+	p := gopacket.NewPacket(testMLDv2Query, LayerTypeICMPv6, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeICMPv6, LayerTypeMLDv2Query}, t)
+	got := p.Layer(LayerTypeMLDv2Query).(*MLDv2Query)
+	if got.MaximumResponseDelay != 10*time.Second || got.RobustnessValue != 2 || got.QueryInterval != 125*time.Second ||
+		got.SuppressRouterProcessing || !got.MulticastAddress.Equal(net.IPv6unspecified) || len(got.SourceAddresses) != 0 {
+		t.Errorf("got query %+v", got)
+	}
+	testMLDSerialization(t, p, testMLDv2Query)
+}
+
+func TestMLDv1(t *testing.T) {
+	p := gopacket.NewPacket(testMLDv1Report, LayerTypeICMPv6, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeICMPv6, LayerTypeMLDv1}, t)
+	if got := p.Layer(LayerTypeICMPv6).(*ICMPv6); got.TypeCode.String() != "MulticastListenerReport" {
+		t.Errorf("got type %v", got.TypeCode)
+	}
+	if got := p.Layer(LayerTypeMLDv1).(*MLDv1); !got.MulticastAddress.Equal(net.ParseIP("ff02::1:ff00:1")) {
+		t.Errorf("got %+v", got)
+	}
+	testMLDSerialization(t, p, testMLDv1Report)
+
+	// An MLDv1 query is shorter than an MLDv2 one.
+	query := append([]byte{0x82}, testMLDv1Report[1:]...)
+	p = gopacket.NewPacket(query, LayerTypeICMPv6, gopacket.Default)
+	checkLayers(p, []gopacket.LayerType{LayerTypeICMPv6, LayerTypeMLDv1}, t)
+}
+
+func TestMLDv2Codes(t *testing.T) {
+	for _, code := range []uint16{0, 1000, 0x7fff, 0x8000, 0x8123, 0xffff} {
+		if got := mldv2DelayEncode(mldv2DelayDecode(code)); got != code {
+			t.Errorf("maximum response code %#x round trips to %#x", code, got)
+		}
+	}
+	if got := mldv2DelayDecode(0x8000); got != 32768*time.Millisecond {
+		t.Errorf("got delay %v", got)
+	}
+	for code := 0; code < 256; code++ {
+		if got := mldv2IntervalEncode(mldv2IntervalDecode(uint8(code))); got != uint8(code) {
+			t.Errorf("query interval code %#x round trips to %#x", code, got)
+		}
+	}
+	if got := mldv2IntervalDecode(0x80); got != 128*time.Second {
+		t.Errorf("got interval %v", got)
+	}
+}
@@ -9,42 +9,132 @@ package layers
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 
 	"github.com/mistsys/gopacket"
 )
 
-// MPLS is the MPLS packet header.
+// MPLSLabel is one entry of an MPLS label stack.
+type MPLSLabel struct {
+	Label        uint32
+	TrafficClass uint8
+	StackBottom  bool
+	TTL          uint8
+}
+
+// MPLS is an MPLS label stack.  Decoding produces a single MPLS layer
+// holding every entry of the stack.
 type MPLS struct {
 	BaseLayer
+	// Label, TrafficClass, StackBottom and TTL are the top entry of the
+	// stack.
 	Label        uint32
 	TrafficClass uint8
 	StackBottom  bool
 	TTL          uint8
+	// Stack is the whole label stack, top entry first, when decoded.  When
+	// serializing, Stack is written if it's set, and otherwise the top
+	// entry fields are written as a single entry.
+	Stack []MPLSLabel
 }
 
 // LayerType returns gopacket.LayerTypeMPLS.
 func (m *MPLS) LayerType() gopacket.LayerType { return LayerTypeMPLS }
 
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (m *MPLS) CanDecode() gopacket.LayerClass { return LayerTypeMPLS }
+
+// NextLayerType guesses the type of the payload, as ProtocolGuessingDecoder
+// does.
+func (m *MPLS) NextLayerType() gopacket.LayerType { return guessMPLSPayload(m.Payload) }
+
+// DecodeFromBytes decodes the label stack at the start of data.
+func (m *MPLS) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	m.Stack = m.Stack[:0]
+	offset := 0
+	for {
+		if len(data) < offset+4 {
+			df.SetTruncated()
+			return fmt.Errorf("MPLS label stack truncated after %d entries", len(m.Stack))
+		}
+		decoded := binary.BigEndian.Uint32(data[offset : offset+4])
+		l := MPLSLabel{
+			Label:        decoded >> 12,
+			TrafficClass: uint8(decoded>>9) & 0x7,
+			StackBottom:  decoded&0x100 != 0,
+			TTL:          uint8(decoded),
+		}
+		m.Stack = append(m.Stack, l)
+		offset += 4
+		if l.StackBottom {
+			break
+		}
+	}
+	top := m.Stack[0]
+	m.Label, m.TrafficClass, m.StackBottom, m.TTL = top.Label, top.TrafficClass, top.StackBottom, top.TTL
+	m.BaseLayer = BaseLayer{data[:offset], data[offset:]}
+	return nil
+}
+
 // ProtocolGuessingDecoder attempts to guess the protocol of the bytes it's
 // given, then decode the packet accordingly.  Its algorithm for guessing is:
 //  If the packet starts with byte 0x45-0x4F: IPv4
 //  If the packet starts with byte 0x60-0x6F: IPv6
+//  If the packet starts with nibble 0x0: pseudowire control word, then
+//    Ethernet, or Ethernet if MPLSControlWord is false
+//  If the packet starts with nibble 0x1: pseudowire associated channel, or
+//    Ethernet if MPLSControlWord is false
 //  Otherwise:  Error
-// See draft-hsmit-isis-aal5mux-00.txt for more detail on this approach.
+// See draft-hsmit-isis-aal5mux-00.txt and RFC 4385 for more detail on this
+// approach.
 type ProtocolGuessingDecoder struct{}
 
 func (ProtocolGuessingDecoder) Decode(data []byte, p gopacket.PacketBuilder) error {
-	switch data[0] {
-	// 0x40 | header_len, where header_len is at least 5.
-	case 0x45, 0x46, 0x47, 0x48, 0x49, 0x4a, 0x4b, 0x4c, 0x4d, 0x4e, 0x4f:
+	switch guessMPLSPayload(data) {
+	case LayerTypeIPv4:
 		return decodeIPv4(data, p)
-		// IPv6 can start with any byte whose first 4 bits are 0x6.
-	case 0x60, 0x61, 0x62, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6a, 0x6b, 0x6c, 0x6d, 0x6e, 0x6f:
+	case LayerTypeIPv6:
 		return decodeIPv6(data, p)
+	case LayerTypePWControlWord:
+		return decodePWControlWord(data, p)
+	case LayerTypeEthernet:
+		return decodeEthernet(data, p)
+	case gopacket.LayerTypePayload:
+		return p.NextDecoder(gopacket.LayerTypePayload)
 	}
 	return errors.New("Unable to guess protocol of packet data")
 }
 
+// guessMPLSPayload implements ProtocolGuessingDecoder's guesses, returning
+// LayerTypeZero if it can't guess.
+func guessMPLSPayload(data []byte) gopacket.LayerType {
+	if len(data) == 0 {
+		return gopacket.LayerTypeZero
+	}
+	switch data[0] >> 4 {
+	case 4:
+		// 0x40 | header_len, where header_len is at least 5.
+		if data[0]&0xf >= 5 {
+			return LayerTypeIPv4
+		}
+	case 6:
+		return LayerTypeIPv6
+	case 0:
+		if !MPLSControlWord {
+			return LayerTypeEthernet
+		}
+		return LayerTypePWControlWord
+	case 1:
+		if !MPLSControlWord {
+			return LayerTypeEthernet
+		}
+		// The associated channel header of RFC 4385 carries OAM, which we
+		// don't decode.
+		return gopacket.LayerTypePayload
+	}
+	return gopacket.LayerTypeZero
+}
+
 // MPLSPayloadDecoder is the decoder used to data encapsulated by each MPLS
 // layer.  MPLS contains no type information, so we have to explicitly decide
 // which decoder to use.  This is initially set to ProtocolGuessingDecoder, our
@@ -53,36 +143,104 @@ func (ProtocolGuessingDecoder) Decode(data []byte, p gopacket.PacketBuilder) err
 // encapsulates a specific protocol, you may reset this.
 var MPLSPayloadDecoder gopacket.Decoder = ProtocolGuessingDecoder{}
 
+// MPLSControlWord says whether ProtocolGuessingDecoder takes MPLS payloads
+// starting with nibble 0x0 or 0x1 for the pseudowire control word or
+// associated channel of RFC 4385.  An Ethernet pseudowire without a
+// control word starts with a destination MAC that can begin with either
+// nibble, so by default such payloads are decoded as Ethernet.  Set it if
+// your pseudowires negotiate the control word.
+var MPLSControlWord bool
+
 func decodeMPLS(data []byte, p gopacket.PacketBuilder) error {
-	decoded := binary.BigEndian.Uint32(data[:4])
-	mpls := &MPLS{
-		Label:        decoded >> 12,
-		TrafficClass: uint8(decoded>>9) & 0x7,
-		StackBottom:  decoded&0x100 != 0,
-		TTL:          uint8(decoded),
-		BaseLayer:    BaseLayer{data[:4], data[4:]},
+	mpls := &MPLS{}
+	if err := mpls.DecodeFromBytes(data, p); err != nil {
+		return err
 	}
 	p.AddLayer(mpls)
-	if mpls.StackBottom {
-		return p.NextDecoder(MPLSPayloadDecoder)
-	}
-	return p.NextDecoder(gopacket.DecodeFunc(decodeMPLS))
+	return p.NextDecoder(MPLSPayloadDecoder)
 }
 
 // SerializeTo writes the serialized form of this layer into the
 // SerializationBuffer, implementing gopacket.SerializableLayer.
 // See the docs for gopacket.SerializableLayer for more info.
 func (m *MPLS) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
-	bytes, err := b.PrependBytes(4)
+	stack := m.Stack
+	if len(stack) == 0 {
+		stack = []MPLSLabel{{m.Label, m.TrafficClass, m.StackBottom, m.TTL}}
+	}
+	bytes, err := b.PrependBytes(4 * len(stack))
 	if err != nil {
 		return err
 	}
-	encoded := m.Label << 12
-	encoded |= uint32(m.TrafficClass) << 9
-	encoded |= uint32(m.TTL)
-	if m.StackBottom {
-		encoded |= 0x100
+	for i, l := range stack {
+		if l.Label >= 1<<20 {
+			return fmt.Errorf("MPLS label %d too large", l.Label)
+		}
+		encoded := l.Label << 12
+		encoded |= uint32(l.TrafficClass&0x7) << 9
+		encoded |= uint32(l.TTL)
+		if l.StackBottom {
+			encoded |= 0x100
+		}
+		binary.BigEndian.PutUint32(bytes[4*i:], encoded)
+	}
+	return nil
+}
+
+// PWControlWord is the generic pseudowire control word of RFC 4385, which
+// precedes the payload of pseudowires such as Ethernet over MPLS (RFC 4448)
+// when it's negotiated.  Its first nibble is zero, which is how it's told
+// apart from IP when MPLSControlWord is set.
+type PWControlWord struct {
+	BaseLayer
+	Flags          uint8
+	Fragmentation  uint8
+	Length         uint8
+	SequenceNumber uint16
+}
+
+// LayerType returns LayerTypePWControlWord.
+func (c *PWControlWord) LayerType() gopacket.LayerType { return LayerTypePWControlWord }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (c *PWControlWord) CanDecode() gopacket.LayerClass { return LayerTypePWControlWord }
+
+// NextLayerType returns LayerTypeEthernet, the most common pseudowire
+// payload.
+func (c *PWControlWord) NextLayerType() gopacket.LayerType { return LayerTypeEthernet }
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (c *PWControlWord) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return fmt.Errorf("PW control word too short: %d bytes", len(data))
+	}
+	if data[0]>>4 != 0 {
+		return fmt.Errorf("invalid PW control word, first nibble %d", data[0]>>4)
+	}
+	c.Flags = data[0] & 0xf
+	c.Fragmentation = data[1] >> 6
+	c.Length = data[1] & 0x3f
+	c.SequenceNumber = binary.BigEndian.Uint16(data[2:4])
+	c.BaseLayer = BaseLayer{data[:4], data[4:]}
+	return nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+// See the docs for gopacket.SerializableLayer for more info.
+func (c *PWControlWord) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	bytes, err := b.PrependBytes(4)
+	if err != nil {
+		return err
 	}
-	binary.BigEndian.PutUint32(bytes, encoded)
+	bytes[0] = c.Flags & 0xf
+	bytes[1] = c.Fragmentation<<6 | c.Length&0x3f
+	binary.BigEndian.PutUint16(bytes[2:], c.SequenceNumber)
 	return nil
 }
+
+func decodePWControlWord(data []byte, p gopacket.PacketBuilder) error {
+	c := &PWControlWord{}
+	return decodingLayerDecoder(c, data, p)
+}
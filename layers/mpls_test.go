@@ -0,0 +1,136 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// setMPLSControlWord sets MPLSControlWord for the rest of the test.
+func setMPLSControlWord(t *testing.T, cw bool) {
+	old := MPLSControlWord
+	MPLSControlWord = cw
+	t.Cleanup(func() { MPLSControlWord = old })
+}
+
+func TestMPLSPseudowireControlWord(t *testing.T) {
+	setMPLSControlWord(t, true)
+	inner := &Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		DstMAC:       net.HardwareAddr{0x00, 0x66, 0x77, 0x88, 0x99, 0xaa},
+		EthernetType: EthernetTypeIPv4,
+	}
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &UDP{SrcPort: 1000, DstPort: 2000}
+	udp.SetNetworkLayerForChecksum(ip)
+	outer := &Ethernet{
+		SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		EthernetType: EthernetTypeMPLSUnicast,
+	}
+	mpls := &MPLS{Stack: []MPLSLabel{{Label: 1000, TTL: 64}, {Label: 20, TrafficClass: 5, StackBottom: true, TTL: 255}}}
+	cw := &PWControlWord{SequenceNumber: 42}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, outer, mpls, cw, inner, ip, udp, gopacket.Payload("pw")); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if want := []byte{0x00, 0x3e, 0x80, 0x40, 0x00, 0x01, 0x4b, 0xff, 0x00, 0x00, 0x00, 0x2a}; !bytes.Equal(data[14:26], want) {
+		t.Errorf("got stack and control word %x, want %x", data[14:26], want)
+	}
+	p := gopacket.NewPacket(data, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeMPLS, LayerTypePWControlWord,
+		LayerTypeEthernet, LayerTypeIPv4, LayerTypeUDP, gopacket.LayerTypePayload}, t)
+	if got := p.Layer(LayerTypePWControlWord).(*PWControlWord); got.SequenceNumber != 42 {
+		t.Errorf("got control word %+v", got)
+	}
+	testSerialization(t, p, data)
+
+	// The same stack and control word, decoded with a DecodingLayerParser.
+	var (
+		eth  Ethernet
+		m    MPLS
+		c    PWControlWord
+		ip4  IPv4
+		u    UDP
+		pl   gopacket.Payload
+		dec  []gopacket.LayerType
+		want = []gopacket.LayerType{LayerTypeEthernet, LayerTypeMPLS, LayerTypePWControlWord, LayerTypeEthernet, LayerTypeIPv4, LayerTypeUDP, gopacket.LayerTypePayload}
+	)
+	parser := gopacket.NewDecodingLayerParser(LayerTypeEthernet, &eth, &m, &c, &ip4, &u, &pl)
+	if err := parser.DecodeLayers(data, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if len(dec) != len(want) || len(m.Stack) != 2 || m.Label != 1000 {
+		t.Errorf("got layers %v, stack %+v", dec, m.Stack)
+	}
+}
+
+func TestMPLSPseudowireWithoutControlWord(t *testing.T) {
+	// The inner destination MAC starts with nibble 0, like a control word.
+	outer := &Ethernet{
+		SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		EthernetType: EthernetTypeMPLSUnicast,
+	}
+	mpls := &MPLS{Label: 20, StackBottom: true, TTL: 255}
+	inner := &Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		DstMAC:       net.HardwareAddr{0x00, 0x66, 0x77, 0x88, 0x99, 0xaa},
+		EthernetType: EthernetTypeIPv4,
+	}
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &UDP{SrcPort: 1000, DstPort: 2000}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, outer, mpls, inner, ip, udp, gopacket.Payload("pw")); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeMPLS,
+		LayerTypeEthernet, LayerTypeIPv4, LayerTypeUDP, gopacket.LayerTypePayload}, t)
+}
+
+func TestMPLSPayloadGuess(t *testing.T) {
+	for _, test := range []struct {
+		first byte
+		cw    bool
+		want  gopacket.LayerType
+	}{
+		{0x45, false, LayerTypeIPv4},
+		{0x44, false, gopacket.LayerTypeZero},
+		{0x60, false, LayerTypeIPv6},
+		{0x00, false, LayerTypeEthernet},
+		{0x10, false, LayerTypeEthernet},
+		{0x00, true, LayerTypePWControlWord},
+		{0x10, true, gopacket.LayerTypePayload},
+		{0x45, true, LayerTypeIPv4},
+		{0x80, false, gopacket.LayerTypeZero},
+	} {
+		setMPLSControlWord(t, test.cw)
+		if got := guessMPLSPayload([]byte{test.first}); got != test.want {
+			t.Errorf("first byte %#x, control word %v: got %v, want %v", test.first, test.cw, got, test.want)
+		}
+	}
+
+	var m MPLS
+	if err := m.DecodeFromBytes([]byte{0, 1, 0, 64, 0, 2, 0}, gopacket.NilDecodeFeedback); err == nil {
+		t.Error("expected error decoding stack without bottom of stack")
+	}
+}
@@ -11,6 +11,9 @@ package layers
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
+	"net"
+	"time"
 
 	"github.com/mistsys/gopacket"
 )
@@ -269,6 +272,18 @@ func (d *NTP) LayerType() gopacket.LayerType {
 // This function is employed in layertypes.go to register the NTP layer.
 func decodeNTP(data []byte, p gopacket.PacketBuilder) error {
 
+	// Control (mode 6) and private (mode 7) messages share port 123 and
+	// the mode bits with the other modes, but not the record format, so
+	// they are decoded as layers of their own.
+	if len(data) > 0 {
+		switch NTPMode(data[0] & 0x07) {
+		case NTPModeControl:
+			return decodeNTPControl(data, p)
+		case NTPModePrivate:
+			return decodeNTPPrivate(data, p)
+		}
+	}
+
 	// Attempt to decode the byte slice.
 	d := &NTP{}
 	err := d.DecodeFromBytes(data, p)
@@ -374,6 +389,139 @@ func (d *NTP) Payload() []byte {
 	return nil
 }
 
+//******************************************************************************
+
+// NTP Field Values
+// ----------------
+// The methods below interpret the raw field values of an NTP record: the
+// leap indicator and mode by name, the fixed point and log2 intervals as
+// durations, the timestamps as times, and the reference ID according to
+// the stratum.
+
+const (
+	NTPLeapNone      NTPLeapIndicator = 0 // No warning.
+	NTPLeapAddSecond NTPLeapIndicator = 1 // The last minute of the day has 61 seconds.
+	NTPLeapDelSecond NTPLeapIndicator = 2 // The last minute of the day has 59 seconds.
+	NTPLeapNotInSync NTPLeapIndicator = 3 // The clock is unsynchronized.
+)
+
+func (l NTPLeapIndicator) String() string {
+	switch l {
+	case NTPLeapNone:
+		return "None"
+	case NTPLeapAddSecond:
+		return "AddSecond"
+	case NTPLeapDelSecond:
+		return "DelSecond"
+	case NTPLeapNotInSync:
+		return "NotInSync"
+	default:
+		return fmt.Sprintf("UnknownNTPLeapIndicator(%d)", uint8(l))
+	}
+}
+
+const (
+	NTPModeReserved         NTPMode = 0
+	NTPModeSymmetricActive  NTPMode = 1
+	NTPModeSymmetricPassive NTPMode = 2
+	NTPModeClient           NTPMode = 3
+	NTPModeServer           NTPMode = 4
+	NTPModeBroadcast        NTPMode = 5
+	NTPModeControl          NTPMode = 6 // See NTPControl.
+	NTPModePrivate          NTPMode = 7 // See NTPPrivate.
+)
+
+func (m NTPMode) String() string {
+	switch m {
+	case NTPModeReserved:
+		return "Reserved"
+	case NTPModeSymmetricActive:
+		return "SymmetricActive"
+	case NTPModeSymmetricPassive:
+		return "SymmetricPassive"
+	case NTPModeClient:
+		return "Client"
+	case NTPModeServer:
+		return "Server"
+	case NTPModeBroadcast:
+		return "Broadcast"
+	case NTPModeControl:
+		return "Control"
+	case NTPModePrivate:
+		return "Private"
+	default:
+		return fmt.Sprintf("UnknownNTPMode(%d)", uint8(m))
+	}
+}
+
+// Duration returns 2^l seconds.
+func (l NTPLog2Seconds) Duration() time.Duration {
+	return time.Duration(math.Ldexp(float64(time.Second), int(l)))
+}
+
+// Duration returns s, which is in seconds times 2^16, as a duration.
+func (s NTPFixed16Seconds) Duration() time.Duration {
+	return time.Duration(int64(s) * int64(time.Second) >> 16)
+}
+
+// ntpEpochOffset is the number of seconds from the NTP epoch, 1900-01-01,
+// to the Unix epoch.
+const ntpEpochOffset = 2208988800
+
+// Time returns the time of t, or the zero time if t is zero, which means
+// that the time is unknown.  The 32-bit seconds of t wrap in 2036, so, as
+// RFC 4330 section 3 suggests, timestamps with the top bit clear are taken
+// to be after 2036 rather than before 1968.
+func (t NTPTimestamp) Time() time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	secs := int64(t >> 32)
+	if secs < 0x80000000 {
+		secs += 1 << 32
+	}
+	nsecs := int64((uint64(t&0xffffffff)*uint64(time.Second) + 1<<31) >> 32)
+	return time.Unix(secs-ntpEpochOffset, nsecs).UTC()
+}
+
+// NewNTPTimestamp returns the timestamp of t, or zero for the zero time.
+func NewNTPTimestamp(t time.Time) NTPTimestamp {
+	if t.IsZero() {
+		return 0
+	}
+	secs := uint64(t.Unix()+ntpEpochOffset) & 0xffffffff
+	frac := (uint64(t.Nanosecond())<<32 + uint64(time.Second)/2) / uint64(time.Second)
+	return NTPTimestamp(secs<<32 + frac)
+}
+
+// Reference returns the reference ID of d as a string.  At stratum 0 it's
+// a kiss code, like "RATE" or "DENY", which KissCode also returns, and at
+// stratum 1 it names the reference clock, like "GPS" or "PPS".  At higher
+// strata it's the IPv4 address of the server d synchronizes to, or, if
+// that's an IPv6 server, the first four bytes of the MD5 hash of its
+// address, which print like one.
+func (d *NTP) Reference() string {
+	b := []byte{byte(d.ReferenceID >> 24), byte(d.ReferenceID >> 16), byte(d.ReferenceID >> 8), byte(d.ReferenceID)}
+	if d.Stratum > 1 {
+		return net.IP(b).String()
+	}
+	n := 0
+	for n < len(b) && b[n] != 0 {
+		n++
+	}
+	return string(b[:n])
+}
+
+// KissCode returns the kiss code of a kiss-o'-death message, with which a
+// server tells a client to back off or stop, like "RATE" or "DENY", or ""
+// for other messages.
+func (d *NTP) KissCode() string {
+	if d.Stratum != 0 || d.Mode != NTPModeServer && d.Mode != NTPModeSymmetricPassive {
+		return ""
+	}
+	return d.Reference()
+}
+
 //******************************************************************************
 //*                            End Of NTP File                                 *
 //******************************************************************************
@@ -9,8 +9,11 @@
 package layers
 
 import (
+	"bytes"
+	"net"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/mistsys/gopacket"
 )
@@ -221,3 +224,106 @@ func TestNTPThree(t *testing.T) {
 }
 
 //******************************************************************************
+
+func TestNTPFieldValues(t *testing.T) {
+	d := &NTP{
+		Mode:              NTPModeSymmetricPassive,
+		Stratum:           2,
+		Poll:              10,
+		Precision:         -20,
+		RootDelay:         0x7c3,
+		ReferenceID:       0xc61e5c02,
+		TransmitTimestamp: 0xc50204ebd235d67b,
+	}
+	want := time.Date(2004, 9, 27, 3, 18, 3, 821134000, time.UTC)
+	if got := d.TransmitTimestamp.Time(); !got.Equal(want) {
+		t.Errorf("got transmit time %v, want %v", got, want)
+	}
+	if got := NewNTPTimestamp(want).Time(); !got.Equal(want) {
+		t.Errorf("got %v from timestamp of %v", got, want)
+	}
+	// Timestamps with the top bit clear are in era 1, after 2036.
+	if got, want := NTPTimestamp(0x80000000).Time(), time.Date(2036, 2, 7, 6, 28, 16, 500000000, time.UTC); !got.Equal(want) {
+		t.Errorf("got era 1 time %v, want %v", got, want)
+	}
+	if !d.OriginTimestamp.Time().IsZero() || NewNTPTimestamp(time.Time{}) != 0 {
+		t.Error("zero timestamp isn't the zero time")
+	}
+	if got := d.RootDelay.Duration(); got != 30319213*time.Nanosecond {
+		t.Errorf("got root delay %v", got)
+	}
+	if d.Poll.Duration() != 1024*time.Second || d.Precision.Duration() != 953*time.Nanosecond {
+		t.Errorf("got poll %v and precision %v", d.Poll.Duration(), d.Precision.Duration())
+	}
+	if got := d.Reference(); got != "198.30.92.2" {
+		t.Errorf("got reference %q", got)
+	}
+	if d.KissCode() != "" {
+		t.Errorf("got kiss code %q at stratum 2", d.KissCode())
+	}
+	d.Mode, d.Stratum, d.ReferenceID = NTPModeServer, 0, 0x52415445
+	if d.KissCode() != "RATE" {
+		t.Errorf("got kiss code %q, want RATE", d.KissCode())
+	}
+	d.Stratum, d.ReferenceID = 1, 0x47505300
+	if d.Reference() != "GPS" {
+		t.Errorf("got reference %q, want GPS", d.Reference())
+	}
+}
+
+//******************************************************************************
+
+func testNTPModePacket(t *testing.T, payload []byte) gopacket.Packet {
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &UDP{SrcPort: 40000, DstPort: 123}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	return p
+}
+
+func TestNTPControl(t *testing.T) {
+	// An ntpq readvar response, with its data padded to 32 bits.
+	data := []byte("version=\"ntpd 4.2.8p15\"")
+	payload := []byte{0x16, 0x82, 0x00, 0x01, 0x06, 0x18, 0x00, 0x00, 0x00, 0x00, 0x00, byte(len(data))}
+	payload = append(payload, data...)
+	payload = append(payload, make([]byte, 3-(len(data)+3)%4)...)
+	p := testNTPModePacket(t, payload)
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeNTPControl}, t)
+	c := p.Layer(LayerTypeNTPControl).(*NTPControl)
+	if !c.Response || c.Error || c.More || c.OpCode != NTPControlReadVariables || c.Version != 2 ||
+		c.Sequence != 1 || c.Status != 0x0618 || int(c.Count) != len(data) {
+		t.Errorf("got control message %+v", c)
+	}
+	if !bytes.Equal(c.Data, data) || c.Authenticator != nil {
+		t.Errorf("got data %q and authenticator %x", c.Data, c.Authenticator)
+	}
+
+	if err := (&NTPControl{}).DecodeFromBytes(payload[:20], gopacket.NilDecodeFeedback); err == nil {
+		t.Error("decoded truncated control message without error")
+	}
+}
+
+func TestNTPPrivate(t *testing.T) {
+	// A monlist request, as sent in amplification attacks.
+	payload := make([]byte, 48)
+	copy(payload, []byte{0x17, 0x00, 0x03, 0x2a})
+	p := testNTPModePacket(t, payload)
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeNTPPrivate}, t)
+	m := p.Layer(LayerTypeNTPPrivate).(*NTPPrivate)
+	if m.Response || m.Version != 2 || m.Implementation != 3 || m.RequestCode != NTPPrivateMonGetList1 || !m.Monlist() {
+		t.Errorf("got private message %+v", m)
+	}
+	if p.Layer(LayerTypeNTP) != nil {
+		t.Error("private message decoded as NTP")
+	}
+}
+
+//******************************************************************************
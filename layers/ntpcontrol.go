@@ -0,0 +1,279 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// NTPControlOpCode is the operation of an NTP control message.
+type NTPControlOpCode uint8
+
+// NTP control message operations (RFC 9327 section 2.4).
+const (
+	NTPControlReadStatus      NTPControlOpCode = 1
+	NTPControlReadVariables   NTPControlOpCode = 2
+	NTPControlWriteVariables  NTPControlOpCode = 3
+	NTPControlReadClock       NTPControlOpCode = 4
+	NTPControlWriteClock      NTPControlOpCode = 5
+	NTPControlSetTrap         NTPControlOpCode = 6
+	NTPControlAsyncMessage    NTPControlOpCode = 7
+	NTPControlConfigure       NTPControlOpCode = 8
+	NTPControlSaveConfig      NTPControlOpCode = 9
+	NTPControlReadMRU         NTPControlOpCode = 10
+	NTPControlReadOrderedList NTPControlOpCode = 11
+	NTPControlRequestNonce    NTPControlOpCode = 12
+	NTPControlUnsetTrap       NTPControlOpCode = 31
+)
+
+func (o NTPControlOpCode) String() string {
+	switch o {
+	case NTPControlReadStatus:
+		return "ReadStatus"
+	case NTPControlReadVariables:
+		return "ReadVariables"
+	case NTPControlWriteVariables:
+		return "WriteVariables"
+	case NTPControlReadClock:
+		return "ReadClock"
+	case NTPControlWriteClock:
+		return "WriteClock"
+	case NTPControlSetTrap:
+		return "SetTrap"
+	case NTPControlAsyncMessage:
+		return "AsyncMessage"
+	case NTPControlConfigure:
+		return "Configure"
+	case NTPControlSaveConfig:
+		return "SaveConfig"
+	case NTPControlReadMRU:
+		return "ReadMRU"
+	case NTPControlReadOrderedList:
+		return "ReadOrderedList"
+	case NTPControlRequestNonce:
+		return "RequestNonce"
+	case NTPControlUnsetTrap:
+		return "UnsetTrap"
+	default:
+		return fmt.Sprintf("UnknownNTPControlOpCode(%d)", uint8(o))
+	}
+}
+
+// NTPControl is an NTP control message, mode 6 (RFC 9327), with which
+// tools like ntpq read and write the variables of NTP servers.
+type NTPControl struct {
+	BaseLayer
+	LeapIndicator NTPLeapIndicator
+	Version       NTPVersion
+	// Response, Error and More are the R, E and M bits: the message is a
+	// response, an error response, or a fragment followed by others.
+	Response, Error, More bool
+	OpCode                NTPControlOpCode
+	Sequence              uint16
+	Status                uint16
+	AssociationID         uint16
+	Offset                uint16
+	Count                 uint16
+	// Data holds the Count bytes of data, often variables in the form
+	// "name=value,...".
+	Data []byte
+	// Authenticator holds what follows the data and its padding: a key ID
+	// and message digest, if the message is authenticated.
+	Authenticator []byte
+}
+
+// LayerType returns LayerTypeNTPControl.
+func (c *NTPControl) LayerType() gopacket.LayerType { return LayerTypeNTPControl }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (c *NTPControl) CanDecode() gopacket.LayerClass { return LayerTypeNTPControl }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (c *NTPControl) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// Payload returns nil, since control messages carry no payload.
+func (c *NTPControl) Payload() []byte { return nil }
+
+func decodeNTPControl(data []byte, p gopacket.PacketBuilder) error {
+	c := &NTPControl{}
+	if err := c.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(c)
+	p.SetApplicationLayer(c)
+	return nil
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (c *NTPControl) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 12 {
+		df.SetTruncated()
+		return errors.New("NTP control message too short")
+	}
+	if NTPMode(data[0]&0x07) != NTPModeControl {
+		return fmt.Errorf("NTP mode %v isn't control", NTPMode(data[0]&0x07))
+	}
+	c.LeapIndicator = NTPLeapIndicator(data[0] >> 6)
+	c.Version = NTPVersion(data[0] >> 3 & 0x07)
+	c.Response = data[1]&0x80 != 0
+	c.Error = data[1]&0x40 != 0
+	c.More = data[1]&0x20 != 0
+	c.OpCode = NTPControlOpCode(data[1] & 0x1f)
+	c.Sequence = binary.BigEndian.Uint16(data[2:4])
+	c.Status = binary.BigEndian.Uint16(data[4:6])
+	c.AssociationID = binary.BigEndian.Uint16(data[6:8])
+	c.Offset = binary.BigEndian.Uint16(data[8:10])
+	c.Count = binary.BigEndian.Uint16(data[10:12])
+	end := 12 + int(c.Count)
+	if len(data) < end {
+		df.SetTruncated()
+		return errors.New("NTP control message data truncated")
+	}
+	c.Data = data[12:end]
+	c.Authenticator = nil
+	if padded := (end + 3) &^ 3; len(data) > padded {
+		c.Authenticator = data[padded:]
+	}
+	c.BaseLayer = BaseLayer{Contents: data}
+	return nil
+}
+
+// NTPPrivateRequestCode is the request code of an NTP private message.
+type NTPPrivateRequestCode uint8
+
+// Some of the request codes of ntpd's private messages.
+const (
+	NTPPrivatePeerList    NTPPrivateRequestCode = 0
+	NTPPrivatePeerListSum NTPPrivateRequestCode = 1
+	NTPPrivatePeerInfo    NTPPrivateRequestCode = 2
+	NTPPrivatePeerStats   NTPPrivateRequestCode = 3
+	NTPPrivateSysInfo     NTPPrivateRequestCode = 4
+	NTPPrivateSysStats    NTPPrivateRequestCode = 5
+	NTPPrivateIOStats     NTPPrivateRequestCode = 6
+	NTPPrivateMemStats    NTPPrivateRequestCode = 7
+	NTPPrivateLoopInfo    NTPPrivateRequestCode = 8
+	NTPPrivateTimerStats  NTPPrivateRequestCode = 9
+	NTPPrivateConfig      NTPPrivateRequestCode = 10
+	NTPPrivateUnconfig    NTPPrivateRequestCode = 11
+	NTPPrivateMonGetList  NTPPrivateRequestCode = 20
+	NTPPrivateMonGetList1 NTPPrivateRequestCode = 42
+)
+
+func (r NTPPrivateRequestCode) String() string {
+	switch r {
+	case NTPPrivatePeerList:
+		return "PeerList"
+	case NTPPrivatePeerListSum:
+		return "PeerListSum"
+	case NTPPrivatePeerInfo:
+		return "PeerInfo"
+	case NTPPrivatePeerStats:
+		return "PeerStats"
+	case NTPPrivateSysInfo:
+		return "SysInfo"
+	case NTPPrivateSysStats:
+		return "SysStats"
+	case NTPPrivateIOStats:
+		return "IOStats"
+	case NTPPrivateMemStats:
+		return "MemStats"
+	case NTPPrivateLoopInfo:
+		return "LoopInfo"
+	case NTPPrivateTimerStats:
+		return "TimerStats"
+	case NTPPrivateConfig:
+		return "Config"
+	case NTPPrivateUnconfig:
+		return "Unconfig"
+	case NTPPrivateMonGetList:
+		return "MonGetList"
+	case NTPPrivateMonGetList1:
+		return "MonGetList1"
+	default:
+		return fmt.Sprintf("UnknownNTPPrivateRequestCode(%d)", uint8(r))
+	}
+}
+
+// NTPPrivate is an NTP private message, mode 7, the implementation
+// specific mode with which the ntpdc tool of older ntpd versions queries
+// and configures servers.  Its monlist request, which returns up to 600
+// addresses of recent clients, has been used for reflected amplification
+// attacks (CVE-2013-5211), so servers should not answer it.
+type NTPPrivate struct {
+	BaseLayer
+	// Response and More are the R and M bits: the message is a response,
+	// or a fragment followed by others.
+	Response, More bool
+	Version        NTPVersion
+	// Authenticated is the A bit of requests.
+	Authenticated  bool
+	Sequence       uint8
+	Implementation uint8
+	RequestCode    NTPPrivateRequestCode
+	// Err is the error code of responses, zero if there is none.
+	Err      uint8
+	NumItems uint16
+	ItemSize uint16
+	// Data holds the items of responses, and the data, padding and
+	// authenticator of requests.
+	Data []byte
+}
+
+// LayerType returns LayerTypeNTPPrivate.
+func (m *NTPPrivate) LayerType() gopacket.LayerType { return LayerTypeNTPPrivate }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (m *NTPPrivate) CanDecode() gopacket.LayerClass { return LayerTypeNTPPrivate }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (m *NTPPrivate) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// Payload returns nil, since private messages carry no payload.
+func (m *NTPPrivate) Payload() []byte { return nil }
+
+// Monlist reports whether m is a monlist request or response.
+func (m *NTPPrivate) Monlist() bool {
+	return m.RequestCode == NTPPrivateMonGetList || m.RequestCode == NTPPrivateMonGetList1
+}
+
+func decodeNTPPrivate(data []byte, p gopacket.PacketBuilder) error {
+	m := &NTPPrivate{}
+	if err := m.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(m)
+	p.SetApplicationLayer(m)
+	return nil
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (m *NTPPrivate) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 8 {
+		df.SetTruncated()
+		return errors.New("NTP private message too short")
+	}
+	if NTPMode(data[0]&0x07) != NTPModePrivate {
+		return fmt.Errorf("NTP mode %v isn't private", NTPMode(data[0]&0x07))
+	}
+	m.Response = data[0]&0x80 != 0
+	m.More = data[0]&0x40 != 0
+	m.Version = NTPVersion(data[0] >> 3 & 0x07)
+	m.Authenticated = data[1]&0x80 != 0
+	m.Sequence = data[1] & 0x7f
+	m.Implementation = data[2]
+	m.RequestCode = NTPPrivateRequestCode(data[3])
+	m.Err = data[4] >> 4
+	m.NumItems = binary.BigEndian.Uint16(data[4:6]) & 0x0fff
+	m.ItemSize = binary.BigEndian.Uint16(data[6:8]) & 0x0fff
+	m.Data = data[8:]
+	m.BaseLayer = BaseLayer{Contents: data}
+	return nil
+}
@@ -0,0 +1,742 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/mistsys/gopacket"
+)
+
+// OSPFType is the type of an OSPF packet.
+type OSPFType uint8
+
+const (
+	OSPFTypeHello                   OSPFType = 1
+	OSPFTypeDatabaseDescription     OSPFType = 2
+	OSPFTypeLinkStateRequest        OSPFType = 3
+	OSPFTypeLinkStateUpdate         OSPFType = 4
+	OSPFTypeLinkStateAcknowledgment OSPFType = 5
+)
+
+func (t OSPFType) String() string {
+	switch t {
+	case OSPFTypeHello:
+		return "Hello"
+	case OSPFTypeDatabaseDescription:
+		return "DatabaseDescription"
+	case OSPFTypeLinkStateRequest:
+		return "LinkStateRequest"
+	case OSPFTypeLinkStateUpdate:
+		return "LinkStateUpdate"
+	case OSPFTypeLinkStateAcknowledgment:
+		return "LinkStateAcknowledgment"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(t))
+}
+
+// OSPFLSAType is the type of a link state advertisement.  OSPFv2 types fit
+// in a byte; OSPFv3 types carry flooding scope bits above the function
+// code, and the OSPFv3 constants include them.
+type OSPFLSAType uint16
+
+const (
+	OSPFv2LSARouter       OSPFLSAType = 1
+	OSPFv2LSANetwork      OSPFLSAType = 2
+	OSPFv2LSASummaryIP    OSPFLSAType = 3
+	OSPFv2LSASummaryASBR  OSPFLSAType = 4
+	OSPFv2LSAASExternal   OSPFLSAType = 5
+	OSPFv2LSANSSA         OSPFLSAType = 7
+	OSPFv3LSARouter       OSPFLSAType = 0x2001
+	OSPFv3LSANetwork      OSPFLSAType = 0x2002
+	OSPFv3LSAInterAreaPfx OSPFLSAType = 0x2003
+	OSPFv3LSAInterAreaRtr OSPFLSAType = 0x2004
+	OSPFv3LSAASExternal   OSPFLSAType = 0x4005
+	OSPFv3LSANSSA         OSPFLSAType = 0x2007
+	OSPFv3LSALink         OSPFLSAType = 0x0008
+	OSPFv3LSAIntraAreaPfx OSPFLSAType = 0x2009
+	ospfv3LSAFunctionCode OSPFLSAType = 0x1fff
+)
+
+const (
+	ospfLSAHeaderLength     = 20
+	ospfv3PrefixFixedLength = 4
+)
+
+// OSPF database description flags.
+const (
+	OSPFDBDescMasterSlave = 0x01
+	OSPFDBDescMore        = 0x02
+	OSPFDBDescInit        = 0x04
+)
+
+// OSPF router LSA flags.
+const (
+	OSPFRouterLSAFlagB = 0x01 // area border router
+	OSPFRouterLSAFlagE = 0x02 // AS boundary router
+	OSPFRouterLSAFlagV = 0x04 // virtual link endpoint
+)
+
+// OSPF is the part of an OSPF packet common to both versions: the fixed
+// header fields, and the body decoded according to Type.  Exactly one of
+// the body fields is set.
+type OSPF struct {
+	Version      uint8
+	Type         OSPFType
+	PacketLength uint16
+	RouterID     uint32
+	AreaID       uint32
+	Checksum     uint16
+
+	// Hello is set for hello packets.
+	Hello *OSPFHello
+	// DBDesc is set for database description packets.
+	DBDesc *OSPFDBDesc
+	// LSRequests is set for link state request packets.
+	LSRequests []OSPFLSRequest
+	// LSAs is set for link state update packets.
+	LSAs []OSPFLSA
+	// LSAHeaders is set for link state acknowledgment packets.
+	LSAHeaders []OSPFLSAHeader
+}
+
+// OSPFv2 is an OSPF for IPv4 packet (RFC 2328).  The trailing message
+// digest of a packet using cryptographic authentication is left in
+// Payload.
+type OSPFv2 struct {
+	BaseLayer
+	OSPF
+	AuType         uint16
+	Authentication uint64
+}
+
+// OSPFv3 is an OSPF for IPv6 packet (RFC 5340).
+type OSPFv3 struct {
+	BaseLayer
+	OSPF
+	Instance uint8
+	Reserved uint8
+}
+
+// OSPFHello is the body of a hello packet.  NetworkMask is only set for
+// OSPFv2 and InterfaceID only for OSPFv3.
+type OSPFHello struct {
+	NetworkMask            net.IPMask
+	InterfaceID            uint32
+	HelloInterval          uint16
+	Options                uint32
+	Priority               uint8
+	RouterDeadInterval     uint32
+	DesignatedRouter       uint32
+	BackupDesignatedRouter uint32
+	Neighbors              []uint32
+}
+
+// OSPFDBDesc is the body of a database description packet.
+type OSPFDBDesc struct {
+	InterfaceMTU uint16
+	Options      uint32
+	Flags        uint8
+	SeqNumber    uint32
+	LSAHeaders   []OSPFLSAHeader
+}
+
+// OSPFLSRequest identifies an LSA requested in a link state request packet.
+type OSPFLSRequest struct {
+	Type        OSPFLSAType
+	LinkStateID uint32
+	AdvRouter   uint32
+}
+
+// OSPFLSAHeader is the header of a link state advertisement.  Options is
+// only set for OSPFv2; OSPFv3 carries options in the LSA bodies.
+type OSPFLSAHeader struct {
+	Age         uint16
+	Options     uint8
+	Type        OSPFLSAType
+	LinkStateID uint32
+	AdvRouter   uint32
+	SeqNumber   uint32
+	Checksum    uint16
+	Length      uint16
+}
+
+// OSPFLSA is a link state advertisement.  Content is the body decoded
+// according to the version and type: *OSPFv2RouterLSA, *OSPFv2NetworkLSA,
+// *OSPFv2SummaryLSA or *OSPFv2ASExternalLSA for OSPFv2, and
+// *OSPFv3RouterLSA, *OSPFv3NetworkLSA, *OSPFv3InterAreaPrefixLSA,
+// *OSPFv3InterAreaRouterLSA, *OSPFv3ASExternalLSA, *OSPFv3LinkLSA or
+// *OSPFv3IntraAreaPrefixLSA for OSPFv3.  The body of an unknown type is
+// left as a []byte.
+type OSPFLSA struct {
+	OSPFLSAHeader
+	Content interface{}
+}
+
+// OSPFv2RouterLSA is the body of an OSPFv2 router LSA.
+type OSPFv2RouterLSA struct {
+	Flags uint8
+	Links []OSPFv2RouterLink
+}
+
+// OSPFv2RouterLink is a link described by an OSPFv2 router LSA.  Type is 1
+// for point-to-point, 2 for transit, 3 for stub and 4 for virtual links.
+type OSPFv2RouterLink struct {
+	LinkID   uint32
+	LinkData uint32
+	Type     uint8
+	Metric   uint16
+	TOS      []OSPFv2TOSMetric
+}
+
+// OSPFv2TOSMetric is a type of service specific metric.
+type OSPFv2TOSMetric struct {
+	TOS    uint8
+	Metric uint16
+}
+
+// OSPFv2NetworkLSA is the body of an OSPFv2 network LSA.
+type OSPFv2NetworkLSA struct {
+	NetworkMask     net.IPMask
+	AttachedRouters []uint32
+}
+
+// OSPFv2SummaryLSA is the body of an OSPFv2 summary LSA, of either type 3
+// or 4.  TOS specific metrics are ignored.
+type OSPFv2SummaryLSA struct {
+	NetworkMask net.IPMask
+	Metric      uint32
+}
+
+// OSPFv2ASExternalLSA is the body of an OSPFv2 AS external or NSSA LSA.
+// External is true for type 2 external metrics.  TOS specific metrics are
+// ignored.
+type OSPFv2ASExternalLSA struct {
+	NetworkMask       net.IPMask
+	External          bool
+	Metric            uint32
+	ForwardingAddress net.IP
+	RouteTag          uint32
+}
+
+// OSPFv3RouterLSA is the body of an OSPFv3 router LSA.
+type OSPFv3RouterLSA struct {
+	Flags      uint8
+	Options    uint32
+	Interfaces []OSPFv3RouterInterface
+}
+
+// OSPFv3RouterInterface is an interface described by an OSPFv3 router LSA.
+type OSPFv3RouterInterface struct {
+	Type                uint8
+	Metric              uint16
+	InterfaceID         uint32
+	NeighborInterfaceID uint32
+	NeighborRouterID    uint32
+}
+
+// OSPFv3NetworkLSA is the body of an OSPFv3 network LSA.
+type OSPFv3NetworkLSA struct {
+	Options         uint32
+	AttachedRouters []uint32
+}
+
+// OSPFv3Prefix is an IPv6 prefix carried in an OSPFv3 LSA.  Metric is only
+// set in intra-area prefix LSAs; other LSAs carry a single metric for
+// their prefix.
+type OSPFv3Prefix struct {
+	Length  uint8
+	Options uint8
+	Metric  uint16
+	Address net.IP
+}
+
+// OSPFv3InterAreaPrefixLSA is the body of an OSPFv3 inter-area prefix LSA.
+type OSPFv3InterAreaPrefixLSA struct {
+	Metric uint32
+	Prefix OSPFv3Prefix
+}
+
+// OSPFv3InterAreaRouterLSA is the body of an OSPFv3 inter-area router LSA.
+type OSPFv3InterAreaRouterLSA struct {
+	Options             uint32
+	Metric              uint32
+	DestinationRouterID uint32
+}
+
+// OSPFv3 AS external LSA flags.
+const (
+	OSPFv3ASExternalFlagT = 0x01 // route tag present
+	OSPFv3ASExternalFlagF = 0x02 // forwarding address present
+	OSPFv3ASExternalFlagE = 0x04 // type 2 external metric
+)
+
+// OSPFv3ASExternalLSA is the body of an OSPFv3 AS external or NSSA LSA.
+// ForwardingAddress, RouteTag and ReferencedLinkStateID are only set when
+// present, as indicated by Flags and ReferencedLSType.
+type OSPFv3ASExternalLSA struct {
+	Flags                 uint8
+	Metric                uint32
+	Prefix                OSPFv3Prefix
+	ReferencedLSType      OSPFLSAType
+	ForwardingAddress     net.IP
+	RouteTag              uint32
+	ReferencedLinkStateID uint32
+}
+
+// OSPFv3LinkLSA is the body of an OSPFv3 link LSA.
+type OSPFv3LinkLSA struct {
+	Priority         uint8
+	Options          uint32
+	LinkLocalAddress net.IP
+	Prefixes         []OSPFv3Prefix
+}
+
+// OSPFv3IntraAreaPrefixLSA is the body of an OSPFv3 intra-area prefix LSA.
+type OSPFv3IntraAreaPrefixLSA struct {
+	ReferencedLSType      OSPFLSAType
+	ReferencedLinkStateID uint32
+	ReferencedAdvRouter   uint32
+	Prefixes              []OSPFv3Prefix
+}
+
+// LayerType returns LayerTypeOSPF.
+func (o *OSPFv2) LayerType() gopacket.LayerType { return LayerTypeOSPF }
+func (o *OSPFv3) LayerType() gopacket.LayerType { return LayerTypeOSPF }
+
+func (o *OSPFv2) CanDecode() gopacket.LayerClass { return LayerTypeOSPF }
+func (o *OSPFv3) CanDecode() gopacket.LayerClass { return LayerTypeOSPF }
+
+func (o *OSPFv2) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+func (o *OSPFv3) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (o *OSPFv2) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 24 {
+		df.SetTruncated()
+		return fmt.Errorf("OSPFv2 length %d too short", len(data))
+	}
+	o.AuType = binary.BigEndian.Uint16(data[14:16])
+	o.Authentication = binary.BigEndian.Uint64(data[16:24])
+	body, err := o.OSPF.decodeHeader(data, 2, df)
+	if err != nil {
+		return err
+	}
+	o.BaseLayer = BaseLayer{Contents: data[:o.PacketLength], Payload: data[o.PacketLength:]}
+	return o.OSPF.decodeBody(body[24:])
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (o *OSPFv3) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 16 {
+		df.SetTruncated()
+		return fmt.Errorf("OSPFv3 length %d too short", len(data))
+	}
+	o.Instance = data[14]
+	o.Reserved = data[15]
+	body, err := o.OSPF.decodeHeader(data, 3, df)
+	if err != nil {
+		return err
+	}
+	o.BaseLayer = BaseLayer{Contents: data[:o.PacketLength], Payload: data[o.PacketLength:]}
+	return o.OSPF.decodeBody(body[16:])
+}
+
+// decodeHeader decodes the header fields common to both versions and
+// returns the packet, trimmed to its length.
+func (o *OSPF) decodeHeader(data []byte, version uint8, df gopacket.DecodeFeedback) ([]byte, error) {
+	*o = OSPF{
+		Version:      data[0],
+		Type:         OSPFType(data[1]),
+		PacketLength: binary.BigEndian.Uint16(data[2:4]),
+		RouterID:     binary.BigEndian.Uint32(data[4:8]),
+		AreaID:       binary.BigEndian.Uint32(data[8:12]),
+		Checksum:     binary.BigEndian.Uint16(data[12:14]),
+	}
+	if o.Version != version {
+		return nil, fmt.Errorf("OSPF version %d is not %d", o.Version, version)
+	}
+	switch {
+	case int(o.PacketLength) > len(data):
+		df.SetTruncated()
+		return nil, fmt.Errorf("OSPFv%d packet length %d exceeds %d bytes available", version, o.PacketLength, len(data))
+	case version == 2 && o.PacketLength < 24, version == 3 && o.PacketLength < 16:
+		return nil, fmt.Errorf("OSPFv%d packet length %d too short", version, o.PacketLength)
+	}
+	return data[:o.PacketLength], nil
+}
+
+func (o *OSPF) decodeBody(b []byte) error {
+	var err error
+	switch o.Type {
+	case OSPFTypeHello:
+		o.Hello, err = decodeOSPFHello(b, o.Version)
+	case OSPFTypeDatabaseDescription:
+		o.DBDesc, err = decodeOSPFDBDesc(b, o.Version)
+	case OSPFTypeLinkStateRequest:
+		o.LSRequests, err = decodeOSPFLSRequests(b, o.Version)
+	case OSPFTypeLinkStateUpdate:
+		o.LSAs, err = decodeOSPFLSUpdate(b, o.Version)
+	case OSPFTypeLinkStateAcknowledgment:
+		o.LSAHeaders, err = decodeOSPFLSAHeaders(b, o.Version)
+	default:
+		err = fmt.Errorf("unknown OSPF type %v", o.Type)
+	}
+	return err
+}
+
+func decodeOSPFRouterIDs(b []byte) []uint32 {
+	var ids []uint32
+	for ; len(b) >= 4; b = b[4:] {
+		ids = append(ids, binary.BigEndian.Uint32(b))
+	}
+	return ids
+}
+
+func decodeOSPFHello(b []byte, version uint8) (*OSPFHello, error) {
+	if len(b) < 20 {
+		return nil, fmt.Errorf("OSPF hello length %d too short", len(b))
+	}
+	h := &OSPFHello{
+		DesignatedRouter:       binary.BigEndian.Uint32(b[12:16]),
+		BackupDesignatedRouter: binary.BigEndian.Uint32(b[16:20]),
+		Neighbors:              decodeOSPFRouterIDs(b[20:]),
+	}
+	if version == 2 {
+		h.NetworkMask = net.IPMask(b[0:4])
+		h.HelloInterval = binary.BigEndian.Uint16(b[4:6])
+		h.Options = uint32(b[6])
+		h.Priority = b[7]
+		h.RouterDeadInterval = binary.BigEndian.Uint32(b[8:12])
+	} else {
+		h.InterfaceID = binary.BigEndian.Uint32(b[0:4])
+		h.Priority = b[4]
+		h.Options = binary.BigEndian.Uint32(b[4:8]) & 0xffffff
+		h.HelloInterval = binary.BigEndian.Uint16(b[8:10])
+		h.RouterDeadInterval = uint32(binary.BigEndian.Uint16(b[10:12]))
+	}
+	return h, nil
+}
+
+func decodeOSPFDBDesc(b []byte, version uint8) (*OSPFDBDesc, error) {
+	var d OSPFDBDesc
+	if version == 2 {
+		if len(b) < 8 {
+			return nil, fmt.Errorf("OSPF database description length %d too short", len(b))
+		}
+		d.InterfaceMTU = binary.BigEndian.Uint16(b[0:2])
+		d.Options = uint32(b[2])
+		d.Flags = b[3]
+		d.SeqNumber = binary.BigEndian.Uint32(b[4:8])
+		b = b[8:]
+	} else {
+		if len(b) < 12 {
+			return nil, fmt.Errorf("OSPF database description length %d too short", len(b))
+		}
+		d.Options = binary.BigEndian.Uint32(b[0:4]) & 0xffffff
+		d.InterfaceMTU = binary.BigEndian.Uint16(b[4:6])
+		d.Flags = b[7]
+		d.SeqNumber = binary.BigEndian.Uint32(b[8:12])
+		b = b[12:]
+	}
+	var err error
+	d.LSAHeaders, err = decodeOSPFLSAHeaders(b, version)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func decodeOSPFLSRequests(b []byte, version uint8) ([]OSPFLSRequest, error) {
+	if len(b)%12 != 0 {
+		return nil, fmt.Errorf("OSPF link state request length %d is not a multiple of 12", len(b))
+	}
+	var rs []OSPFLSRequest
+	for ; len(b) > 0; b = b[12:] {
+		r := OSPFLSRequest{
+			Type:        OSPFLSAType(binary.BigEndian.Uint32(b[0:4])),
+			LinkStateID: binary.BigEndian.Uint32(b[4:8]),
+			AdvRouter:   binary.BigEndian.Uint32(b[8:12]),
+		}
+		if version == 3 {
+			r.Type = OSPFLSAType(binary.BigEndian.Uint16(b[2:4]))
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+func decodeOSPFLSAHeader(b []byte, version uint8) OSPFLSAHeader {
+	h := OSPFLSAHeader{
+		Age:         binary.BigEndian.Uint16(b[0:2]),
+		LinkStateID: binary.BigEndian.Uint32(b[4:8]),
+		AdvRouter:   binary.BigEndian.Uint32(b[8:12]),
+		SeqNumber:   binary.BigEndian.Uint32(b[12:16]),
+		Checksum:    binary.BigEndian.Uint16(b[16:18]),
+		Length:      binary.BigEndian.Uint16(b[18:20]),
+	}
+	if version == 2 {
+		h.Options = b[2]
+		h.Type = OSPFLSAType(b[3])
+	} else {
+		h.Type = OSPFLSAType(binary.BigEndian.Uint16(b[2:4]))
+	}
+	return h
+}
+
+func decodeOSPFLSAHeaders(b []byte, version uint8) ([]OSPFLSAHeader, error) {
+	if len(b)%ospfLSAHeaderLength != 0 {
+		return nil, fmt.Errorf("OSPF LSA headers length %d is not a multiple of %d", len(b), ospfLSAHeaderLength)
+	}
+	var hs []OSPFLSAHeader
+	for ; len(b) > 0; b = b[ospfLSAHeaderLength:] {
+		hs = append(hs, decodeOSPFLSAHeader(b, version))
+	}
+	return hs, nil
+}
+
+func decodeOSPFLSUpdate(b []byte, version uint8) ([]OSPFLSA, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("OSPF link state update length %d too short", len(b))
+	}
+	n := binary.BigEndian.Uint32(b[0:4])
+	b = b[4:]
+	var lsas []OSPFLSA
+	for i := uint32(0); i < n; i++ {
+		if len(b) < ospfLSAHeaderLength {
+			return nil, fmt.Errorf("OSPF LSA %d of %d truncated", i+1, n)
+		}
+		lsa := OSPFLSA{OSPFLSAHeader: decodeOSPFLSAHeader(b, version)}
+		if int(lsa.Length) < ospfLSAHeaderLength || int(lsa.Length) > len(b) {
+			return nil, fmt.Errorf("OSPF LSA %d of %d length %d invalid", i+1, n, lsa.Length)
+		}
+		body := b[ospfLSAHeaderLength:lsa.Length]
+		var err error
+		if version == 2 {
+			lsa.Content, err = decodeOSPFv2LSABody(lsa.Type, body)
+		} else {
+			lsa.Content, err = decodeOSPFv3LSABody(lsa.Type, body)
+		}
+		if err != nil {
+			return nil, err
+		}
+		lsas = append(lsas, lsa)
+		b = b[lsa.Length:]
+	}
+	return lsas, nil
+}
+
+func decodeOSPFv2LSABody(t OSPFLSAType, b []byte) (interface{}, error) {
+	switch t {
+	case OSPFv2LSARouter:
+		if len(b) < 4 {
+			return nil, fmt.Errorf("OSPFv2 router LSA length %d too short", len(b))
+		}
+		r := &OSPFv2RouterLSA{Flags: b[0]}
+		n := int(binary.BigEndian.Uint16(b[2:4]))
+		b = b[4:]
+		for i := 0; i < n; i++ {
+			if len(b) < 12 || len(b) < 12+4*int(b[9]) {
+				return nil, fmt.Errorf("OSPFv2 router LSA link %d of %d truncated", i+1, n)
+			}
+			l := OSPFv2RouterLink{
+				LinkID:   binary.BigEndian.Uint32(b[0:4]),
+				LinkData: binary.BigEndian.Uint32(b[4:8]),
+				Type:     b[8],
+				Metric:   binary.BigEndian.Uint16(b[10:12]),
+			}
+			for j := 0; j < int(b[9]); j++ {
+				tos := b[12+4*j:]
+				l.TOS = append(l.TOS, OSPFv2TOSMetric{TOS: tos[0], Metric: binary.BigEndian.Uint16(tos[2:4])})
+			}
+			r.Links = append(r.Links, l)
+			b = b[12+4*int(b[9]):]
+		}
+		return r, nil
+	case OSPFv2LSANetwork:
+		if len(b) < 4 {
+			return nil, fmt.Errorf("OSPFv2 network LSA length %d too short", len(b))
+		}
+		return &OSPFv2NetworkLSA{NetworkMask: net.IPMask(b[0:4]), AttachedRouters: decodeOSPFRouterIDs(b[4:])}, nil
+	case OSPFv2LSASummaryIP, OSPFv2LSASummaryASBR:
+		if len(b) < 8 {
+			return nil, fmt.Errorf("OSPFv2 summary LSA length %d too short", len(b))
+		}
+		return &OSPFv2SummaryLSA{NetworkMask: net.IPMask(b[0:4]), Metric: binary.BigEndian.Uint32(b[4:8]) & 0xffffff}, nil
+	case OSPFv2LSAASExternal, OSPFv2LSANSSA:
+		if len(b) < 16 {
+			return nil, fmt.Errorf("OSPFv2 AS external LSA length %d too short", len(b))
+		}
+		return &OSPFv2ASExternalLSA{
+			NetworkMask:       net.IPMask(b[0:4]),
+			External:          b[4]&0x80 != 0,
+			Metric:            binary.BigEndian.Uint32(b[4:8]) & 0xffffff,
+			ForwardingAddress: net.IP(b[8:12]),
+			RouteTag:          binary.BigEndian.Uint32(b[12:16]),
+		}, nil
+	}
+	return b, nil
+}
+
+// decodeOSPFv3Prefix decodes a prefix and returns it, the 16 bits between
+// its options and address, whose meaning depends on the LSA, and its
+// length.
+func decodeOSPFv3Prefix(b []byte) (OSPFv3Prefix, uint16, int, error) {
+	if len(b) < ospfv3PrefixFixedLength {
+		return OSPFv3Prefix{}, 0, 0, fmt.Errorf("OSPFv3 prefix length %d too short", len(b))
+	}
+	p := OSPFv3Prefix{Length: b[0], Options: b[1]}
+	if p.Length > 128 {
+		return OSPFv3Prefix{}, 0, 0, fmt.Errorf("OSPFv3 prefix length %d invalid", p.Length)
+	}
+	n := ospfv3PrefixFixedLength + (int(p.Length)+31)/32*4
+	if len(b) < n {
+		return OSPFv3Prefix{}, 0, 0, fmt.Errorf("OSPFv3 prefix /%d truncated", p.Length)
+	}
+	p.Address = make(net.IP, net.IPv6len)
+	copy(p.Address, b[ospfv3PrefixFixedLength:n])
+	return p, binary.BigEndian.Uint16(b[2:4]), n, nil
+}
+
+func decodeOSPFv3LSABody(t OSPFLSAType, b []byte) (interface{}, error) {
+	switch t & ospfv3LSAFunctionCode {
+	case OSPFv3LSARouter & ospfv3LSAFunctionCode:
+		if len(b) < 4 || (len(b)-4)%16 != 0 {
+			return nil, fmt.Errorf("OSPFv3 router LSA length %d invalid", len(b))
+		}
+		r := &OSPFv3RouterLSA{Flags: b[0], Options: binary.BigEndian.Uint32(b[0:4]) & 0xffffff}
+		for b = b[4:]; len(b) > 0; b = b[16:] {
+			r.Interfaces = append(r.Interfaces, OSPFv3RouterInterface{
+				Type:                b[0],
+				Metric:              binary.BigEndian.Uint16(b[2:4]),
+				InterfaceID:         binary.BigEndian.Uint32(b[4:8]),
+				NeighborInterfaceID: binary.BigEndian.Uint32(b[8:12]),
+				NeighborRouterID:    binary.BigEndian.Uint32(b[12:16]),
+			})
+		}
+		return r, nil
+	case OSPFv3LSANetwork & ospfv3LSAFunctionCode:
+		if len(b) < 4 {
+			return nil, fmt.Errorf("OSPFv3 network LSA length %d too short", len(b))
+		}
+		return &OSPFv3NetworkLSA{Options: binary.BigEndian.Uint32(b[0:4]) & 0xffffff, AttachedRouters: decodeOSPFRouterIDs(b[4:])}, nil
+	case OSPFv3LSAInterAreaPfx & ospfv3LSAFunctionCode:
+		if len(b) < 4 {
+			return nil, fmt.Errorf("OSPFv3 inter-area prefix LSA length %d too short", len(b))
+		}
+		p, _, _, err := decodeOSPFv3Prefix(b[4:])
+		if err != nil {
+			return nil, err
+		}
+		return &OSPFv3InterAreaPrefixLSA{Metric: binary.BigEndian.Uint32(b[0:4]) & 0xffffff, Prefix: p}, nil
+	case OSPFv3LSAInterAreaRtr & ospfv3LSAFunctionCode:
+		if len(b) < 12 {
+			return nil, fmt.Errorf("OSPFv3 inter-area router LSA length %d too short", len(b))
+		}
+		return &OSPFv3InterAreaRouterLSA{
+			Options:             binary.BigEndian.Uint32(b[0:4]) & 0xffffff,
+			Metric:              binary.BigEndian.Uint32(b[4:8]) & 0xffffff,
+			DestinationRouterID: binary.BigEndian.Uint32(b[8:12]),
+		}, nil
+	case OSPFv3LSAASExternal & ospfv3LSAFunctionCode, OSPFv3LSANSSA & ospfv3LSAFunctionCode:
+		if len(b) < 4 {
+			return nil, fmt.Errorf("OSPFv3 AS external LSA length %d too short", len(b))
+		}
+		e := &OSPFv3ASExternalLSA{Flags: b[0], Metric: binary.BigEndian.Uint32(b[0:4]) & 0xffffff}
+		p, ref, n, err := decodeOSPFv3Prefix(b[4:])
+		if err != nil {
+			return nil, err
+		}
+		e.Prefix, e.ReferencedLSType = p, OSPFLSAType(ref)
+		b = b[4+n:]
+		if e.Flags&OSPFv3ASExternalFlagF != 0 {
+			if len(b) < 16 {
+				return nil, fmt.Errorf("OSPFv3 AS external LSA forwarding address truncated")
+			}
+			e.ForwardingAddress = net.IP(b[0:16])
+			b = b[16:]
+		}
+		if e.Flags&OSPFv3ASExternalFlagT != 0 {
+			if len(b) < 4 {
+				return nil, fmt.Errorf("OSPFv3 AS external LSA route tag truncated")
+			}
+			e.RouteTag = binary.BigEndian.Uint32(b[0:4])
+			b = b[4:]
+		}
+		if e.ReferencedLSType != 0 {
+			if len(b) < 4 {
+				return nil, fmt.Errorf("OSPFv3 AS external LSA referenced link state ID truncated")
+			}
+			e.ReferencedLinkStateID = binary.BigEndian.Uint32(b[0:4])
+		}
+		return e, nil
+	case OSPFv3LSALink & ospfv3LSAFunctionCode:
+		if len(b) < 24 {
+			return nil, fmt.Errorf("OSPFv3 link LSA length %d too short", len(b))
+		}
+		l := &OSPFv3LinkLSA{
+			Priority:         b[0],
+			Options:          binary.BigEndian.Uint32(b[0:4]) & 0xffffff,
+			LinkLocalAddress: net.IP(b[4:20]),
+		}
+		prefixes, err := decodeOSPFv3Prefixes(b[24:], binary.BigEndian.Uint32(b[20:24]), false)
+		if err != nil {
+			return nil, err
+		}
+		l.Prefixes = prefixes
+		return l, nil
+	case OSPFv3LSAIntraAreaPfx & ospfv3LSAFunctionCode:
+		if len(b) < 12 {
+			return nil, fmt.Errorf("OSPFv3 intra-area prefix LSA length %d too short", len(b))
+		}
+		l := &OSPFv3IntraAreaPrefixLSA{
+			ReferencedLSType:      OSPFLSAType(binary.BigEndian.Uint16(b[2:4])),
+			ReferencedLinkStateID: binary.BigEndian.Uint32(b[4:8]),
+			ReferencedAdvRouter:   binary.BigEndian.Uint32(b[8:12]),
+		}
+		prefixes, err := decodeOSPFv3Prefixes(b[12:], uint32(binary.BigEndian.Uint16(b[0:2])), true)
+		if err != nil {
+			return nil, err
+		}
+		l.Prefixes = prefixes
+		return l, nil
+	}
+	return b, nil
+}
+
+// decodeOSPFv3Prefixes decodes n consecutive prefixes, which carry a
+// metric if withMetric is set.
+func decodeOSPFv3Prefixes(b []byte, n uint32, withMetric bool) ([]OSPFv3Prefix, error) {
+	var ps []OSPFv3Prefix
+	for i := uint32(0); i < n; i++ {
+		p, metric, l, err := decodeOSPFv3Prefix(b)
+		if err != nil {
+			return nil, err
+		}
+		if withMetric {
+			p.Metric = metric
+		}
+		ps = append(ps, p)
+		b = b[l:]
+	}
+	return ps, nil
+}
+
+func decodeOSPF(data []byte, p gopacket.PacketBuilder) error {
+	if len(data) < 1 {
+		return fmt.Errorf("OSPF packet is too small")
+	}
+	switch data[0] {
+	case 2:
+		return decodingLayerDecoder(&OSPFv2{}, data, p)
+	case 3:
+		return decodingLayerDecoder(&OSPFv3{}, data, p)
+	}
+	return fmt.Errorf("unknown OSPF version %d", data[0])
+}
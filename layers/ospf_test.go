@@ -0,0 +1,203 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testPacketOSPFv2Hello is an OSPFv2 hello from 1.1.1.1, the designated
+// router, which has seen 2.2.2.2.
+var testPacketOSPFv2Hello = []byte{
+	0x01, 0x00, 0x5e, 0x00, 0x00, 0x05, 0x00, 0x0c, 0x29, 0x00, 0x00, 0x01, 0x08, 0x00,
+	0x45, 0xc0, 0x00, 0x44, 0x00, 0x01, 0x00, 0x00, 0x01, 0x59, 0x00, 0x00,
+	0x0a, 0x00, 0x00, 0x01, 0xe0, 0x00, 0x00, 0x05,
+	0x02, 0x01, 0x00, 0x30, 0x01, 0x01, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x00, 0x00, 0x0a, 0x02, 0x01, 0x00, 0x00, 0x00, 0x28,
+	0x0a, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x02, 0x02, 0x02, 0x02,
+}
+
+func TestPacketOSPFv2Hello(t *testing.T) {
+	p := gopacket.NewPacket(testPacketOSPFv2Hello, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeIPv4, LayerTypeOSPF}, t)
+	o, ok := p.Layer(LayerTypeOSPF).(*OSPFv2)
+	if !ok {
+		t.Fatal("no OSPFv2 layer")
+	}
+	if o.Version != 2 || o.Type != OSPFTypeHello || o.PacketLength != 48 || o.RouterID != 0x01010101 {
+		t.Errorf("got header %+v", o.OSPF)
+	}
+	want := &OSPFHello{
+		NetworkMask:        net.IPMask{0xff, 0xff, 0xff, 0x00},
+		HelloInterval:      10,
+		Options:            2,
+		Priority:           1,
+		RouterDeadInterval: 40,
+		DesignatedRouter:   0x0a000001,
+		Neighbors:          []uint32{0x02020202},
+	}
+	if !reflect.DeepEqual(o.Hello, want) {
+		t.Errorf("got hello %+v, want %+v", o.Hello, want)
+	}
+}
+
+// testOSPFv2LSUpdate is an OSPFv2 link state update carrying a router LSA
+// with a stub and a point-to-point link, and an AS external LSA.
+var testOSPFv2LSUpdate = []byte{
+	0x02, 0x04, 0x00, 0x74, 0x01, 0x01, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x02,
+	0x00, 0x01, 0x02, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01,
+	0x80, 0x00, 0x00, 0x01, 0x12, 0x34, 0x00, 0x34,
+	0x02, 0x00, 0x00, 0x02,
+	0x0a, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0x00, 0x03, 0x00, 0x00, 0x0a,
+	0x02, 0x02, 0x02, 0x02, 0x0a, 0x00, 0x00, 0x01, 0x01, 0x01, 0x00, 0x01, 0x08, 0x00, 0x00, 0x05,
+	0x00, 0x02, 0x02, 0x05, 0x0a, 0x01, 0x00, 0x00, 0x01, 0x01, 0x01, 0x01,
+	0x80, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x24,
+	0xff, 0xff, 0x00, 0x00, 0x80, 0x00, 0x00, 0x14, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x07,
+}
+
+func TestOSPFv2LSUpdate(t *testing.T) {
+	p := gopacket.NewPacket(testOSPFv2LSUpdate, LayerTypeOSPF, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	o := p.Layer(LayerTypeOSPF).(*OSPFv2)
+	if o.Type != OSPFTypeLinkStateUpdate || len(o.LSAs) != 2 {
+		t.Fatalf("got %+v", o.OSPF)
+	}
+	wantHeader := OSPFLSAHeader{Age: 1, Options: 2, Type: OSPFv2LSARouter, LinkStateID: 0x01010101, AdvRouter: 0x01010101, SeqNumber: 0x80000001, Checksum: 0x1234, Length: 52}
+	if o.LSAs[0].OSPFLSAHeader != wantHeader {
+		t.Errorf("got LSA header %+v, want %+v", o.LSAs[0].OSPFLSAHeader, wantHeader)
+	}
+	wantRouter := &OSPFv2RouterLSA{Flags: OSPFRouterLSAFlagE, Links: []OSPFv2RouterLink{
+		{LinkID: 0x0a000000, LinkData: 0xffffff00, Type: 3, Metric: 10},
+		{LinkID: 0x02020202, LinkData: 0x0a000001, Type: 1, Metric: 1, TOS: []OSPFv2TOSMetric{{TOS: 8, Metric: 5}}},
+	}}
+	if !reflect.DeepEqual(o.LSAs[0].Content, wantRouter) {
+		t.Errorf("got router LSA %+v, want %+v", o.LSAs[0].Content, wantRouter)
+	}
+	wantExternal := &OSPFv2ASExternalLSA{
+		NetworkMask:       net.IPMask{0xff, 0xff, 0x00, 0x00},
+		External:          true,
+		Metric:            20,
+		ForwardingAddress: net.IP{0, 0, 0, 0},
+		RouteTag:          7,
+	}
+	if !reflect.DeepEqual(o.LSAs[1].Content, wantExternal) {
+		t.Errorf("got AS external LSA %+v, want %+v", o.LSAs[1].Content, wantExternal)
+	}
+
+	// Claim a third LSA.
+	data := append([]byte{}, testOSPFv2LSUpdate...)
+	data[27] = 3
+	if p := gopacket.NewPacket(data, LayerTypeOSPF, gopacket.Default); p.ErrorLayer() == nil {
+		t.Error("decoded update with missing LSA")
+	}
+	if p := gopacket.NewPacket(testOSPFv2LSUpdate[:100], LayerTypeOSPF, gopacket.Default); p.ErrorLayer() == nil || !p.Metadata().Truncated {
+		t.Error("decoded truncated update")
+	}
+}
+
+// testOSPFv3Hello is an OSPFv3 hello from 1.1.1.1 on interface 5.
+var testOSPFv3Hello = []byte{
+	0x03, 0x01, 0x00, 0x28, 0x01, 0x01, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x05, 0x01, 0x00, 0x00, 0x13, 0x00, 0x0a, 0x00, 0x28,
+	0x01, 0x01, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x02, 0x02, 0x02, 0x02,
+}
+
+func TestOSPFv3Hello(t *testing.T) {
+	p := gopacket.NewPacket(testOSPFv3Hello, LayerTypeOSPF, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	o, ok := p.Layer(LayerTypeOSPF).(*OSPFv3)
+	if !ok {
+		t.Fatal("no OSPFv3 layer")
+	}
+	want := &OSPFHello{
+		InterfaceID:        5,
+		HelloInterval:      10,
+		Options:            0x13,
+		Priority:           1,
+		RouterDeadInterval: 40,
+		DesignatedRouter:   0x01010101,
+		Neighbors:          []uint32{0x02020202},
+	}
+	if !reflect.DeepEqual(o.Hello, want) {
+		t.Errorf("got hello %+v, want %+v", o.Hello, want)
+	}
+}
+
+// testOSPFv3LSUpdate is an OSPFv3 link state update carrying a router, a
+// link and an intra-area prefix LSA.
+var testOSPFv3LSUpdate = []byte{
+	0x03, 0x04, 0x00, 0xa0, 0x01, 0x01, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x03,
+	0x00, 0x01, 0x20, 0x01, 0x00, 0x00, 0x00, 0x00, 0x01, 0x01, 0x01, 0x01,
+	0x80, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x28,
+	0x01, 0x00, 0x00, 0x13,
+	0x02, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00, 0x05, 0x02, 0x02, 0x02, 0x02,
+	0x00, 0x01, 0x00, 0x08, 0x00, 0x00, 0x00, 0x05, 0x01, 0x01, 0x01, 0x01,
+	0x80, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x38,
+	0x01, 0x00, 0x00, 0x13,
+	0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+	0x00, 0x00, 0x00, 0x01,
+	0x40, 0x00, 0x00, 0x00, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x01,
+	0x00, 0x01, 0x20, 0x09, 0x00, 0x00, 0x00, 0x00, 0x01, 0x01, 0x01, 0x01,
+	0x80, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x2c,
+	0x00, 0x01, 0x20, 0x01, 0x00, 0x00, 0x00, 0x00, 0x01, 0x01, 0x01, 0x01,
+	0x40, 0x00, 0x00, 0x0a, 0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x01,
+}
+
+func TestOSPFv3LSUpdate(t *testing.T) {
+	p := gopacket.NewPacket(testOSPFv3LSUpdate, LayerTypeOSPF, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	o := p.Layer(LayerTypeOSPF).(*OSPFv3)
+	if len(o.LSAs) != 3 {
+		t.Fatalf("got %d LSAs", len(o.LSAs))
+	}
+	for i, typ := range []OSPFLSAType{OSPFv3LSARouter, OSPFv3LSALink, OSPFv3LSAIntraAreaPfx} {
+		if o.LSAs[i].Type != typ {
+			t.Errorf("LSA %d type %#x, want %#x", i, o.LSAs[i].Type, typ)
+		}
+	}
+	wantRouter := &OSPFv3RouterLSA{Flags: OSPFRouterLSAFlagB, Options: 0x13, Interfaces: []OSPFv3RouterInterface{
+		{Type: 2, Metric: 10, InterfaceID: 5, NeighborInterfaceID: 5, NeighborRouterID: 0x02020202},
+	}}
+	if !reflect.DeepEqual(o.LSAs[0].Content, wantRouter) {
+		t.Errorf("got router LSA %+v, want %+v", o.LSAs[0].Content, wantRouter)
+	}
+	prefix := net.ParseIP("2001:db8:0:1::")
+	wantLink := &OSPFv3LinkLSA{
+		Priority:         1,
+		Options:          0x13,
+		LinkLocalAddress: net.ParseIP("fe80::1"),
+		Prefixes:         []OSPFv3Prefix{{Length: 64, Address: prefix}},
+	}
+	if !reflect.DeepEqual(o.LSAs[1].Content, wantLink) {
+		t.Errorf("got link LSA %+v, want %+v", o.LSAs[1].Content, wantLink)
+	}
+	wantPrefix := &OSPFv3IntraAreaPrefixLSA{
+		ReferencedLSType:    OSPFv3LSARouter,
+		ReferencedAdvRouter: 0x01010101,
+		Prefixes:            []OSPFv3Prefix{{Length: 64, Metric: 10, Address: prefix}},
+	}
+	if !reflect.DeepEqual(o.LSAs[2].Content, wantPrefix) {
+		t.Errorf("got intra-area prefix LSA %+v, want %+v", o.LSAs[2].Content, wantPrefix)
+	}
+}
@@ -56,6 +56,29 @@ func (a UDPPort) String() string {
 	return strconv.Itoa(int(a))
 }
 
+// TCPPortLayerType maps TCP ports to the layer type that TCPPort.LayerType
+// returns for them, to decode the payloads of segments to or from them.
+// It starts empty, so TCP payloads are decoded as gopacket.Payload: a
+// segment needn't hold a whole message, so protocols over TCP are better
+// decoded from reassembled streams, with stream types such as BGPStream.
+// Programs decoding single-segment messages can add ports, for example:
+//
+//	layers.TCPPortLayerType[179] = layers.LayerTypeBGP
+//
+// Decoding layer parsers must then also be able to decode the added types.
+var TCPPortLayerType = map[TCPPort]gopacket.LayerType{}
+
+// LayerType returns a LayerType that would be able to decode the
+// application payload, as set in TCPPortLayerType.
+//
+// Returns gopacket.LayerTypePayload for ports not in TCPPortLayerType.
+func (a TCPPort) LayerType() gopacket.LayerType {
+	if lt, ok := TCPPortLayerType[a]; ok {
+		return lt
+	}
+	return gopacket.LayerTypePayload
+}
+
 // LayerType returns a LayerType that would be able to decode the
 // application payload. It use some well-known port such as 53 for DNS.
 //
@@ -70,8 +93,48 @@ func (a UDPPort) LayerType() gopacket.LayerType {
 		return LayerTypeVXLAN
 	case 67, 68:
 		return LayerTypeDHCPv4
+	case 546, 547:
+		return LayerTypeDHCPv6
+	case 319, 320:
+		return LayerTypePTP
+	case 514:
+		return LayerTypeSyslog
+	case 1812, 1813, 1645, 1646, 3799:
+		return LayerTypeRADIUS
+	case 88:
+		return LayerTypeKerberos
+	case 5060:
+		return LayerTypeSIP
+	case 3478:
+		return LayerTypeSTUN
+	case 5683:
+		return LayerTypeCoAP
 	case 6343:
 		return LayerTypeSFlow
+	case 2152:
+		return LayerTypeGTPv1U
+	case 2123:
+		return LayerTypeGTPv2C
+	case 1701:
+		return LayerTypeL2TP
+	case 520:
+		return LayerTypeRIP
+	case 1985, 2029:
+		return LayerTypeHSRP
+	case 500:
+		return LayerTypeIKE
+	case 4500:
+		return LayerTypeIPSecUDPEncap
+	case 51820:
+		return LayerTypeWireGuard
+	case 2083, 5684:
+		return LayerTypeDTLS
+	case 5353:
+		return LayerTypeMDNS
+	case 5355:
+		return LayerTypeLLMNR
+	case 1900:
+		return LayerTypeSSDP
 	default:
 		return gopacket.LayerTypePayload
 	}
@@ -37,17 +37,31 @@ func (p *PPP) LinkFlow() gopacket.Flow { return PPPFlow }
 
 func decodePPP(data []byte, p gopacket.PacketBuilder) error {
 	ppp := &PPP{}
-	if data[0]&0x1 == 0 {
-		if data[1]&0x1 == 0 {
+	// PPP carried in HDLC-like framing, as in L2TP, may start with the
+	// all-stations address and UI control field.
+	start := 0
+	if len(data) >= 2 && data[0] == 0xff && data[1] == 0x03 {
+		start = 2
+	}
+	if len(data) < start+1 {
+		p.SetTruncated()
+		return errors.New("PPP packet too short")
+	}
+	if data[start]&0x1 == 0 {
+		if len(data) < start+2 {
+			p.SetTruncated()
+			return errors.New("PPP packet too short")
+		}
+		if data[start+1]&0x1 == 0 {
 			return errors.New("PPP has invalid type")
 		}
-		ppp.PPPType = PPPType(binary.BigEndian.Uint16(data[:2]))
-		ppp.Contents = data[:2]
-		ppp.Payload = data[2:]
+		ppp.PPPType = PPPType(binary.BigEndian.Uint16(data[start : start+2]))
+		ppp.Contents = data[:start+2]
+		ppp.Payload = data[start+2:]
 	} else {
-		ppp.PPPType = PPPType(data[0])
-		ppp.Contents = data[:1]
-		ppp.Payload = data[1:]
+		ppp.PPPType = PPPType(data[start])
+		ppp.Contents = data[:start+1]
+		ppp.Payload = data[start+1:]
 	}
 	p.AddLayer(ppp)
 	p.SetLinkLayer(ppp)
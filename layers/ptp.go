@@ -0,0 +1,454 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// PTPMessageType is the type of a PTP message.
+type PTPMessageType uint8
+
+// PTP message types (IEEE 1588-2019 section 13.3.2.3).  Sync, Delay_Req,
+// Pdelay_Req and Pdelay_Resp are event messages, timestamped when sent and
+// received, and go to UDP port 319; the others are general messages, sent
+// to port 320.
+const (
+	PTPMessageTypeSync               PTPMessageType = 0x0
+	PTPMessageTypeDelayReq           PTPMessageType = 0x1
+	PTPMessageTypePdelayReq          PTPMessageType = 0x2
+	PTPMessageTypePdelayResp         PTPMessageType = 0x3
+	PTPMessageTypeFollowUp           PTPMessageType = 0x8
+	PTPMessageTypeDelayResp          PTPMessageType = 0x9
+	PTPMessageTypePdelayRespFollowUp PTPMessageType = 0xa
+	PTPMessageTypeAnnounce           PTPMessageType = 0xb
+	PTPMessageTypeSignaling          PTPMessageType = 0xc
+	PTPMessageTypeManagement         PTPMessageType = 0xd
+)
+
+func (t PTPMessageType) String() string {
+	switch t {
+	case PTPMessageTypeSync:
+		return "Sync"
+	case PTPMessageTypeDelayReq:
+		return "Delay_Req"
+	case PTPMessageTypePdelayReq:
+		return "Pdelay_Req"
+	case PTPMessageTypePdelayResp:
+		return "Pdelay_Resp"
+	case PTPMessageTypeFollowUp:
+		return "Follow_Up"
+	case PTPMessageTypeDelayResp:
+		return "Delay_Resp"
+	case PTPMessageTypePdelayRespFollowUp:
+		return "Pdelay_Resp_Follow_Up"
+	case PTPMessageTypeAnnounce:
+		return "Announce"
+	case PTPMessageTypeSignaling:
+		return "Signaling"
+	case PTPMessageTypeManagement:
+		return "Management"
+	default:
+		return fmt.Sprintf("UnknownPTPMessageType(%d)", uint8(t))
+	}
+}
+
+// bodyLength returns the length of the body of messages of type t, which
+// follows the header and precedes the TLVs.
+func (t PTPMessageType) bodyLength() int {
+	switch t {
+	case PTPMessageTypeSync, PTPMessageTypeDelayReq, PTPMessageTypeFollowUp, PTPMessageTypeSignaling:
+		return 10
+	case PTPMessageTypePdelayReq, PTPMessageTypePdelayResp, PTPMessageTypeDelayResp, PTPMessageTypePdelayRespFollowUp:
+		return 20
+	case PTPMessageTypeAnnounce:
+		return 30
+	case PTPMessageTypeManagement:
+		return 14
+	}
+	return 0
+}
+
+// PTP flags, of the flag field of the header.
+const (
+	PTPFlagLeap61                uint16 = 0x0001
+	PTPFlagLeap59                uint16 = 0x0002
+	PTPFlagCurrentUTCOffsetValid uint16 = 0x0004
+	PTPFlagPTPTimescale          uint16 = 0x0008
+	PTPFlagTimeTraceable         uint16 = 0x0010
+	PTPFlagFrequencyTraceable    uint16 = 0x0020
+	PTPFlagAlternateMaster       uint16 = 0x0100
+	PTPFlagTwoStep               uint16 = 0x0200
+	PTPFlagUnicast               uint16 = 0x0400
+	PTPFlagProfileSpecific1      uint16 = 0x2000
+	PTPFlagProfileSpecific2      uint16 = 0x4000
+)
+
+// PTPClockIdentity identifies a PTP clock, often by an EUI-64 derived from
+// its MAC address.
+type PTPClockIdentity [8]byte
+
+func (c PTPClockIdentity) String() string {
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x:%02x:%02x", c[0], c[1], c[2], c[3], c[4], c[5], c[6], c[7])
+}
+
+// PTPPortIdentity identifies a port of a PTP clock.
+type PTPPortIdentity struct {
+	ClockIdentity PTPClockIdentity
+	PortNumber    uint16
+}
+
+func (p PTPPortIdentity) String() string {
+	return fmt.Sprintf("%v-%d", p.ClockIdentity, p.PortNumber)
+}
+
+func (p *PTPPortIdentity) decode(data []byte) {
+	copy(p.ClockIdentity[:], data[:8])
+	p.PortNumber = binary.BigEndian.Uint16(data[8:10])
+}
+
+func (p *PTPPortIdentity) encode(data []byte) {
+	copy(data[:8], p.ClockIdentity[:])
+	binary.BigEndian.PutUint16(data[8:10], p.PortNumber)
+}
+
+// PTPTimestamp is a PTP timestamp, of 48-bit seconds and nanoseconds since
+// the PTP epoch, 1970-01-01 TAI.
+type PTPTimestamp struct {
+	Seconds     uint64
+	Nanoseconds uint32
+}
+
+// Time returns t as a time.  PTP keeps TAI, which is ahead of UTC by the
+// current UTC offset of Announce messages, 37 seconds since 2017, when the
+// PTP timescale flag is set; Time doesn't subtract it.
+func (t PTPTimestamp) Time() time.Time {
+	return time.Unix(int64(t.Seconds), int64(t.Nanoseconds)).UTC()
+}
+
+func (t *PTPTimestamp) decode(data []byte) {
+	t.Seconds = uint64(binary.BigEndian.Uint16(data[0:2]))<<32 | uint64(binary.BigEndian.Uint32(data[2:6]))
+	t.Nanoseconds = binary.BigEndian.Uint32(data[6:10])
+}
+
+func (t *PTPTimestamp) encode(data []byte) {
+	binary.BigEndian.PutUint16(data[0:2], uint16(t.Seconds>>32))
+	binary.BigEndian.PutUint32(data[2:6], uint32(t.Seconds))
+	binary.BigEndian.PutUint32(data[6:10], t.Nanoseconds)
+}
+
+// PTPClockQuality describes the quality of a grandmaster clock, by which
+// the best master clock algorithm picks one.
+type PTPClockQuality struct {
+	ClockClass              uint8
+	ClockAccuracy           uint8
+	OffsetScaledLogVariance uint16
+}
+
+// PTPAnnounce is the body of an Announce message, with which a master
+// advertises its grandmaster.
+type PTPAnnounce struct {
+	// CurrentUTCOffset is the offset of TAI from UTC, in seconds.
+	CurrentUTCOffset        int16
+	GrandmasterPriority1    uint8
+	GrandmasterClockQuality PTPClockQuality
+	GrandmasterPriority2    uint8
+	GrandmasterIdentity     PTPClockIdentity
+	StepsRemoved            uint16
+	TimeSource              uint8
+}
+
+// PTPTLVType is the type of a PTP TLV.
+type PTPTLVType uint16
+
+// PTP TLV types (IEEE 1588-2019 section 14.1.1).
+const (
+	PTPTLVTypeManagement                           PTPTLVType = 0x0001
+	PTPTLVTypeManagementErrorStatus                PTPTLVType = 0x0002
+	PTPTLVTypeOrganizationExtension                PTPTLVType = 0x0003
+	PTPTLVTypeRequestUnicastTransmission           PTPTLVType = 0x0004
+	PTPTLVTypeGrantUnicastTransmission             PTPTLVType = 0x0005
+	PTPTLVTypeCancelUnicastTransmission            PTPTLVType = 0x0006
+	PTPTLVTypeAcknowledgeCancelUnicastTransmission PTPTLVType = 0x0007
+	PTPTLVTypePathTrace                            PTPTLVType = 0x0008
+	PTPTLVTypeAlternateTimeOffsetIndicator         PTPTLVType = 0x0009
+)
+
+func (t PTPTLVType) String() string {
+	switch t {
+	case PTPTLVTypeManagement:
+		return "Management"
+	case PTPTLVTypeManagementErrorStatus:
+		return "ManagementErrorStatus"
+	case PTPTLVTypeOrganizationExtension:
+		return "OrganizationExtension"
+	case PTPTLVTypeRequestUnicastTransmission:
+		return "RequestUnicastTransmission"
+	case PTPTLVTypeGrantUnicastTransmission:
+		return "GrantUnicastTransmission"
+	case PTPTLVTypeCancelUnicastTransmission:
+		return "CancelUnicastTransmission"
+	case PTPTLVTypeAcknowledgeCancelUnicastTransmission:
+		return "AcknowledgeCancelUnicastTransmission"
+	case PTPTLVTypePathTrace:
+		return "PathTrace"
+	case PTPTLVTypeAlternateTimeOffsetIndicator:
+		return "AlternateTimeOffsetIndicator"
+	default:
+		return fmt.Sprintf("UnknownPTPTLVType(%d)", uint16(t))
+	}
+}
+
+// PTPTLV is a TLV, which extends a PTP message.
+type PTPTLV struct {
+	Type   PTPTLVType
+	Length uint16
+	Value  []byte
+}
+
+// PTP is a Precision Time Protocol version 2 message (IEEE 1588), carried
+// over UDP ports 319 and 320 or directly over Ethernet.  The fields after
+// LogMessageInterval are those of the message's body, and are set for the
+// types of message that have them.
+type PTP struct {
+	BaseLayer
+	// MajorSdoID, formerly transportSpecific, tells profiles apart, like
+	// 802.1AS, which sets it to 1.
+	MajorSdoID    uint8
+	MessageType   PTPMessageType
+	MinorVersion  uint8
+	Version       uint8
+	MessageLength uint16
+	DomainNumber  uint8
+	MinorSdoID    uint8
+	Flags         uint16
+	// Correction is the time the message spent in transparent clocks, or
+	// other corrections, in nanoseconds times 2^16.
+	Correction          int64
+	MessageTypeSpecific uint32
+	SourcePortIdentity  PTPPortIdentity
+	SequenceID          uint16
+	ControlField        uint8
+	LogMessageInterval  int8
+
+	// Timestamp is the originTimestamp of Sync, Delay_Req, Pdelay_Req and
+	// Announce messages, the preciseOriginTimestamp of Follow_Up, the
+	// receiveTimestamp of Delay_Resp, the requestReceiptTimestamp of
+	// Pdelay_Resp and the responseOriginTimestamp of
+	// Pdelay_Resp_Follow_Up.
+	Timestamp PTPTimestamp
+	// RequestingPortIdentity is that of Delay_Resp, Pdelay_Resp and
+	// Pdelay_Resp_Follow_Up messages.
+	RequestingPortIdentity PTPPortIdentity
+	// TargetPortIdentity is that of Signaling and Management messages.
+	TargetPortIdentity PTPPortIdentity
+	Announce           PTPAnnounce
+	// StartingBoundaryHops, BoundaryHops and Action are those of
+	// Management messages.
+	StartingBoundaryHops uint8
+	BoundaryHops         uint8
+	Action               uint8
+	TLVs                 []PTPTLV
+}
+
+// LayerType returns LayerTypePTP.
+func (p *PTP) LayerType() gopacket.LayerType { return LayerTypePTP }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (p *PTP) CanDecode() gopacket.LayerClass { return LayerTypePTP }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (p *PTP) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// Payload returns nil, since PTP messages carry no payload.
+func (p *PTP) Payload() []byte { return nil }
+
+// CorrectionDuration returns Correction as a duration, without the
+// fractions of nanoseconds.
+func (p *PTP) CorrectionDuration() time.Duration {
+	return time.Duration(p.Correction >> 16)
+}
+
+func decodePTP(data []byte, p gopacket.PacketBuilder) error {
+	ptp := &PTP{}
+	if err := ptp.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(ptp)
+	p.SetApplicationLayer(ptp)
+	return nil
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.  Bytes past the
+// message length, as Ethernet pads short frames with, are left out of
+// Contents.
+func (p *PTP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 34 {
+		df.SetTruncated()
+		return errors.New("PTP header too short")
+	}
+	p.Version = data[1] & 0x0f
+	if p.Version != 2 {
+		return fmt.Errorf("PTP version %d not supported", p.Version)
+	}
+	p.MajorSdoID = data[0] >> 4
+	p.MessageType = PTPMessageType(data[0] & 0x0f)
+	p.MinorVersion = data[1] >> 4
+	p.MessageLength = binary.BigEndian.Uint16(data[2:4])
+	p.DomainNumber = data[4]
+	p.MinorSdoID = data[5]
+	p.Flags = binary.BigEndian.Uint16(data[6:8])
+	p.Correction = int64(binary.BigEndian.Uint64(data[8:16]))
+	p.MessageTypeSpecific = binary.BigEndian.Uint32(data[16:20])
+	p.SourcePortIdentity.decode(data[20:30])
+	p.SequenceID = binary.BigEndian.Uint16(data[30:32])
+	p.ControlField = data[32]
+	p.LogMessageInterval = int8(data[33])
+
+	n := int(p.MessageLength)
+	if n > len(data) {
+		df.SetTruncated()
+		return fmt.Errorf("PTP message length %d longer than %d bytes", n, len(data))
+	}
+	body := 34 + p.MessageType.bodyLength()
+	if n < body {
+		return fmt.Errorf("PTP %v message length %d too short", p.MessageType, n)
+	}
+	p.Timestamp = PTPTimestamp{}
+	p.RequestingPortIdentity = PTPPortIdentity{}
+	p.TargetPortIdentity = PTPPortIdentity{}
+	p.Announce = PTPAnnounce{}
+	p.StartingBoundaryHops, p.BoundaryHops, p.Action = 0, 0, 0
+	b := data[34:body]
+	switch p.MessageType {
+	case PTPMessageTypeSync, PTPMessageTypeDelayReq, PTPMessageTypeFollowUp, PTPMessageTypePdelayReq:
+		p.Timestamp.decode(b)
+	case PTPMessageTypeDelayResp, PTPMessageTypePdelayResp, PTPMessageTypePdelayRespFollowUp:
+		p.Timestamp.decode(b)
+		p.RequestingPortIdentity.decode(b[10:])
+	case PTPMessageTypeAnnounce:
+		p.Timestamp.decode(b)
+		a := &p.Announce
+		a.CurrentUTCOffset = int16(binary.BigEndian.Uint16(b[10:12]))
+		a.GrandmasterPriority1 = b[13]
+		a.GrandmasterClockQuality.ClockClass = b[14]
+		a.GrandmasterClockQuality.ClockAccuracy = b[15]
+		a.GrandmasterClockQuality.OffsetScaledLogVariance = binary.BigEndian.Uint16(b[16:18])
+		a.GrandmasterPriority2 = b[18]
+		copy(a.GrandmasterIdentity[:], b[19:27])
+		a.StepsRemoved = binary.BigEndian.Uint16(b[27:29])
+		a.TimeSource = b[29]
+	case PTPMessageTypeSignaling:
+		p.TargetPortIdentity.decode(b)
+	case PTPMessageTypeManagement:
+		p.TargetPortIdentity.decode(b)
+		p.StartingBoundaryHops = b[10]
+		p.BoundaryHops = b[11]
+		p.Action = b[12] & 0x0f
+	}
+
+	p.TLVs = p.TLVs[:0]
+	for t := data[body:n]; len(t) > 0; {
+		if len(t) < 4 {
+			return errors.New("PTP TLV truncated")
+		}
+		l := binary.BigEndian.Uint16(t[2:4])
+		if len(t) < 4+int(l) {
+			return errors.New("PTP TLV truncated")
+		}
+		p.TLVs = append(p.TLVs, PTPTLV{
+			Type:   PTPTLVType(binary.BigEndian.Uint16(t[0:2])),
+			Length: l,
+			Value:  t[4 : 4+l],
+		})
+		t = t[4+l:]
+	}
+	p.BaseLayer = BaseLayer{Contents: data[:n]}
+	return nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+// See the docs for gopacket.SerializableLayer for more info.
+func (p *PTP) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	body := 34 + p.MessageType.bodyLength()
+	n := body
+	for _, t := range p.TLVs {
+		n += 4 + len(t.Value)
+	}
+	if n > 0xffff {
+		return fmt.Errorf("PTP message length %d too long", n)
+	}
+	data, err := b.PrependBytes(n)
+	if err != nil {
+		return err
+	}
+	if opts.FixLengths {
+		p.MessageLength = uint16(n)
+	}
+	data[0] = p.MajorSdoID<<4 | uint8(p.MessageType)&0x0f
+	data[1] = p.MinorVersion<<4 | p.Version&0x0f
+	binary.BigEndian.PutUint16(data[2:4], p.MessageLength)
+	data[4] = p.DomainNumber
+	data[5] = p.MinorSdoID
+	binary.BigEndian.PutUint16(data[6:8], p.Flags)
+	binary.BigEndian.PutUint64(data[8:16], uint64(p.Correction))
+	binary.BigEndian.PutUint32(data[16:20], p.MessageTypeSpecific)
+	p.SourcePortIdentity.encode(data[20:30])
+	binary.BigEndian.PutUint16(data[30:32], p.SequenceID)
+	data[32] = p.ControlField
+	data[33] = uint8(p.LogMessageInterval)
+
+	bd := data[34:body]
+	for i := range bd {
+		bd[i] = 0
+	}
+	switch p.MessageType {
+	case PTPMessageTypeSync, PTPMessageTypeDelayReq, PTPMessageTypeFollowUp, PTPMessageTypePdelayReq:
+		p.Timestamp.encode(bd)
+	case PTPMessageTypeDelayResp, PTPMessageTypePdelayResp, PTPMessageTypePdelayRespFollowUp:
+		p.Timestamp.encode(bd)
+		p.RequestingPortIdentity.encode(bd[10:])
+	case PTPMessageTypeAnnounce:
+		p.Timestamp.encode(bd)
+		a := &p.Announce
+		binary.BigEndian.PutUint16(bd[10:12], uint16(a.CurrentUTCOffset))
+		bd[13] = a.GrandmasterPriority1
+		bd[14] = a.GrandmasterClockQuality.ClockClass
+		bd[15] = a.GrandmasterClockQuality.ClockAccuracy
+		binary.BigEndian.PutUint16(bd[16:18], a.GrandmasterClockQuality.OffsetScaledLogVariance)
+		bd[18] = a.GrandmasterPriority2
+		copy(bd[19:27], a.GrandmasterIdentity[:])
+		binary.BigEndian.PutUint16(bd[27:29], a.StepsRemoved)
+		bd[29] = a.TimeSource
+	case PTPMessageTypeSignaling:
+		p.TargetPortIdentity.encode(bd)
+	case PTPMessageTypeManagement:
+		p.TargetPortIdentity.encode(bd)
+		bd[10] = p.StartingBoundaryHops
+		bd[11] = p.BoundaryHops
+		bd[12] = p.Action & 0x0f
+	}
+
+	t := data[body:]
+	for i := range p.TLVs {
+		tlv := &p.TLVs[i]
+		if opts.FixLengths {
+			tlv.Length = uint16(len(tlv.Value))
+		}
+		binary.BigEndian.PutUint16(t[0:2], uint16(tlv.Type))
+		binary.BigEndian.PutUint16(t[2:4], tlv.Length)
+		copy(t[4:], tlv.Value)
+		t = t[4+len(tlv.Value):]
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+var testPTPClock = PTPClockIdentity{0x00, 0x1b, 0x19, 0xff, 0xfe, 0x00, 0x00, 0x01}
+
+func TestPTPAnnounceUDP(t *testing.T) {
+	announce := &PTP{
+		MessageType:        PTPMessageTypeAnnounce,
+		Version:            2,
+		Flags:              PTPFlagPTPTimescale | PTPFlagCurrentUTCOffsetValid,
+		SourcePortIdentity: PTPPortIdentity{testPTPClock, 1},
+		SequenceID:         77,
+		ControlField:       5,
+		LogMessageInterval: 1,
+		Announce: PTPAnnounce{
+			CurrentUTCOffset:        37,
+			GrandmasterPriority1:    128,
+			GrandmasterClockQuality: PTPClockQuality{ClockClass: 6, ClockAccuracy: 0x21, OffsetScaledLogVariance: 0x4e5d},
+			GrandmasterPriority2:    128,
+			GrandmasterIdentity:     testPTPClock,
+			TimeSource:              0x20,
+		},
+		TLVs: []PTPTLV{{Type: PTPTLVTypePathTrace, Value: testPTPClock[:]}},
+	}
+	ip := &IPv4{Version: 4, TTL: 1, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{224, 0, 1, 129}}
+	udp := &UDP{SrcPort: 320, DstPort: 320}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, announce); err != nil {
+		t.Fatal(err)
+	}
+	if announce.MessageLength != 76 {
+		t.Errorf("got message length %d, want 76", announce.MessageLength)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypePTP}, t)
+	got := p.Layer(LayerTypePTP).(*PTP)
+	if got.MessageType != PTPMessageTypeAnnounce || got.SequenceID != 77 || got.SourcePortIdentity != announce.SourcePortIdentity {
+		t.Errorf("got header %+v", got)
+	}
+	if got.Announce != announce.Announce {
+		t.Errorf("got announce %+v, want %+v", got.Announce, announce.Announce)
+	}
+	if !reflect.DeepEqual(got.TLVs, announce.TLVs) {
+		t.Errorf("got TLVs %v, want %v", got.TLVs, announce.TLVs)
+	}
+}
+
+func TestPTPFollowUpEthernet(t *testing.T) {
+	follow := &PTP{
+		MajorSdoID:         1,
+		MessageType:        PTPMessageTypeFollowUp,
+		Version:            2,
+		Correction:         1500<<16 | 0x8000,
+		SourcePortIdentity: PTPPortIdentity{testPTPClock, 1},
+		SequenceID:         9,
+		Timestamp:          PTPTimestamp{Seconds: 1700000037, Nanoseconds: 250},
+	}
+	eth := &Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x1b, 0x19, 0x00, 0x00, 0x01},
+		DstMAC:       net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e},
+		EthernetType: EthernetTypePTP,
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, eth, follow); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LinkTypeEthernet, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypePTP}, t)
+	got := p.Layer(LayerTypePTP).(*PTP)
+	// The frame is padded to the Ethernet minimum, past the message.
+	if len(got.Contents) != 44 || got.MessageLength != 44 {
+		t.Errorf("got %d bytes of message length %d, want 44", len(got.Contents), got.MessageLength)
+	}
+	if got.MajorSdoID != 1 || got.Timestamp != follow.Timestamp || len(got.TLVs) != 0 {
+		t.Errorf("got follow up %+v", got)
+	}
+	if want := time.Unix(1700000037, 250).UTC(); !got.Timestamp.Time().Equal(want) {
+		t.Errorf("got time %v, want %v", got.Timestamp.Time(), want)
+	}
+	if got.CorrectionDuration() != 1500*time.Nanosecond {
+		t.Errorf("got correction %v, want 1.5µs", got.CorrectionDuration())
+	}
+}
+
+func TestPTPDelayResp(t *testing.T) {
+	resp := &PTP{
+		MessageType:            PTPMessageTypeDelayResp,
+		Version:                2,
+		SourcePortIdentity:     PTPPortIdentity{testPTPClock, 1},
+		Timestamp:              PTPTimestamp{Seconds: 1 << 40, Nanoseconds: 999999999},
+		RequestingPortIdentity: PTPPortIdentity{PTPClockIdentity{1, 2, 3, 4, 5, 6, 7, 8}, 2},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := resp.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		t.Fatal(err)
+	}
+	got := &PTP{}
+	if err := got.DecodeFromBytes(buf.Bytes(), gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if got.Timestamp != resp.Timestamp || got.RequestingPortIdentity != resp.RequestingPortIdentity {
+		t.Errorf("got delay response %+v", got)
+	}
+	if s := got.RequestingPortIdentity.String(); s != "01:02:03:04:05:06:07:08-2" {
+		t.Errorf("got port identity %q", s)
+	}
+
+	data := buf.Bytes()
+	for _, b := range [][]byte{data[:30], data[:50]} {
+		if err := (&PTP{}).DecodeFromBytes(b, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("decoded %d of %d bytes without error", len(b), len(data))
+		}
+	}
+}
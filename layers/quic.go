@@ -0,0 +1,318 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// QUICVersion is a QUIC version.
+type QUICVersion uint32
+
+const (
+	// QUICVersionNegotiation is the version of version negotiation
+	// packets.
+	QUICVersionNegotiation QUICVersion = 0
+	QUICVersion1           QUICVersion = 0x00000001
+	QUICVersion2           QUICVersion = 0x6b3343cf
+	QUICVersionDraft29     QUICVersion = 0xff00001d
+)
+
+func (v QUICVersion) String() string {
+	switch v {
+	case QUICVersionNegotiation:
+		return "Version Negotiation"
+	case QUICVersion1:
+		return "QUIC v1"
+	case QUICVersion2:
+		return "QUIC v2"
+	case QUICVersionDraft29:
+		return "draft-29"
+	default:
+		return fmt.Sprintf("UnknownQUICVersion(%#08x)", uint32(v))
+	}
+}
+
+// Known reports whether the long header packet types of v are known.
+func (v QUICVersion) Known() bool {
+	switch v {
+	case QUICVersion1, QUICVersion2, QUICVersionDraft29:
+		return true
+	}
+	return false
+}
+
+// QUICPacketType is the type of a QUIC packet.  The types aren't those
+// sent on the wire, which vary by version.
+type QUICPacketType uint8
+
+const (
+	QUICPacketInitial QUICPacketType = iota
+	QUICPacket0RTT
+	QUICPacketHandshake
+	QUICPacketRetry
+	QUICPacketVersionNegotiation
+	// QUICPacket1RTT is a short header packet.
+	QUICPacket1RTT
+)
+
+func (t QUICPacketType) String() string {
+	switch t {
+	case QUICPacketInitial:
+		return "Initial"
+	case QUICPacket0RTT:
+		return "0-RTT"
+	case QUICPacketHandshake:
+		return "Handshake"
+	case QUICPacketRetry:
+		return "Retry"
+	case QUICPacketVersionNegotiation:
+		return "Version Negotiation"
+	case QUICPacket1RTT:
+		return "1-RTT"
+	default:
+		return fmt.Sprintf("UnknownQUICPacketType(%d)", uint8(t))
+	}
+}
+
+// quicLongTypes maps the wire types of long header packets to
+// QUICPacketTypes, for v1 and v2.
+var quicLongTypes = map[QUICVersion][4]QUICPacketType{
+	QUICVersion1:       {QUICPacketInitial, QUICPacket0RTT, QUICPacketHandshake, QUICPacketRetry},
+	QUICVersionDraft29: {QUICPacketInitial, QUICPacket0RTT, QUICPacketHandshake, QUICPacketRetry},
+	QUICVersion2:       {QUICPacketRetry, QUICPacketInitial, QUICPacket0RTT, QUICPacketHandshake},
+}
+
+// QUICPacket is a QUIC packet, of which a datagram may hold several.
+//
+// The packet number and payload of Initial, 0-RTT, Handshake and 1-RTT
+// packets are protected, and are in Protected, which follows Header.
+// Removing the protection of Initial packets needs only the destination
+// connection ID of the client's first Initial; see the quic package.
+type QUICPacket struct {
+	LongHeader bool
+	Type       QUICPacketType
+	// FixedBit is set in every packet decoded but version negotiation
+	// ones, in which it's unused.
+	FixedBit bool
+	// Version and SrcConnID are only set in long headers, and DestConnID
+	// only in them too: the length of the destination connection ID of
+	// short headers is known only to the endpoints, so it's at the start
+	// of Protected.
+	Version    QUICVersion
+	DestConnID []byte
+	SrcConnID  []byte
+	// Token is the token of an Initial or Retry packet.
+	Token []byte
+	// Length is the length of the packet number and payload of Initial,
+	// 0-RTT and Handshake packets.
+	Length uint64
+	// SupportedVersions are the versions a version negotiation packet
+	// offers.
+	SupportedVersions []QUICVersion
+	// RetryIntegrityTag ends Retry packets.
+	RetryIntegrityTag []byte
+	// SpinBit is the latency spin bit of short headers.
+	SpinBit bool
+
+	Header    []byte
+	Protected []byte
+}
+
+// QUIC is a UDP datagram of QUIC (RFC 9000) packets, on UDP port 443.
+// Long header packets may be coalesced in a datagram, followed by at most
+// one short header packet.  Only packets with the fixed bit set, and long
+// header packets of known versions, are decoded, so that other protocols
+// on port 443 aren't taken for QUIC; endpoints greasing the fixed bit (RFC
+// 9287) aren't supported.
+type QUIC struct {
+	BaseLayer
+	Packets []QUICPacket
+}
+
+// LayerType returns LayerTypeQUIC.
+func (q *QUIC) LayerType() gopacket.LayerType { return LayerTypeQUIC }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (q *QUIC) CanDecode() gopacket.LayerClass { return LayerTypeQUIC }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (q *QUIC) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+func decodeQUIC(data []byte, p gopacket.PacketBuilder) error {
+	if !isQUIC(data) {
+		return gopacket.DecodePayload.Decode(data, p)
+	}
+	return decodingLayerDecoder(&QUIC{}, data, p)
+}
+
+// isQUIC returns true if data starts with a QUIC packet: one with the
+// fixed bit set, and a known version if it has a long header.  Version
+// negotiation packets need only the long header, as their other bits are
+// unused.
+func isQUIC(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	if data[0]&0x80 != 0 {
+		if len(data) < 5 {
+			return false
+		}
+		v := QUICVersion(binary.BigEndian.Uint32(data[1:5]))
+		if v == QUICVersionNegotiation {
+			return true
+		}
+		if !v.Known() {
+			return false
+		}
+	}
+	return data[0]&0x40 != 0
+}
+
+// QUICVarint decodes the variable length integer at the start of b,
+// returning it and its length, which is 0 if b is too short.
+func QUICVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, 0
+	}
+	v := uint64(b[0] & 0x3f)
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (q *QUIC) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) == 0 {
+		df.SetTruncated()
+		return fmt.Errorf("QUIC datagram empty")
+	}
+	q.Packets = q.Packets[:0]
+	for rest := data; len(rest) > 0; {
+		p, n, err := decodeQUICPacket(rest, df)
+		if err != nil {
+			return err
+		}
+		q.Packets = append(q.Packets, p)
+		rest = rest[n:]
+		// Padding may follow the last packet, and a zero first byte can't
+		// start a packet.
+		if len(rest) > 0 && rest[0] == 0 {
+			break
+		}
+	}
+	q.BaseLayer = BaseLayer{Contents: data}
+	return nil
+}
+
+// quicConnID returns the connection ID with a one byte length at the start
+// of b, and what follows it.
+func quicConnID(b []byte, what string) ([]byte, []byte, error) {
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return nil, nil, fmt.Errorf("QUIC %s connection ID truncated", what)
+	}
+	if b[0] > 20 {
+		// Only version negotiation packets may have longer ones.
+		return nil, nil, fmt.Errorf("QUIC %s connection ID length %d invalid", what, b[0])
+	}
+	return b[1 : 1+int(b[0])], b[1+int(b[0]):], nil
+}
+
+// decodeQUICPacket decodes the packet at the start of b, and returns its
+// length.
+func decodeQUICPacket(b []byte, df gopacket.DecodeFeedback) (QUICPacket, int, error) {
+	p := QUICPacket{LongHeader: b[0]&0x80 != 0, FixedBit: b[0]&0x40 != 0}
+	if !p.LongHeader && !p.FixedBit {
+		return p, 0, fmt.Errorf("QUIC short header fixed bit not set")
+	}
+	if !p.LongHeader {
+		p.Type = QUICPacket1RTT
+		p.SpinBit = b[0]&0x20 != 0
+		p.Header, p.Protected = b[:1], b[1:]
+		return p, len(b), nil
+	}
+	if len(b) < 5 {
+		df.SetTruncated()
+		return p, 0, fmt.Errorf("QUIC long header length %d too short", len(b))
+	}
+	p.Version = QUICVersion(binary.BigEndian.Uint32(b[1:5]))
+	var err error
+	rest := b[5:]
+	if p.Version == QUICVersionNegotiation {
+		p.Type = QUICPacketVersionNegotiation
+		// Connection IDs of any length are echoed back.
+		for _, id := range []*[]byte{&p.DestConnID, &p.SrcConnID} {
+			if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+				df.SetTruncated()
+				return p, 0, fmt.Errorf("QUIC version negotiation connection ID truncated")
+			}
+			*id, rest = rest[1:1+int(rest[0])], rest[1+int(rest[0]):]
+		}
+		if len(rest)%4 != 0 {
+			return p, 0, fmt.Errorf("QUIC supported versions length %d not a multiple of 4", len(rest))
+		}
+		for ; len(rest) > 0; rest = rest[4:] {
+			p.SupportedVersions = append(p.SupportedVersions, QUICVersion(binary.BigEndian.Uint32(rest)))
+		}
+		p.Header = b
+		return p, len(b), nil
+	}
+	types, ok := quicLongTypes[p.Version]
+	if !ok {
+		return p, 0, fmt.Errorf("QUIC version %v not supported", p.Version)
+	}
+	if !p.FixedBit {
+		return p, 0, fmt.Errorf("QUIC long header fixed bit not set")
+	}
+	if p.DestConnID, rest, err = quicConnID(rest, "destination"); err != nil {
+		df.SetTruncated()
+		return p, 0, err
+	}
+	if p.SrcConnID, rest, err = quicConnID(rest, "source"); err != nil {
+		df.SetTruncated()
+		return p, 0, err
+	}
+	p.Type = types[(b[0]>>4)&3]
+	switch p.Type {
+	case QUICPacketRetry:
+		if len(rest) < 16 {
+			df.SetTruncated()
+			return p, 0, fmt.Errorf("QUIC retry length %d too short", len(rest))
+		}
+		p.Token, p.RetryIntegrityTag = rest[:len(rest)-16], rest[len(rest)-16:]
+		p.Header = b
+		return p, len(b), nil
+	case QUICPacketInitial:
+		v, n := QUICVarint(rest)
+		if n == 0 || uint64(len(rest)-n) < v {
+			df.SetTruncated()
+			return p, 0, fmt.Errorf("QUIC token truncated")
+		}
+		p.Token, rest = rest[n:n+int(v)], rest[n+int(v):]
+	}
+	v, n := QUICVarint(rest)
+	if n == 0 {
+		df.SetTruncated()
+		return p, 0, fmt.Errorf("QUIC length truncated")
+	}
+	p.Length, rest = v, rest[n:]
+	if uint64(len(rest)) < p.Length {
+		df.SetTruncated()
+		return p, 0, fmt.Errorf("QUIC length %d exceeds datagram", p.Length)
+	}
+	hlen := len(b) - len(rest)
+	p.Header, p.Protected = b[:hlen], rest[:p.Length]
+	return p, hlen + int(p.Length), nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func TestQUICVarint(t *testing.T) {
+	// RFC 9000 A.1.
+	for _, c := range []struct {
+		b    []byte
+		want uint64
+	}{
+		{[]byte{0xc2, 0x19, 0x7c, 0x5e, 0xff, 0x14, 0xe8, 0x8c}, 151288809941952652},
+		{[]byte{0x9d, 0x7f, 0x3e, 0x7d}, 494878333},
+		{[]byte{0x7b, 0xbd}, 15293},
+		{[]byte{0x25}, 37},
+	} {
+		if got, n := QUICVarint(c.b); got != c.want || n != len(c.b) {
+			t.Errorf("QUICVarint(%x) = %d, %d, want %d, %d", c.b, got, n, c.want, len(c.b))
+		}
+	}
+	if _, n := QUICVarint([]byte{0x7b}); n != 0 {
+		t.Error("truncated varint decoded")
+	}
+}
+
+// quicLong returns a long header packet of version v with the given first
+// byte and connection IDs, followed by rest.
+func quicLong(first byte, v QUICVersion, dcid, scid []byte, rest ...byte) []byte {
+	b := []byte{first, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v), byte(len(dcid))}
+	b = append(b, dcid...)
+	b = append(b, byte(len(scid)))
+	b = append(b, scid...)
+	return append(b, rest...)
+}
+
+func TestQUICCoalesced(t *testing.T) {
+	dcid, scid := []byte{1, 2, 3, 4, 5, 6, 7, 8}, []byte{9, 10}
+	var data []byte
+	// An Initial with a 2 byte token, then a Handshake, a 1-RTT packet and
+	// no padding.
+	data = append(data, quicLong(0xc1, QUICVersion1, dcid, scid, 2, 0xaa, 0xbb, 4, 1, 2, 3, 4)...)
+	data = append(data, quicLong(0xe1, QUICVersion1, dcid, scid, 0x40, 3, 5, 6, 7)...)
+	data = append(data, 0x61, 1, 2, 3)
+	p := gopacket.NewPacket(data, LayerTypeQUIC, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	q := p.Layer(LayerTypeQUIC).(*QUIC)
+	if len(q.Packets) != 3 {
+		t.Fatalf("got %d packets, want 3: %+v", len(q.Packets), q.Packets)
+	}
+	in := q.Packets[0]
+	if !in.LongHeader || in.Type != QUICPacketInitial || in.Version != QUICVersion1 || !bytes.Equal(in.DestConnID, dcid) ||
+		!bytes.Equal(in.SrcConnID, scid) || !bytes.Equal(in.Token, []byte{0xaa, 0xbb}) || in.Length != 4 || !bytes.Equal(in.Protected, []byte{1, 2, 3, 4}) {
+		t.Errorf("got Initial %+v", in)
+	}
+	if hs := q.Packets[1]; hs.Type != QUICPacketHandshake || hs.Length != 3 || len(hs.Token) != 0 {
+		t.Errorf("got Handshake %+v", hs)
+	}
+	if s := q.Packets[2]; s.LongHeader || s.Type != QUICPacket1RTT || !s.SpinBit || !bytes.Equal(s.Protected, []byte{1, 2, 3}) {
+		t.Errorf("got 1-RTT %+v", s)
+	}
+}
+
+func TestQUICVersion2Types(t *testing.T) {
+	// In v2, the wire type of Initial packets is 1.
+	data := quicLong(0xd0, QUICVersion2, []byte{1}, nil, 0, 1, 0)
+	p := gopacket.NewPacket(data, LayerTypeQUIC, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	if got := p.Layer(LayerTypeQUIC).(*QUIC).Packets[0].Type; got != QUICPacketInitial {
+		t.Errorf("got type %v, want Initial", got)
+	}
+}
+
+func TestQUICVersionNegotiation(t *testing.T) {
+	data := quicLong(0x80, QUICVersionNegotiation, []byte{9, 10}, []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		0, 0, 0, 1, 0x6b, 0x33, 0x43, 0xcf, 0x1a, 0x2a, 0x3a, 0x4a)
+	p := gopacket.NewPacket(data, LayerTypeQUIC, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	vn := p.Layer(LayerTypeQUIC).(*QUIC).Packets[0]
+	want := []QUICVersion{QUICVersion1, QUICVersion2, 0x1a2a3a4a}
+	if vn.Type != QUICPacketVersionNegotiation || !reflect.DeepEqual(vn.SupportedVersions, want) {
+		t.Errorf("got %+v, want versions %v", vn, want)
+	}
+}
+
+func TestQUICRetry(t *testing.T) {
+	tag := repeatByte(0x77, 16)
+	data := quicLong(0xf0, QUICVersion1, []byte{1}, []byte{2}, append([]byte("token"), tag...)...)
+	p := gopacket.NewPacket(data, LayerTypeQUIC, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	r := p.Layer(LayerTypeQUIC).(*QUIC).Packets[0]
+	if r.Type != QUICPacketRetry || string(r.Token) != "token" || !bytes.Equal(r.RetryIntegrityTag, tag) {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestQUICTruncated(t *testing.T) {
+	// The length runs past the datagram.
+	data := quicLong(0xc1, QUICVersion1, []byte{1}, nil, 0, 10, 1, 2)
+	p := gopacket.NewPacket(data, LayerTypeQUIC, gopacket.Default)
+	if p.ErrorLayer() == nil {
+		t.Error("truncated packet decoded")
+	}
+}
+
+func testQUICOverUDP(t *testing.T, payload []byte) gopacket.Packet {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{192, 0, 2, 1}, DstIP: net.IP{192, 0, 2, 2}}
+	udp := &UDP{SrcPort: 50000, DstPort: 443}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	return gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, gopacket.Default)
+}
+
+func TestQUICOverUDP(t *testing.T) {
+	p := testQUICOverUDP(t, quicLong(0xc0, QUICVersion1, []byte{1, 2, 3, 4}, nil, 0, 2, 0, 0))
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeQUIC}, t)
+
+	// Datagrams to port 443 that aren't QUIC are left as payload.
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"unknown version", quicLong(0xc0, 0x0a0a0a0a, []byte{1}, nil, 0, 2, 0, 0)},
+		{"long header fixed bit clear", quicLong(0x80, QUICVersion1, []byte{1}, nil, 0, 2, 0, 0)},
+		{"short header fixed bit clear", []byte{0x01, 1, 2, 3}},
+		{"DTLS", []byte{0x16, 0xfe, 0xfd, 0, 0}},
+	} {
+		p := testQUICOverUDP(t, c.data)
+		if p.Layer(LayerTypeQUIC) != nil || p.Layer(gopacket.LayerTypePayload) == nil {
+			t.Errorf("%s: decoded %v", c.name, p)
+		}
+	}
+
+	// Decoded directly, they are left as payload too.
+	p = gopacket.NewPacket([]byte{0x01, 1, 2, 3}, LayerTypeQUIC, gopacket.Default)
+	checkLayers(p, []gopacket.LayerType{gopacket.LayerTypePayload}, t)
+}
@@ -0,0 +1,440 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/mistsys/gopacket"
+)
+
+// RADIUSCode is the code of a RADIUS packet, which gives its type.
+type RADIUSCode uint8
+
+// RADIUS codes (RFC 2865, RFC 2866 and RFC 5176).
+const (
+	RADIUSCodeAccessRequest      RADIUSCode = 1
+	RADIUSCodeAccessAccept       RADIUSCode = 2
+	RADIUSCodeAccessReject       RADIUSCode = 3
+	RADIUSCodeAccountingRequest  RADIUSCode = 4
+	RADIUSCodeAccountingResponse RADIUSCode = 5
+	RADIUSCodeAccessChallenge    RADIUSCode = 11
+	RADIUSCodeStatusServer       RADIUSCode = 12
+	RADIUSCodeStatusClient       RADIUSCode = 13
+	RADIUSCodeDisconnectRequest  RADIUSCode = 40
+	RADIUSCodeDisconnectACK      RADIUSCode = 41
+	RADIUSCodeDisconnectNAK      RADIUSCode = 42
+	RADIUSCodeCoARequest         RADIUSCode = 43
+	RADIUSCodeCoAACK             RADIUSCode = 44
+	RADIUSCodeCoANAK             RADIUSCode = 45
+)
+
+func (c RADIUSCode) String() string {
+	switch c {
+	case RADIUSCodeAccessRequest:
+		return "Access-Request"
+	case RADIUSCodeAccessAccept:
+		return "Access-Accept"
+	case RADIUSCodeAccessReject:
+		return "Access-Reject"
+	case RADIUSCodeAccountingRequest:
+		return "Accounting-Request"
+	case RADIUSCodeAccountingResponse:
+		return "Accounting-Response"
+	case RADIUSCodeAccessChallenge:
+		return "Access-Challenge"
+	case RADIUSCodeStatusServer:
+		return "Status-Server"
+	case RADIUSCodeStatusClient:
+		return "Status-Client"
+	case RADIUSCodeDisconnectRequest:
+		return "Disconnect-Request"
+	case RADIUSCodeDisconnectACK:
+		return "Disconnect-ACK"
+	case RADIUSCodeDisconnectNAK:
+		return "Disconnect-NAK"
+	case RADIUSCodeCoARequest:
+		return "CoA-Request"
+	case RADIUSCodeCoAACK:
+		return "CoA-ACK"
+	case RADIUSCodeCoANAK:
+		return "CoA-NAK"
+	default:
+		return fmt.Sprintf("UnknownRADIUSCode(%d)", uint8(c))
+	}
+}
+
+// RADIUSAttributeType is the type of a RADIUS attribute.
+type RADIUSAttributeType uint8
+
+// RADIUS attribute types (RFC 2865, RFC 2866, RFC 2868, RFC 2869 and
+// others).
+const (
+	RADIUSAttributeTypeUserName             RADIUSAttributeType = 1
+	RADIUSAttributeTypeUserPassword         RADIUSAttributeType = 2
+	RADIUSAttributeTypeCHAPPassword         RADIUSAttributeType = 3
+	RADIUSAttributeTypeNASIPAddress         RADIUSAttributeType = 4
+	RADIUSAttributeTypeNASPort              RADIUSAttributeType = 5
+	RADIUSAttributeTypeServiceType          RADIUSAttributeType = 6
+	RADIUSAttributeTypeFramedProtocol       RADIUSAttributeType = 7
+	RADIUSAttributeTypeFramedIPAddress      RADIUSAttributeType = 8
+	RADIUSAttributeTypeFilterID             RADIUSAttributeType = 11
+	RADIUSAttributeTypeFramedMTU            RADIUSAttributeType = 12
+	RADIUSAttributeTypeReplyMessage         RADIUSAttributeType = 18
+	RADIUSAttributeTypeState                RADIUSAttributeType = 24
+	RADIUSAttributeTypeClass                RADIUSAttributeType = 25
+	RADIUSAttributeTypeVendorSpecific       RADIUSAttributeType = 26
+	RADIUSAttributeTypeSessionTimeout       RADIUSAttributeType = 27
+	RADIUSAttributeTypeIdleTimeout          RADIUSAttributeType = 28
+	RADIUSAttributeTypeCalledStationID      RADIUSAttributeType = 30
+	RADIUSAttributeTypeCallingStationID     RADIUSAttributeType = 31
+	RADIUSAttributeTypeNASIdentifier        RADIUSAttributeType = 32
+	RADIUSAttributeTypeProxyState           RADIUSAttributeType = 33
+	RADIUSAttributeTypeAcctStatusType       RADIUSAttributeType = 40
+	RADIUSAttributeTypeAcctDelayTime        RADIUSAttributeType = 41
+	RADIUSAttributeTypeAcctInputOctets      RADIUSAttributeType = 42
+	RADIUSAttributeTypeAcctOutputOctets     RADIUSAttributeType = 43
+	RADIUSAttributeTypeAcctSessionID        RADIUSAttributeType = 44
+	RADIUSAttributeTypeAcctAuthentic        RADIUSAttributeType = 45
+	RADIUSAttributeTypeAcctSessionTime      RADIUSAttributeType = 46
+	RADIUSAttributeTypeAcctInputPackets     RADIUSAttributeType = 47
+	RADIUSAttributeTypeAcctOutputPackets    RADIUSAttributeType = 48
+	RADIUSAttributeTypeAcctTerminateCause   RADIUSAttributeType = 49
+	RADIUSAttributeTypeEventTimestamp       RADIUSAttributeType = 55
+	RADIUSAttributeTypeNASPortType          RADIUSAttributeType = 61
+	RADIUSAttributeTypeTunnelType           RADIUSAttributeType = 64
+	RADIUSAttributeTypeTunnelMediumType     RADIUSAttributeType = 65
+	RADIUSAttributeTypeConnectInfo          RADIUSAttributeType = 77
+	RADIUSAttributeTypeEAPMessage           RADIUSAttributeType = 79
+	RADIUSAttributeTypeMessageAuthenticator RADIUSAttributeType = 80
+	RADIUSAttributeTypeTunnelPrivateGroupID RADIUSAttributeType = 81
+	RADIUSAttributeTypeNASPortID            RADIUSAttributeType = 87
+	RADIUSAttributeTypeNASIPv6Address       RADIUSAttributeType = 95
+)
+
+func (t RADIUSAttributeType) String() string {
+	switch t {
+	case RADIUSAttributeTypeUserName:
+		return "User-Name"
+	case RADIUSAttributeTypeUserPassword:
+		return "User-Password"
+	case RADIUSAttributeTypeCHAPPassword:
+		return "CHAP-Password"
+	case RADIUSAttributeTypeNASIPAddress:
+		return "NAS-IP-Address"
+	case RADIUSAttributeTypeNASPort:
+		return "NAS-Port"
+	case RADIUSAttributeTypeServiceType:
+		return "Service-Type"
+	case RADIUSAttributeTypeFramedProtocol:
+		return "Framed-Protocol"
+	case RADIUSAttributeTypeFramedIPAddress:
+		return "Framed-IP-Address"
+	case RADIUSAttributeTypeFilterID:
+		return "Filter-Id"
+	case RADIUSAttributeTypeFramedMTU:
+		return "Framed-MTU"
+	case RADIUSAttributeTypeReplyMessage:
+		return "Reply-Message"
+	case RADIUSAttributeTypeState:
+		return "State"
+	case RADIUSAttributeTypeClass:
+		return "Class"
+	case RADIUSAttributeTypeVendorSpecific:
+		return "Vendor-Specific"
+	case RADIUSAttributeTypeSessionTimeout:
+		return "Session-Timeout"
+	case RADIUSAttributeTypeIdleTimeout:
+		return "Idle-Timeout"
+	case RADIUSAttributeTypeCalledStationID:
+		return "Called-Station-Id"
+	case RADIUSAttributeTypeCallingStationID:
+		return "Calling-Station-Id"
+	case RADIUSAttributeTypeNASIdentifier:
+		return "NAS-Identifier"
+	case RADIUSAttributeTypeProxyState:
+		return "Proxy-State"
+	case RADIUSAttributeTypeAcctStatusType:
+		return "Acct-Status-Type"
+	case RADIUSAttributeTypeAcctDelayTime:
+		return "Acct-Delay-Time"
+	case RADIUSAttributeTypeAcctInputOctets:
+		return "Acct-Input-Octets"
+	case RADIUSAttributeTypeAcctOutputOctets:
+		return "Acct-Output-Octets"
+	case RADIUSAttributeTypeAcctSessionID:
+		return "Acct-Session-Id"
+	case RADIUSAttributeTypeAcctAuthentic:
+		return "Acct-Authentic"
+	case RADIUSAttributeTypeAcctSessionTime:
+		return "Acct-Session-Time"
+	case RADIUSAttributeTypeAcctInputPackets:
+		return "Acct-Input-Packets"
+	case RADIUSAttributeTypeAcctOutputPackets:
+		return "Acct-Output-Packets"
+	case RADIUSAttributeTypeAcctTerminateCause:
+		return "Acct-Terminate-Cause"
+	case RADIUSAttributeTypeEventTimestamp:
+		return "Event-Timestamp"
+	case RADIUSAttributeTypeNASPortType:
+		return "NAS-Port-Type"
+	case RADIUSAttributeTypeTunnelType:
+		return "Tunnel-Type"
+	case RADIUSAttributeTypeTunnelMediumType:
+		return "Tunnel-Medium-Type"
+	case RADIUSAttributeTypeConnectInfo:
+		return "Connect-Info"
+	case RADIUSAttributeTypeEAPMessage:
+		return "EAP-Message"
+	case RADIUSAttributeTypeMessageAuthenticator:
+		return "Message-Authenticator"
+	case RADIUSAttributeTypeTunnelPrivateGroupID:
+		return "Tunnel-Private-Group-Id"
+	case RADIUSAttributeTypeNASPortID:
+		return "NAS-Port-Id"
+	case RADIUSAttributeTypeNASIPv6Address:
+		return "NAS-IPv6-Address"
+	default:
+		return fmt.Sprintf("UnknownRADIUSAttributeType(%d)", uint8(t))
+	}
+}
+
+// RADIUSAttribute is an attribute of a RADIUS packet.  Length includes the
+// type and length bytes.
+type RADIUSAttribute struct {
+	Type   RADIUSAttributeType
+	Length uint8
+	Value  []byte
+}
+
+// Integer returns the value of an attribute of the integer data type,
+// like NAS-Port or Session-Timeout.
+func (a RADIUSAttribute) Integer() (uint32, error) {
+	if len(a.Value) != 4 {
+		return 0, fmt.Errorf("RADIUS %v attribute of %d bytes isn't an integer", a.Type, len(a.Value))
+	}
+	return binary.BigEndian.Uint32(a.Value), nil
+}
+
+// IP returns the value of an attribute of the IPv4 or IPv6 address data
+// type, like NAS-IP-Address.
+func (a RADIUSAttribute) IP() (net.IP, error) {
+	if len(a.Value) != net.IPv4len && len(a.Value) != net.IPv6len {
+		return nil, fmt.Errorf("RADIUS %v attribute of %d bytes isn't an address", a.Type, len(a.Value))
+	}
+	return net.IP(a.Value), nil
+}
+
+// RADIUSVendorSpecific is the value of a Vendor-Specific attribute, with
+// which vendors define attributes of their own.
+type RADIUSVendorSpecific struct {
+	// VendorID is the vendor's IANA enterprise number, like 9 for Cisco or
+	// 311 for Microsoft.
+	VendorID uint32
+	Data     []byte
+	// Attributes holds Data decoded as the vendor's attributes, in the
+	// format RFC 2865 suggests, which is that of RADIUS attributes.  It's
+	// nil when Data isn't in that format.
+	Attributes []RADIUSVendorAttribute
+}
+
+// RADIUSVendorAttribute is an attribute of a vendor.
+type RADIUSVendorAttribute struct {
+	Type  uint8
+	Value []byte
+}
+
+// VendorSpecific decodes a Vendor-Specific attribute.
+func (a RADIUSAttribute) VendorSpecific() (RADIUSVendorSpecific, error) {
+	if a.Type != RADIUSAttributeTypeVendorSpecific {
+		return RADIUSVendorSpecific{}, fmt.Errorf("RADIUS attribute %v isn't Vendor-Specific", a.Type)
+	}
+	if len(a.Value) < 5 {
+		return RADIUSVendorSpecific{}, errors.New("RADIUS Vendor-Specific attribute too short")
+	}
+	v := RADIUSVendorSpecific{VendorID: binary.BigEndian.Uint32(a.Value), Data: a.Value[4:]}
+	for b := v.Data; len(b) > 0; {
+		if len(b) < 2 || b[1] < 2 || len(b) < int(b[1]) {
+			v.Attributes = nil
+			break
+		}
+		v.Attributes = append(v.Attributes, RADIUSVendorAttribute{Type: b[0], Value: b[2:b[1]]})
+		b = b[b[1]:]
+	}
+	return v, nil
+}
+
+// RADIUS is a RADIUS packet (RFC 2865), with which network access servers,
+// like switches, access points and VPN concentrators, ask servers to
+// authenticate users and authorize their access, and report accounting
+// (RFC 2866).  For 802.1X, the EAP packets between the supplicant and the
+// server are carried in EAP-Message attributes, split across several when
+// they're over 253 bytes; the layer's payload is the EAP packet, joined
+// again, which decodes as an EAP layer.
+type RADIUS struct {
+	BaseLayer
+	Code       RADIUSCode
+	Identifier uint8
+	Length     uint16
+	// Authenticator is random in Access-Requests, and in other packets an
+	// MD5 hash, which needs the shared secret to check.
+	Authenticator [16]byte
+	Attributes    []RADIUSAttribute
+}
+
+// LayerType returns LayerTypeRADIUS.
+func (r *RADIUS) LayerType() gopacket.LayerType { return LayerTypeRADIUS }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (r *RADIUS) CanDecode() gopacket.LayerClass { return LayerTypeRADIUS }
+
+// NextLayerType returns LayerTypeEAP if r has EAP-Message attributes.
+func (r *RADIUS) NextLayerType() gopacket.LayerType {
+	if len(r.BaseLayer.Payload) > 0 {
+		return LayerTypeEAP
+	}
+	return gopacket.LayerTypeZero
+}
+
+// Payload returns the EAP packet of r's EAP-Message attributes, or nil if
+// it has none.
+func (r *RADIUS) Payload() []byte { return r.BaseLayer.Payload }
+
+func decodeRADIUS(data []byte, p gopacket.PacketBuilder) error {
+	r := &RADIUS{}
+	if err := r.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(r)
+	p.SetApplicationLayer(r)
+	if len(r.BaseLayer.Payload) == 0 {
+		return nil
+	}
+	return p.NextDecoder(LayerTypeEAP)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (r *RADIUS) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 20 {
+		df.SetTruncated()
+		return fmt.Errorf("RADIUS length %d too short", len(data))
+	}
+	r.Code = RADIUSCode(data[0])
+	r.Identifier = data[1]
+	r.Length = binary.BigEndian.Uint16(data[2:4])
+	switch {
+	case r.Length < 20:
+		return fmt.Errorf("RADIUS packet length %d too short", r.Length)
+	case int(r.Length) > len(data):
+		df.SetTruncated()
+		return fmt.Errorf("RADIUS packet length %d exceeds %d bytes available", r.Length, len(data))
+	}
+	copy(r.Authenticator[:], data[4:20])
+	r.Attributes = r.Attributes[:0]
+	for b := data[20:r.Length]; len(b) > 0; {
+		if len(b) < 2 || b[1] < 2 || len(b) < int(b[1]) {
+			return errors.New("RADIUS attribute truncated")
+		}
+		r.Attributes = append(r.Attributes, RADIUSAttribute{Type: RADIUSAttributeType(b[0]), Length: b[1], Value: b[2:b[1]]})
+		b = b[b[1]:]
+	}
+	// Bytes past Length are padding, and ignored (RFC 2865 section 3).
+	r.BaseLayer = BaseLayer{Contents: data[:r.Length], Payload: r.EAPMessage()}
+	return nil
+}
+
+// Attribute returns the first attribute of type t.
+func (r *RADIUS) Attribute(t RADIUSAttributeType) (RADIUSAttribute, bool) {
+	for _, a := range r.Attributes {
+		if a.Type == t {
+			return a, true
+		}
+	}
+	return RADIUSAttribute{}, false
+}
+
+// EAPMessage returns the EAP packet r carries: the values of its
+// EAP-Message attributes, joined in order, or nil if it has none.
+func (r *RADIUS) EAPMessage() []byte {
+	var parts [][]byte
+	n := 0
+	for _, a := range r.Attributes {
+		if a.Type == RADIUSAttributeTypeEAPMessage {
+			parts = append(parts, a.Value)
+			n += len(a.Value)
+		}
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	var msg []byte
+	if n > 0 {
+		msg = make([]byte, 0, n)
+	}
+	for _, p := range parts {
+		msg = append(msg, p...)
+	}
+	return msg
+}
+
+// NewRADIUSEAPMessage returns the EAP-Message attributes that carry the
+// EAP packet eap, split into values of at most 253 bytes.
+func NewRADIUSEAPMessage(eap []byte) []RADIUSAttribute {
+	var attrs []RADIUSAttribute
+	for len(eap) > 0 {
+		n := len(eap)
+		if n > 253 {
+			n = 253
+		}
+		attrs = append(attrs, RADIUSAttribute{Type: RADIUSAttributeTypeEAPMessage, Length: uint8(n + 2), Value: eap[:n]})
+		eap = eap[n:]
+	}
+	return attrs
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.  The
+// authenticator is written as it is; computing it needs the shared
+// secret.
+func (r *RADIUS) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	n := 20
+	for _, a := range r.Attributes {
+		if len(a.Value) > 253 {
+			return fmt.Errorf("RADIUS %v attribute of %d bytes too long", a.Type, len(a.Value))
+		}
+		n += 2 + len(a.Value)
+	}
+	if n > 4096 {
+		return fmt.Errorf("RADIUS packet length %d over 4096", n)
+	}
+	data, err := b.PrependBytes(n)
+	if err != nil {
+		return err
+	}
+	if opts.FixLengths {
+		r.Length = uint16(n)
+	}
+	data[0] = byte(r.Code)
+	data[1] = r.Identifier
+	binary.BigEndian.PutUint16(data[2:4], r.Length)
+	copy(data[4:20], r.Authenticator[:])
+	off := 20
+	for i := range r.Attributes {
+		a := &r.Attributes[i]
+		if opts.FixLengths {
+			a.Length = uint8(2 + len(a.Value))
+		}
+		data[off] = byte(a.Type)
+		data[off+1] = a.Length
+		copy(data[off+2:], a.Value)
+		off += 2 + len(a.Value)
+	}
+	return nil
+}
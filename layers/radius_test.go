@@ -0,0 +1,120 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func TestRADIUSAccessRequestEAP(t *testing.T) {
+	// An EAP-TLS response too long for one attribute.
+	eap := make([]byte, 600)
+	eap[0], eap[1], eap[2], eap[3], eap[4] = byte(EAPCodeResponse), 7, 600>>8, 600&0xff, 13
+	for i := 5; i < len(eap); i++ {
+		eap[i] = byte(i)
+	}
+	cisco := []byte{0, 0, 0, 9, 1, 11, 'a', 'b', 'c', '=', 'd', 'e', 'f', 'g', 'h'}
+	req := &RADIUS{
+		Code:          RADIUSCodeAccessRequest,
+		Identifier:    42,
+		Authenticator: [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		Attributes: []RADIUSAttribute{
+			{Type: RADIUSAttributeTypeUserName, Value: []byte("alice")},
+			{Type: RADIUSAttributeTypeNASIPAddress, Value: []byte{10, 0, 0, 5}},
+			{Type: RADIUSAttributeTypeNASPort, Value: []byte{0, 0, 0, 12}},
+			{Type: RADIUSAttributeTypeVendorSpecific, Value: cisco},
+		},
+	}
+	req.Attributes = append(req.Attributes, NewRADIUSEAPMessage(eap)...)
+	req.Attributes = append(req.Attributes, RADIUSAttribute{Type: RADIUSAttributeTypeMessageAuthenticator, Value: make([]byte, 16)})
+
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 5}, DstIP: net.IP{10, 0, 0, 1}}
+	udp := &UDP{SrcPort: 50000, DstPort: 1812}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, req); err != nil {
+		t.Fatal(err)
+	}
+	if want := 20 + 7 + 6 + 6 + 17 + 3*2 + 600 + 18; int(req.Length) != want {
+		t.Errorf("got length %d, want %d", req.Length, want)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeRADIUS, LayerTypeEAP}, t)
+
+	got := p.Layer(LayerTypeRADIUS).(*RADIUS)
+	if got.Code != RADIUSCodeAccessRequest || got.Identifier != 42 || got.Authenticator != req.Authenticator {
+		t.Errorf("got header %v %d %x", got.Code, got.Identifier, got.Authenticator)
+	}
+	if len(got.Attributes) != len(req.Attributes) {
+		t.Fatalf("got %d attributes, want %d", len(got.Attributes), len(req.Attributes))
+	}
+	if !bytes.Equal(got.EAPMessage(), eap) {
+		t.Error("EAP message not reassembled")
+	}
+	if a, ok := got.Attribute(RADIUSAttributeTypeUserName); !ok || string(a.Value) != "alice" {
+		t.Errorf("got User-Name %q", a.Value)
+	}
+	a, _ := got.Attribute(RADIUSAttributeTypeNASIPAddress)
+	if ip, err := a.IP(); err != nil || !ip.Equal(net.IP{10, 0, 0, 5}) {
+		t.Errorf("got NAS-IP-Address %v, %v", ip, err)
+	}
+	a, _ = got.Attribute(RADIUSAttributeTypeNASPort)
+	if n, err := a.Integer(); err != nil || n != 12 {
+		t.Errorf("got NAS-Port %d, %v", n, err)
+	}
+
+	a, _ = got.Attribute(RADIUSAttributeTypeVendorSpecific)
+	vsa, err := a.VendorSpecific()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RADIUSVendorSpecific{VendorID: 9, Data: cisco[4:], Attributes: []RADIUSVendorAttribute{{1, []byte("abc=defgh")}}}
+	if !reflect.DeepEqual(vsa, want) {
+		t.Errorf("got vendor specific %+v, want %+v", vsa, want)
+	}
+
+	e := p.Layer(LayerTypeEAP).(*EAP)
+	if e.Code != EAPCodeResponse || e.Id != 7 || e.Type != EAPType(13) || !bytes.Equal(e.TypeData, eap[5:]) {
+		t.Errorf("got EAP %v %d %v with %d bytes", e.Code, e.Id, e.Type, len(e.TypeData))
+	}
+}
+
+func TestRADIUSDecodeErrors(t *testing.T) {
+	accept := []byte{
+		2, 1, 0, 26, // Access-Accept, length 26
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		27, 6, 0, 0, 14, 16, // Session-Timeout 3600
+		0, 0, // padding past the length
+	}
+	r := &RADIUS{}
+	if err := r.DecodeFromBytes(accept, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Contents) != 26 || len(r.Attributes) != 1 || r.Payload() != nil || r.NextLayerType() != gopacket.LayerTypeZero {
+		t.Errorf("got %+v", r)
+	}
+
+	bad := append([]byte(nil), accept[:26]...)
+	bad[21] = 7 // attribute past the packet length
+	for _, b := range [][]byte{accept[:19], accept[:25], bad} {
+		if err := (&RADIUS{}).DecodeFromBytes(b, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("decoded %x without error", b)
+		}
+	}
+	if _, err := (RADIUSAttribute{Type: RADIUSAttributeTypeVendorSpecific, Value: []byte{0, 0, 0, 9}}).VendorSpecific(); err == nil {
+		t.Error("decoded empty vendor specific attribute without error")
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/mistsys/gopacket"
+)
+
+const (
+	ripHeaderLength = 4
+	ripEntryLength  = 20
+	// ripAuthFamily is the address family of RIPv2 authentication entries.
+	ripAuthFamily = 0xffff
+)
+
+// RIPCommand is the command of a RIP message.
+type RIPCommand uint8
+
+const (
+	RIPCommandRequest  RIPCommand = 1
+	RIPCommandResponse RIPCommand = 2
+)
+
+func (c RIPCommand) String() string {
+	switch c {
+	case RIPCommandRequest:
+		return "Request"
+	case RIPCommandResponse:
+		return "Response"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(c))
+}
+
+// RIPAuthType is the type of RIPv2 authentication.
+type RIPAuthType uint16
+
+const (
+	RIPAuthTypeSimplePassword RIPAuthType = 2
+	RIPAuthTypeKeyedMD5       RIPAuthType = 3
+)
+
+func (t RIPAuthType) String() string {
+	switch t {
+	case RIPAuthTypeSimplePassword:
+		return "SimplePassword"
+	case RIPAuthTypeKeyedMD5:
+		return "KeyedMD5"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint16(t))
+}
+
+// RIPMetricInfinity is the metric of unreachable routes.
+const RIPMetricInfinity = 16
+
+// RIPEntry is a route entry of a RIP message.  RouteTag, Mask and NextHop
+// are only set in RIPv2; a zero next hop means the sender itself.
+type RIPEntry struct {
+	AddressFamily uint16
+	RouteTag      uint16
+	IP            net.IP
+	Mask          net.IPMask
+	NextHop       net.IP
+	Metric        uint32
+}
+
+// RIPAuthentication is the authentication of a RIPv2 message.  Password is
+// set for simple password authentication.  The other fields are set for
+// keyed MD5, whose digest follows the route entries.
+type RIPAuthentication struct {
+	Type           RIPAuthType
+	Password       []byte
+	PacketLength   uint16
+	KeyID          uint8
+	AuthDataLength uint8
+	SequenceNumber uint32
+	AuthData       []byte
+}
+
+// RIP is a RIP version 1 or 2 message.
+type RIP struct {
+	BaseLayer
+	Command        RIPCommand
+	Version        uint8
+	Authentication *RIPAuthentication
+	Entries        []RIPEntry
+}
+
+// LayerType returns LayerTypeRIP.
+func (r *RIP) LayerType() gopacket.LayerType { return LayerTypeRIP }
+
+func (r *RIP) CanDecode() gopacket.LayerClass { return LayerTypeRIP }
+
+func (r *RIP) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// Payload returns nil; RIP messages carry no payload.
+func (r *RIP) Payload() []byte { return nil }
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (r *RIP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < ripHeaderLength {
+		df.SetTruncated()
+		return fmt.Errorf("RIP length %d too short", len(data))
+	}
+	*r = RIP{
+		BaseLayer: BaseLayer{Contents: data},
+		Command:   RIPCommand(data[0]),
+		Version:   data[1],
+	}
+	if r.Version != 1 && r.Version != 2 {
+		return fmt.Errorf("RIP version %d unsupported", r.Version)
+	}
+	b := data[ripHeaderLength:]
+	if r.Version == 2 && len(b) >= ripEntryLength && binary.BigEndian.Uint16(b[0:2]) == ripAuthFamily {
+		r.Authentication = &RIPAuthentication{Type: RIPAuthType(binary.BigEndian.Uint16(b[2:4]))}
+		auth := b[4:ripEntryLength]
+		switch r.Authentication.Type {
+		case RIPAuthTypeSimplePassword:
+			r.Authentication.Password = auth
+		case RIPAuthTypeKeyedMD5:
+			a := r.Authentication
+			a.PacketLength = binary.BigEndian.Uint16(auth[0:2])
+			a.KeyID = auth[2]
+			a.AuthDataLength = auth[3]
+			a.SequenceNumber = binary.BigEndian.Uint32(auth[4:8])
+			// The digest trails the entries, in an entry of its own
+			// family and type 1, and is not counted in the packet length.
+			if int(a.PacketLength) < ripHeaderLength+ripEntryLength || int(a.PacketLength)+4 > len(data) {
+				return fmt.Errorf("RIP MD5 packet length %d invalid for %d bytes", a.PacketLength, len(data))
+			}
+			a.AuthData = data[a.PacketLength+4:]
+			b = data[ripHeaderLength:a.PacketLength]
+		default:
+			return fmt.Errorf("RIP authentication type %v unsupported", r.Authentication.Type)
+		}
+		b = b[ripEntryLength:]
+	}
+	if len(b)%ripEntryLength != 0 {
+		return fmt.Errorf("RIP entries length %d is not a multiple of %d", len(b), ripEntryLength)
+	}
+	for ; len(b) > 0; b = b[ripEntryLength:] {
+		e := RIPEntry{
+			AddressFamily: binary.BigEndian.Uint16(b[0:2]),
+			IP:            net.IP(b[4:8]),
+			Metric:        binary.BigEndian.Uint32(b[16:20]),
+		}
+		if r.Version == 2 {
+			e.RouteTag = binary.BigEndian.Uint16(b[2:4])
+			e.Mask = net.IPMask(b[8:12])
+			e.NextHop = net.IP(b[12:16])
+		}
+		r.Entries = append(r.Entries, e)
+	}
+	return nil
+}
+
+// WholeTableRequest returns true if r requests the sender's whole routing
+// table.
+func (r *RIP) WholeTableRequest() bool {
+	return r.Command == RIPCommandRequest && len(r.Entries) == 1 &&
+		r.Entries[0].AddressFamily == 0 && r.Entries[0].Metric == RIPMetricInfinity
+}
+
+func decodeRIP(data []byte, p gopacket.PacketBuilder) error {
+	r := &RIP{}
+	if err := r.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(r)
+	p.SetApplicationLayer(r)
+	return nil
+}
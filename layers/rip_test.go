@@ -0,0 +1,89 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// ripPacket returns a RIP message sent to the RIP port over UDP.
+func ripPacket(t *testing.T, rip []byte) gopacket.Packet {
+	buf := gopacket.NewSerializeBuffer()
+	ip := &IPv4{Version: 4, TTL: 1, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{224, 0, 0, 9}}
+	udp := &UDP{SrcPort: 520, DstPort: 520}
+	udp.SetNetworkLayerForChecksum(ip)
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		ip, udp, gopacket.Payload(rip)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeRIP}, t)
+	return p
+}
+
+func TestPacketRIPv1(t *testing.T) {
+	p := ripPacket(t, []byte{
+		0x02, 0x01, 0x00, 0x00,
+		0x00, 0x02, 0x00, 0x00, 0x0a, 0x01, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x02, 0x00, 0x00, 0xc0, 0xa8, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0x00, 0x00, 0x00, 0x10,
+	})
+	rip := p.ApplicationLayer().(*RIP)
+	if rip.Command != RIPCommandResponse || rip.Version != 1 || rip.Authentication != nil || len(rip.Entries) != 2 {
+		t.Fatalf("got %+v", rip)
+	}
+	want := RIPEntry{AddressFamily: 2, IP: net.IP{192, 168, 0, 0}, Metric: RIPMetricInfinity}
+	if !reflect.DeepEqual(rip.Entries[1], want) {
+		t.Errorf("got entry %+v, want %+v", rip.Entries[1], want)
+	}
+}
+
+func TestPacketRIPv2Password(t *testing.T) {
+	data := []byte{0x02, 0x02, 0x00, 0x00, 0xff, 0xff, 0x00, 0x02}
+	data = append(data, []byte("secret\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")...)
+	data = append(data, 0x00, 0x02, 0x00, 0x07, 0x0a, 0x01, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x0a, 0x00, 0x00, 0xfe, 0x00, 0x00, 0x00, 0x02)
+	rip := ripPacket(t, data).ApplicationLayer().(*RIP)
+	if a := rip.Authentication; a == nil || a.Type != RIPAuthTypeSimplePassword || !bytes.HasPrefix(a.Password, []byte("secret")) {
+		t.Fatalf("got authentication %+v", rip.Authentication)
+	}
+	want := []RIPEntry{{
+		AddressFamily: 2,
+		RouteTag:      7,
+		IP:            net.IP{10, 1, 0, 0},
+		Mask:          net.IPMask{255, 255, 0, 0},
+		NextHop:       net.IP{10, 0, 0, 254},
+		Metric:        2,
+	}}
+	if !reflect.DeepEqual(rip.Entries, want) {
+		t.Errorf("got entries %+v, want %+v", rip.Entries, want)
+	}
+}
+
+func TestPacketRIPv2MD5(t *testing.T) {
+	data := []byte{
+		0x01, 0x02, 0x00, 0x00,
+		0xff, 0xff, 0x00, 0x03, 0x00, 0x2c, 0x05, 0x14, 0x00, 0x00, 0x01, 0x00, 0, 0, 0, 0, 0, 0, 0, 0,
+		0x00, 0x00, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x00, 0x00, 0x00, 0x10,
+		0xff, 0xff, 0x00, 0x01,
+	}
+	digest := bytes.Repeat([]byte{0xab}, 16)
+	rip := ripPacket(t, append(data, digest...)).ApplicationLayer().(*RIP)
+	a := rip.Authentication
+	if a == nil || a.Type != RIPAuthTypeKeyedMD5 || a.KeyID != 5 || a.AuthDataLength != 20 || a.SequenceNumber != 256 || !bytes.Equal(a.AuthData, digest) {
+		t.Fatalf("got authentication %+v", a)
+	}
+	if !rip.WholeTableRequest() {
+		t.Errorf("got entries %+v", rip.Entries)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// RTag is the 802.1CB redundancy tag, which frame replication and
+// elimination for reliability (FRER) adds to frames so that a receiver can
+// discard the duplicates sent over redundant paths.
+type RTag struct {
+	BaseLayer
+	Reserved       uint16
+	SequenceNumber uint16
+	Type           EthernetType
+}
+
+// LayerType returns LayerTypeRTag.
+func (r *RTag) LayerType() gopacket.LayerType { return LayerTypeRTag }
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (r *RTag) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 6 {
+		df.SetTruncated()
+		return fmt.Errorf("R-TAG length %d too short", len(data))
+	}
+	r.Reserved = binary.BigEndian.Uint16(data[0:2])
+	r.SequenceNumber = binary.BigEndian.Uint16(data[2:4])
+	r.Type = EthernetType(binary.BigEndian.Uint16(data[4:6]))
+	r.BaseLayer = BaseLayer{Contents: data[:6], Payload: data[6:]}
+	return nil
+}
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (r *RTag) CanDecode() gopacket.LayerClass {
+	return LayerTypeRTag
+}
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (r *RTag) NextLayerType() gopacket.LayerType {
+	return r.Type.LayerType()
+}
+
+func decodeRTag(data []byte, p gopacket.PacketBuilder) error {
+	return decodingLayerDecoder(&RTag{}, data, p)
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+// See the docs for gopacket.SerializableLayer for more info.
+func (r *RTag) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	bytes, err := b.PrependBytes(6)
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint16(bytes[0:2], r.Reserved)
+	binary.BigEndian.PutUint16(bytes[2:4], r.SequenceNumber)
+	binary.BigEndian.PutUint16(bytes[4:6], uint16(r.Type))
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testPacketRTag is a VLAN tagged UDP packet with an 802.1CB R-TAG.
+var testPacketRTag = []byte{
+	0x01, 0x00, 0x5e, 0x00, 0x00, 0x01, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x81, 0x00,
+	0x60, 0x0a, 0xf1, 0xc1,
+	0x00, 0x00, 0x12, 0x34, 0x08, 0x00,
+	0x45, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x00, 0x40, 0x11, 0xc4, 0xc9,
+	0xc0, 0xa8, 0x01, 0x01, 0xe0, 0x00, 0x00, 0x01,
+	0x13, 0x88, 0x13, 0x88, 0x00, 0x0c, 0x00, 0x00,
+	0x64, 0x61, 0x74, 0x61,
+	0x00, 0x00, 0x00, 0x00,
+}
+
+func TestRTag(t *testing.T) {
+	p := gopacket.NewPacket(testPacketRTag, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeDot1Q, LayerTypeRTag, LayerTypeIPv4, LayerTypeUDP, gopacket.LayerTypePayload}, t)
+	r := p.Layer(LayerTypeRTag).(*RTag)
+	if r.SequenceNumber != 0x1234 || r.Type != EthernetTypeIPv4 || r.Reserved != 0 {
+		t.Errorf("got R-TAG %+v", r)
+	}
+	if ip := p.NetworkLayer().(*IPv4); !ip.DstIP.Equal(net.IPv4(224, 0, 0, 1)) {
+		t.Errorf("got IPv4 %+v", ip)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	err := gopacket.SerializeLayers(buf, opts,
+		p.Layer(LayerTypeEthernet).(*Ethernet),
+		p.Layer(LayerTypeDot1Q).(*Dot1Q),
+		r,
+		p.NetworkLayer().(*IPv4),
+		p.TransportLayer().(*UDP),
+		gopacket.Payload("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), testPacketRTag) {
+		t.Errorf("serialization mismatch:\ngot  %x\nwant %x", buf.Bytes(), testPacketRTag)
+	}
+}
+
+func TestRTagTruncated(t *testing.T) {
+	p := gopacket.NewPacket([]byte{0, 0, 0, 1, 0x08}, LayerTypeRTag, gopacket.Default)
+	if p.ErrorLayer() == nil || !p.Metadata().Truncated {
+		t.Error("want truncated decode error")
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// RTCPType is the packet type of an RTCP packet.
+type RTCPType uint8
+
+// RTCP packet types (RFC 3550, RFC 3611 and RFC 4585).
+const (
+	RTCPTypeSenderReport       RTCPType = 200
+	RTCPTypeReceiverReport     RTCPType = 201
+	RTCPTypeSourceDescription  RTCPType = 202
+	RTCPTypeGoodbye            RTCPType = 203
+	RTCPTypeApplicationDefined RTCPType = 204
+	RTCPTypeTransportFeedback  RTCPType = 205
+	RTCPTypePayloadFeedback    RTCPType = 206
+	RTCPTypeExtendedReport     RTCPType = 207
+)
+
+func (t RTCPType) String() string {
+	switch t {
+	case RTCPTypeSenderReport:
+		return "SR"
+	case RTCPTypeReceiverReport:
+		return "RR"
+	case RTCPTypeSourceDescription:
+		return "SDES"
+	case RTCPTypeGoodbye:
+		return "BYE"
+	case RTCPTypeApplicationDefined:
+		return "APP"
+	case RTCPTypeTransportFeedback:
+		return "RTPFB"
+	case RTCPTypePayloadFeedback:
+		return "PSFB"
+	case RTCPTypeExtendedReport:
+		return "XR"
+	default:
+		return fmt.Sprintf("UnknownRTCPType(%d)", t)
+	}
+}
+
+// RTCPSDESType is the type of an item of a source description.
+type RTCPSDESType uint8
+
+// RTCP source description item types (RFC 3550 section 6.5).
+const (
+	RTCPSDESTypeCNAME RTCPSDESType = 1
+	RTCPSDESTypeName  RTCPSDESType = 2
+	RTCPSDESTypeEmail RTCPSDESType = 3
+	RTCPSDESTypePhone RTCPSDESType = 4
+	RTCPSDESTypeLoc   RTCPSDESType = 5
+	RTCPSDESTypeTool  RTCPSDESType = 6
+	RTCPSDESTypeNote  RTCPSDESType = 7
+	RTCPSDESTypePriv  RTCPSDESType = 8
+)
+
+func (t RTCPSDESType) String() string {
+	switch t {
+	case RTCPSDESTypeCNAME:
+		return "CNAME"
+	case RTCPSDESTypeName:
+		return "NAME"
+	case RTCPSDESTypeEmail:
+		return "EMAIL"
+	case RTCPSDESTypePhone:
+		return "PHONE"
+	case RTCPSDESTypeLoc:
+		return "LOC"
+	case RTCPSDESTypeTool:
+		return "TOOL"
+	case RTCPSDESTypeNote:
+		return "NOTE"
+	case RTCPSDESTypePriv:
+		return "PRIV"
+	default:
+		return fmt.Sprintf("UnknownRTCPSDESType(%d)", t)
+	}
+}
+
+// RTCPSenderInfo is the sender information of a sender report.
+type RTCPSenderInfo struct {
+	// NTPTimestamp is the wall-clock time of the report.
+	NTPTimestamp NTPTimestamp
+	RTPTimestamp uint32
+	PacketCount  uint32
+	OctetCount   uint32
+}
+
+// RTCPReportBlock is a reception report about the source SSRC, sent in
+// sender and receiver reports.
+type RTCPReportBlock struct {
+	SSRC uint32
+	// FractionLost is the fixed point (n/256) loss fraction since the
+	// previous report.
+	FractionLost uint8
+	// PacketsLost is the cumulative number of packets lost, which is
+	// negative if duplicates outnumber losses.
+	PacketsLost     int32
+	HighestSequence uint32
+	// Jitter is the interarrival jitter in RTP timestamp units.
+	Jitter uint32
+	// LastSR is the middle 32 bits of the NTP timestamp of the last sender
+	// report from the source, and DelaySinceLastSR the time since.
+	LastSR           uint32
+	DelaySinceLastSR NTPFixed16Seconds
+}
+
+// RoundTrip returns the round trip time to the reporter, as seen by the
+// source receiving the report at arrival (RFC 3550 section 6.4.1).  It
+// returns zero if the reporter has seen no sender report.
+func (b *RTCPReportBlock) RoundTrip(arrival time.Time) time.Duration {
+	if b.LastSR == 0 {
+		return 0
+	}
+	secs := uint64(arrival.Unix() + ntpEpochOffset)
+	frac := uint64(arrival.Nanosecond()) << 32 / 1e9
+	a := uint32(secs<<16 | frac>>16)
+	rtt := int32(a - b.LastSR - uint32(b.DelaySinceLastSR))
+	if rtt < 0 {
+		return 0
+	}
+	return NTPFixed16Seconds(rtt).Duration()
+}
+
+// RTCPSDESItem is an item of a source description.
+type RTCPSDESItem struct {
+	Type RTCPSDESType
+	Text string
+}
+
+// RTCPSDESChunk is the source description of one source.
+type RTCPSDESChunk struct {
+	Source uint32
+	Items  []RTCPSDESItem
+}
+
+// RTCPPacket is one packet of an RTCP compound packet.
+type RTCPPacket struct {
+	Padding bool
+	// Count is the number of report blocks, chunks or sources, or for APP
+	// and feedback packets the subtype or feedback message type.
+	Count uint8
+	Type  RTCPType
+	// Length is the length of the packet in 32 bit words, minus one.
+	Length uint16
+	// SSRC is the sender of reports, APP, feedback and extended report
+	// packets.
+	SSRC uint32
+
+	// SenderInfo is set for sender reports, and Reports for sender and
+	// receiver reports.
+	SenderInfo *RTCPSenderInfo
+	Reports    []RTCPReportBlock
+	// Chunks is set for source descriptions.
+	Chunks []RTCPSDESChunk
+	// Sources and Reason are set for BYE packets.
+	Sources []uint32
+	Reason  string
+	// Body is what follows the fields above, without padding: profile
+	// extensions of reports, and the bodies of other packet types.
+	Body []byte
+}
+
+// RTCP is an RTCP compound packet (RFC 3550 section 6), which carries
+// reception statistics and source descriptions for RTP sessions.  Like
+// RTP, it's found on negotiated ports; see RTP for how it's decoded.
+type RTCP struct {
+	BaseLayer
+	Packets []RTCPPacket
+}
+
+// LayerType returns LayerTypeRTCP.
+func (r *RTCP) LayerType() gopacket.LayerType { return LayerTypeRTCP }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (r *RTCP) CanDecode() gopacket.LayerClass { return LayerTypeRTCP }
+
+// NextLayerType returns LayerTypeZero, since RTCP carries no payload.
+func (r *RTCP) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// Payload returns nil.
+func (r *RTCP) Payload() []byte { return nil }
+
+// CNAME returns the canonical name of the source with the given SSRC, from
+// the source descriptions of r.
+func (r *RTCP) CNAME(ssrc uint32) (string, bool) {
+	for _, p := range r.Packets {
+		for _, c := range p.Chunks {
+			if c.Source != ssrc {
+				continue
+			}
+			for _, it := range c.Items {
+				if it.Type == RTCPSDESTypeCNAME {
+					return it.Text, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+func decodeRTCP(data []byte, p gopacket.PacketBuilder) error {
+	r := &RTCP{}
+	if err := r.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(r)
+	p.SetApplicationLayer(r)
+	return nil
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (r *RTCP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	r.Packets = r.Packets[:0]
+	for rest := data; len(rest) > 0; {
+		if len(rest) < 4 {
+			df.SetTruncated()
+			return errors.New("RTCP header truncated")
+		}
+		if v := rest[0] >> 6; v != 2 {
+			return fmt.Errorf("RTCP version %d unsupported", v)
+		}
+		pk := RTCPPacket{
+			Padding: rest[0]&0x20 != 0,
+			Count:   rest[0] & 0x1f,
+			Type:    RTCPType(rest[1]),
+			Length:  binary.BigEndian.Uint16(rest[2:4]),
+		}
+		n := 4 * (int(pk.Length) + 1)
+		if len(rest) < n {
+			df.SetTruncated()
+			return fmt.Errorf("RTCP %v packet length %d exceeds %d bytes", pk.Type, n, len(rest))
+		}
+		body := rest[4:n]
+		rest = rest[n:]
+		if pk.Padding {
+			// Only the last packet of a compound packet may be padded.
+			if len(rest) > 0 {
+				return fmt.Errorf("RTCP %v packet padded before the end", pk.Type)
+			}
+			if len(body) == 0 || body[len(body)-1] == 0 || int(body[len(body)-1]) > len(body) {
+				return fmt.Errorf("RTCP %v padding invalid", pk.Type)
+			}
+			body = body[:len(body)-int(body[len(body)-1])]
+		}
+		if err := pk.decodeBody(body); err != nil {
+			return err
+		}
+		r.Packets = append(r.Packets, pk)
+	}
+	if len(r.Packets) == 0 {
+		return errors.New("RTCP packet empty")
+	}
+	r.BaseLayer = BaseLayer{Contents: data}
+	return nil
+}
+
+func (pk *RTCPPacket) decodeBody(body []byte) error {
+	pk.Body = nil
+	switch pk.Type {
+	case RTCPTypeSenderReport, RTCPTypeReceiverReport:
+		n := 4 + 24*int(pk.Count)
+		if pk.Type == RTCPTypeSenderReport {
+			n += 20
+		}
+		if len(body) < n {
+			return fmt.Errorf("RTCP %v of %d reports too short", pk.Type, pk.Count)
+		}
+		pk.SSRC = binary.BigEndian.Uint32(body[:4])
+		body = body[4:]
+		if pk.Type == RTCPTypeSenderReport {
+			pk.SenderInfo = &RTCPSenderInfo{
+				NTPTimestamp: NTPTimestamp(binary.BigEndian.Uint64(body[:8])),
+				RTPTimestamp: binary.BigEndian.Uint32(body[8:12]),
+				PacketCount:  binary.BigEndian.Uint32(body[12:16]),
+				OctetCount:   binary.BigEndian.Uint32(body[16:20]),
+			}
+			body = body[20:]
+		}
+		for i := 0; i < int(pk.Count); i++ {
+			b := body[24*i:]
+			lost := binary.BigEndian.Uint32(b[4:8])
+			pk.Reports = append(pk.Reports, RTCPReportBlock{
+				SSRC:             binary.BigEndian.Uint32(b[:4]),
+				FractionLost:     uint8(lost >> 24),
+				PacketsLost:      int32(lost<<8) >> 8,
+				HighestSequence:  binary.BigEndian.Uint32(b[8:12]),
+				Jitter:           binary.BigEndian.Uint32(b[12:16]),
+				LastSR:           binary.BigEndian.Uint32(b[16:20]),
+				DelaySinceLastSR: NTPFixed16Seconds(binary.BigEndian.Uint32(b[20:24])),
+			})
+		}
+		pk.Body = body[24*int(pk.Count):]
+	case RTCPTypeSourceDescription:
+		for i := 0; i < int(pk.Count); i++ {
+			c, n, err := decodeRTCPSDESChunk(body)
+			if err != nil {
+				return err
+			}
+			pk.Chunks = append(pk.Chunks, c)
+			body = body[n:]
+		}
+	case RTCPTypeGoodbye:
+		if len(body) < 4*int(pk.Count) {
+			return fmt.Errorf("RTCP BYE of %d sources too short", pk.Count)
+		}
+		for i := 0; i < int(pk.Count); i++ {
+			pk.Sources = append(pk.Sources, binary.BigEndian.Uint32(body[4*i:]))
+		}
+		body = body[4*int(pk.Count):]
+		if len(body) > 0 {
+			l := int(body[0])
+			if 1+l > len(body) {
+				return errors.New("RTCP BYE reason truncated")
+			}
+			pk.Reason = string(body[1 : 1+l])
+		}
+	default:
+		if len(body) >= 4 {
+			pk.SSRC = binary.BigEndian.Uint32(body[:4])
+		}
+		pk.Body = body
+	}
+	return nil
+}
+
+// decodeRTCPSDESChunk decodes the source description chunk at the start of
+// data, and returns it and its length including the padding to a 32 bit
+// boundary.
+func decodeRTCPSDESChunk(data []byte) (RTCPSDESChunk, int, error) {
+	var c RTCPSDESChunk
+	if len(data) < 4 {
+		return c, 0, errors.New("RTCP SDES chunk truncated")
+	}
+	c.Source = binary.BigEndian.Uint32(data[:4])
+	off := 4
+	for {
+		if off >= len(data) {
+			return c, 0, errors.New("RTCP SDES chunk unterminated")
+		}
+		if data[off] == 0 {
+			// The list ends with a null item, padded to 32 bits.
+			off = (off + 4) &^ 3
+			if off > len(data) {
+				return c, 0, errors.New("RTCP SDES chunk unterminated")
+			}
+			return c, off, nil
+		}
+		if off+2 > len(data) || off+2+int(data[off+1]) > len(data) {
+			return c, 0, errors.New("RTCP SDES item truncated")
+		}
+		l := int(data[off+1])
+		c.Items = append(c.Items, RTCPSDESItem{Type: RTCPSDESType(data[off]), Text: string(data[off+2 : off+2+l])})
+		off += 2 + l
+	}
+}
+
+// rtcpCompoundValid returns whether the headers of data's RTCP packets are
+// valid and their lengths add up to data's.
+func rtcpCompoundValid(data []byte) bool {
+	for len(data) > 0 {
+		if len(data) < 4 || data[0]>>6 != 2 || data[1] < 192 || data[1] > 223 {
+			return false
+		}
+		n := 4 * (int(binary.BigEndian.Uint16(data[2:4])) + 1)
+		if n > len(data) {
+			return false
+		}
+		data = data[n:]
+	}
+	return true
+}
@@ -0,0 +1,317 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/mistsys/gopacket"
+)
+
+// RTPExtension is an element of an RFC 8285 header extension.
+type RTPExtension struct {
+	ID   uint8
+	Data []byte
+}
+
+// RTP is the header of an RTP packet (RFC 3550), whose payload is the
+// media.
+//
+// RTP runs on ports negotiated by signaling, so UDP doesn't decode it by
+// port number unless the port has been added with AddRTPPortHint, for
+// instance from the session descriptions of SIP (see SDP.RTPEndpoints).
+// Otherwise decode UDP payloads with the decoder of LayerTypeRTP, which
+// also decodes RTCP multiplexed on the same port (RFC 5761), or use
+// ClassifyRTP to pick out RTP and RTCP.
+type RTP struct {
+	BaseLayer
+	Version     uint8
+	Padding     bool
+	Extension   bool
+	Marker      bool
+	PayloadType uint8
+	Sequence    uint16
+	Timestamp   uint32
+	SSRC        uint32
+	CSRC        []uint32
+	// ExtensionProfile and ExtensionData are the header extension, present
+	// if Extension is set.  Extensions holds its elements if the profile
+	// is one of the RFC 8285 one-byte or two-byte forms.
+	ExtensionProfile uint16
+	ExtensionData    []byte
+	Extensions       []RTPExtension
+	// PaddingLength is the number of padding bytes after the payload.
+	PaddingLength uint8
+}
+
+// LayerType returns LayerTypeRTP.
+func (r *RTP) LayerType() gopacket.LayerType { return LayerTypeRTP }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (r *RTP) CanDecode() gopacket.LayerClass { return LayerTypeRTP }
+
+// NextLayerType returns LayerTypePayload, since the media encoding is
+// given by signaling rather than the packet.
+func (r *RTP) NextLayerType() gopacket.LayerType { return gopacket.LayerTypePayload }
+
+// Payload returns the media, without padding.
+func (r *RTP) Payload() []byte { return r.BaseLayer.Payload }
+
+// ExtensionElement returns the data of the header extension element with the
+// given ID.
+func (r *RTP) ExtensionElement(id uint8) ([]byte, bool) {
+	for _, e := range r.Extensions {
+		if e.ID == id {
+			return e.Data, true
+		}
+	}
+	return nil, false
+}
+
+func decodeRTP(data []byte, p gopacket.PacketBuilder) error {
+	if isRTCP(data) {
+		return decodeRTCP(data, p)
+	}
+	r := &RTP{}
+	if err := r.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(r)
+	p.SetApplicationLayer(r)
+	return p.NextDecoder(gopacket.LayerTypePayload)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (r *RTP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 12 {
+		df.SetTruncated()
+		return fmt.Errorf("RTP packet of %d bytes too short", len(data))
+	}
+	r.Version = data[0] >> 6
+	if r.Version != 2 {
+		return fmt.Errorf("RTP version %d unsupported", r.Version)
+	}
+	r.Padding = data[0]&0x20 != 0
+	r.Extension = data[0]&0x10 != 0
+	r.Marker = data[1]&0x80 != 0
+	r.PayloadType = data[1] & 0x7f
+	r.Sequence = binary.BigEndian.Uint16(data[2:4])
+	r.Timestamp = binary.BigEndian.Uint32(data[4:8])
+	r.SSRC = binary.BigEndian.Uint32(data[8:12])
+	n := 12 + 4*int(data[0]&0x0f)
+	if len(data) < n {
+		df.SetTruncated()
+		return errors.New("RTP CSRC list truncated")
+	}
+	r.CSRC = r.CSRC[:0]
+	for off := 12; off < n; off += 4 {
+		r.CSRC = append(r.CSRC, binary.BigEndian.Uint32(data[off:off+4]))
+	}
+
+	r.ExtensionProfile, r.ExtensionData, r.Extensions = 0, nil, nil
+	if r.Extension {
+		if len(data) < n+4 {
+			df.SetTruncated()
+			return errors.New("RTP header extension truncated")
+		}
+		r.ExtensionProfile = binary.BigEndian.Uint16(data[n : n+2])
+		l := 4 * int(binary.BigEndian.Uint16(data[n+2:n+4]))
+		n += 4
+		if len(data) < n+l {
+			df.SetTruncated()
+			return errors.New("RTP header extension truncated")
+		}
+		r.ExtensionData = data[n : n+l]
+		n += l
+		var err error
+		if r.Extensions, err = decodeRTPExtensions(r.ExtensionProfile, r.ExtensionData); err != nil {
+			return err
+		}
+	}
+
+	end := len(data)
+	r.PaddingLength = 0
+	if r.Padding {
+		r.PaddingLength = data[end-1]
+		if r.PaddingLength == 0 || int(r.PaddingLength) > end-n {
+			return fmt.Errorf("RTP padding length %d invalid", r.PaddingLength)
+		}
+		end -= int(r.PaddingLength)
+	}
+	r.BaseLayer = BaseLayer{Contents: data[:n], Payload: data[n:end]}
+	return nil
+}
+
+// decodeRTPExtensions decodes the elements of a header extension in the
+// RFC 8285 one-byte (profile 0xBEDE) or two-byte (0x100X) forms.  Other
+// profiles have no elements.
+func decodeRTPExtensions(profile uint16, data []byte) ([]RTPExtension, error) {
+	oneByte := profile == 0xbede
+	if !oneByte && profile&0xfff0 != 0x1000 {
+		return nil, nil
+	}
+	var out []RTPExtension
+	for len(data) > 0 {
+		if data[0] == 0 {
+			// Padding between elements.
+			data = data[1:]
+			continue
+		}
+		var id uint8
+		var l, hl int
+		if oneByte {
+			id, l, hl = data[0]>>4, int(data[0]&0x0f)+1, 1
+			if id == 15 {
+				// The rest of the extension isn't to be decoded.
+				break
+			}
+		} else {
+			if len(data) < 2 {
+				return out, errors.New("RTP header extension element truncated")
+			}
+			id, l, hl = data[0], int(data[1]), 2
+		}
+		if len(data) < hl+l {
+			return out, fmt.Errorf("RTP header extension element %d truncated", id)
+		}
+		out = append(out, RTPExtension{ID: id, Data: data[hl : hl+l]})
+		data = data[hl+l:]
+	}
+	return out, nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.  The header
+// extension is written from ExtensionProfile and ExtensionData, whose
+// length must be a multiple of four bytes, and Extensions is ignored.
+// Padding is written if PaddingLength is set.
+func (r *RTP) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	if len(r.CSRC) > 15 {
+		return fmt.Errorf("RTP CSRC list of %d too long", len(r.CSRC))
+	}
+	if len(r.ExtensionData)%4 != 0 || len(r.ExtensionData) > 4*0xffff {
+		return fmt.Errorf("RTP header extension of %d bytes invalid", len(r.ExtensionData))
+	}
+	if r.PaddingLength > 0 {
+		pad, err := b.AppendBytes(int(r.PaddingLength))
+		if err != nil {
+			return err
+		}
+		for i := range pad {
+			pad[i] = 0
+		}
+		pad[len(pad)-1] = r.PaddingLength
+	}
+	n := 12 + 4*len(r.CSRC)
+	if r.Extension || len(r.ExtensionData) > 0 {
+		n += 4 + len(r.ExtensionData)
+	}
+	data, err := b.PrependBytes(n)
+	if err != nil {
+		return err
+	}
+	if opts.FixLengths {
+		r.Padding = r.PaddingLength > 0
+		r.Extension = r.Extension || len(r.ExtensionData) > 0
+	}
+	data[0] = 2<<6 | uint8(len(r.CSRC))
+	if r.Padding {
+		data[0] |= 0x20
+	}
+	if r.Extension {
+		data[0] |= 0x10
+	}
+	data[1] = r.PayloadType & 0x7f
+	if r.Marker {
+		data[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(data[2:4], r.Sequence)
+	binary.BigEndian.PutUint32(data[4:8], r.Timestamp)
+	binary.BigEndian.PutUint32(data[8:12], r.SSRC)
+	off := 12
+	for _, c := range r.CSRC {
+		binary.BigEndian.PutUint32(data[off:off+4], c)
+		off += 4
+	}
+	if off < n {
+		binary.BigEndian.PutUint16(data[off:off+2], r.ExtensionProfile)
+		binary.BigEndian.PutUint16(data[off+2:off+4], uint16(len(r.ExtensionData)/4))
+		copy(data[off+4:], r.ExtensionData)
+	}
+	return nil
+}
+
+// ClassifyRTP returns LayerTypeRTP or LayerTypeRTCP if data looks like an
+// RTP or RTCP packet, and otherwise LayerTypePayload.  RTCP is told apart
+// from RTP by its packet type (RFC 5761 section 4), and must be a compound
+// packet whose lengths add up.  STUN, DTLS and other protocols multiplexed
+// with RTP (RFC 7983) aren't version 2 RTP.
+//
+// Since RTP has no magic number, short or random payloads may pass;
+// restrict classification to flows that are expected to carry media.
+func ClassifyRTP(data []byte) gopacket.LayerType {
+	if len(data) < 8 || data[0]>>6 != 2 {
+		return gopacket.LayerTypePayload
+	}
+	if isRTCP(data) {
+		if rtcpCompoundValid(data) {
+			return LayerTypeRTCP
+		}
+		return gopacket.LayerTypePayload
+	}
+	r := &RTP{}
+	if r.DecodeFromBytes(data, gopacket.NilDecodeFeedback) != nil {
+		return gopacket.LayerTypePayload
+	}
+	return LayerTypeRTP
+}
+
+// isRTCP returns whether data's second byte is an RTCP packet type in the
+// range RFC 5761 reserves, which RTP payload types mustn't collide with.
+func isRTCP(data []byte) bool {
+	return len(data) >= 2 && data[1] >= 192 && data[1] <= 223
+}
+
+var rtpPortHints = struct {
+	sync.RWMutex
+	ports map[UDPPort]int
+}{ports: map[UDPPort]int{}}
+
+// AddRTPPortHint makes UDP decode datagrams to or from port as RTP or
+// RTCP, if ClassifyRTP recognizes them, when the port has no well-known
+// layer type.  Hints are counted, so a port added for two media streams
+// stays hinted until it has been removed twice.  It's safe to call while
+// packets are being decoded.
+func AddRTPPortHint(port UDPPort) {
+	rtpPortHints.Lock()
+	rtpPortHints.ports[port]++
+	rtpPortHints.Unlock()
+}
+
+// RemoveRTPPortHint removes a hint added by AddRTPPortHint.
+func RemoveRTPPortHint(port UDPPort) {
+	rtpPortHints.Lock()
+	if rtpPortHints.ports[port] <= 1 {
+		delete(rtpPortHints.ports, port)
+	} else {
+		rtpPortHints.ports[port]--
+	}
+	rtpPortHints.Unlock()
+}
+
+// rtpPortHinted returns whether either port was added by AddRTPPortHint.
+func rtpPortHinted(src, dst UDPPort) bool {
+	rtpPortHints.RLock()
+	defer rtpPortHints.RUnlock()
+	if len(rtpPortHints.ports) == 0 {
+		return false
+	}
+	return rtpPortHints.ports[src] > 0 || rtpPortHints.ports[dst] > 0
+}
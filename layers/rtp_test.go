@@ -0,0 +1,169 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testRTPPacket is a G.711 packet with a CSRC, a one-byte header extension
+// carrying an audio level (ID 1) and a transport sequence number (ID 3),
+// and two bytes of padding.
+var testRTPPacket = []byte{
+	0xb1, 0x80, 0x12, 0x34, 0x00, 0x00, 0x03, 0x20, 0xde, 0xad, 0xbe, 0xef,
+	0x01, 0x02, 0x03, 0x04,
+	0xbe, 0xde, 0x00, 0x02, 0x10, 0x85, 0x31, 0x00, 0x2a, 0x00, 0x00, 0x00,
+	0xd5, 0xd5, 0xd5, 0xd5,
+	0x00, 0x02,
+}
+
+// testRTCPCompound is a receiver report with one report block, a source
+// description with a CNAME and a BYE with a reason.
+var testRTCPCompound = []byte{
+	0x81, 0xc9, 0x00, 0x07, 0x11, 0x11, 0x11, 0x11,
+	0xde, 0xad, 0xbe, 0xef, 0x40, 0xff, 0xff, 0xfe, 0x00, 0x01, 0x12, 0x40,
+	0x00, 0x00, 0x00, 0x50, 0x12, 0x34, 0x56, 0x78, 0x00, 0x01, 0x00, 0x00,
+	0x81, 0xca, 0x00, 0x03, 0x11, 0x11, 0x11, 0x11,
+	0x01, 0x05, 'a', '@', 'h', 'o', 's', 0x00,
+	0xa1, 0xcb, 0x00, 0x03, 0x11, 0x11, 0x11, 0x11,
+	0x03, 'b', 'y', 'e', 0x00, 0x00, 0x00, 0x04,
+}
+
+func TestRTPDecode(t *testing.T) {
+	var r RTP
+	if err := r.DecodeFromBytes(testRTPPacket, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Marker || r.PayloadType != 0 || r.Sequence != 0x1234 || r.Timestamp != 800 || r.SSRC != 0xdeadbeef {
+		t.Errorf("got header %+v", r)
+	}
+	if !reflect.DeepEqual(r.CSRC, []uint32{0x01020304}) {
+		t.Errorf("got CSRC %x", r.CSRC)
+	}
+	want := []RTPExtension{{1, []byte{0x85}}, {3, []byte{0x00, 0x2a}}}
+	if r.ExtensionProfile != 0xbede || !reflect.DeepEqual(r.Extensions, want) {
+		t.Errorf("got extension %#x %+v, want %+v", r.ExtensionProfile, r.Extensions, want)
+	}
+	if level, ok := r.ExtensionElement(1); !ok || level[0]&0x7f != 5 {
+		t.Errorf("got audio level %x", level)
+	}
+	if r.PaddingLength != 2 || !bytes.Equal(r.Payload(), []byte{0xd5, 0xd5, 0xd5, 0xd5}) {
+		t.Errorf("got payload %x with %d bytes of padding", r.Payload(), r.PaddingLength)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, &r, gopacket.Payload(r.Payload())); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), testRTPPacket) {
+		t.Errorf("serialized\n%x, want\n%x", buf.Bytes(), testRTPPacket)
+	}
+
+	for _, b := range [][]byte{
+		testRTPPacket[:11],
+		testRTPPacket[:14],
+		testRTPPacket[:22],
+		append([]byte{0x40}, testRTPPacket[1:]...),
+		append(append([]byte{}, testRTPPacket[:len(testRTPPacket)-1]...), 0x40),
+	} {
+		if err := (&RTP{}).DecodeFromBytes(b, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("decoded %x without error", b)
+		}
+	}
+}
+
+func TestRTCPDecode(t *testing.T) {
+	p := gopacket.NewPacket(testRTCPCompound, LayerTypeRTP, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeRTCP}, t)
+	r := p.Layer(LayerTypeRTCP).(*RTCP)
+	if len(r.Packets) != 3 {
+		t.Fatalf("got %d packets, want 3", len(r.Packets))
+	}
+	rr := r.Packets[0]
+	wantBlock := RTCPReportBlock{SSRC: 0xdeadbeef, FractionLost: 64, PacketsLost: -2, HighestSequence: 0x11240,
+		Jitter: 80, LastSR: 0x12345678, DelaySinceLastSR: 0x10000}
+	if rr.Type != RTCPTypeReceiverReport || rr.SSRC != 0x11111111 || !reflect.DeepEqual(rr.Reports, []RTCPReportBlock{wantBlock}) {
+		t.Errorf("got receiver report %+v", rr)
+	}
+	if name, ok := r.CNAME(0x11111111); !ok || name != "a@hos" {
+		t.Errorf("got CNAME %q", name)
+	}
+	bye := r.Packets[2]
+	if bye.Type != RTCPTypeGoodbye || !reflect.DeepEqual(bye.Sources, []uint32{0x11111111}) || bye.Reason != "bye" {
+		t.Errorf("got BYE %+v", bye)
+	}
+
+	sr := []byte{
+		0x80, 0xc8, 0x00, 0x06, 0x22, 0x22, 0x22, 0x22,
+		0xda, 0xa7, 0x3f, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0x20,
+		0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x03, 0x20,
+	}
+	r = &RTCP{}
+	if err := r.DecodeFromBytes(sr, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	wantInfo := &RTCPSenderInfo{NTPTimestamp: 0xdaa73f0080000000, RTPTimestamp: 800, PacketCount: 5, OctetCount: 800}
+	if pk := r.Packets[0]; pk.Type != RTCPTypeSenderReport || pk.SSRC != 0x22222222 || !reflect.DeepEqual(pk.SenderInfo, wantInfo) || len(pk.Reports) != 0 {
+		t.Errorf("got sender report %+v", pk)
+	}
+
+	// The round trip is the arrival time less LastSR and the delay.
+	lsr := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := RTCPReportBlock{LastSR: uint32((lsr.Unix() + ntpEpochOffset) << 16), DelaySinceLastSR: 1 << 15}
+	if rtt := b.RoundTrip(lsr.Add(600 * time.Millisecond)); rtt < 99*time.Millisecond || rtt > 101*time.Millisecond {
+		t.Errorf("got round trip %v, want 100ms", rtt)
+	}
+
+	for _, b := range [][]byte{
+		testRTCPCompound[:30],
+		testRTCPCompound[:len(testRTCPCompound)-1],
+		append([]byte{0x41}, testRTCPCompound[1:]...),
+		// A padded packet before the end.
+		append([]byte{0xa1}, testRTCPCompound[1:]...),
+	} {
+		if err := (&RTCP{}).DecodeFromBytes(b, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("decoded %x without error", b)
+		}
+	}
+}
+
+func TestRTPPortHint(t *testing.T) {
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{192, 0, 2, 10}, DstIP: net.IP{198, 51, 100, 1}}
+	packet := func(port UDPPort, payload []byte) gopacket.Packet {
+		udp := &UDP{SrcPort: 30000, DstPort: port}
+		udp.SetNetworkLayerForChecksum(ip)
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+		if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload(payload)); err != nil {
+			t.Fatal(err)
+		}
+		return gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	}
+
+	checkLayers(packet(49170, testRTPPacket), []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, gopacket.LayerTypePayload}, t)
+	AddRTPPortHint(49170)
+	AddRTPPortHint(49171)
+	AddRTPPortHint(49171)
+	defer RemoveRTPPortHint(49171)
+	checkLayers(packet(49170, testRTPPacket), []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeRTP, gopacket.LayerTypePayload}, t)
+	checkLayers(packet(49170, []byte{0, 1, 0, 0, 0x21, 0x12, 0xa4, 0x42}), []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, gopacket.LayerTypePayload}, t)
+	checkLayers(packet(49171, testRTCPCompound), []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeRTCP}, t)
+	checkLayers(packet(49170, testSTUNBytes(t, testSTUNResponse)), []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeSTUN}, t)
+	RemoveRTPPortHint(49170)
+	RemoveRTPPortHint(49171)
+	checkLayers(packet(49170, testRTPPacket), []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, gopacket.LayerTypePayload}, t)
+	checkLayers(packet(49171, testRTCPCompound), []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeRTCP}, t)
+}
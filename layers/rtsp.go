@@ -0,0 +1,423 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mistsys/gopacket"
+)
+
+// RTSPHeader is a header field of an RTSP message.
+type RTSPHeader struct {
+	Name, Value string
+}
+
+// RTSPParam is a parameter of a Transport header field.
+type RTSPParam struct {
+	Name, Value string
+}
+
+// RTSPTransport is one of the transports in a Transport header field: one
+// offered by a SETUP request, or the one chosen in its response.
+type RTSPTransport struct {
+	// Protocol is the transport protocol, profile and lower transport,
+	// like "RTP/AVP" or "RTP/AVP/TCP".
+	Protocol  string
+	Multicast bool
+	// Interleaved, ClientPort and ServerPort are the one or two numbers of
+	// the interleaved channel and port ranges, the first for RTP and the
+	// second for RTCP.  They're empty if not given.
+	Interleaved []int
+	ClientPort  []int
+	ServerPort  []int
+	Destination string
+	Source      string
+	SSRC        string
+	Params      []RTSPParam
+}
+
+// RTSP is an RTSP request or response (RFC 2326 and RFC 7826), which sets
+// up and controls media streams, most commonly from IP cameras.  A DESCRIBE
+// response's body is decoded as LayerTypeSDP.
+//
+// RTP and RTCP may be sent over the RTSP connection itself, in frames
+// decoded as RTSPInterleaved.  Only the message or frame at the start of a
+// TCP segment is decoded; use RTSPStream to decode all of a reassembled
+// connection.
+type RTSP struct {
+	BaseLayer
+	IsResponse bool
+	// Method and RequestURI are set for requests.
+	Method     string
+	RequestURI string
+	// StatusCode and Reason are set for responses.
+	StatusCode int
+	Reason     string
+	Version    string
+	Headers    []RTSPHeader
+
+	CSeq int
+	// Session is the session identifier, and SessionTimeout the timeout in
+	// seconds given with it, or zero.
+	Session        string
+	SessionTimeout int
+	Transports     []RTSPTransport
+	ContentType    string
+	ContentLength  int
+}
+
+// LayerType returns LayerTypeRTSP.
+func (r *RTSP) LayerType() gopacket.LayerType { return LayerTypeRTSP }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (r *RTSP) CanDecode() gopacket.LayerClass { return LayerTypeRTSP }
+
+// NextLayerType returns LayerTypeSDP if the body is a session
+// description, and otherwise LayerTypePayload if there is a body.
+func (r *RTSP) NextLayerType() gopacket.LayerType {
+	switch {
+	case len(r.BaseLayer.Payload) == 0:
+		return gopacket.LayerTypeZero
+	case strings.EqualFold(strings.TrimSpace(strings.SplitN(r.ContentType, ";", 2)[0]), "application/sdp"):
+		return LayerTypeSDP
+	default:
+		return gopacket.LayerTypePayload
+	}
+}
+
+// Payload returns the message body.
+func (r *RTSP) Payload() []byte { return r.BaseLayer.Payload }
+
+// Header returns the value of the first header field with the given name.
+// Names are case insensitive.
+func (r *RTSP) Header(name string) (string, bool) {
+	for _, h := range r.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value, true
+		}
+	}
+	return "", false
+}
+
+// RTSPInterleaved is a frame of binary data interleaved in an RTSP
+// connection (RFC 2326 section 10.12), which carries RTP or RTCP on the
+// channel given by the Transport header field of the SETUP exchange.
+type RTSPInterleaved struct {
+	BaseLayer
+	Channel uint8
+	Length  uint16
+}
+
+// LayerType returns LayerTypeRTSPInterleaved.
+func (r *RTSPInterleaved) LayerType() gopacket.LayerType { return LayerTypeRTSPInterleaved }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (r *RTSPInterleaved) CanDecode() gopacket.LayerClass { return LayerTypeRTSPInterleaved }
+
+// NextLayerType returns LayerTypeRTP or LayerTypeRTCP if the frame holds
+// one, as classified by ClassifyRTP, and otherwise LayerTypePayload.
+func (r *RTSPInterleaved) NextLayerType() gopacket.LayerType {
+	return ClassifyRTP(r.BaseLayer.Payload)
+}
+
+// Payload returns the frame's data.
+func (r *RTSPInterleaved) Payload() []byte { return r.BaseLayer.Payload }
+
+// DecodeFromBytes decodes the given bytes into this layer.  Bytes after
+// the frame are ignored.
+func (r *RTSPInterleaved) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return errors.New("RTSP interleaved frame header truncated")
+	}
+	if data[0] != '$' {
+		return fmt.Errorf("RTSP interleaved frame starts with %#x", data[0])
+	}
+	r.Channel = data[1]
+	r.Length = binary.BigEndian.Uint16(data[2:4])
+	if len(data) < 4+int(r.Length) {
+		df.SetTruncated()
+		return fmt.Errorf("RTSP interleaved frame length %d exceeds %d bytes", r.Length, len(data)-4)
+	}
+	r.BaseLayer = BaseLayer{Contents: data[:4], Payload: data[4 : 4+int(r.Length)]}
+	return nil
+}
+
+func decodeRTSP(data []byte, p gopacket.PacketBuilder) error {
+	if len(data) > 0 && data[0] == '$' {
+		f := &RTSPInterleaved{}
+		if err := f.DecodeFromBytes(data, p); err != nil {
+			return err
+		}
+		p.AddLayer(f)
+		return p.NextDecoder(f.NextLayerType())
+	}
+	// A TCP segment that doesn't start with a message, like one continuing
+	// a message split across segments, is left as payload.
+	if !isRTSPMessage(data) {
+		return gopacket.DecodePayload.Decode(data, p)
+	}
+	r := &RTSP{}
+	if err := r.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(r)
+	p.SetApplicationLayer(r)
+	next := r.NextLayerType()
+	if next == gopacket.LayerTypeZero {
+		return nil
+	}
+	return p.NextDecoder(next)
+}
+
+// isRTSPMessage returns true if data starts with an RTSP request or status
+// line.
+func isRTSPMessage(data []byte) bool {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return false
+	}
+	line := string(bytes.TrimRight(data[:i], "\r"))
+	if strings.HasPrefix(line, "RTSP/") {
+		return true
+	}
+	f := strings.Fields(line)
+	return len(f) == 3 && strings.HasPrefix(f[2], "RTSP/") && rtspIsMethod(f[0])
+}
+
+// rtspIsMethod returns true if s is a method name: upper case letters and
+// underscores, as in GET_PARAMETER.
+func rtspIsMethod(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if (s[i] < 'A' || s[i] > 'Z') && s[i] != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.  The body
+// extends for Content-Length bytes, and bytes after it are ignored.
+func (r *RTSP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	*r = RTSP{}
+	n := sipHeaderEnd(data)
+	if n < 0 {
+		df.SetTruncated()
+		return errors.New("RTSP header not terminated by an empty line")
+	}
+	lines := strings.Split(strings.TrimRight(string(data[:n]), "\r\n"), "\n")
+	if err := r.decodeStartLine(strings.TrimRight(lines[0], "\r")); err != nil {
+		return err
+	}
+	for _, l := range lines[1:] {
+		l = strings.TrimRight(l, "\r")
+		i := strings.IndexByte(l, ':')
+		if i <= 0 {
+			return fmt.Errorf("RTSP header field %q malformed", l)
+		}
+		h := RTSPHeader{Name: strings.TrimSpace(l[:i]), Value: strings.TrimSpace(l[i+1:])}
+		r.Headers = append(r.Headers, h)
+		if err := r.decodeHeader(h); err != nil {
+			return fmt.Errorf("RTSP %s header field invalid: %v", h.Name, err)
+		}
+	}
+	if _, ok := r.Header("CSeq"); !ok {
+		return errors.New("RTSP message missing CSeq")
+	}
+	// Messages without Content-Length have no body.
+	body := data[n:]
+	if r.ContentLength > len(body) {
+		df.SetTruncated()
+		return fmt.Errorf("RTSP Content-Length %d exceeds %d bytes available", r.ContentLength, len(body))
+	}
+	r.BaseLayer = BaseLayer{Contents: data[:n], Payload: body[:r.ContentLength]}
+	return nil
+}
+
+func (r *RTSP) decodeStartLine(line string) error {
+	if strings.HasPrefix(line, "RTSP/") {
+		f := strings.SplitN(line, " ", 3)
+		if len(f) < 2 {
+			return fmt.Errorf("RTSP status line %q malformed", line)
+		}
+		code, err := strconv.Atoi(f[1])
+		if err != nil || code < 100 || code > 999 {
+			return fmt.Errorf("RTSP status code %q invalid", f[1])
+		}
+		r.IsResponse, r.Version, r.StatusCode = true, f[0], code
+		if len(f) == 3 {
+			r.Reason = f[2]
+		}
+		return nil
+	}
+	f := strings.Fields(line)
+	if len(f) != 3 || !strings.HasPrefix(f[2], "RTSP/") || !rtspIsMethod(f[0]) {
+		return fmt.Errorf("RTSP request line %q malformed", line)
+	}
+	r.Method, r.RequestURI, r.Version = f[0], f[1], f[2]
+	return nil
+}
+
+func (r *RTSP) decodeHeader(h RTSPHeader) error {
+	var err error
+	switch strings.ToLower(h.Name) {
+	case "cseq":
+		r.CSeq, err = strconv.Atoi(h.Value)
+	case "session":
+		f := strings.Split(h.Value, ";")
+		r.Session = strings.TrimSpace(f[0])
+		for _, p := range f[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(kv[0], "timeout") {
+				if r.SessionTimeout, err = strconv.Atoi(kv[1]); err != nil {
+					return err
+				}
+			}
+		}
+	case "transport":
+		for _, v := range strings.Split(h.Value, ",") {
+			t, err := decodeRTSPTransport(v)
+			if err != nil {
+				return err
+			}
+			r.Transports = append(r.Transports, t)
+		}
+	case "content-type":
+		r.ContentType = h.Value
+	case "content-length":
+		var n uint64
+		n, err = strconv.ParseUint(h.Value, 10, 31)
+		r.ContentLength = int(n)
+	}
+	return err
+}
+
+func decodeRTSPTransport(v string) (RTSPTransport, error) {
+	var t RTSPTransport
+	f := strings.Split(strings.TrimSpace(v), ";")
+	t.Protocol = strings.TrimSpace(f[0])
+	if t.Protocol == "" {
+		return t, errors.New("transport protocol missing")
+	}
+	for _, p := range f[1:] {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		var param RTSPParam
+		if i := strings.IndexByte(p, '='); i >= 0 {
+			param = RTSPParam{Name: p[:i], Value: strings.Trim(p[i+1:], `"`)}
+		} else {
+			param.Name = p
+		}
+		t.Params = append(t.Params, param)
+		var err error
+		switch strings.ToLower(param.Name) {
+		case "multicast":
+			t.Multicast = true
+		case "interleaved":
+			t.Interleaved, err = decodeRTSPRange(param.Value)
+		case "client_port":
+			t.ClientPort, err = decodeRTSPRange(param.Value)
+		case "server_port":
+			t.ServerPort, err = decodeRTSPRange(param.Value)
+		case "destination":
+			t.Destination = param.Value
+		case "source":
+			t.Source = param.Value
+		case "ssrc":
+			t.SSRC = param.Value
+		}
+		if err != nil {
+			return t, fmt.Errorf("transport %s invalid: %v", param.Name, err)
+		}
+	}
+	return t, nil
+}
+
+// decodeRTSPRange decodes a number or a range of two numbers, like
+// "0-1".
+func decodeRTSPRange(v string) ([]int, error) {
+	var out []int
+	for _, s := range strings.SplitN(v, "-", 2) {
+		n, err := strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, int(n))
+	}
+	return out, nil
+}
+
+// maxRTSPMessage is the largest message or interleaved frame RTSPStream
+// accepts.  Interleaved frames hold at most 64KB, and message bodies, such
+// as SDP, are much smaller.
+const maxRTSPMessage = 1 << 17
+
+// RTSPStream splits one direction of a reassembled RTSP connection into
+// messages and interleaved frames, including those split across TCP
+// segments.
+type RTSPStream struct {
+	buf streamBuffer
+}
+
+// Decode appends data from the stream and returns the messages (*RTSP) and
+// interleaved frames (*RTSPInterleaved) completed by it, in order.  After
+// an error, or a gap in the stream, call Reset before decoding more data.
+func (s *RTSPStream) Decode(data []byte) ([]gopacket.Layer, error) {
+	return s.buf.decode(data, "RTSP", maxRTSPMessage, rtspFrame)
+}
+
+// rtspFrame is the streamFramer of RTSPStream.
+func rtspFrame(data []byte) (int64, layerDecodingLayer, error) {
+	if data[0] == '$' {
+		if len(data) < 4 {
+			return 0, nil, nil
+		}
+		return 4 + int64(binary.BigEndian.Uint16(data[2:4])), &RTSPInterleaved{}, nil
+	}
+	h := sipHeaderEnd(data)
+	if h < 0 {
+		return 0, nil, nil
+	}
+	n, err := rtspContentLength(data[:h])
+	if err != nil {
+		return 0, nil, err
+	}
+	return int64(h) + n, &RTSP{}, nil
+}
+
+// rtspContentLength returns the value of the Content-Length header field
+// of a message's header, or zero if there is none.
+func rtspContentLength(header []byte) (int64, error) {
+	for _, l := range strings.Split(string(header), "\n") {
+		i := strings.IndexByte(l, ':')
+		if i <= 0 || !strings.EqualFold(strings.TrimSpace(l[:i]), "Content-Length") {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(l[i+1:]), 10, 31)
+		if err != nil {
+			return 0, fmt.Errorf("RTSP Content-Length invalid: %v", err)
+		}
+		return int64(n), nil
+	}
+	return 0, nil
+}
+
+// Reset discards any partial message.
+func (s *RTSPStream) Reset() {
+	s.buf.reset()
+}
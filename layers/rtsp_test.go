@@ -0,0 +1,159 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+const testRTSPDescribeSDP = "v=0\r\n" +
+	"o=- 1 1 IN IP4 192.0.2.20\r\n" +
+	"s=Camera\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"t=0 0\r\n" +
+	"m=video 0 RTP/AVP 96\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"a=control:trackID=1\r\n"
+
+var testRTSPDescribeReply = "RTSP/1.0 200 OK\r\n" +
+	"CSeq: 2\r\n" +
+	"Content-Base: rtsp://192.0.2.20/stream1/\r\n" +
+	"Content-Type: application/sdp\r\n" +
+	"Content-Length: " + strconv.Itoa(len(testRTSPDescribeSDP)) + "\r\n" +
+	"\r\n" + testRTSPDescribeSDP
+
+var testRTSPSetup = "SETUP rtsp://192.0.2.20/stream1/trackID=1 RTSP/1.0\r\n" +
+	"CSeq: 3\r\n" +
+	"Transport: RTP/AVP/TCP;unicast;interleaved=0-1, RTP/AVP;unicast;client_port=5000-5001\r\n" +
+	"\r\n"
+
+var testRTSPSetupReply = "RTSP/1.0 200 OK\r\n" +
+	"CSeq: 3\r\n" +
+	"Session: 12345678;timeout=60\r\n" +
+	"Transport: RTP/AVP/TCP;unicast;interleaved=0-1;ssrc=DEADBEEF\r\n" +
+	"\r\n"
+
+func testRTSPPacket(t *testing.T, payload []byte) gopacket.Packet {
+	setTCPPortLayerType(t, 554, LayerTypeRTSP)
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolTCP, SrcIP: net.IP{192, 0, 2, 20}, DstIP: net.IP{198, 51, 100, 1}}
+	tcp := &TCP{SrcPort: 554, DstPort: 40000, PSH: true, ACK: true, Window: 1024}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, tcp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	return p
+}
+
+func TestRTSPMessages(t *testing.T) {
+	p := testRTSPPacket(t, []byte(testRTSPDescribeReply))
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeTCP, LayerTypeRTSP, LayerTypeSDP}, t)
+	r := p.Layer(LayerTypeRTSP).(*RTSP)
+	if !r.IsResponse || r.StatusCode != 200 || r.Reason != "OK" || r.CSeq != 2 || r.Version != "RTSP/1.0" {
+		t.Errorf("got response %+v", r)
+	}
+	if v, ok := r.Header("content-base"); !ok || v != "rtsp://192.0.2.20/stream1/" {
+		t.Errorf("got Content-Base %q", v)
+	}
+
+	var setup RTSP
+	if err := setup.DecodeFromBytes([]byte(testRTSPSetup), gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	want := []RTSPTransport{
+		{Protocol: "RTP/AVP/TCP", Interleaved: []int{0, 1}, Params: []RTSPParam{{"unicast", ""}, {"interleaved", "0-1"}}},
+		{Protocol: "RTP/AVP", ClientPort: []int{5000, 5001}, Params: []RTSPParam{{"unicast", ""}, {"client_port", "5000-5001"}}},
+	}
+	if setup.Method != "SETUP" || setup.RequestURI != "rtsp://192.0.2.20/stream1/trackID=1" || !reflect.DeepEqual(setup.Transports, want) {
+		t.Errorf("got SETUP %+v", setup)
+	}
+	if setup.NextLayerType() != gopacket.LayerTypeZero {
+		t.Errorf("got next layer %v for message without body", setup.NextLayerType())
+	}
+
+	var reply RTSP
+	if err := reply.DecodeFromBytes([]byte(testRTSPSetupReply), gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Session != "12345678" || reply.SessionTimeout != 60 || len(reply.Transports) != 1 || reply.Transports[0].SSRC != "DEADBEEF" {
+		t.Errorf("got SETUP reply %+v", reply)
+	}
+
+	for _, m := range []string{
+		"",
+		"PLAY rtsp://h/ RTSP/1.0\r\nCSeq: 4\r\n",
+		"PLAY rtsp://h/ RTSP/1.0\r\n\r\n",
+		"play rtsp://h/ RTSP/1.0\r\nCSeq: 4\r\n\r\n",
+		"RTSP/1.0 OK\r\nCSeq: 4\r\n\r\n",
+		"SETUP rtsp://h/ RTSP/1.0\r\nCSeq: 4\r\nTransport: RTP/AVP;client_port=a-b\r\n\r\n",
+	} {
+		if err := (&RTSP{}).DecodeFromBytes([]byte(m), gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("decoded %q without error", m)
+		}
+	}
+}
+
+func TestRTSPInterleaved(t *testing.T) {
+	frame := append([]byte{'$', 0, 0, byte(len(testRTPPacket))}, testRTPPacket...)
+	p := testRTSPPacket(t, frame)
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeTCP, LayerTypeRTSPInterleaved, LayerTypeRTP, gopacket.LayerTypePayload}, t)
+	if f := p.Layer(LayerTypeRTSPInterleaved).(*RTSPInterleaved); f.Channel != 0 || int(f.Length) != len(testRTPPacket) {
+		t.Errorf("got frame %+v", f)
+	}
+	rtcp := append([]byte{'$', 1, 0, byte(len(testRTCPCompound))}, testRTCPCompound...)
+	checkLayers(testRTSPPacket(t, rtcp), []gopacket.LayerType{LayerTypeIPv4, LayerTypeTCP, LayerTypeRTSPInterleaved, LayerTypeRTCP}, t)
+
+	// A stream splits the SETUP reply and frames across segments.
+	data := append([]byte(testRTSPSetupReply), frame...)
+	data = append(data, rtcp...)
+	data = append(data, testRTSPDescribeReply...)
+	var s RTSPStream
+	var got []gopacket.LayerType
+	for _, chunk := range [][]byte{data[:10], data[10 : len(testRTSPSetupReply)+2], data[len(testRTSPSetupReply)+2 : len(data)-50], data[len(data)-50:]} {
+		ls, err := s.Decode(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range ls {
+			got = append(got, l.LayerType())
+		}
+	}
+	want := []gopacket.LayerType{LayerTypeRTSP, LayerTypeRTSPInterleaved, LayerTypeRTSPInterleaved, LayerTypeRTSP}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v from stream, want %v", got, want)
+	}
+
+	if err := (&RTSPInterleaved{}).DecodeFromBytes(frame[:len(frame)-1], gopacket.NilDecodeFeedback); err == nil {
+		t.Error("decoded truncated frame without error")
+	}
+
+	// Neither an endless header nor a huge body is buffered.
+	s.Reset()
+	if _, err := s.Decode([]byte("OPTIONS * RTSP/1.0\r\nCSeq: 1\r\nContent-Length: 100000000\r\n\r\n")); err == nil {
+		t.Error("no error for oversized body")
+	}
+	s.Reset()
+	line := []byte("X-Filler: " + strings.Repeat("a", 1000) + "\r\n")
+	var err error
+	for i := 0; i < 200 && err == nil; i++ {
+		_, err = s.Decode(line)
+	}
+	if err == nil {
+		t.Error("no error for oversized header")
+	}
+}
@@ -0,0 +1,572 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mistsys/gopacket"
+)
+
+// SDP is a Session Description Protocol body, as specified in RFC 4566.
+//
+// SDP is never carried directly by a transport, but is embedded in the
+// bodies of signaling protocols such as SIP and RTSP.  Those layers hand
+// their body to LayerTypeSDP when the content type says so, and callers
+// holding a raw body may call DecodeFromBytes on an SDP directly.
+type SDP struct {
+	BaseLayer
+	Version     int
+	Origin      SDPOrigin
+	SessionName string
+	SessionInfo string
+	URI         string
+	Emails      []string
+	Phones      []string
+	// Connection is the session-level connection data, or nil if each
+	// media description carries its own.
+	Connection    *SDPConnection
+	Bandwidths    []SDPBandwidth
+	Timings       []SDPTiming
+	TimeZones     string
+	EncryptionKey string
+	// Attributes holds every session-level a= line in order.  Well-known
+	// attributes are additionally parsed into the typed fields below.
+	Attributes   []SDPAttribute
+	Fingerprints []SDPFingerprint
+	Media        []SDPMedia
+}
+
+// SDPOrigin is the o= line of a session description.
+type SDPOrigin struct {
+	Username       string
+	SessionID      string
+	SessionVersion string
+	NetworkType    string
+	AddressType    string
+	Address        string
+}
+
+// SDPConnection is a c= line of a session description.
+type SDPConnection struct {
+	NetworkType string
+	AddressType string
+	Address     string
+	// TTL and NumAddresses are only present for multicast addresses.
+	TTL          int
+	NumAddresses int
+}
+
+// SDPBandwidth is a b= line of a session description.
+type SDPBandwidth struct {
+	Type  string
+	Value int
+}
+
+// SDPTiming is a t= line plus any r= lines following it.
+type SDPTiming struct {
+	Start, Stop uint64
+	Repeats     []string
+}
+
+// SDPAttribute is an a= line.  Property attributes (a=recvonly) have an
+// empty Value.
+type SDPAttribute struct {
+	Key, Value string
+}
+
+// SDPRTPMap is an a=rtpmap attribute, mapping an RTP payload type to an
+// encoding.
+type SDPRTPMap struct {
+	PayloadType    uint8
+	EncodingName   string
+	ClockRate      int
+	EncodingParams string
+}
+
+// SDPCandidate is an ICE a=candidate attribute, as specified in RFC 8839.
+type SDPCandidate struct {
+	Foundation     string
+	Component      int
+	Transport      string
+	Priority       uint32
+	Address        string
+	Port           int
+	Type           string
+	RelatedAddress string
+	RelatedPort    int
+	// Extensions holds any trailing name/value pairs (generation, ufrag...).
+	Extensions []SDPAttribute
+}
+
+// SDPFingerprint is an a=fingerprint attribute, as specified in RFC 8122.
+type SDPFingerprint struct {
+	HashFunction string
+	Fingerprint  string
+}
+
+// SDPCrypto is an SDES a=crypto attribute, as specified in RFC 4568.
+type SDPCrypto struct {
+	Tag           int
+	Suite         string
+	KeyParams     string
+	SessionParams []string
+}
+
+// SDPMedia is a media description, starting with an m= line.
+type SDPMedia struct {
+	Type     string
+	Port     int
+	NumPorts int
+	Protocol string
+	Formats  []string
+	Info     string
+	// Connection is the media-level connection data, or nil if the
+	// session-level connection applies.
+	Connection   *SDPConnection
+	Bandwidths   []SDPBandwidth
+	Attributes   []SDPAttribute
+	RTPMaps      []SDPRTPMap
+	Candidates   []SDPCandidate
+	Fingerprints []SDPFingerprint
+	Crypto       []SDPCrypto
+}
+
+// LayerType returns LayerTypeSDP.
+func (s *SDP) LayerType() gopacket.LayerType { return LayerTypeSDP }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (s *SDP) CanDecode() gopacket.LayerClass { return LayerTypeSDP }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (s *SDP) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// Payload returns nil, since SDP has no payload of its own.
+func (s *SDP) Payload() []byte { return nil }
+
+// Attribute returns the value of the first session-level attribute with the
+// given key.
+func (s *SDP) Attribute(key string) (string, bool) {
+	return sdpAttribute(s.Attributes, key)
+}
+
+// Attribute returns the value of the first media-level attribute with the
+// given key.
+func (m *SDPMedia) Attribute(key string) (string, bool) {
+	return sdpAttribute(m.Attributes, key)
+}
+
+// Direction returns the media direction (sendrecv, sendonly, recvonly or
+// inactive), falling back to the session-level direction and then to the
+// RFC 4566 default of sendrecv.
+func (s *SDP) Direction(m *SDPMedia) string {
+	for _, attrs := range [][]SDPAttribute{m.Attributes, s.Attributes} {
+		for _, a := range attrs {
+			switch a.Key {
+			case "sendrecv", "sendonly", "recvonly", "inactive":
+				return a.Key
+			}
+		}
+	}
+	return "sendrecv"
+}
+
+// ConnectionFor returns the connection data that applies to the given media
+// description, or nil if there is none.
+func (s *SDP) ConnectionFor(m *SDPMedia) *SDPConnection {
+	if m.Connection != nil {
+		return m.Connection
+	}
+	return s.Connection
+}
+
+// SDPRTPEndpoint is where a media description asks to receive RTP and
+// RTCP.
+type SDPRTPEndpoint struct {
+	Media    *SDPMedia
+	Address  string
+	RTPPort  int
+	RTCPPort int
+	// RTCPAddress is the address in an a=rtcp attribute, or Address.
+	RTCPAddress string
+}
+
+// RTPEndpoints returns where the media descriptions using RTP ask to
+// receive it, which is how RTP flows are found from the session
+// descriptions of SIP and RTSP.  Media descriptions with port zero, which
+// are disabled, and those without connection data are skipped.  RTCP is
+// received on the port of an a=rtcp attribute (RFC 3605), on the RTP port
+// with a=rtcp-mux (RFC 5761), and otherwise on the port above the RTP
+// port.
+func (s *SDP) RTPEndpoints() []SDPRTPEndpoint {
+	var out []SDPRTPEndpoint
+	for i := range s.Media {
+		m := &s.Media[i]
+		c := s.ConnectionFor(m)
+		if m.Port == 0 || c == nil || !strings.Contains(m.Protocol, "RTP/") {
+			continue
+		}
+		e := SDPRTPEndpoint{Media: m, Address: c.Address, RTPPort: m.Port, RTCPPort: m.Port + 1, RTCPAddress: c.Address}
+		if _, ok := m.Attribute("rtcp-mux"); ok {
+			e.RTCPPort = m.Port
+		}
+		if v, ok := m.Attribute("rtcp"); ok {
+			f := strings.Fields(v)
+			if len(f) > 0 {
+				if n, err := strconv.Atoi(f[0]); err == nil {
+					e.RTCPPort = n
+				}
+			}
+			if len(f) == 4 {
+				e.RTCPAddress = f[3]
+			}
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func sdpAttribute(attrs []SDPAttribute, key string) (string, bool) {
+	for _, a := range attrs {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+func decodeSDP(data []byte, p gopacket.PacketBuilder) error {
+	s := &SDP{}
+	if err := s.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(s)
+	p.SetApplicationLayer(s)
+	return nil
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.  Lines may be
+// terminated by either CRLF or a bare LF.
+func (s *SDP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	*s = SDP{BaseLayer: BaseLayer{Contents: data}}
+	var media *SDPMedia
+	var timing *SDPTiming
+	seenVersion := false
+	for lineno, rest := 1, data; len(rest) > 0; lineno++ {
+		var line []byte
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line, rest = rest[:i], rest[i+1:]
+		} else {
+			line, rest = rest, nil
+		}
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) < 2 || line[1] != '=' {
+			return fmt.Errorf("SDP line %d malformed: %q", lineno, line)
+		}
+		typ, value := line[0], string(line[2:])
+		if !seenVersion {
+			if typ != 'v' {
+				return errors.New("SDP does not start with a version line")
+			}
+			seenVersion = true
+		}
+		var err error
+		switch typ {
+		case 'v':
+			s.Version, err = strconv.Atoi(value)
+		case 'o':
+			err = s.Origin.decode(value)
+		case 's':
+			s.SessionName = value
+		case 'i':
+			if media != nil {
+				media.Info = value
+			} else {
+				s.SessionInfo = value
+			}
+		case 'u':
+			s.URI = value
+		case 'e':
+			s.Emails = append(s.Emails, value)
+		case 'p':
+			s.Phones = append(s.Phones, value)
+		case 'c':
+			c := &SDPConnection{}
+			if err = c.decode(value); err == nil {
+				if media != nil {
+					media.Connection = c
+				} else {
+					s.Connection = c
+				}
+			}
+		case 'b':
+			var bw SDPBandwidth
+			if bw, err = decodeSDPBandwidth(value); err == nil {
+				if media != nil {
+					media.Bandwidths = append(media.Bandwidths, bw)
+				} else {
+					s.Bandwidths = append(s.Bandwidths, bw)
+				}
+			}
+		case 't':
+			var t SDPTiming
+			if t, err = decodeSDPTiming(value); err == nil {
+				s.Timings = append(s.Timings, t)
+				timing = &s.Timings[len(s.Timings)-1]
+			}
+		case 'r':
+			if timing == nil {
+				err = errors.New("repeat without timing")
+			} else {
+				timing.Repeats = append(timing.Repeats, value)
+			}
+		case 'z':
+			s.TimeZones = value
+		case 'k':
+			s.EncryptionKey = value
+		case 'a':
+			a := decodeSDPAttribute(value)
+			if media != nil {
+				media.Attributes = append(media.Attributes, a)
+				err = media.decodeAttribute(a)
+			} else {
+				s.Attributes = append(s.Attributes, a)
+				if a.Key == "fingerprint" {
+					var fp SDPFingerprint
+					if fp, err = decodeSDPFingerprint(a.Value); err == nil {
+						s.Fingerprints = append(s.Fingerprints, fp)
+					}
+				}
+			}
+		case 'm':
+			var m SDPMedia
+			if err = m.decode(value); err == nil {
+				s.Media = append(s.Media, m)
+				media = &s.Media[len(s.Media)-1]
+			}
+		default:
+			// RFC 4566 section 5: parsers must ignore unknown types.
+		}
+		if err != nil {
+			return fmt.Errorf("SDP line %d (%c=): %v", lineno, typ, err)
+		}
+	}
+	if !seenVersion {
+		return errors.New("SDP body is empty")
+	}
+	return nil
+}
+
+func (o *SDPOrigin) decode(value string) error {
+	f := strings.Fields(value)
+	if len(f) != 6 {
+		return fmt.Errorf("origin has %d fields, want 6", len(f))
+	}
+	*o = SDPOrigin{f[0], f[1], f[2], f[3], f[4], f[5]}
+	return nil
+}
+
+func (c *SDPConnection) decode(value string) error {
+	f := strings.Fields(value)
+	if len(f) != 3 {
+		return fmt.Errorf("connection has %d fields, want 3", len(f))
+	}
+	c.NetworkType, c.AddressType = f[0], f[1]
+	// Multicast addresses may carry /ttl (IPv4 only) and /number.
+	parts := strings.Split(f[2], "/")
+	c.Address = parts[0]
+	var err error
+	switch {
+	case len(parts) > 3:
+		return fmt.Errorf("bad connection address %q", f[2])
+	case len(parts) == 3:
+		if c.TTL, err = strconv.Atoi(parts[1]); err != nil {
+			return err
+		}
+		c.NumAddresses, err = strconv.Atoi(parts[2])
+	case len(parts) == 2 && c.AddressType == "IP6":
+		c.NumAddresses, err = strconv.Atoi(parts[1])
+	case len(parts) == 2:
+		c.TTL, err = strconv.Atoi(parts[1])
+	}
+	return err
+}
+
+func decodeSDPBandwidth(value string) (bw SDPBandwidth, err error) {
+	i := strings.IndexByte(value, ':')
+	if i < 0 {
+		return bw, fmt.Errorf("bandwidth %q missing ':'", value)
+	}
+	bw.Type = value[:i]
+	bw.Value, err = strconv.Atoi(value[i+1:])
+	return
+}
+
+func decodeSDPTiming(value string) (t SDPTiming, err error) {
+	f := strings.Fields(value)
+	if len(f) != 2 {
+		return t, fmt.Errorf("timing has %d fields, want 2", len(f))
+	}
+	if t.Start, err = strconv.ParseUint(f[0], 10, 64); err != nil {
+		return
+	}
+	t.Stop, err = strconv.ParseUint(f[1], 10, 64)
+	return
+}
+
+func decodeSDPAttribute(value string) SDPAttribute {
+	if i := strings.IndexByte(value, ':'); i >= 0 {
+		return SDPAttribute{Key: value[:i], Value: value[i+1:]}
+	}
+	return SDPAttribute{Key: value}
+}
+
+func (m *SDPMedia) decode(value string) error {
+	f := strings.Fields(value)
+	if len(f) < 3 {
+		return fmt.Errorf("media has %d fields, want at least 3", len(f))
+	}
+	m.Type = f[0]
+	port := f[1]
+	if i := strings.IndexByte(port, '/'); i >= 0 {
+		n, err := strconv.Atoi(port[i+1:])
+		if err != nil {
+			return err
+		}
+		m.NumPorts = n
+		port = port[:i]
+	}
+	var err error
+	if m.Port, err = strconv.Atoi(port); err != nil {
+		return err
+	}
+	m.Protocol = f[2]
+	m.Formats = f[3:]
+	return nil
+}
+
+// decodeAttribute parses the well-known media-level attributes into their
+// typed fields.  Unknown attributes are left in Attributes only.
+func (m *SDPMedia) decodeAttribute(a SDPAttribute) error {
+	switch a.Key {
+	case "rtpmap":
+		r, err := decodeSDPRTPMap(a.Value)
+		if err != nil {
+			return err
+		}
+		m.RTPMaps = append(m.RTPMaps, r)
+	case "candidate":
+		c, err := decodeSDPCandidate(a.Value)
+		if err != nil {
+			return err
+		}
+		m.Candidates = append(m.Candidates, c)
+	case "fingerprint":
+		fp, err := decodeSDPFingerprint(a.Value)
+		if err != nil {
+			return err
+		}
+		m.Fingerprints = append(m.Fingerprints, fp)
+	case "crypto":
+		c, err := decodeSDPCrypto(a.Value)
+		if err != nil {
+			return err
+		}
+		m.Crypto = append(m.Crypto, c)
+	}
+	return nil
+}
+
+func decodeSDPRTPMap(value string) (r SDPRTPMap, err error) {
+	f := strings.Fields(value)
+	if len(f) != 2 {
+		return r, fmt.Errorf("rtpmap %q malformed", value)
+	}
+	pt, err := strconv.ParseUint(f[0], 10, 7)
+	if err != nil {
+		return r, err
+	}
+	r.PayloadType = uint8(pt)
+	enc := strings.SplitN(f[1], "/", 3)
+	if len(enc) < 2 {
+		return r, fmt.Errorf("rtpmap %q missing clock rate", value)
+	}
+	r.EncodingName = enc[0]
+	if r.ClockRate, err = strconv.Atoi(enc[1]); err != nil {
+		return r, err
+	}
+	if len(enc) == 3 {
+		r.EncodingParams = enc[2]
+	}
+	return r, nil
+}
+
+func decodeSDPCandidate(value string) (c SDPCandidate, err error) {
+	f := strings.Fields(value)
+	if len(f) < 8 || f[6] != "typ" {
+		return c, fmt.Errorf("candidate %q malformed", value)
+	}
+	c.Foundation = f[0]
+	if c.Component, err = strconv.Atoi(f[1]); err != nil {
+		return
+	}
+	c.Transport = f[2]
+	prio, err := strconv.ParseUint(f[3], 10, 32)
+	if err != nil {
+		return
+	}
+	c.Priority = uint32(prio)
+	c.Address = f[4]
+	if c.Port, err = strconv.Atoi(f[5]); err != nil {
+		return
+	}
+	c.Type = f[7]
+	for f = f[8:]; len(f) >= 2; f = f[2:] {
+		switch f[0] {
+		case "raddr":
+			c.RelatedAddress = f[1]
+		case "rport":
+			if c.RelatedPort, err = strconv.Atoi(f[1]); err != nil {
+				return
+			}
+		default:
+			c.Extensions = append(c.Extensions, SDPAttribute{Key: f[0], Value: f[1]})
+		}
+	}
+	return c, nil
+}
+
+func decodeSDPFingerprint(value string) (fp SDPFingerprint, err error) {
+	f := strings.Fields(value)
+	if len(f) != 2 {
+		return fp, fmt.Errorf("fingerprint %q malformed", value)
+	}
+	return SDPFingerprint{HashFunction: f[0], Fingerprint: f[1]}, nil
+}
+
+func decodeSDPCrypto(value string) (c SDPCrypto, err error) {
+	f := strings.Fields(value)
+	if len(f) < 3 {
+		return c, fmt.Errorf("crypto %q malformed", value)
+	}
+	if c.Tag, err = strconv.Atoi(f[0]); err != nil {
+		return
+	}
+	c.Suite = f[1]
+	c.KeyParams = f[2]
+	if len(f) > 3 {
+		c.SessionParams = f[3:]
+	}
+	return c, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testSDPWebRTC is a trimmed WebRTC offer with an SDES-keyed audio stream
+// and an ICE/DTLS video stream.
+var testSDPWebRTC = []byte("v=0\r\n" +
+	"o=- 4611731400430051336 2 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"c=IN IP4 203.0.113.5\r\n" +
+	"t=0 0\r\n" +
+	"a=group:BUNDLE 0 1\r\n" +
+	"a=fingerprint:sha-256 19:E2:1C:3B:4B:9F:81:E6:B8:5C:F4:A5:A8:D8:73:04\r\n" +
+	"m=audio 49170 RTP/SAVP 0 8 101\r\n" +
+	"a=rtpmap:0 PCMU/8000\r\n" +
+	"a=rtpmap:8 PCMA/8000\r\n" +
+	"a=rtpmap:101 telephone-event/8000\r\n" +
+	"a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:PS1uQCVeeCFCanVmcjkpPywjNWhcYD0mXXtxaVBR|2^20|1:32\r\n" +
+	"a=sendonly\r\n" +
+	"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+	"c=IN IP6 2001:db8::1\r\n" +
+	"b=AS:512\r\n" +
+	"a=rtpmap:96 VP8/90000\r\n" +
+	"a=candidate:842163049 1 udp 1677729535 198.51.100.7 61665 typ srflx raddr 10.0.0.2 rport 61665 generation 0\r\n" +
+	"a=fingerprint:sha-1 4A:AD:B9:B1:3F:82:18:3B:54:02:12:DF:3E:5D:49:6B:19:E5:7C:AB\r\n")
+
+func TestSDPDecode(t *testing.T) {
+	var s SDP
+	if err := s.DecodeFromBytes(testSDPWebRTC, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if s.Origin.SessionID != "4611731400430051336" || s.Origin.Address != "127.0.0.1" {
+		t.Errorf("bad origin %+v", s.Origin)
+	}
+	if s.Connection == nil || s.Connection.Address != "203.0.113.5" {
+		t.Errorf("bad session connection %+v", s.Connection)
+	}
+	if len(s.Fingerprints) != 1 || s.Fingerprints[0].HashFunction != "sha-256" {
+		t.Errorf("bad session fingerprints %+v", s.Fingerprints)
+	}
+	if len(s.Media) != 2 {
+		t.Fatalf("got %d media descriptions, want 2", len(s.Media))
+	}
+
+	audio := &s.Media[0]
+	if audio.Type != "audio" || audio.Port != 49170 || audio.Protocol != "RTP/SAVP" {
+		t.Errorf("bad audio media line %+v", audio)
+	}
+	if want := []string{"0", "8", "101"}; !reflect.DeepEqual(audio.Formats, want) {
+		t.Errorf("audio formats: got %v want %v", audio.Formats, want)
+	}
+	if want := (SDPRTPMap{PayloadType: 101, EncodingName: "telephone-event", ClockRate: 8000}); len(audio.RTPMaps) != 3 || audio.RTPMaps[2] != want {
+		t.Errorf("audio rtpmaps: got %+v", audio.RTPMaps)
+	}
+	if len(audio.Crypto) != 1 || audio.Crypto[0].Tag != 1 || audio.Crypto[0].Suite != "AES_CM_128_HMAC_SHA1_80" {
+		t.Errorf("audio crypto: got %+v", audio.Crypto)
+	}
+	if got := s.Direction(audio); got != "sendonly" {
+		t.Errorf("audio direction: got %q want sendonly", got)
+	}
+	if c := s.ConnectionFor(audio); c != s.Connection {
+		t.Errorf("audio connection should fall back to session level, got %+v", c)
+	}
+
+	video := &s.Media[1]
+	if c := s.ConnectionFor(video); c == nil || c.AddressType != "IP6" || c.Address != "2001:db8::1" {
+		t.Errorf("bad video connection %+v", c)
+	}
+	if len(video.Bandwidths) != 1 || video.Bandwidths[0] != (SDPBandwidth{"AS", 512}) {
+		t.Errorf("video bandwidths: got %+v", video.Bandwidths)
+	}
+	wantCand := SDPCandidate{
+		Foundation:     "842163049",
+		Component:      1,
+		Transport:      "udp",
+		Priority:       1677729535,
+		Address:        "198.51.100.7",
+		Port:           61665,
+		Type:           "srflx",
+		RelatedAddress: "10.0.0.2",
+		RelatedPort:    61665,
+		Extensions:     []SDPAttribute{{"generation", "0"}},
+	}
+	if len(video.Candidates) != 1 || !reflect.DeepEqual(video.Candidates[0], wantCand) {
+		t.Errorf("video candidates: got %+v", video.Candidates)
+	}
+	if len(video.Fingerprints) != 1 || video.Fingerprints[0].HashFunction != "sha-1" {
+		t.Errorf("video fingerprints: got %+v", video.Fingerprints)
+	}
+	if got := s.Direction(video); got != "sendrecv" {
+		t.Errorf("video direction: got %q want sendrecv", got)
+	}
+}
+
+func TestSDPDecodeLayer(t *testing.T) {
+	p := gopacket.NewPacket(testSDPWebRTC, LayerTypeSDP, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeSDP}, t)
+	if _, ok := p.ApplicationLayer().(*SDP); !ok {
+		t.Errorf("SDP should be the application layer")
+	}
+}
+
+func TestSDPDecodeMalformed(t *testing.T) {
+	for _, body := range []string{
+		"",
+		"o=- 1 1 IN IP4 127.0.0.1\r\n",
+		"v=0\r\nthis is not sdp\r\n",
+		"v=0\r\nm=audio notaport RTP/AVP 0\r\n",
+		"v=0\r\nm=audio 1234 RTP/AVP 0\r\na=rtpmap:0 PCMU\r\n",
+	} {
+		var s SDP
+		if err := s.DecodeFromBytes([]byte(body), gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("expected error decoding %q", body)
+		}
+	}
+}
@@ -0,0 +1,553 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mistsys/gopacket"
+)
+
+// SIPHeader is a header field of a SIP message.
+type SIPHeader struct {
+	Name, Value string
+}
+
+// SIPParam is a parameter of a SIP header field or URI, like ";tag=1234".
+// Parameters without a value, like ";lr", have an empty Value.
+type SIPParam struct {
+	Name, Value string
+}
+
+// SIPVia is a Via header field value, added by each hop a request takes
+// and used to route the response back.
+type SIPVia struct {
+	// Transport is the transport of the hop, like "UDP" or "TLS".
+	Transport string
+	Host      string
+	// Port is zero if the hop uses the default port for its transport.
+	Port int
+	// Branch identifies the transaction.
+	Branch string
+	Params []SIPParam
+}
+
+// SIPAddress is a name-addr or addr-spec header field value, as in From,
+// To and Contact: an optional display name, a URI, and parameters.
+type SIPAddress struct {
+	DisplayName string
+	URI         string
+	// Tag identifies the dialog of each party, in From and To.
+	Tag    string
+	Params []SIPParam
+}
+
+// SIP is a SIP message (RFC 3261): a request, like INVITE, or a response,
+// like "200 OK".  Header fields are kept in order in Headers, with compact
+// names, like "v", expanded to their full names, like "Via".  The fields
+// every message has are also decoded into the typed fields.
+//
+// The payload is the message body.  If it's a session description, as in
+// an INVITE offering a call and the response answering it, it decodes as
+// LayerTypeSDP, whose media descriptions give the RTP addresses and ports
+// of the call.
+//
+// Over TCP, the body extends for Content-Length bytes, and bytes after it
+// are ignored; use SIPStream to split a reassembled connection into
+// messages.
+type SIP struct {
+	BaseLayer
+	IsResponse bool
+	// Method and RequestURI are set for requests.
+	Method     string
+	RequestURI string
+	// StatusCode and Reason are set for responses.
+	StatusCode int
+	Reason     string
+	Version    string
+	Headers    []SIPHeader
+
+	Via           []SIPVia
+	From, To      SIPAddress
+	CallID        string
+	CSeq          uint32
+	CSeqMethod    string
+	ContentType   string
+	ContentLength int
+}
+
+// sipCompactNames maps the compact header names of RFC 3261 section 7.3.3
+// and its extensions to the full names.
+var sipCompactNames = map[string]string{
+	"a": "Accept-Contact",
+	"b": "Referred-By",
+	"c": "Content-Type",
+	"e": "Content-Encoding",
+	"f": "From",
+	"i": "Call-ID",
+	"k": "Supported",
+	"l": "Content-Length",
+	"m": "Contact",
+	"o": "Event",
+	"r": "Refer-To",
+	"s": "Subject",
+	"t": "To",
+	"u": "Allow-Events",
+	"v": "Via",
+	"x": "Session-Expires",
+}
+
+// LayerType returns LayerTypeSIP.
+func (s *SIP) LayerType() gopacket.LayerType { return LayerTypeSIP }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (s *SIP) CanDecode() gopacket.LayerClass { return LayerTypeSIP }
+
+// NextLayerType returns LayerTypeSDP if the body is a session
+// description, and otherwise LayerTypePayload if there is a body.
+func (s *SIP) NextLayerType() gopacket.LayerType {
+	switch {
+	case len(s.BaseLayer.Payload) == 0:
+		return gopacket.LayerTypeZero
+	case s.isSDP():
+		return LayerTypeSDP
+	default:
+		return gopacket.LayerTypePayload
+	}
+}
+
+// Payload returns the message body.
+func (s *SIP) Payload() []byte { return s.BaseLayer.Payload }
+
+func (s *SIP) isSDP() bool {
+	t := s.ContentType
+	if i := strings.IndexByte(t, ';'); i >= 0 {
+		t = t[:i]
+	}
+	return strings.EqualFold(strings.TrimSpace(t), "application/sdp")
+}
+
+// Header returns the value of the first header field with the given name,
+// which may be compact.  Names are case insensitive.
+func (s *SIP) Header(name string) (string, bool) {
+	name = sipHeaderName(name)
+	for _, h := range s.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value, true
+		}
+	}
+	return "", false
+}
+
+// HeaderValues returns the values of every header field with the given
+// name, in order.
+func (s *SIP) HeaderValues(name string) []string {
+	name = sipHeaderName(name)
+	var out []string
+	for _, h := range s.Headers {
+		if strings.EqualFold(h.Name, name) {
+			out = append(out, h.Value)
+		}
+	}
+	return out
+}
+
+// SDP decodes the body as a session description.  It returns an error if
+// the body isn't one.
+func (s *SIP) SDP() (*SDP, error) {
+	if !s.isSDP() || len(s.BaseLayer.Payload) == 0 {
+		return nil, fmt.Errorf("SIP body of type %q isn't SDP", s.ContentType)
+	}
+	d := &SDP{}
+	if err := d.DecodeFromBytes(s.BaseLayer.Payload, gopacket.NilDecodeFeedback); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func sipHeaderName(name string) string {
+	if full, ok := sipCompactNames[strings.ToLower(name)]; ok {
+		return full
+	}
+	return name
+}
+
+func decodeSIP(data []byte, p gopacket.PacketBuilder) error {
+	// A TCP segment that doesn't start with a message, like one continuing
+	// a message split across segments, or a CRLF keepalive, is left as
+	// payload.
+	if !isSIPMessage(data) {
+		return gopacket.DecodePayload.Decode(data, p)
+	}
+	s := &SIP{}
+	if err := s.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(s)
+	p.SetApplicationLayer(s)
+	next := s.NextLayerType()
+	if next == gopacket.LayerTypeZero {
+		return nil
+	}
+	return p.NextDecoder(next)
+}
+
+// isSIPMessage returns true if data starts with a SIP request or status
+// line.
+func isSIPMessage(data []byte) bool {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return false
+	}
+	line := string(bytes.TrimRight(data[:i], "\r"))
+	if strings.HasPrefix(line, "SIP/2.0 ") {
+		return true
+	}
+	f := strings.Fields(line)
+	return len(f) == 3 && f[2] == "SIP/2.0" && sipIsToken(f[0])
+}
+
+// sipIsToken returns true if s is a method name: upper case letters, as
+// all methods are by convention.
+func sipIsToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// sipHeaderEnd returns the length of the start line and header fields of
+// data, including the empty line ending them, or -1 if they don't end.
+// Lines may end with CRLF or a bare LF.
+func sipHeaderEnd(data []byte) int {
+	for i := 0; i < len(data); {
+		j := bytes.IndexByte(data[i:], '\n')
+		if j < 0 {
+			return -1
+		}
+		line := data[i : i+j]
+		i += j + 1
+		if len(line) == 0 || len(line) == 1 && line[0] == '\r' {
+			return i
+		}
+	}
+	return -1
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (s *SIP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	*s = SIP{}
+	n := sipHeaderEnd(data)
+	if n < 0 {
+		df.SetTruncated()
+		return errors.New("SIP header not terminated by an empty line")
+	}
+	var lines []string
+	for _, l := range strings.Split(string(data[:n]), "\n") {
+		l = strings.TrimRight(l, "\r")
+		if l == "" {
+			continue
+		}
+		// Lines starting with white space continue the header field above.
+		if (l[0] == ' ' || l[0] == '\t') && len(lines) > 1 {
+			lines[len(lines)-1] += " " + strings.TrimSpace(l)
+			continue
+		}
+		lines = append(lines, l)
+	}
+	if len(lines) == 0 {
+		return errors.New("SIP message starts with an empty line")
+	}
+	if err := s.decodeStartLine(lines[0]); err != nil {
+		return err
+	}
+	for _, l := range lines[1:] {
+		i := strings.IndexByte(l, ':')
+		if i <= 0 {
+			return fmt.Errorf("SIP header field %q malformed", l)
+		}
+		h := SIPHeader{Name: sipHeaderName(strings.TrimSpace(l[:i])), Value: strings.TrimSpace(l[i+1:])}
+		s.Headers = append(s.Headers, h)
+		if err := s.decodeHeader(h); err != nil {
+			return fmt.Errorf("SIP %s header field invalid: %v", h.Name, err)
+		}
+	}
+	if s.CallID == "" || s.CSeqMethod == "" || len(s.Via) == 0 || s.From.URI == "" || s.To.URI == "" {
+		return errors.New("SIP message missing Via, From, To, Call-ID or CSeq")
+	}
+	body := data[n:]
+	if _, ok := s.Header("Content-Length"); ok {
+		if s.ContentLength > len(body) {
+			df.SetTruncated()
+			return fmt.Errorf("SIP Content-Length %d exceeds %d bytes available", s.ContentLength, len(body))
+		}
+		body = body[:s.ContentLength]
+	}
+	s.BaseLayer = BaseLayer{Contents: data[:n], Payload: body}
+	return nil
+}
+
+func (s *SIP) decodeStartLine(line string) error {
+	if strings.HasPrefix(line, "SIP/") {
+		f := strings.SplitN(line, " ", 3)
+		if len(f) < 2 || len(f[1]) != 3 {
+			return fmt.Errorf("SIP status line %q malformed", line)
+		}
+		code, err := strconv.Atoi(f[1])
+		if err != nil || code < 100 {
+			return fmt.Errorf("SIP status code %q invalid", f[1])
+		}
+		s.IsResponse, s.Version, s.StatusCode = true, f[0], code
+		if len(f) == 3 {
+			s.Reason = f[2]
+		}
+		return nil
+	}
+	f := strings.Fields(line)
+	if len(f) != 3 || !strings.HasPrefix(f[2], "SIP/") {
+		return fmt.Errorf("SIP request line %q malformed", line)
+	}
+	s.Method, s.RequestURI, s.Version = f[0], f[1], f[2]
+	return nil
+}
+
+func (s *SIP) decodeHeader(h SIPHeader) error {
+	var err error
+	switch strings.ToLower(h.Name) {
+	case "via":
+		for _, v := range sipSplitList(h.Value) {
+			via, err := decodeSIPVia(v)
+			if err != nil {
+				return err
+			}
+			s.Via = append(s.Via, via)
+		}
+	case "from":
+		s.From, err = decodeSIPAddress(h.Value)
+	case "to":
+		s.To, err = decodeSIPAddress(h.Value)
+	case "call-id":
+		s.CallID = h.Value
+	case "cseq":
+		f := strings.Fields(h.Value)
+		if len(f) != 2 {
+			return fmt.Errorf("%q malformed", h.Value)
+		}
+		n, err := strconv.ParseUint(f[0], 10, 32)
+		if err != nil {
+			return err
+		}
+		s.CSeq, s.CSeqMethod = uint32(n), f[1]
+	case "content-type":
+		s.ContentType = h.Value
+	case "content-length":
+		n, err := strconv.ParseUint(h.Value, 10, 31)
+		if err != nil {
+			return err
+		}
+		s.ContentLength = int(n)
+	}
+	return err
+}
+
+// sipSplitList splits a header field value holding a comma separated
+// list, ignoring commas in quoted strings and angle brackets.
+func sipSplitList(v string) []string {
+	var out []string
+	quoted, angle, start := false, false, 0
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == '<' && !quoted:
+			angle = true
+		case c == '>' && !quoted:
+			angle = false
+		case c == ',' && !quoted && !angle:
+			out = append(out, strings.TrimSpace(v[start:i]))
+			start = i + 1
+		}
+	}
+	return append(out, strings.TrimSpace(v[start:]))
+}
+
+// decodeSIPParams decodes parameters, like ";branch=z9hG4bK776;rport",
+// after the leading semicolon.
+func decodeSIPParams(v string) []SIPParam {
+	var out []SIPParam
+	for _, p := range strings.Split(v, ";") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if i := strings.IndexByte(p, '='); i >= 0 {
+			out = append(out, SIPParam{Name: strings.TrimSpace(p[:i]), Value: strings.Trim(strings.TrimSpace(p[i+1:]), `"`)})
+		} else {
+			out = append(out, SIPParam{Name: p})
+		}
+	}
+	return out
+}
+
+func decodeSIPVia(v string) (SIPVia, error) {
+	var via SIPVia
+	i := strings.IndexAny(v, " \t")
+	if i < 0 {
+		return via, fmt.Errorf("%q malformed", v)
+	}
+	proto := strings.Split(strings.Replace(v[:i], " ", "", -1), "/")
+	if len(proto) != 3 {
+		return via, fmt.Errorf("protocol %q malformed", v[:i])
+	}
+	via.Transport = strings.ToUpper(proto[2])
+	sentBy := strings.TrimSpace(v[i:])
+	if j := strings.IndexByte(sentBy, ';'); j >= 0 {
+		via.Params = decodeSIPParams(sentBy[j+1:])
+		sentBy = strings.TrimSpace(sentBy[:j])
+	}
+	host, port := sentBy, ""
+	if strings.HasPrefix(host, "[") {
+		j := strings.IndexByte(host, ']')
+		if j < 0 {
+			return via, fmt.Errorf("host %q malformed", sentBy)
+		}
+		host, port = host[1:j], strings.TrimPrefix(host[j+1:], ":")
+	} else if j := strings.LastIndexByte(host, ':'); j >= 0 {
+		host, port = host[:j], host[j+1:]
+	}
+	if host == "" {
+		return via, fmt.Errorf("%q has no host", v)
+	}
+	via.Host = host
+	if port != "" {
+		n, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return via, fmt.Errorf("port %q invalid", port)
+		}
+		via.Port = int(n)
+	}
+	for _, p := range via.Params {
+		if strings.EqualFold(p.Name, "branch") {
+			via.Branch = p.Value
+		}
+	}
+	return via, nil
+}
+
+func decodeSIPAddress(v string) (SIPAddress, error) {
+	var a SIPAddress
+	params := ""
+	if i := strings.IndexByte(v, '<'); i >= 0 {
+		j := strings.IndexByte(v[i:], '>')
+		if j < 0 {
+			return a, fmt.Errorf("%q missing '>'", v)
+		}
+		a.DisplayName = strings.TrimSpace(v[:i])
+		if len(a.DisplayName) >= 2 && a.DisplayName[0] == '"' && a.DisplayName[len(a.DisplayName)-1] == '"' {
+			a.DisplayName = strings.Replace(a.DisplayName[1:len(a.DisplayName)-1], `\"`, `"`, -1)
+		}
+		a.URI = v[i+1 : i+j]
+		params = v[i+j+1:]
+	} else {
+		// Without angle brackets, parameters belong to the header field,
+		// not the URI (RFC 3261 section 20.10).
+		a.URI = v
+		if i := strings.IndexByte(v, ';'); i >= 0 {
+			a.URI, params = v[:i], v[i:]
+		}
+		a.URI = strings.TrimSpace(a.URI)
+	}
+	if a.URI == "" {
+		return a, fmt.Errorf("%q has no URI", v)
+	}
+	if params = strings.TrimSpace(params); params != "" {
+		if params[0] != ';' {
+			return a, fmt.Errorf("%q malformed", v)
+		}
+		a.Params = decodeSIPParams(params[1:])
+	}
+	for _, p := range a.Params {
+		if strings.EqualFold(p.Name, "tag") {
+			a.Tag = p.Value
+		}
+	}
+	return a, nil
+}
+
+// maxSIPMessage is the largest message SIPStream accepts, header and body
+// together.  It is the most a UDP datagram can carry, far beyond what SIP
+// messages need.
+const maxSIPMessage = 0xffff
+
+// SIPStream splits one direction of a reassembled SIP connection into
+// messages, including those split across TCP segments.  Messages over TCP
+// must have a Content-Length header field.
+type SIPStream struct {
+	buf streamBuffer
+}
+
+// Decode appends data from the stream and returns the messages completed
+// by it.  After an error, or a gap in the stream, call Reset before
+// decoding more data.
+func (s *SIPStream) Decode(data []byte) ([]*SIP, error) {
+	ls, err := s.buf.decode(data, "SIP", maxSIPMessage, sipFrame)
+	var out []*SIP
+	for _, l := range ls {
+		out = append(out, l.(*SIP))
+	}
+	return out, err
+}
+
+// sipFrame is the streamFramer of SIPStream.
+func sipFrame(data []byte) (int64, layerDecodingLayer, error) {
+	// Skip CRLF keepalives (RFC 5626 section 3.5.1) between messages.
+	if k := len(data) - len(bytes.TrimLeft(data, "\r\n")); k > 0 {
+		return int64(k), nil, nil
+	}
+	n := sipHeaderEnd(data)
+	if n < 0 {
+		return 0, nil, nil
+	}
+	l, err := sipContentLength(data[:n])
+	if err != nil {
+		return 0, nil, err
+	}
+	return int64(n) + l, &SIP{}, nil
+}
+
+// sipContentLength returns the value of the Content-Length header field
+// of a message's header.
+func sipContentLength(header []byte) (int64, error) {
+	for _, l := range strings.Split(string(header), "\n") {
+		i := strings.IndexByte(l, ':')
+		if i <= 0 || !strings.EqualFold(sipHeaderName(strings.TrimSpace(l[:i])), "Content-Length") {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(l[i+1:]), 10, 31)
+		if err != nil {
+			return 0, fmt.Errorf("SIP Content-Length invalid: %v", err)
+		}
+		return int64(n), nil
+	}
+	return 0, errors.New("SIP message over TCP missing Content-Length")
+}
+
+// Reset discards any partial message.
+func (s *SIPStream) Reset() {
+	s.buf.reset()
+}
@@ -0,0 +1,176 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+const testSIPInviteSDP = "v=0\r\n" +
+	"o=alice 2890844526 2890844526 IN IP4 192.0.2.10\r\n" +
+	"s=-\r\n" +
+	"c=IN IP4 192.0.2.10\r\n" +
+	"t=0 0\r\n" +
+	"m=audio 49170 RTP/AVP 0\r\n" +
+	"a=rtpmap:0 PCMU/8000\r\n"
+
+var testSIPInvite = "INVITE sip:bob@example.com SIP/2.0\r\n" +
+	"Via: SIP/2.0/UDP 192.0.2.10:5060;branch=z9hG4bK776asdhds;rport\r\n" +
+	"Max-Forwards: 70\r\n" +
+	"To: Bob <sip:bob@example.com>\r\n" +
+	"From: \"Alice\" <sip:alice@example.org>;tag=1928301774\r\n" +
+	"Call-ID: a84b4c76e66710@192.0.2.10\r\n" +
+	"CSeq: 314159 INVITE\r\n" +
+	"Contact: <sip:alice@192.0.2.10>\r\n" +
+	"Content-Type: application/sdp\r\n" +
+	"Content-Length: " + strconv.Itoa(len(testSIPInviteSDP)) + "\r\n" +
+	"\r\n" + testSIPInviteSDP
+
+// testSIPResponse has compact header names, a folded header and two Via
+// values in one field.
+var testSIPResponse = "SIP/2.0 180 Ringing\r\n" +
+	"v: SIP/2.0/UDP proxy.example.com;branch=z9hG4bK4b43c2ff8.1,\r\n" +
+	" SIP/2.0/UDP 192.0.2.10:5060;branch=z9hG4bK776asdhds\r\n" +
+	"t: Bob <sip:bob@example.com>;tag=a6c85cf\r\n" +
+	"f: Alice <sip:alice@example.org>;tag=1928301774\r\n" +
+	"i: a84b4c76e66710@192.0.2.10\r\n" +
+	"CSeq: 314159 INVITE\r\n" +
+	"l: 0\r\n" +
+	"\r\n"
+
+func TestSIPInviteUDP(t *testing.T) {
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{192, 0, 2, 10}, DstIP: net.IP{198, 51, 100, 1}}
+	udp := &UDP{SrcPort: 5060, DstPort: 5060}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload(testSIPInvite)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeSIP, LayerTypeSDP}, t)
+	s := p.Layer(LayerTypeSIP).(*SIP)
+	if s.IsResponse || s.Method != "INVITE" || s.RequestURI != "sip:bob@example.com" || s.Version != "SIP/2.0" {
+		t.Errorf("got request line %q %q %q", s.Method, s.RequestURI, s.Version)
+	}
+	wantVia := []SIPVia{{Transport: "UDP", Host: "192.0.2.10", Port: 5060, Branch: "z9hG4bK776asdhds",
+		Params: []SIPParam{{"branch", "z9hG4bK776asdhds"}, {"rport", ""}}}}
+	if !reflect.DeepEqual(s.Via, wantVia) {
+		t.Errorf("got Via %+v, want %+v", s.Via, wantVia)
+	}
+	if s.From.DisplayName != "Alice" || s.From.URI != "sip:alice@example.org" || s.From.Tag != "1928301774" {
+		t.Errorf("got From %+v", s.From)
+	}
+	if s.To.DisplayName != "Bob" || s.To.URI != "sip:bob@example.com" || s.To.Tag != "" {
+		t.Errorf("got To %+v", s.To)
+	}
+	if s.CallID != "a84b4c76e66710@192.0.2.10" || s.CSeq != 314159 || s.CSeqMethod != "INVITE" {
+		t.Errorf("got Call-ID %q, CSeq %d %s", s.CallID, s.CSeq, s.CSeqMethod)
+	}
+	if v, ok := s.Header("max-forwards"); !ok || v != "70" {
+		t.Errorf("got Max-Forwards %q", v)
+	}
+
+	sdp := p.Layer(LayerTypeSDP).(*SDP)
+	want := []SDPRTPEndpoint{{Media: &sdp.Media[0], Address: "192.0.2.10", RTPPort: 49170, RTCPPort: 49171, RTCPAddress: "192.0.2.10"}}
+	if got := sdp.RTPEndpoints(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got RTP endpoints %+v, want %+v", got, want)
+	}
+	if d, err := s.SDP(); err != nil || len(d.Media) != 1 {
+		t.Errorf("SDP() returned %+v, %v", d, err)
+	}
+}
+
+func TestSIPResponse(t *testing.T) {
+	var s SIP
+	if err := s.DecodeFromBytes([]byte(testSIPResponse), gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsResponse || s.StatusCode != 180 || s.Reason != "Ringing" {
+		t.Errorf("got status line %d %q", s.StatusCode, s.Reason)
+	}
+	if len(s.Via) != 2 || s.Via[0].Host != "proxy.example.com" || s.Via[0].Port != 0 || s.Via[1].Port != 5060 {
+		t.Errorf("got Via %+v", s.Via)
+	}
+	if s.To.Tag != "a6c85cf" || s.From.Tag != "1928301774" || s.CallID != "a84b4c76e66710@192.0.2.10" {
+		t.Errorf("got To %+v, From %+v, Call-ID %q", s.To, s.From, s.CallID)
+	}
+	if got := s.HeaderValues("Via"); len(got) != 1 {
+		t.Errorf("got Via values %q", got)
+	}
+	if s.NextLayerType() != gopacket.LayerTypeZero || len(s.Payload()) != 0 {
+		t.Errorf("got next layer %v, payload %q", s.NextLayerType(), s.Payload())
+	}
+}
+
+func TestSIPStream(t *testing.T) {
+	data := []byte("\r\n\r\n" + testSIPInvite + testSIPResponse)
+	var st SIPStream
+	var got []*SIP
+	for _, chunk := range [][]byte{data[:30], data[30 : len(data)-40], data[len(data)-40:]} {
+		ms, err := st.Decode(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, ms...)
+	}
+	if len(got) != 2 || got[0].Method != "INVITE" || got[1].StatusCode != 180 {
+		t.Fatalf("got %d messages from stream", len(got))
+	}
+	if len(got[0].Payload()) != len(testSIPInviteSDP) {
+		t.Errorf("got body %q", got[0].Payload())
+	}
+
+	st.Reset()
+	if _, err := st.Decode([]byte("OPTIONS sip:a@b SIP/2.0\r\nVia: SIP/2.0/TCP h\r\n\r\n")); err == nil {
+		t.Error("decoded TCP message without Content-Length")
+	}
+
+	// Neither an endless header nor a huge body is buffered.
+	st.Reset()
+	if _, err := st.Decode([]byte("OPTIONS sip:a@b SIP/2.0\r\nContent-Length: 100000000\r\n\r\n")); err == nil {
+		t.Error("no error for oversized body")
+	}
+	st.Reset()
+	line := []byte("X-Filler: " + strings.Repeat("a", 1000) + "\r\n")
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		_, err = st.Decode(line)
+	}
+	if err == nil {
+		t.Error("no error for oversized header")
+	}
+}
+
+func TestSIPMalformed(t *testing.T) {
+	for _, m := range []string{
+		"",
+		"INVITE sip:bob@example.com SIP/2.0\r\n",
+		"INVITE sip:bob@example.com SIP/2.0\r\nVia: SIP/2.0/UDP h\r\n\r\n",
+		"SIP/2.0 abc Ringing\r\n\r\n",
+		"SIP/2.0 200 OK\r\nv: SIP/2.0/UDP h\r\nf: <sip:a@b>\r\nt: <sip:c@d>\r\ni: 1\r\nCSeq: x INVITE\r\n\r\n",
+	} {
+		if err := (&SIP{}).DecodeFromBytes([]byte(m), gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("decoded %q without error", m)
+		}
+	}
+
+	// A body shorter than its Content-Length is truncated.
+	p := gopacket.NewPacket([]byte(testSIPInvite[:len(testSIPInvite)-5]), LayerTypeSIP, gopacket.Default)
+	if p.ErrorLayer() == nil || !p.Metadata().Truncated {
+		t.Error("truncated body not reported")
+	}
+}
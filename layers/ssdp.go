@@ -0,0 +1,505 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mistsys/gopacket"
+)
+
+// SSDPHeader is a header field of an SSDP message.
+type SSDPHeader struct {
+	Name, Value string
+}
+
+// SSDPTargetKind is the kind of an SSDP search target or notification
+// type.
+type SSDPTargetKind uint8
+
+// SSDP target kinds.
+const (
+	SSDPTargetUnknown    SSDPTargetKind = iota
+	SSDPTargetAll                       // ssdp:all
+	SSDPTargetRootDevice                // upnp:rootdevice
+	SSDPTargetUUID                      // uuid:device-UUID
+	SSDPTargetDevice                    // urn:domain:device:type:version
+	SSDPTargetService                   // urn:domain:service:type:version
+)
+
+func (k SSDPTargetKind) String() string {
+	switch k {
+	case SSDPTargetUnknown:
+		return "Unknown"
+	case SSDPTargetAll:
+		return "All"
+	case SSDPTargetRootDevice:
+		return "RootDevice"
+	case SSDPTargetUUID:
+		return "UUID"
+	case SSDPTargetDevice:
+		return "Device"
+	case SSDPTargetService:
+		return "Service"
+	default:
+		return fmt.Sprintf("UnknownSSDPTargetKind(%d)", k)
+	}
+}
+
+// SSDPTarget is the search target (ST) of an M-SEARCH request or its
+// responses, or the notification type (NT) of a NOTIFY request.
+type SSDPTarget struct {
+	Kind SSDPTargetKind
+	// Value is the target as given.
+	Value string
+	// UUID is set for UUID targets, and Domain, Type and Version for device
+	// and service types, like "schemas-upnp-org", "MediaRenderer" and 1.
+	UUID    string
+	Domain  string
+	Type    string
+	Version int
+}
+
+func (t SSDPTarget) String() string { return t.Value }
+
+func decodeSSDPTarget(v string) SSDPTarget {
+	t := SSDPTarget{Value: v}
+	lower := strings.ToLower(v)
+	switch {
+	case lower == "ssdp:all":
+		t.Kind = SSDPTargetAll
+	case lower == "upnp:rootdevice":
+		t.Kind = SSDPTargetRootDevice
+	case strings.HasPrefix(lower, "uuid:"):
+		t.Kind, t.UUID = SSDPTargetUUID, v[5:]
+	case strings.HasPrefix(lower, "urn:"):
+		f := strings.Split(v, ":")
+		if len(f) != 5 {
+			break
+		}
+		version, err := strconv.Atoi(f[4])
+		if err != nil {
+			break
+		}
+		switch strings.ToLower(f[2]) {
+		case "device":
+			t.Kind = SSDPTargetDevice
+		case "service":
+			t.Kind = SSDPTargetService
+		default:
+			return t
+		}
+		t.Domain, t.Type, t.Version = f[1], f[3], version
+	}
+	return t
+}
+
+// SSDPNotificationSubType is the NTS header field of a NOTIFY request.
+type SSDPNotificationSubType uint8
+
+// SSDP notification subtypes.
+const (
+	SSDPAlive SSDPNotificationSubType = iota + 1
+	SSDPByeBye
+	SSDPUpdate
+)
+
+func (n SSDPNotificationSubType) String() string {
+	switch n {
+	case SSDPAlive:
+		return "ssdp:alive"
+	case SSDPByeBye:
+		return "ssdp:byebye"
+	case SSDPUpdate:
+		return "ssdp:update"
+	default:
+		return fmt.Sprintf("UnknownSSDPNotificationSubType(%d)", n)
+	}
+}
+
+// SSDPProduct is a product token of a SERVER or USER-AGENT header field,
+// like "UPnP/1.0".
+type SSDPProduct struct {
+	Name, Version string
+}
+
+// SSDP is a Simple Service Discovery Protocol message (UPnP Device
+// Architecture 2.0 section 1), sent over UDP to port 1900, most often to
+// the 239.255.255.250 or ff02::c multicast groups.  Devices advertise
+// themselves and their services in NOTIFY requests, and answer M-SEARCH
+// requests with responses; the header fields identifying them are decoded
+// into the fields named after them.
+//
+// Use SSDPDevices to gather the devices advertised by a series of
+// messages.
+type SSDP struct {
+	BaseLayer
+	IsResponse bool
+	// Method and RequestURI are set for requests.
+	Method     string
+	RequestURI string
+	// StatusCode and Reason are set for responses.
+	StatusCode int
+	Reason     string
+	Version    string
+	Headers    []SSDPHeader
+
+	Host string
+	// Man and MX are set for M-SEARCH: Man is "ssdp:discover", and MX the
+	// most seconds responses may be delayed by.
+	Man string
+	MX  int
+	// ST is the search target of M-SEARCH requests and their responses,
+	// and NT and NTS the notification type and subtype of NOTIFY requests.
+	ST  SSDPTarget
+	NT  SSDPTarget
+	NTS SSDPNotificationSubType
+	// USN is the unique service name of the advertisement, and UUID the
+	// device UUID it starts with.
+	USN      string
+	UUID     string
+	Location string
+	// Server identifies the advertising device's software, and UserAgent
+	// that of the control point searching.
+	Server    string
+	UserAgent string
+	// MaxAge is the number of seconds the advertisement is valid for,
+	// from the CACHE-CONTROL header field.
+	MaxAge int
+	// BootID and ConfigID are the BOOTID.UPNP.ORG and CONFIGID.UPNP.ORG
+	// header fields, or zero if not given.
+	BootID   int
+	ConfigID int
+}
+
+// LayerType returns LayerTypeSSDP.
+func (s *SSDP) LayerType() gopacket.LayerType { return LayerTypeSSDP }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (s *SSDP) CanDecode() gopacket.LayerClass { return LayerTypeSSDP }
+
+// NextLayerType returns LayerTypePayload if there is a body.
+func (s *SSDP) NextLayerType() gopacket.LayerType {
+	if len(s.BaseLayer.Payload) == 0 {
+		return gopacket.LayerTypeZero
+	}
+	return gopacket.LayerTypePayload
+}
+
+// Payload returns the message body, which SSDP messages don't usually
+// have.
+func (s *SSDP) Payload() []byte { return s.BaseLayer.Payload }
+
+// Header returns the value of the first header field with the given name.
+// Names are case insensitive.
+func (s *SSDP) Header(name string) (string, bool) {
+	for _, h := range s.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value, true
+		}
+	}
+	return "", false
+}
+
+// Products returns the product tokens of the SERVER header field, or of
+// the USER-AGENT header field if there is no SERVER, as in M-SEARCH
+// requests.  Comments in parentheses are skipped, and words without a
+// version are taken as part of the following product's name, as in
+// "Portable SDK for UPnP devices/1.6.22".
+func (s *SSDP) Products() []SSDPProduct {
+	v := s.Server
+	if v == "" {
+		v = s.UserAgent
+	}
+	var out []SSDPProduct
+	var name []string
+	depth := 0
+	for _, w := range strings.Fields(strings.Replace(v, ",", " ", -1)) {
+		if depth > 0 || strings.HasPrefix(w, "(") {
+			if depth += strings.Count(w, "(") - strings.Count(w, ")"); depth < 0 {
+				depth = 0
+			}
+			continue
+		}
+		i := strings.IndexByte(w, '/')
+		if i < 0 {
+			name = append(name, w)
+			continue
+		}
+		out = append(out, SSDPProduct{Name: strings.Join(append(name, w[:i]), " "), Version: w[i+1:]})
+		name = nil
+	}
+	if name != nil {
+		out = append(out, SSDPProduct{Name: strings.Join(name, " ")})
+	}
+	return out
+}
+
+func decodeSSDP(data []byte, p gopacket.PacketBuilder) error {
+	// Other traffic to or from port 1900 is left as payload.
+	if !isSSDPMessage(data) {
+		return gopacket.DecodePayload.Decode(data, p)
+	}
+	s := &SSDP{}
+	if err := s.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(s)
+	p.SetApplicationLayer(s)
+	next := s.NextLayerType()
+	if next == gopacket.LayerTypeZero {
+		return nil
+	}
+	return p.NextDecoder(next)
+}
+
+// isSSDPMessage returns true if data starts with an HTTP request or status
+// line.
+func isSSDPMessage(data []byte) bool {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return false
+	}
+	line := string(bytes.TrimRight(data[:i], "\r"))
+	if strings.HasPrefix(line, "HTTP/1.") {
+		return true
+	}
+	f := strings.Fields(line)
+	return len(f) == 3 && strings.HasPrefix(f[2], "HTTP/1.") && ssdpIsMethod(f[0])
+}
+
+// ssdpIsMethod returns true if s is a method name: upper case letters and
+// hyphens, as in M-SEARCH.
+func ssdpIsMethod(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if (s[i] < 'A' || s[i] > 'Z') && s[i] != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.  Since a
+// datagram holds the whole message, header fields not ended by an empty
+// line are accepted.
+func (s *SSDP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	*s = SSDP{}
+	n := sipHeaderEnd(data)
+	if n < 0 {
+		n = len(data)
+	}
+	lines := strings.Split(strings.TrimRight(string(data[:n]), "\r\n"), "\n")
+	if err := s.decodeStartLine(strings.TrimRight(lines[0], "\r")); err != nil {
+		return err
+	}
+	for _, l := range lines[1:] {
+		l = strings.TrimRight(l, "\r")
+		i := strings.IndexByte(l, ':')
+		if i <= 0 {
+			return fmt.Errorf("SSDP header field %q malformed", l)
+		}
+		h := SSDPHeader{Name: strings.TrimSpace(l[:i]), Value: strings.TrimSpace(l[i+1:])}
+		s.Headers = append(s.Headers, h)
+		if err := s.decodeHeader(h); err != nil {
+			return fmt.Errorf("SSDP %s header field invalid: %v", h.Name, err)
+		}
+	}
+	s.BaseLayer = BaseLayer{Contents: data[:n], Payload: data[n:]}
+	return nil
+}
+
+func (s *SSDP) decodeStartLine(line string) error {
+	if strings.HasPrefix(line, "HTTP/1.") {
+		f := strings.SplitN(line, " ", 3)
+		if len(f) < 2 {
+			return fmt.Errorf("SSDP status line %q malformed", line)
+		}
+		code, err := strconv.Atoi(f[1])
+		if err != nil || code < 100 || code > 999 {
+			return fmt.Errorf("SSDP status code %q invalid", f[1])
+		}
+		s.IsResponse, s.Version, s.StatusCode = true, f[0], code
+		if len(f) == 3 {
+			s.Reason = f[2]
+		}
+		return nil
+	}
+	f := strings.Fields(line)
+	if len(f) != 3 || !strings.HasPrefix(f[2], "HTTP/1.") || !ssdpIsMethod(f[0]) {
+		return fmt.Errorf("SSDP request line %q malformed", line)
+	}
+	s.Method, s.RequestURI, s.Version = f[0], f[1], f[2]
+	return nil
+}
+
+func (s *SSDP) decodeHeader(h SSDPHeader) error {
+	var err error
+	switch strings.ToLower(h.Name) {
+	case "host":
+		s.Host = h.Value
+	case "man":
+		s.Man = strings.Trim(h.Value, `"`)
+	case "mx":
+		s.MX, err = strconv.Atoi(h.Value)
+	case "st":
+		s.ST = decodeSSDPTarget(h.Value)
+	case "nt":
+		s.NT = decodeSSDPTarget(h.Value)
+	case "nts":
+		switch strings.ToLower(h.Value) {
+		case "ssdp:alive":
+			s.NTS = SSDPAlive
+		case "ssdp:byebye":
+			s.NTS = SSDPByeBye
+		case "ssdp:update":
+			s.NTS = SSDPUpdate
+		default:
+			err = fmt.Errorf("subtype %q unknown", h.Value)
+		}
+	case "usn":
+		s.USN = h.Value
+		if strings.HasPrefix(strings.ToLower(h.Value), "uuid:") {
+			s.UUID = strings.SplitN(h.Value[5:], "::", 2)[0]
+		}
+	case "location", "al":
+		// AL, from older drafts, is a list of locations in angle
+		// brackets.
+		if s.Location == "" {
+			s.Location = strings.Trim(strings.SplitN(h.Value, ">", 2)[0], "<")
+		}
+	case "server":
+		s.Server = h.Value
+	case "user-agent":
+		s.UserAgent = h.Value
+	case "cache-control":
+		for _, d := range strings.Split(h.Value, ",") {
+			kv := strings.SplitN(strings.TrimSpace(d), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "max-age") {
+				s.MaxAge, err = strconv.Atoi(strings.TrimSpace(kv[1]))
+			}
+		}
+	case "bootid.upnp.org":
+		s.BootID, err = strconv.Atoi(h.Value)
+	case "configid.upnp.org":
+		s.ConfigID, err = strconv.Atoi(h.Value)
+	}
+	return err
+}
+
+// SSDPDevice is a UPnP device, as advertised by SSDP.
+type SSDPDevice struct {
+	UUID     string
+	Location string
+	Server   string
+	// RootDevice is set if the device advertised itself as a root device,
+	// rather than one embedded in another.
+	RootDevice bool
+	// DeviceTypes and ServiceTypes are the device and service types
+	// advertised, like "urn:schemas-upnp-org:device:MediaRenderer:1", in
+	// the order first seen.
+	DeviceTypes  []string
+	ServiceTypes []string
+	// MaxAge and BootID are those of the latest advertisement.
+	MaxAge int
+	BootID int
+	// Left is set if the device said it's leaving the network, until it
+	// advertises itself again.
+	Left bool
+}
+
+// SSDPDevices gathers the UPnP devices advertised by SSDP NOTIFY requests
+// and M-SEARCH responses, by device UUID.  Devices advertise each of their
+// types and services in separate messages, which Add merges.  The zero
+// value is ready to use.
+type SSDPDevices struct {
+	devices map[string]*SSDPDevice
+}
+
+// Add records the advertisement in s, and returns the device it's from.
+// It returns nil for M-SEARCH requests, error responses and messages
+// without a device UUID.
+func (d *SSDPDevices) Add(s *SSDP) *SSDPDevice {
+	var target SSDPTarget
+	switch {
+	case s.IsResponse && s.StatusCode == 200:
+		target = s.ST
+	case !s.IsResponse && s.Method == "NOTIFY":
+		target = s.NT
+	default:
+		return nil
+	}
+	if s.UUID == "" {
+		return nil
+	}
+	key := strings.ToLower(s.UUID)
+	dev := d.devices[key]
+	if dev == nil {
+		if d.devices == nil {
+			d.devices = make(map[string]*SSDPDevice)
+		}
+		dev = &SSDPDevice{UUID: s.UUID}
+		d.devices[key] = dev
+	}
+	if s.NTS == SSDPByeBye {
+		dev.Left = true
+		return dev
+	}
+	dev.Left = false
+	if s.Location != "" {
+		dev.Location = s.Location
+	}
+	if s.Server != "" {
+		dev.Server = s.Server
+	}
+	if s.MaxAge != 0 {
+		dev.MaxAge = s.MaxAge
+	}
+	if s.BootID != 0 {
+		dev.BootID = s.BootID
+	}
+	switch target.Kind {
+	case SSDPTargetRootDevice:
+		dev.RootDevice = true
+	case SSDPTargetDevice:
+		dev.DeviceTypes = ssdpAppendNew(dev.DeviceTypes, target.Value)
+	case SSDPTargetService:
+		dev.ServiceTypes = ssdpAppendNew(dev.ServiceTypes, target.Value)
+	}
+	return dev
+}
+
+func ssdpAppendNew(list []string, v string) []string {
+	for _, l := range list {
+		if l == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// Device returns the device with the given UUID, or nil if none has been
+// seen.
+func (d *SSDPDevices) Device(uuid string) *SSDPDevice {
+	return d.devices[strings.ToLower(uuid)]
+}
+
+// Devices returns the devices seen, sorted by UUID.
+func (d *SSDPDevices) Devices() []*SSDPDevice {
+	out := make([]*SSDPDevice, 0, len(d.devices))
+	for _, dev := range d.devices {
+		out = append(out, dev)
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i].UUID) < strings.ToLower(out[j].UUID) })
+	return out
+}
@@ -0,0 +1,212 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func testSSDPPacket(t *testing.T, srcPort, dstPort UDPPort, msg string) gopacket.Packet {
+	ip := &IPv4{Version: 4, TTL: 4, Protocol: IPProtocolUDP, SrcIP: net.IP{192, 168, 1, 20}, DstIP: net.IP{239, 255, 255, 250}}
+	udp := &UDP{SrcPort: srcPort, DstPort: dstPort}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload(msg)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	return p
+}
+
+func testSSDPMessage(lines ...string) string {
+	return strings.Join(lines, "\r\n") + "\r\n\r\n"
+}
+
+var testSSDPNotify = testSSDPMessage(
+	"NOTIFY * HTTP/1.1",
+	"HOST: 239.255.255.250:1900",
+	"CACHE-CONTROL: max-age=1800",
+	"LOCATION: http://192.168.1.20:49152/description.xml",
+	"NT: urn:schemas-upnp-org:device:MediaRenderer:1",
+	"NTS: ssdp:alive",
+	"SERVER: Linux/4.9 (armv7l) UPnP/1.0 Portable SDK for UPnP devices/1.6.22",
+	"USN: uuid:2f402f80-da50-11e1-9b23-00178829d301::urn:schemas-upnp-org:device:MediaRenderer:1",
+	"BOOTID.UPNP.ORG: 7",
+	"CONFIGID.UPNP.ORG: 2",
+)
+
+var testSSDPSearch = testSSDPMessage(
+	"M-SEARCH * HTTP/1.1",
+	"HOST: 239.255.255.250:1900",
+	`MAN: "ssdp:discover"`,
+	"MX: 3",
+	"ST: ssdp:all",
+	"USER-AGENT: Android/13 UPnP/1.1 Cling/2.1",
+)
+
+var testSSDPResponse = testSSDPMessage(
+	"HTTP/1.1 200 OK",
+	"CACHE-CONTROL: max-age = 100",
+	"EXT:",
+	"LOCATION: http://192.168.1.20:49152/description.xml",
+	"SERVER: Linux/4.9 (armv7l) UPnP/1.0 Portable SDK for UPnP devices/1.6.22",
+	"ST: upnp:rootdevice",
+	"USN: uuid:2F402F80-DA50-11E1-9B23-00178829D301::upnp:rootdevice",
+)
+
+func TestSSDPNotify(t *testing.T) {
+	p := testSSDPPacket(t, 1900, 1900, testSSDPNotify)
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeSSDP}, t)
+	s := p.Layer(LayerTypeSSDP).(*SSDP)
+	if s.IsResponse || s.Method != "NOTIFY" || s.RequestURI != "*" || s.Version != "HTTP/1.1" {
+		t.Errorf("got request line %q %q %q", s.Method, s.RequestURI, s.Version)
+	}
+	want := SSDPTarget{Kind: SSDPTargetDevice, Value: "urn:schemas-upnp-org:device:MediaRenderer:1",
+		Domain: "schemas-upnp-org", Type: "MediaRenderer", Version: 1}
+	if !reflect.DeepEqual(s.NT, want) {
+		t.Errorf("got NT %+v, want %+v", s.NT, want)
+	}
+	if s.NTS != SSDPAlive || s.UUID != "2f402f80-da50-11e1-9b23-00178829d301" || s.MaxAge != 1800 || s.BootID != 7 || s.ConfigID != 2 {
+		t.Errorf("got %+v", s)
+	}
+	if s.Location != "http://192.168.1.20:49152/description.xml" || s.Host != "239.255.255.250:1900" {
+		t.Errorf("got location %q host %q", s.Location, s.Host)
+	}
+	wantProducts := []SSDPProduct{{"Linux", "4.9"}, {"UPnP", "1.0"}, {"Portable SDK for UPnP devices", "1.6.22"}}
+	if got := s.Products(); !reflect.DeepEqual(got, wantProducts) {
+		t.Errorf("got products %q, want %q", got, wantProducts)
+	}
+	if s.NextLayerType() != gopacket.LayerTypeZero {
+		t.Errorf("got next layer %v", s.NextLayerType())
+	}
+}
+
+func TestSSDPSearch(t *testing.T) {
+	p := testSSDPPacket(t, 50123, 1900, testSSDPSearch)
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeSSDP}, t)
+	s := p.Layer(LayerTypeSSDP).(*SSDP)
+	if s.Method != "M-SEARCH" || s.Man != "ssdp:discover" || s.MX != 3 || s.ST.Kind != SSDPTargetAll {
+		t.Errorf("got %+v", s)
+	}
+	wantProducts := []SSDPProduct{{"Android", "13"}, {"UPnP", "1.1"}, {"Cling", "2.1"}}
+	if got := s.Products(); !reflect.DeepEqual(got, wantProducts) {
+		t.Errorf("got products %q, want %q", got, wantProducts)
+	}
+
+	// The response comes from port 1900.
+	p = testSSDPPacket(t, 1900, 50123, testSSDPResponse)
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeSSDP}, t)
+	s = p.Layer(LayerTypeSSDP).(*SSDP)
+	if !s.IsResponse || s.StatusCode != 200 || s.Reason != "OK" || s.ST.Kind != SSDPTargetRootDevice || s.MaxAge != 100 {
+		t.Errorf("got %+v", s)
+	}
+	if v, ok := s.Header("ext"); !ok || v != "" {
+		t.Errorf("got EXT %q, %v", v, ok)
+	}
+}
+
+func TestSSDPTarget(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want SSDPTarget
+	}{
+		{"uuid:abc-123", SSDPTarget{Kind: SSDPTargetUUID, Value: "uuid:abc-123", UUID: "abc-123"}},
+		{"urn:schemas-upnp-org:service:ContentDirectory:2", SSDPTarget{Kind: SSDPTargetService,
+			Value: "urn:schemas-upnp-org:service:ContentDirectory:2", Domain: "schemas-upnp-org", Type: "ContentDirectory", Version: 2}},
+		{"urn:dial-multiscreen-org:service:dial:1", SSDPTarget{Kind: SSDPTargetService,
+			Value: "urn:dial-multiscreen-org:service:dial:1", Domain: "dial-multiscreen-org", Type: "dial", Version: 1}},
+		{"urn:schemas-upnp-org:device:Basic", SSDPTarget{Value: "urn:schemas-upnp-org:device:Basic"}},
+		{"roku:ecp", SSDPTarget{Value: "roku:ecp"}},
+	} {
+		if got := decodeSSDPTarget(c.in); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %+v, want %+v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestSSDPDevices(t *testing.T) {
+	var devs SSDPDevices
+	decode := func(msg string) *SSDP {
+		s := &SSDP{}
+		if err := s.DecodeFromBytes([]byte(msg), gopacket.NilDecodeFeedback); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	if d := devs.Add(decode(testSSDPSearch)); d != nil {
+		t.Errorf("M-SEARCH added device %+v", d)
+	}
+	devs.Add(decode(testSSDPNotify))
+	devs.Add(decode(strings.Replace(testSSDPNotify, "device:MediaRenderer:1\r\nNTS", "service:AVTransport:1\r\nNTS", 1)))
+	devs.Add(decode(testSSDPNotify))
+	devs.Add(decode(testSSDPResponse))
+	devs.Add(decode(strings.Replace(testSSDPResponse, "2F402F80", "00000000", 1)))
+
+	got := devs.Devices()
+	if len(got) != 2 {
+		t.Fatalf("got %d devices, want 2", len(got))
+	}
+	want := &SSDPDevice{
+		UUID:         "2f402f80-da50-11e1-9b23-00178829d301",
+		Location:     "http://192.168.1.20:49152/description.xml",
+		Server:       "Linux/4.9 (armv7l) UPnP/1.0 Portable SDK for UPnP devices/1.6.22",
+		RootDevice:   true,
+		DeviceTypes:  []string{"urn:schemas-upnp-org:device:MediaRenderer:1"},
+		ServiceTypes: []string{"urn:schemas-upnp-org:service:AVTransport:1"},
+		MaxAge:       100,
+		BootID:       7,
+	}
+	if d := devs.Device("2F402F80-DA50-11E1-9B23-00178829D301"); !reflect.DeepEqual(d, want) || got[1] != d {
+		t.Errorf("got device\n%+v\nwant\n%+v", d, want)
+	}
+
+	bye := testSSDPMessage(
+		"NOTIFY * HTTP/1.1",
+		"HOST: 239.255.255.250:1900",
+		"NT: upnp:rootdevice",
+		"NTS: ssdp:byebye",
+		"USN: uuid:2f402f80-da50-11e1-9b23-00178829d301::upnp:rootdevice",
+	)
+	if d := devs.Add(decode(bye)); d == nil || !d.Left || d.Location == "" {
+		t.Errorf("got device after byebye %+v", d)
+	}
+	if d := devs.Add(decode(testSSDPNotify)); d.Left {
+		t.Errorf("device still left after alive: %+v", d)
+	}
+}
+
+func TestSSDPMalformed(t *testing.T) {
+	for _, msg := range []string{
+		"NOTIFY * HTTP/1.1\r\nNTS: ssdp:dead\r\n\r\n",
+		"M-SEARCH * HTTP/1.1\r\nMX: soon\r\n\r\n",
+		"HTTP/1.1 2000 OK\r\n\r\n",
+		"NOTIFY * HTTP/1.1\r\nno colon\r\n\r\n",
+	} {
+		s := &SSDP{}
+		if err := s.DecodeFromBytes([]byte(msg), gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("%q decoded without error", msg)
+		}
+	}
+
+	// A message missing its final empty line is accepted.
+	s := &SSDP{}
+	if err := s.DecodeFromBytes([]byte("M-SEARCH * HTTP/1.1\r\nST: ssdp:all\r\n"), gopacket.NilDecodeFeedback); err != nil || s.ST.Kind != SSDPTargetAll {
+		t.Errorf("got %+v, %v", s, err)
+	}
+
+	p := testSSDPPacket(t, 1900, 1900, "\x00\x01 not ssdp")
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, gopacket.LayerTypePayload}, t)
+}
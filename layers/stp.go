@@ -0,0 +1,389 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// BPDUs are sent with LLC DSAP and SSAP 0x42.  Configuration BPDUs are 35
+// bytes long, RST BPDUs add a version 1 length byte, and MST BPDUs add the
+// MST configuration and CIST information, followed by up to 64 MSTI
+// configuration messages.
+const (
+	stpLLCSAP          = 0x42
+	stpTCNLength       = 4
+	stpConfigLength    = 35
+	stpRSTLength       = 36
+	stpMSTLength       = 102
+	stpMSTILength      = 16
+	stpMSTNameLength   = 32
+	stpMSTDigestLength = 16
+	stpMSTV3Fixed      = stpMSTLength - stpRSTLength - 2
+	stpTimerUnitsPerS  = 256
+)
+
+// STPVersion is the protocol version of a BPDU.
+type STPVersion uint8
+
+const (
+	STPVersionSTP  STPVersion = 0
+	STPVersionRSTP STPVersion = 2
+	STPVersionMSTP STPVersion = 3
+)
+
+func (v STPVersion) String() string {
+	switch v {
+	case STPVersionSTP:
+		return "STP"
+	case STPVersionRSTP:
+		return "RSTP"
+	case STPVersionMSTP:
+		return "MSTP"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(v))
+}
+
+// STPBPDUType is the type of a BPDU.
+type STPBPDUType uint8
+
+const (
+	STPBPDUTypeConfig STPBPDUType = 0x00
+	// STPBPDUTypeRST is used by both RSTP and MSTP.
+	STPBPDUTypeRST STPBPDUType = 0x02
+	// STPBPDUTypeTCN is a topology change notification, which has no
+	// fields beyond the type.
+	STPBPDUTypeTCN STPBPDUType = 0x80
+)
+
+func (t STPBPDUType) String() string {
+	switch t {
+	case STPBPDUTypeConfig:
+		return "Config"
+	case STPBPDUTypeRST:
+		return "RST"
+	case STPBPDUTypeTCN:
+		return "TCN"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(t))
+}
+
+// STPFlags are the flags of a BPDU or MSTI configuration message.
+// Configuration BPDUs only use STPFlagTopologyChange and
+// STPFlagTopologyChangeAck.
+type STPFlags uint8
+
+const (
+	STPFlagTopologyChange    STPFlags = 0x01
+	STPFlagProposal          STPFlags = 0x02
+	STPFlagPortRole          STPFlags = 0x0c
+	STPFlagLearning          STPFlags = 0x10
+	STPFlagForwarding        STPFlags = 0x20
+	STPFlagAgreement         STPFlags = 0x40
+	STPFlagTopologyChangeAck STPFlags = 0x80
+)
+
+// Role returns the port role the flags carry.
+func (f STPFlags) Role() STPPortRole { return STPPortRole(f&STPFlagPortRole) >> 2 }
+
+// STPPortRole is the role of the port sending an RST or MST BPDU.
+type STPPortRole uint8
+
+const (
+	STPPortRoleUnknown STPPortRole = 0
+	// STPPortRoleAlternate is also sent for backup ports.
+	STPPortRoleAlternate  STPPortRole = 1
+	STPPortRoleRoot       STPPortRole = 2
+	STPPortRoleDesignated STPPortRole = 3
+)
+
+func (r STPPortRole) String() string {
+	switch r {
+	case STPPortRoleUnknown:
+		return "Unknown"
+	case STPPortRoleAlternate:
+		return "Alternate/Backup"
+	case STPPortRoleRoot:
+		return "Root"
+	case STPPortRoleDesignated:
+		return "Designated"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(r))
+}
+
+// STPBridgeID identifies a bridge.  Since 802.1D-2004 the priority is a
+// multiple of 4096, and the low 12 bits carry a system ID extension, which
+// is the VLAN for per-VLAN spanning trees and the MSTI for MSTP.
+type STPBridgeID struct {
+	Priority          uint16
+	SystemIDExtension uint16
+	Address           net.HardwareAddr
+}
+
+func (id *STPBridgeID) decode(b []byte) {
+	p := binary.BigEndian.Uint16(b[0:2])
+	id.Priority, id.SystemIDExtension = p&0xf000, p&0x0fff
+	id.Address = net.HardwareAddr(b[2:8])
+}
+
+func (id *STPBridgeID) encode(b []byte) error {
+	if id.Priority&0x0fff != 0 || id.SystemIDExtension&0xf000 != 0 {
+		return fmt.Errorf("invalid STP bridge priority %d and system ID extension %d", id.Priority, id.SystemIDExtension)
+	}
+	if id.Address != nil && len(id.Address) != 6 {
+		return fmt.Errorf("invalid STP bridge address %v", id.Address)
+	}
+	binary.BigEndian.PutUint16(b[0:2], id.Priority|id.SystemIDExtension)
+	copy(b[2:8], id.Address)
+	return nil
+}
+
+func (id STPBridgeID) String() string {
+	return fmt.Sprintf("%d.%d.%v", id.Priority, id.SystemIDExtension, id.Address)
+}
+
+// MSTIConfig is an MSTI configuration message, the state of one multiple
+// spanning tree instance.
+type MSTIConfig struct {
+	Flags STPFlags
+	// RegionalRootID's system ID extension is the MSTI number.
+	RegionalRootID       STPBridgeID
+	InternalRootPathCost uint32
+	// BridgePriority and PortPriority are sent in the high four bits of
+	// their bytes, and hold those bits.
+	BridgePriority, PortPriority uint8
+	RemainingHops                uint8
+}
+
+// MSTConfig is the MSTP part of an MST BPDU.  Bridges are in the same MST
+// region if they agree on Name, Revision and Digest, the digest of their
+// VLAN to MSTI mappings.
+type MSTConfig struct {
+	FormatSelector uint8
+	Name           string
+	Revision       uint16
+	Digest         []byte
+	// The CIST fields describe the common and internal spanning tree
+	// within the region.
+	CISTInternalRootPathCost uint32
+	CISTBridgeID             STPBridgeID
+	CISTRemainingHops        uint8
+	MSTIs                    []MSTIConfig
+}
+
+// STP is a spanning tree BPDU: an 802.1D configuration or topology change
+// notification BPDU, an 802.1w RST BPDU, or an 802.1s MST BPDU.
+type STP struct {
+	BaseLayer
+	ProtocolID uint16
+	Version    STPVersion
+	Type       STPBPDUType
+	// The rest of the fields are not set for TCN BPDUs.
+	Flags        STPFlags
+	RootID       STPBridgeID
+	RootPathCost uint32
+	BridgeID     STPBridgeID
+	PortID       uint16
+	// The timers are sent in 1/256ths of a second.
+	MessageAge, MaxAge, HelloTime, ForwardDelay time.Duration
+	// MST is set for MST BPDUs.  For them, RootID and RootPathCost are the
+	// CIST root and external root path cost, and BridgeID the CIST
+	// regional root.
+	MST *MSTConfig
+}
+
+// LayerType returns LayerTypeSTP.
+func (s *STP) LayerType() gopacket.LayerType { return LayerTypeSTP }
+
+func (s *STP) CanDecode() gopacket.LayerClass { return LayerTypeSTP }
+
+func (s *STP) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+func stpTimer(b []byte) time.Duration {
+	return time.Duration(binary.BigEndian.Uint16(b)) * time.Second / stpTimerUnitsPerS
+}
+
+func putSTPTimer(b []byte, d time.Duration) {
+	binary.BigEndian.PutUint16(b, uint16(d*stpTimerUnitsPerS/time.Second))
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (s *STP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < stpTCNLength {
+		df.SetTruncated()
+		return fmt.Errorf("STP length %d too short", len(data))
+	}
+	*s = STP{
+		ProtocolID: binary.BigEndian.Uint16(data[0:2]),
+		Version:    STPVersion(data[2]),
+		Type:       STPBPDUType(data[3]),
+	}
+	if s.ProtocolID != 0 {
+		return fmt.Errorf("STP protocol ID %d unknown", s.ProtocolID)
+	}
+	length := stpTCNLength
+	switch s.Type {
+	case STPBPDUTypeTCN:
+	case STPBPDUTypeConfig, STPBPDUTypeRST:
+		length = stpConfigLength
+		if s.Type == STPBPDUTypeRST {
+			length = stpRSTLength
+		}
+		if len(data) < length {
+			df.SetTruncated()
+			return fmt.Errorf("STP %v BPDU length %d too short", s.Type, len(data))
+		}
+		s.Flags = STPFlags(data[4])
+		s.RootID.decode(data[5:13])
+		s.RootPathCost = binary.BigEndian.Uint32(data[13:17])
+		s.BridgeID.decode(data[17:25])
+		s.PortID = binary.BigEndian.Uint16(data[25:27])
+		s.MessageAge = stpTimer(data[27:29])
+		s.MaxAge = stpTimer(data[29:31])
+		s.HelloTime = stpTimer(data[31:33])
+		s.ForwardDelay = stpTimer(data[33:35])
+		// MSTP bridges that aren't sending MST BPDUs send version 3 RST
+		// BPDUs without the MST part, so go by the version 3 length.
+		if s.Type == STPBPDUTypeRST && s.Version >= STPVersionMSTP && len(data) >= stpRSTLength+2 {
+			v3 := int(binary.BigEndian.Uint16(data[36:38]))
+			if v3 < stpMSTV3Fixed || (v3-stpMSTV3Fixed)%stpMSTILength != 0 {
+				return fmt.Errorf("MSTP version 3 length %d invalid", v3)
+			}
+			length = stpRSTLength + 2 + v3
+			if len(data) < length {
+				df.SetTruncated()
+				return fmt.Errorf("MST BPDU length %d too short, want %d", len(data), length)
+			}
+			s.MST = decodeMSTConfig(data[38:length])
+		}
+	default:
+		return fmt.Errorf("STP BPDU type %d unknown", data[3])
+	}
+	// Anything after the BPDU is padding.
+	s.BaseLayer = BaseLayer{Contents: data[:length], Payload: data[length:]}
+	return nil
+}
+
+func decodeMSTConfig(b []byte) *MSTConfig {
+	m := &MSTConfig{
+		FormatSelector:           b[0],
+		Name:                     strings.TrimRight(string(b[1:33]), "\x00"),
+		Revision:                 binary.BigEndian.Uint16(b[33:35]),
+		Digest:                   b[35:51],
+		CISTInternalRootPathCost: binary.BigEndian.Uint32(b[51:55]),
+		CISTRemainingHops:        b[63],
+	}
+	m.CISTBridgeID.decode(b[55:63])
+	for b = b[stpMSTV3Fixed:]; len(b) >= stpMSTILength; b = b[stpMSTILength:] {
+		c := MSTIConfig{
+			Flags:                STPFlags(b[0]),
+			InternalRootPathCost: binary.BigEndian.Uint32(b[9:13]),
+			BridgePriority:       b[13],
+			PortPriority:         b[14],
+			RemainingHops:        b[15],
+		}
+		c.RegionalRootID.decode(b[1:9])
+		m.MSTIs = append(m.MSTIs, c)
+	}
+	return m
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.
+// See the docs for gopacket.SerializableLayer for more info.  The length
+// written follows Type, and MST if it is set.
+func (s *STP) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	length := stpTCNLength
+	switch s.Type {
+	case STPBPDUTypeTCN:
+	case STPBPDUTypeConfig:
+		length = stpConfigLength
+	case STPBPDUTypeRST:
+		length = stpRSTLength
+		if s.MST != nil {
+			length = stpMSTLength + len(s.MST.MSTIs)*stpMSTILength
+		}
+	default:
+		return fmt.Errorf("STP BPDU type %d unknown", uint8(s.Type))
+	}
+	if s.MST != nil && s.Type != STPBPDUTypeRST {
+		return fmt.Errorf("MST configuration in %v BPDU", s.Type)
+	}
+	bytes, err := b.PrependBytes(length)
+	if err != nil {
+		return err
+	}
+	for i := range bytes {
+		bytes[i] = 0
+	}
+	binary.BigEndian.PutUint16(bytes[0:2], s.ProtocolID)
+	bytes[2] = uint8(s.Version)
+	bytes[3] = uint8(s.Type)
+	if s.Type == STPBPDUTypeTCN {
+		return nil
+	}
+	bytes[4] = uint8(s.Flags)
+	if err := s.RootID.encode(bytes[5:13]); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(bytes[13:17], s.RootPathCost)
+	if err := s.BridgeID.encode(bytes[17:25]); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint16(bytes[25:27], s.PortID)
+	putSTPTimer(bytes[27:29], s.MessageAge)
+	putSTPTimer(bytes[29:31], s.MaxAge)
+	putSTPTimer(bytes[31:33], s.HelloTime)
+	putSTPTimer(bytes[33:35], s.ForwardDelay)
+	// The version 1 length, at byte 35, is always zero.
+	if s.MST != nil {
+		return s.MST.encode(bytes[36:])
+	}
+	return nil
+}
+
+func (m *MSTConfig) encode(b []byte) error {
+	if len(m.Name) > stpMSTNameLength {
+		return fmt.Errorf("MST configuration name %q too long", m.Name)
+	}
+	if m.Digest != nil && len(m.Digest) != stpMSTDigestLength {
+		return fmt.Errorf("MST configuration digest length %d invalid", len(m.Digest))
+	}
+	binary.BigEndian.PutUint16(b[0:2], uint16(len(b)-2))
+	b = b[2:]
+	b[0] = m.FormatSelector
+	copy(b[1:33], m.Name)
+	binary.BigEndian.PutUint16(b[33:35], m.Revision)
+	copy(b[35:51], m.Digest)
+	binary.BigEndian.PutUint32(b[51:55], m.CISTInternalRootPathCost)
+	if err := m.CISTBridgeID.encode(b[55:63]); err != nil {
+		return err
+	}
+	b[63] = m.CISTRemainingHops
+	b = b[stpMSTV3Fixed:]
+	for i := range m.MSTIs {
+		c := &m.MSTIs[i]
+		b[0] = uint8(c.Flags)
+		if err := c.RegionalRootID.encode(b[1:9]); err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint32(b[9:13], c.InternalRootPathCost)
+		b[13], b[14], b[15] = c.BridgePriority, c.PortPriority, c.RemainingHops
+		b = b[stpMSTILength:]
+	}
+	return nil
+}
+
+func decodeSTP(data []byte, p gopacket.PacketBuilder) error {
+	return decodingLayerDecoder(&STP{}, data, p)
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testPacketSTPConfig is an 802.1D configuration BPDU for VLAN 1, padded to
+// the minimum frame size.
+var testPacketSTPConfig = []byte{
+	0x01, 0x80, 0xc2, 0x00, 0x00, 0x00, 0x00, 0x1c, 0x0e, 0x87, 0x85, 0x04, 0x00, 0x26,
+	0x42, 0x42, 0x03,
+	0x00, 0x00, 0x00, 0x00, 0x00,
+	0x80, 0x01, 0x00, 0x1c, 0x0e, 0x87, 0x78, 0x00,
+	0x00, 0x00, 0x00, 0x04,
+	0x80, 0x01, 0x00, 0x1c, 0x0e, 0x87, 0x85, 0x00,
+	0x80, 0x04, 0x01, 0x00, 0x14, 0x00, 0x02, 0x00, 0x0f, 0x00,
+	0, 0, 0, 0, 0, 0, 0, 0,
+}
+
+func TestPacketSTPConfig(t *testing.T) {
+	p := gopacket.NewPacket(testPacketSTPConfig, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeLLC, LayerTypeSTP}, t)
+	stp := p.Layer(LayerTypeSTP).(*STP)
+	root := STPBridgeID{Priority: 32768, SystemIDExtension: 1, Address: net.HardwareAddr{0x00, 0x1c, 0x0e, 0x87, 0x78, 0x00}}
+	if stp.Version != STPVersionSTP || stp.Type != STPBPDUTypeConfig || !reflect.DeepEqual(stp.RootID, root) {
+		t.Errorf("got %+v", stp)
+	}
+	if stp.RootPathCost != 4 || stp.BridgeID.String() != "32768.1.00:1c:0e:87:85:00" || stp.PortID != 0x8004 {
+		t.Errorf("got cost %d, bridge %v, port %#x", stp.RootPathCost, stp.BridgeID, stp.PortID)
+	}
+	if stp.MessageAge != time.Second || stp.MaxAge != 20*time.Second || stp.HelloTime != 2*time.Second || stp.ForwardDelay != 15*time.Second {
+		t.Errorf("got timers %v %v %v %v", stp.MessageAge, stp.MaxAge, stp.HelloTime, stp.ForwardDelay)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	if err := stp.SerializeTo(buf, gopacket.SerializeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.Bytes(), testPacketSTPConfig[17:52]; !reflect.DeepEqual(got, want) {
+		t.Errorf("serialized\n%x\nwant\n%x", got, want)
+	}
+}
+
+func TestSTPSerialize(t *testing.T) {
+	bridge := net.HardwareAddr{0x00, 0x1b, 0x54, 0x00, 0x00, 0x01}
+	root := STPBridgeID{Priority: 4096, Address: net.HardwareAddr{0x00, 0x1b, 0x54, 0x00, 0x00, 0x09}}
+	for _, want := range []*STP{
+		{Version: STPVersionSTP, Type: STPBPDUTypeTCN},
+		{
+			Version:      STPVersionRSTP,
+			Type:         STPBPDUTypeRST,
+			Flags:        STPFlagProposal | STPFlags(STPPortRoleDesignated<<2) | STPFlagLearning | STPFlagForwarding,
+			RootID:       root,
+			RootPathCost: 20000,
+			BridgeID:     STPBridgeID{Priority: 32768, Address: bridge},
+			PortID:       0x8002,
+			MaxAge:       20 * time.Second,
+			HelloTime:    2 * time.Second,
+			ForwardDelay: 15 * time.Second,
+		},
+		{
+			Version:  STPVersionMSTP,
+			Type:     STPBPDUTypeRST,
+			Flags:    STPFlags(STPPortRoleRoot<<2) | STPFlagAgreement,
+			RootID:   root,
+			BridgeID: root,
+			PortID:   0x8001,
+			MaxAge:   20 * time.Second,
+			MST: &MSTConfig{
+				Name:                     "region1",
+				Revision:                 3,
+				Digest:                   make([]byte, 16),
+				CISTInternalRootPathCost: 20000,
+				CISTBridgeID:             STPBridgeID{Priority: 32768, Address: bridge},
+				CISTRemainingHops:        19,
+				MSTIs: []MSTIConfig{{
+					Flags:                STPFlags(STPPortRoleDesignated<<2) | STPFlagForwarding,
+					RegionalRootID:       STPBridgeID{Priority: 8192, SystemIDExtension: 1, Address: bridge},
+					InternalRootPathCost: 0,
+					BridgePriority:       0x20,
+					PortPriority:         0x80,
+					RemainingHops:        20,
+				}},
+			},
+		},
+	} {
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true}
+		err := gopacket.SerializeLayers(buf, opts,
+			&Ethernet{SrcMAC: bridge, DstMAC: net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x00}, EthernetType: EthernetTypeLLC},
+			&LLC{DSAP: 0x42, SSAP: 0x42, Control: LLCControlUI},
+			want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := gopacket.NewPacket(buf.Bytes(), LinkTypeEthernet, gopacket.Default)
+		if p.ErrorLayer() != nil {
+			t.Fatalf("%v: failed to decode packet: %v", want.Type, p.ErrorLayer().Error())
+		}
+		got, ok := p.Layer(LayerTypeSTP).(*STP)
+		if !ok {
+			t.Fatalf("%v: no STP layer in %v", want.Type, p)
+		}
+		got.BaseLayer = BaseLayer{}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v\nwant %+v", got, want)
+		}
+	}
+	if got := (STPFlags(STPPortRoleRoot<<2) | STPFlagAgreement).Role(); got != STPPortRoleRoot {
+		t.Errorf("got role %v", got)
+	}
+}
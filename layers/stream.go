@@ -0,0 +1,67 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// streamFramer finds the message at the start of data, the unconsumed
+// part of a reassembled stream.  It returns the message's length and a
+// layer to decode it into, or a zero length if data doesn't yet hold
+// enough of the message to know it.  The length may exceed len(data), and
+// is an int64 so lengths read from the stream can't overflow int on 32-bit
+// platforms.  A nil layer discards the bytes, as for keepalives between
+// messages.
+type streamFramer func(data []byte) (n int64, l layerDecodingLayer, err error)
+
+// streamBuffer splits one direction of a reassembled TCP stream into
+// messages, for the stream types of protocols such as BGPStream.  Its zero
+// value is ready to use.
+type streamBuffer struct {
+	buf []byte
+}
+
+// decode appends data to the buffer, and decodes the messages completed
+// by it, as found by frame.  Messages longer than max bytes are an error,
+// so a peer can't make the buffer grow without bound.
+func (s *streamBuffer) decode(data []byte, proto string, max int, frame streamFramer) ([]gopacket.Layer, error) {
+	s.buf = append(s.buf, data...)
+	var out []gopacket.Layer
+	for len(s.buf) > 0 {
+		n, l, err := frame(s.buf)
+		if err != nil {
+			return out, err
+		}
+		if n < 0 {
+			return out, fmt.Errorf("%s message length %d invalid", proto, n)
+		}
+		if n > int64(max) || n == 0 && len(s.buf) > max {
+			return out, fmt.Errorf("%s message exceeds %d bytes", proto, max)
+		}
+		if n == 0 || n > int64(len(s.buf)) {
+			break
+		}
+		if l != nil {
+			if err := l.DecodeFromBytes(append([]byte{}, s.buf[:n]...), gopacket.NilDecodeFeedback); err != nil {
+				return out, err
+			}
+			out = append(out, l)
+		}
+		s.buf = s.buf[n:]
+	}
+	// Copy the partial message, so the consumed data can be freed.
+	s.buf = append([]byte{}, s.buf...)
+	return out, nil
+}
+
+// reset discards any partial message.
+func (s *streamBuffer) reset() {
+	s.buf = nil
+}
@@ -0,0 +1,534 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+
+	"github.com/mistsys/gopacket"
+)
+
+// STUNMagicCookie is the fixed value in every STUN message since RFC 5389,
+// which also keys the XOR address attributes.
+const STUNMagicCookie = 0x2112a442
+
+// stunFingerprintXOR is XORed with the CRC of a message to give its
+// FINGERPRINT attribute.
+const stunFingerprintXOR = 0x5354554e
+
+// STUNClass is the class of a STUN message.
+type STUNClass uint8
+
+// STUN message classes.
+const (
+	STUNClassRequest         STUNClass = 0
+	STUNClassIndication      STUNClass = 1
+	STUNClassSuccessResponse STUNClass = 2
+	STUNClassErrorResponse   STUNClass = 3
+)
+
+func (c STUNClass) String() string {
+	switch c {
+	case STUNClassRequest:
+		return "Request"
+	case STUNClassIndication:
+		return "Indication"
+	case STUNClassSuccessResponse:
+		return "SuccessResponse"
+	case STUNClassErrorResponse:
+		return "ErrorResponse"
+	default:
+		return fmt.Sprintf("UnknownSTUNClass(%d)", c)
+	}
+}
+
+// STUNMethod is the method of a STUN message.
+type STUNMethod uint16
+
+// STUN methods (RFC 8489), and those of TURN (RFC 8656).
+const (
+	STUNMethodBinding          STUNMethod = 0x001
+	STUNMethodAllocate         STUNMethod = 0x003
+	STUNMethodRefresh          STUNMethod = 0x004
+	STUNMethodSend             STUNMethod = 0x006
+	STUNMethodData             STUNMethod = 0x007
+	STUNMethodCreatePermission STUNMethod = 0x008
+	STUNMethodChannelBind      STUNMethod = 0x009
+)
+
+func (m STUNMethod) String() string {
+	switch m {
+	case STUNMethodBinding:
+		return "Binding"
+	case STUNMethodAllocate:
+		return "Allocate"
+	case STUNMethodRefresh:
+		return "Refresh"
+	case STUNMethodSend:
+		return "Send"
+	case STUNMethodData:
+		return "Data"
+	case STUNMethodCreatePermission:
+		return "CreatePermission"
+	case STUNMethodChannelBind:
+		return "ChannelBind"
+	default:
+		return fmt.Sprintf("UnknownSTUNMethod(%d)", m)
+	}
+}
+
+// STUNAttributeType is the type of a STUN attribute.
+type STUNAttributeType uint16
+
+// STUN attribute types (RFC 8489, RFC 8656 and RFC 8445).
+const (
+	STUNAttributeMappedAddress          STUNAttributeType = 0x0001
+	STUNAttributeUsername               STUNAttributeType = 0x0006
+	STUNAttributeMessageIntegrity       STUNAttributeType = 0x0008
+	STUNAttributeErrorCode              STUNAttributeType = 0x0009
+	STUNAttributeUnknownAttributes      STUNAttributeType = 0x000a
+	STUNAttributeChannelNumber          STUNAttributeType = 0x000c
+	STUNAttributeLifetime               STUNAttributeType = 0x000d
+	STUNAttributeXORPeerAddress         STUNAttributeType = 0x0012
+	STUNAttributeData                   STUNAttributeType = 0x0013
+	STUNAttributeRealm                  STUNAttributeType = 0x0014
+	STUNAttributeNonce                  STUNAttributeType = 0x0015
+	STUNAttributeXORRelayedAddress      STUNAttributeType = 0x0016
+	STUNAttributeRequestedTransport     STUNAttributeType = 0x0019
+	STUNAttributeMessageIntegritySHA256 STUNAttributeType = 0x001c
+	STUNAttributeUserhash               STUNAttributeType = 0x001e
+	STUNAttributeXORMappedAddress       STUNAttributeType = 0x0020
+	STUNAttributePriority               STUNAttributeType = 0x0024
+	STUNAttributeUseCandidate           STUNAttributeType = 0x0025
+	STUNAttributeSoftware               STUNAttributeType = 0x8022
+	STUNAttributeAlternateServer        STUNAttributeType = 0x8023
+	STUNAttributeFingerprint            STUNAttributeType = 0x8028
+	STUNAttributeICEControlled          STUNAttributeType = 0x8029
+	STUNAttributeICEControlling         STUNAttributeType = 0x802a
+)
+
+func (t STUNAttributeType) String() string {
+	switch t {
+	case STUNAttributeMappedAddress:
+		return "MAPPED-ADDRESS"
+	case STUNAttributeUsername:
+		return "USERNAME"
+	case STUNAttributeMessageIntegrity:
+		return "MESSAGE-INTEGRITY"
+	case STUNAttributeErrorCode:
+		return "ERROR-CODE"
+	case STUNAttributeUnknownAttributes:
+		return "UNKNOWN-ATTRIBUTES"
+	case STUNAttributeChannelNumber:
+		return "CHANNEL-NUMBER"
+	case STUNAttributeLifetime:
+		return "LIFETIME"
+	case STUNAttributeXORPeerAddress:
+		return "XOR-PEER-ADDRESS"
+	case STUNAttributeData:
+		return "DATA"
+	case STUNAttributeRealm:
+		return "REALM"
+	case STUNAttributeNonce:
+		return "NONCE"
+	case STUNAttributeXORRelayedAddress:
+		return "XOR-RELAYED-ADDRESS"
+	case STUNAttributeRequestedTransport:
+		return "REQUESTED-TRANSPORT"
+	case STUNAttributeMessageIntegritySHA256:
+		return "MESSAGE-INTEGRITY-SHA256"
+	case STUNAttributeUserhash:
+		return "USERHASH"
+	case STUNAttributeXORMappedAddress:
+		return "XOR-MAPPED-ADDRESS"
+	case STUNAttributePriority:
+		return "PRIORITY"
+	case STUNAttributeUseCandidate:
+		return "USE-CANDIDATE"
+	case STUNAttributeSoftware:
+		return "SOFTWARE"
+	case STUNAttributeAlternateServer:
+		return "ALTERNATE-SERVER"
+	case STUNAttributeFingerprint:
+		return "FINGERPRINT"
+	case STUNAttributeICEControlled:
+		return "ICE-CONTROLLED"
+	case STUNAttributeICEControlling:
+		return "ICE-CONTROLLING"
+	default:
+		return fmt.Sprintf("UnknownSTUNAttributeType(%d)", t)
+	}
+}
+
+// STUNAttribute is an attribute of a STUN message.  Value doesn't include
+// the padding to a multiple of four bytes.
+type STUNAttribute struct {
+	Type   STUNAttributeType
+	Length uint16
+	Value  []byte
+}
+
+// Integer returns the value of an attribute holding a 32 bit integer, like
+// PRIORITY or LIFETIME.
+func (a STUNAttribute) Integer() (uint32, error) {
+	if len(a.Value) != 4 {
+		return 0, fmt.Errorf("STUN %v attribute of %d bytes isn't an integer", a.Type, len(a.Value))
+	}
+	return binary.BigEndian.Uint32(a.Value), nil
+}
+
+// STUNAddress is the transport address in an address attribute.
+type STUNAddress struct {
+	IP   net.IP
+	Port uint16
+}
+
+func (a STUNAddress) String() string {
+	return net.JoinHostPort(a.IP.String(), fmt.Sprint(a.Port))
+}
+
+// STUN is a STUN message (RFC 8489), used by ICE (RFC 8445) to find and
+// check the candidate addresses of WebRTC and other media sessions, and by
+// TURN (RFC 8656) to relay them.  TURN Send and Data indications carry
+// relayed data in a DATA attribute, which is the payload, and is decoded as
+// RTP or RTCP if ClassifyRTP recognizes it.
+//
+// Over TCP, messages and TURN channel data may be split across segments;
+// use STUNStream to decode a reassembled connection.
+type STUN struct {
+	BaseLayer
+	Class         STUNClass
+	Method        STUNMethod
+	Length        uint16
+	TransactionID [12]byte
+	Attributes    []STUNAttribute
+}
+
+// LayerType returns LayerTypeSTUN.
+func (s *STUN) LayerType() gopacket.LayerType { return LayerTypeSTUN }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (s *STUN) CanDecode() gopacket.LayerClass { return LayerTypeSTUN }
+
+// NextLayerType returns the layer type of the relayed data, if any.
+func (s *STUN) NextLayerType() gopacket.LayerType {
+	if len(s.BaseLayer.Payload) == 0 {
+		return gopacket.LayerTypeZero
+	}
+	return ClassifyRTP(s.BaseLayer.Payload)
+}
+
+// Payload returns the value of the DATA attribute.
+func (s *STUN) Payload() []byte { return s.BaseLayer.Payload }
+
+// Attribute returns the first attribute of the given type.
+func (s *STUN) Attribute(t STUNAttributeType) (STUNAttribute, bool) {
+	for _, a := range s.Attributes {
+		if a.Type == t {
+			return a, true
+		}
+	}
+	return STUNAttribute{}, false
+}
+
+// Text returns the value of a text attribute, like USERNAME, REALM, NONCE
+// or SOFTWARE.
+func (s *STUN) Text(t STUNAttributeType) (string, bool) {
+	a, ok := s.Attribute(t)
+	return string(a.Value), ok
+}
+
+// Address returns the transport address of an address attribute, like
+// XOR-MAPPED-ADDRESS, undoing the XOR of the XOR-* attributes.
+func (s *STUN) Address(t STUNAttributeType) (STUNAddress, error) {
+	a, ok := s.Attribute(t)
+	if !ok {
+		return STUNAddress{}, fmt.Errorf("STUN message has no %v attribute", t)
+	}
+	v := a.Value
+	if len(v) < 4 {
+		return STUNAddress{}, fmt.Errorf("STUN %v attribute too short", t)
+	}
+	var addr STUNAddress
+	switch v[1] {
+	case 1:
+		if len(v) != 8 {
+			return addr, fmt.Errorf("STUN %v IPv4 address length %d invalid", t, len(v)-4)
+		}
+	case 2:
+		if len(v) != 20 {
+			return addr, fmt.Errorf("STUN %v IPv6 address length %d invalid", t, len(v)-4)
+		}
+	default:
+		return addr, fmt.Errorf("STUN %v address family %d unknown", t, v[1])
+	}
+	addr.Port = binary.BigEndian.Uint16(v[2:4])
+	addr.IP = append(net.IP{}, v[4:]...)
+	if t == STUNAttributeXORMappedAddress || t == STUNAttributeXORPeerAddress || t == STUNAttributeXORRelayedAddress {
+		// The port is XORed with the top of the magic cookie, and the
+		// address with the magic cookie and transaction ID.
+		var key [16]byte
+		binary.BigEndian.PutUint32(key[:4], STUNMagicCookie)
+		copy(key[4:], s.TransactionID[:])
+		addr.Port ^= STUNMagicCookie >> 16
+		for i := range addr.IP {
+			addr.IP[i] ^= key[i]
+		}
+	}
+	return addr, nil
+}
+
+// Priority returns the ICE candidate priority of a connectivity check.
+func (s *STUN) Priority() (uint32, bool) {
+	a, ok := s.Attribute(STUNAttributePriority)
+	if !ok {
+		return 0, false
+	}
+	p, err := a.Integer()
+	return p, err == nil
+}
+
+// ErrorCode returns the error code and reason phrase of an error
+// response.
+func (s *STUN) ErrorCode() (int, string, bool) {
+	a, ok := s.Attribute(STUNAttributeErrorCode)
+	if !ok || len(a.Value) < 4 {
+		return 0, "", false
+	}
+	return int(a.Value[2]&0x07)*100 + int(a.Value[3]), string(a.Value[4:]), true
+}
+
+// FingerprintValid returns true if the message ends with a FINGERPRINT
+// attribute holding its CRC.
+func (s *STUN) FingerprintValid() bool {
+	n := len(s.Contents)
+	if len(s.Attributes) == 0 || s.Attributes[len(s.Attributes)-1].Type != STUNAttributeFingerprint || n < 28 {
+		return false
+	}
+	want := binary.BigEndian.Uint32(s.Contents[n-4:])
+	return crc32.ChecksumIEEE(s.Contents[:n-8])^stunFingerprintXOR == want
+}
+
+func decodeSTUN(data []byte, p gopacket.PacketBuilder) error {
+	if len(data) > 0 && data[0]>>6 == 1 {
+		c := &TURNChannelData{}
+		if err := c.DecodeFromBytes(data, p); err != nil {
+			return err
+		}
+		p.AddLayer(c)
+		p.SetApplicationLayer(c)
+		return p.NextDecoder(c.NextLayerType())
+	}
+	// A TCP segment that doesn't start with a message, like one continuing
+	// a message split across segments, is left as payload.
+	if !isSTUNMessage(data) {
+		return gopacket.DecodePayload.Decode(data, p)
+	}
+	s := &STUN{}
+	if err := s.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(s)
+	p.SetApplicationLayer(s)
+	next := s.NextLayerType()
+	if next == gopacket.LayerTypeZero {
+		return nil
+	}
+	return p.NextDecoder(next)
+}
+
+// isSTUNMessage returns true if data starts with a STUN message header:
+// the top bits clear, a length that's a multiple of four, and the magic
+// cookie.  It's how STUN is told apart from media multiplexed on the same
+// port (RFC 7983).
+func isSTUNMessage(data []byte) bool {
+	return len(data) >= 20 && data[0]>>6 == 0 && data[3]&3 == 0 &&
+		binary.BigEndian.Uint32(data[4:8]) == STUNMagicCookie
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.  Bytes after
+// the message are ignored.
+func (s *STUN) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 20 {
+		df.SetTruncated()
+		return fmt.Errorf("STUN message of %d bytes too short", len(data))
+	}
+	if data[0]>>6 != 0 {
+		return errors.New("STUN message type has top bits set")
+	}
+	if c := binary.BigEndian.Uint32(data[4:8]); c != STUNMagicCookie {
+		return fmt.Errorf("STUN magic cookie %#x invalid", c)
+	}
+	t := binary.BigEndian.Uint16(data[0:2])
+	// The class bits are interleaved with the method's.
+	s.Class = STUNClass(t>>4&1 | t>>7&2)
+	s.Method = STUNMethod(t&0x000f | t>>1&0x0070 | t>>2&0x0f80)
+	s.Length = binary.BigEndian.Uint16(data[2:4])
+	if s.Length%4 != 0 {
+		return fmt.Errorf("STUN message length %d not a multiple of 4", s.Length)
+	}
+	n := 20 + int(s.Length)
+	if len(data) < n {
+		df.SetTruncated()
+		return fmt.Errorf("STUN message length %d exceeds %d bytes", s.Length, len(data)-20)
+	}
+	copy(s.TransactionID[:], data[8:20])
+	s.Attributes = s.Attributes[:0]
+	var payload []byte
+	for attrs := data[20:n]; len(attrs) > 0; {
+		if len(attrs) < 4 {
+			return errors.New("STUN attribute header truncated")
+		}
+		a := STUNAttribute{
+			Type:   STUNAttributeType(binary.BigEndian.Uint16(attrs[0:2])),
+			Length: binary.BigEndian.Uint16(attrs[2:4]),
+		}
+		l := int(a.Length)
+		if 4+l > len(attrs) {
+			return fmt.Errorf("STUN %v attribute length %d exceeds %d bytes", a.Type, l, len(attrs)-4)
+		}
+		a.Value = attrs[4 : 4+l]
+		s.Attributes = append(s.Attributes, a)
+		if a.Type == STUNAttributeData {
+			payload = a.Value
+		}
+		// Attributes are padded to a multiple of 4 bytes.
+		if next := 4 + (l+3)&^3; next < len(attrs) {
+			attrs = attrs[next:]
+		} else {
+			attrs = nil
+		}
+	}
+	s.BaseLayer = BaseLayer{Contents: data[:n], Payload: payload}
+	return nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.  The magic
+// cookie is always written, and attributes are padded with zeros.
+func (s *STUN) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	n := 20
+	for _, a := range s.Attributes {
+		if len(a.Value) > 0xffff {
+			return fmt.Errorf("STUN %v attribute of %d bytes too long", a.Type, len(a.Value))
+		}
+		n += 4 + (len(a.Value)+3)&^3
+	}
+	if n-20 > 0xffff {
+		return fmt.Errorf("STUN message of %d bytes too long", n)
+	}
+	data, err := b.PrependBytes(n)
+	if err != nil {
+		return err
+	}
+	if opts.FixLengths {
+		s.Length = uint16(n - 20)
+	}
+	m, c := uint16(s.Method), uint16(s.Class)
+	binary.BigEndian.PutUint16(data[0:2], m&0x000f|m&0x0070<<1|m&0x0f80<<2|c&1<<4|c&2<<7)
+	binary.BigEndian.PutUint16(data[2:4], s.Length)
+	binary.BigEndian.PutUint32(data[4:8], STUNMagicCookie)
+	copy(data[8:20], s.TransactionID[:])
+	off := 20
+	for i := range s.Attributes {
+		a := &s.Attributes[i]
+		if opts.FixLengths {
+			a.Length = uint16(len(a.Value))
+		}
+		binary.BigEndian.PutUint16(data[off:off+2], uint16(a.Type))
+		binary.BigEndian.PutUint16(data[off+2:off+4], a.Length)
+		off += 4
+		off += copy(data[off:], a.Value)
+		for ; off%4 != 0; off++ {
+			data[off] = 0
+		}
+	}
+	return nil
+}
+
+// TURNChannelData is a TURN ChannelData message (RFC 8656 section 12.4),
+// which relays data to the peer bound to a channel with less overhead than
+// a Send or Data indication.  The data is decoded as RTP or RTCP if
+// ClassifyRTP recognizes it.
+type TURNChannelData struct {
+	BaseLayer
+	Channel uint16
+	Length  uint16
+}
+
+// LayerType returns LayerTypeTURNChannelData.
+func (c *TURNChannelData) LayerType() gopacket.LayerType { return LayerTypeTURNChannelData }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (c *TURNChannelData) CanDecode() gopacket.LayerClass { return LayerTypeTURNChannelData }
+
+// NextLayerType returns the layer type of the relayed data.
+func (c *TURNChannelData) NextLayerType() gopacket.LayerType {
+	return ClassifyRTP(c.BaseLayer.Payload)
+}
+
+// Payload returns the relayed data.
+func (c *TURNChannelData) Payload() []byte { return c.BaseLayer.Payload }
+
+// DecodeFromBytes decodes the given bytes into this layer.  Bytes after
+// the data, such as the padding to four bytes sent over TCP, are ignored.
+func (c *TURNChannelData) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return errors.New("TURN ChannelData header truncated")
+	}
+	c.Channel = binary.BigEndian.Uint16(data[0:2])
+	if c.Channel < 0x4000 || c.Channel > 0x4fff {
+		return fmt.Errorf("TURN channel number %#x invalid", c.Channel)
+	}
+	c.Length = binary.BigEndian.Uint16(data[2:4])
+	if len(data) < 4+int(c.Length) {
+		df.SetTruncated()
+		return fmt.Errorf("TURN ChannelData length %d exceeds %d bytes", c.Length, len(data)-4)
+	}
+	c.BaseLayer = BaseLayer{Contents: data[:4], Payload: data[4 : 4+int(c.Length)]}
+	return nil
+}
+
+// maxSTUNMessage is the largest STUN message, whose length field counts
+// the bytes after its 20 byte header.  Channel data is shorter.
+const maxSTUNMessage = 20 + 0xffff
+
+// STUNStream splits one direction of a reassembled STUN or TURN connection
+// over TCP into messages and channel data, including those split across
+// TCP segments.
+type STUNStream struct {
+	buf streamBuffer
+}
+
+// Decode appends data from the stream and returns the messages (*STUN) and
+// channel data (*TURNChannelData) completed by it, in order.  After an
+// error, or a gap in the stream, call Reset before decoding more data.
+func (s *STUNStream) Decode(data []byte) ([]gopacket.Layer, error) {
+	return s.buf.decode(data, "STUN", maxSTUNMessage, stunFrame)
+}
+
+// stunFrame is the streamFramer of STUNStream.
+func stunFrame(data []byte) (int64, layerDecodingLayer, error) {
+	if len(data) < 4 {
+		return 0, nil, nil
+	}
+	if data[0]>>6 == 1 {
+		// Channel data is padded to four bytes over TCP.
+		return 4 + (int64(binary.BigEndian.Uint16(data[2:4]))+3)&^3, &TURNChannelData{}, nil
+	}
+	return 20 + int64(binary.BigEndian.Uint16(data[2:4])), &STUN{}, nil
+}
+
+// Reset discards any partial message.
+func (s *STUNStream) Reset() {
+	s.buf.reset()
+}
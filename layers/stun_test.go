@@ -0,0 +1,193 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func testSTUNBytes(t *testing.T, h string) []byte {
+	b, err := hex.DecodeString(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// testSTUNResponse is the IPv4 Binding success response of RFC 5769
+// section 2.2.
+const testSTUNResponse = "0101003c2112a442b7e7a701bc34d686fa87dfae" +
+	"8022000b7465737420766563746f7220" +
+	"002000080001a147e112a643" +
+	"000800142b91f599fd9e90c38c7489f92af9ba53f06be7d7" +
+	"80280004c07d4c96"
+
+func TestSTUNBindingResponse(t *testing.T) {
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{198, 51, 100, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &UDP{SrcPort: 3478, DstPort: 50000}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload(testSTUNBytes(t, testSTUNResponse))); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeSTUN}, t)
+	s := p.Layer(LayerTypeSTUN).(*STUN)
+	if s.Class != STUNClassSuccessResponse || s.Method != STUNMethodBinding || s.Length != 60 || len(s.Attributes) != 4 {
+		t.Errorf("got message %v %v of length %d with %d attributes", s.Method, s.Class, s.Length, len(s.Attributes))
+	}
+	if sw, ok := s.Text(STUNAttributeSoftware); !ok || sw != "test vector" {
+		t.Errorf("got SOFTWARE %q", sw)
+	}
+	addr, err := s.Address(STUNAttributeXORMappedAddress)
+	if err != nil || addr.String() != "192.0.2.1:32853" {
+		t.Errorf("got XOR-MAPPED-ADDRESS %v, %v", addr, err)
+	}
+	if !s.FingerprintValid() {
+		t.Error("fingerprint invalid")
+	}
+	s.Contents[30]++
+	if s.FingerprintValid() {
+		t.Error("fingerprint valid after changing the message")
+	}
+
+	// The IPv6 address of RFC 5769 section 2.3.
+	s.Attributes[1].Value = testSTUNBytes(t, "0002a1470113a9faa5d3f179bc25f4b5bed2b9d9")
+	if addr, err := s.Address(STUNAttributeXORMappedAddress); err != nil || addr.String() != "[2001:db8:1234:5678:11:2233:4455:6677]:32853" {
+		t.Errorf("got IPv6 XOR-MAPPED-ADDRESS %v, %v", addr, err)
+	}
+}
+
+func TestSTUNICECheck(t *testing.T) {
+	req := &STUN{
+		Class:  STUNClassRequest,
+		Method: STUNMethodBinding,
+		Attributes: []STUNAttribute{
+			{Type: STUNAttributeUsername, Value: []byte("evtj:h6vY")},
+			{Type: STUNAttributePriority, Value: []byte{0x6e, 0x00, 0x01, 0xff}},
+			{Type: STUNAttributeICEControlling, Value: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+			{Type: STUNAttributeUseCandidate},
+		},
+	}
+	copy(req.TransactionID[:], "0123456789ab")
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, req); err != nil {
+		t.Fatal(err)
+	}
+	if !isSTUNMessage(buf.Bytes()) || len(buf.Bytes()) != 20+16+8+12+4 {
+		t.Fatalf("serialized %x", buf.Bytes())
+	}
+	var got STUN
+	if err := got.DecodeFromBytes(buf.Bytes(), gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if got.Class != STUNClassRequest || got.Method != STUNMethodBinding || got.TransactionID != req.TransactionID {
+		t.Errorf("got %v %v %q", got.Method, got.Class, got.TransactionID)
+	}
+	if u, _ := got.Text(STUNAttributeUsername); u != "evtj:h6vY" {
+		t.Errorf("got USERNAME %q", u)
+	}
+	if prio, ok := got.Priority(); !ok || prio != 0x6e0001ff {
+		t.Errorf("got PRIORITY %#x", prio)
+	}
+	if _, ok := got.Attribute(STUNAttributeUseCandidate); !ok {
+		t.Error("USE-CANDIDATE missing")
+	}
+
+	// A TURN Allocate error response, and the class and method bits of a
+	// Data indication.
+	alloc := &STUN{Class: STUNClassErrorResponse, Method: STUNMethodAllocate, Attributes: []STUNAttribute{
+		{Type: STUNAttributeErrorCode, Value: append([]byte{0, 0, 4, 1}, "Unauthorized"...)},
+	}}
+	buf = gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, alloc); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Bytes()[0] != 0x01 || buf.Bytes()[1] != 0x13 {
+		t.Errorf("Allocate error response type %x, want 0113", buf.Bytes()[:2])
+	}
+	if err := got.DecodeFromBytes(buf.Bytes(), gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if code, reason, ok := got.ErrorCode(); !ok || code != 401 || reason != "Unauthorized" {
+		t.Errorf("got ERROR-CODE %d %q", code, reason)
+	}
+	if err := got.DecodeFromBytes(append([]byte{0x00, 0x17, 0, 0, 0x21, 0x12, 0xa4, 0x42}, make([]byte, 12)...), gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if got.Class != STUNClassIndication || got.Method != STUNMethodData {
+		t.Errorf("got %v %v, want Data Indication", got.Method, got.Class)
+	}
+
+	for _, b := range [][]byte{
+		testSTUNBytes(t, testSTUNResponse)[:19],
+		testSTUNBytes(t, testSTUNResponse)[:40],
+		testSTUNBytes(t, "0101000421000000b7e7a701bc34d686fa87dfae00010000"),
+		testSTUNBytes(t, "010100042112a442b7e7a701bc34d686fa87dfae00010008"),
+	} {
+		if err := (&STUN{}).DecodeFromBytes(b, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("decoded %x without error", b)
+		}
+	}
+}
+
+func TestTURNRelay(t *testing.T) {
+	// A Data indication and ChannelData relaying RTP.
+	ind := &STUN{Class: STUNClassIndication, Method: STUNMethodData, Attributes: []STUNAttribute{
+		{Type: STUNAttributeXORPeerAddress, Value: testSTUNBytes(t, "0001a147e112a643")},
+		{Type: STUNAttributeData, Value: testRTPPacket},
+	}}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ind); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeSTUN, testDecodeOptions)
+	checkLayers(p, []gopacket.LayerType{LayerTypeSTUN, LayerTypeRTP, gopacket.LayerTypePayload}, t)
+	if peer, err := p.Layer(LayerTypeSTUN).(*STUN).Address(STUNAttributeXORPeerAddress); err != nil || peer.String() != "192.0.2.1:32853" {
+		t.Errorf("got XOR-PEER-ADDRESS %v, %v", peer, err)
+	}
+
+	cd := append([]byte{0x40, 0x01, 0, byte(len(testRTCPCompound))}, testRTCPCompound...)
+	p = gopacket.NewPacket(cd, LayerTypeSTUN, testDecodeOptions)
+	checkLayers(p, []gopacket.LayerType{LayerTypeTURNChannelData, LayerTypeRTCP}, t)
+	if c := p.Layer(LayerTypeTURNChannelData).(*TURNChannelData); c.Channel != 0x4001 {
+		t.Errorf("got channel %#x", c.Channel)
+	}
+
+	// Over TCP, channel data is padded to four bytes.
+	odd := []byte{0x40, 0x02, 0, 3, 'a', 'b', 'c', 0}
+	data := append(append(append([]byte{}, buf.Bytes()...), odd...), cd...)
+	var s STUNStream
+	var got []gopacket.Layer
+	for _, chunk := range [][]byte{data[:3], data[3:50], data[50:]} {
+		ls, err := s.Decode(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, ls...)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d messages from stream", len(got))
+	}
+	if !reflect.DeepEqual(got[0].(*STUN).Payload(), testRTPPacket) || !bytes.Equal(got[1].LayerPayload(), []byte("abc")) || got[2].(*TURNChannelData).Channel != 0x4001 {
+		t.Errorf("got %v from stream", got)
+	}
+
+	if err := (&TURNChannelData{}).DecodeFromBytes([]byte{0x7f, 0xff, 0, 0}, gopacket.NilDecodeFeedback); err == nil {
+		t.Error("decoded reserved channel without error")
+	}
+}
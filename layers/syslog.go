@@ -0,0 +1,529 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// SyslogFacility is the facility of a syslog message: the kind of program
+// that logged it.
+type SyslogFacility uint8
+
+// Syslog facilities (RFC 5424 section 6.2.1).
+const (
+	SyslogFacilityKern     SyslogFacility = 0
+	SyslogFacilityUser     SyslogFacility = 1
+	SyslogFacilityMail     SyslogFacility = 2
+	SyslogFacilityDaemon   SyslogFacility = 3
+	SyslogFacilityAuth     SyslogFacility = 4
+	SyslogFacilitySyslog   SyslogFacility = 5
+	SyslogFacilityLPR      SyslogFacility = 6
+	SyslogFacilityNews     SyslogFacility = 7
+	SyslogFacilityUUCP     SyslogFacility = 8
+	SyslogFacilityCron     SyslogFacility = 9
+	SyslogFacilityAuthPriv SyslogFacility = 10
+	SyslogFacilityFTP      SyslogFacility = 11
+	SyslogFacilityNTP      SyslogFacility = 12
+	SyslogFacilityAudit    SyslogFacility = 13
+	SyslogFacilityAlert    SyslogFacility = 14
+	SyslogFacilityClock    SyslogFacility = 15
+	SyslogFacilityLocal0   SyslogFacility = 16
+	SyslogFacilityLocal1   SyslogFacility = 17
+	SyslogFacilityLocal2   SyslogFacility = 18
+	SyslogFacilityLocal3   SyslogFacility = 19
+	SyslogFacilityLocal4   SyslogFacility = 20
+	SyslogFacilityLocal5   SyslogFacility = 21
+	SyslogFacilityLocal6   SyslogFacility = 22
+	SyslogFacilityLocal7   SyslogFacility = 23
+)
+
+var syslogFacilityNames = [...]string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "audit", "alert", "clock",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// String returns the name syslog configurations use for f, like "local7".
+func (f SyslogFacility) String() string {
+	if int(f) < len(syslogFacilityNames) {
+		return syslogFacilityNames[f]
+	}
+	return fmt.Sprintf("UnknownSyslogFacility(%d)", uint8(f))
+}
+
+// SyslogSeverity is the severity of a syslog message.  Lower values are
+// more severe.
+type SyslogSeverity uint8
+
+// Syslog severities (RFC 5424 section 6.2.1).
+const (
+	SyslogSeverityEmergency     SyslogSeverity = 0
+	SyslogSeverityAlert         SyslogSeverity = 1
+	SyslogSeverityCritical      SyslogSeverity = 2
+	SyslogSeverityError         SyslogSeverity = 3
+	SyslogSeverityWarning       SyslogSeverity = 4
+	SyslogSeverityNotice        SyslogSeverity = 5
+	SyslogSeverityInformational SyslogSeverity = 6
+	SyslogSeverityDebug         SyslogSeverity = 7
+)
+
+var syslogSeverityNames = [...]string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// String returns the name syslog configurations use for s, like "err".
+func (s SyslogSeverity) String() string {
+	if int(s) < len(syslogSeverityNames) {
+		return syslogSeverityNames[s]
+	}
+	return fmt.Sprintf("UnknownSyslogSeverity(%d)", uint8(s))
+}
+
+// SyslogSDElement is an element of the structured data of an RFC 5424
+// message, like [exampleSDID@32473 iut="3" eventSource="Application"].
+type SyslogSDElement struct {
+	ID     string
+	Params []SyslogSDParam
+}
+
+// SyslogSDParam is a parameter of a structured data element, with its
+// value unescaped.
+type SyslogSDParam struct {
+	Name, Value string
+}
+
+// Syslog is a syslog message, in the format of RFC 5424 or in the older
+// BSD format RFC 3164 describes, which many devices still send.  Syslog
+// is sent over UDP port 514, one message per datagram, or over TCP, where
+// messages are framed as RFC 6587 describes: preceded by their length, or
+// followed by a newline.  A layer holds one message; when a TCP segment
+// holds several, each is a layer of its own.  SyslogStream decodes the
+// messages of reassembled TCP streams.
+//
+// Fields that a message leaves out, or has as the nil value "-", are
+// empty.
+type Syslog struct {
+	BaseLayer
+	Facility SyslogFacility
+	Severity SyslogSeverity
+	// Version is 1 for RFC 5424 messages, and 0 for BSD ones.
+	Version uint8
+	// Timestamp is the time the message was logged.  BSD timestamps, like
+	// "Oct 11 22:14:15", have neither year nor time zone, so they decode
+	// as times in year 0, UTC.
+	Timestamp time.Time
+	Hostname  string
+	// AppName is the APP-NAME of RFC 5424 messages, or the tag of BSD ones,
+	// like "sshd" in "sshd[42]: ...", and ProcID the PROCID or the number in
+	// brackets after the tag.
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData []SyslogSDElement
+	// Message is the free-form text of the message, without the byte order
+	// mark RFC 5424 messages may start it with, or the trailing newline
+	// many senders end it with.
+	Message string
+}
+
+// Priority returns the PRI value of s, which combines its facility and
+// severity.
+func (s *Syslog) Priority() int {
+	return int(s.Facility)*8 + int(s.Severity)
+}
+
+// LayerType returns LayerTypeSyslog.
+func (s *Syslog) LayerType() gopacket.LayerType { return LayerTypeSyslog }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (s *Syslog) CanDecode() gopacket.LayerClass { return LayerTypeSyslog }
+
+// NextLayerType returns LayerTypeSyslog if the bytes after the message
+// start with another, and otherwise LayerTypePayload.
+func (s *Syslog) NextLayerType() gopacket.LayerType {
+	if len(s.BaseLayer.Payload) == 0 {
+		return gopacket.LayerTypeZero
+	}
+	if isSyslogMessage(s.BaseLayer.Payload) {
+		return LayerTypeSyslog
+	}
+	return gopacket.LayerTypePayload
+}
+
+// Payload returns nil, since the message is the content of the layer.
+func (s *Syslog) Payload() []byte { return nil }
+
+func decodeSyslog(data []byte, p gopacket.PacketBuilder) error {
+	// A TCP segment that doesn't start with a message, like one continuing
+	// a message split across segments, is left as payload.
+	if !isSyslogMessage(data) {
+		return gopacket.DecodePayload.Decode(data, p)
+	}
+	s := &Syslog{}
+	if err := s.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(s)
+	p.SetApplicationLayer(s)
+	if len(s.BaseLayer.Payload) == 0 {
+		return nil
+	}
+	return p.NextDecoder(gopacket.DecodeFunc(decodeSyslog))
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// syslogOctetCount returns the length of an octet counted frame at the
+// start of data (RFC 6587 section 3.4.1), and the length of the count and
+// the space following it, or ok false if data doesn't start with one.
+func syslogOctetCount(data []byte) (n, skip int, ok bool) {
+	i := 0
+	for i < len(data) && i < 10 && isDigit(data[i]) {
+		i++
+	}
+	if i == 0 || i == len(data) || data[i] != ' ' || data[0] == '0' {
+		return 0, 0, false
+	}
+	n, err := strconv.Atoi(string(data[:i]))
+	if err != nil {
+		return 0, 0, false
+	}
+	return n, i + 1, true
+}
+
+// isSyslogMessage returns true if data starts with a complete octet
+// counted frame, or with a priority.
+func isSyslogMessage(data []byte) bool {
+	if n, skip, ok := syslogOctetCount(data); ok {
+		return n > 0 && n <= len(data)-skip && data[skip] == '<'
+	}
+	return len(data) >= 3 && data[0] == '<' && isDigit(data[1])
+}
+
+// splitSyslogFrame returns the first message of data and the bytes
+// following its frame.  Messages without an octet count run to the end
+// of data, or to a newline or NUL that precedes another message.
+func splitSyslogFrame(data []byte) (msg, rest []byte, err error) {
+	if n, skip, ok := syslogOctetCount(data); ok {
+		if n > len(data)-skip {
+			return nil, nil, fmt.Errorf("syslog frame length %d exceeds %d bytes available", n, len(data)-skip)
+		}
+		return data[skip : skip+n], data[skip+n:], nil
+	}
+	for i := 0; i+2 < len(data); i++ {
+		if (data[i] == '\n' || data[i] == 0) && data[i+1] == '<' && isDigit(data[i+2]) {
+			return data[:i], data[i+1:], nil
+		}
+	}
+	return data, nil, nil
+}
+
+// DecodeFromBytes decodes the first message of the given bytes into this
+// layer.  The bytes after it, if any, are the layer's payload.
+func (s *Syslog) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	msg, rest, err := splitSyslogFrame(data)
+	if err != nil {
+		df.SetTruncated()
+		return err
+	}
+	*s = Syslog{}
+	if err := s.decodeMessage(msg); err != nil {
+		return err
+	}
+	s.BaseLayer = BaseLayer{Contents: data[:len(data)-len(rest)], Payload: rest}
+	return nil
+}
+
+func (s *Syslog) decodeMessage(msg []byte) error {
+	msg = bytes.TrimRight(msg, "\r\n\x00")
+	i := 1
+	for i < len(msg) && i < 5 && isDigit(msg[i]) {
+		i++
+	}
+	if len(msg) < 3 || msg[0] != '<' || i == 1 || i == len(msg) || msg[i] != '>' {
+		return errors.New("syslog message has no priority")
+	}
+	pri, _ := strconv.Atoi(string(msg[1:i]))
+	if pri > 191 {
+		return fmt.Errorf("syslog priority %d out of range", pri)
+	}
+	s.Facility, s.Severity = SyslogFacility(pri/8), SyslogSeverity(pri%8)
+	rest := string(msg[i+1:])
+	if j := strings.IndexByte(rest, ' '); j > 0 && j <= 3 && rest[0] != '0' && isAllDigits(rest[:j]) {
+		v, _ := strconv.Atoi(rest[:j])
+		s.Version = uint8(v)
+		return s.decodeRFC5424(rest[j+1:])
+	}
+	s.decodeBSD(rest)
+	return nil
+}
+
+func isAllDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// syslogField returns the field at the start of s, up to a space, and what
+// follows the space.  The nil value "-" is returned as "".
+func syslogField(s string) (field, rest string, err error) {
+	j := strings.IndexByte(s, ' ')
+	if j < 0 {
+		return "", "", errors.New("syslog header truncated")
+	}
+	if field = s[:j]; field == "-" {
+		field = ""
+	}
+	return field, s[j+1:], nil
+}
+
+func (s *Syslog) decodeRFC5424(rest string) error {
+	var ts string
+	var err error
+	if ts, rest, err = syslogField(rest); err != nil {
+		return err
+	}
+	if ts != "" {
+		if s.Timestamp, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+			return fmt.Errorf("syslog timestamp %q invalid", ts)
+		}
+	}
+	for _, f := range []*string{&s.Hostname, &s.AppName, &s.ProcID, &s.MsgID} {
+		if *f, rest, err = syslogField(rest); err != nil {
+			return err
+		}
+	}
+	switch {
+	case strings.HasPrefix(rest, "-"):
+		rest = rest[1:]
+	case strings.HasPrefix(rest, "["):
+		if s.StructuredData, rest, err = decodeSyslogSD(rest); err != nil {
+			return err
+		}
+	default:
+		return errors.New("syslog structured data missing")
+	}
+	if strings.HasPrefix(rest, " ") {
+		s.Message = strings.TrimPrefix(rest[1:], "\ufeff")
+	} else if rest != "" {
+		return errors.New("syslog structured data not followed by a space")
+	}
+	return nil
+}
+
+// decodeSyslogSD decodes the structured data elements at the start of s.
+func decodeSyslogSD(s string) ([]SyslogSDElement, string, error) {
+	var elems []SyslogSDElement
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+		if end < 0 {
+			return nil, "", errors.New("syslog structured data element truncated")
+		}
+		e := SyslogSDElement{ID: s[1:end]}
+		s = s[end:]
+		for strings.HasPrefix(s, " ") {
+			eq := strings.IndexByte(s, '=')
+			if eq < 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+				return nil, "", errors.New("syslog structured data parameter invalid")
+			}
+			p := SyslogSDParam{Name: s[1:eq]}
+			var v []byte
+			i := eq + 2
+			for ; i < len(s) && s[i] != '"'; i++ {
+				// Only '"', '\' and ']' are escaped; other backslashes are
+				// literal.
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+					i++
+				}
+				v = append(v, s[i])
+			}
+			if i == len(s) {
+				return nil, "", errors.New("syslog structured data parameter truncated")
+			}
+			p.Value = string(v)
+			e.Params = append(e.Params, p)
+			s = s[i+1:]
+		}
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", errors.New("syslog structured data element not terminated")
+		}
+		elems = append(elems, e)
+		s = s[1:]
+	}
+	return elems, s, nil
+}
+
+// decodeBSD decodes what follows the priority of a BSD message, whose
+// format is a convention more than a standard: each part is taken if it's
+// there, and whatever isn't recognized is left in Message.
+func (s *Syslog) decodeBSD(rest string) {
+	// The timestamp is traditionally like "Oct 11 22:14:15", but some
+	// senders use RFC 3339 timestamps.  The host name follows it.
+	if len(rest) > len(time.Stamp) && rest[len(time.Stamp)] == ' ' {
+		if t, err := time.Parse(time.Stamp, rest[:len(time.Stamp)]); err == nil {
+			s.Timestamp, rest = t, rest[len(time.Stamp)+1:]
+		}
+	}
+	if s.Timestamp.IsZero() {
+		if j := strings.IndexByte(rest, ' '); j > 0 {
+			if t, err := time.Parse(time.RFC3339Nano, rest[:j]); err == nil {
+				s.Timestamp, rest = t, rest[j+1:]
+			}
+		}
+	}
+	if !s.Timestamp.IsZero() {
+		if j := strings.IndexByte(rest, ' '); j > 0 {
+			s.Hostname, rest = rest[:j], rest[j+1:]
+		}
+	}
+	// The tag is the name of the program, up to 32 characters, ended by a
+	// colon or by the process ID in brackets.
+	j := 0
+	for j < len(rest) && j <= 32 && syslogTagChar(rest[j]) {
+		j++
+	}
+	if j > 0 && j < len(rest) {
+		tag, after := rest[:j], rest[j:]
+		var pid string
+		if after[0] == '[' {
+			if k := strings.Index(after, "]:"); k > 1 {
+				pid, after = after[1:k], after[k+1:]
+			}
+		}
+		if after[0] == ':' {
+			s.AppName, s.ProcID = tag, pid
+			rest = strings.TrimPrefix(after[1:], " ")
+		}
+	}
+	s.Message = rest
+}
+
+func syslogTagChar(c byte) bool {
+	return c > ' ' && c < 0x7f && c != ':' && c != '[' && c != ']'
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.  It
+// writes an RFC 5424 message if Version is nonzero, and otherwise a BSD
+// one, without any TCP framing.
+func (s *Syslog) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	if s.Facility > SyslogFacilityLocal7 || s.Severity > SyslogSeverityDebug {
+		return fmt.Errorf("syslog facility %d or severity %d out of range", s.Facility, s.Severity)
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "<%d>", s.Priority())
+	if s.Version != 0 {
+		fmt.Fprintf(buf, "%d ", s.Version)
+		ts := ""
+		if !s.Timestamp.IsZero() {
+			ts = s.Timestamp.Format(time.RFC3339Nano)
+		}
+		for _, f := range []string{ts, s.Hostname, s.AppName, s.ProcID, s.MsgID} {
+			if f == "" {
+				f = "-"
+			}
+			buf.WriteString(f)
+			buf.WriteByte(' ')
+		}
+		if len(s.StructuredData) == 0 {
+			buf.WriteByte('-')
+		}
+		for _, e := range s.StructuredData {
+			buf.WriteString("[" + e.ID)
+			for _, p := range e.Params {
+				buf.WriteString(" " + p.Name + `="`)
+				for i := 0; i < len(p.Value); i++ {
+					if c := p.Value[i]; c == '"' || c == '\\' || c == ']' {
+						buf.WriteByte('\\')
+					}
+					buf.WriteByte(p.Value[i])
+				}
+				buf.WriteByte('"')
+			}
+			buf.WriteByte(']')
+		}
+		if s.Message != "" {
+			buf.WriteByte(' ')
+			buf.WriteString(s.Message)
+		}
+	} else {
+		if !s.Timestamp.IsZero() {
+			buf.WriteString(s.Timestamp.Format(time.Stamp) + " ")
+			if s.Hostname != "" {
+				buf.WriteString(s.Hostname + " ")
+			}
+		}
+		if s.AppName != "" {
+			buf.WriteString(s.AppName)
+			if s.ProcID != "" {
+				buf.WriteString("[" + s.ProcID + "]")
+			}
+			buf.WriteString(": ")
+		}
+		buf.WriteString(s.Message)
+	}
+	data, err := b.PrependBytes(buf.Len())
+	if err != nil {
+		return err
+	}
+	copy(data, buf.Bytes())
+	return nil
+}
+
+// maxSyslogMessage is the largest message SyslogStream accepts, well
+// beyond the 8KB that RFC 6587 receivers commonly allow.
+const maxSyslogMessage = 1 << 16
+
+// SyslogStream splits one direction of a reassembled syslog TCP stream
+// into messages, including those split across TCP segments.
+type SyslogStream struct {
+	buf streamBuffer
+}
+
+// Decode appends data from the stream and returns the messages completed
+// by it.  Messages framed by a trailing newline are only complete once the
+// newline arrives.  After an error, or a gap in the stream, call Reset
+// before decoding more data.
+func (s *SyslogStream) Decode(data []byte) ([]*Syslog, error) {
+	ls, err := s.buf.decode(data, "syslog", maxSyslogMessage, syslogFrame)
+	var out []*Syslog
+	for _, l := range ls {
+		out = append(out, l.(*Syslog))
+	}
+	return out, err
+}
+
+// syslogFrame is the streamFramer of SyslogStream.
+func syslogFrame(data []byte) (int64, layerDecodingLayer, error) {
+	if n, skip, ok := syslogOctetCount(data); ok {
+		return int64(skip) + int64(n), &Syslog{}, nil
+	} else if data[0] == '<' {
+		end := bytes.IndexAny(data, "\n\x00")
+		if end < 0 {
+			return 0, nil, nil
+		}
+		return int64(end) + 1, &Syslog{}, nil
+	} else if len(data) <= 10 && isAllDigits(string(data)) {
+		// The start of an octet count.
+		return 0, nil, nil
+	}
+	return 0, nil, errors.New("syslog stream not framed")
+}
+
+// Reset discards any partial message.
+func (s *SyslogStream) Reset() {
+	s.buf.reset()
+}
@@ -0,0 +1,170 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+func TestSyslogRFC5424(t *testing.T) {
+	// The example of RFC 5424 section 6.5, with a quote escaped.
+	msg := "<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 " +
+		`[exampleSDID@32473 iut="3" eventSource="Appli\"cation" eventID="1011"][examplePriority@32473 class="high"]` +
+		" \ufeffAn application event log entry...\n"
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &UDP{SrcPort: 40000, DstPort: 514}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload(msg)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeSyslog}, t)
+	got := p.Layer(LayerTypeSyslog).(*Syslog)
+	want := &Syslog{
+		BaseLayer: got.BaseLayer,
+		Facility:  SyslogFacilityLocal4,
+		Severity:  SyslogSeverityNotice,
+		Version:   1,
+		Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+		Hostname:  "mymachine.example.com",
+		AppName:   "evntslog",
+		MsgID:     "ID47",
+		StructuredData: []SyslogSDElement{
+			{ID: "exampleSDID@32473", Params: []SyslogSDParam{{"iut", "3"}, {"eventSource", `Appli"cation`}, {"eventID", "1011"}}},
+			{ID: "examplePriority@32473", Params: []SyslogSDParam{{"class", "high"}}},
+		},
+		Message: "An application event log entry...",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+	if got.Priority() != 165 || got.Facility.String() != "local4" || got.Severity.String() != "notice" {
+		t.Errorf("got priority %d, %v.%v", got.Priority(), got.Facility, got.Severity)
+	}
+
+	// Serializing writes the message back, less the BOM and newline.
+	buf = gopacket.NewSerializeBuffer()
+	if err := got.SerializeTo(buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	again := &Syslog{}
+	if err := again.DecodeFromBytes(buf.Bytes(), gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	again.BaseLayer = got.BaseLayer
+	if !reflect.DeepEqual(again, got) {
+		t.Errorf("got %+v after serializing, want %+v", again, got)
+	}
+}
+
+func TestSyslogBSD(t *testing.T) {
+	for _, test := range []struct {
+		msg  string
+		want Syslog
+	}{
+		{
+			"<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8",
+			Syslog{Facility: SyslogFacilityAuth, Severity: SyslogSeverityCritical,
+				Timestamp: time.Date(0, 10, 11, 22, 14, 15, 0, time.UTC), Hostname: "mymachine",
+				AppName: "su", ProcID: "230", Message: "'su root' failed for lonvick on /dev/pts/8"},
+		},
+		{
+			"<13>2024-03-01T10:00:00+01:00 fw01 kernel: DROP IN=eth0\n",
+			Syslog{Facility: SyslogFacilityUser, Severity: SyslogSeverityNotice,
+				Timestamp: time.Date(2024, 3, 1, 10, 0, 0, 0, time.FixedZone("", 3600)), Hostname: "fw01",
+				AppName: "kernel", Message: "DROP IN=eth0"},
+		},
+		{
+			// Cisco devices send a sequence number and no host name.
+			"<189>123: *Mar  1 00:00:10.123: %SYS-5-CONFIG_I: Configured from console",
+			Syslog{Facility: SyslogFacilityLocal7, Severity: SyslogSeverityNotice,
+				AppName: "123", Message: "*Mar  1 00:00:10.123: %SYS-5-CONFIG_I: Configured from console"},
+		},
+		{
+			"<6>no tag here",
+			Syslog{Facility: SyslogFacilityKern, Severity: SyslogSeverityInformational, Message: "no tag here"},
+		},
+	} {
+		got := &Syslog{}
+		if err := got.DecodeFromBytes([]byte(test.msg), gopacket.NilDecodeFeedback); err != nil {
+			t.Errorf("%q: %v", test.msg, err)
+			continue
+		}
+		got.BaseLayer = BaseLayer{}
+		if !got.Timestamp.Equal(test.want.Timestamp) {
+			t.Errorf("%q: got time %v, want %v", test.msg, got.Timestamp, test.want.Timestamp)
+		}
+		got.Timestamp, test.want.Timestamp = time.Time{}, time.Time{}
+		if !reflect.DeepEqual(*got, test.want) {
+			t.Errorf("%q:\ngot  %+v\nwant %+v", test.msg, *got, test.want)
+		}
+	}
+
+	for _, msg := range []string{"no priority", "<192>out of range", "<13>1 2003-10-11T22:14:15Z host", "<13>1 - - - - - [id x=1]"} {
+		if err := (&Syslog{}).DecodeFromBytes([]byte(msg), gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("decoded %q without error", msg)
+		}
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	setTCPPortLayerType(t, 601, LayerTypeSyslog)
+	// One segment with an octet counted message, a newline terminated one,
+	// and the start of a third.
+	payload := "25 <14>1 - host app - - - hi<14>host: second\n<14>par"
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolTCP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	tcp := &TCP{SrcPort: 40000, DstPort: 601, PSH: true, ACK: true, Window: 1024}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, tcp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeTCP, LayerTypeSyslog, LayerTypeSyslog, LayerTypeSyslog}, t)
+	var msgs []string
+	for _, l := range p.Layers() {
+		if s, ok := l.(*Syslog); ok {
+			msgs = append(msgs, s.Hostname+"|"+s.AppName+"|"+s.Message)
+		}
+	}
+	if want := []string{"host|app|hi", "|host|second", "||par"}; !reflect.DeepEqual(msgs, want) {
+		t.Errorf("got messages %q, want %q", msgs, want)
+	}
+
+	// A stream only returns messages once they're complete.
+	var s SyslogStream
+	var got []string
+	for _, chunk := range []string{"2", "5 <14>1 - host app - - - hi<14>host: sec", "ond\n<14>par", "t\n"} {
+		out, err := s.Decode([]byte(chunk))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range out {
+			got = append(got, m.Message)
+		}
+	}
+	if want := []string{"hi", "second", "part"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got stream messages %q, want %q", got, want)
+	}
+	if _, err := s.Decode([]byte("garbage\n")); err == nil {
+		t.Error("decoded unframed stream without error")
+	}
+}
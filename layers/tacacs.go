@@ -0,0 +1,583 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+const tacacsPlusHeaderLength = 12
+
+// TACACSPlusMajorVersion is the only major version of TACACS+.
+const TACACSPlusMajorVersion = 0xc
+
+// TACACSPlusType is the type of a TACACS+ packet.
+type TACACSPlusType uint8
+
+// TACACS+ packet types (RFC 8907 section 4.1).
+const (
+	TACACSPlusTypeAuthentication TACACSPlusType = 1
+	TACACSPlusTypeAuthorization  TACACSPlusType = 2
+	TACACSPlusTypeAccounting     TACACSPlusType = 3
+)
+
+func (t TACACSPlusType) String() string {
+	switch t {
+	case TACACSPlusTypeAuthentication:
+		return "Authentication"
+	case TACACSPlusTypeAuthorization:
+		return "Authorization"
+	case TACACSPlusTypeAccounting:
+		return "Accounting"
+	default:
+		return fmt.Sprintf("UnknownTACACSPlusType(%d)", uint8(t))
+	}
+}
+
+// TACACS+ header flags.
+const (
+	// TACACSPlusFlagUnencrypted means the body isn't obfuscated.
+	TACACSPlusFlagUnencrypted uint8 = 0x01
+	// TACACSPlusFlagSingleConnect asks to multiplex sessions on the
+	// connection.
+	TACACSPlusFlagSingleConnect uint8 = 0x04
+)
+
+// TACACSPlusAuthenAction is the action of an authentication START.
+type TACACSPlusAuthenAction uint8
+
+// TACACS+ authentication actions.
+const (
+	TACACSPlusAuthenActionLogin    TACACSPlusAuthenAction = 1
+	TACACSPlusAuthenActionChPass   TACACSPlusAuthenAction = 2
+	TACACSPlusAuthenActionSendAuth TACACSPlusAuthenAction = 4
+)
+
+func (a TACACSPlusAuthenAction) String() string {
+	switch a {
+	case TACACSPlusAuthenActionLogin:
+		return "LOGIN"
+	case TACACSPlusAuthenActionChPass:
+		return "CHPASS"
+	case TACACSPlusAuthenActionSendAuth:
+		return "SENDAUTH"
+	default:
+		return fmt.Sprintf("UnknownTACACSPlusAuthenAction(%d)", uint8(a))
+	}
+}
+
+// TACACSPlusAuthenType is the authentication type of a session.
+type TACACSPlusAuthenType uint8
+
+// TACACS+ authentication types.
+const (
+	TACACSPlusAuthenTypeASCII    TACACSPlusAuthenType = 1
+	TACACSPlusAuthenTypePAP      TACACSPlusAuthenType = 2
+	TACACSPlusAuthenTypeCHAP     TACACSPlusAuthenType = 3
+	TACACSPlusAuthenTypeMSCHAP   TACACSPlusAuthenType = 5
+	TACACSPlusAuthenTypeMSCHAPv2 TACACSPlusAuthenType = 6
+)
+
+func (t TACACSPlusAuthenType) String() string {
+	switch t {
+	case 0:
+		return "NotSet"
+	case TACACSPlusAuthenTypeASCII:
+		return "ASCII"
+	case TACACSPlusAuthenTypePAP:
+		return "PAP"
+	case TACACSPlusAuthenTypeCHAP:
+		return "CHAP"
+	case TACACSPlusAuthenTypeMSCHAP:
+		return "MSCHAP"
+	case TACACSPlusAuthenTypeMSCHAPv2:
+		return "MSCHAPv2"
+	default:
+		return fmt.Sprintf("UnknownTACACSPlusAuthenType(%d)", uint8(t))
+	}
+}
+
+// TACACSPlusAuthenStatus is the status of an authentication REPLY.
+type TACACSPlusAuthenStatus uint8
+
+// TACACS+ authentication statuses.
+const (
+	TACACSPlusAuthenStatusPass    TACACSPlusAuthenStatus = 0x01
+	TACACSPlusAuthenStatusFail    TACACSPlusAuthenStatus = 0x02
+	TACACSPlusAuthenStatusGetData TACACSPlusAuthenStatus = 0x03
+	TACACSPlusAuthenStatusGetUser TACACSPlusAuthenStatus = 0x04
+	TACACSPlusAuthenStatusGetPass TACACSPlusAuthenStatus = 0x05
+	TACACSPlusAuthenStatusRestart TACACSPlusAuthenStatus = 0x06
+	TACACSPlusAuthenStatusError   TACACSPlusAuthenStatus = 0x07
+	TACACSPlusAuthenStatusFollow  TACACSPlusAuthenStatus = 0x21
+)
+
+func (s TACACSPlusAuthenStatus) String() string {
+	switch s {
+	case TACACSPlusAuthenStatusPass:
+		return "PASS"
+	case TACACSPlusAuthenStatusFail:
+		return "FAIL"
+	case TACACSPlusAuthenStatusGetData:
+		return "GETDATA"
+	case TACACSPlusAuthenStatusGetUser:
+		return "GETUSER"
+	case TACACSPlusAuthenStatusGetPass:
+		return "GETPASS"
+	case TACACSPlusAuthenStatusRestart:
+		return "RESTART"
+	case TACACSPlusAuthenStatusError:
+		return "ERROR"
+	case TACACSPlusAuthenStatusFollow:
+		return "FOLLOW"
+	default:
+		return fmt.Sprintf("UnknownTACACSPlusAuthenStatus(%d)", uint8(s))
+	}
+}
+
+// TACACSPlusAuthorStatus is the status of an authorization REPLY.
+type TACACSPlusAuthorStatus uint8
+
+// TACACS+ authorization statuses.
+const (
+	TACACSPlusAuthorStatusPassAdd  TACACSPlusAuthorStatus = 0x01
+	TACACSPlusAuthorStatusPassRepl TACACSPlusAuthorStatus = 0x02
+	TACACSPlusAuthorStatusFail     TACACSPlusAuthorStatus = 0x10
+	TACACSPlusAuthorStatusError    TACACSPlusAuthorStatus = 0x11
+	TACACSPlusAuthorStatusFollow   TACACSPlusAuthorStatus = 0x21
+)
+
+func (s TACACSPlusAuthorStatus) String() string {
+	switch s {
+	case TACACSPlusAuthorStatusPassAdd:
+		return "PASS_ADD"
+	case TACACSPlusAuthorStatusPassRepl:
+		return "PASS_REPL"
+	case TACACSPlusAuthorStatusFail:
+		return "FAIL"
+	case TACACSPlusAuthorStatusError:
+		return "ERROR"
+	case TACACSPlusAuthorStatusFollow:
+		return "FOLLOW"
+	default:
+		return fmt.Sprintf("UnknownTACACSPlusAuthorStatus(%d)", uint8(s))
+	}
+}
+
+// TACACSPlusAcctStatus is the status of an accounting REPLY.
+type TACACSPlusAcctStatus uint8
+
+// TACACS+ accounting statuses.
+const (
+	TACACSPlusAcctStatusSuccess TACACSPlusAcctStatus = 0x01
+	TACACSPlusAcctStatusError   TACACSPlusAcctStatus = 0x02
+	TACACSPlusAcctStatusFollow  TACACSPlusAcctStatus = 0x21
+)
+
+func (s TACACSPlusAcctStatus) String() string {
+	switch s {
+	case TACACSPlusAcctStatusSuccess:
+		return "SUCCESS"
+	case TACACSPlusAcctStatusError:
+		return "ERROR"
+	case TACACSPlusAcctStatusFollow:
+		return "FOLLOW"
+	default:
+		return fmt.Sprintf("UnknownTACACSPlusAcctStatus(%d)", uint8(s))
+	}
+}
+
+// TACACS+ accounting request flags.
+const (
+	TACACSPlusAcctFlagStart    uint8 = 0x02
+	TACACSPlusAcctFlagStop     uint8 = 0x04
+	TACACSPlusAcctFlagWatchdog uint8 = 0x08
+)
+
+// TACACSPlusAuthenStart is the body of the first packet of an
+// authentication session.
+type TACACSPlusAuthenStart struct {
+	Action     TACACSPlusAuthenAction
+	PrivLevel  uint8
+	AuthenType TACACSPlusAuthenType
+	// AuthenService is the service requesting authentication, like 1 for
+	// login or 3 for PPP.
+	AuthenService uint8
+	User          string
+	Port          string
+	RemAddr       string
+	// Data holds the password for PAP, and the challenge and response for
+	// CHAP and MS-CHAP.
+	Data []byte
+}
+
+// TACACSPlusAuthenReply is the body of an authentication packet from the
+// server.
+type TACACSPlusAuthenReply struct {
+	Status TACACSPlusAuthenStatus
+	// Flags holds 0x01 if the client shouldn't echo the reply to the
+	// user's prompt.
+	Flags     uint8
+	ServerMsg string
+	Data      []byte
+}
+
+// TACACSPlusAuthenContinue is the body of an authentication packet from
+// the client after the first, answering the server's prompt.
+type TACACSPlusAuthenContinue struct {
+	UserMsg string
+	Data    []byte
+	// Flags holds 0x01 if the client aborts the session.
+	Flags uint8
+}
+
+// TACACSPlusAuthorRequest is the body of an authorization REQUEST.
+type TACACSPlusAuthorRequest struct {
+	// AuthenMethod is how the user was authenticated, like 6 for TACACS+.
+	AuthenMethod  uint8
+	PrivLevel     uint8
+	AuthenType    TACACSPlusAuthenType
+	AuthenService uint8
+	User          string
+	Port          string
+	RemAddr       string
+	// Args are attribute-value pairs, like "service=shell" or
+	// "cmd=show".
+	Args []string
+}
+
+// TACACSPlusAuthorReply is the body of an authorization REPLY.
+type TACACSPlusAuthorReply struct {
+	Status    TACACSPlusAuthorStatus
+	Args      []string
+	ServerMsg string
+	Data      []byte
+}
+
+// TACACSPlusAcctRequest is the body of an accounting REQUEST, which has
+// the fields of an authorization REQUEST after its flags.
+type TACACSPlusAcctRequest struct {
+	Flags uint8
+	TACACSPlusAuthorRequest
+}
+
+// TACACSPlusAcctReply is the body of an accounting REPLY.
+type TACACSPlusAcctReply struct {
+	ServerMsg string
+	Data      []byte
+	Status    TACACSPlusAcctStatus
+}
+
+// TACACSPlus is a TACACS+ packet (RFC 8907), with which network devices
+// ask servers to authenticate and authorize administrators, and report
+// the commands they run.
+//
+// Bodies are obfuscated with a key shared by the device and the server,
+// unless TACACSPlusFlagUnencrypted is set.  Unobfuscated bodies are
+// decoded into the field for the packet's type and direction; given the
+// key, package tacacs decodes obfuscated ones.
+type TACACSPlus struct {
+	BaseLayer
+	MajorVersion uint8
+	MinorVersion uint8
+	Type         TACACSPlusType
+	// SeqNo counts the packets of a session, from 1.  Packets from the
+	// client have odd numbers, and from the server even ones.
+	SeqNo     uint8
+	Flags     uint8
+	SessionID uint32
+	Length    uint32
+	// Body is the body as sent, which may be obfuscated.
+	Body []byte
+
+	// One of these is set once the body is decoded.
+	AuthenStart    *TACACSPlusAuthenStart
+	AuthenReply    *TACACSPlusAuthenReply
+	AuthenContinue *TACACSPlusAuthenContinue
+	AuthorRequest  *TACACSPlusAuthorRequest
+	AuthorReply    *TACACSPlusAuthorReply
+	AcctRequest    *TACACSPlusAcctRequest
+	AcctReply      *TACACSPlusAcctReply
+}
+
+// LayerType returns LayerTypeTACACSPlus.
+func (t *TACACSPlus) LayerType() gopacket.LayerType { return LayerTypeTACACSPlus }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (t *TACACSPlus) CanDecode() gopacket.LayerClass { return LayerTypeTACACSPlus }
+
+// NextLayerType returns LayerTypeTACACSPlus if another complete packet
+// follows this one, and otherwise LayerTypePayload.
+func (t *TACACSPlus) NextLayerType() gopacket.LayerType {
+	if len(t.BaseLayer.Payload) == 0 {
+		return gopacket.LayerTypeZero
+	}
+	if isTACACSPlusPacket(t.BaseLayer.Payload) {
+		return LayerTypeTACACSPlus
+	}
+	return gopacket.LayerTypePayload
+}
+
+// Payload returns nil, since the body is part of the layer.
+func (t *TACACSPlus) Payload() []byte { return nil }
+
+// FromClient returns true if t was sent by the client.
+func (t *TACACSPlus) FromClient() bool { return t.SeqNo%2 == 1 }
+
+func decodeTACACSPlus(data []byte, p gopacket.PacketBuilder) error {
+	// A segment that doesn't start with a complete packet is left as
+	// payload; reassemble the stream and use TACACSPlusStream to decode
+	// it.
+	if !isTACACSPlusPacket(data) {
+		return gopacket.DecodePayload.Decode(data, p)
+	}
+	t := &TACACSPlus{}
+	if err := t.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(t)
+	p.SetApplicationLayer(t)
+	if len(t.BaseLayer.Payload) == 0 {
+		return nil
+	}
+	return p.NextDecoder(gopacket.DecodeFunc(decodeTACACSPlus))
+}
+
+// isTACACSPlusPacket returns true if data starts with a complete packet.
+func isTACACSPlusPacket(data []byte) bool {
+	if len(data) < tacacsPlusHeaderLength || data[0]>>4 != TACACSPlusMajorVersion {
+		return false
+	}
+	if t := TACACSPlusType(data[1]); t < TACACSPlusTypeAuthentication || t > TACACSPlusTypeAccounting {
+		return false
+	}
+	return uint64(binary.BigEndian.Uint32(data[8:12])) <= uint64(len(data)-tacacsPlusHeaderLength)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (t *TACACSPlus) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < tacacsPlusHeaderLength {
+		df.SetTruncated()
+		return fmt.Errorf("TACACS+ length %d too short", len(data))
+	}
+	t.MajorVersion = data[0] >> 4
+	t.MinorVersion = data[0] & 0xf
+	if t.MajorVersion != TACACSPlusMajorVersion {
+		return fmt.Errorf("TACACS+ major version %#x not supported", t.MajorVersion)
+	}
+	t.Type = TACACSPlusType(data[1])
+	t.SeqNo = data[2]
+	t.Flags = data[3]
+	t.SessionID = binary.BigEndian.Uint32(data[4:8])
+	t.Length = binary.BigEndian.Uint32(data[8:12])
+	if uint64(t.Length) > uint64(len(data)-tacacsPlusHeaderLength) {
+		df.SetTruncated()
+		return fmt.Errorf("TACACS+ body length %d exceeds %d bytes available", t.Length, len(data)-tacacsPlusHeaderLength)
+	}
+	n := tacacsPlusHeaderLength + int(t.Length)
+	t.Body = data[tacacsPlusHeaderLength:n]
+	t.BaseLayer = BaseLayer{Contents: data[:n], Payload: data[n:]}
+	t.AuthenStart, t.AuthenReply, t.AuthenContinue = nil, nil, nil
+	t.AuthorRequest, t.AuthorReply = nil, nil
+	t.AcctRequest, t.AcctReply = nil, nil
+	if t.Flags&TACACSPlusFlagUnencrypted == 0 {
+		return nil
+	}
+	return t.DecodeBody(t.Body)
+}
+
+// DecodeBody decodes body, the unobfuscated body of t, into the field
+// for t's type and direction.
+func (t *TACACSPlus) DecodeBody(body []byte) error {
+	var err error
+	switch {
+	case t.Type == TACACSPlusTypeAuthentication && t.SeqNo == 1:
+		t.AuthenStart, err = decodeTACACSPlusAuthenStart(body)
+	case t.Type == TACACSPlusTypeAuthentication && t.FromClient():
+		t.AuthenContinue, err = decodeTACACSPlusAuthenContinue(body)
+	case t.Type == TACACSPlusTypeAuthentication:
+		t.AuthenReply, err = decodeTACACSPlusAuthenReply(body)
+	case t.Type == TACACSPlusTypeAuthorization && t.FromClient():
+		t.AuthorRequest = &TACACSPlusAuthorRequest{}
+		err = t.AuthorRequest.decode(body)
+	case t.Type == TACACSPlusTypeAuthorization:
+		t.AuthorReply, err = decodeTACACSPlusAuthorReply(body)
+	case t.Type == TACACSPlusTypeAccounting && t.FromClient():
+		if len(body) < 1 {
+			return errors.New("TACACS+ accounting request truncated")
+		}
+		t.AcctRequest = &TACACSPlusAcctRequest{Flags: body[0]}
+		err = t.AcctRequest.TACACSPlusAuthorRequest.decode(body[1:])
+	case t.Type == TACACSPlusTypeAccounting:
+		t.AcctReply, err = decodeTACACSPlusAcctReply(body)
+	default:
+		return fmt.Errorf("TACACS+ %v body not supported", t.Type)
+	}
+	return err
+}
+
+// tacacsPlusFields splits the variable length fields of a body, whose
+// lengths are given, from b.
+func tacacsPlusFields(b []byte, lengths ...int) ([][]byte, error) {
+	out := make([][]byte, len(lengths))
+	for i, n := range lengths {
+		if len(b) < n {
+			return nil, errors.New("TACACS+ body fields exceed body length")
+		}
+		out[i], b = b[:n], b[n:]
+	}
+	if len(b) > 0 {
+		return nil, fmt.Errorf("TACACS+ body has %d bytes after its fields", len(b))
+	}
+	return out, nil
+}
+
+func decodeTACACSPlusAuthenStart(b []byte) (*TACACSPlusAuthenStart, error) {
+	if len(b) < 8 {
+		return nil, errors.New("TACACS+ authentication START truncated")
+	}
+	f, err := tacacsPlusFields(b[8:], int(b[4]), int(b[5]), int(b[6]), int(b[7]))
+	if err != nil {
+		return nil, err
+	}
+	return &TACACSPlusAuthenStart{
+		Action:        TACACSPlusAuthenAction(b[0]),
+		PrivLevel:     b[1],
+		AuthenType:    TACACSPlusAuthenType(b[2]),
+		AuthenService: b[3],
+		User:          string(f[0]),
+		Port:          string(f[1]),
+		RemAddr:       string(f[2]),
+		Data:          f[3],
+	}, nil
+}
+
+func decodeTACACSPlusAuthenReply(b []byte) (*TACACSPlusAuthenReply, error) {
+	if len(b) < 6 {
+		return nil, errors.New("TACACS+ authentication REPLY truncated")
+	}
+	f, err := tacacsPlusFields(b[6:], int(binary.BigEndian.Uint16(b[2:4])), int(binary.BigEndian.Uint16(b[4:6])))
+	if err != nil {
+		return nil, err
+	}
+	return &TACACSPlusAuthenReply{
+		Status:    TACACSPlusAuthenStatus(b[0]),
+		Flags:     b[1],
+		ServerMsg: string(f[0]),
+		Data:      f[1],
+	}, nil
+}
+
+func decodeTACACSPlusAuthenContinue(b []byte) (*TACACSPlusAuthenContinue, error) {
+	if len(b) < 5 {
+		return nil, errors.New("TACACS+ authentication CONTINUE truncated")
+	}
+	f, err := tacacsPlusFields(b[5:], int(binary.BigEndian.Uint16(b[0:2])), int(binary.BigEndian.Uint16(b[2:4])))
+	if err != nil {
+		return nil, err
+	}
+	return &TACACSPlusAuthenContinue{UserMsg: string(f[0]), Data: f[1], Flags: b[4]}, nil
+}
+
+func (r *TACACSPlusAuthorRequest) decode(b []byte) error {
+	if len(b) < 8 || len(b) < 8+int(b[7]) {
+		return errors.New("TACACS+ authorization request truncated")
+	}
+	lengths := []int{int(b[4]), int(b[5]), int(b[6])}
+	for _, n := range b[8 : 8+int(b[7])] {
+		lengths = append(lengths, int(n))
+	}
+	f, err := tacacsPlusFields(b[8+int(b[7]):], lengths...)
+	if err != nil {
+		return err
+	}
+	*r = TACACSPlusAuthorRequest{
+		AuthenMethod:  b[0],
+		PrivLevel:     b[1],
+		AuthenType:    TACACSPlusAuthenType(b[2]),
+		AuthenService: b[3],
+		User:          string(f[0]),
+		Port:          string(f[1]),
+		RemAddr:       string(f[2]),
+	}
+	for _, a := range f[3:] {
+		r.Args = append(r.Args, string(a))
+	}
+	return nil
+}
+
+func decodeTACACSPlusAuthorReply(b []byte) (*TACACSPlusAuthorReply, error) {
+	if len(b) < 6 || len(b) < 6+int(b[1]) {
+		return nil, errors.New("TACACS+ authorization REPLY truncated")
+	}
+	lengths := []int{int(binary.BigEndian.Uint16(b[2:4])), int(binary.BigEndian.Uint16(b[4:6]))}
+	for _, n := range b[6 : 6+int(b[1])] {
+		lengths = append(lengths, int(n))
+	}
+	f, err := tacacsPlusFields(b[6+int(b[1]):], lengths...)
+	if err != nil {
+		return nil, err
+	}
+	r := &TACACSPlusAuthorReply{Status: TACACSPlusAuthorStatus(b[0]), ServerMsg: string(f[0]), Data: f[1]}
+	for _, a := range f[2:] {
+		r.Args = append(r.Args, string(a))
+	}
+	return r, nil
+}
+
+func decodeTACACSPlusAcctReply(b []byte) (*TACACSPlusAcctReply, error) {
+	if len(b) < 5 {
+		return nil, errors.New("TACACS+ accounting REPLY truncated")
+	}
+	f, err := tacacsPlusFields(b[5:], int(binary.BigEndian.Uint16(b[0:2])), int(binary.BigEndian.Uint16(b[2:4])))
+	if err != nil {
+		return nil, err
+	}
+	return &TACACSPlusAcctReply{ServerMsg: string(f[0]), Data: f[1], Status: TACACSPlusAcctStatus(b[4])}, nil
+}
+
+// maxTACACSPlusPacket is the largest packet TACACSPlusStream accepts,
+// far beyond what the longest argument lists need.
+const maxTACACSPlusPacket = 1 << 16
+
+// TACACSPlusStream splits one direction of a reassembled TACACS+
+// connection into packets, including those split across TCP segments.
+type TACACSPlusStream struct {
+	buf streamBuffer
+}
+
+// Decode appends data from the stream and returns the packets completed
+// by it.  After an error, or a gap in the stream, call Reset before
+// decoding more data.
+func (s *TACACSPlusStream) Decode(data []byte) ([]*TACACSPlus, error) {
+	ls, err := s.buf.decode(data, "TACACS+", maxTACACSPlusPacket, tacacsPlusFrame)
+	var out []*TACACSPlus
+	for _, l := range ls {
+		out = append(out, l.(*TACACSPlus))
+	}
+	return out, err
+}
+
+// tacacsPlusFrame is the streamFramer of TACACSPlusStream.
+func tacacsPlusFrame(data []byte) (int64, layerDecodingLayer, error) {
+	if len(data) < tacacsPlusHeaderLength {
+		return 0, nil, nil
+	}
+	if data[0]>>4 != TACACSPlusMajorVersion {
+		return 0, nil, fmt.Errorf("TACACS+ major version %#x not supported", data[0]>>4)
+	}
+	return tacacsPlusHeaderLength + int64(binary.BigEndian.Uint32(data[8:12])), &TACACSPlus{}, nil
+}
+
+// Reset discards any partial packet.
+func (s *TACACSPlusStream) Reset() {
+	s.buf.reset()
+}
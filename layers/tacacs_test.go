@@ -0,0 +1,165 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func testTACACSPlusPacket(typ TACACSPlusType, seq, flags uint8, session uint32, body ...byte) []byte {
+	b := []byte{0xc0, byte(typ), seq, flags, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[4:8], session)
+	binary.BigEndian.PutUint32(b[8:12], uint32(len(body)))
+	return append(b, body...)
+}
+
+func TestTACACSPlusTCP(t *testing.T) {
+	setTCPPortLayerType(t, 49, LayerTypeTACACSPlus)
+	// A PAP login and, multiplexed on the same connection, a request to
+	// authorize a command.
+	start := testTACACSPlusPacket(TACACSPlusTypeAuthentication, 1, TACACSPlusFlagUnencrypted|TACACSPlusFlagSingleConnect, 0x1111,
+		1, 1, 2, 1, 5, 4, 8, 6,
+		'a', 'l', 'i', 'c', 'e', 't', 't', 'y', '1', '1', '0', '.', '0', '.', '0', '.', '9', 's', 'e', 'c', 'r', 'e', 't')
+	author := testTACACSPlusPacket(TACACSPlusTypeAuthorization, 1, TACACSPlusFlagUnencrypted|TACACSPlusFlagSingleConnect, 0x2222,
+		6, 15, 1, 1, 5, 0, 0, 2, 13, 8,
+		'a', 'l', 'i', 'c', 'e', 's', 'e', 'r', 'v', 'i', 'c', 'e', '=', 's', 'h', 'e', 'l', 'l', 'c', 'm', 'd', '=', 's', 'h', 'o', 'w')
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolTCP, SrcIP: net.IP{10, 0, 0, 9}, DstIP: net.IP{10, 0, 0, 1}}
+	tcp := &TCP{SrcPort: 40000, DstPort: 49, PSH: true, ACK: true, Window: 1024}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, tcp, gopacket.Payload(append(start, author...))); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, testDecodeOptions)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeTCP, LayerTypeTACACSPlus, LayerTypeTACACSPlus}, t)
+	var got []*TACACSPlus
+	for _, l := range p.Layers() {
+		if tp, ok := l.(*TACACSPlus); ok {
+			got = append(got, tp)
+		}
+	}
+	if got[0].SessionID != 0x1111 || got[0].Type != TACACSPlusTypeAuthentication || !got[0].FromClient() {
+		t.Errorf("got header %+v", got[0])
+	}
+	wantStart := &TACACSPlusAuthenStart{
+		Action: TACACSPlusAuthenActionLogin, PrivLevel: 1, AuthenType: TACACSPlusAuthenTypePAP, AuthenService: 1,
+		User: "alice", Port: "tty1", RemAddr: "10.0.0.9", Data: []byte("secret"),
+	}
+	if !reflect.DeepEqual(got[0].AuthenStart, wantStart) {
+		t.Errorf("got START %+v, want %+v", got[0].AuthenStart, wantStart)
+	}
+	wantAuthor := &TACACSPlusAuthorRequest{
+		AuthenMethod: 6, PrivLevel: 15, AuthenType: TACACSPlusAuthenTypeASCII, AuthenService: 1,
+		User: "alice", Args: []string{"service=shell", "cmd=show"},
+	}
+	if got[1].SessionID != 0x2222 || !reflect.DeepEqual(got[1].AuthorRequest, wantAuthor) {
+		t.Errorf("got authorization request %+v, want %+v", got[1].AuthorRequest, wantAuthor)
+	}
+
+	// A stream splits packets across segments.
+	var s TACACSPlusStream
+	var out []*TACACSPlus
+	data := append(start, author...)
+	for _, chunk := range [][]byte{data[:5], data[5:40], data[40:]} {
+		ps, err := s.Decode(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, ps...)
+	}
+	if len(out) != 2 || out[0].AuthenStart == nil || out[1].AuthorRequest == nil {
+		t.Errorf("got %d packets from stream", len(out))
+	}
+	s.Reset()
+	huge := append([]byte{}, start[:tacacsPlusHeaderLength]...)
+	binary.BigEndian.PutUint32(huge[8:12], 0xffffffff)
+	if _, err := s.Decode(huge); err == nil {
+		t.Error("stream buffered a 4GB packet without error")
+	}
+}
+
+func TestTACACSPlusBodies(t *testing.T) {
+	for _, test := range []struct {
+		packet []byte
+		want   TACACSPlus
+	}{
+		{
+			testTACACSPlusPacket(TACACSPlusTypeAuthentication, 2, TACACSPlusFlagUnencrypted, 1,
+				byte(TACACSPlusAuthenStatusGetPass), 1, 0, 9, 0, 0, 'P', 'a', 's', 's', 'w', 'o', 'r', 'd', ':'),
+			TACACSPlus{AuthenReply: &TACACSPlusAuthenReply{Status: TACACSPlusAuthenStatusGetPass, Flags: 1, ServerMsg: "Password:", Data: []byte{}}},
+		},
+		{
+			testTACACSPlusPacket(TACACSPlusTypeAuthentication, 3, TACACSPlusFlagUnencrypted, 1,
+				0, 3, 0, 0, 0, 'p', 'w', '1'),
+			TACACSPlus{AuthenContinue: &TACACSPlusAuthenContinue{UserMsg: "pw1", Data: []byte{}}},
+		},
+		{
+			testTACACSPlusPacket(TACACSPlusTypeAuthorization, 2, TACACSPlusFlagUnencrypted, 1,
+				byte(TACACSPlusAuthorStatusPassAdd), 1, 0, 0, 0, 0, 8, 'p', 'r', 'i', 'v', '-', 'l', 'v', 'l'),
+			TACACSPlus{AuthorReply: &TACACSPlusAuthorReply{Status: TACACSPlusAuthorStatusPassAdd, Args: []string{"priv-lvl"}, Data: []byte{}}},
+		},
+		{
+			testTACACSPlusPacket(TACACSPlusTypeAccounting, 1, TACACSPlusFlagUnencrypted, 1,
+				TACACSPlusAcctFlagStop, 6, 15, 1, 1, 3, 0, 0, 1, 9, 'b', 'o', 'b', 't', 'a', 's', 'k', '_', 'i', 'd', '=', '7'),
+			TACACSPlus{AcctRequest: &TACACSPlusAcctRequest{Flags: TACACSPlusAcctFlagStop, TACACSPlusAuthorRequest: TACACSPlusAuthorRequest{
+				AuthenMethod: 6, PrivLevel: 15, AuthenType: TACACSPlusAuthenTypeASCII, AuthenService: 1, User: "bob", Args: []string{"task_id=7"},
+			}}},
+		},
+		{
+			testTACACSPlusPacket(TACACSPlusTypeAccounting, 2, TACACSPlusFlagUnencrypted, 1,
+				0, 0, 0, 0, byte(TACACSPlusAcctStatusSuccess)),
+			TACACSPlus{AcctReply: &TACACSPlusAcctReply{Status: TACACSPlusAcctStatusSuccess, Data: []byte{}}},
+		},
+	} {
+		got := &TACACSPlus{}
+		if err := got.DecodeFromBytes(test.packet, gopacket.NilDecodeFeedback); err != nil {
+			t.Errorf("%x: %v", test.packet, err)
+			continue
+		}
+		for _, pair := range [][2]interface{}{
+			{got.AuthenReply, test.want.AuthenReply},
+			{got.AuthenContinue, test.want.AuthenContinue},
+			{got.AuthorReply, test.want.AuthorReply},
+			{got.AcctRequest, test.want.AcctRequest},
+			{got.AcctReply, test.want.AcctReply},
+		} {
+			if !reflect.DeepEqual(pair[0], pair[1]) {
+				t.Errorf("%x: got %+v, want %+v", test.packet, pair[0], pair[1])
+			}
+		}
+	}
+
+	// Obfuscated bodies are left for package tacacs.
+	obf := testTACACSPlusPacket(TACACSPlusTypeAuthentication, 1, 0, 1, 0xde, 0xad, 0xbe, 0xef)
+	got := &TACACSPlus{}
+	if err := got.DecodeFromBytes(obf, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if got.AuthenStart != nil || len(got.Body) != 4 {
+		t.Errorf("got %+v from obfuscated packet", got)
+	}
+
+	for _, b := range [][]byte{
+		obf[:11],
+		obf[:15],
+		testTACACSPlusPacket(TACACSPlusTypeAuthentication, 1, TACACSPlusFlagUnencrypted, 1, 1, 1, 2, 1, 5, 0, 0, 0, 'a'),
+		append([]byte{0x10}, obf[1:]...),
+	} {
+		if err := (&TACACSPlus{}).DecodeFromBytes(b, gopacket.NilDecodeFeedback); err == nil {
+			t.Errorf("decoded %x without error", b)
+		}
+	}
+}
@@ -40,20 +40,26 @@ type TCPOptionKind uint8
 const (
 	TCPOptionKindEndList                         = 0
 	TCPOptionKindNop                             = 1
-	TCPOptionKindMSS                             = 2  // len = 4
-	TCPOptionKindWindowScale                     = 3  // len = 3
-	TCPOptionKindSACKPermitted                   = 4  // len = 2
-	TCPOptionKindSACK                            = 5  // len = n
-	TCPOptionKindEcho                            = 6  // len = 6, obsolete
-	TCPOptionKindEchoReply                       = 7  // len = 6, obsolete
-	TCPOptionKindTimestamps                      = 8  // len = 10
-	TCPOptionKindPartialOrderConnectionPermitted = 9  // len = 2, obsolete
-	TCPOptionKindPartialOrderServiceProfile      = 10 // len = 3, obsolete
-	TCPOptionKindCC                              = 11 // obsolete
-	TCPOptionKindCCNew                           = 12 // obsolete
-	TCPOptionKindCCEcho                          = 13 // obsolete
-	TCPOptionKindAltChecksum                     = 14 // len = 3, obsolete
-	TCPOptionKindAltChecksumData                 = 15 // len = n, obsolete
+	TCPOptionKindMSS                             = 2   // len = 4
+	TCPOptionKindWindowScale                     = 3   // len = 3
+	TCPOptionKindSACKPermitted                   = 4   // len = 2
+	TCPOptionKindSACK                            = 5   // len = n
+	TCPOptionKindEcho                            = 6   // len = 6, obsolete
+	TCPOptionKindEchoReply                       = 7   // len = 6, obsolete
+	TCPOptionKindTimestamps                      = 8   // len = 10
+	TCPOptionKindPartialOrderConnectionPermitted = 9   // len = 2, obsolete
+	TCPOptionKindPartialOrderServiceProfile      = 10  // len = 3, obsolete
+	TCPOptionKindCC                              = 11  // obsolete
+	TCPOptionKindCCNew                           = 12  // obsolete
+	TCPOptionKindCCEcho                          = 13  // obsolete
+	TCPOptionKindAltChecksum                     = 14  // len = 3, obsolete
+	TCPOptionKindAltChecksumData                 = 15  // len = n, obsolete
+	TCPOptionKindUserTimeout                     = 28  // len = 4
+	TCPOptionKindAuthentication                  = 29  // len = n
+	TCPOptionKindMultipath                       = 30  // len = n
+	TCPOptionKindFastOpen                        = 34  // len = 2-18
+	TCPOptionKindAccECN0                         = 172 // len = 2-11
+	TCPOptionKindAccECN1                         = 174 // len = 2-11
 )
 
 func (k TCPOptionKind) String() string {
@@ -90,6 +96,18 @@ func (k TCPOptionKind) String() string {
 		return "AltChecksum"
 	case TCPOptionKindAltChecksumData:
 		return "AltChecksumData"
+	case TCPOptionKindUserTimeout:
+		return "UserTimeout"
+	case TCPOptionKindAuthentication:
+		return "Authentication"
+	case TCPOptionKindMultipath:
+		return "Multipath"
+	case TCPOptionKindFastOpen:
+		return "FastOpen"
+	case TCPOptionKindAccECN0:
+		return "AccECN0"
+	case TCPOptionKindAccECN1:
+		return "AccECN1"
 	default:
 		return fmt.Sprintf("Unknown(%d)", k)
 	}
@@ -101,6 +119,35 @@ type TCPOption struct {
 	OptionData   []byte
 }
 
+// TCPAccECNCounters are the byte counters of an AccECN option: the number
+// of payload bytes received with each ECN codepoint, modulo 2^24.  An
+// option may carry fewer than three counters, and Count says how many it
+// did; the others are zero.
+type TCPAccECNCounters struct {
+	ECT0, CE, ECT1 uint32
+	Count          int
+}
+
+// AccECN returns the counters of an AccECN0 or AccECN1 option, which list
+// them in opposite orders.  It returns false for other options, or a
+// length that isn't a whole number of counters.
+func (t TCPOption) AccECN() (TCPAccECNCounters, bool) {
+	var c TCPAccECNCounters
+	if (t.OptionType != TCPOptionKindAccECN0 && t.OptionType != TCPOptionKindAccECN1) || len(t.OptionData)%3 != 0 || len(t.OptionData) > 9 {
+		return c, false
+	}
+	c.Count = len(t.OptionData) / 3
+	fields := [3]*uint32{&c.ECT0, &c.CE, &c.ECT1}
+	if t.OptionType == TCPOptionKindAccECN1 {
+		fields[0], fields[2] = fields[2], fields[0]
+	}
+	for i := 0; i < c.Count; i++ {
+		b := t.OptionData[3*i:]
+		*fields[i] = uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+	}
+	return c, true
+}
+
 func (t TCPOption) String() string {
 	hd := hex.EncodeToString(t.OptionData)
 	if len(hd) > 0 {
@@ -121,6 +168,11 @@ func (t TCPOption) String() string {
 				binary.BigEndian.Uint32(t.OptionData[4:8]),
 				hd)
 		}
+
+	case TCPOptionKindAccECN0, TCPOptionKindAccECN1:
+		if c, ok := t.AccECN(); ok {
+			return fmt.Sprintf("TCPOption(%s:ECT0=%d CE=%d ECT1=%d%s)", t.OptionType, c.ECT0, c.CE, c.ECT1, hd)
+		}
 	}
 	return fmt.Sprintf("TCPOption(%s:%s)", t.OptionType, hd)
 }
@@ -281,12 +333,46 @@ func (tcp *TCP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
 	return nil
 }
 
+// Option returns the first option of the given kind, and whether there was
+// one.
+func (t *TCP) Option(kind TCPOptionKind) (TCPOption, bool) {
+	for _, o := range t.Options {
+		if o.OptionType == kind {
+			return o, true
+		}
+	}
+	return TCPOption{}, false
+}
+
+// ACE returns the AccECN counter of CE-marked packets received, modulo 8,
+// which connections that negotiated AccECN carry in the AE (NS), CWR and
+// ECE flags of segments other than the SYN and SYN-ACK.
+func (t *TCP) ACE() uint8 {
+	var ace uint8
+	if t.NS {
+		ace |= 4
+	}
+	if t.CWR {
+		ace |= 2
+	}
+	if t.ECE {
+		ace |= 1
+	}
+	return ace
+}
+
 func (t *TCP) CanDecode() gopacket.LayerClass {
 	return LayerTypeTCP
 }
 
+// NextLayerType uses the ports to select the next decoder, from
+// TCPPortLayerType.  It tries the destination port first, then the source
+// port, and returns gopacket.LayerTypePayload if neither is there.
 func (t *TCP) NextLayerType() gopacket.LayerType {
-	return gopacket.LayerTypePayload
+	if lt := t.DstPort.LayerType(); lt != gopacket.LayerTypePayload {
+		return lt
+	}
+	return t.SrcPort.LayerType()
 }
 
 func decodeTCP(data []byte, p gopacket.PacketBuilder) error {
@@ -297,7 +383,7 @@ func decodeTCP(data []byte, p gopacket.PacketBuilder) error {
 	if err != nil {
 		return err
 	}
-	return p.NextDecoder(gopacket.LayerTypePayload)
+	return p.NextDecoder(tcp.NextLayerType())
 }
 
 func (t *TCP) TransportFlow() gopacket.Flow {
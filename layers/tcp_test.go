@@ -6,7 +6,18 @@
 
 package layers
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// setTCPPortLayerType decodes the payloads of TCP segments to or from port
+// as lt until the test ends.
+func setTCPPortLayerType(t *testing.T, port TCPPort, lt gopacket.LayerType) {
+	TCPPortLayerType[port] = lt
+	t.Cleanup(func() { delete(TCPPortLayerType, port) })
+}
 
 func TestTCPOptionKindString(t *testing.T) {
 	testData := []struct {
@@ -29,7 +40,13 @@ func TestTCPOptionKindString(t *testing.T) {
 			OptionLength: 10,
 			OptionData:   []byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01},
 		},
-			"TCPOption(Timestamps:2/1 0x0000000200000001)"}}
+			"TCPOption(Timestamps:2/1 0x0000000200000001)"},
+		{&TCPOption{
+			OptionType:   TCPOptionKindAccECN1,
+			OptionLength: 8,
+			OptionData:   []byte{0x00, 0x00, 0x05, 0x00, 0x01, 0x00},
+		},
+			"TCPOption(AccECN1:ECT0=0 CE=256 ECT1=5 0x000005000100)"}}
 
 	for _, tc := range testData {
 		if s := tc.o.String(); s != tc.s {
@@ -37,3 +54,52 @@ func TestTCPOptionKindString(t *testing.T) {
 		}
 	}
 }
+
+func TestTCPAccECN(t *testing.T) {
+	o := TCPOption{OptionType: TCPOptionKindAccECN0, OptionData: []byte{0, 0, 1, 0, 0, 2, 0, 0, 3}}
+	if c, ok := o.AccECN(); !ok || c != (TCPAccECNCounters{ECT0: 1, CE: 2, ECT1: 3, Count: 3}) {
+		t.Errorf("got %+v, %v", c, ok)
+	}
+	o.OptionData = o.OptionData[:4]
+	if _, ok := o.AccECN(); ok {
+		t.Error("partial counter accepted")
+	}
+	tcp := &TCP{NS: true, ECE: true, Options: []TCPOption{{OptionType: TCPOptionKindNop}, o}}
+	if tcp.ACE() != 5 {
+		t.Errorf("got ACE %d", tcp.ACE())
+	}
+	if got, ok := tcp.Option(TCPOptionKindAccECN0); !ok || len(got.OptionData) != 4 {
+		t.Errorf("got option %v", got)
+	}
+	if _, ok := tcp.Option(TCPOptionKindAccECN1); ok {
+		t.Error("found missing option")
+	}
+}
+
+func TestTCPPortLayerType(t *testing.T) {
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolTCP, SrcIP: []byte{10, 0, 0, 1}, DstIP: []byte{10, 0, 0, 2}}
+	tcp := &TCP{SrcPort: 50000, DstPort: 179, ACK: true, Window: 1024}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, tcp, gopacket.Payload(bgpMessage(BGPTypeKeepalive))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Parsers without the BGP layer decode segments to well-known ports.
+	var dip IPv4
+	var dtcp TCP
+	var payload gopacket.Payload
+	parser := gopacket.NewDecodingLayerParser(LayerTypeIPv4, &dip, &dtcp, &payload)
+	var decoded []gopacket.LayerType
+	if err := parser.DecodeLayers(buf.Bytes(), &decoded); err != nil {
+		t.Errorf("parser: %v", err)
+	}
+	if got := dtcp.NextLayerType(); got != gopacket.LayerTypePayload {
+		t.Errorf("got next layer %v by default, want Payload", got)
+	}
+
+	setTCPPortLayerType(t, 179, LayerTypeBGP)
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, gopacket.Default)
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeTCP, LayerTypeBGP}, t)
+}
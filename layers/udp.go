@@ -72,6 +72,8 @@ func (u *UDP) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOpt
 	if opts.FixLengths {
 		if jumbo {
 			u.Length = 0
+		} else if len(payload)+8 > 65535 {
+			return fmt.Errorf("UDP length %d exceeds 65535", len(payload)+8)
 		} else {
 			u.Length = uint16(len(payload)) + 8
 		}
@@ -97,12 +99,34 @@ func (u *UDP) CanDecode() gopacket.LayerClass {
 
 // NextLayerType use the destination port to select the
 // right next decoder. It tries first to decode via the
-// destination port, then the source port.
+// destination port, then the source port.  Responses from
+// DNS servers are DNS whatever the client's port, which may
+// be mDNS's.  Ports without a layer type that were added with
+// AddRTPPortHint are classified with ClassifyRTP, or as STUN for the ICE
+// checks multiplexed with media.
 func (u *UDP) NextLayerType() gopacket.LayerType {
+	if u.SrcPort == 53 {
+		return LayerTypeDNS
+	}
 	if lt := u.DstPort.LayerType(); lt != gopacket.LayerTypePayload {
 		return lt
 	}
-	return u.SrcPort.LayerType()
+	if lt := u.SrcPort.LayerType(); lt != gopacket.LayerTypePayload {
+		return lt
+	}
+	if u.SrcPort == 3544 || u.DstPort == 3544 {
+		return teredoNextLayerType(u.BaseLayer.Payload)
+	}
+	if (u.SrcPort == 443 || u.DstPort == 443) && isQUIC(u.BaseLayer.Payload) {
+		return LayerTypeQUIC
+	}
+	if rtpPortHinted(u.SrcPort, u.DstPort) {
+		if isSTUNMessage(u.BaseLayer.Payload) {
+			return LayerTypeSTUN
+		}
+		return ClassifyRTP(u.BaseLayer.Payload)
+	}
+	return gopacket.LayerTypePayload
 }
 
 func decodeUDP(data []byte, p gopacket.PacketBuilder) error {
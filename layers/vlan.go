@@ -0,0 +1,125 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"github.com/mistsys/gopacket"
+)
+
+// VLANTag is one 802.1Q or 802.1ad tag of a VLAN stack.
+type VLANTag struct {
+	// TPID is the EthernetType identifying the tag, EthernetTypeDot1Q or
+	// EthernetTypeQinQ.  Zero lets SerializableLayers pick it.
+	TPID           EthernetType
+	Priority       uint8
+	DropEligible   bool
+	VLANIdentifier uint16
+}
+
+// VLANStack is the VLAN tags of a frame, outermost first.  Single tagged
+// frames have one tag, QinQ frames a service tag then a customer tag.
+type VLANStack []VLANTag
+
+// PacketVLANStack returns the VLAN tags of p, from the Dot1Q layers that
+// follow its Ethernet layer.  It returns nil for untagged packets.
+func PacketVLANStack(p gopacket.Packet) VLANStack {
+	return LayersVLANStack(p.Layers())
+}
+
+// LayersVLANStack is like PacketVLANStack, for the layers decoded by a
+// DecodingLayerParser or DecodingLayerContainer.
+func LayersVLANStack(ls []gopacket.Layer) VLANStack {
+	var s VLANStack
+	var tpid EthernetType
+	for _, l := range ls {
+		switch l := l.(type) {
+		case *Ethernet:
+			tpid = l.EthernetType
+		case *Dot1Q:
+			s = append(s, VLANTag{
+				TPID:           tpid,
+				Priority:       l.Priority,
+				DropEligible:   l.DropEligible,
+				VLANIdentifier: l.VLANIdentifier,
+			})
+			tpid = l.Type
+		default:
+			if s != nil {
+				return s
+			}
+		}
+	}
+	return s
+}
+
+// Outer returns the outermost tag, the service tag of a QinQ frame.
+func (s VLANStack) Outer() (VLANTag, bool) {
+	if len(s) == 0 {
+		return VLANTag{}, false
+	}
+	return s[0], true
+}
+
+// Inner returns the innermost tag, the customer tag of a QinQ frame.  For
+// single tagged frames it's the same as Outer.
+func (s VLANStack) Inner() (VLANTag, bool) {
+	if len(s) == 0 {
+		return VLANTag{}, false
+	}
+	return s[len(s)-1], true
+}
+
+// IDs returns the VLAN identifiers of the stack, outermost first.
+func (s VLANStack) IDs() []uint16 {
+	ids := make([]uint16, len(s))
+	for i, t := range s {
+		ids[i] = t.VLANIdentifier
+	}
+	return ids
+}
+
+// tpid returns the TPID of the i'th tag, defaulting to EthernetTypeQinQ for
+// the outer tags and EthernetTypeDot1Q for the innermost one.
+func (s VLANStack) tpid(i int) EthernetType {
+	switch {
+	case s[i].TPID != 0:
+		return s[i].TPID
+	case i < len(s)-1:
+		return EthernetTypeQinQ
+	}
+	return EthernetTypeDot1Q
+}
+
+// SerializableLayers returns the layers serializing eth followed by the
+// stack, for the payload of type next.  It sets eth.EthernetType to the
+// TPID of the outer tag, or to next if the stack is empty:
+//
+//	stack := layers.VLANStack{{VLANIdentifier: 100}, {VLANIdentifier: 10}}
+//	ls := append(stack.SerializableLayers(eth, layers.EthernetTypeIPv4), ip, udp, payload)
+//	err := gopacket.SerializeLayers(buf, opts, ls...)
+func (s VLANStack) SerializableLayers(eth *Ethernet, next EthernetType) []gopacket.SerializableLayer {
+	ls := make([]gopacket.SerializableLayer, 0, len(s)+1)
+	ls = append(ls, eth)
+	if len(s) == 0 {
+		eth.EthernetType = next
+		return ls
+	}
+	eth.EthernetType = s.tpid(0)
+	for i, t := range s {
+		d := &Dot1Q{
+			Priority:       t.Priority,
+			DropEligible:   t.DropEligible,
+			VLANIdentifier: t.VLANIdentifier,
+			Type:           next,
+		}
+		if i < len(s)-1 {
+			d.Type = s.tpid(i + 1)
+		}
+		ls = append(ls, d)
+	}
+	return ls
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+// testPacketQinQ is a QinQ ARP packet, service VLAN 100 with PCP 3 and DEI
+// set, customer VLAN 10 with PCP 5.
+var testPacketQinQ = []byte{
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x88, 0xa8,
+	0x70, 0x64, 0x81, 0x00,
+	0xa0, 0x0a, 0x08, 0x06,
+	0x00, 0x01, 0x08, 0x00, 0x06, 0x04, 0x00, 0x01,
+	0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x0a, 0x00, 0x00, 0x01,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x02,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+func TestVLANStack(t *testing.T) {
+	p := gopacket.NewPacket(testPacketQinQ, LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeEthernet, LayerTypeDot1Q, LayerTypeDot1Q, LayerTypeARP}, t)
+	s := PacketVLANStack(p)
+	want := VLANStack{
+		{TPID: EthernetTypeQinQ, Priority: 3, DropEligible: true, VLANIdentifier: 100},
+		{TPID: EthernetTypeDot1Q, Priority: 5, VLANIdentifier: 10},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Fatalf("got stack %+v, want %+v", s, want)
+	}
+	if o, _ := s.Outer(); o.VLANIdentifier != 100 {
+		t.Errorf("got outer tag %+v", o)
+	}
+	if i, _ := s.Inner(); i.VLANIdentifier != 10 {
+		t.Errorf("got inner tag %+v", i)
+	}
+	if ids := s.IDs(); !reflect.DeepEqual(ids, []uint16{100, 10}) {
+		t.Errorf("got ids %v", ids)
+	}
+
+	// Serialize the stack with default TPIDs, which match the packet's.
+	for i := range s {
+		s[i].TPID = 0
+	}
+	eth := &Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}}
+	buf := gopacket.NewSerializeBuffer()
+	ls := append(s.SerializableLayers(eth, EthernetTypeARP), p.Layer(LayerTypeARP).(*ARP))
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{}, ls...); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), testPacketQinQ) {
+		t.Errorf("serialization mismatch:\ngot  %x\nwant %x", buf.Bytes(), testPacketQinQ)
+	}
+}
+
+func TestVLANStackUntagged(t *testing.T) {
+	data := ethernetFrame(t, EthernetTypeARP, &ARP{AddrType: LinkTypeEthernet, Protocol: EthernetTypeIPv4, HwAddressSize: 6, ProtAddressSize: 4,
+		SourceHwAddress: make([]byte, 6), SourceProtAddress: make([]byte, 4), DstHwAddress: make([]byte, 6), DstProtAddress: make([]byte, 4)})
+	p := gopacket.NewPacket(data, LinkTypeEthernet, gopacket.Default)
+	s := PacketVLANStack(p)
+	if s != nil {
+		t.Errorf("got stack %+v for untagged packet", s)
+	}
+	if _, ok := s.Outer(); ok {
+		t.Error("untagged packet has an outer tag")
+	}
+	eth := &Ethernet{}
+	if ls := s.SerializableLayers(eth, EthernetTypeIPv4); len(ls) != 1 || eth.EthernetType != EthernetTypeIPv4 {
+		t.Errorf("got layers %v, type %v", ls, eth.EthernetType)
+	}
+}
+
+func TestDot1QDropEligible(t *testing.T) {
+	d := &Dot1Q{Priority: 7, DropEligible: true, VLANIdentifier: 0xfff, Type: EthernetTypeIPv4}
+	buf := gopacket.NewSerializeBuffer()
+	if err := d.SerializeTo(buf, gopacket.SerializeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xff, 0xff, 0x08, 0x00}; !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got %x, want %x", buf.Bytes(), want)
+	}
+	got := &Dot1Q{}
+	if err := got.DecodeFromBytes(buf.Bytes(), gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if !got.DropEligible || got.Priority != 7 || got.VLANIdentifier != 0xfff {
+		t.Errorf("got %+v", got)
+	}
+	if err := got.DecodeFromBytes([]byte{1, 2}, gopacket.NilDecodeFeedback); err == nil {
+		t.Error("decoded truncated tag")
+	}
+}
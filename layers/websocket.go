@@ -0,0 +1,240 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// WebSocketOpcode is the opcode of a WebSocket frame.
+type WebSocketOpcode uint8
+
+const (
+	WebSocketContinuation WebSocketOpcode = 0x0
+	WebSocketText         WebSocketOpcode = 0x1
+	WebSocketBinary       WebSocketOpcode = 0x2
+	WebSocketClose        WebSocketOpcode = 0x8
+	WebSocketPing         WebSocketOpcode = 0x9
+	WebSocketPong         WebSocketOpcode = 0xa
+)
+
+func (o WebSocketOpcode) String() string {
+	switch o {
+	case WebSocketContinuation:
+		return "Continuation"
+	case WebSocketText:
+		return "Text"
+	case WebSocketBinary:
+		return "Binary"
+	case WebSocketClose:
+		return "Close"
+	case WebSocketPing:
+		return "Ping"
+	case WebSocketPong:
+		return "Pong"
+	default:
+		return fmt.Sprintf("UnknownWebSocketOpcode(%d)", uint8(o))
+	}
+}
+
+// Control reports whether o is the opcode of a control frame.
+func (o WebSocketOpcode) Control() bool { return o&0x8 != 0 }
+
+// WebSocketFrame is a WebSocket frame (RFC 6455 section 5.2).
+type WebSocketFrame struct {
+	Fin              bool
+	RSV1, RSV2, RSV3 bool
+	Opcode           WebSocketOpcode
+	// Masked is set for frames sent by clients, whose payload is masked
+	// with MaskingKey.
+	Masked     bool
+	MaskingKey [4]byte
+	Length     uint64
+	// Payload is the unmasked payload.  It is a copy if the frame was
+	// masked.
+	Payload []byte
+	// CloseCode and CloseReason are set for close frames that have them.
+	CloseCode   uint16
+	CloseReason string
+}
+
+// WebSocket is a run of WebSocket frames.  WebSocket runs over HTTP
+// connections after an upgrade, so TCP payloads aren't decoded as
+// WebSocket unless asked to.  Frames may also span segments: decoding a
+// reassembled stream with DecodeWebSocketFrame handles them.
+type WebSocket struct {
+	BaseLayer
+	Frames []WebSocketFrame
+}
+
+// LayerType returns LayerTypeWebSocket.
+func (w *WebSocket) LayerType() gopacket.LayerType { return LayerTypeWebSocket }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (w *WebSocket) CanDecode() gopacket.LayerClass { return LayerTypeWebSocket }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (w *WebSocket) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+func decodeWebSocket(data []byte, p gopacket.PacketBuilder) error {
+	return decodingLayerDecoder(&WebSocket{}, data, p)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (w *WebSocket) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) == 0 {
+		df.SetTruncated()
+		return fmt.Errorf("WebSocket payload empty")
+	}
+	w.Frames = w.Frames[:0]
+	for rest := data; len(rest) > 0; {
+		var f WebSocketFrame
+		n, err := DecodeWebSocketFrame(&f, rest)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			df.SetTruncated()
+			return fmt.Errorf("WebSocket frame truncated")
+		}
+		w.Frames = append(w.Frames, f)
+		rest = rest[n:]
+	}
+	w.BaseLayer = BaseLayer{Contents: data}
+	return nil
+}
+
+// DecodeWebSocketFrame decodes the frame at the start of data into f,
+// returning its length, which is 0 with no error if data doesn't hold all
+// of it yet.
+func DecodeWebSocketFrame(f *WebSocketFrame, data []byte) (int, error) {
+	if len(data) < 2 {
+		return 0, nil
+	}
+	*f = WebSocketFrame{
+		Fin:    data[0]&0x80 != 0,
+		RSV1:   data[0]&0x40 != 0,
+		RSV2:   data[0]&0x20 != 0,
+		RSV3:   data[0]&0x10 != 0,
+		Opcode: WebSocketOpcode(data[0] & 0xf),
+		Masked: data[1]&0x80 != 0,
+		Length: uint64(data[1] & 0x7f),
+	}
+	n := 2
+	switch f.Length {
+	case 126:
+		if len(data) < n+2 {
+			return 0, nil
+		}
+		f.Length = uint64(binary.BigEndian.Uint16(data[n:]))
+		n += 2
+	case 127:
+		if len(data) < n+8 {
+			return 0, nil
+		}
+		f.Length = binary.BigEndian.Uint64(data[n:])
+		if f.Length>>63 != 0 {
+			return 0, fmt.Errorf("WebSocket frame length %#x has its most significant bit set", f.Length)
+		}
+		n += 8
+	}
+	if f.Opcode.Control() && (f.Length > 125 || !f.Fin) {
+		return 0, fmt.Errorf("WebSocket %v frame fragmented or longer than 125 bytes", f.Opcode)
+	}
+	if f.Masked {
+		if len(data) < n+4 {
+			return 0, nil
+		}
+		copy(f.MaskingKey[:], data[n:])
+		n += 4
+	}
+	if uint64(len(data)-n) < f.Length {
+		return 0, nil
+	}
+	f.Payload = data[n : n+int(f.Length)]
+	n += int(f.Length)
+	if f.Masked {
+		f.Payload = append([]byte(nil), f.Payload...)
+		for i := range f.Payload {
+			f.Payload[i] ^= f.MaskingKey[i%4]
+		}
+	}
+	if f.Opcode == WebSocketClose && len(f.Payload) >= 2 {
+		f.CloseCode = binary.BigEndian.Uint16(f.Payload)
+		f.CloseReason = string(f.Payload[2:])
+	}
+	return n, nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.  Frames
+// with Masked set are masked with their MaskingKey, and the lengths are
+// always those of the payloads.
+func (w *WebSocket) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	size := 0
+	for i := range w.Frames {
+		size += w.Frames[i].headerLength() + len(w.Frames[i].Payload)
+	}
+	bytes, err := b.PrependBytes(size)
+	if err != nil {
+		return err
+	}
+	for i := range w.Frames {
+		f := &w.Frames[i]
+		h := f.headerLength()
+		bytes[0] = byte(f.Opcode & 0xf)
+		for j, set := range []bool{f.Fin, f.RSV1, f.RSV2, f.RSV3} {
+			if set {
+				bytes[0] |= 0x80 >> uint(j)
+			}
+		}
+		n := len(f.Payload)
+		switch {
+		case n < 126:
+			bytes[1] = byte(n)
+		case n <= 0xffff:
+			bytes[1] = 126
+			binary.BigEndian.PutUint16(bytes[2:], uint16(n))
+		default:
+			bytes[1] = 127
+			binary.BigEndian.PutUint64(bytes[2:], uint64(n))
+		}
+		if f.Masked {
+			bytes[1] |= 0x80
+			copy(bytes[h-4:], f.MaskingKey[:])
+		}
+		copy(bytes[h:], f.Payload)
+		if f.Masked {
+			for j := 0; j < n; j++ {
+				bytes[h+j] ^= f.MaskingKey[j%4]
+			}
+		}
+		if opts.FixLengths {
+			f.Length = uint64(n)
+		}
+		bytes = bytes[h+n:]
+	}
+	return nil
+}
+
+// headerLength returns the length of f's header, for its payload.
+func (f *WebSocketFrame) headerLength() int {
+	n := 2
+	switch {
+	case len(f.Payload) > 0xffff:
+		n += 8
+	case len(f.Payload) >= 126:
+		n += 2
+	}
+	if f.Masked {
+		n += 4
+	}
+	return n
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func TestWebSocketRFCExamples(t *testing.T) {
+	// RFC 6455 section 5.7: a masked text frame, a fragmented unmasked
+	// text message, and a masked pong, in one payload.
+	data := []byte{
+		0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58,
+		0x01, 0x03, 0x48, 0x65, 0x6c,
+		0x80, 0x02, 0x6c, 0x6f,
+		0x8a, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58,
+	}
+	p := gopacket.NewPacket(data, LayerTypeWebSocket, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	w := p.Layer(LayerTypeWebSocket).(*WebSocket)
+	if len(w.Frames) != 4 {
+		t.Fatalf("got %d frames", len(w.Frames))
+	}
+	if f := w.Frames[0]; !f.Fin || f.Opcode != WebSocketText || !f.Masked || string(f.Payload) != "Hello" {
+		t.Errorf("got %+v", f)
+	}
+	if f := w.Frames[1]; f.Fin || f.Opcode != WebSocketText || string(f.Payload) != "Hel" {
+		t.Errorf("got %+v", f)
+	}
+	if f := w.Frames[2]; !f.Fin || f.Opcode != WebSocketContinuation || string(f.Payload) != "lo" {
+		t.Errorf("got %+v", f)
+	}
+	if f := w.Frames[3]; f.Opcode != WebSocketPong || string(f.Payload) != "Hello" {
+		t.Errorf("got %+v", f)
+	}
+	// Unmasking doesn't modify the packet.
+	if data[6] != 0x7f {
+		t.Error("packet data modified")
+	}
+}
+
+func TestWebSocketLengths(t *testing.T) {
+	for _, n := range []int{0, 125, 256, 65536} {
+		payload := bytes.Repeat([]byte{0xab}, n)
+		in := &WebSocket{Frames: []WebSocketFrame{{Fin: true, Opcode: WebSocketBinary, Masked: n%2 == 0, MaskingKey: [4]byte{1, 2, 3, 4}, Payload: payload}}}
+		buf := gopacket.NewSerializeBuffer()
+		if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, in); err != nil {
+			t.Fatal(err)
+		}
+		var f WebSocketFrame
+		got, err := DecodeWebSocketFrame(&f, buf.Bytes())
+		if err != nil || got != len(buf.Bytes()) {
+			t.Fatalf("%d bytes: decoded %d of %d, %v", n, got, len(buf.Bytes()), err)
+		}
+		if f.Length != uint64(n) || !bytes.Equal(f.Payload, payload) || f.Masked != in.Frames[0].Masked {
+			t.Errorf("%d bytes: got %+v", n, f)
+		}
+		// Every prefix is incomplete.
+		for _, cut := range []int{1, 3, len(buf.Bytes()) - 1} {
+			if cut < len(buf.Bytes()) {
+				if got, err := DecodeWebSocketFrame(&f, buf.Bytes()[:cut]); got != 0 || err != nil {
+					t.Errorf("%d bytes cut at %d: got %d, %v", n, cut, got, err)
+				}
+			}
+		}
+	}
+}
+
+func TestWebSocketClose(t *testing.T) {
+	data := []byte{0x88, 0x06, 0x03, 0xe8, 'b', 'y', 'e', '!'}
+	p := gopacket.NewPacket(data, LayerTypeWebSocket, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	if f := p.Layer(LayerTypeWebSocket).(*WebSocket).Frames[0]; f.CloseCode != 1000 || f.CloseReason != "bye!" {
+		t.Errorf("got %+v", f)
+	}
+	// Control frames can't be fragmented.
+	p = gopacket.NewPacket([]byte{0x09, 0x00}, LayerTypeWebSocket, gopacket.Default)
+	if p.ErrorLayer() == nil {
+		t.Error("fragmented ping decoded")
+	}
+}
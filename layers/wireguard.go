@@ -0,0 +1,210 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mistsys/gopacket"
+)
+
+// WireGuardMessageType is the type of a WireGuard message.
+type WireGuardMessageType uint8
+
+const (
+	WireGuardHandshakeInitiation WireGuardMessageType = 1
+	WireGuardHandshakeResponse   WireGuardMessageType = 2
+	WireGuardCookieReply         WireGuardMessageType = 3
+	WireGuardTransportData       WireGuardMessageType = 4
+)
+
+func (t WireGuardMessageType) String() string {
+	switch t {
+	case WireGuardHandshakeInitiation:
+		return "Handshake Initiation"
+	case WireGuardHandshakeResponse:
+		return "Handshake Response"
+	case WireGuardCookieReply:
+		return "Cookie Reply"
+	case WireGuardTransportData:
+		return "Transport Data"
+	default:
+		return fmt.Sprintf("UnknownWireGuardMessageType(%d)", uint8(t))
+	}
+}
+
+// Lengths of WireGuard messages.  Transport data messages are at least
+// WireGuardTransportMinLength long, for an empty keepalive.
+const (
+	WireGuardHandshakeInitiationLength = 148
+	WireGuardHandshakeResponseLength   = 92
+	WireGuardCookieReplyLength         = 64
+	WireGuardTransportMinLength        = 32
+)
+
+// WireGuard is a WireGuard message, on UDP port 51820 by default.
+//
+// The fields set depend on Type.  SenderIndex is set for handshake
+// messages, and ReceiverIndex for all but the initiation.  MAC1 and MAC2
+// end the handshake messages, and MAC2 is zero unless the sender is
+// under load and was sent a cookie.  The Encrypted fields are AEAD
+// ciphertexts including their 16 byte tag.  Integers are little endian
+// on the wire.
+type WireGuard struct {
+	BaseLayer
+	Type          WireGuardMessageType
+	SenderIndex   uint32
+	ReceiverIndex uint32
+	// Ephemeral is the sender's ephemeral public key, in handshake
+	// messages.
+	Ephemeral []byte
+	// EncryptedStatic and EncryptedTimestamp are set in handshake
+	// initiations, and EncryptedNothing in responses.
+	EncryptedStatic    []byte
+	EncryptedTimestamp []byte
+	EncryptedNothing   []byte
+	MAC1, MAC2         []byte
+	// Nonce and EncryptedCookie are set in cookie replies.
+	Nonce           []byte
+	EncryptedCookie []byte
+	// Counter and EncryptedPacket are set in transport data messages.
+	// An EncryptedPacket of only the tag is a keepalive.
+	Counter         uint64
+	EncryptedPacket []byte
+}
+
+// LayerType returns LayerTypeWireGuard.
+func (w *WireGuard) LayerType() gopacket.LayerType { return LayerTypeWireGuard }
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (w *WireGuard) CanDecode() gopacket.LayerClass { return LayerTypeWireGuard }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (w *WireGuard) NextLayerType() gopacket.LayerType { return gopacket.LayerTypeZero }
+
+// IsKeepalive reports whether w is a transport data message carrying no
+// packet.
+func (w *WireGuard) IsKeepalive() bool {
+	return w.Type == WireGuardTransportData && len(w.EncryptedPacket) == 16
+}
+
+func decodeWireGuard(data []byte, p gopacket.PacketBuilder) error {
+	return decodingLayerDecoder(&WireGuard{}, data, p)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (w *WireGuard) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 4 {
+		df.SetTruncated()
+		return fmt.Errorf("WireGuard length %d too short", len(data))
+	}
+	if data[1] != 0 || data[2] != 0 || data[3] != 0 {
+		return fmt.Errorf("WireGuard reserved bytes %x not zero", data[1:4])
+	}
+	*w = WireGuard{Type: WireGuardMessageType(data[0])}
+	want := 0
+	switch w.Type {
+	case WireGuardHandshakeInitiation:
+		want = WireGuardHandshakeInitiationLength
+	case WireGuardHandshakeResponse:
+		want = WireGuardHandshakeResponseLength
+	case WireGuardCookieReply:
+		want = WireGuardCookieReplyLength
+	case WireGuardTransportData:
+		if len(data) < WireGuardTransportMinLength {
+			df.SetTruncated()
+			return fmt.Errorf("WireGuard transport data length %d too short", len(data))
+		}
+		w.ReceiverIndex = binary.LittleEndian.Uint32(data[4:8])
+		w.Counter = binary.LittleEndian.Uint64(data[8:16])
+		w.EncryptedPacket = data[16:]
+		w.BaseLayer = BaseLayer{Contents: data}
+		return nil
+	default:
+		return fmt.Errorf("unknown WireGuard message type %d", data[0])
+	}
+	if len(data) < want {
+		df.SetTruncated()
+		return fmt.Errorf("WireGuard %v length %d too short", w.Type, len(data))
+	} else if len(data) > want {
+		return fmt.Errorf("WireGuard %v length %d too long", w.Type, len(data))
+	}
+	switch w.Type {
+	case WireGuardHandshakeInitiation:
+		w.SenderIndex = binary.LittleEndian.Uint32(data[4:8])
+		w.Ephemeral = data[8:40]
+		w.EncryptedStatic = data[40:88]
+		w.EncryptedTimestamp = data[88:116]
+		w.MAC1, w.MAC2 = data[116:132], data[132:148]
+	case WireGuardHandshakeResponse:
+		w.SenderIndex = binary.LittleEndian.Uint32(data[4:8])
+		w.ReceiverIndex = binary.LittleEndian.Uint32(data[8:12])
+		w.Ephemeral = data[12:44]
+		w.EncryptedNothing = data[44:60]
+		w.MAC1, w.MAC2 = data[60:76], data[76:92]
+	case WireGuardCookieReply:
+		w.ReceiverIndex = binary.LittleEndian.Uint32(data[4:8])
+		w.Nonce = data[8:32]
+		w.EncryptedCookie = data[32:64]
+	}
+	w.BaseLayer = BaseLayer{Contents: data}
+	return nil
+}
+
+// SerializeTo writes the serialized form of this layer into the
+// SerializationBuffer, implementing gopacket.SerializableLayer.  Byte
+// fields shorter than their place in the message are zero padded.
+// See the docs for gopacket.SerializableLayer for more info.
+func (w *WireGuard) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	var n int
+	switch w.Type {
+	case WireGuardHandshakeInitiation:
+		n = WireGuardHandshakeInitiationLength
+	case WireGuardHandshakeResponse:
+		n = WireGuardHandshakeResponseLength
+	case WireGuardCookieReply:
+		n = WireGuardCookieReplyLength
+	case WireGuardTransportData:
+		n = 16 + len(w.EncryptedPacket)
+	default:
+		return fmt.Errorf("unknown WireGuard message type %d", w.Type)
+	}
+	bytes, err := b.PrependBytes(n)
+	if err != nil {
+		return err
+	}
+	for i := range bytes {
+		bytes[i] = 0
+	}
+	bytes[0] = uint8(w.Type)
+	switch w.Type {
+	case WireGuardHandshakeInitiation:
+		binary.LittleEndian.PutUint32(bytes[4:8], w.SenderIndex)
+		copy(bytes[8:40], w.Ephemeral)
+		copy(bytes[40:88], w.EncryptedStatic)
+		copy(bytes[88:116], w.EncryptedTimestamp)
+		copy(bytes[116:132], w.MAC1)
+		copy(bytes[132:148], w.MAC2)
+	case WireGuardHandshakeResponse:
+		binary.LittleEndian.PutUint32(bytes[4:8], w.SenderIndex)
+		binary.LittleEndian.PutUint32(bytes[8:12], w.ReceiverIndex)
+		copy(bytes[12:44], w.Ephemeral)
+		copy(bytes[44:60], w.EncryptedNothing)
+		copy(bytes[60:76], w.MAC1)
+		copy(bytes[76:92], w.MAC2)
+	case WireGuardCookieReply:
+		binary.LittleEndian.PutUint32(bytes[4:8], w.ReceiverIndex)
+		copy(bytes[8:32], w.Nonce)
+		copy(bytes[32:64], w.EncryptedCookie)
+	case WireGuardTransportData:
+		binary.LittleEndian.PutUint32(bytes[4:8], w.ReceiverIndex)
+		binary.LittleEndian.PutUint64(bytes[8:16], w.Counter)
+		copy(bytes[16:], w.EncryptedPacket)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package layers
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+)
+
+func serializeWireGuard(t *testing.T, wg *WireGuard) gopacket.Packet {
+	ip := &IPv4{Version: 4, TTL: 64, Protocol: IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &UDP{SrcPort: 40000, DstPort: 51820}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ip, udp, wg); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), LayerTypeIPv4, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	checkLayers(p, []gopacket.LayerType{LayerTypeIPv4, LayerTypeUDP, LayerTypeWireGuard}, t)
+	return p
+}
+
+func TestWireGuardHandshake(t *testing.T) {
+	p := serializeWireGuard(t, &WireGuard{
+		Type:               WireGuardHandshakeInitiation,
+		SenderIndex:        0x11223344,
+		Ephemeral:          repeatByte(0xe1, 32),
+		EncryptedStatic:    repeatByte(0x51, 48),
+		EncryptedTimestamp: repeatByte(0x7a, 28),
+		MAC1:               repeatByte(0x01, 16),
+	})
+	wg := p.Layer(LayerTypeWireGuard).(*WireGuard)
+	if len(wg.Contents) != WireGuardHandshakeInitiationLength || wg.Contents[4] != 0x44 {
+		t.Errorf("got contents %x", wg.Contents)
+	}
+	if wg.SenderIndex != 0x11223344 || !bytes.Equal(wg.Ephemeral, repeatByte(0xe1, 32)) ||
+		!bytes.Equal(wg.EncryptedStatic, repeatByte(0x51, 48)) || !bytes.Equal(wg.EncryptedTimestamp, repeatByte(0x7a, 28)) ||
+		!bytes.Equal(wg.MAC1, repeatByte(0x01, 16)) || !bytes.Equal(wg.MAC2, make([]byte, 16)) {
+		t.Errorf("got initiation %+v", wg)
+	}
+
+	p = serializeWireGuard(t, &WireGuard{
+		Type:             WireGuardHandshakeResponse,
+		SenderIndex:      5,
+		ReceiverIndex:    0x11223344,
+		Ephemeral:        repeatByte(0xe2, 32),
+		EncryptedNothing: repeatByte(0x4e, 16),
+		MAC1:             repeatByte(0x02, 16),
+		MAC2:             repeatByte(0x03, 16),
+	})
+	wg = p.Layer(LayerTypeWireGuard).(*WireGuard)
+	if wg.SenderIndex != 5 || wg.ReceiverIndex != 0x11223344 || !bytes.Equal(wg.EncryptedNothing, repeatByte(0x4e, 16)) ||
+		!bytes.Equal(wg.MAC2, repeatByte(0x03, 16)) {
+		t.Errorf("got response %+v", wg)
+	}
+
+	p = serializeWireGuard(t, &WireGuard{Type: WireGuardCookieReply, ReceiverIndex: 5, Nonce: repeatByte(0x6e, 24), EncryptedCookie: repeatByte(0xcc, 32)})
+	wg = p.Layer(LayerTypeWireGuard).(*WireGuard)
+	if wg.ReceiverIndex != 5 || !bytes.Equal(wg.Nonce, repeatByte(0x6e, 24)) || !bytes.Equal(wg.EncryptedCookie, repeatByte(0xcc, 32)) {
+		t.Errorf("got cookie reply %+v", wg)
+	}
+}
+
+func TestWireGuardTransport(t *testing.T) {
+	p := serializeWireGuard(t, &WireGuard{Type: WireGuardTransportData, ReceiverIndex: 7, Counter: 0x0102030405, EncryptedPacket: repeatByte(0xdd, 80)})
+	wg := p.Layer(LayerTypeWireGuard).(*WireGuard)
+	if wg.ReceiverIndex != 7 || wg.Counter != 0x0102030405 || len(wg.EncryptedPacket) != 80 || wg.IsKeepalive() {
+		t.Errorf("got transport data %+v", wg)
+	}
+	p = serializeWireGuard(t, &WireGuard{Type: WireGuardTransportData, ReceiverIndex: 7, Counter: 1, EncryptedPacket: repeatByte(0xdd, 16)})
+	if wg := p.Layer(LayerTypeWireGuard).(*WireGuard); !wg.IsKeepalive() {
+		t.Errorf("keepalive not recognized: %+v", wg)
+	}
+}
+
+func TestWireGuardInvalid(t *testing.T) {
+	for _, data := range [][]byte{
+		{1, 0, 0, 0, 1, 2, 3},
+		append([]byte{4, 0, 0, 0}, make([]byte, 20)...),
+		append([]byte{3, 1, 0, 0}, make([]byte, 60)...),
+		append([]byte{9, 0, 0, 0}, make([]byte, 60)...),
+		append([]byte{2, 0, 0, 0}, make([]byte, 100)...),
+	} {
+		p := gopacket.NewPacket(data, LayerTypeWireGuard, gopacket.Default)
+		if p.ErrorLayer() == nil {
+			t.Errorf("%x decoded without error", data)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package logexport
+
+import (
+	"fmt"
+	"time"
+)
+
+// TLSRecord describes a TLS session, to be filled in by a TLS analyzer.
+// It's written as a Zeek ssl.log entry or an EVE tls event.
+type TLSRecord struct {
+	ConnID
+	Time time.Time
+	// Version is the negotiated protocol version as sent on the wire, for
+	// example 0x0303 for TLS 1.2.
+	Version     uint16
+	Cipher      string
+	ServerName  string
+	Resumed     bool
+	Established bool
+	// Certificate details of the server's leaf certificate, if seen.
+	Subject, Issuer, Serial string
+	// Fingerprint is the SHA-1 fingerprint of the server's certificate,
+	// as colon separated hex.
+	Fingerprint         string
+	NotBefore, NotAfter time.Time
+	// JA3 and JA3S are the client and server fingerprints, with the
+	// strings they hash.
+	JA3, JA3String   string
+	JA3S, JA3SString string
+}
+
+// tlsVersion returns Zeek's and EVE's names for a TLS or SSL version.
+func tlsVersion(v uint16) (zeek, eve string) {
+	switch v {
+	case 0x0300:
+		return "SSLv3", "SSLv3"
+	case 0x0301:
+		return "TLSv10", "TLS 1.0"
+	case 0x0302:
+		return "TLSv11", "TLS 1.1"
+	case 0x0303:
+		return "TLSv12", "TLS 1.2"
+	case 0x0304:
+		return "TLSv13", "TLS 1.3"
+	case 0:
+		return "", ""
+	}
+	s := fmt.Sprintf("0x%04x", v)
+	return s, s
+}
+
+// HTTPRecord describes an HTTP request and its response, to be filled in by
+// an HTTP analyzer.  It's written as a Zeek http.log entry or an EVE http
+// event.
+type HTTPRecord struct {
+	ConnID
+	Time time.Time
+	// TransDepth is the position of the request in its connection,
+	// starting at 1.
+	TransDepth int
+	Method     string
+	Host       string
+	URI        string
+	Referrer   string
+	// Version is the HTTP version without the "HTTP/" prefix, such as
+	// "1.1".
+	Version     string
+	UserAgent   string
+	ContentType string
+	// RequestBodyLen and ResponseBodyLen are the body sizes in bytes.
+	RequestBodyLen, ResponseBodyLen uint64
+	StatusCode                      int
+	StatusMsg                       string
+}
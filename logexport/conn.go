@@ -0,0 +1,462 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package logexport writes what gopacket sees in the log formats security
+// operations tooling already consumes: Zeek (conn.log, dns.log, ssl.log,
+// http.log, as TSV or JSON) and Suricata EVE JSON (flow, dns, tls and http
+// events).
+//
+// A ConnTracker follows connections and assigns each one the identifiers
+// both formats use to tie records together: a Zeek uid and an EVE flow_id.
+// Analyzers build records for the connection a packet belongs to; this
+// package provides a DNS analyzer, and TLSRecord and HTTPRecord for TLS and
+// HTTP analyzers to fill in.  Every record can be written with a
+// ZeekWriter or an EVEWriter.
+//
+// Usage:
+//
+//	conns := logexport.NewConnTracker()
+//	dns := logexport.NewDNSAnalyzer()
+//	connLog := logexport.NewZeekWriter(connFile, logexport.ZeekTSV)
+//	eve := logexport.NewEVEWriter(eveFile)
+//	for p := range source.Packets() {
+//	  c := conns.Add(p)
+//	  if c == nil {
+//	    continue
+//	  }
+//	  if d := dns.Add(p, c); d != nil {
+//	    eve.Write(d)
+//	  }
+//	  for _, done := range conns.Expire(p.Metadata().Timestamp.Add(-time.Minute)) {
+//	    connLog.Write(done)
+//	    eve.Write(done)
+//	  }
+//	}
+package logexport
+
+import (
+	"net"
+	"sort"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// ConnID identifies the connection a record belongs to, as the uid and id
+// fields of Zeek logs and the flow_id and address fields of EVE events.
+// The originator is the host that started the connection.
+type ConnID struct {
+	UID    string
+	FlowID uint64
+	OrigH  net.IP
+	OrigP  uint16
+	RespH  net.IP
+	RespP  uint16
+	// For ICMP, OrigP is the originator's message type and RespP its code,
+	// or for requests and replies such as echo, the counterpart's type.
+	// Proto is "tcp", "udp" or "icmp".
+	Proto string
+	// Source is where the connection's first packet was captured.
+	Source gopacket.CaptureSource
+}
+
+// Conn is a connection summary, the equivalent of a Zeek conn.log entry or
+// an EVE flow event.
+type Conn struct {
+	ConnID
+	Start, End time.Time
+	// Service is the application protocol, if one was decoded.
+	Service string
+	// OrigBytes and RespBytes count transport payload bytes, OrigIPBytes
+	// and RespIPBytes whole IP packets.
+	OrigBytes, RespBytes     uint64
+	OrigPkts, RespPkts       uint64
+	OrigIPBytes, RespIPBytes uint64
+	// History is Zeek's connection history: a letter for the first time
+	// each of SYN (s), SYN-ACK (h), pure ACK (a), data (d), FIN (f) and RST
+	// (r) is seen, upper case from the originator and lower case from the
+	// responder.
+	History string
+	// OrigDirection is the direction, relative to the capturing host, of
+	// packets sent by the originator, as recorded by host-based captures.
+	// Outbound means the originator is the local host.
+	OrigDirection gopacket.CaptureDirection
+
+	origSYN, origFIN, origRST bool
+	respSYN, respFIN, respRST bool
+	seen                      map[byte]bool
+}
+
+// Duration returns how long the connection lasted.
+func (c *Conn) Duration() time.Duration { return c.End.Sub(c.Start) }
+
+// State returns the Zeek conn_state of the connection, such as S0 (no
+// reply to a connection attempt), SF (normal establishment and
+// termination) or REJ (connection attempt rejected).
+func (c *Conn) State() string {
+	if c.Proto != "tcp" {
+		if c.RespPkts == 0 {
+			return "S0"
+		}
+		return "SF"
+	}
+	switch {
+	case !c.origSYN && !c.respSYN:
+		return "OTH"
+	case c.origSYN && !c.respSYN:
+		switch {
+		case c.respRST:
+			return "REJ"
+		case c.origRST:
+			return "RSTOS0"
+		case c.origFIN:
+			return "SH"
+		}
+		return "S0"
+	case !c.origSYN:
+		switch {
+		case c.respRST:
+			return "RSTRH"
+		case c.respFIN:
+			return "SHR"
+		}
+		return "OTH"
+	}
+	switch {
+	case c.origRST:
+		return "RSTO"
+	case c.respRST:
+		return "RSTR"
+	case c.origFIN && c.respFIN:
+		return "SF"
+	case c.origFIN:
+		return "S2"
+	case c.respFIN:
+		return "S3"
+	}
+	return "S1"
+}
+
+// Services maps the application layer types this package recognizes to
+// the service names used in Zeek and EVE logs.
+var Services = map[gopacket.LayerType]string{
+	layers.LayerTypeDNS:        "dns",
+	layers.LayerTypeMDNS:       "dns",
+	layers.LayerTypeLLMNR:      "dns",
+	layers.LayerTypeNTP:        "ntp",
+	layers.LayerTypeNTPControl: "ntp",
+	layers.LayerTypeNTPPrivate: "ntp",
+	layers.LayerTypePTP:        "ptp",
+	layers.LayerTypeSyslog:     "syslog",
+	layers.LayerTypeRADIUS:     "radius",
+	layers.LayerTypeKerberos:   "kerberos",
+	layers.LayerTypeTACACSPlus: "tacacs",
+	layers.LayerTypeSIP:        "sip",
+	layers.LayerTypeRTP:        "rtp",
+	layers.LayerTypeRTCP:       "rtcp",
+	layers.LayerTypeRTSP:       "rtsp",
+	layers.LayerTypeSTUN:       "stun",
+	layers.LayerTypeCoAP:       "coap",
+	layers.LayerTypeAMQP091:    "amqp",
+	layers.LayerTypeAMQP10:     "amqp",
+	layers.LayerTypeSSDP:       "ssdp",
+	layers.LayerTypeDHCPv4:     "dhcp",
+	layers.LayerTypeDHCPv6:     "dhcp",
+	layers.LayerTypeVXLAN:      "vxlan",
+	layers.LayerTypeGTPv1U:     "gtpv1",
+	layers.LayerTypeGTPv2C:     "gtpv2",
+	layers.LayerTypeL2TP:       "l2tp",
+	layers.LayerTypeSFlow:      "sflow",
+}
+
+type connKey struct {
+	network, transport gopacket.Flow
+	proto              layers.IPProtocol
+	// id is the identifier of ICMP echo, timestamp and information
+	// messages, which tells apart concurrent exchanges between two hosts.
+	id uint16
+}
+
+// ConnTracker follows connections.  It is not safe for concurrent use.
+type ConnTracker struct {
+	conns  map[connKey]*Conn
+	nextID uint64
+}
+
+// NewConnTracker creates an empty ConnTracker.
+func NewConnTracker() *ConnTracker {
+	return &ConnTracker{conns: map[connKey]*Conn{}}
+}
+
+// Add counts p against its connection, creating it if needed, and returns
+// it.  It returns nil for packets that aren't TCP, UDP or ICMP over IP.
+func (t *ConnTracker) Add(p gopacket.Packet) *Conn {
+	nl := p.NetworkLayer()
+	var src, dst net.IP
+	var ipLen int
+	switch ip := nl.(type) {
+	case *layers.IPv4:
+		src, dst, ipLen = ip.SrcIP, ip.DstIP, int(ip.Length)
+	case *layers.IPv6:
+		src, dst, ipLen = ip.SrcIP, ip.DstIP, len(ip.Contents)+len(ip.Payload)
+	default:
+		return nil
+	}
+	var sport, dport, id uint16
+	var proto layers.IPProtocol
+	var name string
+	var tcp *layers.TCP
+	var payload int
+	switch l := p.TransportLayer().(type) {
+	case *layers.TCP:
+		sport, dport, proto, name, tcp, payload = uint16(l.SrcPort), uint16(l.DstPort), layers.IPProtocolTCP, "tcp", l, len(l.Payload)
+	case *layers.UDP:
+		sport, dport, proto, name, payload = uint16(l.SrcPort), uint16(l.DstPort), layers.IPProtocolUDP, "udp", len(l.Payload)
+	default:
+		// Zeek reports ICMP type and code in place of the ports.
+		var typ, code uint8
+		if icmp, ok := p.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4); ok {
+			typ, code, proto, payload = icmp.TypeCode.Type(), icmp.TypeCode.Code(), layers.IPProtocolICMPv4, len(icmp.Payload)
+			switch typ {
+			case layers.ICMPv4TypeEchoRequest, layers.ICMPv4TypeEchoReply,
+				layers.ICMPv4TypeTimestampRequest, layers.ICMPv4TypeTimestampReply,
+				layers.ICMPv4TypeInfoRequest, layers.ICMPv4TypeInfoReply:
+				id = icmp.Id
+			}
+		} else if icmp, ok := p.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6); ok {
+			// Echo and neighbor discovery messages leave the last 4 bytes
+			// of the 8 byte header to the layer following ICMPv6.
+			typ, code, proto, payload = icmp.TypeCode.Type(), icmp.TypeCode.Code(), layers.IPProtocolICMPv6, len(icmp.Contents)+len(icmp.Payload)-8
+			if payload < 0 {
+				payload = 0
+			}
+			if echo, ok := p.Layer(layers.LayerTypeICMPv6Echo).(*layers.ICMPv6Echo); ok {
+				id = echo.Identifier
+			}
+		} else {
+			return nil
+		}
+		sport, dport, name = uint16(typ), uint16(code), "icmp"
+		if reply, ok := icmpCounterpart(proto, typ, code); ok {
+			// As in Zeek, the responder's port of a request or reply is
+			// its counterpart's type, so a reply's key is the reverse of
+			// its request's.
+			dport = uint16(reply)
+		}
+	}
+	ts := p.Metadata().Timestamp
+
+	k := connKey{nl.NetworkFlow(), portFlow(sport, dport), proto, id}
+	fromOrig := true
+	c := t.conns[k]
+	if c == nil && (name != "icmp" || icmpPaired(proto, sport, dport)) {
+		if c = t.conns[connKey{k.network.Reverse(), k.transport.Reverse(), proto, id}]; c != nil {
+			fromOrig = false
+		}
+	}
+	if c == nil {
+		// A SYN-ACK without a SYN is the responder's half of a handshake
+		// we missed.
+		if tcp != nil && tcp.SYN && tcp.ACK {
+			c = t.newConn(connKey{k.network.Reverse(), k.transport.Reverse(), proto, id}, name, dst, src, dport, sport, ts)
+			fromOrig = false
+		} else {
+			c = t.newConn(k, name, src, dst, sport, dport, ts)
+		}
+		c.Source = p.Metadata().Source
+	}
+	c.End = ts
+	if c.OrigDirection == gopacket.DirectionUnknown {
+		switch dir := p.Metadata().Direction; {
+		case fromOrig:
+			c.OrigDirection = dir
+		case dir == gopacket.DirectionInbound:
+			c.OrigDirection = gopacket.DirectionOutbound
+		case dir == gopacket.DirectionOutbound:
+			c.OrigDirection = gopacket.DirectionInbound
+		}
+	}
+	if fromOrig {
+		c.OrigPkts++
+		c.OrigBytes += uint64(payload)
+		c.OrigIPBytes += uint64(ipLen)
+	} else {
+		c.RespPkts++
+		c.RespBytes += uint64(payload)
+		c.RespIPBytes += uint64(ipLen)
+	}
+	if tcp != nil {
+		c.addTCP(tcp, fromOrig)
+	}
+	if c.Service == "" {
+		for _, l := range p.Layers() {
+			if s, ok := Services[l.LayerType()]; ok {
+				c.Service = s
+				break
+			}
+		}
+	}
+	return c
+}
+
+// icmpCounterpart returns the reply type of an ICMP request, or the
+// request type of a reply, for the types Zeek pairs into one connection.
+func icmpCounterpart(proto layers.IPProtocol, typ, code uint8) (uint8, bool) {
+	if code != 0 {
+		return 0, false
+	}
+	var pairs [][2]uint8
+	if proto == layers.IPProtocolICMPv4 {
+		pairs = [][2]uint8{
+			{layers.ICMPv4TypeEchoRequest, layers.ICMPv4TypeEchoReply},
+			{layers.ICMPv4TypeRouterSolicitation, layers.ICMPv4TypeRouterAdvertisement},
+			{layers.ICMPv4TypeTimestampRequest, layers.ICMPv4TypeTimestampReply},
+			{layers.ICMPv4TypeInfoRequest, layers.ICMPv4TypeInfoReply},
+			{layers.ICMPv4TypeAddressMaskRequest, layers.ICMPv4TypeAddressMaskReply},
+		}
+	} else {
+		pairs = [][2]uint8{
+			{layers.ICMPv6TypeEchoRequest, layers.ICMPv6TypeEchoReply},
+			{layers.ICMPv6TypeRouterSolicitation, layers.ICMPv6TypeRouterAdvertisement},
+			{layers.ICMPv6TypeNeighborSolicitation, layers.ICMPv6TypeNeighborAdvertisement},
+		}
+	}
+	for _, pair := range pairs {
+		switch typ {
+		case pair[0]:
+			return pair[1], true
+		case pair[1]:
+			return pair[0], true
+		}
+	}
+	return 0, false
+}
+
+// icmpPaired returns true if sport and dport, an ICMP message's type and
+// the port icmpCounterpart gave it, are a request and its reply.
+func icmpPaired(proto layers.IPProtocol, sport, dport uint16) bool {
+	reply, ok := icmpCounterpart(proto, uint8(sport), 0)
+	return ok && uint16(reply) == dport
+}
+
+func portFlow(src, dst uint16) gopacket.Flow {
+	return gopacket.NewFlow(layers.EndpointUDPPort, []byte{byte(src >> 8), byte(src)}, []byte{byte(dst >> 8), byte(dst)})
+}
+
+func (t *ConnTracker) newConn(k connKey, name string, src, dst net.IP, sport, dport uint16, ts time.Time) *Conn {
+	t.nextID++
+	id := mix64(t.nextID)
+	c := &Conn{
+		ConnID: ConnID{
+			UID: zeekUID(id),
+			// EVE flow IDs must survive a round trip through a float64.
+			FlowID: id & (1<<51 - 1),
+			OrigH:  src,
+			OrigP:  sport,
+			RespH:  dst,
+			RespP:  dport,
+			Proto:  name,
+		},
+		Start: ts,
+		seen:  map[byte]bool{},
+	}
+	t.conns[k] = c
+	return c
+}
+
+func (c *Conn) addTCP(tcp *layers.TCP, fromOrig bool) {
+	var letter byte
+	switch {
+	case tcp.RST:
+		letter = 'r'
+	case tcp.SYN && tcp.ACK:
+		letter = 'h'
+	case tcp.SYN:
+		letter = 's'
+	case tcp.FIN:
+		letter = 'f'
+	case len(tcp.Payload) > 0:
+		letter = 'd'
+	case tcp.ACK:
+		letter = 'a'
+	}
+	if fromOrig {
+		c.origSYN = c.origSYN || tcp.SYN
+		c.origFIN = c.origFIN || tcp.FIN
+		c.origRST = c.origRST || tcp.RST
+		if letter != 0 {
+			letter -= 'a' - 'A'
+		}
+	} else {
+		c.respSYN = c.respSYN || tcp.SYN
+		c.respFIN = c.respFIN || tcp.FIN
+		c.respRST = c.respRST || tcp.RST
+	}
+	if letter != 0 && !c.seen[letter] {
+		c.seen[letter] = true
+		c.History += string(letter)
+	}
+}
+
+// Expire removes and returns every connection with no packets since t, in
+// the order they started.
+func (t *ConnTracker) Expire(before time.Time) []*Conn {
+	var done []*Conn
+	for k, c := range t.conns {
+		if c.End.Before(before) {
+			done = append(done, c)
+			delete(t.conns, k)
+		}
+	}
+	sortConns(done)
+	return done
+}
+
+// Flush removes and returns every connection, in the order they started.
+func (t *ConnTracker) Flush() []*Conn {
+	done := make([]*Conn, 0, len(t.conns))
+	for _, c := range t.conns {
+		done = append(done, c)
+	}
+	t.conns = map[connKey]*Conn{}
+	sortConns(done)
+	return done
+}
+
+type byStart []*Conn
+
+func (b byStart) Len() int      { return len(b) }
+func (b byStart) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byStart) Less(i, j int) bool {
+	if !b[i].Start.Equal(b[j].Start) {
+		return b[i].Start.Before(b[j].Start)
+	}
+	return b[i].FlowID < b[j].FlowID
+}
+
+func sortConns(c []*Conn) { sort.Sort(byStart(c)) }
+
+// mix64 is the splitmix64 finalizer, spreading sequential IDs over the
+// whole 64 bit space so that uids look like Zeek's.
+func mix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// zeekUID formats id like a Zeek connection uid: C followed by base62.
+func zeekUID(id uint64) string {
+	b := []byte{'C'}
+	for id > 0 {
+		b = append(b, base62[id%62])
+		id /= 62
+	}
+	return string(b)
+}
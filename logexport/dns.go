@@ -0,0 +1,206 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package logexport
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// DNSAnswer is one answer of a DNS response.
+type DNSAnswer struct {
+	Name string
+	Type layers.DNSType
+	TTL  time.Duration
+	// Data is the answer's RDATA in text form, such as an address or a
+	// name.
+	Data string
+}
+
+// DNSRecord is a DNS transaction: a query and, if one was seen, its
+// response.  It's written as a Zeek dns.log entry or EVE dns query and
+// answer events.
+type DNSRecord struct {
+	ConnID
+	// Time is when the query was sent, or when the response was seen if
+	// the query wasn't.
+	Time    time.Time
+	TransID uint16
+	// RTT is the time between query and response, or 0 if either is
+	// missing.
+	RTT    time.Duration
+	Query  string
+	QClass layers.DNSClass
+	QType  layers.DNSType
+	// Responded is true once the response has been seen.  The remaining
+	// fields come from the response.
+	Responded      bool
+	RCode          layers.DNSResponseCode
+	AA, TC, RD, RA bool
+	Z              uint8
+	Answers        []DNSAnswer
+
+	querySeen bool
+}
+
+type dnsKey struct {
+	uid string
+	id  uint16
+}
+
+// DNSAnalyzer pairs DNS queries with their responses.  It is not safe for
+// concurrent use.
+type DNSAnalyzer struct {
+	pending map[dnsKey]*DNSRecord
+}
+
+// NewDNSAnalyzer creates an empty DNSAnalyzer.
+func NewDNSAnalyzer() *DNSAnalyzer {
+	return &DNSAnalyzer{pending: map[dnsKey]*DNSRecord{}}
+}
+
+// Add processes p, which belongs to connection c.  It returns the finished
+// transaction when p is a DNS response, and nil otherwise.
+func (a *DNSAnalyzer) Add(p gopacket.Packet, c *Conn) *DNSRecord {
+	dns, ok := p.Layer(layers.LayerTypeDNS).(*layers.DNS)
+	if !ok || c == nil {
+		return nil
+	}
+	ts := p.Metadata().Timestamp
+	k := dnsKey{c.UID, dns.ID}
+	if !dns.QR {
+		r := &DNSRecord{ConnID: c.ConnID, Time: ts, TransID: dns.ID, RD: dns.RD, querySeen: true}
+		r.setQuestion(dns)
+		a.pending[k] = r
+		return nil
+	}
+	r := a.pending[k]
+	delete(a.pending, k)
+	if r == nil {
+		r = &DNSRecord{ConnID: c.ConnID, Time: ts, TransID: dns.ID}
+	} else {
+		r.RTT = ts.Sub(r.Time)
+	}
+	r.setQuestion(dns)
+	r.Responded = true
+	r.RCode = dns.ResponseCode
+	r.AA, r.TC, r.RD, r.RA, r.Z = dns.AA, dns.TC, dns.RD, dns.RA, dns.Z
+	for i := range dns.Answers {
+		rr := &dns.Answers[i]
+		r.Answers = append(r.Answers, DNSAnswer{
+			Name: string(rr.Name),
+			Type: rr.Type,
+			TTL:  time.Duration(rr.TTL) * time.Second,
+			Data: rdata(rr),
+		})
+	}
+	return r
+}
+
+func (r *DNSRecord) setQuestion(dns *layers.DNS) {
+	if len(dns.Questions) > 0 {
+		q := dns.Questions[0]
+		r.Query, r.QClass, r.QType = string(q.Name), q.Class, q.Type
+	}
+}
+
+// Expire removes and returns the unanswered queries sent before t.
+func (a *DNSAnalyzer) Expire(t time.Time) []*DNSRecord {
+	var done []*DNSRecord
+	for k, r := range a.pending {
+		if r.Time.Before(t) {
+			done = append(done, r)
+			delete(a.pending, k)
+		}
+	}
+	return done
+}
+
+func rdata(rr *layers.DNSResourceRecord) string {
+	switch rr.Type {
+	case layers.DNSTypeA, layers.DNSTypeAAAA:
+		return rr.IP.String()
+	case layers.DNSTypeNS:
+		return string(rr.NS)
+	case layers.DNSTypeCNAME:
+		return string(rr.CNAME)
+	case layers.DNSTypePTR:
+		return string(rr.PTR)
+	case layers.DNSTypeMX:
+		return string(rr.MX.Name)
+	case layers.DNSTypeSRV:
+		return string(rr.SRV.Name)
+	case layers.DNSTypeSOA:
+		return string(rr.SOA.MName)
+	case layers.DNSTypeTXT:
+		txts := make([]string, len(rr.TXTs))
+		for i, t := range rr.TXTs {
+			txts[i] = string(t)
+		}
+		return strings.Join(txts, " ")
+	}
+	return fmt.Sprintf("<%s>", dnsTypeName(rr.Type))
+}
+
+var dnsTypeNames = map[layers.DNSType]string{
+	layers.DNSTypeA:     "A",
+	layers.DNSTypeNS:    "NS",
+	layers.DNSTypeCNAME: "CNAME",
+	layers.DNSTypeSOA:   "SOA",
+	layers.DNSTypePTR:   "PTR",
+	layers.DNSTypeHINFO: "HINFO",
+	layers.DNSTypeMX:    "MX",
+	layers.DNSTypeTXT:   "TXT",
+	layers.DNSTypeAAAA:  "AAAA",
+	layers.DNSTypeSRV:   "SRV",
+}
+
+func dnsTypeName(t layers.DNSType) string {
+	if n, ok := dnsTypeNames[t]; ok {
+		return n
+	}
+	return fmt.Sprintf("TYPE%d", uint16(t))
+}
+
+var dnsRCodeNames = map[layers.DNSResponseCode]string{
+	layers.DNSResponseCodeNoErr:    "NOERROR",
+	layers.DNSResponseCodeFormErr:  "FORMERR",
+	layers.DNSResponseCodeServFail: "SERVFAIL",
+	layers.DNSResponseCodeNXDomain: "NXDOMAIN",
+	layers.DNSResponseCodeNotImp:   "NOTIMP",
+	layers.DNSResponseCodeRefused:  "REFUSED",
+	layers.DNSResponseCodeYXDomain: "YXDOMAIN",
+	layers.DNSResponseCodeYXRRSet:  "YXRRSET",
+	layers.DNSResponseCodeNXRRSet:  "NXRRSET",
+	layers.DNSResponseCodeNotAuth:  "NOTAUTH",
+	layers.DNSResponseCodeNotZone:  "NOTZONE",
+}
+
+func dnsRCodeName(c layers.DNSResponseCode) string {
+	if n, ok := dnsRCodeNames[c]; ok {
+		return n
+	}
+	return fmt.Sprintf("RCODE%d", uint8(c))
+}
+
+func dnsClassName(c layers.DNSClass) string {
+	switch c {
+	case layers.DNSClassIN:
+		return "C_INTERNET"
+	case layers.DNSClassCH:
+		return "C_CHAOS"
+	case layers.DNSClassHS:
+		return "C_HESIOD"
+	case layers.DNSClassAny:
+		return "C_ANY"
+	}
+	return fmt.Sprintf("C_%d", uint16(c))
+}
@@ -0,0 +1,321 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package logexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mistsys/gopacket/layers"
+)
+
+// EVEEvent is a Suricata EVE JSON event.  Exactly one of Flow, DNS, TLS and
+// HTTP is set, matching EventType.
+type EVEEvent struct {
+	Timestamp time.Time `json:"-"`
+	FlowID    uint64    `json:"flow_id,omitempty"`
+	EventType string    `json:"event_type"`
+	SrcIP     string    `json:"src_ip"`
+	SrcPort   uint16    `json:"src_port,omitempty"`
+	DestIP    string    `json:"dest_ip"`
+	DestPort  uint16    `json:"dest_port,omitempty"`
+	Proto     string    `json:"proto"`
+	// ICMPType and ICMPCode are set in place of the ports for ICMP.
+	ICMPType *uint16  `json:"icmp_type,omitempty"`
+	ICMPCode *uint16  `json:"icmp_code,omitempty"`
+	AppProto string   `json:"app_proto,omitempty"`
+	Flow     *EVEFlow `json:"flow,omitempty"`
+	DNS      *EVEDNS  `json:"dns,omitempty"`
+	TLS      *EVETLS  `json:"tls,omitempty"`
+	HTTP     *EVEHTTP `json:"http,omitempty"`
+	// InIface and Host are the capture interface and sensor, from
+	// ConnID.Source.
+	InIface string `json:"in_iface,omitempty"`
+	Host    string `json:"host,omitempty"`
+}
+
+// eveTimeFormat is the timestamp format Suricata uses.
+const eveTimeFormat = "2006-01-02T15:04:05.000000-0700"
+
+// MarshalJSON writes e with its timestamp in Suricata's format.
+func (e *EVEEvent) MarshalJSON() ([]byte, error) {
+	type event EVEEvent
+	return json.Marshal(&struct {
+		Timestamp string `json:"timestamp"`
+		*event
+	}{e.Timestamp.Format(eveTimeFormat), (*event)(e)})
+}
+
+// EVEFlow is the flow object of a flow event.
+type EVEFlow struct {
+	PktsToServer  uint64 `json:"pkts_toserver"`
+	PktsToClient  uint64 `json:"pkts_toclient"`
+	BytesToServer uint64 `json:"bytes_toserver"`
+	BytesToClient uint64 `json:"bytes_toclient"`
+	Start         string `json:"start"`
+	End           string `json:"end"`
+	Age           int64  `json:"age"`
+	// State is "new", "established" or "closed".
+	State  string `json:"state"`
+	Reason string `json:"reason"`
+}
+
+// EVEDNS is the dns object of a dns event, in EVE's version 2 format.
+type EVEDNS struct {
+	Version int    `json:"version,omitempty"`
+	Type    string `json:"type"`
+	ID      uint16 `json:"id"`
+	Flags   string `json:"flags,omitempty"`
+	QR      bool   `json:"qr,omitempty"`
+	AA      bool   `json:"aa,omitempty"`
+	TC      bool   `json:"tc,omitempty"`
+	RD      bool   `json:"rd,omitempty"`
+	RA      bool   `json:"ra,omitempty"`
+	RRName  string `json:"rrname"`
+	RRType  string `json:"rrtype"`
+	RCode   string `json:"rcode,omitempty"`
+	// Answers is set in answer events.
+	Answers []EVEDNSAnswer `json:"answers,omitempty"`
+}
+
+// EVEDNSAnswer is one answer of an EVE dns answer event.
+type EVEDNSAnswer struct {
+	RRName string `json:"rrname"`
+	RRType string `json:"rrtype"`
+	TTL    uint32 `json:"ttl"`
+	RData  string `json:"rdata"`
+}
+
+// EVEJA3 is a JA3 or JA3S fingerprint and the string it hashes.
+type EVEJA3 struct {
+	Hash   string `json:"hash"`
+	String string `json:"string"`
+}
+
+// EVETLS is the tls object of a tls event.
+type EVETLS struct {
+	Subject     string  `json:"subject,omitempty"`
+	IssuerDN    string  `json:"issuerdn,omitempty"`
+	Serial      string  `json:"serial,omitempty"`
+	Fingerprint string  `json:"fingerprint,omitempty"`
+	SNI         string  `json:"sni,omitempty"`
+	Version     string  `json:"version,omitempty"`
+	NotBefore   string  `json:"notbefore,omitempty"`
+	NotAfter    string  `json:"notafter,omitempty"`
+	JA3         *EVEJA3 `json:"ja3,omitempty"`
+	JA3S        *EVEJA3 `json:"ja3s,omitempty"`
+}
+
+// EVEHTTP is the http object of an http event.
+type EVEHTTP struct {
+	Hostname        string `json:"hostname,omitempty"`
+	URL             string `json:"url,omitempty"`
+	HTTPUserAgent   string `json:"http_user_agent,omitempty"`
+	HTTPContentType string `json:"http_content_type,omitempty"`
+	HTTPRefer       string `json:"http_refer,omitempty"`
+	HTTPMethod      string `json:"http_method,omitempty"`
+	Protocol        string `json:"protocol,omitempty"`
+	Status          int    `json:"status,omitempty"`
+	Length          uint64 `json:"length"`
+}
+
+// EVERecord is implemented by records that can be written as EVE events.
+type EVERecord interface {
+	EVEEvents() []*EVEEvent
+}
+
+// eveEvent returns an event of type t for the connection, sent by the
+// originator if fromOrig is true and by the responder otherwise.
+func (id *ConnID) eveEvent(t string, ts time.Time, fromOrig bool) *EVEEvent {
+	e := &EVEEvent{
+		Timestamp: ts,
+		FlowID:    id.FlowID,
+		InIface:   id.Source.InterfaceName,
+		Host:      id.Source.SensorID,
+		EventType: t,
+	}
+	srcIP, srcPort, dstIP, dstPort := id.OrigH, id.OrigP, id.RespH, id.RespP
+	if !fromOrig {
+		srcIP, srcPort, dstIP, dstPort = dstIP, dstPort, srcIP, srcPort
+	}
+	e.SrcIP, e.DestIP = srcIP.String(), dstIP.String()
+	switch id.Proto {
+	case "tcp":
+		e.Proto = "TCP"
+	case "udp":
+		e.Proto = "UDP"
+	case "icmp":
+		e.Proto = "ICMP"
+		proto := layers.IPProtocolICMPv4
+		if id.OrigH.To4() == nil {
+			e.Proto = "IPv6-ICMP"
+			proto = layers.IPProtocolICMPv6
+		}
+		// The originator's ports hold the ICMP type and code, or for a
+		// request or reply, whose code is zero, the counterpart's type.
+		typ, code := id.OrigP, id.RespP
+		if icmpPaired(proto, typ, code) {
+			code = 0
+		}
+		e.ICMPType, e.ICMPCode = &typ, &code
+		return e
+	default:
+		e.Proto = id.Proto
+	}
+	e.SrcPort, e.DestPort = srcPort, dstPort
+	return e
+}
+
+// EVEEvents returns c as a flow event.
+func (c *Conn) EVEEvents() []*EVEEvent {
+	e := c.eveEvent("flow", c.End, true)
+	e.AppProto = c.Service
+	if e.AppProto == "" {
+		e.AppProto = "failed"
+	}
+	state := "new"
+	switch {
+	case c.origFIN || c.respFIN || c.origRST || c.respRST:
+		state = "closed"
+	case c.origSYN && c.respSYN:
+		state = "established"
+	case c.Proto != "tcp" && c.RespPkts > 0:
+		state = "established"
+	}
+	e.Flow = &EVEFlow{
+		PktsToServer:  c.OrigPkts,
+		PktsToClient:  c.RespPkts,
+		BytesToServer: c.OrigIPBytes,
+		BytesToClient: c.RespIPBytes,
+		Start:         c.Start.Format(eveTimeFormat),
+		End:           c.End.Format(eveTimeFormat),
+		Age:           int64(c.Duration() / time.Second),
+		State:         state,
+		Reason:        "timeout",
+	}
+	return []*EVEEvent{e}
+}
+
+// EVEEvents returns r as a dns query event, if the query was seen, and a
+// dns answer event, if the response was.
+func (r *DNSRecord) EVEEvents() []*EVEEvent {
+	var events []*EVEEvent
+	rrtype := dnsTypeName(r.QType)
+	if r.querySeen {
+		e := r.eveEvent("dns", r.Time, true)
+		e.DNS = &EVEDNS{Type: "query", ID: r.TransID, RD: r.RD, RRName: r.Query, RRType: rrtype}
+		events = append(events, e)
+	}
+	if r.Responded {
+		e := r.eveEvent("dns", r.Time.Add(r.RTT), false)
+		flags := uint16(0x8000) | uint16(r.Z&7)<<4 | uint16(r.RCode&0xf)
+		for _, f := range []struct {
+			set bool
+			bit uint16
+		}{{r.AA, 0x400}, {r.TC, 0x200}, {r.RD, 0x100}, {r.RA, 0x80}} {
+			if f.set {
+				flags |= f.bit
+			}
+		}
+		e.DNS = &EVEDNS{
+			Version: 2,
+			Type:    "answer",
+			ID:      r.TransID,
+			Flags:   fmt.Sprintf("%x", flags),
+			QR:      true,
+			AA:      r.AA,
+			TC:      r.TC,
+			RD:      r.RD,
+			RA:      r.RA,
+			RRName:  r.Query,
+			RRType:  rrtype,
+			RCode:   dnsRCodeName(r.RCode),
+		}
+		for _, a := range r.Answers {
+			e.DNS.Answers = append(e.DNS.Answers, EVEDNSAnswer{
+				RRName: a.Name,
+				RRType: dnsTypeName(a.Type),
+				TTL:    uint32(a.TTL / time.Second),
+				RData:  a.Data,
+			})
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// EVEEvents returns r as a tls event.
+func (r *TLSRecord) EVEEvents() []*EVEEvent {
+	e := r.eveEvent("tls", r.Time, true)
+	e.AppProto = "tls"
+	_, version := tlsVersion(r.Version)
+	e.TLS = &EVETLS{
+		Subject:     r.Subject,
+		IssuerDN:    r.Issuer,
+		Serial:      r.Serial,
+		Fingerprint: r.Fingerprint,
+		SNI:         r.ServerName,
+		Version:     version,
+	}
+	if !r.NotBefore.IsZero() {
+		e.TLS.NotBefore = r.NotBefore.UTC().Format("2006-01-02T15:04:05")
+	}
+	if !r.NotAfter.IsZero() {
+		e.TLS.NotAfter = r.NotAfter.UTC().Format("2006-01-02T15:04:05")
+	}
+	if r.JA3 != "" {
+		e.TLS.JA3 = &EVEJA3{r.JA3, r.JA3String}
+	}
+	if r.JA3S != "" {
+		e.TLS.JA3S = &EVEJA3{r.JA3S, r.JA3SString}
+	}
+	return []*EVEEvent{e}
+}
+
+// EVEEvents returns r as an http event.
+func (r *HTTPRecord) EVEEvents() []*EVEEvent {
+	e := r.eveEvent("http", r.Time, true)
+	e.AppProto = "http"
+	var protocol string
+	if r.Version != "" {
+		protocol = "HTTP/" + r.Version
+	}
+	e.HTTP = &EVEHTTP{
+		Hostname:        r.Host,
+		URL:             r.URI,
+		HTTPUserAgent:   r.UserAgent,
+		HTTPContentType: r.ContentType,
+		HTTPRefer:       r.Referrer,
+		HTTPMethod:      r.Method,
+		Protocol:        protocol,
+		Status:          r.StatusCode,
+		Length:          r.ResponseBodyLen,
+	}
+	return []*EVEEvent{e}
+}
+
+// EVEWriter writes EVE events as JSON lines.
+type EVEWriter struct {
+	enc *json.Encoder
+}
+
+// NewEVEWriter creates a writer of EVE JSON lines to w.
+func NewEVEWriter(w io.Writer) *EVEWriter {
+	return &EVEWriter{enc: json.NewEncoder(w)}
+}
+
+// Write writes every event of r.
+func (e *EVEWriter) Write(r EVERecord) error {
+	for _, ev := range r.EVEEvents() {
+		if err := e.enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package logexport
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/statestore"
+)
+
+var start = time.Unix(1000, 0).UTC()
+
+func packet(t *testing.T, src, dst string, ts time.Time, ls ...gopacket.SerializableLayer) gopacket.Packet {
+	ip := &layers.IPv4{
+		Version: 4,
+		TTL:     64,
+		SrcIP:   net.ParseIP(src).To4(),
+		DstIP:   net.ParseIP(dst).To4(),
+	}
+	switch l := ls[0].(type) {
+	case *layers.TCP:
+		ip.Protocol = layers.IPProtocolTCP
+		l.SetNetworkLayerForChecksum(ip)
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		l.SetNetworkLayerForChecksum(ip)
+	case *layers.ICMPv4:
+		ip.Protocol = layers.IPProtocolICMPv4
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, append([]gopacket.SerializableLayer{ip}, ls...)...); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal("Failed to decode packet:", p.ErrorLayer().Error())
+	}
+	p.Metadata().Timestamp = ts
+	return p
+}
+
+func TestConnStates(t *testing.T) {
+	const c, s = "10.0.0.1", "10.0.0.2"
+	type pkt struct {
+		fromClient bool
+		tcp        layers.TCP
+		payload    string
+	}
+	for _, test := range []struct {
+		name    string
+		pkts    []pkt
+		state   string
+		history string
+	}{
+		{"S0", []pkt{{true, layers.TCP{SYN: true}, ""}}, "S0", "S"},
+		{"REJ", []pkt{{true, layers.TCP{SYN: true}, ""}, {false, layers.TCP{RST: true, ACK: true}, ""}}, "REJ", "Sr"},
+		{"SF", []pkt{
+			{true, layers.TCP{SYN: true}, ""},
+			{false, layers.TCP{SYN: true, ACK: true}, ""},
+			{true, layers.TCP{ACK: true}, ""},
+			{true, layers.TCP{ACK: true, PSH: true}, "GET"},
+			{false, layers.TCP{ACK: true, PSH: true}, "OK"},
+			{true, layers.TCP{FIN: true, ACK: true}, ""},
+			{false, layers.TCP{FIN: true, ACK: true}, ""},
+		}, "SF", "ShADdFf"},
+		{"RSTO", []pkt{
+			{true, layers.TCP{SYN: true}, ""},
+			{false, layers.TCP{SYN: true, ACK: true}, ""},
+			{true, layers.TCP{RST: true}, ""},
+		}, "RSTO", "ShR"},
+		{"missed SYN", []pkt{
+			{false, layers.TCP{SYN: true, ACK: true}, ""},
+			{true, layers.TCP{ACK: true}, ""},
+		}, "OTH", "hA"},
+		{"midstream", []pkt{{true, layers.TCP{ACK: true}, "x"}}, "OTH", "D"},
+	} {
+		tr := NewConnTracker()
+		var conn *Conn
+		for i, p := range test.pkts {
+			tcp := p.tcp
+			src, dst := c, s
+			tcp.SrcPort, tcp.DstPort = 40000, 80
+			if !p.fromClient {
+				src, dst = s, c
+				tcp.SrcPort, tcp.DstPort = 80, 40000
+			}
+			conn = tr.Add(packet(t, src, dst, start.Add(time.Duration(i)*time.Second), &tcp, gopacket.Payload(p.payload)))
+		}
+		if st := conn.State(); st != test.state || conn.History != test.history {
+			t.Errorf("%s: got state %s history %q, want %s %q", test.name, st, conn.History, test.state, test.history)
+		}
+		if !conn.OrigH.Equal(net.ParseIP(c)) || conn.OrigP != 40000 || conn.RespP != 80 {
+			t.Errorf("%s: bad originator %+v", test.name, conn.ConnID)
+		}
+		if done := tr.Flush(); len(done) != 1 || done[0] != conn {
+			t.Errorf("%s: flushed %v", test.name, done)
+		}
+	}
+}
+
+func TestConnICMP(t *testing.T) {
+	const c, s = "10.0.0.1", "10.0.0.2"
+	icmp := func(typ, code uint8) *layers.ICMPv4 {
+		return &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(typ, code), Id: 1, Seq: 1}
+	}
+	tr := NewConnTracker()
+	echo := tr.Add(packet(t, c, s, start, icmp(layers.ICMPv4TypeEchoRequest, 0), gopacket.Payload("ping")))
+	if got := tr.Add(packet(t, s, c, start, icmp(layers.ICMPv4TypeEchoReply, 0), gopacket.Payload("ping"))); got != echo {
+		t.Fatalf("echo reply got its own connection %+v", got.ConnID)
+	}
+	if echo.OrigPkts != 1 || echo.RespPkts != 1 || echo.RespBytes != 4 || echo.State() != "SF" {
+		t.Errorf("got echo connection %+v", echo)
+	}
+	if echo.OrigP != 8 || echo.RespP != 0 {
+		t.Errorf("got echo ports %d, %d", echo.OrigP, echo.RespP)
+	}
+
+	// Another ping between the same hosts, with its own identifier.
+	ping2 := &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0), Id: 2, Seq: 1}
+	echo2 := tr.Add(packet(t, c, s, start, ping2, gopacket.Payload("ping")))
+	if echo2 == echo {
+		t.Fatal("echo with another identifier joined the first echo's connection")
+	}
+	pong2 := &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoReply, 0), Id: 2, Seq: 1}
+	if got := tr.Add(packet(t, s, c, start, pong2, gopacket.Payload("ping"))); got != echo2 || echo.RespPkts != 1 {
+		t.Errorf("echo reply got connection %+v", got.ConnID)
+	}
+
+	ts := tr.Add(packet(t, c, s, start, icmp(layers.ICMPv4TypeTimestampRequest, 0), gopacket.Payload(make([]byte, 12))))
+	if got := tr.Add(packet(t, s, c, start, icmp(layers.ICMPv4TypeTimestampReply, 0), gopacket.Payload(make([]byte, 12)))); got != ts || ts == echo {
+		t.Fatalf("timestamp reply got connection %+v", got.ConnID)
+	}
+	if e := ts.eveEvent("flow", ts.End, true); *e.ICMPType != 13 || *e.ICMPCode != 0 {
+		t.Errorf("got EVE ICMP type %d code %d", *e.ICMPType, *e.ICMPCode)
+	}
+
+	// Errors aren't paired with anything.
+	unreach := tr.Add(packet(t, s, c, start, icmp(layers.ICMPv4TypeDestinationUnreachable, 3), gopacket.Payload("x")))
+	if unreach == echo || unreach == ts || unreach.OrigP != 3 || unreach.RespP != 3 || unreach.RespPkts != 0 {
+		t.Errorf("got unreachable connection %+v", unreach)
+	}
+}
+
+func dnsPackets(t *testing.T) (query, response gopacket.Packet) {
+	q := layers.DNSQuestion{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}
+	query = packet(t, "10.0.0.1", "10.0.0.53", start, &layers.UDP{SrcPort: 5353, DstPort: 53},
+		&layers.DNS{ID: 0x1234, RD: true, Questions: []layers.DNSQuestion{q}})
+	response = packet(t, "10.0.0.53", "10.0.0.1", start.Add(20*time.Millisecond), &layers.UDP{SrcPort: 53, DstPort: 5353},
+		&layers.DNS{ID: 0x1234, QR: true, RD: true, RA: true, Questions: []layers.DNSQuestion{q},
+			Answers: []layers.DNSResourceRecord{{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 300, IP: net.IP{192, 0, 2, 10}}}})
+	return query, response
+}
+
+func TestDNSZeek(t *testing.T) {
+	query, response := dnsPackets(t)
+	tr := NewConnTracker()
+	a := NewDNSAnalyzer()
+	if r := a.Add(query, tr.Add(query)); r != nil {
+		t.Fatalf("got record for query: %+v", r)
+	}
+	r := a.Add(response, tr.Add(response))
+	if r == nil {
+		t.Fatal("no record for response")
+	}
+	if r.RTT != 20*time.Millisecond || r.Query != "example.com" || len(r.Answers) != 1 || r.Answers[0].Data != "192.0.2.10" {
+		t.Errorf("bad record %+v", r)
+	}
+
+	var buf bytes.Buffer
+	w := NewZeekWriter(&buf, ZeekTSV)
+	if err := w.Write(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("got %d lines:\n%s", len(lines), buf.String())
+	}
+	if lines[4] != "#path\tdns" || lines[5] != "#open\t1970-01-01-00-16-40" {
+		t.Errorf("bad header:\n%s", buf.String())
+	}
+	want := strings.Join([]string{"1000.000000", r.UID, "10.0.0.1", "5353", "10.0.0.53", "53", "udp", "4660",
+		"0.020000", "example.com", "1", "C_INTERNET", "1", "A", "0", "NOERROR", "F", "F", "T", "T", "0",
+		"192.0.2.10", "300.000000", "F"}, "\t")
+	if lines[8] != want {
+		t.Errorf("got  %q\nwant %q", lines[8], want)
+	}
+
+	buf.Reset()
+	w = NewZeekWriter(&buf, ZeekJSON)
+	if err := w.Write(r); err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["id.resp_h"] != "10.0.0.53" || m["ts"] != 1000.0 || m["qtype_name"] != "A" {
+		t.Errorf("bad JSON %s", buf.String())
+	}
+	if err := w.Write(&Conn{}); err == nil {
+		t.Error("expected error writing conn record to dns log")
+	}
+}
+
+func TestEVE(t *testing.T) {
+	query, response := dnsPackets(t)
+	query.Metadata().Source = gopacket.CaptureSource{SensorID: "sensor-1", InterfaceName: "eth0"}
+	tr := NewConnTracker()
+	a := NewDNSAnalyzer()
+	a.Add(query, tr.Add(query))
+	r := a.Add(response, tr.Add(response))
+
+	var buf bytes.Buffer
+	w := NewEVEWriter(&buf)
+	if err := w.Write(r); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range tr.Flush() {
+		if err := w.Write(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d events:\n%s", len(lines), buf.String())
+	}
+	var events []map[string]interface{}
+	for _, l := range lines {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(l), &m); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, m)
+	}
+	if f := events[2]; f["host"] != "sensor-1" || f["in_iface"] != "eth0" {
+		t.Errorf("bad capture source in %s", lines[2])
+	}
+	if q := events[0]; q["event_type"] != "dns" || q["src_ip"] != "10.0.0.1" || q["timestamp"] != "1970-01-01T00:16:40.000000+0000" ||
+		q["dns"].(map[string]interface{})["type"] != "query" {
+		t.Errorf("bad query event %s", lines[0])
+	}
+	ans := events[1]["dns"].(map[string]interface{})
+	if events[1]["src_ip"] != "10.0.0.53" || ans["rcode"] != "NOERROR" || ans["flags"] != "8180" {
+		t.Errorf("bad answer event %s", lines[1])
+	}
+	if rdata := ans["answers"].([]interface{})[0].(map[string]interface{})["rdata"]; rdata != "192.0.2.10" {
+		t.Errorf("bad answer rdata %v", rdata)
+	}
+	flow := events[2]
+	if flow["event_type"] != "flow" || flow["app_proto"] != "dns" || flow["flow_id"] != events[0]["flow_id"] {
+		t.Errorf("bad flow event %s", lines[2])
+	}
+	if f := flow["flow"].(map[string]interface{}); f["pkts_toserver"] != 1.0 || f["pkts_toclient"] != 1.0 || f["state"] != "established" {
+		t.Errorf("bad flow %v", f)
+	}
+}
+
+func TestZeekEscape(t *testing.T) {
+	if got := zeekTSVValue("a\tb\\c"); got != `a\x09b\x5cc` {
+		t.Errorf("got %q", got)
+	}
+	if got := zeekTSVValue([]string{"a,b", ""}); got != `a\x2cb,` {
+		t.Errorf("got %q", got)
+	}
+	if got := zeekTSVValue(nil); got != "-" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestConnLocal(t *testing.T) {
+	// A host capture that sees a reply arrive for a connection it opened.
+	tr := NewConnTracker()
+	syn := packet(t, "10.0.0.1", "10.0.0.2", start, &layers.TCP{SrcPort: 40000, DstPort: 443, SYN: true})
+	synAck := packet(t, "10.0.0.2", "10.0.0.1", start, &layers.TCP{SrcPort: 443, DstPort: 40000, SYN: true, ACK: true})
+	synAck.Metadata().Direction = gopacket.DirectionInbound
+	tr.Add(syn)
+	c := tr.Add(synAck)
+	if c.OrigDirection != gopacket.DirectionOutbound {
+		t.Errorf("got originator direction %v, want outbound", c.OrigDirection)
+	}
+	fields := map[string]interface{}{}
+	for _, f := range c.ZeekFields() {
+		fields[f.Name] = f.Value
+	}
+	if fields["local_orig"] != true || fields["local_resp"] != false {
+		t.Errorf("got local_orig %v local_resp %v", fields["local_orig"], fields["local_resp"])
+	}
+}
+
+func TestConnSaveRestore(t *testing.T) {
+	const c, s = "10.0.0.1", "10.0.0.2"
+	tr := NewConnTracker()
+	tr.Add(packet(t, c, s, start, &layers.TCP{SrcPort: 40000, DstPort: 80, SYN: true}))
+	tr.Add(packet(t, s, c, start.Add(time.Second), &layers.TCP{SrcPort: 80, DstPort: 40000, SYN: true, ACK: true}))
+	saved := tr.Add(packet(t, c, s, start.Add(2*time.Second), &layers.TCP{SrcPort: 40000, DstPort: 80, ACK: true}, gopacket.Payload("GET")))
+	st := statestore.NewMemory()
+	if err := tr.Save(st); err != nil {
+		t.Fatal(err)
+	}
+
+	// The restored connection carries on where it left off, including
+	// which history letters it has seen.
+	restored := NewConnTracker()
+	if err := restored.Restore(st); err != nil {
+		t.Fatal(err)
+	}
+	conn := restored.Add(packet(t, s, c, start.Add(3*time.Second), &layers.TCP{SrcPort: 80, DstPort: 40000, ACK: true}, gopacket.Payload("OK")))
+	restored.Add(packet(t, c, s, start.Add(4*time.Second), &layers.TCP{SrcPort: 40000, DstPort: 80, ACK: true}, gopacket.Payload("more")))
+	if conn.UID != saved.UID || conn.History != "ShDd" || conn.OrigPkts != 3 || conn.RespPkts != 2 || conn.OrigBytes != 7 {
+		t.Errorf("got connection %+v after restore", conn)
+	}
+	if !conn.Start.Equal(start) || conn.State() != "S1" {
+		t.Errorf("got start %v state %s after restore", conn.Start, conn.State())
+	}
+
+	// ICMP identifiers are part of the saved key.
+	ping := &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0), Id: 7}
+	echo := tr.Add(packet(t, c, s, start, ping, gopacket.Payload("ping")))
+	if err := tr.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	restored = NewConnTracker()
+	if err := restored.Restore(st); err != nil {
+		t.Fatal(err)
+	}
+	pong := &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoReply, 0), Id: 7}
+	if got := restored.Add(packet(t, s, c, start, pong, gopacket.Payload("ping"))); got.UID != echo.UID || got.RespPkts != 1 {
+		t.Errorf("echo reply got connection %+v after restore", got)
+	}
+
+	// New connections don't reuse the saved IDs.
+	other := restored.Add(packet(t, c, s, start, &layers.UDP{SrcPort: 5000, DstPort: 53}))
+	if other.UID == saved.UID || other.FlowID == saved.FlowID {
+		t.Errorf("new connection reused ID %s", other.UID)
+	}
+}
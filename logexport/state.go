@@ -0,0 +1,100 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package logexport
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/statestore"
+)
+
+// The tracker's connections are saved under statePrefixConn, by UID, and
+// the counter its UIDs come from under stateNextID.
+const (
+	statePrefix     = "logexport/"
+	statePrefixConn = statePrefix + "conn/"
+	stateNextID     = statePrefix + "next_id"
+)
+
+// connState is the saved form of a Conn.
+type connState struct {
+	Network   statestore.Flow   `json:"network"`
+	Transport statestore.Flow   `json:"transport"`
+	Protocol  layers.IPProtocol `json:"protocol"`
+	ICMPID    uint16            `json:"icmp_id,omitempty"`
+	Conn
+
+	OrigSYN bool `json:"orig_syn"`
+	OrigFIN bool `json:"orig_fin"`
+	OrigRST bool `json:"orig_rst"`
+	RespSYN bool `json:"resp_syn"`
+	RespFIN bool `json:"resp_fin"`
+	RespRST bool `json:"resp_rst"`
+}
+
+// Save writes the tracker's open connections to s, replacing any saved
+// before.
+func (t *ConnTracker) Save(s statestore.Store) error {
+	if err := statestore.Clear(s, statePrefix); err != nil {
+		return err
+	}
+	for k, c := range t.conns {
+		st := connState{
+			Network:   statestore.NewFlow(k.network),
+			Transport: statestore.NewFlow(k.transport),
+			Protocol:  k.proto,
+			ICMPID:    k.id,
+			Conn:      *c,
+			OrigSYN:   c.origSYN,
+			OrigFIN:   c.origFIN,
+			OrigRST:   c.origRST,
+			RespSYN:   c.respSYN,
+			RespFIN:   c.respFIN,
+			RespRST:   c.respRST,
+		}
+		if err := statestore.PutJSON(s, statePrefixConn+c.UID, st); err != nil {
+			return err
+		}
+	}
+	return s.Put(stateNextID, []byte(strconv.FormatUint(t.nextID, 10)))
+}
+
+// Restore adds the connections saved in s to the tracker, replacing any
+// with the same key.  Connections it opens afterwards get new IDs.
+func (t *ConnTracker) Restore(s statestore.Store) error {
+	return s.Scan(statePrefix, func(key string, v []byte) error {
+		if key == stateNextID {
+			n, err := strconv.ParseUint(string(v), 10, 64)
+			if err != nil {
+				return err
+			}
+			if n > t.nextID {
+				t.nextID = n
+			}
+			return nil
+		}
+		if !strings.HasPrefix(key, statePrefixConn) {
+			return nil
+		}
+		var st connState
+		if err := json.Unmarshal(v, &st); err != nil {
+			return err
+		}
+		c := st.Conn
+		c.origSYN, c.origFIN, c.origRST = st.OrigSYN, st.OrigFIN, st.OrigRST
+		c.respSYN, c.respFIN, c.respRST = st.RespSYN, st.RespFIN, st.RespRST
+		c.seen = map[byte]bool{}
+		for i := 0; i < len(c.History); i++ {
+			c.seen[c.History[i]] = true
+		}
+		t.conns[connKey{st.Network.Flow(), st.Transport.Flow(), st.Protocol, st.ICMPID}] = &c
+		return nil
+	})
+}
@@ -0,0 +1,363 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package logexport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/mistsys/gopacket"
+)
+
+// ZeekField is one column of a Zeek log entry.  A nil Value is written as
+// unset.
+type ZeekField struct {
+	Name string
+	// Type is the Zeek type, such as time, addr, port, count or
+	// vector[string].
+	Type  string
+	Value interface{}
+}
+
+// ZeekRecord is implemented by records that can be written to a Zeek log.
+// Every record written to one log must return the same path and field
+// names.
+type ZeekRecord interface {
+	// ZeekPath returns the name of the log, such as "conn".
+	ZeekPath() string
+	ZeekFields() []ZeekField
+}
+
+func (id *ConnID) zeekFields(ts time.Time) []ZeekField {
+	return []ZeekField{
+		{"ts", "time", ts},
+		{"uid", "string", id.UID},
+		{"id.orig_h", "addr", id.OrigH},
+		{"id.orig_p", "port", id.OrigP},
+		{"id.resp_h", "addr", id.RespH},
+		{"id.resp_p", "port", id.RespP},
+	}
+}
+
+// optional returns nil for empty strings, so they're written as unset.
+func optional(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// ZeekPath returns "conn".
+func (c *Conn) ZeekPath() string { return "conn" }
+
+// ZeekFields returns the conn.log fields of c.
+func (c *Conn) ZeekFields() []ZeekField {
+	var localOrig, localResp interface{}
+	if c.OrigDirection != gopacket.DirectionUnknown {
+		localOrig = c.OrigDirection == gopacket.DirectionOutbound
+		localResp = !localOrig.(bool)
+	}
+	return append(c.zeekFields(c.Start),
+		ZeekField{"proto", "enum", c.Proto},
+		ZeekField{"service", "string", optional(c.Service)},
+		ZeekField{"duration", "interval", c.Duration()},
+		ZeekField{"orig_bytes", "count", c.OrigBytes},
+		ZeekField{"resp_bytes", "count", c.RespBytes},
+		ZeekField{"conn_state", "string", c.State()},
+		ZeekField{"local_orig", "bool", localOrig},
+		ZeekField{"local_resp", "bool", localResp},
+		ZeekField{"history", "string", optional(c.History)},
+		ZeekField{"orig_pkts", "count", c.OrigPkts},
+		ZeekField{"orig_ip_bytes", "count", c.OrigIPBytes},
+		ZeekField{"resp_pkts", "count", c.RespPkts},
+		ZeekField{"resp_ip_bytes", "count", c.RespIPBytes},
+	)
+}
+
+// ZeekPath returns "dns".
+func (r *DNSRecord) ZeekPath() string { return "dns" }
+
+// ZeekFields returns the dns.log fields of r.
+func (r *DNSRecord) ZeekFields() []ZeekField {
+	f := append(r.zeekFields(r.Time),
+		ZeekField{"proto", "enum", r.Proto},
+		ZeekField{"trans_id", "count", r.TransID},
+		ZeekField{"rtt", "interval", nil},
+		ZeekField{"query", "string", optional(r.Query)},
+		ZeekField{"qclass", "count", nil},
+		ZeekField{"qclass_name", "string", nil},
+		ZeekField{"qtype", "count", nil},
+		ZeekField{"qtype_name", "string", nil},
+		ZeekField{"rcode", "count", nil},
+		ZeekField{"rcode_name", "string", nil},
+		ZeekField{"AA", "bool", r.AA},
+		ZeekField{"TC", "bool", r.TC},
+		ZeekField{"RD", "bool", r.RD},
+		ZeekField{"RA", "bool", r.RA},
+		ZeekField{"Z", "count", r.Z},
+		ZeekField{"answers", "vector[string]", nil},
+		ZeekField{"TTLs", "vector[interval]", nil},
+		ZeekField{"rejected", "bool", r.Responded && r.RCode != 0 && len(r.Answers) == 0},
+	)
+	if r.RTT > 0 {
+		f[8].Value = r.RTT
+	}
+	if r.Query != "" {
+		f[10].Value, f[11].Value = uint16(r.QClass), dnsClassName(r.QClass)
+		f[12].Value, f[13].Value = uint16(r.QType), dnsTypeName(r.QType)
+	}
+	if r.Responded {
+		f[14].Value, f[15].Value = uint8(r.RCode), dnsRCodeName(r.RCode)
+	}
+	if len(r.Answers) > 0 {
+		answers := make([]string, len(r.Answers))
+		ttls := make([]time.Duration, len(r.Answers))
+		for i, a := range r.Answers {
+			answers[i], ttls[i] = a.Data, a.TTL
+		}
+		f[21].Value, f[22].Value = answers, ttls
+	}
+	return f
+}
+
+// ZeekPath returns "ssl".
+func (r *TLSRecord) ZeekPath() string { return "ssl" }
+
+// ZeekFields returns the ssl.log fields of r.
+func (r *TLSRecord) ZeekFields() []ZeekField {
+	version, _ := tlsVersion(r.Version)
+	return append(r.zeekFields(r.Time),
+		ZeekField{"version", "string", optional(version)},
+		ZeekField{"cipher", "string", optional(r.Cipher)},
+		ZeekField{"server_name", "string", optional(r.ServerName)},
+		ZeekField{"resumed", "bool", r.Resumed},
+		ZeekField{"established", "bool", r.Established},
+		ZeekField{"subject", "string", optional(r.Subject)},
+		ZeekField{"issuer", "string", optional(r.Issuer)},
+		ZeekField{"ja3", "string", optional(r.JA3)},
+		ZeekField{"ja3s", "string", optional(r.JA3S)},
+	)
+}
+
+// ZeekPath returns "http".
+func (r *HTTPRecord) ZeekPath() string { return "http" }
+
+// ZeekFields returns the http.log fields of r.
+func (r *HTTPRecord) ZeekFields() []ZeekField {
+	var status interface{}
+	if r.StatusCode != 0 {
+		status = r.StatusCode
+	}
+	return append(r.zeekFields(r.Time),
+		ZeekField{"trans_depth", "count", r.TransDepth},
+		ZeekField{"method", "string", optional(r.Method)},
+		ZeekField{"host", "string", optional(r.Host)},
+		ZeekField{"uri", "string", optional(r.URI)},
+		ZeekField{"referrer", "string", optional(r.Referrer)},
+		ZeekField{"version", "string", optional(r.Version)},
+		ZeekField{"user_agent", "string", optional(r.UserAgent)},
+		ZeekField{"request_body_len", "count", r.RequestBodyLen},
+		ZeekField{"response_body_len", "count", r.ResponseBodyLen},
+		ZeekField{"status_code", "count", status},
+		ZeekField{"status_msg", "string", optional(r.StatusMsg)},
+	)
+}
+
+// ZeekFormat selects how a ZeekWriter writes logs.
+type ZeekFormat int
+
+const (
+	// ZeekTSV is Zeek's default tab separated format, with its header.
+	ZeekTSV ZeekFormat = iota
+	// ZeekJSON writes one JSON object per line, as Zeek does with
+	// LogAscii::use_json.
+	ZeekJSON
+)
+
+// ZeekWriter writes records to a single Zeek log.
+type ZeekWriter struct {
+	w      io.Writer
+	format ZeekFormat
+	path   string
+	last   time.Time
+}
+
+// NewZeekWriter creates a writer for a Zeek log in the given format.
+func NewZeekWriter(w io.Writer, format ZeekFormat) *ZeekWriter {
+	return &ZeekWriter{w: w, format: format}
+}
+
+// Write writes r.  The first record written determines the log's path and,
+// for TSV, its header.
+func (z *ZeekWriter) Write(r ZeekRecord) error {
+	fields := r.ZeekFields()
+	if ts, ok := fields[0].Value.(time.Time); ok && ts.After(z.last) {
+		z.last = ts
+	}
+	if z.path == "" {
+		z.path = r.ZeekPath()
+		if z.format == ZeekTSV {
+			if err := z.header(fields); err != nil {
+				return err
+			}
+		}
+	} else if p := r.ZeekPath(); p != z.path {
+		return fmt.Errorf("record for %s log written to %s log", p, z.path)
+	}
+	var buf bytes.Buffer
+	if z.format == ZeekJSON {
+		buf.WriteByte('{')
+		first := true
+		for _, f := range fields {
+			if f.Value == nil {
+				continue
+			}
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			name, _ := json.Marshal(f.Name)
+			value, err := json.Marshal(zeekJSONValue(f.Value))
+			if err != nil {
+				return err
+			}
+			buf.Write(name)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteString("}\n")
+	} else {
+		for i, f := range fields {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			buf.WriteString(zeekTSVValue(f.Value))
+		}
+		buf.WriteByte('\n')
+	}
+	_, err := z.w.Write(buf.Bytes())
+	return err
+}
+
+func (z *ZeekWriter) header(fields []ZeekField) error {
+	open := z.last
+	if open.IsZero() {
+		open = time.Now()
+	}
+	var buf bytes.Buffer
+	buf.WriteString("#separator \\x09\n#set_separator\t,\n#empty_field\t(empty)\n#unset_field\t-\n")
+	fmt.Fprintf(&buf, "#path\t%s\n#open\t%s\n#fields", z.path, open.UTC().Format("2006-01-02-15-04-05"))
+	for _, f := range fields {
+		buf.WriteString("\t" + f.Name)
+	}
+	buf.WriteString("\n#types")
+	for _, f := range fields {
+		buf.WriteString("\t" + f.Type)
+	}
+	buf.WriteByte('\n')
+	_, err := z.w.Write(buf.Bytes())
+	return err
+}
+
+// Close writes the TSV footer.  It doesn't close the underlying writer.
+func (z *ZeekWriter) Close() error {
+	if z.format != ZeekTSV || z.path == "" {
+		return nil
+	}
+	_, err := fmt.Fprintf(z.w, "#close\t%s\n", z.last.UTC().Format("2006-01-02-15-04-05"))
+	return err
+}
+
+func zeekTime(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+func zeekJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Time:
+		return zeekTime(v)
+	case time.Duration:
+		return v.Seconds()
+	case net.IP:
+		return v.String()
+	case []time.Duration:
+		s := make([]float64, len(v))
+		for i, d := range v {
+			s[i] = d.Seconds()
+		}
+		return s
+	}
+	return v
+}
+
+func zeekTSVValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case time.Time:
+		return strconv.FormatFloat(zeekTime(v), 'f', 6, 64)
+	case time.Duration:
+		return strconv.FormatFloat(v.Seconds(), 'f', 6, 64)
+	case net.IP:
+		return v.String()
+	case bool:
+		if v {
+			return "T"
+		}
+		return "F"
+	case string:
+		if v == "" {
+			return "(empty)"
+		}
+		return zeekEscape(v, false)
+	case []string:
+		if len(v) == 0 {
+			return "(empty)"
+		}
+		var buf bytes.Buffer
+		for i, s := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(zeekEscape(s, true))
+		}
+		return buf.String()
+	case []time.Duration:
+		if len(v) == 0 {
+			return "(empty)"
+		}
+		var buf bytes.Buffer
+		for i, d := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(strconv.FormatFloat(d.Seconds(), 'f', 6, 64))
+		}
+		return buf.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// zeekEscape escapes the separators and unprintable bytes of s as \xNN.
+// Commas are escaped in set and vector elements.
+func zeekEscape(s string, element bool) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= 0x7f || c == '\\' || (element && c == ',') {
+			fmt.Fprintf(&buf, "\\x%02x", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
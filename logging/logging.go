@@ -0,0 +1,126 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package logging holds the helpers shared by the packages that log
+// through log/slog.
+//
+// Packages that can log take an optional *slog.Logger, usually a Logger
+// field in their options, and log nothing if it's nil.  (gopacket itself
+// takes a gopacket.Logger, which a *slog.Logger implements, so that it
+// doesn't depend on log/slog.)  They log drops, evictions and errors they
+// would otherwise swallow at Warn level, and per-packet traces at Debug
+// level, so the handler's level decides how much is logged.  Per-packet
+// records can be many, so Sample limits how many records with the same
+// message are logged:
+//
+//	h := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+//	logger := slog.New(logging.Sample(h, logging.DefaultSampling))
+//	source := gopacket.NewPacketSource(handle, layers.LinkTypeEthernet)
+//	source.Logger = logger
+//	assembler.Logger = logger.With("component", "tcpassembly")
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Sampling configures Sample.
+type Sampling struct {
+	// In each Interval, the First records with a given level and message
+	// are logged, then every Thereafter'th.  Thereafter zero logs no more
+	// until the interval ends.
+	Interval   time.Duration
+	First      int
+	Thereafter int
+}
+
+// DefaultSampling logs the first 10 records with each message each
+// second, and every 100th after that.
+var DefaultSampling = Sampling{
+	Interval:   time.Second,
+	First:      10,
+	Thereafter: 100,
+}
+
+type sampleCount struct {
+	start time.Time
+	n     int
+}
+
+type sampler struct {
+	Sampling
+	mu     sync.Mutex
+	counts map[sampleKey]*sampleCount
+}
+
+type sampleKey struct {
+	level slog.Level
+	msg   string
+}
+
+// allow counts r, and says whether it should be logged.
+func (s *sampler) allow(r slog.Record) bool {
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	k := sampleKey{r.Level, r.Message}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.counts[k]
+	if c == nil || t.Sub(c.start) >= s.Interval {
+		if c == nil && len(s.counts) >= maxSampleKeys {
+			// Messages are usually constants, but don't grow without
+			// bound if they aren't.
+			s.counts = map[sampleKey]*sampleCount{}
+		}
+		c = &sampleCount{start: t}
+		s.counts[k] = c
+	}
+	c.n++
+	if c.n <= s.First {
+		return true
+	}
+	return s.Thereafter > 0 && (c.n-s.First)%s.Thereafter == 0
+}
+
+const maxSampleKeys = 1024
+
+type sampleHandler struct {
+	slog.Handler
+	s *sampler
+}
+
+// Sample returns a handler that passes records to h, dropping some of
+// those with a message logged often, as configured by s.  The handlers
+// derived from it with WithAttrs and WithGroup share its counts.
+func Sample(h slog.Handler, s Sampling) slog.Handler {
+	return &sampleHandler{Handler: h, s: &sampler{Sampling: s, counts: map[sampleKey]*sampleCount{}}}
+}
+
+func (h *sampleHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !h.s.allow(r) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *sampleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sampleHandler{Handler: h.Handler.WithAttrs(attrs), s: h.s}
+}
+
+func (h *sampleHandler) WithGroup(name string) slog.Handler {
+	return &sampleHandler{Handler: h.Handler.WithGroup(name), s: h.s}
+}
+
+// Enabled reports whether l is set and logs at level.  Callers check it
+// before building the arguments of per-packet records.
+func Enabled(l *slog.Logger, level slog.Level) bool {
+	return l != nil && l.Enabled(context.Background(), level)
+}
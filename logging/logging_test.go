@@ -0,0 +1,44 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSample(t *testing.T) {
+	var buf bytes.Buffer
+	h := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	l := slog.New(Sample(h, Sampling{Interval: time.Hour, First: 2, Thereafter: 3}))
+	for i := 0; i < 10; i++ {
+		l.Debug("often")
+		l.With("k", "v").Debug("often")
+	}
+	l.Warn("once")
+	out := buf.String()
+	// 20 records: the first 2, then the 5th, 8th, 11th, ... of the rest.
+	if n := strings.Count(out, "msg=often"); n != 8 {
+		t.Errorf("logged %d sampled records, want 8:\n%s", n, out)
+	}
+	if n := strings.Count(out, "msg=once"); n != 1 {
+		t.Errorf("logged %d unsampled records, want 1", n)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	if Enabled(nil, slog.LevelError) {
+		t.Error("nil logger enabled")
+	}
+	l := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	if Enabled(l, slog.LevelDebug) || !Enabled(l, slog.LevelWarn) {
+		t.Error("wrong levels enabled")
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package mobile is a binding of gopacket's decoders for Android and iOS
+// apps, built with gomobile:
+//
+//	gomobile bind -target=android github.com/mistsys/gopacket/mobile
+//	gomobile bind -target=ios github.com/mistsys/gopacket/mobile
+//
+// It depends only on packages that use no cgo, so it doesn't need libpcap
+// on the device.  Its API uses only the types gomobile supports: results
+// are returned as JSON strings, and times as nanoseconds since the Unix
+// epoch.
+//
+// Decode converts a whole pcap or pcapng capture, as a packetjson.Capture.
+// Flows keeps packet and byte counts per conversation, for captures or for
+// packets read one at a time, for example from a VPN interface:
+//
+//	Flows flows = Mobile.newFlows();
+//	flows.addPacket(packet, Mobile.LinkTypeRaw, System.currentTimeMillis() * 1000000);
+//	String json = flows.json();
+package mobile
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/packetjson"
+	"github.com/mistsys/gopacket/pcapgo"
+)
+
+// Link types for AddPacket, from layers.LinkType.
+const (
+	LinkTypeEthernet = int(layers.LinkTypeEthernet)
+	LinkTypeRaw      = int(layers.LinkTypeRaw)
+	LinkTypeLinuxSLL = int(layers.LinkTypeLinuxSLL)
+)
+
+// Decode decodes a pcap or pcapng capture into the JSON encoding of a
+// packetjson.Capture.  Errors are recorded in the result.
+func Decode(capture []byte) string {
+	return string(packetjson.DecodeCaptureJSON(capture))
+}
+
+// Flow is the counters for one conversation, identified by its network and
+// transport endpoints.  A is the endpoint which sent the first packet seen.
+type Flow struct {
+	Network   string    `json:"network"`
+	Transport string    `json:"transport,omitempty"`
+	AddressA  string    `json:"address_a"`
+	AddressB  string    `json:"address_b"`
+	PortA     string    `json:"port_a,omitempty"`
+	PortB     string    `json:"port_b,omitempty"`
+	PacketsAB int64     `json:"packets_ab"`
+	BytesAB   int64     `json:"bytes_ab"`
+	PacketsBA int64     `json:"packets_ba"`
+	BytesBA   int64     `json:"bytes_ba"`
+	First     time.Time `json:"first"`
+	Last      time.Time `json:"last"`
+}
+
+type flowKey struct {
+	network, transport gopacket.Flow
+}
+
+// Flows accumulates flow counters.  It is safe for concurrent use.
+type Flows struct {
+	mu    sync.Mutex
+	flows map[flowKey]*Flow
+}
+
+// NewFlows creates an empty Flows.
+func NewFlows() *Flows {
+	return &Flows{flows: map[flowKey]*Flow{}}
+}
+
+// AddPacket counts one packet, of the given link type, captured at the
+// given time in nanoseconds since the Unix epoch.  Packets without a
+// network layer are ignored.
+func (f *Flows) AddPacket(data []byte, linkType int, timestamp int64) {
+	p := gopacket.NewPacket(data, layers.LinkType(linkType), gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	f.add(p, len(data), time.Unix(0, timestamp))
+}
+
+// AddCapture counts every packet of a pcap or pcapng capture.  It returns
+// the error reading the capture, if there was one, after counting the
+// packets read before it.
+func (f *Flows) AddCapture(capture []byte) error {
+	r, err := pcapgo.NewAnyReader(bytes.NewReader(capture))
+	if err != nil {
+		return err
+	}
+	ng, _ := r.(*pcapgo.NgReader)
+	for {
+		data, ci, err := r.ReadPacketData()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		lt := r.LinkType()
+		if ng != nil {
+			if ifs := ng.Interfaces(); ci.InterfaceIndex < len(ifs) {
+				lt = ifs[ci.InterfaceIndex].LinkType
+			}
+		}
+		length := ci.Length
+		if length == 0 {
+			length = len(data)
+		}
+		f.add(gopacket.NewPacket(data, lt, gopacket.DecodeOptions{Lazy: true, NoCopy: true}), length, ci.Timestamp)
+	}
+}
+
+func (f *Flows) add(p gopacket.Packet, length int, ts time.Time) {
+	n := p.NetworkLayer()
+	if n == nil {
+		return
+	}
+	k := flowKey{network: n.NetworkFlow()}
+	if t := p.TransportLayer(); t != nil {
+		k.transport = t.TransportFlow()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reverse := false
+	r := f.flows[k]
+	if r == nil {
+		if r = f.flows[flowKey{k.network.Reverse(), k.transport.Reverse()}]; r != nil {
+			reverse = true
+		}
+	}
+	if r == nil {
+		src, dst := k.network.Endpoints()
+		r = &Flow{
+			Network:  k.network.EndpointType().String(),
+			AddressA: src.String(),
+			AddressB: dst.String(),
+			First:    ts,
+		}
+		if k.transport != (gopacket.Flow{}) {
+			src, dst := k.transport.Endpoints()
+			r.Transport = k.transport.EndpointType().String()
+			r.PortA, r.PortB = src.String(), dst.String()
+		}
+		f.flows[k] = r
+	}
+	if ts.Before(r.First) {
+		r.First = ts
+	}
+	if ts.After(r.Last) {
+		r.Last = ts
+	}
+	if reverse {
+		r.PacketsBA++
+		r.BytesBA += int64(length)
+	} else {
+		r.PacketsAB++
+		r.BytesAB += int64(length)
+	}
+}
+
+// Len returns the number of flows.
+func (f *Flows) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.flows)
+}
+
+// Reset removes all flows.
+func (f *Flows) Reset() {
+	f.mu.Lock()
+	f.flows = map[flowKey]*Flow{}
+	f.mu.Unlock()
+}
+
+// Snapshot returns a copy of the flows, ordered by the time of their first
+// packet.  It isn't available to gomobile callers, which use JSON.
+func (f *Flows) Snapshot() []Flow {
+	f.mu.Lock()
+	out := make([]Flow, 0, len(f.flows))
+	for _, r := range f.flows {
+		out = append(out, *r)
+	}
+	f.mu.Unlock()
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].First.Equal(out[j].First) {
+			return out[i].First.Before(out[j].First)
+		}
+		if out[i].AddressA != out[j].AddressA {
+			return out[i].AddressA < out[j].AddressA
+		}
+		return out[i].PortA < out[j].PortA
+	})
+	return out
+}
+
+// JSON returns the JSON encoding of Snapshot, a list of Flow objects.
+func (f *Flows) JSON() string {
+	b, err := json.Marshal(f.Snapshot())
+	if err != nil {
+		return "[]"
+	}
+	return string(b)
+}
+
+// FlowStats counts the flows of a pcap or pcapng capture, returning the
+// JSON encoding of their list of Flow objects.
+func FlowStats(capture []byte) (string, error) {
+	f := NewFlows()
+	if err := f.AddCapture(capture); err != nil {
+		return "", err
+	}
+	return f.JSON(), nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package mobile
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/build"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/pcapgo"
+)
+
+func udpPacket(t *testing.T, src, dst string, sport, dport uint16, n int) []byte {
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP(src).To4(),
+		DstIP:    net.ParseIP(dst).To4(),
+	}
+	udp := &layers.UDP{SrcPort: layers.UDPPort(sport), DstPort: layers.UDPPort(dport)}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ip, udp, gopacket.Payload(make([]byte, n))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFlows(t *testing.T) {
+	start := time.Unix(1000, 0)
+	var capture bytes.Buffer
+	w := pcapgo.NewWriter(&capture)
+	if err := w.WriteFileHeader(65536, layers.LinkTypeRaw); err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range [][]byte{
+		udpPacket(t, "10.0.0.2", "192.0.2.1", 50000, 53, 10),
+		udpPacket(t, "192.0.2.1", "10.0.0.2", 53, 50000, 100),
+		udpPacket(t, "10.0.0.2", "192.0.2.1", 50000, 53, 10),
+		udpPacket(t, "10.0.0.2", "192.0.2.1", 50001, 53, 10),
+	} {
+		ci := gopacket.CaptureInfo{Timestamp: start.Add(time.Duration(i) * time.Second), CaptureLength: len(data), Length: len(data)}
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := FlowStats(capture.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Flow
+	if err := json.Unmarshal([]byte(s), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d flows, want 2: %s", len(got), s)
+	}
+	f := got[0]
+	if f.AddressA != "10.0.0.2" || f.PortA != "50000" || f.AddressB != "192.0.2.1" || f.PortB != "53" || f.Transport != "UDP" {
+		t.Errorf("got flow %+v", f)
+	}
+	if f.PacketsAB != 2 || f.BytesAB != 76 || f.PacketsBA != 1 || f.BytesBA != 128 {
+		t.Errorf("got counts %+v", f)
+	}
+	if !f.First.Equal(start) || !f.Last.Equal(start.Add(2*time.Second)) {
+		t.Errorf("got times %v to %v", f.First, f.Last)
+	}
+
+	flows := NewFlows()
+	flows.AddPacket(udpPacket(t, "10.0.0.2", "192.0.2.1", 50000, 53, 10), LinkTypeRaw, start.UnixNano())
+	flows.AddPacket([]byte{0xff}, LinkTypeRaw, start.UnixNano())
+	if flows.Len() != 1 {
+		t.Errorf("got %d flows, want 1: %s", flows.Len(), flows.JSON())
+	}
+	flows.Reset()
+	if s := flows.JSON(); s != "[]" {
+		t.Errorf("got %s after reset", s)
+	}
+	if _, err := FlowStats([]byte("not a capture")); err == nil {
+		t.Error("decoded a bad capture")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var capture bytes.Buffer
+	w := pcapgo.NewWriter(&capture)
+	if err := w.WriteFileHeader(65536, layers.LinkTypeRaw); err != nil {
+		t.Fatal(err)
+	}
+	data := udpPacket(t, "10.0.0.2", "192.0.2.1", 50000, 53, 10)
+	if err := w.WritePacket(gopacket.CaptureInfo{CaptureLength: len(data), Length: len(data)}, data); err != nil {
+		t.Fatal(err)
+	}
+	if s := Decode(capture.Bytes()); !strings.Contains(s, `"type":"UDP"`) {
+		t.Errorf("got %s", s)
+	}
+}
+
+// TestNoCgo checks that nothing this package imports uses cgo, which
+// gomobile can't build without a C toolchain and libraries for the device.
+func TestNoCgo(t *testing.T) {
+	seen := map[string]bool{}
+	var walk func(path, dir string)
+	walk = func(path, dir string) {
+		if path == "C" {
+			// Reported as the importer's CgoFiles.
+			return
+		}
+		pkg, err := build.Import(path, dir, 0)
+		if err != nil {
+			t.Errorf("import %s: %v", path, err)
+			return
+		}
+		if seen[pkg.ImportPath] || pkg.Goroot {
+			return
+		}
+		seen[pkg.ImportPath] = true
+		if len(pkg.CgoFiles) > 0 {
+			t.Errorf("package %s uses cgo", pkg.ImportPath)
+		}
+		for _, imp := range pkg.Imports {
+			walk(imp, pkg.Dir)
+		}
+	}
+	walk("github.com/mistsys/gopacket/mobile", ".")
+	if len(seen) < 3 {
+		t.Errorf("only found packages %v", seen)
+	}
+}
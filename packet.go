@@ -31,6 +31,68 @@ type CaptureInfo struct {
 	Length int
 	// InterfaceIndex
 	InterfaceIndex int
+	// Direction is the direction the packet was traveling relative to the
+	// capturing host, if the capture records it.  Decoders of link layers
+	// that carry it, such as Linux cooked captures, fill it in when the
+	// capture source doesn't.
+	Direction CaptureDirection
+	// Source records where the packet was captured, so packets captured at
+	// several points can be told apart once they're brought together.
+	Source CaptureSource
+}
+
+// CaptureSource identifies where a packet was captured.  Every field is
+// optional: capture sources fill in what they know, and the zero value
+// means unknown.
+type CaptureSource struct {
+	// SensorID identifies the sensor or capturing host.
+	SensorID string
+	// InterfaceName is the name of the capture interface, such as "eth0".
+	InterfaceName string
+	// PortVLAN is the VLAN of the switch port being captured, such as a
+	// SPAN or tap port, as opposed to any VLAN tags in the packet itself.
+	PortVLAN uint16
+}
+
+// IsZero returns true if nothing is known about the capture source.
+func (s CaptureSource) IsZero() bool { return s == CaptureSource{} }
+
+// Merge fills in the fields of s that are unset from d.
+func (s *CaptureSource) Merge(d CaptureSource) {
+	if s.SensorID == "" {
+		s.SensorID = d.SensorID
+	}
+	if s.InterfaceName == "" {
+		s.InterfaceName = d.InterfaceName
+	}
+	if s.PortVLAN == 0 {
+		s.PortVLAN = d.PortVLAN
+	}
+}
+
+// CaptureDirection is the direction of a captured packet relative to the
+// host that captured it.
+type CaptureDirection uint8
+
+const (
+	DirectionUnknown CaptureDirection = iota
+	// DirectionInbound is a packet received by the capturing host,
+	// including ones addressed to other hosts seen in promiscuous mode.
+	DirectionInbound
+	// DirectionOutbound is a packet sent by the capturing host.
+	DirectionOutbound
+)
+
+func (d CaptureDirection) String() string {
+	switch d {
+	case DirectionUnknown:
+		return "Unknown"
+	case DirectionInbound:
+		return "Inbound"
+	case DirectionOutbound:
+		return "Outbound"
+	}
+	return fmt.Sprintf("UnknownCaptureDirection(%d)", uint8(d))
 }
 
 // PacketMetadata contains metadata for a packet.
@@ -42,6 +104,9 @@ type PacketMetadata struct {
 	// This is also set automatically for packets captured off the wire if
 	// CaptureInfo.CaptureLength < CaptureInfo.Length.
 	Truncated bool
+	// Warnings holds anomalies found while decoding the packet that did not
+	// stop it from being decoded.
+	Warnings []error
 }
 
 // Packet is the primary object used by gopacket.  Packets are created by a
@@ -126,6 +191,10 @@ func (p *packet) SetTruncated() {
 	p.metadata.Truncated = true
 }
 
+func (p *packet) AddWarning(err error) {
+	p.metadata.Warnings = append(p.metadata.Warnings, err)
+}
+
 func (p *packet) SetLinkLayer(l LinkLayer) {
 	if p.link == nil {
 		p.link = l
@@ -395,6 +464,9 @@ func (p *packet) packetString() string {
 	if p.metadata.Truncated {
 		b.WriteString(", truncated")
 	}
+	for _, w := range p.metadata.Warnings {
+		fmt.Fprintf(&b, ", warning: %v", w)
+	}
 	if p.metadata.Length > 0 {
 		fmt.Fprintf(&b, ", wire length %d cap length %d", p.metadata.Length, p.metadata.CaptureLength)
 	}
@@ -745,7 +817,25 @@ type PacketSource struct {
 	// of packet data.  This can/should be changed by the user to reflect the
 	// way packets should be decoded.
 	DecodeOptions
-	c chan Packet
+	// CaptureSource fills in the parts of CaptureInfo.Source that the
+	// PacketDataSource leaves unset, such as a sensor ID, for every packet.
+	CaptureSource CaptureSource
+	// OnDecodeFailure, if set, is called with each packet whose decoding
+	// failed or panicked, after its metadata is filled in, so that it can
+	// be kept for debugging.  Checking for failures decodes every layer,
+	// even with Lazy set.
+	OnDecodeFailure func(Packet)
+	// Logger, if set, logs the read errors that Packets and All skip, at
+	// Warn level, and decoding failures at Debug level.
+	Logger Logger
+	c      chan Packet
+}
+
+// Logger is the leveled logger a PacketSource logs to, taking a message
+// followed by alternating keys and values.  A *slog.Logger is a Logger.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
 }
 
 // NewPacketSource creates a packet data source.
@@ -765,11 +855,35 @@ func (p *PacketSource) NextPacket() (Packet, error) {
 	}
 	packet := NewPacket(data, p.decoder, p.DecodeOptions)
 	m := packet.Metadata()
+	// Keep what decoding found in the packet unless the source knows better.
+	dir, ifindex := m.Direction, m.InterfaceIndex
 	m.CaptureInfo = ci
+	if m.Direction == DirectionUnknown {
+		m.Direction = dir
+	}
+	if m.InterfaceIndex == 0 {
+		m.InterfaceIndex = ifindex
+	}
+	m.Source.Merge(p.CaptureSource)
 	m.Truncated = m.Truncated || ci.CaptureLength < ci.Length
+	if p.OnDecodeFailure != nil && packet.ErrorLayer() != nil {
+		p.OnDecodeFailure(packet)
+	}
+	if p.Logger != nil {
+		if fail := packet.ErrorLayer(); fail != nil {
+			p.Logger.Debug("packet decoding failed", "error", fail.Error(), "length", len(data), "timestamp", ci.Timestamp)
+		}
+	}
 	return packet, nil
 }
 
+// skipError logs an error reading packets that is skipped.
+func (p *PacketSource) skipError(err error) {
+	if p.Logger != nil {
+		p.Logger.Warn("skipping packet read error", "error", err)
+	}
+}
+
 // packetsToChannel reads in all packets from the packet source and sends them
 // to the given channel.  When it receives an error, it ignores it.  When it
 // receives an io.EOF, it closes the channel.
@@ -781,6 +895,8 @@ func (p *PacketSource) packetsToChannel() {
 			return
 		} else if err == nil {
 			p.c <- packet
+		} else {
+			p.skipError(err)
 		}
 	}
 }
@@ -795,7 +911,8 @@ func (p *PacketSource) packetsToChannel() {
 //    handlePacket(packet)  // Do something with each packet.
 //  }
 //
-// If called more than once, returns the same channel.
+// If called more than once, returns the same channel.  With Go 1.23 and
+// later, All iterates over packets without the channel and goroutine.
 func (p *PacketSource) Packets() chan Packet {
 	if p.c == nil {
 		p.c = make(chan Packet, 1000)
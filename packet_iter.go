@@ -0,0 +1,63 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+//go:build go1.23
+// +build go1.23
+
+package gopacket
+
+import (
+	"context"
+	"io"
+	"iter"
+)
+
+// All returns an iterator over the packets from the PacketSource, for use
+// with range:
+//
+//	for packet := range packetSource.All(ctx) {
+//	  handlePacket(packet)  // Do something with each packet.
+//	}
+//
+// Unlike Packets, it reads and decodes each packet in the ranging goroutine,
+// so there's no channel or extra goroutine, and breaking out of the loop
+// stops reading.  Iteration ends at io.EOF, or when ctx is done; ctx is
+// checked before each read, so a read blocked waiting for packets isn't
+// interrupted.  Other errors are skipped, as with Packets.
+func (p *PacketSource) All(ctx context.Context) iter.Seq[Packet] {
+	return func(yield func(Packet) bool) {
+		for packet, err := range p.AllWithErrors(ctx) {
+			if err != nil {
+				if ctx.Err() == nil {
+					p.skipError(err)
+				}
+			} else if !yield(packet) {
+				return
+			}
+		}
+	}
+}
+
+// AllWithErrors is like All, but also yields the errors other than io.EOF
+// returned by the PacketDataSource, with nil packets, so the caller can
+// decide whether to carry on.  If ctx is done, it yields ctx.Err() last.
+func (p *PacketSource) AllWithErrors(ctx context.Context) iter.Seq2[Packet, error] {
+	return func(yield func(Packet, error) bool) {
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			packet, err := p.NextPacket()
+			if err == io.EOF {
+				return
+			}
+			if !yield(packet, err) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+//go:build go1.23
+// +build go1.23
+
+package gopacket
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// countSource returns n packets, with an error before every errEvery'th if
+// errEvery is set, then io.EOF.
+type countSource struct {
+	n, errEvery, reads int
+	data               []byte
+}
+
+var errCountSource = errors.New("countSource error")
+
+func (s *countSource) ReadPacketData() ([]byte, CaptureInfo, error) {
+	if s.n == 0 {
+		return nil, CaptureInfo{}, io.EOF
+	}
+	s.reads++
+	if s.errEvery > 0 && s.reads%s.errEvery == 0 {
+		return nil, CaptureInfo{}, errCountSource
+	}
+	s.n--
+	return s.data, CaptureInfo{CaptureLength: len(s.data), Length: len(s.data)}, nil
+}
+
+func TestPacketSourceAll(t *testing.T) {
+	ps := NewPacketSource(&countSource{n: 5, errEvery: 3, data: []byte{1, 2, 3}}, DecodePayload)
+	n := 0
+	for p := range ps.All(context.Background()) {
+		if len(p.Data()) != 3 {
+			t.Errorf("got packet %v", p)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("got %d packets, want 5", n)
+	}
+
+	ps = NewPacketSource(&countSource{n: 5, errEvery: 3, data: []byte{1}}, DecodePayload)
+	var packets, errs int
+	for p, err := range ps.AllWithErrors(context.Background()) {
+		if err != nil {
+			if err != errCountSource || p != nil {
+				t.Errorf("got %v, %v", p, err)
+			}
+			errs++
+		} else {
+			packets++
+		}
+	}
+	if packets != 5 || errs != 2 {
+		t.Errorf("got %d packets and %d errors, want 5 and 2", packets, errs)
+	}
+}
+
+func TestPacketSourceAllStops(t *testing.T) {
+	src := &countSource{n: 100, data: []byte{1}}
+	ps := NewPacketSource(src, DecodePayload)
+	for range ps.All(context.Background()) {
+		if src.reads == 3 {
+			break
+		}
+	}
+	if src.reads != 3 {
+		t.Errorf("read %d packets after break, want 3", src.reads)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var last error
+	for _, err := range ps.AllWithErrors(ctx) {
+		last = err
+		if src.reads == 5 {
+			cancel()
+		}
+	}
+	if src.reads != 5 || last != context.Canceled {
+		t.Errorf("read %d packets, last error %v after cancel", src.reads, last)
+	}
+}
+
+func BenchmarkPacketSourcePackets(b *testing.B) {
+	ps := NewPacketSource(&countSource{n: b.N, data: make([]byte, 64)}, DecodePayload)
+	ps.DecodeOptions = NoCopy
+	for range ps.Packets() {
+	}
+}
+
+func BenchmarkPacketSourceAll(b *testing.B) {
+	ps := NewPacketSource(&countSource{n: b.N, data: make([]byte, 64)}, DecodePayload)
+	ps.DecodeOptions = NoCopy
+	for range ps.All(context.Background()) {
+	}
+}
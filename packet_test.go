@@ -7,6 +7,7 @@
 package gopacket
 
 import (
+	"io"
 	"reflect"
 	"testing"
 )
@@ -26,3 +27,33 @@ func TestDumpEmbedded(t *testing.T) {
 		t.Errorf("embedded dump mismatch:\n   got: %v\n  want: %v", got, want)
 	}
 }
+
+type oneSource struct {
+	ci   CaptureInfo
+	done bool
+}
+
+func (s *oneSource) ReadPacketData() ([]byte, CaptureInfo, error) {
+	if s.done {
+		return nil, CaptureInfo{}, io.EOF
+	}
+	s.done = true
+	return []byte{1, 2, 3}, s.ci, nil
+}
+
+func TestPacketSourceCaptureSource(t *testing.T) {
+	ci := CaptureInfo{CaptureLength: 3, Length: 3, Source: CaptureSource{InterfaceName: "eth1"}}
+	ps := NewPacketSource(&oneSource{ci: ci}, DecodePayload)
+	ps.CaptureSource = CaptureSource{SensorID: "sensor-7", InterfaceName: "eth0", PortVLAN: 10}
+	p, err := ps.NextPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CaptureSource{SensorID: "sensor-7", InterfaceName: "eth1", PortVLAN: 10}
+	if got := p.Metadata().Source; got != want {
+		t.Errorf("got capture source %+v, want %+v", got, want)
+	}
+	if (CaptureSource{}).IsZero() != true || want.IsZero() {
+		t.Error("IsZero is wrong")
+	}
+}
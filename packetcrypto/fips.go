@@ -0,0 +1,17 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+//go:build go1.24 && !boringcrypto
+// +build go1.24,!boringcrypto
+
+package packetcrypto
+
+import "crypto/fips140"
+
+// fipsEnabled returns true if the standard library runs in FIPS 140 mode.
+func fipsEnabled() bool {
+	return fips140.Enabled()
+}
@@ -0,0 +1,17 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+//go:build boringcrypto
+// +build boringcrypto
+
+package packetcrypto
+
+import "crypto/boring"
+
+// fipsEnabled returns true if the standard library uses BoringCrypto.
+func fipsEnabled() bool {
+	return boring.Enabled()
+}
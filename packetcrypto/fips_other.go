@@ -0,0 +1,16 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+//go:build !go1.24 && !boringcrypto
+// +build !go1.24,!boringcrypto
+
+package packetcrypto
+
+// fipsEnabled returns false: releases before Go 1.24 have no FIPS 140 mode,
+// and this build doesn't use BoringCrypto.
+func fipsEnabled() bool {
+	return false
+}
@@ -0,0 +1,214 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package packetcrypto
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+)
+
+// PBKDF2 derives a keyLen byte key from password and salt, with iter
+// iterations of HMAC-h, as in RFC 8018.  WPA2 personal derives its PMK
+// from the passphrase with PBKDF2(p, SHA1, passphrase, ssid, 4096, 32).
+func PBKDF2(p Provider, h Hash, password, salt []byte, iter, keyLen int) ([]byte, error) {
+	prf, err := p.NewHMAC(h, password)
+	if err != nil {
+		return nil, err
+	}
+	size := prf.Size()
+	out := make([]byte, 0, (keyLen+size-1)/size*size)
+	var count [4]byte
+	u := make([]byte, size)
+	for block := uint32(1); len(out) < keyLen; block++ {
+		binary.BigEndian.PutUint32(count[:], block)
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(count[:])
+		u = prf.Sum(u[:0])
+		t := append([]byte(nil), u...)
+		for n := 1; n < iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:keyLen], nil
+}
+
+// PRF is the pseudo-random function of IEEE 802.11 (12.7.1.2), returning
+// bits bits derived from key, label and data with HMAC-SHA1.  WPA2 derives
+// its PTK with PRF(p, pmk, "Pairwise key expansion", addresses||nonces,
+// 384).
+func PRF(p Provider, key []byte, label string, data []byte, bits int) ([]byte, error) {
+	mac, err := p.NewHMAC(SHA1, key)
+	if err != nil {
+		return nil, err
+	}
+	n := (bits + 7) / 8
+	var out []byte
+	for i := 0; len(out) < n; i++ {
+		mac.Reset()
+		mac.Write([]byte(label))
+		mac.Write([]byte{0})
+		mac.Write(data)
+		mac.Write([]byte{byte(i)})
+		out = mac.Sum(out)
+	}
+	return out[:n], nil
+}
+
+// KDF is the key derivation function of IEEE 802.11 (12.7.1.7.2),
+// KDF-Hash-Length, returning bits bits derived from key, label and context
+// with HMAC-h.  It's used by 802.11r, 802.11w and SAE, with SHA256.
+func KDF(p Provider, h Hash, key []byte, label string, context []byte, bits int) ([]byte, error) {
+	mac, err := p.NewHMAC(h, key)
+	if err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	binary.LittleEndian.PutUint16(length[:], uint16(bits))
+	n := (bits + 7) / 8
+	var out []byte
+	var counter [2]byte
+	for i := uint16(1); len(out) < n; i++ {
+		binary.LittleEndian.PutUint16(counter[:], i)
+		mac.Reset()
+		mac.Write(counter[:])
+		mac.Write([]byte(label))
+		mac.Write(context)
+		mac.Write(length[:])
+		out = mac.Sum(out)
+	}
+	return out[:n], nil
+}
+
+// CMAC returns the AES-CMAC of msg with key, as in RFC 4493.
+func CMAC(p Provider, key, msg []byte) ([]byte, error) {
+	b, err := p.NewAES(key)
+	if err != nil {
+		return nil, err
+	}
+	const bs = 16
+	// Derive the subkeys by doubling the encrypted zero block.
+	k1 := make([]byte, bs)
+	b.Encrypt(k1, k1)
+	double(k1)
+	k2 := append([]byte(nil), k1...)
+	double(k2)
+
+	n := (len(msg) + bs - 1) / bs
+	last := make([]byte, bs)
+	if n == 0 || len(msg)%bs != 0 {
+		if n == 0 {
+			n = 1
+		}
+		copy(last, msg[(n-1)*bs:])
+		last[len(msg)-(n-1)*bs] = 0x80
+		xor(last, k2)
+	} else {
+		copy(last, msg[(n-1)*bs:])
+		xor(last, k1)
+	}
+	x := make([]byte, bs)
+	for i := 0; i < n-1; i++ {
+		xor(x, msg[i*bs:(i+1)*bs])
+		b.Encrypt(x, x)
+	}
+	xor(x, last)
+	b.Encrypt(x, x)
+	return x, nil
+}
+
+// double multiplies the 128 bit block b by x in GF(2^128).
+func double(b []byte) {
+	carry := b[0] >> 7
+	for i := 0; i < len(b)-1; i++ {
+		b[i] = b[i]<<1 | b[i+1]>>7
+	}
+	b[len(b)-1] = b[len(b)-1]<<1 ^ carry*0x87
+}
+
+func xor(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// EAPOLKeyMIC returns the 16 byte MIC of an EAPOL-Key frame, computed with
+// the KCK using the algorithm of the frame's key descriptor version: 1 for
+// HMAC-MD5, 2 for HMAC-SHA1-128 and 3 for AES-128-CMAC.  frame is the whole
+// EAPOL frame with its MIC field set to zeros.
+func EAPOLKeyMIC(p Provider, version int, kck, frame []byte) ([]byte, error) {
+	switch version {
+	case 1, 2:
+		h := MD5
+		if version == 2 {
+			h = SHA1
+		}
+		mac, err := p.NewHMAC(h, kck)
+		if err != nil {
+			return nil, err
+		}
+		mac.Write(frame)
+		return mac.Sum(nil)[:16], nil
+	case 3:
+		return CMAC(p, kck, frame)
+	}
+	return nil, fmt.Errorf("packetcrypto: unknown key descriptor version %d", version)
+}
+
+// VerifyEAPOLKeyMIC returns nil if mic is the MIC of frame, computed as by
+// EAPOLKeyMIC.
+func VerifyEAPOLKeyMIC(p Provider, version int, kck, frame, mic []byte) error {
+	want, err := EAPOLKeyMIC(p, version, kck, frame)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(want, mic) != 1 {
+		return fmt.Errorf("packetcrypto: EAPOL-Key MIC mismatch")
+	}
+	return nil
+}
+
+// HKDFExtract returns the pseudorandom key HKDF-Extract derives from salt
+// and the input keying material ikm with HMAC-h, as in RFC 5869.
+func HKDFExtract(p Provider, h Hash, salt, ikm []byte) ([]byte, error) {
+	mac, err := p.NewHMAC(h, salt)
+	if err != nil {
+		return nil, err
+	}
+	mac.Write(ikm)
+	return mac.Sum(nil), nil
+}
+
+// HKDFExpand returns length bytes HKDF-Expand derives from the
+// pseudorandom key prk and info with HMAC-h, as in RFC 5869.  TLS 1.3 and
+// QUIC derive their keys with it.
+func HKDFExpand(p Provider, h Hash, prk, info []byte, length int) ([]byte, error) {
+	mac, err := p.NewHMAC(h, prk)
+	if err != nil {
+		return nil, err
+	}
+	if length > 255*mac.Size() {
+		return nil, fmt.Errorf("packetcrypto: HKDF length %d too long", length)
+	}
+	var out, t []byte
+	for i := byte(1); len(out) < length; i++ {
+		mac.Reset()
+		mac.Write(t)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		t = mac.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:length], nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package packetcrypto holds the cryptography gopacket uses to derive keys,
+// validate message integrity codes and decrypt captured traffic, behind a
+// Provider interface.  Code which decrypts or validates packets takes a
+// Provider, or uses Default, rather than calling the crypto packages
+// directly, so deployments which must use validated cryptography can
+// control and audit every algorithm used.
+//
+// Standard is implemented with the standard library.  When the standard
+// library's cryptography is itself FIPS validated, either because the
+// program is built with GOEXPERIMENT=boringcrypto or because it runs in Go's
+// FIPS 140 mode, Default refuses algorithms which aren't approved, such as
+// MD5 and RC4, returning ErrNotApproved.  FIPSOnly applies the same
+// restriction to any Provider.
+package packetcrypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// Hash identifies a hash function.
+type Hash uint8
+
+const (
+	MD5 Hash = iota + 1
+	SHA1
+	SHA256
+	SHA384
+	SHA512
+)
+
+func (h Hash) String() string {
+	switch h {
+	case MD5:
+		return "MD5"
+	case SHA1:
+		return "SHA1"
+	case SHA256:
+		return "SHA256"
+	case SHA384:
+		return "SHA384"
+	case SHA512:
+		return "SHA512"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(h))
+}
+
+// ErrNotApproved is returned by providers restricted to FIPS approved
+// algorithms, when asked for one which isn't.
+var ErrNotApproved = errors.New("packetcrypto: algorithm not FIPS approved")
+
+// Provider supplies cryptographic primitives.  Implementations must be
+// safe for concurrent use.
+type Provider interface {
+	// Name describes the implementation, for logs and audits.
+	Name() string
+	// FIPS returns true if the provider only supplies FIPS approved
+	// algorithms from a validated module.
+	FIPS() bool
+	// NewHash returns a new hash.Hash computing h.
+	NewHash(h Hash) (hash.Hash, error)
+	// NewHMAC returns a new hash.Hash computing the HMAC of h with key.
+	NewHMAC(h Hash, key []byte) (hash.Hash, error)
+	// NewAES returns an AES block cipher, with a 16, 24 or 32 byte key.
+	NewAES(key []byte) (cipher.Block, error)
+	// NewAESGCM returns AES in Galois Counter Mode with 12 byte nonces
+	// and 16 byte tags, as used by TLS, MACsec and 802.11 GCMP.
+	NewAESGCM(key []byte) (cipher.AEAD, error)
+	// NewRC4 returns an RC4 stream cipher, as used by WEP and TKIP.
+	NewRC4(key []byte) (cipher.Stream, error)
+}
+
+// Default is the Provider used by packages which aren't given one.
+var Default Provider = Standard
+
+// Standard is the Provider implemented with the standard library.
+var Standard Provider = standard{}
+
+type standard struct{}
+
+func (standard) Name() string { return "stdlib" }
+func (standard) FIPS() bool   { return fipsEnabled() }
+
+func (standard) NewHash(h Hash) (hash.Hash, error) {
+	switch h {
+	case MD5:
+		return md5.New(), nil
+	case SHA1:
+		return sha1.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case SHA384:
+		return sha512.New384(), nil
+	case SHA512:
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("packetcrypto: unknown hash %v", h)
+}
+
+func (s standard) NewHMAC(h Hash, key []byte) (hash.Hash, error) {
+	if _, err := s.NewHash(h); err != nil {
+		return nil, err
+	}
+	return hmac.New(func() hash.Hash {
+		f, _ := s.NewHash(h)
+		return f
+	}, key), nil
+}
+
+func (standard) NewAES(key []byte) (cipher.Block, error) {
+	return aes.NewCipher(key)
+}
+
+func (standard) NewAESGCM(key []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(b)
+}
+
+func (standard) NewRC4(key []byte) (cipher.Stream, error) {
+	return rc4.NewCipher(key)
+}
+
+// FIPSOnly returns a Provider which supplies the FIPS approved algorithms
+// of p, and returns ErrNotApproved for the others.  It doesn't make p's
+// implementation validated: that depends on the module p uses.
+func FIPSOnly(p Provider) Provider {
+	if f, ok := p.(fipsOnly); ok {
+		return f
+	}
+	return fipsOnly{p}
+}
+
+type fipsOnly struct {
+	p Provider
+}
+
+func (f fipsOnly) Name() string { return f.p.Name() + " (FIPS approved only)" }
+func (f fipsOnly) FIPS() bool   { return f.p.FIPS() }
+
+func (f fipsOnly) NewHash(h Hash) (hash.Hash, error) {
+	if h == MD5 {
+		return nil, ErrNotApproved
+	}
+	return f.p.NewHash(h)
+}
+
+func (f fipsOnly) NewHMAC(h Hash, key []byte) (hash.Hash, error) {
+	if h == MD5 {
+		return nil, ErrNotApproved
+	}
+	return f.p.NewHMAC(h, key)
+}
+
+func (f fipsOnly) NewAES(key []byte) (cipher.Block, error) {
+	return f.p.NewAES(key)
+}
+
+func (f fipsOnly) NewAESGCM(key []byte) (cipher.AEAD, error) {
+	return f.p.NewAESGCM(key)
+}
+
+func (f fipsOnly) NewRC4(key []byte) (cipher.Stream, error) {
+	return nil, ErrNotApproved
+}
+
+func init() {
+	if fipsEnabled() {
+		Default = FIPSOnly(Standard)
+	}
+}
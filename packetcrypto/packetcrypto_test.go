@@ -0,0 +1,149 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package packetcrypto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPBKDF2(t *testing.T) {
+	// IEEE 802.11 J.4.2, the PSK for passphrase "password" and SSID "IEEE".
+	got, err := PBKDF2(Standard, SHA1, []byte("password"), []byte("IEEE"), 4096, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := unhex(t, "f42c6fc52df0ebef9ebb4b90b38a5f902e83fe1b135a70e23aed762e9710a12e"); !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+}
+
+func TestPRF(t *testing.T) {
+	// IEEE 802.11 J.3.2, test case 1.
+	got, err := PRF(Standard, bytes.Repeat([]byte{0x0b}, 20), "prefix", []byte("Hi There"), 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := unhex(t, "bcd4c650b30b9684951829e0d75f9d54b862175ed9f00606e17d8da35402ffee75df78c3d31e0f889f012120c0862beb67753e7439ae242edb8373698356cf5a")
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+}
+
+func TestKDF(t *testing.T) {
+	key := []byte("key")
+	got, err := KDF(Standard, SHA256, key, "label", []byte("context"), 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("\x01\x00labelcontext\x00\x01"))
+	if want := mac.Sum(nil); !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+	if got, _ := KDF(Standard, SHA256, key, "label", nil, 384); len(got) != 48 {
+		t.Errorf("got %d bytes, want 48", len(got))
+	}
+}
+
+func TestHKDF(t *testing.T) {
+	// RFC 5869 A.1.
+	prk, err := HKDFExtract(Standard, SHA256, unhex(t, "000102030405060708090a0b0c"), bytes.Repeat([]byte{0x0b}, 22))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := unhex(t, "077709362c2e32df0ddc3f0dc47bba6390b6c73bb50f9c3122ec844ad7c2b3e5"); !bytes.Equal(prk, want) {
+		t.Errorf("got PRK %x, want %x", prk, want)
+	}
+	okm, err := HKDFExpand(Standard, SHA256, prk, unhex(t, "f0f1f2f3f4f5f6f7f8f9"), 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := unhex(t, "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865"); !bytes.Equal(okm, want) {
+		t.Errorf("got OKM %x, want %x", okm, want)
+	}
+}
+
+func TestCMAC(t *testing.T) {
+	// RFC 4493 section 4.
+	key := unhex(t, "2b7e151628aed2a6abf7158809cf4f3c")
+	msg := unhex(t, "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710")
+	for _, test := range []struct {
+		n    int
+		want string
+	}{
+		{0, "bb1d6929e95937287fa37d129b756746"},
+		{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{40, "dfa66747de9ae63030ca32611497c827"},
+		{64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	} {
+		got, err := CMAC(Standard, key, msg[:test.n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := unhex(t, test.want); !bytes.Equal(got, want) {
+			t.Errorf("%d bytes: got %x, want %x", test.n, got, want)
+		}
+	}
+}
+
+func TestEAPOLKeyMIC(t *testing.T) {
+	kck := bytes.Repeat([]byte{1}, 16)
+	frame := []byte("an EAPOL-Key frame with a zeroed MIC")
+	for version := 1; version <= 3; version++ {
+		mic, err := EAPOLKeyMIC(Standard, version, kck, frame)
+		if err != nil || len(mic) != 16 {
+			t.Fatalf("version %d: got %x, %v", version, mic, err)
+		}
+		if err := VerifyEAPOLKeyMIC(Standard, version, kck, frame, mic); err != nil {
+			t.Errorf("version %d: %v", version, err)
+		}
+		mic[0] ^= 1
+		if err := VerifyEAPOLKeyMIC(Standard, version, kck, frame, mic); err == nil {
+			t.Errorf("version %d: bad MIC verified", version)
+		}
+	}
+	if _, err := EAPOLKeyMIC(Standard, 4, kck, frame); err == nil {
+		t.Error("computed MIC for unknown version")
+	}
+}
+
+func TestFIPSOnly(t *testing.T) {
+	p := FIPSOnly(Standard)
+	if FIPSOnly(p) != p {
+		t.Error("FIPSOnly wrapped twice")
+	}
+	if _, err := p.NewHash(MD5); err != ErrNotApproved {
+		t.Errorf("MD5: got %v", err)
+	}
+	if _, err := p.NewRC4([]byte("key")); err != ErrNotApproved {
+		t.Errorf("RC4: got %v", err)
+	}
+	if _, err := EAPOLKeyMIC(p, 1, make([]byte, 16), nil); err != ErrNotApproved {
+		t.Errorf("HMAC-MD5 MIC: got %v", err)
+	}
+	if _, err := EAPOLKeyMIC(p, 3, make([]byte, 16), nil); err != nil {
+		t.Errorf("AES-CMAC MIC: %v", err)
+	}
+	if _, err := p.NewAESGCM(make([]byte, 16)); err != nil {
+		t.Errorf("AES-GCM: %v", err)
+	}
+	if Default.FIPS() != Standard.FIPS() {
+		t.Errorf("default provider %s, FIPS %v", Default.Name(), Default.FIPS())
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package packetjson converts decoded packets into trees of layers and
+// fields that encode to JSON, for viewers written in other languages, such
+// as browser and mobile apps.  It uses no cgo, so it builds for targets
+// like GOOS=js GOARCH=wasm.
+//
+// Fields are taken from the exported fields of each layer, like
+// gopacket.LayerString.  Values with a String method, such as addresses
+// and enumerations, become strings, byte slices become hex strings, and
+// structs become objects.
+package packetjson
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/pcapgo"
+)
+
+// Packet is a decoded packet.
+type Packet struct {
+	Timestamp      time.Time `json:"timestamp"`
+	CaptureLength  int       `json:"capture_length"`
+	Length         int       `json:"length"`
+	InterfaceIndex int       `json:"interface_index,omitempty"`
+	Layers         []Layer   `json:"layers"`
+	// Error is the error decoding the packet, if there was one.
+	Error string `json:"error,omitempty"`
+}
+
+// Layer is one layer of a packet.
+type Layer struct {
+	Type string `json:"type"`
+	// Offset and Length locate the layer's header in the packet data.
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+	// Fields holds the layer's fields by name.
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// maxDepth bounds the nesting of fields, in case of cycles.
+const maxDepth = 16
+
+var (
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	payloadType  = reflect.TypeOf(gopacket.Payload(nil))
+)
+
+// FromPacket converts p.
+func FromPacket(p gopacket.Packet) *Packet {
+	md := p.Metadata()
+	out := &Packet{
+		Timestamp:      md.Timestamp,
+		CaptureLength:  md.CaptureLength,
+		Length:         md.Length,
+		InterfaceIndex: md.InterfaceIndex,
+		Layers:         []Layer{},
+	}
+	offset := 0
+	for _, l := range p.Layers() {
+		out.Layers = append(out.Layers, FromLayer(l, offset))
+		offset += len(l.LayerContents())
+	}
+	if e := p.ErrorLayer(); e != nil {
+		out.Error = e.Error().Error()
+	}
+	return out
+}
+
+// FromLayer converts l, found at the given offset in its packet.
+func FromLayer(l gopacket.Layer, offset int) Layer {
+	out := Layer{
+		Type:   l.LayerType().String(),
+		Offset: offset,
+		Length: len(l.LayerContents()),
+		Fields: map[string]interface{}{},
+	}
+	v := reflect.ValueOf(l)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return out
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		structFields(v, out.Fields, 0)
+	} else if v.Type() == payloadType {
+		// Payload has no fields, only its contents.
+	} else {
+		out.Fields["value"] = value(v, 0)
+	}
+	return out
+}
+
+// structFields adds the exported fields of struct v to fields.  Fields of
+// embedded structs are added as if they were v's own, except those of
+// embedded layers such as BaseLayer, which hold the layer's contents and
+// payload.
+func structFields(v reflect.Value, fields map[string]interface{}, depth int) {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+		if f.Anonymous {
+			if f.Name == "BaseLayer" || fv.Kind() != reflect.Struct {
+				continue
+			}
+			structFields(fv, fields, depth)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if x, ok := valueOK(fv, depth+1); ok {
+			fields[f.Name] = x
+		}
+	}
+}
+
+func value(v reflect.Value, depth int) interface{} {
+	x, _ := valueOK(v, depth)
+	return x
+}
+
+// valueOK converts v, returning false for values with no JSON form, such
+// as functions.
+func valueOK(v reflect.Value, depth int) (interface{}, bool) {
+	if depth > maxDepth {
+		return nil, false
+	}
+	switch v.Kind() {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Invalid:
+		return nil, false
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, true
+		}
+		return valueOK(v.Elem(), depth)
+	}
+	if v.Kind() != reflect.Struct && v.CanInterface() && v.Type().Implements(stringerType) {
+		return v.Interface().(fmt.Stringer).String(), true
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			return t, true
+		}
+		fields := map[string]interface{}{}
+		structFields(v, fields, depth)
+		return fields, true
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return hex.EncodeToString(b), true
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, true
+		}
+		s := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s = append(s, value(v.Index(i), depth+1))
+		}
+		return s, true
+	case reflect.Map:
+		m := map[string]interface{}{}
+		for _, k := range v.MapKeys() {
+			m[fmt.Sprint(k.Interface())] = value(v.MapIndex(k), depth+1)
+		}
+		return m, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), true
+	case reflect.Bool:
+		return v.Bool(), true
+	case reflect.String:
+		return v.String(), true
+	}
+	return nil, false
+}
+
+// DecodeCapture decodes every packet of a pcap or pcapng capture held in
+// data.  It returns the packets decoded before any error reading the
+// capture, along with the error.
+func DecodeCapture(data []byte, opts gopacket.DecodeOptions) ([]*Packet, error) {
+	r, err := pcapgo.NewAnyReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	ng, _ := r.(*pcapgo.NgReader)
+	var out []*Packet
+	for {
+		data, ci, err := r.ReadPacketData()
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return out, err
+		}
+		lt := r.LinkType()
+		if ng != nil {
+			if ifs := ng.Interfaces(); ci.InterfaceIndex < len(ifs) {
+				lt = ifs[ci.InterfaceIndex].LinkType
+			}
+		}
+		p := gopacket.NewPacket(data, lt, opts)
+		p.Metadata().CaptureInfo = ci
+		out = append(out, FromPacket(p))
+	}
+}
+
+// Capture is a decoded capture.
+type Capture struct {
+	Packets []*Packet `json:"packets"`
+	// Error is the error reading the capture, if there was one, in which
+	// case Packets holds the packets read before it.
+	Error string `json:"error,omitempty"`
+}
+
+// DecodeCaptureJSON decodes a pcap or pcapng capture into the JSON
+// encoding of a Capture, which records any error rather than returning
+// it, for callers in other languages.
+func DecodeCaptureJSON(data []byte) []byte {
+	packets, err := DecodeCapture(data, gopacket.Default)
+	c := Capture{Packets: packets}
+	if c.Packets == nil {
+		c.Packets = []*Packet{}
+	}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		b, _ = json.Marshal(Capture{Packets: []*Packet{}, Error: err.Error()})
+	}
+	return b
+}
@@ -0,0 +1,145 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package packetjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/pcapgo"
+)
+
+func udpPacket(t *testing.T) []byte {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{2, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{2, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.IP{192, 0, 2, 1},
+		DstIP:    net.IP{192, 0, 2, 2},
+	}
+	udp := &layers.UDP{SrcPort: 5000, DstPort: 6000}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload("hello")); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeCaptureJSON(t *testing.T) {
+	data := udpPacket(t)
+	ci := gopacket.CaptureInfo{Timestamp: time.Unix(1000, 0), CaptureLength: len(data), Length: len(data)}
+	var pcap, pcapng bytes.Buffer
+	w := pcapgo.NewWriter(&pcap)
+	if err := w.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	ng, err := pcapgo.NewNgWriter(&pcapng, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatal(err)
+		}
+		if err := ng.WritePacket(ci, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, capture := range map[string][]byte{"pcap": pcap.Bytes(), "pcapng": pcapng.Bytes()} {
+		var c struct {
+			Packets []struct {
+				Timestamp     time.Time `json:"timestamp"`
+				CaptureLength int       `json:"capture_length"`
+				Layers        []struct {
+					Type   string                 `json:"type"`
+					Offset int                    `json:"offset"`
+					Length int                    `json:"length"`
+					Fields map[string]interface{} `json:"fields"`
+				} `json:"layers"`
+			} `json:"packets"`
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(DecodeCaptureJSON(capture), &c); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if c.Error != "" || len(c.Packets) != 2 {
+			t.Fatalf("%s: got %d packets, error %q", name, len(c.Packets), c.Error)
+		}
+		p := c.Packets[0]
+		if !p.Timestamp.Equal(ci.Timestamp) || p.CaptureLength != len(data) || len(p.Layers) != 4 {
+			t.Fatalf("%s: got %+v", name, p)
+		}
+		ip := p.Layers[1]
+		if ip.Type != "IPv4" || ip.Offset != 14 || ip.Length != 20 {
+			t.Errorf("%s: got IPv4 layer %+v", name, ip)
+		}
+		for field, want := range map[string]interface{}{
+			"SrcIP":    "192.0.2.1",
+			"Protocol": "UDP",
+			"TTL":      float64(64),
+			"Options":  nil,
+		} {
+			if got := ip.Fields[field]; got != want {
+				t.Errorf("%s: IPv4 field %s is %#v, want %#v", name, field, got, want)
+			}
+		}
+		if _, ok := ip.Fields["Contents"]; ok {
+			t.Errorf("%s: IPv4 layer has contents field", name)
+		}
+		if eth := p.Layers[0]; eth.Fields["SrcMAC"] != "02:00:00:00:00:01" {
+			t.Errorf("%s: got Ethernet layer %+v", name, eth)
+		}
+		if udp := p.Layers[2]; udp.Fields["DstPort"] != "6000" {
+			t.Errorf("%s: got UDP layer %+v", name, udp)
+		}
+	}
+}
+
+func TestDecodeCaptureJSONError(t *testing.T) {
+	var c Capture
+	if err := json.Unmarshal(DecodeCaptureJSON([]byte("not a capture")), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Error == "" || c.Packets == nil || len(c.Packets) != 0 {
+		t.Errorf("got %+v, want an error and no packets", c)
+	}
+}
+
+func TestFromLayerNested(t *testing.T) {
+	ip := &layers.IPv4{
+		Options: []layers.IPv4Option{{
+			OptionType:  layers.IPv4OptionRouterAlert,
+			RouterAlert: &layers.IPv4RouterAlertOption{Value: 1},
+		}},
+	}
+	l := FromLayer(ip, 0)
+	opts, ok := l.Fields["Options"].([]interface{})
+	if !ok || len(opts) != 1 {
+		t.Fatalf("got options %#v", l.Fields["Options"])
+	}
+	// Structs with String methods are still broken out into fields.
+	opt, ok := opts[0].(map[string]interface{})
+	if !ok {
+		t.Fatalf("got option %#v", opts[0])
+	}
+	ra, ok := opt["RouterAlert"].(map[string]interface{})
+	if !ok || ra["Value"] != uint64(1) || opt["Route"] != nil {
+		t.Errorf("got option %#v", opt)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package packetstream
+
+import (
+	"github.com/mistsys/gopacket"
+)
+
+// PacketDataSource reads the packets of a stream that requested raw data,
+// implementing gopacket.PacketDataSource, so they can be decoded with the
+// sensor's link type by a gopacket.PacketSource.
+type PacketDataSource struct {
+	stream PacketService_StreamPacketsClient
+}
+
+// NewPacketDataSource returns a source reading the packets of s.
+func NewPacketDataSource(s PacketService_StreamPacketsClient) *PacketDataSource {
+	return &PacketDataSource{stream: s}
+}
+
+// ReadPacketData returns the raw data of the next packet.  It returns
+// io.EOF if the sensor ends the stream.
+func (s *PacketDataSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	p, err := s.stream.Recv()
+	if err != nil {
+		return nil, gopacket.CaptureInfo{}, err
+	}
+	return p.Data, p.CaptureInfo(), nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package packetstream implements a gRPC service for distributed capture:
+// sensors stream the packets they capture, raw or summarized, to
+// collectors, which can also start, stop and refilter the sensors'
+// captures.
+//
+// The service and its messages are defined by packetstream.proto, from
+// which packetstream.pb.go and packetstream_grpc.pb.go are generated, so
+// clients and servers in other languages interoperate with this package.
+//
+// A sensor publishes the packets it reads to a Server:
+//
+//	srv := packetstream.NewServer(capture, handle.LinkType())
+//	g := grpc.NewServer()
+//	packetstream.RegisterPacketServiceServer(g, srv)
+//	go g.Serve(listener)
+//	for p := range gopacket.NewPacketSource(handle, handle.LinkType()).Packets() {
+//		srv.Publish(p)
+//	}
+//
+// and a collector reads them with the generated client:
+//
+//	c := packetstream.NewPacketServiceClient(conn)
+//	s, err := c.StreamPackets(ctx, &packetstream.StreamRequest{Data: true})
+//	...
+//	for {
+//		p, err := s.Recv()
+//		if err != nil {
+//			break
+//		}
+//		pkt := p.Decode(gopacket.Default)
+//		...
+//	}
+package packetstream
+
+import (
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// NewCaptureInfo returns the message form of ci.
+func NewCaptureInfo(ci gopacket.CaptureInfo) *CaptureInfo {
+	c := &CaptureInfo{
+		CaptureLength:  uint32(ci.CaptureLength),
+		Length:         uint32(ci.Length),
+		InterfaceIndex: int32(ci.InterfaceIndex),
+		Direction:      Direction(ci.Direction),
+		SensorId:       ci.Source.SensorID,
+		InterfaceName:  ci.Source.InterfaceName,
+		PortVlan:       uint32(ci.Source.PortVLAN),
+	}
+	if !ci.Timestamp.IsZero() {
+		c.Timestamp = ci.Timestamp.UnixNano()
+	}
+	return c
+}
+
+// CaptureInfo returns the packet's capture info.
+func (p *Packet) CaptureInfo() gopacket.CaptureInfo {
+	ci := p.GetInfo()
+	out := gopacket.CaptureInfo{
+		CaptureLength:  int(ci.GetCaptureLength()),
+		Length:         int(ci.GetLength()),
+		InterfaceIndex: int(ci.GetInterfaceIndex()),
+		Direction:      gopacket.CaptureDirection(ci.GetDirection()),
+		Source: gopacket.CaptureSource{
+			SensorID:      ci.GetSensorId(),
+			InterfaceName: ci.GetInterfaceName(),
+			PortVLAN:      uint16(ci.GetPortVlan()),
+		},
+	}
+	if ci.GetTimestamp() != 0 {
+		out.Timestamp = time.Unix(0, ci.GetTimestamp())
+	}
+	return out
+}
+
+// Decode decodes the packet's raw data, with its capture info as metadata.
+func (p *Packet) Decode(opts gopacket.DecodeOptions) gopacket.Packet {
+	pkt := gopacket.NewPacket(p.GetData(), layers.LinkType(p.GetLinkType()), opts)
+	md := pkt.Metadata()
+	md.CaptureInfo = p.CaptureInfo()
+	md.Truncated = md.Truncated || md.CaptureLength < md.Length
+	return pkt
+}
+
+// Summarize returns the summary of p.  Fields of layers p doesn't have are
+// left zero.
+func Summarize(p gopacket.Packet) *Summary {
+	s := &Summary{}
+	var haveLink, haveVLAN, haveNet, haveTransport bool
+	for _, l := range p.Layers() {
+		s.Layers = append(s.Layers, l.LayerType().String())
+		switch l := l.(type) {
+		case *layers.Ethernet:
+			if !haveLink {
+				s.SrcMac, s.DstMac, haveLink = l.SrcMAC, l.DstMAC, true
+			}
+		case *layers.Dot1Q:
+			if !haveVLAN {
+				s.Vlan, haveVLAN = uint32(l.VLANIdentifier), true
+			}
+		case *layers.IPv4:
+			if !haveNet {
+				s.SrcIp, s.DstIp, s.Protocol, haveNet = l.SrcIP, l.DstIP, uint32(l.Protocol), true
+			}
+		case *layers.IPv6:
+			if !haveNet {
+				s.SrcIp, s.DstIp, s.Protocol, haveNet = l.SrcIP, l.DstIP, uint32(l.NextHeader), true
+			}
+		case *layers.TCP:
+			if !haveTransport {
+				s.SrcPort, s.DstPort, haveTransport = uint32(l.SrcPort), uint32(l.DstPort), true
+				s.Protocol = uint32(layers.IPProtocolTCP)
+			}
+		case *layers.UDP:
+			if !haveTransport {
+				s.SrcPort, s.DstPort, haveTransport = uint32(l.SrcPort), uint32(l.DstPort), true
+				s.Protocol = uint32(layers.IPProtocolUDP)
+			}
+		case *layers.SCTP:
+			if !haveTransport {
+				s.SrcPort, s.DstPort, haveTransport = uint32(l.SrcPort), uint32(l.DstPort), true
+				s.Protocol = uint32(layers.IPProtocolSCTP)
+			}
+		}
+	}
+	return s
+}
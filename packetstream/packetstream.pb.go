@@ -0,0 +1,737 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// The wire contract between capture sensors and collectors.  Sensors serve
+// PacketService; collectors subscribe to packet streams and control the
+// sensors' captures.  packetstream.pb.go and packetstream_grpc.pb.go are
+// generated from this file; regenerate them after changing it, with
+//
+//   protoc --go_out=. --go_opt=paths=source_relative \
+//       --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//       packetstream.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: packetstream.proto
+
+package packetstream
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Direction int32
+
+const (
+	Direction_DIRECTION_UNKNOWN  Direction = 0
+	Direction_DIRECTION_INBOUND  Direction = 1
+	Direction_DIRECTION_OUTBOUND Direction = 2
+)
+
+// Enum value maps for Direction.
+var (
+	Direction_name = map[int32]string{
+		0: "DIRECTION_UNKNOWN",
+		1: "DIRECTION_INBOUND",
+		2: "DIRECTION_OUTBOUND",
+	}
+	Direction_value = map[string]int32{
+		"DIRECTION_UNKNOWN":  0,
+		"DIRECTION_INBOUND":  1,
+		"DIRECTION_OUTBOUND": 2,
+	}
+)
+
+func (x Direction) Enum() *Direction {
+	p := new(Direction)
+	*p = x
+	return p
+}
+
+func (x Direction) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Direction) Descriptor() protoreflect.EnumDescriptor {
+	return file_packetstream_proto_enumTypes[0].Descriptor()
+}
+
+func (Direction) Type() protoreflect.EnumType {
+	return &file_packetstream_proto_enumTypes[0]
+}
+
+func (x Direction) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Direction.Descriptor instead.
+func (Direction) EnumDescriptor() ([]byte, []int) {
+	return file_packetstream_proto_rawDescGZIP(), []int{0}
+}
+
+type ControlRequest_Action int32
+
+const (
+	ControlRequest_STATUS     ControlRequest_Action = 0
+	ControlRequest_START      ControlRequest_Action = 1
+	ControlRequest_STOP       ControlRequest_Action = 2
+	ControlRequest_SET_FILTER ControlRequest_Action = 3
+)
+
+// Enum value maps for ControlRequest_Action.
+var (
+	ControlRequest_Action_name = map[int32]string{
+		0: "STATUS",
+		1: "START",
+		2: "STOP",
+		3: "SET_FILTER",
+	}
+	ControlRequest_Action_value = map[string]int32{
+		"STATUS":     0,
+		"START":      1,
+		"STOP":       2,
+		"SET_FILTER": 3,
+	}
+)
+
+func (x ControlRequest_Action) Enum() *ControlRequest_Action {
+	p := new(ControlRequest_Action)
+	*p = x
+	return p
+}
+
+func (x ControlRequest_Action) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ControlRequest_Action) Descriptor() protoreflect.EnumDescriptor {
+	return file_packetstream_proto_enumTypes[1].Descriptor()
+}
+
+func (ControlRequest_Action) Type() protoreflect.EnumType {
+	return &file_packetstream_proto_enumTypes[1]
+}
+
+func (x ControlRequest_Action) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ControlRequest_Action.Descriptor instead.
+func (ControlRequest_Action) EnumDescriptor() ([]byte, []int) {
+	return file_packetstream_proto_rawDescGZIP(), []int{4, 0}
+}
+
+type StreamRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// data requests the raw packet data.
+	Data bool `protobuf:"varint,1,opt,name=data,proto3" json:"data,omitempty"`
+	// summary requests a summary of the decoded packet.
+	Summary bool `protobuf:"varint,2,opt,name=summary,proto3" json:"summary,omitempty"`
+	// snap_length truncates the raw packet data, if it's not 0.
+	SnapLength    uint32 `protobuf:"varint,3,opt,name=snap_length,json=snapLength,proto3" json:"snap_length,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamRequest) Reset() {
+	*x = StreamRequest{}
+	mi := &file_packetstream_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamRequest) ProtoMessage() {}
+
+func (x *StreamRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_packetstream_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamRequest.ProtoReflect.Descriptor instead.
+func (*StreamRequest) Descriptor() ([]byte, []int) {
+	return file_packetstream_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *StreamRequest) GetData() bool {
+	if x != nil {
+		return x.Data
+	}
+	return false
+}
+
+func (x *StreamRequest) GetSummary() bool {
+	if x != nil {
+		return x.Summary
+	}
+	return false
+}
+
+func (x *StreamRequest) GetSnapLength() uint32 {
+	if x != nil {
+		return x.SnapLength
+	}
+	return 0
+}
+
+type CaptureInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// timestamp is in nanoseconds since the Unix epoch.
+	Timestamp      int64     `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	CaptureLength  uint32    `protobuf:"varint,2,opt,name=capture_length,json=captureLength,proto3" json:"capture_length,omitempty"`
+	Length         uint32    `protobuf:"varint,3,opt,name=length,proto3" json:"length,omitempty"`
+	InterfaceIndex int32     `protobuf:"varint,4,opt,name=interface_index,json=interfaceIndex,proto3" json:"interface_index,omitempty"`
+	Direction      Direction `protobuf:"varint,5,opt,name=direction,proto3,enum=gopacket.packetstream.Direction" json:"direction,omitempty"`
+	SensorId       string    `protobuf:"bytes,6,opt,name=sensor_id,json=sensorId,proto3" json:"sensor_id,omitempty"`
+	InterfaceName  string    `protobuf:"bytes,7,opt,name=interface_name,json=interfaceName,proto3" json:"interface_name,omitempty"`
+	PortVlan       uint32    `protobuf:"varint,8,opt,name=port_vlan,json=portVlan,proto3" json:"port_vlan,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *CaptureInfo) Reset() {
+	*x = CaptureInfo{}
+	mi := &file_packetstream_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CaptureInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CaptureInfo) ProtoMessage() {}
+
+func (x *CaptureInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_packetstream_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CaptureInfo.ProtoReflect.Descriptor instead.
+func (*CaptureInfo) Descriptor() ([]byte, []int) {
+	return file_packetstream_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CaptureInfo) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *CaptureInfo) GetCaptureLength() uint32 {
+	if x != nil {
+		return x.CaptureLength
+	}
+	return 0
+}
+
+func (x *CaptureInfo) GetLength() uint32 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *CaptureInfo) GetInterfaceIndex() int32 {
+	if x != nil {
+		return x.InterfaceIndex
+	}
+	return 0
+}
+
+func (x *CaptureInfo) GetDirection() Direction {
+	if x != nil {
+		return x.Direction
+	}
+	return Direction_DIRECTION_UNKNOWN
+}
+
+func (x *CaptureInfo) GetSensorId() string {
+	if x != nil {
+		return x.SensorId
+	}
+	return ""
+}
+
+func (x *CaptureInfo) GetInterfaceName() string {
+	if x != nil {
+		return x.InterfaceName
+	}
+	return ""
+}
+
+func (x *CaptureInfo) GetPortVlan() uint32 {
+	if x != nil {
+		return x.PortVlan
+	}
+	return 0
+}
+
+type Summary struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// layers are the names of the packet's layers, outermost first.
+	Layers []string `protobuf:"bytes,1,rep,name=layers,proto3" json:"layers,omitempty"`
+	SrcMac []byte   `protobuf:"bytes,2,opt,name=src_mac,json=srcMac,proto3" json:"src_mac,omitempty"`
+	DstMac []byte   `protobuf:"bytes,3,opt,name=dst_mac,json=dstMac,proto3" json:"dst_mac,omitempty"`
+	// vlan is the ID of the outermost 802.1Q tag.
+	Vlan  uint32 `protobuf:"varint,4,opt,name=vlan,proto3" json:"vlan,omitempty"`
+	SrcIp []byte `protobuf:"bytes,5,opt,name=src_ip,json=srcIp,proto3" json:"src_ip,omitempty"`
+	DstIp []byte `protobuf:"bytes,6,opt,name=dst_ip,json=dstIp,proto3" json:"dst_ip,omitempty"`
+	// protocol is the IP protocol number of the transport layer.
+	Protocol      uint32 `protobuf:"varint,7,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	SrcPort       uint32 `protobuf:"varint,8,opt,name=src_port,json=srcPort,proto3" json:"src_port,omitempty"`
+	DstPort       uint32 `protobuf:"varint,9,opt,name=dst_port,json=dstPort,proto3" json:"dst_port,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Summary) Reset() {
+	*x = Summary{}
+	mi := &file_packetstream_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Summary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Summary) ProtoMessage() {}
+
+func (x *Summary) ProtoReflect() protoreflect.Message {
+	mi := &file_packetstream_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Summary.ProtoReflect.Descriptor instead.
+func (*Summary) Descriptor() ([]byte, []int) {
+	return file_packetstream_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Summary) GetLayers() []string {
+	if x != nil {
+		return x.Layers
+	}
+	return nil
+}
+
+func (x *Summary) GetSrcMac() []byte {
+	if x != nil {
+		return x.SrcMac
+	}
+	return nil
+}
+
+func (x *Summary) GetDstMac() []byte {
+	if x != nil {
+		return x.DstMac
+	}
+	return nil
+}
+
+func (x *Summary) GetVlan() uint32 {
+	if x != nil {
+		return x.Vlan
+	}
+	return 0
+}
+
+func (x *Summary) GetSrcIp() []byte {
+	if x != nil {
+		return x.SrcIp
+	}
+	return nil
+}
+
+func (x *Summary) GetDstIp() []byte {
+	if x != nil {
+		return x.DstIp
+	}
+	return nil
+}
+
+func (x *Summary) GetProtocol() uint32 {
+	if x != nil {
+		return x.Protocol
+	}
+	return 0
+}
+
+func (x *Summary) GetSrcPort() uint32 {
+	if x != nil {
+		return x.SrcPort
+	}
+	return 0
+}
+
+func (x *Summary) GetDstPort() uint32 {
+	if x != nil {
+		return x.DstPort
+	}
+	return 0
+}
+
+type Packet struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Info  *CaptureInfo           `protobuf:"bytes,1,opt,name=info,proto3" json:"info,omitempty"`
+	// link_type is the pcap link type of data.
+	LinkType      uint32   `protobuf:"varint,2,opt,name=link_type,json=linkType,proto3" json:"link_type,omitempty"`
+	Data          []byte   `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Summary       *Summary `protobuf:"bytes,4,opt,name=summary,proto3" json:"summary,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Packet) Reset() {
+	*x = Packet{}
+	mi := &file_packetstream_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Packet) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Packet) ProtoMessage() {}
+
+func (x *Packet) ProtoReflect() protoreflect.Message {
+	mi := &file_packetstream_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Packet.ProtoReflect.Descriptor instead.
+func (*Packet) Descriptor() ([]byte, []int) {
+	return file_packetstream_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Packet) GetInfo() *CaptureInfo {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+func (x *Packet) GetLinkType() uint32 {
+	if x != nil {
+		return x.LinkType
+	}
+	return 0
+}
+
+func (x *Packet) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *Packet) GetSummary() *Summary {
+	if x != nil {
+		return x.Summary
+	}
+	return nil
+}
+
+type ControlRequest struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Action ControlRequest_Action  `protobuf:"varint,1,opt,name=action,proto3,enum=gopacket.packetstream.ControlRequest_Action" json:"action,omitempty"`
+	// filter is a BPF filter expression, for SET_FILTER.
+	Filter        string `protobuf:"bytes,2,opt,name=filter,proto3" json:"filter,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ControlRequest) Reset() {
+	*x = ControlRequest{}
+	mi := &file_packetstream_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ControlRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ControlRequest) ProtoMessage() {}
+
+func (x *ControlRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_packetstream_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ControlRequest.ProtoReflect.Descriptor instead.
+func (*ControlRequest) Descriptor() ([]byte, []int) {
+	return file_packetstream_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ControlRequest) GetAction() ControlRequest_Action {
+	if x != nil {
+		return x.Action
+	}
+	return ControlRequest_STATUS
+}
+
+func (x *ControlRequest) GetFilter() string {
+	if x != nil {
+		return x.Filter
+	}
+	return ""
+}
+
+type Status struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Running bool                   `protobuf:"varint,1,opt,name=running,proto3" json:"running,omitempty"`
+	Filter  string                 `protobuf:"bytes,2,opt,name=filter,proto3" json:"filter,omitempty"`
+	// packets is the number of packets published since the sensor started,
+	// and dropped the number of them dropped for slow streams.
+	Packets uint64 `protobuf:"varint,3,opt,name=packets,proto3" json:"packets,omitempty"`
+	Dropped uint64 `protobuf:"varint,4,opt,name=dropped,proto3" json:"dropped,omitempty"`
+	// streams is the number of open packet streams.
+	Streams       uint32 `protobuf:"varint,5,opt,name=streams,proto3" json:"streams,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Status) Reset() {
+	*x = Status{}
+	mi := &file_packetstream_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Status) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Status) ProtoMessage() {}
+
+func (x *Status) ProtoReflect() protoreflect.Message {
+	mi := &file_packetstream_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Status.ProtoReflect.Descriptor instead.
+func (*Status) Descriptor() ([]byte, []int) {
+	return file_packetstream_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Status) GetRunning() bool {
+	if x != nil {
+		return x.Running
+	}
+	return false
+}
+
+func (x *Status) GetFilter() string {
+	if x != nil {
+		return x.Filter
+	}
+	return ""
+}
+
+func (x *Status) GetPackets() uint64 {
+	if x != nil {
+		return x.Packets
+	}
+	return 0
+}
+
+func (x *Status) GetDropped() uint64 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
+
+func (x *Status) GetStreams() uint32 {
+	if x != nil {
+		return x.Streams
+	}
+	return 0
+}
+
+var File_packetstream_proto protoreflect.FileDescriptor
+
+const file_packetstream_proto_rawDesc = "" +
+	"\n" +
+	"\x12packetstream.proto\x12\x15gopacket.packetstream\"^\n" +
+	"\rStreamRequest\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\bR\x04data\x12\x18\n" +
+	"\asummary\x18\x02 \x01(\bR\asummary\x12\x1f\n" +
+	"\vsnap_length\x18\x03 \x01(\rR\n" +
+	"snapLength\"\xb4\x02\n" +
+	"\vCaptureInfo\x12\x1c\n" +
+	"\ttimestamp\x18\x01 \x01(\x03R\ttimestamp\x12%\n" +
+	"\x0ecapture_length\x18\x02 \x01(\rR\rcaptureLength\x12\x16\n" +
+	"\x06length\x18\x03 \x01(\rR\x06length\x12'\n" +
+	"\x0finterface_index\x18\x04 \x01(\x05R\x0einterfaceIndex\x12>\n" +
+	"\tdirection\x18\x05 \x01(\x0e2 .gopacket.packetstream.DirectionR\tdirection\x12\x1b\n" +
+	"\tsensor_id\x18\x06 \x01(\tR\bsensorId\x12%\n" +
+	"\x0einterface_name\x18\a \x01(\tR\rinterfaceName\x12\x1b\n" +
+	"\tport_vlan\x18\b \x01(\rR\bportVlan\"\xe7\x01\n" +
+	"\aSummary\x12\x16\n" +
+	"\x06layers\x18\x01 \x03(\tR\x06layers\x12\x17\n" +
+	"\asrc_mac\x18\x02 \x01(\fR\x06srcMac\x12\x17\n" +
+	"\adst_mac\x18\x03 \x01(\fR\x06dstMac\x12\x12\n" +
+	"\x04vlan\x18\x04 \x01(\rR\x04vlan\x12\x15\n" +
+	"\x06src_ip\x18\x05 \x01(\fR\x05srcIp\x12\x15\n" +
+	"\x06dst_ip\x18\x06 \x01(\fR\x05dstIp\x12\x1a\n" +
+	"\bprotocol\x18\a \x01(\rR\bprotocol\x12\x19\n" +
+	"\bsrc_port\x18\b \x01(\rR\asrcPort\x12\x19\n" +
+	"\bdst_port\x18\t \x01(\rR\adstPort\"\xab\x01\n" +
+	"\x06Packet\x126\n" +
+	"\x04info\x18\x01 \x01(\v2\".gopacket.packetstream.CaptureInfoR\x04info\x12\x1b\n" +
+	"\tlink_type\x18\x02 \x01(\rR\blinkType\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\x128\n" +
+	"\asummary\x18\x04 \x01(\v2\x1e.gopacket.packetstream.SummaryR\asummary\"\xa9\x01\n" +
+	"\x0eControlRequest\x12D\n" +
+	"\x06action\x18\x01 \x01(\x0e2,.gopacket.packetstream.ControlRequest.ActionR\x06action\x12\x16\n" +
+	"\x06filter\x18\x02 \x01(\tR\x06filter\"9\n" +
+	"\x06Action\x12\n" +
+	"\n" +
+	"\x06STATUS\x10\x00\x12\t\n" +
+	"\x05START\x10\x01\x12\b\n" +
+	"\x04STOP\x10\x02\x12\x0e\n" +
+	"\n" +
+	"SET_FILTER\x10\x03\"\x88\x01\n" +
+	"\x06Status\x12\x18\n" +
+	"\arunning\x18\x01 \x01(\bR\arunning\x12\x16\n" +
+	"\x06filter\x18\x02 \x01(\tR\x06filter\x12\x18\n" +
+	"\apackets\x18\x03 \x01(\x04R\apackets\x12\x18\n" +
+	"\adropped\x18\x04 \x01(\x04R\adropped\x12\x18\n" +
+	"\astreams\x18\x05 \x01(\rR\astreams*Q\n" +
+	"\tDirection\x12\x15\n" +
+	"\x11DIRECTION_UNKNOWN\x10\x00\x12\x15\n" +
+	"\x11DIRECTION_INBOUND\x10\x01\x12\x16\n" +
+	"\x12DIRECTION_OUTBOUND\x10\x022\xb8\x01\n" +
+	"\rPacketService\x12V\n" +
+	"\rStreamPackets\x12$.gopacket.packetstream.StreamRequest\x1a\x1d.gopacket.packetstream.Packet0\x01\x12O\n" +
+	"\aControl\x12%.gopacket.packetstream.ControlRequest\x1a\x1d.gopacket.packetstream.StatusB*Z(github.com/mistsys/gopacket/packetstreamb\x06proto3"
+
+var (
+	file_packetstream_proto_rawDescOnce sync.Once
+	file_packetstream_proto_rawDescData []byte
+)
+
+func file_packetstream_proto_rawDescGZIP() []byte {
+	file_packetstream_proto_rawDescOnce.Do(func() {
+		file_packetstream_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_packetstream_proto_rawDesc), len(file_packetstream_proto_rawDesc)))
+	})
+	return file_packetstream_proto_rawDescData
+}
+
+var file_packetstream_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_packetstream_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_packetstream_proto_goTypes = []any{
+	(Direction)(0),             // 0: gopacket.packetstream.Direction
+	(ControlRequest_Action)(0), // 1: gopacket.packetstream.ControlRequest.Action
+	(*StreamRequest)(nil),      // 2: gopacket.packetstream.StreamRequest
+	(*CaptureInfo)(nil),        // 3: gopacket.packetstream.CaptureInfo
+	(*Summary)(nil),            // 4: gopacket.packetstream.Summary
+	(*Packet)(nil),             // 5: gopacket.packetstream.Packet
+	(*ControlRequest)(nil),     // 6: gopacket.packetstream.ControlRequest
+	(*Status)(nil),             // 7: gopacket.packetstream.Status
+}
+var file_packetstream_proto_depIdxs = []int32{
+	0, // 0: gopacket.packetstream.CaptureInfo.direction:type_name -> gopacket.packetstream.Direction
+	3, // 1: gopacket.packetstream.Packet.info:type_name -> gopacket.packetstream.CaptureInfo
+	4, // 2: gopacket.packetstream.Packet.summary:type_name -> gopacket.packetstream.Summary
+	1, // 3: gopacket.packetstream.ControlRequest.action:type_name -> gopacket.packetstream.ControlRequest.Action
+	2, // 4: gopacket.packetstream.PacketService.StreamPackets:input_type -> gopacket.packetstream.StreamRequest
+	6, // 5: gopacket.packetstream.PacketService.Control:input_type -> gopacket.packetstream.ControlRequest
+	5, // 6: gopacket.packetstream.PacketService.StreamPackets:output_type -> gopacket.packetstream.Packet
+	7, // 7: gopacket.packetstream.PacketService.Control:output_type -> gopacket.packetstream.Status
+	6, // [6:8] is the sub-list for method output_type
+	4, // [4:6] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_packetstream_proto_init() }
+func file_packetstream_proto_init() {
+	if File_packetstream_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_packetstream_proto_rawDesc), len(file_packetstream_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_packetstream_proto_goTypes,
+		DependencyIndexes: file_packetstream_proto_depIdxs,
+		EnumInfos:         file_packetstream_proto_enumTypes,
+		MessageInfos:      file_packetstream_proto_msgTypes,
+	}.Build()
+	File_packetstream_proto = out.File
+	file_packetstream_proto_goTypes = nil
+	file_packetstream_proto_depIdxs = nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package packetstream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+func testPacket(t *testing.T) gopacket.Packet {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{2, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{2, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeDot1Q,
+	}
+	vlan := &layers.Dot1Q{VLANIdentifier: 42, Type: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.IP{192, 0, 2, 1},
+		DstIP:    net.IP{192, 0, 2, 2},
+	}
+	udp := &layers.UDP{SrcPort: 5000, DstPort: 6000}
+	udp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, vlan, ip, udp, gopacket.Payload("hello")); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+	md := p.Metadata()
+	md.Timestamp = time.Unix(1000, 5)
+	md.CaptureLength = len(buf.Bytes())
+	md.Length = len(buf.Bytes())
+	md.InterfaceIndex = 2
+	md.Direction = gopacket.DirectionInbound
+	md.Source = gopacket.CaptureSource{SensorID: "sensor-1", InterfaceName: "eth0", PortVLAN: 7}
+	return p
+}
+
+func TestCaptureInfo(t *testing.T) {
+	ci := testPacket(t).Metadata().CaptureInfo
+	b, err := proto.Marshal(&Packet{Info: NewCaptureInfo(ci)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := new(Packet)
+	if err := proto.Unmarshal(b, p); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.CaptureInfo(); got != ci {
+		t.Errorf("got %+v, want %+v", got, ci)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	s := Summarize(testPacket(t))
+	want := &Summary{
+		Layers:   []string{"Ethernet", "Dot1Q", "IPv4", "UDP", "Payload"},
+		SrcMac:   []byte{2, 0, 0, 0, 0, 1},
+		DstMac:   []byte{2, 0, 0, 0, 0, 2},
+		Vlan:     42,
+		SrcIp:    []byte{192, 0, 2, 1},
+		DstIp:    []byte{192, 0, 2, 2},
+		Protocol: uint32(layers.IPProtocolUDP),
+		SrcPort:  5000,
+		DstPort:  6000,
+	}
+	if !proto.Equal(s, want) {
+		t.Errorf("got %v, want %v", s, want)
+	}
+}
+
+type testCapture struct {
+	running bool
+	filter  string
+}
+
+func (c *testCapture) Start() error { c.running = true; return nil }
+func (c *testCapture) Stop() error  { c.running = false; return nil }
+func (c *testCapture) SetFilter(expr string) error {
+	if expr == "bad" {
+		return errors.New("syntax error")
+	}
+	c.filter = expr
+	return nil
+}
+
+func TestServer(t *testing.T) {
+	capture := &testCapture{}
+	srv := NewServer(capture, layers.LinkTypeEthernet)
+	g := grpc.NewServer()
+	RegisterPacketServiceServer(g, srv)
+	l := bufconn.Listen(1 << 20)
+	go g.Serve(l)
+	defer g.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := NewPacketServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	st, err := c.Control(ctx, &ControlRequest{Action: ControlRequest_START})
+	if err != nil || !st.Running || !capture.running {
+		t.Fatalf("start: got %v, %v", st, err)
+	}
+	if st, err = c.Control(ctx, &ControlRequest{Action: ControlRequest_SET_FILTER, Filter: "udp"}); err != nil || st.Filter != "udp" || capture.filter != "udp" {
+		t.Fatalf("set filter: got %v, %v", st, err)
+	}
+	if _, err = c.Control(ctx, &ControlRequest{Action: ControlRequest_SET_FILTER, Filter: "bad"}); err == nil {
+		t.Error("bad filter accepted")
+	}
+
+	s, err := c.StreamPackets(ctx, &StreamRequest{Data: true, Summary: true, SnapLength: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for srv.Status().Streams == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	p := testPacket(t)
+	srv.Publish(p)
+	got, err := s.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci := got.CaptureInfo()
+	if !bytes.Equal(got.Data, p.Data()[:20]) || ci.CaptureLength != 20 || ci.Length != len(p.Data()) {
+		t.Errorf("got data %x, capture info %+v", got.Data, ci)
+	}
+	if ci.Source != p.Metadata().Source || !ci.Timestamp.Equal(p.Metadata().Timestamp) {
+		t.Errorf("got capture info %+v, want %+v", ci, p.Metadata().CaptureInfo)
+	}
+	if got.Summary.GetDstPort() != 6000 {
+		t.Errorf("got summary %v", got.Summary)
+	}
+	if pkt := got.Decode(gopacket.Default); pkt.Layer(layers.LayerTypeDot1Q) == nil || !pkt.Metadata().Truncated {
+		t.Errorf("decoded %v", pkt)
+	}
+	if st := srv.Status(); st.Packets != 1 || st.Dropped != 0 || st.Streams != 1 {
+		t.Errorf("got status %v", st)
+	}
+
+	srv.Publish(p)
+	data, _, err := NewPacketDataSource(s).ReadPacketData()
+	if err != nil || !bytes.Equal(data, p.Data()[:20]) {
+		t.Errorf("read packet data: got %x, %v", data, err)
+	}
+}
+
+func TestServerDropsForSlowStreams(t *testing.T) {
+	srv := NewServer(nil, layers.LinkTypeEthernet)
+	srv.StreamBuffer = 2
+	st := &serverStream{req: &StreamRequest{Summary: true}, packets: make(chan *Packet, srv.StreamBuffer)}
+	srv.streams[st] = struct{}{}
+	p := testPacket(t)
+	for i := 0; i < 5; i++ {
+		srv.Publish(p)
+	}
+	if s := srv.Status(); s.Packets != 5 || s.Dropped != 3 {
+		t.Errorf("got status %v, want 5 packets with 3 dropped", s)
+	}
+	if _, err := srv.Control(context.Background(), &ControlRequest{Action: ControlRequest_STOP}); err == nil {
+		t.Error("stopped capture without a Capture")
+	}
+}
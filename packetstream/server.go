@@ -0,0 +1,186 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package packetstream
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Capture is the capture a Server controls for collectors, such as a pcap
+// handle and the loop reading it.
+type Capture interface {
+	Start() error
+	Stop() error
+	// SetFilter replaces the capture's BPF filter.
+	SetFilter(expr string) error
+}
+
+// DefaultStreamBuffer is the default Server.StreamBuffer.
+const DefaultStreamBuffer = 1024
+
+// Server serves packets published by a sensor to the collectors streaming
+// them, and lets collectors control the sensor's capture.  It implements
+// PacketServiceServer, to be registered with a grpc.Server by
+// RegisterPacketServiceServer.
+type Server struct {
+	UnimplementedPacketServiceServer
+
+	capture  Capture
+	linkType layers.LinkType
+	// StreamBuffer is the number of packets queued for each stream.
+	// Packets for a stream further behind than that are dropped, so a slow
+	// collector doesn't hold up the capture.  Set it before serving.
+	StreamBuffer int
+	// Logger, if set, gets a Warn record for each packet dropped for a slow
+	// stream, so it should usually sample them.  Set it before serving.
+	Logger *slog.Logger
+
+	mu               sync.Mutex
+	running          bool
+	filter           string
+	packets, dropped uint64
+	streams          map[*serverStream]struct{}
+}
+
+type serverStream struct {
+	req     *StreamRequest
+	packets chan *Packet
+}
+
+// NewServer returns a server for packets of the given link type, which
+// controls c.  c may be nil if the capture can't be controlled.
+func NewServer(c Capture, linkType layers.LinkType) *Server {
+	return &Server{
+		capture:      c,
+		linkType:     linkType,
+		StreamBuffer: DefaultStreamBuffer,
+		streams:      make(map[*serverStream]struct{}),
+	}
+}
+
+// SetRunning records whether the capture is running, for captures started
+// or stopped other than through the server.
+func (s *Server) SetRunning(running bool) {
+	s.mu.Lock()
+	s.running = running
+	s.mu.Unlock()
+}
+
+// Status returns the status of the server's capture.
+func (s *Server) Status() *Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &Status{
+		Running: s.running,
+		Filter:  s.filter,
+		Packets: s.packets,
+		Dropped: s.dropped,
+		Streams: uint32(len(s.streams)),
+	}
+}
+
+// Publish sends p to every open stream.
+func (s *Server) Publish(p gopacket.Packet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.packets++
+	ci := p.Metadata().CaptureInfo
+	var data []byte
+	var summary *Summary
+	for st := range s.streams {
+		out := &Packet{Info: NewCaptureInfo(ci), LinkType: uint32(s.linkType)}
+		if st.req.Data {
+			if data == nil {
+				// The packet's data may be reused once we return.
+				data = append([]byte(nil), p.Data()...)
+			}
+			out.Data = data
+			if n := int(st.req.SnapLength); n > 0 && len(data) > n {
+				out.Data = data[:n]
+				out.Info.CaptureLength = uint32(n)
+			}
+		}
+		if st.req.Summary {
+			if summary == nil {
+				summary = Summarize(p)
+			}
+			out.Summary = summary
+		}
+		select {
+		case st.packets <- out:
+		default:
+			s.dropped++
+			if s.Logger != nil {
+				s.Logger.Warn("packetstream: stream too slow, dropping packet", "dropped", s.dropped)
+			}
+		}
+	}
+}
+
+// Control acts on the server's capture, implementing PacketServiceServer.
+func (s *Server) Control(ctx context.Context, req *ControlRequest) (*Status, error) {
+	if req.Action != ControlRequest_STATUS && s.capture == nil {
+		return nil, status.Errorf(codes.Unimplemented, "capture can't be controlled")
+	}
+	var err error
+	switch req.Action {
+	case ControlRequest_STATUS:
+	case ControlRequest_START:
+		if err = s.capture.Start(); err == nil {
+			s.SetRunning(true)
+		}
+	case ControlRequest_STOP:
+		if err = s.capture.Stop(); err == nil {
+			s.SetRunning(false)
+		}
+	case ControlRequest_SET_FILTER:
+		if err = s.capture.SetFilter(req.Filter); err == nil {
+			s.mu.Lock()
+			s.filter = req.Filter
+			s.mu.Unlock()
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown action %v", req.Action)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v: %v", req.Action, err)
+	}
+	return s.Status(), nil
+}
+
+// StreamPackets sends the packets published from now on to stream, until
+// the collector cancels it, implementing PacketServiceServer.
+func (s *Server) StreamPackets(req *StreamRequest, stream grpc.ServerStreamingServer[Packet]) error {
+	st := &serverStream{req: req, packets: make(chan *Packet, s.StreamBuffer)}
+	s.mu.Lock()
+	s.streams[st] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, st)
+		s.mu.Unlock()
+	}()
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case p := <-st.packets:
+			if err := stream.Send(p); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -51,6 +51,8 @@ type DecodingLayerParser struct {
 	// Truncated is set when a decode layer detects that the packet has been
 	// truncated.
 	Truncated bool
+	// Warnings holds the warnings decode layers reported for the last packet.
+	Warnings []error
 }
 
 // AddDecodingLayer adds a decoding layer to the parser.  This adds support for
@@ -69,6 +71,12 @@ func (l *DecodingLayerParser) SetTruncated() {
 	l.Truncated = true
 }
 
+// AddWarning is used by DecodingLayers to add to Warnings, which is reset by
+// each call to DecodeLayers.
+func (l *DecodingLayerParser) AddWarning(err error) {
+	l.Warnings = append(l.Warnings, err)
+}
+
 // NewDecodingLayerParser creates a new DecodingLayerParser and adds in all
 // of the given DecodingLayers with AddDecodingLayer.
 //
@@ -150,6 +158,7 @@ func NewDecodingLayerParser(first LayerType, decoders ...DecodingLayer) *Decodin
 // error UnsupportedLayerType.
 func (l *DecodingLayerParser) DecodeLayers(data []byte, decoded *[]LayerType) (err error) {
 	l.Truncated = false
+	l.Warnings = nil
 	if !l.IgnorePanic {
 		defer panicToError(&err)
 	}
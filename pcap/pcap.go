@@ -353,6 +353,7 @@ func (p *Handle) getNextBufPtrLocked(ci *gopacket.CaptureInfo) error {
 	ci.CaptureLength = int(p.pkthdr.caplen)
 	ci.Length = int(p.pkthdr.len)
 	ci.InterfaceIndex = p.deviceIndex
+	ci.Source.InterfaceName = p.device
 	return nil
 }
 
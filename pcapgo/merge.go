@@ -0,0 +1,215 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package pcapgo
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// PacketReader is a source of packet data with a link type, such as a
+// Reader or an NgReader.
+type PacketReader interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+}
+
+// NewAnyReader returns a Reader or an NgReader for r, depending on whether
+// it holds pcap or pcapng data.
+func NewAnyReader(r io.Reader) (PacketReader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(magic) == ngBlockSectionHeader {
+		return NewNgReader(br)
+	}
+	return NewReader(br)
+}
+
+// MergeSource is one input to a MergeReader.
+type MergeSource struct {
+	// Name identifies the source in errors, for example a file name or a
+	// sensor ID.
+	Name   string
+	Reader PacketReader
+	// Offset is added to the timestamp of every packet from this source,
+	// to correct for the skew of the clock that captured it.
+	Offset time.Duration
+	// CaptureSource fills in the parts of CaptureInfo.Source that the
+	// reader leaves unset, such as the sensor that captured the file.
+	CaptureSource gopacket.CaptureSource
+}
+
+// mergeHead is the next packet from a source.
+type mergeHead struct {
+	source int
+	data   []byte
+	ci     gopacket.CaptureInfo
+	lt     layers.LinkType
+}
+
+type mergeHeap []*mergeHead
+
+func (h mergeHeap) Len() int      { return len(h) }
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h mergeHeap) Less(i, j int) bool {
+	if !h[i].ci.Timestamp.Equal(h[j].ci.Timestamp) {
+		return h[i].ci.Timestamp.Before(h[j].ci.Timestamp)
+	}
+	return h[i].source < h[j].source
+}
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*mergeHead)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// MergeReader merges packets from several sources into timestamp order,
+// the way mergecap does, but keeping track of which source every packet
+// came from, both through Source and in CaptureInfo.Source.  Sources may have different link types; NextPacket decodes
+// each packet with its own.  Packets with equal timestamps are returned in
+// source order, and each source's packets are assumed to be in order
+// already.
+//
+//	r1, _ := pcapgo.NewAnyReader(f1)
+//	r2, _ := pcapgo.NewAnyReader(f2)
+//	m, err := pcapgo.NewMergeReader(
+//	  pcapgo.MergeSource{Name: "core", Reader: r1},
+//	  pcapgo.MergeSource{Name: "edge", Reader: r2, Offset: -150 * time.Millisecond})
+//	for {
+//	  p, err := m.NextPacket()
+//	  ...
+//	  fmt.Println(m.SourceName(), p)
+//	}
+type MergeReader struct {
+	sources []MergeSource
+	dropped []bool
+	heads   mergeHeap
+	last    int
+	// DecodeOptions are used by NextPacket.
+	DecodeOptions gopacket.DecodeOptions
+}
+
+// NewMergeReader returns a reader merging the given sources, reading the
+// first packet of each.
+func NewMergeReader(sources ...MergeSource) (*MergeReader, error) {
+	m := &MergeReader{
+		sources:       sources,
+		dropped:       make([]bool, len(sources)),
+		last:          -1,
+		DecodeOptions: gopacket.Default,
+	}
+	for i := range sources {
+		if err := m.advance(i); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// advance reads the next packet of source i onto the heap.  At the end of
+// a source, or after an error, the source is dropped.
+func (m *MergeReader) advance(i int) error {
+	if m.dropped[i] {
+		return nil
+	}
+	s := m.sources[i]
+	data, ci, err := s.Reader.ReadPacketData()
+	if err != nil {
+		m.dropped[i] = true
+		if err == io.EOF {
+			return nil
+		}
+		return fmt.Errorf("merge source %s: %v", s.Name, err)
+	}
+	ci.Timestamp = ci.Timestamp.Add(s.Offset)
+	ci.Source.Merge(s.CaptureSource)
+	lt := s.Reader.LinkType()
+	if ng, ok := s.Reader.(*NgReader); ok && ci.InterfaceIndex < len(ng.interfaces) {
+		lt = ng.interfaces[ci.InterfaceIndex].LinkType
+	}
+	heap.Push(&m.heads, &mergeHead{
+		source: i,
+		data:   append([]byte(nil), data...),
+		ci:     ci,
+		lt:     lt,
+	})
+	return nil
+}
+
+// ReadPacketData returns the earliest packet remaining in any source,
+// implementing gopacket.PacketDataSource.  It returns io.EOF once every
+// source is exhausted.  If a source returns an error, the error is
+// returned and that source is dropped, so reading can carry on with the
+// others.
+func (m *MergeReader) ReadPacketData() (data []byte, ci gopacket.CaptureInfo, err error) {
+	h, err := m.next()
+	if err != nil {
+		return nil, ci, err
+	}
+	return h.data, h.ci, nil
+}
+
+func (m *MergeReader) next() (*mergeHead, error) {
+	if len(m.heads) == 0 {
+		return nil, io.EOF
+	}
+	h := heap.Pop(&m.heads).(*mergeHead)
+	if err := m.advance(h.source); err != nil {
+		// Return h on the next call.
+		heap.Push(&m.heads, h)
+		return nil, err
+	}
+	m.last = h.source
+	return h, nil
+}
+
+// NextPacket returns the earliest packet remaining in any source, decoded
+// with its source's link type.
+func (m *MergeReader) NextPacket() (gopacket.Packet, error) {
+	h, err := m.next()
+	if err != nil {
+		return nil, err
+	}
+	p := gopacket.NewPacket(h.data, h.lt, m.DecodeOptions)
+	md := p.Metadata()
+	// Keep what decoding found in the packet unless the source knows better,
+	// as gopacket.PacketSource does.
+	dir, ifindex := md.Direction, md.InterfaceIndex
+	md.CaptureInfo = h.ci
+	if md.Direction == gopacket.DirectionUnknown {
+		md.Direction = dir
+	}
+	if md.InterfaceIndex == 0 {
+		md.InterfaceIndex = ifindex
+	}
+	md.Truncated = md.Truncated || h.ci.CaptureLength < h.ci.Length
+	return p, nil
+}
+
+// Source returns the index of the source of the last packet returned, or
+// -1 if none has been.
+func (m *MergeReader) Source() int { return m.last }
+
+// SourceName returns the name of the source of the last packet returned.
+func (m *MergeReader) SourceName() string {
+	if m.last < 0 {
+		return ""
+	}
+	return m.sources[m.last].Name
+}
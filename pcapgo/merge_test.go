@@ -0,0 +1,126 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package pcapgo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+func TestMergeReader(t *testing.T) {
+	base := time.Unix(1000, 0)
+	ci := func(ms int) gopacket.CaptureInfo {
+		return gopacket.CaptureInfo{Timestamp: base.Add(time.Duration(ms) * time.Millisecond), CaptureLength: 1, Length: 1}
+	}
+
+	var pcapBuf bytes.Buffer
+	w := NewWriter(&pcapBuf)
+	if err := w.WriteFileHeader(65536, layers.LinkTypeRaw); err != nil {
+		t.Fatal(err)
+	}
+	for _, ms := range []int{0, 20, 40} {
+		if err := w.WritePacket(ci(ms), []byte{byte(ms)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ngBuf bytes.Buffer
+	nw, err := NewNgWriter(&ngBuf, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ms := range []int{110, 130} {
+		if err := nw.WritePacket(ci(ms), []byte{byte(ms)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r1, err := NewAnyReader(&pcapBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := NewAnyReader(&ngBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r2.(*NgReader); !ok {
+		t.Fatalf("got %T for pcapng data", r2)
+	}
+	m, err := NewMergeReader(
+		MergeSource{Name: "a", Reader: r1},
+		MergeSource{Name: "b", Reader: r2, Offset: -100 * time.Millisecond, CaptureSource: gopacket.CaptureSource{SensorID: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []struct {
+		data   byte
+		source string
+		ms     int
+		lt     layers.LinkType
+	}{
+		{0, "a", 0, layers.LinkTypeRaw},
+		{110, "b", 10, layers.LinkTypeEthernet},
+		{20, "a", 20, layers.LinkTypeRaw},
+		{130, "b", 30, layers.LinkTypeEthernet},
+		{40, "a", 40, layers.LinkTypeRaw},
+	} {
+		if lt := m.heads[0].lt; lt != want.lt {
+			t.Errorf("packet %d has link type %v, want %v", want.data, lt, want.lt)
+		}
+		p, err := m.NextPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sensor := p.Metadata().Source.SensorID
+		if want.source == "a" && sensor != "" || want.source == "b" && sensor != "b" {
+			t.Errorf("packet %d: got sensor %q", want.data, sensor)
+		}
+		if p.Data()[0] != want.data || m.SourceName() != want.source || !p.Metadata().Timestamp.Equal(ci(want.ms).Timestamp) {
+			t.Errorf("got packet %d from %s at %v, want %d from %s", p.Data()[0], m.SourceName(), p.Metadata().Timestamp, want.data, want.source)
+		}
+	}
+	if _, err := m.NextPacket(); err != io.EOF {
+		t.Errorf("got %v at end, want EOF", err)
+	}
+}
+
+type errReader struct {
+	n int
+}
+
+func (r *errReader) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	r.n++
+	if r.n > 1 {
+		return nil, gopacket.CaptureInfo{}, errors.New("broken")
+	}
+	return []byte{9}, gopacket.CaptureInfo{Timestamp: time.Unix(5, 0), CaptureLength: 1, Length: 1}, nil
+}
+
+func (r *errReader) LinkType() layers.LinkType { return layers.LinkTypeRaw }
+
+func TestMergeReaderError(t *testing.T) {
+	m, err := NewMergeReader(MergeSource{Name: "bad", Reader: &errReader{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.ReadPacketData(); err == nil {
+		t.Error("expected error from broken source")
+	}
+	// The packet read before the error isn't lost.
+	if data, _, err := m.ReadPacketData(); err != nil || data[0] != 9 {
+		t.Errorf("got %x, %v", data, err)
+	}
+	if _, _, err := m.ReadPacketData(); err != io.EOF {
+		t.Errorf("got %v, want EOF", err)
+	}
+}
@@ -0,0 +1,420 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package pcapgo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// pcapng block types.  See
+// https://github.com/pcapng/pcapng for the file format.
+const (
+	ngBlockSectionHeader        = 0x0A0D0D0A
+	ngBlockInterfaceDescription = 0x00000001
+	ngBlockSimplePacket         = 0x00000003
+	ngBlockEnhancedPacket       = 0x00000006
+	ngBlockDecryptionSecrets    = 0x0000000A
+
+	ngByteOrderMagic = 0x1A2B3C4D
+
+	// ngMaxBlockSize bounds the blocks we're willing to read, so a corrupt
+	// length can't make us allocate without limit.
+	ngMaxBlockSize = 16 * 1024 * 1024
+)
+
+// pcapng option codes.
+const (
+	ngOptEndOfOptions   = 0
+	ngOptComment        = 1
+	ngOptIfName         = 2
+	ngOptIfDescription  = 3
+	ngOptIfTSResolution = 9
+	ngOptEPBFlags       = 2
+)
+
+// NgSecretsType identifies the kind of keys held by a pcapng Decryption
+// Secrets Block.
+type NgSecretsType uint32
+
+const (
+	// NgSecretsTLSKeyLog is an NSS key log, as written by SSLKEYLOGFILE.
+	NgSecretsTLSKeyLog NgSecretsType = 0x544c534b
+	// NgSecretsSSHKeyLog is an SSH key log.
+	NgSecretsSSHKeyLog NgSecretsType = 0x5353484b
+	// NgSecretsWireGuardKeyLog is a WireGuard key log.
+	NgSecretsWireGuardKeyLog NgSecretsType = 0x57474b4c
+	// NgSecretsZigBeeNWKKey is a ZigBee network key.
+	NgSecretsZigBeeNWKKey NgSecretsType = 0x5a4e574b
+	// NgSecretsZigBeeAPSKey is a ZigBee APS key.
+	NgSecretsZigBeeAPSKey NgSecretsType = 0x5a415053
+)
+
+func (t NgSecretsType) String() string {
+	switch t {
+	case NgSecretsTLSKeyLog:
+		return "TLSKeyLog"
+	case NgSecretsSSHKeyLog:
+		return "SSHKeyLog"
+	case NgSecretsWireGuardKeyLog:
+		return "WireGuardKeyLog"
+	case NgSecretsZigBeeNWKKey:
+		return "ZigBeeNWKKey"
+	case NgSecretsZigBeeAPSKey:
+		return "ZigBeeAPSKey"
+	}
+	return fmt.Sprintf("UnknownNgSecretsType(%#x)", uint32(t))
+}
+
+// NgSecrets is the content of a pcapng Decryption Secrets Block.
+type NgSecrets struct {
+	Type NgSecretsType
+	Data []byte
+}
+
+// NgInterface is a capture interface described by a pcapng Interface
+// Description Block.
+type NgInterface struct {
+	Name        string
+	Description string
+	LinkType    layers.LinkType
+	SnapLength  uint32
+	// TimestampResolution is the if_tsresol option: the timestamp unit is
+	// 10^-n seconds, or 2^-n seconds if the most significant bit is set.
+	// The default is 6, microseconds.
+	TimestampResolution uint8
+}
+
+// NgReader reads packet data in pcapng format.  It handles files with
+// several sections and interfaces, and collects the decryption secrets
+// found along the way.  Block types it doesn't know are skipped.
+type NgReader struct {
+	r          *bufio.Reader
+	byteOrder  binary.ByteOrder
+	interfaces []NgInterface
+	secrets    []NgSecrets
+	// SecretsHandler, if set, is called by ReadPacketData with each
+	// Decryption Secrets Block, before any of the packets it applies to are
+	// returned.  This is how keys reach decryption code that's decoding
+	// the packets.
+	SecretsHandler func(NgSecrets)
+	handled        int
+	buf            []byte
+}
+
+// NewNgReader returns a reader for pcapng data, reading the first section
+// header from r.
+//
+//	// Read a pcapng file, passing TLS keys to a decryptor as they appear:
+//	f, _ := os.Open("/tmp/file.pcapng")
+//	defer f.Close()
+//	r, err := NewNgReader(f)
+//	r.SecretsHandler = func(s NgSecrets) { ... }
+//	data, ci, err := r.ReadPacketData()
+func NewNgReader(r io.Reader) (*NgReader, error) {
+	ret := &NgReader{r: bufio.NewReader(r)}
+	if _, _, err := ret.readBlock(); err != nil {
+		return nil, err
+	}
+	// Read up to the first interface, so LinkType works straight away.
+	for len(ret.interfaces) == 0 {
+		typ, body, err := ret.readBlock()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case ngBlockInterfaceDescription:
+			err = ret.readInterface(body)
+		case ngBlockDecryptionSecrets:
+			err = ret.readSecrets(body)
+		case ngBlockEnhancedPacket, ngBlockSimplePacket:
+			err = errors.New("pcapng packet before any interface description")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// readBlock reads the next block, returning its type and body.  A section
+// header sets the byte order for the blocks that follow it.
+func (r *NgReader) readBlock() (typ uint32, body []byte, err error) {
+	var hdr [12]byte
+	if _, err = io.ReadFull(r.r, hdr[:8]); err != nil {
+		return
+	}
+	if binary.LittleEndian.Uint32(hdr[:4]) == ngBlockSectionHeader {
+		if _, err = io.ReadFull(r.r, hdr[8:12]); err != nil {
+			return 0, nil, noEOF(err)
+		}
+		switch magic := binary.LittleEndian.Uint32(hdr[8:12]); magic {
+		case ngByteOrderMagic:
+			r.byteOrder = binary.LittleEndian
+		case 0x4D3C2B1A:
+			r.byteOrder = binary.BigEndian
+		default:
+			return 0, nil, fmt.Errorf("Unknown pcapng byte order magic %x", magic)
+		}
+		r.interfaces = r.interfaces[:0]
+	} else if r.byteOrder == nil {
+		return 0, nil, errors.New("pcapng data doesn't start with a section header")
+	}
+	typ = r.byteOrder.Uint32(hdr[:4])
+	length := r.byteOrder.Uint32(hdr[4:8])
+	if length < 12 || length%4 != 0 || length > ngMaxBlockSize {
+		return 0, nil, fmt.Errorf("Invalid pcapng block length %d", length)
+	}
+	if cap(r.buf) < int(length) {
+		r.buf = make([]byte, length)
+	}
+	block := r.buf[:length]
+	n := copy(block, hdr[:8])
+	if typ == ngBlockSectionHeader {
+		n += copy(block[8:], hdr[8:12])
+	}
+	if _, err = io.ReadFull(r.r, block[n:]); err != nil {
+		return 0, nil, noEOF(err)
+	}
+	if trailer := r.byteOrder.Uint32(block[length-4:]); trailer != length {
+		return 0, nil, fmt.Errorf("pcapng block length %d doesn't match trailing length %d", length, trailer)
+	}
+	body = block[8 : length-4]
+	if typ == ngBlockSectionHeader {
+		if len(body) < 16 {
+			return 0, nil, errors.New("pcapng section header too short")
+		}
+		if major := r.byteOrder.Uint16(body[4:6]); major != 1 {
+			return 0, nil, fmt.Errorf("Unknown pcapng major version %d", major)
+		}
+	}
+	return typ, body, nil
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF, for reads in the middle of
+// a block.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// ngOptions calls f with the code and value of each option in data.
+func (r *NgReader) ngOptions(data []byte, f func(code uint16, value []byte)) error {
+	for len(data) >= 4 {
+		code, length := r.byteOrder.Uint16(data[:2]), int(r.byteOrder.Uint16(data[2:4]))
+		if code == ngOptEndOfOptions {
+			return nil
+		}
+		padded := (length + 3) &^ 3
+		if len(data) < 4+length {
+			return fmt.Errorf("pcapng option %d truncated", code)
+		}
+		f(code, data[4:4+length])
+		if len(data) < 4+padded {
+			return nil
+		}
+		data = data[4+padded:]
+	}
+	return nil
+}
+
+func (r *NgReader) readInterface(body []byte) error {
+	if len(body) < 8 {
+		return errors.New("pcapng interface description too short")
+	}
+	i := NgInterface{
+		LinkType:            layers.LinkType(r.byteOrder.Uint16(body[:2])),
+		SnapLength:          r.byteOrder.Uint32(body[4:8]),
+		TimestampResolution: 6,
+	}
+	err := r.ngOptions(body[8:], func(code uint16, value []byte) {
+		switch code {
+		case ngOptIfName:
+			i.Name = string(value)
+		case ngOptIfDescription:
+			i.Description = string(value)
+		case ngOptIfTSResolution:
+			if len(value) > 0 {
+				i.TimestampResolution = value[0]
+			}
+		}
+	})
+	r.interfaces = append(r.interfaces, i)
+	return err
+}
+
+func (r *NgReader) readSecrets(body []byte) error {
+	if len(body) < 8 {
+		return errors.New("pcapng decryption secrets block too short")
+	}
+	length := r.byteOrder.Uint32(body[4:8])
+	if uint64(length) > uint64(len(body)-8) {
+		return fmt.Errorf("pcapng decryption secrets length %d exceeds block", length)
+	}
+	s := NgSecrets{
+		Type: NgSecretsType(r.byteOrder.Uint32(body[:4])),
+		Data: append([]byte(nil), body[8:8+length]...),
+	}
+	r.secrets = append(r.secrets, s)
+	return nil
+}
+
+// handleSecrets passes secrets not yet seen by SecretsHandler to it.
+func (r *NgReader) handleSecrets() {
+	if r.SecretsHandler == nil {
+		return
+	}
+	for ; r.handled < len(r.secrets); r.handled++ {
+		r.SecretsHandler(r.secrets[r.handled])
+	}
+}
+
+// ngTimestamp converts a timestamp in units of the interface's resolution
+// into a time.
+func ngTimestamp(ts uint64, resolution uint8) time.Time {
+	if resolution&0x80 != 0 {
+		shift := uint(resolution & 0x7f)
+		if shift >= 64 {
+			return time.Unix(0, 0).UTC()
+		}
+		frac := ts & (1<<shift - 1)
+		return time.Unix(int64(ts>>shift), int64(float64(frac)*1e9/float64(uint64(1)<<shift))).UTC()
+	}
+	var unit uint64 = 1
+	for i := uint8(0); i < resolution && unit <= 1e18; i++ {
+		unit *= 10
+	}
+	secs, frac := ts/unit, ts%unit
+	var nanos uint64
+	if unit <= 1e9 {
+		nanos = frac * (1e9 / unit)
+	} else {
+		nanos = frac / (unit / 1e9)
+	}
+	return time.Unix(int64(secs), int64(nanos)).UTC()
+}
+
+// ReadPacketData returns the next packet, reading and handling any other
+// blocks that come before it.  CaptureInfo.InterfaceIndex is the index of
+// the packet's interface within its section, Source.InterfaceName is the
+// interface's name, and Direction is set from the enhanced packet block's
+// flags.  The data is only valid until the next
+// call.
+func (r *NgReader) ReadPacketData() (data []byte, ci gopacket.CaptureInfo, err error) {
+	for {
+		r.handleSecrets()
+		var typ uint32
+		var body []byte
+		if typ, body, err = r.readBlock(); err != nil {
+			return
+		}
+		switch typ {
+		case ngBlockInterfaceDescription:
+			if err = r.readInterface(body); err != nil {
+				return
+			}
+		case ngBlockDecryptionSecrets:
+			if err = r.readSecrets(body); err != nil {
+				return
+			}
+		case ngBlockEnhancedPacket:
+			r.handleSecrets()
+			return r.readEnhancedPacket(body)
+		case ngBlockSimplePacket:
+			r.handleSecrets()
+			return r.readSimplePacket(body)
+		}
+	}
+}
+
+func (r *NgReader) readEnhancedPacket(body []byte) (data []byte, ci gopacket.CaptureInfo, err error) {
+	if len(body) < 20 {
+		err = errors.New("pcapng enhanced packet block too short")
+		return
+	}
+	id := int(r.byteOrder.Uint32(body[:4]))
+	if id >= len(r.interfaces) {
+		err = fmt.Errorf("pcapng packet for undescribed interface %d", id)
+		return
+	}
+	ts := uint64(r.byteOrder.Uint32(body[4:8]))<<32 | uint64(r.byteOrder.Uint32(body[8:12]))
+	ci.Timestamp = ngTimestamp(ts, r.interfaces[id].TimestampResolution)
+	ci.CaptureLength = int(r.byteOrder.Uint32(body[12:16]))
+	ci.Length = int(r.byteOrder.Uint32(body[16:20]))
+	ci.InterfaceIndex = id
+	ci.Source.InterfaceName = r.interfaces[id].Name
+	if ci.CaptureLength > len(body)-20 {
+		err = fmt.Errorf("pcapng capture length %d exceeds block", ci.CaptureLength)
+		return
+	}
+	data = body[20 : 20+ci.CaptureLength]
+	var opts []byte
+	if end := 20 + (ci.CaptureLength+3)&^3; end < len(body) {
+		opts = body[end:]
+	}
+	err = r.ngOptions(opts, func(code uint16, value []byte) {
+		if code == ngOptEPBFlags && len(value) == 4 {
+			switch r.byteOrder.Uint32(value) & 0x3 {
+			case 1:
+				ci.Direction = gopacket.DirectionInbound
+			case 2:
+				ci.Direction = gopacket.DirectionOutbound
+			}
+		}
+	})
+	return
+}
+
+func (r *NgReader) readSimplePacket(body []byte) (data []byte, ci gopacket.CaptureInfo, err error) {
+	if len(r.interfaces) == 0 {
+		err = errors.New("pcapng simple packet before any interface description")
+		return
+	}
+	if len(body) < 4 {
+		err = errors.New("pcapng simple packet block too short")
+		return
+	}
+	ci.Length = int(r.byteOrder.Uint32(body[:4]))
+	ci.CaptureLength = ci.Length
+	if snap := int(r.interfaces[0].SnapLength); snap > 0 && ci.CaptureLength > snap {
+		ci.CaptureLength = snap
+	}
+	if ci.CaptureLength > len(body)-4 {
+		ci.CaptureLength = len(body) - 4
+	}
+	data = body[4 : 4+ci.CaptureLength]
+	return
+}
+
+// LinkType returns the link type of the first interface of the current
+// section, or LinkTypeNull if none has been read yet.
+func (r *NgReader) LinkType() layers.LinkType {
+	if len(r.interfaces) == 0 {
+		return layers.LinkTypeNull
+	}
+	return r.interfaces[0].LinkType
+}
+
+// Interfaces returns the interfaces described so far in the current
+// section.
+func (r *NgReader) Interfaces() []NgInterface {
+	return append([]NgInterface(nil), r.interfaces...)
+}
+
+// DecryptionSecrets returns every Decryption Secrets Block read so far.
+func (r *NgReader) DecryptionSecrets() []NgSecrets {
+	return append([]NgSecrets(nil), r.secrets...)
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package pcapgo
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+func TestNgWriteRead(t *testing.T) {
+	keyLog := []byte("CLIENT_RANDOM 0102 0304\n")
+	var buf bytes.Buffer
+	w, err := NewNgWriter(&buf, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, err := w.AddInterface(NgInterface{Name: "wlan0", LinkType: layers.LinkTypeIEEE80211Radio, SnapLength: 2048}); err != nil || i != 1 {
+		t.Fatalf("got interface %d, error %v", i, err)
+	}
+	if err := w.WriteDecryptionSecrets(NgSecrets{Type: NgSecretsTLSKeyLog, Data: keyLog}); err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Unix(1000, 123456789).UTC()
+	cis := []gopacket.CaptureInfo{
+		{Timestamp: ts, CaptureLength: 3, Length: 3, Direction: gopacket.DirectionOutbound},
+		{Timestamp: ts.Add(time.Second), CaptureLength: 4, Length: 60, InterfaceIndex: 1, Source: gopacket.CaptureSource{InterfaceName: "wlan0"}},
+	}
+	datas := [][]byte{{1, 2, 3}, {4, 5, 6, 7}}
+	if err := w.WritePacketComment(cis[0], datas[0], "first packet"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WritePacket(cis[1], datas[1]); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("first packet")) {
+		t.Error("packet comment not written")
+	}
+	if err := w.WritePacket(gopacket.CaptureInfo{CaptureLength: 1, Length: 1, InterfaceIndex: 2}, []byte{0}); err == nil {
+		t.Error("expected error writing packet for unknown interface")
+	}
+
+	r, err := NewNgReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.LinkType() != layers.LinkTypeEthernet {
+		t.Errorf("got link type %v", r.LinkType())
+	}
+	var handled []NgSecrets
+	r.SecretsHandler = func(s NgSecrets) { handled = append(handled, s) }
+	for i, want := range cis {
+		data, ci, err := r.ReadPacketData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(handled) != 1 || handled[0].Type != NgSecretsTLSKeyLog || !bytes.Equal(handled[0].Data, keyLog) {
+			t.Errorf("packet %d: handled secrets %+v", i, handled)
+		}
+		if !reflect.DeepEqual(ci, want) || !bytes.Equal(data, datas[i]) {
+			t.Errorf("packet %d: got %+v %x, want %+v %x", i, ci, data, want, datas[i])
+		}
+	}
+	if _, _, err := r.ReadPacketData(); err != io.EOF {
+		t.Errorf("got error %v at end, want EOF", err)
+	}
+	if ifs := r.Interfaces(); len(ifs) != 2 || ifs[1].Name != "wlan0" || ifs[1].SnapLength != 2048 || ifs[1].TimestampResolution != 9 {
+		t.Errorf("got interfaces %+v", ifs)
+	}
+	if s := r.DecryptionSecrets(); len(s) != 1 {
+		t.Errorf("got secrets %+v", s)
+	}
+}
+
+func TestNgReadBigEndian(t *testing.T) {
+	data := []byte{
+		// Section header
+		0x0a, 0x0d, 0x0d, 0x0a, 0x00, 0x00, 0x00, 0x1c, 0x1a, 0x2b, 0x3c, 0x4d,
+		0x00, 0x01, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x00, 0x00, 0x00, 0x1c,
+		// Interface description, link type 1, default microsecond resolution
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x14, 0x00, 0x01, 0x00, 0x00,
+		0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x00, 0x14,
+		// Simple packet
+		0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x14, 0x00, 0x00, 0x00, 0x02,
+		0xab, 0xcd, 0x00, 0x00, 0x00, 0x00, 0x00, 0x14,
+	}
+	r, err := NewNgReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.LinkType() != layers.LinkTypeEthernet {
+		t.Errorf("got link type %v", r.LinkType())
+	}
+	pkt, ci, err := r.ReadPacketData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pkt, []byte{0xab, 0xcd}) || ci.Length != 2 {
+		t.Errorf("got %x %+v", pkt, ci)
+	}
+
+	data[len(data)-1] = 0x10
+	r, _ = NewNgReader(bytes.NewReader(data))
+	if _, _, err := r.ReadPacketData(); err == nil {
+		t.Error("expected error for mismatched trailing length")
+	}
+}
+
+func TestNgTimestamp(t *testing.T) {
+	for _, test := range []struct {
+		ts         uint64
+		resolution uint8
+		want       time.Time
+	}{
+		{1000000001, 6, time.Unix(1000, 1000)},
+		{1000000000001, 9, time.Unix(1000, 1)},
+		{10001, 1, time.Unix(1000, 100000000)},
+		{1000<<10 | 512, 0x8a, time.Unix(1000, 500000000)},
+	} {
+		if got := ngTimestamp(test.ts, test.resolution); !got.Equal(test.want) {
+			t.Errorf("ngTimestamp(%d, %#x) = %v, want %v", test.ts, test.resolution, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package pcapgo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// NgWriter writes packet data in pcapng format, with nanosecond
+// timestamps and little-endian encoding.
+type NgWriter struct {
+	w          io.Writer
+	interfaces int
+}
+
+// NewNgWriter writes a section header and a description of one interface
+// with the given link type to w, and returns a writer for packets captured
+// on it.  More interfaces can be added with AddInterface.
+//
+//	// Write a pcapng file with the TLS keys needed to decrypt it:
+//	f, _ := os.Create("/tmp/file.pcapng")
+//	w, _ := pcapgo.NewNgWriter(f, layers.LinkTypeEthernet)
+//	w.WriteDecryptionSecrets(pcapgo.NgSecrets{Type: pcapgo.NgSecretsTLSKeyLog, Data: keyLog})
+//	w.WritePacket(gopacket.CaptureInfo{...}, data1)
+//	f.Close()
+func NewNgWriter(w io.Writer, linkType layers.LinkType) (*NgWriter, error) {
+	ret := &NgWriter{w: w}
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:4], ngByteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:6], 1)
+	binary.LittleEndian.PutUint16(shb[6:8], 0)
+	// The section length is unknown.
+	binary.LittleEndian.PutUint64(shb[8:16], 0xffffffffffffffff)
+	if err := ret.writeBlock(ngBlockSectionHeader, shb); err != nil {
+		return nil, err
+	}
+	if _, err := ret.AddInterface(NgInterface{LinkType: linkType}); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// writeBlock writes a block with the given body, padding it to 32 bits.
+func (w *NgWriter) writeBlock(typ uint32, body []byte) error {
+	padded := (len(body) + 3) &^ 3
+	buf := make([]byte, 12+padded)
+	binary.LittleEndian.PutUint32(buf[0:4], typ)
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(buf)))
+	copy(buf[8:], body)
+	binary.LittleEndian.PutUint32(buf[len(buf)-4:], uint32(len(buf)))
+	_, err := w.w.Write(buf)
+	return err
+}
+
+// appendNgOption appends an option, padded to 32 bits.
+func appendNgOption(b []byte, code uint16, value []byte) []byte {
+	var hdr [4]byte
+	binary.LittleEndian.PutUint16(hdr[0:2], code)
+	binary.LittleEndian.PutUint16(hdr[2:4], uint16(len(value)))
+	b = append(b, hdr[:]...)
+	b = append(b, value...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// AddInterface writes a description of another interface and returns its
+// index, for use as CaptureInfo.InterfaceIndex.  The interface's
+// TimestampResolution is ignored, as the writer always uses nanoseconds.
+func (w *NgWriter) AddInterface(i NgInterface) (int, error) {
+	body := make([]byte, 8, 32)
+	binary.LittleEndian.PutUint16(body[0:2], uint16(i.LinkType))
+	binary.LittleEndian.PutUint32(body[4:8], i.SnapLength)
+	if i.Name != "" {
+		body = appendNgOption(body, ngOptIfName, []byte(i.Name))
+	}
+	if i.Description != "" {
+		body = appendNgOption(body, ngOptIfDescription, []byte(i.Description))
+	}
+	body = appendNgOption(body, ngOptIfTSResolution, []byte{9})
+	body = appendNgOption(body, ngOptEndOfOptions, nil)
+	if err := w.writeBlock(ngBlockInterfaceDescription, body); err != nil {
+		return 0, err
+	}
+	w.interfaces++
+	return w.interfaces - 1, nil
+}
+
+// WriteDecryptionSecrets writes a Decryption Secrets Block.  Readers such
+// as Wireshark apply the secrets to the packets that follow it, so it
+// should be written before them.
+func (w *NgWriter) WriteDecryptionSecrets(s NgSecrets) error {
+	body := make([]byte, 8, 8+len(s.Data))
+	binary.LittleEndian.PutUint32(body[0:4], uint32(s.Type))
+	binary.LittleEndian.PutUint32(body[4:8], uint32(len(s.Data)))
+	return w.writeBlock(ngBlockDecryptionSecrets, append(body, s.Data...))
+}
+
+// WritePacket writes the given packet data as an enhanced packet block on
+// interface ci.InterfaceIndex, recording ci.Direction if it's known.
+func (w *NgWriter) WritePacket(ci gopacket.CaptureInfo, data []byte) error {
+	return w.writePacket(ci, data, "")
+}
+
+// WritePacketComment is like WritePacket, but attaches a comment to the
+// packet, which readers such as Wireshark display with it.  Comments
+// longer than 65535 bytes are truncated.
+func (w *NgWriter) WritePacketComment(ci gopacket.CaptureInfo, data []byte, comment string) error {
+	return w.writePacket(ci, data, comment)
+}
+
+func (w *NgWriter) writePacket(ci gopacket.CaptureInfo, data []byte, comment string) error {
+	if ci.CaptureLength != len(data) {
+		return fmt.Errorf("capture length %d does not match data length %d", ci.CaptureLength, len(data))
+	}
+	if ci.CaptureLength > ci.Length {
+		return fmt.Errorf("invalid capture info %+v:  capture length > length", ci)
+	}
+	if ci.InterfaceIndex < 0 || ci.InterfaceIndex >= w.interfaces {
+		return fmt.Errorf("invalid interface index %d, %d interfaces written", ci.InterfaceIndex, w.interfaces)
+	}
+	t := ci.Timestamp
+	if t.IsZero() {
+		t = time.Now()
+	}
+	ts := uint64(t.UnixNano())
+	body := make([]byte, 20, 20+len(data)+16)
+	binary.LittleEndian.PutUint32(body[0:4], uint32(ci.InterfaceIndex))
+	binary.LittleEndian.PutUint32(body[4:8], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(body[8:12], uint32(ts))
+	binary.LittleEndian.PutUint32(body[12:16], uint32(ci.CaptureLength))
+	binary.LittleEndian.PutUint32(body[16:20], uint32(ci.Length))
+	body = append(body, data...)
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	var flags uint32
+	switch ci.Direction {
+	case gopacket.DirectionInbound:
+		flags = 1
+	case gopacket.DirectionOutbound:
+		flags = 2
+	}
+	if comment != "" {
+		if len(comment) > 0xffff {
+			comment = comment[:0xffff]
+		}
+		body = appendNgOption(body, ngOptComment, []byte(comment))
+	}
+	if flags != 0 {
+		var v [4]byte
+		binary.LittleEndian.PutUint32(v[:], flags)
+		body = appendNgOption(body, ngOptEPBFlags, v[:])
+	}
+	if comment != "" || flags != 0 {
+		body = appendNgOption(body, ngOptEndOfOptions, nil)
+	}
+	return w.writeBlock(ngBlockEnhancedPacket, body)
+}
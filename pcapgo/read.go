@@ -50,6 +50,11 @@ const magicNanosecondsBigendian = 0x4D3CB2A1
 const magicGzip1 = 0x1f
 const magicGzip2 = 0x8b
 
+// maxCaptureLength is the largest capture length Reader accepts, whatever
+// the snaplen in the file header.  It is the snaplen tcpdump uses by
+// default, and leaves room for jumbo frames and segmentation offload.
+const maxCaptureLength = 262144
+
 // NewReader returns a new reader object, for reading packet data from
 // the given reader. The reader must be open and header data is
 // read from it at this point.
@@ -124,10 +129,17 @@ func (r *Reader) ReadPacketData() (data []byte, ci gopacket.CaptureInfo, err err
 	}
 
 	var n int
-	if 16+ci.CaptureLength > len(r.buf) {
-		err = fmt.Errorf("capture length with header exceeds buffer size: %d > %d", 16+ci.CaptureLength, len(r.buf))
+	if ci.CaptureLength > maxCaptureLength {
+		err = fmt.Errorf("capture length %d exceeds maximum %d", ci.CaptureLength, maxCaptureLength)
 		return
 	}
+	// Some writers record packets longer than their snaplen, which is also
+	// zero in some files, so grow the buffer rather than truncate.
+	if 16+ci.CaptureLength > len(r.buf) {
+		buf := make([]byte, 16+ci.CaptureLength)
+		copy(buf, r.buf[:16])
+		r.buf = buf
+	}
 	data = r.buf[16 : 16+ci.CaptureLength]
 	if n, err = io.ReadFull(r.r, data); err != nil {
 		return
@@ -9,6 +9,8 @@ import (
 	"bytes"
 	"testing"
 	"time"
+
+	"github.com/mistsys/gopacket"
 )
 
 // test header read
@@ -164,3 +166,24 @@ func TestTruncatedGzipPacket(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestReadPacketBeyondSnaplen(t *testing.T) {
+	// Some writers record packets longer than the snaplen, or a zero
+	// snaplen.
+	for _, snaplen := range []uint32{0, 1518} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.WriteFileHeader(snaplen, 1)
+		data := make([]byte, 9014)
+		if err := w.WritePacket(gopacket.CaptureInfo{Length: len(data), CaptureLength: len(data)}, data); err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _, err := r.ReadPacketData(); err != nil || len(got) != len(data) {
+			t.Errorf("snaplen %d: got %d bytes, error %v", snaplen, len(got), err)
+		}
+	}
+}
@@ -4,7 +4,7 @@
 // that can be found in the LICENSE file in the root of the source
 // tree.
 
-// Package pcapgo provides some native PCAP support, not requiring
+// Package pcapgo provides some native PCAP and pcapng support, not requiring
 // C libpcap to be installed.
 package pcapgo
 
@@ -70,3 +70,22 @@ func TestCaptureInfoErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteJumboPacket(t *testing.T) {
+	// Packets longer than the snaplen are written whole, and read back.
+	data := make([]byte, 9014)
+	ci := gopacket.CaptureInfo{Timestamp: time.Unix(0, 0), Length: len(data), CaptureLength: len(data)}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteFileHeader(1518, 1)
+	if err := w.WritePacket(ci, data); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _, err := r.ReadPacketData(); err != nil || len(got) != len(data) {
+		t.Errorf("got %d bytes, error %v", len(got), err)
+	}
+}
@@ -53,6 +53,7 @@ type Ring struct {
 	snaplen                 int
 	useExtendedPacketHeader bool
 	interfaceIndex          int
+	device                  string
 	mu                      sync.Mutex
 	// Since pointers to these objects are passed into a C function, if
 	// they're declared locally then the Go compiler thinks they may have
@@ -84,7 +85,7 @@ func NewRing(device string, snaplen uint32, flags Flag) (ring *Ring, _ error) {
 	if cptr == nil || err != nil {
 		return nil, fmt.Errorf("pfring NewRing error: %v", err)
 	}
-	ring = &Ring{cptr: cptr, snaplen: int(snaplen)}
+	ring = &Ring{cptr: cptr, snaplen: int(snaplen), device: device}
 
 	if flags&FlagLongHeader == FlagLongHeader {
 		ring.useExtendedPacketHeader = true
@@ -153,6 +154,7 @@ func (r *Ring) ReadPacketDataTo(data []byte) (ci gopacket.CaptureInfo, err error
 	} else {
 		ci.InterfaceIndex = r.interfaceIndex
 	}
+	ci.Source.InterfaceName = r.device
 	r.mu.Unlock()
 	return
 }
@@ -0,0 +1,329 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package pmtud finds path MTU discovery blackholes in captures, and
+// estimates the effective MTU of each path.
+//
+// Path MTU discovery relies on routers sending an ICMP fragmentation needed
+// (IPv4) or packet too big (IPv6) message when they drop a packet that
+// can't be fragmented.  When a firewall filters those messages, large
+// packets are dropped silently: the connection sets up, then stalls
+// retransmitting the same full-sized segment.  An Analyzer follows TCP
+// segments sent with the don't fragment bit set, and reports a Blackhole
+// when a large one is retransmitted repeatedly with no ICMP message
+// reporting a smaller MTU for its path:
+//
+//	a := pmtud.NewAnalyzer(pmtud.DefaultConfig)
+//	for p := range source.Packets() {
+//	  if b := a.Add(p); b != nil {
+//	    log.Println(b)
+//	  }
+//	}
+//	for _, path := range a.Paths() {
+//	  fmt.Println(path.Src, path.Dst, path.EffectiveMTU())
+//	}
+package pmtud
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// Path is what's known about the MTU from one address to another.  Sizes
+// are IP packet lengths, including the IP header.
+type Path struct {
+	Src, Dst net.IP
+	// MaxSent is the largest packet sent on the path, and MaxDelivered the
+	// largest TCP segment whose data the destination acknowledged.
+	MaxSent, MaxDelivered int
+	// ReportedMTU is the smallest MTU reported by ICMP messages about the
+	// path, and Reports counts those messages.  Some old routers report an
+	// MTU of zero, which is counted but not recorded.
+	ReportedMTU int
+	Reports     int
+	// Blackholes counts the blackholes reported on the path, and
+	// MinBlackholed is the size of the smallest packet lost to them.
+	Blackholes    int
+	MinBlackholed int
+	// lastReport is the time of the last ICMP message about the path.
+	lastReport time.Time
+}
+
+// EffectiveMTU returns the path's MTU as far as the capture shows: the MTU
+// reported by ICMP if there was one, and otherwise the size of the largest
+// packet delivered, which is a lower bound.  It returns 0 if nothing is
+// known.
+func (p *Path) EffectiveMTU() int {
+	if p.ReportedMTU != 0 {
+		return p.ReportedMTU
+	}
+	return p.MaxDelivered
+}
+
+func (p *Path) String() string {
+	return fmt.Sprintf("%v->%v: effective MTU %d, max sent %d, max delivered %d, reported MTU %d, %d blackholes", p.Src, p.Dst, p.EffectiveMTU(), p.MaxSent, p.MaxDelivered, p.ReportedMTU, p.Blackholes)
+}
+
+// Blackhole is a large segment that was retransmitted repeatedly with no
+// ICMP message reporting a smaller MTU.
+type Blackhole struct {
+	Src, Dst         net.IP
+	SrcPort, DstPort layers.TCPPort
+	// Size is the length of the lost IP packet.
+	Size int
+	// Sent is when the segment was first sent, and Time when the
+	// retransmission that reported it was.
+	Sent, Time      time.Time
+	Retransmissions int
+	// MaxDelivered is the size of the largest packet delivered on the path
+	// before, which bounds its MTU from below.
+	MaxDelivered int
+}
+
+func (b *Blackhole) String() string {
+	return fmt.Sprintf("PMTUD blackhole %v:%d->%v:%d: %d byte packet retransmitted %d times without ICMP, largest delivered %d", b.Src, int(b.SrcPort), b.Dst, int(b.DstPort), b.Size, b.Retransmissions, b.MaxDelivered)
+}
+
+// Config configures an Analyzer.
+type Config struct {
+	// MinSize is the size of the smallest packet that's checked for being
+	// blackholed.  Smaller packets are unlikely to exceed any path's MTU.
+	MinSize int
+	// Retransmissions is the number of retransmissions of a large segment
+	// that counts as a blackhole.
+	Retransmissions int
+	// Timeout is how long segments are followed for, and how long a
+	// connection can be idle before it is forgotten.
+	Timeout time.Duration
+}
+
+// DefaultConfig checks packets over the IPv6 minimum MTU, retransmitted
+// twice within a minute.
+var DefaultConfig = Config{
+	MinSize:         1281,
+	Retransmissions: 2,
+	Timeout:         time.Minute,
+}
+
+// segment is a segment waiting to be acknowledged.
+type segment struct {
+	end             uint32
+	size            int
+	sent            time.Time
+	retransmissions int
+	// check is true if the segment is checked for being blackholed, and
+	// otherwise it's only followed to update the path's MaxDelivered.
+	check bool
+}
+
+// conn is one direction of a TCP connection.
+type conn struct {
+	path     *Path
+	segments map[uint32]*segment // keyed by sequence number
+	last     time.Time
+}
+
+// Analyzer follows TCP connections and ICMP messages.  Segments that can't
+// raise their path's MaxDelivered, and small or fragmentable ones that
+// aren't checked for blackholes, aren't followed.  It is not safe for
+// concurrent use.
+type Analyzer struct {
+	Config
+	paths   map[string]*Path
+	conns   map[string]*conn
+	expired time.Time
+}
+
+// NewAnalyzer creates an Analyzer with the given configuration.
+func NewAnalyzer(c Config) *Analyzer {
+	return &Analyzer{
+		Config: c,
+		paths:  map[string]*Path{},
+		conns:  map[string]*conn{},
+	}
+}
+
+func (a *Analyzer) path(src, dst net.IP) *Path {
+	k := string(src) + string(dst)
+	p := a.paths[k]
+	if p == nil {
+		p = &Path{
+			Src: append(net.IP(nil), src...),
+			Dst: append(net.IP(nil), dst...),
+		}
+		a.paths[k] = p
+	}
+	return p
+}
+
+func connKey(src, dst net.IP, tcp *layers.TCP) string {
+	var ports [4]byte
+	binary.BigEndian.PutUint16(ports[0:2], uint16(tcp.SrcPort))
+	binary.BigEndian.PutUint16(ports[2:4], uint16(tcp.DstPort))
+	return string(src) + string(dst) + string(ports[:])
+}
+
+// Add processes p, and returns the blackhole it reveals, if any.
+func (a *Analyzer) Add(p gopacket.Packet) *Blackhole {
+	ts := p.Metadata().Timestamp
+	if ts.Sub(a.expired) > a.Timeout {
+		a.expire(ts)
+	}
+	var src, dst net.IP
+	var size int
+	var df bool
+	switch ip := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		src, dst, size = ip.SrcIP, ip.DstIP, int(ip.Length)
+		df = ip.Flags&layers.IPv4DontFragment != 0
+	case *layers.IPv6:
+		// Routers never fragment IPv6.
+		src, dst, size = ip.SrcIP, ip.DstIP, int(ip.Length)+40
+		df = true
+	default:
+		return nil
+	}
+	switch l := p.TransportLayer().(type) {
+	case *layers.TCP:
+		return a.tcp(src, dst, size, df, l, ts)
+	}
+	if icmp, ok := p.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4); ok {
+		if icmp.TypeCode.Type() == layers.ICMPv4TypeDestinationUnreachable && icmp.TypeCode.Code() == layers.ICMPv4CodeFragmentationNeeded {
+			// The next-hop MTU is in the low half of the unused word, and
+			// the payload quotes the dropped packet's header.
+			if b := icmp.Payload; len(b) >= 20 {
+				a.tooBig(net.IP(b[12:16]), net.IP(b[16:20]), int(icmp.Seq), ts)
+			}
+		}
+	} else if icmp, ok := p.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6); ok {
+		if icmp.TypeCode.Type() == layers.ICMPv6TypePacketTooBig && icmp.TypeBytes != nil {
+			if b := icmp.Payload; len(b) >= 40 {
+				a.tooBig(net.IP(b[8:24]), net.IP(b[24:40]), int(binary.BigEndian.Uint32(icmp.TypeBytes)), ts)
+			}
+		}
+	}
+	return nil
+}
+
+// tooBig records an ICMP message reporting the MTU of the path from src to
+// dst.
+func (a *Analyzer) tooBig(src, dst net.IP, mtu int, ts time.Time) {
+	path := a.path(src, dst)
+	path.Reports++
+	path.lastReport = ts
+	if mtu != 0 && (path.ReportedMTU == 0 || mtu < path.ReportedMTU) {
+		path.ReportedMTU = mtu
+	}
+}
+
+func (a *Analyzer) tcp(src, dst net.IP, size int, df bool, tcp *layers.TCP, ts time.Time) *Blackhole {
+	path := a.path(src, dst)
+	if size > path.MaxSent {
+		path.MaxSent = size
+	}
+	if tcp.ACK {
+		a.acked(dst, src, tcp, ts)
+	}
+	check := df && size >= a.MinSize
+	if len(tcp.Payload) == 0 || (!check && size <= path.MaxDelivered) {
+		return nil
+	}
+	k := connKey(src, dst, tcp)
+	c := a.conns[k]
+	if c == nil {
+		c = &conn{path: path, segments: map[uint32]*segment{}}
+		a.conns[k] = c
+	}
+	c.last = ts
+	s := c.segments[tcp.Seq]
+	// A smaller segment at the same sequence number means the sender has
+	// lowered its segment size, and starts over.
+	if s == nil || size < s.size {
+		c.segments[tcp.Seq] = &segment{
+			end:   tcp.Seq + uint32(len(tcp.Payload)),
+			size:  size,
+			sent:  ts,
+			check: check,
+		}
+		return nil
+	}
+	s.retransmissions++
+	if !s.check || s.retransmissions != a.Retransmissions || !path.lastReport.Before(s.sent) {
+		return nil
+	}
+	path.Blackholes++
+	if path.MinBlackholed == 0 || size < path.MinBlackholed {
+		path.MinBlackholed = size
+	}
+	return &Blackhole{
+		Src:             path.Src,
+		Dst:             path.Dst,
+		SrcPort:         tcp.SrcPort,
+		DstPort:         tcp.DstPort,
+		Size:            s.size,
+		Sent:            s.sent,
+		Time:            ts,
+		Retransmissions: s.retransmissions,
+		MaxDelivered:    path.MaxDelivered,
+	}
+}
+
+// acked records the segments from src to dst that tcp, sent the other way,
+// acknowledges.
+func (a *Analyzer) acked(src, dst net.IP, tcp *layers.TCP, ts time.Time) {
+	var rev layers.TCP
+	rev.SrcPort, rev.DstPort = tcp.DstPort, tcp.SrcPort
+	c := a.conns[connKey(src, dst, &rev)]
+	if c == nil {
+		return
+	}
+	for seq, s := range c.segments {
+		if int32(tcp.Ack-s.end) >= 0 {
+			if s.size > c.path.MaxDelivered {
+				c.path.MaxDelivered = s.size
+			}
+			delete(c.segments, seq)
+		}
+	}
+}
+
+// expire forgets segments and connections older than the timeout.
+func (a *Analyzer) expire(ts time.Time) {
+	a.expired = ts
+	for k, c := range a.conns {
+		if ts.Sub(c.last) > a.Timeout {
+			delete(a.conns, k)
+			continue
+		}
+		for seq, s := range c.segments {
+			if ts.Sub(s.sent) > a.Timeout {
+				delete(c.segments, seq)
+			}
+		}
+	}
+}
+
+// Paths returns the paths seen, sorted by source and destination.
+func (a *Analyzer) Paths() []*Path {
+	out := make([]*Path, 0, len(a.paths))
+	for _, p := range a.paths {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if c := bytes.Compare(out[i].Src, out[j].Src); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(out[i].Dst, out[j].Dst) < 0
+	})
+	return out
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package pmtud
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+var (
+	client = net.IP{10, 0, 0, 1}
+	server = net.IP{192, 0, 2, 1}
+	router = net.IP{10, 0, 0, 254}
+)
+
+func packet(t *testing.T, sec int64, ls ...gopacket.SerializableLayer) gopacket.Packet {
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ls...); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	p.Metadata().Timestamp = time.Unix(sec, 0)
+	return p
+}
+
+// data returns a segment of n bytes of data from server to client.
+func data(t *testing.T, sec int64, seq uint32, n int) gopacket.Packet {
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, Flags: layers.IPv4DontFragment, SrcIP: server, DstIP: client}
+	tcp := &layers.TCP{SrcPort: 443, DstPort: 40000, Seq: seq, ACK: true, Window: 1000}
+	tcp.SetNetworkLayerForChecksum(ip)
+	return packet(t, sec, ip, tcp, gopacket.Payload(make([]byte, n)))
+}
+
+func ack(t *testing.T, sec int64, ack uint32) gopacket.Packet {
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: client, DstIP: server}
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: 443, Seq: 1, Ack: ack, ACK: true, Window: 1000}
+	tcp.SetNetworkLayerForChecksum(ip)
+	return packet(t, sec, ip, tcp)
+}
+
+// fragNeeded returns an ICMP fragmentation needed message for a packet from
+// server to client.
+func fragNeeded(t *testing.T, sec int64, mtu uint16) gopacket.Packet {
+	quoted := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, Flags: layers.IPv4DontFragment, SrcIP: server, DstIP: client, Length: 1500}
+	qbuf := gopacket.NewSerializeBuffer()
+	if err := quoted.SerializeTo(qbuf, gopacket.SerializeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolICMPv4, SrcIP: router, DstIP: server}
+	icmp := &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded), Seq: mtu}
+	return packet(t, sec, ip, icmp, gopacket.Payload(append(qbuf.Bytes(), make([]byte, 8)...)))
+}
+
+func TestBlackhole(t *testing.T) {
+	a := NewAnalyzer(DefaultConfig)
+	a.Add(data(t, 1, 1000, 500))
+	a.Add(ack(t, 1, 1500))
+	a.Add(data(t, 2, 1500, 1460))
+	if b := a.Add(data(t, 3, 1500, 1460)); b != nil {
+		t.Fatalf("blackhole after one retransmission: %v", b)
+	}
+	b := a.Add(data(t, 5, 1500, 1460))
+	if b == nil || b.Size != 1500 || b.Retransmissions != 2 || b.MaxDelivered != 540 || !b.Src.Equal(server) || b.DstPort != 40000 {
+		t.Fatalf("got %v", b)
+	}
+	if b := a.Add(data(t, 9, 1500, 1460)); b != nil {
+		t.Errorf("blackhole reported twice: %v", b)
+	}
+	// The server falls back to a smaller segment size, which gets through.
+	a.Add(data(t, 10, 1500, 1200))
+	a.Add(ack(t, 10, 2700))
+	paths := a.Paths()
+	if len(paths) != 2 {
+		t.Fatalf("got paths %v", paths)
+	}
+	p := paths[1]
+	if !p.Src.Equal(server) || p.Blackholes != 1 || p.MinBlackholed != 1500 || p.MaxDelivered != 1240 || p.EffectiveMTU() != 1240 {
+		t.Errorf("got path %v", p)
+	}
+}
+
+func TestFragmentationNeeded(t *testing.T) {
+	a := NewAnalyzer(DefaultConfig)
+	a.Add(data(t, 1, 1000, 1460))
+	a.Add(fragNeeded(t, 1, 1400))
+	a.Add(data(t, 2, 1000, 1460))
+	if b := a.Add(data(t, 3, 1000, 1460)); b != nil {
+		t.Errorf("blackhole despite ICMP: %v", b)
+	}
+	p := a.Paths()[0]
+	if p.Reports != 1 || p.ReportedMTU != 1400 || p.EffectiveMTU() != 1400 || p.Blackholes != 0 {
+		t.Errorf("got path %v", p)
+	}
+}
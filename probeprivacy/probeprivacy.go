@@ -0,0 +1,278 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package probeprivacy summarizes what 802.11 clients reveal in their probe
+// requests.
+//
+// For each device it records the SSIDs revealed by directed probes, how
+// the device randomizes its address, and how often it probes.  Devices
+// probing from locally administered, random, addresses are tracked by a
+// fingerprint of the elements they probe with, so that a device rotating
+// its address is still counted once:
+//
+//	a := probeprivacy.New()
+//	for p := range source.Packets() {
+//	  a.Add(p)
+//	}
+//	// Export with SSIDs replaced by keyed hashes.
+//	a.Export(os.Stdout, key)
+package probeprivacy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// Scheme is how a device chooses the address it probes from.
+type Scheme int
+
+const (
+	// Global means the device probes from its universally administered
+	// address.
+	Global Scheme = iota
+	// Randomized means the device probes from a locally administered
+	// address, and was only seen using one.
+	Randomized
+	// Rotating means the device was seen probing from several locally
+	// administered addresses.
+	Rotating
+)
+
+func (s Scheme) String() string {
+	switch s {
+	case Global:
+		return "Global"
+	case Randomized:
+		return "Randomized"
+	case Rotating:
+		return "Rotating"
+	}
+	return fmt.Sprintf("UnknownScheme(%d)", int(s))
+}
+
+// Device is what one device revealed in its probe requests.
+type Device struct {
+	// Fingerprint is a hash of the elements, rates and capabilities the
+	// device probes with, which stay the same when it changes its address.
+	// Devices of the same model and software may share a fingerprint.
+	Fingerprint string
+	Addresses   []net.HardwareAddr
+	Scheme      Scheme
+	// SSIDs are the distinct SSIDs of the device's directed probes, sorted.
+	SSIDs []string
+	// Probes counts all probe requests, and Wildcard those for any SSID.
+	Probes, Wildcard    int
+	FirstSeen, LastSeen time.Time
+}
+
+// Rate returns the device's probes per minute between its first and last
+// probe, or 0 if it was only seen once.
+func (d *Device) Rate() float64 {
+	span := d.LastSeen.Sub(d.FirstSeen)
+	if span <= 0 {
+		return 0
+	}
+	return float64(d.Probes) / span.Minutes()
+}
+
+func (d *Device) addAddress(addr net.HardwareAddr) {
+	for _, a := range d.Addresses {
+		if bytes.Equal(a, addr) {
+			return
+		}
+	}
+	d.Addresses = append(d.Addresses, append(net.HardwareAddr(nil), addr...))
+	if d.Scheme == Randomized && len(d.Addresses) > 1 {
+		d.Scheme = Rotating
+	}
+}
+
+func (d *Device) addSSID(ssid string) {
+	i := sort.SearchStrings(d.SSIDs, ssid)
+	if i < len(d.SSIDs) && d.SSIDs[i] == ssid {
+		return
+	}
+	d.SSIDs = append(d.SSIDs, "")
+	copy(d.SSIDs[i+1:], d.SSIDs[i:])
+	d.SSIDs[i] = ssid
+}
+
+// Analyzer collects devices from probe requests.  It is not safe for
+// concurrent use.
+type Analyzer struct {
+	// devices are keyed by address for global addresses, and by
+	// fingerprint for random ones.
+	devices map[string]*Device
+}
+
+// New creates an empty Analyzer.
+func New() *Analyzer {
+	return &Analyzer{devices: map[string]*Device{}}
+}
+
+// randomized returns true if addr is locally administered.
+func randomized(addr net.HardwareAddr) bool {
+	return len(addr) > 0 && addr[0]&0x02 != 0
+}
+
+// fingerprint hashes the IDs of the elements of a probe request, in order,
+// and the contents of those that describe the device rather than the
+// network it looks for.
+func fingerprint(es []*layers.Dot11InformationElement) string {
+	h := sha256.New()
+	for _, e := range es {
+		h.Write([]byte{byte(e.ID)})
+		switch e.ID {
+		case layers.Dot11InformationElementIDRates,
+			layers.Dot11InformationElementIDESRates,
+			layers.Dot11InformationElementHTCapabilities,
+			layers.Dot11InformationElementExtendedCapabilities,
+			layers.Dot11InformationElementVHTCapabilities:
+			h.Write(e.Info)
+		case layers.Dot11InformationElementIDVendor:
+			h.Write(e.OUI)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// Add records p if it is a probe request, and returns its device.
+func (a *Analyzer) Add(p gopacket.Packet) *Device {
+	d, ok := p.Layer(layers.LayerTypeDot11).(*layers.Dot11)
+	if !ok {
+		return nil
+	}
+	req, ok := p.Layer(layers.LayerTypeDot11MgmtProbeReq).(*layers.Dot11MgmtProbeReq)
+	if !ok {
+		return nil
+	}
+	// Probe request layers don't decode their elements, so decode them from
+	// the frame body.
+	var es []*layers.Dot11InformationElement
+	body := gopacket.NewPacket(req.Contents, layers.LayerTypeDot11InformationElement, gopacket.NoCopy)
+	for _, l := range body.Layers() {
+		if e, ok := l.(*layers.Dot11InformationElement); ok {
+			es = append(es, e)
+		}
+	}
+	fp := fingerprint(es)
+	key, scheme := string(d.Address2), Global
+	if randomized(d.Address2) {
+		key, scheme = fp, Randomized
+	}
+	dev := a.devices[key]
+	if dev == nil {
+		dev = &Device{Fingerprint: fp, Scheme: scheme}
+		a.devices[key] = dev
+	}
+	dev.addAddress(d.Address2)
+
+	ts := p.Metadata().Timestamp
+	if dev.Probes == 0 || ts.Before(dev.FirstSeen) {
+		dev.FirstSeen = ts
+	}
+	if ts.After(dev.LastSeen) {
+		dev.LastSeen = ts
+	}
+	dev.Probes++
+	for _, e := range es {
+		if e.ID != layers.Dot11InformationElementIDSSID {
+			continue
+		}
+		if len(e.Info) == 0 {
+			dev.Wildcard++
+		} else {
+			dev.addSSID(string(e.Info))
+		}
+		break
+	}
+	return dev
+}
+
+// Devices returns the devices seen, in order of first probe.
+func (a *Analyzer) Devices() []*Device {
+	out := make([]*Device, 0, len(a.devices))
+	for _, d := range a.devices {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].FirstSeen.Equal(out[j].FirstSeen) {
+			return out[i].FirstSeen.Before(out[j].FirstSeen)
+		}
+		return out[i].Fingerprint < out[j].Fingerprint
+	})
+	return out
+}
+
+// RedactSSID replaces an SSID, which may name a person, home or employer,
+// with a keyed hash.  The same key maps an SSID to the same string, so
+// exports made with it can still be joined on SSID.
+func RedactSSID(key []byte, ssid string) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(ssid))
+	return "ssid-" + hex.EncodeToString(m.Sum(nil)[:6])
+}
+
+// Record is the exported form of a Device.
+type Record struct {
+	Fingerprint     string    `json:"fingerprint"`
+	Addresses       []string  `json:"addresses"`
+	Scheme          string    `json:"scheme"`
+	SSIDs           []string  `json:"ssids"`
+	Probes          int       `json:"probes"`
+	Wildcard        int       `json:"wildcard_probes"`
+	ProbesPerMinute float64   `json:"probes_per_minute"`
+	FirstSeen       time.Time `json:"first_seen"`
+	LastSeen        time.Time `json:"last_seen"`
+}
+
+// Record returns d for export.  If key is not nil, SSIDs are redacted with
+// RedactSSID.
+func (d *Device) Record(key []byte) Record {
+	r := Record{
+		Fingerprint:     d.Fingerprint,
+		Scheme:          d.Scheme.String(),
+		SSIDs:           []string{},
+		Probes:          d.Probes,
+		Wildcard:        d.Wildcard,
+		ProbesPerMinute: d.Rate(),
+		FirstSeen:       d.FirstSeen,
+		LastSeen:        d.LastSeen,
+	}
+	for _, a := range d.Addresses {
+		r.Addresses = append(r.Addresses, a.String())
+	}
+	for _, s := range d.SSIDs {
+		if key != nil {
+			s = RedactSSID(key, s)
+		}
+		r.SSIDs = append(r.SSIDs, s)
+	}
+	return r
+}
+
+// Export writes a JSON record per device to w, one per line.  If key is not
+// nil, SSIDs are redacted with RedactSSID.
+func (a *Analyzer) Export(w io.Writer, key []byte) error {
+	enc := json.NewEncoder(w)
+	for _, d := range a.Devices() {
+		if err := enc.Encode(d.Record(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
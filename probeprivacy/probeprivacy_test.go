@@ -0,0 +1,104 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package probeprivacy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+var (
+	globalAddr = net.HardwareAddr{0x00, 0x03, 0x93, 0, 0, 1}
+	randomA    = net.HardwareAddr{0x12, 0, 0, 0, 0, 1}
+	randomB    = net.HardwareAddr{0x16, 0, 0, 0, 0, 2}
+	randomC    = net.HardwareAddr{0x1a, 0, 0, 0, 0, 3}
+)
+
+var (
+	ratesA = []byte{0x01, 0x04, 0x02, 0x04, 0x0b, 0x16}
+	ratesB = []byte{0x01, 0x04, 0x8c, 0x12, 0x98, 0x24}
+	htCaps = []byte{0x2d, 0x02, 0xef, 0x01}
+)
+
+// probe returns a broadcast probe request from src for ssid, with the
+// given rates element, sent sec seconds into the capture.
+func probe(t *testing.T, src net.HardwareAddr, ssid string, rates []byte, sec int64) gopacket.Packet {
+	data := []byte{0x40, 0, 0, 0}
+	data = append(data, layers.EthernetBroadcast...)
+	data = append(data, src...)
+	data = append(data, layers.EthernetBroadcast...)
+	data = append(data, 0, 0)
+	data = append(data, 0x00, byte(len(ssid)))
+	data = append(data, ssid...)
+	data = append(data, rates...)
+	data = append(data, htCaps...)
+	data = append(data, 0, 0, 0, 0) // FCS
+	p := gopacket.NewPacket(data, layers.LayerTypeDot11, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	p.Metadata().Timestamp = time.Unix(1000+sec, 0)
+	return p
+}
+
+func TestAnalyzer(t *testing.T) {
+	a := New()
+	a.Add(probe(t, globalAddr, "HomeNet", ratesA, 0))
+	a.Add(probe(t, globalAddr, "", ratesA, 30))
+	a.Add(probe(t, randomA, "CorpWiFi", ratesB, 5))
+	a.Add(probe(t, randomB, "", ratesB, 10))
+	a.Add(probe(t, randomA, "CorpWiFi", ratesB, 15))
+	a.Add(probe(t, randomC, "", ratesA, 20))
+
+	devs := a.Devices()
+	if len(devs) != 3 {
+		t.Fatalf("got %d devices", len(devs))
+	}
+	g, rot, single := devs[0], devs[1], devs[2]
+	if g.Scheme != Global || g.Probes != 2 || g.Wildcard != 1 || !reflect.DeepEqual(g.SSIDs, []string{"HomeNet"}) || g.Rate() != 4 {
+		t.Errorf("got global device %+v, rate %v", g, g.Rate())
+	}
+	if rot.Scheme != Rotating || len(rot.Addresses) != 2 || rot.Probes != 3 || !reflect.DeepEqual(rot.SSIDs, []string{"CorpWiFi"}) {
+		t.Errorf("got rotating device %+v", rot)
+	}
+	if single.Scheme != Randomized || single.Probes != 1 || single.Rate() != 0 || single.Fingerprint != g.Fingerprint {
+		t.Errorf("got randomized device %+v", single)
+	}
+
+	var plain, redacted bytes.Buffer
+	if err := a.Export(&plain, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(plain.String(), `"HomeNet"`) {
+		t.Errorf("SSID missing from export:\n%s", plain.String())
+	}
+	key := []byte("secret")
+	if err := a.Export(&redacted, key); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(redacted.String(), "HomeNet") || strings.Contains(redacted.String(), "CorpWiFi") {
+		t.Errorf("SSID in redacted export:\n%s", redacted.String())
+	}
+	var r Record
+	if err := json.NewDecoder(&redacted).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.SSIDs, []string{RedactSSID(key, "HomeNet")}) || r.Scheme != "Global" || r.Addresses[0] != globalAddr.String() {
+		t.Errorf("got record %+v", r)
+	}
+	if RedactSSID(key, "HomeNet") == RedactSSID([]byte("other"), "HomeNet") {
+		t.Error("redaction ignores key")
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package quarantine keeps packets that fail to decode, so that decoder
+// bugs seen in the field can be reproduced.
+//
+// A Recorder writes each packet it's given to a pcapng file, with a comment
+// describing the failure: the error, the stack of a recovered panic, the
+// layers decoded before it, and the offset of the bytes that failed.  It
+// is rate limited, so a flood of malformed packets can't fill the disk.
+// Set it as a PacketSource's OnDecodeFailure hook to quarantine packets
+// automatically:
+//
+//	f, _ := os.Create("/var/lib/sensor/quarantine.pcapng")
+//	r, err := quarantine.NewRecorder(f, layers.LinkTypeEthernet, quarantine.DefaultConfig)
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	source := gopacket.NewPacketSource(handle, layers.LinkTypeEthernet)
+//	source.OnDecodeFailure = r.Record
+//	for p := range source.Packets() {
+//	  ...
+//	}
+//	if err := r.Err(); err != nil {
+//	  log.Println("quarantine:", err)
+//	}
+package quarantine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/pcapgo"
+)
+
+// Config configures a Recorder.
+type Config struct {
+	// Rate is how many packets a second are recorded on average, and Burst
+	// how many may be recorded at once.  Time is measured by the packets'
+	// timestamps.
+	Rate  float64
+	Burst int
+	// MaxPerError, if not zero, limits the packets recorded with the same
+	// error message, so that one common failure doesn't crowd out rarer
+	// ones.
+	MaxPerError int
+	// Context is added to every comment, to say where the packets came
+	// from, for example the sensor, interface and decoder options.
+	Context string
+}
+
+// DefaultConfig records a packet a second, in bursts of up to 10, and up
+// to 100 packets with each error.
+var DefaultConfig = Config{
+	Rate:        1,
+	Burst:       10,
+	MaxPerError: 100,
+}
+
+// Stats counts the packets given to a Recorder.
+type Stats struct {
+	// Recorded packets were written, and RateLimited and ErrorLimited ones
+	// were dropped by the rate limit or MaxPerError.
+	Recorded, RateLimited, ErrorLimited int
+}
+
+// Recorder writes packets that failed to decode to a pcapng file.  It is
+// safe for concurrent use.
+type Recorder struct {
+	Config
+	mu     sync.Mutex
+	w      *pcapgo.NgWriter
+	tokens float64
+	last   time.Time
+	errors map[string]int
+	stats  Stats
+	err    error
+}
+
+// NewRecorder writes a pcapng header for packets of the given link type to
+// w, and returns a Recorder writing to it.
+func NewRecorder(w io.Writer, linkType layers.LinkType, c Config) (*Recorder, error) {
+	nw, err := pcapgo.NewNgWriter(w, linkType)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{Config: c, w: nw, tokens: float64(c.Burst), errors: map[string]int{}}, nil
+}
+
+// Record writes p, if it failed to decode and the limits allow it.  Write
+// errors are returned by Err, and stop further recording.
+func (r *Recorder) Record(p gopacket.Packet) {
+	fail := p.ErrorLayer()
+	if fail == nil {
+		return
+	}
+	msg := fail.Error().Error()
+	ci := p.Metadata().CaptureInfo
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	if r.MaxPerError > 0 && r.errors[msg] >= r.MaxPerError {
+		r.stats.ErrorLimited++
+		return
+	}
+	if !r.allow(ci.Timestamp) {
+		r.stats.RateLimited++
+		return
+	}
+	data := p.Data()
+	ci.InterfaceIndex = 0
+	ci.CaptureLength = len(data)
+	if ci.Length < len(data) {
+		ci.Length = len(data)
+	}
+	if r.err = r.w.WritePacketComment(ci, data, r.comment(p, fail)); r.err != nil {
+		return
+	}
+	r.errors[msg]++
+	r.stats.Recorded++
+}
+
+// allow takes a token from the bucket, refilled at Rate since the last
+// packet.
+func (r *Recorder) allow(t time.Time) bool {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	if !r.last.IsZero() && t.After(r.last) {
+		r.tokens += t.Sub(r.last).Seconds() * r.Rate
+		if r.tokens > float64(r.Burst) {
+			r.tokens = float64(r.Burst)
+		}
+	}
+	if r.last.IsZero() || t.After(r.last) {
+		r.last = t
+	}
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// comment describes why p failed to decode.
+func (r *Recorder) comment(p gopacket.Packet, fail gopacket.ErrorLayer) string {
+	var b bytes.Buffer
+	if r.Context != "" {
+		fmt.Fprintf(&b, "%s\n", r.Context)
+	}
+	var stack string
+	if d, ok := fail.(*gopacket.DecodeFailure); ok {
+		stack = d.Dump()
+	}
+	if stack != "" {
+		fmt.Fprintf(&b, "panic: %v\n", fail.Error())
+	} else {
+		fmt.Fprintf(&b, "error: %v\n", fail.Error())
+	}
+	fmt.Fprintf(&b, "failed at offset %d of %d:", len(p.Data())-len(fail.LayerContents()), len(p.Data()))
+	for _, l := range p.Layers() {
+		if l == gopacket.Layer(fail) {
+			break
+		}
+		fmt.Fprintf(&b, " %v(%d)", l.LayerType(), len(l.LayerContents()))
+	}
+	b.WriteByte('\n')
+	if m := p.Metadata(); m.Truncated {
+		fmt.Fprintf(&b, "truncated, %d of %d bytes captured\n", m.CaptureLength, m.Length)
+	}
+	b.WriteString(stack)
+	return b.String()
+}
+
+// Stats returns the counts of packets recorded and dropped so far.
+func (r *Recorder) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// Err returns the first error writing a packet, if any.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package quarantine
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/pcapgo"
+)
+
+// truncatedIPv4 is an Ethernet frame holding the first 10 bytes of an
+// IPv4 header.
+var truncatedIPv4 = []byte{
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 0x08, 0x00,
+	0x45, 0x00, 0x00, 0x28, 0x00, 0x00, 0x00, 0x00, 0x40, 0x06,
+}
+
+type packetData struct {
+	data [][]byte
+	ts   time.Time
+}
+
+func (s *packetData) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	if len(s.data) == 0 {
+		return nil, gopacket.CaptureInfo{}, io.EOF
+	}
+	d := s.data[0]
+	s.data = s.data[1:]
+	s.ts = s.ts.Add(100 * time.Millisecond)
+	return d, gopacket.CaptureInfo{Timestamp: s.ts, CaptureLength: len(d), Length: len(d)}, nil
+}
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	r, err := NewRecorder(&buf, layers.LinkTypeEthernet, Config{Rate: 1, Burst: 2, Context: "sensor1 eth0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := gopacket.NewSerializeBuffer()
+	err = gopacket.SerializeLayers(good, gopacket.SerializeOptions{},
+		&layers.Ethernet{SrcMAC: make([]byte, 6), DstMAC: make([]byte, 6), EthernetType: layers.EthernetTypeARP},
+		&layers.ARP{
+			AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4,
+			HwAddressSize: 6, ProtAddressSize: 4, Operation: layers.ARPRequest,
+			SourceHwAddress: make([]byte, 6), SourceProtAddress: make([]byte, 4),
+			DstHwAddress: make([]byte, 6), DstProtAddress: make([]byte, 4),
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := gopacket.NewPacketSource(&packetData{
+		data: [][]byte{truncatedIPv4, good.Bytes(), truncatedIPv4, truncatedIPv4, truncatedIPv4},
+		ts:   time.Unix(1000, 0),
+	}, layers.LinkTypeEthernet)
+	src.OnDecodeFailure = r.Record
+	for range src.Packets() {
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	// Two pass the burst, the rest arrive within a second.
+	if s := r.Stats(); s != (Stats{Recorded: 2, RateLimited: 2}) {
+		t.Errorf("got stats %+v", s)
+	}
+	for _, want := range []string{"sensor1 eth0\n", "error: ", "failed at offset 14 of 24: Ethernet(14)\n"} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("comment %q not written", want)
+		}
+	}
+
+	pr, err := pcapgo.NewNgReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		data, ci, err := pr.ReadPacketData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, truncatedIPv4) || ci.Timestamp.Before(time.Unix(1000, 0)) {
+			t.Errorf("packet %d: got %+v %x", i, ci, data)
+		}
+	}
+	if _, _, err := pr.ReadPacketData(); err != io.EOF {
+		t.Errorf("got %v, want EOF", err)
+	}
+}
+
+var layerTypePanic = gopacket.RegisterLayerType(9999, gopacket.LayerTypeMetadata{Name: "QuarantinePanic", Decoder: gopacket.DecodeFunc(func([]byte, gopacket.PacketBuilder) error {
+	panic("boom")
+})})
+
+func TestRecorderPanicAndMaxPerError(t *testing.T) {
+	var buf bytes.Buffer
+	r, err := NewRecorder(&buf, layers.LinkTypeEthernet, Config{Rate: 100, Burst: 100, MaxPerError: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		p := gopacket.NewPacket([]byte{1, 2, 3}, layerTypePanic, gopacket.Default)
+		p.Metadata().CaptureInfo = gopacket.CaptureInfo{Timestamp: time.Unix(1000, 0), CaptureLength: 3, Length: 3}
+		r.Record(p)
+	}
+	// Packets that decode are ignored.
+	r.Record(gopacket.NewPacket([]byte{1, 2, 3}, gopacket.DecodePayload, gopacket.Default))
+	if s := r.Stats(); s != (Stats{Recorded: 1, ErrorLimited: 2}) {
+		t.Errorf("got stats %+v", s)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "panic: boom\n") || !strings.Contains(out, "goroutine ") {
+		t.Error("panic and stack not recorded")
+	}
+}
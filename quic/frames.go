@@ -0,0 +1,160 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package quic
+
+import (
+	"fmt"
+
+	"github.com/mistsys/gopacket/layers"
+)
+
+// FrameType is the type of a QUIC frame.
+type FrameType uint64
+
+const (
+	FramePadding         FrameType = 0x00
+	FramePing            FrameType = 0x01
+	FrameACK             FrameType = 0x02
+	FrameACKECN          FrameType = 0x03
+	FrameCrypto          FrameType = 0x06
+	FrameConnectionClose FrameType = 0x1c
+	// FrameApplicationClose is a CONNECTION_CLOSE frame for an
+	// application error.
+	FrameApplicationClose FrameType = 0x1d
+)
+
+func (t FrameType) String() string {
+	switch t {
+	case FramePadding:
+		return "PADDING"
+	case FramePing:
+		return "PING"
+	case FrameACK:
+		return "ACK"
+	case FrameACKECN:
+		return "ACK_ECN"
+	case FrameCrypto:
+		return "CRYPTO"
+	case FrameConnectionClose, FrameApplicationClose:
+		return "CONNECTION_CLOSE"
+	}
+	return fmt.Sprintf("UnknownFrameType(%#x)", uint64(t))
+}
+
+// Frame is a frame of an Initial packet, which may only hold PADDING,
+// PING, ACK, CRYPTO and CONNECTION_CLOSE frames.
+type Frame struct {
+	Type FrameType
+	// Length is the number of PADDING frames in a run of them.
+	Length int
+	// Offset and Data are the TLS handshake data of a CRYPTO frame, and
+	// its offset in the stream.
+	Offset uint64
+	Data   []byte
+	// LargestAcked is the largest packet number an ACK frame acknowledges.
+	LargestAcked uint64
+	// ErrorCode and Reason are set for CONNECTION_CLOSE frames.
+	ErrorCode uint64
+	Reason    string
+}
+
+func (f Frame) String() string {
+	switch f.Type {
+	case FramePadding:
+		return fmt.Sprintf("PADDING(%d)", f.Length)
+	case FrameCrypto:
+		return fmt.Sprintf("CRYPTO(%d+%d)", f.Offset, len(f.Data))
+	case FrameACK, FrameACKECN:
+		return fmt.Sprintf("%v(%d)", f.Type, f.LargestAcked)
+	case FrameConnectionClose, FrameApplicationClose:
+		return fmt.Sprintf("CONNECTION_CLOSE(%#x %q)", f.ErrorCode, f.Reason)
+	}
+	return f.Type.String()
+}
+
+// varints decodes len(vs) variable length integers from the start of b,
+// returning what follows them.
+func varints(b []byte, vs ...*uint64) ([]byte, error) {
+	for _, v := range vs {
+		var n int
+		if *v, n = layers.QUICVarint(b); n == 0 {
+			return nil, fmt.Errorf("quic: frame truncated")
+		}
+		b = b[n:]
+	}
+	return b, nil
+}
+
+// decodeFrames decodes the frames of an Initial packet's payload, up to
+// the first it can't decode.
+func decodeFrames(b []byte) ([]Frame, error) {
+	var frames []Frame
+	for len(b) > 0 {
+		var typ uint64
+		var err error
+		if b, err = varints(b, &typ); err != nil {
+			return frames, err
+		}
+		f := Frame{Type: FrameType(typ)}
+		switch f.Type {
+		case FramePadding:
+			f.Length = 1
+			for len(b) > 0 && b[0] == 0 {
+				f.Length++
+				b = b[1:]
+			}
+		case FramePing:
+		case FrameACK, FrameACKECN:
+			var delay, count, first uint64
+			if b, err = varints(b, &f.LargestAcked, &delay, &count, &first); err != nil {
+				return frames, err
+			}
+			for i := uint64(0); i < count; i++ {
+				var gap, length uint64
+				if b, err = varints(b, &gap, &length); err != nil {
+					return frames, err
+				}
+			}
+			if f.Type == FrameACKECN {
+				var ect0, ect1, ce uint64
+				if b, err = varints(b, &ect0, &ect1, &ce); err != nil {
+					return frames, err
+				}
+			}
+		case FrameCrypto:
+			var length uint64
+			if b, err = varints(b, &f.Offset, &length); err != nil {
+				return frames, err
+			}
+			if uint64(len(b)) < length {
+				return frames, fmt.Errorf("quic: CRYPTO frame length %d exceeds packet", length)
+			}
+			f.Data, b = b[:length], b[length:]
+		case FrameConnectionClose, FrameApplicationClose:
+			if b, err = varints(b, &f.ErrorCode); err != nil {
+				return frames, err
+			}
+			var frameType, length uint64
+			if f.Type == FrameConnectionClose {
+				if b, err = varints(b, &frameType); err != nil {
+					return frames, err
+				}
+			}
+			if b, err = varints(b, &length); err != nil {
+				return frames, err
+			}
+			if uint64(len(b)) < length {
+				return frames, fmt.Errorf("quic: CONNECTION_CLOSE reason length %d exceeds packet", length)
+			}
+			f.Reason, b = string(b[:length]), b[length:]
+		default:
+			return frames, fmt.Errorf("quic: frame type %v not allowed in Initial packets", f.Type)
+		}
+		frames = append(frames, f)
+	}
+	return frames, nil
+}
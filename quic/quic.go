@@ -0,0 +1,243 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package quic removes the protection of QUIC Initial packets decoded by
+// layers.QUIC, exposing their packet numbers and frames.
+//
+// Initial packets are protected with keys derived from the destination
+// connection ID of the client's first Initial (RFC 9001 section 5.2), so
+// anyone seeing it can read the Initial packets of both sides, which carry
+// the TLS ClientHello and ServerHello in CRYPTO frames.  A Decrypter
+// follows the connection IDs of each handshake to pick the keys:
+//
+//	d := quic.NewDecrypter(packetcrypto.Default)
+//	for p := range source.Packets() {
+//	  q, ok := p.Layer(layers.LayerTypeQUIC).(*layers.QUIC)
+//	  if !ok {
+//	    continue
+//	  }
+//	  for i := range q.Packets {
+//	    if in, err := d.Initial(&q.Packets[i]); err == nil {
+//	      fmt.Println(in.PacketNumber, in.Frames)
+//	    }
+//	  }
+//	}
+//
+// Handshake and 1-RTT packets use keys from the TLS handshake, and aren't
+// decrypted.
+package quic
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/packetcrypto"
+)
+
+// Keys are the packet protection keys of one side of a connection.
+type Keys struct {
+	Key, IV, HP []byte
+}
+
+type versionParams struct {
+	salt   []byte
+	prefix string
+}
+
+var versions = map[layers.QUICVersion]versionParams{
+	layers.QUICVersion1: {
+		salt:   []byte{0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17, 0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a},
+		prefix: "quic ",
+	},
+	layers.QUICVersion2: {
+		salt:   []byte{0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93, 0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9},
+		prefix: "quicv2 ",
+	},
+	layers.QUICVersionDraft29: {
+		salt:   []byte{0xaf, 0xbf, 0xec, 0x28, 0x99, 0x93, 0xd2, 0x4c, 0x9e, 0x97, 0x86, 0xf1, 0x9c, 0x61, 0x11, 0xe0, 0x43, 0x90, 0xa8, 0x99},
+		prefix: "quic ",
+	},
+}
+
+// expandLabel is HKDF-Expand-Label of TLS 1.3 (RFC 8446 section 7.1), with
+// an empty context.
+func expandLabel(p packetcrypto.Provider, secret []byte, label string, length int) ([]byte, error) {
+	label = "tls13 " + label
+	info := []byte{byte(length >> 8), byte(length), byte(len(label))}
+	info = append(info, label...)
+	info = append(info, 0)
+	return packetcrypto.HKDFExpand(p, packetcrypto.SHA256, secret, info, length)
+}
+
+func keys(p packetcrypto.Provider, v versionParams, secret []byte) (Keys, error) {
+	var k Keys
+	var err error
+	if k.Key, err = expandLabel(p, secret, v.prefix+"key", 16); err != nil {
+		return k, err
+	}
+	if k.IV, err = expandLabel(p, secret, v.prefix+"iv", 12); err != nil {
+		return k, err
+	}
+	k.HP, err = expandLabel(p, secret, v.prefix+"hp", 16)
+	return k, err
+}
+
+// InitialKeys returns the keys protecting the client's and the server's
+// Initial packets of a connection of version v, whose client's first
+// Initial had the destination connection ID dcid.
+func InitialKeys(p packetcrypto.Provider, v layers.QUICVersion, dcid []byte) (client, server Keys, err error) {
+	params, ok := versions[v]
+	if !ok {
+		return client, server, fmt.Errorf("quic: unsupported version %v", v)
+	}
+	initial, err := packetcrypto.HKDFExtract(p, packetcrypto.SHA256, params.salt, dcid)
+	if err != nil {
+		return client, server, err
+	}
+	for _, s := range []struct {
+		label string
+		keys  *Keys
+	}{{"client in", &client}, {"server in", &server}} {
+		secret, err := expandLabel(p, initial, s.label, 32)
+		if err != nil {
+			return client, server, err
+		}
+		if *s.keys, err = keys(p, params, secret); err != nil {
+			return client, server, err
+		}
+	}
+	return client, server, nil
+}
+
+// Packet is an unprotected packet.
+type Packet struct {
+	// PacketNumber is the truncated packet number sent, which is the full
+	// packet number for the first packets of a connection.
+	PacketNumber uint64
+	Payload      []byte
+	Frames       []Frame
+}
+
+// ErrNotInitial is returned for packets other than Initial packets.
+var ErrNotInitial = errors.New("quic: not an Initial packet")
+
+// Unprotect removes the header protection of the long header packet pkt
+// with k, and decrypts its payload, decoding its frames.  The packet's
+// bytes aren't modified.
+func Unprotect(p packetcrypto.Provider, k Keys, pkt *layers.QUICPacket) (*Packet, error) {
+	if !pkt.LongHeader || len(pkt.Header) == 0 {
+		return nil, errors.New("quic: not a long header packet")
+	}
+	// The sample starts 4 bytes after the packet number starts, as though
+	// it were 4 bytes long.
+	if len(pkt.Protected) < 4+16 {
+		return nil, fmt.Errorf("quic: packet length %d too short to sample", len(pkt.Protected))
+	}
+	hp, err := p.NewAES(k.HP)
+	if err != nil {
+		return nil, err
+	}
+	mask := make([]byte, 16)
+	hp.Encrypt(mask, pkt.Protected[4:20])
+	first := pkt.Header[0] ^ mask[0]&0x0f
+	pnLen := int(first&3) + 1
+	header := make([]byte, len(pkt.Header)+pnLen)
+	copy(header, pkt.Header)
+	header[0] = first
+	var pn uint64
+	for i := 0; i < pnLen; i++ {
+		b := pkt.Protected[i] ^ mask[1+i]
+		header[len(pkt.Header)+i] = b
+		pn = pn<<8 | uint64(b)
+	}
+
+	aead, err := p.NewAESGCM(k.Key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := append([]byte(nil), k.IV...)
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], pn)
+	for i := range n {
+		nonce[len(nonce)-8+i] ^= n[i]
+	}
+	payload, err := open(aead, nonce, pkt.Protected[pnLen:], header)
+	if err != nil {
+		return nil, err
+	}
+	frames, err := decodeFrames(payload)
+	return &Packet{PacketNumber: pn, Payload: payload, Frames: frames}, err
+}
+
+func open(aead cipher.AEAD, nonce, ciphertext, aad []byte) ([]byte, error) {
+	out, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, errors.New("quic: packet authentication failed")
+	}
+	return out, nil
+}
+
+// Decrypter decrypts the Initial packets of the connections it sees.  It
+// is not safe for concurrent use.
+type Decrypter struct {
+	provider packetcrypto.Provider
+	// peers holds the side sent to by each connection ID.
+	peers map[string]peer
+}
+
+// peer is one side of a connection.
+type peer struct {
+	client, server *Keys
+	// toServer is set for the server's connection IDs, which the client
+	// sends to.
+	toServer bool
+}
+
+// keys returns the keys of the packets sent to p.
+func (p peer) keys() Keys {
+	if p.toServer {
+		return *p.client
+	}
+	return *p.server
+}
+
+// NewDecrypter returns a Decrypter using p's cryptography.
+func NewDecrypter(p packetcrypto.Provider) *Decrypter {
+	return &Decrypter{provider: p, peers: map[string]peer{}}
+}
+
+// Initial removes the protection of pkt, an Initial packet.  A client's
+// first Initial sets the keys of its connection: packets sent to its
+// destination connection ID are the client's, and packets sent to its
+// source connection ID are the server's.  The server's Initial in turn
+// adds its source connection ID for the client's later packets.
+func (d *Decrypter) Initial(pkt *layers.QUICPacket) (*Packet, error) {
+	if pkt.Type != layers.QUICPacketInitial {
+		return nil, ErrNotInitial
+	}
+	to, known := d.peers[string(pkt.DestConnID)]
+	if !known {
+		client, server, err := InitialKeys(d.provider, pkt.Version, pkt.DestConnID)
+		if err != nil {
+			return nil, err
+		}
+		to = peer{client: &client, server: &server, toServer: true}
+	}
+	out, err := Unprotect(d.provider, to.keys(), pkt)
+	if err != nil {
+		return nil, err
+	}
+	d.peers[string(pkt.DestConnID)] = to
+	if _, ok := d.peers[string(pkt.SrcConnID)]; !ok {
+		from := to
+		from.toServer = !to.toServer
+		d.peers[string(pkt.SrcConnID)] = from
+	}
+	return out, nil
+}
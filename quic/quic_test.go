@@ -0,0 +1,200 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package quic
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/packetcrypto"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// RFC 9001 appendix A.
+var rfcDCID = []byte{0x83, 0x94, 0xc8, 0xf0, 0x3e, 0x51, 0x57, 0x08}
+
+func TestInitialKeys(t *testing.T) {
+	client, server, err := InitialKeys(packetcrypto.Standard, layers.QUICVersion1, rfcDCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name      string
+		got, want []byte
+	}{
+		{"client key", client.Key, unhex(t, "1f369613dd76d5467730efcbe3b1a22d")},
+		{"client iv", client.IV, unhex(t, "fa044b2f42a3fd3b46fb255c")},
+		{"client hp", client.HP, unhex(t, "9f50449e04a0e810283a1e9933adedd2")},
+		{"server key", server.Key, unhex(t, "cf3a5331653c364c88f0f379b6067e37")},
+		{"server iv", server.IV, unhex(t, "0ac1493ca1905853b0bba03e")},
+		{"server hp", server.HP, unhex(t, "c206b8d9b9f0f37644430b490eeaa314")},
+	} {
+		if !bytes.Equal(c.got, c.want) {
+			t.Errorf("%s = %x, want %x", c.name, c.got, c.want)
+		}
+	}
+	if _, _, err := InitialKeys(packetcrypto.Standard, 0x1a2a3a4a, rfcDCID); err == nil {
+		t.Error("keys derived for unknown version")
+	}
+}
+
+func TestUnprotectServerInitial(t *testing.T) {
+	// RFC 9001 A.3, the server's Initial, holding an ACK and the
+	// ServerHello.
+	data := unhex(t, `
+		cf000000010008f067a5502a4262b5004075c0d95a482cd0991cd25b0aac406a
+		5816b6394100f37a1c69797554780bb38cc5a99f5ede4cf73c3ec2493a1839b3
+		dbcba3f6ea46c5b7684df3548e7ddeb9c3bf9c73cc3f3bded74b562bfb19fb84
+		022f8ef4cdd93795d77d06edbb7aaf2f58891850abbdca3d20398c276456cbc4
+		2158407dd074ee`)
+	_, server, err := InitialKeys(packetcrypto.Standard, layers.QUICVersion1, rfcDCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unprotect(packetcrypto.Standard, server, quicPacket(t, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PacketNumber != 1 || len(got.Frames) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	if f := got.Frames[0]; f.Type != FrameACK || f.LargestAcked != 0 {
+		t.Errorf("got frame %v", f)
+	}
+	if f := got.Frames[1]; f.Type != FrameCrypto || len(f.Data) != 90 || f.Data[0] != 2 {
+		t.Errorf("got frame %v, want a ServerHello", f)
+	}
+}
+
+// protect builds a v1 Initial packet holding payload, protected with k.
+func protect(t *testing.T, k Keys, dcid, scid []byte, pn uint32, payload []byte) []byte {
+	block, err := aes.NewCipher(k.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	length := 4 + len(payload) + aead.Overhead()
+	h := []byte{0xc3, 0, 0, 0, 1, byte(len(dcid))}
+	h = append(h, dcid...)
+	h = append(h, byte(len(scid)))
+	h = append(h, scid...)
+	h = append(h, 0, 0x40|byte(length>>8), byte(length))
+	pnOffset := len(h)
+	h = append(h, byte(pn>>24), byte(pn>>16), byte(pn>>8), byte(pn))
+	nonce := append([]byte(nil), k.IV...)
+	for i := 0; i < 4; i++ {
+		nonce[len(nonce)-4+i] ^= h[pnOffset+i]
+	}
+	out := aead.Seal(h, nonce, payload, h)
+
+	hp, err := aes.NewCipher(k.HP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mask := make([]byte, 16)
+	hp.Encrypt(mask, out[pnOffset+4:pnOffset+20])
+	out[0] ^= mask[0] & 0x0f
+	for i := 0; i < 4; i++ {
+		out[pnOffset+i] ^= mask[1+i]
+	}
+	return out
+}
+
+func quicPacket(t *testing.T, data []byte) *layers.QUICPacket {
+	p := gopacket.NewPacket(data, layers.LayerTypeQUIC, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	q := p.Layer(layers.LayerTypeQUIC).(*layers.QUIC)
+	if len(q.Packets) != 1 {
+		t.Fatalf("got %d packets, want 1", len(q.Packets))
+	}
+	return &q.Packets[0]
+}
+
+func TestDecrypter(t *testing.T) {
+	client, server, err := InitialKeys(packetcrypto.Standard, layers.QUICVersion1, rfcDCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientSCID := []byte{1, 2, 3, 4}
+	serverSCID := []byte{5, 6, 7, 8, 9}
+
+	hello := append([]byte{6, 0, 0x40, 20}, bytes.Repeat([]byte{0xaa}, 20)...)
+	payload := append(hello, make([]byte, 100)...)
+	d := NewDecrypter(packetcrypto.Standard)
+	got, err := d.Initial(quicPacket(t, protect(t, client, rfcDCID, clientSCID, 0, payload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PacketNumber != 0 || len(got.Frames) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	if f := got.Frames[0]; f.Type != FrameCrypto || f.Offset != 0 || !bytes.Equal(f.Data, hello[4:]) {
+		t.Errorf("got frame %v", f)
+	}
+	if f := got.Frames[1]; f.Type != FramePadding || f.Length != 100 {
+		t.Errorf("got frame %v", f)
+	}
+
+	// The server's Initial is sent to the client's source connection ID.
+	ack := []byte{2, 0, 0, 0, 0}
+	got, err = d.Initial(quicPacket(t, protect(t, server, clientSCID, serverSCID, 1, append(ack, make([]byte, 20)...))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PacketNumber != 1 || got.Frames[0].Type != FrameACK {
+		t.Errorf("got %+v", got)
+	}
+
+	// And the client's next one to the server's.
+	if _, err := d.Initial(quicPacket(t, protect(t, client, serverSCID, clientSCID, 2, append(ack, make([]byte, 20)...)))); err != nil {
+		t.Error(err)
+	}
+
+	// Tampering fails authentication.
+	data := protect(t, client, rfcDCID, clientSCID, 3, payload)
+	data[len(data)-1] ^= 1
+	if _, err := d.Initial(quicPacket(t, data)); err == nil {
+		t.Error("tampered packet decrypted")
+	}
+}
+
+func TestDecodeFrames(t *testing.T) {
+	b := []byte{
+		1,                   // PING
+		3, 5, 0, 1, 0, 2, 1, // ACK_ECN: largest 5, with one more range
+		1, 1, 1, // and the ECN counts
+		0x1c, 0x0a, 6, 3, 'b', 'y', 'e', // CONNECTION_CLOSE
+	}
+	frames, err := decodeFrames(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 || frames[1].LargestAcked != 5 || frames[2].ErrorCode != 0x0a || frames[2].Reason != "bye" {
+		t.Errorf("got %v", frames)
+	}
+	if _, err := decodeFrames([]byte{0x08, 0}); err == nil {
+		t.Error("STREAM frame decoded in Initial packet")
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package gopacket
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// DecodePanic is the error for a panic recovered from a decoder wrapped by
+// RecoverDecoder or RecoverDecodingLayer.
+type DecodePanic struct {
+	// Value is the value passed to panic, and Stack the stack of the
+	// goroutine when it was recovered.
+	Value interface{}
+	Stack []byte
+}
+
+func (e *DecodePanic) Error() string {
+	return fmt.Sprintf("decoder panic: %v", e.Value)
+}
+
+// RecoverDecoder wraps d, so that if it panics, the panic is recovered and
+// the packet gets a DecodeFailure layer with a DecodePanic error, after the
+// layers decoded so far.  Wrapping experimental or third party decoders
+// with it keeps their bugs from taking down a program that sets
+// SkipDecodeRecovery, and reports their stacks when it doesn't:
+//
+//	layers.EthernetTypeMetadata[0x88b5] = layers.EnumMetadata{
+//	  DecodeWith: gopacket.RecoverDecoder(gopacket.DecodeFunc(decodeExperiment)),
+//	  Name:       "Experiment",
+//	}
+func RecoverDecoder(d Decoder) Decoder {
+	return DecodeFunc(func(data []byte, p PacketBuilder) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				e := &DecodePanic{Value: r, Stack: debug.Stack()}
+				fail := &DecodeFailure{data: data, err: e, stack: e.Stack}
+				p.AddLayer(fail)
+				p.SetErrorLayer(fail)
+				err = nil
+			}
+		}()
+		return d.Decode(data, p)
+	})
+}
+
+type recoverDecodingLayer struct {
+	DecodingLayer
+}
+
+func (d recoverDecodingLayer) DecodeFromBytes(data []byte, df DecodeFeedback) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &DecodePanic{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return d.DecodingLayer.DecodeFromBytes(data, df)
+}
+
+// RecoverDecodingLayer wraps d, so that if DecodeFromBytes panics, it
+// returns a DecodePanic error instead.  DecodingLayerParser recovers from
+// panics itself unless IgnorePanic is set, but loses their stacks.
+func RecoverDecodingLayer(d DecodingLayer) DecodingLayer {
+	return recoverDecodingLayer{d}
+}
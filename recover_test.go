@@ -0,0 +1,79 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package gopacket
+
+import (
+	"strings"
+	"testing"
+)
+
+type headerLayer struct {
+	contents, payload []byte
+}
+
+func (h *headerLayer) LayerType() LayerType     { return LayerTypeFragment }
+func (h *headerLayer) LayerContents() []byte    { return h.contents }
+func (h *headerLayer) LayerPayload() []byte     { return h.payload }
+func (h *headerLayer) CanDecode() LayerClass    { return LayerTypeFragment }
+func (h *headerLayer) NextLayerType() LayerType { return LayerTypePayload }
+func (h *headerLayer) DecodeFromBytes(data []byte, df DecodeFeedback) error {
+	h.contents, h.payload = data[:2], data[2:]
+	return nil
+}
+
+var panicDecoder = DecodeFunc(func([]byte, PacketBuilder) error {
+	panic("experimental decoder bug")
+})
+
+func TestRecoverDecoder(t *testing.T) {
+	header := DecodeFunc(func(data []byte, p PacketBuilder) error {
+		h := &headerLayer{}
+		h.DecodeFromBytes(data, p)
+		p.AddLayer(h)
+		return p.NextDecoder(RecoverDecoder(panicDecoder))
+	})
+	for _, opts := range []DecodeOptions{{SkipDecodeRecovery: true}, {Lazy: true, SkipDecodeRecovery: true}, Default} {
+		p := NewPacket([]byte{1, 2, 3, 4}, header, opts)
+		layers := p.Layers()
+		if len(layers) != 2 || layers[0].LayerType() != LayerTypeFragment {
+			t.Fatalf("%+v: got layers %v", opts, layers)
+		}
+		fail, ok := p.ErrorLayer().(*DecodeFailure)
+		if !ok {
+			t.Fatalf("%+v: got error layer %v", opts, p.ErrorLayer())
+		}
+		e, ok := fail.Error().(*DecodePanic)
+		if !ok || e.Value != "experimental decoder bug" {
+			t.Fatalf("%+v: got error %v", opts, fail.Error())
+		}
+		if !strings.Contains(fail.Dump(), "recover_test.go") || string(fail.LayerContents()) != "\x03\x04" {
+			t.Errorf("%+v: got failure %q, stack %s", opts, fail.LayerContents(), fail.Dump())
+		}
+	}
+}
+
+type panicPayload struct {
+	Payload
+}
+
+func (p *panicPayload) DecodeFromBytes(data []byte, df DecodeFeedback) error {
+	panic("experimental decoder bug")
+}
+
+func TestRecoverDecodingLayer(t *testing.T) {
+	parser := NewDecodingLayerParser(LayerTypeFragment, &headerLayer{}, RecoverDecodingLayer(&panicPayload{}))
+	parser.IgnorePanic = true
+	var decoded []LayerType
+	err := parser.DecodeLayers([]byte{1, 2, 3, 4}, &decoded)
+	e, ok := err.(*DecodePanic)
+	if !ok || len(e.Stack) == 0 {
+		t.Fatalf("got error %v", err)
+	}
+	if len(decoded) != 1 || decoded[0] != LayerTypeFragment {
+		t.Errorf("got decoded layers %v", decoded)
+	}
+}
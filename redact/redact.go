@@ -0,0 +1,372 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package redact finds secrets and key material left in packets, and
+// overwrites them, so captures can be checked before they're shared.
+//
+// It looks for:
+//
+//   - EAPOL-Key handshake nonces and MICs, which allow offline attacks on
+//     WPA passphrases, and EAPOL-Key key data, which holds group keys.
+//   - TLS ClientKeyExchange messages, which hold the encrypted pre-master
+//     secret or the client's Diffie-Hellman share.
+//   - SNMPv1 and SNMPv2c community strings.
+//   - HTTP basic authentication credentials.
+//
+// Only what's visible in single packets is found: TLS records and HTTP
+// headers split across TCP segments aren't reassembled.
+//
+//	report, err := redact.Check(source, layers.LayerTypeEthernet)
+//	for _, f := range report.Findings {
+//	  fmt.Printf("packet %d: %v\n", f.Packet, f)
+//	}
+//
+// Redact overwrites findings in place, fixing TCP and UDP checksums, and
+// Copy writes a redacted copy of a capture.
+package redact
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// Kind is the kind of secret found.
+type Kind uint8
+
+const (
+	// EAPOLHandshake is the nonce and MIC of an EAPOL-Key frame.
+	EAPOLHandshake Kind = iota + 1
+	// EAPOLKeyData is the key data of an EAPOL-Key frame.
+	EAPOLKeyData
+	// TLSKeyExchange is the body of a TLS ClientKeyExchange message.
+	TLSKeyExchange
+	// SNMPCommunity is an SNMPv1 or SNMPv2c community string.
+	SNMPCommunity
+	// HTTPBasicAuth is the credentials of an HTTP Authorization or
+	// Proxy-Authorization header using the basic scheme.
+	HTTPBasicAuth
+)
+
+func (k Kind) String() string {
+	switch k {
+	case EAPOLHandshake:
+		return "EAPOLHandshake"
+	case EAPOLKeyData:
+		return "EAPOLKeyData"
+	case TLSKeyExchange:
+		return "TLSKeyExchange"
+	case SNMPCommunity:
+		return "SNMPCommunity"
+	case HTTPBasicAuth:
+		return "HTTPBasicAuth"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint8(k))
+}
+
+// fill returns the byte Redact overwrites secrets of kind k with: 'X' for
+// text, keeping it printable, and zero for key material.
+func (k Kind) fill() byte {
+	if k == SNMPCommunity || k == HTTPBasicAuth {
+		return 'X'
+	}
+	return 0
+}
+
+// Finding is a secret found in a packet.
+type Finding struct {
+	Kind Kind
+	// Offset and Length locate the secret in the packet data.  Some kinds,
+	// such as EAPOLHandshake, are reported as one finding per field.
+	Offset, Length int
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%v at bytes %d-%d", f.Kind, f.Offset, f.Offset+f.Length)
+}
+
+// offset returns the offset of sub in data, which it must be a subslice
+// of, or -1.
+func offset(data, sub []byte) int {
+	o := cap(data) - cap(sub)
+	if o < 0 || o+len(sub) > len(data) || (len(sub) > 0 && &data[o] != &sub[0]) {
+		return -1
+	}
+	return o
+}
+
+// Scan returns the secrets found in p.  p must have been decoded without
+// DecodeOptions.Lazy, so its layers are slices of its data.
+func Scan(p gopacket.Packet) []Finding {
+	data := p.Data()
+	var out []Finding
+	add := func(k Kind, field []byte) {
+		// Fields already redacted aren't reported again.
+		if o := offset(data, field); o >= 0 && len(field) > 0 && !filled(field, k.fill()) {
+			out = append(out, Finding{Kind: k, Offset: o, Length: len(field)})
+		}
+	}
+	if k, ok := p.Layer(layers.LayerTypeEAPOLKey).(*layers.EAPOLKey); ok {
+		scanEAPOLKey(k.Contents, add)
+	}
+	switch t := p.TransportLayer().(type) {
+	case *layers.TCP:
+		scanTLS(t.Payload, add)
+		scanHTTP(t.Payload, add)
+	case *layers.UDP:
+		if t.SrcPort == 161 || t.DstPort == 161 || t.SrcPort == 162 || t.DstPort == 162 {
+			scanSNMP(t.Payload, add)
+		}
+	}
+	return out
+}
+
+// Redact overwrites the secrets found in p's data, returning them.  Key
+// material is zeroed, and text such as communities and credentials is
+// replaced with 'X', keeping its length.  TCP and UDP checksums covering
+// changed data are recomputed.
+func Redact(p gopacket.Packet) []Finding {
+	found := Scan(p)
+	if len(found) == 0 {
+		return nil
+	}
+	data := p.Data()
+	for _, f := range found {
+		fill := f.Kind.fill()
+		for i := f.Offset; i < f.Offset+f.Length; i++ {
+			data[i] = fill
+		}
+	}
+	fixChecksum(p)
+	return found
+}
+
+// fixChecksum recomputes the checksum of p's TCP or UDP layer in place.
+func fixChecksum(p gopacket.Packet) {
+	n := p.NetworkLayer()
+	if n == nil {
+		return
+	}
+	var (
+		l        gopacket.SerializableLayer
+		contents []byte
+		at       int
+		csum     *uint16
+	)
+	switch t := p.TransportLayer().(type) {
+	case *layers.TCP:
+		if t.SetNetworkLayerForChecksum(n) != nil {
+			return
+		}
+		l, contents, at, csum = t, t.Contents, 16, &t.Checksum
+	case *layers.UDP:
+		// A zero UDP checksum over IPv4 means there is none.
+		if t.Checksum == 0 || t.SetNetworkLayerForChecksum(n) != nil {
+			return
+		}
+		l, contents, at, csum = t, t.Contents, 6, &t.Checksum
+	default:
+		return
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{ComputeChecksums: true}, l, gopacket.Payload(p.TransportLayer().LayerPayload())); err != nil {
+		return
+	}
+	binary.BigEndian.PutUint16(contents[at:], *csum)
+}
+
+// scanEAPOLKey finds the secrets in the body of an EAPOL-Key frame, which
+// is laid out as in IEEE 802.11 figure 12-32 with a 16 byte MIC.
+func scanEAPOLKey(k []byte, add func(Kind, []byte)) {
+	if len(k) < 95 {
+		return
+	}
+	add(EAPOLHandshake, k[13:45]) // nonce
+	add(EAPOLHandshake, k[77:93]) // MIC
+	n := int(binary.BigEndian.Uint16(k[93:95]))
+	if n > len(k)-95 {
+		n = len(k) - 95
+	}
+	add(EAPOLKeyData, k[95:95+n])
+}
+
+// filled returns true if every byte of b is c.
+func filled(b []byte, c byte) bool {
+	for _, x := range b {
+		if x != c {
+			return false
+		}
+	}
+	return true
+}
+
+// scanTLS finds ClientKeyExchange messages in TLS handshake records
+// starting at the beginning of data.
+func scanTLS(data []byte, add func(Kind, []byte)) {
+	for len(data) >= 5 {
+		typ, major, length := data[0], data[1], int(binary.BigEndian.Uint16(data[3:5]))
+		if typ < 20 || typ > 24 || major != 3 {
+			return
+		}
+		end := 5 + length
+		if end > len(data) {
+			end = len(data)
+		}
+		if typ == 22 {
+			msgs := data[5:end]
+			for len(msgs) >= 4 {
+				n := int(msgs[1])<<16 | int(msgs[2])<<8 | int(msgs[3])
+				if 4+n > len(msgs) {
+					n = len(msgs) - 4
+				}
+				if msgs[0] == 16 && n > 0 {
+					add(TLSKeyExchange, msgs[4:4+n])
+				}
+				msgs = msgs[4+n:]
+			}
+		}
+		data = data[end:]
+	}
+}
+
+// berElement returns the tag and contents of the BER element at the start
+// of data, and the data following it.
+func berElement(data []byte) (tag byte, contents, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, io.ErrUnexpectedEOF
+	}
+	tag, n := data[0], int(data[1])
+	data = data[2:]
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 3 || size > len(data) {
+			return 0, nil, nil, fmt.Errorf("unsupported BER length")
+		}
+		n = 0
+		for _, b := range data[:size] {
+			n = n<<8 | int(b)
+		}
+		data = data[size:]
+	}
+	if n > len(data) {
+		return 0, nil, nil, io.ErrUnexpectedEOF
+	}
+	return tag, data[:n], data[n:], nil
+}
+
+// scanSNMP finds the community of an SNMPv1 or SNMPv2c message.
+func scanSNMP(data []byte, add func(Kind, []byte)) {
+	tag, msg, _, err := berElement(data)
+	if err != nil || tag != 0x30 {
+		return
+	}
+	tag, version, msg, err := berElement(msg)
+	if err != nil || tag != 0x02 || len(version) != 1 || version[0] > 1 {
+		return
+	}
+	tag, community, _, err := berElement(msg)
+	if err != nil || tag != 0x04 {
+		return
+	}
+	add(SNMPCommunity, community)
+}
+
+// scanHTTP finds basic authentication credentials in HTTP request headers.
+func scanHTTP(data []byte, add func(Kind, []byte)) {
+	for {
+		i := bytes.Index(data, []byte("\r\n"))
+		if i < 0 {
+			return
+		}
+		data = data[i+2:]
+		end := bytes.Index(data, []byte("\r\n"))
+		if end < 0 {
+			end = len(data)
+		}
+		line := data[:end]
+		colon := bytes.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		name := string(bytes.TrimSpace(line[:colon]))
+		if !strings.EqualFold(name, "Authorization") && !strings.EqualFold(name, "Proxy-Authorization") {
+			continue
+		}
+		value := line[colon+1:]
+		value = value[len(value)-len(bytes.TrimLeft(value, " \t")):]
+		if len(value) < 6 || !strings.EqualFold(string(value[:6]), "basic ") {
+			continue
+		}
+		creds := bytes.TrimSpace(value[6:])
+		add(HTTPBasicAuth, creds)
+	}
+}
+
+// PacketFinding is a secret found in a packet of a capture.
+type PacketFinding struct {
+	// Packet is the index of the packet in the capture, from 0.
+	Packet int
+	Finding
+}
+
+// Report is the result of checking a capture.
+type Report struct {
+	Packets  int
+	Findings []PacketFinding
+}
+
+// Clean returns true if no secrets were found.
+func (r *Report) Clean() bool {
+	return len(r.Findings) == 0
+}
+
+// Check scans every packet read from src, decoded with dec, such as a
+// capture's link type.
+func Check(src gopacket.PacketDataSource, dec gopacket.Decoder) (*Report, error) {
+	return process(src, dec, nil)
+}
+
+// PacketWriter writes packets, like pcapgo.Writer and pcapgo.NgWriter.
+type PacketWriter interface {
+	WritePacket(ci gopacket.CaptureInfo, data []byte) error
+}
+
+// Copy redacts every packet read from src, decoded with dec, writing it to
+// dst.  The returned report lists what was redacted.
+func Copy(dst PacketWriter, src gopacket.PacketDataSource, dec gopacket.Decoder) (*Report, error) {
+	return process(src, dec, dst)
+}
+
+func process(src gopacket.PacketDataSource, dec gopacket.Decoder, dst PacketWriter) (*Report, error) {
+	r := &Report{}
+	for {
+		data, ci, err := src.ReadPacketData()
+		if err == io.EOF {
+			return r, nil
+		} else if err != nil {
+			return r, err
+		}
+		p := gopacket.NewPacket(data, dec, gopacket.Default)
+		var found []Finding
+		if dst != nil {
+			found = Redact(p)
+			if err := dst.WritePacket(ci, p.Data()); err != nil {
+				return r, err
+			}
+		} else {
+			found = Scan(p)
+		}
+		for _, f := range found {
+			r.Findings = append(r.Findings, PacketFinding{Packet: r.Packets, Finding: f})
+		}
+		r.Packets++
+	}
+}
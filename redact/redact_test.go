@@ -0,0 +1,186 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package redact
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/pcapgo"
+)
+
+var (
+	clientMAC = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	serverMAC = net.HardwareAddr{2, 0, 0, 0, 0, 2}
+)
+
+func serialize(t *testing.T, l ...gopacket.SerializableLayer) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, l...); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func ipPacket(t *testing.T, transport gopacket.SerializableLayer, payload []byte) []byte {
+	eth := &layers.Ethernet{SrcMAC: clientMAC, DstMAC: serverMAC, EthernetType: layers.EthernetTypeIPv4}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		SrcIP:    net.IP{192, 0, 2, 1},
+		DstIP:    net.IP{192, 0, 2, 2},
+		Protocol: layers.IPProtocolTCP,
+	}
+	switch l := transport.(type) {
+	case *layers.TCP:
+		l.SetNetworkLayerForChecksum(ip)
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		l.SetNetworkLayerForChecksum(ip)
+	}
+	return serialize(t, eth, ip, transport, gopacket.Payload(payload))
+}
+
+func eapolKeyPacket(t *testing.T) []byte {
+	key := make([]byte, 95+8)
+	key[0] = 2
+	binary.BigEndian.PutUint16(key[1:3], 0x010a) // MIC set, pairwise, version 2
+	for i := 13; i < 45; i++ {
+		key[i] = 0xaa // nonce
+	}
+	for i := 77; i < 93; i++ {
+		key[i] = 0xbb // MIC
+	}
+	binary.BigEndian.PutUint16(key[93:95], 8)
+	copy(key[95:], "keydata!")
+	eapol := []byte{2, 3, 0, byte(len(key))}
+	eth := &layers.Ethernet{SrcMAC: clientMAC, DstMAC: serverMAC, EthernetType: layers.EthernetTypeEAPOL}
+	return serialize(t, eth, gopacket.Payload(append(eapol, key...)))
+}
+
+func testPackets(t *testing.T) [][]byte {
+	http := []byte("GET / HTTP/1.1\r\nHost: example.com\r\nauthorization:  Basic dXNlcjpwYXNz\r\n\r\n")
+	tls := []byte{
+		0x16, 0x03, 0x03, 0x00, 0x0a, 0x10, 0x00, 0x00, 0x06, 1, 2, 3, 4, 5, 6,
+		0x14, 0x03, 0x03, 0x00, 0x01, 0x01,
+	}
+	snmp := []byte{
+		0x30, 0x18, 0x02, 0x01, 0x01, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+		0xa0, 0x0b, 0x02, 0x01, 0x01, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00, 0x30, 0x00,
+	}
+	return [][]byte{
+		ipPacket(t, &layers.TCP{SrcPort: 50000, DstPort: 80, ACK: true, PSH: true, Window: 1000}, http),
+		ipPacket(t, &layers.TCP{SrcPort: 50001, DstPort: 443, ACK: true, PSH: true, Window: 1000}, tls),
+		ipPacket(t, &layers.UDP{SrcPort: 50002, DstPort: 161}, snmp),
+		eapolKeyPacket(t),
+		ipPacket(t, &layers.UDP{SrcPort: 50003, DstPort: 53}, []byte("nothing to see")),
+	}
+}
+
+func TestScan(t *testing.T) {
+	want := [][]Kind{
+		{HTTPBasicAuth},
+		{TLSKeyExchange},
+		{SNMPCommunity},
+		{EAPOLHandshake, EAPOLHandshake, EAPOLKeyData},
+		nil,
+	}
+	for i, data := range testPackets(t) {
+		p := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+		var got []Kind
+		for _, f := range Scan(p) {
+			got = append(got, f.Kind)
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("packet %d: got %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	for i, data := range testPackets(t) {
+		p := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+		found := Redact(p)
+		for _, f := range found {
+			field := p.Data()[f.Offset : f.Offset+f.Length]
+			if f.Kind == HTTPBasicAuth || f.Kind == SNMPCommunity {
+				if !bytes.Equal(field, bytes.Repeat([]byte("X"), f.Length)) {
+					t.Errorf("packet %d: %v left %q", i, f, field)
+				}
+			} else if !bytes.Equal(field, make([]byte, f.Length)) {
+				t.Errorf("packet %d: %v left %x", i, f, field)
+			}
+		}
+		if f := Scan(gopacket.NewPacket(p.Data(), layers.LayerTypeEthernet, gopacket.Default)); len(f) != 0 {
+			t.Errorf("packet %d: found %v after redaction", i, f)
+		}
+		// The transport checksum must match the redacted payload.
+		rp := gopacket.NewPacket(p.Data(), layers.LayerTypeEthernet, gopacket.Default)
+		switch l := rp.TransportLayer().(type) {
+		case *layers.TCP:
+			want := l.Checksum
+			l.SetNetworkLayerForChecksum(rp.NetworkLayer())
+			serialize(t, l, gopacket.Payload(l.Payload))
+			if l.Checksum != want {
+				t.Errorf("packet %d: TCP checksum %#x, want %#x", i, want, l.Checksum)
+			}
+		case *layers.UDP:
+			want := l.Checksum
+			l.SetNetworkLayerForChecksum(rp.NetworkLayer())
+			serialize(t, l, gopacket.Payload(l.Payload))
+			if l.Checksum != want {
+				t.Errorf("packet %d: UDP checksum %#x, want %#x", i, want, l.Checksum)
+			}
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	var in, out bytes.Buffer
+	w := pcapgo.NewWriter(&in)
+	w.WriteFileHeader(65536, layers.LinkTypeEthernet)
+	for i, data := range testPackets(t) {
+		ci := gopacket.CaptureInfo{Timestamp: time.Unix(int64(i), 0), CaptureLength: len(data), Length: len(data)}
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := pcapgo.NewReader(bytes.NewReader(in.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ow := pcapgo.NewWriter(&out)
+	ow.WriteFileHeader(65536, layers.LinkTypeEthernet)
+	report, err := Copy(ow, r, layers.LayerTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Packets != 5 || len(report.Findings) != 6 || report.Clean() {
+		t.Errorf("got report %+v", report)
+	}
+	if f := report.Findings[3]; f.Packet != 3 || f.Kind != EAPOLHandshake {
+		t.Errorf("got finding %+v", f)
+	}
+
+	r, err = pcapgo.NewReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = Check(r, layers.LayerTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Packets != 5 || !report.Clean() {
+		t.Errorf("redacted capture has findings %+v", report)
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package roam reports 802.11 roams and how clients authenticated for them.
+//
+// An Analyzer follows (re)associations to find clients moving between
+// BSSes, and RSN pre-authentication exchanges, which are EAPOL frames a
+// client sends through the distribution system (EtherType 0x88c7) to
+// authenticate with an AP before roaming to it.  Each Roam is linked to the
+// pre-authentication that preceded it, and records whether the client
+// offered a cached PMK, so that fast roams using pre-authentication or
+// opportunistic key caching (OKC) can be told from full authentications:
+//
+//	a := roam.NewAnalyzer(roam.DefaultConfig)
+//	for p := range source.Packets() {
+//	  if r := a.Add(p); r != nil {
+//	    fmt.Println(r)
+//	  }
+//	}
+package roam
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// Kind is how a client authenticated for a roam.
+type Kind int
+
+const (
+	// FullAuth means the client offered no cached PMK, and so ran a full
+	// authentication after roaming.
+	FullAuth Kind = iota
+	// PMKCaching means the client offered a cached PMK without having
+	// pre-authenticated, as with opportunistic key caching or a return to
+	// an AP it authenticated with before.
+	PMKCaching
+	// PreAuthenticated means the client offered a cached PMK derived by
+	// pre-authenticating with the AP.
+	PreAuthenticated
+)
+
+func (k Kind) String() string {
+	switch k {
+	case FullAuth:
+		return "FullAuth"
+	case PMKCaching:
+		return "PMKCaching"
+	case PreAuthenticated:
+		return "PreAuthenticated"
+	}
+	return fmt.Sprintf("UnknownKind(%d)", int(k))
+}
+
+// PreAuth is an RSN pre-authentication exchange between a client and an AP
+// it may roam to.
+type PreAuth struct {
+	Client, BSSID net.HardwareAddr
+	Start, End    time.Time
+	// Frames counts the EAPOL frames of the exchange.
+	Frames int
+	// Success is true if the AP sent an EAP success.
+	Success bool
+}
+
+// Roam is a client's move from one BSS to another.
+type Roam struct {
+	Client, From, To net.HardwareAddr
+	Time             time.Time
+	// PMKID is true if the client's (re)association request listed a
+	// PMKID.
+	PMKID bool
+	// PreAuth is the successful pre-authentication with To that preceded
+	// the roam, if any.
+	PreAuth *PreAuth
+}
+
+// Kind returns how the client authenticated for r.
+func (r *Roam) Kind() Kind {
+	switch {
+	case !r.PMKID:
+		return FullAuth
+	case r.PreAuth != nil:
+		return PreAuthenticated
+	}
+	return PMKCaching
+}
+
+func (r *Roam) String() string {
+	return fmt.Sprintf("%v roamed from %v to %v at %v: %v", r.Client, r.From, r.To, r.Time.Format(time.RFC3339Nano), r.Kind())
+}
+
+// Config configures an Analyzer.
+type Config struct {
+	// Window is how long after a pre-authentication a roam to the same AP
+	// is linked to it.
+	Window time.Duration
+}
+
+// DefaultConfig links roams to pre-authentications in the last 10 minutes.
+var DefaultConfig = Config{Window: 10 * time.Minute}
+
+// request is a (re)association request waiting for its response.
+type request struct {
+	from  net.HardwareAddr
+	pmkid bool
+}
+
+// Analyzer finds roams and pre-authentications.  It is not safe for
+// concurrent use.
+type Analyzer struct {
+	Config
+	// bssids holds the BSS each client is associated with.
+	bssids map[string]net.HardwareAddr
+	// requests holds clients' last (re)association requests, keyed by
+	// client and BSSID.
+	requests map[string]request
+	// preauths holds the last pre-authentication, keyed by client and
+	// BSSID.
+	preauths map[string]*PreAuth
+}
+
+// NewAnalyzer creates an Analyzer with the given configuration.
+func NewAnalyzer(c Config) *Analyzer {
+	return &Analyzer{
+		Config:   c,
+		bssids:   map[string]net.HardwareAddr{},
+		requests: map[string]request{},
+		preauths: map[string]*PreAuth{},
+	}
+}
+
+func key(client, bssid net.HardwareAddr) string {
+	return string(client) + string(bssid)
+}
+
+// Add processes p, and returns the roam it completes, if any.
+func (a *Analyzer) Add(p gopacket.Packet) *Roam {
+	ts := p.Metadata().Timestamp
+	if eapol, ok := p.Layer(layers.LayerTypeEAPOL).(*layers.EAPOL); ok {
+		a.preauth(p, eapol, ts)
+		return nil
+	}
+	d, ok := p.Layer(layers.LayerTypeDot11).(*layers.Dot11)
+	if !ok {
+		return nil
+	}
+	switch m := p.Layer(d.NextLayerType()).(type) {
+	case *layers.Dot11MgmtAssociationReq:
+		a.requests[key(d.Address2, d.Address3)] = request{pmkid: hasPMKID(p)}
+	case *layers.Dot11MgmtReassociationReq:
+		a.requests[key(d.Address2, d.Address3)] = request{
+			from:  append(net.HardwareAddr(nil), m.CurrentApAddress...),
+			pmkid: hasPMKID(p),
+		}
+	case *layers.Dot11MgmtAssociationResp:
+		if m.Status == layers.Dot11StatusSuccess {
+			return a.associated(d.Address1, d.Address3, ts)
+		}
+	case *layers.Dot11MgmtReassociationResp:
+		if m.Status == layers.Dot11StatusSuccess {
+			return a.associated(d.Address1, d.Address3, ts)
+		}
+	}
+	return nil
+}
+
+// associated records client's association with bssid, and returns the
+// roam if it came from another BSS.
+func (a *Analyzer) associated(client, bssid net.HardwareAddr, ts time.Time) *Roam {
+	k := key(client, bssid)
+	req := a.requests[k]
+	delete(a.requests, k)
+	from := a.bssids[string(client)]
+	if req.from != nil {
+		from = req.from
+	}
+	a.bssids[string(client)] = append(net.HardwareAddr(nil), bssid...)
+	if from == nil || string(from) == string(bssid) {
+		return nil
+	}
+	r := &Roam{
+		Client: append(net.HardwareAddr(nil), client...),
+		From:   from,
+		To:     append(net.HardwareAddr(nil), bssid...),
+		Time:   ts,
+		PMKID:  req.pmkid,
+	}
+	if pa := a.preauths[k]; pa != nil && pa.Success && ts.Sub(pa.End) <= a.Window {
+		r.PreAuth = pa
+		delete(a.preauths, k)
+	}
+	return r
+}
+
+// preauth records eapol if p is a pre-authentication frame.
+func (a *Analyzer) preauth(p gopacket.Packet, eapol *layers.EAPOL, ts time.Time) {
+	src, dst, ok := endpoints(p)
+	if !ok {
+		return
+	}
+	// Requests and results come from the AP, and everything else from the
+	// client.
+	eap, _ := p.Layer(layers.LayerTypeEAP).(*layers.EAP)
+	client, bssid := src, dst
+	if eap != nil && eap.Code != layers.EAPCodeResponse {
+		client, bssid = dst, src
+	}
+	k := key(client, bssid)
+	pa := a.preauths[k]
+	if pa == nil || (eapol.Type == layers.EAPOLTypeStart && pa.Frames > 0) {
+		pa = &PreAuth{
+			Client: append(net.HardwareAddr(nil), client...),
+			BSSID:  append(net.HardwareAddr(nil), bssid...),
+			Start:  ts,
+		}
+		a.preauths[k] = pa
+	}
+	pa.End = ts
+	pa.Frames++
+	if eap != nil && (eap.Code == layers.EAPCodeSuccess || eap.Code == layers.EAPCodeFailure) {
+		pa.Success = eap.Code == layers.EAPCodeSuccess
+	}
+}
+
+// endpoints returns the source and destination of p if it is a
+// pre-authentication frame, whether bridged onto Ethernet or sent over the
+// air.
+func endpoints(p gopacket.Packet) (src, dst net.HardwareAddr, ok bool) {
+	if eth, ok := p.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok {
+		typ := eth.EthernetType
+		if q, ok := p.Layer(layers.LayerTypeDot1Q).(*layers.Dot1Q); ok {
+			typ = q.Type
+		}
+		return eth.SrcMAC, eth.DstMAC, typ == layers.EthernetTypeRSNPreAuth
+	}
+	snap, ok := p.Layer(layers.LayerTypeSNAP).(*layers.SNAP)
+	if !ok || snap.Type != layers.EthernetTypeRSNPreAuth {
+		return nil, nil, false
+	}
+	d, ok := p.Layer(layers.LayerTypeDot11).(*layers.Dot11)
+	if !ok {
+		return nil, nil, false
+	}
+	switch {
+	case d.Flags.ToDS() && d.Flags.FromDS():
+		return d.Address4, d.Address3, true
+	case d.Flags.ToDS():
+		return d.Address2, d.Address3, true
+	case d.Flags.FromDS():
+		return d.Address3, d.Address1, true
+	}
+	return d.Address2, d.Address1, true
+}
+
+// hasPMKID returns true if the RSN element of p lists a PMKID.
+func hasPMKID(p gopacket.Packet) bool {
+	for _, l := range p.Layers() {
+		e, ok := l.(*layers.Dot11InformationElement)
+		if !ok || e.ID != layers.Dot11InformationElementIDRSNInfo {
+			continue
+		}
+		// Skip the version, group cipher and pairwise cipher and AKM suite
+		// lists, then the capabilities, to the PMKID count.
+		b := e.Info
+		if len(b) < 8 {
+			return false
+		}
+		b = b[6:]
+		for i := 0; i < 2; i++ {
+			if len(b) < 2 {
+				return false
+			}
+			n := 2 + 4*int(binary.LittleEndian.Uint16(b))
+			if len(b) < n {
+				return false
+			}
+			b = b[n:]
+		}
+		return len(b) >= 4 && binary.LittleEndian.Uint16(b[2:]) > 0
+	}
+	return false
+}
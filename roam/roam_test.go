@@ -0,0 +1,135 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package roam
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/statestore"
+)
+
+var (
+	ap1    = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	ap2    = net.HardwareAddr{2, 0, 0, 0, 0, 2}
+	ap3    = net.HardwareAddr{2, 0, 0, 0, 0, 3}
+	client = net.HardwareAddr{0, 3, 0x93, 0, 0, 1}
+)
+
+func decode(t *testing.T, data []byte, first gopacket.Decoder, sec int64) gopacket.Packet {
+	p := gopacket.NewPacket(data, first, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	p.Metadata().Timestamp = time.Unix(sec, 0)
+	return p
+}
+
+// preauth returns a pre-authentication frame bridged onto Ethernet.
+func preauth(t *testing.T, src, dst net.HardwareAddr, sec int64, eapol ...byte) gopacket.Packet {
+	data := append(append(append([]byte{}, dst...), src...), 0x88, 0xc7)
+	return decode(t, append(data, eapol...), layers.LinkTypeEthernet, sec)
+}
+
+// mgmt returns a management frame with the given frame control byte,
+// addresses and body.
+func mgmt(t *testing.T, fc byte, a1, a2, a3 net.HardwareAddr, sec int64, body ...byte) gopacket.Packet {
+	data := []byte{fc, 0, 0, 0}
+	data = append(append(append(data, a1...), a2...), a3...)
+	data = append(data, 0, 0)
+	data = append(data, body...)
+	data = append(data, 0, 0, 0, 0) // FCS
+	return decode(t, data, layers.LayerTypeDot11, sec)
+}
+
+// reassociate returns a reassociation request from client to ap, roaming
+// from current, with an RSN element listing a PMKID if pmkid is set.
+func reassociate(t *testing.T, ap, current net.HardwareAddr, pmkid bool, sec int64) gopacket.Packet {
+	body := append([]byte{0x11, 0x00, 0x0a, 0x00}, current...)
+	rsn := []byte{0x01, 0x00, 0x00, 0x0f, 0xac, 0x04, 0x01, 0x00, 0x00, 0x0f, 0xac, 0x04, 0x01, 0x00, 0x00, 0x0f, 0xac, 0x01, 0x00, 0x00}
+	if pmkid {
+		rsn = append(rsn, 0x01, 0x00)
+		rsn = append(rsn, make([]byte, 16)...)
+	}
+	body = append(body, 0x30, byte(len(rsn)))
+	return mgmt(t, 0x20, ap, client, ap, sec, append(body, rsn...)...)
+}
+
+func reassociated(t *testing.T, ap net.HardwareAddr, sec int64) gopacket.Packet {
+	return mgmt(t, 0x30, client, ap, ap, sec, 0x11, 0x00, 0x00, 0x00, 0x01, 0xc0)
+}
+
+func TestAnalyzer(t *testing.T) {
+	a := NewAnalyzer(DefaultConfig)
+	if r := a.Add(reassociated(t, ap1, 100)); r != nil {
+		t.Errorf("initial association reported as %v", r)
+	}
+
+	// Pre-authenticate with ap2 through ap1, then roam to it.
+	a.Add(preauth(t, client, ap2, 110, 0x02, 0x01, 0x00, 0x00))
+	a.Add(preauth(t, ap2, client, 110, 0x02, 0x00, 0x00, 0x05, 0x01, 0x01, 0x00, 0x05, 0x01))
+	a.Add(preauth(t, client, ap2, 111, 0x02, 0x00, 0x00, 0x06, 0x02, 0x01, 0x00, 0x06, 0x01, 'a'))
+	a.Add(preauth(t, ap2, client, 112, 0x02, 0x00, 0x00, 0x04, 0x03, 0x01, 0x00, 0x04))
+	a.Add(reassociate(t, ap2, ap1, true, 130))
+	r := a.Add(reassociated(t, ap2, 130))
+	if r == nil || r.Kind() != PreAuthenticated || r.From.String() != ap1.String() || r.To.String() != ap2.String() {
+		t.Fatalf("got %v", r)
+	}
+	if pa := r.PreAuth; pa.Frames != 4 || !pa.Success || pa.Start.Unix() != 110 || pa.End.Unix() != 112 {
+		t.Errorf("got pre-authentication %+v", pa)
+	}
+
+	// Roam to ap3 with a cached PMK but no pre-authentication.
+	a.Add(reassociate(t, ap3, ap2, true, 200))
+	if r := a.Add(reassociated(t, ap3, 200)); r == nil || r.Kind() != PMKCaching {
+		t.Errorf("got %v", r)
+	}
+	// Roam back to ap1 with a full authentication.
+	a.Add(reassociate(t, ap1, ap3, false, 300))
+	if r := a.Add(reassociated(t, ap1, 300)); r == nil || r.Kind() != FullAuth || r.From.String() != ap3.String() {
+		t.Errorf("got %v", r)
+	}
+}
+
+func TestAnalyzerExpiredPreAuth(t *testing.T) {
+	a := NewAnalyzer(Config{Window: time.Minute})
+	a.Add(reassociated(t, ap1, 100))
+	a.Add(preauth(t, ap2, client, 110, 0x02, 0x00, 0x00, 0x04, 0x03, 0x01, 0x00, 0x04))
+	a.Add(reassociate(t, ap2, ap1, true, 300))
+	if r := a.Add(reassociated(t, ap2, 300)); r == nil || r.PreAuth != nil || r.Kind() != PMKCaching {
+		t.Errorf("got %v", r)
+	}
+}
+
+func TestSaveRestore(t *testing.T) {
+	a := NewAnalyzer(DefaultConfig)
+	a.Add(reassociated(t, ap1, 100))
+	a.Add(preauth(t, client, ap2, 110, 0x02, 0x01, 0x00, 0x00))
+	a.Add(preauth(t, ap2, client, 112, 0x02, 0x00, 0x00, 0x04, 0x03, 0x01, 0x00, 0x04))
+	a.Add(reassociate(t, ap2, ap1, true, 130))
+	s := statestore.NewMemory()
+	if err := a.Save(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// The association, pre-authentication and pending request all survive,
+	// so the restored analyzer completes the roam.
+	restored := NewAnalyzer(DefaultConfig)
+	if err := restored.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	r := restored.Add(reassociated(t, ap2, 130))
+	if r == nil || r.Kind() != PreAuthenticated || r.From.String() != ap1.String() || r.To.String() != ap2.String() {
+		t.Fatalf("got %v after restore", r)
+	}
+	if pa := r.PreAuth; pa.Frames != 2 || !pa.Success || pa.Start.Unix() != 110 || pa.End.Unix() != 112 {
+		t.Errorf("got pre-authentication %+v after restore", pa)
+	}
+}
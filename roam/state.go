@@ -0,0 +1,95 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package roam
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"strings"
+
+	"github.com/mistsys/gopacket/statestore"
+)
+
+// The analyzer's state is saved under three prefixes, one per map, with
+// the hex encoding of the map keys.
+const (
+	statePrefix        = "roam/"
+	statePrefixBSSID   = statePrefix + "bssid/"
+	statePrefixRequest = statePrefix + "request/"
+	statePrefixPreAuth = statePrefix + "preauth/"
+)
+
+// requestState is the saved form of a request.
+type requestState struct {
+	From  net.HardwareAddr `json:"from"`
+	PMKID bool             `json:"pmkid"`
+}
+
+// Save writes the analyzer's associations, pending requests and
+// pre-authentications to s, replacing any saved before.
+func (a *Analyzer) Save(s statestore.Store) error {
+	if err := statestore.Clear(s, statePrefix); err != nil {
+		return err
+	}
+	for k, b := range a.bssids {
+		if err := statestore.PutJSON(s, statePrefixBSSID+hex.EncodeToString([]byte(k)), b); err != nil {
+			return err
+		}
+	}
+	for k, r := range a.requests {
+		if err := statestore.PutJSON(s, statePrefixRequest+hex.EncodeToString([]byte(k)), requestState{r.from, r.pmkid}); err != nil {
+			return err
+		}
+	}
+	for k, pa := range a.preauths {
+		if err := statestore.PutJSON(s, statePrefixPreAuth+hex.EncodeToString([]byte(k)), pa); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore adds the state saved in s to the analyzer.
+func (a *Analyzer) Restore(s statestore.Store) error {
+	return s.Scan(statePrefix, func(key string, v []byte) error {
+		var prefix string
+		for _, p := range []string{statePrefixBSSID, statePrefixRequest, statePrefixPreAuth} {
+			if strings.HasPrefix(key, p) {
+				prefix = p
+			}
+		}
+		if prefix == "" {
+			return nil
+		}
+		k, err := hex.DecodeString(key[len(prefix):])
+		if err != nil {
+			return err
+		}
+		switch prefix {
+		case statePrefixBSSID:
+			var b net.HardwareAddr
+			if err := json.Unmarshal(v, &b); err != nil {
+				return err
+			}
+			a.bssids[string(k)] = b
+		case statePrefixRequest:
+			var r requestState
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			a.requests[string(k)] = request{from: r.From, pmkid: r.PMKID}
+		case statePrefixPreAuth:
+			pa := &PreAuth{}
+			if err := json.Unmarshal(v, pa); err != nil {
+				return err
+			}
+			a.preauths[string(k)] = pa
+		}
+		return nil
+	})
+}
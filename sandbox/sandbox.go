@@ -0,0 +1,293 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package sandbox runs independent decoding pipelines in one process, each
+// with its own decoder table, memory budget and statistics.
+//
+// The decoders of the layers package are chosen from global tables, like
+// layers.EthernetTypeMetadata, which every goroutine shares.  A Sandbox
+// instead overrides the decoders of enum values and layer types for its
+// packets only, leaving the global tables alone, so one tenant may decode
+// a proprietary EtherType or turn a decoder off without affecting the
+// others.  Each Sandbox also bounds the bytes of its packets held at once,
+// and recovers from panics in its decoders:
+//
+//	r := sandbox.NewRegistry()
+//	s, err := r.Add("customer-a", sandbox.Config{
+//	  MaxBytes: 64 << 20,
+//	  Decoders: map[gopacket.Decoder]gopacket.Decoder{
+//	    layers.EthernetType(0x88b5): gopacket.DecodeFunc(decodeExperiment),
+//	    layers.LayerTypeDNS:         gopacket.DecodePayload,
+//	  },
+//	})
+//	...
+//	p, err := s.NewPacket(data, layers.LayerTypeEthernet, ci)
+//	if err == nil {
+//	  process(p)
+//	  s.Release(p)
+//	}
+//	fmt.Println(r.Stats())
+//
+// Packets of a Sandbox are always decoded eagerly.
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/mistsys/gopacket"
+)
+
+// ErrBudget is returned for packets that would take a Sandbox over its
+// memory budget.
+var ErrBudget = errors.New("sandbox: memory budget exceeded")
+
+// Config configures a Sandbox.
+type Config struct {
+	// MaxBytes bounds the bytes of packets not yet released, or is zero
+	// for no bound.
+	MaxBytes int64
+	// Decoders override the decoders of the keys, which are the values
+	// decoders pass to PacketBuilder.NextDecoder: enum values like
+	// layers.EthernetType, or gopacket.LayerTypes, such as those IPv4
+	// passes for its protocols.  Keys must be comparable.
+	// gopacket.DecodePayload turns decoding off.
+	Decoders map[gopacket.Decoder]gopacket.Decoder
+}
+
+// Stats are the statistics of a Sandbox.
+type Stats struct {
+	Name    string
+	Packets uint64
+	Bytes   uint64
+	// Errors counts packets with an error layer, and Panics those of them
+	// whose decoder panicked.
+	Errors uint64
+	Panics uint64
+	// Dropped counts packets refused for exceeding the memory budget.
+	Dropped uint64
+	// InUse is the bytes of packets not yet released, and PeakInUse the
+	// most there have been.
+	InUse, PeakInUse int64
+	// Layers counts the layers of each type decoded.
+	Layers map[gopacket.LayerType]uint64
+}
+
+// Sandbox decodes packets with its own decoder table and memory budget.
+// It is safe for concurrent use.
+type Sandbox struct {
+	name     string
+	maxBytes int64
+	decoders map[gopacket.Decoder]gopacket.Decoder
+	// types are the types of the keys of decoders, so only values of
+	// those types, which are known to be comparable, are looked up.
+	types map[reflect.Type]bool
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// New creates a Sandbox.  The decoder table is copied.
+func New(name string, c Config) (*Sandbox, error) {
+	s := &Sandbox{
+		name:     name,
+		maxBytes: c.MaxBytes,
+		decoders: map[gopacket.Decoder]gopacket.Decoder{},
+		types:    map[reflect.Type]bool{},
+		stats:    Stats{Name: name, Layers: map[gopacket.LayerType]uint64{}},
+	}
+	for k, d := range c.Decoders {
+		// Keys that aren't comparable already panicked when added to
+		// c.Decoders, so only nil is left to check.
+		if k == nil || d == nil {
+			return nil, fmt.Errorf("sandbox: nil decoder in table of %q", name)
+		}
+		s.decoders[k] = d
+		s.types[reflect.TypeOf(k)] = true
+	}
+	return s, nil
+}
+
+// Name returns the name of s.
+func (s *Sandbox) Name() string { return s.name }
+
+// builder decodes a packet's layers with a Sandbox's decoders.
+type builder struct {
+	gopacket.PacketBuilder
+	s    *Sandbox
+	last gopacket.Layer
+}
+
+// metadataBuilder is implemented by the PacketBuilders of gopacket's
+// packets, and used by decoders that set capture info.
+type metadataBuilder interface {
+	Metadata() *gopacket.PacketMetadata
+}
+
+func (b *builder) AddLayer(l gopacket.Layer) {
+	b.last = l
+	b.PacketBuilder.AddLayer(l)
+}
+
+// Metadata returns the metadata of the packet being built.
+func (b *builder) Metadata() *gopacket.PacketMetadata {
+	return b.PacketBuilder.(metadataBuilder).Metadata()
+}
+
+// AddWarning records a warning on the packet being built.
+func (b *builder) AddWarning(err error) {
+	gopacket.AddWarning(b.PacketBuilder, err)
+}
+
+// NextDecoder decodes the payload of the last layer with next, or the
+// Sandbox's override of it, passing on the builder so that later layers
+// are overridden too.
+func (b *builder) NextDecoder(next gopacket.Decoder) error {
+	if next == nil {
+		return errors.New("NextDecoder passed nil decoder, probably an unsupported decode type")
+	}
+	if b.last == nil {
+		return errors.New("NextDecoder called, but no layers added yet")
+	}
+	data := b.last.LayerPayload()
+	if len(data) == 0 {
+		return nil
+	}
+	return b.s.decoder(next).Decode(data, b)
+}
+
+func (s *Sandbox) decoder(d gopacket.Decoder) gopacket.Decoder {
+	if s.types[reflect.TypeOf(d)] {
+		if o, ok := s.decoders[d]; ok {
+			return o
+		}
+	}
+	return d
+}
+
+// NewPacket decodes a copy of data, starting with first, and sets its
+// capture info to ci.  The packet's bytes count against the memory budget
+// until it is released, and if they would exceed it, NewPacket returns
+// ErrBudget.
+func (s *Sandbox) NewPacket(data []byte, first gopacket.Decoder, ci gopacket.CaptureInfo) (gopacket.Packet, error) {
+	n := int64(len(data))
+	s.mu.Lock()
+	if s.maxBytes > 0 && s.stats.InUse+n > s.maxBytes {
+		s.stats.Dropped++
+		s.mu.Unlock()
+		return nil, ErrBudget
+	}
+	s.stats.InUse += n
+	if s.stats.InUse > s.stats.PeakInUse {
+		s.stats.PeakInUse = s.stats.InUse
+	}
+	s.mu.Unlock()
+
+	first = s.decoder(first)
+	dec := gopacket.RecoverDecoder(gopacket.DecodeFunc(func(data []byte, p gopacket.PacketBuilder) error {
+		b := &builder{PacketBuilder: p, s: s}
+		// Decoders may add to the capture info, so it's set first.
+		b.Metadata().CaptureInfo = ci
+		return first.Decode(data, b)
+	}))
+	p := gopacket.NewPacket(data, dec, gopacket.Default)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Packets++
+	s.stats.Bytes += uint64(n)
+	for _, l := range p.Layers() {
+		s.stats.Layers[l.LayerType()]++
+	}
+	if e := p.ErrorLayer(); e != nil {
+		s.stats.Errors++
+		if _, ok := e.Error().(*gopacket.DecodePanic); ok {
+			s.stats.Panics++
+		}
+	}
+	return p, nil
+}
+
+// Release returns the bytes of p, a packet of s, to the memory budget.  It
+// must be called once for each packet NewPacket returns, once the packet
+// is no longer used.
+func (s *Sandbox) Release(p gopacket.Packet) {
+	s.mu.Lock()
+	s.stats.InUse -= int64(len(p.Data()))
+	s.mu.Unlock()
+}
+
+// Stats returns the statistics of s.
+func (s *Sandbox) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.Layers = make(map[gopacket.LayerType]uint64, len(s.stats.Layers))
+	for t, n := range s.stats.Layers {
+		st.Layers[t] = n
+	}
+	return st
+}
+
+// Registry holds the Sandboxes of a process by name.  It is safe for
+// concurrent use.
+type Registry struct {
+	mu        sync.Mutex
+	sandboxes map[string]*Sandbox
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{sandboxes: map[string]*Sandbox{}}
+}
+
+// Add creates a Sandbox named name.  Names must be unique.
+func (r *Registry) Add(name string, c Config) (*Sandbox, error) {
+	s, err := New(name, c)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sandboxes[name]; ok {
+		return nil, fmt.Errorf("sandbox: %q already exists", name)
+	}
+	r.sandboxes[name] = s
+	return s, nil
+}
+
+// Get returns the Sandbox named name, or nil.
+func (r *Registry) Get(name string) *Sandbox {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sandboxes[name]
+}
+
+// Remove removes the Sandbox named name.
+func (r *Registry) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sandboxes, name)
+}
+
+// Stats returns the statistics of every Sandbox, sorted by name.
+func (r *Registry) Stats() []Stats {
+	r.mu.Lock()
+	sandboxes := make([]*Sandbox, 0, len(r.sandboxes))
+	for _, s := range r.sandboxes {
+		sandboxes = append(sandboxes, s)
+	}
+	r.mu.Unlock()
+	stats := make([]Stats, len(sandboxes))
+	for i, s := range sandboxes {
+		stats[i] = s.Stats()
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
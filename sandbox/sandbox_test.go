@@ -0,0 +1,136 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package sandbox
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+func frame(t *testing.T, typ layers.EthernetType, payload ...gopacket.SerializableLayer) []byte {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{2, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{2, 0, 0, 0, 0, 2},
+		EthernetType: typ,
+	}
+	buf := gopacket.NewSerializeBuffer()
+	ls := append([]gopacket.SerializableLayer{eth}, payload...)
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ls...); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestIsolation(t *testing.T) {
+	r := NewRegistry()
+	experiment := gopacket.DecodeFunc(func(data []byte, p gopacket.PacketBuilder) error {
+		p.AddLayer(gopacket.Payload(data))
+		return nil
+	})
+	a, err := r.Add("a", Config{Decoders: map[gopacket.Decoder]gopacket.Decoder{
+		layers.EthernetType(0x88b5): experiment,
+		layers.LayerTypeUDP:         gopacket.DecodePayload,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := r.Add("b", Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Add("a", Config{}); err == nil {
+		t.Error("duplicate sandbox added")
+	}
+
+	ci := gopacket.CaptureInfo{Timestamp: time.Unix(1, 0), InterfaceIndex: 3}
+	data := frame(t, 0x88b5, gopacket.Payload{1, 2, 3, 4})
+	p, err := a.NewPacket(data, layers.LayerTypeEthernet, ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ErrorLayer() != nil || p.Layer(gopacket.LayerTypePayload) == nil || p.Metadata().InterfaceIndex != 3 {
+		t.Errorf("a got %v", p)
+	}
+	if p, _ := b.NewPacket(data, layers.LayerTypeEthernet, ci); p.ErrorLayer() == nil {
+		t.Errorf("b decoded the experimental EtherType: %v", p)
+	}
+
+	// The override applies past the first layer, and only in a.
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{192, 0, 2, 1}, DstIP: net.IP{192, 0, 2, 2}}
+	udp := &layers.UDP{SrcPort: 1000, DstPort: 2000}
+	data = frame(t, layers.EthernetTypeIPv4, ip, udp, gopacket.Payload{0})
+	if p, _ := a.NewPacket(data, layers.LayerTypeEthernet, ci); p.Layer(layers.LayerTypeUDP) != nil || p.Layer(gopacket.LayerTypePayload) == nil {
+		t.Errorf("a decoded UDP: %v", p)
+	}
+	if p, _ := b.NewPacket(data, layers.LayerTypeEthernet, ci); p.Layer(layers.LayerTypeUDP) == nil {
+		t.Errorf("b didn't decode UDP: %v", p)
+	}
+
+	stats := r.Stats()
+	if len(stats) != 2 || stats[0].Name != "a" || stats[1].Name != "b" {
+		t.Fatalf("got stats %+v", stats)
+	}
+	if s := stats[0]; s.Packets != 2 || s.Errors != 0 || s.Layers[layers.LayerTypeEthernet] != 2 || s.Layers[layers.LayerTypeUDP] != 0 {
+		t.Errorf("got a stats %+v", s)
+	}
+	if s := stats[1]; s.Packets != 2 || s.Errors != 1 || s.Layers[layers.LayerTypeUDP] != 1 {
+		t.Errorf("got b stats %+v", s)
+	}
+}
+
+func TestPanics(t *testing.T) {
+	s, err := New("panicky", Config{Decoders: map[gopacket.Decoder]gopacket.Decoder{
+		layers.LayerTypeEthernet: gopacket.DecodeFunc(func([]byte, gopacket.PacketBuilder) error {
+			panic("bug")
+		}),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.NewPacket(frame(t, layers.EthernetTypeIPv4), layers.LayerTypeEthernet, gopacket.CaptureInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.ErrorLayer().Error().(*gopacket.DecodePanic); !ok {
+		t.Errorf("got error %v", p.ErrorLayer().Error())
+	}
+	if st := s.Stats(); st.Errors != 1 || st.Panics != 1 {
+		t.Errorf("got stats %+v", st)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	data := frame(t, layers.EthernetTypeIPv4, gopacket.Payload(make([]byte, 46)))
+	s, err := New("small", Config{MaxBytes: int64(2 * len(data))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var held []gopacket.Packet
+	for i := 0; i < 3; i++ {
+		p, err := s.NewPacket(data, layers.LayerTypeEthernet, gopacket.CaptureInfo{})
+		switch {
+		case i < 2 && err != nil:
+			t.Fatal(err)
+		case i == 2 && err != ErrBudget:
+			t.Fatalf("got error %v, want ErrBudget", err)
+		}
+		if p != nil {
+			held = append(held, p)
+		}
+	}
+	s.Release(held[0])
+	if _, err := s.NewPacket(data, layers.LayerTypeEthernet, gopacket.CaptureInfo{}); err != nil {
+		t.Error(err)
+	}
+	if st := s.Stats(); st.Dropped != 1 || st.Packets != 3 || st.InUse != int64(2*len(data)) || st.PeakInUse != st.InUse {
+		t.Errorf("got stats %+v", st)
+	}
+}
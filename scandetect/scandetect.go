@@ -0,0 +1,297 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package scandetect spots port scans and address sweeps in decoded
+// packets.
+//
+// A Detector keeps per-source counters over fixed time windows and reports
+// an Event the first time, within a window, that a source crosses one of
+// these thresholds:
+//
+//   - HorizontalScan: the same destination port probed on many hosts
+//   - VerticalScan: many destination ports probed on one host
+//   - HalfOpen: many TCP SYNs sent, few of them answered with a SYN-ACK
+//   - UnreachableBurst: many ICMP destination unreachable messages sent
+//     back to the source, as happens during UDP scans
+//
+// TCP SYNs and the first UDP datagram of each flow count as probes.  UDP
+// replies, sent back on a flow the other side started, don't, so busy
+// servers aren't mistaken for scanners.
+//
+// Usage:
+//
+//	d := scandetect.NewDetector(scandetect.DefaultConfig)
+//	for p := range source.Packets() {
+//	  for _, e := range d.Add(p) {
+//	    log.Println(e)
+//	  }
+//	}
+package scandetect
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// EventType is the kind of suspicious behavior an Event reports.
+type EventType int
+
+const (
+	HorizontalScan EventType = iota
+	VerticalScan
+	HalfOpen
+	UnreachableBurst
+)
+
+func (t EventType) String() string {
+	switch t {
+	case HorizontalScan:
+		return "HorizontalScan"
+	case VerticalScan:
+		return "VerticalScan"
+	case HalfOpen:
+		return "HalfOpen"
+	case UnreachableBurst:
+		return "UnreachableBurst"
+	}
+	return fmt.Sprintf("UnknownEventType(%d)", int(t))
+}
+
+// Event describes a threshold crossed by a source.
+type Event struct {
+	Type EventType
+	// Source is the address doing the scanning.
+	Source net.IP
+	// Time is the timestamp of the packet that crossed the threshold, and
+	// WindowStart the start of the window it was counted in.
+	Time, WindowStart time.Time
+	// Count is the value that crossed the threshold: hosts for a horizontal
+	// scan, ports for a vertical scan, unanswered SYNs for half-open
+	// connections, and ICMP messages for unreachable bursts.
+	Count int
+	// Port is the scanned port of a horizontal scan.
+	Port uint16
+	// Target is the scanned host of a vertical scan.
+	Target net.IP
+}
+
+func (e Event) String() string {
+	switch e.Type {
+	case HorizontalScan:
+		return fmt.Sprintf("%v: %v probed port %d on %d hosts", e.Type, e.Source, e.Port, e.Count)
+	case VerticalScan:
+		return fmt.Sprintf("%v: %v probed %d ports on %v", e.Type, e.Source, e.Count, e.Target)
+	}
+	return fmt.Sprintf("%v: %v count %d", e.Type, e.Source, e.Count)
+}
+
+// Config holds a Detector's thresholds.  A zero threshold disables its
+// check.
+type Config struct {
+	// Window is the length of the counting windows.
+	Window time.Duration
+	// HorizontalHosts is the number of distinct hosts probed on one port
+	// that counts as a horizontal scan.
+	HorizontalHosts int
+	// VerticalPorts is the number of distinct ports probed on one host that
+	// counts as a vertical scan.
+	VerticalPorts int
+	// MinSYNs is the number of SYNs a source must send before its
+	// SYN-without-ACK ratio is checked against HalfOpenRatio.
+	MinSYNs       int
+	HalfOpenRatio float64
+	// Unreachables is the number of ICMP destination unreachable messages
+	// received by a source that counts as a burst.
+	Unreachables int
+}
+
+// DefaultConfig has thresholds suitable for an enterprise network edge.
+var DefaultConfig = Config{
+	Window:          time.Minute,
+	HorizontalHosts: 20,
+	VerticalPorts:   50,
+	MinSYNs:         20,
+	HalfOpenRatio:   0.8,
+	Unreachables:    20,
+}
+
+type probeKey struct {
+	host string
+	port uint16
+}
+
+type source struct {
+	start    time.Time
+	probes   map[probeKey]bool
+	hosts    map[uint16]int // hosts probed per port
+	ports    map[string]int // ports probed per host
+	syns     int
+	synAcks  int
+	unreach  int
+	reported map[EventType]bool
+}
+
+// udpFlow identifies the UDP flows seen, so replies can be told apart
+// from probes.
+type udpFlow struct {
+	src, dst         string
+	srcPort, dstPort uint16
+}
+
+func (f udpFlow) reverse() udpFlow {
+	return udpFlow{f.dst, f.src, f.dstPort, f.srcPort}
+}
+
+// Detector tracks sources and reports events.  It is not safe for
+// concurrent use.
+type Detector struct {
+	Config
+	sources map[string]*source
+	// udpFlows holds the time each UDP flow was last seen, keyed by the
+	// direction of its first datagram.
+	udpFlows map[udpFlow]time.Time
+}
+
+// NewDetector creates a Detector with the given configuration.
+func NewDetector(c Config) *Detector {
+	return &Detector{Config: c, sources: map[string]*source{}, udpFlows: map[udpFlow]time.Time{}}
+}
+
+func (d *Detector) source(ip net.IP, ts time.Time) *source {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	s := d.sources[string(ip)]
+	if s == nil || (d.Window > 0 && !ts.Before(s.start.Add(d.Window))) {
+		s = &source{
+			start:    ts,
+			probes:   map[probeKey]bool{},
+			hosts:    map[uint16]int{},
+			ports:    map[string]int{},
+			reported: map[EventType]bool{},
+		}
+		d.sources[string(ip)] = s
+	}
+	return s
+}
+
+// Add counts p and returns any events it triggers.
+func (d *Detector) Add(p gopacket.Packet) []Event {
+	var src, dst net.IP
+	switch ip := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		src, dst = ip.SrcIP, ip.DstIP
+	case *layers.IPv6:
+		src, dst = ip.SrcIP, ip.DstIP
+	default:
+		return nil
+	}
+	ts := p.Metadata().Timestamp
+	var events []Event
+	switch t := p.TransportLayer().(type) {
+	case *layers.TCP:
+		switch {
+		case t.SYN && !t.ACK:
+			s := d.source(src, ts)
+			s.syns++
+			events = d.probe(events, s, src, dst, uint16(t.DstPort), ts)
+			events = d.checkHalfOpen(events, s, src, ts)
+		case t.SYN && t.ACK:
+			// The destination is the source that sent the SYN.
+			if s := d.sources[string(d.key(dst))]; s != nil {
+				s.synAcks++
+			}
+		}
+	case *layers.UDP:
+		f := udpFlow{string(d.key(src)), string(d.key(dst)), uint16(t.SrcPort), uint16(t.DstPort)}
+		if _, ok := d.udpFlows[f.reverse()]; ok {
+			// A reply on a flow the destination started.
+			d.udpFlows[f.reverse()] = ts
+			break
+		}
+		d.udpFlows[f] = ts
+		events = d.probe(events, d.source(src, ts), src, dst, uint16(t.DstPort), ts)
+	}
+	if icmp, ok := p.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4); ok && icmp.TypeCode.Type() == layers.ICMPv4TypeDestinationUnreachable {
+		events = d.unreachable(events, dst, ts)
+	}
+	if icmp, ok := p.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6); ok && icmp.TypeCode.Type() == layers.ICMPv6TypeDestinationUnreachable {
+		events = d.unreachable(events, dst, ts)
+	}
+	return events
+}
+
+func (d *Detector) key(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+func (d *Detector) report(events []Event, s *source, e Event) []Event {
+	if s.reported[e.Type] {
+		return events
+	}
+	s.reported[e.Type] = true
+	e.WindowStart = s.start
+	return append(events, e)
+}
+
+func (d *Detector) probe(events []Event, s *source, src, dst net.IP, port uint16, ts time.Time) []Event {
+	k := probeKey{string(d.key(dst)), port}
+	if s.probes[k] {
+		return events
+	}
+	s.probes[k] = true
+	s.hosts[port]++
+	s.ports[k.host]++
+	if d.HorizontalHosts > 0 && s.hosts[port] >= d.HorizontalHosts {
+		events = d.report(events, s, Event{Type: HorizontalScan, Source: src, Time: ts, Count: s.hosts[port], Port: port})
+	}
+	if d.VerticalPorts > 0 && s.ports[k.host] >= d.VerticalPorts {
+		events = d.report(events, s, Event{Type: VerticalScan, Source: src, Time: ts, Count: s.ports[k.host], Target: dst})
+	}
+	return events
+}
+
+func (d *Detector) checkHalfOpen(events []Event, s *source, src net.IP, ts time.Time) []Event {
+	if d.MinSYNs == 0 || s.syns < d.MinSYNs {
+		return events
+	}
+	unanswered := s.syns - s.synAcks
+	if float64(unanswered)/float64(s.syns) >= d.HalfOpenRatio {
+		events = d.report(events, s, Event{Type: HalfOpen, Source: src, Time: ts, Count: unanswered})
+	}
+	return events
+}
+
+func (d *Detector) unreachable(events []Event, scanner net.IP, ts time.Time) []Event {
+	s := d.source(scanner, ts)
+	s.unreach++
+	if d.Unreachables > 0 && s.unreach >= d.Unreachables {
+		events = d.report(events, s, Event{Type: UnreachableBurst, Source: scanner, Time: ts, Count: s.unreach})
+	}
+	return events
+}
+
+// Expire forgets every source whose window started before t, and every
+// UDP flow last seen before t.
+func (d *Detector) Expire(t time.Time) {
+	for k, s := range d.sources {
+		if s.start.Before(t) {
+			delete(d.sources, k)
+		}
+	}
+	for f, last := range d.udpFlows {
+		if last.Before(t) {
+			delete(d.udpFlows, f)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package scandetect
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/statestore"
+)
+
+var start = time.Unix(1000, 0)
+
+func packet(t *testing.T, src, dst string, ts time.Time, ls ...gopacket.SerializableLayer) gopacket.Packet {
+	ip := &layers.IPv4{
+		Version: 4,
+		TTL:     64,
+		SrcIP:   net.ParseIP(src).To4(),
+		DstIP:   net.ParseIP(dst).To4(),
+	}
+	switch l := ls[0].(type) {
+	case *layers.TCP:
+		ip.Protocol = layers.IPProtocolTCP
+		l.SetNetworkLayerForChecksum(ip)
+	case *layers.UDP:
+		ip.Protocol = layers.IPProtocolUDP
+		l.SetNetworkLayerForChecksum(ip)
+	case *layers.ICMPv4:
+		ip.Protocol = layers.IPProtocolICMPv4
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, append([]gopacket.SerializableLayer{ip}, ls...)...); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	p.Metadata().Timestamp = ts
+	return p
+}
+
+func TestHorizontalAndHalfOpen(t *testing.T) {
+	d := NewDetector(Config{Window: time.Minute, HorizontalHosts: 10, VerticalPorts: 10, MinSYNs: 10, HalfOpenRatio: 0.8})
+	var events []Event
+	for i := 0; i < 30; i++ {
+		dst := fmt.Sprintf("10.0.1.%d", i+1)
+		events = append(events, d.Add(packet(t, "10.0.0.66", dst, start.Add(time.Duration(i)*time.Second), &layers.TCP{SrcPort: 40000, DstPort: 22, SYN: true}))...)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %v", len(events), events)
+	}
+	if e := events[0]; e.Type != HorizontalScan || e.Port != 22 || e.Count != 10 || !e.Source.Equal(net.IP{10, 0, 0, 66}) {
+		t.Errorf("bad horizontal scan event %+v", e)
+	}
+	if e := events[1]; e.Type != HalfOpen || e.Count != 10 {
+		t.Errorf("bad half-open event %+v", e)
+	}
+}
+
+func TestVerticalScan(t *testing.T) {
+	d := NewDetector(Config{Window: time.Minute, VerticalPorts: 5})
+	var events []Event
+	for port := uint16(1); port <= 10; port++ {
+		// Repeated probes of the same port don't count twice.
+		for j := 0; j < 2; j++ {
+			events = append(events, d.Add(packet(t, "10.0.0.66", "10.0.1.1", start, &layers.UDP{SrcPort: 40000, DstPort: layers.UDPPort(port)}))...)
+		}
+	}
+	if len(events) != 1 || events[0].Type != VerticalScan || events[0].Count != 5 || !events[0].Target.Equal(net.IP{10, 0, 1, 1}) {
+		t.Errorf("bad vertical scan events %v", events)
+	}
+}
+
+func TestAnsweredSYNs(t *testing.T) {
+	d := NewDetector(Config{Window: time.Minute, MinSYNs: 5, HalfOpenRatio: 0.5})
+	for i := 0; i < 10; i++ {
+		ts := start.Add(time.Duration(i) * time.Second)
+		if ev := d.Add(packet(t, "10.0.0.2", "10.0.1.1", ts, &layers.TCP{SrcPort: layers.TCPPort(40000 + i), DstPort: 443, SYN: true})); len(ev) != 0 {
+			t.Fatalf("unexpected events %v", ev)
+		}
+		d.Add(packet(t, "10.0.1.1", "10.0.0.2", ts, &layers.TCP{SrcPort: 443, DstPort: layers.TCPPort(40000 + i), SYN: true, ACK: true}))
+	}
+}
+
+func TestUDPReplies(t *testing.T) {
+	d := NewDetector(Config{Window: time.Minute, HorizontalHosts: 20, VerticalPorts: 50})
+	for i := 0; i < 60; i++ {
+		ts := start.Add(time.Duration(i) * time.Millisecond)
+		// A DNS client querying from ephemeral ports, and NTP clients
+		// on many hosts using port 123.
+		dns := &layers.UDP{SrcPort: layers.UDPPort(40000 + i), DstPort: 53}
+		ntpClient := fmt.Sprintf("10.0.1.%d", i+1)
+		ntp := &layers.UDP{SrcPort: 123, DstPort: 123}
+		for _, p := range []gopacket.Packet{
+			packet(t, "10.0.0.2", "10.0.0.53", ts, dns),
+			packet(t, "10.0.0.53", "10.0.0.2", ts, &layers.UDP{SrcPort: 53, DstPort: dns.SrcPort}),
+			packet(t, ntpClient, "10.0.0.123", ts, ntp),
+			packet(t, "10.0.0.123", ntpClient, ts, &layers.UDP{SrcPort: 123, DstPort: 123}),
+		} {
+			if ev := d.Add(p); len(ev) != 0 {
+				t.Fatalf("query %d: unexpected events %v", i, ev)
+			}
+		}
+	}
+	d.Expire(start.Add(time.Second))
+	if len(d.udpFlows) != 0 {
+		t.Errorf("%d UDP flows left after expiry", len(d.udpFlows))
+	}
+}
+
+func TestUnreachableBurstAndWindows(t *testing.T) {
+	d := NewDetector(Config{Window: time.Minute, Unreachables: 3})
+	icmp := func() *layers.ICMPv4 {
+		return &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodePort)}
+	}
+	var events []Event
+	for i := 0; i < 5; i++ {
+		events = append(events, d.Add(packet(t, "10.0.1.1", "10.0.0.66", start, icmp()))...)
+	}
+	if len(events) != 1 || events[0].Type != UnreachableBurst || !events[0].Source.Equal(net.IP{10, 0, 0, 66}) {
+		t.Fatalf("bad unreachable events %v", events)
+	}
+	// A new window reports again.
+	later := start.Add(2 * time.Minute)
+	events = nil
+	for i := 0; i < 3; i++ {
+		events = append(events, d.Add(packet(t, "10.0.1.1", "10.0.0.66", later, icmp()))...)
+	}
+	if len(events) != 1 || !events[0].WindowStart.Equal(later) {
+		t.Errorf("bad events in second window %v", events)
+	}
+	d.Expire(later.Add(time.Second))
+	if len(d.sources) != 0 {
+		t.Error("sources not expired")
+	}
+}
+
+func TestSaveRestore(t *testing.T) {
+	cfg := Config{Window: time.Minute, HorizontalHosts: 10, VerticalPorts: 10, MinSYNs: 5, HalfOpenRatio: 0.8}
+	d := NewDetector(cfg)
+	syn := func(i int) gopacket.Packet {
+		return packet(t, "10.0.0.66", fmt.Sprintf("10.0.1.%d", i+1), start.Add(time.Duration(i)*time.Second), &layers.TCP{SrcPort: 40000, DstPort: 22, SYN: true})
+	}
+	var events []Event
+	for i := 0; i < 6; i++ {
+		events = append(events, d.Add(syn(i))...)
+	}
+	if len(events) != 1 || events[0].Type != HalfOpen {
+		t.Fatalf("got events %v before save", events)
+	}
+	d.Add(packet(t, "10.0.0.2", "10.0.0.53", start, &layers.UDP{SrcPort: 40000, DstPort: 53}))
+	s := statestore.NewMemory()
+	if err := d.Save(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// The restored detector carries on counting the scan, without
+	// reporting it as half-open again, and still knows the UDP flow.
+	restored := NewDetector(cfg)
+	if err := restored.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	events = nil
+	for i := 0; i < 10; i++ {
+		events = append(events, restored.Add(syn(i))...)
+	}
+	if len(events) != 1 || events[0].Type != HorizontalScan || events[0].Count != 10 || !events[0].WindowStart.Equal(start) {
+		t.Errorf("got events %v after restore, want a horizontal scan of 10 hosts", events)
+	}
+	if ev := restored.Add(packet(t, "10.0.0.53", "10.0.0.2", start, &layers.UDP{SrcPort: 53, DstPort: 40000})); len(ev) != 0 || restored.sources[string(net.IP{10, 0, 0, 53})] != nil {
+		t.Errorf("UDP reply after restore counted as a probe: %v", ev)
+	}
+}
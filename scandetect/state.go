@@ -0,0 +1,125 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package scandetect
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mistsys/gopacket/statestore"
+)
+
+// The detector's sources are saved under statePrefixSource, with the hex
+// encoding of their address, and its UDP flows under statePrefixUDP.
+const (
+	statePrefix       = "scandetect/"
+	statePrefixSource = statePrefix + "source/"
+	statePrefixUDP    = statePrefix + "udp/"
+)
+
+// probeState is the saved form of a probeKey.
+type probeState struct {
+	Host net.IP `json:"host"`
+	Port uint16 `json:"port"`
+}
+
+// sourceState is the saved form of a source.  The per-port and per-host
+// counts aren't saved, since they follow from the probes.
+type sourceState struct {
+	Start    time.Time    `json:"start"`
+	Probes   []probeState `json:"probes"`
+	SYNs     int          `json:"syns"`
+	SYNAcks  int          `json:"syn_acks"`
+	Unreach  int          `json:"unreach"`
+	Reported []EventType  `json:"reported"`
+}
+
+// udpFlowState is the saved form of a UDP flow.
+type udpFlowState struct {
+	Src     net.IP    `json:"src"`
+	Dst     net.IP    `json:"dst"`
+	SrcPort uint16    `json:"src_port"`
+	DstPort uint16    `json:"dst_port"`
+	Last    time.Time `json:"last"`
+}
+
+// Save writes the detector's sources and UDP flows to s, replacing any
+// saved before.
+func (d *Detector) Save(s statestore.Store) error {
+	if err := statestore.Clear(s, statePrefix); err != nil {
+		return err
+	}
+	for k, src := range d.sources {
+		st := sourceState{Start: src.start, SYNs: src.syns, SYNAcks: src.synAcks, Unreach: src.unreach}
+		for p := range src.probes {
+			st.Probes = append(st.Probes, probeState{net.IP(p.host), p.port})
+		}
+		for t := range src.reported {
+			st.Reported = append(st.Reported, t)
+		}
+		if err := statestore.PutJSON(s, statePrefixSource+hex.EncodeToString([]byte(k)), st); err != nil {
+			return err
+		}
+	}
+	for f, last := range d.udpFlows {
+		st := udpFlowState{net.IP(f.src), net.IP(f.dst), f.srcPort, f.dstPort, last}
+		key := fmt.Sprintf("%s%x:%d-%x:%d", statePrefixUDP, f.src, f.srcPort, f.dst, f.dstPort)
+		if err := statestore.PutJSON(s, key, st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore adds the state saved in s to the detector, replacing any sources
+// with the same address.
+func (d *Detector) Restore(s statestore.Store) error {
+	return s.Scan(statePrefix, func(key string, v []byte) error {
+		switch {
+		case strings.HasPrefix(key, statePrefixSource):
+			k, err := hex.DecodeString(key[len(statePrefixSource):])
+			if err != nil {
+				return err
+			}
+			var st sourceState
+			if err := json.Unmarshal(v, &st); err != nil {
+				return err
+			}
+			src := &source{
+				start:    st.Start,
+				probes:   map[probeKey]bool{},
+				hosts:    map[uint16]int{},
+				ports:    map[string]int{},
+				syns:     st.SYNs,
+				synAcks:  st.SYNAcks,
+				unreach:  st.Unreach,
+				reported: map[EventType]bool{},
+			}
+			for _, p := range st.Probes {
+				pk := probeKey{string(d.key(p.Host)), p.Port}
+				src.probes[pk] = true
+				src.hosts[pk.port]++
+				src.ports[pk.host]++
+			}
+			for _, t := range st.Reported {
+				src.reported[t] = true
+			}
+			d.sources[string(k)] = src
+		case strings.HasPrefix(key, statePrefixUDP):
+			var st udpFlowState
+			if err := json.Unmarshal(v, &st); err != nil {
+				return err
+			}
+			d.udpFlows[udpFlow{string(d.key(st.Src)), string(d.key(st.Dst)), st.SrcPort, st.DstPort}] = st.Last
+		}
+		return nil
+	})
+}
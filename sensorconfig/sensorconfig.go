@@ -0,0 +1,294 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package sensorconfig describes a capture pipeline's configuration, how
+// packets are decoded and filtered and the parameters of the analyzers,
+// in a JSON file, so that many sensors can share one configuration
+// without being rebuilt.
+//
+// Each analyzer has a section, and an analyzer whose section is missing is
+// disabled.  Durations are written as strings such as "10s" or "1m30s":
+//
+//	{
+//	  "decode": {"first_layer": "Ethernet", "lazy": true},
+//	  "filter": "tcp or icmp or icmp6",
+//	  "direction": {"local_nets": ["10.0.0.0/8"], "first_syn": true},
+//	  "pmtud": {"min_size": 1281, "retransmissions": 2, "timeout": "1m"}
+//	}
+//
+// Load reads and checks a configuration, and the section methods convert
+// it to the analyzers' own configurations:
+//
+//	c, err := sensorconfig.LoadFile("/etc/sensor.json")
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	dec, err := c.Decode.Decoder()
+//	...
+//	if c.PMTUD != nil {
+//	  a := pmtud.NewAnalyzer(c.PMTUD.Config())
+//	  ...
+//	}
+//
+// Snapshot and the Set methods go the other way, recording a running
+// pipeline's configuration so it can be written out with Write.  Parts of
+// the configuration that are code, such as appclass classifiers or a
+// steering Model function, aren't recorded.
+package sensorconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/direction"
+	"github.com/mistsys/gopacket/ip4defrag"
+	"github.com/mistsys/gopacket/pmtud"
+	"github.com/mistsys/gopacket/roam"
+	"github.com/mistsys/gopacket/scandetect"
+	"github.com/mistsys/gopacket/steering"
+	"github.com/mistsys/gopacket/tcpmetrics"
+
+	// Registers the layer names Decode.FirstLayer refers to.
+	_ "github.com/mistsys/gopacket/layers"
+)
+
+// Duration is a time.Duration written as a string, such as "1m30s".
+// Numbers are read as nanoseconds.
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("invalid duration %s", b)
+		}
+		*d = Duration(n)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Decode says how packets are decoded.
+type Decode struct {
+	// FirstLayer is the name of the layer packets start with, as
+	// registered in gopacket.DecodersByLayerName, such as "Ethernet" or
+	// "RadioTap".
+	FirstLayer         string `json:"first_layer"`
+	Lazy               bool   `json:"lazy,omitempty"`
+	NoCopy             bool   `json:"no_copy,omitempty"`
+	SkipDecodeRecovery bool   `json:"skip_decode_recovery,omitempty"`
+}
+
+// Decoder returns the decoder of the first layer.
+func (d *Decode) Decoder() (gopacket.Decoder, error) {
+	dec, ok := gopacket.DecodersByLayerName[d.FirstLayer]
+	if !ok || dec == nil {
+		return nil, fmt.Errorf("no decoder registered for layer %q", d.FirstLayer)
+	}
+	return dec, nil
+}
+
+// Options returns the decode options.
+func (d *Decode) Options() gopacket.DecodeOptions {
+	return gopacket.DecodeOptions{Lazy: d.Lazy, NoCopy: d.NoCopy, SkipDecodeRecovery: d.SkipDecodeRecovery}
+}
+
+// Direction configures a direction.Classifier.
+type Direction struct {
+	IgnoreCapture bool `json:"ignore_capture,omitempty"`
+	// LocalMACs and LocalNets are written as strings, such as
+	// "02:00:00:00:00:01" and "10.0.0.0/8".
+	LocalMACs      []string `json:"local_macs,omitempty"`
+	LocalNets      []string `json:"local_nets,omitempty"`
+	FirstSYN       bool     `json:"first_syn,omitempty"`
+	MaxConnections int      `json:"max_connections,omitempty"`
+}
+
+// Config returns the classifier configuration, or an error if an address
+// or prefix is invalid.
+func (d *Direction) Config() (direction.Config, error) {
+	c := direction.Config{IgnoreCapture: d.IgnoreCapture, FirstSYN: d.FirstSYN, MaxConnections: d.MaxConnections}
+	for _, s := range d.LocalMACs {
+		mac, err := net.ParseMAC(s)
+		if err != nil {
+			return c, err
+		}
+		c.LocalMACs = append(c.LocalMACs, mac)
+	}
+	nets, err := direction.ParseLocalNets(d.LocalNets...)
+	if err != nil {
+		return c, err
+	}
+	c.LocalNets = nets
+	return c, nil
+}
+
+// Defrag configures an ip4defrag.IPv4Defragmenter.
+type Defrag struct {
+	Timeout      Duration `json:"timeout,omitempty"`
+	MaxFragments int      `json:"max_fragments,omitempty"`
+	MaxBytes     int      `json:"max_bytes,omitempty"`
+}
+
+// Config returns the defragmenter configuration.
+func (d *Defrag) Config() ip4defrag.Config {
+	return ip4defrag.Config{Timeout: time.Duration(d.Timeout), MaxFragments: d.MaxFragments, MaxBytes: d.MaxBytes}
+}
+
+// AppClass configures an appclass.Engine.  Its classifiers are code, and
+// are chosen by the program.
+type AppClass struct {
+	MaxPackets int `json:"max_packets"`
+}
+
+// PMTUD configures a pmtud.Analyzer.
+type PMTUD struct {
+	MinSize         int      `json:"min_size"`
+	Retransmissions int      `json:"retransmissions"`
+	Timeout         Duration `json:"timeout"`
+}
+
+// Config returns the analyzer configuration.
+func (p *PMTUD) Config() pmtud.Config {
+	return pmtud.Config{MinSize: p.MinSize, Retransmissions: p.Retransmissions, Timeout: time.Duration(p.Timeout)}
+}
+
+// TCPMetrics configures a tcpmetrics.Tracker.
+type TCPMetrics struct {
+	Bucket        Duration `json:"bucket"`
+	ReorderWindow Duration `json:"reorder_window"`
+}
+
+// Config returns the tracker configuration.
+func (t *TCPMetrics) Config() tcpmetrics.Config {
+	return tcpmetrics.Config{Bucket: time.Duration(t.Bucket), ReorderWindow: time.Duration(t.ReorderWindow)}
+}
+
+// Roam configures a roam.Analyzer.
+type Roam struct {
+	Window Duration `json:"window"`
+}
+
+// Config returns the analyzer configuration.
+func (r *Roam) Config() roam.Config {
+	return roam.Config{Window: time.Duration(r.Window)}
+}
+
+// Steering configures a steering.Analyzer.  Its Model function is code,
+// and is left nil, for OUIModel.
+type Steering struct {
+	Window Duration `json:"window"`
+}
+
+// Config returns the analyzer configuration.
+func (s *Steering) Config() steering.Config {
+	return steering.Config{Window: time.Duration(s.Window)}
+}
+
+// ScanDetect configures a scandetect.Detector.
+type ScanDetect struct {
+	Window          Duration `json:"window"`
+	HorizontalHosts int      `json:"horizontal_hosts"`
+	VerticalPorts   int      `json:"vertical_ports"`
+	MinSYNs         int      `json:"min_syns"`
+	HalfOpenRatio   float64  `json:"half_open_ratio"`
+	Unreachables    int      `json:"unreachables"`
+}
+
+// Config returns the detector configuration.
+func (s *ScanDetect) Config() scandetect.Config {
+	return scandetect.Config{
+		Window:          time.Duration(s.Window),
+		HorizontalHosts: s.HorizontalHosts,
+		VerticalPorts:   s.VerticalPorts,
+		MinSYNs:         s.MinSYNs,
+		HalfOpenRatio:   s.HalfOpenRatio,
+		Unreachables:    s.Unreachables,
+	}
+}
+
+// Config is a pipeline's configuration.  Analyzers with nil sections are
+// disabled.
+type Config struct {
+	Decode Decode `json:"decode"`
+	// Filter is a BPF expression for the capture source.
+	Filter     string      `json:"filter,omitempty"`
+	Direction  *Direction  `json:"direction,omitempty"`
+	Defrag     *Defrag     `json:"defrag,omitempty"`
+	AppClass   *AppClass   `json:"appclass,omitempty"`
+	PMTUD      *PMTUD      `json:"pmtud,omitempty"`
+	TCPMetrics *TCPMetrics `json:"tcpmetrics,omitempty"`
+	Roam       *Roam       `json:"roam,omitempty"`
+	Steering   *Steering   `json:"steering,omitempty"`
+	ScanDetect *ScanDetect `json:"scandetect,omitempty"`
+}
+
+// Check returns an error if the first layer has no decoder, or the
+// direction section doesn't parse.
+func (c *Config) Check() error {
+	if _, err := c.Decode.Decoder(); err != nil {
+		return err
+	}
+	if c.Direction != nil {
+		if _, err := c.Direction.Config(); err != nil {
+			return fmt.Errorf("direction: %v", err)
+		}
+	}
+	return nil
+}
+
+// Load reads and checks a configuration.  Unknown fields are errors, so
+// that misspelt settings aren't silently ignored.
+func Load(r io.Reader) (*Config, error) {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	c := &Config{}
+	if err := d.Decode(c); err != nil {
+		return nil, fmt.Errorf("sensorconfig: %v", err)
+	}
+	if err := c.Check(); err != nil {
+		return nil, fmt.Errorf("sensorconfig: %v", err)
+	}
+	return c, nil
+}
+
+// LoadFile reads and checks the configuration in the file at path.
+func LoadFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Write writes c as indented JSON.
+func (c *Config) Write(w io.Writer) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, bytes.NewReader(append(b, '\n')))
+	return err
+}
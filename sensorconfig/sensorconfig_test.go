@@ -0,0 +1,97 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package sensorconfig
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/direction"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/pmtud"
+	"github.com/mistsys/gopacket/scandetect"
+	"github.com/mistsys/gopacket/tcpmetrics"
+)
+
+func TestSnapshotLoad(t *testing.T) {
+	nets, err := direction.ParseLocalNets("10.0.0.0/8", "2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := direction.Config{
+		LocalMACs: []net.HardwareAddr{{2, 0, 0, 0, 0, 1}},
+		LocalNets: nets,
+		FirstSYN:  true,
+	}
+	c := Snapshot(layers.LayerTypeEthernet, gopacket.Lazy, "tcp")
+	c.SetDirection(dir)
+	c.SetPMTUD(pmtud.DefaultConfig)
+	c.SetTCPMetrics(tcpmetrics.DefaultConfig)
+	c.SetScanDetect(scandetect.DefaultConfig)
+	c.SetAppClass(200)
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"timeout": "1m0s"`) {
+		t.Errorf("durations not written as strings:\n%s", buf.String())
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, c) {
+		t.Errorf("loaded %+v, want %+v", loaded, c)
+	}
+	if got, err := loaded.Direction.Config(); err != nil || !reflect.DeepEqual(got, dir) {
+		t.Errorf("got direction config %+v, %v, want %+v", got, err, dir)
+	}
+	if got := loaded.PMTUD.Config(); got != pmtud.DefaultConfig {
+		t.Errorf("got PMTUD config %+v", got)
+	}
+	if got := loaded.ScanDetect.Config(); got != scandetect.DefaultConfig {
+		t.Errorf("got scan detection config %+v", got)
+	}
+	if loaded.Roam != nil || loaded.Steering != nil {
+		t.Errorf("got sections for analyzers not in the snapshot")
+	}
+	dec, err := loaded.Decode.Decoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := gopacket.NewPacket(make([]byte, 60), dec, gopacket.Default); p.Layer(layers.LayerTypeEthernet) == nil {
+		t.Errorf("decoder didn't decode Ethernet: %v", p)
+	}
+	if loaded.Decode.Options() != gopacket.Lazy {
+		t.Errorf("got decode options %+v", loaded.Decode.Options())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	c, err := Load(strings.NewReader(`{"decode": {"first_layer": "RadioTap"}, "roam": {"window": "90s"}, "tcpmetrics": {"bucket": 1000000000}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Roam.Config().Window != 90*time.Second || c.TCPMetrics.Config().Bucket != time.Second {
+		t.Errorf("got %+v, %+v", c.Roam, c.TCPMetrics)
+	}
+	for _, bad := range []string{
+		`{"decode": {"first_layer": "NoSuchLayer"}}`,
+		`{"decode": {"first_layer": "Ethernet"}, "roam": {"window": "soon"}}`,
+		`{"decode": {"first_layer": "Ethernet"}, "roam": {"windw": "1m"}}`,
+		`{"decode": {"first_layer": "Ethernet"}, "direction": {"local_nets": ["10.0.0.0/33"]}}`,
+	} {
+		if _, err := Load(strings.NewReader(bad)); err == nil {
+			t.Errorf("no error loading %s", bad)
+		}
+	}
+}
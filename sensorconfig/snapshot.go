@@ -0,0 +1,89 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package sensorconfig
+
+import (
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/direction"
+	"github.com/mistsys/gopacket/ip4defrag"
+	"github.com/mistsys/gopacket/pmtud"
+	"github.com/mistsys/gopacket/roam"
+	"github.com/mistsys/gopacket/scandetect"
+	"github.com/mistsys/gopacket/steering"
+	"github.com/mistsys/gopacket/tcpmetrics"
+)
+
+// Snapshot starts recording the configuration of a running pipeline, which
+// decodes packets from firstLayer with the given options, and captures
+// those matching filter.  The Set methods then fill in the sections of the
+// analyzers the pipeline runs; the rest stay nil.
+func Snapshot(firstLayer gopacket.LayerType, opts gopacket.DecodeOptions, filter string) *Config {
+	return &Config{
+		Decode: Decode{
+			FirstLayer:         firstLayer.String(),
+			Lazy:               opts.Lazy,
+			NoCopy:             opts.NoCopy,
+			SkipDecodeRecovery: opts.SkipDecodeRecovery,
+		},
+		Filter: filter,
+	}
+}
+
+// SetDirection records the direction classifier's configuration.
+func (c *Config) SetDirection(cfg direction.Config) {
+	d := &Direction{IgnoreCapture: cfg.IgnoreCapture, FirstSYN: cfg.FirstSYN, MaxConnections: cfg.MaxConnections}
+	for _, mac := range cfg.LocalMACs {
+		d.LocalMACs = append(d.LocalMACs, mac.String())
+	}
+	for _, n := range cfg.LocalNets {
+		d.LocalNets = append(d.LocalNets, n.String())
+	}
+	c.Direction = d
+}
+
+// SetDefrag records the defragmenter's configuration.
+func (c *Config) SetDefrag(cfg ip4defrag.Config) {
+	c.Defrag = &Defrag{Timeout: Duration(cfg.Timeout), MaxFragments: cfg.MaxFragments, MaxBytes: cfg.MaxBytes}
+}
+
+// SetAppClass records the appclass engine's packet limit.
+func (c *Config) SetAppClass(maxPackets int) {
+	c.AppClass = &AppClass{MaxPackets: maxPackets}
+}
+
+// SetPMTUD records the PMTUD analyzer's configuration.
+func (c *Config) SetPMTUD(cfg pmtud.Config) {
+	c.PMTUD = &PMTUD{MinSize: cfg.MinSize, Retransmissions: cfg.Retransmissions, Timeout: Duration(cfg.Timeout)}
+}
+
+// SetTCPMetrics records the TCP metrics tracker's configuration.
+func (c *Config) SetTCPMetrics(cfg tcpmetrics.Config) {
+	c.TCPMetrics = &TCPMetrics{Bucket: Duration(cfg.Bucket), ReorderWindow: Duration(cfg.ReorderWindow)}
+}
+
+// SetRoam records the roam analyzer's configuration.
+func (c *Config) SetRoam(cfg roam.Config) {
+	c.Roam = &Roam{Window: Duration(cfg.Window)}
+}
+
+// SetSteering records the steering analyzer's configuration, except its
+// Model function.
+func (c *Config) SetSteering(cfg steering.Config) {
+	c.Steering = &Steering{Window: Duration(cfg.Window)}
+}
+
+// SetScanDetect records the scan detector's configuration.
+func (c *Config) SetScanDetect(cfg scandetect.Config) {
+	c.ScanDetect = &ScanDetect{
+		Window:          Duration(cfg.Window),
+		HorizontalHosts: cfg.HorizontalHosts,
+		VerticalPorts:   cfg.VerticalPorts,
+		MinSYNs:         cfg.MinSYNs,
+		HalfOpenRatio:   cfg.HalfOpenRatio,
+		Unreachables:    cfg.Unreachables,
+	}
+}
@@ -0,0 +1,482 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package slaac follows IPv6 stateless address autoconfiguration (RFC
+// 4862) and temporary address (RFC 8981) lifecycles in captures.
+//
+// A Tracker records, for each client by link layer address, when it
+// solicited and received router advertisements, which addresses it probed
+// with duplicate address detection (DAD), and which it went on to use or
+// lost to a duplicate:
+//
+//	tr := slaac.NewTracker(slaac.DefaultConfig)
+//	for p := range source.Packets() {
+//	  for _, e := range tr.Add(p) {
+//	    fmt.Println(e)
+//	  }
+//	}
+//
+// An address is configured once DADTimeout passes after its probe with no
+// conflict, or as soon as the client uses it.  Which global addresses are
+// temporary can only be guessed: an interface identifier that isn't the
+// client's modified EUI-64 is random, and a new random address in a prefix
+// the client already has one in is taken as a temporary address rotation.
+package slaac
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// EventType is the type of an Event.
+type EventType int
+
+const (
+	// RouterSolicitation is a client soliciting router advertisements.
+	RouterSolicitation EventType = iota
+	// RouterAdvertisement is the first advertisement a client received
+	// after soliciting.
+	RouterAdvertisement
+	// DADProbe is a client starting DAD for a tentative address.
+	DADProbe
+	// DADFailure is a client's tentative address turning out to be in use
+	// by another node, which either advertised it or probed it too.
+	DADFailure
+	// AddressConfigured is a client's address passing DAD, or being used.
+	AddressConfigured
+	// AddressRotated is a client configuring a temporary address in a
+	// prefix it already had one in.
+	AddressRotated
+)
+
+func (t EventType) String() string {
+	switch t {
+	case RouterSolicitation:
+		return "RouterSolicitation"
+	case RouterAdvertisement:
+		return "RouterAdvertisement"
+	case DADProbe:
+		return "DADProbe"
+	case DADFailure:
+		return "DADFailure"
+	case AddressConfigured:
+		return "AddressConfigured"
+	case AddressRotated:
+		return "AddressRotated"
+	}
+	return fmt.Sprintf("UnknownEventType(%d)", int(t))
+}
+
+// AddressKind classifies an address by its interface identifier.
+type AddressKind int
+
+const (
+	// LinkLocal is a link-local address.
+	LinkLocal AddressKind = iota
+	// EUI64 is a global address whose interface identifier is the
+	// client's modified EUI-64, derived from its MAC.
+	EUI64
+	// Random is a global address with any other interface identifier:
+	// a temporary address, or a stable opaque one (RFC 7217).
+	Random
+)
+
+func (k AddressKind) String() string {
+	switch k {
+	case LinkLocal:
+		return "LinkLocal"
+	case EUI64:
+		return "EUI64"
+	case Random:
+		return "Random"
+	}
+	return fmt.Sprintf("UnknownAddressKind(%d)", int(k))
+}
+
+// Event is a step in a client's address acquisition.
+type Event struct {
+	Time   time.Time
+	Type   EventType
+	Client net.HardwareAddr
+	// Address is the address probed, configured, failed or rotated to.
+	Address net.IP
+	// Router is the source of the router advertisement.
+	Router net.IP
+	// Previous is the temporary address replaced by a rotation.
+	Previous net.IP
+	// Latency is the time from solicitation to advertisement, or from
+	// probe to configuration.
+	Latency time.Duration
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("%v %v %v", e.Time.Format(time.RFC3339Nano), e.Client, e.Type)
+	switch e.Type {
+	case RouterAdvertisement:
+		s += fmt.Sprintf(" from %v after %v", e.Router, e.Latency)
+	case DADProbe, DADFailure:
+		s += fmt.Sprintf(" %v", e.Address)
+	case AddressConfigured:
+		s += fmt.Sprintf(" %v", e.Address)
+		if e.Latency > 0 {
+			s += fmt.Sprintf(" after %v", e.Latency)
+		}
+	case AddressRotated:
+		s += fmt.Sprintf(" %v to %v", e.Previous, e.Address)
+	}
+	return s
+}
+
+// Address is an address a client probed or used.
+type Address struct {
+	IP   net.IP
+	Kind AddressKind
+	// Prefix is the advertised autonomous prefix the address is in, if
+	// any.
+	Prefix *net.IPNet
+	// Probed is when DAD started, and is zero if the client was first
+	// seen using the address.  Configured is zero until the address
+	// passes DAD or is used.
+	Probed, Configured time.Time
+	LastSeen           time.Time
+	// Failed is set if DAD found the address in use by another node.
+	Failed bool
+}
+
+// Client is what's known about one client's address acquisition.
+type Client struct {
+	MAC       net.HardwareAddr
+	FirstSeen time.Time
+	Addresses []*Address
+	// Events is the client's timeline.
+	Events      []Event
+	DADFailures int
+	Rotations   int
+	// solicited is when the client last solicited, if it's still waiting
+	// for an advertisement.
+	solicited time.Time
+}
+
+// Address returns the client's address ip, or nil.
+func (c *Client) Address(ip net.IP) *Address {
+	for _, a := range c.Addresses {
+		if a.IP.Equal(ip) {
+			return a
+		}
+	}
+	return nil
+}
+
+// Config configures a Tracker.
+type Config struct {
+	// DADTimeout is how long after a probe an address with no conflict is
+	// taken as configured: RetransTimer times DupAddrDetectTransmits.
+	DADTimeout time.Duration
+}
+
+// DefaultConfig uses the default RetransTimer of 1s and a single DAD
+// transmission.
+var DefaultConfig = Config{DADTimeout: time.Second}
+
+// Tracker follows clients' address acquisitions.  It is not safe for
+// concurrent use.
+type Tracker struct {
+	Config
+	clients map[string]*Client
+	// routers holds the link layer addresses that sent advertisements,
+	// whose traffic isn't from clients.
+	routers map[string]bool
+	// prefixes holds the autonomous prefixes advertised.
+	prefixes map[string]*net.IPNet
+	// probing holds the addresses being probed, and their clients.
+	probing map[*Address]*Client
+}
+
+// NewTracker creates a Tracker with the given configuration.
+func NewTracker(c Config) *Tracker {
+	return &Tracker{
+		Config:   c,
+		clients:  map[string]*Client{},
+		routers:  map[string]bool{},
+		prefixes: map[string]*net.IPNet{},
+		probing:  map[*Address]*Client{},
+	}
+}
+
+// Client returns the client with the given link layer address, or nil.
+func (t *Tracker) Client(mac net.HardwareAddr) *Client {
+	return t.clients[string(mac)]
+}
+
+// Clients returns the clients seen, ordered by link layer address.
+func (t *Tracker) Clients() []*Client {
+	out := make([]*Client, 0, len(t.clients))
+	for _, c := range t.clients {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return bytes.Compare(out[i].MAC, out[j].MAC) < 0 })
+	return out
+}
+
+func (t *Tracker) client(mac net.HardwareAddr, ts time.Time) *Client {
+	c := t.clients[string(mac)]
+	if c == nil {
+		c = &Client{MAC: append(net.HardwareAddr(nil), mac...), FirstSeen: ts}
+		t.clients[string(mac)] = c
+	}
+	return c
+}
+
+// source returns the link layer source of p, bridged onto Ethernet or sent
+// over the air.
+func source(p gopacket.Packet) (net.HardwareAddr, bool) {
+	if eth, ok := p.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok {
+		return eth.SrcMAC, true
+	}
+	if d, ok := p.Layer(layers.LayerTypeDot11).(*layers.Dot11); ok {
+		if d.Flags.FromDS() && !d.Flags.ToDS() {
+			return d.Address3, true
+		}
+		return d.Address2, true
+	}
+	return nil, false
+}
+
+// Add updates the tracker from p, returning the events it causes,
+// including configurations of earlier probes whose timeout has passed.
+func (t *Tracker) Add(p gopacket.Packet) []Event {
+	ip6, ok := p.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	if !ok {
+		return nil
+	}
+	mac, ok := source(p)
+	if !ok {
+		return nil
+	}
+	ts := p.Metadata().Timestamp
+	events := t.expire(ts)
+	switch m := p.Layer(layers.LayerTypeICMPv6RouterAdvertisement).(type) {
+	case *layers.ICMPv6RouterAdvertisement:
+		return append(events, t.advertisement(mac, ip6, m, ts)...)
+	}
+	if t.routers[string(mac)] {
+		return events
+	}
+	if _, ok := p.Layer(layers.LayerTypeICMPv6RouterSolicitation).(*layers.ICMPv6RouterSolicitation); ok {
+		c := t.client(mac, ts)
+		if c.solicited.IsZero() {
+			c.solicited = ts
+		}
+		events = append(events, c.event(Event{Time: ts, Type: RouterSolicitation}))
+	}
+	if ns, ok := p.Layer(layers.LayerTypeICMPv6NeighborSolicitation).(*layers.ICMPv6NeighborSolicitation); ok && ip6.SrcIP.IsUnspecified() {
+		return append(events, t.probe(mac, ns.TargetAddress, ts)...)
+	}
+	if na, ok := p.Layer(layers.LayerTypeICMPv6NeighborAdvertisement).(*layers.ICMPv6NeighborAdvertisement); ok {
+		events = append(events, t.conflict(mac, na.TargetAddress, ts)...)
+	}
+	if !ip6.SrcIP.IsUnspecified() && !ip6.SrcIP.IsMulticast() {
+		events = append(events, t.used(t.client(mac, ts), ip6.SrcIP, ts)...)
+	}
+	return events
+}
+
+// Flush configures the probed addresses whose DAD timeout has passed by
+// now, returning the events.  Call it at the end of a capture.
+func (t *Tracker) Flush(now time.Time) []Event {
+	return t.expire(now)
+}
+
+func (c *Client) event(e Event) Event {
+	e.Client = c.MAC
+	c.Events = append(c.Events, e)
+	return e
+}
+
+func (t *Tracker) advertisement(mac net.HardwareAddr, ip6 *layers.IPv6, ra *layers.ICMPv6RouterAdvertisement, ts time.Time) []Event {
+	t.routers[string(mac)] = true
+	for _, o := range ra.Options {
+		if pi := o.PrefixInfo; pi != nil && pi.Autonomous && pi.PrefixLength <= 128 {
+			n := &net.IPNet{IP: pi.Prefix.Mask(net.CIDRMask(int(pi.PrefixLength), 128)), Mask: net.CIDRMask(int(pi.PrefixLength), 128)}
+			t.prefixes[n.String()] = n
+		}
+	}
+	// Advertisements solicited by a client may be sent to it or to all
+	// nodes; either way they answer every client waiting for one.
+	var events []Event
+	for _, c := range t.Clients() {
+		if c.solicited.IsZero() {
+			continue
+		}
+		if dst := ip6.DstIP; !dst.IsMulticast() && c.Address(dst) == nil {
+			continue
+		}
+		events = append(events, c.event(Event{
+			Time:    ts,
+			Type:    RouterAdvertisement,
+			Router:  append(net.IP(nil), ip6.SrcIP...),
+			Latency: ts.Sub(c.solicited),
+		}))
+		c.solicited = time.Time{}
+	}
+	return events
+}
+
+// eui64 reports whether the interface identifier of ip is the modified
+// EUI-64 of mac.
+func eui64(ip net.IP, mac net.HardwareAddr) bool {
+	if len(mac) != 6 {
+		return false
+	}
+	id := []byte{mac[0] ^ 0x02, mac[1], mac[2], 0xff, 0xfe, mac[3], mac[4], mac[5]}
+	return bytes.Equal(ip.To16()[8:], id)
+}
+
+func (t *Tracker) newAddress(c *Client, ip net.IP) *Address {
+	a := &Address{IP: append(net.IP(nil), ip.To16()...)}
+	switch {
+	case ip.IsLinkLocalUnicast():
+		a.Kind = LinkLocal
+	case eui64(ip, c.MAC):
+		a.Kind = EUI64
+	default:
+		a.Kind = Random
+	}
+	for _, n := range t.prefixes {
+		if n.Contains(ip) {
+			a.Prefix = n
+		}
+	}
+	c.Addresses = append(c.Addresses, a)
+	return a
+}
+
+func (t *Tracker) probe(mac net.HardwareAddr, target net.IP, ts time.Time) []Event {
+	var events []Event
+	// Another node probing the same tentative address fails both.
+	for _, o := range t.Clients() {
+		if string(o.MAC) == string(mac) {
+			continue
+		}
+		if a := o.Address(target); a != nil && a.Configured.IsZero() && !a.Failed {
+			events = append(events, t.fail(o, a, ts))
+			c := t.client(mac, ts)
+			b := c.Address(target)
+			if b == nil {
+				b = t.newAddress(c, target)
+			}
+			b.Probed, b.LastSeen = ts, ts
+			events = append(events, c.event(Event{Time: ts, Type: DADProbe, Address: b.IP}), t.fail(c, b, ts))
+			return events
+		}
+	}
+	c := t.client(mac, ts)
+	a := c.Address(target)
+	if a != nil && !a.Configured.IsZero() {
+		// Probes of configured addresses are repeated DAD after the link
+		// came back, which changes nothing.
+		a.LastSeen = ts
+		return events
+	}
+	if a == nil {
+		a = t.newAddress(c, target)
+	}
+	a.Probed, a.LastSeen, a.Failed = ts, ts, false
+	t.probing[a] = c
+	return append(events, c.event(Event{Time: ts, Type: DADProbe, Address: a.IP}))
+}
+
+func (t *Tracker) fail(c *Client, a *Address, ts time.Time) Event {
+	delete(t.probing, a)
+	a.Failed = true
+	c.DADFailures++
+	return c.event(Event{Time: ts, Type: DADFailure, Address: a.IP})
+}
+
+// conflict handles an advertisement from mac for target, which fails any
+// other client's probe of it.
+func (t *Tracker) conflict(mac net.HardwareAddr, target net.IP, ts time.Time) []Event {
+	var events []Event
+	for _, c := range t.Clients() {
+		if string(c.MAC) == string(mac) {
+			continue
+		}
+		if a := c.Address(target); a != nil && a.Configured.IsZero() && !a.Failed {
+			events = append(events, t.fail(c, a, ts))
+		}
+	}
+	return events
+}
+
+// used handles c sending from ip.
+func (t *Tracker) used(c *Client, ip net.IP, ts time.Time) []Event {
+	a := c.Address(ip)
+	if a == nil {
+		a = t.newAddress(c, ip)
+	}
+	a.LastSeen = ts
+	if !a.Configured.IsZero() || a.Failed {
+		return nil
+	}
+	return t.configure(c, a, ts)
+}
+
+// expire configures the probed addresses whose DAD timeout has passed by
+// now.
+func (t *Tracker) expire(now time.Time) []Event {
+	var done []*Address
+	for a := range t.probing {
+		if now.Sub(a.Probed) >= t.DADTimeout {
+			done = append(done, a)
+		}
+	}
+	sort.Slice(done, func(i, j int) bool {
+		if !done[i].Probed.Equal(done[j].Probed) {
+			return done[i].Probed.Before(done[j].Probed)
+		}
+		return bytes.Compare(t.probing[done[i]].MAC, t.probing[done[j]].MAC) < 0
+	})
+	var events []Event
+	for _, a := range done {
+		events = append(events, t.configure(t.probing[a], a, a.Probed.Add(t.DADTimeout))...)
+	}
+	return events
+}
+
+func (t *Tracker) configure(c *Client, a *Address, ts time.Time) []Event {
+	delete(t.probing, a)
+	a.Configured = ts
+	e := Event{Time: ts, Type: AddressConfigured, Address: a.IP}
+	if !a.Probed.IsZero() {
+		e.Latency = ts.Sub(a.Probed)
+	}
+	events := []Event{c.event(e)}
+	if a.Kind != Random || a.Prefix == nil {
+		return events
+	}
+	// The latest random address configured in the prefix before this one
+	// is the one it replaces.
+	var prev *Address
+	for _, b := range c.Addresses {
+		if b == a || b.Kind != Random || b.Prefix == nil || b.Prefix.String() != a.Prefix.String() || b.Configured.IsZero() {
+			continue
+		}
+		if prev == nil || b.Configured.After(prev.Configured) {
+			prev = b
+		}
+	}
+	if prev != nil {
+		c.Rotations++
+		events = append(events, c.event(Event{Time: ts, Type: AddressRotated, Address: a.IP, Previous: prev.IP}))
+	}
+	return events
+}
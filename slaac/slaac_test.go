@@ -0,0 +1,179 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package slaac
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+var (
+	clientMAC = net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	otherMAC  = net.HardwareAddr{0x02, 0, 0, 0, 0, 2}
+	routerMAC = net.HardwareAddr{0x02, 0, 0, 0, 0, 0xfe}
+	start     = time.Unix(1500000000, 0)
+)
+
+func at(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+func icmp6(t *testing.T, ts time.Time, mac net.HardwareAddr, src, dst string, typ uint8, msg gopacket.SerializableLayer) gopacket.Packet {
+	ip6 := &layers.IPv6{
+		Version:    6,
+		NextHeader: layers.IPProtocolICMPv6,
+		HopLimit:   255,
+		SrcIP:      net.ParseIP(src),
+		DstIP:      net.ParseIP(dst),
+	}
+	icmp := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(typ, 0)}
+	icmp.SetNetworkLayerForChecksum(ip6)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	err := gopacket.SerializeLayers(buf, opts,
+		&layers.Ethernet{SrcMAC: mac, DstMAC: net.HardwareAddr{0x33, 0x33, 0, 0, 0, 1}, EthernetType: layers.EthernetTypeIPv6},
+		ip6, icmp, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	p.Metadata().Timestamp = ts
+	return p
+}
+
+func probe(t *testing.T, ts time.Time, mac net.HardwareAddr, target string) gopacket.Packet {
+	return icmp6(t, ts, mac, "::", "ff02::1:ff00:1", layers.ICMPv6TypeNeighborSolicitation,
+		&layers.ICMPv6NeighborSolicitation{TargetAddress: net.ParseIP(target)})
+}
+
+func echo(t *testing.T, ts time.Time, mac net.HardwareAddr, src string) gopacket.Packet {
+	return icmp6(t, ts, mac, src, "2001:db8:1::1", layers.ICMPv6TypeEchoRequest, &layers.ICMPv6Echo{Identifier: 1})
+}
+
+type event struct {
+	Type     EventType
+	Time     time.Time
+	Address  string
+	Previous string
+}
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(DefaultConfig)
+	var got []event
+	for _, p := range []gopacket.Packet{
+		probe(t, at(0), clientMAC, "fe80::ff:fe00:1"),
+		icmp6(t, at(100), clientMAC, "::", "ff02::2", layers.ICMPv6TypeRouterSolicitation, &layers.ICMPv6RouterSolicitation{}),
+		icmp6(t, at(200), routerMAC, "fe80::1", "ff02::1", layers.ICMPv6TypeRouterAdvertisement, &layers.ICMPv6RouterAdvertisement{
+			HopLimit:       64,
+			RouterLifetime: 1800,
+			Options: layers.ICMPv6Options{{
+				Type: layers.ICMPv6OptPrefixInfo,
+				PrefixInfo: &layers.ICMPv6PrefixInfo{
+					PrefixLength:      64,
+					OnLink:            true,
+					Autonomous:        true,
+					ValidLifetime:     86400,
+					PreferredLifetime: 14400,
+					Prefix:            net.ParseIP("2001:db8::"),
+				},
+			}},
+		}),
+		probe(t, at(300), clientMAC, "2001:db8::ff:fe00:1"),
+		probe(t, at(400), clientMAC, "2001:db8::1234"),
+		icmp6(t, at(500), otherMAC, "2001:db8::1234", "ff02::1", layers.ICMPv6TypeNeighborAdvertisement,
+			&layers.ICMPv6NeighborAdvertisement{Flags: 0x20, TargetAddress: net.ParseIP("2001:db8::1234")}),
+		probe(t, at(600), clientMAC, "2001:db8::5678"),
+		echo(t, at(2000), clientMAC, "2001:db8::5678"),
+		probe(t, at(100000), clientMAC, "2001:db8::9abc"),
+		echo(t, at(100200), clientMAC, "2001:db8::9abc"),
+	} {
+		for _, e := range tr.Add(p) {
+			if string(e.Client) != string(clientMAC) {
+				continue
+			}
+			ev := event{Type: e.Type, Time: e.Time}
+			if e.Address != nil {
+				ev.Address = e.Address.String()
+			}
+			if e.Previous != nil {
+				ev.Previous = e.Previous.String()
+			}
+			got = append(got, ev)
+		}
+	}
+	want := []event{
+		{Type: DADProbe, Time: at(0), Address: "fe80::ff:fe00:1"},
+		{Type: RouterSolicitation, Time: at(100)},
+		{Type: RouterAdvertisement, Time: at(200)},
+		{Type: DADProbe, Time: at(300), Address: "2001:db8::ff:fe00:1"},
+		{Type: DADProbe, Time: at(400), Address: "2001:db8::1234"},
+		{Type: DADFailure, Time: at(500), Address: "2001:db8::1234"},
+		{Type: DADProbe, Time: at(600), Address: "2001:db8::5678"},
+		{Type: AddressConfigured, Time: at(1000), Address: "fe80::ff:fe00:1"},
+		{Type: AddressConfigured, Time: at(1300), Address: "2001:db8::ff:fe00:1"},
+		{Type: AddressConfigured, Time: at(1600), Address: "2001:db8::5678"},
+		{Type: DADProbe, Time: at(100000), Address: "2001:db8::9abc"},
+		{Type: AddressConfigured, Time: at(100200), Address: "2001:db8::9abc"},
+		{Type: AddressRotated, Time: at(100200), Address: "2001:db8::9abc", Previous: "2001:db8::5678"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events:\n got %+v\nwant %+v", got, want)
+	}
+
+	c := tr.Client(clientMAC)
+	if c == nil {
+		t.Fatal("client not tracked")
+	}
+	if c.DADFailures != 1 || c.Rotations != 1 || len(c.Addresses) != 5 {
+		t.Errorf("client = %+v", c)
+	}
+	if ra := c.Events[2]; ra.Latency != 100*time.Millisecond || !ra.Router.Equal(net.ParseIP("fe80::1")) {
+		t.Errorf("advertisement event = %+v", ra)
+	}
+	for _, a := range c.Addresses {
+		want := Random
+		switch a.IP.String() {
+		case "fe80::ff:fe00:1":
+			want = LinkLocal
+		case "2001:db8::ff:fe00:1":
+			want = EUI64
+		}
+		if a.Kind != want {
+			t.Errorf("%v kind %v, want %v", a.IP, a.Kind, want)
+		}
+		if a.Kind != LinkLocal && (a.Prefix == nil || a.Prefix.String() != "2001:db8::/64") {
+			t.Errorf("%v prefix %v", a.IP, a.Prefix)
+		}
+	}
+	if tr.Client(routerMAC) != nil {
+		t.Error("router tracked as a client")
+	}
+}
+
+func TestTrackerSimultaneousProbe(t *testing.T) {
+	tr := NewTracker(DefaultConfig)
+	tr.Add(probe(t, at(0), clientMAC, "2001:db8::1"))
+	events := tr.Add(probe(t, at(10), otherMAC, "2001:db8::1"))
+	var failures int
+	for _, e := range events {
+		if e.Type == DADFailure {
+			failures++
+		}
+	}
+	if failures != 2 {
+		t.Errorf("got %d failures, want 2: %v", failures, events)
+	}
+	if events := tr.Flush(at(5000)); len(events) != 0 {
+		t.Errorf("failed addresses configured: %v", events)
+	}
+}
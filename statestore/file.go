@@ -0,0 +1,70 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package statestore
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// File is a Memory store that is loaded from a file when opened, and
+// written back to it by Sync and Close.  Writes replace the file
+// atomically, so a crash leaves the state of the last Sync.
+type File struct {
+	Memory
+	path string
+}
+
+// OpenFile opens the store kept in the file at path, which needn't exist
+// yet.
+func OpenFile(path string) (*File, error) {
+	s := &File{Memory: Memory{m: map[string][]byte{}}, path: path}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(&s.m); err != nil {
+		return nil, fmt.Errorf("statestore: reading %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// Sync writes the store to its file.
+func (s *File) Sync() error {
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	err = gob.NewEncoder(tmp).Encode(s.m)
+	s.mu.RUnlock()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Close writes the store to its file.  The store may still be used, but
+// won't be written again unless Sync or Close are called.
+func (s *File) Close() error {
+	return s.Sync()
+}
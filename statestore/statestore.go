@@ -0,0 +1,161 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package statestore defines the storage analyzers save their state to, so
+// that long-running sensors can restore it after a restart.
+//
+// A Store is a flat key-value store.  Analyzers that support it have Save
+// and Restore methods, which keep their state under their own key prefix,
+// so one store can hold several analyzers' state:
+//
+//	s, err := statestore.OpenFile("/var/lib/sensor/state")
+//	if err != nil {
+//	  log.Fatal(err)
+//	}
+//	inv := bssinventory.New()
+//	if err := inv.Restore(s); err != nil {
+//	  log.Println("starting afresh:", err)
+//	}
+//	...
+//	inv.Save(s)
+//	s.Close()
+//
+// Memory is the default store, for tests and for sharing state within a
+// process.  File persists a store to disk; other backends, such as
+// embedded databases, only need to implement Store.
+package statestore
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mistsys/gopacket"
+)
+
+// ErrNotFound is returned by Get for missing keys.
+var ErrNotFound = errors.New("statestore: key not found")
+
+// Store is a key-value store.  Implementations must be safe for concurrent
+// use.
+type Store interface {
+	// Get returns the value stored under key, or ErrNotFound.  Callers
+	// must not modify the value.
+	Get(key string) ([]byte, error)
+	// Put stores value under key, replacing any value already there.  The
+	// store keeps value, so callers must not modify it afterwards.
+	Put(key string, value []byte) error
+	// Delete removes key, if it is present.
+	Delete(key string) error
+	// Scan calls fn for each key starting with prefix, in key order, and
+	// stops at the first error fn returns, returning it.  fn must not
+	// modify the store.
+	Scan(prefix string, fn func(key string, value []byte) error) error
+}
+
+// Memory is a Store held in memory.
+type Memory struct {
+	mu sync.RWMutex
+	m  map[string][]byte
+}
+
+// NewMemory creates an empty Memory store.
+func NewMemory() *Memory {
+	return &Memory{m: map[string][]byte{}}
+}
+
+// Get implements Store.
+func (s *Memory) Get(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.m[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+// Put implements Store.
+func (s *Memory) Put(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[key] = value
+	return nil
+}
+
+// Delete implements Store.
+func (s *Memory) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+	return nil
+}
+
+// Scan implements Store.
+func (s *Memory) Scan(prefix string, fn func(key string, value []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []string
+	for k := range s.m {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn(k, s.m[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Clear deletes every key starting with prefix.  Analyzers clear their
+// prefix before saving, so that state they have expired isn't restored.
+func Clear(s Store, prefix string) error {
+	var keys []string
+	if err := s.Scan(prefix, func(k string, _ []byte) error {
+		keys = append(keys, k)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := s.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutJSON stores the JSON encoding of v under key.
+func PutJSON(s Store, key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Put(key, b)
+}
+
+// Flow is the JSON form of a gopacket.Flow, which analyzers use for keys.
+type Flow struct {
+	Type gopacket.EndpointType `json:"type"`
+	Src  []byte                `json:"src"`
+	Dst  []byte                `json:"dst"`
+}
+
+// NewFlow returns the JSON form of f.
+func NewFlow(f gopacket.Flow) Flow {
+	src, dst := f.Endpoints()
+	return Flow{Type: f.EndpointType(), Src: src.Raw(), Dst: dst.Raw()}
+}
+
+// Flow returns the gopacket.Flow f holds.
+func (f Flow) Flow() gopacket.Flow {
+	return gopacket.NewFlow(f.Type, f.Src, f.Dst)
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package statestore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+func keys(t *testing.T, s Store, prefix string) []string {
+	var ks []string
+	if err := s.Scan(prefix, func(k string, _ []byte) error {
+		ks = append(ks, k)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func TestMemory(t *testing.T) {
+	s := NewMemory()
+	for _, k := range []string{"b/2", "a/1", "b/1", "c"} {
+		if err := s.Put(k, []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := keys(t, s, "b/"), []string{"b/1", "b/2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got keys %v, want %v", got, want)
+	}
+	if err := Clear(s, "b/"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys(t, s, ""), []string{"a/1", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got keys %v after clear, want %v", got, want)
+	}
+	if _, err := s.Get("b/1"); err != ErrNotFound {
+		t.Errorf("got error %v, want ErrNotFound", err)
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state")
+	s, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = OpenFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get("a"); err != nil || string(v) != "1" {
+		t.Errorf("got %q, %v, want \"1\"", v, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("got %d files, want 1", len(files))
+	}
+}
+
+func TestFlow(t *testing.T) {
+	f, err := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IP{192, 0, 2, 1}), layers.NewIPEndpoint(net.IP{192, 0, 2, 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewMemory()
+	if err := PutJSON(s, "flow", NewFlow(f)); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := s.Get("flow")
+	var got Flow
+	if err := json.Unmarshal(v, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Flow() != f {
+		t.Errorf("got flow %v, want %v", got.Flow(), f)
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package steering measures how clients respond to 802.11v BSS transition
+// management (BTM) requests.
+//
+// An Analyzer pairs each BTM request an AP sends with the client's BTM
+// response and with the client's next successful (re)association, and
+// reports the Attempt once its outcome is known: the client moved to one
+// of the requested BSSes, moved somewhere else, rejected the request, or
+// accepted or ignored it and stayed.  Attempts are counted per client
+// model, to compare steering acceptance across device types:
+//
+//	a := steering.NewAnalyzer(steering.DefaultConfig)
+//	for p := range source.Packets() {
+//	  a.Add(p)
+//	}
+//	a.Flush()
+//	for model, s := range a.Stats() {
+//	  fmt.Printf("%s: %.0f%% accepted, %.0f%% steered\n", model, 100*s.AcceptanceRate(), 100*s.SteeringRate())
+//	}
+package steering
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/macs"
+)
+
+// Outcome is how a BTM request turned out.
+type Outcome int
+
+const (
+	// Steered means the client (re)associated to the BSS it accepted, or
+	// to one of the request's candidates.
+	Steered Outcome = iota
+	// RoamedElsewhere means the client (re)associated to a BSS that was not
+	// a candidate.
+	RoamedElsewhere
+	// Rejected means the client rejected the request and did not roam.
+	Rejected
+	// AcceptedNoRoam means the client accepted the request but did not
+	// roam within the window.
+	AcceptedNoRoam
+	// NoResponse means the client neither responded nor roamed.
+	NoResponse
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Steered:
+		return "Steered"
+	case RoamedElsewhere:
+		return "RoamedElsewhere"
+	case Rejected:
+		return "Rejected"
+	case AcceptedNoRoam:
+		return "AcceptedNoRoam"
+	case NoResponse:
+		return "NoResponse"
+	}
+	return fmt.Sprintf("UnknownOutcome(%d)", int(o))
+}
+
+// Attempt is one BTM request and what followed it.
+type Attempt struct {
+	Client net.HardwareAddr
+	// BSSID is the BSS that sent the request.
+	BSSID       net.HardwareAddr
+	Model       string
+	Request     *layers.Dot11BSSTransitionRequest
+	RequestTime time.Time
+	// Response and ResponseTime are set if the client responded.
+	Response     *layers.Dot11BSSTransitionResponse
+	ResponseTime time.Time
+	// RoamBSSID and RoamTime are set if the client (re)associated to
+	// another BSS within the window.
+	RoamBSSID net.HardwareAddr
+	RoamTime  time.Time
+}
+
+// Accepted returns true if the client accepted the request.
+func (a *Attempt) Accepted() bool {
+	return a.Response != nil && a.Response.Status == layers.Dot11BTMAccept
+}
+
+// candidate returns true if the client was asked to, or said it would,
+// move to bssid.
+func (a *Attempt) candidate(bssid net.HardwareAddr) bool {
+	if a.Response != nil && bytes.Equal(a.Response.TargetBSSID, bssid) {
+		return true
+	}
+	for _, c := range a.Request.Candidates {
+		if bytes.Equal(c.BSSID, bssid) {
+			return true
+		}
+	}
+	return false
+}
+
+// Outcome classifies the attempt.
+func (a *Attempt) Outcome() Outcome {
+	switch {
+	case a.RoamBSSID != nil && a.candidate(a.RoamBSSID):
+		return Steered
+	case a.RoamBSSID != nil:
+		return RoamedElsewhere
+	case a.Response == nil:
+		return NoResponse
+	case a.Accepted():
+		return AcceptedNoRoam
+	}
+	return Rejected
+}
+
+func (a *Attempt) String() string {
+	return fmt.Sprintf("BTM %v -> %v (%s): %v", a.BSSID, a.Client, a.Model, a.Outcome())
+}
+
+// Stats counts the attempts of one client model.
+type Stats struct {
+	Requests  int
+	Responses int
+	Accepted  int
+	// Statuses counts responses by status, and Outcomes attempts by
+	// outcome.
+	Statuses map[layers.Dot11BTMStatus]int
+	Outcomes map[Outcome]int
+}
+
+// AcceptanceRate returns the fraction of requests the clients accepted.
+func (s *Stats) AcceptanceRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Accepted) / float64(s.Requests)
+}
+
+// SteeringRate returns the fraction of requests after which the clients
+// moved to a requested BSS.
+func (s *Stats) SteeringRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Outcomes[Steered]) / float64(s.Requests)
+}
+
+// Config holds an Analyzer's settings.
+type Config struct {
+	// Window is how long after a request the client's (re)association
+	// counts as its outcome.
+	Window time.Duration
+	// Model returns the model of a client, which stats are grouped by.  If
+	// nil, OUIModel is used.
+	Model func(client net.HardwareAddr) string
+}
+
+// DefaultConfig waits ten seconds for clients to move and groups them by
+// vendor.
+var DefaultConfig = Config{Window: 10 * time.Second}
+
+// OUIModel names a client by the organization owning its OUI.  Locally
+// administered, usually randomized, addresses are "Randomized", and
+// unregistered ones "Unknown".
+func OUIModel(client net.HardwareAddr) string {
+	if len(client) < 3 {
+		return "Unknown"
+	}
+	if client[0]&0x02 != 0 {
+		return "Randomized"
+	}
+	if org, ok := macs.ValidMACPrefixMap[[3]byte{client[0], client[1], client[2]}]; ok {
+		return org
+	}
+	return "Unknown"
+}
+
+// Analyzer pairs BTM requests with their outcomes.  It is not safe for
+// concurrent use.
+type Analyzer struct {
+	Config
+	pending map[string]*Attempt
+	stats   map[string]*Stats
+}
+
+// NewAnalyzer creates an Analyzer with the given configuration.
+func NewAnalyzer(c Config) *Analyzer {
+	if c.Model == nil {
+		c.Model = OUIModel
+	}
+	return &Analyzer{Config: c, pending: map[string]*Attempt{}, stats: map[string]*Stats{}}
+}
+
+// Add processes p and returns the attempts whose outcome it settled,
+// including those whose window expired before p.
+func (a *Analyzer) Add(p gopacket.Packet) []*Attempt {
+	d, ok := p.Layer(layers.LayerTypeDot11).(*layers.Dot11)
+	if !ok {
+		return nil
+	}
+	ts := p.Metadata().Timestamp
+	done := a.expire(ts)
+	switch m := p.Layer(d.NextLayerType()).(type) {
+	case *layers.Dot11MgmtAction:
+		if req, err := m.BSSTransitionRequest(); err == nil {
+			if d.Address1[0]&0x01 != 0 {
+				break
+			}
+			if prev := a.pending[string(d.Address1)]; prev != nil {
+				if prev.Request.DialogToken == req.DialogToken && bytes.Equal(prev.BSSID, d.Address2) {
+					// A retransmission.
+					break
+				}
+				done = append(done, a.complete(prev))
+			}
+			a.pending[string(d.Address1)] = &Attempt{
+				Client:      append(net.HardwareAddr(nil), d.Address1...),
+				BSSID:       append(net.HardwareAddr(nil), d.Address2...),
+				Model:       a.Model(d.Address1),
+				Request:     req,
+				RequestTime: ts,
+			}
+		} else if resp, err := m.BSSTransitionResponse(); err == nil {
+			at := a.pending[string(d.Address2)]
+			if at != nil && at.Response == nil && at.Request.DialogToken == resp.DialogToken {
+				at.Response, at.ResponseTime = resp, ts
+			}
+		}
+	case *layers.Dot11MgmtAssociationResp:
+		if m.Status == layers.Dot11StatusSuccess {
+			done = a.associated(done, d.Address1, d.Address3, ts)
+		}
+	case *layers.Dot11MgmtReassociationResp:
+		if m.Status == layers.Dot11StatusSuccess {
+			done = a.associated(done, d.Address1, d.Address3, ts)
+		}
+	}
+	return done
+}
+
+// associated settles the pending attempt of client if it moved to another
+// BSS.
+func (a *Analyzer) associated(done []*Attempt, client, bssid net.HardwareAddr, ts time.Time) []*Attempt {
+	at := a.pending[string(client)]
+	if at == nil || bytes.Equal(at.BSSID, bssid) {
+		return done
+	}
+	at.RoamBSSID, at.RoamTime = append(net.HardwareAddr(nil), bssid...), ts
+	return append(done, a.complete(at))
+}
+
+func (a *Analyzer) expire(ts time.Time) []*Attempt {
+	var done []*Attempt
+	for _, at := range a.pending {
+		if ts.Sub(at.RequestTime) > a.Window {
+			done = append(done, a.complete(at))
+		}
+	}
+	return done
+}
+
+func (a *Analyzer) complete(at *Attempt) *Attempt {
+	delete(a.pending, string(at.Client))
+	s := a.stats[at.Model]
+	if s == nil {
+		s = &Stats{Statuses: map[layers.Dot11BTMStatus]int{}, Outcomes: map[Outcome]int{}}
+		a.stats[at.Model] = s
+	}
+	s.Requests++
+	if at.Response != nil {
+		s.Responses++
+		s.Statuses[at.Response.Status]++
+		if at.Accepted() {
+			s.Accepted++
+		}
+	}
+	s.Outcomes[at.Outcome()]++
+	return at
+}
+
+// Flush settles all pending attempts, as at the end of a capture.
+func (a *Analyzer) Flush() []*Attempt {
+	var done []*Attempt
+	for _, at := range a.pending {
+		done = append(done, a.complete(at))
+	}
+	return done
+}
+
+// Stats returns the counts of settled attempts, keyed by client model.
+func (a *Analyzer) Stats() map[string]*Stats {
+	return a.stats
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package steering
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+var (
+	ap1    = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	ap2    = net.HardwareAddr{2, 0, 0, 0, 0, 2}
+	ap3    = net.HardwareAddr{2, 0, 0, 0, 0, 3}
+	apple1 = net.HardwareAddr{0, 3, 0x93, 0, 0, 1}
+	apple2 = net.HardwareAddr{0, 3, 0x93, 0, 0, 2}
+	random = net.HardwareAddr{0x12, 0, 0, 0, 0, 9}
+)
+
+// frame returns a management frame with the given frame control byte,
+// addresses, body and timestamp, in seconds.
+func frame(t *testing.T, fc byte, a1, a2, a3 net.HardwareAddr, sec int64, body ...byte) gopacket.Packet {
+	data := []byte{fc, 0, 0, 0}
+	data = append(append(append(data, a1...), a2...), a3...)
+	data = append(data, 0, 0)
+	data = append(data, body...)
+	data = append(data, 0, 0, 0, 0) // FCS
+	p := gopacket.NewPacket(data, layers.LayerTypeDot11, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	p.Metadata().Timestamp = time.Unix(sec, 0)
+	return p
+}
+
+// request returns a BTM request from ap to client listing candidate.
+func request(t *testing.T, ap, client net.HardwareAddr, token uint8, candidate net.HardwareAddr, sec int64) gopacket.Packet {
+	body := []byte{0x0a, 0x07, token, layers.Dot11BTMPreferredCandidateList, 0, 0, 0xff, 0x34, 0x0d}
+	body = append(body, candidate...)
+	body = append(body, 0, 0, 0, 0, 115, 36, 9)
+	return frame(t, 0xd0, client, ap, ap, sec, body...)
+}
+
+// response returns a BTM response from client to ap, accepting a move to
+// target if it is set.
+func response(t *testing.T, ap, client net.HardwareAddr, token uint8, status layers.Dot11BTMStatus, target net.HardwareAddr, sec int64) gopacket.Packet {
+	body := append([]byte{0x0a, 0x08, token, byte(status), 0}, target...)
+	return frame(t, 0xd0, ap, client, ap, sec, body...)
+}
+
+// reassociated returns a successful reassociation response from ap.
+func reassociated(t *testing.T, ap, client net.HardwareAddr, sec int64) gopacket.Packet {
+	return frame(t, 0x30, client, ap, ap, sec, 0x11, 0x00, 0x00, 0x00, 0x01, 0xc0)
+}
+
+func TestAnalyzer(t *testing.T) {
+	a := NewAnalyzer(DefaultConfig)
+	var done []*Attempt
+	add := func(p gopacket.Packet) {
+		done = append(done, a.Add(p)...)
+	}
+
+	// apple1 accepts and moves to ap2; the request is retransmitted once.
+	add(request(t, ap1, apple1, 1, ap2, 100))
+	add(request(t, ap1, apple1, 1, ap2, 100))
+	add(response(t, ap1, apple1, 1, layers.Dot11BTMAccept, ap2, 100))
+	add(reassociated(t, ap2, apple1, 101))
+	// apple2 ignores the request, then moves to ap3 much later.
+	add(request(t, ap1, apple2, 2, ap2, 102))
+	// random rejects, and reassociates to the same AP.
+	add(request(t, ap1, random, 3, ap2, 103))
+	add(response(t, ap1, random, 3, layers.Dot11BTMRejectNoSuitableCandidates, nil, 104))
+	add(reassociated(t, ap1, random, 105))
+	if len(done) != 1 || done[0].Outcome() != Steered || !done[0].Accepted() {
+		t.Fatalf("got %v", done)
+	}
+	add(reassociated(t, ap3, apple2, 200))
+	done = append(done, a.Flush()...)
+	if len(done) != 3 {
+		t.Fatalf("got %v", done)
+	}
+
+	outcomes := map[string]Outcome{}
+	for _, at := range done {
+		outcomes[at.Client.String()] = at.Outcome()
+	}
+	if outcomes[apple2.String()] != NoResponse || outcomes[random.String()] != Rejected {
+		t.Errorf("got outcomes %v", outcomes)
+	}
+
+	stats := a.Stats()
+	apple, rand := stats["Apple"], stats["Randomized"]
+	if apple == nil || rand == nil {
+		t.Fatalf("got stats %v", stats)
+	}
+	if apple.Requests != 2 || apple.Accepted != 1 || apple.AcceptanceRate() != 0.5 || apple.SteeringRate() != 0.5 {
+		t.Errorf("got Apple stats %+v", apple)
+	}
+	if rand.Requests != 1 || rand.Responses != 1 || rand.Statuses[layers.Dot11BTMRejectNoSuitableCandidates] != 1 || rand.Outcomes[Rejected] != 1 {
+		t.Errorf("got Randomized stats %+v", rand)
+	}
+}
+
+func TestAnalyzerRoamedElsewhere(t *testing.T) {
+	a := NewAnalyzer(Config{Window: time.Minute, Model: func(net.HardwareAddr) string { return "phone" }})
+	a.Add(request(t, ap1, apple1, 1, ap2, 100))
+	a.Add(response(t, ap1, apple1, 1, layers.Dot11BTMAccept, ap2, 100))
+	done := a.Add(reassociated(t, ap3, apple1, 110))
+	if len(done) != 1 || done[0].Outcome() != RoamedElsewhere || done[0].Model != "phone" {
+		t.Fatalf("got %v", done)
+	}
+	if len(a.Flush()) != 0 {
+		t.Error("attempt still pending")
+	}
+}
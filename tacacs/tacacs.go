@@ -0,0 +1,87 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package tacacs removes the obfuscation of TACACS+ packet bodies decoded
+// by layers.TACACSPlus, with the key the device shares with the server,
+// and decodes them.
+//
+// The body is XORed with a pad of MD5 hashes of the session ID, key,
+// version and sequence number (RFC 8907 section 4.5), so MD5 must be
+// available from the packetcrypto.Provider; providers restricted to FIPS
+// approved algorithms refuse it.
+//
+//	for p := range source.Packets() {
+//	  t, ok := p.Layer(layers.LayerTypeTACACSPlus).(*layers.TACACSPlus)
+//	  if !ok {
+//	    continue
+//	  }
+//	  if err := tacacs.Decrypt(packetcrypto.Default, key, t); err == nil {
+//	    fmt.Println(t.AuthenStart, t.AuthorRequest, t.AcctRequest)
+//	  }
+//	}
+package tacacs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/packetcrypto"
+)
+
+// ErrKey is returned by Decrypt when the body doesn't decode with the key,
+// which is most likely the wrong one.
+var ErrKey = errors.New("tacacs: body invalid, key may be wrong")
+
+// Obfuscate XORs body with the pad for the given key and header fields.
+// Since obfuscating twice restores the body, it also removes the
+// obfuscation.
+func Obfuscate(p packetcrypto.Provider, key []byte, sessionID uint32, version, seqNo uint8, body []byte) ([]byte, error) {
+	h, err := p.NewHash(packetcrypto.MD5)
+	if err != nil {
+		return nil, fmt.Errorf("tacacs: %w", err)
+	}
+	var prefix [6]byte
+	binary.BigEndian.PutUint32(prefix[:4], sessionID)
+	prefix[4], prefix[5] = version, seqNo
+	out := make([]byte, len(body))
+	var pad []byte
+	for i := range body {
+		if i%h.Size() == 0 {
+			// Each hash covers the session ID, key, version and sequence
+			// number, and the hash before it.
+			h.Reset()
+			h.Write(prefix[:4])
+			h.Write(key)
+			h.Write(prefix[4:])
+			h.Write(pad)
+			pad = h.Sum(pad[:0])
+		}
+		out[i] = body[i] ^ pad[i%h.Size()]
+	}
+	return out, nil
+}
+
+// Decrypt removes the obfuscation of t's body with key, and decodes it
+// into t.  Bodies sent unobfuscated are decoded as they are.
+func Decrypt(p packetcrypto.Provider, key []byte, t *layers.TACACSPlus) error {
+	body := t.Body
+	if t.Flags&layers.TACACSPlusFlagUnencrypted == 0 {
+		var err error
+		version := t.MajorVersion<<4 | t.MinorVersion
+		if body, err = Obfuscate(p, key, t.SessionID, version, t.SeqNo, t.Body); err != nil {
+			return err
+		}
+	}
+	if err := t.DecodeBody(body); err != nil {
+		if t.Flags&layers.TACACSPlusFlagUnencrypted == 0 {
+			return fmt.Errorf("%w: %v", ErrKey, err)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package tacacs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/packetcrypto"
+)
+
+var key = []byte("tacacs-key")
+
+// startPacket returns an authentication START for user alice, longer than
+// one MD5 hash so the pad chains hashes, obfuscated with k.
+func startPacket(t *testing.T, k []byte) []byte {
+	body := append([]byte{1, 1, 2, 1, 5, 4, 8, 40}, "alicetty110.0.0.9"...)
+	body = append(body, bytes.Repeat([]byte{'x'}, 40)...)
+	obf, err := Obfuscate(packetcrypto.Standard, k, 0x01020304, 0xc0, 1, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(obf, body) {
+		t.Fatal("body not obfuscated")
+	}
+	h := []byte{0xc0, 1, 1, 0, 1, 2, 3, 4, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(h[8:], uint32(len(obf)))
+	return append(h, obf...)
+}
+
+func decode(t *testing.T, data []byte) *layers.TACACSPlus {
+	tp := &layers.TACACSPlus{}
+	if err := tp.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil {
+		t.Fatal(err)
+	}
+	return tp
+}
+
+func TestDecrypt(t *testing.T) {
+	tp := decode(t, startPacket(t, key))
+	if tp.AuthenStart != nil {
+		t.Fatal("decoded obfuscated body")
+	}
+	if err := Decrypt(packetcrypto.Standard, key, tp); err != nil {
+		t.Fatal(err)
+	}
+	s := tp.AuthenStart
+	if s == nil || s.User != "alice" || s.Port != "tty1" || s.RemAddr != "10.0.0.9" || len(s.Data) != 40 {
+		t.Errorf("got START %+v", s)
+	}
+
+	if err := Decrypt(packetcrypto.Standard, []byte("wrong"), decode(t, startPacket(t, key))); !errors.Is(err, ErrKey) {
+		t.Errorf("got error %v with wrong key, want ErrKey", err)
+	}
+	if err := Decrypt(packetcrypto.FIPSOnly(packetcrypto.Standard), key, decode(t, startPacket(t, key))); !errors.Is(err, packetcrypto.ErrNotApproved) {
+		t.Errorf("got error %v from FIPS provider, want ErrNotApproved", err)
+	}
+}
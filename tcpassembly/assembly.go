@@ -22,11 +22,13 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/mistsys/gopacket"
 	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/logging"
 )
 
 var memLog = flag.Bool("assembly_memuse_log", false, "If true, the github.com/mistsys/gopacket/tcpassembly library will log information regarding its memory use every once in a while.")
@@ -392,6 +394,21 @@ type AssemblerOptions struct {
 	// particular connection, the smallest sequence number will be flushed, along
 	// with any contiguous data.  If <= 0, this is ignored.
 	MaxBufferedPagesPerConnection int
+	// Logger, if set, gets a Warn record when a buffer limit forces a
+	// connection to skip missing data, and a Debug record for each step of
+	// reassembly, in place of the assembly_debug_log flag's output.
+	Logger *slog.Logger
+}
+
+// slogDebug says whether to trace reassembly to the Logger.
+func (a *Assembler) slogDebug() bool {
+	return logging.Enabled(a.Logger, slog.LevelDebug)
+}
+
+// logDebug says whether to trace reassembly to the standard logger, as the
+// assembly_debug_log flag asks when there's no Logger.
+func (a *Assembler) logDebug() bool {
+	return a.Logger == nil && *debugLog
 }
 
 // Assembler handles reassembling TCP streams.  It is not safe for
@@ -520,7 +537,9 @@ func (a *Assembler) Assemble(netFlow gopacket.Flow, t *layers.TCP) {
 func (a *Assembler) AssembleWithTimestamp(netFlow gopacket.Flow, t *layers.TCP, timestamp time.Time) {
 	// Ignore empty TCP packets
 	if !t.SYN && !t.FIN && !t.RST && len(t.LayerPayload()) == 0 {
-		if *debugLog {
+		if a.slogDebug() {
+			a.Logger.Debug("ignoring useless packet")
+		} else if a.logDebug() {
 			log.Println("ignoring useless packet")
 		}
 		return
@@ -537,7 +556,9 @@ func (a *Assembler) AssembleWithTimestamp(netFlow gopacket.Flow, t *layers.TCP,
 		conn = a.connPool.getConnection(
 			key, !t.SYN && len(t.LayerPayload()) == 0, timestamp)
 		if conn == nil {
-			if *debugLog {
+			if a.slogDebug() {
+				a.Logger.Debug("got empty packet on otherwise empty connection", "conn", key)
+			} else if a.logDebug() {
 				log.Printf("%v got empty packet on otherwise empty connection", key)
 			}
 			return
@@ -554,7 +575,9 @@ func (a *Assembler) AssembleWithTimestamp(netFlow gopacket.Flow, t *layers.TCP,
 	seq, bytes := Sequence(t.Seq), t.Payload
 	if conn.nextSeq == invalidSequence {
 		if t.SYN {
-			if *debugLog {
+			if a.slogDebug() {
+				a.Logger.Debug("saw first SYN packet, returning immediately", "conn", key, "seq", seq)
+			} else if a.logDebug() {
 				log.Printf("%v saw first SYN packet, returning immediately, seq=%v", key, seq)
 			}
 			a.ret = append(a.ret, Reassembly{
@@ -565,19 +588,25 @@ func (a *Assembler) AssembleWithTimestamp(netFlow gopacket.Flow, t *layers.TCP,
 			})
 			conn.nextSeq = seq.Add(len(bytes) + 1)
 		} else {
-			if *debugLog {
+			if a.slogDebug() {
+				a.Logger.Debug("waiting for start, storing into connection", "conn", key)
+			} else if a.logDebug() {
 				log.Printf("%v waiting for start, storing into connection", key)
 			}
 			a.insertIntoConn(t, conn, timestamp)
 		}
 	} else if diff := conn.nextSeq.Difference(seq); diff > 0 {
-		if *debugLog {
+		if a.slogDebug() {
+			a.Logger.Debug("gap in sequence numbers, storing into connection", "conn", key, "next", conn.nextSeq, "seq", seq, "diff", diff)
+		} else if a.logDebug() {
 			log.Printf("%v gap in sequence numbers (%v, %v) diff %v, storing into connection", key, conn.nextSeq, seq, diff)
 		}
 		a.insertIntoConn(t, conn, timestamp)
 	} else {
 		bytes, conn.nextSeq = byteSpan(conn.nextSeq, seq, bytes)
-		if *debugLog {
+		if a.slogDebug() {
+			a.Logger.Debug("found contiguous data, returning immediately", "conn", key, "seq", seq, "next", conn.nextSeq)
+		} else if a.logDebug() {
 			log.Printf("%v found contiguous data (%v, %v), returning immediately", key, seq, conn.nextSeq)
 		}
 		a.ret = append(a.ret, Reassembly{
@@ -630,7 +659,9 @@ func (a *Assembler) addContiguous(conn *connection) {
 // first set of bytes we have.  If we have no bytes pending, it closes the
 // connection.
 func (a *Assembler) skipFlush(conn *connection) {
-	if *debugLog {
+	if a.slogDebug() {
+		a.Logger.Debug("skipFlush", "conn", conn.key, "next", conn.nextSeq)
+	} else if a.logDebug() {
 		log.Printf("%v skipFlush %v", conn.key, conn.nextSeq)
 	}
 	if conn.first == nil {
@@ -651,7 +682,9 @@ func (p *StreamPool) remove(conn *connection) {
 }
 
 func (a *Assembler) closeConnection(conn *connection) {
-	if *debugLog {
+	if a.slogDebug() {
+		a.Logger.Debug("closing", "conn", conn.key)
+	} else if a.logDebug() {
 		log.Printf("%v closing", conn.key)
 	}
 	conn.stream.ReassemblyComplete()
@@ -706,7 +739,9 @@ func (a *Assembler) insertIntoConn(t *layers.TCP, conn *connection, ts time.Time
 	conn.pages += numPages
 	if (a.MaxBufferedPagesPerConnection > 0 && conn.pages >= a.MaxBufferedPagesPerConnection) ||
 		(a.MaxBufferedPagesTotal > 0 && a.pc.used >= a.MaxBufferedPagesTotal) {
-		if *debugLog {
+		if a.Logger != nil {
+			a.Logger.Warn("hit max buffer size, flushing", "conn", conn.key, "pages", conn.pages, "total_pages", a.pc.used)
+		} else if *debugLog {
 			log.Printf("%v hit max buffer size: %+v, %v, %v", conn.key, a.AssemblerOptions, conn.pages, a.pc.used)
 		}
 		a.addNextFromConn(conn)
@@ -751,7 +786,9 @@ func (a *Assembler) addNextFromConn(conn *connection) {
 		conn.first.Skip = int(diff)
 	}
 	conn.first.Bytes, conn.nextSeq = byteSpan(conn.nextSeq, conn.first.seq, conn.first.Bytes)
-	if *debugLog {
+	if a.slogDebug() {
+		a.Logger.Debug("adding from conn", "conn", conn.key, "seq", conn.first.seq, "next", conn.nextSeq)
+	} else if a.logDebug() {
 		log.Printf("%v   adding from conn (%v, %v)", conn.key, conn.first.seq, conn.nextSeq)
 	}
 	a.ret = append(a.ret, conn.first.Reassembly)
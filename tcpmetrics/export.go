@@ -0,0 +1,23 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package tcpmetrics
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// WriteJSON writes each cell as a JSON object on its own line.
+func WriteJSON(w io.Writer, cells []Cell) error {
+	enc := json.NewEncoder(w)
+	for i := range cells {
+		if err := enc.Encode(&cells[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package tcpmetrics counts TCP retransmissions, out-of-order segments and
+// duplicate ACKs in time buckets, per flow and per client, and exports
+// them as heatmaps.
+//
+// A Tracker follows both directions of each connection.  A data segment
+// starting before the next expected sequence number is out of order if it
+// fills a gap opened within the last ReorderWindow, and a retransmission
+// otherwise.  A pure ACK repeating the last ACK number and window is a
+// duplicate ACK.  Each heatmap cell holds one bucket's counts and rates:
+//
+//	tr := tcpmetrics.NewTracker(tcpmetrics.DefaultConfig)
+//	for p := range source.Packets() {
+//	  tr.Add(p)
+//	}
+//	tcpmetrics.WriteJSON(os.Stdout, tr.ClientHeatmap())
+package tcpmetrics
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// Counts are the counters of one bucket.
+type Counts struct {
+	// Segments counts data segments, and Retransmissions and OutOfOrder
+	// those of them that were retransmitted or arrived out of order.
+	Segments        int `json:"segments"`
+	Retransmissions int `json:"retransmissions"`
+	OutOfOrder      int `json:"out_of_order"`
+	// ACKs counts pure ACKs, and DupACKs those of them that were
+	// duplicates.
+	ACKs    int `json:"acks"`
+	DupACKs int `json:"dup_acks"`
+}
+
+func (c *Counts) add(o Counts) {
+	c.Segments += o.Segments
+	c.Retransmissions += o.Retransmissions
+	c.OutOfOrder += o.OutOfOrder
+	c.ACKs += o.ACKs
+	c.DupACKs += o.DupACKs
+}
+
+func rate(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// RetransmissionRate returns the fraction of data segments retransmitted.
+func (c Counts) RetransmissionRate() float64 { return rate(c.Retransmissions, c.Segments) }
+
+// OutOfOrderRate returns the fraction of data segments out of order.
+func (c Counts) OutOfOrderRate() float64 { return rate(c.OutOfOrder, c.Segments) }
+
+// DupACKRate returns the fraction of pure ACKs that were duplicates.
+func (c Counts) DupACKRate() float64 { return rate(c.DupACKs, c.ACKs) }
+
+// Cell is one bucket of a heatmap.  Flow cells have every field set, and
+// client cells leave the server and ports zero.
+type Cell struct {
+	Time       time.Time `json:"time"`
+	Client     net.IP    `json:"client"`
+	ClientPort uint16    `json:"client_port,omitempty"`
+	Server     net.IP    `json:"server,omitempty"`
+	ServerPort uint16    `json:"server_port,omitempty"`
+	Counts
+	RetransmissionRate float64 `json:"retransmission_rate"`
+	OutOfOrderRate     float64 `json:"out_of_order_rate"`
+	DupACKRate         float64 `json:"dup_ack_rate"`
+}
+
+// Config configures a Tracker.
+type Config struct {
+	// Bucket is the length of the time buckets.
+	Bucket time.Duration
+	// ReorderWindow is how soon after a gap in the sequence numbers a
+	// segment filling it counts as out of order rather than retransmitted.
+	ReorderWindow time.Duration
+}
+
+// DefaultConfig uses 10 second buckets, and a 3ms reorder window.
+var DefaultConfig = Config{
+	Bucket:        10 * time.Second,
+	ReorderWindow: 3 * time.Millisecond,
+}
+
+// half is one direction of a flow.
+type half struct {
+	seen     bool
+	next     uint32
+	gapStart uint32
+	gapEnd   uint32
+	gapTime  time.Time
+	acked    bool
+	ack      uint32
+	window   uint16
+}
+
+type flowKey struct {
+	network, transport gopacket.Flow
+}
+
+type flow struct {
+	client, server         net.IP
+	clientPort, serverPort uint16
+	fromClient, fromServer half
+	last                   time.Time
+	buckets                map[int64]*Counts
+}
+
+// Tracker follows TCP flows and counts their retransmissions, out-of-order
+// segments and duplicate ACKs.  It is not safe for concurrent use.
+type Tracker struct {
+	Config
+	flows map[flowKey]*flow
+}
+
+// NewTracker creates a Tracker with the given configuration.
+func NewTracker(c Config) *Tracker {
+	return &Tracker{Config: c, flows: map[flowKey]*flow{}}
+}
+
+// Add counts p, if it is a TCP segment.
+func (tr *Tracker) Add(p gopacket.Packet) {
+	var src net.IP
+	switch ip := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		src = ip.SrcIP
+	case *layers.IPv6:
+		src = ip.SrcIP
+	default:
+		return
+	}
+	tcp, ok := p.TransportLayer().(*layers.TCP)
+	if !ok {
+		return
+	}
+	ts := p.Metadata().Timestamp
+	f := tr.flow(p, tcp)
+	f.last = ts
+	h := &f.fromServer
+	if uint16(tcp.SrcPort) == f.clientPort && src.Equal(f.client) {
+		h = &f.fromClient
+	}
+	bucket := ts.Truncate(tr.Bucket).UnixNano()
+	c := f.buckets[bucket]
+	if c == nil {
+		c = &Counts{}
+		f.buckets[bucket] = c
+	}
+	tr.segment(h, tcp, ts, c)
+}
+
+// flow returns the flow of p.  Its client is the sender of the SYN, if one
+// is seen, and otherwise the sender of the first packet seen, unless the
+// capture direction says it was inbound.
+func (tr *Tracker) flow(p gopacket.Packet, tcp *layers.TCP) *flow {
+	nf, tf := p.NetworkLayer().NetworkFlow(), tcp.TransportFlow()
+	k := flowKey{nf, tf}
+	if nf.Dst().LessThan(nf.Src()) || (nf.Dst() == nf.Src() && tf.Dst().LessThan(tf.Src())) {
+		k = flowKey{nf.Reverse(), tf.Reverse()}
+	}
+	f := tr.flows[k]
+	if f != nil && !(tcp.SYN && !tcp.ACK) {
+		return f
+	}
+	src, dst := net.IP(nf.Src().Raw()), net.IP(nf.Dst().Raw())
+	sport, dport := uint16(tcp.SrcPort), uint16(tcp.DstPort)
+	if tcp.SYN && tcp.ACK || (!tcp.SYN && p.Metadata().Direction == gopacket.DirectionInbound) {
+		src, dst, sport, dport = dst, src, dport, sport
+	}
+	if f == nil {
+		f = &flow{buckets: map[int64]*Counts{}}
+		tr.flows[k] = f
+	}
+	f.client, f.server = append(net.IP(nil), src...), append(net.IP(nil), dst...)
+	f.clientPort, f.serverPort = sport, dport
+	return f
+}
+
+// segment counts tcp, sent in the direction of h.
+func (tr *Tracker) segment(h *half, tcp *layers.TCP, ts time.Time, c *Counts) {
+	length := uint32(len(tcp.Payload))
+	if tcp.SYN || tcp.FIN {
+		length++
+	}
+	if length == 0 {
+		if tcp.ACK && !tcp.RST {
+			c.ACKs++
+			if h.acked && tcp.Ack == h.ack && tcp.Window == h.window {
+				c.DupACKs++
+			}
+		}
+	} else {
+		c.Segments++
+		end := tcp.Seq + length
+		switch d := int32(tcp.Seq - h.next); {
+		case tcp.SYN && h.seen && end == h.next:
+			c.Retransmissions++
+		case !h.seen || d == 0 || tcp.SYN:
+			// A SYN starts a new sequence space.
+			h.next = end
+		case d > 0:
+			// A gap, which a later segment may fill.
+			h.gapStart, h.gapEnd, h.gapTime = h.next, tcp.Seq, ts
+			h.next = end
+		default:
+			if int32(tcp.Seq-h.gapStart) >= 0 && int32(tcp.Seq-h.gapEnd) < 0 && ts.Sub(h.gapTime) <= tr.ReorderWindow {
+				c.OutOfOrder++
+			} else {
+				c.Retransmissions++
+			}
+			if int32(end-h.next) > 0 {
+				h.next = end
+			}
+		}
+		h.seen = true
+	}
+	if tcp.ACK {
+		h.acked, h.ack, h.window = true, tcp.Ack, tcp.Window
+	}
+}
+
+// Expire forgets every flow whose last packet was before t.
+func (tr *Tracker) Expire(t time.Time) {
+	for k, f := range tr.flows {
+		if f.last.Before(t) {
+			delete(tr.flows, k)
+		}
+	}
+}
+
+func newCell(t int64, client net.IP, c Counts) Cell {
+	return Cell{
+		Time:               time.Unix(0, t).UTC(),
+		Client:             client,
+		Counts:             c,
+		RetransmissionRate: c.RetransmissionRate(),
+		OutOfOrderRate:     c.OutOfOrderRate(),
+		DupACKRate:         c.DupACKRate(),
+	}
+}
+
+func sortCells(cells []Cell) {
+	sort.Slice(cells, func(i, j int) bool {
+		a, b := &cells[i], &cells[j]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		if c := bytes.Compare(a.Client, b.Client); c != 0 {
+			return c < 0
+		}
+		if a.ClientPort != b.ClientPort {
+			return a.ClientPort < b.ClientPort
+		}
+		if c := bytes.Compare(a.Server, b.Server); c != 0 {
+			return c < 0
+		}
+		return a.ServerPort < b.ServerPort
+	})
+}
+
+// FlowHeatmap returns a cell for each bucket of each flow, sorted by time
+// then flow.
+func (tr *Tracker) FlowHeatmap() []Cell {
+	var cells []Cell
+	for _, f := range tr.flows {
+		for t, c := range f.buckets {
+			cell := newCell(t, f.client, *c)
+			cell.ClientPort, cell.Server, cell.ServerPort = f.clientPort, f.server, f.serverPort
+			cells = append(cells, cell)
+		}
+	}
+	sortCells(cells)
+	return cells
+}
+
+// ClientHeatmap returns a cell for each bucket of each client, summing the
+// client's flows, sorted by time then client.
+func (tr *Tracker) ClientHeatmap() []Cell {
+	type key struct {
+		t      int64
+		client string
+	}
+	sums := map[key]*Cell{}
+	for _, f := range tr.flows {
+		for t, c := range f.buckets {
+			k := key{t, string(f.client)}
+			if sums[k] == nil {
+				cell := newCell(t, f.client, Counts{})
+				sums[k] = &cell
+			}
+			sums[k].Counts.add(*c)
+		}
+	}
+	cells := make([]Cell, 0, len(sums))
+	for _, cell := range sums {
+		c := cell.Counts
+		cells = append(cells, newCell(cell.Time.UnixNano(), cell.Client, c))
+	}
+	sortCells(cells)
+	return cells
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package tcpmetrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+var (
+	client = net.IP{10, 0, 0, 1}
+	server = net.IP{192, 0, 2, 1}
+	start  = time.Unix(1000, 0)
+)
+
+func segment(t *testing.T, ts time.Duration, fromClient bool, tcp *layers.TCP, n int) gopacket.Packet {
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: server, DstIP: client}
+	tcp.SrcPort, tcp.DstPort = 443, 40000
+	if fromClient {
+		ip.SrcIP, ip.DstIP = client, server
+		tcp.SrcPort, tcp.DstPort = 40000, 443
+	}
+	if tcp.Window == 0 {
+		tcp.Window = 1000
+	}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, ip, tcp, gopacket.Payload(make([]byte, n))); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	p.Metadata().Timestamp = start.Add(ts)
+	return p
+}
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(DefaultConfig)
+	ms := time.Millisecond
+	// The first packet seen is from the server, but the SYN says who the
+	// client is.
+	tr.Add(segment(t, 0, false, &layers.TCP{Seq: 1, ACK: true}, 100))
+	tr.Add(segment(t, 0, true, &layers.TCP{SYN: true, Seq: 99}, 0))
+	// Bucket 0: 101, a gap, 301 and 201 reordered, then 101 retransmitted.
+	tr.Add(segment(t, 1*ms, false, &layers.TCP{Seq: 101, ACK: true}, 100))
+	tr.Add(segment(t, 2*ms, false, &layers.TCP{Seq: 301, ACK: true}, 100))
+	tr.Add(segment(t, 3*ms, false, &layers.TCP{Seq: 201, ACK: true}, 100))
+	tr.Add(segment(t, 500*ms, false, &layers.TCP{Seq: 101, ACK: true}, 100))
+	// Bucket 1: three duplicate ACKs from the client.
+	for i := 0; i < 4; i++ {
+		tr.Add(segment(t, 10*time.Second, true, &layers.TCP{Seq: 100, Ack: 401, ACK: true}, 0))
+	}
+
+	cells := tr.FlowHeatmap()
+	if len(cells) != 2 {
+		t.Fatalf("got cells %+v", cells)
+	}
+	c := cells[0]
+	if !c.Client.Equal(client) || c.ClientPort != 40000 || !c.Server.Equal(server) || c.ServerPort != 443 || !c.Time.Equal(start) {
+		t.Errorf("got cell %+v", c)
+	}
+	if c.Segments != 6 || c.Retransmissions != 1 || c.OutOfOrder != 1 || c.RetransmissionRate != 1.0/6 {
+		t.Errorf("got cell %+v", c)
+	}
+	c = cells[1]
+	if c.ACKs != 4 || c.DupACKs != 3 || c.DupACKRate != 0.75 || !c.Time.Equal(start.Add(10*time.Second)) {
+		t.Errorf("got cell %+v", c)
+	}
+
+	// Another connection from the client adds to its client cells.
+	tr.Add(segment(t, 0, true, &layers.TCP{SYN: true, Seq: 0}, 0))
+	clients := tr.ClientHeatmap()
+	if len(clients) != 2 || clients[0].Segments != 7 || clients[0].Server != nil || clients[0].ClientPort != 0 {
+		t.Errorf("got client cells %+v", clients)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, clients[:1]); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["client"] != "10.0.0.1" || got["segments"] != 7.0 || got["retransmissions"] != 1.0 {
+		t.Errorf("got JSON %s", buf.Bytes())
+	}
+}
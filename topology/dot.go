@@ -0,0 +1,58 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package topology
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// WriteDOT writes g as a Graphviz graph, with a node per device and an
+// edge per link, labeled with the ports' IDs.  Root bridges are drawn
+// with a double border.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	roots := map[string]bool{}
+	for _, tr := range g.Trees {
+		for _, b := range tr.Bridges {
+			if bytes.Equal(b.ID.Address, tr.Root.Address) {
+				roots[b.Device] = true
+			}
+		}
+	}
+	fmt.Fprintln(bw, "graph topology {")
+	for _, d := range g.Devices {
+		label := d.ID
+		if d.Name != "" {
+			label = d.Name + "\n" + d.ID
+		}
+		shape := "box"
+		if roots[d.ID] {
+			shape = "doubleoctagon"
+		}
+		fmt.Fprintf(bw, "  %q [label=%q shape=%s];\n", d.ID, label, shape)
+	}
+	for _, l := range g.Links {
+		a, b := g.Ports[l.A], g.Ports[l.B]
+		fmt.Fprintf(bw, "  %q -- %q [taillabel=%q headlabel=%q];\n", a.Device, b.Device, portLabel(a), portLabel(b))
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func portLabel(p *Port) string {
+	label := p.ID
+	if label == "" {
+		label = p.MAC.String()
+	}
+	if p.NativeVLAN != 0 {
+		label = fmt.Sprintf("%s (VLAN %d)", label, p.NativeVLAN)
+	}
+	return label
+}
@@ -0,0 +1,475 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package topology infers the layer 2 topology of a network from the LLDP,
+// CDP and spanning tree frames in passive captures.
+//
+// Every advertisement and BPDU comes from a switch port on the segment it
+// was captured on, so each capture interface (the InterfaceIndex of the
+// packets) is taken as a segment, and the ports heard on the same segment
+// are adjacent.  Ports are identified by the source address of their
+// frames, which ties a port's LLDP, CDP and BPDUs together, and devices by
+// their LLDP chassis ID, CDP device ID or bridge address.  BPDUs add the
+// spanning trees: each tree's root and the bridges' costs to it.
+//
+//	top := topology.New()
+//	for p := range source.Packets() {
+//	  top.Add(p)
+//	}
+//	g := top.Graph(time.Time{})
+//	g.WriteDOT(os.Stdout)
+package topology
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+	"unicode"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// Device is a switch, or another device sending LLDP, CDP or BPDUs.
+type Device struct {
+	// ID is the LLDP chassis ID, CDP device ID or bridge address first
+	// heard from the device.
+	ID                string
+	Name, Description string
+	// Platform is the CDP platform.
+	Platform  string
+	Addresses []net.IP
+	// Bridges are the bridge IDs the device sends BPDUs with, one per
+	// spanning tree instance or VLAN.
+	Bridges  []layers.STPBridgeID
+	LastSeen time.Time
+}
+
+// STPPort is the spanning tree state of a port, from the last BPDU it
+// sent.
+type STPPort struct {
+	Version      layers.STPVersion
+	Role         layers.STPPortRole
+	Root         layers.STPBridgeID
+	RootPathCost uint32
+	Bridge       layers.STPBridgeID
+	PortID       uint16
+}
+
+// Port is a device's port heard on a segment.
+type Port struct {
+	Device string
+	// ID is the LLDP or CDP port ID, and is empty for ports only sending
+	// BPDUs.
+	ID          string
+	Description string
+	// MAC is the source address of the port's frames.
+	MAC     net.HardwareAddr
+	Segment int
+	// NativeVLAN is the port's untagged VLAN, from CDP or the LLDP port
+	// VLAN ID, or 0 if unknown.
+	NativeVLAN uint16
+	STP        *STPPort
+	LastSeen   time.Time
+	// Expires is when the port's last advertisement or BPDU goes stale.
+	Expires time.Time
+}
+
+// Link is an adjacency of two ports heard on the same segment.  A and B
+// index Graph.Ports.
+type Link struct {
+	A, B    int
+	Segment int
+}
+
+// Bridge is a bridge in a spanning tree.
+type Bridge struct {
+	ID           layers.STPBridgeID
+	RootPathCost uint32
+	// Device is the ID of the device sending the bridge's BPDUs.
+	Device string
+}
+
+// Tree is a spanning tree, one per VLAN for per-VLAN spanning trees and
+// one per MSTP region's CIST otherwise.
+type Tree struct {
+	// Instance is the system ID extension of the bridge IDs in the tree:
+	// the VLAN for per-VLAN spanning trees.
+	Instance uint16
+	Root     layers.STPBridgeID
+	// Bridges are ordered by their cost to the root.
+	Bridges []Bridge
+}
+
+// Graph is the topology inferred at some time.
+type Graph struct {
+	Devices []*Device
+	Ports   []*Port
+	Links   []Link
+	Trees   []Tree
+}
+
+// Topology accumulates the topology from packets.  It is not safe for
+// concurrent use.
+type Topology struct {
+	devices map[string]*Device
+	// ports are keyed by segment and MAC, and macs maps the source
+	// addresses heard to device IDs.
+	ports map[portKey]*Port
+	macs  map[string]string
+}
+
+type portKey struct {
+	segment int
+	mac     string
+}
+
+// New returns an empty Topology.
+func New() *Topology {
+	return &Topology{
+		devices: map[string]*Device{},
+		ports:   map[portKey]*Port{},
+		macs:    map[string]string{},
+	}
+}
+
+// stpHoldTime is how long a BPDU is taken to hold when its max age is
+// zero.
+const stpHoldTime = 20 * time.Second
+
+// Add updates the topology from p, returning whether p was an LLDP, CDP
+// or spanning tree frame.
+func (t *Topology) Add(p gopacket.Packet) bool {
+	eth, ok := p.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	if !ok {
+		return false
+	}
+	md := p.Metadata()
+	if l, ok := p.Layer(layers.LayerTypeLinkLayerDiscovery).(*layers.LinkLayerDiscovery); ok {
+		info, _ := p.Layer(layers.LayerTypeLinkLayerDiscoveryInfo).(*layers.LinkLayerDiscoveryInfo)
+		t.addLLDP(eth.SrcMAC, md.InterfaceIndex, md.Timestamp, l, info)
+		return true
+	}
+	if c, ok := p.Layer(layers.LayerTypeCiscoDiscovery).(*layers.CiscoDiscovery); ok {
+		info, ok := p.Layer(layers.LayerTypeCiscoDiscoveryInfo).(*layers.CiscoDiscoveryInfo)
+		if !ok {
+			return false
+		}
+		t.addCDP(eth.SrcMAC, md.InterfaceIndex, md.Timestamp, c, info)
+		return true
+	}
+	if s, ok := p.Layer(layers.LayerTypeSTP).(*layers.STP); ok {
+		if s.Type == layers.STPBPDUTypeTCN {
+			// Topology change notifications carry no bridge.
+			return true
+		}
+		t.addSTP(eth.SrcMAC, md.InterfaceIndex, md.Timestamp, s)
+		return true
+	}
+	return false
+}
+
+// device returns the device with the given ID, or the one already heard
+// from mac, creating it if there is neither.
+func (t *Topology) device(id string, mac net.HardwareAddr, ts time.Time) *Device {
+	if known, ok := t.macs[string(mac)]; ok {
+		id = known
+	}
+	d := t.devices[id]
+	if d == nil {
+		d = &Device{ID: id}
+		t.devices[id] = d
+	}
+	t.macs[string(mac)] = id
+	if ts.After(d.LastSeen) {
+		d.LastSeen = ts
+	}
+	return d
+}
+
+func (t *Topology) port(d *Device, mac net.HardwareAddr, segment int, ts, expires time.Time) *Port {
+	k := portKey{segment, string(mac)}
+	p := t.ports[k]
+	if p == nil {
+		p = &Port{MAC: append(net.HardwareAddr(nil), mac...), Segment: segment}
+		t.ports[k] = p
+	}
+	p.Device = d.ID
+	p.LastSeen = ts
+	if expires.After(p.Expires) {
+		p.Expires = expires
+	}
+	return p
+}
+
+func addAddress(d *Device, ip net.IP) {
+	for _, a := range d.Addresses {
+		if a.Equal(ip) {
+			return
+		}
+	}
+	d.Addresses = append(d.Addresses, append(net.IP(nil), ip...))
+}
+
+// printable returns b as a string if it's printable, and in hex otherwise.
+func printable(b []byte) string {
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) {
+			return hex.EncodeToString(b)
+		}
+	}
+	return string(b)
+}
+
+// lldpAddress formats an LLDP network address, which starts with its
+// address family.
+func lldpAddress(b []byte) (net.IP, bool) {
+	if len(b) == 0 {
+		return nil, false
+	}
+	switch layers.IANAAddressFamily(b[0]) {
+	case layers.IANAAddressFamilyIPV4:
+		if len(b) == 1+net.IPv4len {
+			return net.IP(b[1:]), true
+		}
+	case layers.IANAAddressFamilyIPV6:
+		if len(b) == 1+net.IPv6len {
+			return net.IP(b[1:]), true
+		}
+	}
+	return nil, false
+}
+
+func lldpChassisID(c layers.LLDPChassisID) string {
+	switch c.Subtype {
+	case layers.LLDPChassisIDSubTypeMACAddr:
+		if len(c.ID) == 6 {
+			return net.HardwareAddr(c.ID).String()
+		}
+	case layers.LLDPChassisIDSubTypeNetworkAddr:
+		if ip, ok := lldpAddress(c.ID); ok {
+			return ip.String()
+		}
+	}
+	return printable(c.ID)
+}
+
+func lldpPortID(id layers.LLDPPortID) string {
+	switch id.Subtype {
+	case layers.LLDPPortIDSubtypeMACAddr:
+		if len(id.ID) == 6 {
+			return net.HardwareAddr(id.ID).String()
+		}
+	case layers.LLDPPortIDSubtypeNetworkAddr:
+		if ip, ok := lldpAddress(id.ID); ok {
+			return ip.String()
+		}
+	}
+	return printable(id.ID)
+}
+
+func (t *Topology) addLLDP(mac net.HardwareAddr, segment int, ts time.Time, l *layers.LinkLayerDiscovery, info *layers.LinkLayerDiscoveryInfo) {
+	if l.TTL == 0 {
+		// The port is shutting down.
+		delete(t.ports, portKey{segment, string(mac)})
+		return
+	}
+	d := t.device(lldpChassisID(l.ChassisID), mac, ts)
+	p := t.port(d, mac, segment, ts, ts.Add(time.Duration(l.TTL)*time.Second))
+	p.ID = lldpPortID(l.PortID)
+	if info == nil {
+		return
+	}
+	if info.SysName != "" {
+		d.Name = info.SysName
+	}
+	if info.SysDescription != "" {
+		d.Description = info.SysDescription
+	}
+	if info.PortDescription != "" {
+		p.Description = info.PortDescription
+	}
+	switch info.MgmtAddress.Subtype {
+	case layers.IANAAddressFamilyIPV4, layers.IANAAddressFamilyIPV6:
+		if n := len(info.MgmtAddress.Address); n == net.IPv4len || n == net.IPv6len {
+			addAddress(d, net.IP(info.MgmtAddress.Address))
+		}
+	}
+	if dot1, err := info.Decode8021(); err == nil && dot1.PVID != 0 {
+		p.NativeVLAN = dot1.PVID
+	}
+}
+
+func (t *Topology) addCDP(mac net.HardwareAddr, segment int, ts time.Time, c *layers.CiscoDiscovery, info *layers.CiscoDiscoveryInfo) {
+	if c.TTL == 0 {
+		delete(t.ports, portKey{segment, string(mac)})
+		return
+	}
+	id := info.DeviceID
+	if id == "" {
+		id = mac.String()
+	}
+	d := t.device(id, mac, ts)
+	p := t.port(d, mac, segment, ts, ts.Add(time.Duration(c.TTL)*time.Second))
+	if info.PortID != "" {
+		p.ID = info.PortID
+	}
+	if info.NativeVLAN != 0 {
+		p.NativeVLAN = info.NativeVLAN
+	}
+	if info.SysName != "" && d.Name == "" {
+		d.Name = info.SysName
+	}
+	if info.Version != "" && d.Description == "" {
+		d.Description = info.Version
+	}
+	if info.Platform != "" {
+		d.Platform = info.Platform
+	}
+	for _, a := range info.Addresses {
+		addAddress(d, a)
+	}
+	for _, a := range info.MgmtAddresses {
+		addAddress(d, a)
+	}
+}
+
+func (t *Topology) addSTP(mac net.HardwareAddr, segment int, ts time.Time, s *layers.STP) {
+	// The bridge address is usually the device's base MAC, which is also
+	// its LLDP chassis ID.
+	d := t.device(s.BridgeID.Address.String(), mac, ts)
+	bridge := s.BridgeID
+	root := s.RootID
+	if s.MST != nil {
+		// The bridge ID of an MST BPDU is the CIST regional root; the
+		// bridge's own ID is the CIST bridge ID.
+		bridge = s.MST.CISTBridgeID
+	}
+	bridge.Address = append(net.HardwareAddr(nil), bridge.Address...)
+	root.Address = append(net.HardwareAddr(nil), root.Address...)
+	known := false
+	for i, b := range d.Bridges {
+		if b.SystemIDExtension == bridge.SystemIDExtension {
+			d.Bridges[i], known = bridge, true
+		}
+	}
+	if !known {
+		d.Bridges = append(d.Bridges, bridge)
+	}
+	hold := s.MaxAge
+	if hold == 0 {
+		hold = stpHoldTime
+	}
+	p := t.port(d, mac, segment, ts, ts.Add(hold))
+	p.STP = &STPPort{
+		Version:      s.Version,
+		Role:         s.Flags.Role(),
+		Root:         root,
+		RootPathCost: s.RootPathCost,
+		Bridge:       bridge,
+		PortID:       s.PortID,
+	}
+	if s.Type == layers.STPBPDUTypeConfig {
+		// Configuration BPDUs are only sent by designated ports.
+		p.STP.Role = layers.STPPortRoleDesignated
+	}
+}
+
+// Graph returns the topology as of now, leaving out ports whose
+// advertisements and BPDUs have gone stale, and devices with no ports
+// left.  A zero now includes everything heard.
+func (t *Topology) Graph(now time.Time) *Graph {
+	g := &Graph{}
+	devices := map[string]bool{}
+	for _, p := range t.ports {
+		if !now.IsZero() && now.After(p.Expires) {
+			continue
+		}
+		c := *p
+		if p.STP != nil {
+			s := *p.STP
+			c.STP = &s
+		}
+		g.Ports = append(g.Ports, &c)
+		devices[p.Device] = true
+	}
+	sort.Slice(g.Ports, func(i, j int) bool {
+		a, b := g.Ports[i], g.Ports[j]
+		if a.Segment != b.Segment {
+			return a.Segment < b.Segment
+		}
+		return bytes.Compare(a.MAC, b.MAC) < 0
+	})
+	for id := range devices {
+		d := *t.devices[id]
+		d.Addresses = append([]net.IP(nil), d.Addresses...)
+		d.Bridges = append([]layers.STPBridgeID(nil), d.Bridges...)
+		g.Devices = append(g.Devices, &d)
+	}
+	sort.Slice(g.Devices, func(i, j int) bool { return g.Devices[i].ID < g.Devices[j].ID })
+
+	for i, a := range g.Ports {
+		for j := i + 1; j < len(g.Ports) && g.Ports[j].Segment == a.Segment; j++ {
+			if g.Ports[j].Device != a.Device {
+				g.Links = append(g.Links, Link{A: i, B: j, Segment: a.Segment})
+			}
+		}
+	}
+	g.Trees = trees(g.Ports)
+	return g
+}
+
+// trees returns the spanning trees the ports' BPDUs describe.
+func trees(ports []*Port) []Tree {
+	byInstance := map[uint16]*Tree{}
+	seen := map[string]bool{}
+	for _, p := range ports {
+		if p.STP == nil {
+			continue
+		}
+		inst := p.STP.Bridge.SystemIDExtension
+		tr := byInstance[inst]
+		if tr == nil {
+			tr = &Tree{Instance: inst, Root: p.STP.Root}
+			byInstance[inst] = tr
+		} else if bridgeLess(p.STP.Root, tr.Root) {
+			// Bridges disagree on the root while the tree converges; the
+			// best root wins.
+			tr.Root = p.STP.Root
+		}
+		key := fmt.Sprint(inst, p.STP.Bridge)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		tr.Bridges = append(tr.Bridges, Bridge{ID: p.STP.Bridge, RootPathCost: p.STP.RootPathCost, Device: p.Device})
+	}
+	var out []Tree
+	for _, tr := range byInstance {
+		sort.Slice(tr.Bridges, func(i, j int) bool {
+			a, b := tr.Bridges[i], tr.Bridges[j]
+			if a.RootPathCost != b.RootPathCost {
+				return a.RootPathCost < b.RootPathCost
+			}
+			return bridgeLess(a.ID, b.ID)
+		})
+		out = append(out, *tr)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Instance < out[j].Instance })
+	return out
+}
+
+// bridgeLess reports whether a is a better bridge ID than b, as spanning
+// tree compares them.
+func bridgeLess(a, b layers.STPBridgeID) bool {
+	if a.Priority|a.SystemIDExtension != b.Priority|b.SystemIDExtension {
+		return a.Priority|a.SystemIDExtension < b.Priority|b.SystemIDExtension
+	}
+	return bytes.Compare(a.Address, b.Address) < 0
+}
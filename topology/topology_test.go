@@ -0,0 +1,158 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package topology
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+var (
+	sw1Base = net.HardwareAddr{0x00, 0x11, 0x22, 0x00, 0x00, 0x00}
+	sw1Port = net.HardwareAddr{0x00, 0x11, 0x22, 0x00, 0x00, 0x01}
+	sw2Port = net.HardwareAddr{0x00, 0x33, 0x44, 0x00, 0x00, 0x07}
+	start   = time.Unix(1500000000, 0)
+)
+
+func packet(t *testing.T, segment int, ts time.Time, ls ...gopacket.SerializableLayer) gopacket.Packet {
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ls...); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+	p.Metadata().InterfaceIndex = segment
+	p.Metadata().Timestamp = ts
+	return p
+}
+
+func tlv(typ int, value ...byte) []byte {
+	return append([]byte{byte(typ<<1) | byte(len(value)>>8), byte(len(value))}, value...)
+}
+
+func lldp(t *testing.T, segment int, ts time.Time) gopacket.Packet {
+	var b []byte
+	b = append(b, tlv(1, append([]byte{4}, sw1Base...)...)...)
+	b = append(b, tlv(2, append([]byte{5}, "Gi1/0/1"...)...)...)
+	b = append(b, tlv(3, 0, 120)...)
+	b = append(b, tlv(5, []byte("sw1")...)...)
+	b = append(b, tlv(127, 0x00, 0x80, 0xc2, 1, 0, 10)...)
+	b = append(b, tlv(0)...)
+	return packet(t, segment, ts,
+		&layers.Ethernet{SrcMAC: sw1Port, DstMAC: net.HardwareAddr{0x01, 0x80, 0xc2, 0, 0, 0x0e}, EthernetType: layers.EthernetTypeLinkLayerDiscovery},
+		gopacket.Payload(b))
+}
+
+func cdp(t *testing.T, segment int, ts time.Time) gopacket.Packet {
+	return packet(t, segment, ts,
+		&layers.Ethernet{SrcMAC: sw2Port, DstMAC: net.HardwareAddr{1, 0, 0x0c, 0xcc, 0xcc, 0xcc}, EthernetType: layers.EthernetTypeLLC},
+		&layers.LLC{DSAP: 0xaa, SSAP: 0xaa, Control: 3},
+		&layers.SNAP{OrganizationalCode: []byte{0, 0, 0x0c}, Type: layers.EthernetTypeCiscoDiscovery},
+		&layers.CiscoDiscovery{Version: 2, TTL: 180},
+		&layers.CiscoDiscoveryInfo{
+			DeviceID:   "sw2.example.com",
+			PortID:     "GigabitEthernet0/7",
+			Platform:   "cisco WS-C2960",
+			NativeVLAN: 10,
+			Addresses:  []net.IP{net.IPv4(192, 0, 2, 2).To4()},
+		})
+}
+
+func bpdu(t *testing.T, segment int, ts time.Time, src net.HardwareAddr, priority uint16, cost uint32) gopacket.Packet {
+	return packet(t, segment, ts,
+		&layers.Ethernet{SrcMAC: src, DstMAC: net.HardwareAddr{0x01, 0x80, 0xc2, 0, 0, 0}, EthernetType: layers.EthernetTypeLLC},
+		&layers.LLC{DSAP: 0x42, SSAP: 0x42, Control: layers.LLCControlUI},
+		&layers.STP{
+			Version:      layers.STPVersionRSTP,
+			Type:         layers.STPBPDUTypeRST,
+			Flags:        layers.STPFlags(layers.STPPortRoleDesignated << 2),
+			RootID:       layers.STPBridgeID{Priority: 4096, SystemIDExtension: 10, Address: sw1Base},
+			RootPathCost: cost,
+			BridgeID:     layers.STPBridgeID{Priority: priority, SystemIDExtension: 10, Address: src},
+			PortID:       0x8001,
+			MaxAge:       20 * time.Second,
+		})
+}
+
+func TestTopology(t *testing.T) {
+	top := New()
+	for _, p := range []gopacket.Packet{
+		lldp(t, 1, start),
+		bpdu(t, 1, start.Add(time.Second), sw1Port, 4096, 0),
+		cdp(t, 1, start.Add(2*time.Second)),
+		bpdu(t, 1, start.Add(3*time.Second), sw2Port, 32768, 4),
+	} {
+		if !top.Add(p) {
+			t.Fatalf("packet not added: %v", p)
+		}
+	}
+
+	g := top.Graph(start.Add(10 * time.Second))
+	if len(g.Devices) != 2 {
+		t.Fatalf("got %d devices, want 2: %+v", len(g.Devices), g.Devices)
+	}
+	sw1, sw2 := g.Devices[0], g.Devices[1]
+	if sw1.ID != sw1Base.String() || sw1.Name != "sw1" || len(sw1.Bridges) != 1 {
+		t.Errorf("sw1 = %+v", sw1)
+	}
+	if sw2.ID != "sw2.example.com" || sw2.Platform != "cisco WS-C2960" || len(sw2.Addresses) != 1 {
+		t.Errorf("sw2 = %+v", sw2)
+	}
+	if len(g.Ports) != 2 {
+		t.Fatalf("got %d ports, want 2", len(g.Ports))
+	}
+	p1, p2 := g.Ports[0], g.Ports[1]
+	if p1.Device != sw1.ID || p1.ID != "Gi1/0/1" || p1.NativeVLAN != 10 || p1.STP == nil || p1.STP.Role != layers.STPPortRoleDesignated {
+		t.Errorf("sw1 port = %+v", p1)
+	}
+	if p2.Device != sw2.ID || p2.ID != "GigabitEthernet0/7" || p2.NativeVLAN != 10 || p2.STP == nil {
+		t.Errorf("sw2 port = %+v", p2)
+	}
+	if want := []Link{{A: 0, B: 1, Segment: 1}}; len(g.Links) != 1 || g.Links[0] != want[0] {
+		t.Errorf("links = %+v, want %+v", g.Links, want)
+	}
+	if len(g.Trees) != 1 {
+		t.Fatalf("got %d trees, want 1", len(g.Trees))
+	}
+	tr := g.Trees[0]
+	if tr.Instance != 10 || !bytes.Equal(tr.Root.Address, sw1Base) || len(tr.Bridges) != 2 || tr.Bridges[0].Device != sw1.ID || tr.Bridges[1].RootPathCost != 4 {
+		t.Errorf("tree = %+v", tr)
+	}
+
+	var dot bytes.Buffer
+	if err := g.WriteDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dot.String(), `"00:11:22:00:00:00" -- "sw2.example.com" [taillabel="Gi1/0/1 (VLAN 10)"`) {
+		t.Errorf("DOT output missing link:\n%s", dot.String())
+	}
+
+	// The BPDUs go stale after 20s, and sw1's LLDP after 120s, but sw2's
+	// CDP holds for 180s.
+	g = top.Graph(start.Add(150 * time.Second))
+	if len(g.Devices) != 1 || g.Devices[0].ID != sw2.ID || len(g.Links) != 0 {
+		t.Errorf("stale graph = %+v", g)
+	}
+}
+
+func TestTopologySegments(t *testing.T) {
+	top := New()
+	top.Add(lldp(t, 1, start))
+	top.Add(cdp(t, 2, start))
+	g := top.Graph(time.Time{})
+	if len(g.Ports) != 2 || len(g.Links) != 0 {
+		t.Errorf("ports on different segments linked: %+v", g.Links)
+	}
+}
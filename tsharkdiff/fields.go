@@ -0,0 +1,198 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package tsharkdiff
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+)
+
+// LayerFields returns the Fields called names of layers of type t, whose
+// values value returns.
+func LayerFields(t gopacket.LayerType, value func(l gopacket.Layer, name string) (string, bool), names ...string) []Field {
+	fields := make([]Field, len(names))
+	for i, name := range names {
+		name := name
+		fields[i] = Field{Name: name, Layer: t, Value: func(l gopacket.Layer) (string, bool) { return value(l, name) }}
+	}
+	return fields
+}
+
+// dec formats an integer field in decimal.
+func dec(v uint64) (string, bool) {
+	return fmt.Sprint(v), true
+}
+
+// hex formats an integer field as tshark does hexadecimal fields, zero
+// padded to 4 digits.
+func hex(v uint64) (string, bool) {
+	return fmt.Sprintf("0x%04x", v), true
+}
+
+func ethernetValue(l gopacket.Layer, name string) (string, bool) {
+	e := l.(*layers.Ethernet)
+	switch name {
+	case "eth.src":
+		return e.SrcMAC.String(), true
+	case "eth.dst":
+		return e.DstMAC.String(), true
+	}
+	return "", false
+}
+
+func dot1QValue(l gopacket.Layer, name string) (string, bool) {
+	d := l.(*layers.Dot1Q)
+	switch name {
+	case "vlan.id":
+		return dec(uint64(d.VLANIdentifier))
+	case "vlan.priority":
+		return dec(uint64(d.Priority))
+	}
+	return "", false
+}
+
+func arpValue(l gopacket.Layer, name string) (string, bool) {
+	a := l.(*layers.ARP)
+	switch name {
+	case "arp.opcode":
+		return dec(uint64(a.Operation))
+	case "arp.src.proto_ipv4":
+		return net.IP(a.SourceProtAddress).String(), true
+	case "arp.dst.proto_ipv4":
+		return net.IP(a.DstProtAddress).String(), true
+	}
+	return "", false
+}
+
+func ipv4Value(l gopacket.Layer, name string) (string, bool) {
+	ip := l.(*layers.IPv4)
+	switch name {
+	case "ip.src":
+		return ip.SrcIP.String(), true
+	case "ip.dst":
+		return ip.DstIP.String(), true
+	case "ip.ttl":
+		return dec(uint64(ip.TTL))
+	case "ip.proto":
+		return dec(uint64(ip.Protocol))
+	case "ip.len":
+		return dec(uint64(ip.Length))
+	case "ip.id":
+		return hex(uint64(ip.Id))
+	case "ip.checksum":
+		return hex(uint64(ip.Checksum))
+	}
+	return "", false
+}
+
+func ipv6Value(l gopacket.Layer, name string) (string, bool) {
+	ip := l.(*layers.IPv6)
+	switch name {
+	case "ipv6.src":
+		return ip.SrcIP.String(), true
+	case "ipv6.dst":
+		return ip.DstIP.String(), true
+	case "ipv6.hlim":
+		return dec(uint64(ip.HopLimit))
+	case "ipv6.plen":
+		return dec(uint64(ip.Length))
+	}
+	return "", false
+}
+
+func tcpValue(l gopacket.Layer, name string) (string, bool) {
+	t := l.(*layers.TCP)
+	switch name {
+	case "tcp.srcport":
+		return dec(uint64(t.SrcPort))
+	case "tcp.dstport":
+		return dec(uint64(t.DstPort))
+	case "tcp.seq_raw":
+		return dec(uint64(t.Seq))
+	case "tcp.flags":
+		var f uint64
+		for i, set := range []bool{t.FIN, t.SYN, t.RST, t.PSH, t.ACK, t.URG, t.ECE, t.CWR, t.NS} {
+			if set {
+				f |= 1 << uint(i)
+			}
+		}
+		return hex(f)
+	case "tcp.window_size_value":
+		return dec(uint64(t.Window))
+	case "tcp.checksum":
+		return hex(uint64(t.Checksum))
+	}
+	return "", false
+}
+
+func udpValue(l gopacket.Layer, name string) (string, bool) {
+	u := l.(*layers.UDP)
+	switch name {
+	case "udp.srcport":
+		return dec(uint64(u.SrcPort))
+	case "udp.dstport":
+		return dec(uint64(u.DstPort))
+	case "udp.length":
+		return dec(uint64(u.Length))
+	case "udp.checksum":
+		return hex(uint64(u.Checksum))
+	}
+	return "", false
+}
+
+func icmpv4Value(l gopacket.Layer, name string) (string, bool) {
+	i := l.(*layers.ICMPv4)
+	switch name {
+	case "icmp.type":
+		return dec(uint64(i.TypeCode.Type()))
+	case "icmp.code":
+		return dec(uint64(i.TypeCode.Code()))
+	}
+	return "", false
+}
+
+func dnsValue(l gopacket.Layer, name string) (string, bool) {
+	d := l.(*layers.DNS)
+	switch name {
+	case "dns.id":
+		return hex(uint64(d.ID))
+	case "dns.count.queries":
+		return dec(uint64(d.QDCount))
+	case "dns.count.answers":
+		return dec(uint64(d.ANCount))
+	case "dns.qry.name":
+		if len(d.Questions) > 0 {
+			return string(d.Questions[0].Name), true
+		}
+	}
+	return "", false
+}
+
+// DefaultFields are the fields of the link, network and transport layers
+// most captures have, and of DNS.
+var DefaultFields = concat(
+	LayerFields(layers.LayerTypeEthernet, ethernetValue, "eth.src", "eth.dst"),
+	LayerFields(layers.LayerTypeDot1Q, dot1QValue, "vlan.id", "vlan.priority"),
+	LayerFields(layers.LayerTypeARP, arpValue, "arp.opcode", "arp.src.proto_ipv4", "arp.dst.proto_ipv4"),
+	LayerFields(layers.LayerTypeIPv4, ipv4Value, "ip.src", "ip.dst", "ip.ttl", "ip.proto", "ip.len", "ip.id", "ip.checksum"),
+	LayerFields(layers.LayerTypeIPv6, ipv6Value, "ipv6.src", "ipv6.dst", "ipv6.hlim", "ipv6.plen"),
+	LayerFields(layers.LayerTypeTCP, tcpValue, "tcp.srcport", "tcp.dstport", "tcp.seq_raw", "tcp.flags", "tcp.window_size_value", "tcp.checksum"),
+	LayerFields(layers.LayerTypeUDP, udpValue, "udp.srcport", "udp.dstport", "udp.length", "udp.checksum"),
+	LayerFields(layers.LayerTypeICMPv4, icmpv4Value, "icmp.type", "icmp.code"),
+	LayerFields(layers.LayerTypeDNS, dnsValue, "dns.id", "dns.count.queries", "dns.count.answers", "dns.qry.name"),
+)
+
+func concat(fs ...[]Field) []Field {
+	var out []Field
+	for _, f := range fs {
+		out = append(out, f...)
+	}
+	return out
+}
@@ -0,0 +1,260 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+// Package tsharkdiff compares gopacket's decoding of a capture with
+// Wireshark's, to find regressions and differences in the layers both
+// decode.
+//
+// Run decodes a pcap or pcapng file with gopacket, and has tshark decode it
+// to JSON, then compares a set of fields packet by packet.  Each Field
+// names a tshark field, and extracts the same value from the gopacket
+// layer in the format tshark prints it.  The Report counts the fields
+// compared and the mismatches per layer, with a few examples of each.
+// Fields that neither decoder finds in a packet aren't counted, so a
+// field only one of them finds is a mismatch.  Only the first occurrence
+// of a field in a packet is compared, so with tunnels only the outer
+// layers are.
+//
+// Check wraps Run for tests, skipping them if tshark isn't installed:
+//
+//	func TestWiresharkParity(t *testing.T) {
+//	  tsharkdiff.Check(t, "testdata/capture.pcap", tsharkdiff.DefaultFields)
+//	}
+package tsharkdiff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/pcapgo"
+)
+
+// Field is a field decoded by both gopacket and tshark.
+type Field struct {
+	// Name is the tshark field name, such as "ip.ttl".
+	Name string
+	// Layer is the gopacket layer holding the field.
+	Layer gopacket.LayerType
+	// Value returns the field of the first layer of type Layer, formatted
+	// as tshark prints it, and false if the layer doesn't have it.
+	Value func(l gopacket.Layer) (string, bool)
+}
+
+// Mismatch is a field whose values differ.
+type Mismatch struct {
+	// Packet is the packet's number, from 1 as in Wireshark.
+	Packet          int
+	Field           string
+	Gopacket, Shark string
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("packet %d %s: gopacket %q, tshark %q", m.Packet, m.Field, m.Gopacket, m.Shark)
+}
+
+// FieldReport counts the comparisons of a field.
+type FieldReport struct {
+	Compared, Mismatched int
+	// Examples holds the first MaxExamples mismatches.
+	Examples []Mismatch
+}
+
+// LayerReport is the comparison of the fields of a layer.
+type LayerReport struct {
+	Compared, Mismatched int
+	Fields               map[string]*FieldReport
+}
+
+// Report is the result of a comparison.
+type Report struct {
+	Packets int
+	Layers  map[gopacket.LayerType]*LayerReport
+}
+
+// MaxExamples is the number of mismatches a FieldReport keeps.
+const MaxExamples = 5
+
+// Mismatched returns the number of mismatched fields over all layers.
+func (r *Report) Mismatched() int {
+	n := 0
+	for _, l := range r.Layers {
+		n += l.Mismatched
+	}
+	return n
+}
+
+func (r *Report) add(f Field, packet int, ours string, okOurs bool, theirs string, okTheirs bool) {
+	if !okOurs && !okTheirs {
+		return
+	}
+	lr := r.Layers[f.Layer]
+	if lr == nil {
+		lr = &LayerReport{Fields: map[string]*FieldReport{}}
+		r.Layers[f.Layer] = lr
+	}
+	fr := lr.Fields[f.Name]
+	if fr == nil {
+		fr = &FieldReport{}
+		lr.Fields[f.Name] = fr
+	}
+	lr.Compared++
+	fr.Compared++
+	if okOurs && okTheirs && ours == theirs {
+		return
+	}
+	lr.Mismatched++
+	fr.Mismatched++
+	if len(fr.Examples) < MaxExamples {
+		if !okOurs {
+			ours = "<missing>"
+		}
+		if !okTheirs {
+			theirs = "<missing>"
+		}
+		fr.Examples = append(fr.Examples, Mismatch{Packet: packet, Field: f.Name, Gopacket: ours, Shark: theirs})
+	}
+}
+
+// WriteTo writes the report as text, one line per layer and per field with
+// mismatches, followed by their examples.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d packets, %d mismatched fields\n", r.Packets, r.Mismatched())
+	layerTypes := make([]gopacket.LayerType, 0, len(r.Layers))
+	for t := range r.Layers {
+		layerTypes = append(layerTypes, t)
+	}
+	sort.Slice(layerTypes, func(i, j int) bool { return layerTypes[i].String() < layerTypes[j].String() })
+	for _, t := range layerTypes {
+		lr := r.Layers[t]
+		fmt.Fprintf(&b, "%v: %d/%d fields match\n", t, lr.Compared-lr.Mismatched, lr.Compared)
+		names := make([]string, 0, len(lr.Fields))
+		for name := range lr.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fr := lr.Fields[name]
+			if fr.Mismatched == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "  %s: %d/%d mismatched\n", name, fr.Mismatched, fr.Compared)
+			for _, m := range fr.Examples {
+				fmt.Fprintf(&b, "    %v\n", m)
+			}
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Available reports whether tshark is installed.
+func Available() bool {
+	_, err := exec.LookPath("tshark")
+	return err == nil
+}
+
+// Run compares the decoding of the capture at path by gopacket and by
+// tshark, for fields.
+func Run(ctx context.Context, path string, fields []Field) (*Report, error) {
+	args := []string{"-r", path, "-n", "-T", "json"}
+	for _, f := range fields {
+		args = append(args, "-e", f.Name)
+	}
+	out, err := exec.CommandContext(ctx, "tshark", args...).Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("tsharkdiff: tshark: %v: %s", err, ee.Stderr)
+		}
+		return nil, fmt.Errorf("tsharkdiff: tshark: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := pcapgo.NewAnyReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return Compare(r, bytes.NewReader(out), fields)
+}
+
+// sharkPacket is a packet in tshark's JSON output, with -e fields.
+type sharkPacket struct {
+	Source struct {
+		Layers map[string][]string `json:"layers"`
+	} `json:"_source"`
+}
+
+// Compare compares the packets from r with tshark's JSON output for the
+// same capture, produced with -T json and -e for each of fields.
+func Compare(r pcapgo.PacketReader, tshark io.Reader, fields []Field) (*Report, error) {
+	var shark []sharkPacket
+	if err := json.NewDecoder(tshark).Decode(&shark); err != nil {
+		return nil, fmt.Errorf("tsharkdiff: decoding tshark output: %v", err)
+	}
+	report := &Report{Layers: map[gopacket.LayerType]*LayerReport{}}
+	source := gopacket.NewPacketSource(r, r.LinkType())
+	for i := 0; ; i++ {
+		p, err := source.NextPacket()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if i >= len(shark) {
+			return nil, fmt.Errorf("tsharkdiff: tshark decoded %d packets, gopacket more", len(shark))
+		}
+		report.Packets++
+		theirs := shark[i].Source.Layers
+		for _, f := range fields {
+			var ours string
+			okOurs := false
+			if l := p.Layer(f.Layer); l != nil {
+				ours, okOurs = f.Value(l)
+			}
+			v, okTheirs := theirs[f.Name]
+			var first string
+			if okTheirs = okTheirs && len(v) > 0; okTheirs {
+				first = v[0]
+			}
+			report.add(f, i+1, ours, okOurs, first, okTheirs)
+		}
+	}
+	if report.Packets < len(shark) {
+		return nil, fmt.Errorf("tsharkdiff: tshark decoded %d packets, gopacket %d", len(shark), report.Packets)
+	}
+	return report, nil
+}
+
+// Check runs Run for a test, and reports each mismatch as an error.  It
+// skips the test if tshark isn't installed.
+func Check(t testing.TB, path string, fields []Field) *Report {
+	t.Helper()
+	if !Available() {
+		t.Skip("tshark not installed")
+	}
+	r, err := Run(context.Background(), path, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Mismatched() > 0 {
+		var b strings.Builder
+		r.WriteTo(&b)
+		t.Errorf("%s: differences from tshark:\n%s", path, b.String())
+	}
+	return r
+}
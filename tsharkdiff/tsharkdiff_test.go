@@ -0,0 +1,106 @@
+// Copyright 2016 Google, Inc. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package tsharkdiff
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mistsys/gopacket"
+	"github.com/mistsys/gopacket/layers"
+	"github.com/mistsys/gopacket/pcapgo"
+)
+
+// capture returns a pcap file with a UDP packet from each of ports.
+func capture(t *testing.T, ports ...layers.UDPPort) []byte {
+	var file bytes.Buffer
+	w := pcapgo.NewWriter(&file)
+	if err := w.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	for _, port := range ports {
+		eth := &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, DstMAC: net.HardwareAddr{6, 7, 8, 9, 10, 11}, EthernetType: layers.EthernetTypeIPv4}
+		ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+		udp := &layers.UDP{SrcPort: port, DstPort: 9}
+		udp.SetNetworkLayerForChecksum(ip)
+		buf := gopacket.NewSerializeBuffer()
+		if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, eth, ip, udp, gopacket.Payload("x")); err != nil {
+			t.Fatal(err)
+		}
+		ci := gopacket.CaptureInfo{Timestamp: time.Unix(0, 0), CaptureLength: len(buf.Bytes()), Length: len(buf.Bytes())}
+		if err := w.WritePacket(ci, buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return file.Bytes()
+}
+
+// The first packet matches, the second has a different TTL and a field
+// tshark didn't find.
+const sharkJSON = `[
+  {"_source": {"layers": {"eth.src": ["00:01:02:03:04:05"], "ip.ttl": ["64"], "ip.proto": ["17"], "udp.srcport": ["1000"], "udp.length": ["9"]}}},
+  {"_source": {"layers": {"eth.src": ["00:01:02:03:04:05"], "ip.ttl": ["63"], "ip.proto": ["17"], "udp.srcport": ["2000"]}}}
+]`
+
+var testFields = concat(
+	LayerFields(layers.LayerTypeEthernet, ethernetValue, "eth.src"),
+	LayerFields(layers.LayerTypeIPv4, ipv4Value, "ip.ttl", "ip.proto"),
+	LayerFields(layers.LayerTypeUDP, udpValue, "udp.srcport", "udp.length"),
+	LayerFields(layers.LayerTypeTCP, tcpValue, "tcp.srcport"),
+)
+
+func TestCompare(t *testing.T) {
+	r, err := pcapgo.NewReader(bytes.NewReader(capture(t, 1000, 2000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Compare(r, strings.NewReader(sharkJSON), testFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Packets != 2 {
+		t.Errorf("got %d packets, want 2", report.Packets)
+	}
+	if got := report.Mismatched(); got != 2 {
+		t.Errorf("got %d mismatches, want 2", got)
+	}
+	if _, ok := report.Layers[layers.LayerTypeTCP]; ok {
+		t.Error("TCP fields compared, but neither decoder found them")
+	}
+	ip := report.Layers[layers.LayerTypeIPv4]
+	if ip == nil || ip.Compared != 4 || ip.Mismatched != 1 {
+		t.Fatalf("got IPv4 report %+v, want 4 compared, 1 mismatched", ip)
+	}
+	want := Mismatch{Packet: 2, Field: "ip.ttl", Gopacket: "64", Shark: "63"}
+	if ex := ip.Fields["ip.ttl"].Examples; len(ex) != 1 || ex[0] != want {
+		t.Errorf("got examples %v, want %v", ex, want)
+	}
+	var b strings.Builder
+	report.WriteTo(&b)
+	for _, s := range []string{
+		"2 packets, 2 mismatched fields\n",
+		"IPv4: 3/4 fields match\n",
+		`packet 2 udp.length: gopacket "9", tshark "<missing>"`,
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("report missing %q:\n%s", s, b.String())
+		}
+	}
+}
+
+func TestComparePacketCount(t *testing.T) {
+	r, err := pcapgo.NewReader(bytes.NewReader(capture(t, 1000, 2000, 3000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Compare(r, strings.NewReader(sharkJSON), testFields); err == nil {
+		t.Error("packet count difference not reported")
+	}
+}
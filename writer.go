@@ -6,6 +6,8 @@
 
 package gopacket
 
+import "fmt"
+
 // SerializableLayer allows its implementations to be written out as a set of bytes,
 // so those bytes may be sent on the wire or otherwise used by the caller.
 // SerializableLayer is implemented by certain Layer types, and can be encoded to
@@ -43,6 +45,29 @@ type SerializeOptions struct {
 	// ComputeChecksums determines whether, during serialization, layers
 	// should recompute checksums based on their payloads.
 	ComputeChecksums bool
+	// MaxFrameSize, if not 0, is the largest packet SerializeLayers may
+	// write.  Larger packets make it return a *FrameSizeError, rather than a
+	// packet that the link it is built for would drop.  Set it to the
+	// link's largest frame, such as 1514 for Ethernet without tags, or 9014
+	// for Ethernet with jumbo frames.
+	MaxFrameSize int
+	// Deterministic makes SerializeLayers zero the bytes it hands layers to
+	// write, so the bytes they leave unset, such as padding and reserved
+	// fields, are zero rather than left over from earlier use of the
+	// buffer.  Layers write options and other repeated fields in the order
+	// of their slices, so with Deterministic the same layers always
+	// serialize to the same bytes, as golden file tests need.
+	Deterministic bool
+}
+
+// FrameSizeError is returned by SerializeLayers when a packet is larger than
+// SerializeOptions.MaxFrameSize.
+type FrameSizeError struct {
+	Length, Max int
+}
+
+func (e *FrameSizeError) Error() string {
+	return fmt.Sprintf("serialized packet of %d bytes exceeds maximum frame size %d", e.Length, e.Max)
 }
 
 // SerializeBuffer is a helper used by gopacket for writing out packet layers.
@@ -183,6 +208,9 @@ func (w *serializeBuffer) Clear() error {
 //   secondPayload := buf.Bytes()  // contains byte representation of d(e(f)). firstPayload is now invalidated, since the SerializeLayers call Clears buf.
 func SerializeLayers(w SerializeBuffer, opts SerializeOptions, layers ...SerializableLayer) error {
 	w.Clear()
+	if opts.Deterministic {
+		w = zeroingBuffer{w}
+	}
 	for i := len(layers) - 1; i >= 0; i-- {
 		layer := layers[i]
 		err := layer.SerializeTo(w, opts)
@@ -190,5 +218,30 @@ func SerializeLayers(w SerializeBuffer, opts SerializeOptions, layers ...Seriali
 			return err
 		}
 	}
+	if opts.MaxFrameSize > 0 && len(w.Bytes()) > opts.MaxFrameSize {
+		return &FrameSizeError{Length: len(w.Bytes()), Max: opts.MaxFrameSize}
+	}
 	return nil
 }
+
+// zeroingBuffer is a SerializeBuffer whose Prepend/Append calls return
+// zeroed bytes.
+type zeroingBuffer struct {
+	SerializeBuffer
+}
+
+func (w zeroingBuffer) PrependBytes(num int) ([]byte, error) {
+	b, err := w.SerializeBuffer.PrependBytes(num)
+	for i := range b {
+		b[i] = 0
+	}
+	return b, err
+}
+
+func (w zeroingBuffer) AppendBytes(num int) ([]byte, error) {
+	b, err := w.SerializeBuffer.AppendBytes(num)
+	for i := range b {
+		b[i] = 0
+	}
+	return b, err
+}
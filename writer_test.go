@@ -92,3 +92,44 @@ func ExampleSerializeBuffer() {
 	// 6: []
 	// 7: [9 9]
 }
+
+func TestSerializeMaxFrameSize(t *testing.T) {
+	buf := NewSerializeBuffer()
+	data := Payload(make([]byte, 1600))
+	err := SerializeLayers(buf, SerializeOptions{MaxFrameSize: 1514}, data)
+	if e, ok := err.(*FrameSizeError); !ok || e.Length != 1600 || e.Max != 1514 {
+		t.Errorf("got error %v", err)
+	}
+	if err := SerializeLayers(buf, SerializeOptions{MaxFrameSize: 9014}, data); err != nil {
+		t.Error(err)
+	}
+}
+
+// sparseLayer writes only the first of the bytes it prepends.
+type sparseLayer int
+
+func (s sparseLayer) SerializeTo(b SerializeBuffer, opts SerializeOptions) error {
+	bytes, err := b.PrependBytes(int(s))
+	if err != nil {
+		return err
+	}
+	bytes[0] = 1
+	return nil
+}
+
+func TestSerializeDeterministic(t *testing.T) {
+	buf := NewSerializeBuffer()
+	dirty := Payload{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	opts := SerializeOptions{Deterministic: true}
+	for i := 0; i < 2; i++ {
+		if err := SerializeLayers(buf, SerializeOptions{}, dirty); err != nil {
+			t.Fatal(err)
+		}
+		if err := SerializeLayers(buf, opts, sparseLayer(4), sparseLayer(4)); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fmt.Sprintf("%x", buf.Bytes()), "0100000001000000"; got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}